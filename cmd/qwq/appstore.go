@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"qwq/internal/appstore"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultAppStoreCacheDir 模板仓库默认克隆目录
+const defaultAppStoreCacheDir = "data/appstore-sources"
+
+// newAppStoreSyncService 连接数据库并根据配置创建模板同步服务
+func newAppStoreSyncService() (*appstore.SyncService, error) {
+	cfg := config.Current()
+	db, err := openServiceDB(appStoreSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]appstore.TemplateSource, 0, len(cfg.AppStore.Sources))
+	for _, source := range cfg.AppStore.Sources {
+		sources = append(sources, appstore.TemplateSource{
+			ID:        source.ID,
+			URL:       source.URL,
+			Branch:    source.Branch,
+			DeployKey: source.DeployKey,
+		})
+	}
+	cacheDir := cfg.AppStore.CacheDir
+	if cacheDir == "" {
+		cacheDir = defaultAppStoreCacheDir
+	}
+	return appstore.NewSyncService(db, sources, cacheDir), nil
+}
+
+// newAppStoreCommand 应用商店管理命令
+func newAppStoreCommand() *cobra.Command {
+	appStoreCmd := &cobra.Command{Use: "appstore", Short: "Manage app store templates"}
+
+	var force bool
+	syncCmd := &cobra.Command{
+		Use:   "sync [source-id]",
+		Short: "Sync templates from the configured Git sources",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			syncService, err := newAppStoreSyncService()
+			if err != nil {
+				fmt.Printf("❌ 模板同步失败: %v\n", err)
+				logger.Close()
+				os.Exit(1)
+			}
+
+			var results []*appstore.SyncResult
+			if len(args) == 1 {
+				var result *appstore.SyncResult
+				if result, err = syncService.Sync(cmd.Context(), args[0], force); result != nil {
+					results = append(results, result)
+				}
+			} else {
+				results, err = syncService.SyncAll(cmd.Context(), force)
+			}
+
+			failed := err != nil
+			for _, result := range results {
+				logger.Info("[AUDIT] 📦 模板源已同步: %s@%s force=%v by %s", result.SourceID, result.Commit, force, currentUser())
+				printSyncResult(result)
+				failed = failed || len(result.Failed) > 0
+			}
+			if err != nil {
+				fmt.Printf("❌ 模板同步失败: %v\n", err)
+			}
+			if failed {
+				logger.Close()
+				os.Exit(1)
+			}
+		},
+	}
+	syncCmd.Flags().BoolVar(&force, "force", false, "Overwrite locally modified templates")
+
+	appStoreCmd.AddCommand(syncCmd)
+	return appStoreCmd
+}
+
+// printSyncResult 输出单个模板源的同步结果
+func printSyncResult(result *appstore.SyncResult) {
+	fmt.Printf("📦 %s @ %s\n", result.SourceID, result.Commit)
+	for _, group := range []struct {
+		icon  string
+		names []string
+	}{
+		{"➕", result.Added},
+		{"🔄", result.Updated},
+		{"⚠️ ", result.Deprecated},
+		{"🗑️ ", result.Removed},
+	} {
+		for _, name := range group.names {
+			fmt.Printf("  %s %s\n", group.icon, name)
+		}
+	}
+	for _, failure := range result.Failed {
+		fmt.Printf("  ❌ %s: %s\n", failure.Template, failure.Reason)
+	}
+	fmt.Printf("  added %d, updated %d, unchanged %d, deprecated %d, removed %d, failed %d\n",
+		len(result.Added), len(result.Updated), len(result.Unchanged), len(result.Deprecated), len(result.Removed), len(result.Failed))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"qwq/internal/archive"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/database"
+	"qwq/internal/logger"
+	"qwq/internal/monitoring"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// incidentResources 审计日志中表示告警的资源类型，引用未关闭告警的审计记录不归档
+var incidentResources = []string{"alert", "alerts", "incident", "incidents"}
+
+// newArchiver 根据配置创建归档任务：告警（只归档已解决的）、审计日志（不归档引用未关闭告警的记录）和自愈记录
+func newArchiver() (*archive.Archiver, error) {
+	alertsDB, err := openServiceDB(monitoringSchema)
+	if err != nil {
+		return nil, err
+	}
+	coreDB, err := openServiceDB(database.CoreSchema)
+	if err != nil {
+		return nil, err
+	}
+	containerDB, err := openServiceDB(containerSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []archive.Table{
+		{
+			Name:  "alerts",
+			DB:    alertsDB,
+			Model: &monitoring.Alert{},
+			Exclude: func(ctx context.Context, tx *gorm.DB) (*gorm.DB, error) {
+				return tx.Where("status = ?", monitoring.AlertStatusResolved), nil
+			},
+		},
+		{
+			Name:  "audit_logs",
+			DB:    coreDB,
+			Model: &database.AuditLog{},
+			Exclude: func(ctx context.Context, tx *gorm.DB) (*gorm.DB, error) {
+				var open []uint
+				if err := alertsDB.WithContext(ctx).Model(&monitoring.Alert{}).
+					Where("status <> ?", monitoring.AlertStatusResolved).Pluck("id", &open).Error; err != nil {
+					return nil, fmt.Errorf("failed to list open alerts: %w", err)
+				}
+				if len(open) == 0 {
+					return tx, nil
+				}
+				ids := make([]string, len(open))
+				for i, id := range open {
+					ids[i] = strconv.FormatUint(uint64(id), 10)
+				}
+				return tx.Where("NOT (resource IN ? AND resource_id IN ?)", incidentResources, ids), nil
+			},
+		},
+		{
+			Name:       "failure_records",
+			DB:         containerDB,
+			Model:      &container.FailureRecord{},
+			TimeColumn: "detected_at",
+		},
+	}
+
+	cfg := config.Current().Archive
+	dir := cfg.Dir
+	if dir == "" {
+		dir = "archive"
+	}
+	archiver := archive.NewArchiver(dir, time.Duration(cfg.MaxAgeDays)*24*time.Hour, tables...)
+	if cfg.S3.Endpoint != "" {
+		archiver.SetUploader(&archive.S3Uploader{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		})
+	}
+	return archiver, nil
+}
+
+// enableArchive 配置启用归档时创建全局归档任务，由定时任务 archive 执行
+func enableArchive() {
+	if !config.Current().Archive.Enabled {
+		return
+	}
+	archiver, err := newArchiver()
+	if err != nil {
+		logger.Info("⚠️ 归档数据库不可用，历史记录不会被归档: %v", err)
+		return
+	}
+	archive.SetDefault(archiver)
+}
+
+// newArchiveCommand 历史记录归档命令
+func newArchiveCommand() *cobra.Command {
+	archiveCmd := &cobra.Command{Use: "archive", Short: "Archive old alerts, audit logs and self-healing records"}
+
+	var dryRun bool
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Export records older than archive.max_age_days and remove them from the database",
+		Run: func(cmd *cobra.Command, args []string) {
+			archiver, err := newArchiver()
+			if err != nil {
+				exitArchive("归档数据库不可用: %v", err)
+			}
+			result, err := archiver.Run(context.Background(), dryRun)
+			if err != nil {
+				exitArchive("保存归档结果失败: %v", err)
+			}
+			if dryRun {
+				fmt.Printf("🔍 试运行：以下早于 %s 的记录将被归档\n", result.Cutoff.Format("2006-01-02 15:04"))
+			}
+			for _, table := range result.Tables {
+				fmt.Printf("📦 %s: %d 条", table.Table, table.Rows)
+				if !dryRun {
+					fmt.Printf("，已删除 %d 条", table.Deleted)
+				}
+				fmt.Println()
+				for _, file := range table.Files {
+					target := file.Path
+					if file.Object != "" {
+						target += " (已上传 " + file.Object + ")"
+					}
+					fmt.Printf("  %s  %6d 条  %s\n", file.Day, file.Rows, target)
+				}
+				if table.Error != "" {
+					fmt.Printf("  ❌ %s\n", table.Error)
+				}
+			}
+			if result.Failed() {
+				logger.Close()
+				os.Exit(1)
+			}
+		},
+	}
+	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be archived")
+
+	var table string
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Load an archive file back into the database for investigation",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			archiver, err := newArchiver()
+			if err != nil {
+				exitArchive("归档数据库不可用: %v", err)
+			}
+			total, imported, err := archiver.Import(context.Background(), args[0], table)
+			if err != nil {
+				exitArchive("%v", err)
+			}
+			fmt.Printf("✅ 已导入 %d 条记录（文件中共 %d 条，已存在的跳过）\n", imported, total)
+			logger.Info("[AUDIT] 📦 归档文件已导入: %s (%d 条) by %s", args[0], imported, currentUser())
+		},
+	}
+	importCmd.Flags().StringVar(&table, "table", "", "Target table, inferred from the file name by default")
+
+	archiveCmd.AddCommand(runCmd, importCmd)
+	return archiveCmd
+}
+
+func exitArchive(format string, args ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", args...)
+	logger.Close()
+	os.Exit(1)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"qwq/internal/security"
+
+	"github.com/spf13/cobra"
+)
+
+// loadAutoExecPolicy 根据配置加载自动执行策略；规则无效（如正则表达式错误）时拒绝启动，不会退回到其他策略
+func loadAutoExecPolicy() error {
+	policy, err := security.NewAutoExecPolicy(config.Current().AutoExec)
+	if err != nil {
+		return fmt.Errorf("自动执行策略 autoexec 无效: %w", err)
+	}
+	security.SetAutoExecPolicy(policy)
+	return nil
+}
+
+// newConfigCommand 配置管理命令
+func newConfigCommand() *cobra.Command {
+	configCmd := &cobra.Command{Use: "config", Short: "Inspect qwq configuration"}
+
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Validate the configuration and run the autoexec policy tests",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := *config.Current()
+			// ValidateWebhooks 会就地规范化命名渠道，复制切片避免修改当前快照
+			cfg.NotifyRouting.Channels = append([]config.NotifyChannelConfig(nil), cfg.NotifyRouting.Channels...)
+			result, err := checkConfig(&cfg)
+			if result != nil {
+				source := "配置文件"
+				if result.policy.Builtin() {
+					source = "内置默认"
+				}
+				fmt.Printf("⚙️  自动执行策略: %s, %d 条规则, 默认 %s\n", source, len(result.policy.Rules()), result.policy.Default())
+				for _, failure := range result.failures {
+					fmt.Printf("  ❌ %q: 期望 %s, 实际 %s (规则: %s)\n", failure.Command, failure.Expect, failure.Got, failure.Rule)
+				}
+			}
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				logger.Close()
+				os.Exit(1)
+			}
+			for _, warning := range result.warnings {
+				fmt.Printf("⚠️  通知地址可疑: %s\n", warning)
+			}
+			fmt.Println("✅ 配置检查通过")
+		},
+	}
+
+	configCmd.AddCommand(checkCmd)
+	return configCmd
+}
+
+// configCheck 配置检查结果
+type configCheck struct {
+	policy   *security.AutoExecPolicy
+	failures []security.CaseFailure
+	warnings []string
+}
+
+// checkConfig 执行 qwq config check 的全部校验，qwq init 用它校验生成的配置。
+// 通知地址会被就地规范化；自动执行策略有效时即使后续校验失败也返回结果，便于输出测试用例
+func checkConfig(cfg *config.Config) (*configCheck, error) {
+	policy, failures, err := security.ValidateAutoExecConfig(cfg.AutoExec)
+	if err != nil {
+		return nil, fmt.Errorf("自动执行策略无效: %w", err)
+	}
+	result := &configCheck{policy: policy, failures: failures}
+	if len(failures) > 0 {
+		return result, fmt.Errorf("%d 个测试用例未通过", len(failures))
+	}
+	if _, err := notify.NewRouter(cfg.NotifyRouting); err != nil {
+		return result, fmt.Errorf("通知路由配置无效: %w", err)
+	}
+	if result.warnings, err = config.ValidateWebhooks(cfg); err != nil {
+		return result, fmt.Errorf("通知地址配置无效: %w", err)
+	}
+	if err := config.Validate(cfg); err != nil {
+		return result, err
+	}
+	return result, nil
+}
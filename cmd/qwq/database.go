@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"qwq/internal/agent"
+	"qwq/internal/apitoken"
+	"qwq/internal/appstore"
+	"qwq/internal/backup"
+	"qwq/internal/cache"
+	"qwq/internal/chathistory"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/database"
+	"qwq/internal/drift"
+	"qwq/internal/events"
+	"qwq/internal/incident"
+	"qwq/internal/jobs"
+	"qwq/internal/logger"
+	"qwq/internal/maintenance"
+	"qwq/internal/monitor"
+	"qwq/internal/monitoring"
+	"qwq/internal/ownership"
+	"qwq/internal/patrol"
+	"qwq/internal/portaudit"
+	"qwq/internal/remote"
+	"qwq/internal/server"
+	"qwq/internal/utils"
+	"qwq/internal/website"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// appStoreSchema 应用商店表结构，模型变化时递增版本
+var appStoreSchema = database.Schema{
+	Service: "appstore",
+	Version: 2,
+	Models:  []interface{}{&appstore.AppTemplate{}, &appstore.ApplicationInstance{}},
+}
+
+// containerSchema Compose 项目、部署历史、部署流水线、定时分析历史和自愈记录表结构
+var containerSchema = database.Schema{
+	Service: "container",
+	Version: 4,
+	Models: []interface{}{
+		&container.ComposeProject{}, &container.ComposeRevision{}, &container.Deployment{},
+		&container.DeploymentEvent{}, &container.ServiceInstance{}, &container.FailureRecord{},
+		&container.Pipeline{}, &container.AnalysisRun{},
+	},
+}
+
+// cacheSchema 延迟写入的缓存条目表结构
+var cacheSchema = database.Schema{
+	Service: "cache",
+	Version: 1,
+	Models:  []interface{}{&cache.Entry{}},
+}
+
+// jobsSchema 定时任务执行记录和暂停状态表结构
+var jobsSchema = database.Schema{
+	Service: "jobs",
+	Version: 1,
+	Models:  []interface{}{&jobs.JobRun{}, &jobs.JobState{}},
+}
+
+// tokenSchema API 令牌表结构
+var tokenSchema = database.Schema{
+	Service: "tokens",
+	Version: 1,
+	Models:  []interface{}{&apitoken.Token{}},
+}
+
+// dashboardSchema Web 控制台的用户、角色、网站和操作审计表结构
+var dashboardSchema = database.Schema{
+	Service: "dashboard",
+	Version: 2,
+	Models:  server.DashboardModels,
+}
+
+// chatSchema Web 控制台对话、消息和关联数据表结构
+var chatSchema = database.Schema{
+	Service: "chat",
+	Version: 1,
+	Models:  []interface{}{&chathistory.Conversation{}, &chathistory.Message{}, &chathistory.Artifact{}},
+}
+
+// eventsSchema 事件时间线表结构
+var eventsSchema = database.Schema{
+	Service: "events",
+	Version: 1,
+	Models:  []interface{}{&events.Event{}},
+}
+
+// maintenanceSchema 维护窗口和被静默的事件表结构
+var maintenanceSchema = database.Schema{
+	Service: "maintenance",
+	Version: 1,
+	Models:  []interface{}{&maintenance.Window{}, &maintenance.SuppressedEvent{}},
+}
+
+// monitoringSchema 监控指标定义、告警规则和告警表结构
+var monitoringSchema = database.Schema{
+	Service: "monitoring",
+	Version: 1,
+	Models:  []interface{}{&monitoring.MetricDefinition{}, &monitoring.AlertRule{}, &monitoring.Alert{}},
+}
+
+// websiteSchema 网站、反向代理、SSL 证书和 DNS 记录表结构
+var websiteSchema = database.Schema{
+	Service: "website",
+	Version: 3,
+	Models:  []interface{}{&website.Website{}, &website.ProxyConfig{}, &website.SSLCert{}, &website.DNSRecord{}},
+}
+
+// remoteSchema 通过 SSH 巡检和执行命令的远程主机表结构
+var remoteSchema = database.Schema{
+	Service: "remote",
+	Version: 1,
+	Models:  []interface{}{&remote.Host{}},
+}
+
+// anomaliesSchema 巡检记录和异常历史表结构
+var anomaliesSchema = database.Schema{
+	Service: "anomalies",
+	Version: 1,
+	Models:  monitor.AnomalyModels,
+}
+
+// configureDatabase 根据配置设置各服务数据库连接的分配方式
+func configureDatabase() {
+	cfg := config.Current().Database
+	database.Configure(database.HandleConfig{
+		Config: database.Config{
+			Type:         cfg.Type,
+			Host:         cfg.Host,
+			Port:         cfg.Port,
+			User:         cfg.User,
+			Password:     cfg.Password,
+			DBName:       cfg.DBName,
+			SSLMode:      cfg.SSLMode,
+			DSN:          cfg.DSN,
+			FilePath:     cfg.Path,
+			Debug:        config.Current().DebugMode,
+			BusyTimeout:  time.Duration(cfg.BusyTimeoutMS) * time.Millisecond,
+			MaxOpenConns: cfg.MaxOpenConns,
+		},
+		Dir: cfg.Dir,
+	})
+	// 迁移到 PostgreSQL 后仍指向 SQLite 时各服务的数据库都会打开失败，启动时明确提示一次
+	for _, schema := range allSchemas {
+		if file := database.HandleFile(schema.Service); file != "" {
+			if marker := database.MigratedTo(file); marker != nil {
+				logger.Info("⛔ %s 已迁移到 %s，不再使用；请把 database.type 改为 postgres", file, marker.Target)
+				return
+			}
+		}
+	}
+}
+
+// openServiceDB 获取服务的数据库连接并执行其表结构迁移（已迁移到当前版本时跳过）
+func openServiceDB(schema database.Schema) (*gorm.DB, error) {
+	db, err := database.Handle(schema.Service)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.Migrate(db, schema); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// enableCachePersistence 把进程内缓存（AI 分析结果、HTTP 检查结果）延迟写入 cache 数据库，重启后恢复未过期的条目
+func enableCachePersistence() {
+	if config.Current().Cache.NoPersist {
+		return
+	}
+	db, err := openServiceDB(cacheSchema)
+	if err == nil {
+		err = cache.Default.Persist(context.Background(), db)
+	}
+	if err != nil {
+		logger.Info("⚠️ 缓存数据库不可用，缓存只保存在内存中: %v", err)
+		return
+	}
+	go utils.Supervise(context.Background(), "cache-flush", cache.Default.Run)
+}
+
+// enableDeploymentTools 为 Agent 接入部署和自愈服务，数据库不可用时部署工具报告未配置
+func enableDeploymentTools() {
+	db, err := openServiceDB(containerSchema)
+	if err != nil {
+		logger.Info("⚠️ 部署服务数据库不可用，Agent 部署工具已禁用: %v", err)
+		return
+	}
+	agent.SetDeploymentBackend(&agent.DeploymentBackend{
+		Compose: container.NewComposeService(db),
+		Healing: container.NewSelfHealingService(db, container.NewDockerExecutor(), nil),
+	})
+}
+
+// enableOptimizerAdvisor Compose 优化建议在 AI 可用时附带 AI 补充，与巡检分析共用限流和预算
+func enableOptimizerAdvisor() {
+	container.SetOptimizationAdvisor(agent.OptimizationAdvisor{})
+}
+
+// enableContainerLogCheck 巡检时检查容器日志大小，部署服务数据库可用时标记 qwq 管理的项目以提供一键修复
+func enableContainerLogCheck() {
+	if config.Current().Patrol.ContainerLogs.Disabled {
+		return
+	}
+	executor := container.NewDockerExecutor()
+	db, err := openServiceDB(containerSchema)
+	if err != nil {
+		logger.Info("⚠️ 部署服务数据库不可用，容器日志告警不提供一键修复: %v", err)
+		patrol.ContainerLogs = func(ctx context.Context) ([]container.LogFile, error) {
+			return container.ScanLogFiles(ctx, executor)
+		}
+		return
+	}
+	patrol.ContainerLogs = container.NewLogRotationService(container.NewComposeService(db), executor).Scan
+}
+
+// enablePortAudit 部署 Compose 项目和安装应用前检查主机端口，除监听的 socket 外还与运行中的容器、
+// 其他项目和应用实例发布的端口比较；某个数据库不可用时只跳过对应来源
+func enablePortAudit() {
+	if lister, ok := container.NewDockerExecutor().(container.ContainerLister); ok {
+		portaudit.Default.SetSource("containers", container.ContainerPortSource(lister))
+	}
+	if db, err := openServiceDB(containerSchema); err == nil {
+		portaudit.Default.SetSource("projects", container.ProjectPortSource(db))
+	} else {
+		logger.Info("⚠️ 部署服务数据库不可用，端口检查不包含其他 Compose 项目: %v", err)
+	}
+	if db, err := openServiceDB(appStoreSchema); err == nil {
+		portaudit.Default.SetSource("apps", appstore.InstancePortSource(appstore.NewAppStoreService(db)))
+	} else {
+		logger.Info("⚠️ 应用商店数据库不可用，端口检查不包含应用实例: %v", err)
+	}
+}
+
+// enableSearchSources 全局搜索包含 DNS 记录和应用实例，对应数据库不可用时只跳过该数据源
+func enableSearchSources() {
+	if db, err := openServiceDB(websiteSchema); err == nil {
+		server.RegisterSearchSource(server.DNSRecordSearchSource(website.NewDNSService(db)))
+	} else {
+		logger.Info("⚠️ 网站数据库不可用，全局搜索不包含 DNS 记录: %v", err)
+	}
+	if db, err := openServiceDB(appStoreSchema); err == nil {
+		server.RegisterSearchSource(server.AppInstanceSearchSource(appstore.NewAppStoreService(db)))
+	} else {
+		logger.Info("⚠️ 应用商店数据库不可用，全局搜索不包含应用实例: %v", err)
+	}
+}
+
+// enableAppProbes 应用商店安装完成后执行模板声明的验证探针，探针与 Compose 部署的 probes 一样由容器模块执行
+func enableAppProbes() {
+	runner := container.NewProbeRunner(container.NewDockerExecutor())
+	appstore.SetProbeRunner(func(ctx context.Context, projectName, content string, probes []appstore.TemplateProbe) error {
+		composeConfig, err := container.NewComposeParser().Parse(content)
+		if err != nil {
+			return err
+		}
+		converted := make([]container.DeployProbe, 0, len(probes))
+		for _, probe := range probes {
+			converted = append(converted, container.DeployProbe{
+				Name: probe.Name, Type: container.ProbeType(probe.Type),
+				URL: probe.URL, ExpectStatus: probe.ExpectStatus, ExpectBody: probe.ExpectBody,
+				Address: probe.Address,
+				Service: probe.Service, Command: probe.Command, ExpectExitCode: probe.ExpectExitCode,
+				Delay: probe.Delay, Retries: probe.Retries, Interval: probe.Interval, Timeout: probe.Timeout,
+			})
+		}
+		if err := container.ValidateProbes(converted, composeConfig); err != nil {
+			return err
+		}
+		return runner.Run(ctx, projectName, composeConfig.Services, converted, func(probe *container.DeployProbe, result *container.ProbeResult) {
+			if result != nil {
+				logger.Info("应用 %s 安装验证 %s: 通过=%v，%d 次尝试", projectName, result.Probe, result.Passed, result.Attempts)
+			}
+		})
+	})
+}
+
+// newAnalysisHistory 创建 Compose 项目定时分析服务，部署服务数据库不可用时返回错误
+func newAnalysisHistory() (*container.AnalysisHistory, error) {
+	db, err := openServiceDB(containerSchema)
+	if err != nil {
+		return nil, err
+	}
+	return container.NewAnalysisHistory(db, container.NewComposeService(db)), nil
+}
+
+// enableDriftWatch 检测托管的 nginx 配置和 compose 项目文件被外部修改，
+// 对应服务的数据库可用时才支持保留外部修改（导入到站点自定义配置或 compose 修订）
+func enableDriftWatch() {
+	if !drift.Enabled() {
+		return
+	}
+	if db, err := openServiceDB(websiteSchema); err == nil {
+		drift.Default.SetHandler(drift.KindNginx, website.NewNginxDriftHandler(website.NewWebsiteService(db), website.NewProxyService(db)))
+	} else {
+		logger.Info("⚠️ 网站数据库不可用，nginx 配置的外部修改只能覆盖: %v", err)
+	}
+	if db, err := openServiceDB(containerSchema); err == nil {
+		drift.Default.SetHandler(drift.KindCompose, container.NewComposeDriftHandler(container.NewComposeService(db)))
+	} else {
+		logger.Info("⚠️ 部署服务数据库不可用，compose 文件的外部修改只能覆盖: %v", err)
+	}
+	go utils.Supervise(context.Background(), "drift-watch", drift.Default.Run)
+}
+
+// enableCertRenewal 巡检时续期进入续期窗口的证书，续期后重载 nginx；Web 控制台通过同一个证书服务申请证书
+func enableCertRenewal() {
+	db, err := openServiceDB(websiteSchema)
+	if err != nil {
+		logger.Info("⚠️ 网站数据库不可用，不能申请和自动续期证书: %v", err)
+		return
+	}
+	certs, proxies := website.NewSSLService(db), website.NewProxyService(db)
+	patrol.CertRenewals = func(ctx context.Context) ([]website.RenewalResult, error) {
+		return website.RenewDue(ctx, certs, proxies.ReloadNginx)
+	}
+	server.SetCertificateService(certs)
+}
+
+// applyStagedRestores 在打开数据库之前替换从配置备份恢复的数据库文件
+func applyStagedRestores() {
+	var files []string
+	for _, schema := range allSchemas {
+		files = append(files, database.HandleFile(schema.Service))
+	}
+	applied, err := backup.ApplyStagedRestores(files)
+	for _, file := range applied {
+		logger.Info("♻️ 已用配置备份恢复数据库 %s，原文件保存为 %s.before-restore", file, file)
+	}
+	if err != nil {
+		logger.Info("❌ 恢复数据库失败: %v", err)
+	}
+}
+
+// enableConfigBackup 备份 nginx 站点配置、compose 项目、SQLite 数据库和配置文件，巡检时每天自动备份一次；
+// 某个数据库不可用时只跳过对应来源
+func enableConfigBackup() {
+	cfg := config.Current()
+	sources := backup.ConfigSources{NginxDir: cfg.Backup.NginxDir, ConfigFiles: config.Files()}
+	if sources.NginxDir == "" {
+		sources.NginxDir = cfg.Websites.NginxSitesDir
+	}
+	for _, schema := range allSchemas {
+		file := database.HandleFile(schema.Service)
+		if file == "" {
+			continue
+		}
+		db, _ := database.Handle(schema.Service) // 打不开的数据库直接复制文件
+		sources.Databases = append(sources.Databases, backup.DatabaseFile{Path: file, DB: db})
+	}
+	if db, err := openServiceDB(containerSchema); err == nil {
+		sources.Compose = container.ComposeBackupStore(container.NewComposeService(db))
+	} else {
+		logger.Info("⚠️ 部署服务数据库不可用，配置备份不包含 compose 项目: %v", err)
+	}
+
+	manager := backup.NewConfigBackupManager(cfg.Backup, sources, nil)
+	server.SetConfigBackups(manager)
+	if !cfg.Backup.DisableSchedule {
+		patrol.ConfigBackups = manager
+	}
+}
+
+// enableAPITokens 启用 API 令牌，数据库不可用时 Bearer 认证全部拒绝
+func enableAPITokens() *apitoken.Manager {
+	db, err := openServiceDB(tokenSchema)
+	if err != nil {
+		logger.Info("⚠️ API 令牌数据库不可用，只能使用用户名密码访问 API: %v", err)
+		return nil
+	}
+	manager := apitoken.NewManager(db)
+	apitoken.SetDefault(manager)
+	return manager
+}
+
+// enableDashboardStore 把 Web 控制台的用户、角色和网站保存到 dashboard 数据库，重启后保留；
+// 数据库不可用时只保存在内存中
+func enableDashboardStore() {
+	db, err := openServiceDB(dashboardSchema)
+	if err != nil {
+		logger.Info("⚠️ 控制台数据库不可用，用户、角色和网站重启后丢失: %v", err)
+		return
+	}
+	server.SetDashboardDB(db)
+}
+
+// enableChatHistory 启用 Web 控制台的对话历史，删除对话时一并删除关联的复盘对话记录；
+// 数据库不可用或已关闭时对话不保存
+func enableChatHistory() {
+	cfg := config.Current().ChatHistory
+	if cfg.Disabled {
+		return
+	}
+	db, err := openServiceDB(chatSchema)
+	if err != nil {
+		logger.Info("⚠️ 对话历史数据库不可用，Web 对话不会保存: %v", err)
+		return
+	}
+	manager := chathistory.NewManager(db, chathistory.Limits{
+		MaxMessages:          cfg.MaxMessages,
+		MaxConversationBytes: int64(cfg.MaxConversationKB) << 10,
+		MaxUserBytes:         int64(cfg.MaxUserMB) << 20,
+	})
+	manager.RegisterPurger(chathistory.ArtifactTranscript, func(session string) error {
+		return incident.DefaultTranscripts.Delete(session)
+	})
+	chathistory.SetDefault(manager)
+}
+
+// openEvents 打开事件时间线并设为全局存储，数据库不可用或已关闭时返回 nil，不记录事件
+func openEvents() *events.Store {
+	cfg := config.Current().Events
+	if cfg.Disabled {
+		return nil
+	}
+	db, err := openServiceDB(eventsSchema)
+	if err != nil {
+		logger.Info("⚠️ 事件时间线数据库不可用，不记录事件: %v", err)
+		return nil
+	}
+	store := events.NewStore(db, time.Duration(cfg.RetentionDays)*24*time.Hour)
+	events.SetDefault(store)
+	return store
+}
+
+// enableEvents 启用事件时间线并订阅 Docker 事件
+func enableEvents() {
+	store := openEvents()
+	if store == nil || config.Current().Events.DisableDocker {
+		return
+	}
+	collector, err := events.NewDockerCollector(store)
+	if err != nil {
+		logger.Info("⚠️ 无法连接 Docker，时间线不包含 Docker 事件: %v", err)
+		return
+	}
+	go utils.Supervise(context.Background(), "docker-events", collector.Run)
+}
+
+// enableOwnershipTransfer 登记各模块带所属用户的表，删除用户时把其网站、DNS 记录、Compose 项目、部署和应用实例转给指定用户；
+// 数据库不可用的服务不参与转移
+func enableOwnershipTransfer() {
+	registry := ownership.NewRegistry()
+	for _, owned := range []struct {
+		schema database.Schema
+		models []interface{}
+	}{
+		{websiteSchema, []interface{}{&website.Website{}, &website.ProxyConfig{}, &website.SSLCert{}, &website.DNSRecord{}}},
+		{containerSchema, []interface{}{&container.ComposeProject{}, &container.Deployment{}}},
+		{appStoreSchema, []interface{}{&appstore.ApplicationInstance{}}},
+	} {
+		db, err := openServiceDB(owned.schema)
+		if err == nil {
+			err = registry.Register(owned.schema.Service, db, owned.models...)
+		}
+		if err != nil {
+			logger.Info("⚠️ %s 数据库不可用，删除用户时不会转移其中的资源: %v", owned.schema.Service, err)
+		}
+	}
+	ownership.SetDefault(registry)
+}
+
+// enableMaintenance 启用维护窗口并接入通知静默，数据库不可用时告警照常发送
+func enableMaintenance() *maintenance.Manager {
+	db, err := openServiceDB(maintenanceSchema)
+	if err != nil {
+		logger.Info("⚠️ 维护窗口数据库不可用，告警不会被静默: %v", err)
+		return nil
+	}
+	manager := maintenance.NewManager(db)
+	maintenance.SetDefault(manager)
+	return manager
+}
+
+// enableRemoteHosts 启用远程主机：巡检时逐台通过 SSH 检查，Web 控制台采集各主机的监控数据，对话可通过 /host 切换执行目标；
+// 数据库不可用时只巡检本机
+func enableRemoteHosts() *remote.Manager {
+	db, err := openServiceDB(remoteSchema)
+	if err != nil {
+		logger.Info("⚠️ 远程主机数据库不可用，只巡检本机: %v", err)
+		return nil
+	}
+	manager := remote.NewManager(db)
+	remote.SetDefault(manager)
+	patrol.RemoteHosts = manager
+	server.SetRemoteHosts(manager)
+	return manager
+}
+
+// enableAnomalyHistory 巡检结束后保存巡检记录和异常，控制台据此展示最近的异常；数据库不可用或已关闭时不保存
+func enableAnomalyHistory() {
+	cfg := config.Current().Anomalies
+	if cfg.Disabled {
+		return
+	}
+	db, err := openServiceDB(anomaliesSchema)
+	if err != nil {
+		logger.Info("⚠️ 异常历史数据库不可用，不保存巡检异常: %v", err)
+		return
+	}
+	monitor.SetDefaultAnomalies(monitor.NewAnomalyStore(db, time.Duration(cfg.RetentionDays)*24*time.Hour))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// probeWebhooksAtStartup 配置 webhook_probe 时在后台探测通知渠道连通性并记录到日志
+func probeWebhooksAtStartup() {
+	if !config.Current().WebhookProbe {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, result := range notify.ProbeChannels(ctx) {
+			if result.OK {
+				logger.Info("📡 通知渠道 %s (%s) 可用: %s", result.Channel, result.Type, result.Detail)
+			} else {
+				logger.Info("⚠️ 通知渠道 %s (%s) 不可用: %s", result.Channel, result.Type, result.Detail)
+			}
+		}
+	}()
+}
+
+// newDoctorCommand 环境自检命令：检查通知地址配置并探测通知渠道连通性
+func newDoctorCommand() *cobra.Command {
+	var skipProbe bool
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check notification webhooks and probe their connectivity",
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := false
+			fmt.Println("🩺 通知渠道")
+			if config.Current().DingTalkWebhook == "" && config.Current().TelegramToken == "" && len(config.Current().NotifyRouting.Channels) == 0 {
+				fmt.Println("  ⚠️ 未配置任何通知渠道")
+			}
+			for _, warning := range config.WebhookWarnings() {
+				fmt.Printf("  ⚠️ %s\n", warning)
+			}
+			if _, err := notify.NewRouter(config.Current().NotifyRouting); err != nil {
+				fmt.Printf("  ❌ 通知路由配置无效: %v\n", err)
+				failed = true
+			}
+
+			if !skipProbe {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				for _, result := range notify.ProbeChannels(ctx) {
+					mark := "✅"
+					if !result.OK {
+						mark = "❌"
+						failed = true
+					}
+					fmt.Printf("  %s %s (%s) %s [%s]\n", mark, result.Channel, result.Type, result.Detail, result.Latency.Round(time.Millisecond))
+				}
+				cancel()
+			}
+
+			if failed {
+				logger.Close()
+				os.Exit(1)
+			}
+			fmt.Println("✅ 自检通过")
+		},
+	}
+	cmd.Flags().BoolVar(&skipProbe, "no-probe", false, "Only validate the configuration, do not contact the webhooks")
+	return cmd
+}
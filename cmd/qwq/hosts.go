@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"qwq/internal/agent"
+	"qwq/internal/remote"
+	"qwq/internal/utils"
+	"strings"
+)
+
+// chatTarget 命令行对话的执行目标，/host <name> 切换后快速命令和 Agent 执行的命令都在该主机上通过 SSH 执行
+type chatTarget struct {
+	manager  *remote.Manager // 远程主机数据库不可用时为 nil，只能在本机执行
+	executor remote.Executor
+}
+
+func newChatTarget(manager *remote.Manager) *chatTarget {
+	return &chatTarget{manager: manager, executor: remote.Local}
+}
+
+// remoteName 当前的远程主机名称，在本机执行时为空
+func (t *chatTarget) remoteName() string {
+	if t.executor.Name() == remote.LocalName {
+		return ""
+	}
+	return t.executor.Name()
+}
+
+// suffix 提示信息中的执行目标，在本机执行时为空
+func (t *chatTarget) suffix() string {
+	if name := t.remoteName(); name != "" {
+		return " @" + name
+	}
+	return ""
+}
+
+// run 在当前目标上执行命令
+func (t *chatTarget) run(ctx context.Context, cmd string) *utils.ShellResult {
+	return t.executor.Run(ctx, cmd, utils.ShellOptions{})
+}
+
+// context Agent 步骤使用的上下文，目标为远程主机时命令转到该主机执行
+func (t *chatTarget) context() context.Context {
+	ctx := context.Background()
+	if t.remoteName() == "" {
+		return ctx
+	}
+	return agent.WithShellRunner(ctx, t.run)
+}
+
+// handle 处理 /host 和 /host <name>，不是该命令时返回 false
+func (t *chatTarget) handle(line string, color func(code, text string) string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "/host" {
+		return false
+	}
+	if t.manager == nil {
+		fmt.Println(color("33", "⚠️ 远程主机不可用，命令只能在本机执行"))
+		return true
+	}
+	ctx := context.Background()
+
+	if len(fields) == 1 {
+		hosts, err := t.manager.List(ctx)
+		if err != nil {
+			fmt.Println(color("33", fmt.Sprintf("⚠️ 读取远程主机失败: %v", err)))
+			return true
+		}
+		fmt.Println(color("36", "当前执行目标: "+t.executor.Name()))
+		mark := func(name string) string {
+			if name == t.executor.Name() {
+				return "*"
+			}
+			return " "
+		}
+		fmt.Printf("%s %s\n", mark(remote.LocalName), remote.LocalName)
+		for _, host := range hosts {
+			labels := ""
+			if len(host.Labels) > 0 {
+				labels = "  [" + strings.Join(host.Labels, ",") + "]"
+			}
+			fmt.Printf("%s %s  %s@%s:%d%s\n", mark(host.Name), host.Name, host.User, host.Address, host.Port, labels)
+		}
+		fmt.Println(color("90", "使用 /host <name> 切换，/host local 回到本机"))
+		return true
+	}
+
+	executor, err := t.manager.Executor(ctx, fields[1])
+	if err != nil {
+		fmt.Println(color("33", fmt.Sprintf("⚠️ %v", err)))
+		return true
+	}
+	if executor.Name() != remote.LocalName {
+		// 切换时先连接一次，主机无法连接时保留原来的目标
+		if res := executor.Run(ctx, "true", utils.ShellOptions{}); res.ExitCode == -1 && res.Err != "" {
+			fmt.Println(color("33", fmt.Sprintf("⚠️ 无法连接 %s: %s", executor.Name(), res.Err)))
+			return true
+		}
+	}
+	t.executor = executor
+	fmt.Println(color("36", "🖥️ 执行目标已切换到 "+executor.Name()))
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"qwq/internal/incident"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// newIncidentCommand 巡检事件命令
+func newIncidentCommand() *cobra.Command {
+	incidentCmd := &cobra.Command{Use: "incident", Short: "Inspect patrol incidents"}
+
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Write the postmortem bundle of a patrol incident to a zip file",
+		Long: "Bundles the incident timeline, linked chat transcripts, executed commands, audit log lines,\n" +
+			"stats history, events recorded in the same window and AI analysis. Reads the files persisted\n" +
+			"by the running web or patrol process.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				exitIncident("无效的事件 ID: %s", args[0])
+			}
+			if err := patrol.DefaultStore.Load(patrol.DefaultRunsFile); err != nil {
+				exitIncident("加载巡检记录失败: %v", err)
+			}
+			if err := monitor.DefaultHistory.Load(); err != nil {
+				exitIncident("加载监控历史失败: %v", err)
+			}
+			// 复盘包包含同时段的 Docker 事件、部署和配置变更
+			openEvents()
+			if output == "" {
+				output = fmt.Sprintf("incident-%d.zip", id)
+			}
+
+			// 直接写入文件，大包不会占用内存
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				exitIncident("创建文件失败: %v", err)
+			}
+			if err := incident.NewBundle().Write(f, id); err != nil {
+				f.Close()
+				os.Remove(output)
+				exitIncident("%v", err)
+			}
+			if err := f.Close(); err != nil {
+				exitIncident("写入文件失败: %v", err)
+			}
+			fmt.Printf("✅ 事件 #%d 的复盘包已保存到 %s\n", id, output)
+			logger.Info("[AUDIT] 📦 事件复盘包已导出: #%d -> %s by %s", id, output, currentUser())
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default incident-<id>.zip)")
+
+	incidentCmd.AddCommand(exportCmd)
+	return incidentCmd
+}
+
+func exitIncident(format string, args ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", args...)
+	logger.Close()
+	os.Exit(1)
+}
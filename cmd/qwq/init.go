@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"qwq/internal/agent"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"qwq/internal/patrol"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// initOptions qwq init 的命令行参数，非交互模式下直接作为配置值
+type initOptions struct {
+	nonInteractive   bool
+	force            bool
+	skipChecks       bool
+	generatePassword bool
+	baseURL          string
+	apiKey           string
+	model            string
+	notify           string
+	slackWebhook     string
+	telegramToken    string
+	telegramChatID   string
+	diskThreshold    int
+	loadThreshold    float64
+	clockWarnMS      int
+	modules          []string
+	systemdPath      string
+	composePath      string
+}
+
+// initWizard 逐步收集配置，每一步都经过与 qwq config check 相同的校验
+type initWizard struct {
+	opts *initOptions
+	cmd  *cobra.Command
+	rl   *readline.Instance // 非交互模式为 nil
+	cfg  *config.Config
+}
+
+// newInitCommand 交互式生成配置文件
+func newInitCommand() *cobra.Command {
+	opts := &initOptions{}
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Interactively generate a validated config file",
+		Long: "Walks through the AI endpoint, notification channel, web credentials, patrol thresholds and optional modules, " +
+			"validates every value like `qwq config check` and writes a commented config file (default ./qwq.json, or -c).",
+		// 配置文件可能还不存在，跳过全局的配置加载
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		Run: func(cmd *cobra.Command, args []string) {
+			runInit(cmd, opts)
+		},
+	}
+
+	flags := initCmd.Flags()
+	flags.BoolVar(&opts.nonInteractive, "non-interactive", false, "Use flag values and defaults without prompting")
+	flags.BoolVar(&opts.force, "force", false, "Overwrite an existing config instead of merging into it")
+	flags.BoolVar(&opts.skipChecks, "skip-checks", false, "Skip the live AI endpoint call and the test notification")
+	flags.BoolVar(&opts.generatePassword, "generate-password", false, "Generate a strong web dashboard password")
+	flags.StringVar(&opts.baseURL, "base-url", envOr("OPENAI_BASE_URL", agent.DefaultBaseURL), "OpenAI compatible API base URL")
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv("OPENAI_API_KEY"), "AI API key (empty disables AI unless base-url is a local endpoint)")
+	flags.StringVar(&opts.model, "model", agent.DefaultModel, "Model name")
+	flags.StringVar(&opts.notify, "notify", "none", "Notification channel: none, dingtalk, slack or telegram (DingTalk uses --webhook)")
+	flags.StringVar(&opts.slackWebhook, "slack-webhook", "", "Slack incoming webhook URL")
+	flags.StringVar(&opts.telegramToken, "telegram-token", "", "Telegram bot token")
+	flags.StringVar(&opts.telegramChatID, "telegram-chat-id", "", "Telegram chat ID")
+	flags.IntVar(&opts.diskThreshold, "disk-threshold", patrol.DefaultDiskThreshold, "Disk usage alert threshold (percent)")
+	flags.Float64Var(&opts.loadThreshold, "load-threshold", patrol.DefaultLoadThreshold, "1 minute load average alert threshold")
+	flags.IntVar(&opts.clockWarnMS, "clock-warn-ms", 500, "Clock offset warning threshold (milliseconds)")
+	flags.StringSliceVar(&opts.modules, "modules", []string{"websites", "appstore", "gateway"}, "Optional modules to enable: websites, appstore, gateway")
+	flags.StringVar(&opts.systemdPath, "systemd", "", "Also write a systemd unit to this path")
+	flags.StringVar(&opts.composePath, "compose", "", "Also write a docker-compose snippet to this path")
+	return initCmd
+}
+
+func runInit(cmd *cobra.Command, opts *initOptions) {
+	path := configPath
+	if path == "" {
+		path = "qwq.json"
+	}
+	w := &initWizard{opts: opts, cmd: cmd, cfg: &config.Config{}}
+	if !opts.nonInteractive {
+		rl, err := readline.New("")
+		if err != nil {
+			initFatal("无法打开终端，请使用 --non-interactive: %v", err)
+		}
+		defer rl.Close()
+		w.rl = rl
+	}
+
+	fmt.Printf("🧭 qwq 初始化向导，配置将写入 %s\n", path)
+	if existing, err := config.LoadFile(path); err == nil {
+		if w.mergeExisting(path) {
+			w.cfg = existing
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		initFatal("已有配置无法读取: %v (使用 --force 覆盖)", err)
+	}
+
+	w.stepAI()
+	w.stepNotify()
+	w.stepWeb()
+	w.stepPatrol()
+	w.stepModules()
+
+	result, err := checkConfig(w.cfg)
+	if err != nil {
+		initFatal("生成的配置未通过检查: %v", err)
+	}
+	for _, warning := range result.warnings {
+		fmt.Printf("⚠️  通知地址可疑: %s\n", warning)
+	}
+	w.write(path)
+	w.writeExtras(path)
+	fmt.Printf("✅ 配置已写入 %s，运行 qwq web -c %s 启动\n", path, path)
+}
+
+// mergeExisting 配置文件已存在时决定是否在其基础上修改，默认合并
+func (w *initWizard) mergeExisting(path string) bool {
+	if w.rl == nil {
+		return !w.opts.force
+	}
+	if w.opts.force {
+		return false
+	}
+	for {
+		switch strings.ToLower(w.ask(path+" 已存在：合并(m) / 覆盖(o) / 退出(q)", "m")) {
+		case "m", "merge":
+			return true
+		case "o", "overwrite":
+			return false
+		case "q", "quit":
+			initFatal("已取消")
+		}
+	}
+}
+
+// stepAI AI 接口配置，调用 ListModels 确认地址和 Key 可用
+func (w *initWizard) stepAI() {
+	fmt.Println("\n🤖 AI 接口")
+	for {
+		w.cfg.BaseURL = w.ask("接口地址", w.value("base-url", w.opts.baseURL, w.cfg.BaseURL))
+		w.cfg.ApiKey = w.askSecret("API Key（留空禁用 AI，本地模型可留空）", w.value("api-key", w.opts.apiKey, w.cfg.ApiKey))
+		w.cfg.Model = w.ask("模型", w.value("model", w.opts.model, w.cfg.Model))
+		if w.cfg.ApiKey == "" && (w.cfg.BaseURL == "" || w.cfg.BaseURL == agent.DefaultBaseURL) {
+			// 只配置 base_url 也会启用 AI，默认的云端接口没有 Key 时不写入地址
+			w.cfg.BaseURL = ""
+			fmt.Println("ℹ️  未配置 API Key，AI 功能将被禁用")
+			return
+		}
+		if w.opts.skipChecks {
+			return
+		}
+		found, err := verifyAI(w.cfg.BaseURL, w.cfg.ApiKey, w.cfg.Model)
+		if err == nil {
+			if !found {
+				fmt.Printf("⚠️  接口可用，但模型列表中没有 %s，请确认模型名称\n", w.cfg.Model)
+			} else {
+				fmt.Println("✅ AI 接口可用")
+			}
+			return
+		}
+		if w.rl == nil {
+			initFatal("AI 接口调用失败: %v (使用 --skip-checks 跳过)", err)
+		}
+		fmt.Printf("❌ AI 接口调用失败: %v\n", err)
+		if w.confirm("仍然使用该配置", false) {
+			return
+		}
+	}
+}
+
+// stepNotify 通知渠道配置，保存前发送一条测试消息
+func (w *initWizard) stepNotify() {
+	fmt.Println("\n📨 通知渠道")
+	for {
+		kind := w.ask("渠道 (none/dingtalk/slack/telegram)", w.value("notify", w.opts.notify, w.existingNotify()))
+		var channel config.NotifyChannelConfig
+		switch kind {
+		case "none":
+			return
+		case "dingtalk":
+			w.cfg.DingTalkWebhook = w.askSecret("钉钉机器人 Webhook", w.value("webhook", config.GlobalConfig.DingTalkWebhook, w.cfg.DingTalkWebhook))
+		case "slack":
+			url := w.askSecret("Slack Incoming Webhook", w.value("slack-webhook", w.opts.slackWebhook, w.namedChannel("slack").Webhook))
+			w.setSlackChannel(url)
+		case "telegram":
+			w.cfg.TelegramToken = w.askSecret("Telegram Bot Token", w.value("telegram-token", w.opts.telegramToken, w.cfg.TelegramToken))
+			w.cfg.TelegramChatID = w.ask("Telegram Chat ID", w.value("telegram-chat-id", w.opts.telegramChatID, w.cfg.TelegramChatID))
+		default:
+			w.retry(fmt.Errorf("未知的通知渠道 %q", kind))
+			continue
+		}
+		if err := w.validate(); err != nil {
+			w.retry(err)
+			continue
+		}
+
+		// 校验会规范化地址，测试消息使用规范化后的值
+		switch kind {
+		case "dingtalk":
+			channel = config.NotifyChannelConfig{Name: notify.DefaultChannel, Type: "dingtalk", Webhook: w.cfg.DingTalkWebhook}
+		case "slack":
+			channel = w.namedChannel("slack")
+		case "telegram":
+			channel = config.NotifyChannelConfig{Name: notify.DefaultChannel, Type: "telegram", TelegramToken: w.cfg.TelegramToken, TelegramChatID: w.cfg.TelegramChatID}
+		}
+		if w.opts.skipChecks {
+			return
+		}
+		if err := notify.SendTest(channel, "qwq 测试消息", "qwq init 已配置该通知渠道，巡检告警将发送到这里。"); err != nil {
+			if w.rl == nil {
+				initFatal("测试消息发送失败: %v (使用 --skip-checks 跳过)", err)
+			}
+			fmt.Printf("❌ 测试消息发送失败: %v\n", err)
+			if !w.confirm("仍然使用该配置", false) {
+				continue
+			}
+			return
+		}
+		fmt.Println("✅ 测试消息已发送，请确认是否收到")
+		return
+	}
+}
+
+// stepWeb Web 控制台账号，可生成随机密码
+func (w *initWizard) stepWeb() {
+	fmt.Println("\n🔐 Web 控制台")
+	for {
+		w.cfg.WebUser = w.ask("用户名（留空不启用认证）", w.value("user", config.GlobalConfig.WebUser, w.cfg.WebUser))
+		password := w.value("password", config.GlobalConfig.WebPassword, w.cfg.WebPassword)
+		generate := w.opts.generatePassword
+		if w.cfg.WebUser == "" {
+			password, generate = "", false
+		} else if w.rl != nil && !generate {
+			password = w.askSecret("密码（留空生成随机密码）", password)
+			generate = password == ""
+		}
+		if generate {
+			generated, err := config.GenerateSecureKey(24)
+			if err != nil {
+				initFatal("生成密码失败: %v", err)
+			}
+			password = generated
+			fmt.Printf("🔑 已生成密码: %s（只显示这一次，请妥善保存）\n", password)
+		}
+		w.cfg.WebPassword = password
+		if err := w.validate(); err != nil {
+			w.retry(err)
+			continue
+		}
+		if w.cfg.WebUser == "" || w.cfg.WebPassword == "" {
+			fmt.Println("⚠️  用户名或密码为空，Web 控制台不启用认证")
+		}
+		return
+	}
+}
+
+// stepPatrol 巡检阈值
+func (w *initWizard) stepPatrol() {
+	fmt.Println("\n🩺 巡检阈值")
+	for {
+		disk, err := strconv.Atoi(w.ask("磁盘使用率告警阈值 (%)", w.number("disk-threshold", w.opts.diskThreshold, w.cfg.Patrol.DiskThreshold)))
+		if err != nil {
+			w.retry(fmt.Errorf("磁盘阈值必须是整数: %w", err))
+			continue
+		}
+		load, err := strconv.ParseFloat(w.ask("1 分钟负载告警阈值", w.value("load-threshold", strconv.FormatFloat(w.opts.loadThreshold, 'f', -1, 64), formatLoad(w.cfg.Patrol.LoadThreshold))), 64)
+		if err != nil {
+			w.retry(fmt.Errorf("负载阈值必须是数字: %w", err))
+			continue
+		}
+		clock, err := strconv.Atoi(w.ask("时钟偏差告警阈值 (ms)", w.number("clock-warn-ms", w.opts.clockWarnMS, w.cfg.Patrol.Clock.WarnMS)))
+		if err != nil {
+			w.retry(fmt.Errorf("时钟偏差阈值必须是整数: %w", err))
+			continue
+		}
+		w.cfg.Patrol.DiskThreshold, w.cfg.Patrol.LoadThreshold, w.cfg.Patrol.Clock.WarnMS = disk, load, clock
+		if err := w.validate(); err != nil {
+			w.retry(err)
+			continue
+		}
+		return
+	}
+}
+
+// stepModules 可选模块开关
+func (w *initWizard) stepModules() {
+	fmt.Println("\n🧩 可选模块")
+	modules := &w.cfg.Modules
+	if w.rl == nil {
+		// 未指定 --modules 时保留已有配置，新配置默认全部启用
+		if w.cmd.Flags().Changed("modules") {
+			enabled := make(map[string]bool)
+			for _, name := range w.opts.modules {
+				enabled[strings.TrimSpace(name)] = true
+			}
+			modules.DisableWebsites, modules.DisableAppStore, modules.DisableGateway = !enabled["websites"], !enabled["appstore"], !enabled["gateway"]
+		}
+		return
+	}
+	modules.DisableWebsites = !w.confirm("启用网站管理", !modules.DisableWebsites)
+	modules.DisableAppStore = !w.confirm("启用应用商店", !modules.DisableAppStore)
+	modules.DisableGateway = !w.confirm("启用 API Gateway 模式", !modules.DisableGateway)
+}
+
+// write 备份已有文件后写入带注释的配置
+func (w *initWizard) write(path string) {
+	data, err := config.RenderCommented(w.cfg)
+	if err != nil {
+		initFatal("生成配置失败: %v", err)
+	}
+	if previous, err := os.ReadFile(path); err == nil {
+		if err := os.WriteFile(path+".bak", previous, 0600); err != nil {
+			initFatal("备份已有配置失败: %v", err)
+		}
+		fmt.Printf("💾 已有配置已备份到 %s.bak\n", path)
+	}
+	if err := config.WriteFile(path, data); err != nil {
+		initFatal("写入配置失败: %v", err)
+	}
+}
+
+// writeExtras 按需生成 systemd unit 和 docker-compose 片段
+func (w *initWizard) writeExtras(path string) {
+	systemdPath, composePath := w.opts.systemdPath, w.opts.composePath
+	if w.rl != nil {
+		systemdPath = w.ask("\nsystemd unit 输出路径（留空跳过）", systemdPath)
+		composePath = w.ask("docker-compose 片段输出路径（留空跳过）", composePath)
+	}
+	absConfig, err := filepath.Abs(path)
+	if err != nil {
+		absConfig = path
+	}
+	if systemdPath != "" {
+		exe, err := os.Executable()
+		if err != nil {
+			exe = "/usr/local/bin/qwq"
+		}
+		w.writeExtra(systemdPath, systemdUnit(exe, absConfig))
+	}
+	if composePath != "" {
+		w.writeExtra(composePath, composeSnippet(absConfig))
+	}
+}
+
+func (w *initWizard) writeExtra(path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		initFatal("写入 %s 失败: %v", path, err)
+	}
+	fmt.Printf("📝 已生成 %s\n", path)
+}
+
+// systemdUnit 以 web 模式运行 qwq 的 systemd unit
+func systemdUnit(exe, configPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=qwq AIOps
+After=network-online.target docker.service
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%s web -c %s
+WorkingDirectory=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, exe, configPath, filepath.Dir(configPath))
+}
+
+// composeSnippet 挂载生成的配置运行 qwq 的 docker-compose 片段
+func composeSnippet(configPath string) string {
+	return fmt.Sprintf(`services:
+  qwq:
+    image: qwq-aiops:latest
+    command: ["/app/qwq", "web", "-c", "/app/qwq.json"]
+    ports:
+      - "8080:8080"
+    volumes:
+      - %s:/app/qwq.json:ro
+      - /var/run/docker.sock:/var/run/docker.sock
+    restart: unless-stopped
+`, configPath)
+}
+
+// validate 用 qwq config check 的校验检查当前配置
+func (w *initWizard) validate() error {
+	_, err := checkConfig(w.cfg)
+	return err
+}
+
+// retry 交互模式下提示错误后重新输入，非交互模式直接退出
+func (w *initWizard) retry(err error) {
+	if w.rl == nil {
+		initFatal("%v", err)
+	}
+	fmt.Printf("❌ %v\n", err)
+}
+
+// ask 读取一行输入，留空使用默认值；非交互模式直接返回默认值
+func (w *initWizard) ask(prompt, def string) string {
+	if w.rl == nil {
+		return def
+	}
+	if def != "" {
+		prompt += " [" + def + "]"
+	}
+	w.rl.SetPrompt(prompt + ": ")
+	line, err := w.rl.Readline()
+	if err != nil {
+		initFatal("已取消")
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// askSecret 读取密钥类输入，不回显，已有值时提示留空保留
+func (w *initWizard) askSecret(prompt, def string) string {
+	if w.rl == nil {
+		return def
+	}
+	if def != "" {
+		prompt += " [已设置，留空保留]"
+	}
+	secret, err := w.rl.ReadPassword(prompt + ": ")
+	if err != nil {
+		initFatal("已取消")
+	}
+	if value := strings.TrimSpace(string(secret)); value != "" {
+		return value
+	}
+	return def
+}
+
+func (w *initWizard) confirm(prompt string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	switch strings.ToLower(w.ask(prompt+" ("+hint+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// value 默认值的优先级：显式指定的命令行参数、已有配置、参数默认值
+func (w *initWizard) value(flag, flagValue, existing string) string {
+	if w.cmd.Flags().Changed(flag) || existing == "" {
+		return flagValue
+	}
+	return existing
+}
+
+func (w *initWizard) number(flag string, flagValue, existing int) string {
+	value := ""
+	if existing != 0 {
+		value = strconv.Itoa(existing)
+	}
+	return w.value(flag, strconv.Itoa(flagValue), value)
+}
+
+// existingNotify 已有配置中使用的通知渠道
+func (w *initWizard) existingNotify() string {
+	switch {
+	case w.cfg.DingTalkWebhook != "" || config.GlobalConfig.DingTalkWebhook != "":
+		return "dingtalk"
+	case w.cfg.TelegramToken != "":
+		return "telegram"
+	case w.namedChannel("slack").Webhook != "":
+		return "slack"
+	}
+	return ""
+}
+
+func (w *initWizard) namedChannel(name string) config.NotifyChannelConfig {
+	for _, channel := range w.cfg.NotifyRouting.Channels {
+		if channel.Name == name {
+			return channel
+		}
+	}
+	return config.NotifyChannelConfig{}
+}
+
+// setSlackChannel 写入名为 slack 的命名渠道，未配置默认渠道时将其设为默认
+func (w *initWizard) setSlackChannel(webhook string) {
+	routing := &w.cfg.NotifyRouting
+	channel := config.NotifyChannelConfig{Name: "slack", Type: "slack", Webhook: webhook}
+	replaced := false
+	for i := range routing.Channels {
+		if routing.Channels[i].Name == channel.Name {
+			routing.Channels[i], replaced = channel, true
+		}
+	}
+	if !replaced {
+		routing.Channels = append(routing.Channels, channel)
+	}
+	if len(routing.Default) == 0 {
+		routing.Default = []string{channel.Name}
+	}
+}
+
+// verifyAI 列出模型确认接口地址和 Key 可用，返回模型是否在列表中
+func verifyAI(baseURL, apiKey, model string) (bool, error) {
+	clientConfig := openai.DefaultConfig(apiKey)
+	clientConfig.BaseURL = baseURL
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	list, err := openai.NewClientWithConfig(clientConfig).ListModels(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range list.Models {
+		if m.ID == model {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func formatLoad(load float64) string {
+	if load == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(load, 'f', -1, 64)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func initFatal(format string, args ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", args...)
+	logger.Close()
+	os.Exit(1)
+}
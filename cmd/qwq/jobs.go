@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"qwq/internal/archive"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/events"
+	"qwq/internal/jobs"
+	"qwq/internal/logger"
+	"qwq/internal/maintenance"
+	"qwq/internal/monitor"
+	"qwq/internal/notify"
+	"qwq/internal/patrol"
+	"qwq/internal/selfguard"
+	"qwq/internal/server"
+	"time"
+)
+
+// 巡检和报告的执行间隔
+const (
+	patrolInterval       = 5 * time.Minute
+	statusReportInterval = 8 * time.Hour
+	weeklyReportInterval = 7 * 24 * time.Hour
+	// statusReportDelay 启动后延迟发送第一次日报，避免和启动巡检的告警同时推送
+	statusReportDelay = 30 * time.Second
+	// notifyDigestInterval 检查渠道静默时段是否结束的间隔
+	notifyDigestInterval = time.Minute
+)
+
+// startJobs 注册后台定时任务并启动调度，执行记录保存到 jobs 数据库，可在面板 /api/jobs 查看和控制
+// 数据库不可用时任务照常执行，只是不保存执行历史和暂停状态
+func startJobs() {
+	db, err := openServiceDB(jobsSchema)
+	if err != nil {
+		logger.Info("⚠️ 定时任务数据库不可用，执行记录不会保存: %v", err)
+		db = nil
+	}
+	scheduler := jobs.NewScheduler(db)
+	for _, job := range defaultJobs() {
+		if err := scheduler.Register(job); err != nil {
+			logger.Info("⚠️ 定时任务注册失败: %v", err)
+		}
+	}
+	jobs.SetDefault(scheduler)
+	scheduler.Start(context.Background())
+
+	// qwq 自身内存接近限制时立即巡检，由巡检的 self 检查项通过告警渠道通知
+	selfguard.OnPressure = func() { server.RecordPatrolHistory(patrol.Perform("self-guard")) }
+}
+
+// defaultJobs 根据配置返回需要运行的定时任务
+func defaultJobs() []jobs.Job {
+	list := []jobs.Job{
+		{
+			Name:        "patrol",
+			Description: "系统巡检",
+			Interval:    patrolInterval,
+			RunAtStart:  true,
+			Handler: func(ctx context.Context) error {
+				performPatrol()
+				return nil
+			},
+		},
+		{
+			Name:        "status-report",
+			Description: "服务器状态日报",
+			Interval:    statusReportInterval,
+			RunAtStart:  true,
+			StartDelay:  statusReportDelay,
+			Handler: func(ctx context.Context) error {
+				sendSystemStatus()
+				return nil
+			},
+		},
+		{
+			Name:        "weekly-report",
+			Description: "服务器运行周报",
+			Interval:    weeklyReportInterval,
+			Handler: func(ctx context.Context) error {
+				sendWeeklyReport()
+				return nil
+			},
+		},
+		{
+			Name:        "notify-digest",
+			Description: "静默时段结束后发送排队通知的摘要",
+			Interval:    notifyDigestInterval,
+			RunAtStart:  true,
+			Handler: func(ctx context.Context) error {
+				return notify.DefaultRouter().FlushQuiet(time.Now())
+			},
+		},
+	}
+
+	if manager := maintenance.Default(); manager != nil {
+		list = append(list, jobs.Job{
+			Name:        "maintenance-expiry",
+			Description: "关闭到期的维护窗口并发送静默摘要",
+			Interval:    maintenance.DefaultCheckInterval,
+			RunAtStart:  true,
+			Handler: func(ctx context.Context) error {
+				_, err := manager.CloseExpired(ctx)
+				return err
+			},
+		})
+	}
+	if store := events.Default(); store != nil {
+		list = append(list, jobs.Job{
+			Name:        "events-prune",
+			Description: "删除超过保留时间的时间线事件",
+			Interval:    events.DefaultPruneInterval,
+			RunAtStart:  true,
+			Handler: func(ctx context.Context) error {
+				_, err := store.Prune(ctx)
+				return err
+			},
+		})
+	}
+	if store := monitor.DefaultAnomalies(); store != nil {
+		list = append(list, jobs.Job{
+			Name:        "anomalies-prune",
+			Description: "删除超过保留时间的巡检记录和已恢复的异常",
+			Interval:    monitor.DefaultAnomalyPruneInterval,
+			RunAtStart:  true,
+			Handler: func(ctx context.Context) error {
+				_, err := store.Prune(ctx)
+				return err
+			},
+		})
+	}
+	if archiver := archive.Default(); archiver != nil {
+		interval := time.Duration(config.Current().Archive.IntervalHours) * time.Hour
+		if interval <= 0 {
+			interval = archive.DefaultInterval
+		}
+		list = append(list, jobs.Job{
+			Name:        "archive",
+			Description: "归档历史告警、审计日志和自愈记录",
+			Interval:    interval,
+			RunAtStart:  true,
+			Handler: func(ctx context.Context) error {
+				result, err := archiver.Run(ctx, false)
+				if err != nil {
+					return err
+				}
+				if result.Failed() {
+					return errors.New("部分表归档失败，详见 /api/archive/status")
+				}
+				return nil
+			},
+		})
+	}
+	if !config.Current().ComposeAnalysis.Disabled {
+		if history, err := newAnalysisHistory(); err != nil {
+			logger.Info("⚠️ Compose 项目定时分析未启动: %v", err)
+		} else {
+			list = append(list, jobs.Job{
+				Name:        "compose-analysis",
+				Description: "重新分析 Compose 项目架构和性能，记录健康评分趋势",
+				Interval:    container.AnalysisInterval(),
+				Handler: func(ctx context.Context) error {
+					result, err := history.RunAll(ctx)
+					if result != nil {
+						logger.Info("📊 Compose 项目定时分析完成: 分析 %d 个，内容未变化跳过 %d 个，评分下降 %d 个",
+							result.Analyzed, result.Skipped, len(result.Drops))
+					}
+					return err
+				},
+			})
+		}
+	}
+	if cfg := config.Current().AppStore; cfg.SyncInterval > 0 && len(cfg.Sources) > 0 && !config.Current().Modules.DisableAppStore {
+		if syncService, err := newAppStoreSyncService(); err != nil {
+			logger.Info("⚠️ 模板源定时同步未启动: %v", err)
+		} else {
+			list = append(list, jobs.Job{
+				Name:        "appstore-sync",
+				Description: "同步应用商店模板源",
+				Interval:    time.Duration(cfg.SyncInterval) * time.Minute,
+				RunAtStart:  true,
+				Handler: func(ctx context.Context) error {
+					_, err := syncService.SyncAll(ctx, false)
+					return err
+				},
+			})
+		}
+	}
+	return list
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// logRetentionPolicy 根据配置生成日志保留策略
+func logRetentionPolicy() logger.RetentionPolicy {
+	cfg := config.Current().LogRetention
+	return logger.RetentionPolicy{
+		MaxSizeMB:  cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+		MaxTotalMB: cfg.MaxTotalMB,
+		Compress:   !cfg.NoCompress,
+	}
+}
+
+// newLogsCommand 日志管理命令
+func newLogsCommand() *cobra.Command {
+	logsCmd := &cobra.Command{Use: "logs", Short: "Manage qwq.log files"}
+
+	var keep int
+	var maxAge time.Duration
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete or compress rotated log files according to the retention policy",
+		Run: func(cmd *cobra.Command, args []string) {
+			policy := logRetentionPolicy()
+			if keep > 0 {
+				policy.MaxBackups = keep
+			}
+			if maxAge > 0 {
+				policy.MaxAge = maxAge
+			}
+
+			result, err := logger.Prune(policy)
+			if err != nil {
+				fmt.Printf("❌ 清理日志失败: %v\n", err)
+				logger.Close()
+				os.Exit(1)
+			}
+			logger.Info("[AUDIT] 🧹 日志已清理: 删除 %d 个, 压缩 %d 个, 释放 %d 字节 by %s",
+				len(result.Deleted), len(result.Compressed), result.FreedBytes, currentUser())
+			for _, name := range result.Deleted {
+				fmt.Printf("  🗑️  %s\n", name)
+			}
+			for _, name := range result.Compressed {
+				fmt.Printf("  📦 %s\n", name)
+			}
+		},
+	}
+	pruneCmd.Flags().IntVar(&keep, "keep", 0, "Number of rotated files to keep (overrides config)")
+	pruneCmd.Flags().DurationVar(&maxAge, "max-age", 0, "Maximum age of rotated files, e.g. 720h (overrides config)")
+
+	logsCmd.AddCommand(pruneCmd)
+	return logsCmd
+}
+
+// currentUser 命令行操作者，用于审计日志
+func currentUser() string {
+	for _, key := range []string{"SUDO_USER", "USER"} {
+		if user := os.Getenv(key); user != "" {
+			return user
+		}
+	}
+	return "unknown"
+}
@@ -1,27 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"qwq/internal/agent"
+	"qwq/internal/cache"
 	"qwq/internal/config"
+	"qwq/internal/database"
 	"qwq/internal/executor"
 	"qwq/internal/gateway"
+	"qwq/internal/incident"
 	"qwq/internal/logger"
+	"qwq/internal/metrics"
 	"qwq/internal/monitor"
 	"qwq/internal/notify"
+	"qwq/internal/patrol"
 	"qwq/internal/security"
+	"qwq/internal/selfguard"
 	"qwq/internal/server"
+	"qwq/internal/slash"
 	"qwq/internal/utils"
 	"runtime"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/charmbracelet/glamour"
-	"github.com/chzyer/readline"
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
@@ -36,13 +41,22 @@ func main() {
 			if err := config.Init(configPath); err != nil {
 				return err
 			}
-			logger.Init("qwq.log", config.GlobalConfig.DebugMode)
-			if config.GlobalConfig.DingTalkWebhook != "" {
-				config.GlobalConfig.DingTalkWebhook = strings.ReplaceAll(config.GlobalConfig.DingTalkWebhook, "\\", "")
+			logger.InitWithRetention("qwq.log", config.Current().DebugMode, logRetentionPolicy())
+			// 尽早按容器的 CPU 配额和内存限制调整 GOMAXPROCS 和 GC 目标
+			selfguard.Init()
+			if err := loadAutoExecPolicy(); err != nil {
+				return err
+			}
+			configureDatabase()
+			applyStagedRestores()
+			for _, warning := range config.WebhookWarnings() {
+				logger.Info("⚠️ 通知地址可疑: %s", warning)
 			}
 			agent.InitClient()
-			// 初始化通知服务
+			// 初始化通知服务，投递记录持久化后重启仍可查询
+			notify.DefaultDeliveryLog = notify.NewDeliveryLog(notify.DefaultDeliveryLogFile)
 			notify.InitNotificationService()
+			go watchReloadSignal()
 			return nil
 		},
 	}
@@ -52,28 +66,45 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&config.GlobalConfig.WebUser, "user", "", "Web Dashboard Username")
 	rootCmd.PersistentFlags().StringVar(&config.GlobalConfig.WebPassword, "password", "", "Web Dashboard Password")
 	rootCmd.PersistentFlags().StringVar(&config.GlobalConfig.KnowledgeFile, "knowledge", "", "Path to knowledge base file")
+	rootCmd.PersistentFlags().StringVar(&config.GlobalConfig.AgentRecordDir, "record", "", "Record agent conversations as replay fixtures into this directory")
+	rootCmd.PersistentFlags().BoolVar(&config.GlobalConfig.Terminal.NoColor, "no-color", false, "Disable colors and markdown styling in terminal output")
+	rootCmd.PersistentFlags().BoolVar(&config.GlobalConfig.Terminal.AssumeYes, "yes", false, "Approve confirmation prompts when stdin is not a terminal")
 
-	rootCmd.AddCommand(&cobra.Command{Use: "chat", Short: "Interactive Mode", Run: runChatMode})
+	rootCmd.AddCommand(newChatCommand())
 	rootCmd.AddCommand(&cobra.Command{Use: "patrol", Short: "Patrol Mode", Run: runPatrolMode})
 	rootCmd.AddCommand(&cobra.Command{Use: "status", Short: "Send status", Run: runStatusMode})
 	rootCmd.AddCommand(&cobra.Command{Use: "web", Short: "Web Dashboard", Run: runWebMode})
 	rootCmd.AddCommand(&cobra.Command{Use: "gateway", Short: "API Gateway Mode", Run: runGatewayMode})
 	
+	rootCmd.AddCommand(newLogsCommand())
+	rootCmd.AddCommand(newAppStoreCommand())
+	rootCmd.AddCommand(newWebsiteCommand())
+	rootCmd.AddCommand(newPipelineCommand())
+	rootCmd.AddCommand(newConfigCommand())
+	rootCmd.AddCommand(newNotifyCommand())
+	rootCmd.AddCommand(newMaintenanceCommand())
+	rootCmd.AddCommand(newTokenCommand())
+	rootCmd.AddCommand(newDoctorCommand())
+	rootCmd.AddCommand(newArchiveCommand())
+	rootCmd.AddCommand(newIncidentCommand())
+	rootCmd.AddCommand(newInitCommand())
+	rootCmd.AddCommand(newTopCommand())
+	rootCmd.AddCommand(newDBCommand())
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "run [command]",
 		Short: "Smart execution with auto-remediation",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			fullCmd := strings.Join(args, " ")
-			if !utils.ConfirmExecution(fullCmd) {
-				fmt.Println("已取消")
-				return
-			}
-			executor.SmartRun(fullCmd)
+			executor.SmartRun(strings.Join(args, " "))
 		},
 	})
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	cache.Default.Close() // 写出尚未持久化的缓存条目
+	database.CloseHandles()
+	logger.Close() // 退出前写出缓冲中的日志
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -82,11 +113,32 @@ func main() {
 // 提供可视化界面和 API 服务，支持通过环境变量 PORT 自定义端口
 func runWebMode(cmd *cobra.Command, args []string) {
 	// 注册巡检和状态推送回调函数
-	server.TriggerPatrolFunc = performPatrol
+	server.TriggerPatrolFunc = triggerPatrol
 	server.TriggerStatusFunc = sendSystemStatus
 	
-	// 启动后台定时任务：每 8 小时执行一次巡检和日报
-	go runPatrolLoop(8 * time.Hour)
+	enableCachePersistence()
+	enableDeploymentTools()
+	enableContainerLogCheck()
+	enableAPITokens()
+	enableDashboardStore()
+	enableChatHistory()
+	enableEvents()
+	enableOwnershipTransfer()
+	enableOptimizerAdvisor()
+	enablePortAudit()
+	enableSearchSources()
+	enableAppProbes()
+	enableMaintenance()
+	enableArchive()
+	enableDriftWatch()
+	enableCertRenewal()
+	enableConfigBackup()
+	enableRemoteHosts()
+	enableAnomalyHistory()
+	probeWebhooksAtStartup()
+
+	// 启动后台定时任务：巡检、日报、周报、维护窗口、归档和模板同步
+	startJobs()
 	
 	// 从环境变量读取服务端口，默认使用 8080
 	// 可通过 docker-compose.yml 或 .env 文件配置
@@ -102,6 +154,11 @@ func runWebMode(cmd *cobra.Command, args []string) {
 // runGatewayMode 启动 API 网关模式
 // 提供统一的 API 入口，支持服务发现、负载均衡和路由转发
 func runGatewayMode(cmd *cobra.Command, args []string) {
+	if config.Current().Modules.DisableGateway {
+		fmt.Println("❌ API Gateway 模块已在配置中禁用 (modules.disable_gateway)")
+		logger.Close()
+		os.Exit(1)
+	}
 	logger.Info("🚀 启动增强版 API Gateway 模式")
 	
 	// 从环境变量读取网关端口，默认 8080
@@ -123,9 +180,9 @@ func runGatewayMode(cmd *cobra.Command, args []string) {
 	gatewayServer.GetGateway().AddDocsRoutes()
 	
 	// 启动后台服务
-	server.TriggerPatrolFunc = performPatrol
+	server.TriggerPatrolFunc = triggerPatrol
 	server.TriggerStatusFunc = sendSystemStatus
-	go runPatrolLoop(8 * time.Hour)
+	startJobs()
 	
 	// 启动原有Web服务（作为微服务之一）
 	go func() {
@@ -139,18 +196,35 @@ func runGatewayMode(cmd *cobra.Command, args []string) {
 	// 启动增强版网关
 	if err := gatewayServer.Start(); err != nil {
 		logger.Info("增强版网关启动失败: %v", err)
+		logger.Close()
 		os.Exit(1)
 	}
 }
 
 func runPatrolMode(cmd *cobra.Command, args []string) {
 	logger.Info("巡检模式启动 (无 Web 面板)")
-	go runPatrolLoop(8 * time.Hour)
+	enableCachePersistence()
+	enableContainerLogCheck()
+	enableMaintenance()
+	enableArchive()
+	enableDriftWatch()
+	enableCertRenewal()
+	enableConfigBackup()
+	enableRemoteHosts()
+	enableEvents()
+	enableAnomalyHistory()
+	probeWebhooksAtStartup()
+	if err := patrol.DefaultStore.Load(patrol.DefaultRunsFile); err != nil {
+		logger.Info("加载巡检记录失败: %v", err)
+	}
+	startJobs()
+	go utils.Supervise(context.Background(), "self-guard", selfguard.Run)
+	go utils.Supervise(context.Background(), "http-checks", monitor.DefaultChecks.Run)
 	waitForShutdown()
 }
 
 func runStatusMode(cmd *cobra.Command, args []string) {
-	if config.GlobalConfig.DingTalkWebhook == "" {
+	if config.Current().DingTalkWebhook == "" {
 		fmt.Println("错误: 请提供 --webhook 或在配置文件中设置")
 		return
 	}
@@ -158,54 +232,144 @@ func runStatusMode(cmd *cobra.Command, args []string) {
 }
 
 func runChatMode(cmd *cobra.Command, args []string) {
-	rl, _ := readline.NewEx(&readline.Config{Prompt: "\033[32mqwq > \033[0m", HistoryFile: "/tmp/qwq_history"})
+	// 交互式对话完全依赖 AI，未配置时直接拒绝
+	if !agent.Enabled() {
+		fmt.Printf("\033[31m❌ %v\033[0m\n", agent.ErrAIDisabled)
+		logger.Close()
+		os.Exit(1)
+	}
+
+	enableDeploymentTools()
+	// /host 切换执行目标，远程主机数据库不可用时只能在本机执行
+	target := newChatTarget(enableRemoteHosts())
+	// /patrol 和 /incidents 使用与 Web 面板相同的巡检记录
+	server.TriggerPatrolFunc = triggerPatrol
+	if err := patrol.DefaultStore.Load(patrol.DefaultRunsFile); err != nil {
+		logger.Info("加载巡检记录失败: %v", err)
+	}
+
+	// 渲染器在会话内复用：启动时探测一次终端和宽度，输出被重定向或设置了 NO_COLOR、--no-color 时输出纯文本
+	term := config.Current().Terminal
+	renderer := utils.NewMarkdownRenderer(os.Stdout, utils.RenderOptions{NoColor: term.NoColor, Width: term.WrapWidth, Style: term.Style})
+	render, color := renderer.Render, renderer.Colorize
+
+	// 标准输入不是终端时逐行读取，读完输入后退出；确认提示按 --yes 处理，不会阻塞
+	rl, err := utils.NewLineReader(color("32", "qwq > "), "/tmp/qwq_history")
+	if err != nil {
+		fmt.Printf("\033[31m❌ %v\033[0m\n", err)
+		return
+	}
 	defer rl.Close()
-	fmt.Printf("\033[36m(qwq) Agent Online. System: %s\033[0m\n", runtime.GOOS)
+	fmt.Println(color("36", fmt.Sprintf("(qwq) Agent Online. System: %s", runtime.GOOS)))
 	
+	// 对话在退出时保存，可通过 --resume 或 /resume 继续；/sessions 列出会话，/clear 开始新对话
+	sessions := newChatSessions()
 	messages := agent.GetBaseMessages()
+	if resumeSession != "" {
+		resumed, err := sessions.resume(resumeSession)
+		if err != nil {
+			fmt.Printf("\033[31m❌ 恢复会话失败: %v\033[0m\n", err)
+			return
+		}
+		messages = resumed
+		fmt.Println(color("36", fmt.Sprintf("↩️ 已恢复会话 %s（%d 条消息）", resumeSession, len(messages)-sessions.base)))
+	}
+	defer func() { sessions.save(messages, color) }()
+	transcript := incident.DefaultTranscripts.Session(incident.SourceCLI, currentUser())
 
 	for {
-		line, _ := rl.Readline()
+		line, err := rl.ReadLine()
+		if err != nil { break }
+		line = strings.TrimSpace(line)
 		if line == "exit" { break }
 		if line == "" { continue }
+		transcript.Record(incident.RoleUser, line)
+		if sessions.handle(line, &messages, color) {
+			continue
+		}
+		if target.handle(line, color) {
+			continue
+		}
+		
+		// 0. 斜杠命令：本机操作者拥有全部权限
+		if slash.IsCommand(line) {
+			ctx := slash.WithActor(context.Background(), currentUser()+" (cli)")
+			result, err := server.SlashCommands.Dispatch(ctx, line, nil)
+			if err != nil {
+				fmt.Println(color("33", err.Error()))
+				continue
+			}
+			content := result.Markdown()
+			transcript.Record(incident.RoleOutput, content)
+			fmt.Print(render(content))
+			continue
+		}
 		
 		// 1. 静态规则
 		staticResp := agent.CheckStaticResponse(line)
 		if staticResp != "" {
-			r, _ := glamour.NewTermRenderer(glamour.WithAutoStyle(), glamour.WithWordWrap(100))
-			out, _ := r.Render(staticResp)
-			fmt.Print(out)
+			fmt.Print(render(staticResp))
 			continue
 		}
 
 		// 2. 关键词速查
 		quickCmd := agent.GetQuickCommand(line)
 		if quickCmd != "" {
-			fmt.Printf("\033[90m⚡ 快速执行: %s\033[0m\n", quickCmd)
-			output := utils.ExecuteShell(quickCmd)
+			fmt.Println(color("90", "⚡ 快速执行: "+quickCmd+target.suffix()))
+			output := target.run(context.Background(), quickCmd).Combined()
 			if strings.TrimSpace(output) == "" { output = "(No output)" }
+			transcript.Record(incident.RoleCommand, quickCmd)
+			transcript.Record(incident.RoleOutput, output)
 			fmt.Println(output)
 			continue
 		}
 		
 		safeInput := security.Redact(line)
-		enhancedInput := safeInput + " (Context: Current Linux Server)"
+		enhancedInput := safeInput + agent.HostInputContext(target.remoteName())
+		
+		// 与 Web 端共用限流器，避免 CLI 抢占巡检分析的配额
+		if err := agent.DefaultLimiter.Allow("cli"); err != nil {
+			fmt.Println(color("33", fmt.Sprintf("⏳ %v", err)))
+			continue
+		}
+		release, err := agent.DefaultLimiter.Acquire(context.Background(), "cli", agent.PriorityInteractive, func(position int) {
+			fmt.Println(color("90", fmt.Sprintf("⏳ Agent 繁忙，已排队，当前第 %d 位", position)))
+		})
+		if err != nil {
+			fmt.Println(color("33", fmt.Sprintf("⏳ %v", err)))
+			continue
+		}
 		
 		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: enhancedInput})
+		recorded := len(messages)
 		
 		for i := 0; i < 5; i++ {
-			respMsg, cont := agent.ProcessAgentStep(&messages)
+			respMsg, cont := agent.ProcessAgentStepCLI(target.context(), &messages)
+			transcript.RecordMessages(messages[recorded:])
+			recorded = len(messages)
 			
 			if respMsg.Content != "" && len(respMsg.ToolCalls) == 0 {
-				r, _ := glamour.NewTermRenderer(glamour.WithAutoStyle(), glamour.WithWordWrap(100))
-				out, _ := r.Render(respMsg.Content)
-				fmt.Print(out)
+				fmt.Print(render(respMsg.Content))
 				
 				agent.CheckAndSaveFile(respMsg.Content)
 			}
 			
 			if !cont { break }
 		}
+		release()
+	}
+}
+
+// watchReloadSignal 收到 SIGHUP 时热加载 AI 限流配置
+func watchReloadSignal() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	for range sigChan {
+		if err := config.ReloadAILimits(); err != nil {
+			logger.Info("⚠️ 热加载 AI 限流配置失败: %v", err)
+			continue
+		}
+		logger.Info("🔄 AI 限流配置已热加载")
 	}
 }
 
@@ -216,128 +380,22 @@ func waitForShutdown() {
 	fmt.Println("\n正在关闭服务...")
 }
 
-func runPatrolLoop(interval time.Duration) {
-	checkTicker := time.NewTicker(5 * time.Minute)
-	reportTicker := time.NewTicker(interval)
-	defer checkTicker.Stop()
-	defer reportTicker.Stop()
-	
-	// 启动时立即执行一次巡检
-	performPatrol()
-	
-	// 启动时延迟一小段时间后发送第一次日报（避免和立即发送的冲突）
-	go func() {
-		time.Sleep(30 * time.Second)
-		sendSystemStatus()
-	}()
-	
-	logger.Info("📅 定时任务已启动: 巡检每5分钟, 日报每%v", interval)
-	
-	for {
-		select {
-		case <-checkTicker.C:
-			logger.Info("⏰ 定时巡检触发")
-			performPatrol()
-		case <-reportTicker.C:
-			logger.Info("⏰ 定时日报触发")
-			sendSystemStatus()
-		}
-	}
-}
-
+// performPatrol 执行一次系统巡检，结果和决策追踪可通过 /api/patrol/runs 查看，异常写入 /api/anomalies 的历史
 func performPatrol() {
-	logger.Info("正在执行系统巡检...")
-	var anomalies []string
-
-	// 磁盘检查：在代码中解析和过滤，确保可靠过滤 loop、snap 等设备
-	diskOut := utils.ExecuteShell("df -h")
-	diskLines := strings.Split(diskOut, "\n")
-	var diskAlerts []string
-	
-	for _, line := range diskLines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "Filesystem") {
-			continue
-		}
-		
-		// 严格过滤：检查设备名和挂载点
-		fields := strings.Fields(line)
-		if len(fields) < 5 {
-			continue
-		}
-		
-		device := fields[0]
-		mountPoint := fields[len(fields)-1]
-		
-		// 过滤所有 loop 设备、snap 相关、虚拟文件系统
-		if strings.Contains(device, "/dev/loop") ||
-		   strings.Contains(device, "loop") ||
-		   strings.Contains(mountPoint, "/snap") ||
-		   strings.Contains(mountPoint, "snap/") ||
-		   strings.Contains(mountPoint, "/hostfs") ||
-		   strings.Contains(line, "tmpfs") ||
-		   strings.Contains(line, "overlay") ||
-		   strings.Contains(line, "cdrom") ||
-		   strings.Contains(line, "efivarfs") {
-			continue
-		}
-		
-		// 解析使用率
-		useStr := strings.TrimSuffix(fields[4], "%")
-		usePct, err := strconv.Atoi(useStr)
-		if err == nil && usePct > 85 {
-			diskAlerts = append(diskAlerts, line)
-		}
-	}
-	
-	if len(diskAlerts) > 0 {
-		anomalies = append(anomalies, "**磁盘告警**:\n```\n"+strings.Join(diskAlerts, "\n")+"\n```")
-	}
-	if out := utils.ExecuteShell("uptime | awk -F'load average:' '{ print $2 }' | awk '{ if ($1 > 4.0) print $0 }'"); strings.TrimSpace(out) != "" && !strings.Contains(out, "exit status") {
-		anomalies = append(anomalies, "**高负载**:\n```\n"+strings.TrimSpace(out)+"\n```")
-	}
-	dmesgOut := utils.ExecuteShell("dmesg | grep -i 'out of memory' | tail -n 5")
-	if !strings.Contains(dmesgOut, "Operation not permitted") && !strings.Contains(dmesgOut, "不允许的操作") && strings.TrimSpace(dmesgOut) != "" && !strings.Contains(dmesgOut, "exit status") {
-		anomalies = append(anomalies, "**OOM日志**:\n```\n"+strings.TrimSpace(dmesgOut)+"\n```")
-	}
-	rawZombies := utils.ExecuteShell("ps -A -o stat,ppid,pid,cmd | awk '$1 ~ /^[Zz]/'")
-	if strings.TrimSpace(rawZombies) != "" && !strings.Contains(rawZombies, "exit status") {
-		detailZombie := "STAT    PPID     PID CMD\n" + rawZombies
-		anomalies = append(anomalies, "**僵尸进程**:\n```\n"+strings.TrimSpace(detailZombie)+"\n```")
-	}
-
-	for _, rule := range config.GlobalConfig.PatrolRules {
-		out := utils.ExecuteShell(rule.Command)
-		if strings.TrimSpace(out) != "" && !strings.Contains(out, "exit status") {
-			logger.Info(fmt.Sprintf("⚠️ 触发自定义规则: %s", rule.Name))
-			anomalies = append(anomalies, fmt.Sprintf("**%s**:\n```\n%s\n```", rule.Name, strings.TrimSpace(out)))
-		}
-	}
-
-	httpResults := monitor.RunChecks()
-	for _, res := range httpResults {
-		if !res.Success {
-			logger.Info(fmt.Sprintf("⚠️ HTTP 监控失败: %s", res.Name))
-			anomalies = append(anomalies, fmt.Sprintf("**HTTP异常 (%s)**:\n%s", res.Name, res.Error))
-		}
-	}
+	server.RecordPatrolHistory(patrol.Perform("schedule"))
+	server.RecordHealthScore()
+}
 
-	if len(anomalies) > 0 {
-		report := strings.Join(anomalies, "\n")
-		logger.Info("🚨 发现异常，正在请求 AI 分析...")
-		analysis := agent.AnalyzeWithAI(report)
-		alertMsg := fmt.Sprintf("🚨 **系统告警** [%s]\n\n%s\n\n💡 **处理建议**:\n%s", utils.GetHostname(), report, analysis)
-		notify.Send("系统告警", alertMsg)
-		logger.Info("告警已推送")
-	} else {
-		logger.Info("✔ 系统健康")
-	}
+// triggerPatrol 由 Web 面板手动触发的巡检
+func triggerPatrol() {
+	server.RecordPatrolHistory(patrol.Perform("manual"))
+	server.RecordHealthScore()
 }
 
 func sendSystemStatus() {
 	// 检查是否有配置通知渠道
-	if config.GlobalConfig.DingTalkWebhook == "" && 
-	   (config.GlobalConfig.TelegramToken == "" || config.GlobalConfig.TelegramChatID == "") {
+	if config.Current().DingTalkWebhook == "" && 
+	   (config.Current().TelegramToken == "" || config.Current().TelegramChatID == "") {
 		logger.Info("⚠️ 未配置通知渠道，跳过日报发送")
 		return
 	}
@@ -345,39 +403,51 @@ func sendSystemStatus() {
 	hostname := utils.GetHostname()
 	
 	// 获取IP地址（多种方法尝试）
-	ip := strings.TrimSpace(utils.ExecuteShell("ip route get 1 2>/dev/null | awk '{print $7; exit}' || hostname -I 2>/dev/null | awk '{print $1}' || echo 'N/A'"))
-	if ip == "" || strings.Contains(ip, "exit status") {
+	ip := strings.TrimSpace(utils.RunShell("ip route get 1 2>/dev/null | awk '{print $7; exit}' || hostname -I 2>/dev/null | awk '{print $1}'").Stdout)
+	if ip == "" {
 		ip = "N/A"
 	}
 	
 	// 获取运行时间
-	uptime := strings.TrimSpace(utils.ExecuteShell("uptime -p 2>/dev/null || uptime | awk -F'up' '{print $2}' | awk '{print $1,$2,$3}'"))
-	if uptime == "" || strings.Contains(uptime, "exit status") {
+	uptime := strings.TrimSpace(utils.RunShell("uptime -p 2>/dev/null || uptime | awk -F'up' '{print $2}' | awk '{print $1,$2,$3}'").Stdout)
+	if uptime == "" {
 		uptime = "N/A"
 	}
 	
-	// 获取内存信息
-	memInfo := strings.TrimSpace(utils.ExecuteShell("free -m | awk 'NR==2{printf \"%.1f%% (已用 %sM / 总计 %sM)\", $3/$2*100, $3, $2}'"))
-	if memInfo == "" || strings.Contains(memInfo, "exit status") {
-		memInfo = "N/A"
+	// 内存、磁盘、负载和 TCP 连接数，Linux 上读取 /proc 和 statfs，其他平台回退到 shell 命令
+	snap := metrics.Collect()
+	memInfo := "N/A"
+	if snap.MemTotalMB > 0 {
+		memInfo = fmt.Sprintf("%.1f%% (已用 %dM / 总计 %dM)", snap.MemPct(), snap.MemUsedMB, snap.MemTotalMB)
 	}
-	
-	// 获取磁盘信息（只检查根目录，过滤掉 loop 设备）
-	diskInfo := strings.TrimSpace(utils.ExecuteShell("df -h / 2>/dev/null | awk 'NR==2 {print $5 \" (剩余 \" $4 \")\"}'"))
-	if diskInfo == "" || strings.Contains(diskInfo, "exit status") {
-		diskInfo = "N/A"
+	diskInfo := "N/A"
+	if snap.DiskAvail != "" && snap.DiskAvail != "0G" {
+		diskInfo = fmt.Sprintf("%s%% (剩余 %s)", snap.DiskPct, snap.DiskAvail)
 	}
-	
-	// 获取负载信息
-	loadInfo := strings.TrimSpace(utils.ExecuteShell("uptime | awk -F'load average:' '{ print $2 }' | sed 's/^ *//'"))
-	if loadInfo == "" || strings.Contains(loadInfo, "exit status") {
+	loadInfo := snap.Load
+	if loadInfo == "" {
 		loadInfo = "N/A"
 	}
+	tcpConn := snap.TCPConn
+	
+	// 获取时钟偏差（优先使用最近一次巡检结果）
+	clockInfo := "N/A"
+	if status := patrol.LastClockStatus(); status != nil {
+		clockInfo = status.Describe()
+	} else if !config.Current().Patrol.Clock.Disabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		if status, err := patrol.NewClockProbe(utils.RunShell).Measure(ctx); err == nil {
+			clockInfo = status.Describe()
+		}
+		cancel()
+	}
 	
-	// 获取TCP连接数（多种方法尝试）
-	tcpConn := strings.TrimSpace(utils.ExecuteShell("ss -s 2>/dev/null | grep 'TCP:' | grep -oE 'estab [0-9]+' | awk '{print $2}' || netstat -ant 2>/dev/null | grep ESTABLISHED | wc -l || echo '0'"))
-	if tcpConn == "" || strings.Contains(tcpConn, "exit status") {
-		tcpConn = "0"
+	// CPU 和内存占用最高的进程，受 patrol.top_processes.max_chars 限制
+	topInfo := ""
+	if offenders := patrol.NewTopOffenders(utils.RunShell); offenders != nil {
+		if summary := offenders.Summary(); summary != "" {
+			topInfo = "\n#### 🔝 资源占用最高的进程\n\n" + summary + "\n"
+		}
 	}
 	
 	// 获取当前时间
@@ -385,6 +455,8 @@ func sendSystemStatus() {
 	
 	report := fmt.Sprintf(`### 📊 服务器状态日报 [%s]
 
+%s
+
 > **IP**: %s  
 > **运行时间**: %s  
 > **报告时间**: %s
@@ -397,11 +469,12 @@ func sendSystemStatus() {
 | **内存使用** | %s |
 | **系统磁盘** | %s |
 | **TCP连接** | %s |
-
+| **时钟偏差** | %s |
+%s
 ---
 
 *qwq AIOps 自动监控*
-`, hostname, ip, uptime, currentTime, loadInfo, memInfo, diskInfo, tcpConn)
+`, hostname, healthScoreHeader(24*time.Hour), ip, uptime, currentTime, loadInfo, memInfo, diskInfo, tcpConn, clockInfo, topInfo)
 	
 	notify.Send("服务器状态日报", report)
 	logger.Info("✅ 健康日报已发送 [%s]", hostname)
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"qwq/internal/logger"
+	"qwq/internal/maintenance"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newMaintenanceCommand 维护窗口管理命令
+func newMaintenanceCommand() *cobra.Command {
+	maintenanceCmd := &cobra.Command{Use: "maintenance", Short: "Silence alerts during planned maintenance"}
+
+	var window maintenance.Window
+	startCmd := &cobra.Command{
+		Use:   "start <duration>",
+		Short: "Start a maintenance window, e.g. qwq maintenance start 2h --reason \"db upgrade\"",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			duration, err := time.ParseDuration(args[0])
+			if err != nil || duration <= 0 {
+				exitMaintenance("无效的时长 %q，示例: 2h、30m", args[0])
+			}
+			manager := maintenanceManager()
+			window.StartsAt = time.Now()
+			window.EndsAt = window.StartsAt.Add(duration)
+			window.CreatedBy = currentUser()
+			if err := manager.Create(context.Background(), &window); err != nil {
+				exitMaintenance("创建维护窗口失败: %v", err)
+			}
+			fmt.Printf("🔧 维护窗口 #%d 已开始，%s 结束\n", window.ID, window.EndsAt.Format("2006-01-02 15:04"))
+			printWindowScope(&window)
+		},
+	}
+	startCmd.Flags().StringVar(&window.Reason, "reason", "", "Why the maintenance is happening")
+	startCmd.Flags().StringSliceVar(&window.Hosts, "host", nil, "Only silence alerts from these hosts (glob, repeatable)")
+	startCmd.Flags().StringSliceVar(&window.Categories, "category", nil, "Only silence these anomaly categories, e.g. disk, rule:nginx* (repeatable)")
+	startCmd.Flags().StringSliceVar(&window.Targets, "target", nil, "Only silence alerts for these websites or projects (repeatable)")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recent maintenance windows",
+		Run: func(cmd *cobra.Command, args []string) {
+			windows, err := maintenanceManager().List(context.Background(), 20)
+			if err != nil {
+				exitMaintenance("查询维护窗口失败: %v", err)
+			}
+			if len(windows) == 0 {
+				fmt.Println("没有维护窗口")
+				return
+			}
+			now := time.Now()
+			for _, w := range windows {
+				state := "已结束"
+				if w.Active(now) {
+					state = "生效中"
+				} else if w.ClosedAt == nil && now.Before(w.StartsAt) {
+					state = "未开始"
+				}
+				fmt.Printf("#%d [%s] %s ~ %s 静默 %d 条 %s\n", w.ID, state,
+					w.StartsAt.Format("01-02 15:04"), w.EndsAt.Format("01-02 15:04"), w.Suppressed, w.Reason)
+			}
+		},
+	}
+
+	stopCmd := &cobra.Command{
+		Use:   "stop <id>",
+		Short: "End a maintenance window early and send the summary of silenced alerts",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				exitMaintenance("无效的窗口 ID %q", args[0])
+			}
+			window, err := maintenanceManager().End(context.Background(), uint(id), currentUser())
+			if err != nil {
+				exitMaintenance("结束维护窗口失败: %v", err)
+			}
+			fmt.Printf("✅ 维护窗口 #%d 已结束，静默告警 %d 条，摘要已发送\n", window.ID, window.Suppressed)
+		},
+	}
+
+	maintenanceCmd.AddCommand(startCmd, listCmd, stopCmd)
+	return maintenanceCmd
+}
+
+// maintenanceManager 打开维护窗口数据库，失败时退出
+func maintenanceManager() *maintenance.Manager {
+	manager := enableMaintenance()
+	if manager == nil {
+		exitMaintenance("维护窗口数据库不可用")
+	}
+	return manager
+}
+
+func printWindowScope(window *maintenance.Window) {
+	for _, scope := range []struct {
+		label  string
+		values []string
+	}{
+		{"主机", window.Hosts},
+		{"类别", window.Categories},
+		{"对象", window.Targets},
+	} {
+		if len(scope.values) > 0 {
+			fmt.Printf("   %s: %s\n", scope.label, strings.Join(scope.values, ", "))
+		}
+	}
+}
+
+func exitMaintenance(format string, v ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", v...)
+	logger.Close()
+	os.Exit(1)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"qwq/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newNotifyCommand 通知管理命令
+func newNotifyCommand() *cobra.Command {
+	notifyCmd := &cobra.Command{Use: "notify", Short: "Inspect notification routing"}
+
+	var event notify.Event
+	var at string
+	routeTestCmd := &cobra.Command{
+		Use:   "route-test",
+		Short: "Show which channels would receive a hypothetical event",
+		Run: func(cmd *cobra.Command, args []string) {
+			router, err := notify.NewRouter(config.Current().NotifyRouting)
+			if err != nil {
+				fmt.Printf("❌ 通知路由配置无效: %v\n", err)
+				logger.Close()
+				os.Exit(1)
+			}
+			if at != "" {
+				t, err := parseEventTime(at, time.Now())
+				if err != nil {
+					fmt.Printf("❌ %v\n", err)
+					logger.Close()
+					os.Exit(1)
+				}
+				event.Time = t
+			}
+			if event.Time.IsZero() {
+				event.Time = time.Now()
+			}
+
+			decision := router.Match(event)
+			fmt.Printf("📨 事件: severity=%s category=%s host=%s tags=%s\n",
+				event.Severity, event.Category, event.Host, strings.Join(event.Tags, ","))
+			fmt.Printf("   路由: %s\n", decision.Route)
+			fmt.Printf("   时间: %s\n", event.Time.Format(time.RFC3339))
+			fmt.Printf("   渠道: %s\n", strings.Join(decision.Channels, ", "))
+			for _, delivery := range decision.Deliveries {
+				switch delivery.Action {
+				case notify.ChannelQueue:
+					fmt.Printf("     - %s: 排队，静默时段于 %s 结束后合并为摘要发送\n", delivery.Channel, delivery.Until.Format("2006-01-02 15:04 MST"))
+				case notify.ChannelDisabled:
+					fmt.Printf("     - %s: 渠道已停用，不发送\n", delivery.Channel)
+				case notify.ChannelEscalate:
+					fmt.Printf("     - %s: 处于静默时段 (至 %s)，严重事件立即发送\n", delivery.Channel, delivery.Until.Format("2006-01-02 15:04 MST"))
+				default:
+					fmt.Printf("     - %s: 立即发送\n", delivery.Channel)
+				}
+			}
+			if decision.EscalateAfter > 0 {
+				fmt.Printf("   升级: 严重异常持续 %v 未恢复后通知 %s\n", decision.EscalateAfter, strings.Join(decision.EscalateTo, ", "))
+			}
+		},
+	}
+	routeTestCmd.Flags().StringVar(&event.Severity, "severity", notify.SeverityWarning, "Event severity: critical, warning or info")
+	routeTestCmd.Flags().StringVar(&event.Category, "category", "", "Event category, e.g. disk, http, rule:nginx")
+	routeTestCmd.Flags().StringVar(&event.Host, "host", utils.GetHostname(), "Host that raised the event")
+	routeTestCmd.Flags().StringSliceVar(&event.Tags, "tag", nil, "Event tags (repeatable)")
+	routeTestCmd.Flags().StringVar(&at, "at", "", "Time to evaluate: HH:MM today (host time) or RFC3339 such as 2026-01-03T03:00:00+08:00, defaults to now")
+
+	notifyCmd.AddCommand(routeTestCmd)
+	return notifyCmd
+}
+
+// parseEventTime 解析 route-test 的 --at：HH:MM 表示主机时区的今天，也可以用 RFC3339 指定日期和时区（静默时段按星期生效）
+func parseEventTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--at 格式应为 HH:MM 或 RFC3339: %q", value)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location()), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"qwq/internal/container"
+	"qwq/internal/logger"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// newPipelineCommand 部署流水线命令
+func newPipelineCommand() *cobra.Command {
+	pipelineCmd := &cobra.Command{Use: "pipeline", Short: "Run multi-step deployment pipelines"}
+
+	runCmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Run a pipeline and follow its step events until it finishes",
+		Long: "Manual-approval steps and shell commands that the command policy marks as confirm wait until\n" +
+			"the run is approved through the deployment approval API. Interrupting the command cancels the run.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := openServiceDB(containerSchema)
+			if err != nil {
+				exitPipeline("部署服务数据库不可用: %v", err)
+			}
+			pipelines := container.NewPipelineService(db, container.NewComposeService(db), container.NewDockerExecutor())
+			pipeline, err := pipelines.GetPipelineByName(cmd.Context(), args[0], 1)
+			if err != nil {
+				exitPipeline("流水线 %s 不可用: %v", args[0], err)
+			}
+			run, err := pipelines.Run(container.WithRequester(cmd.Context(), currentUser()), pipeline.ID)
+			if err != nil {
+				exitPipeline("运行流水线失败: %v", err)
+			}
+			fmt.Printf("🧩 流水线 %s 开始运行（运行记录 #%d）\n", pipeline.Name, run.ID)
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			var final container.DeploymentStreamFrame
+			err = pipelines.Stream(ctx, run.ID, func(frame container.DeploymentStreamFrame) error {
+				if frame.Event != nil {
+					printPipelineEvent(frame.Event)
+				} else {
+					final = frame
+				}
+				return nil
+			})
+			if ctx.Err() != nil {
+				pipelines.CancelRun(context.Background(), run.ID)
+				exitPipeline("已中断，运行记录 #%d 已取消", run.ID)
+			}
+			if err != nil {
+				exitPipeline("读取运行状态失败: %v", err)
+			}
+			if final.Status != container.DeploymentStatusCompleted {
+				exitPipeline("流水线运行 %s: %s", final.Status, final.Message)
+			}
+			fmt.Printf("✅ %s\n", final.Message)
+		},
+	}
+
+	pipelineCmd.AddCommand(runCmd)
+	return pipelineCmd
+}
+
+// printPipelineEvent 输出一条运行事件，步骤事件带步骤名
+func printPipelineEvent(event *container.DeploymentEvent) {
+	if event.ServiceName != "" {
+		fmt.Printf("[%s] %-24s %s: %s\n", event.CreatedAt.Format("15:04:05"), event.EventType, event.ServiceName, event.Message)
+		return
+	}
+	fmt.Printf("[%s] %-24s %s\n", event.CreatedAt.Format("15:04:05"), event.EventType, event.Message)
+}
+
+func exitPipeline(format string, args ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", args...)
+	logger.Close()
+	os.Exit(1)
+}
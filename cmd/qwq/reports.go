@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"qwq/internal/patrol"
+	"qwq/internal/server"
+	"qwq/internal/utils"
+	"strings"
+	"time"
+)
+
+// healthScoreHeader 报告顶部的健康评分摘要，包含评分、窗口内趋势和主要扣分项
+func healthScoreHeader(window time.Duration) string {
+	report := server.ComputeHealthScore()
+	lines := []string{fmt.Sprintf("> **健康评分**: %d/100", report.Score)}
+	if series, err := server.HealthTrend(window); err == nil && len(series.Points) > 0 {
+		lines = append(lines, fmt.Sprintf("> **评分趋势**: %s (最低 %.0f / 平均 %.0f)",
+			series.Summary.Trend, series.Summary.Min, series.Summary.Avg))
+	}
+	for i, d := range report.Breakdown {
+		if i == 5 {
+			lines = append(lines, fmt.Sprintf("> … 另有 %d 项扣分", len(report.Breakdown)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("> - -%.1f %s", d.Points, d.Reason))
+	}
+	return strings.Join(lines, "  \n")
+}
+
+// worstProjectRow 周报表格中最近一次定时分析评分最低的 Compose 项目，没有分析记录时为空
+func worstProjectRow() string {
+	if config.Current().ComposeAnalysis.Disabled {
+		return ""
+	}
+	history, err := newAnalysisHistory()
+	if err != nil {
+		return ""
+	}
+	worst, err := history.Worst(context.Background())
+	if err != nil || worst == nil {
+		return ""
+	}
+	return fmt.Sprintf("| **评分最低的 Compose 项目** | %s (%d/100，严重 %d / 高 %d) |\n",
+		worst.Project, worst.Run.HealthScore, worst.Run.Critical, worst.Run.High)
+}
+
+// sendWeeklyReport 发送周报：健康评分、7 天评分趋势、巡检异常统计和评分最低的 Compose 项目
+func sendWeeklyReport() {
+	if config.Current().DingTalkWebhook == "" &&
+		(config.Current().TelegramToken == "" || config.Current().TelegramChatID == "") {
+		logger.Info("⚠️ 未配置通知渠道，跳过周报发送")
+		return
+	}
+
+	hostname := utils.GetHostname()
+	since := time.Now().Add(-7 * 24 * time.Hour)
+	runs, anomalous, anomalies := 0, 0, 0
+	for _, run := range patrol.DefaultStore.List(0) {
+		if run.StartedAt.Before(since) {
+			continue
+		}
+		runs++
+		if run.Anomalies > 0 {
+			anomalous++
+			anomalies += run.Anomalies
+		}
+	}
+
+	report := fmt.Sprintf(`### 📅 服务器运行周报 [%s]
+
+%s
+
+---
+
+| 指标 | 数值 |
+| :--- | :--- |
+| **巡检次数** | %d |
+| **发现异常的巡检** | %d |
+| **异常总数** | %d |
+| **统计区间** | %s ~ %s |
+%s
+
+---
+
+*qwq AIOps 自动监控*
+`, hostname, healthScoreHeader(7*24*time.Hour), runs, anomalous, anomalies,
+		since.Format("2006-01-02"), time.Now().Format("2006-01-02"), worstProjectRow())
+
+	notify.Send("服务器运行周报", report)
+	logger.Info("✅ 周报已发送 [%s]", hostname)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"qwq/internal/agent"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// resumeSession qwq chat --resume 指定的会话 ID
+var resumeSession string
+
+// newChatCommand 交互式对话命令，--resume 继续之前保存的会话
+func newChatCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "chat", Short: "Interactive Mode", Run: runChatMode}
+	cmd.Flags().StringVar(&resumeSession, "resume", "", "Resume a saved chat session by id (see /sessions)")
+	return cmd
+}
+
+// chatSessions 命令行对话的会话：退出、切换或清空对话时把当前对话保存到 ~/.qwq/sessions
+type chatSessions struct {
+	store *agent.SessionStore
+	id    string // 当前会话 ID，尚未保存过时为空
+	base  int    // 系统提示词和示例对话的消息数，不保存
+}
+
+func newChatSessions() *chatSessions {
+	return &chatSessions{store: agent.NewSessionStore(agent.DefaultSessionDir()), base: len(agent.GetBaseMessages())}
+}
+
+// save 保存当前对话，没有对话内容时不保存
+func (s *chatSessions) save(messages []openai.ChatCompletionMessage, color func(code, text string) string) {
+	if len(messages) <= s.base {
+		return
+	}
+	id, err := s.store.Save(s.id, messages[s.base:])
+	if err != nil {
+		fmt.Println(color("33", fmt.Sprintf("⚠️ 保存会话失败: %v", err)))
+		return
+	}
+	s.id = id
+	fmt.Println(color("90", fmt.Sprintf("💾 会话已保存: %s（qwq chat --resume %s 继续）", id, id)))
+}
+
+// resume 读取会话，返回接在系统提示词之后的完整对话
+func (s *chatSessions) resume(id string) ([]openai.ChatCompletionMessage, error) {
+	session, err := s.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	s.id = session.ID
+	return append(agent.GetBaseMessages(), session.Messages...), nil
+}
+
+// handle 处理会话命令 /sessions、/resume <id>、/clear，不是会话命令时返回 false
+func (s *chatSessions) handle(line string, messages *[]openai.ChatCompletionMessage, color func(code, text string) string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "/sessions":
+		infos, err := s.store.List()
+		if err != nil {
+			fmt.Println(color("33", fmt.Sprintf("⚠️ 读取会话失败: %v", err)))
+			return true
+		}
+		if len(infos) == 0 {
+			fmt.Println(color("90", "暂无保存的会话"))
+			return true
+		}
+		for _, info := range infos {
+			current := " "
+			if info.ID == s.id {
+				current = "*"
+			}
+			fmt.Printf("%s %s  %s  %3d 条  %s\n", current, info.ID, info.UpdatedAt.Local().Format("2006-01-02 15:04"), info.Messages, info.Title)
+		}
+	case "/resume":
+		if len(fields) != 2 {
+			fmt.Println(color("33", "用法: /resume <id>，会话 ID 见 /sessions"))
+			return true
+		}
+		session, err := s.store.Load(fields[1])
+		if err != nil {
+			fmt.Println(color("33", fmt.Sprintf("⚠️ 恢复会话失败: %v", err)))
+			return true
+		}
+		// 先保存正在进行的对话，再切换
+		s.save(*messages, color)
+		s.id = session.ID
+		*messages = append(agent.GetBaseMessages(), session.Messages...)
+		fmt.Println(color("36", fmt.Sprintf("↩️ 已恢复会话 %s（%d 条消息）", session.ID, len(session.Messages))))
+	case "/clear":
+		s.save(*messages, color)
+		s.id = ""
+		*messages = agent.GetBaseMessages()
+		fmt.Println(color("36", "🧹 已开始新的对话"))
+	default:
+		return false
+	}
+	return true
+}
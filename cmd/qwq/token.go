@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"qwq/internal/apitoken"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/server"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newTokenCommand API 令牌管理命令，令牌属于配置的管理员账号
+func newTokenCommand() *cobra.Command {
+	tokenCmd := &cobra.Command{Use: "token", Short: "Manage API tokens for programmatic access"}
+
+	var name, expires string
+	var permissions []string
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API token, e.g. qwq token create --name ci --permissions deployments:write --expires 90d",
+		Long: "Prints the full token once; only its prefix is stored in readable form.\n" +
+			"Use it as an Authorization: Bearer header on any /api route.",
+		Run: func(cmd *cobra.Command, args []string) {
+			owner := tokenOwner()
+			if name == "" {
+				name = "cli-" + time.Now().Format("20060102-150405")
+			}
+			if err := server.ValidateTokenPermissions(owner, permissions); err != nil {
+				exitToken("%v", err)
+			}
+			ttl, err := apitoken.ParseTTL(expires)
+			if err != nil {
+				exitToken("%v", err)
+			}
+			token, secret, err := tokenStore().Create(context.Background(), apitoken.CreateRequest{
+				Name: name, Owner: owner, TenantID: 1, Permissions: permissions, TTL: ttl,
+			})
+			if err != nil {
+				exitToken("创建令牌失败: %v", err)
+			}
+			logger.Info("[AUDIT] 🔑 API 令牌已创建: %q (%s) 权限 %s by %s (cli)", token.Name, token.Prefix, strings.Join(token.Permissions, ","), currentUser())
+			fmt.Printf("🔑 令牌 #%d %s 已创建（%s），只显示这一次:\n\n%s\n", token.ID, token.Name, tokenExpiry(token, time.Now()), secret)
+		},
+	}
+	createCmd.Flags().StringVar(&name, "name", "", "Token name shown in audit logs (default cli-<timestamp>)")
+	createCmd.Flags().StringSliceVar(&permissions, "permissions", nil, "Permissions granted to the token, e.g. deployments:write,logs:read (repeatable)")
+	createCmd.Flags().StringVar(&expires, "expires", "", "Expiry such as 90d or 12h (default: never)")
+	createCmd.MarkFlagRequired("permissions")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List API tokens with their prefix and last use",
+		Run: func(cmd *cobra.Command, args []string) {
+			tokens, err := tokenStore().List(context.Background(), tokenOwner())
+			if err != nil {
+				exitToken("查询令牌失败: %v", err)
+			}
+			if len(tokens) == 0 {
+				fmt.Println("没有 API 令牌")
+				return
+			}
+			now := time.Now()
+			for _, token := range tokens {
+				lastUsed := "从未使用"
+				if token.LastUsedAt != nil {
+					lastUsed = "最近使用 " + token.LastUsedAt.Format("01-02 15:04")
+				}
+				fmt.Printf("#%d %s %s… [%s] %s 权限 %s\n", token.ID, token.Name, token.Prefix,
+					tokenExpiry(token, now), lastUsed, strings.Join(token.Permissions, ","))
+			}
+		},
+	}
+
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke an API token; it is rejected immediately",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				exitToken("无效的令牌 ID %q", args[0])
+			}
+			token, err := tokenStore().Revoke(context.Background(), uint(id), tokenOwner())
+			if err != nil {
+				exitToken("吊销令牌失败: %v", err)
+			}
+			logger.Info("[AUDIT] 🔑 API 令牌已吊销: %q (%s) by %s (cli)", token.Name, token.Prefix, currentUser())
+			fmt.Printf("✅ 令牌 #%d %s 已吊销\n", token.ID, token.Name)
+		},
+	}
+
+	tokenCmd.AddCommand(createCmd, listCmd, revokeCmd)
+	return tokenCmd
+}
+
+// tokenOwner 命令行创建的令牌属于配置的管理员账号，未配置认证时令牌没有意义
+func tokenOwner() string {
+	cfg := config.Current()
+	if cfg.WebUser == "" || cfg.WebPassword == "" {
+		exitToken("API 令牌需要先配置 web_user 和 web_password")
+	}
+	return cfg.WebUser
+}
+
+// tokenStore 打开 API 令牌数据库，失败时退出
+func tokenStore() *apitoken.Manager {
+	manager := enableAPITokens()
+	if manager == nil {
+		exitToken("API 令牌数据库不可用")
+	}
+	return manager
+}
+
+// tokenExpiry 令牌有效期的展示文本
+func tokenExpiry(token *apitoken.Token, now time.Time) string {
+	switch {
+	case token.RevokedAt != nil:
+		return "已吊销"
+	case token.ExpiresAt == nil:
+		return "不过期"
+	case !now.Before(*token.ExpiresAt):
+		return "已过期"
+	}
+	return token.ExpiresAt.Format("2006-01-02") + " 过期"
+}
+
+func exitToken(format string, v ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", v...)
+	logger.Close()
+	os.Exit(1)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+	"qwq/internal/server"
+	"qwq/internal/tui"
+	"qwq/internal/utils"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// topProbeTimeout 探测本机 Web 服务的超时，服务未运行时应尽快回退到本地采集
+const topProbeTimeout = 500 * time.Millisecond
+
+// newTopCommand 终端仪表盘命令，适合只能通过 SSH 登录的环境
+func newTopCommand() *cobra.Command {
+	var apiURL, token string
+	var local bool
+	topCmd := &cobra.Command{
+		Use:   "top",
+		Short: "Live terminal dashboard of metrics, checks, incidents and patrols",
+		Long: "Refreshes every 2 seconds. Keys: p trigger a patrol, i incidents, l logs, d dashboard, q / ctrl-c quit.\n" +
+			"Reads from the web server on this host (PORT, default 8080) when it is running, otherwise collects locally.",
+		Run: func(cmd *cobra.Command, args []string) {
+			source := topSource(apiURL, token, local)
+			// 日志输出到控制台会破坏画面，退出后恢复
+			logger.SetConsole(false)
+			err := tui.Run(context.Background(), source, os.Stdin, os.Stdout)
+			logger.SetConsole(true)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				logger.Close()
+				os.Exit(1)
+			}
+		},
+	}
+	topCmd.Flags().StringVar(&apiURL, "api", "", "Web server URL to read from (default http://127.0.0.1:$PORT if it is running)")
+	topCmd.Flags().StringVar(&token, "token", "", "API token for the web server (default: web_user / web_password basic auth)")
+	topCmd.Flags().BoolVar(&local, "local", false, "Always collect locally instead of reading from the web server")
+	return topCmd
+}
+
+// topSource Web 服务在运行时读取其 API，避免启动第二个采集器；否则在本进程中采集
+func topSource(apiURL, token string, local bool) tui.Source {
+	if !local {
+		explicit := apiURL != ""
+		if !explicit {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			apiURL = "http://127.0.0.1:" + port
+		}
+		cfg := config.Current()
+		api := &tui.APISource{BaseURL: apiURL, User: cfg.WebUser, Password: cfg.WebPassword, Token: token, Client: &http.Client{Timeout: 5 * time.Second}}
+		ctx, cancel := context.WithTimeout(context.Background(), topProbeTimeout)
+		err := api.Probe(ctx)
+		cancel()
+		if err == nil {
+			return api
+		}
+		if explicit {
+			fmt.Printf("❌ 无法读取 %s: %v\n", apiURL, err)
+			logger.Close()
+			os.Exit(1)
+		}
+		logger.Info("Web 服务不可用 (%v)，在本进程中采集", err)
+	}
+
+	if err := patrol.DefaultStore.Load(patrol.DefaultRunsFile); err != nil {
+		logger.Info("加载巡检记录失败: %v", err)
+	}
+	go utils.Supervise(context.Background(), "http-checks", monitor.DefaultChecks.Run)
+	return &tui.LocalSource{
+		Collect:  server.CollectStats,
+		Patrol:   triggerPatrol,
+		LogPath:  logger.Path(),
+		Buffer:   logger.GetWebLogs,
+		RunsFile: patrol.DefaultRunsFile,
+	}
+}
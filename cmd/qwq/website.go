@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"qwq/internal/appstore"
+	"qwq/internal/logger"
+	"qwq/internal/website"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newWebsiteCommand 网站管理命令
+func newWebsiteCommand() *cobra.Command {
+	websiteCmd := &cobra.Command{Use: "website", Short: "Manage websites served by nginx"}
+
+	var (
+		domain, name, templateName, service string
+		params                              []string
+		timeout                             time.Duration
+	)
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a website, optionally deploying its backend from an app store template",
+		Long: "With --template the app is installed from the app store, its published port becomes the proxy backend\n" +
+			"and the nginx config is generated and reloaded. A failure at any stage rolls back the earlier ones.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			websiteDB, err := openServiceDB(websiteSchema)
+			if err != nil {
+				exitWebsite("网站数据库不可用: %v", err)
+			}
+			site := &website.Website{Name: name, Domain: domain, SiteType: website.SiteTypeProxy, UserID: 1, TenantID: 1}
+			if site.Name == "" {
+				site.Name = domain
+			}
+			websites := website.NewWebsiteService(websiteDB)
+
+			if templateName == "" {
+				if err := websites.CreateWebsite(cmd.Context(), site); err != nil {
+					exitWebsite("创建网站失败: %v", err)
+				}
+				fmt.Printf("✅ 网站已创建: #%d %s（未配置后端）\n", site.ID, site.Domain)
+				logger.Info("[AUDIT] 🌐 网站已创建: %s by %s", site.Domain, currentUser())
+				return
+			}
+
+			appDB, err := openServiceDB(appStoreSchema)
+			if err != nil {
+				exitWebsite("应用商店数据库不可用: %v", err)
+			}
+			store := appstore.NewAppStoreService(appDB)
+			template, err := store.GetTemplateByName(cmd.Context(), templateName)
+			if err != nil {
+				exitWebsite("模板 %s 不可用: %v", templateName, err)
+			}
+			parameters, err := templateParameters(template, params)
+			if err != nil {
+				exitWebsite("%v", err)
+			}
+
+			deployer := website.NewTemplateSiteDeployer(websites, website.NewProxyService(websiteDB), store, appstore.NewInstallerService(store))
+			deployer.WaitTimeout = timeout
+			fmt.Printf("📦 正在从模板 %s 部署 %s 的后端...\n", template.Name, domain)
+			result, err := deployer.Create(cmd.Context(), site, &website.BackendTemplate{
+				TemplateID: template.ID,
+				Parameters: parameters,
+				Service:    service,
+			})
+			if err != nil {
+				if result != nil && result.FailedStage != "" {
+					fmt.Printf("❌ 阶段 %s 失败: %s\n", result.FailedStage, result.Error)
+					if len(result.RolledBack) > 0 {
+						fmt.Printf("↩️  已回滚: %s\n", strings.Join(result.RolledBack, ", "))
+					}
+					for _, rbErr := range result.RollbackErr {
+						fmt.Printf("⚠️  回滚失败，需要手动清理: %s\n", rbErr)
+					}
+				}
+				exitWebsite("创建网站失败: %v", err)
+			}
+			fmt.Printf("✅ 网站已创建: #%d %s -> %s（应用实例 #%d）\n", result.WebsiteID, site.Domain, result.Backend, result.InstanceID)
+			logger.Info("[AUDIT] 🌐 网站已创建: %s <- 模板 %s 实例 #%d by %s", site.Domain, template.Name, result.InstanceID, currentUser())
+		},
+	}
+	createCmd.Flags().StringVar(&domain, "domain", "", "Primary domain of the website")
+	createCmd.Flags().StringVar(&name, "name", "", "Website name (default the domain)")
+	createCmd.Flags().StringVar(&templateName, "template", "", "App store template to deploy as the backend")
+	createCmd.Flags().StringArrayVar(&params, "param", nil, "Template parameter as key=value (repeatable)")
+	createCmd.Flags().StringVar(&service, "service", "", "Compose service to proxy when the template publishes several")
+	createCmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "How long to wait for the backend to run")
+	createCmd.MarkFlagRequired("domain")
+
+	websiteCmd.AddCommand(createCmd)
+	return websiteCmd
+}
+
+// templateParameters 按模板的参数定义把 --param key=value 转换为对应类型
+func templateParameters(template *appstore.AppTemplate, raw []string) (map[string]interface{}, error) {
+	var defs []appstore.TemplateParameter
+	if template.Parameters != "" {
+		if err := json.Unmarshal([]byte(template.Parameters), &defs); err != nil {
+			return nil, fmt.Errorf("模板参数定义无效: %w", err)
+		}
+	}
+	types := make(map[string]appstore.ParameterType, len(defs))
+	for _, def := range defs {
+		types[def.Name] = def.Type
+	}
+
+	params := make(map[string]interface{}, len(raw))
+	for _, item := range raw {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("无效的参数 %q，格式为 key=value", item)
+		}
+		switch types[key] {
+		case appstore.ParamTypeInt:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("参数 %s 必须是整数: %q", key, value)
+			}
+			params[key] = n
+		case appstore.ParamTypeBool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("参数 %s 必须是布尔值: %q", key, value)
+			}
+			params[key] = b
+		default:
+			params[key] = value
+		}
+	}
+	return params, nil
+}
+
+func exitWebsite(format string, args ...interface{}) {
+	fmt.Printf("❌ "+format+"\n", args...)
+	logger.Close()
+	os.Exit(1)
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"qwq/internal/config"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// advisorUser 优化建议 AI 补充在限流器中使用的用户名，与交互式对话分开计算速率
+const advisorUser = "optimizer"
+
+// ErrPromptOverBudget 请求内容超过分析预算
+var ErrPromptOverBudget = errors.New("prompt exceeds analysis token budget")
+
+// OptimizationAdvisor 为 Compose 优化建议提供 AI 补充（实现 container.OptimizationAdvisor）
+// 与巡检分析共用限流器和 analysis_budget，超出预算或被限流时返回错误，由调用方回退到规则建议
+type OptimizationAdvisor struct{}
+
+// Advise 发送一次不带工具的对话请求，返回模型的回复
+func (OptimizationAdvisor) Advise(ctx context.Context, system, prompt string) (string, error) {
+	client := ClientFor(config.UseOptimizer)
+	if client == nil {
+		return "", ErrAIDisabled
+	}
+	budget, _ := analysisBudget()
+	if tokens := EstimateTokens(system) + EstimateTokens(prompt); tokens > budget {
+		return "", fmt.Errorf("%w: ~%d > %d tokens", ErrPromptOverBudget, tokens, budget)
+	}
+	if err := DefaultLimiter.Allow(advisorUser); err != nil {
+		return "", err
+	}
+	release, err := DefaultLimiter.Acquire(ctx, advisorUser, PriorityInteractive, nil)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	resp, err := client.CreateChatCompletion(reqCtx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("empty AI response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
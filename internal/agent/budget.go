@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"fmt"
+	"qwq/internal/config"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultAnalysisTokenBudget 单次分析请求中异常报告的默认 token 上限
+	DefaultAnalysisTokenBudget = 6000
+	// DefaultAnalysisKeepLines 压缩时每段原始输出默认保留的首尾行数
+	DefaultAnalysisKeepLines = 20
+)
+
+// ReportSection 异常报告中的一段，对应一项异常
+type ReportSection struct {
+	Title  string
+	Detail string
+	Fenced bool // 详情是否为原始输出（代码块）
+}
+
+// Markdown 渲染为发送给模型的 Markdown 片段，格式与巡检告警一致
+func (s ReportSection) Markdown() string {
+	if s.Fenced {
+		return fmt.Sprintf("**%s**:\n```\n%s\n```", s.Title, s.Detail)
+	}
+	return fmt.Sprintf("**%s**:\n%s", s.Title, s.Detail)
+}
+
+// BudgetedReport 按预算切分后的异常报告
+type BudgetedReport struct {
+	Chunks    []string // 每个元素为一次分析请求的报告内容，均不超过预算
+	Condensed []string // 被压缩的异常标题
+}
+
+// EstimateTokens 估算文本的 token 数
+// ASCII 字符按每 3 个 1 个 token 计（日志、命令输出的分词效率低于自然语言），其余字符（中文等）每个按 1 个 token 计，估算结果偏保守
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+2)/3 + other
+}
+
+// analysisBudget 当前配置的分析预算
+func analysisBudget() (int, int) {
+	cfg := config.Current().AnalysisBudget
+	budget, keep := cfg.MaxTokens, cfg.KeepLines
+	if budget <= 0 {
+		budget = DefaultAnalysisTokenBudget
+	}
+	if keep <= 0 {
+		keep = DefaultAnalysisKeepLines
+	}
+	return budget, keep
+}
+
+// sectionSeparator 报告中各异常之间的分隔
+const sectionSeparator = "\n"
+
+// chunkHeaderReserve 分段分析时为每段前的说明预留的 token 数
+const chunkHeaderReserve = 50
+
+// BudgetReport 将异常报告限制在预算内
+// 报告未超出预算时原样返回；超出时逐项压缩（合并重复行，原始输出只保留首尾 keepLines 行），
+// 按顺序装入不超过预算的分段。单项压缩后仍超出预算时进一步截断并单独成段，每项异常都会出现在某一段中
+func BudgetReport(sections []ReportSection, budget, keepLines int) BudgetedReport {
+	full := joinSections(sections)
+	if EstimateTokens(full) <= budget {
+		return BudgetedReport{Chunks: []string{full}}
+	}
+
+	if budget > 2*chunkHeaderReserve {
+		budget -= chunkHeaderReserve
+	}
+	var report BudgetedReport
+	var current []string
+	currentTokens := 0
+	for _, section := range sections {
+		condensed := fitSection(condenseSection(section, keepLines), budget)
+		if condensed != section {
+			report.Condensed = append(report.Condensed, section.Title)
+		}
+		markdown := condensed.Markdown()
+		tokens := EstimateTokens(markdown + sectionSeparator)
+		if len(current) > 0 && currentTokens+tokens > budget {
+			report.Chunks = append(report.Chunks, strings.Join(current, sectionSeparator))
+			current, currentTokens = nil, 0
+		}
+		current = append(current, markdown)
+		currentTokens += tokens
+	}
+	if len(current) > 0 {
+		report.Chunks = append(report.Chunks, strings.Join(current, sectionSeparator))
+	}
+	return report
+}
+
+func joinSections(sections []ReportSection) string {
+	parts := make([]string, 0, len(sections))
+	for _, section := range sections {
+		parts = append(parts, section.Markdown())
+	}
+	return strings.Join(parts, sectionSeparator)
+}
+
+// dmesgTimestamp dmesg 行首的时间戳，比较重复行时忽略
+var dmesgTimestamp = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s*`)
+
+// condenseSection 合并连续的重复行，原始输出超过 2*keepLines 行时只保留首尾
+func condenseSection(section ReportSection, keepLines int) ReportSection {
+	lines := strings.Split(section.Detail, "\n")
+	collapsed := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		key := dmesgTimestamp.ReplaceAllString(lines[i], "")
+		j := i + 1
+		for j < len(lines) && dmesgTimestamp.ReplaceAllString(lines[j], "") == key {
+			j++
+		}
+		if n := j - i; n > 1 {
+			collapsed = append(collapsed, fmt.Sprintf("%s （重复 %d 次）", lines[i], n))
+		} else {
+			collapsed = append(collapsed, lines[i])
+		}
+		i = j
+	}
+
+	if section.Fenced && len(collapsed) > 2*keepLines {
+		omitted := len(collapsed) - 2*keepLines
+		head := collapsed[:keepLines]
+		tail := collapsed[len(collapsed)-keepLines:]
+		collapsed = append(append(append([]string{}, head...), fmt.Sprintf("... 省略 %d 行 ...", omitted)), tail...)
+	}
+	if len(collapsed) != len(lines) {
+		section.Detail = strings.Join(collapsed, "\n")
+	}
+	return section
+}
+
+// fitSection 单项仍超出预算时按字符截断详情，每次保留首尾各四分之一直至不超出预算
+func fitSection(section ReportSection, budget int) ReportSection {
+	for EstimateTokens(section.Markdown()) > budget {
+		runes := []rune(section.Detail)
+		if len(runes) <= 64 {
+			section.Detail = ""
+		}
+		if section.Detail == "" {
+			// 标题本身超出预算，只能截断标题
+			title := []rune(section.Title)
+			section.Title = string(title[:len(title)/2]) + "..."
+			if len(title) < 8 {
+				return section
+			}
+			continue
+		}
+		keep := len(runes) / 4
+		section.Detail = string(runes[:keep]) + "\n... 内容过长已截断 ...\n" + string(runes[len(runes)-keep:])
+	}
+	return section
+}
+
+// AnalyzeReportWithAI 在上下文预算内分析异常报告
+// 报告超出预算时先压缩；压缩后仍需多次请求时分别分析再合并结果。返回分析结果和被压缩的异常标题
+func AnalyzeReportWithAI(sections []ReportSection) (string, []string) {
+	budget, keepLines := analysisBudget()
+	report := BudgetReport(sections, budget, keepLines)
+	return mergeAnalyses(report.Chunks, AnalyzeWithAI), report.Condensed
+}
+
+// mergeAnalyses 分析各分段并合并结果，只有一段时直接返回该段的分析
+func mergeAnalyses(chunks []string, analyze func(string) string) string {
+	if len(chunks) == 1 {
+		return analyze(chunks[0])
+	}
+	results := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		prompt := fmt.Sprintf("以下是本次巡检异常的第 %d/%d 部分，其余部分单独分析：\n\n%s", i+1, len(chunks), chunk)
+		results = append(results, fmt.Sprintf("**第 %d/%d 部分**\n%s", i+1, len(chunks), analyze(prompt)))
+	}
+	return strings.Join(results, "\n\n")
+}
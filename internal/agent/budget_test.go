@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// giantSection 生成包含大量原始输出的异常
+func giantSection(title string, lines int, repeated bool) ReportSection {
+	var builder strings.Builder
+	for i := 0; i < lines; i++ {
+		if repeated {
+			builder.WriteString(fmt.Sprintf("[%d.%06d] EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2: comm ls: reading directory lblock 0\n", i, i))
+		} else {
+			builder.WriteString(fmt.Sprintf("/dev/mapper/vg-data%04d  100G   %dG   %dG  %d%% /mnt/volume%04d\n", i, 90, 10, 90, i))
+		}
+	}
+	return ReportSection{Title: title, Detail: strings.TrimSuffix(builder.String(), "\n"), Fenced: true}
+}
+
+func TestBudgetReport_FitsUnchanged(t *testing.T) {
+	sections := []ReportSection{
+		{Title: "负载过高", Detail: "load average: 8.00"},
+		{Title: "磁盘告警 (/dev/sda1)", Detail: "91%", Fenced: true},
+	}
+	report := BudgetReport(sections, 1000, 20)
+	if len(report.Chunks) != 1 || len(report.Condensed) != 0 {
+		t.Fatalf("small report should be sent as-is, got %+v", report)
+	}
+	if report.Chunks[0] != joinSections(sections) {
+		t.Errorf("unexpected chunk: %q", report.Chunks[0])
+	}
+}
+
+func TestBudgetReport_CondensesGiantReport(t *testing.T) {
+	var sections []ReportSection
+	for i := 0; i < 12; i++ {
+		sections = append(sections, giantSection(fmt.Sprintf("异常 %02d", i), 500, i%2 == 0))
+	}
+	sections = append(sections, ReportSection{Title: "负载过高", Detail: "load average: 8.00"})
+
+	const budget = 6000
+	report := BudgetReport(sections, budget, 20)
+	if len(report.Chunks) != 1 {
+		t.Fatalf("condensed report should fit in one request, got %d chunks", len(report.Chunks))
+	}
+	prompt := report.Chunks[0]
+	if tokens := EstimateTokens(prompt); tokens > budget {
+		t.Errorf("prompt is %d tokens, budget %d", tokens, budget)
+	}
+	for _, section := range sections {
+		if !strings.Contains(prompt, "**"+section.Title+"**") {
+			t.Errorf("anomaly %q missing from prompt", section.Title)
+		}
+	}
+	if len(report.Condensed) != 12 {
+		t.Errorf("expected 12 condensed sections, got %v", report.Condensed)
+	}
+	if !strings.Contains(prompt, "（重复 500 次）") {
+		t.Error("repeated dmesg lines should be collapsed with a count")
+	}
+	if !strings.Contains(prompt, "省略 460 行") {
+		t.Error("long raw output should keep head and tail with an omission note")
+	}
+}
+
+func TestBudgetReport_SplitsOversizedSections(t *testing.T) {
+	var sections []ReportSection
+	for i := 0; i < 3; i++ {
+		// 每行都很长，只保留首尾行也超出预算
+		section := giantSection(fmt.Sprintf("超大异常 %d", i), 40, false)
+		section.Detail = strings.Repeat(section.Detail, 20)
+		sections = append(sections, section)
+	}
+
+	const budget = 1500
+	report := BudgetReport(sections, budget, 20)
+	if len(report.Chunks) < 2 {
+		t.Fatalf("oversized sections should be analyzed separately, got %d chunks", len(report.Chunks))
+	}
+	for i, chunk := range report.Chunks {
+		if tokens := EstimateTokens(chunk); tokens > budget-chunkHeaderReserve {
+			t.Errorf("chunk %d is %d tokens, budget %d", i, tokens, budget)
+		}
+	}
+	all := strings.Join(report.Chunks, "\n")
+	for _, section := range sections {
+		if !strings.Contains(all, "**"+section.Title+"**") {
+			t.Errorf("anomaly %q missing from chunks", section.Title)
+		}
+	}
+
+	var prompts []string
+	merged := mergeAnalyses(report.Chunks, func(prompt string) string {
+		prompts = append(prompts, prompt)
+		return fmt.Sprintf("analysis %d", len(prompts))
+	})
+	if len(prompts) != len(report.Chunks) {
+		t.Fatalf("expected one analysis per chunk, got %d", len(prompts))
+	}
+	for i, prompt := range prompts {
+		if tokens := EstimateTokens(prompt); tokens > budget {
+			t.Errorf("prompt %d is %d tokens, budget %d", i, tokens, budget)
+		}
+	}
+	for i := range prompts {
+		if !strings.Contains(merged, fmt.Sprintf("analysis %d", i+1)) {
+			t.Errorf("merged analysis missing part %d: %q", i+1, merged)
+		}
+	}
+}
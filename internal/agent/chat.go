@@ -1,16 +1,22 @@
 package agent
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"qwq/internal/backup"
+	"qwq/internal/cache"
 	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/security"
 	"qwq/internal/utils"
 	"regexp"
 	"strings"
-	"time"
+		"time"
 
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -21,17 +27,8 @@ const (
 	Version        = "v3.2.0 Enterprise"
 )
 
-var Client *openai.Client
-
-func InitClient() {
-	cfg := openai.DefaultConfig(config.GlobalConfig.ApiKey)
-	if config.GlobalConfig.BaseURL != "" {
-		cfg.BaseURL = config.GlobalConfig.BaseURL
-	} else {
-		cfg.BaseURL = DefaultBaseURL
-	}
-	Client = openai.NewClientWithConfig(cfg)
-}
+// ErrAIDisabled 未配置 AI 后端
+var ErrAIDisabled = errors.New("AI not configured — set OPENAI_API_KEY or configure a local endpoint")
 
 var Tools = []openai.Tool{
 	{
@@ -49,6 +46,45 @@ var Tools = []openai.Tool{
 			}`),
 		},
 	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "snapshot_container_volumes",
+			Description: "Snapshot all named volumes of a Docker container so they can be restored later. Offer this before destructive database operations or migrations.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"container": { "type": "string", "description": "Container ID or name" },
+					"reason": { "type": "string", "description": "The reason" }
+				},
+				"required": ["container", "reason"]
+			}`),
+		},
+	},
+	queryMetricsTool,
+	deploymentTools[0],
+	deploymentTools[1],
+	deploymentTools[2],
+	deploymentTools[3],
+}
+
+// queryMetricsTool 查询历史监控指标，后台分析时也只开放此工具
+var queryMetricsTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        "query_metrics",
+		Description: "Query historical host metrics (up to 7 days, 1-minute resolution). Returns bucketed points plus a summary with trend, min/max/avg, current value and the change versus 24h ago. Use it for questions about trends or 'since when'.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"metric": { "type": "string", "enum": ["load", "mem_pct", "disk_pct", "tcp_conn", "health_score"], "description": "Metric name" },
+				"range": { "type": "string", "description": "Look-back window as a Go duration, e.g. 1h, 24h, 168h. Default 24h" },
+				"aggregation": { "type": "string", "enum": ["avg", "min", "max"], "description": "Per-bucket aggregation. Default avg" },
+				"buckets": { "type": "integer", "description": "Number of buckets, at most 60. Default 24" }
+			},
+			"required": ["metric"]
+		}`),
+	},
 }
 
 func GetQuickCommand(input string) string {
@@ -152,6 +188,18 @@ func GetBaseMessages() []openai.ChatCompletionMessage {
 4. **禁止废话**：
    - 不要解释命令，不要说 "你可以使用..."。
 
+5. **趋势分析**：
+   - 涉及"最近是否上涨"、"从什么时候开始"等历史趋势问题时，调用 query_metrics 查询历史数据，不要仅凭当前值判断。
+
+6. **数据保护**：
+   - 对容器内数据库执行删除、清空、迁移等破坏性操作前，**必须**先询问用户是否需要快照。
+   - 用户同意后调用 snapshot_container_volumes，快照成功后再继续。
+
+7. **受管项目**：
+   - 涉及 qwq 管理的 Compose 项目的部署、回滚、自愈状态时，**优先**调用 list_deployments、deploy_project、rollback_deployment、get_healing_status。
+   - **不要**手写 docker / docker compose 命令操作受管项目，否则会绕过部署历史和审批。
+   - 回滚前先用 list_deployments 确认部署 ID。
+
 %s`, knowledgePart)
 
 	return []openai.ChatCompletionMessage{
@@ -179,66 +227,190 @@ func GetBaseMessages() []openai.ChatCompletionMessage {
 	}
 }
 
+// analysisCache 后台分析结果缓存，巡检反复报告相同异常时在有效期内复用上次的分析，不再调用 AI
+var analysisCache = cache.New[string](cache.Default, "ai.analysis", cache.Options{MaxEntries: 256})
+
+// DefaultAnalysisCacheTTL 分析结果默认的缓存时间
+const DefaultAnalysisCacheTTL = 30 * time.Minute
+
+// analysisCacheTTL 配置的分析结果缓存时间，负数表示不缓存
+func analysisCacheTTL() time.Duration {
+	minutes := config.Current().Cache.AnalysisTTLMinutes
+	if minutes == 0 {
+		return DefaultAnalysisCacheTTL
+	}
+	if minutes < 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// analysisCacheKey 分析结果的缓存键，模型和内容相同才复用
+func analysisCacheKey(issue string) string {
+	sum := sha256.Sum256([]byte(modelFor(config.UsePatrolAnalysis) + "\x00" + issue))
+	return hex.EncodeToString(sum[:])
+}
+
+// AnalyzeWithAI 分析巡检异常，相同内容的成功分析结果会被缓存
 func AnalyzeWithAI(issue string) string {
+	client := ClientFor(config.UsePatrolAnalysis)
+	if client == nil {
+		return "AI 分析未启用: " + ErrAIDisabled.Error()
+	}
+
+	ttl := analysisCacheTTL()
+	key := analysisCacheKey(issue)
+	if ttl > 0 {
+		if analysis, ok := analysisCache.Get(key); ok {
+			return analysis
+		}
+	}
+
+	analysis, err := analyzeWithAI(client, issue)
+	if err != nil {
+		return "AI Error: " + err.Error()
+	}
+	if ttl > 0 && analysis != "" {
+		analysisCache.SetTTL(key, analysis, ttl)
+	}
+	return analysis
+}
+
+// analyzeWithAI 调用 AI 分析，允许模型查询历史指标
+func analyzeWithAI(client *ModelClient, issue string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
+	// 后台分析调用以高优先级排队，优先于交互式对话
+	release, err := DefaultLimiter.Acquire(ctx, "patrol", PriorityPatrol, nil)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
 	msgs := GetBaseMessages()
 	msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: issue})
 
-	resp, err := Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: getModelName(),
-		Messages: msgs,
-		Temperature: 0.0,
-	})
-	if err != nil {
-		return "AI Error: " + err.Error()
+	// 允许模型查询历史指标判断趋势，最后一轮不再提供工具以强制给出结论
+	for round := 0; ; round++ {
+		req := openai.ChatCompletionRequest{
+			Messages: msgs,
+			Temperature: 0.0,
+		}
+		if round < analyzeMaxToolRounds {
+			req.Tools = []openai.Tool{queryMetricsTool}
+		}
+
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || round >= analyzeMaxToolRounds {
+			return msg.Content, nil
+		}
+
+		msgs = append(msgs, msg)
+		for _, toolCall := range msg.ToolCalls {
+			if toolCall.Function.Name != queryMetricsTool.Function.Name {
+				addToolOutput(&msgs, toolCall.ID, "Error: tool not available during analysis.")
+				continue
+			}
+			addToolOutput(&msgs, toolCall.ID, queryMetrics(toolCall.Function.Arguments))
+		}
 	}
-	return resp.Choices[0].Message.Content
 }
 
+// analyzeMaxToolRounds 后台分析最多的工具调用轮数
+const analyzeMaxToolRounds = 3
+
 func ProcessAgentStep(msgs *[]openai.ChatCompletionMessage) (openai.ChatCompletionMessage, bool) {
 	return ProcessAgentStepForWeb(msgs, func(log string) {
 		// CLI 模式静默
 	}, true)
 }
 
+// ProcessAgentStepCLI 与 ProcessAgentStep 相同，命令按 ctx 中的 ShellRunner 执行（如 /host 切换到的远程主机）
+func ProcessAgentStepCLI(ctx context.Context, msgs *[]openai.ChatCompletionMessage) (openai.ChatCompletionMessage, bool) {
+	return processAgentStep(ctx, msgs, nil, func(string) {}, func(string) {}, true)
+}
+
 func ProcessAgentStepForWeb(msgs *[]openai.ChatCompletionMessage, logCallback func(string), isCLI ...bool) (openai.ChatCompletionMessage, bool) {
-	ctx := context.Background()
+	return processAgentStep(context.Background(), msgs, nil, logCallback, func(string) {}, len(isCLI) > 0 && isCLI[0])
+}
+
+// CancelledToolOutput 被用户取消的工具调用返回给模型的结果
+const CancelledToolOutput = "Cancelled by user."
+
+// ProcessAgentStepContext 执行一步 Agent 对话，ctx 取消时中断 AI 请求和正在执行的命令（终止进程）
+// 被中断的工具调用以 CancelledToolOutput 作为结果写入对话，保证对话记录完整；partialCallback 接收命令被终止前已产生的输出
+func ProcessAgentStepContext(ctx context.Context, msgs *[]openai.ChatCompletionMessage, logCallback, partialCallback func(string)) (openai.ChatCompletionMessage, bool) {
+	return processAgentStep(ctx, msgs, nil, logCallback, partialCallback, false)
+}
+
+// ProcessAgentStepStream 与 ProcessAgentStepContext 相同，但使用流式响应，助手回答的文本增量实时交给 deltaCallback；
+// 工具调用仍在完整响应后执行，日志照常通过 logCallback 推送。模型或接口不支持流式响应时自动改用普通请求，不会调用 deltaCallback
+func ProcessAgentStepStream(ctx context.Context, msgs *[]openai.ChatCompletionMessage, deltaCallback, logCallback, partialCallback func(string)) (openai.ChatCompletionMessage, bool) {
+	return processAgentStep(ctx, msgs, deltaCallback, logCallback, partialCallback, false)
+}
+
+func processAgentStep(ctx context.Context, msgs *[]openai.ChatCompletionMessage, deltaCallback, logCallback, partialCallback func(string), cli bool) (openai.ChatCompletionMessage, bool) {
+	client := ClientFor(config.UseChat)
+	if client == nil {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: ErrAIDisabled.Error()}, false
+	}
+
+	// 录制模式：记录请求、响应、命令审批和执行结果，用于回放回归测试
+	dir := recordDir()
+	if dir == "" {
+		return agentStep(ctx, client, msgs, deltaCallback, logCallback, partialCallback, cli)
+	}
+	trace := &stepTrace{}
+	request := append([]openai.ChatCompletionMessage(nil), (*msgs)...)
+	msg, cont := agentStep(withStepTrace(ctx, trace), client, msgs, deltaCallback, logCallback, partialCallback, cli)
+	defaultRecorder.record(dir, msgs, request, trace, msg, cont)
+	return msg, cont
+}
+
+// agentStep 执行一步 Agent 对话：请求模型，处理工具调用或文本中的命令；deltaCallback 不为空时使用流式响应
+func agentStep(ctx context.Context, client ChatCompleter, msgs *[]openai.ChatCompletionMessage, deltaCallback, logCallback, partialCallback func(string), cli bool) (openai.ChatCompletionMessage, bool) {
 	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 	
-	resp, err := Client.CreateChatCompletion(reqCtx, openai.ChatCompletionRequest{
-		Model: getModelName(),
+	// 对话超出上下文预算时先压缩较早的历史，避免接口返回上下文过长的错误
+	fitHistory(msgs, logCallback)
+	msg, err := requestCompletion(reqCtx, client, openai.ChatCompletionRequest{
 		Messages: *msgs, 
 		Tools: Tools, 
 		Temperature: 0.0,
-	})
+	}, deltaCallback)
 	
 	if err != nil {
+		if ctx.Err() != nil {
+			return openai.ChatCompletionMessage{}, false
+		}
 		logCallback(fmt.Sprintf("API Error: %v", err))
 		return openai.ChatCompletionMessage{}, false
 	}
-	msg := resp.Choices[0].Message
 	*msgs = append(*msgs, msg)
 
-	// 1. 处理 Tool Calls
+	// 1. 处理 Tool Calls，取消后剩余的调用也要写入结果，否则对话记录不完整
 	if len(msg.ToolCalls) > 0 {
 		for _, toolCall := range msg.ToolCalls {
-			handleToolCall(toolCall, msgs, logCallback)
+			if ctx.Err() != nil {
+				addToolOutput(msgs, toolCall.ID, CancelledToolOutput)
+				continue
+			}
+			handleToolCall(ctx, toolCall, msgs, logCallback, partialCallback)
 		}
-		return msg, true
+		return msg, ctx.Err() == nil
 	}
 
 	// 2. CLI 模式：检测代码块并询问保存
-	if len(isCLI) > 0 && isCLI[0] {
+	if cli {
 		filename, content := extractCodeBlock(msg.Content)
 		if filename != "" && content != "" {
-			fmt.Printf("\n\033[36m💾 检测到配置文件，是否保存为 '%s'? (y/N): \033[0m", filename)
-			reader := bufio.NewReader(os.Stdin)
-			input, _ := reader.ReadString('\n')
-			input = strings.TrimSpace(strings.ToLower(input))
-			if input == "y" || input == "yes" {
+			if utils.Confirm(fmt.Sprintf("\n\033[36m💾 检测到配置文件，是否保存为 '%s'? (y/N): \033[0m", filename), utils.ConfirmYes) {
 				err := os.WriteFile(filename, []byte(content), 0644)
 				if err == nil {
 					fmt.Printf("\033[32m✔ 文件已保存: %s\033[0m\n", filename)
@@ -253,11 +425,14 @@ func ProcessAgentStepForWeb(msgs *[]openai.ChatCompletionMessage, logCallback fu
 	// 3. 文本回退机制
 	cmd := extractCommandFromText(msg.Content)
 	if cmd != "" {
-		if isSafeAutoCommand(cmd) {
+		decision := security.EvaluateAutoExec(cmd)
+		logger.Info("[AUDIT] ⚙️ 自动执行策略: %q -> %s (规则: %s)", cmd, decision.Action, decision.Rule)
+		stepTraceFrom(ctx).decided(cmd, decision)
+		if decision.Action == security.ActionAuto && !strings.Contains(cmd, "| bash") && !strings.Contains(cmd, "| sh") {
 			logCallback(fmt.Sprintf("⚡ (自动捕获命令): %s", cmd))
-			output := utils.ExecuteShell(cmd)
-			if strings.TrimSpace(output) == "" { output = "(No output)" }
-			
+			res := executeCommand(ctx, cmd)
+			output := res.Format()
+
 			feedback := fmt.Sprintf("[System Output]:\n%s", output)
 			*msgs = append(*msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: feedback})
 
@@ -276,11 +451,7 @@ func ProcessAgentStepForWeb(msgs *[]openai.ChatCompletionMessage, logCallback fu
 func CheckAndSaveFile(content string) {
 	filename, fileContent := extractCodeBlock(content)
 	if filename != "" && fileContent != "" {
-		fmt.Printf("\n\033[36m💾 检测到配置文件，是否保存为 '%s'? (y/N): \033[0m", filename)
-		reader := bufio.NewReader(os.Stdin)
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(strings.ToLower(input))
-		if input == "y" || input == "yes" {
+		if utils.Confirm(fmt.Sprintf("\n\033[36m💾 检测到配置文件，是否保存为 '%s'? (y/N): \033[0m", filename), utils.ConfirmYes) {
 			err := os.WriteFile(filename, []byte(fileContent), 0644)
 			if err == nil {
 				fmt.Printf("\033[32m✔ 文件已保存: %s\033[0m\n", filename)
@@ -291,7 +462,7 @@ func CheckAndSaveFile(content string) {
 	}
 }
 
-func handleToolCall(toolCall openai.ToolCall, msgs *[]openai.ChatCompletionMessage, logCallback func(string)) {
+func handleToolCall(ctx context.Context, toolCall openai.ToolCall, msgs *[]openai.ChatCompletionMessage, logCallback, partialCallback func(string)) {
 	if toolCall.Function.Name == "execute_shell_command" {
 		var args map[string]string
 		json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
@@ -302,33 +473,127 @@ func handleToolCall(toolCall openai.ToolCall, msgs *[]openai.ChatCompletionMessa
 		logCallback(fmt.Sprintf("⚡ 意图: %s", reason))
 		logCallback(fmt.Sprintf("👉 命令: %s", cmdStr))
 
-		if !utils.IsCommandSafe(cmdStr) {
-			logCallback("❌ [拦截] 高危命令")
-			addToolOutput(msgs, toolCall.ID, "Error: Blocked.")
+		if denied := approveCommand(ctx, cmdStr, reason, logCallback); denied != "" {
+			addToolOutput(msgs, toolCall.ID, denied)
 			return
 		}
 
-		if utils.IsReadOnlyCommand(cmdStr) {
-			// Auto run
-		} else {
-			logCallback("⚠️ Web模式暂不支持交互式修改命令，已跳过")
-			addToolOutput(msgs, toolCall.ID, "User denied.")
+		res := executeCommand(ctx, cmdStr)
+		if ctx.Err() != nil {
+			logger.Info("[AUDIT] ⏹️ 命令已被用户取消: %q", cmdStr)
+			if strings.TrimSpace(res.Stdout+res.Stderr) == "" {
+				addToolOutput(msgs, toolCall.ID, CancelledToolOutput)
+				return
+			}
+			partialCallback(strings.TrimSuffix(res.Combined(), "\n(Command cancelled)"))
+			addToolOutput(msgs, toolCall.ID, CancelledToolOutput+" Partial output:\n"+res.Format())
 			return
 		}
+		addToolOutput(msgs, toolCall.ID, res.Format())
+	}
+
+	if toolCall.Function.Name == "query_metrics" {
+		logCallback("📈 查询历史指标")
+		addToolOutput(msgs, toolCall.ID, queryMetrics(toolCall.Function.Arguments))
+	}
 
-		output := utils.ExecuteShell(cmdStr)
-		if strings.TrimSpace(output) == "" { output = "(No output)" }
-		addToolOutput(msgs, toolCall.ID, output)
+	if isDeploymentTool(toolCall.Function.Name) {
+		addToolOutput(msgs, toolCall.ID, runDeploymentTool(ctx, toolCall.Function.Name, toolCall.Function.Arguments, logCallback))
+	}
+
+	if toolCall.Function.Name == "snapshot_container_volumes" {
+		var args map[string]string
+		json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
+		container := strings.TrimSpace(args["container"])
+		if container == "" {
+			addToolOutput(msgs, toolCall.ID, "Error: missing container.")
+			return
+		}
+
+		logCallback(fmt.Sprintf("⚡ 意图: %s", args["reason"]))
+		logCallback(fmt.Sprintf("📦 快照容器卷: %s", container))
+
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		defer cancel()
+		snapshot, err := backup.DefaultSnapshotManager().CreateSnapshot(ctx, container, args["reason"])
+		if err != nil {
+			addToolOutput(msgs, toolCall.ID, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		volumes := make([]string, 0, len(snapshot.Volumes))
+		for _, volume := range snapshot.Volumes {
+			volumes = append(volumes, fmt.Sprintf("%s (%d bytes)", volume.Volume, volume.Size))
+		}
+		addToolOutput(msgs, toolCall.ID, fmt.Sprintf("Snapshot %s created: %s", snapshot.ID, strings.Join(volumes, ", ")))
+	}
+}
+
+// approveCommand 按自动执行策略审批命令，允许执行时返回空字符串，否则返回写入对话的工具结果
+// 高危命令检查在策略规则之前执行；需要确认的命令交给 ctx 中的 Approver，没有时视为用户拒绝
+func approveCommand(ctx context.Context, cmdStr, reason string, logCallback func(string)) string {
+	decision := security.EvaluateAutoExec(cmdStr)
+	logger.Info("[AUDIT] ⚙️ 自动执行策略: %q -> %s (规则: %s)", cmdStr, decision.Action, decision.Rule)
+	stepTraceFrom(ctx).decided(cmdStr, decision)
+	switch decision.Action {
+	case security.ActionAuto:
+		return ""
+	case security.ActionDeny:
+		if decision.Rule == security.RuleSecurity {
+			logCallback("❌ [拦截] 高危命令")
+			return "Error: Blocked."
+		}
+		logCallback(fmt.Sprintf("❌ [拦截] 策略规则 %s 禁止执行", decision.Rule))
+		if decision.Reason != "" {
+			// 规则的说明同时告知模型，便于换用允许的做法
+			logCallback("原因: " + decision.Reason)
+			return "Error: Blocked. " + decision.Reason
+		}
+		return "Error: Blocked."
+	default:
+		approve, _ := ctx.Value(approverKey{}).(Approver)
+		if approve == nil {
+			logCallback(fmt.Sprintf("⚠️ Web模式暂不支持交互式修改命令，已跳过（%s）", decision.Describe()))
+			return "User denied."
+		}
+		logCallback(fmt.Sprintf("⏳ 等待确认（%s）", decision.Describe()))
+		approved := approve(ctx, CommandApproval{Command: cmdStr, Reason: reason, Policy: decision.Describe()})
+		stepTraceFrom(ctx).approved(approved)
+		if !approved {
+			logger.Info("[AUDIT] 🚫 用户拒绝执行: %q", cmdStr)
+			logCallback("🚫 用户拒绝执行")
+			return "User denied."
+		}
+		logger.Info("[AUDIT] ✅ 用户确认执行: %q", cmdStr)
+		return ""
+	}
+}
+
+// maxAuditOutput 审计日志中每个输出流保留的长度
+const maxAuditOutput = 1000
+
+// auditShellResult 在审计日志中记录命令的退出码、耗时以及脱敏后的 stdout 和 stderr
+func auditShellResult(res *utils.ShellResult) {
+	clip := func(s string) string {
+		s = security.Redact(strings.TrimSpace(s))
+		if len(s) > maxAuditOutput {
+			return s[:maxAuditOutput] + "...(truncated)"
+		}
+		return s
 	}
+	logger.Info("[AUDIT] 💻 命令执行结束: %q 退出码 %d, 耗时 %s, 超时 %v\nstdout:\n%s\nstderr:\n%s",
+		res.Command, res.ExitCode, res.Duration.Round(time.Millisecond), res.TimedOut, clip(res.Stdout), clip(res.Stderr))
 }
 
+// addToolOutput 追加工具输出，超出剩余上下文预算的输出先经 ShapeToolOutput 压缩
 func addToolOutput(msgs *[]openai.ChatCompletionMessage, id, content string) {
+	content = ShapeToolOutput(content, toolOutputBudget(*msgs))
 	*msgs = append(*msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, Content: content, ToolCallID: id})
 }
 
 func getModelName() string {
-	if config.GlobalConfig.Model != "" {
-		return config.GlobalConfig.Model
+	if config.Current().Model != "" {
+		return config.Current().Model
 	}
 	return DefaultModel
 }
@@ -396,6 +661,7 @@ func extractCodeBlock(text string) (string, string) {
 	return "", ""
 }
 
+// isSafeAutoCommand 判断单行文本是否为常见的运维命令，用于从纯文本回复中识别命令
 func isSafeAutoCommand(cmd string) bool {
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 { return false }
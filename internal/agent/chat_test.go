@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/security"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestAIDisabledWithoutKeyOrEndpoint(t *testing.T) {
+	saved := config.Current()
+	defer func() {
+		config.Store(saved)
+		InitClient()
+	}()
+
+	config.Update(func(cfg *config.Config) { cfg.ApiKey, cfg.BaseURL = "", "" })
+	InitClient()
+	if Enabled() {
+		t.Fatal("Expected AI to be disabled without API key or endpoint")
+	}
+
+	if got := AnalyzeWithAI("disk full"); !strings.Contains(got, ErrAIDisabled.Error()) {
+		t.Errorf("Expected explanatory analysis message, got %q", got)
+	}
+	msgs := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+	msg, cont := ProcessAgentStep(&msgs)
+	if cont || msg.Content != ErrAIDisabled.Error() {
+		t.Errorf("Expected disabled message and stop, got %q (continue=%v)", msg.Content, cont)
+	}
+
+	// 只配置本地端点（如 Ollama）时启用
+	config.Update(func(cfg *config.Config) { cfg.BaseURL = "http://127.0.0.1:11434/v1" })
+	InitClient()
+	if !Enabled() {
+		t.Error("Expected AI to be enabled with a local endpoint")
+	}
+}
+
+func TestProcessAgentStepContext_CancelKillsCommand(t *testing.T) {
+	saved := config.Current()
+	savedPolicy := security.CurrentAutoExecPolicy()
+	defer func() {
+		config.Store(saved)
+		security.SetAutoExecPolicy(savedPolicy)
+		InitClient()
+	}()
+
+	// 模型要求执行一个长时间运行的命令
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"execute_shell_command","arguments":"{\"command\":\"echo partial; sleep 30\",\"reason\":\"test\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"execute_shell_command","arguments":"{\"command\":\"echo never\",\"reason\":\"test\"}"}}
+		]}}]}`)
+	}))
+	defer api.Close()
+	config.Update(func(cfg *config.Config) { cfg.ApiKey, cfg.BaseURL = "test", api.URL })
+	InitClient()
+	// 链式命令中的每条命令都要被规则允许
+	policy, err := security.NewAutoExecPolicy(config.AutoExecConfig{Rules: []config.AutoExecRule{
+		{Match: "prefix", Pattern: "echo", Action: "auto"},
+		{Match: "prefix", Pattern: "sleep", Action: "auto"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetAutoExecPolicy(policy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	var partial string
+	msgs := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "grep the big log"}}
+	start := time.Now()
+	_, cont := ProcessAgentStepContext(ctx, &msgs, func(string) {}, func(output string) { partial = output })
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Cancelled command should be killed promptly, took %v", elapsed)
+	}
+	if cont {
+		t.Error("Agent loop should stop after cancellation")
+	}
+	if !strings.Contains(partial, "partial") {
+		t.Errorf("Expected partial output to be delivered, got %q", partial)
+	}
+	// 每个工具调用都有结果，被取消的调用告知模型
+	var outputs []openai.ChatCompletionMessage
+	for _, msg := range msgs {
+		if msg.Role == openai.ChatMessageRoleTool {
+			outputs = append(outputs, msg)
+		}
+	}
+	if len(outputs) != 2 || !strings.HasPrefix(outputs[0].Content, CancelledToolOutput) || outputs[1].Content != CancelledToolOutput {
+		t.Errorf("Expected cancelled tool results for both calls, got %+v", outputs)
+	}
+}
+
+func TestHandleToolCall_LabelsOutputStreams(t *testing.T) {
+	savedPolicy := security.CurrentAutoExecPolicy()
+	defer security.SetAutoExecPolicy(savedPolicy)
+	policy, err := security.NewAutoExecPolicy(config.AutoExecConfig{Rules: []config.AutoExecRule{
+		{Match: "prefix", Pattern: "echo", Action: "auto"},
+		{Match: "prefix", Pattern: "exit", Action: "auto"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetAutoExecPolicy(policy)
+
+	var msgs []openai.ChatCompletionMessage
+	toolCall := openai.ToolCall{ID: "call_1", Function: openai.FunctionCall{
+		Name:      "execute_shell_command",
+		Arguments: `{"command":"echo 42; echo 'deprecated option' >&2; exit 1","reason":"test"}`,
+	}}
+	handleToolCall(context.Background(), toolCall, &msgs, func(string) {}, func(string) {})
+
+	if len(msgs) != 1 || msgs[0].ToolCallID != "call_1" {
+		t.Fatalf("Expected one tool output, got %+v", msgs)
+	}
+	for _, want := range []string{"[exit_code] 1", "[stdout]\n42\n", "[stderr]\ndeprecated option"} {
+		if !strings.Contains(msgs[0].Content, want) {
+			t.Errorf("Expected %q in tool output:\n%s", want, msgs[0].Content)
+		}
+	}
+}
+
+func TestAnalyzeWithAI_CachesAnalysis(t *testing.T) {
+	saved := config.Current()
+	defer func() {
+		config.Store(saved)
+		InitClient()
+	}()
+
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"磁盘被日志占满"}}]}`)
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+	config.Update(func(cfg *config.Config) { cfg.ApiKey, cfg.BaseURL = "test", api.URL })
+	InitClient()
+
+	issue := fmt.Sprintf("disk full %d", time.Now().UnixNano())
+	if got := AnalyzeWithAI(issue); got != "磁盘被日志占满" {
+		t.Fatalf("Unexpected analysis %q", got)
+	}
+	if got := AnalyzeWithAI(issue); got != "磁盘被日志占满" || calls.Load() != 1 {
+		t.Errorf("Expected the cached analysis without another request, got %q after %d requests", got, calls.Load())
+	}
+
+	// 失败的分析不缓存，关闭缓存后每次都请求
+	other := issue + " again"
+	if got := AnalyzeWithAI(other); !strings.HasPrefix(got, "AI Error") {
+		t.Fatalf("Expected an error, got %q", got)
+	}
+	if _, ok := analysisCache.Get(analysisCacheKey(other)); ok {
+		t.Error("Failed analyses must not be cached")
+	}
+	config.Update(func(cfg *config.Config) { cfg.Cache.AnalysisTTLMinutes = -1 })
+	before := calls.Load()
+	AnalyzeWithAI(issue)
+	if calls.Load() == before {
+		t.Error("Expected a request when the analysis cache is disabled")
+	}
+}
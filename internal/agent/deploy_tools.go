@@ -0,0 +1,371 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"qwq/internal/container"
+	"qwq/internal/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 部署工具所需的权限，与 RBAC 默认权限同名
+const (
+	PermissionContainerRead  = "container:read"
+	PermissionContainerWrite = "container:write"
+)
+
+// defaultDeploymentListLimit list_deployments 默认返回的部署记录数
+const defaultDeploymentListLimit = 10
+
+// DeploymentBackend 部署工具调用的服务，Healing 为空时 get_healing_status 不可用
+type DeploymentBackend struct {
+	Compose container.ComposeService
+	Healing container.SelfHealingService
+}
+
+var (
+	deploymentBackendMu sync.RWMutex
+	deploymentBackend   *DeploymentBackend
+)
+
+// SetDeploymentBackend 设置部署工具使用的服务，传 nil 时部署工具返回未配置
+func SetDeploymentBackend(backend *DeploymentBackend) {
+	deploymentBackendMu.Lock()
+	defer deploymentBackendMu.Unlock()
+	deploymentBackend = backend
+}
+
+func currentDeploymentBackend() *DeploymentBackend {
+	deploymentBackendMu.RLock()
+	defer deploymentBackendMu.RUnlock()
+	return deploymentBackend
+}
+
+// PermissionFunc 判断调用者是否拥有指定权限
+type PermissionFunc func(permission string) bool
+
+type permissionsKey struct{}
+
+// WithPermissions 在上下文中记录调用者的权限，Web 对话据此限制 Agent 工具
+func WithPermissions(ctx context.Context, can PermissionFunc) context.Context {
+	return context.WithValue(ctx, permissionsKey{}, can)
+}
+
+// permitted 未记录权限时（CLI 本机管理员）允许所有操作
+func permitted(ctx context.Context, permission string) bool {
+	can, ok := ctx.Value(permissionsKey{}).(PermissionFunc)
+	return !ok || can == nil || can(permission)
+}
+
+// deploymentTools 部署相关工具，部署和回滚与修改类命令一样经过自动执行策略
+var deploymentTools = []openai.Tool{
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "list_deployments",
+			Description: "List managed compose projects, or the recent deployments of one project (newest first) with their IDs, versions and statuses.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"project": { "type": "string", "description": "Project name or ID. Omit to list all managed projects" },
+					"limit": { "type": "integer", "description": "Maximum number of deployments. Default 10" }
+				}
+			}`),
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "deploy_project",
+			Description: "Deploy the current compose file of a managed project through the deployment service. Production projects wait for approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"project": { "type": "string", "description": "Project name or ID" },
+					"reason": { "type": "string", "description": "The reason" }
+				},
+				"required": ["project", "reason"]
+			}`),
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "rollback_deployment",
+			Description: "Roll a deployment back to the previous successful deployment of its project. Use list_deployments to find the deployment ID.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"deployment_id": { "type": "integer", "description": "Deployment ID" },
+					"project": { "type": "string", "description": "Project name or ID the deployment must belong to" },
+					"reason": { "type": "string", "description": "The reason" }
+				},
+				"required": ["deployment_id", "reason"]
+			}`),
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "get_healing_status",
+			Description: "Get the self-healing health status and recent failure/restart history of a container.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"container": { "type": "string", "description": "Container ID" },
+					"limit": { "type": "integer", "description": "Maximum number of failure records. Default 10" }
+				},
+				"required": ["container"]
+			}`),
+		},
+	},
+}
+
+// deploymentToolArgs 部署工具参数
+type deploymentToolArgs struct {
+	Project      string `json:"project"`
+	DeploymentID uint   `json:"deployment_id"`
+	Container    string `json:"container"`
+	Limit        int    `json:"limit"`
+	Reason       string `json:"reason"`
+}
+
+// isDeploymentTool 是否为部署相关工具
+func isDeploymentTool(name string) bool {
+	for _, tool := range deploymentTools {
+		if tool.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deploymentSummary 返回给模型的部署信息
+type deploymentSummary struct {
+	ID              uint       `json:"id"`
+	ProjectID       uint       `json:"project_id"`
+	Version         string     `json:"version"`
+	Strategy        string     `json:"strategy"`
+	Status          string     `json:"status"`
+	Message         string     `json:"message,omitempty"`
+	RollbackVersion string     `json:"rollback_version,omitempty"`
+	RequestedBy     string     `json:"requested_by,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// projectSummary 返回给模型的项目信息
+type projectSummary struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Environment string `json:"environment,omitempty"`
+}
+
+func summarizeDeployment(d *container.Deployment) deploymentSummary {
+	return deploymentSummary{
+		ID: d.ID, ProjectID: d.ProjectID, Version: d.Version, Strategy: string(d.Strategy),
+		Status: string(d.Status), Message: d.Message, RollbackVersion: d.RollbackVersion,
+		RequestedBy: d.RequestedBy, StartedAt: d.StartedAt, CompletedAt: d.CompletedAt, CreatedAt: d.CreatedAt,
+	}
+}
+
+func summarizeProject(p *container.ComposeProject) projectSummary {
+	return projectSummary{ID: p.ID, Name: p.Name, Status: string(p.Status), Environment: p.Environment}
+}
+
+// runDeploymentTool 执行部署工具调用，返回 JSON 结果或错误说明
+func runDeploymentTool(ctx context.Context, name, arguments string, logCallback func(string)) string {
+	var args deploymentToolArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return fmt.Sprintf("Error: invalid arguments: %v", err)
+	}
+	backend := currentDeploymentBackend()
+	if backend == nil || backend.Compose == nil {
+		return "Error: deployment service not configured."
+	}
+
+	permission := PermissionContainerRead
+	if name == "deploy_project" || name == "rollback_deployment" {
+		permission = PermissionContainerWrite
+	}
+	if !permitted(ctx, permission) {
+		logCallback(fmt.Sprintf("❌ [拦截] 缺少权限 %s", permission))
+		return "Error: permission denied: " + permission
+	}
+
+	var result interface{}
+	var err error
+	switch name {
+	case "list_deployments":
+		logCallback("📋 查询部署记录")
+		result, err = listDeployments(ctx, backend, args)
+	case "deploy_project":
+		result, err = deployProject(ctx, backend, args, logCallback)
+	case "rollback_deployment":
+		result, err = rollbackDeployment(ctx, backend, args, logCallback)
+	case "get_healing_status":
+		logCallback(fmt.Sprintf("🩺 查询自愈状态: %s", args.Container))
+		result, err = healingStatus(ctx, backend, args)
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	// 被自动执行策略拦截时与 Shell 命令返回相同的结果
+	if output, ok := result.(string); ok {
+		return output
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return string(data)
+}
+
+// resolveProject 按名称或 ID 在数据库中查找受管项目
+func resolveProject(ctx context.Context, compose container.ComposeService, ref string) (*container.ComposeProject, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("missing project")
+	}
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		if project, err := compose.GetProject(ctx, uint(id)); err == nil {
+			return project, nil
+		}
+	}
+	projects, err := compose.ListProjects(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if project.Name == ref {
+			return project, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", container.ErrProjectNotFound, ref)
+}
+
+func listDeployments(ctx context.Context, backend *DeploymentBackend, args deploymentToolArgs) (interface{}, error) {
+	if strings.TrimSpace(args.Project) == "" {
+		projects, err := backend.Compose.ListProjects(ctx, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		summaries := make([]projectSummary, 0, len(projects))
+		for _, project := range projects {
+			summaries = append(summaries, summarizeProject(project))
+		}
+		return map[string]interface{}{"projects": summaries}, nil
+	}
+
+	project, err := resolveProject(ctx, backend.Compose, args.Project)
+	if err != nil {
+		return nil, err
+	}
+	deployments, err := backend.Compose.ListDeployments(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultDeploymentListLimit
+	}
+	if len(deployments) > limit {
+		deployments = deployments[:limit]
+	}
+	summaries := make([]deploymentSummary, 0, len(deployments))
+	for _, deployment := range deployments {
+		summaries = append(summaries, summarizeDeployment(deployment))
+	}
+	return map[string]interface{}{"project": summarizeProject(project), "deployments": summaries}, nil
+}
+
+func deployProject(ctx context.Context, backend *DeploymentBackend, args deploymentToolArgs, logCallback func(string)) (interface{}, error) {
+	project, err := resolveProject(ctx, backend.Compose, args.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	logCallback(fmt.Sprintf("⚡ 意图: %s", args.Reason))
+	logCallback(fmt.Sprintf("🚀 部署项目: %s", project.Name))
+	if denied := approveCommand(ctx, fmt.Sprintf("qwq deploy --project %d", project.ID), args.Reason, logCallback); denied != "" {
+		return denied, nil
+	}
+
+	deployment, err := backend.Compose.Deploy(ctx, project.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("[AUDIT] 🚀 Agent 发起部署: 项目 %s -> 部署 #%d (%s) by %s, 原因: %s",
+		project.Name, deployment.ID, deployment.Status, container.RequesterFromContext(ctx), args.Reason)
+	return map[string]interface{}{"project": summarizeProject(project), "deployment": summarizeDeployment(deployment)}, nil
+}
+
+func rollbackDeployment(ctx context.Context, backend *DeploymentBackend, args deploymentToolArgs, logCallback func(string)) (interface{}, error) {
+	if args.DeploymentID == 0 {
+		return nil, fmt.Errorf("missing deployment_id")
+	}
+	deployment, err := backend.Compose.GetDeployment(ctx, args.DeploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Project) != "" {
+		project, err := resolveProject(ctx, backend.Compose, args.Project)
+		if err != nil {
+			return nil, err
+		}
+		if project.ID != deployment.ProjectID {
+			return nil, fmt.Errorf("deployment #%d does not belong to project %s", deployment.ID, project.Name)
+		}
+	}
+
+	logCallback(fmt.Sprintf("⚡ 意图: %s", args.Reason))
+	logCallback(fmt.Sprintf("⏪ 回滚部署: #%d (项目 #%d)", deployment.ID, deployment.ProjectID))
+	if denied := approveCommand(ctx, fmt.Sprintf("qwq rollback --deployment %d", deployment.ID), args.Reason, logCallback); denied != "" {
+		return denied, nil
+	}
+
+	if err := backend.Compose.RollbackDeployment(ctx, deployment.ID); err != nil {
+		return nil, err
+	}
+	logger.Info("[AUDIT] ⏪ Agent 回滚部署: #%d (项目 #%d) by %s, 原因: %s",
+		deployment.ID, deployment.ProjectID, container.RequesterFromContext(ctx), args.Reason)
+	if updated, err := backend.Compose.GetDeployment(ctx, deployment.ID); err == nil {
+		deployment = updated
+	}
+	return map[string]interface{}{"deployment": summarizeDeployment(deployment)}, nil
+}
+
+func healingStatus(ctx context.Context, backend *DeploymentBackend, args deploymentToolArgs) (interface{}, error) {
+	if backend.Healing == nil {
+		return nil, fmt.Errorf("self-healing service not configured")
+	}
+	containerID := strings.TrimSpace(args.Container)
+	if containerID == "" {
+		return nil, fmt.Errorf("missing container")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultDeploymentListLimit
+	}
+
+	result := map[string]interface{}{"container": containerID, "registered": false}
+	if health, err := backend.Healing.GetContainerHealth(ctx, containerID); err == nil {
+		result["registered"] = true
+		result["health"] = health
+	}
+	failures, err := backend.Healing.GetFailureHistory(ctx, containerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	result["failures"] = failures
+	return result, nil
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/security"
+	"strings"
+	"testing"
+)
+
+// fakeCompose 只实现部署工具用到的方法
+type fakeCompose struct {
+	container.ComposeService
+	projects    []*container.ComposeProject
+	deployments []*container.Deployment
+	deployed    []string
+	rolledBack  []uint
+}
+
+func (f *fakeCompose) GetProject(ctx context.Context, id uint) (*container.ComposeProject, error) {
+	for _, project := range f.projects {
+		if project.ID == id {
+			return project, nil
+		}
+	}
+	return nil, container.ErrProjectNotFound
+}
+
+func (f *fakeCompose) ListProjects(ctx context.Context, userID, tenantID uint) ([]*container.ComposeProject, error) {
+	return f.projects, nil
+}
+
+func (f *fakeCompose) ListDeployments(ctx context.Context, projectID uint) ([]*container.Deployment, error) {
+	var result []*container.Deployment
+	for _, deployment := range f.deployments {
+		if deployment.ProjectID == projectID {
+			result = append(result, deployment)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeCompose) GetDeployment(ctx context.Context, id uint) (*container.Deployment, error) {
+	for _, deployment := range f.deployments {
+		if deployment.ID == id {
+			return deployment, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get deployment: record not found")
+}
+
+func (f *fakeCompose) Deploy(ctx context.Context, projectID uint, cfg *container.DeploymentConfig) (*container.Deployment, error) {
+	f.deployed = append(f.deployed, container.RequesterFromContext(ctx))
+	return &container.Deployment{ID: 99, ProjectID: projectID, Status: container.DeploymentStatusPending}, nil
+}
+
+func (f *fakeCompose) RollbackDeployment(ctx context.Context, deploymentID uint) error {
+	f.rolledBack = append(f.rolledBack, deploymentID)
+	return nil
+}
+
+func setupDeploymentTools(t *testing.T) *fakeCompose {
+	savedPolicy := security.CurrentAutoExecPolicy()
+	t.Cleanup(func() {
+		SetDeploymentBackend(nil)
+		security.SetAutoExecPolicy(savedPolicy)
+	})
+	compose := &fakeCompose{
+		projects: []*container.ComposeProject{{ID: 1, Name: "api"}, {ID: 2, Name: "web"}},
+		deployments: []*container.Deployment{
+			{ID: 12, ProjectID: 1, Version: "v2", Status: container.DeploymentStatusCompleted},
+			{ID: 11, ProjectID: 1, Version: "v1", Status: container.DeploymentStatusCompleted},
+			{ID: 20, ProjectID: 2, Version: "v1", Status: container.DeploymentStatusCompleted},
+		},
+	}
+	SetDeploymentBackend(&DeploymentBackend{Compose: compose})
+	return compose
+}
+
+func TestDeploymentTools_ListDeployments(t *testing.T) {
+	setupDeploymentTools(t)
+
+	output := runDeploymentTool(context.Background(), "list_deployments", `{"project":"api","limit":1}`, func(string) {})
+	var result struct {
+		Project     projectSummary      `json:"project"`
+		Deployments []deploymentSummary `json:"deployments"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("Expected JSON result, got %q", output)
+	}
+	if result.Project.ID != 1 || len(result.Deployments) != 1 || result.Deployments[0].ID != 12 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	if output := runDeploymentTool(context.Background(), "list_deployments", `{"project":"missing"}`, func(string) {}); !strings.Contains(output, container.ErrProjectNotFound.Error()) {
+		t.Errorf("Unknown project should be rejected, got %q", output)
+	}
+}
+
+func TestDeploymentTools_MutatingToolsNeedApprovalAndPermission(t *testing.T) {
+	compose := setupDeploymentTools(t)
+	ctx := container.WithRequester(context.Background(), "alice")
+
+	// 默认策略需要确认，Web 对话中视为拒绝
+	security.SetAutoExecPolicy(nil)
+	if output := runDeploymentTool(ctx, "deploy_project", `{"project":"api","reason":"release"}`, func(string) {}); output != "User denied." {
+		t.Errorf("Expected deploy to need confirmation, got %q", output)
+	}
+	// 有 Approver 时按用户的确认结果执行，拒绝同样以 "User denied." 告知模型
+	var asked []CommandApproval
+	deny := WithApprover(ctx, func(_ context.Context, req CommandApproval) bool {
+		asked = append(asked, req)
+		return false
+	})
+	if output := runDeploymentTool(deny, "deploy_project", `{"project":"api","reason":"release"}`, func(string) {}); output != "User denied." {
+		t.Errorf("Expected the denied deploy to be skipped, got %q", output)
+	}
+	if len(asked) != 1 || asked[0].Command != "qwq deploy --project 1" || asked[0].Reason != "release" {
+		t.Errorf("Expected one approval request for the deploy, got %+v", asked)
+	}
+
+	policy, err := security.NewAutoExecPolicy(config.AutoExecConfig{Rules: []config.AutoExecRule{
+		{Match: "prefix", Pattern: "qwq deploy", Action: "auto"},
+		{Match: "prefix", Pattern: "qwq rollback", Action: "auto"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetAutoExecPolicy(policy)
+
+	readOnly := WithPermissions(ctx, func(permission string) bool { return permission == PermissionContainerRead })
+	if output := runDeploymentTool(readOnly, "deploy_project", `{"project":"api","reason":"release"}`, func(string) {}); !strings.Contains(output, "permission denied") {
+		t.Errorf("Expected permission error, got %q", output)
+	}
+	if len(compose.deployed) != 0 {
+		t.Fatalf("Denied deploys must not reach the service, got %v", compose.deployed)
+	}
+
+	output := runDeploymentTool(ctx, "deploy_project", `{"project":"api","reason":"release"}`, func(string) {})
+	if !strings.Contains(output, `"id":99`) || len(compose.deployed) != 1 || compose.deployed[0] != "alice" {
+		t.Errorf("Expected deploy by alice, got %q (%v)", output, compose.deployed)
+	}
+
+	// 部署 ID 必须属于指定项目
+	if output := runDeploymentTool(ctx, "rollback_deployment", `{"deployment_id":20,"project":"api","reason":"bad"}`, func(string) {}); !strings.Contains(output, "does not belong") {
+		t.Errorf("Expected project mismatch error, got %q", output)
+	}
+	if output := runDeploymentTool(ctx, "rollback_deployment", `{"deployment_id":404,"reason":"bad"}`, func(string) {}); !strings.HasPrefix(output, "Error:") {
+		t.Errorf("Expected unknown deployment error, got %q", output)
+	}
+	runDeploymentTool(ctx, "rollback_deployment", `{"deployment_id":12,"project":"api","reason":"bad release"}`, func(string) {})
+	if len(compose.rolledBack) != 1 || compose.rolledBack[0] != 12 {
+		t.Errorf("Expected rollback of #12, got %v", compose.rolledBack)
+	}
+}
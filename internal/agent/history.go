@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"fmt"
+	"qwq/internal/config"
+	"reflect"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultKeepTurns 压缩对话历史时默认原样保留的最近轮数
+	DefaultKeepTurns = 4
+	// historySummaryPrefix 压缩较早对话生成的系统消息的开头，再次压缩时识别并合并
+	historySummaryPrefix = "[对话摘要]"
+	// summaryUserRunes、summaryReplyRunes 摘要中每条用户消息、助手回复和命令结果保留的字符数
+	summaryUserRunes  = 200
+	summaryReplyRunes = 160
+	// minSummaryTokens 摘要的最低预算，不足时只注明省略的消息数
+	minSummaryTokens = 64
+)
+
+// ContextManager 对话历史的 token 预算：估算超出预算时，把较早的工具输出和问答压缩成一条系统消息，
+// 开头的系统提示词（含示例对话）和最近 KeepTurns 轮始终原样保留；最近的轮次本身超出预算时再压缩其中的工具输出
+type ContextManager struct {
+	Budget    int              // 对话历史的估算 token 上限
+	KeepTurns int              // 原样保留的最近轮数，每轮从一条用户消息开始
+	Pinned    int              // 开头始终保留的消息数
+	Estimate  func(string) int // token 估算方法，为空时使用 EstimateTokens
+}
+
+// NewContextManager 按 analysis_budget 配置创建对话历史预算，pinned 为开头始终保留的消息数
+// 默认预算为上下文窗口扣除回复预留后的四分之三，其余留给工具定义和新的命令输出
+func NewContextManager(pinned int) ContextManager {
+	cfg := config.Current().AnalysisBudget
+	window := cfg.ContextTokens
+	if window <= 0 {
+		window = DefaultContextTokens
+	}
+	budget := cfg.HistoryTokens
+	if budget <= 0 {
+		budget = (window - responseReserveTokens) * 3 / 4
+	}
+	keep := cfg.KeepTurns
+	if keep <= 0 {
+		keep = DefaultKeepTurns
+	}
+	return ContextManager{Budget: budget, KeepTurns: keep, Pinned: pinned}
+}
+
+func (m ContextManager) estimate(text string) int {
+	if m.Estimate != nil {
+		return m.Estimate(text)
+	}
+	return EstimateTokens(text)
+}
+
+// Tokens 估算对话占用的 token
+func (m ContextManager) Tokens(msgs []openai.ChatCompletionMessage) int {
+	total := 0
+	for _, msg := range msgs {
+		total += messageOverheadTokens + m.estimate(msg.Content)
+		for _, call := range msg.ToolCalls {
+			total += m.estimate(call.Function.Name) + m.estimate(call.Function.Arguments)
+		}
+	}
+	return total
+}
+
+// Fit 把对话限制在预算内，返回结果和被压缩进摘要的消息数；未超出预算时原样返回
+// 保留的部分总是从一条用户消息开始，工具调用和对应的结果不会被拆开
+func (m ContextManager) Fit(msgs []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, int) {
+	if m.Tokens(msgs) <= m.Budget {
+		return msgs, 0
+	}
+	pinned := min(m.Pinned, len(msgs))
+	var turns []int
+	for i := pinned; i < len(msgs); i++ {
+		if msgs[i].Role == openai.ChatMessageRoleUser {
+			turns = append(turns, i)
+		}
+	}
+
+	head := msgs[:pinned:pinned]
+	// 先尝试保留 KeepTurns 轮，摘要没有空间时逐步减少，至少保留最后一轮
+	cut := pinned
+	for keep := min(max(m.KeepTurns, 1), len(turns)); keep >= 1; keep-- {
+		cut = turns[len(turns)-keep]
+		if cut > pinned && m.Budget-m.Tokens(head)-m.Tokens(msgs[cut:])-messageOverheadTokens >= minSummaryTokens {
+			break
+		}
+	}
+
+	out := append([]openai.ChatCompletionMessage{}, head...)
+	if cut > pinned {
+		available := m.Budget - m.Tokens(head) - m.Tokens(msgs[cut:]) - messageOverheadTokens
+		out = append(out, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: m.summarize(msgs[pinned:cut], available)})
+	}
+	out = m.shrinkRecent(out, msgs[cut:])
+	return out, cut - pinned
+}
+
+// shrinkRecent 追加最近的轮次，仍超出预算时按剩余空间均分压缩其中的工具输出
+func (m ContextManager) shrinkRecent(out, recent []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	recent = append([]openai.ChatCompletionMessage{}, recent...)
+	over := m.Tokens(out) + m.Tokens(recent) - m.Budget
+	var tools []int
+	for i, msg := range recent {
+		if msg.Role == openai.ChatMessageRoleTool {
+			tools = append(tools, i)
+		}
+	}
+	if over > 0 && len(tools) > 0 {
+		size := 0
+		for _, i := range tools {
+			size += m.estimate(recent[i].Content)
+		}
+		share := max((size-over)/len(tools), minToolOutputTokens)
+		for _, i := range tools {
+			recent[i].Content = ShapeToolOutput(recent[i].Content, share)
+		}
+	}
+	return append(out, recent...)
+}
+
+// summarize 把较早的消息压缩成一条摘要：每条用户消息、助手回复、命令及其结果一行，超出 budget 时省略最早的行
+func (m ContextManager) summarize(msgs []openai.ChatCompletionMessage, budget int) string {
+	var lines []string
+	for _, msg := range msgs {
+		switch {
+		case msg.Role == openai.ChatMessageRoleSystem && strings.HasPrefix(msg.Content, historySummaryPrefix):
+			// 之前生成的摘要，去掉标题行后合并
+			if _, body, ok := strings.Cut(msg.Content, "\n"); ok {
+				lines = append(lines, strings.Split(body, "\n")...)
+			}
+		case msg.Role == openai.ChatMessageRoleUser:
+			lines = append(lines, "- 用户: "+clipRunes(msg.Content, summaryUserRunes))
+		case msg.Role == openai.ChatMessageRoleTool:
+			lines = append(lines, "  结果: "+clipRunes(msg.Content, summaryReplyRunes))
+		default:
+			for _, call := range msg.ToolCalls {
+				lines = append(lines, fmt.Sprintf("  调用 %s %s", call.Function.Name, clipRunes(call.Function.Arguments, summaryReplyRunes)))
+			}
+			if strings.TrimSpace(msg.Content) != "" {
+				lines = append(lines, "  助手: "+clipRunes(msg.Content, summaryReplyRunes))
+			}
+		}
+	}
+
+	header := fmt.Sprintf("%s 为控制上下文长度，较早的 %d 条消息已压缩为以下要点（命令结果可能已过时，需要时重新执行）：", historySummaryPrefix, len(msgs))
+	used := m.estimate(header)
+	start := len(lines)
+	for start > 0 && used+m.estimate(lines[start-1])+1 <= budget {
+		start--
+		used += m.estimate(lines[start]) + 1
+	}
+	kept := lines[start:]
+	if start > 0 {
+		kept = append([]string{fmt.Sprintf("  ... 更早的 %d 条要点已省略", start)}, kept...)
+	}
+	return header + "\n" + strings.Join(kept, "\n")
+}
+
+// clipRunes 合并空白后截断到 n 个字符
+func clipRunes(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
+
+// basePrefixLen 对话开头与 GetBaseMessages 相同的消息数（系统提示词和示例对话），压缩历史时始终保留
+func basePrefixLen(msgs []openai.ChatCompletionMessage) int {
+	base := GetBaseMessages()
+	n := 0
+	for n < len(base) && n < len(msgs) && reflect.DeepEqual(base[n], msgs[n]) {
+		n++
+	}
+	if n == 0 && len(msgs) > 0 && msgs[0].Role == openai.ChatMessageRoleSystem {
+		// 知识库在对话期间变化时系统提示词不同，仍然保留
+		n = 1
+	}
+	return n
+}
+
+// fitHistory 请求模型之前把对话限制在预算内，压缩后的对话写回 msgs，之后的请求不再重复压缩
+func fitHistory(msgs *[]openai.ChatCompletionMessage, logCallback func(string)) {
+	manager := NewContextManager(basePrefixLen(*msgs))
+	if manager.Tokens(*msgs) <= manager.Budget {
+		return
+	}
+	fitted, folded := manager.Fit(*msgs)
+	*msgs = fitted
+	if folded > 0 {
+		logCallback(fmt.Sprintf("📉 对话过长，已将较早的 %d 条消息压缩为摘要", folded))
+	}
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"qwq/internal/config"
+	"reflect"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// longConversation 系统提示词和示例对话之后的 turns 轮对话，每轮执行一条输出很长的命令
+func longConversation(turns int) []openai.ChatCompletionMessage {
+	msgs := GetBaseMessages()
+	for i := 0; i < turns; i++ {
+		id := fmt.Sprintf("call_t%d", i)
+		msgs = append(msgs,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("第 %d 个问题：看看日志", i)},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: id, Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "execute_shell_command", Arguments: fmt.Sprintf(`{"command":"tail -n 500 /var/log/app%d.log"}`, i)}}}},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: id, Content: strings.Repeat(fmt.Sprintf("line %d: request handled in 12ms\n", i), 400)},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: fmt.Sprintf("第 %d 个日志正常", i)},
+		)
+	}
+	return msgs
+}
+
+// checkToolPairs 每条工具结果之前都有对应的工具调用
+func checkToolPairs(t *testing.T, msgs []openai.ChatCompletionMessage) {
+	t.Helper()
+	calls := map[string]bool{}
+	for _, msg := range msgs {
+		for _, call := range msg.ToolCalls {
+			calls[call.ID] = true
+		}
+		if msg.Role == openai.ChatMessageRoleTool && !calls[msg.ToolCallID] {
+			t.Errorf("Tool output %s has no matching tool call", msg.ToolCallID)
+		}
+	}
+}
+
+func TestContextManager_FitsOversizedHistory(t *testing.T) {
+	msgs := longConversation(30)
+	base := len(GetBaseMessages())
+	manager := ContextManager{Budget: 20000, KeepTurns: 3, Pinned: base}
+	if manager.Tokens(msgs) <= manager.Budget {
+		t.Fatalf("Test history should exceed the budget, got %d tokens", manager.Tokens(msgs))
+	}
+
+	fitted, folded := manager.Fit(msgs)
+	if tokens := manager.Tokens(fitted); tokens > manager.Budget {
+		t.Errorf("Expected the history to fit in %d tokens, got %d", manager.Budget, tokens)
+	}
+	if !reflect.DeepEqual(fitted[:base], msgs[:base]) {
+		t.Error("Expected the system prompt and examples to be kept verbatim")
+	}
+	summary := fitted[base]
+	if summary.Role != openai.ChatMessageRoleSystem || !strings.HasPrefix(summary.Content, historySummaryPrefix) || !strings.Contains(summary.Content, "第 26 个问题") {
+		t.Errorf("Expected the older turns to be summarized, got %+v", summary)
+	}
+	// 最近 3 轮原样保留
+	if !reflect.DeepEqual(fitted[base+1:], msgs[len(msgs)-12:]) || folded != len(msgs)-12-base {
+		t.Errorf("Expected the last 3 turns to be kept verbatim, folded %d messages", folded)
+	}
+	checkToolPairs(t, fitted)
+
+	// 再次超出预算时合并之前的摘要
+	next := append(fitted, longConversation(3)[base:]...)
+	refitted, _ := manager.Fit(next)
+	if tokens := manager.Tokens(refitted); tokens > manager.Budget {
+		t.Errorf("Expected the refitted history to fit, got %d tokens", tokens)
+	}
+	if n := strings.Count(refitted[base].Content, historySummaryPrefix); n != 1 || strings.Count(refitted[base+1].Content, historySummaryPrefix) != 0 {
+		t.Errorf("Expected a single merged summary, got %q", refitted[base].Content)
+	}
+}
+
+func TestContextManager_ShrinksOversizedLastTurn(t *testing.T) {
+	msgs := longConversation(1)
+	question := "磁盘为什么满了"
+	msgs = append(msgs,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: question},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "call_du", Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "execute_shell_command", Arguments: `{"command":"du -ah /var"}`}}}},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: "call_du", Content: strings.Repeat("4.0K\t/var/lib/docker/overlay2/abcdef/file\n", 3000) + "ERROR: du: cannot read directory"},
+	)
+	manager := ContextManager{Budget: 3000, KeepTurns: 4, Pinned: len(GetBaseMessages())}
+
+	fitted, _ := manager.Fit(msgs)
+	if tokens := manager.Tokens(fitted); tokens > manager.Budget {
+		t.Errorf("Expected the history to fit in %d tokens, got %d", manager.Budget, tokens)
+	}
+	last := fitted[len(fitted)-1]
+	if fitted[len(fitted)-3].Content != question || last.ToolCallID != "call_du" || !strings.Contains(last.Content, "cannot read directory") {
+		t.Errorf("Expected the latest question and a shaped tool output, got %+v", fitted[len(fitted)-3:])
+	}
+	checkToolPairs(t, fitted)
+}
+
+func TestAgentStep_FitsHistoryBeforeRequest(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.AnalysisBudget.HistoryTokens = 6000 })
+
+	msgs := longConversation(20)
+	msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "现在负载多少"})
+	completer := &captureCompleter{reply: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "负载 0.3"}}
+	var logs []string
+	agentStep(context.Background(), completer, &msgs, nil, func(log string) { logs = append(logs, log) }, func(string) {}, false)
+
+	sent := completer.requests[0].Messages
+	if tokens := (ContextManager{}).Tokens(sent); tokens > 6000 {
+		t.Errorf("Expected the request to fit the history budget, got %d tokens", tokens)
+	}
+	if sent[len(sent)-1].Content != "现在负载多少" || len(logs) != 1 || !strings.Contains(logs[0], "压缩为摘要") {
+		t.Errorf("Expected the latest question to be sent after compaction, logs %q", logs)
+	}
+	// 压缩后的对话写回，之后的请求不再重复压缩
+	if len(msgs) != len(sent)+1 {
+		t.Errorf("Expected the compacted history to replace the conversation, got %d messages", len(msgs))
+	}
+}
+
+// captureCompleter 记录收到的请求并返回固定回复
+type captureCompleter struct {
+	reply    openai.ChatCompletionMessage
+	requests []openai.ChatCompletionRequest
+}
+
+func (c *captureCompleter) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	c.requests = append(c.requests, req)
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: c.reply}}}, nil
+}
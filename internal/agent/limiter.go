@@ -0,0 +1,352 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+)
+
+// 默认限流参数（速率单位：每分钟）
+const (
+	DefaultUserRate      = 10.0
+	DefaultUserBurst     = 5
+	DefaultGlobalRate    = 60.0
+	DefaultGlobalBurst   = 20
+	DefaultMaxConcurrent = 3
+	DefaultMaxQueue      = 20
+
+	// limiterPruneInterval 清理空闲用户令牌桶的最小间隔
+	limiterPruneInterval = time.Minute
+	// StatusMaxUsers /api/ai/status 最多列出的用户数，优先列出剩余令牌最少的用户
+	StatusMaxUsers = 50
+)
+
+var (
+	// ErrRateLimited 请求过于频繁
+	ErrRateLimited = errors.New("ai rate limit exceeded")
+	// ErrQueueFull 排队人数已满
+	ErrQueueFull = errors.New("ai agent queue is full")
+)
+
+// Priority AI 调用优先级
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // 交互式对话
+	PriorityPatrol                      // 巡检等后台分析，优先于交互式请求
+)
+
+// RateLimitError 限流错误，包含建议的重试等待时间
+type RateLimitError struct {
+	Scope      string        // user 或 global
+	RetryAfter time.Duration // 建议等待时间
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry after %v", e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap 支持 errors.Is(err, ErrRateLimited)
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take 按当前速率补充令牌并尝试取出一个，失败时返回需要等待的时间
+func (b *tokenBucket) take(now time.Time, ratePerMin float64, burst int) (bool, time.Duration) {
+	perSecond := ratePerMin / 60
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if perSecond <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+}
+
+// peek 计算当前可用令牌数，不修改桶状态
+func (b *tokenBucket) peek(now time.Time, ratePerMin float64, burst int) float64 {
+	if b.last.IsZero() {
+		return float64(burst)
+	}
+	return math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*ratePerMin/60)
+}
+
+// waiter 等待执行槽位的请求
+type waiter struct {
+	user     string
+	priority Priority
+	ready    chan struct{}
+}
+
+// Limiter AI 调用限流器
+// 令牌桶限制消息速率，并发槽位限制同时运行的 Agent 循环，排队时巡检请求优先
+type Limiter struct {
+	mu     sync.Mutex
+	users  map[string]*tokenBucket
+	global tokenBucket
+	active int
+	queue  []*waiter
+	limits func() config.AILimitConfig
+	now    func() time.Time
+
+	rejected  int64
+	lastPrune time.Time
+}
+
+// LimiterStatus 限流器状态，用于 /api/ai/status
+type LimiterStatus struct {
+	Active        int                  `json:"active"`
+	MaxConcurrent int                  `json:"max_concurrent"`
+	Queued        int                  `json:"queued"`
+	QueuedPatrol  int                  `json:"queued_patrol"`
+	MaxQueue      int                  `json:"max_queue"`
+	GlobalTokens  float64              `json:"global_tokens"`
+	UserTokens    map[string]float64   `json:"user_tokens"`   // 最多 StatusMaxUsers 个用户
+	TrackedUsers  int                  `json:"tracked_users"` // 当前保留令牌桶的用户数
+	Rejected      int64                `json:"rejected"`
+	Limits        config.AILimitConfig `json:"limits"`
+}
+
+// NewLimiter 创建限流器，limits 每次调用时读取，因此配置变更会立即生效
+func NewLimiter(limits func() config.AILimitConfig) *Limiter {
+	return &Limiter{
+		users:  make(map[string]*tokenBucket),
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// DefaultLimiter 全局 AI 限流器，限流参数来自 config.Current().AILimits
+var DefaultLimiter = NewLimiter(func() config.AILimitConfig {
+	return config.Current().AILimits
+})
+
+// effectiveLimits 获取填充默认值后的限流参数
+func (l *Limiter) effectiveLimits() config.AILimitConfig {
+	cfg := l.limits()
+	if cfg.UserRate <= 0 {
+		cfg.UserRate = DefaultUserRate
+	}
+	if cfg.UserBurst <= 0 {
+		cfg.UserBurst = DefaultUserBurst
+	}
+	if cfg.GlobalRate <= 0 {
+		cfg.GlobalRate = DefaultGlobalRate
+	}
+	if cfg.GlobalBurst <= 0 {
+		cfg.GlobalBurst = DefaultGlobalBurst
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = DefaultMaxConcurrent
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = DefaultMaxQueue
+	}
+	return cfg
+}
+
+// Allow 检查用户的消息速率，超限时返回 *RateLimitError
+func (l *Limiter) Allow(user string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg := l.effectiveLimits()
+	now := l.now()
+	l.pruneLocked(now, cfg)
+
+	bucket, ok := l.users[user]
+	if !ok {
+		bucket = &tokenBucket{}
+		l.users[user] = bucket
+	}
+
+	// 先检查用户桶，避免单个用户消耗全局令牌
+	if ok, wait := bucket.take(now, cfg.UserRate, cfg.UserBurst); !ok {
+		l.rejected++
+		return &RateLimitError{Scope: "user", RetryAfter: wait}
+	}
+	if ok, wait := l.global.take(now, cfg.GlobalRate, cfg.GlobalBurst); !ok {
+		bucket.tokens++ // 归还用户令牌
+		l.rejected++
+		return &RateLimitError{Scope: "global", RetryAfter: wait}
+	}
+	return nil
+}
+
+// pruneLocked 删除已经补满的用户令牌桶，补满的桶与新建的桶等价，删除不影响限流；
+// 未启用认证时按客户端地址限流，不清理时用户数会无限增长
+func (l *Limiter) pruneLocked(now time.Time, cfg config.AILimitConfig) {
+	if now.Sub(l.lastPrune) < limiterPruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for user, bucket := range l.users {
+		if bucket.peek(now, cfg.UserRate, cfg.UserBurst) >= float64(cfg.UserBurst) {
+			delete(l.users, user)
+		}
+	}
+}
+
+// Acquire 获取一个 Agent 执行槽位，返回的 release 函数必须调用
+// 槽位已满时排队等待，onQueued 在入队时回调当前排队位置（从 1 开始）
+func (l *Limiter) Acquire(ctx context.Context, user string, priority Priority, onQueued func(position int)) (func(), error) {
+	l.mu.Lock()
+	cfg := l.effectiveLimits()
+	l.dispatchLocked() // 并发上限可能已被热加载调大
+
+	if l.active < cfg.MaxConcurrent && len(l.queue) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return l.releaseFunc(), nil
+	}
+
+	if priority == PriorityInteractive && l.countQueued(PriorityInteractive) >= cfg.MaxQueue {
+		l.rejected++
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	w := &waiter{user: user, priority: priority, ready: make(chan struct{})}
+	position := l.enqueue(w)
+	l.mu.Unlock()
+
+	if onQueued != nil {
+		onQueued(position)
+	}
+
+	select {
+	case <-w.ready:
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// 已经分配到槽位，直接归还
+			l.active--
+			l.dispatchLocked()
+		default:
+			l.removeLocked(w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// enqueue 入队：巡检请求排在所有交互式请求之前，返回排队位置
+func (l *Limiter) enqueue(w *waiter) int {
+	index := len(l.queue)
+	if w.priority == PriorityPatrol {
+		index = 0
+		for index < len(l.queue) && l.queue[index].priority == PriorityPatrol {
+			index++
+		}
+	}
+	l.queue = append(l.queue, nil)
+	copy(l.queue[index+1:], l.queue[index:])
+	l.queue[index] = w
+	return index + 1
+}
+
+// removeLocked 从队列中移除等待者
+func (l *Limiter) removeLocked(w *waiter) {
+	for i, item := range l.queue {
+		if item == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatchLocked 将空闲槽位分配给队首的等待者
+func (l *Limiter) dispatchLocked() {
+	cfg := l.effectiveLimits()
+	for l.active < cfg.MaxConcurrent && len(l.queue) > 0 {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		l.active++
+		close(w.ready)
+	}
+}
+
+// releaseFunc 创建只会生效一次的释放函数
+func (l *Limiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.active--
+			l.dispatchLocked()
+		})
+	}
+}
+
+func (l *Limiter) countQueued(priority Priority) int {
+	count := 0
+	for _, w := range l.queue {
+		if w.priority == priority {
+			count++
+		}
+	}
+	return count
+}
+
+// Status 获取限流器当前状态
+func (l *Limiter) Status() LimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg := l.effectiveLimits()
+	status := LimiterStatus{
+		Active:        l.active,
+		MaxConcurrent: cfg.MaxConcurrent,
+		Queued:        len(l.queue),
+		QueuedPatrol:  l.countQueued(PriorityPatrol),
+		MaxQueue:      cfg.MaxQueue,
+		UserTokens:    make(map[string]float64),
+		TrackedUsers:  len(l.users),
+		Rejected:      l.rejected,
+		Limits:        cfg,
+	}
+	now := l.now()
+	status.GlobalTokens = l.global.peek(now, cfg.GlobalRate, cfg.GlobalBurst)
+
+	type userTokens struct {
+		user   string
+		tokens float64
+	}
+	users := make([]userTokens, 0, len(l.users))
+	for user, bucket := range l.users {
+		users = append(users, userTokens{user, bucket.peek(now, cfg.UserRate, cfg.UserBurst)})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].tokens != users[j].tokens {
+			return users[i].tokens < users[j].tokens
+		}
+		return users[i].user < users[j].user
+	})
+	for _, u := range users[:min(len(users), StatusMaxUsers)] {
+		status.UserTokens[u.user] = u.tokens
+	}
+	return status
+}
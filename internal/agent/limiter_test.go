@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+)
+
+func newTestLimiter(cfg *config.AILimitConfig) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(func() config.AILimitConfig { return *cfg })
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLimiter_UserTokenBucket(t *testing.T) {
+	cfg := &config.AILimitConfig{UserRate: 6, UserBurst: 2, GlobalRate: 600, GlobalBurst: 100}
+	limiter, now := newTestLimiter(cfg)
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Allow("alice"); err != nil {
+			t.Fatalf("Request %d should be allowed: %v", i, err)
+		}
+	}
+
+	err := limiter.Allow("alice")
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.Scope != "user" || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected user rate limit error, got %v", err)
+	}
+	if rateErr.RetryAfter != 10*time.Second {
+		t.Errorf("Expected retry after 10s, got %v", rateErr.RetryAfter)
+	}
+
+	// 其他用户不受影响
+	if err := limiter.Allow("bob"); err != nil {
+		t.Errorf("Other user should be allowed: %v", err)
+	}
+
+	// 10 秒后补充 1 个令牌
+	*now = now.Add(10 * time.Second)
+	if err := limiter.Allow("alice"); err != nil {
+		t.Errorf("Request should be allowed after refill: %v", err)
+	}
+}
+
+func TestLimiter_GlobalLimitRefundsUserToken(t *testing.T) {
+	cfg := &config.AILimitConfig{UserRate: 60, UserBurst: 5, GlobalRate: 1, GlobalBurst: 1}
+	limiter, _ := newTestLimiter(cfg)
+
+	if err := limiter.Allow("alice"); err != nil {
+		t.Fatalf("First request should be allowed: %v", err)
+	}
+	var rateErr *RateLimitError
+	if err := limiter.Allow("bob"); !errors.As(err, &rateErr) || rateErr.Scope != "global" {
+		t.Fatalf("Expected global rate limit error, got %v", err)
+	}
+	if tokens := limiter.Status().UserTokens["bob"]; tokens != 5 {
+		t.Errorf("Expected bob's token to be refunded, got %.1f", tokens)
+	}
+}
+
+func TestLimiter_PrunesIdleUsers(t *testing.T) {
+	cfg := &config.AILimitConfig{UserRate: 60, UserBurst: 2, GlobalRate: 6000, GlobalBurst: 1000}
+	limiter, now := newTestLimiter(cfg)
+
+	for i := 0; i < StatusMaxUsers+10; i++ {
+		if err := limiter.Allow(fmt.Sprintf("10.0.0.%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limiter.Allow("alice")
+	limiter.Allow("alice")
+	status := limiter.Status()
+	if status.TrackedUsers != StatusMaxUsers+11 || len(status.UserTokens) != StatusMaxUsers {
+		t.Fatalf("Expected the status to cap the user list, got %d tracked %d listed", status.TrackedUsers, len(status.UserTokens))
+	}
+	if tokens, ok := status.UserTokens["alice"]; !ok || tokens != 0 {
+		t.Errorf("Expected the most throttled user to be listed first, got %v %v", tokens, ok)
+	}
+
+	// 令牌补满的用户在下一次请求时被清理，仍在限流中的用户保留
+	*now = now.Add(limiterPruneInterval)
+	limiter.Allow("alice")
+	limiter.Allow("alice")
+	*now = now.Add(time.Second)
+	if err := limiter.Allow("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if status := limiter.Status(); status.TrackedUsers != 2 {
+		t.Errorf("Expected only alice and bob to be tracked, got %d", status.TrackedUsers)
+	}
+	var rateErr *RateLimitError
+	*now = now.Add(limiterPruneInterval)
+	limiter.Allow("alice")
+	limiter.Allow("alice")
+	if err := limiter.Allow("alice"); !errors.As(err, &rateErr) {
+		t.Errorf("Expected alice to stay rate limited after pruning, got %v", err)
+	}
+}
+
+func TestLimiter_QueuePriority(t *testing.T) {
+	cfg := &config.AILimitConfig{MaxConcurrent: 1, MaxQueue: 5}
+	limiter, _ := newTestLimiter(cfg)
+	ctx := context.Background()
+
+	release, err := limiter.Acquire(ctx, "alice", PriorityInteractive, nil)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	order := make(chan string, 2)
+	positions := make(chan int, 2)
+	start := func(user string, priority Priority) {
+		go func() {
+			rel, err := limiter.Acquire(ctx, user, priority, func(p int) { positions <- p })
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			order <- user
+			rel()
+		}()
+	}
+
+	start("bob", PriorityInteractive)
+	if p := <-positions; p != 1 {
+		t.Errorf("Expected bob at position 1, got %d", p)
+	}
+	start("patrol", PriorityPatrol)
+	if p := <-positions; p != 1 {
+		t.Errorf("Expected patrol to jump to position 1, got %d", p)
+	}
+
+	if status := limiter.Status(); status.Queued != 2 || status.QueuedPatrol != 1 || status.Active != 1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	release()
+	if first := <-order; first != "patrol" {
+		t.Errorf("Expected patrol to run first, got %s", first)
+	}
+	if second := <-order; second != "bob" {
+		t.Errorf("Expected bob to run second, got %s", second)
+	}
+}
+
+func TestLimiter_QueueFullAndCancel(t *testing.T) {
+	cfg := &config.AILimitConfig{MaxConcurrent: 1, MaxQueue: 1}
+	limiter, _ := newTestLimiter(cfg)
+
+	release, _ := limiter.Acquire(context.Background(), "alice", PriorityInteractive, nil)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := limiter.Acquire(ctx, "bob", PriorityInteractive, func(int) { close(queued) })
+		done <- err
+	}()
+	<-queued
+
+	if _, err := limiter.Acquire(context.Background(), "carol", PriorityInteractive, nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if status := limiter.Status(); status.Queued != 0 {
+		t.Errorf("Cancelled waiter should be removed, queued=%d", status.Queued)
+	}
+}
+
+func TestLimiter_HotReloadConcurrency(t *testing.T) {
+	cfg := &config.AILimitConfig{MaxConcurrent: 1}
+	limiter, _ := newTestLimiter(cfg)
+
+	release, _ := limiter.Acquire(context.Background(), "alice", PriorityInteractive, nil)
+	defer release()
+
+	acquired := make(chan struct{})
+	go func() {
+		rel, err := limiter.Acquire(context.Background(), "bob", PriorityInteractive, nil)
+		if err == nil {
+			close(acquired)
+			rel()
+		}
+	}()
+
+	// 等待 bob 入队后调大并发上限，新的请求触发重新分配
+	for limiter.Status().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cfg.MaxConcurrent = 3
+	rel, err := limiter.Acquire(context.Background(), "carol", PriorityInteractive, nil)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	rel()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Queued request should be dispatched after limit increase")
+	}
+}
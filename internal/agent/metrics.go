@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"qwq/internal/monitor"
+	"time"
+)
+
+// 查询窗口
+const (
+	defaultMetricsRange = 24 * time.Hour
+	maxMetricsRange     = 7 * 24 * time.Hour
+)
+
+// queryMetricsArgs query_metrics 工具参数
+type queryMetricsArgs struct {
+	Metric      string `json:"metric"`
+	Range       string `json:"range"`
+	Aggregation string `json:"aggregation"`
+	Buckets     int    `json:"buckets"`
+}
+
+// queryMetrics 执行 query_metrics 工具调用，返回 JSON 结果或错误说明
+func queryMetrics(arguments string) string {
+	var args queryMetricsArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return fmt.Sprintf("Error: invalid arguments: %v", err)
+	}
+
+	window := defaultMetricsRange
+	if args.Range != "" {
+		parsed, err := time.ParseDuration(args.Range)
+		if err != nil || parsed <= 0 {
+			return fmt.Sprintf("Error: invalid range %q, use a duration such as 1h or 24h", args.Range)
+		}
+		window = parsed
+	}
+	if window > maxMetricsRange {
+		window = maxMetricsRange
+	}
+
+	now := time.Now()
+	series, err := monitor.DefaultHistory.Query(args.Metric, now.Add(-window), now, args.Buckets, monitor.Aggregation(args.Aggregation))
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	if len(series.Points) == 0 {
+		return fmt.Sprintf("No data recorded for %s in the last %s.", args.Metric, window)
+	}
+
+	data, err := json.Marshal(series)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"sync/atomic"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ModelClient 某个模型配置的 AI 客户端，请求时按配置填写模型名称、采样温度和最大 token 数；
+// 连接失败（网络错误或网关不可用）时在备用配置上重试一次，并记录实际回答的模型
+type ModelClient struct {
+	*openai.Client
+	Profile  config.ModelProfile // 补全默认值后的配置：BaseURL、Model 不为空
+	fallback *ModelClient
+}
+
+// modelClients 一份配置对应的全部客户端，配置热加载时整体替换
+type modelClients struct {
+	routes map[string]*ModelClient // 用途 -> 客户端，未启用的用途不在其中
+}
+
+// clients 当前的 AI 客户端，InitClient 可能在配置热加载时被并发调用，读取方通过 ClientFor 获取
+var clients atomic.Pointer[modelClients]
+
+// InitClient 按 models 配置初始化各用途的 AI 客户端
+// 模型配置既没有 API Key 也没有自定义（本地）端点时不创建客户端，使用它的用途进入禁用状态，其余功能照常可用
+func InitClient() {
+	current := config.Current()
+	built := map[string]*ModelClient{}
+	build := func(name string) *ModelClient {
+		if c, ok := built[name]; ok {
+			return c
+		}
+		profile, ok := current.Models.Profile(name)
+		if !ok && name != config.DefaultModelProfile {
+			logger.Info("⚠️ 模型配置 %q 不存在，相关 AI 功能禁用", name)
+		}
+		var c *ModelClient
+		if ok || name == config.DefaultModelProfile {
+			profile.Name = name
+			c = newModelClient(profile, current)
+		}
+		built[name] = c
+		return c
+	}
+
+	set := &modelClients{routes: map[string]*ModelClient{}}
+	for _, useCase := range []string{config.UseChat, config.UsePatrolAnalysis, config.UseOptimizer} {
+		if c := build(current.Models.Route(useCase)); c != nil {
+			set.routes[useCase] = c
+		}
+	}
+	if name := current.Models.Fallback; name != "" {
+		if fallback := build(name); fallback != nil {
+			for _, c := range set.routes {
+				if c != fallback {
+					c.fallback = fallback
+				}
+			}
+		}
+	}
+	clients.Store(set)
+}
+
+// newModelClient 创建模型配置的客户端，未设置的字段使用顶层 api_key、base_url、model；未启用时返回 nil
+// 设置了自己 base_url 的配置只使用 api_key_env 中的密钥，顶层 api_key 不会发送到其他接口；api_key_env 指定的环境变量为空时不启用
+func newModelClient(profile config.ModelProfile, current *config.Config) *ModelClient {
+	var apiKey string
+	switch {
+	case profile.APIKeyEnv != "":
+		if apiKey = os.Getenv(profile.APIKeyEnv); apiKey == "" {
+			logger.Info("⚠️ 模型配置 %q 的环境变量 %s 为空，相关 AI 功能禁用", profile.Name, profile.APIKeyEnv)
+			return nil
+		}
+	case profile.BaseURL == "":
+		apiKey = current.ApiKey
+	}
+	if profile.BaseURL == "" {
+		profile.BaseURL = current.BaseURL
+	}
+	if apiKey == "" && profile.BaseURL == "" {
+		return nil
+	}
+	if profile.BaseURL == "" {
+		profile.BaseURL = DefaultBaseURL
+	}
+	if profile.Model == "" {
+		profile.Model = getModelName()
+	}
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.BaseURL = profile.BaseURL
+	return &ModelClient{Client: openai.NewClientWithConfig(cfg), Profile: profile}
+}
+
+// ClientFor 返回用途（config.UseChat 等）使用的 AI 客户端，未启用时为 nil
+func ClientFor(useCase string) *ModelClient {
+	set := clients.Load()
+	if set == nil {
+		return nil
+	}
+	return set.routes[useCase]
+}
+
+// Enabled AI 对话是否可用
+func Enabled() bool {
+	return ClientFor(config.UseChat) != nil
+}
+
+// modelFor 用途实际使用的模型名称，未启用时为顶层配置的模型
+func modelFor(useCase string) string {
+	if c := ClientFor(useCase); c != nil {
+		return c.Profile.Model
+	}
+	return getModelName()
+}
+
+// apply 按模型配置填写请求的模型名称、采样温度和最大 token 数
+func (c *ModelClient) apply(req openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	req.Model = c.Profile.Model
+	if c.Profile.Temperature != nil {
+		req.Temperature = *c.Profile.Temperature
+	}
+	if c.Profile.MaxTokens > 0 {
+		req.MaxTokens = c.Profile.MaxTokens
+	}
+	return req
+}
+
+// CreateChatCompletion 请求一次对话补全，连接失败时在备用模型上重试一次
+func (c *ModelClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := c.Client.CreateChatCompletion(ctx, c.apply(req))
+	if err == nil || c.fallback == nil || ctx.Err() != nil || !connectionFailed(err) {
+		return resp, err
+	}
+	fallback := c.fallback
+	logger.Info("⚠️ 模型 %s（%s）连接失败，改用备用模型 %s: %v", c.Profile.Model, c.Profile.Name, fallback.Profile.Model, err)
+	resp, fallbackErr := fallback.Client.CreateChatCompletion(ctx, fallback.apply(req))
+	if fallbackErr != nil {
+		return resp, fmt.Errorf("%w (fallback %s: %v)", err, fallback.Profile.Name, fallbackErr)
+	}
+	logger.Info("🤖 本次回答由备用模型 %s（%s）给出", fallback.Profile.Model, fallback.Profile.Name)
+	return resp, nil
+}
+
+// CreateChatCompletionStream 以流式响应请求模型；流式请求失败后由 requestCompletion 改用 CreateChatCompletion，备用模型在那里生效
+func (c *ModelClient) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error) {
+	return c.Client.CreateChatCompletionStream(ctx, c.apply(req))
+}
+
+// connectionFailed 错误是否表示接口不可达：网络错误或网关返回 502/503/504，模型返回的业务错误不重试
+func connectionFailed(err error) bool {
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	status := 0
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	}
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
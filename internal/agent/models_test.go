@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// modelTestServer 模拟接口，记录收到的请求并回答模型名称
+func modelTestServer(t *testing.T, status int, requests *[]openai.ChatCompletionRequest) *httptest.Server {
+	t.Helper()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*requests = append(*requests, req)
+		if status != http.StatusOK {
+			http.Error(w, `{"error":{"message":"unavailable"}}`, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"model":%q,"choices":[{"message":{"role":"assistant","content":"answered by %s"}}]}`, req.Model, req.Model)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func useModels(t *testing.T, update func(cfg *config.Config)) {
+	t.Helper()
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		InitClient()
+	})
+	config.Update(update)
+	InitClient()
+}
+
+func TestClientFor_RoutesUseCasesToProfiles(t *testing.T) {
+	temperature := float32(0.7)
+	useModels(t, func(cfg *config.Config) {
+		cfg.ApiKey, cfg.BaseURL, cfg.Model = "main-key", "https://api.example.com/v1", "main-model"
+		cfg.Models = config.ModelsConfig{
+			Profiles: []config.ModelProfile{
+				{Name: "local", BaseURL: "http://127.0.0.1:11434/v1", Model: "qwen2.5:7b", Temperature: &temperature, MaxTokens: 512},
+				{Name: "offline", APIKeyEnv: "QWQ_TEST_MISSING_KEY"},
+			},
+			Routes: map[string]string{config.UsePatrolAnalysis: "local", config.UseOptimizer: "offline"},
+		}
+	})
+
+	chat := ClientFor(config.UseChat)
+	if chat == nil || chat.Profile.Name != config.DefaultModelProfile || chat.Profile.Model != "main-model" || chat.Profile.BaseURL != "https://api.example.com/v1" {
+		t.Fatalf("Expected chat to use the top-level settings, got %+v", chat)
+	}
+	patrol := ClientFor(config.UsePatrolAnalysis)
+	if patrol == nil || patrol.Profile.Model != "qwen2.5:7b" || patrol.Profile.BaseURL != "http://127.0.0.1:11434/v1" {
+		t.Fatalf("Expected patrol analysis to use the local profile, got %+v", patrol)
+	}
+	req := patrol.apply(openai.ChatCompletionRequest{Temperature: 0})
+	if req.Model != "qwen2.5:7b" || req.Temperature != 0.7 || req.MaxTokens != 512 {
+		t.Errorf("Expected the profile's model and parameters, got %+v", req)
+	}
+	if modelFor(config.UsePatrolAnalysis) != "qwen2.5:7b" {
+		t.Errorf("Expected the analysis cache to be keyed by the routed model, got %s", modelFor(config.UsePatrolAnalysis))
+	}
+	// api_key_env 指定的环境变量为空时禁用
+	if c := ClientFor(config.UseOptimizer); c != nil {
+		t.Errorf("Expected the optimizer to be disabled without its API key, got %+v", c)
+	}
+	if !Enabled() {
+		t.Error("Expected chat to stay enabled")
+	}
+}
+
+func TestModelClient_FallsBackOnConnectionFailure(t *testing.T) {
+	var primaryRequests, backupRequests []openai.ChatCompletionRequest
+	primary := modelTestServer(t, http.StatusOK, &primaryRequests)
+	backup := modelTestServer(t, http.StatusOK, &backupRequests)
+	useModels(t, func(cfg *config.Config) {
+		cfg.ApiKey, cfg.BaseURL, cfg.Model = "test", primary.URL, "primary-model"
+		cfg.Models = config.ModelsConfig{
+			Profiles: []config.ModelProfile{{Name: "backup", BaseURL: backup.URL, Model: "backup-model"}},
+			Fallback: "backup",
+		}
+	})
+	primary.Close()
+
+	client := ClientFor(config.UseChat)
+	msg, err := requestCompletion(context.Background(), client, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "磁盘满了吗"}},
+	}, nil)
+	if err != nil || msg.Content != "answered by backup-model" {
+		t.Fatalf("Expected the backup model to answer, got %+v %v", msg, err)
+	}
+	if len(backupRequests) != 1 || backupRequests[0].Model != "backup-model" {
+		t.Errorf("Expected one request for the backup model, got %+v", backupRequests)
+	}
+
+	// 备用配置本身没有备用，不会再次重试
+	if ClientFor(config.UseChat).fallback.fallback != nil {
+		t.Error("The fallback profile must not fall back again")
+	}
+}
+
+func TestModelClient_FallsBackOnlyWhenUnreachable(t *testing.T) {
+	var primaryRequests, backupRequests []openai.ChatCompletionRequest
+	primary := modelTestServer(t, http.StatusBadRequest, &primaryRequests)
+	backup := modelTestServer(t, http.StatusOK, &backupRequests)
+	useModels(t, func(cfg *config.Config) {
+		cfg.ApiKey, cfg.BaseURL = "test", primary.URL
+		cfg.Models = config.ModelsConfig{
+			Profiles: []config.ModelProfile{{Name: "backup", BaseURL: backup.URL}},
+			Fallback: "backup",
+		}
+	})
+
+	_, err := ClientFor(config.UseChat).CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	})
+	if err == nil || len(primaryRequests) != 1 || len(backupRequests) != 0 {
+		t.Errorf("Expected the API error without a fallback request, got %v (%d backup requests)", err, len(backupRequests))
+	}
+
+	var served atomic.Int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer gateway.Close()
+	config.Update(func(cfg *config.Config) { cfg.BaseURL = gateway.URL })
+	InitClient()
+	if _, err := ClientFor(config.UseChat).CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{}); err != nil || served.Load() != 1 {
+		t.Errorf("Expected a 502 from the primary to be answered by the backup, got %v", err)
+	}
+}
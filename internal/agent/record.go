@@ -0,0 +1,289 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/security"
+	"qwq/internal/utils"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatCompleter 对话补全接口，*openai.Client 实现该接口；回放测试用录制的响应代替真实接口
+type ChatCompleter interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// Fixture 录制的一次 Agent 对话，每次 ProcessAgentStep 对应一个步骤
+type Fixture struct {
+	Name       string        `json:"name"`
+	RecordedAt time.Time     `json:"recorded_at"`
+	Model      string        `json:"model"`
+	Steps      []FixtureStep `json:"steps"`
+}
+
+// FixtureStep 一个 Agent 步骤：发送给模型的消息、模型响应、命令审批与执行结果，以及该步的输出
+type FixtureStep struct {
+	Request  []openai.ChatCompletionMessage `json:"request"`
+	Response openai.ChatCompletionMessage   `json:"response"`
+	Commands []FixtureCommand               `json:"commands,omitempty"`
+	Appended []openai.ChatCompletionMessage `json:"appended"` // 该步追加到对话中的消息（模型响应和工具输出）
+	Result   openai.ChatCompletionMessage   `json:"result"`   // 返回给调用方的消息
+	Continue bool                           `json:"continue"`
+}
+
+// FixtureCommand 步骤中经过自动执行策略审批的命令，执行过的命令附带输出
+type FixtureCommand struct {
+	Command  string `json:"command"`
+	Action   string `json:"action"`
+	Rule     string `json:"rule"`
+	Executed bool   `json:"executed"`
+	// Approved 需要确认的命令用户的审批结果，没有向用户请求确认时为空
+	Approved   *bool  `json:"approved,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// Result 还原录制的命令执行结果
+func (c FixtureCommand) Result() *utils.ShellResult {
+	return &utils.ShellResult{
+		Command:  c.Command,
+		Stdout:   c.Stdout,
+		Stderr:   c.Stderr,
+		ExitCode: c.ExitCode,
+		Duration: time.Duration(c.DurationMS) * time.Millisecond,
+	}
+}
+
+// LoadFixture 读取录制文件
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &fixture, nil
+}
+
+// runShellContext 执行命令，回放测试替换为返回录制结果
+var runShellContext = utils.RunShellContext
+
+// stepTrace 记录一个 Agent 步骤中的命令审批和执行结果，通过 context 传递
+type stepTrace struct {
+	commands []FixtureCommand
+}
+
+type stepTraceKey struct{}
+
+func withStepTrace(ctx context.Context, trace *stepTrace) context.Context {
+	return context.WithValue(ctx, stepTraceKey{}, trace)
+}
+
+func stepTraceFrom(ctx context.Context) *stepTrace {
+	trace, _ := ctx.Value(stepTraceKey{}).(*stepTrace)
+	return trace
+}
+
+func (t *stepTrace) decided(cmd string, decision security.Decision) {
+	if t != nil {
+		t.commands = append(t.commands, FixtureCommand{Command: cmd, Action: string(decision.Action), Rule: decision.Rule})
+	}
+}
+
+func (t *stepTrace) approved(approved bool) {
+	if t != nil && len(t.commands) > 0 {
+		t.commands[len(t.commands)-1].Approved = &approved
+	}
+}
+
+func (t *stepTrace) executed(res *utils.ShellResult) {
+	if t == nil || len(t.commands) == 0 {
+		return
+	}
+	last := &t.commands[len(t.commands)-1]
+	last.Executed = true
+	last.Stdout, last.Stderr, last.ExitCode = res.Stdout, res.Stderr, res.ExitCode
+	last.DurationMS = res.Duration.Milliseconds()
+}
+
+// CommandObserver 命令执行结束后的回调，Web 对话据此把命令写入操作审计
+type CommandObserver func(res *utils.ShellResult)
+
+type commandObserverKey struct{}
+
+// WithCommandObserver 在上下文中记录命令执行的回调，Agent 每执行一条命令调用一次
+func WithCommandObserver(ctx context.Context, observe CommandObserver) context.Context {
+	return context.WithValue(ctx, commandObserverKey{}, observe)
+}
+
+// ShellRunner 执行已审批命令的函数，对话切换到远程主机时由调用方注入
+type ShellRunner func(ctx context.Context, cmd string) *utils.ShellResult
+
+type shellRunnerKey struct{}
+
+// WithShellRunner 在上下文中指定执行命令的函数，未指定时在本机执行
+func WithShellRunner(ctx context.Context, run ShellRunner) context.Context {
+	return context.WithValue(ctx, shellRunnerKey{}, run)
+}
+
+// CommandApproval 自动执行策略要求确认、等待用户审批的命令
+type CommandApproval struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason"` // 模型给出的执行意图
+	Policy  string `json:"policy"` // 命中的自动执行策略规则及说明，如 "规则 mutating"
+}
+
+// Approver 向用户请求确认命令，返回是否批准；ctx 取消时应返回 false
+type Approver func(ctx context.Context, req CommandApproval) bool
+
+type approverKey struct{}
+
+// WithApprover 在上下文中指定确认命令的函数，Web 对话通过 WebSocket 向用户请求确认；
+// 未指定时需要确认的命令一律跳过，视为用户拒绝
+func WithApprover(ctx context.Context, approve Approver) context.Context {
+	return context.WithValue(ctx, approverKey{}, approve)
+}
+
+// executeCommand 执行已审批的命令并写入审计日志和步骤记录
+func executeCommand(ctx context.Context, cmd string) *utils.ShellResult {
+	run := runShellContext
+	if runner, ok := ctx.Value(shellRunnerKey{}).(ShellRunner); ok && runner != nil {
+		run = runner
+	}
+	res := run(ctx, cmd)
+	auditShellResult(res)
+	stepTraceFrom(ctx).executed(res)
+	if observe, ok := ctx.Value(commandObserverKey{}).(CommandObserver); ok && observe != nil {
+		observe(res)
+	}
+	return res
+}
+
+// maxRecordedSessions 同时录制的对话数量上限，超出时丢弃最早的对话
+const maxRecordedSessions = 100
+
+// recorder 把 Agent 步骤追加写入 agent_record_dir 下的录制文件，所有文本先经过 security.Redact 脱敏
+type recorder struct {
+	mu       sync.Mutex
+	seq      int
+	sessions map[*[]openai.ChatCompletionMessage]*recordedSession
+	order    []*[]openai.ChatCompletionMessage
+}
+
+type recordedSession struct {
+	path    string
+	length  int // 上一步结束时的对话长度，对话变短说明调用方开始了新对话
+	fixture Fixture
+}
+
+var defaultRecorder = &recorder{sessions: make(map[*[]openai.ChatCompletionMessage]*recordedSession)}
+
+// record 记录一个步骤：msgs 为步骤结束后的对话，request 为发送给模型的消息
+func (r *recorder) record(dir string, msgs *[]openai.ChatCompletionMessage, request []openai.ChatCompletionMessage, trace *stepTrace, result openai.ChatCompletionMessage, cont bool) {
+	// 接口调用失败时没有响应，不记录
+	if len(*msgs) <= len(request) {
+		return
+	}
+	step := FixtureStep{
+		Request:  redactMessages(request),
+		Response: redactMessage((*msgs)[len(request)]),
+		Commands: redactCommands(trace.commands),
+		Appended: redactMessages((*msgs)[len(request):]),
+		Result:   redactMessage(result),
+		Continue: cont,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session := r.sessions[msgs]
+	if session == nil || len(request) < session.length {
+		session = r.open(dir, msgs)
+	}
+	session.fixture.Steps = append(session.fixture.Steps, step)
+	session.length = len(*msgs)
+
+	data, err := json.MarshalIndent(session.fixture, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(session.path, data)
+	}
+	if err != nil {
+		logger.Info("⚠️ 写入 Agent 录制文件失败: %v", err)
+	}
+}
+
+func (r *recorder) open(dir string, msgs *[]openai.ChatCompletionMessage) *recordedSession {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logger.Info("⚠️ 创建 Agent 录制目录失败: %v", err)
+	}
+	now := time.Now()
+	r.seq++
+	name := fmt.Sprintf("session-%s-%03d", now.Format("20060102-150405"), r.seq)
+	session := &recordedSession{
+		path:    filepath.Join(dir, name+".json"),
+		fixture: Fixture{Name: name, RecordedAt: now.UTC().Truncate(time.Second), Model: modelFor(config.UseChat)},
+	}
+	if _, ok := r.sessions[msgs]; !ok {
+		r.order = append(r.order, msgs)
+	}
+	r.sessions[msgs] = session
+	if len(r.order) > maxRecordedSessions {
+		delete(r.sessions, r.order[0])
+		r.order = r.order[1:]
+	}
+	return session
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func redactMessages(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, len(msgs))
+	for i, msg := range msgs {
+		out[i] = redactMessage(msg)
+	}
+	return out
+}
+
+func redactMessage(msg openai.ChatCompletionMessage) openai.ChatCompletionMessage {
+	msg.Content = security.Redact(msg.Content)
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]openai.ToolCall, len(msg.ToolCalls))
+		for i, call := range msg.ToolCalls {
+			call.Function.Arguments = security.Redact(call.Function.Arguments)
+			calls[i] = call
+		}
+		msg.ToolCalls = calls
+	}
+	return msg
+}
+
+func redactCommands(commands []FixtureCommand) []FixtureCommand {
+	out := make([]FixtureCommand, len(commands))
+	for i, c := range commands {
+		c.Command, c.Stdout, c.Stderr = security.Redact(c.Command), security.Redact(c.Stdout), security.Redact(c.Stderr)
+		out[i] = c
+	}
+	return out
+}
+
+// recordDir 录制目录，未配置时不录制
+func recordDir() string {
+	return config.Current().AgentRecordDir
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/security"
+	"qwq/internal/utils"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// replayCompleter 按顺序返回录制的模型响应，并检查发送的消息与录制时一致
+type replayCompleter struct {
+	t     *testing.T
+	steps []FixtureStep
+	index int
+}
+
+func (c *replayCompleter) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if c.index >= len(c.steps) {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("unexpected request #%d", c.index+1)
+	}
+	step := c.steps[c.index]
+	if diff := diffMessages(step.Request, req.Messages); diff != "" {
+		c.t.Errorf("step %d: request diverged from the recording: %s", c.index+1, diff)
+	}
+	c.index++
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: step.Response}}}, nil
+}
+
+// TestReplayCorpus 回放 testdata/replay 下录制的对话：用录制的模型响应和命令输出重新执行 Agent 步骤，
+// 检查工具调用、自动执行策略的审批结果和最终消息与录制时一致。不访问网络，也不执行真实命令
+func TestReplayCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "replay", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No replay fixtures found: %v", err)
+	}
+	for _, file := range files {
+		fixture, err := LoadFixture(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(fixture.Name, func(t *testing.T) {
+			replayFixture(t, fixture)
+		})
+	}
+}
+
+func replayFixture(t *testing.T, fixture *Fixture) {
+	// 回放使用内置默认策略，录制文件中的审批结果也应基于内置默认策略
+	savedPolicy, savedShell := security.CurrentAutoExecPolicy(), runShellContext
+	t.Cleanup(func() {
+		security.SetAutoExecPolicy(savedPolicy)
+		runShellContext = savedShell
+	})
+	policy, err := security.NewAutoExecPolicy(config.AutoExecConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetAutoExecPolicy(policy)
+
+	recorded := make(map[string]FixtureCommand)
+	approvals := make(map[string]bool)
+	for _, step := range fixture.Steps {
+		for _, c := range step.Commands {
+			if c.Executed {
+				recorded[c.Command] = c
+			}
+			if c.Approved != nil {
+				approvals[c.Command] = *c.Approved
+			}
+		}
+	}
+	runShellContext = func(ctx context.Context, cmd string) *utils.ShellResult {
+		c, ok := recorded[cmd]
+		if !ok {
+			t.Errorf("Command %q was executed but not recorded", cmd)
+			return &utils.ShellResult{Command: cmd, ExitCode: 127, Stderr: "not recorded", Err: "not recorded"}
+		}
+		return c.Result()
+	}
+
+	completer := &replayCompleter{t: t, steps: fixture.Steps}
+	var msgs []openai.ChatCompletionMessage
+	for i, step := range fixture.Steps {
+		// 步骤之间调用方追加的消息（用户的下一轮输入）取自录制的请求
+		if diff := diffMessages(step.Request[:min(len(msgs), len(step.Request))], msgs); diff != "" || len(msgs) > len(step.Request) {
+			t.Fatalf("step %d: conversation diverged before the request: %s", i+1, diff)
+		}
+		msgs = append(msgs, step.Request[len(msgs):]...)
+
+		before := len(msgs)
+		trace := &stepTrace{}
+		ctx := withStepTrace(context.Background(), trace)
+		// 录制时用户确认过命令的会话按录制的审批结果回放
+		if len(approvals) > 0 {
+			ctx = WithApprover(ctx, func(_ context.Context, req CommandApproval) bool {
+				approved, ok := approvals[req.Command]
+				if !ok {
+					t.Errorf("Approval for %q was requested but not recorded", req.Command)
+				}
+				return approved
+			})
+		}
+		msg, cont := agentStep(ctx, completer, &msgs, nil, func(string) {}, func(string) {}, false)
+
+		if diff := diffCommands(step.Commands, trace.commands); diff != "" {
+			t.Errorf("step %d: commands differ: %s", i+1, diff)
+		}
+		if diff := diffMessages(step.Appended, msgs[before:]); diff != "" {
+			t.Errorf("step %d: appended messages differ: %s", i+1, diff)
+		}
+		if diff := diffMessages([]openai.ChatCompletionMessage{step.Result}, []openai.ChatCompletionMessage{msg}); diff != "" || cont != step.Continue {
+			t.Errorf("step %d: result differs (continue %v, want %v): %s", i+1, cont, step.Continue, diff)
+		}
+	}
+	if completer.index != len(fixture.Steps) {
+		t.Errorf("Expected %d model requests, got %d", len(fixture.Steps), completer.index)
+	}
+}
+
+// diffMessages 比较角色、内容和工具调用，返回第一处差异
+func diffMessages(want, got []openai.ChatCompletionMessage) string {
+	if len(want) != len(got) {
+		return fmt.Sprintf("expected %d messages, got %d", len(want), len(got))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.Role != g.Role || w.Content != g.Content || w.ToolCallID != g.ToolCallID {
+			return fmt.Sprintf("message %d: expected %s %q (tool_call_id %q), got %s %q (tool_call_id %q)",
+				i, w.Role, w.Content, w.ToolCallID, g.Role, g.Content, g.ToolCallID)
+		}
+		if len(w.ToolCalls) != len(g.ToolCalls) {
+			return fmt.Sprintf("message %d: expected %d tool calls, got %d", i, len(w.ToolCalls), len(g.ToolCalls))
+		}
+		for j := range w.ToolCalls {
+			wc, gc := w.ToolCalls[j], g.ToolCalls[j]
+			if wc.ID != gc.ID || wc.Function.Name != gc.Function.Name || wc.Function.Arguments != gc.Function.Arguments {
+				return fmt.Sprintf("message %d tool call %d: expected %s %s, got %s %s", i, j, wc.Function.Name, wc.Function.Arguments, gc.Function.Name, gc.Function.Arguments)
+			}
+		}
+	}
+	return ""
+}
+
+func diffCommands(want, got []FixtureCommand) string {
+	if len(want) != len(got) {
+		return fmt.Sprintf("expected %d commands %+v, got %d %+v", len(want), want, len(got), got)
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.Command != g.Command || w.Action != g.Action || w.Rule != g.Rule || w.Executed != g.Executed {
+			return fmt.Sprintf("command %d: expected %q %s (rule %s, executed %v), got %q %s (rule %s, executed %v)",
+				i, w.Command, w.Action, w.Rule, w.Executed, g.Command, g.Action, g.Rule, g.Executed)
+		}
+		if (w.Approved == nil) != (g.Approved == nil) || (w.Approved != nil && *w.Approved != *g.Approved) {
+			return fmt.Sprintf("command %d: expected approval %v, got %v", i, approval(w.Approved), approval(g.Approved))
+		}
+	}
+	return ""
+}
+
+// approval 审批结果的可读形式，没有请求确认时为 "none"
+func approval(approved *bool) string {
+	if approved == nil {
+		return "none"
+	}
+	return fmt.Sprint(*approved)
+}
+
+func TestRecorder_WritesRedactedSessions(t *testing.T) {
+	dir := t.TempDir()
+	r := &recorder{sessions: make(map[*[]openai.ChatCompletionMessage]*recordedSession)}
+	request := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "ping 10.0.0.8"}}
+	msgs := append(append([]openai.ChatCompletionMessage(nil), request...), openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "10.0.0.8 可达"})
+	trace := &stepTrace{}
+	trace.decided("ping -c1 10.0.0.8", security.Decision{Action: security.ActionAuto, Rule: "read-only"})
+	trace.executed(&utils.ShellResult{Stdout: "64 bytes from 10.0.0.8"})
+
+	r.record(dir, &msgs, request, trace, msgs[1], true)
+	// 同一对话的下一步追加到同一文件
+	request2 := append(append([]openai.ChatCompletionMessage(nil), msgs...), openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "谢谢"})
+	msgs = append(request2, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "不客气"})
+	r.record(dir, &msgs, request2, &stepTrace{}, msgs[len(msgs)-1], true)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one session file, got %v", files)
+	}
+	fixture, err := LoadFixture(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixture.Steps) != 2 || len(fixture.Steps[1].Request) != 3 {
+		t.Fatalf("Expected two steps, got %+v", fixture.Steps)
+	}
+	step := fixture.Steps[0]
+	if step.Request[0].Content != "ping <IP_REDACTED>" || step.Response.Content != "<IP_REDACTED> 可达" ||
+		step.Commands[0].Command != "ping -c1 <IP_REDACTED>" || step.Commands[0].Stdout != "64 bytes from <IP_REDACTED>" {
+		t.Errorf("Expected redacted fixture, got %+v", step)
+	}
+}
+
+func TestExecuteCommand_UsesContextShellRunner(t *testing.T) {
+	var ran []string
+	ctx := WithShellRunner(context.Background(), func(ctx context.Context, cmd string) *utils.ShellResult {
+		ran = append(ran, cmd)
+		return &utils.ShellResult{Command: cmd, Stdout: "web-1\n"}
+	})
+	var observed *utils.ShellResult
+	ctx = WithCommandObserver(ctx, func(res *utils.ShellResult) { observed = res })
+
+	res := executeCommand(ctx, "hostname")
+	if len(ran) != 1 || res.Stdout != "web-1\n" || observed != res {
+		t.Fatalf("Expected the command to run through the context runner, ran %v got %+v", ran, res)
+	}
+}
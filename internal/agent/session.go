@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"qwq/internal/config"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultMaxSessions 默认保留的命令行对话会话数量，超出时删除最久未更新的会话
+const DefaultMaxSessions = 20
+
+// CLIInputContext 命令行对话附加在用户输入后的环境说明，会话标题中去掉
+const CLIInputContext = " (Context: Current Linux Server)"
+
+// HostInputContext 附加在用户输入后的环境说明，/host 切换到远程主机后说明命令在该主机上通过 SSH 执行
+func HostInputContext(host string) string {
+	if host == "" {
+		return CLIInputContext
+	}
+	return fmt.Sprintf(" (Context: Remote Linux Server %s, commands run there over SSH)", host)
+}
+
+// trimInputContext 去掉用户输入后附加的环境说明
+func trimInputContext(content string) string {
+	if i := strings.LastIndex(content, " (Context: "); i >= 0 && strings.HasSuffix(content, ")") {
+		return content[:i]
+	}
+	return content
+}
+
+// maxSessionTitle 会话标题（第一条用户消息）的最大字符数
+const maxSessionTitle = 40
+
+var (
+	// ErrSessionNotFound 会话不存在
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrInvalidSessionID 会话 ID 格式无效
+	ErrInvalidSessionID = errors.New("invalid session id")
+)
+
+// sessionIDPattern 会话 ID 只允许字母、数字和连字符，防止读写会话目录之外的文件
+var sessionIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// Session 一个命令行对话会话，Messages 不含系统提示词和示例对话，恢复时接在 GetBaseMessages 之后
+type Session struct {
+	ID        string                         `json:"id"`
+	CreatedAt time.Time                      `json:"created_at"`
+	UpdatedAt time.Time                      `json:"updated_at"`
+	Model     string                         `json:"model,omitempty"`
+	Messages  []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// SessionInfo 会话列表中的摘要
+type SessionInfo struct {
+	ID        string
+	UpdatedAt time.Time
+	Messages  int
+	Title     string
+}
+
+// SessionStore 命令行对话的会话存储：每个会话一个 JSON 文件，写入前经 security.Redact 脱敏
+type SessionStore struct {
+	Dir string
+	Max int // 保留的会话数量，0 表示 DefaultMaxSessions
+}
+
+// DefaultSessionDir 默认的会话目录 ~/.qwq/sessions
+func DefaultSessionDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".qwq", "sessions")
+	}
+	return filepath.Join(home, ".qwq", "sessions")
+}
+
+// NewSessionStore 创建会话存储
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{Dir: dir, Max: DefaultMaxSessions}
+}
+
+// Save 保存对话，id 为空时以当前时间创建新会话；返回会话 ID。没有消息时不保存，返回原 ID
+func (s *SessionStore) Save(id string, msgs []openai.ChatCompletionMessage) (string, error) {
+	if len(msgs) == 0 {
+		return id, nil
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return id, err
+	}
+	now := time.Now()
+	session := &Session{ID: id, CreatedAt: now, Model: modelFor(config.UseChat)}
+	if id == "" {
+		session.ID = s.newID(now)
+	} else if existing, err := s.Load(id); err == nil {
+		session.CreatedAt = existing.CreatedAt
+	} else if !errors.Is(err, ErrSessionNotFound) {
+		return id, err
+	}
+	session.UpdatedAt = now
+	session.Messages = redactMessages(msgs)
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return id, err
+	}
+	if err := writeFileAtomic(s.path(session.ID), data); err != nil {
+		return id, err
+	}
+	return session.ID, s.prune()
+}
+
+// Load 读取会话；对话末尾的工具调用缺少结果时（如执行中退出）丢弃这次调用，保证恢复后模型可以继续对话
+func (s *SessionStore) Load(id string) (*Session, error) {
+	if !sessionIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSessionID, id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("parse session %s: %w", id, err)
+	}
+	session.ID = id
+	session.Messages = completeToolCalls(session.Messages)
+	return &session, nil
+}
+
+// List 列出会话，最近更新的在前；无法解析的文件被跳过
+func (s *SessionStore) List() ([]SessionInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var infos []SessionInfo
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		session, err := s.Load(id)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, SessionInfo{ID: id, UpdatedAt: session.UpdatedAt, Messages: len(session.Messages), Title: sessionTitle(session.Messages)})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].UpdatedAt.After(infos[j].UpdatedAt) })
+	return infos, nil
+}
+
+// prune 只保留最近更新的 Max 个会话
+func (s *SessionStore) prune() error {
+	limit := s.Max
+	if limit <= 0 {
+		limit = DefaultMaxSessions
+	}
+	infos, err := s.List()
+	if err != nil || len(infos) <= limit {
+		return err
+	}
+	var errs []error
+	for _, info := range infos[limit:] {
+		if err := os.Remove(s.path(info.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newID 以时间（精确到毫秒）生成会话 ID，同一毫秒内的多个会话追加序号
+func (s *SessionStore) newID(now time.Time) string {
+	base := fmt.Sprintf("%s-%03d", now.Format("20060102-150405"), now.Nanosecond()/int(time.Millisecond))
+	id := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(s.path(id)); errors.Is(err, os.ErrNotExist) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func (s *SessionStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+// completeToolCalls 截掉对话末尾缺少结果的工具调用：带工具调用的助手消息之后必须紧跟每个调用的结果
+func completeToolCalls(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	for i := 0; i < len(msgs); i++ {
+		if len(msgs[i].ToolCalls) == 0 {
+			continue
+		}
+		answered := map[string]bool{}
+		j := i + 1
+		for ; j < len(msgs) && msgs[j].Role == openai.ChatMessageRoleTool; j++ {
+			answered[msgs[j].ToolCallID] = true
+		}
+		for _, call := range msgs[i].ToolCalls {
+			if !answered[call.ID] {
+				return msgs[:i]
+			}
+		}
+		i = j - 1
+	}
+	return msgs
+}
+
+// sessionTitle 第一条用户消息，用作会话列表中的标题
+func sessionTitle(msgs []openai.ChatCompletionMessage) string {
+	for _, msg := range msgs {
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		title := strings.Join(strings.Fields(trimInputContext(msg.Content)), " ")
+		if utf8.RuneCountInString(title) > maxSessionTitle {
+			title = string([]rune(title)[:maxSessionTitle]) + "…"
+		}
+		return title
+	}
+	return ""
+}
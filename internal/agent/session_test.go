@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func sessionConversation() []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "nginx 为什么起不来" + CLIInputContext},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+			{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "execute_shell_command", Arguments: `{"command":"systemctl status nginx","reason":"check"}`}},
+			{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_system_metrics", Arguments: `{}`}},
+		}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "nginx.service: failed"},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_2", Content: "load 0.1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "端口 80 被占用"},
+	}
+}
+
+func TestSessionStore_RoundTripsToolCalls(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	msgs := sessionConversation()
+
+	id, err := store.Save("", msgs)
+	if err != nil || id == "" {
+		t.Fatalf("Save failed: %q %v", id, err)
+	}
+	session, err := store.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(session.Messages, msgs) {
+		t.Errorf("Messages did not round-trip:\n%+v\n%+v", session.Messages, msgs)
+	}
+
+	// 继续对话后写回同一个会话，创建时间不变
+	msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "怎么修"})
+	if again, err := store.Save(id, msgs); err != nil || again != id {
+		t.Fatalf("Expected to save into %s, got %s %v", id, again, err)
+	}
+	resumed, _ := store.Load(id)
+	if len(resumed.Messages) != len(msgs) || !resumed.CreatedAt.Equal(session.CreatedAt) {
+		t.Errorf("Expected the session to be updated in place, got %d messages created %v", len(resumed.Messages), resumed.CreatedAt)
+	}
+
+	infos, err := store.List()
+	if err != nil || len(infos) != 1 || infos[0].Title != "nginx 为什么起不来" || infos[0].Messages != len(msgs) {
+		t.Errorf("Unexpected session list %+v %v", infos, err)
+	}
+}
+
+func TestSessionStore_RedactsBeforeWriting(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	id, err := store.Save("", []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "连接 10.0.0.12 失败"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "execute_shell_command", Arguments: `{"command":"curl -H 'Authorization: sk-abcdefghijklmnopqrstuvwxyz123456' http://10.0.0.12"}`}}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "admin@example.com denied"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(store.Dir, id+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"10.0.0.12", "sk-abcdefghijklmnopqrstuvwxyz123456", "admin@example.com"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %s to be redacted on disk:\n%s", secret, data)
+		}
+	}
+}
+
+func TestSessionStore_DropsUnansweredToolCalls(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	full := sessionConversation()
+	// 执行第二个工具调用时退出
+	id, err := store.Save("", full[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := store.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(session.Messages, full[:1]) {
+		t.Errorf("Expected the incomplete tool call to be dropped, got %+v", session.Messages)
+	}
+}
+
+func TestSessionStore_KeepsMostRecentSessions(t *testing.T) {
+	store := &SessionStore{Dir: t.TempDir(), Max: 3}
+	msgs := sessionConversation()
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id, err := store.Save("", msgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		time.Sleep(time.Millisecond)
+	}
+	// 更新保留的会话中最早的一个后，它成为最近的会话
+	if _, err := store.Save(ids[2], msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, info := range infos {
+		kept = append(kept, info.ID)
+	}
+	if want := []string{ids[2], ids[4], ids[3]}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("Expected %v to be kept, got %v", want, kept)
+	}
+	if _, err := store.Load(ids[0]); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected the oldest session to be removed, got %v", err)
+	}
+	if _, err := store.Load("../../etc/passwd"); !errors.Is(err, ErrInvalidSessionID) {
+		t.Errorf("Expected ErrInvalidSessionID, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"fmt"
+	"qwq/internal/config"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultContextTokens 模型上下文窗口的默认估算 token 数
+	DefaultContextTokens = 32000
+	// responseReserveTokens 为模型回复预留的 token 数
+	responseReserveTokens = 2048
+	// minToolOutputTokens 工具输出的最低预算，上下文即将耗尽时仍保留最关键的几行
+	minToolOutputTokens = 300
+	// shapeTailLines 压缩时始终保留的末尾行数
+	shapeTailLines = 20
+	// shapeHeadLines 预算允许时保留的开头行数
+	shapeHeadLines = 5
+	// shapeMaxLineRunes 单行最大长度，超长的行截断
+	shapeMaxLineRunes = 400
+	// messageOverheadTokens 每条消息的角色、分隔等额外开销
+	messageOverheadTokens = 4
+)
+
+var (
+	// 比较相似行时忽略的部分：时间戳、十六进制地址、数字
+	shapeTimestamp   = regexp.MustCompile(`^(\w{3} [ \d]\d \d\d:\d\d:\d\d \S+ |\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:?\d\d)?\s*|\[\s*\d+\.\d+\]\s*)`)
+	shapeBracketTime = regexp.MustCompile(`\[\d\d/\w{3}/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}\]`)
+	shapeHex         = regexp.MustCompile(`0x[0-9a-fA-F]+|\b[0-9a-f]{8,}\b`)
+	shapeDigits      = regexp.MustCompile(`\d+`)
+
+	// shapeImportant 错误、警告等裁剪时优先保留的行
+	shapeImportant = regexp.MustCompile(`(?i)\b(error|err|fatal|fail(ed|ure|ing)?|panic|exception|caused by|critical|crit|emerg|alert|warn(ing)?|denied|refused|timeout|timed out|oom|out of memory|killed|segfault|traceback|unable|cannot|can't|not found)\b|\b[45]\d\d\b \d+ "|\bHTTP/\d(\.\d)?" [45]\d\d\b`)
+	// shapeException Java 异常和 Caused by 行，其后的前几个栈帧作为上下文一并保留
+	shapeException = regexp.MustCompile(`^(Exception in thread|Caused by:|\S+(Exception|Error)(: |$))`)
+	shapeFrame     = regexp.MustCompile(`^\s+(at |\.\.\. \d+ more)`)
+	// shapeMarker Format 输出的分段标记，始终保留
+	shapeMarker = regexp.MustCompile(`^\[(exit_code|duration|stdout|stderr)\]`)
+)
+
+// shapeFrameContext 异常行之后保留的栈帧数
+const shapeFrameContext = 3
+
+// shapedLine 压缩过程中的一行，repeats 为合并的相似行数（不含本行），last 为其中最后一行
+type shapedLine struct {
+	text      string
+	repeats   int
+	last      string
+	identical bool // 合并的行与本行完全相同
+	important bool
+	pinned    bool
+}
+
+// ShapeToolOutput 将命令输出压缩到 budget（估算 token）以内，再交给模型：
+// 先合并连续的相似行，仍超出预算时保留分段标记、末尾 shapeTailLines 行和错误、警告行（越靠后越优先），
+// 剩余空间依次留给开头几行，被省略的位置和数量在结果中注明。未超出预算的输出原样返回
+func ShapeToolOutput(output string, budget int) string {
+	if EstimateTokens(output) <= budget {
+		return output
+	}
+	lines := strings.Split(output, "\n")
+	entries := collapseSimilar(lines)
+	if shaped := renderShaped(entries, nil, len(lines)); EstimateTokens(shaped) <= budget {
+		return shaped
+	}
+
+	keep := make([]bool, len(entries))
+	// 每保留一行最多新增一处省略说明，按最坏情况计入
+	marker := EstimateTokens(omittedMarker(len(lines))) + 1
+	used := EstimateTokens(shapeSummary(len(lines), len(lines))) + marker
+	take := func(i, limit int) bool {
+		if keep[i] {
+			return true
+		}
+		cost := EstimateTokens(entries[i].render()) + 1 + marker
+		if used+cost > limit {
+			return false
+		}
+		keep[i], used = true, used+cost
+		return true
+	}
+	for i, e := range entries {
+		if e.pinned {
+			take(i, budget)
+		}
+	}
+	// 末尾的行从后往前保留，先占用不超过一半的预算，给错误和警告行留出空间，之后再补齐
+	tail := max(len(entries)-shapeTailLines, 0)
+	for i := len(entries) - 1; i >= tail; i-- {
+		if !take(i, budget/2) {
+			break
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].important {
+			take(i, budget)
+		}
+	}
+	for i := len(entries) - 1; i >= tail; i-- {
+		if !take(i, budget) {
+			break
+		}
+	}
+	for i := 0; i < len(entries) && i < shapeHeadLines; i++ {
+		take(i, budget)
+	}
+
+	shaped := renderShaped(entries, keep, len(lines))
+	// 估算有误差时按字符截断兜底，保证不超出预算
+	for EstimateTokens(shaped) > budget {
+		runes := []rune(shaped)
+		if len(runes) < 64 {
+			return string(runes[len(runes)/2:])
+		}
+		shaped = "... 内容过长已截断 ...\n" + string(runes[len(runes)/4:])
+	}
+	return shaped
+}
+
+// collapseSimilar 合并连续的相似行（忽略时间戳和数字后相同），错误行不与普通行合并，超长的行截断
+func collapseSimilar(lines []string) []shapedLine {
+	entries := make([]shapedLine, 0, len(lines))
+	lastKey := ""
+	frames := 0
+	for _, line := range lines {
+		e := shapedLine{text: truncateLine(line), pinned: shapeMarker.MatchString(line)}
+		switch {
+		case shapeException.MatchString(strings.TrimSpace(line)):
+			e.important, frames = true, shapeFrameContext
+		case shapeFrame.MatchString(line) && frames > 0:
+			e.important = true
+			frames--
+		default:
+			e.important = shapeImportant.MatchString(line)
+			if !shapeFrame.MatchString(line) {
+				frames = 0
+			}
+		}
+
+		key := similarityKey(line)
+		if n := len(entries); n > 0 && key == lastKey && strings.TrimSpace(line) != "" && entries[n-1].important == e.important {
+			prev := &entries[n-1]
+			if prev.repeats == 0 {
+				prev.identical = true
+			}
+			prev.repeats++
+			prev.last = e.text
+			prev.identical = prev.identical && prev.last == prev.text
+			continue
+		}
+		lastKey = key
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func similarityKey(line string) string {
+	line = shapeTimestamp.ReplaceAllString(line, "")
+	line = shapeBracketTime.ReplaceAllString(line, "")
+	line = shapeHex.ReplaceAllString(line, "#")
+	return shapeDigits.ReplaceAllString(line, "#")
+}
+
+func truncateLine(line string) string {
+	runes := []rune(line)
+	if len(runes) <= shapeMaxLineRunes {
+		return line
+	}
+	return string(runes[:shapeMaxLineRunes]) + fmt.Sprintf(" ...(截断 %d 字符)", len(runes)-shapeMaxLineRunes)
+}
+
+// render 合并了相同行时注明重复次数；合并了相似行时保留首尾两行
+func (e shapedLine) render() string {
+	switch {
+	case e.repeats == 0:
+		return e.text
+	case e.identical:
+		return fmt.Sprintf("%s\n... 上一行重复 %d 次", e.text, e.repeats)
+	case e.repeats == 1:
+		return e.text + "\n" + e.last
+	}
+	return fmt.Sprintf("%s\n... 相似行 %d 行已合并 ...\n%s", e.text, e.repeats-1, e.last)
+}
+
+func omittedMarker(n int) string {
+	return fmt.Sprintf("... 省略 %d 行 ...", n)
+}
+
+func shapeSummary(original, kept int) string {
+	return fmt.Sprintf("[输出已压缩：原始 %d 行，保留 %d 行；相似行已合并，优先保留错误、警告和末尾 %d 行]", original, kept, shapeTailLines)
+}
+
+// renderShaped 按原顺序输出保留的行，keep 为 nil 时保留全部；连续省略的行合并为一条说明
+func renderShaped(entries []shapedLine, keep []bool, original int) string {
+	out := make([]string, 0, len(entries)+2)
+	kept, omitted := 0, 0
+	for i, e := range entries {
+		if keep != nil && !keep[i] {
+			omitted += 1 + e.repeats
+			continue
+		}
+		if omitted > 0 {
+			out = append(out, omittedMarker(omitted))
+			omitted = 0
+		}
+		out = append(out, e.render())
+		kept++
+	}
+	if omitted > 0 {
+		out = append(out, omittedMarker(omitted))
+	}
+	return shapeSummary(original, kept) + "\n" + strings.Join(out, "\n")
+}
+
+// estimateMessagesTokens 估算对话已占用的 token
+func estimateMessagesTokens(msgs []openai.ChatCompletionMessage) int {
+	total := 0
+	for _, msg := range msgs {
+		total += messageOverheadTokens + EstimateTokens(msg.Content)
+		for _, call := range msg.ToolCalls {
+			total += EstimateTokens(call.Function.Name) + EstimateTokens(call.Function.Arguments)
+		}
+	}
+	return total
+}
+
+// toolOutputBudget 按对话剩余的上下文空间计算下一条工具输出的预算：
+// 剩余空间（扣除为回复预留的部分）的一半，不超过上下文窗口的四分之一
+func toolOutputBudget(msgs []openai.ChatCompletionMessage) int {
+	window := config.Current().AnalysisBudget.ContextTokens
+	if window <= 0 {
+		window = DefaultContextTokens
+	}
+	budget := (window - responseReserveTokens - estimateMessagesTokens(msgs)) / 2
+	return max(min(budget, window/4), minToolOutputTokens)
+}
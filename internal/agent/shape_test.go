@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// journaldOutput journalctl -xe 风格的输出：大量重复的连接日志中夹着 OOM 和服务失败
+func journaldOutput() string {
+	var b strings.Builder
+	for i := 0; i < 800; i++ {
+		fmt.Fprintf(&b, "Oct 14 03:%02d:%02d web-01 sshd[%d]: Connection closed by 10.0.0.%d port %d [preauth]\n", i/60%60, i%60, 2000+i, i%250, 40000+i)
+		if i == 300 {
+			b.WriteString("Oct 14 03:05:00 web-01 kernel: Out of memory: Killed process 4242 (java) total-vm:8123456kB\n")
+		}
+		if i%97 == 0 {
+			fmt.Fprintf(&b, "Oct 14 03:%02d:00 web-01 CRON[%d]: pam_unix(cron:session): session opened for user root%d\n", i/60%60, 9000+i, i)
+		}
+	}
+	b.WriteString("Oct 14 03:14:00 web-01 systemd[1]: app.service: Main process exited, code=killed, status=9/KILL\n")
+	b.WriteString("Oct 14 03:14:00 web-01 systemd[1]: app.service: Failed with result 'signal'.\n")
+	return b.String()
+}
+
+// nginxOutput nginx access/error 日志：正常请求中夹着 502 和 upstream 错误
+func nginxOutput() string {
+	var b strings.Builder
+	for i := 0; i < 1500; i++ {
+		status := 200
+		if i%211 == 0 {
+			status = 502
+		}
+		fmt.Fprintf(&b, "10.1.%d.%d - - [14/Oct/2026:03:%02d:%02d +0000] \"GET /api/items/%d?page=%d HTTP/1.1\" %d %d \"-\" \"Mozilla/5.0\"\n", i%7, i%200, i/60%60, i%60, i, i%9, status, 512+i)
+		if i == 1055 {
+			b.WriteString("2026/10/14 03:17:35 [error] 31#31: *8812 connect() failed (111: Connection refused) while connecting to upstream, client: 10.1.3.9, upstream: \"http://172.18.0.5:8080/api/items\"\n")
+		}
+	}
+	return b.String()
+}
+
+// javaOutput 带多层 Caused by 的 Java 栈
+func javaOutput() string {
+	var b strings.Builder
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&b, "2026-10-14 03:20:%02d.%03d INFO  [main] c.e.app.Worker - processed batch %d in %dms\n", i%60, i, i, 10+i%30)
+	}
+	b.WriteString("Exception in thread \"main\" java.lang.IllegalStateException: Failed to load ApplicationContext\n")
+	for i := 0; i < 60; i++ {
+		fmt.Fprintf(&b, "\tat org.springframework.context.%s.invoke(%s.java:%d)\n", frameName("Context", i), frameName("Context", i), 100+i)
+	}
+	b.WriteString("Caused by: java.sql.SQLTransientConnectionException: HikariPool-1 - Connection is not available, request timed out after 30000ms.\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "\tat com.zaxxer.hikari.pool.%s.run(%s.java:%d)\n", frameName("Pool", i), frameName("Pool", i), 200+i)
+	}
+	b.WriteString("\t... 52 more\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "2026-10-14 03:21:%02d.%03d INFO  [main] c.e.app.Shutdown - releasing resource %d\n", i%60, i, i)
+	}
+	return b.String()
+}
+
+// frameName 生成互不相似的类名，避免栈帧被当作相似行合并
+func frameName(prefix string, i int) string {
+	return fmt.Sprintf("%s%c%c", prefix, 'A'+i%26, 'a'+i/26)
+}
+
+func TestShapeToolOutput_RetainsErrorsWithinBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		output string
+		budget int
+		want   []string
+	}{
+		{"journald", journaldOutput(), 600, []string{"Out of memory: Killed process 4242", "Failed with result 'signal'", "status=9/KILL"}},
+		{"nginx", nginxOutput(), 800, []string{"connect() failed (111: Connection refused)", "\"GET /api/items/0?page=0 HTTP/1.1\" 502", "\"GET /api/items/422?page=8 HTTP/1.1\" 502", "\"GET /api/items/1477?page=1 HTTP/1.1\" 502"}},
+		{"java", javaOutput(), 700, []string{"IllegalStateException: Failed to load ApplicationContext", "ContextAa.invoke", "Caused by: java.sql.SQLTransientConnectionException", "PoolAa.run", "releasing resource 99"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			output := "[exit_code] 0\n[duration] 1.2s\n[stdout]\n" + tc.output + "[stderr] (empty)"
+			if EstimateTokens(output) <= tc.budget {
+				t.Fatalf("fixture should exceed the budget, got %d tokens", EstimateTokens(output))
+			}
+			shaped := ShapeToolOutput(output, tc.budget)
+			if tokens := EstimateTokens(shaped); tokens > tc.budget {
+				t.Errorf("Expected shaped output within %d tokens, got %d", tc.budget, tokens)
+			}
+			for _, want := range append(tc.want, "[exit_code] 0", "[stderr] (empty)", "[输出已压缩") {
+				if !strings.Contains(shaped, want) {
+					t.Errorf("Expected %q to be retained, got:\n%s", want, shaped)
+				}
+			}
+		})
+	}
+}
+
+func TestShapeToolOutput_CollapsesSimilarLines(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 413; i++ {
+		fmt.Fprintf(&b, "[%d.%06d] EXT4-fs error (device sda1): reading directory lblock %d\n", 100+i, i, i)
+	}
+	b.WriteString("done")
+	shaped := ShapeToolOutput(b.String(), 2000)
+	if !strings.Contains(shaped, "相似行 411 行已合并") || strings.Count(shaped, "EXT4-fs error") != 2 ||
+		!strings.Contains(shaped, "lblock 412\ndone") {
+		t.Errorf("Expected repeated lines to be collapsed, got:\n%s", shaped)
+	}
+}
+
+func TestShapeToolOutput_CollapsesIdenticalLines(t *testing.T) {
+	output := strings.Repeat("WARNING: apt does not have a stable CLI interface.\n", 500) + "ok"
+	shaped := ShapeToolOutput(output, 100)
+	if !strings.Contains(shaped, "上一行重复 499 次") || strings.Count(shaped, "WARNING") != 1 {
+		t.Errorf("Expected identical lines to be collapsed, got:\n%s", shaped)
+	}
+}
+
+func TestShapeToolOutput_SmallOutputUnchanged(t *testing.T) {
+	output := "[exit_code] 0\n[stdout]\nup 3 days"
+	if got := ShapeToolOutput(output, 100); got != output {
+		t.Errorf("Expected small output unchanged, got %q", got)
+	}
+}
+
+func TestToolOutputBudget_AdaptsToContext(t *testing.T) {
+	empty := toolOutputBudget(nil)
+	if empty != DefaultContextTokens/4 {
+		t.Errorf("Expected a quarter of the window for an empty conversation, got %d", empty)
+	}
+	long := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleTool, Content: strings.Repeat("x", 3*25000)}}
+	if budget := toolOutputBudget(long); budget >= empty || budget < minToolOutputTokens {
+		t.Errorf("Expected a smaller budget as the context fills, got %d", budget)
+	}
+	full := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleTool, Content: strings.Repeat("x", 3*DefaultContextTokens)}}
+	if budget := toolOutputBudget(full); budget != minToolOutputTokens {
+		t.Errorf("Expected the minimum budget when the context is full, got %d", budget)
+	}
+}
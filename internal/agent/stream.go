@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatStreamer 支持流式响应的对话补全接口，*openai.Client 实现该接口
+type ChatStreamer interface {
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error)
+}
+
+// errStreamUnsupported 流式请求成功但没有返回任何数据块，通常是接口忽略了 stream 参数
+var errStreamUnsupported = errors.New("endpoint returned no stream chunks")
+
+// streamUnsupported 不支持流式响应的接口和模型（BaseURL + 模型名），之后直接使用普通请求
+var streamUnsupported sync.Map
+
+// streamKey 客户端的接口地址和模型名，不支持流式响应的判定按此记录
+func streamKey(client ChatCompleter) string {
+	if c, ok := client.(*ModelClient); ok {
+		return c.Profile.BaseURL + "|" + c.Profile.Model
+	}
+	return config.Current().BaseURL + "|" + getModelName()
+}
+
+// streamingEnabled 是否尝试流式请求：未关闭流式响应且当前接口和模型没有被判定为不支持
+func streamingEnabled(client ChatCompleter) bool {
+	if config.Current().NoStream {
+		return false
+	}
+	_, unsupported := streamUnsupported.Load(streamKey(client))
+	return !unsupported
+}
+
+// requestCompletion 请求一次对话补全；deltaCallback 不为空且接口支持时使用流式响应，文本增量实时交给 deltaCallback。
+// 流式请求在输出任何内容之前失败时改用普通请求，接口明确不支持流式时记住结果，之后不再尝试
+// 两种方式返回的消息相同，对话记录与普通请求一致
+func requestCompletion(ctx context.Context, client ChatCompleter, req openai.ChatCompletionRequest, deltaCallback func(string)) (openai.ChatCompletionMessage, error) {
+	if streamer, ok := client.(ChatStreamer); ok && deltaCallback != nil && streamingEnabled(client) {
+		streamed := false
+		msg, err := completeStream(ctx, streamer, req, func(delta string) {
+			streamed = true
+			deltaCallback(delta)
+		})
+		if err == nil || streamed || ctx.Err() != nil {
+			return msg, err
+		}
+		if streamNotSupported(err) {
+			streamUnsupported.Store(streamKey(client), true)
+			logger.Info("⚠️ 模型或接口不支持流式响应，改用普通请求: %v", err)
+		} else {
+			logger.Debug("流式请求失败，改用普通请求: %v", err)
+		}
+	}
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	return resp.Choices[0].Message, nil
+}
+
+// streamNotSupported 错误是否表示接口不支持流式响应，而不是临时故障
+func streamNotSupported(err error) bool {
+	if errors.Is(err, errStreamUnsupported) || errors.Is(err, openai.ErrTooManyEmptyStreamMessages) {
+		return true
+	}
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+	return status == http.StatusBadRequest || status == http.StatusNotFound ||
+		status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented
+}
+
+// completeStream 以流式响应请求模型，拼接文本增量和按序号分段返回的工具调用
+func completeStream(ctx context.Context, streamer ChatStreamer, req openai.ChatCompletionRequest, onDelta func(string)) (openai.ChatCompletionMessage, error) {
+	req.Stream = true
+	stream, err := streamer.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var calls []openai.ToolCall
+	chunks := 0
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content.String()}, err
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		chunks++
+		delta := resp.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+		for _, call := range delta.ToolCalls {
+			i := len(calls)
+			if call.Index != nil {
+				i = *call.Index
+			}
+			for len(calls) <= i {
+				calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+			}
+			if call.ID != "" {
+				calls[i].ID = call.ID
+			}
+			if call.Type != "" {
+				calls[i].Type = call.Type
+			}
+			if calls[i].Function.Name == "" {
+				calls[i].Function.Name = call.Function.Name
+			}
+			calls[i].Function.Arguments += call.Function.Arguments
+		}
+	}
+	if chunks == 0 {
+		return openai.ChatCompletionMessage{}, errStreamUnsupported
+	}
+	// 普通请求返回的工具调用没有序号，保持对话记录一致
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content.String(), ToolCalls: calls}, nil
+}
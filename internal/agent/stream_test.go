@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// streamTestClient 指向模拟接口的客户端，并清空流式支持的判定结果
+func streamTestClient(t *testing.T, handler http.HandlerFunc) *openai.Client {
+	t.Helper()
+	api := httptest.NewServer(handler)
+	t.Cleanup(api.Close)
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		streamUnsupported.Clear()
+	})
+	config.Update(func(cfg *config.Config) { cfg.BaseURL, cfg.NoStream = api.URL, false })
+	streamUnsupported.Clear()
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = api.URL
+	return openai.NewClientWithConfig(cfg)
+}
+
+func streamRequested(r *http.Request) bool {
+	var req openai.ChatCompletionRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	return req.Stream
+}
+
+func TestRequestCompletion_StreamMatchesNonStreaming(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"先看一下"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"磁盘"}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"execute_shell_command","arguments":"{\"command\":"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"df -h\",\"reason\":\"disk\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_system_metrics","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	}
+	client := streamTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if streamRequested(r) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range chunks {
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"先看一下磁盘","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"execute_shell_command","arguments":"{\"command\":\"df -h\",\"reason\":\"disk\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"get_system_metrics","arguments":"{}"}}
+		]}}]}`)
+	})
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "磁盘满了吗"}}}
+
+	var deltas []string
+	streamed, err := requestCompletion(context.Background(), client, req, func(delta string) { deltas = append(deltas, delta) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := requestCompletion(context.Background(), client, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deltas, []string{"先看一下", "磁盘"}) {
+		t.Errorf("Expected the text deltas in order, got %q", deltas)
+	}
+	if !reflect.DeepEqual(streamed, plain) {
+		t.Errorf("Streamed message differs from the non-streaming one:\n%+v\n%+v", streamed, plain)
+	}
+}
+
+func TestRequestCompletion_FallsBackWhenStreamingUnsupported(t *testing.T) {
+	var streamRequests atomic.Int32
+	// 接口忽略 stream 参数，总是返回完整响应
+	client := streamTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if streamRequested(r) {
+			streamRequests.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"磁盘使用率 42%"}}]}`)
+	})
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "磁盘满了吗"}}}
+
+	for i := 0; i < 2; i++ {
+		var deltas []string
+		msg, err := requestCompletion(context.Background(), client, req, func(delta string) { deltas = append(deltas, delta) })
+		if err != nil || msg.Content != "磁盘使用率 42%" {
+			t.Fatalf("Expected the non-streaming answer, got %+v %v", msg, err)
+		}
+		if len(deltas) != 0 {
+			t.Errorf("Expected no deltas from the fallback, got %q", deltas)
+		}
+	}
+	if n := streamRequests.Load(); n != 1 {
+		t.Errorf("Expected streaming to be tried once and remembered as unsupported, got %d attempts", n)
+	}
+
+	// 关闭流式响应后不再尝试
+	streamUnsupported.Clear()
+	config.Update(func(cfg *config.Config) { cfg.NoStream = true })
+	requestCompletion(context.Background(), client, req, func(string) {})
+	if n := streamRequests.Load(); n != 1 {
+		t.Errorf("Expected no_stream to skip streaming, got %d attempts", n)
+	}
+}
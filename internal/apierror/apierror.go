@@ -0,0 +1,210 @@
+// Package apierror 定义所有 HTTP API 统一的错误响应：
+// {"code": "WEBSITE_DOMAIN_EXISTS", "message": "...", "details": ..., "request_id": "..."}
+// code 是稳定的机器可读错误码，前端据此区分错误类型；message 面向用户，可能随版本变化。
+// 服务层返回的类型化错误通过 Mapping 表转换为状态码和错误码，未知错误统一返回 INTERNAL，
+// 详情只写入日志（附带请求 ID），不返回给客户端
+package apierror
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"qwq/internal/logger"
+)
+
+// RequestIDHeader 请求 ID 头，客户端传入时沿用，否则自动生成
+const RequestIDHeader = "X-Request-ID"
+
+// 通用错误码，没有更具体的错误码时按状态码选择
+const (
+	CodeBadRequest       = "BAD_REQUEST"
+	CodeValidation       = "VALIDATION_FAILED"
+	CodeUnauthorized     = "UNAUTHORIZED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeNotFound         = "NOT_FOUND"
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	CodeConflict         = "CONFLICT"
+	CodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	CodeUnprocessable    = "UNPROCESSABLE"
+	CodeRateLimited      = "RATE_LIMITED"
+	CodeInternal         = "INTERNAL"
+	CodeNotImplemented   = "NOT_IMPLEMENTED"
+	CodeBadGateway       = "BAD_GATEWAY"
+	CodeUnavailable      = "UNAVAILABLE"
+	CodeTimeout          = "TIMEOUT"
+)
+
+// internalMessage 未知错误返回给客户端的信息
+const internalMessage = "internal server error"
+
+// Envelope 错误响应体
+type Envelope struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id"`
+}
+
+// Error 带状态码和错误码的 API 错误，处理器可以直接返回给 Write
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error // 原始错误，只用于 errors.Is/As 和日志
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New 创建 API 错误
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap 以原始错误信息创建 API 错误，用于可以直接展示给用户的错误（如请求参数校验失败）
+func Wrap(status int, code string, err error) *Error {
+	return &Error{Status: status, Code: code, Message: err.Error(), Err: err}
+}
+
+// WithDetails 附加结构化详情，如字段级校验错误
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Mapping 服务层错误到 API 错误的映射，Err 通过 errors.Is 匹配，返回的 message 使用原始错误信息；
+// 原始错误实现 Detailer 时将其返回的结构化详情附加到响应中
+type Mapping struct {
+	Err    error
+	Status int
+	Code   string
+}
+
+// Detailer 服务层错误可以实现该接口，为映射后的响应提供 details，如端口冲突报告
+type Detailer interface {
+	Details() interface{}
+}
+
+// Lookup 按 Error、映射表、上下文错误的顺序转换错误，无法识别时返回 INTERNAL
+func Lookup(err error, mappings ...Mapping) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, m := range mappings {
+		if errors.Is(err, m.Err) {
+			mapped := &Error{Status: m.Status, Code: m.Code, Message: err.Error(), Err: err}
+			var detailer Detailer
+			if errors.As(err, &detailer) {
+				mapped.Details = detailer.Details()
+			}
+			return mapped
+		}
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "request timed out", Err: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "request canceled", Err: err}
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: internalMessage, Err: err}
+}
+
+// Write 将错误转换为统一的错误响应；INTERNAL 错误的详情只记录到日志
+func Write(w http.ResponseWriter, r *http.Request, err error, mappings ...Mapping) {
+	apiErr := Lookup(err, mappings...)
+	requestID := RequestID(w, r)
+	if apiErr.Code == CodeInternal && apiErr.Err != nil {
+		method, path := "", ""
+		if r != nil {
+			method, path = r.Method, r.URL.Path
+		}
+		logger.Info("❌ API 内部错误 [%s] %s %s: %v", requestID, method, path, apiErr.Err)
+	}
+	writeEnvelope(w, apiErr.Status, Envelope{Code: apiErr.Code, Message: apiErr.Error(), Details: apiErr.Details, RequestID: requestID})
+}
+
+// Respond 返回指定状态码的错误，错误码按状态码选择
+func Respond(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeEnvelope(w, status, Envelope{Code: CodeForStatus(status), Message: message, RequestID: RequestID(w, r)})
+}
+
+// CodeForStatus 状态码对应的通用错误码
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 400 && status < 500 {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
+
+// RequestID 当前请求的 ID：优先使用中间件写入响应头的 ID，其次是客户端传入的 ID，都没有时生成一个并写入响应头
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+	id := ""
+	if r != nil {
+		id = r.Header.Get(RequestIDHeader)
+	}
+	if id == "" {
+		id = NewRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// NewRequestID 生成随机请求 ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, envelope Envelope) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(envelope)
+}
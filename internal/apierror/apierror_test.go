@@ -0,0 +1,88 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errThingNotFound = errors.New("thing not found")
+
+// thingError 带结构化详情的服务层错误
+type thingError struct{ id int }
+
+func (e *thingError) Error() string        { return fmt.Sprintf("thing %d not found", e.id) }
+func (e *thingError) Unwrap() error        { return errThingNotFound }
+func (e *thingError) Details() interface{} { return map[string]int{"id": e.id} }
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) Envelope {
+	t.Helper()
+	var envelope Envelope
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func TestLookup(t *testing.T) {
+	mappings := []Mapping{{Err: errThingNotFound, Status: http.StatusNotFound, Code: "THING_NOT_FOUND"}}
+
+	apiErr := Lookup(fmt.Errorf("load: %w", errThingNotFound), mappings...)
+	if apiErr.Status != http.StatusNotFound || apiErr.Code != "THING_NOT_FOUND" || apiErr.Message != "load: thing not found" {
+		t.Errorf("Unexpected mapping %+v", apiErr)
+	}
+	detailed := Lookup(fmt.Errorf("load: %w", &thingError{id: 7}), mappings...)
+	if details, _ := detailed.Details.(map[string]int); detailed.Code != "THING_NOT_FOUND" || details["id"] != 7 {
+		t.Errorf("Expected details from the mapped error, got %+v", detailed)
+	}
+	explicit := New(http.StatusConflict, "THING_EXISTS", "thing exists")
+	if got := Lookup(fmt.Errorf("create: %w", explicit), mappings...); got != explicit {
+		t.Errorf("Expected the wrapped API error, got %+v", got)
+	}
+	if got := Lookup(context.DeadlineExceeded); got.Status != http.StatusGatewayTimeout || got.Code != CodeTimeout {
+		t.Errorf("Unexpected timeout mapping %+v", got)
+	}
+	if got := Lookup(errors.New("secret dsn")); got.Code != CodeInternal || got.Error() != internalMessage {
+		t.Errorf("Unknown errors should map to INTERNAL, got %+v", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/things/1", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	rec := httptest.NewRecorder()
+	Write(rec, req, New(http.StatusBadRequest, CodeValidation, "name is required").WithDetails(map[string]string{"field": "name"}))
+	envelope := decode(t, rec)
+	if rec.Code != http.StatusBadRequest || envelope.Code != CodeValidation || envelope.RequestID != "abc" || rec.Header().Get(RequestIDHeader) != "abc" {
+		t.Errorf("Unexpected response %d %+v", rec.Code, envelope)
+	}
+	if details, _ := envelope.Details.(map[string]interface{}); details["field"] != "name" {
+		t.Errorf("Expected details, got %+v", envelope.Details)
+	}
+
+	rec = httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodGet, "/api/things/1", nil), errors.New("pq: password authentication failed"))
+	body := rec.Body.String()
+	envelope = decode(t, rec)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(body, "password") || envelope.RequestID == "" {
+		t.Errorf("Internal errors should only expose the request ID, got %d %s", rec.Code, body)
+	}
+	if strings.Contains(body, `"details"`) {
+		t.Errorf("Empty details should be omitted, got %s", body)
+	}
+}
+
+func TestRespond(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(RequestIDHeader, "from-middleware")
+	Respond(rec, httptest.NewRequest(http.MethodDelete, "/api/things", nil), http.StatusMethodNotAllowed, "Method not allowed")
+	envelope := decode(t, rec)
+	if envelope.Code != CodeMethodNotAllowed || envelope.RequestID != "from-middleware" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected response %+v", envelope)
+	}
+}
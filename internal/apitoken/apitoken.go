@@ -0,0 +1,249 @@
+// Package apitoken 提供程序化访问 API 的令牌：令牌属于创建它的用户，只拥有创建时选择的权限子集，
+// 数据库中只保存哈希，完整令牌只在创建时返回一次
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Prefix 令牌的固定前缀，便于在日志和密钥扫描中识别
+	Prefix = "qwq_"
+	// prefixLength 列表中显示、用于查找令牌的前缀长度（含 qwq_）
+	prefixLength = 12
+	// lastUsedInterval 最近使用时间的最小更新间隔，避免每个请求都写数据库
+	lastUsedInterval = time.Minute
+)
+
+var (
+	// ErrInvalidToken 令牌不存在或不匹配
+	ErrInvalidToken = errors.New("invalid api token")
+	// ErrTokenExpired 令牌已过期
+	ErrTokenExpired = errors.New("api token expired")
+	// ErrTokenRevoked 令牌已吊销
+	ErrTokenRevoked = errors.New("api token revoked")
+	// ErrTokenNotFound 令牌记录不存在
+	ErrTokenNotFound = errors.New("api token not found")
+	// ErrInvalidRequest 创建令牌的参数无效
+	ErrInvalidRequest = errors.New("invalid api token request")
+)
+
+// Token API 令牌，完整令牌不落库，只保存前缀和 SHA-256 哈希
+type Token struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"not null"`
+	Owner       string     `json:"owner" gorm:"index;not null"` // 创建令牌的用户，令牌的操作记在该用户名下
+	TenantID    uint       `json:"tenant_id" gorm:"index"`
+	Prefix      string     `json:"prefix" gorm:"uniqueIndex;not null"` // 完整令牌的前 12 个字符
+	Hash        string     `json:"-" gorm:"not null"`
+	Permissions []string   `json:"permissions" gorm:"type:text;serializer:json"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // 为空表示不过期
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Allows 令牌是否拥有权限，* 表示全部权限，<resource>:* 表示资源的全部操作
+func (t *Token) Allows(permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, granted := range t.Permissions {
+		if granted == "*" || granted == permission || granted == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsResource 令牌是否拥有资源的任一权限
+func (t *Token) AllowsResource(resource string) bool {
+	for _, granted := range t.Permissions {
+		if granted == "*" || strings.HasPrefix(granted, resource+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateRequest 创建令牌的参数
+type CreateRequest struct {
+	Name        string
+	Owner       string
+	TenantID    uint
+	Permissions []string
+	TTL         time.Duration // 0 表示不过期
+}
+
+// Manager 令牌管理
+type Manager struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewManager 创建令牌管理器
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db, now: time.Now}
+}
+
+// Create 创建令牌，返回令牌记录和完整令牌；完整令牌之后无法再次获取
+func (m *Manager) Create(ctx context.Context, req CreateRequest) (*Token, string, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Owner == "" {
+		return nil, "", fmt.Errorf("%w: name and owner are required", ErrInvalidRequest)
+	}
+	if len(req.Permissions) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one permission is required", ErrInvalidRequest)
+	}
+	if req.TTL < 0 {
+		return nil, "", fmt.Errorf("%w: expiry must not be negative", ErrInvalidRequest)
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+	secret := Prefix + hex.EncodeToString(random)
+	token := &Token{
+		Name:        req.Name,
+		Owner:       req.Owner,
+		TenantID:    req.TenantID,
+		Prefix:      secret[:prefixLength],
+		Hash:        hashSecret(secret),
+		Permissions: req.Permissions,
+		CreatedAt:   m.now(),
+	}
+	if req.TTL > 0 {
+		expires := token.CreatedAt.Add(req.TTL)
+		token.ExpiresAt = &expires
+	}
+	if err := m.db.WithContext(ctx).Create(token).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to save api token: %w", err)
+	}
+	return token, secret, nil
+}
+
+// List 列出令牌（含已吊销的），owner 为空时列出所有用户的令牌
+func (m *Manager) List(ctx context.Context, owner string) ([]*Token, error) {
+	query := m.db.WithContext(ctx).Order("id DESC")
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	var tokens []*Token
+	if err := query.Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Revoke 吊销令牌，立即生效；owner 不为空时只能吊销该用户的令牌
+func (m *Manager) Revoke(ctx context.Context, id uint, owner string) (*Token, error) {
+	var token Token
+	query := m.db.WithContext(ctx).Where("id = ?", id)
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	if err := query.First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to load api token: %w", err)
+	}
+	if token.RevokedAt != nil {
+		return &token, nil
+	}
+	now := m.now()
+	if err := m.db.WithContext(ctx).Model(&token).UpdateColumn("revoked_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to revoke api token: %w", err)
+	}
+	token.RevokedAt = &now
+	return &token, nil
+}
+
+// Authenticate 校验完整令牌并更新最近使用时间
+// 每次都查询数据库，吊销和过期立即生效
+func (m *Manager) Authenticate(ctx context.Context, secret string) (*Token, error) {
+	if !strings.HasPrefix(secret, Prefix) || len(secret) <= prefixLength {
+		return nil, ErrInvalidToken
+	}
+	var token Token
+	if err := m.db.WithContext(ctx).Where("prefix = ?", secret[:prefixLength]).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to load api token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	now := m.now()
+	if token.RevokedAt != nil {
+		return nil, ErrTokenRevoked
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedInterval {
+		if err := m.db.WithContext(ctx).Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to update api token: %w", err)
+		}
+		token.LastUsedAt = &now
+	}
+	return &token, nil
+}
+
+// hashSecret 令牌是 192 位随机数，SHA-256 足以防止从数据库还原
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseTTL 解析有效期，支持 Go duration（如 12h）和天数（如 90d），空字符串表示不过期
+func ParseTTL(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: invalid expiry %q", ErrInvalidRequest, value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: invalid expiry %q, e.g. 90d or 12h", ErrInvalidRequest, value)
+	}
+	return d, nil
+}
+
+var (
+	defaultManagerMu sync.RWMutex
+	defaultManager   *Manager
+)
+
+// SetDefault 设置全局令牌管理器，Web 服务通过它校验 Bearer 令牌
+func SetDefault(manager *Manager) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+	defaultManager = manager
+}
+
+// Default 返回全局令牌管理器，未启用时为 nil
+func Default() *Manager {
+	defaultManagerMu.RLock()
+	defer defaultManagerMu.RUnlock()
+	return defaultManager
+}
@@ -0,0 +1,126 @@
+package apitoken
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func setupManager(t *testing.T) (*Manager, *time.Time) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&Token{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	manager := NewManager(db)
+	manager.now = func() time.Time { return now }
+	return manager, &now
+}
+
+func TestManager_CreateAndAuthenticate(t *testing.T) {
+	manager, now := setupManager(t)
+	ctx := context.Background()
+
+	token, secret, err := manager.Create(ctx, CreateRequest{Name: "ci", Owner: "admin", TenantID: 1, Permissions: []string{"deployments:write"}, TTL: 90 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(secret, Prefix) || token.Prefix != secret[:12] || strings.Contains(token.Hash, secret) {
+		t.Fatalf("Unexpected token %+v for secret %q", token, secret)
+	}
+
+	got, err := manager.Authenticate(ctx, secret)
+	if err != nil || got.ID != token.ID || got.LastUsedAt == nil {
+		t.Fatalf("Expected token to authenticate and record last use, got %+v, %v", got, err)
+	}
+	if !got.Allows("deployments:write") || got.Allows("deployments:approve") || !got.AllowsResource("deployments") || got.AllowsResource("files") {
+		t.Errorf("Unexpected permissions for %v", got.Permissions)
+	}
+
+	tampered := secret[:len(secret)-1] + "x"
+	if _, err := manager.Authenticate(ctx, tampered); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a tampered secret, got %v", err)
+	}
+	if _, err := manager.Authenticate(ctx, "Basic abc"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken without prefix, got %v", err)
+	}
+
+	*now = now.Add(91 * 24 * time.Hour)
+	if _, err := manager.Authenticate(ctx, secret); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestManager_RevokeTakesEffectImmediately(t *testing.T) {
+	manager, _ := setupManager(t)
+	ctx := context.Background()
+
+	token, secret, err := manager.Create(ctx, CreateRequest{Name: "ci", Owner: "alice", Permissions: []string{"websites:*"}})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := manager.Revoke(ctx, token.ID, "bob"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected other users not to revoke the token, got %v", err)
+	}
+	if _, err := manager.Authenticate(ctx, secret); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	revoked, err := manager.Revoke(ctx, token.ID, "alice")
+	if err != nil || revoked.RevokedAt == nil {
+		t.Fatalf("Revoke failed: %+v, %v", revoked, err)
+	}
+	if _, err := manager.Authenticate(ctx, secret); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked right after revocation, got %v", err)
+	}
+
+	tokens, err := manager.List(ctx, "alice")
+	if err != nil || len(tokens) != 1 || tokens[0].RevokedAt == nil {
+		t.Errorf("Expected the revoked token to stay listed, got %+v, %v", tokens, err)
+	}
+	if tokens, _ := manager.List(ctx, "bob"); len(tokens) != 0 {
+		t.Errorf("Expected no tokens for bob, got %d", len(tokens))
+	}
+}
+
+func TestManager_CreateValidation(t *testing.T) {
+	manager, _ := setupManager(t)
+	for _, req := range []CreateRequest{
+		{Owner: "admin", Permissions: []string{"logs:read"}},
+		{Name: "ci", Owner: "admin"},
+		{Name: "ci", Owner: "admin", Permissions: []string{"logs:read"}, TTL: -time.Hour},
+	} {
+		if _, _, err := manager.Create(context.Background(), req); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest for %+v, got %v", req, err)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for value, want := range map[string]time.Duration{"": 0, "90d": 90 * 24 * time.Hour, "12h": 12 * time.Hour} {
+		if got, err := ParseTTL(value); err != nil || got != want {
+			t.Errorf("ParseTTL(%q) = %v, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"0d", "-1d", "soon", "-2h"} {
+		if _, err := ParseTTL(value); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Expected ParseTTL(%q) to fail, got %v", value, err)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package appstore
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 
+	"qwq/internal/pagination"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -14,6 +15,7 @@ type APIService struct {
 	appStoreService AppStoreService
 	installerService InstallerService
 	recommendationService RecommendationService
+	syncService *SyncService
 }
 
 // NewAPIService 创建 API 服务实例
@@ -29,6 +31,11 @@ func NewAPIService(db *gorm.DB) *APIService {
 	}
 }
 
+// SetSyncService 设置模板源同步服务，未设置时模板源接口返回 404
+func (s *APIService) SetSyncService(syncService *SyncService) {
+	s.syncService = syncService
+}
+
 // RegisterRoutes 注册路由
 func (s *APIService) RegisterRoutes(router *gin.RouterGroup) {
 	// 模板管理路由
@@ -70,6 +77,13 @@ func (s *APIService) RegisterRoutes(router *gin.RouterGroup) {
 		search.GET("/recommendations", s.GetRecommendations) // 获取推荐
 	}
 	
+	// 模板源同步路由
+	sources := router.Group("/sources")
+	{
+		sources.GET("", s.ListSources)            // 列出模板源
+		sources.POST("/:id/sync", s.SyncSource)   // 同步模板源
+	}
+	
 	// 初始化路由
 	router.POST("/init", s.InitBuiltinTemplates)     // 初始化内置模板
 }
@@ -90,7 +104,7 @@ func (s *APIService) ListTemplates(c *gin.Context) {
 	
 	templates, err := s.appStoreService.ListTemplates(c.Request.Context(), category, status)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -109,17 +123,13 @@ func (s *APIService) ListTemplates(c *gin.Context) {
 func (s *APIService) GetTemplate(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid template id")))
+		respondError(c, http.StatusBadRequest, "invalid template id")
 		return
 	}
 	
 	template, err := s.appStoreService.GetTemplate(c.Request.Context(), uint(id))
 	if err != nil {
-		if err == ErrTemplateNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse(err))
-		} else {
-			c.JSON(http.StatusInternalServerError, ErrorResponse(err))
-		}
+		writeError(c, err)
 		return
 	}
 	
@@ -138,16 +148,12 @@ func (s *APIService) GetTemplate(c *gin.Context) {
 func (s *APIService) CreateTemplate(c *gin.Context) {
 	var template AppTemplate
 	if err := c.ShouldBindJSON(&template); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
 	if err := s.appStoreService.CreateTemplate(c.Request.Context(), &template); err != nil {
-		if err == ErrTemplateAlreadyExists {
-			c.JSON(http.StatusConflict, ErrorResponse(err))
-		} else {
-			c.JSON(http.StatusInternalServerError, ErrorResponse(err))
-		}
+		writeError(c, err)
 		return
 	}
 	
@@ -167,20 +173,20 @@ func (s *APIService) CreateTemplate(c *gin.Context) {
 func (s *APIService) UpdateTemplate(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid template id")))
+		respondError(c, http.StatusBadRequest, "invalid template id")
 		return
 	}
 	
 	var template AppTemplate
 	if err := c.ShouldBindJSON(&template); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
 	template.ID = uint(id)
 	
 	if err := s.appStoreService.UpdateTemplate(c.Request.Context(), &template); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -199,16 +205,12 @@ func (s *APIService) UpdateTemplate(c *gin.Context) {
 func (s *APIService) DeleteTemplate(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid template id")))
+		respondError(c, http.StatusBadRequest, "invalid template id")
 		return
 	}
 	
 	if err := s.appStoreService.DeleteTemplate(c.Request.Context(), uint(id)); err != nil {
-		if err == ErrTemplateNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse(err))
-		} else {
-			c.JSON(http.StatusInternalServerError, ErrorResponse(err))
-		}
+		writeError(c, err)
 		return
 	}
 	
@@ -227,13 +229,13 @@ func (s *APIService) DeleteTemplate(c *gin.Context) {
 func (s *APIService) ValidateTemplate(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid template id")))
+		respondError(c, http.StatusBadRequest, "invalid template id")
 		return
 	}
 	
 	template, err := s.appStoreService.GetTemplate(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -263,19 +265,19 @@ func (s *APIService) ValidateTemplate(c *gin.Context) {
 func (s *APIService) RenderTemplate(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid template id")))
+		respondError(c, http.StatusBadRequest, "invalid template id")
 		return
 	}
 	
 	var params map[string]interface{}
 	if err := c.ShouldBindJSON(&params); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
 	rendered, err := s.appStoreService.RenderTemplate(c.Request.Context(), uint(id), params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -284,27 +286,43 @@ func (s *APIService) RenderTemplate(c *gin.Context) {
 	}))
 }
 
+// instanceListSpec 实例列表允许的排序字段和过滤参数
+var instanceListSpec = pagination.Spec{
+	Sort:        map[string]string{"id": "id", "name": "name", "status": "status", "created_at": "created_at", "updated_at": "updated_at"},
+	DefaultSort: "-created_at",
+	Filters:     map[string]string{"status": "status", "name": "name"},
+}
+
 // ListInstances 列出应用实例
 // @Summary 列出应用实例
-// @Description 获取应用实例列表
+// @Description 分页获取应用实例列表，省略分页参数时返回第一页
 // @Tags instances
 // @Accept json
 // @Produce json
 // @Param user_id query int false "用户ID"
 // @Param tenant_id query int false "租户ID"
-// @Success 200 {object} Response{data=[]ApplicationInstance}
+// @Param page query int false "页码，从 1 开始"
+// @Param pageSize query int false "每页条数，默认 20，最大 200"
+// @Param sort query string false "排序字段（id、name、status、created_at、updated_at），- 前缀表示降序"
+// @Param status query string false "按状态过滤"
+// @Success 200 {object} Response{data=pagination.Page[ApplicationInstance]}
 // @Router /appstore/instances [get]
 func (s *APIService) ListInstances(c *gin.Context) {
 	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 32)
 	tenantID, _ := strconv.ParseUint(c.Query("tenant_id"), 10, 32)
+	q, err := pagination.Parse(c.Request.URL.Query(), instanceListSpec)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
 	
-	instances, err := s.appStoreService.ListInstances(c.Request.Context(), uint(userID), uint(tenantID))
+	page, err := s.appStoreService.QueryInstances(c.Request.Context(), uint(userID), uint(tenantID), q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
-	c.JSON(http.StatusOK, SuccessResponse(instances))
+	c.JSON(http.StatusOK, SuccessResponse(page))
 }
 
 // GetInstance 获取应用实例详情
@@ -319,17 +337,13 @@ func (s *APIService) ListInstances(c *gin.Context) {
 func (s *APIService) GetInstance(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid instance id")))
+		respondError(c, http.StatusBadRequest, "invalid instance id")
 		return
 	}
 	
 	instance, err := s.appStoreService.GetInstance(c.Request.Context(), uint(id))
 	if err != nil {
-		if err == ErrInstanceNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse(err))
-		} else {
-			c.JSON(http.StatusInternalServerError, ErrorResponse(err))
-		}
+		writeError(c, err)
 		return
 	}
 	
@@ -348,7 +362,7 @@ func (s *APIService) GetInstance(c *gin.Context) {
 func (s *APIService) InstallApplication(c *gin.Context) {
 	var req InstallRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
@@ -363,11 +377,7 @@ func (s *APIService) InstallApplication(c *gin.Context) {
 	
 	result, err := s.installerService.Install(c.Request.Context(), &req)
 	if err != nil {
-		if err == ErrDependencyNotMet || err == ErrPortConflict {
-			c.JSON(http.StatusConflict, ErrorResponse(err))
-		} else {
-			c.JSON(http.StatusInternalServerError, ErrorResponse(err))
-		}
+		writeError(c, err)
 		return
 	}
 	
@@ -387,20 +397,20 @@ func (s *APIService) InstallApplication(c *gin.Context) {
 func (s *APIService) UpdateInstance(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid instance id")))
+		respondError(c, http.StatusBadRequest, "invalid instance id")
 		return
 	}
 	
 	var instance ApplicationInstance
 	if err := c.ShouldBindJSON(&instance); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
 	instance.ID = uint(id)
 	
 	if err := s.appStoreService.UpdateInstance(c.Request.Context(), &instance); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -420,7 +430,7 @@ func (s *APIService) UpdateInstance(c *gin.Context) {
 func (s *APIService) UninstallApplication(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid instance id")))
+		respondError(c, http.StatusBadRequest, "invalid instance id")
 		return
 	}
 	
@@ -432,7 +442,7 @@ func (s *APIService) UninstallApplication(c *gin.Context) {
 	}
 	
 	if err := s.installerService.Uninstall(c.Request.Context(), req); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -451,13 +461,13 @@ func (s *APIService) UninstallApplication(c *gin.Context) {
 func (s *APIService) GetInstanceStatus(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid instance id")))
+		respondError(c, http.StatusBadRequest, "invalid instance id")
 		return
 	}
 	
 	instance, err := s.appStoreService.GetInstance(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -484,13 +494,13 @@ func (s *APIService) CheckDependencies(c *gin.Context) {
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
 	checks, err := s.installerService.CheckDependencies(c.Request.Context(), req.TemplateID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -513,13 +523,13 @@ func (s *APIService) DetectConflicts(c *gin.Context) {
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		writeError(c, invalidRequest(err))
 		return
 	}
 	
 	conflicts, err := s.installerService.DetectConflicts(c.Request.Context(), req.TemplateID, req.Parameters)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -540,7 +550,7 @@ func (s *APIService) GetInstallProgress(c *gin.Context) {
 	
 	progress, err := s.installerService.GetProgress(c.Request.Context(), progressID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -559,12 +569,12 @@ func (s *APIService) GetInstallProgress(c *gin.Context) {
 func (s *APIService) RollbackInstallation(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("invalid instance id")))
+		respondError(c, http.StatusBadRequest, "invalid instance id")
 		return
 	}
 	
 	if err := s.installerService.Rollback(c.Request.Context(), uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -588,7 +598,7 @@ func (s *APIService) SearchTemplates(c *gin.Context) {
 	// 获取所有模板
 	templates, err := s.appStoreService.ListTemplates(c.Request.Context(), category, TemplateStatusPublished)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -634,7 +644,7 @@ func (s *APIService) GetRecommendations(c *gin.Context) {
 	// 调用推荐服务获取推荐列表，限制返回 10 条结果
 	recommendations, err := s.recommendationService.GetRecommendations(c.Request.Context(), userContext, 10)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -651,7 +661,7 @@ func (s *APIService) GetRecommendations(c *gin.Context) {
 // @Router /appstore/init [post]
 func (s *APIService) InitBuiltinTemplates(c *gin.Context) {
 	if err := s.appStoreService.InitBuiltinTemplates(c.Request.Context()); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
+		writeError(c, err)
 		return
 	}
 	
@@ -660,7 +670,51 @@ func (s *APIService) InitBuiltinTemplates(c *gin.Context) {
 	}))
 }
 
-// Response 统一响应结构
+// ListSources 列出模板源
+// @Summary 列出模板源
+// @Description 获取已配置的远程 Git 模板源
+// @Tags sources
+// @Produce json
+// @Success 200 {object} Response{data=[]TemplateSource}
+// @Router /appstore/sources [get]
+func (s *APIService) ListSources(c *gin.Context) {
+	sources := []TemplateSource{}
+	if s.syncService != nil {
+		for _, source := range s.syncService.Sources() {
+			source.DeployKey = "" // 不暴露密钥路径
+			sources = append(sources, source)
+		}
+	}
+	
+	c.JSON(http.StatusOK, SuccessResponse(sources))
+}
+
+// SyncSource 同步模板源
+// @Summary 同步模板源
+// @Description 拉取远程 Git 仓库并更新模板，force=true 时覆盖本地修改
+// @Tags sources
+// @Produce json
+// @Param id path string true "模板源ID"
+// @Param force query bool false "覆盖本地修改过的模板"
+// @Success 200 {object} Response{data=SyncResult}
+// @Router /appstore/sources/{id}/sync [post]
+func (s *APIService) SyncSource(c *gin.Context) {
+	if s.syncService == nil {
+		writeError(c, ErrSourceNotFound)
+		return
+	}
+	
+	force, _ := strconv.ParseBool(c.Query("force"))
+	result, err := s.syncService.Sync(c.Request.Context(), c.Param("id"), force)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	
+	c.JSON(http.StatusOK, SuccessResponse(result))
+}
+
+// Response 成功响应结构，错误响应使用 apierror.Envelope
 type Response struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
@@ -676,14 +730,6 @@ func SuccessResponse(data interface{}) Response {
 	}
 }
 
-// ErrorResponse 错误响应
-func ErrorResponse(err error) Response {
-	return Response{
-		Code:    1,
-		Message: err.Error(),
-	}
-}
-
 // contains 检查字符串是否包含子串（不区分大小写）
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && 
@@ -0,0 +1,81 @@
+package appstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"qwq/internal/apierror"
+	"qwq/internal/pagination"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIService_ListInstances(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupSimpleTestDB(t)
+	template := createSimpleTestTemplate(t, db)
+	store := NewAppStoreService(db)
+	for i := 1; i <= 5; i++ {
+		status := "running"
+		if i%2 == 0 {
+			status = "stopped"
+		}
+		instance := &ApplicationInstance{Name: fmt.Sprintf("app-%d", i), TemplateID: template.ID, Version: "1.0.0", Status: status, UserID: 1, TenantID: 1}
+		if err := store.CreateInstance(context.Background(), instance); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := &APIService{appStoreService: store}
+	router := gin.New()
+	router.GET("/appstore/instances", service.ListInstances)
+	get := func(path string) (*httptest.ResponseRecorder, pagination.Page[*ApplicationInstance]) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Data pagination.Page[*ApplicationInstance] `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec, body.Data
+	}
+
+	rec, page := get("/appstore/instances")
+	if rec.Code != http.StatusOK || page.Total != 5 || len(page.Items) != 5 || page.Page != 1 || page.PageSize != pagination.DefaultPageSize {
+		t.Fatalf("Expected the first page with the default size, got %d %+v", rec.Code, page)
+	}
+	if page.Items[0].Name != "app-5" || page.Items[0].Template == nil {
+		t.Errorf("Expected the newest instance first with its template, got %+v", page.Items[0])
+	}
+
+	if _, page = get("/appstore/instances?page=2&pageSize=2&sort=name"); len(page.Items) != 2 || page.Items[0].Name != "app-3" {
+		t.Errorf("Unexpected second page %+v", page)
+	}
+	if _, page = get("/appstore/instances?page=3&pageSize=2&sort=name"); len(page.Items) != 1 || page.Items[0].Name != "app-5" {
+		t.Errorf("Expected the last partial page, got %+v", page)
+	}
+	if _, page = get("/appstore/instances?page=4&pageSize=2"); page.Total != 5 || len(page.Items) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v", page)
+	}
+	if _, page = get("/appstore/instances?status=stopped"); page.Total != 2 {
+		t.Errorf("Expected 2 stopped instances, got %+v", page)
+	}
+
+	for path, code := range map[string]string{
+		"/appstore/instances?pageSize=0":    pagination.CodeInvalidPagination,
+		"/appstore/instances?sort=-config":  pagination.CodeInvalidSort,
+		"/appstore/instances?page=first":    pagination.CodeInvalidPagination,
+		"/appstore/instances?sort=password": pagination.CodeInvalidSort,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var envelope apierror.Envelope
+		json.Unmarshal(rec.Body.Bytes(), &envelope)
+		if rec.Code != http.StatusBadRequest || envelope.Code != code {
+			t.Errorf("%s: expected %s, got %d %+v", path, code, rec.Code, envelope)
+		}
+	}
+}
@@ -4,21 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
+	"qwq/internal/portaudit"
+
 	"gopkg.in/yaml.v3"
 )
 
 // ConflictChecker 冲突检测器
 type ConflictChecker struct {
 	appStoreService AppStoreService
+	ports           *portaudit.Checker // 端口检查与 Compose 项目部署共用，同时检查主机上监听的端口
 }
 
 // NewConflictChecker 创建冲突检测器实例
 func NewConflictChecker(appStoreService AppStoreService) *ConflictChecker {
 	return &ConflictChecker{
 		appStoreService: appStoreService,
+		ports:           portaudit.Default,
 	}
 }
 
@@ -41,7 +46,7 @@ func (c *ConflictChecker) DetectConflicts(ctx context.Context, templateID uint,
 	// 根据模板类型检测不同的冲突
 	switch template.Type {
 	case TemplateTypeDockerCompose:
-		composeConflicts, err := c.detectDockerComposeConflicts(ctx, rendered)
+		composeConflicts, err := c.detectDockerComposeConflicts(ctx, rendered, params)
 		if err != nil {
 			return nil, fmt.Errorf("failed to detect docker-compose conflicts: %w", err)
 		}
@@ -59,7 +64,9 @@ func (c *ConflictChecker) DetectConflicts(ctx context.Context, templateID uint,
 }
 
 // detectDockerComposeConflicts 检测 Docker Compose 冲突
-func (c *ConflictChecker) detectDockerComposeConflicts(ctx context.Context, rendered string) ([]ConflictInfo, error) {
+// 端口冲突交给 portaudit 检查，与其他应用实例、Compose 项目和主机上监听的端口比较；
+// 冲突端口来自某个安装参数时给出可以直接使用的下一个可用端口
+func (c *ConflictChecker) detectDockerComposeConflicts(ctx context.Context, rendered string, params map[string]interface{}) ([]ConflictInfo, error) {
 	// 解析 Docker Compose 文件
 	var compose map[string]interface{}
 	if err := yaml.Unmarshal([]byte(rendered), &compose); err != nil {
@@ -69,78 +76,172 @@ func (c *ConflictChecker) detectDockerComposeConflicts(ctx context.Context, rend
 	var conflicts []ConflictInfo
 
 	// 获取所有已安装的实例
-	instances, err := c.appStoreService.ListInstances(ctx, 0, 0)
+	instances, err := c.activeInstances(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list instances: %w", err)
+		return nil, err
 	}
 
-	// 提取当前模板使用的端口
-	currentPorts := c.extractPortsFromCompose(compose)
+	// 检查端口冲突
+	bindings, _ := portaudit.ParseServices(composePorts(compose))
+	report := c.ports.Audit(ctx, bindings, portaudit.Options{Claims: instancePortClaims(instances)})
+	for _, conflict := range report.Conflicts {
+		info := ConflictInfo{
+			Type:        "port",
+			Resource:    strconv.Itoa(conflict.Port),
+			ExistingApp: conflict.Owner,
+			OwnerKind:   conflict.OwnerKind,
+			Resolvable:  true,
+			Suggestions: []string{
+				"Change port mapping to use a different host port",
+			},
+		}
+		if conflict.OwnerKind == portaudit.KindApp {
+			info.Suggestions = append(info.Suggestions, fmt.Sprintf("Stop the conflicting application: %s", conflict.Owner))
+		}
+		if conflict.SuggestedPort > 0 {
+			if info.Parameter = portParameter(params, conflict.Port); info.Parameter != "" {
+				info.SuggestedPort = conflict.SuggestedPort
+				info.Suggestions = append([]string{fmt.Sprintf("Set %s to %d", info.Parameter, conflict.SuggestedPort)}, info.Suggestions...)
+			}
+		}
+		conflicts = append(conflicts, info)
+	}
 
-	// 提取当前模板使用的数据卷
+	// 检查数据卷冲突
 	currentVolumes := c.extractVolumesFromCompose(compose)
-
-	// 检查端口冲突
 	for _, instance := range instances {
-		if instance.Status == "running" || instance.Status == "installing" {
-			// 获取实例的配置
-			var instanceConfig map[string]interface{}
-			if err := json.Unmarshal([]byte(instance.Config), &instanceConfig); err != nil {
-				continue
+		instanceVolumes := c.extractVolumesFromCompose(instance.compose)
+		for _, volume := range currentVolumes {
+			for _, existingVolume := range instanceVolumes {
+				if volume == existingVolume {
+					conflicts = append(conflicts, ConflictInfo{
+						Type:        "volume",
+						Resource:    volume,
+						ExistingApp: instance.Name,
+						Resolvable:  true,
+						Suggestions: []string{
+							fmt.Sprintf("Use a different volume name or path"),
+							fmt.Sprintf("Share the volume with application: %s", instance.Name),
+						},
+					})
+				}
 			}
+		}
+	}
 
-			// 渲染实例的模板以获取其使用的资源
-			instanceRendered, err := c.appStoreService.RenderTemplate(ctx, instance.TemplateID, instanceConfig)
-			if err != nil {
-				continue
-			}
+	return conflicts, nil
+}
 
-			var instanceCompose map[string]interface{}
-			if err := yaml.Unmarshal([]byte(instanceRendered), &instanceCompose); err != nil {
-				continue
-			}
+// renderedInstance 运行中或安装中的实例及其渲染后的 Compose 配置
+type renderedInstance struct {
+	*ApplicationInstance
+	compose map[string]interface{}
+}
 
-			// 检查端口冲突
-			instancePorts := c.extractPortsFromCompose(instanceCompose)
-			for _, port := range currentPorts {
-				for _, existingPort := range instancePorts {
-					if port == existingPort {
-						conflicts = append(conflicts, ConflictInfo{
-							Type:        "port",
-							Resource:    port,
-							ExistingApp: instance.Name,
-							Resolvable:  true,
-							Suggestions: []string{
-								fmt.Sprintf("Change port mapping to use a different host port"),
-								fmt.Sprintf("Stop the conflicting application: %s", instance.Name),
-							},
-						})
-					}
-				}
-			}
+// activeInstances 渲染所有运行中和安装中的实例，配置无法渲染的实例跳过
+func (c *ConflictChecker) activeInstances(ctx context.Context) ([]renderedInstance, error) {
+	instances, err := c.appStoreService.ListInstances(ctx, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
 
-			// 检查数据卷冲突
-			instanceVolumes := c.extractVolumesFromCompose(instanceCompose)
-			for _, volume := range currentVolumes {
-				for _, existingVolume := range instanceVolumes {
-					if volume == existingVolume {
-						conflicts = append(conflicts, ConflictInfo{
-							Type:        "volume",
-							Resource:    volume,
-							ExistingApp: instance.Name,
-							Resolvable:  true,
-							Suggestions: []string{
-								fmt.Sprintf("Use a different volume name or path"),
-								fmt.Sprintf("Share the volume with application: %s", instance.Name),
-							},
-						})
-					}
-				}
-			}
+	var result []renderedInstance
+	for _, instance := range instances {
+		if instance.Status != "running" && instance.Status != "installing" {
+			continue
+		}
+		// 获取实例的配置
+		var instanceConfig map[string]interface{}
+		if err := json.Unmarshal([]byte(instance.Config), &instanceConfig); err != nil {
+			continue
+		}
+
+		// 渲染实例的模板以获取其使用的资源
+		instanceRendered, err := c.appStoreService.RenderTemplate(ctx, instance.TemplateID, instanceConfig)
+		if err != nil {
+			continue
 		}
+
+		var instanceCompose map[string]interface{}
+		if err := yaml.Unmarshal([]byte(instanceRendered), &instanceCompose); err != nil {
+			continue
+		}
+		result = append(result, renderedInstance{ApplicationInstance: instance, compose: instanceCompose})
 	}
+	return result, nil
+}
 
-	return conflicts, nil
+// instancePortClaims 实例发布的主机端口
+func instancePortClaims(instances []renderedInstance) []portaudit.Claim {
+	var claims []portaudit.Claim
+	for _, instance := range instances {
+		bindings, _ := portaudit.ParseServices(composePorts(instance.compose))
+		for _, b := range bindings {
+			claims = append(claims, portaudit.Claim{
+				Kind:   portaudit.KindApp,
+				Owner:  instance.Name,
+				HostIP: b.HostIP,
+				Port:   b.Port,
+				Proto:  b.Proto,
+			})
+		}
+	}
+	return claims
+}
+
+// InstancePortSource 应用实例发布的端口，注册到 portaudit 后 Compose 项目部署前也会检查
+func InstancePortSource(appStoreService AppStoreService) portaudit.Source {
+	checker := NewConflictChecker(appStoreService)
+	return func(ctx context.Context) ([]portaudit.Claim, error) {
+		instances, err := checker.activeInstances(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return instancePortClaims(instances), nil
+	}
+}
+
+// composePorts 按服务取出 Compose 配置中的端口定义
+func composePorts(compose map[string]interface{}) map[string][]interface{} {
+	ports := make(map[string][]interface{})
+	services, ok := compose["services"].(map[string]interface{})
+	if !ok {
+		return ports
+	}
+	for name, serviceConfig := range services {
+		serviceMap, ok := serviceConfig.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if list, ok := serviceMap["ports"].([]interface{}); ok {
+			ports[name] = list
+		}
+	}
+	return ports
+}
+
+// portParameter 取值等于冲突端口的安装参数，可以直接改为建议的端口；多个参数相同时按名称取第一个
+func portParameter(params map[string]interface{}, port int) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var value int
+		switch v := params[name].(type) {
+		case int:
+			value = v
+		case float64:
+			value = int(v)
+		case string:
+			value, _ = strconv.Atoi(v)
+		}
+		if value == port {
+			return name
+		}
+	}
+	return ""
 }
 
 // detectHelmChartConflicts 检测 Helm Chart 冲突
@@ -163,38 +264,6 @@ func (c *ConflictChecker) detectHelmChartConflicts(ctx context.Context, rendered
 	return conflicts, nil
 }
 
-// extractPortsFromCompose 从 Docker Compose 配置中提取端口
-func (c *ConflictChecker) extractPortsFromCompose(compose map[string]interface{}) []string {
-	var ports []string
-
-	services, ok := compose["services"].(map[string]interface{})
-	if !ok {
-		return ports
-	}
-
-	for _, serviceConfig := range services {
-		serviceMap, ok := serviceConfig.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// 检查 ports 字段
-		if portsField, exists := serviceMap["ports"]; exists {
-			switch v := portsField.(type) {
-			case []interface{}:
-				for _, port := range v {
-					portStr := c.normalizePort(port)
-					if portStr != "" {
-						ports = append(ports, portStr)
-					}
-				}
-			}
-		}
-	}
-
-	return ports
-}
-
 // extractVolumesFromCompose 从 Docker Compose 配置中提取数据卷
 func (c *ConflictChecker) extractVolumesFromCompose(compose map[string]interface{}) []string {
 	var volumes []string
@@ -227,23 +296,6 @@ func (c *ConflictChecker) extractVolumesFromCompose(compose map[string]interface
 	return volumes
 }
 
-// normalizePort 规范化端口表示
-func (c *ConflictChecker) normalizePort(port interface{}) string {
-	switch v := port.(type) {
-	case string:
-		// 格式可能是 "8080:80" 或 "8080"
-		parts := strings.Split(v, ":")
-		if len(parts) > 0 {
-			return parts[0] // 返回主机端口
-		}
-	case int:
-		return strconv.Itoa(v)
-	case float64:
-		return strconv.Itoa(int(v))
-	}
-	return ""
-}
-
 // normalizeVolume 规范化数据卷表示
 func (c *ConflictChecker) normalizeVolume(volume interface{}) string {
 	switch v := volume.(type) {
@@ -299,40 +351,17 @@ func (c *ConflictChecker) resolveServiceConflict(ctx context.Context, conflict C
 	return nil
 }
 
-// FindAvailablePort 查找可用端口
+// FindAvailablePort 查找可用端口，跳过其他应用实例发布的端口
 func (c *ConflictChecker) FindAvailablePort(ctx context.Context, startPort int) (int, error) {
 	// 获取所有已使用的端口
 	usedPorts := make(map[int]bool)
 
-	instances, err := c.appStoreService.ListInstances(ctx, 0, 0)
+	instances, err := c.activeInstances(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to list instances: %w", err)
+		return 0, err
 	}
-
-	for _, instance := range instances {
-		if instance.Status == "running" || instance.Status == "installing" {
-			var instanceConfig map[string]interface{}
-			if err := json.Unmarshal([]byte(instance.Config), &instanceConfig); err != nil {
-				continue
-			}
-
-			instanceRendered, err := c.appStoreService.RenderTemplate(ctx, instance.TemplateID, instanceConfig)
-			if err != nil {
-				continue
-			}
-
-			var instanceCompose map[string]interface{}
-			if err := yaml.Unmarshal([]byte(instanceRendered), &instanceCompose); err != nil {
-				continue
-			}
-
-			ports := c.extractPortsFromCompose(instanceCompose)
-			for _, portStr := range ports {
-				if port, err := strconv.Atoi(portStr); err == nil {
-					usedPorts[port] = true
-				}
-			}
-		}
+	for _, claim := range instancePortClaims(instances) {
+		usedPorts[claim.Port] = true
 	}
 
 	// 从 startPort 开始查找可用端口
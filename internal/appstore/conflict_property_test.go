@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"testing"
 
+	"qwq/internal/pagination"
+
 	"github.com/leanovate/gopter"
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
@@ -68,6 +70,10 @@ func (m *mockAppStoreService) ListInstances(ctx context.Context, userID, tenantI
 	return m.instances, nil
 }
 
+func (m *mockAppStoreService) QueryInstances(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*ApplicationInstance], error) {
+	return &pagination.Page[*ApplicationInstance]{Items: m.instances, Total: int64(len(m.instances)), Page: q.Page, PageSize: q.PageSize}, nil
+}
+
 func (m *mockAppStoreService) CreateInstance(ctx context.Context, instance *ApplicationInstance) error {
 	instance.ID = uint(len(m.instances) + 1)
 	m.instances = append(m.instances, instance)
@@ -0,0 +1,46 @@
+package appstore
+
+import (
+	"net/http"
+
+	"qwq/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorMappings 应用商店错误到 API 错误码的映射，网站管理接口部署模板后端时复用
+var ErrorMappings = []apierror.Mapping{
+	{Err: ErrTemplateNotFound, Status: http.StatusNotFound, Code: "TEMPLATE_NOT_FOUND"},
+	{Err: ErrTemplateAlreadyExists, Status: http.StatusConflict, Code: "TEMPLATE_ALREADY_EXISTS"},
+	{Err: ErrInstanceNotFound, Status: http.StatusNotFound, Code: "INSTANCE_NOT_FOUND"},
+	{Err: ErrProgressNotFound, Status: http.StatusNotFound, Code: "INSTALL_PROGRESS_NOT_FOUND"},
+	{Err: ErrInstallationInProgress, Status: http.StatusConflict, Code: "INSTALLATION_IN_PROGRESS"},
+	{Err: ErrDependencyNotMet, Status: http.StatusConflict, Code: "DEPENDENCY_NOT_MET"},
+	{Err: ErrPortConflict, Status: http.StatusConflict, Code: "PORT_CONFLICT"},
+	{Err: ErrVolumeConflict, Status: http.StatusConflict, Code: "VOLUME_CONFLICT"},
+	{Err: ErrResourceInsufficient, Status: http.StatusConflict, Code: "RESOURCE_INSUFFICIENT"},
+	{Err: ErrSourceNotFound, Status: http.StatusNotFound, Code: "SOURCE_NOT_FOUND"},
+	{Err: ErrInvalidSource, Status: http.StatusBadRequest, Code: "INVALID_SOURCE"},
+	{Err: ErrInvalidTemplateType, Status: http.StatusBadRequest, Code: "INVALID_TEMPLATE_TYPE"},
+	{Err: ErrInvalidTemplateContent, Status: http.StatusBadRequest, Code: "INVALID_TEMPLATE_CONTENT"},
+	{Err: ErrMissingRequiredParameter, Status: http.StatusBadRequest, Code: "MISSING_REQUIRED_PARAMETER"},
+	{Err: ErrInvalidParameterValue, Status: http.StatusBadRequest, Code: "INVALID_PARAMETER_VALUE"},
+	{Err: ErrParameterValidationFailed, Status: http.StatusBadRequest, Code: "PARAMETER_VALIDATION_FAILED"},
+}
+
+// writeError 按映射表返回统一的错误响应，未知错误只返回请求 ID
+func writeError(c *gin.Context, err error) {
+	apierror.Write(c.Writer, c.Request, err, ErrorMappings...)
+	c.Abort()
+}
+
+// respondError 返回指定状态码的错误响应
+func respondError(c *gin.Context, status int, message string) {
+	apierror.Respond(c.Writer, c.Request, status, message)
+	c.Abort()
+}
+
+// invalidRequest 请求体绑定或校验失败，错误信息原样返回给客户端
+func invalidRequest(err error) error {
+	return apierror.Wrap(http.StatusBadRequest, apierror.CodeValidation, err)
+}
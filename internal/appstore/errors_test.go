@@ -0,0 +1,62 @@
+package appstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"qwq/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubAppStoreService 返回固定错误的应用商店服务
+type stubAppStoreService struct {
+	AppStoreService
+	err error
+}
+
+func (s *stubAppStoreService) GetTemplate(ctx context.Context, id uint) (*AppTemplate, error) {
+	return nil, s.err
+}
+
+func TestAPIService_ErrorEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &stubAppStoreService{}
+	service := &APIService{appStoreService: store}
+	router := gin.New()
+	router.GET("/appstore/templates/:id", service.GetTemplate)
+	router.POST("/appstore/sources/:id/sync", service.SyncSource)
+
+	get := func(path string) (*httptest.ResponseRecorder, apierror.Envelope) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var envelope apierror.Envelope
+		json.NewDecoder(rec.Body).Decode(&envelope)
+		return rec, envelope
+	}
+
+	store.err = ErrTemplateNotFound
+	if rec, envelope := get("/appstore/templates/7"); rec.Code != http.StatusNotFound || envelope.Code != "TEMPLATE_NOT_FOUND" || envelope.RequestID == "" {
+		t.Errorf("Expected TEMPLATE_NOT_FOUND, got %d %+v", rec.Code, envelope)
+	}
+	if rec, envelope := get("/appstore/templates/abc"); rec.Code != http.StatusBadRequest || envelope.Code != apierror.CodeBadRequest {
+		t.Errorf("Expected BAD_REQUEST for an invalid id, got %d %+v", rec.Code, envelope)
+	}
+	store.err = errors.New("sql: database is closed")
+	if rec, envelope := get("/appstore/templates/7"); rec.Code != http.StatusInternalServerError || envelope.Code != apierror.CodeInternal || strings.Contains(envelope.Message, "sql") {
+		t.Errorf("Expected INTERNAL without details, got %d %+v", rec.Code, envelope)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/appstore/sources/official/sync", nil))
+	var envelope apierror.Envelope
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	if rec.Code != http.StatusNotFound || envelope.Code != "SOURCE_NOT_FOUND" {
+		t.Errorf("Expected SOURCE_NOT_FOUND, got %d %+v", rec.Code, envelope)
+	}
+}
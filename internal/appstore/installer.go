@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"qwq/internal/health"
 )
 
 var (
@@ -22,6 +24,8 @@ var (
 	ErrVolumeConflict = errors.New("volume conflict detected")
 	// ErrResourceInsufficient 资源不足
 	ErrResourceInsufficient = errors.New("insufficient resources")
+	// ErrProgressNotFound 安装进度不存在或已过期
+	ErrProgressNotFound = errors.New("progress not found")
 )
 
 // InstallationStatus 安装状态
@@ -61,11 +65,14 @@ type RollbackInfo struct {
 
 // ConflictInfo 冲突信息
 type ConflictInfo struct {
-	Type        string   `json:"type"`         // port, volume, service
-	Resource    string   `json:"resource"`     // 冲突的资源
-	ExistingApp string   `json:"existing_app"` // 已存在的应用
-	Resolvable  bool     `json:"resolvable"`   // 是否可自动解决
-	Suggestions []string `json:"suggestions"`  // 解决建议
+	Type          string   `json:"type"`                     // port, volume, service
+	Resource      string   `json:"resource"`                 // 冲突的资源
+	ExistingApp   string   `json:"existing_app"`             // 已存在的应用，端口被其他进程占用时为进程或容器
+	OwnerKind     string   `json:"owner_kind,omitempty"`     // 端口占用者类型：app、project、container、process、service
+	Resolvable    bool     `json:"resolvable"`               // 是否可自动解决
+	Suggestions   []string `json:"suggestions"`              // 解决建议
+	Parameter     string   `json:"parameter,omitempty"`      // 可自动修改的安装参数
+	SuggestedPort int      `json:"suggested_port,omitempty"` // 建议改用的端口
 }
 
 // DependencyCheck 依赖检查结果
@@ -195,6 +202,20 @@ func (s *installerServiceImpl) Install(ctx context.Context, req *InstallRequest)
 		}, ErrPortConflict
 	}
 
+	// 端口冲突在创建实例之前失败；启用 auto_resolve 时把冲突的端口参数改为建议端口后重新检测
+	if hasPortConflict(conflicts) && req.AutoResolve && applySuggestedPorts(req.Parameters, conflicts) {
+		if conflicts, err = s.DetectConflicts(ctx, req.TemplateID, req.Parameters); err != nil {
+			return nil, fmt.Errorf("failed to detect conflicts: %w", err)
+		}
+	}
+	if hasPortConflict(conflicts) {
+		return &InstallResult{
+			Status:    StatusFailed,
+			Message:   "host port conflicts detected, change the port parameters or enable auto_resolve",
+			Conflicts: conflicts,
+		}, ErrPortConflict
+	}
+
 	// 创建应用实例
 	instance := &ApplicationInstance{
 		Name:       req.InstanceName,
@@ -233,6 +254,31 @@ func (s *installerServiceImpl) Install(ctx context.Context, req *InstallRequest)
 	}, nil
 }
 
+// hasPortConflict 是否存在端口冲突
+func hasPortConflict(conflicts []ConflictInfo) bool {
+	for _, conflict := range conflicts {
+		if conflict.Type == "port" {
+			return true
+		}
+	}
+	return false
+}
+
+// applySuggestedPorts 将所有端口冲突对应的参数改为建议端口，有冲突无法自动修改时不做任何修改并返回 false
+func applySuggestedPorts(params map[string]interface{}, conflicts []ConflictInfo) bool {
+	for _, conflict := range conflicts {
+		if conflict.Type == "port" && (conflict.Parameter == "" || conflict.SuggestedPort == 0) {
+			return false
+		}
+	}
+	for _, conflict := range conflicts {
+		if conflict.Type == "port" {
+			params[conflict.Parameter] = conflict.SuggestedPort
+		}
+	}
+	return true
+}
+
 // executeInstallation 执行安装过程
 func (s *installerServiceImpl) executeInstallation(ctx context.Context, instance *ApplicationInstance, template *AppTemplate, params map[string]interface{}, progress *InstallationProgress) {
 	// 更新进度：验证中
@@ -267,14 +313,15 @@ func (s *installerServiceImpl) executeInstallation(ctx context.Context, instance
 	// 更新进度：验证部署
 	s.progressStore.Update(progress.ID, StatusInstalling, "Verifying deployment", 4, 5)
 
-	// 验证部署是否成功
-	if err := s.verifyDeployment(ctx, instance); err != nil {
+	// 验证部署是否成功，模板声明了探针时逐个执行
+	if err := s.verifyDeployment(ctx, instance, template, rendered); err != nil {
 		s.handleInstallationError(ctx, instance, progress, "deployment verification", err)
 		return
 	}
 
 	// 更新进度：完成
 	s.progressStore.Update(progress.ID, StatusCompleted, "Installation completed successfully", 5, 5)
+	health.DefaultDeployments.Record(time.Now(), true)
 
 	// 更新实例状态
 	instance.Status = "running"
@@ -289,6 +336,7 @@ func (s *installerServiceImpl) handleInstallationError(ctx context.Context, inst
 	// 更新进度为失败
 	s.progressStore.Update(progress.ID, StatusFailed, fmt.Sprintf("Failed at step: %s", step), progress.CompletedSteps, progress.TotalSteps)
 	s.progressStore.SetError(progress.ID, err.Error())
+	health.DefaultDeployments.Record(time.Now(), false) // 计入健康评分的部署失败率
 
 	// 更新实例状态
 	instance.Status = "error"
@@ -315,15 +363,34 @@ func (s *installerServiceImpl) deployApplication(ctx context.Context, instance *
 	return nil
 }
 
-// verifyDeployment 验证部署
-func (s *installerServiceImpl) verifyDeployment(ctx context.Context, instance *ApplicationInstance) error {
-	// 这里应该检查应用是否正常运行
-	// 例如：检查容器状态、健康检查等
-	
-	// 模拟验证延迟
-	time.Sleep(50 * time.Millisecond)
-	
-	return nil
+// verifyDeployment 验证部署：执行模板声明的安装后验证探针，未注入探针执行器时跳过
+func (s *installerServiceImpl) verifyDeployment(ctx context.Context, instance *ApplicationInstance, template *AppTemplate, rendered string) error {
+	probes, err := ParseTemplateProbes(template.Probes)
+	if err != nil {
+		return err
+	}
+	probeRunnerMu.RLock()
+	runner := probeRunner
+	probeRunnerMu.RUnlock()
+	if len(probes) == 0 || runner == nil {
+		return nil
+	}
+	return runner(ctx, instance.Name, rendered, probes)
+}
+
+// ProbeRunner 对已部署的应用执行探针，projectName 为实例名（即 Compose 项目名），content 为渲染后的模板内容
+type ProbeRunner func(ctx context.Context, projectName, content string, probes []TemplateProbe) error
+
+var (
+	probeRunner   ProbeRunner
+	probeRunnerMu sync.RWMutex
+)
+
+// SetProbeRunner 设置安装后验证探针的执行器，由容器模块在启动时注入，传 nil 时不执行探针
+func SetProbeRunner(runner ProbeRunner) {
+	probeRunnerMu.Lock()
+	probeRunner = runner
+	probeRunnerMu.Unlock()
 }
 
 // performRollback 执行回滚
@@ -400,7 +467,7 @@ func (s *installerServiceImpl) DetectConflicts(ctx context.Context, templateID u
 func (s *installerServiceImpl) GetProgress(ctx context.Context, progressID string) (*InstallationProgress, error) {
 	progress := s.progressStore.Get(progressID)
 	if progress == nil {
-		return nil, errors.New("progress not found")
+		return nil, ErrProgressNotFound
 	}
 	return progress, nil
 }
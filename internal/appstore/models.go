@@ -18,9 +18,10 @@ const (
 type TemplateStatus string
 
 const (
-	TemplateStatusDraft     TemplateStatus = "draft"     // 草稿
-	TemplateStatusPublished TemplateStatus = "published" // 已发布
-	TemplateStatusArchived  TemplateStatus = "archived"  // 已归档
+	TemplateStatusDraft      TemplateStatus = "draft"      // 草稿
+	TemplateStatusPublished  TemplateStatus = "published"  // 已发布
+	TemplateStatusArchived   TemplateStatus = "archived"   // 已归档
+	TemplateStatusDeprecated TemplateStatus = "deprecated" // 已废弃（上游已移除但仍有实例）
 )
 
 // AppCategory 应用分类
@@ -65,6 +66,10 @@ type AppTemplate struct {
 	Parameters  string         `json:"parameters" gorm:"type:text"`               // 参数定义（JSON）
 	Dependencies string        `json:"dependencies" gorm:"type:text"`             // 依赖项（JSON）
 	MinResources string        `json:"min_resources" gorm:"type:text"`            // 最小资源要求（JSON）
+	Probes       string        `json:"probes,omitempty" gorm:"type:text"`         // 安装后的验证探针（JSON），见 TemplateProbe
+	SourceID     string        `json:"source_id,omitempty" gorm:"index"`          // 同步来源ID，本地创建的模板为空
+	SourceCommit string        `json:"source_commit,omitempty"`                   // 同步时的上游提交哈希
+	SyncedHash   string        `json:"-"`                                         // 同步时的内容摘要，用于识别本地修改
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -84,6 +89,25 @@ type TemplateParameter struct {
 	Group        string        `json:"group,omitempty"`         // 参数分组
 }
 
+// TemplateProbe 模板声明的安装后验证探针，字段与 Compose 部署配置的 probes 相同
+// 类型为 http（url、expect_status、expect_body）、tcp（address）或 exec（service、command、expect_exit_code），
+// url 和 address 中的主机名写服务名，安装时解析为容器地址
+type TemplateProbe struct {
+	Name           string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Type           string   `json:"type" yaml:"type"`
+	URL            string   `json:"url,omitempty" yaml:"url,omitempty"`
+	ExpectStatus   int      `json:"expect_status,omitempty" yaml:"expect_status,omitempty"`
+	ExpectBody     string   `json:"expect_body,omitempty" yaml:"expect_body,omitempty"`
+	Address        string   `json:"address,omitempty" yaml:"address,omitempty"`
+	Service        string   `json:"service,omitempty" yaml:"service,omitempty"`
+	Command        []string `json:"command,omitempty" yaml:"command,omitempty"`
+	ExpectExitCode int      `json:"expect_exit_code,omitempty" yaml:"expect_exit_code,omitempty"`
+	Delay          int      `json:"delay,omitempty" yaml:"delay,omitempty"`       // 第一次执行前等待的秒数
+	Retries        int      `json:"retries,omitempty" yaml:"retries,omitempty"`   // 总尝试次数，默认 1
+	Interval       int      `json:"interval,omitempty" yaml:"interval,omitempty"` // 重试间隔（秒），默认 5
+	Timeout        int      `json:"timeout,omitempty" yaml:"timeout,omitempty"`   // 每次尝试的超时（秒），默认 10
+}
+
 // TemplateDependency 模板依赖项
 type TemplateDependency struct {
 	Name        string `json:"name"`                  // 依赖名称
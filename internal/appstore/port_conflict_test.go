@@ -0,0 +1,74 @@
+package appstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"qwq/internal/portaudit"
+)
+
+// fakePorts 主机上只有 nginx 监听 9000 的端口检查器
+func fakePorts() *portaudit.Checker {
+	return &portaudit.Checker{
+		Sockets: func() ([]portaudit.Socket, error) {
+			return []portaudit.Socket{{Address: "0.0.0.0", Port: 9000, Proto: "tcp", Inode: 7}}, nil
+		},
+		Process: func(inode uint64) string { return "nginx[1]" },
+	}
+}
+
+func TestPortConflicts_SharedAudit(t *testing.T) {
+	db := setupSimpleTestDB(t)
+	appStoreService := NewAppStoreService(db)
+	installer := NewInstallerService(appStoreService).(*installerServiceImpl)
+	installer.conflictChecker.ports = fakePorts()
+	ctx := context.Background()
+
+	template := createSimpleTestTemplate(t, db)
+	configJSON, _ := json.Marshal(map[string]interface{}{"Version": "latest", "Port": 8080, "DataPath": "/data/nginx1"})
+	existing := &ApplicationInstance{Name: "existing-nginx", TemplateID: template.ID, Version: template.Version, Status: "running", Config: string(configJSON)}
+	if err := appStoreService.CreateInstance(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// 与其他实例冲突，端口来自 Port 参数，建议下一个可用端口
+	conflicts, err := installer.DetectConflicts(ctx, template.ID, map[string]interface{}{"Version": "latest", "Port": 8080, "DataPath": "/data/nginx2"})
+	if err != nil {
+		t.Fatalf("DetectConflicts failed: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Resource != "8080" || conflicts[0].OwnerKind != portaudit.KindApp || conflicts[0].ExistingApp != "existing-nginx" ||
+		conflicts[0].Parameter != "Port" || conflicts[0].SuggestedPort != 8081 {
+		t.Fatalf("Expected app conflict suggesting Port=8081, got %+v", conflicts)
+	}
+
+	// 与主机上监听的进程冲突
+	conflicts, err = installer.DetectConflicts(ctx, template.ID, map[string]interface{}{"Version": "latest", "Port": 9000, "DataPath": "/data/nginx2"})
+	if err != nil {
+		t.Fatalf("DetectConflicts failed: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].OwnerKind != portaudit.KindProcess || conflicts[0].ExistingApp != "nginx[1] (0.0.0.0:9000)" || conflicts[0].SuggestedPort != 9001 {
+		t.Fatalf("Expected process conflict suggesting 9001, got %+v", conflicts)
+	}
+
+	// 未启用 auto_resolve 时安装在创建实例之前失败
+	req := &InstallRequest{TemplateID: template.ID, InstanceName: "second-nginx", Parameters: map[string]interface{}{"Version": "latest", "Port": 8080, "DataPath": "/data/nginx2"}}
+	result, err := installer.Install(ctx, req)
+	if !errors.Is(err, ErrPortConflict) || result == nil || len(result.Conflicts) != 1 {
+		t.Fatalf("Expected ErrPortConflict with the report, got %v %+v", err, result)
+	}
+	if instances, _ := appStoreService.ListInstances(ctx, 0, 0); len(instances) != 1 {
+		t.Fatalf("Expected no instance to be created, got %d", len(instances))
+	}
+
+	// 启用后改用建议端口
+	req.AutoResolve = true
+	result, err = installer.Install(ctx, req)
+	if err != nil {
+		t.Fatalf("Expected auto_resolve to pick a free port, got %v", err)
+	}
+	if req.Parameters["Port"] != 8081 || len(result.Conflicts) != 0 {
+		t.Errorf("Expected Port to be changed to 8081, got %v with conflicts %+v", req.Parameters["Port"], result.Conflicts)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 
+	"qwq/internal/pagination"
+
 	"gorm.io/gorm"
 )
 
@@ -36,6 +38,7 @@ type AppStoreService interface {
 	CreateInstance(ctx context.Context, instance *ApplicationInstance) error
 	GetInstance(ctx context.Context, id uint) (*ApplicationInstance, error)
 	ListInstances(ctx context.Context, userID, tenantID uint) ([]*ApplicationInstance, error)
+	QueryInstances(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*ApplicationInstance], error)
 	UpdateInstance(ctx context.Context, instance *ApplicationInstance) error
 	DeleteInstance(ctx context.Context, id uint) error
 
@@ -251,6 +254,26 @@ func (s *appStoreServiceImpl) ListInstances(ctx context.Context, userID, tenantI
 	return instances, nil
 }
 
+// QueryInstances 分页列出应用实例
+func (s *appStoreServiceImpl) QueryInstances(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*ApplicationInstance], error) {
+	query := s.db.WithContext(ctx).Model(&ApplicationInstance{}).Preload("Template")
+
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if tenantID > 0 {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+
+	page, err := pagination.Find[*ApplicationInstance](query, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	return page, nil
+}
+
 // UpdateInstance 更新应用实例
 func (s *appStoreServiceImpl) UpdateInstance(ctx context.Context, instance *ApplicationInstance) error {
 	if instance == nil {
@@ -303,6 +326,20 @@ func (s *appStoreServiceImpl) InitBuiltinTemplates(ctx context.Context) error {
 	return nil
 }
 
+// ParseTemplateProbes 解析模板声明的安装后验证探针
+func ParseTemplateProbes(probesJSON string) ([]TemplateProbe, error) {
+	if probesJSON == "" {
+		return nil, nil
+	}
+
+	var probes []TemplateProbe
+	if err := json.Unmarshal([]byte(probesJSON), &probes); err != nil {
+		return nil, fmt.Errorf("failed to parse template probes: %w", err)
+	}
+
+	return probes, nil
+}
+
 // ParseTemplateParameters 解析模板参数定义
 func ParseTemplateParameters(parametersJSON string) ([]TemplateParameter, error) {
 	if parametersJSON == "" {
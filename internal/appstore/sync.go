@@ -0,0 +1,454 @@
+package appstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSourceNotFound 模板源未找到
+	ErrSourceNotFound = errors.New("template source not found")
+	// ErrInvalidSource 无效的模板源配置
+	ErrInvalidSource = errors.New("invalid template source")
+)
+
+// TemplatesDir 模板仓库中存放模板的目录
+//
+// 仓库目录结构：
+//
+//	templates/
+//	  <name>/
+//	    template.yaml       # 元数据与参数定义
+//	    docker-compose.yml  # type 为 docker-compose 时的模板内容
+//	    Chart.yaml          # type 为 helm-chart 时的模板内容
+const TemplatesDir = "templates"
+
+// ManifestFile 模板元数据文件名
+const ManifestFile = "template.yaml"
+
+// contentFiles 各模板类型对应的内容文件
+var contentFiles = map[TemplateType]string{
+	TemplateTypeDockerCompose: "docker-compose.yml",
+	TemplateTypeHelmChart:     "Chart.yaml",
+}
+
+var sourceIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// TemplateSource 远程 Git 模板源
+type TemplateSource struct {
+	ID        string `json:"id"`                   // 模板源ID
+	URL       string `json:"url"`                  // Git 仓库地址
+	Branch    string `json:"branch,omitempty"`     // 分支，为空时使用远程默认分支
+	DeployKey string `json:"deploy_key,omitempty"` // SSH 部署私钥文件路径
+}
+
+// SyncFailure 同步失败的模板及原因
+type SyncFailure struct {
+	Template string `json:"template"`
+	Reason   string `json:"reason"`
+}
+
+// SyncResult 模板源同步结果
+type SyncResult struct {
+	SourceID   string        `json:"source_id"`
+	Commit     string        `json:"commit"`
+	Added      []string      `json:"added"`
+	Updated    []string      `json:"updated"`
+	Unchanged  []string      `json:"unchanged"`
+	Deprecated []string      `json:"deprecated"` // 上游已移除但仍有实例，标记为废弃
+	Removed    []string      `json:"removed"`    // 上游已移除且无实例，已删除
+	Failed     []SyncFailure `json:"failed"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+// templateManifest template.yaml 文件结构
+type templateManifest struct {
+	Name         string                   `yaml:"name"`
+	DisplayName  string                   `yaml:"display_name"`
+	Description  string                   `yaml:"description"`
+	Category     AppCategory              `yaml:"category"`
+	Type         TemplateType             `yaml:"type"`
+	Icon         string                   `yaml:"icon"`
+	Author       string                   `yaml:"author"`
+	Tags         []string                 `yaml:"tags"`
+	Parameters   []map[string]interface{} `yaml:"parameters"`
+	Dependencies []map[string]interface{} `yaml:"dependencies"`
+	MinResources map[string]interface{}   `yaml:"min_resources"`
+	Probes       []TemplateProbe          `yaml:"probes"`
+}
+
+// SyncService 从远程 Git 仓库同步应用模板
+type SyncService struct {
+	db              *gorm.DB
+	templateService *TemplateService
+	sources         []TemplateSource
+	cacheDir        string
+	mu              sync.Mutex // 同一时间只执行一次同步
+}
+
+// NewSyncService 创建模板同步服务，cacheDir 为仓库克隆的本地缓存目录
+func NewSyncService(db *gorm.DB, sources []TemplateSource, cacheDir string) *SyncService {
+	return &SyncService{
+		db:              db,
+		templateService: NewTemplateService(),
+		sources:         sources,
+		cacheDir:        cacheDir,
+	}
+}
+
+// Sources 返回已配置的模板源
+func (s *SyncService) Sources() []TemplateSource {
+	return s.sources
+}
+
+// Sync 同步指定模板源
+// force 为 true 时覆盖本地修改过的模板和同名的本地模板
+func (s *SyncService) Sync(ctx context.Context, sourceID string, force bool) (*SyncResult, error) {
+	for _, source := range s.sources {
+		if source.ID == sourceID {
+			return s.syncSource(ctx, source, force)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSourceNotFound, sourceID)
+}
+
+// SyncAll 依次同步所有模板源，单个源失败不影响其他源
+func (s *SyncService) SyncAll(ctx context.Context, force bool) ([]*SyncResult, error) {
+	var results []*SyncResult
+	var errs []error
+	for _, source := range s.sources {
+		result, err := s.syncSource(ctx, source, force)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// syncSource 拉取仓库并将模板写入数据库
+func (s *SyncService) syncSource(ctx context.Context, source TemplateSource, force bool) (*SyncResult, error) {
+	if !sourceIDPattern.MatchString(source.ID) || source.URL == "" {
+		return nil, fmt.Errorf("%w: id %q, url %q", ErrInvalidSource, source.ID, source.URL)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &SyncResult{SourceID: source.ID, StartedAt: time.Now()}
+	dir, commit, err := s.checkout(ctx, source)
+	if err != nil {
+		logger.Info("❌ 模板源 %s 拉取失败: %v", source.ID, err)
+		return nil, fmt.Errorf("failed to fetch source '%s': %w", source.ID, err)
+	}
+	result.Commit = commit
+
+	templates, seen, failures := s.loadTemplates(dir, source, commit)
+	result.Failed = append(result.Failed, failures...)
+
+	for _, template := range templates {
+		if err := s.upsertTemplate(ctx, template, force, result); err != nil {
+			result.Failed = append(result.Failed, SyncFailure{Template: template.Name, Reason: err.Error()})
+		}
+	}
+
+	if err := s.retireRemoved(ctx, source.ID, seen, result); err != nil {
+		result.Failed = append(result.Failed, SyncFailure{Template: "*", Reason: err.Error()})
+	}
+
+	result.FinishedAt = time.Now()
+	logger.Info("📦 模板源 %s 同步完成 (%s): 新增 %d, 更新 %d, 未变化 %d, 废弃 %d, 删除 %d, 失败 %d",
+		source.ID, shortCommit(commit), len(result.Added), len(result.Updated), len(result.Unchanged),
+		len(result.Deprecated), len(result.Removed), len(result.Failed))
+	for _, failure := range result.Failed {
+		logger.Info("   ❌ %s: %s", failure.Template, failure.Reason)
+	}
+	return result, nil
+}
+
+// upsertTemplate 新增或更新单个模板
+func (s *SyncService) upsertTemplate(ctx context.Context, template *AppTemplate, force bool, result *SyncResult) error {
+	var existing AppTemplate
+	err := s.db.WithContext(ctx).Where("name = ?", template.Name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := s.db.WithContext(ctx).Create(template).Error; err != nil {
+			return fmt.Errorf("failed to create template: %w", err)
+		}
+		result.Added = append(result.Added, template.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check template existence: %w", err)
+	}
+
+	if !force {
+		if existing.SourceID != template.SourceID {
+			owner := "a local template"
+			if existing.SourceID != "" {
+				owner = fmt.Sprintf("source '%s'", existing.SourceID)
+			}
+			return fmt.Errorf("name is already used by %s; use --force to overwrite", owner)
+		}
+		if templateHash(&existing) != existing.SyncedHash {
+			return errors.New("template was modified locally; use --force to overwrite")
+		}
+	}
+
+	if existing.SourceID == template.SourceID && existing.SyncedHash == template.SyncedHash &&
+		templateHash(&existing) == existing.SyncedHash && existing.Status != TemplateStatusDeprecated {
+		result.Unchanged = append(result.Unchanged, template.Name)
+		return nil
+	}
+
+	template.ID = existing.ID
+	template.CreatedAt = existing.CreatedAt
+	if err := s.db.WithContext(ctx).Save(template).Error; err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	result.Updated = append(result.Updated, template.Name)
+	return nil
+}
+
+// retireRemoved 处理上游已移除的模板：仍有实例的标记为废弃，否则删除
+func (s *SyncService) retireRemoved(ctx context.Context, sourceID string, seen map[string]bool, result *SyncResult) error {
+	var synced []*AppTemplate
+	if err := s.db.WithContext(ctx).Where("source_id = ?", sourceID).Find(&synced).Error; err != nil {
+		return fmt.Errorf("failed to list synced templates: %w", err)
+	}
+
+	for _, template := range synced {
+		if seen[template.Name] || template.Status == TemplateStatusDeprecated {
+			continue
+		}
+
+		var instances int64
+		if err := s.db.WithContext(ctx).Model(&ApplicationInstance{}).
+			Where("template_id = ?", template.ID).Count(&instances).Error; err != nil {
+			return fmt.Errorf("failed to count instances of '%s': %w", template.Name, err)
+		}
+
+		if instances > 0 {
+			if err := s.db.WithContext(ctx).Model(template).Update("status", TemplateStatusDeprecated).Error; err != nil {
+				return fmt.Errorf("failed to deprecate template '%s': %w", template.Name, err)
+			}
+			result.Deprecated = append(result.Deprecated, template.Name)
+			continue
+		}
+
+		if err := s.db.WithContext(ctx).Delete(template).Error; err != nil {
+			return fmt.Errorf("failed to delete template '%s': %w", template.Name, err)
+		}
+		result.Removed = append(result.Removed, template.Name)
+	}
+	return nil
+}
+
+// loadTemplates 读取并验证仓库中的所有模板
+// seen 包含上游存在的所有模板名（含验证失败的），用于判断哪些模板已被移除
+func (s *SyncService) loadTemplates(dir string, source TemplateSource, commit string) ([]*AppTemplate, map[string]bool, []SyncFailure) {
+	seen := make(map[string]bool)
+	entries, err := os.ReadDir(filepath.Join(dir, TemplatesDir))
+	if err != nil {
+		return nil, seen, []SyncFailure{{Template: TemplatesDir, Reason: err.Error()}}
+	}
+
+	var templates []*AppTemplate
+	var failures []SyncFailure
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		seen[entry.Name()] = true
+
+		template, err := s.loadTemplate(filepath.Join(dir, TemplatesDir, entry.Name()), entry.Name())
+		if err != nil {
+			failures = append(failures, SyncFailure{Template: entry.Name(), Reason: err.Error()})
+			continue
+		}
+		template.SourceID = source.ID
+		template.SourceCommit = commit
+		template.Version = shortCommit(commit)
+		template.Status = TemplateStatusPublished
+		template.SyncedHash = templateHash(template)
+		templates = append(templates, template)
+	}
+	return templates, seen, failures
+}
+
+// loadTemplate 读取单个模板目录
+func (s *SyncService) loadTemplate(dir, name string) (*AppTemplate, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	var manifest templateManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFile, err)
+	}
+	if manifest.Name == "" {
+		manifest.Name = name
+	}
+	if manifest.Name != name {
+		return nil, fmt.Errorf("manifest name '%s' does not match directory name", manifest.Name)
+	}
+	if manifest.Category == "" {
+		manifest.Category = CategoryOther
+	}
+
+	contentFile, ok := contentFiles[manifest.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidTemplateType, manifest.Type)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, contentFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", contentFile, err)
+	}
+
+	parameters, err := json.Marshal(manifest.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode parameters: %w", err)
+	}
+	paramDefs, err := ParseTemplateParameters(string(parameters))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &AppTemplate{
+		Name:        manifest.Name,
+		DisplayName: manifest.DisplayName,
+		Description: manifest.Description,
+		Category:    manifest.Category,
+		Type:        manifest.Type,
+		Icon:        manifest.Icon,
+		Author:      manifest.Author,
+		Tags:        strings.Join(manifest.Tags, ","),
+		Content:     string(content),
+		Parameters:  string(parameters),
+	}
+	if len(manifest.Dependencies) > 0 {
+		dependencies, _ := json.Marshal(manifest.Dependencies)
+		template.Dependencies = string(dependencies)
+	}
+	if len(manifest.MinResources) > 0 {
+		resources, _ := json.Marshal(manifest.MinResources)
+		template.MinResources = string(resources)
+	}
+	if len(manifest.Probes) > 0 {
+		probes, _ := json.Marshal(manifest.Probes)
+		template.Probes = string(probes)
+	}
+
+	if err := s.templateService.ValidateTemplate(template); err != nil {
+		return nil, err
+	}
+	if err := s.templateService.ValidateParameterSchema(paramDefs, template.Content); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// checkout 克隆或更新仓库到本地缓存，返回工作目录和当前提交哈希
+func (s *SyncService) checkout(ctx context.Context, source TemplateSource) (string, string, error) {
+	dir := filepath.Join(s.cacheDir, source.ID)
+	env := gitEnv(source)
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		ref := source.Branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		steps := [][]string{
+			{"remote", "set-url", "origin", source.URL},
+			{"fetch", "--depth", "1", "origin", ref},
+			{"reset", "--hard", "FETCH_HEAD"},
+			{"clean", "-fdx"},
+		}
+		for _, args := range steps {
+			if _, err := runGit(ctx, dir, env, args...); err != nil {
+				return "", "", err
+			}
+		}
+	} else {
+		if err := os.RemoveAll(dir); err != nil {
+			return "", "", fmt.Errorf("failed to clean cache directory: %w", err)
+		}
+		if err := os.MkdirAll(s.cacheDir, 0755); err != nil {
+			return "", "", fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		args := []string{"clone", "--depth", "1", "--single-branch"}
+		if source.Branch != "" {
+			args = append(args, "--branch", source.Branch)
+		}
+		if _, err := runGit(ctx, "", env, append(args, source.URL, dir)...); err != nil {
+			return "", "", err
+		}
+	}
+
+	commit, err := runGit(ctx, dir, env, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	return dir, commit, nil
+}
+
+// gitEnv 生成 git 命令的环境变量，禁止交互式认证并按需使用部署密钥
+func gitEnv(source TemplateSource) []string {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if source.DeployKey != "" {
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", source.DeployKey))
+	}
+	return env
+}
+
+// runGit 执行 git 命令并返回去除首尾空白的输出
+func runGit(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// templateHash 计算模板内容摘要，不包含版本、状态等同步元数据
+func templateHash(template *AppTemplate) string {
+	fields := []string{
+		template.DisplayName, template.Description, string(template.Category), string(template.Type),
+		template.Icon, template.Author, template.Tags, template.Content, template.Parameters,
+		template.Dependencies, template.MinResources,
+	}
+	// 没有探针的模板保持原来的摘要，升级后已同步的模板不会被误判为本地修改
+	if template.Probes != "" {
+		fields = append(fields, template.Probes)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// shortCommit 截取提交哈希前 12 位作为模板版本号
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
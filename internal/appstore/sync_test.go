@@ -0,0 +1,125 @@
+package appstore
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const syncTestManifest = `display_name: Echo
+description: echo server
+category: dev-tools
+type: docker-compose
+tags: [echo, http]
+parameters:
+  - name: port
+    display_name: Port
+    type: int
+    default_value: 8080
+    required: true
+`
+
+const syncTestCompose = `services:
+  echo:
+    image: hashicorp/http-echo
+    ports:
+      - "{{.port}}:5678"
+`
+
+// gitCommitAll 在测试仓库中提交全部改动
+func gitCommitAll(t *testing.T, dir, message string) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", message},
+	} {
+		if output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, output)
+		}
+	}
+}
+
+// writeSyncTemplate 在测试仓库中写入模板目录
+func writeSyncTemplate(t *testing.T, repo, name, manifest, compose string) {
+	t.Helper()
+	dir := filepath.Join(repo, TemplatesDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, ManifestFile), []byte(manifest), 0644)
+	os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(compose), 0644)
+}
+
+func TestSyncService_Sync(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.AutoMigrate(&AppTemplate{}, &ApplicationInstance{})
+
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", "-b", "main", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, output)
+	}
+	writeSyncTemplate(t, repo, "echo", syncTestManifest, syncTestCompose)
+	writeSyncTemplate(t, repo, "legacy", syncTestManifest, syncTestCompose)
+	writeSyncTemplate(t, repo, "broken", syncTestManifest, "services:\n  web:\n    image: nginx\n    ports: [\"{{.undeclared}}:80\"]\n")
+	gitCommitAll(t, repo, "initial")
+
+	ctx := context.Background()
+	service := NewSyncService(db, []TemplateSource{{ID: "community", URL: repo, Branch: "main"}}, t.TempDir())
+	result, err := service.Sync(ctx, "community", false)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(result.Added) != 2 || len(result.Failed) != 1 || result.Failed[0].Template != "broken" {
+		t.Fatalf("Unexpected first sync result: %+v", result)
+	}
+
+	var echo AppTemplate
+	db.Where("name = ?", "echo").First(&echo)
+	if echo.SourceID != "community" || echo.SourceCommit != result.Commit || echo.Version != shortCommit(result.Commit) {
+		t.Errorf("Expected source attribution, got %+v", echo)
+	}
+
+	// 本地修改后同步不覆盖，--force 时覆盖
+	db.Model(&echo).Update("description", "edited locally")
+	var legacy AppTemplate
+	db.Where("name = ?", "legacy").First(&legacy)
+	db.Create(&ApplicationInstance{Name: "legacy-1", TemplateID: legacy.ID, Version: legacy.Version, Status: "running"})
+	os.RemoveAll(filepath.Join(repo, TemplatesDir, "legacy"))
+	writeSyncTemplate(t, repo, "echo", syncTestManifest+"author: upstream\n", syncTestCompose)
+	gitCommitAll(t, repo, "update")
+
+	result, err = service.Sync(ctx, "community", false)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(result.Updated) != 0 || len(result.Failed) != 2 {
+		t.Errorf("Expected locally modified template to be skipped, got %+v", result)
+	}
+	if len(result.Deprecated) != 1 || result.Deprecated[0] != "legacy" {
+		t.Errorf("Expected legacy template to be deprecated, got %+v", result)
+	}
+
+	result, err = service.Sync(ctx, "community", true)
+	if err != nil || len(result.Updated) != 1 {
+		t.Fatalf("Expected forced update, got %+v, %v", result, err)
+	}
+	db.Where("name = ?", "echo").First(&echo)
+	if echo.Author != "upstream" || echo.Description != "echo server" {
+		t.Errorf("Expected upstream content after force, got %+v", echo)
+	}
+
+	if _, err := service.Sync(ctx, "missing", false); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+}
@@ -81,6 +81,9 @@ func (s *TemplateService) ValidateTemplate(template *AppTemplate) error {
 	if err != nil {
 		return err
 	}
+	if err := validateTemplateProbes(template.Probes); err != nil {
+		return err
+	}
 
 	// 根据模板类型进行特定验证
 	switch template.Type {
@@ -93,6 +96,31 @@ func (s *TemplateService) ValidateTemplate(template *AppTemplate) error {
 	}
 }
 
+// validateTemplateProbes 检查探针的类型和必填字段，地址格式等在安装执行时由容器模块校验
+func validateTemplateProbes(probesJSON string) error {
+	probes, err := ParseTemplateProbes(probesJSON)
+	if err != nil {
+		return err
+	}
+	for i, probe := range probes {
+		var missing bool
+		switch probe.Type {
+		case "http":
+			missing = probe.URL == ""
+		case "tcp":
+			missing = probe.Address == ""
+		case "exec":
+			missing = probe.Service == "" || len(probe.Command) == 0
+		default:
+			return fmt.Errorf("probe #%d: unknown type %q, want http, tcp or exec", i+1, probe.Type)
+		}
+		if missing {
+			return fmt.Errorf("probe #%d: missing target for %s probe", i+1, probe.Type)
+		}
+	}
+	return nil
+}
+
 // validateDockerComposeTemplate 验证 Docker Compose 模板
 func (s *TemplateService) validateDockerComposeTemplate(parsed map[string]interface{}) error {
 	// 检查是否包含 services 字段
@@ -332,3 +360,54 @@ func (s *TemplateService) ConvertToJSON(data map[string]interface{}) (string, er
 	}
 	return string(jsonBytes), nil
 }
+
+// ValidateParameterSchema 验证参数定义本身是否合法
+// 检查参数名唯一、类型有效、select 类型有选项、正则可编译、默认值符合定义，
+// 且模板内容中使用的占位符都已声明
+func (s *TemplateService) ValidateParameterSchema(paramDefs []TemplateParameter, content string) error {
+	declared := make(map[string]bool, len(paramDefs))
+	for _, paramDef := range paramDefs {
+		if paramDef.Name == "" {
+			return fmt.Errorf("%w: parameter name is required", ErrParameterValidationFailed)
+		}
+		if declared[paramDef.Name] {
+			return fmt.Errorf("%w: duplicate parameter '%s'", ErrParameterValidationFailed, paramDef.Name)
+		}
+		declared[paramDef.Name] = true
+
+		switch paramDef.Type {
+		case ParamTypeString, ParamTypeInt, ParamTypeBool, ParamTypePassword, ParamTypePath:
+		case ParamTypeSelect:
+			if len(paramDef.Options) == 0 {
+				return fmt.Errorf("%w: select parameter '%s' must define options", ErrParameterValidationFailed, paramDef.Name)
+			}
+		default:
+			return fmt.Errorf("%w: parameter '%s' has unknown type '%s'", ErrParameterValidationFailed, paramDef.Name, paramDef.Type)
+		}
+
+		if paramDef.Validation != "" {
+			if _, err := regexp.Compile(paramDef.Validation); err != nil {
+				return fmt.Errorf("invalid validation regex for parameter '%s': %w", paramDef.Name, err)
+			}
+		}
+
+		if paramDef.DefaultValue != nil {
+			if err := s.validateParameterType(paramDef, paramDef.DefaultValue); err != nil {
+				return fmt.Errorf("invalid default value: %w", err)
+			}
+			if paramDef.Type == ParamTypeSelect {
+				if err := s.validateParameterOptions(paramDef, paramDef.DefaultValue); err != nil {
+					return fmt.Errorf("invalid default value: %w", err)
+				}
+			}
+		}
+	}
+
+	for _, name := range s.ExtractParameters(content) {
+		if !declared[name] {
+			return fmt.Errorf("%w: placeholder '{{.%s}}' is not declared in parameters", ErrParameterValidationFailed, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,495 @@
+// Package archive 将超过保留期的历史记录（告警、审计日志、自愈记录等）导出为按天分文件的 gzip JSONL，
+// 可选上传到 S3 兼容的对象存储，校验行数和校验和无误后才在事务中从在线数据库删除
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrVerifyFailed 归档文件与导出的记录不一致，记录不会被删除
+	ErrVerifyFailed = errors.New("archive verification failed")
+	// ErrUnknownTable 归档文件对应的表未注册
+	ErrUnknownTable = errors.New("unknown archive table")
+)
+
+// DefaultMaxAge 默认保留期
+const DefaultMaxAge = 90 * 24 * time.Hour
+
+// deleteBatch 每条 DELETE 语句最多包含的主键数，避免超出 SQLite 参数上限
+const deleteBatch = 500
+
+// statusFile 最近一次归档结果，保存在归档目录中，CLI 和 Web 服务共享
+const statusFile = "last_run.json"
+
+// Table 参与归档的表，记录需要有 id 主键
+type Table struct {
+	Name       string      // 表名，也用作归档文件名前缀
+	DB         *gorm.DB    // 表所在的数据库
+	Model      interface{} // 模型指针，如 &database.AuditLog{}
+	TimeColumn string      // 判断记录年龄的时间列，默认 created_at
+	// Exclude 排除仍需保留在在线数据库的记录（如未关闭的告警），返回附加条件后的查询
+	Exclude func(ctx context.Context, tx *gorm.DB) (*gorm.DB, error)
+}
+
+func (t Table) timeColumn() string {
+	if t.TimeColumn == "" {
+		return "created_at"
+	}
+	return t.TimeColumn
+}
+
+// FileResult 一个归档文件
+type FileResult struct {
+	Day      string `json:"day"`
+	Path     string `json:"path,omitempty"`
+	Rows     int    `json:"rows"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	Checksum string `json:"checksum,omitempty"` // 未压缩内容的 sha256
+	Object   string `json:"object,omitempty"`   // 上传到对象存储的 key
+}
+
+// TableResult 一张表的归档结果
+type TableResult struct {
+	Table   string       `json:"table"`
+	Rows    int          `json:"rows"`
+	Deleted int64        `json:"deleted"`
+	Files   []FileResult `json:"files"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// RunResult 一次归档的结果
+type RunResult struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	DryRun     bool          `json:"dry_run"`
+	Cutoff     time.Time     `json:"cutoff"`
+	Tables     []TableResult `json:"tables"`
+}
+
+// Failed 是否有表归档失败
+func (r *RunResult) Failed() bool {
+	for _, table := range r.Tables {
+		if table.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Uploader 对象存储上传接口
+type Uploader interface {
+	Upload(ctx context.Context, key, path string) error
+}
+
+// Archiver 归档任务
+type Archiver struct {
+	dir      string
+	maxAge   time.Duration
+	tables   []Table
+	uploader Uploader
+	now      func() time.Time
+	mu       sync.Mutex // 同一进程内的归档任务串行执行
+}
+
+// NewArchiver 创建归档任务，maxAge 为 0 时使用 DefaultMaxAge
+func NewArchiver(dir string, maxAge time.Duration, tables ...Table) *Archiver {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	return &Archiver{dir: dir, maxAge: maxAge, tables: tables, now: time.Now}
+}
+
+// SetUploader 设置对象存储，为 nil 时只保存本地文件
+func (a *Archiver) SetUploader(uploader Uploader) {
+	a.uploader = uploader
+}
+
+// Dir 归档目录
+func (a *Archiver) Dir() string {
+	return a.dir
+}
+
+// Tables 已注册的表名
+func (a *Archiver) Tables() []string {
+	names := make([]string, 0, len(a.tables))
+	for _, table := range a.tables {
+		names = append(names, table.Name)
+	}
+	return names
+}
+
+// Run 归档所有表中早于保留期的记录；dryRun 时只统计将被归档的记录，不写文件也不删除。
+// 单张表失败不影响其他表，错误记录在对应的 TableResult 中
+func (a *Archiver) Run(ctx context.Context, dryRun bool) (*RunResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	result := &RunResult{StartedAt: now, DryRun: dryRun, Cutoff: now.Add(-a.maxAge)}
+	for _, table := range a.tables {
+		tableResult := TableResult{Table: table.Name}
+		if err := a.archiveTable(ctx, table, result.Cutoff, dryRun, &tableResult); err != nil {
+			tableResult.Error = err.Error()
+			logger.Info("❌ 归档 %s 失败: %v", table.Name, err)
+		}
+		result.Tables = append(result.Tables, tableResult)
+	}
+	result.FinishedAt = a.now()
+
+	if !dryRun {
+		if err := a.saveStatus(result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Status 最近一次归档结果，从未执行过时返回 nil
+func (a *Archiver) Status() (*RunResult, error) {
+	data, err := os.ReadFile(filepath.Join(a.dir, statusFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result RunResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse archive status: %w", err)
+	}
+	return &result, nil
+}
+
+func (a *Archiver) saveStatus(result *RunResult) error {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.dir, statusFile), data, 0644)
+}
+
+// eligible 早于截止时间且未被排除的记录
+func (a *Archiver) eligible(ctx context.Context, table Table, from, to time.Time) (*gorm.DB, error) {
+	column := table.timeColumn()
+	tx := table.DB.WithContext(ctx).Model(table.Model).Where(column+" < ?", to)
+	if !from.IsZero() {
+		tx = tx.Where(column+" >= ?", from)
+	}
+	if table.Exclude == nil {
+		return tx, nil
+	}
+	return table.Exclude(ctx, tx)
+}
+
+// archiveTable 按天导出一张表，每天一个文件
+func (a *Archiver) archiveTable(ctx context.Context, table Table, cutoff time.Time, dryRun bool, result *TableResult) error {
+	var from time.Time
+	for {
+		tx, err := a.eligible(ctx, table, from, cutoff)
+		if err != nil {
+			return err
+		}
+		var first struct{ T time.Time }
+		if err := tx.Select(table.timeColumn() + " AS t").Order(table.timeColumn()).Limit(1).Scan(&first).Error; err != nil {
+			return fmt.Errorf("failed to find oldest record: %w", err)
+		}
+		if first.T.IsZero() {
+			return nil
+		}
+
+		day := time.Date(first.T.Year(), first.T.Month(), first.T.Day(), 0, 0, 0, 0, first.T.Location())
+		to := day.AddDate(0, 0, 1)
+		if to.After(cutoff) {
+			to = cutoff
+		}
+		file, deleted, err := a.archiveDay(ctx, table, day, to, dryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %w", day.Format("2006-01-02"), err)
+		}
+		result.Files = append(result.Files, file)
+		result.Rows += file.Rows
+		result.Deleted += deleted
+		from = to
+	}
+}
+
+// archiveDay 导出 [day, to) 内的记录，校验和上传成功后删除
+func (a *Archiver) archiveDay(ctx context.Context, table Table, day, to time.Time, dryRun bool) (FileResult, int64, error) {
+	file := FileResult{Day: day.Format("2006-01-02")}
+	tx, err := a.eligible(ctx, table, day, to)
+	if err != nil {
+		return file, 0, err
+	}
+	if dryRun {
+		var count int64
+		if err := tx.Count(&count).Error; err != nil {
+			return file, 0, fmt.Errorf("failed to count records: %w", err)
+		}
+		file.Rows = int(count)
+		return file, 0, nil
+	}
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(table.Model)))
+	if err := tx.Order(table.timeColumn()).Order("id").Find(rows.Interface()).Error; err != nil {
+		return file, 0, fmt.Errorf("failed to load records: %w", err)
+	}
+	records := rows.Elem()
+	file.Rows = records.Len()
+
+	file.Path, err = a.nextPath(table.Name, file.Day)
+	if err != nil {
+		return file, 0, err
+	}
+	ids, checksum, err := writeArchive(file.Path, records)
+	if err != nil {
+		return file, 0, err
+	}
+	file.Checksum = checksum
+	if err := verifyArchive(file.Path, len(ids), checksum); err != nil {
+		return file, 0, err
+	}
+	if info, err := os.Stat(file.Path); err == nil {
+		file.Bytes = info.Size()
+	}
+
+	if a.uploader != nil {
+		rel, _ := filepath.Rel(a.dir, file.Path)
+		key := filepath.ToSlash(rel)
+		if err := a.uploader.Upload(ctx, key, file.Path); err != nil {
+			return file, 0, fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		file.Object = key
+	}
+
+	deleted, err := deleteRecords(ctx, table, ids)
+	if err != nil {
+		return file, 0, err
+	}
+	logger.Info("📦 已归档 %s %s: %d 条 -> %s", table.Name, file.Day, deleted, file.Path)
+	return file, deleted, nil
+}
+
+// nextPath 归档文件路径，同一天多次归档（如之前未关闭的告警后来关闭）时追加序号，不覆盖已有文件
+func (a *Archiver) nextPath(name, day string) (string, error) {
+	dir := filepath.Join(a.dir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	for i := 1; ; i++ {
+		base := fmt.Sprintf("%s-%s.jsonl.gz", name, day)
+		if i > 1 {
+			base = fmt.Sprintf("%s-%s.%d.jsonl.gz", name, day, i)
+		}
+		path := filepath.Join(dir, base)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path, nil
+		}
+	}
+}
+
+// writeArchive 将记录写成 gzip JSONL，返回记录主键和未压缩内容的 sha256
+func writeArchive(path string, records reflect.Value) ([]uint, string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, "", err
+	}
+	gz := gzip.NewWriter(f)
+	hash := sha256.New()
+	w := io.MultiWriter(gz, hash)
+
+	ids := make([]uint, 0, records.Len())
+	for i := 0; i < records.Len(); i++ {
+		line, err := json.Marshal(records.Index(i).Interface())
+		if err == nil {
+			var key struct {
+				ID uint `json:"id"`
+			}
+			if err = json.Unmarshal(line, &key); err == nil && key.ID == 0 {
+				err = errors.New("record has no id")
+			}
+			ids = append(ids, key.ID)
+		}
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			gz.Close()
+			f.Close()
+			os.Remove(path)
+			return nil, "", err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, "", err
+	}
+	return ids, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyArchive 重新读取归档文件，校验行数和校验和
+func verifyArchive(path string, rows int, checksum string) error {
+	count, sum, err := readArchive(path, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerifyFailed, err)
+	}
+	if count != rows || sum != checksum {
+		return fmt.Errorf("%w: %s has %d rows (sha256 %s), expected %d rows (sha256 %s)", ErrVerifyFailed, path, count, sum, rows, checksum)
+	}
+	return nil
+}
+
+// readArchive 逐行读取归档文件，返回行数和未压缩内容的 sha256
+func readArchive(path string, fn func(line []byte) error) (int, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, "", err
+	}
+	defer gz.Close()
+
+	hash := sha256.New()
+	reader := bufio.NewReader(io.TeeReader(gz, hash))
+	count := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			count++
+			if fn != nil {
+				if err := fn(line); err != nil {
+					return count, "", fmt.Errorf("line %d: %w", count, err)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, "", err
+		}
+	}
+	return count, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// deleteRecords 在事务中删除已归档的记录，删除数量与导出数量不一致时回滚
+func deleteRecords(ctx context.Context, table Table, ids []uint) (int64, error) {
+	var deleted int64
+	err := table.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += deleteBatch {
+			end := start + deleteBatch
+			if end > len(ids) {
+				end = len(ids)
+			}
+			result := tx.Unscoped().Where("id IN ?", ids[start:end]).Delete(table.Model)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		}
+		if deleted != int64(len(ids)) {
+			return fmt.Errorf("deleted %d records, expected %d; records changed during archiving", deleted, len(ids))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete archived records: %w", err)
+	}
+	return deleted, nil
+}
+
+// archiveName 归档文件名：<table>-YYYY-MM-DD[.n].jsonl.gz
+var archiveName = regexp.MustCompile(`^(.+)-\d{4}-\d{2}-\d{2}(\.\d+)?\.jsonl\.gz$`)
+
+// TableForFile 根据归档文件名推断表名，无法识别时返回空字符串
+func TableForFile(path string) string {
+	if m := archiveName.FindStringSubmatch(filepath.Base(path)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Import 将归档文件导回在线数据库供排查使用，已存在的记录（相同主键）跳过，返回文件中的记录数和新导入的记录数。
+// table 为空时根据文件名推断
+func (a *Archiver) Import(ctx context.Context, path, table string) (int, int64, error) {
+	if table == "" {
+		table = TableForFile(path)
+	}
+	var target *Table
+	for i := range a.tables {
+		if a.tables[i].Name == table {
+			target = &a.tables[i]
+		}
+	}
+	if target == nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrUnknownTable, table)
+	}
+
+	modelType := reflect.TypeOf(target.Model).Elem()
+	var imported int64
+	db := target.DB.WithContext(ctx)
+	count, _, err := readArchive(path, func(line []byte) error {
+		record := reflect.New(modelType).Interface()
+		if err := json.Unmarshal(line, record); err != nil {
+			return err
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(record)
+		imported += result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return count, imported, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	return count, imported, nil
+}
+
+// DefaultInterval 定时归档的默认间隔
+const DefaultInterval = 24 * time.Hour
+
+var (
+	defaultArchiver   *Archiver
+	defaultArchiverMu sync.RWMutex
+)
+
+// SetDefault 设置全局归档任务，传 nil 时关闭归档
+func SetDefault(archiver *Archiver) {
+	defaultArchiverMu.Lock()
+	defaultArchiver = archiver
+	defaultArchiverMu.Unlock()
+}
+
+// Default 全局归档任务，未启用时返回 nil
+func Default() *Archiver {
+	defaultArchiverMu.RLock()
+	defer defaultArchiverMu.RUnlock()
+	return defaultArchiver
+}
@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+type testIncident struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Status    string    `json:"status"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type testAudit struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Resource   string    `json:"resource"`
+	ResourceID string    `json:"resource_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func setupArchiver(t *testing.T) (*Archiver, *gorm.DB, time.Time) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&testIncident{}, &testAudit{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.Local)
+	old := now.AddDate(0, 0, -100)
+	records := []interface{}{
+		&testIncident{ID: 1, Status: "resolved", Title: "disk full", CreatedAt: old},
+		&testIncident{ID: 2, Status: "resolved", Title: "oom", CreatedAt: old.Add(2 * time.Hour)},
+		&testIncident{ID: 3, Status: "firing", Title: "still open", CreatedAt: old},
+		&testIncident{ID: 4, Status: "resolved", Title: "next day", CreatedAt: old.AddDate(0, 0, 1)},
+		&testIncident{ID: 5, Status: "resolved", Title: "recent", CreatedAt: now.AddDate(0, 0, -1)},
+		&testAudit{ID: 1, Resource: "alert", ResourceID: "3", CreatedAt: old},
+		&testAudit{ID: 2, Resource: "alert", ResourceID: "1", CreatedAt: old},
+		&testAudit{ID: 3, Resource: "login", ResourceID: "3", CreatedAt: old},
+	}
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archiver := NewArchiver(t.TempDir(), 90*24*time.Hour,
+		Table{
+			Name: "incidents", DB: db, Model: &testIncident{},
+			Exclude: func(ctx context.Context, tx *gorm.DB) (*gorm.DB, error) {
+				return tx.Where("status = ?", "resolved"), nil
+			},
+		},
+		Table{
+			Name: "audit", DB: db, Model: &testAudit{},
+			Exclude: func(ctx context.Context, tx *gorm.DB) (*gorm.DB, error) {
+				var open []string
+				db.Model(&testIncident{}).Where("status <> ?", "resolved").Pluck("CAST(id AS TEXT)", &open)
+				return tx.Where("NOT (resource = ? AND resource_id IN ?)", "alert", open), nil
+			},
+		},
+	)
+	archiver.now = func() time.Time { return now }
+	return archiver, db, old
+}
+
+func TestArchiver_DryRun(t *testing.T) {
+	archiver, db, _ := setupArchiver(t)
+
+	result, err := archiver.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Tables[0].Rows != 3 || len(result.Tables[0].Files) != 2 || result.Tables[1].Rows != 2 {
+		t.Fatalf("Unexpected dry run result %+v", result.Tables)
+	}
+	var count int64
+	db.Model(&testIncident{}).Count(&count)
+	if count != 5 {
+		t.Errorf("Dry run must not delete records, %d left", count)
+	}
+	if entries, _ := os.ReadDir(archiver.Dir()); len(entries) != 0 {
+		t.Errorf("Dry run must not write files, got %v", entries)
+	}
+}
+
+func TestArchiver_RunAndImport(t *testing.T) {
+	archiver, db, old := setupArchiver(t)
+	ctx := context.Background()
+
+	result, err := archiver.Run(ctx, false)
+	if err != nil || result.Failed() {
+		t.Fatalf("Run: %+v %v", result, err)
+	}
+	incidents := result.Tables[0]
+	if incidents.Deleted != 3 || len(incidents.Files) != 2 || incidents.Files[0].Rows != 2 || incidents.Files[0].Checksum == "" {
+		t.Fatalf("Unexpected incidents result %+v", incidents)
+	}
+	if want := filepath.Join(archiver.Dir(), "incidents", "incidents-"+old.Format("2006-01-02")+".jsonl.gz"); incidents.Files[0].Path != want {
+		t.Errorf("Expected file %s, got %s", want, incidents.Files[0].Path)
+	}
+
+	var remaining []testIncident
+	db.Order("id").Find(&remaining)
+	if len(remaining) != 2 || remaining[0].ID != 3 || remaining[1].ID != 5 {
+		t.Errorf("Open and recent incidents must stay, got %+v", remaining)
+	}
+	var audits []testAudit
+	db.Order("id").Find(&audits)
+	if len(audits) != 1 || audits[0].ID != 1 {
+		t.Errorf("Audit records of open incidents must stay, got %+v", audits)
+	}
+
+	status, err := archiver.Status()
+	if err != nil || status == nil || status.Tables[0].Deleted != 3 {
+		t.Errorf("Expected last run in status, got %+v %v", status, err)
+	}
+
+	// 同一天再次归档时不覆盖已有文件
+	db.Model(&testIncident{}).Where("id = ?", 3).Update("status", "resolved")
+	result, _ = archiver.Run(ctx, false)
+	if files := result.Tables[0].Files; len(files) != 1 || !strings.HasSuffix(files[0].Path, ".2.jsonl.gz") {
+		t.Errorf("Expected a second file for the same day, got %+v", files)
+	}
+
+	total, imported, err := archiver.Import(ctx, incidents.Files[0].Path, "")
+	if err != nil || total != 2 || imported != 2 {
+		t.Fatalf("Import: %d %d %v", total, imported, err)
+	}
+	var restored testIncident
+	if err := db.First(&restored, 2).Error; err != nil || restored.Title != "oom" {
+		t.Errorf("Expected incident #2 restored, got %+v %v", restored, err)
+	}
+	if _, imported, _ := archiver.Import(ctx, incidents.Files[0].Path, ""); imported != 0 {
+		t.Errorf("Existing records must be skipped, imported %d", imported)
+	}
+	if _, _, err := archiver.Import(ctx, incidents.Files[0].Path, "missing"); !errors.Is(err, ErrUnknownTable) {
+		t.Errorf("Expected ErrUnknownTable, got %v", err)
+	}
+}
+
+func TestArchiver_UploadFailureKeepsRecords(t *testing.T) {
+	archiver, db, _ := setupArchiver(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	archiver.SetUploader(&S3Uploader{Endpoint: srv.URL, Bucket: "qwq", AccessKey: "k", SecretKey: "s"})
+
+	result, err := archiver.Run(context.Background(), false)
+	if err != nil || !result.Failed() || !strings.Contains(result.Tables[0].Error, "AccessDenied") {
+		t.Fatalf("Expected upload failure, got %+v %v", result, err)
+	}
+	var count int64
+	db.Model(&testIncident{}).Count(&count)
+	if count != 5 {
+		t.Errorf("Records must not be deleted when the upload fails, %d left", count)
+	}
+}
+
+func TestS3Uploader_SignsRequest(t *testing.T) {
+	var gotPath, gotAuth, gotHash string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth, gotHash = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("X-Amz-Content-Sha256")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "a.jsonl.gz")
+	os.WriteFile(path, []byte("payload"), 0644)
+	uploader := &S3Uploader{Endpoint: srv.URL, Bucket: "qwq", Prefix: "archive/", AccessKey: "AKID", SecretKey: "secret"}
+	if err := uploader.Upload(context.Background(), "alerts/a.jsonl.gz", path); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if gotPath != "/qwq/archive/alerts/a.jsonl.gz" || string(gotBody) != "payload" || gotHash != sha256Hex([]byte("payload")) {
+		t.Errorf("Unexpected request %s %q %s", gotPath, gotBody, gotHash)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(gotAuth, "/us-east-1/s3/aws4_request") {
+		t.Errorf("Unexpected authorization header %q", gotAuth)
+	}
+}
+
+func TestTableForFile(t *testing.T) {
+	for path, want := range map[string]string{
+		"archive/audit_logs/audit_logs-2026-01-02.jsonl.gz": "audit_logs",
+		"failure_records-2026-01-02.3.jsonl.gz":             "failure_records",
+		"notes.txt":                                         "",
+	} {
+		if got := TableForFile(path); got != want {
+			t.Errorf("TableForFile(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
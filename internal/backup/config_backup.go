@@ -0,0 +1,724 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// 配置备份默认参数
+const (
+	DefaultConfigBackupDir       = "/var/backups/qwq/config"
+	DefaultConfigBackupRetention = 7
+
+	configBackupIndexFile = "backups.json"
+	configManifestFile    = "manifest.json"
+	composeProjectsFile   = "compose/projects.json"
+
+	// StagedRestoreSuffix 恢复的数据库文件先写到 <数据库>.restore，下次启动打开数据库前替换
+	StagedRestoreSuffix = ".restore"
+	// replacedSuffix 替换前的数据库文件改名为 <数据库>.before-restore
+	replacedSuffix = ".before-restore"
+)
+
+// 配置备份的组件，恢复时必须指定其中一个
+const (
+	ComponentNginx    = "nginx"
+	ComponentCompose  = "compose"
+	ComponentDatabase = "database"
+	ComponentConfig   = "config"
+)
+
+var (
+	// ErrConfigBackupNotFound 配置备份不存在
+	ErrConfigBackupNotFound = errors.New("配置备份不存在")
+
+	// ErrInvalidComponent 恢复时没有指定或指定了未知的组件（不支持一次恢复全部组件）
+	ErrInvalidComponent = errors.New("需要指定恢复的组件: nginx、compose、database 或 config")
+
+	// ErrComponentNotInBackup 备份中没有该组件
+	ErrComponentNotInBackup = errors.New("备份中没有该组件")
+
+	// ErrNginxTestFailed 恢复的 nginx 配置未通过 nginx -t，已回滚
+	ErrNginxTestFailed = errors.New("恢复的 nginx 配置未通过 nginx -t，已回滚")
+)
+
+// ComposeProjectFile 备份中的 Compose 项目
+type ComposeProjectFile struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	UserID      uint   `json:"user_id"`
+	TenantID    uint   `json:"tenant_id"`
+	Content     string `json:"content"`
+}
+
+// ComposeStore 导出和写回 Compose 项目，由部署服务实现
+type ComposeStore interface {
+	// ExportProjects 导出全部项目
+	ExportProjects(ctx context.Context) ([]ComposeProjectFile, error)
+	// ImportProject 按名称和租户写回项目内容，项目不存在时创建
+	ImportProject(ctx context.Context, project ComposeProjectFile) error
+}
+
+// DatabaseFile qwq 使用的 SQLite 数据库，DB 非空时通过 VACUUM INTO 得到一致的副本，否则直接复制文件
+type DatabaseFile struct {
+	Path string
+	DB   *gorm.DB
+}
+
+// ConfigSources 配置备份的来源，为空的来源不备份
+type ConfigSources struct {
+	NginxDir    string         // nginx 站点配置目录
+	Compose     ComposeStore   // Compose 项目
+	Databases   []DatabaseFile // SQLite 数据库，使用 PostgreSQL 时为空
+	ConfigFiles []string       // qwq 的配置文件和运行时覆盖文件
+}
+
+// BackupComponent 备份中一个组件的内容
+type BackupComponent struct {
+	Name  string            `json:"name"`
+	Files []string          `json:"files"`           // 归档中的文件
+	Paths map[string]string `json:"paths,omitempty"` // 数据库和配置文件在归档中的文件名 -> 原路径
+}
+
+// ConfigBackup 一次配置备份
+type ConfigBackup struct {
+	ID         string            `json:"id"`
+	File       string            `json:"file"` // 归档文件名（相对备份目录）
+	Size       int64             `json:"size"`
+	Checksum   string            `json:"checksum"`
+	Trigger    string            `json:"trigger"` // manual 或 scheduled
+	Components []BackupComponent `json:"components"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// component 备份中的组件，没有时为 nil
+func (b *ConfigBackup) component(name string) *BackupComponent {
+	for i := range b.Components {
+		if b.Components[i].Name == name {
+			return &b.Components[i]
+		}
+	}
+	return nil
+}
+
+// RestoreResult 恢复一个组件的结果
+type RestoreResult struct {
+	BackupID        string   `json:"backup_id"`
+	Component       string   `json:"component"`
+	Files           []string `json:"files"`
+	RestartRequired bool     `json:"restart_required"` // 数据库和配置文件在重启 qwq 后生效
+}
+
+// NginxRunner 执行 nginx 命令并返回合并的输出，测试中替换
+type NginxRunner func(ctx context.Context, args ...string) ([]byte, error)
+
+// execNginx 使用 websites.nginx_binary 执行 nginx
+func execNginx(ctx context.Context, args ...string) ([]byte, error) {
+	binary := config.Current().Websites.NginxBinary
+	if binary == "" {
+		binary = "nginx"
+	}
+	return exec.CommandContext(ctx, binary, args...).CombinedOutput()
+}
+
+// ConfigBackupManager 配置备份管理器：把 nginx 配置、compose 项目、数据库和配置文件打包为带时间戳的 tar.gz
+type ConfigBackupManager struct {
+	dir       string
+	retention int
+	sources   ConfigSources
+	nginx     NginxRunner
+
+	mu sync.Mutex
+}
+
+// NewConfigBackupManager 创建配置备份管理器，零值参数使用默认值，nginx 为空时执行 websites.nginx_binary
+func NewConfigBackupManager(cfg config.BackupConfig, sources ConfigSources, nginx NginxRunner) *ConfigBackupManager {
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultConfigBackupDir
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultConfigBackupRetention
+	}
+	if nginx == nil {
+		nginx = execNginx
+	}
+	return &ConfigBackupManager{dir: cfg.Dir, retention: cfg.Retention, sources: sources, nginx: nginx}
+}
+
+// Backup 备份全部来源，完成后只保留最近 retention 个备份
+func (m *ConfigBackupManager) Backup(ctx context.Context, trigger string) (*ConfigBackup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0750); err != nil {
+		return nil, fmt.Errorf("%w: failed to create backup directory: %v", ErrBackupFailed, err)
+	}
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	backup := &ConfigBackup{
+		ID:        uniqueBackupID(index, "qwq-config-"+now.Format("20060102-150405.000")),
+		Trigger:   trigger,
+		CreatedAt: now,
+	}
+	backup.File = backup.ID + ".tar.gz"
+	archive := filepath.Join(m.dir, backup.File)
+
+	if err := m.writeArchive(ctx, archive, backup); err != nil {
+		os.Remove(archive)
+		return nil, fmt.Errorf("%w: %v", ErrBackupFailed, err)
+	}
+	checksum, err := fileSHA256(archive)
+	if err != nil {
+		os.Remove(archive)
+		return nil, fmt.Errorf("%w: %v", ErrBackupFailed, err)
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		os.Remove(archive)
+		return nil, fmt.Errorf("%w: %v", ErrBackupFailed, err)
+	}
+	backup.Size, backup.Checksum = info.Size(), checksum
+
+	index = append(index, backup)
+	for len(index) > m.retention {
+		os.Remove(filepath.Join(m.dir, index[0].File))
+		index = index[1:]
+	}
+	if err := m.saveIndex(index); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// uniqueBackupID 同一毫秒内的多次备份追加序号，避免覆盖已有的归档
+func uniqueBackupID(index []*ConfigBackup, id string) string {
+	used := make(map[string]string, len(index))
+	for _, backup := range index {
+		used[backup.ID] = backup.File
+	}
+	return uniqueName(used, id)
+}
+
+// writeArchive 写入归档，各组件的文件列表记录到 backup 和归档末尾的 manifest.json
+func (m *ConfigBackupManager) writeArchive(ctx context.Context, archive string, backup *ConfigBackup) error {
+	file, err := os.OpenFile(archive, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	if dir := m.sources.NginxDir; dir != "" {
+		component, err := archiveNginx(tw, dir)
+		if err != nil {
+			return fmt.Errorf("nginx: %w", err)
+		}
+		backup.Components = append(backup.Components, *component)
+	}
+	if m.sources.Compose != nil {
+		projects, err := m.sources.Compose.ExportProjects(ctx)
+		if err != nil {
+			return fmt.Errorf("compose: %w", err)
+		}
+		data, err := json.MarshalIndent(projects, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, composeProjectsFile, data, 0600); err != nil {
+			return err
+		}
+		backup.Components = append(backup.Components, BackupComponent{Name: ComponentCompose, Files: []string{composeProjectsFile}})
+	}
+	if len(m.sources.Databases) > 0 {
+		component, err := m.archiveDatabases(ctx, tw)
+		if err != nil {
+			return fmt.Errorf("database: %w", err)
+		}
+		backup.Components = append(backup.Components, *component)
+	}
+	if len(m.sources.ConfigFiles) > 0 {
+		component := BackupComponent{Name: ComponentConfig, Paths: make(map[string]string)}
+		for _, source := range m.sources.ConfigFiles {
+			data, err := os.ReadFile(source)
+			if os.IsNotExist(err) {
+				continue // 覆盖文件在第一次修改配置前不存在
+			}
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			name := uniqueName(component.Paths, "config/"+filepath.Base(source))
+			if err := writeTarFile(tw, name, data, 0600); err != nil {
+				return err
+			}
+			component.Files = append(component.Files, name)
+			component.Paths[name] = source
+		}
+		backup.Components = append(backup.Components, component)
+	}
+
+	manifest, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, configManifestFile, manifest, 0600); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// archiveNginx 打包 nginx 配置目录下的普通文件，目录不存在时组件为空
+func archiveNginx(tw *tar.Writer, dir string) (*BackupComponent, error) {
+	component := &BackupComponent{Name: ComponentNginx}
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if file == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		name := "nginx/" + filepath.ToSlash(rel)
+		if err := writeTarFile(tw, name, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+		component.Files = append(component.Files, name)
+		return nil
+	})
+	return component, err
+}
+
+// archiveDatabases 打包数据库，共用同一文件的服务只打包一次
+func (m *ConfigBackupManager) archiveDatabases(ctx context.Context, tw *tar.Writer) (*BackupComponent, error) {
+	component := &BackupComponent{Name: ComponentDatabase, Paths: make(map[string]string)}
+	seen := make(map[string]bool)
+	for _, database := range m.sources.Databases {
+		if database.Path == "" || seen[database.Path] {
+			continue
+		}
+		seen[database.Path] = true
+
+		data, err := snapshotDatabase(ctx, database, m.dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", database.Path, err)
+		}
+		name := uniqueName(component.Paths, "database/"+filepath.Base(database.Path))
+		if err := writeTarFile(tw, name, data, 0600); err != nil {
+			return nil, err
+		}
+		component.Files = append(component.Files, name)
+		component.Paths[name] = database.Path
+	}
+	return component, nil
+}
+
+// snapshotDatabase 得到数据库的一致副本：打开的数据库用 VACUUM INTO 写到临时文件，避免复制到写了一半的页
+func snapshotDatabase(ctx context.Context, database DatabaseFile, tmpDir string) ([]byte, error) {
+	if database.DB == nil {
+		return os.ReadFile(database.Path)
+	}
+	tmp, err := os.CreateTemp(tmpDir, ".vacuum-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	os.Remove(tmpPath) // VACUUM INTO 要求目标文件不存在
+	defer os.Remove(tmpPath)
+
+	if err := database.DB.WithContext(ctx).Exec("VACUUM INTO ?", tmpPath).Error; err != nil {
+		return nil, fmt.Errorf("vacuum into: %w", err)
+	}
+	return os.ReadFile(tmpPath)
+}
+
+// uniqueName 归档中不重复的文件名，不同目录中的同名文件追加序号
+func uniqueName(used map[string]string, name string) string {
+	if _, ok := used[name]; !ok {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s.%d", name, i)
+		if _, ok := used[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, mode fs.FileMode) error {
+	header := &tar.Header{Name: name, Mode: int64(mode), Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// ListBackups 列出配置备份（最新的在前）
+func (m *ConfigBackupManager) ListBackups() ([]*ConfigBackup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ConfigBackup, 0, len(index))
+	for i := len(index) - 1; i >= 0; i-- {
+		result = append(result, index[i])
+	}
+	return result, nil
+}
+
+// Latest 最近一次配置备份，没有备份时返回 nil
+func (m *ConfigBackupManager) Latest() (*ConfigBackup, error) {
+	backups, err := m.ListBackups()
+	if err != nil || len(backups) == 0 {
+		return nil, err
+	}
+	return backups[0], nil
+}
+
+// Restore 从备份恢复一个组件：
+// nginx 写回配置目录，nginx -t 通过后重载，否则回滚到恢复前的文件；compose 按项目名称和租户写回内容；
+// database 写到 <数据库>.restore，下次启动时替换；config 写回原路径，重启后生效
+func (m *ConfigBackupManager) Restore(ctx context.Context, backupID, component string) (*RestoreResult, error) {
+	switch component {
+	case ComponentNginx, ComponentCompose, ComponentDatabase, ComponentConfig:
+	default:
+		return nil, ErrInvalidComponent
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backup, err := m.findBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	entry := backup.component(component)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %s", ErrComponentNotInBackup, component)
+	}
+	archive := filepath.Join(m.dir, backup.File)
+	if checksum, err := fileSHA256(archive); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRestoreFailed, err)
+	} else if checksum != backup.Checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch for %s", ErrRestoreFailed, backup.File)
+	}
+	files, err := readArchive(archive, component+"/")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRestoreFailed, err)
+	}
+
+	result := &RestoreResult{BackupID: backup.ID, Component: component, Files: entry.Files}
+	switch component {
+	case ComponentNginx:
+		err = m.restoreNginx(ctx, files)
+	case ComponentCompose:
+		err = m.restoreCompose(ctx, files[composeProjectsFile])
+	case ComponentDatabase:
+		err = restoreFiles(files, entry.Paths, StagedRestoreSuffix)
+		result.RestartRequired = true
+	case ComponentConfig:
+		err = restoreFiles(files, entry.Paths, "")
+		result.RestartRequired = true
+	}
+	if err != nil {
+		if errors.Is(err, ErrNginxTestFailed) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRestoreFailed, err)
+	}
+	return result, nil
+}
+
+// archiveFile 归档中的文件
+type archiveFile struct {
+	data []byte
+	mode fs.FileMode
+}
+
+// readArchive 读取归档中 prefix 下的文件
+func readArchive(archive, prefix string) (map[string]archiveFile, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string]archiveFile)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasPrefix(header.Name, prefix) {
+			continue
+		}
+		// 拒绝 ../ 等越出组件目录的文件名
+		if clean := path.Clean(header.Name); clean != header.Name || strings.Contains(clean, "..") {
+			return nil, fmt.Errorf("invalid file name in archive: %q", header.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = archiveFile{data: data, mode: fs.FileMode(header.Mode).Perm()}
+	}
+}
+
+// restoreNginx 用备份替换 nginx 配置目录中的文件，nginx -t 通过后重载；未通过时恢复原来的文件
+func (m *ConfigBackupManager) restoreNginx(ctx context.Context, files map[string]archiveFile) error {
+	dir := m.sources.NginxDir
+	if dir == "" {
+		return errors.New("nginx config directory is not configured")
+	}
+
+	previous := make(map[string]archiveFile)
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if file == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		previous[file] = archiveFile{data: data, mode: info.Mode().Perm()}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	restored := make(map[string]archiveFile, len(files))
+	for name, file := range files {
+		restored[filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(name, ComponentNginx+"/")))] = file
+	}
+	if err := replaceFiles(previous, restored); err != nil {
+		replaceFiles(restored, previous)
+		return err
+	}
+
+	if out, err := m.nginx(ctx, "-t"); err != nil {
+		if rollback := replaceFiles(restored, previous); rollback != nil {
+			return fmt.Errorf("%w: %s; rollback failed: %v", ErrNginxTestFailed, nginxOutput(out, err), rollback)
+		}
+		return fmt.Errorf("%w: %s", ErrNginxTestFailed, nginxOutput(out, err))
+	}
+	if out, err := m.nginx(ctx, "-s", "reload"); err != nil {
+		return fmt.Errorf("nginx reload failed: %s", nginxOutput(out, err))
+	}
+	return nil
+}
+
+// replaceFiles 删除 current 中不在 next 里的文件，写入 next 的全部文件
+func replaceFiles(current, next map[string]archiveFile) error {
+	for file := range current {
+		if _, ok := next[file]; !ok {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for file, content := range next {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, content.data, content.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nginxOutput nginx 的输出，没有输出（如找不到 nginx）时使用执行错误
+func nginxOutput(out []byte, err error) string {
+	if output := strings.TrimSpace(string(out)); output != "" {
+		return output
+	}
+	return err.Error()
+}
+
+// restoreCompose 写回备份中的全部 Compose 项目
+func (m *ConfigBackupManager) restoreCompose(ctx context.Context, file archiveFile) error {
+	if m.sources.Compose == nil {
+		return errors.New("compose projects are not available")
+	}
+	var projects []ComposeProjectFile
+	if err := json.Unmarshal(file.data, &projects); err != nil {
+		return fmt.Errorf("failed to parse compose projects: %w", err)
+	}
+	for _, project := range projects {
+		if err := m.sources.Compose.ImportProject(ctx, project); err != nil {
+			return fmt.Errorf("project %s: %w", project.Name, err)
+		}
+	}
+	return nil
+}
+
+// restoreFiles 把归档中的文件写回 paths 记录的原路径（追加 suffix）
+func restoreFiles(files map[string]archiveFile, paths map[string]string, suffix string) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target, ok := paths[name]
+		if !ok {
+			continue
+		}
+		if err := writeFileAtomic(target+suffix, files[name].data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再改名，避免留下写了一半的文件
+func writeFileAtomic(path string, data []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ApplyStagedRestores 用 <数据库>.restore 替换数据库文件，应在打开数据库之前调用；
+// 原来的数据库和 WAL 文件改名为 .before-restore 保留，返回替换了的数据库
+func ApplyStagedRestores(paths []string) ([]string, error) {
+	var applied []string
+	seen := make(map[string]bool)
+	for _, database := range paths {
+		if database == "" || seen[database] {
+			continue
+		}
+		seen[database] = true
+		staged := database + StagedRestoreSuffix
+		if _, err := os.Stat(staged); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return applied, err
+		}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(database+suffix, database+replacedSuffix+suffix); err != nil && !os.IsNotExist(err) {
+				return applied, err
+			}
+		}
+		if err := os.Rename(staged, database); err != nil {
+			return applied, err
+		}
+		applied = append(applied, database)
+	}
+	return applied, nil
+}
+
+func (m *ConfigBackupManager) findBackup(backupID string) (*ConfigBackup, error) {
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range index {
+		if backup.ID == backupID {
+			return backup, nil
+		}
+	}
+	return nil, ErrConfigBackupNotFound
+}
+
+// loadIndex 读取备份索引
+func (m *ConfigBackupManager) loadIndex() ([]*ConfigBackup, error) {
+	data, err := os.ReadFile(filepath.Join(m.dir, configBackupIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup index: %w", err)
+	}
+
+	var index []*ConfigBackup
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse backup index: %w", err)
+	}
+	return index, nil
+}
+
+// saveIndex 原子写入备份索引
+func (m *ConfigBackupManager) saveIndex(index []*ConfigBackup) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(m.dir, configBackupIndexFile), data, 0640); err != nil {
+		return fmt.Errorf("failed to write backup index: %w", err)
+	}
+	return nil
+}
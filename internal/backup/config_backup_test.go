@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"qwq/internal/config"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+// fakeComposeStore 内存中的 Compose 项目
+type fakeComposeStore struct {
+	projects []ComposeProjectFile
+	imported []ComposeProjectFile
+}
+
+func (f *fakeComposeStore) ExportProjects(ctx context.Context) ([]ComposeProjectFile, error) {
+	return f.projects, nil
+}
+
+func (f *fakeComposeStore) ImportProject(ctx context.Context, project ComposeProjectFile) error {
+	f.imported = append(f.imported, project)
+	return nil
+}
+
+// fakeNginx 记录 nginx 调用，testErr 非空时 nginx -t 失败
+type fakeNginx struct {
+	calls   []string
+	testErr error
+}
+
+func (f *fakeNginx) run(ctx context.Context, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, strings.Join(args, " "))
+	if args[0] == "-t" && f.testErr != nil {
+		return []byte("nginx: [emerg] unexpected end of file"), f.testErr
+	}
+	return nil, nil
+}
+
+// openTestDB 在 path 创建 SQLite 数据库并写入一行
+func openTestDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE items (name TEXT)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO items VALUES ('before')").Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testSources 包含全部组件的备份来源
+func testSources(t *testing.T, dir string) (ConfigSources, *fakeComposeStore) {
+	t.Helper()
+	nginxDir := filepath.Join(dir, "sites")
+	os.MkdirAll(filepath.Join(nginxDir, "snippets"), 0755)
+	os.WriteFile(filepath.Join(nginxDir, "a.com.conf"), []byte("server { listen 80; }\n"), 0644)
+	os.WriteFile(filepath.Join(nginxDir, "snippets", "ssl.conf"), []byte("ssl_protocols TLSv1.3;\n"), 0644)
+
+	configFile := filepath.Join(dir, "config.json")
+	os.WriteFile(configFile, []byte(`{"web_user":"admin"}`), 0600)
+
+	dbPath := filepath.Join(dir, "qwq.db")
+	store := &fakeComposeStore{projects: []ComposeProjectFile{{Name: "shop", TenantID: 1, Content: "services:\n  web:\n    image: nginx\n"}}}
+	return ConfigSources{
+		NginxDir:    nginxDir,
+		Compose:     store,
+		Databases:   []DatabaseFile{{Path: dbPath, DB: openTestDB(t, dbPath)}, {Path: dbPath}},
+		ConfigFiles: []string{configFile, filepath.Join(dir, "missing-overrides.json")},
+	}, store
+}
+
+func TestConfigBackup_BackupAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	sources, _ := testSources(t, dir)
+	manager := NewConfigBackupManager(config.BackupConfig{Dir: filepath.Join(dir, "backups"), Retention: 2}, sources, (&fakeNginx{}).run)
+
+	first, err := manager.Backup(context.Background(), "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]string{}
+	for _, component := range first.Components {
+		files[component.Name] = component.Files
+	}
+	if strings.Join(files[ComponentNginx], ",") != "nginx/a.com.conf,nginx/snippets/ssl.conf" ||
+		strings.Join(files[ComponentCompose], ",") != "compose/projects.json" ||
+		strings.Join(files[ComponentDatabase], ",") != "database/qwq.db" ||
+		strings.Join(files[ComponentConfig], ",") != "config/config.json" {
+		t.Fatalf("Unexpected backup components %+v", files)
+	}
+	if first.Size == 0 || first.Checksum == "" || first.Trigger != "manual" {
+		t.Errorf("Expected size and checksum to be recorded, got %+v", first)
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		created, err := manager.Backup(context.Background(), "scheduled")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, created.ID)
+	}
+	backups, err := manager.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].ID != ids[2] || backups[1].ID != ids[1] {
+		t.Fatalf("Expected the two newest backups, got %+v", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backups", first.File)); !os.IsNotExist(err) {
+		t.Errorf("Expected the pruned archive to be removed, got %v", err)
+	}
+	if latest, _ := manager.Latest(); latest == nil || latest.ID != ids[2] {
+		t.Errorf("Expected the newest backup as latest, got %+v", latest)
+	}
+}
+
+func TestConfigBackup_RestoreNginx(t *testing.T) {
+	dir := t.TempDir()
+	sources, _ := testSources(t, dir)
+	nginx := &fakeNginx{}
+	manager := NewConfigBackupManager(config.BackupConfig{Dir: filepath.Join(dir, "backups")}, sources, nginx.run)
+	created, err := manager.Backup(context.Background(), "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site := filepath.Join(sources.NginxDir, "a.com.conf")
+	extra := filepath.Join(sources.NginxDir, "b.com.conf")
+	os.WriteFile(site, []byte("server { listen 8080; }\n"), 0644)
+	os.WriteFile(extra, []byte("server {}\n"), 0644)
+
+	// nginx -t 失败时回滚到恢复前的文件，不重载
+	nginx.testErr = errors.New("exit status 1")
+	_, err = manager.Restore(context.Background(), created.ID, ComponentNginx)
+	if !errors.Is(err, ErrNginxTestFailed) || !strings.Contains(err.Error(), "unexpected end of file") {
+		t.Fatalf("Expected ErrNginxTestFailed with the nginx output, got %v", err)
+	}
+	if data, _ := os.ReadFile(site); string(data) != "server { listen 8080; }\n" {
+		t.Errorf("Expected the site to be rolled back, got %q", data)
+	}
+	if _, err := os.Stat(extra); err != nil {
+		t.Errorf("Expected the extra site to be restored by the rollback, got %v", err)
+	}
+	if strings.Join(nginx.calls, ",") != "-t" {
+		t.Errorf("Expected no reload after a failed test, got %v", nginx.calls)
+	}
+
+	nginx.testErr, nginx.calls = nil, nil
+	result, err := manager.Restore(context.Background(), created.ID, ComponentNginx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(site); string(data) != "server { listen 80; }\n" {
+		t.Errorf("Expected the backed up site, got %q", data)
+	}
+	if _, err := os.Stat(extra); !os.IsNotExist(err) {
+		t.Errorf("Expected the site added after the backup to be removed, got %v", err)
+	}
+	if strings.Join(nginx.calls, ",") != "-t,-s reload" || result.RestartRequired {
+		t.Errorf("Expected nginx to be tested then reloaded, got %v %+v", nginx.calls, result)
+	}
+}
+
+func TestConfigBackup_RestoreComponents(t *testing.T) {
+	dir := t.TempDir()
+	sources, store := testSources(t, dir)
+	manager := NewConfigBackupManager(config.BackupConfig{Dir: filepath.Join(dir, "backups")}, sources, (&fakeNginx{}).run)
+	created, err := manager.Backup(context.Background(), "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, component := range []string{"", "all", "nginx,compose"} {
+		if _, err := manager.Restore(context.Background(), created.ID, component); !errors.Is(err, ErrInvalidComponent) {
+			t.Errorf("Expected ErrInvalidComponent for %q, got %v", component, err)
+		}
+	}
+	if _, err := manager.Restore(context.Background(), "missing", ComponentCompose); !errors.Is(err, ErrConfigBackupNotFound) {
+		t.Errorf("Expected ErrConfigBackupNotFound, got %v", err)
+	}
+
+	if _, err := manager.Restore(context.Background(), created.ID, ComponentCompose); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.imported) != 1 || store.imported[0].Name != "shop" || store.imported[0].TenantID != 1 {
+		t.Errorf("Expected the project to be imported, got %+v", store.imported)
+	}
+
+	configFile := sources.ConfigFiles[0]
+	os.WriteFile(configFile, []byte(`{"web_user":"changed"}`), 0600)
+	result, err := manager.Restore(context.Background(), created.ID, ComponentConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configFile); string(data) != `{"web_user":"admin"}` || !result.RestartRequired {
+		t.Errorf("Expected the config file to be restored, got %q %+v", data, result)
+	}
+
+	// 数据库在下次启动打开之前替换
+	dbPath := sources.Databases[0].Path
+	if err := sources.Databases[0].DB.Exec("UPDATE items SET name = 'after'").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Restore(context.Background(), created.ID, ComponentDatabase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dbPath + StagedRestoreSuffix); err != nil {
+		t.Fatalf("Expected the database to be staged, got %v", err)
+	}
+	sqlDB, _ := sources.Databases[0].DB.DB()
+	sqlDB.Close()
+
+	applied, err := ApplyStagedRestores([]string{dbPath, dbPath, filepath.Join(dir, "other.db")})
+	if err != nil || len(applied) != 1 || applied[0] != dbPath {
+		t.Fatalf("Expected one staged database to be applied, got %v %v", applied, err)
+	}
+	if _, err := os.Stat(dbPath + ".before-restore"); err != nil {
+		t.Errorf("Expected the replaced database to be kept, got %v", err)
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var name string
+	if err := db.QueryRow("SELECT name FROM items").Scan(&name); err != nil || name != "before" {
+		t.Errorf("Expected the backed up row, got %q %v", name, err)
+	}
+}
@@ -0,0 +1,526 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+)
+
+// 卷快照默认参数
+const (
+	DefaultSnapshotDir         = "/var/backups/qwq/snapshots"
+	DefaultSnapshotRetention   = 5
+	DefaultSnapshotQuotaMB     = 10240
+	DefaultSnapshotHelperImage = "alpine:3.19"
+
+	snapshotIndexFile = "snapshots.json"
+)
+
+var (
+	// ErrSnapshotNotFound 快照不存在
+	ErrSnapshotNotFound = errors.New("快照不存在")
+
+	// ErrNoVolumes 容器没有命名卷
+	ErrNoVolumes = errors.New("容器没有可快照的命名卷")
+
+	// ErrSnapshotQuota 快照超出容量上限
+	ErrSnapshotQuota = errors.New("快照超出容量上限")
+
+	// containerRefRegex 容器 ID 或名称的合法字符
+	containerRefRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// VolumeSnapshot 容器卷快照
+type VolumeSnapshot struct {
+	ID        string          `json:"id"`
+	Container string          `json:"container"`
+	Volumes   []VolumeArchive `json:"volumes"`
+	TotalSize int64           `json:"total_size"`
+	Note      string          `json:"note,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// VolumeArchive 单个卷的归档文件
+type VolumeArchive struct {
+	Volume      string `json:"volume"`
+	Destination string `json:"destination"` // 卷在容器内的挂载路径
+	File        string `json:"file"`        // 归档文件名（相对快照目录）
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum"`
+}
+
+// DockerRunner 执行 docker 命令
+// 抽象出来以便测试，且避免通过 shell 拼接用户输入
+type DockerRunner interface {
+	// Output 执行命令并返回标准输出
+	Output(ctx context.Context, args ...string) ([]byte, error)
+	// Stream 执行命令，使用给定的标准输入输出
+	Stream(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) error
+}
+
+// execDockerRunner 基于 docker CLI 的实现
+type execDockerRunner struct{}
+
+func (execDockerRunner) Output(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "docker", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return out, fmt.Errorf("docker %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+func (execDockerRunner) Stream(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// VolumeSnapshotManager 容器卷快照管理器
+// 通过挂载卷的辅助容器以流的方式打包/解包，不依赖宿主机上的卷路径
+type VolumeSnapshotManager struct {
+	dir         string
+	retention   int
+	quota       int64
+	helperImage string
+	docker      DockerRunner
+	now         func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewVolumeSnapshotManager 创建卷快照管理器，零值参数使用默认值
+func NewVolumeSnapshotManager(cfg config.SnapshotConfig, docker DockerRunner) *VolumeSnapshotManager {
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultSnapshotDir
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultSnapshotRetention
+	}
+	if cfg.QuotaMB <= 0 {
+		cfg.QuotaMB = DefaultSnapshotQuotaMB
+	}
+	if cfg.HelperImage == "" {
+		cfg.HelperImage = DefaultSnapshotHelperImage
+	}
+	if docker == nil {
+		docker = execDockerRunner{}
+	}
+	return &VolumeSnapshotManager{
+		dir:         cfg.Dir,
+		retention:   cfg.Retention,
+		quota:       cfg.QuotaMB * 1024 * 1024,
+		helperImage: cfg.HelperImage,
+		docker:      docker,
+		now:         time.Now,
+	}
+}
+
+var (
+	defaultSnapshotManager     *VolumeSnapshotManager
+	defaultSnapshotManagerOnce sync.Once
+)
+
+// DefaultSnapshotManager 获取基于全局配置的快照管理器
+func DefaultSnapshotManager() *VolumeSnapshotManager {
+	defaultSnapshotManagerOnce.Do(func() {
+		defaultSnapshotManager = NewVolumeSnapshotManager(config.Current().Snapshot, nil)
+	})
+	return defaultSnapshotManager
+}
+
+// dockerMount docker inspect 输出的挂载信息
+type dockerMount struct {
+	Type        string `json:"Type"`
+	Name        string `json:"Name"`
+	Destination string `json:"Destination"`
+}
+
+// containerVolumes 获取容器的命名卷
+func (m *VolumeSnapshotManager) containerVolumes(ctx context.Context, container string) ([]dockerMount, error) {
+	out, err := m.docker.Output(ctx, "inspect", "--format", "{{json .Mounts}}", container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	var mounts []dockerMount
+	if err := json.Unmarshal(out, &mounts); err != nil {
+		return nil, fmt.Errorf("failed to parse container mounts: %w", err)
+	}
+
+	var volumes []dockerMount
+	for _, mount := range mounts {
+		if mount.Type == "volume" && mount.Name != "" {
+			volumes = append(volumes, mount)
+		}
+	}
+	return volumes, nil
+}
+
+// CreateSnapshot 为容器的所有命名卷创建快照
+// 卷以只读方式挂载到辅助容器中打包，完成后执行保留策略和容量检查
+func (m *VolumeSnapshotManager) CreateSnapshot(ctx context.Context, container, note string) (*VolumeSnapshot, error) {
+	if !containerRefRegex.MatchString(container) {
+		return nil, fmt.Errorf("invalid container reference: %q", container)
+	}
+
+	volumes, err := m.containerVolumes(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) == 0 {
+		return nil, ErrNoVolumes
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	snapshot := &VolumeSnapshot{
+		ID:        snapshotID(index, container, now),
+		Container: container,
+		Note:      note,
+		CreatedAt: now,
+	}
+
+	for _, volume := range volumes {
+		archive, err := m.archiveVolume(ctx, snapshot.ID, volume)
+		if err != nil {
+			m.removeArchives(snapshot)
+			return nil, fmt.Errorf("%w: volume %s: %v", ErrBackupFailed, volume.Name, err)
+		}
+		snapshot.Volumes = append(snapshot.Volumes, *archive)
+		snapshot.TotalSize += archive.Size
+	}
+
+	// 新快照本身超出上限时直接丢弃，不清理任何已有快照
+	if snapshot.TotalSize > m.quota {
+		m.removeArchives(snapshot)
+		return nil, fmt.Errorf("%w: snapshot size %d bytes, quota %d bytes", ErrSnapshotQuota, snapshot.TotalSize, m.quota)
+	}
+
+	index = append(index, snapshot)
+	index = m.applyRetention(index, container)
+	index = m.applyQuota(index, snapshot)
+
+	if err := m.saveIndex(index); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// archiveVolume 将单个卷打包为 tar.gz
+func (m *VolumeSnapshotManager) archiveVolume(ctx context.Context, snapshotID string, volume dockerMount) (*VolumeArchive, error) {
+	fileName := fmt.Sprintf("%s_%s.tar.gz", snapshotID, volume.Name)
+	path := filepath.Join(m.dir, fileName)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	writer := io.MultiWriter(file, hasher, counter)
+
+	err = m.docker.Stream(ctx, nil, writer,
+		"run", "--rm", "--network", "none",
+		"-v", volume.Name+":/volume:ro",
+		m.helperImage, "tar", "czf", "-", "-C", "/volume", ".")
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &VolumeArchive{
+		Volume:      volume.Name,
+		Destination: volume.Destination,
+		File:        fileName,
+		Size:        counter.n,
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// RestoreSnapshot 从快照恢复容器的卷
+// 先停止容器，清空并解包每个卷，最后重新启动容器（即使恢复失败也会尝试启动）
+func (m *VolumeSnapshotManager) RestoreSnapshot(ctx context.Context, snapshotID string) (*VolumeSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot, err := m.findSnapshot(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.docker.Output(ctx, "stop", snapshot.Container); err != nil {
+		return nil, fmt.Errorf("%w: failed to stop container: %v", ErrRestoreFailed, err)
+	}
+
+	var restoreErr error
+	for _, archive := range snapshot.Volumes {
+		if err := m.restoreVolume(ctx, archive); err != nil {
+			restoreErr = fmt.Errorf("%w: volume %s: %v", ErrRestoreFailed, archive.Volume, err)
+			break
+		}
+	}
+
+	if _, err := m.docker.Output(ctx, "start", snapshot.Container); err != nil && restoreErr == nil {
+		restoreErr = fmt.Errorf("%w: failed to start container: %v", ErrRestoreFailed, err)
+	}
+	if restoreErr != nil {
+		return nil, restoreErr
+	}
+	return snapshot, nil
+}
+
+// restoreVolume 校验归档并解包到卷中
+func (m *VolumeSnapshotManager) restoreVolume(ctx context.Context, archive VolumeArchive) error {
+	path := filepath.Join(m.dir, archive.File)
+	checksum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if checksum != archive.Checksum {
+		return fmt.Errorf("checksum mismatch for %s", archive.File)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return m.docker.Stream(ctx, file, io.Discard,
+		"run", "--rm", "-i", "--network", "none",
+		"-v", archive.Volume+":/volume",
+		m.helperImage, "sh", "-c", "find /volume -mindepth 1 -delete && tar xzf - -C /volume")
+}
+
+// ListSnapshots 列出快照（最新的在前），container 为空时列出全部
+func (m *VolumeSnapshotManager) ListSnapshots(container string) ([]*VolumeSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*VolumeSnapshot
+	for i := len(index) - 1; i >= 0; i-- {
+		if container == "" || index[i].Container == container {
+			result = append(result, index[i])
+		}
+	}
+	return result, nil
+}
+
+// DeleteSnapshot 删除快照及其归档文件
+func (m *VolumeSnapshotManager) DeleteSnapshot(snapshotID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return err
+	}
+	for i, snapshot := range index {
+		if snapshot.ID == snapshotID {
+			m.removeArchives(snapshot)
+			return m.saveIndex(append(index[:i], index[i+1:]...))
+		}
+	}
+	return ErrSnapshotNotFound
+}
+
+// Usage 获取快照目录已用空间（字节）
+func (m *VolumeSnapshotManager) Usage() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return 0, err
+	}
+	return totalSnapshotSize(index), nil
+}
+
+// applyRetention 每个容器只保留最近 retention 个快照，创建时间相同时按写入索引的顺序判断新旧
+func (m *VolumeSnapshotManager) applyRetention(index []*VolumeSnapshot, container string) []*VolumeSnapshot {
+	count := 0
+	pruned := make(map[*VolumeSnapshot]bool)
+	for i := len(index) - 1; i >= 0; i-- {
+		if index[i].Container == container {
+			count++
+			if count > m.retention {
+				pruned[index[i]] = true
+			}
+		}
+	}
+	kept := make([]*VolumeSnapshot, 0, len(index))
+	for _, snapshot := range index {
+		if pruned[snapshot] {
+			m.removeArchives(snapshot)
+			continue
+		}
+		kept = append(kept, snapshot)
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].CreatedAt.Before(kept[j].CreatedAt) })
+	return kept
+}
+
+// applyQuota 超出容量上限时从最旧的快照开始删除，不删除新快照
+// 调用前已确认新快照本身不超出上限，因此总能降到上限以内
+func (m *VolumeSnapshotManager) applyQuota(index []*VolumeSnapshot, latest *VolumeSnapshot) []*VolumeSnapshot {
+	for totalSnapshotSize(index) > m.quota {
+		evicted := false
+		for i, snapshot := range index {
+			if snapshot != latest {
+				m.removeArchives(snapshot)
+				index = append(index[:i], index[i+1:]...)
+				evicted = true
+				break
+			}
+		}
+		if !evicted {
+			break
+		}
+	}
+	return index
+}
+
+// snapshotID 按容器名和创建时间（毫秒）生成快照 ID，同一毫秒内已有相同 ID 时追加序号，
+// 避免归档文件互相覆盖
+func snapshotID(index []*VolumeSnapshot, container string, now time.Time) string {
+	base := fmt.Sprintf("%s-%s", container, now.Format("20060102-150405.000"))
+	taken := make(map[string]bool, len(index))
+	for _, snapshot := range index {
+		taken[snapshot.ID] = true
+	}
+	id := base
+	for seq := 2; taken[id]; seq++ {
+		id = fmt.Sprintf("%s-%d", base, seq)
+	}
+	return id
+}
+
+func (m *VolumeSnapshotManager) findSnapshot(snapshotID string) (*VolumeSnapshot, error) {
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range index {
+		if snapshot.ID == snapshotID {
+			return snapshot, nil
+		}
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+func (m *VolumeSnapshotManager) removeArchives(snapshot *VolumeSnapshot) {
+	for _, archive := range snapshot.Volumes {
+		os.Remove(filepath.Join(m.dir, archive.File))
+	}
+}
+
+// loadIndex 读取快照索引
+func (m *VolumeSnapshotManager) loadIndex() ([]*VolumeSnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(m.dir, snapshotIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot index: %w", err)
+	}
+
+	var index []*VolumeSnapshot
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot index: %w", err)
+	}
+	return index, nil
+}
+
+// saveIndex 原子写入快照索引
+func (m *VolumeSnapshotManager) saveIndex(index []*VolumeSnapshot) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(m.dir, snapshotIndexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return fmt.Errorf("failed to write snapshot index: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func totalSnapshotSize(index []*VolumeSnapshot) int64 {
+	var total int64
+	for _, snapshot := range index {
+		total += snapshot.TotalSize
+	}
+	return total
+}
+
+// fileSHA256 计算文件的 SHA-256
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// countingWriter 统计写入字节数
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,184 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+)
+
+// fakeDocker 模拟 docker 命令，记录调用并为 tar 打包输出固定内容
+type fakeDocker struct {
+	mounts   string
+	archive  string
+	calls    []string
+	restored map[string]string
+}
+
+func (f *fakeDocker) Output(ctx context.Context, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, strings.Join(args, " "))
+	if args[0] == "inspect" {
+		return []byte(f.mounts), nil
+	}
+	return nil, nil
+}
+
+func (f *fakeDocker) Stream(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) error {
+	f.calls = append(f.calls, strings.Join(args, " "))
+	var volume string
+	for i, arg := range args {
+		if arg == "-v" {
+			volume = strings.SplitN(args[i+1], ":", 2)[0]
+		}
+	}
+	if stdin != nil {
+		data, _ := io.ReadAll(stdin)
+		if f.restored == nil {
+			f.restored = make(map[string]string)
+		}
+		f.restored[volume] = string(data)
+		return nil
+	}
+	_, err := io.WriteString(stdout, f.archive+"-"+volume)
+	return err
+}
+
+const testMounts = `[{"Type":"volume","Name":"pgdata","Destination":"/var/lib/postgresql/data"},{"Type":"bind","Source":"/etc/hosts","Destination":"/etc/hosts"}]`
+
+func TestVolumeSnapshot_CreateAndRestore(t *testing.T) {
+	docker := &fakeDocker{mounts: testMounts, archive: "data"}
+	manager := NewVolumeSnapshotManager(config.SnapshotConfig{Dir: t.TempDir()}, docker)
+
+	snapshot, err := manager.CreateSnapshot(context.Background(), "db", "before migration")
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	if len(snapshot.Volumes) != 1 || snapshot.Volumes[0].Volume != "pgdata" {
+		t.Fatalf("Expected only the named volume to be archived, got %+v", snapshot.Volumes)
+	}
+	if snapshot.TotalSize != int64(len("data-pgdata")) {
+		t.Errorf("Unexpected snapshot size %d", snapshot.TotalSize)
+	}
+	if !strings.Contains(docker.calls[1], "pgdata:/volume:ro") {
+		t.Errorf("Expected volume to be mounted read-only, got %s", docker.calls[1])
+	}
+
+	docker.calls = nil
+	if _, err := manager.RestoreSnapshot(context.Background(), snapshot.ID); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	if docker.restored["pgdata"] != "data-pgdata" {
+		t.Errorf("Expected archive to be streamed back, got %q", docker.restored["pgdata"])
+	}
+	if len(docker.calls) != 3 || docker.calls[0] != "stop db" || docker.calls[2] != "start db" {
+		t.Errorf("Expected stop, restore, start; got %v", docker.calls)
+	}
+}
+
+func TestVolumeSnapshot_NoVolumes(t *testing.T) {
+	docker := &fakeDocker{mounts: `[{"Type":"bind","Destination":"/data"}]`}
+	manager := NewVolumeSnapshotManager(config.SnapshotConfig{Dir: t.TempDir()}, docker)
+
+	if _, err := manager.CreateSnapshot(context.Background(), "web", ""); !errors.Is(err, ErrNoVolumes) {
+		t.Errorf("Expected ErrNoVolumes, got %v", err)
+	}
+}
+
+func TestVolumeSnapshot_Retention(t *testing.T) {
+	docker := &fakeDocker{mounts: testMounts, archive: "data"}
+	dir := t.TempDir()
+	manager := NewVolumeSnapshotManager(config.SnapshotConfig{Dir: dir, Retention: 2}, docker)
+	// 固定时钟：同一毫秒内创建的快照也要有不同的 ID 和归档文件
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		snapshot, err := manager.CreateSnapshot(context.Background(), "db", "")
+		if err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+		ids = append(ids, snapshot.ID)
+	}
+	if ids[0] == ids[1] || ids[1] == ids[2] || ids[0] == ids[2] {
+		t.Fatalf("Expected unique snapshot IDs, got %v", ids)
+	}
+
+	snapshots, _ := manager.ListSnapshots("db")
+	if len(snapshots) != 2 || snapshots[0].ID != ids[2] || snapshots[1].ID != ids[1] {
+		t.Fatalf("Expected the 2 newest snapshots to be kept, got %d", len(snapshots))
+	}
+	if _, err := manager.RestoreSnapshot(context.Background(), ids[0]); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected pruned snapshot to be gone, got %v", err)
+	}
+	for _, snapshot := range snapshots {
+		if _, err := manager.RestoreSnapshot(context.Background(), snapshot.ID); err != nil {
+			t.Errorf("Expected kept snapshot %s to be restorable: %v", snapshot.ID, err)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tar.gz")); len(files) != 2 {
+		t.Errorf("Expected only the kept archives on disk, got %v", files)
+	}
+}
+
+func TestVolumeSnapshot_Quota(t *testing.T) {
+	docker := &fakeDocker{mounts: testMounts, archive: strings.Repeat("x", 1024*1024)}
+	manager := NewVolumeSnapshotManager(config.SnapshotConfig{Dir: t.TempDir(), QuotaMB: 1}, docker)
+
+	if _, err := manager.CreateSnapshot(context.Background(), "db", ""); !errors.Is(err, ErrSnapshotQuota) {
+		t.Fatalf("Expected ErrSnapshotQuota, got %v", err)
+	}
+	if usage, _ := manager.Usage(); usage != 0 {
+		t.Errorf("Oversized snapshot should be removed, usage=%d", usage)
+	}
+}
+
+func TestVolumeSnapshot_OversizedSnapshotKeepsExisting(t *testing.T) {
+	docker := &fakeDocker{mounts: testMounts, archive: strings.Repeat("x", 300*1024)}
+	manager := NewVolumeSnapshotManager(config.SnapshotConfig{Dir: t.TempDir(), QuotaMB: 1}, docker)
+
+	var existing []string
+	for _, container := range []string{"db", "cache", "db"} {
+		snapshot, err := manager.CreateSnapshot(context.Background(), container, "")
+		if err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+		existing = append(existing, snapshot.ID)
+	}
+	before, _ := manager.Usage()
+
+	// 新快照本身超出上限时拒绝，已有快照全部保留
+	docker.archive = strings.Repeat("x", 2*1024*1024)
+	if _, err := manager.CreateSnapshot(context.Background(), "db", ""); !errors.Is(err, ErrSnapshotQuota) {
+		t.Fatalf("Expected ErrSnapshotQuota, got %v", err)
+	}
+	snapshots, _ := manager.ListSnapshots("")
+	if len(snapshots) != len(existing) {
+		t.Fatalf("Expected the existing %d snapshots to be kept, got %d", len(existing), len(snapshots))
+	}
+	for _, id := range existing {
+		if _, err := manager.RestoreSnapshot(context.Background(), id); err != nil {
+			t.Errorf("Expected snapshot %s to survive: %v", id, err)
+		}
+	}
+	if usage, _ := manager.Usage(); usage != before {
+		t.Errorf("Expected usage to stay at %d, got %d", before, usage)
+	}
+
+	// 未超出上限的新快照只淘汰最旧的快照
+	docker.archive = strings.Repeat("x", 500*1024)
+	if _, err := manager.CreateSnapshot(context.Background(), "cache", ""); err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	if _, err := manager.RestoreSnapshot(context.Background(), existing[0]); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected the oldest snapshot to be evicted, got %v", err)
+	}
+	if usage, _ := manager.Usage(); usage > 1024*1024 {
+		t.Errorf("Expected usage within quota, got %d", usage)
+	}
+}
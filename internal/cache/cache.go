@@ -0,0 +1,295 @@
+// Package cache 进程内的键值缓存：按命名空间隔离，支持条目过期时间、最大条目数 LRU 淘汰，
+// 可选地延迟写入数据库，重启后恢复未过期的条目
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultMaxEntries 未设置 MaxEntries 时每个命名空间最多保留的条目数
+const DefaultMaxEntries = 1024
+
+// 各命名空间的命中、未命中、淘汰次数和当前条目数，由 /metrics 导出
+var (
+	hitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qwq_cache_hits_total",
+		Help: "Total cache hits",
+	}, []string{"namespace"})
+	missesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qwq_cache_misses_total",
+		Help: "Total cache misses, including expired entries",
+	}, []string{"namespace"})
+	evictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qwq_cache_evictions_total",
+		Help: "Total entries evicted because the namespace reached its size limit",
+	}, []string{"namespace"})
+	entriesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "qwq_cache_entries",
+		Help: "Current number of cached entries",
+	}, []string{"namespace"})
+)
+
+// Options 命名空间的缓存参数
+type Options struct {
+	MaxEntries int           // 最多保留的条目数，超出时淘汰最久未访问的条目，0 表示 DefaultMaxEntries
+	TTL        time.Duration // Set 使用的默认过期时间，0 表示不过期
+}
+
+// Stats 命名空间的缓存统计
+type Stats struct {
+	Namespace  string `json:"namespace"`
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"`
+}
+
+// item 一个缓存条目
+type item[V any] struct {
+	key     string
+	value   V
+	expires time.Time // 零值表示不过期
+}
+
+// Cache 一个命名空间的缓存，并发安全
+type Cache[V any] struct {
+	namespace  string
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu    sync.Mutex
+	lru   *list.List // 最近访问的条目在前
+	items map[string]*list.Element
+	dirty map[string]struct{} // 上次写入数据库后修改或删除的键，仅在注册到 Store 时记录
+
+	hits, misses, evictions               atomic.Uint64
+	hitCounter, missCounter, evictCounter prometheus.Counter
+	entries                               prometheus.Gauge
+}
+
+// New 创建命名空间缓存；store 非空时注册到该 Store，条目随 Store 持久化，同一 Store 中的命名空间不能重复
+func New[V any](store *Store, namespace string, opts Options) *Cache[V] {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	c := &Cache[V]{
+		namespace:    namespace,
+		maxEntries:   opts.MaxEntries,
+		ttl:          opts.TTL,
+		now:          time.Now,
+		lru:          list.New(),
+		items:        make(map[string]*list.Element),
+		hitCounter:   hitsTotal.WithLabelValues(namespace),
+		missCounter:  missesTotal.WithLabelValues(namespace),
+		evictCounter: evictionsTotal.WithLabelValues(namespace),
+		entries:      entriesGauge.WithLabelValues(namespace),
+	}
+	if store != nil {
+		c.dirty = make(map[string]struct{})
+		store.register(c)
+	}
+	return c
+}
+
+// Namespace 命名空间名称
+func (c *Cache[V]) Namespace() string {
+	return c.namespace
+}
+
+// Get 读取未过期的条目
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		it := elem.Value.(*item[V])
+		if it.expires.IsZero() || c.now().Before(it.expires) {
+			c.lru.MoveToFront(elem)
+			value := it.value
+			c.mu.Unlock()
+			c.hits.Add(1)
+			c.hitCounter.Inc()
+			return value, true
+		}
+		c.removeLocked(elem)
+	}
+	c.mu.Unlock()
+	c.misses.Add(1)
+	c.missCounter.Inc()
+	var zero V
+	return zero, false
+}
+
+// Set 写入条目，使用命名空间的默认过期时间
+func (c *Cache[V]) Set(key string, value V) {
+	c.SetTTL(key, value, c.ttl)
+}
+
+// SetTTL 写入条目并指定过期时间，ttl 为 0 表示不过期
+func (c *Cache[V]) SetTTL(key string, value V, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(key, value, expires)
+	c.markLocked(key)
+}
+
+// putLocked 写入条目并在超出上限时淘汰最久未访问的条目，调用方持有锁
+func (c *Cache[V]) putLocked(key string, value V, expires time.Time) {
+	if elem, ok := c.items[key]; ok {
+		it := elem.Value.(*item[V])
+		it.value, it.expires = value, expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&item[V]{key: key, value: value, expires: expires})
+	for c.lru.Len() > c.maxEntries {
+		c.removeLocked(c.lru.Back())
+		c.evictions.Add(1)
+		c.evictCounter.Inc()
+	}
+	c.entries.Set(float64(c.lru.Len()))
+}
+
+// Delete 删除条目
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeLocked(elem)
+	}
+}
+
+// removeLocked 移除条目，调用方持有锁
+func (c *Cache[V]) removeLocked(elem *list.Element) {
+	it := c.lru.Remove(elem).(*item[V])
+	delete(c.items, it.key)
+	c.markLocked(it.key)
+	c.entries.Set(float64(c.lru.Len()))
+}
+
+// markLocked 记录需要写入数据库的键，调用方持有锁
+func (c *Cache[V]) markLocked(key string) {
+	if c.dirty != nil {
+		c.dirty[key] = struct{}{}
+	}
+}
+
+// Keys 所有未过期条目的键，最近访问的在前
+func (c *Cache[V]) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	keys := make([]string, 0, c.lru.Len())
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		if it := elem.Value.(*item[V]); it.expires.IsZero() || now.Before(it.expires) {
+			keys = append(keys, it.key)
+		}
+	}
+	return keys
+}
+
+// Len 当前条目数（包括已过期但尚未清理的条目）
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Stats 命名空间的缓存统计
+func (c *Cache[V]) Stats() Stats {
+	return Stats{
+		Namespace:  c.namespace,
+		Entries:    c.Len(),
+		MaxEntries: c.maxEntries,
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Evictions:  c.evictions.Load(),
+	}
+}
+
+// prune 清理已过期的条目
+func (c *Cache[V]) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if it := elem.Value.(*item[V]); !it.expires.IsZero() && !now.Before(it.expires) {
+			c.removeLocked(elem)
+		}
+		elem = next
+	}
+}
+
+// pending 取出上次写入后修改的条目和删除的键，并清空修改记录
+func (c *Cache[V]) pending() ([]Entry, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var upserts []Entry
+	var deletes []string
+	for key := range c.dirty {
+		elem, ok := c.items[key]
+		if !ok {
+			deletes = append(deletes, key)
+			continue
+		}
+		it := elem.Value.(*item[V])
+		data, err := json.Marshal(it.value)
+		if err != nil {
+			// 无法编码的值只保留在内存中
+			continue
+		}
+		entry := Entry{Namespace: c.namespace, Key: key, Value: data}
+		if !it.expires.IsZero() {
+			expires := it.expires
+			entry.ExpiresAt = &expires
+		}
+		upserts = append(upserts, entry)
+	}
+	clear(c.dirty)
+	return upserts, deletes
+}
+
+// requeue 写入数据库失败时重新记录这些键，下次写入时重试
+func (c *Cache[V]) requeue(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		c.dirty[key] = struct{}{}
+	}
+}
+
+// restore 从数据库恢复条目，已过期或无法解码的条目跳过，内存中已有的条目不会被覆盖
+func (c *Cache[V]) restore(entries []Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, entry := range entries {
+		if _, ok := c.items[entry.Key]; ok {
+			continue
+		}
+		var expires time.Time
+		if entry.ExpiresAt != nil {
+			if !now.Before(*entry.ExpiresAt) {
+				continue
+			}
+			expires = *entry.ExpiresAt
+		}
+		var value V
+		if err := json.Unmarshal(entry.Value, &value); err != nil {
+			continue
+		}
+		c.putLocked(entry.Key, value, expires)
+	}
+}
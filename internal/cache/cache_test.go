@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+type fact struct {
+	Host  string `json:"host"`
+	Cores int    `json:"cores"`
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&Entry{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestCache_TTLAndEviction(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New[int](nil, "test.ttl", Options{MaxEntries: 2, TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1)
+	c.SetTTL("b", 2, 0)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Expected a=1, got %d %v", v, ok)
+	}
+	// a 刚被访问，写入 c 时淘汰最久未访问的 b
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Expected a to expire after its TTL")
+	}
+	c.Delete("c")
+	stats := c.Stats()
+	if stats.Entries != 0 || stats.Hits != 1 || stats.Misses != 2 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	c := New[string](NewStore(), "test.concurrent", Options{MaxEntries: 64, TTL: time.Minute})
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("k%d", (worker*31+i)%100)
+				switch i % 4 {
+				case 0:
+					c.Set(key, key)
+				case 1:
+					c.Delete(key)
+				default:
+					if v, ok := c.Get(key); ok && v != key {
+						t.Errorf("Expected %s, got %s", key, v)
+					}
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	if n := c.Len(); n > 64 {
+		t.Errorf("Expected at most 64 entries, got %d", n)
+	}
+	if len(c.Keys()) != c.Len() {
+		t.Errorf("Keys and Len disagree: %d vs %d", len(c.Keys()), c.Len())
+	}
+}
+
+func TestStore_PersistAndRestore(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	store := NewStore()
+	facts := New[fact](store, "inventory.facts", Options{})
+	if err := store.Persist(ctx, db); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	facts.Set("web-1", fact{Host: "web-1", Cores: 4})
+	facts.SetTTL("web-2", fact{Host: "web-2", Cores: 8}, time.Hour)
+	facts.SetTTL("gone", fact{Host: "gone"}, time.Hour)
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	facts.Delete("gone")
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// 模拟重启：新的 Store 在设置数据库前后注册的命名空间都能恢复
+	restarted := NewStore()
+	restored := New[fact](restarted, "inventory.facts", Options{})
+	if err := restarted.Persist(ctx, db); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if v, ok := restored.Get("web-1"); !ok || v.Cores != 4 {
+		t.Errorf("Expected web-1 to be restored, got %+v %v", v, ok)
+	}
+	if _, ok := restored.Get("web-2"); !ok {
+		t.Error("Expected web-2 to be restored before it expires")
+	}
+	if _, ok := restored.Get("gone"); ok {
+		t.Error("Deleted entries must not be restored")
+	}
+	other := New[fact](restarted, "other", Options{})
+	if other.Len() != 0 {
+		t.Errorf("Namespaces must not share entries, got %v", other.Keys())
+	}
+
+	var count int64
+	db.Model(&Entry{}).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 persisted entries, got %d", count)
+	}
+}
+
+func TestStore_DuplicateNamespace(t *testing.T) {
+	store := NewStore()
+	New[int](store, "dup", Options{})
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a duplicate namespace to panic")
+		}
+	}()
+	New[string](store, "dup", Options{})
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	c := New[string](NewStore(), "bench.get", Options{MaxEntries: 1024, TTL: time.Hour})
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		c.Set(keys[i], keys[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := c.Get(keys[i%len(keys)]); !ok {
+			b.Fatal("Expected a hit")
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultFlushInterval 修改的条目延迟写入数据库的间隔
+const DefaultFlushInterval = 10 * time.Second
+
+// flushBatchSize 每条 INSERT 语句写入的条目数
+const flushBatchSize = 100
+
+// Entry 持久化的缓存条目，值为 JSON 编码
+type Entry struct {
+	Namespace string     `gorm:"primaryKey;size:64"`
+	Key       string     `gorm:"primaryKey;column:cache_key"`
+	Value     []byte     `gorm:"not null"`
+	ExpiresAt *time.Time `gorm:"index"` // 为空表示不过期
+	UpdatedAt time.Time
+}
+
+// TableName 指定表名
+func (Entry) TableName() string {
+	return "cache_entries"
+}
+
+// namespace Store 管理的命名空间，由 Cache[V] 实现
+type namespace interface {
+	Namespace() string
+	Stats() Stats
+	prune()
+	pending() ([]Entry, []string)
+	requeue(keys []string)
+	restore(entries []Entry)
+}
+
+// Store 一组命名空间缓存及其持久化，设置数据库之前只保存在内存中
+type Store struct {
+	mu         sync.Mutex
+	namespaces map[string]namespace
+	db         *gorm.DB
+	flushMu    sync.Mutex // 保证同一时刻只有一次写入
+}
+
+// NewStore 创建缓存 Store
+func NewStore() *Store {
+	return &Store{namespaces: make(map[string]namespace)}
+}
+
+// Default 全局缓存 Store，qwq 启动时设置持久化数据库
+var Default = NewStore()
+
+// register 注册命名空间，已设置数据库时立即恢复该命名空间的条目
+func (s *Store) register(ns namespace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := ns.Namespace()
+	if _, ok := s.namespaces[name]; ok {
+		panic(fmt.Sprintf("cache: namespace %q already registered", name))
+	}
+	s.namespaces[name] = ns
+	if s.db != nil {
+		s.restoreLocked(context.Background(), ns)
+	}
+}
+
+// Persist 设置持久化数据库（表结构由调用方迁移），清理已过期的条目并恢复已注册命名空间的条目
+func (s *Store) Persist(ctx context.Context, db *gorm.DB) error {
+	if err := db.WithContext(ctx).Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Delete(&Entry{}).Error; err != nil {
+		return fmt.Errorf("清理过期缓存失败: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+	for _, ns := range s.namespaces {
+		s.restoreLocked(ctx, ns)
+	}
+	return nil
+}
+
+// restoreLocked 从数据库恢复命名空间的条目，调用方持有锁
+func (s *Store) restoreLocked(ctx context.Context, ns namespace) {
+	var entries []Entry
+	if err := s.db.WithContext(ctx).Where("namespace = ?", ns.Namespace()).Order("updated_at").Find(&entries).Error; err != nil {
+		logger.Info("⚠️ 恢复缓存 %s 失败: %v", ns.Namespace(), err)
+		return
+	}
+	ns.restore(entries)
+}
+
+// Flush 清理过期条目，并把上次写入后修改和删除的条目写入数据库，未设置数据库时只清理过期条目
+func (s *Store) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	db := s.db
+	namespaces := make([]namespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, ns := range namespaces {
+		ns.prune()
+		if db == nil {
+			continue
+		}
+		upserts, deletes := ns.pending()
+		if err := writeEntries(ctx, db, ns.Namespace(), upserts, deletes); err != nil {
+			keys := deletes
+			for _, entry := range upserts {
+				keys = append(keys, entry.Key)
+			}
+			ns.requeue(keys)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("写入缓存 %s 失败: %w", ns.Namespace(), err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// writeEntries 在一个事务中写入修改的条目并删除被移除的条目
+func writeEntries(ctx context.Context, db *gorm.DB, namespace string, upserts []Entry, deletes []string) error {
+	if len(upserts) == 0 && len(deletes) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(upserts) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "namespace"}, {Name: "cache_key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at", "updated_at"}),
+			}).CreateInBatches(upserts, flushBatchSize).Error
+			if err != nil {
+				return err
+			}
+		}
+		for start := 0; start < len(deletes); start += flushBatchSize {
+			end := min(start+flushBatchSize, len(deletes))
+			if err := tx.Where("namespace = ? AND cache_key IN ?", namespace, deletes[start:end]).Delete(&Entry{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Run 每隔 DefaultFlushInterval 写入修改的条目，ctx 结束时做最后一次写入
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(DefaultFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				logger.Info("⚠️ %v", err)
+			}
+		}
+	}
+}
+
+// Close 写入所有修改的条目，退出前调用，之后缓存仍可在内存中使用
+func (s *Store) Close() error {
+	err := s.Flush(context.Background())
+	if err != nil {
+		logger.Info("⚠️ %v", err)
+	}
+	return err
+}
+
+// Stats 各命名空间的统计，按名称排序
+func (s *Store) Stats() []Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]Stats, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		stats = append(stats, ns.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Namespace < stats[j].Namespace })
+	return stats
+}
@@ -0,0 +1,443 @@
+// Package chathistory 保存 Web 控制台的对话：对话属于认证用户，消息写入前脱敏，
+// 超过单个对话或单个用户的容量上限时删除最早的消息
+package chathistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"qwq/internal/pagination"
+	"qwq/internal/security"
+
+	"gorm.io/gorm"
+)
+
+// 消息角色，与对话记录（incident 包）一致
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleCommand   = "command" // Agent 或快速命令执行的命令
+	RoleOutput    = "output"  // 命令输出
+)
+
+// ArtifactTranscript 对话关联的复盘对话记录会话，删除对话时一并删除
+const ArtifactTranscript = "transcript"
+
+// 默认容量上限
+const (
+	DefaultMaxMessages          = 500
+	DefaultMaxConversationBytes = 2 << 20
+	DefaultMaxUserBytes         = 50 << 20
+)
+
+const (
+	// maxMessageLength 单条消息的最大长度，超长的命令输出被截断
+	maxMessageLength = 64 * 1024
+	// maxTitleLength 自动生成的标题的最大字符数
+	maxTitleLength = 40
+)
+
+var (
+	// ErrNotFound 对话不存在或不属于该用户
+	ErrNotFound = errors.New("conversation not found")
+	// ErrInvalidRequest 参数无效
+	ErrInvalidRequest = errors.New("invalid conversation request")
+)
+
+// Conversation 一个对话，Messages 和 Bytes 为当前保存的消息数和内容字节数
+type Conversation struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Owner       string    `json:"owner" gorm:"index;not null"`
+	Title       string    `json:"title"`
+	CustomTitle bool      `json:"custom_title"` // 用户改过标题，不再自动生成
+	Messages    int       `json:"message_count"`
+	Bytes       int64     `json:"bytes"`
+	Pruned      int       `json:"pruned"` // 因容量上限删除的消息数
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"index"`
+}
+
+// TableName 表名
+func (Conversation) TableName() string { return "chat_conversations" }
+
+// Message 对话中的一条消息（已脱敏）
+type Message struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ConversationID uint      `json:"conversation_id" gorm:"index;not null"`
+	Owner          string    `json:"-" gorm:"index;not null"` // 冗余所属用户，按用户容量删除最早的消息时使用
+	Role           string    `json:"role" gorm:"not null"`
+	Content        string    `json:"content" gorm:"type:text"`
+	Bytes          int       `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName 表名
+func (Message) TableName() string { return "chat_messages" }
+
+// Artifact 对话关联的外部数据，如复盘对话记录，删除对话时由对应 kind 的清理函数删除
+type Artifact struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ConversationID uint      `json:"conversation_id" gorm:"index;not null"`
+	Kind           string    `json:"kind" gorm:"not null"`
+	Ref            string    `json:"ref" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName 表名
+func (Artifact) TableName() string { return "chat_artifacts" }
+
+// Limits 容量上限，0 表示使用默认值
+type Limits struct {
+	MaxMessages          int   // 单个对话保存的消息数
+	MaxConversationBytes int64 // 单个对话的内容字节数
+	MaxUserBytes         int64 // 单个用户全部对话的内容字节数
+}
+
+// withDefaults 补全未设置的上限
+func (l Limits) withDefaults() Limits {
+	if l.MaxMessages <= 0 {
+		l.MaxMessages = DefaultMaxMessages
+	}
+	if l.MaxConversationBytes <= 0 {
+		l.MaxConversationBytes = DefaultMaxConversationBytes
+	}
+	if l.MaxUserBytes <= 0 {
+		l.MaxUserBytes = DefaultMaxUserBytes
+	}
+	return l
+}
+
+// ListSpec 对话列表允许的排序字段和过滤参数，默认最近更新的在前
+var ListSpec = pagination.Spec{
+	Sort:        map[string]string{"updated_at": "updated_at", "created_at": "created_at", "title": "title", "bytes": "bytes"},
+	DefaultSort: "-updated_at",
+	Filters:     map[string]string{"owner": "owner"},
+}
+
+// Manager 对话存储
+type Manager struct {
+	db     *gorm.DB
+	limits Limits
+
+	// mu 串行化写入，追加消息和按容量删除在同一把锁内完成
+	mu      sync.Mutex
+	purgers map[string]func(ref string) error
+}
+
+// NewManager 创建对话存储
+func NewManager(db *gorm.DB, limits Limits) *Manager {
+	return &Manager{db: db, limits: limits.withDefaults(), purgers: make(map[string]func(ref string) error)}
+}
+
+// RegisterPurger 注册一类关联数据的清理函数，删除对话时对该类的每条关联数据调用
+func (m *Manager) RegisterPurger(kind string, purge func(ref string) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purgers[kind] = purge
+}
+
+// Create 为用户创建对话，title 为空时在第一轮问答后自动生成
+func (m *Manager) Create(ctx context.Context, owner, title string) (*Conversation, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("%w: owner is required", ErrInvalidRequest)
+	}
+	title = strings.TrimSpace(title)
+	conversation := &Conversation{Owner: owner, Title: title, CustomTitle: title != ""}
+	if err := m.db.WithContext(ctx).Create(conversation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+	return conversation, nil
+}
+
+// Get 获取对话，owner 为空时不检查所属用户
+func (m *Manager) Get(ctx context.Context, id uint, owner string) (*Conversation, error) {
+	query := m.db.WithContext(ctx).Where("id = ?", id)
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	var conversation Conversation
+	if err := query.First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// List 分页列出用户的对话，owner 为空时列出所有用户的对话（只含元数据）
+func (m *Manager) List(ctx context.Context, owner string, q pagination.Query) (*pagination.Page[*Conversation], error) {
+	query := m.db.WithContext(ctx).Model(&Conversation{})
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	return pagination.Find[*Conversation](query, q)
+}
+
+// Rename 修改对话标题，之后不再自动生成
+func (m *Manager) Rename(ctx context.Context, id uint, owner, title string) (*Conversation, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidRequest)
+	}
+	conversation, err := m.Get(ctx, id, owner)
+	if err != nil {
+		return nil, err
+	}
+	conversation.Title, conversation.CustomTitle = title, true
+	if err := m.db.WithContext(ctx).Model(conversation).Updates(map[string]interface{}{"title": title, "custom_title": true}).Error; err != nil {
+		return nil, fmt.Errorf("failed to rename conversation: %w", err)
+	}
+	return conversation, nil
+}
+
+// Delete 删除对话、其消息和关联数据；关联数据清理失败时记录在返回的错误中，对话仍然删除
+func (m *Manager) Delete(ctx context.Context, id uint, owner string) (*Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, err := m.Get(ctx, id, owner)
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []Artifact
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", id).Find(&artifacts).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&Message{}, &Artifact{}} {
+			if err := tx.Where("conversation_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Conversation{}, id).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete conversation: %w", err)
+	}
+
+	var errs []error
+	for _, artifact := range artifacts {
+		if purge := m.purgers[artifact.Kind]; purge != nil {
+			if err := purge(artifact.Ref); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", artifact.Kind, artifact.Ref, err))
+			}
+		}
+	}
+	return conversation, errors.Join(errs...)
+}
+
+// History 对话的全部消息，按时间顺序
+func (m *Manager) History(ctx context.Context, id uint) ([]Message, error) {
+	messages := []Message{}
+	if err := m.db.WithContext(ctx).Where("conversation_id = ?", id).Order("id").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// AddArtifact 记录对话关联的外部数据，重复记录时忽略
+func (m *Manager) AddArtifact(ctx context.Context, id uint, kind, ref string) error {
+	var count int64
+	db := m.db.WithContext(ctx)
+	if err := db.Model(&Artifact{}).Where("conversation_id = ? AND kind = ? AND ref = ?", id, kind, ref).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	return db.Create(&Artifact{ConversationID: id, Kind: kind, Ref: ref}).Error
+}
+
+// Append 追加一条消息：内容脱敏并截断，第一条回复后由第一条用户消息生成标题，超过容量上限时删除最早的消息
+func (m *Manager) Append(ctx context.Context, id uint, role, content string) (*Conversation, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, nil
+	}
+	if len(content) > maxMessageLength {
+		content = strings.ToValidUTF8(content[:maxMessageLength], "") + "\n... (truncated)"
+	}
+	content = security.Redact(content)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, err := m.Get(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		message := &Message{ConversationID: id, Owner: conversation.Owner, Role: role, Content: content, Bytes: len(content)}
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		if !conversation.CustomTitle && conversation.Title == "" && role != RoleUser {
+			var first Message
+			if err := tx.Where("conversation_id = ? AND role = ?", id, RoleUser).Order("id").First(&first).Error; err == nil {
+				conversation.Title = Title(first.Content)
+			}
+		}
+		if err := m.pruneConversation(tx, conversation, message.ID); err != nil {
+			return err
+		}
+		if err := m.pruneUser(tx, conversation, message.ID); err != nil {
+			return err
+		}
+		if err := refreshCounts(tx, conversation); err != nil {
+			return err
+		}
+		return tx.Model(conversation).Updates(map[string]interface{}{
+			"title": conversation.Title, "messages": conversation.Messages, "bytes": conversation.Bytes,
+			"pruned": conversation.Pruned, "updated_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save chat message: %w", err)
+	}
+	return conversation, nil
+}
+
+// pruneConversation 对话超过消息数或字节数上限时删除最早的消息，刚写入的消息 keep 保留
+func (m *Manager) pruneConversation(tx *gorm.DB, conversation *Conversation, keep uint) error {
+	if err := refreshCounts(tx, conversation); err != nil {
+		return err
+	}
+	excessMessages := conversation.Messages - m.limits.MaxMessages
+	excessBytes := conversation.Bytes - m.limits.MaxConversationBytes
+	if excessMessages <= 0 && excessBytes <= 0 {
+		return nil
+	}
+	var oldest []Message
+	if err := tx.Select("id", "bytes").Where("conversation_id = ? AND id <> ?", conversation.ID, keep).Order("id").Find(&oldest).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	for _, message := range oldest {
+		if excessMessages <= 0 && excessBytes <= 0 {
+			break
+		}
+		ids = append(ids, message.ID)
+		excessMessages--
+		excessBytes -= int64(message.Bytes)
+	}
+	return deleteMessages(tx, ids, map[uint]*Conversation{conversation.ID: conversation})
+}
+
+// pruneUser 用户全部对话超过字节数上限时，跨对话删除最早的消息；current 为正在写入的对话
+func (m *Manager) pruneUser(tx *gorm.DB, current *Conversation, keep uint) error {
+	owner := current.Owner
+	var total int64
+	if err := tx.Model(&Message{}).Where("owner = ?", owner).Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error; err != nil {
+		return err
+	}
+	excess := total - m.limits.MaxUserBytes
+	if excess <= 0 {
+		return nil
+	}
+	var oldest []Message
+	if err := tx.Select("id", "conversation_id", "bytes").Where("owner = ? AND id <> ?", owner, keep).Order("id").Find(&oldest).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	affected := make(map[uint]*Conversation)
+	for _, message := range oldest {
+		if excess <= 0 {
+			break
+		}
+		ids = append(ids, message.ID)
+		excess -= int64(message.Bytes)
+		affected[message.ConversationID] = nil
+	}
+	for conversationID := range affected {
+		if conversationID == current.ID {
+			affected[conversationID] = current
+			continue
+		}
+		var conversation Conversation
+		if err := tx.First(&conversation, conversationID).Error; err != nil {
+			return err
+		}
+		affected[conversationID] = &conversation
+	}
+	return deleteMessages(tx, ids, affected)
+}
+
+// deleteMessages 删除消息并更新受影响对话的计数（调用方持有写锁）
+func deleteMessages(tx *gorm.DB, ids []uint, affected map[uint]*Conversation) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var counts []struct {
+		ConversationID uint
+		Count          int
+	}
+	if err := tx.Model(&Message{}).Select("conversation_id, COUNT(*) AS count").Where("id IN ?", ids).
+		Group("conversation_id").Scan(&counts).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&Message{}).Error; err != nil {
+		return err
+	}
+	for _, c := range counts {
+		conversation := affected[c.ConversationID]
+		if conversation == nil {
+			continue
+		}
+		conversation.Pruned += c.Count
+		if err := refreshCounts(tx, conversation); err != nil {
+			return err
+		}
+		if err := tx.Model(conversation).Updates(map[string]interface{}{
+			"messages": conversation.Messages, "bytes": conversation.Bytes, "pruned": conversation.Pruned,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshCounts 重新统计对话的消息数和字节数
+func refreshCounts(tx *gorm.DB, conversation *Conversation) error {
+	var stats struct {
+		Count int
+		Total int64
+	}
+	if err := tx.Model(&Message{}).Select("COUNT(*) AS count, COALESCE(SUM(bytes), 0) AS total").
+		Where("conversation_id = ?", conversation.ID).Scan(&stats).Error; err != nil {
+		return err
+	}
+	conversation.Messages, conversation.Bytes = stats.Count, stats.Total
+	return nil
+}
+
+// Title 由第一条用户消息生成标题：取第一行，合并空白，超过 40 个字符时截断
+func Title(input string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(input), "\n")
+	title := strings.Join(strings.Fields(line), " ")
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength]) + "…"
+	}
+	if title == "" {
+		return "新对话"
+	}
+	return title
+}
+
+var (
+	defaultManager   *Manager
+	defaultManagerMu sync.RWMutex
+)
+
+// SetDefault 设置全局对话存储，Web 聊天和对话接口通过它保存和读取对话
+func SetDefault(manager *Manager) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+	defaultManager = manager
+}
+
+// Default 返回全局对话存储，未启用时为 nil
+func Default() *Manager {
+	defaultManagerMu.RLock()
+	defer defaultManagerMu.RUnlock()
+	return defaultManager
+}
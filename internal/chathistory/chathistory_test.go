@@ -0,0 +1,158 @@
+package chathistory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"qwq/internal/pagination"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func newTestManager(t *testing.T, limits Limits) *Manager {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Conversation{}, &Message{}, &Artifact{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(db, limits)
+}
+
+func TestManager_AppendTitlesAndRedacts(t *testing.T) {
+	m := newTestManager(t, Limits{})
+	ctx := context.Background()
+	conversation, err := m.Create(ctx, "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Append(ctx, conversation.ID, RoleUser, "  nginx 502 了\n  10.1.2.3 上的   upstream 连不上"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Get(ctx, conversation.ID, "alice"); got.Title != "" {
+		t.Errorf("Title should wait for the first reply, got %q", got.Title)
+	}
+	updated, err := m.Append(ctx, conversation.ID, RoleAssistant, "检查一下 upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "nginx 502 了" || updated.Messages != 2 {
+		t.Errorf("Expected the title from the first user message, got %+v", updated)
+	}
+	m.Append(ctx, conversation.ID, RoleOutput, "connect to 10.1.2.3:8080 failed")
+
+	history, err := m.History(ctx, conversation.ID)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("Expected 3 messages, got %d %v", len(history), err)
+	}
+	for _, message := range history {
+		if strings.Contains(message.Content, "10.1.2.3") {
+			t.Errorf("Expected messages to be redacted, got %q", message.Content)
+		}
+	}
+
+	// 用户改过标题后不再自动生成
+	renamed, err := m.Rename(ctx, conversation.ID, "alice", "502 排查")
+	if err != nil || !renamed.CustomTitle {
+		t.Fatalf("Rename: %+v %v", renamed, err)
+	}
+	if _, err := m.Rename(ctx, conversation.ID, "bob", "mine"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected other users not to rename the conversation, got %v", err)
+	}
+	if got := Title(strings.Repeat("长", 50)); got != strings.Repeat("长", 40)+"…" {
+		t.Errorf("Expected long titles to be truncated, got %q", got)
+	}
+}
+
+func TestManager_PrunesOldestMessages(t *testing.T) {
+	m := newTestManager(t, Limits{MaxMessages: 3, MaxConversationBytes: 1 << 20, MaxUserBytes: 23})
+	ctx := context.Background()
+	first, _ := m.Create(ctx, "alice", "first")
+	for _, content := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		if _, err := m.Append(ctx, first.ID, RoleUser, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, _ := m.History(ctx, first.ID)
+	if len(history) != 3 || history[0].Content != "m3" {
+		t.Fatalf("Expected the 3 newest messages, got %+v", history)
+	}
+	if got, _ := m.Get(ctx, first.ID, ""); got.Messages != 3 || got.Bytes != 6 || got.Pruned != 2 {
+		t.Errorf("Expected counters to follow pruning, got %+v", got)
+	}
+
+	// 用户总量超过上限时跨对话删除最早的消息
+	second, _ := m.Create(ctx, "alice", "second")
+	if _, err := m.Append(ctx, second.ID, RoleUser, strings.Repeat("x", 20)); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := m.History(ctx, first.ID); len(history) != 1 || history[0].Content != "m5" {
+		t.Errorf("Expected the oldest messages of the user to be pruned, got %+v", history)
+	}
+	other, _ := m.Create(ctx, "bob", "")
+	m.Append(ctx, other.ID, RoleUser, strings.Repeat("y", 20))
+	if history, _ := m.History(ctx, first.ID); len(history) != 1 {
+		t.Errorf("Other users' messages should not count towards alice's limit, got %+v", history)
+	}
+}
+
+func TestManager_DeletePurgesArtifacts(t *testing.T) {
+	m := newTestManager(t, Limits{})
+	ctx := context.Background()
+	var purged []string
+	m.RegisterPurger(ArtifactTranscript, func(ref string) error {
+		purged = append(purged, ref)
+		return nil
+	})
+	conversation, _ := m.Create(ctx, "alice", "")
+	m.Append(ctx, conversation.ID, RoleUser, "看看内存")
+	m.AddArtifact(ctx, conversation.ID, ArtifactTranscript, "web-1")
+	m.AddArtifact(ctx, conversation.ID, ArtifactTranscript, "web-1")
+	m.AddArtifact(ctx, conversation.ID, ArtifactTranscript, "web-2")
+
+	if _, err := m.Delete(ctx, conversation.ID, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected other users not to delete the conversation, got %v", err)
+	}
+	if _, err := m.Delete(ctx, conversation.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(purged, ",") != "web-1,web-2" {
+		t.Errorf("Expected each transcript to be purged once, got %v", purged)
+	}
+	if history, _ := m.History(ctx, conversation.ID); len(history) != 0 {
+		t.Errorf("Expected messages to be deleted, got %d", len(history))
+	}
+	if _, err := m.Get(ctx, conversation.ID, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the conversation to be gone, got %v", err)
+	}
+}
+
+func TestManager_ListScopesByOwner(t *testing.T) {
+	m := newTestManager(t, Limits{})
+	ctx := context.Background()
+	m.Create(ctx, "alice", "a1")
+	m.Create(ctx, "alice", "a2")
+	m.Create(ctx, "bob", "b1")
+
+	q, _ := pagination.Parse(nil, ListSpec)
+	page, err := m.List(ctx, "alice", q)
+	if err != nil || page.Total != 2 {
+		t.Fatalf("Expected alice's 2 conversations, got %+v %v", page, err)
+	}
+	if page, _ := m.List(ctx, "", q); page.Total != 3 {
+		t.Errorf("Expected all conversations without an owner, got %d", page.Total)
+	}
+}
@@ -5,40 +5,613 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // PatrolRule Shell 巡检规则
 type PatrolRule struct {
 	Name    string `json:"name"`
 	Command string `json:"command"`
+	Timeout int    `json:"timeout,omitempty"` // 超时时间（秒），0 表示使用巡检默认超时
 }
 
-// HTTPRule HTTP 监控规则
+// PatrolConfig 巡检执行配置，0 表示使用默认值
+type PatrolConfig struct {
+	Concurrency   int                 `json:"concurrency"`    // 同时执行的检查项数量
+	CheckTimeout  int                 `json:"check_timeout"`  // 单个检查项默认超时时间（秒）
+	DiskThreshold int                 `json:"disk_threshold"` // 磁盘使用率告警阈值（百分比），默认 85
+	LoadThreshold float64             `json:"load_threshold"` // 1 分钟负载告警阈值，默认 4.0
+	MemThreshold  float64             `json:"mem_threshold"`  // 内存使用率告警阈值（百分比），默认 90
+	HTTPRefresh   bool                `json:"http_refresh"`   // 巡检时重新执行 HTTP 检查，默认读取后台检查的最近结果（手动触发的巡检总是重新执行）
+	AlertCooldown int                 `json:"alert_cooldown"` // 同一异常重复推送的冷却时间（分钟），默认 60，严重程度升高时立即推送；-1 表示每次巡检都推送
+	Clock         ClockConfig         `json:"clock"`
+	Accounts      AccountsConfig      `json:"accounts"`
+	Zombie        ZombieConfig        `json:"zombie"`
+	TopProcesses  TopProcessesConfig  `json:"top_processes"`
+	ContainerLogs ContainerLogsConfig `json:"container_logs"`
+}
+
+// ModulesConfig 可选模块开关，默认全部启用
+type ModulesConfig struct {
+	DisableWebsites bool `json:"disable_websites"` // 关闭网站管理接口
+	DisableAppStore bool `json:"disable_appstore"` // 关闭应用商店接口和模板同步
+	DisableGateway  bool `json:"disable_gateway"`  // 禁止以 qwq gateway 模式运行
+}
+
+// CORSConfig API 跨域访问配置，未配置来源时只允许同源访问
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`   // 允许访问 /api 的来源，如 https://ops.example.com；* 表示任意来源，不能与 allow_credentials 同时使用
+	AllowCredentials bool     `json:"allow_credentials"` // 允许跨域请求携带认证信息（Authorization、Cookie）
+	MaxAge           int      `json:"max_age"`           // 预检结果缓存时间（秒），默认 600
+}
+
+// ResourcesConfig qwq 自身的资源上限，0 表示使用默认值；自身内存接近容器限制时各缓存自动收缩
+type ResourcesConfig struct {
+	StatsHistory    int `json:"stats_history"`    // 面板实时监控保留的数据点，默认 60
+	LogBuffer       int `json:"log_buffer"`       // 面板日志缓冲保留的条数，默认 100
+	MetricsHistory  int `json:"metrics_history"`  // 长期指标历史保留的时间片（分钟）数，默认 10080（7 天）
+	PressurePercent int `json:"pressure_percent"` // 自身内存达到容器内存限制的该百分比时收缩缓存并告警，默认 90
+}
+
+// DriftConfig 托管文件（生成的 nginx 配置、compose 项目文件）被外部修改的检测配置
+type DriftConfig struct {
+	Disabled   bool   `json:"disabled"`    // 关闭外部修改检测
+	Interval   int    `json:"interval"`    // 定期重新计算哈希的间隔（秒），默认 60；Linux 上文件变化时还会立即检测
+	ComposeDir string `json:"compose_dir"` // 部署时写入 compose 项目文件的目录，默认 data/compose
+}
+
+// ComposeAnalysisConfig 定时重新分析 Compose 项目架构和性能的配置
+type ComposeAnalysisConfig struct {
+	Disabled      bool `json:"disabled"`       // 关闭定时分析
+	IntervalHours int  `json:"interval_hours"` // 分析间隔（小时），默认 168（每周一次）
+	// NoAISuggestions 优化建议只使用内置规则，不请求 AI 补充
+	NoAISuggestions bool `json:"no_ai_suggestions"`
+}
+
+// CacheConfig 进程内缓存配置
+type CacheConfig struct {
+	NoPersist          bool `json:"no_persist"`           // 不把缓存写入数据库，重启后缓存为空
+	AnalysisTTLMinutes int  `json:"analysis_ttl_minutes"` // 相同巡检异常的 AI 分析结果缓存时间（分钟），默认 30，负数表示不缓存
+}
+
+// ChatHistoryConfig Web 控制台对话历史配置，0 表示使用默认值
+type ChatHistoryConfig struct {
+	Disabled          bool `json:"disabled"`            // 不保存对话，刷新页面后对话丢失
+	MaxMessages       int  `json:"max_messages"`        // 单个对话保存的消息数，默认 500
+	MaxConversationKB int  `json:"max_conversation_kb"` // 单个对话的内容大小（KB），默认 2048
+	MaxUserMB         int  `json:"max_user_mb"`         // 单个用户全部对话的内容大小（MB），默认 50
+}
+
+// FilesConfig Web 控制台文件管理配置，空值表示使用默认值
+type FilesConfig struct {
+	AllowedRoots []string `json:"allowed_roots"` // 允许浏览和修改的目录（宿主机路径），默认 ["/"]；符号链接解析后位于这些目录之外的路径一律拒绝
+	MaxFileMB    int      `json:"max_file_mb"`   // 在线查看和保存的单个文件大小上限（MB），默认 5
+	MaxUploadMB  int      `json:"max_upload_mb"` // 上传的单个文件大小上限（MB），默认 100；下载不限制大小
+}
+
+// ACMEConfig 通过 ACME（Let's Encrypt）签发和续期证书的配置，空值表示使用默认值
+type ACMEConfig struct {
+	Email         string        `json:"email"`          // ACME 账户的联系邮箱，申请证书时未指定邮箱则使用该值，可为空
+	Staging       bool          `json:"staging"`        // 使用 Let's Encrypt 测试环境，证书不受浏览器信任，但不消耗正式环境的频率限制，适合首次配置和测试
+	DirectoryURL  string        `json:"directory_url"`  // 自定义 ACME 目录地址（如内部 CA），设置后忽略 staging
+	CertDir       string        `json:"cert_dir"`       // 证书、私钥和 ACME 账户密钥的保存目录，默认 /etc/qwq/ssl
+	ChallengePath string        `json:"challenge_path"` // qwq Web 服务响应 HTTP-01 挑战的路径前缀，默认 /.well-known/acme-challenge/
+	RenewDays     int           `json:"renew_days"`     // 新证书在到期前多少天进入续期窗口，默认 30
+	DNS           ACMEDNSConfig `json:"dns"`            // 通配符域名使用 DNS-01 挑战时发布 TXT 记录的 DNS 提供商
+}
+
+// ACMEDNSConfig DNS-01 挑战使用的 DNS 提供商，凭证取自 dns.providers
+type ACMEDNSConfig struct {
+	Provider           string `json:"provider"`            // aliyun、cloudflare 或 tencent，为空时无法签发通配符证书
+	Zone               string `json:"zone"`                // 托管在提供商的根域名，默认取域名的最后两级
+	PropagationTimeout int    `json:"propagation_timeout"` // 等待 TXT 记录生效的最长时间（秒），默认 120
+}
+
+// DNSConfig DNS 管理同步和推送记录使用的提供商凭证，以及验证解析使用的 DNS 服务器
+type DNSConfig struct {
+	Providers      map[string]DNSProviderCredentials `json:"providers"`       // 键为提供商名称：cloudflare、aliyun、tencent
+	Resolvers      []string                          `json:"resolvers"`       // 验证解析使用的 DNS 服务器（host[:port]），system 为系统默认，默认 system、8.8.8.8、1.1.1.1
+	VerifyTimeout  int                               `json:"verify_timeout"`  // 等待解析生效的最长时间（秒），默认 120
+	VerifyInterval int                               `json:"verify_interval"` // 等待时检查解析的间隔（秒），默认 10
+}
+
+// DNSProviderCredentials 一个 DNS 提供商的凭证
+type DNSProviderCredentials struct {
+	APIToken        string `json:"api_token,omitempty"`         // Cloudflare API Token，需要 Zone:Read 和 DNS:Edit 权限
+	AccessKeyID     string `json:"access_key_id,omitempty"`     // 阿里云 AccessKey ID 或腾讯云 SecretId
+	AccessKeySecret string `json:"access_key_secret,omitempty"` // 阿里云 AccessKey Secret 或腾讯云 SecretKey
+	Region          string `json:"region,omitempty"`            // 阿里云区域，为空时使用 alidns.aliyuncs.com；腾讯云可不填
+	Endpoint        string `json:"endpoint,omitempty"`          // 自定义 API 地址，默认使用提供商的公网地址
+}
+
+// WebsitesConfig Web 控制台网站管理写入 nginx 配置的方式
+type WebsitesConfig struct {
+	NginxSitesDir string `json:"nginx_sites_dir"` // 站点配置写入的目录（nginx include 的 sites-enabled），为空时只保存网站记录，不生成 nginx 配置
+	NginxBinary   string `json:"nginx_binary"`    // 校验和重载配置使用的 nginx 可执行文件，默认 nginx
+}
+
+// AuthConfig Web 控制台登录会话配置
+type AuthConfig struct {
+	JWTSecret     string `json:"jwt_secret"`      // 签名登录令牌（HS256）的密钥，为空时首次启动生成随机密钥并保存到 secret_file
+	SecretFile    string `json:"secret_file"`     // 生成的签名密钥的保存位置，默认 qwq_jwt_secret
+	TokenTTLHours int    `json:"token_ttl_hours"` // 登录令牌有效期（小时），默认 24
+}
+
+// AnomaliesConfig 巡检记录和异常历史配置，控制台据此展示最近的异常
+type AnomaliesConfig struct {
+	Disabled      bool `json:"disabled"`       // 不保存异常历史
+	RetentionDays int  `json:"retention_days"` // 已恢复异常和巡检记录的保留天数，默认 90
+}
+
+// EventsConfig 事件时间线配置：Docker 事件和 qwq 的巡检异常、部署、自愈重启、配置变更
+type EventsConfig struct {
+	Disabled      bool `json:"disabled"`       // 不记录事件时间线
+	RetentionDays int  `json:"retention_days"` // 事件保留天数，默认 7
+	DisableDocker bool `json:"disable_docker"` // 不订阅 Docker 事件，只记录 qwq 自身的事件
+}
+
+// TerminalConfig 命令行的终端输出和交互确认配置
+type TerminalConfig struct {
+	NoColor   bool   `json:"no_color"`   // 关闭颜色和 Markdown 样式，输出纯文本；输出被重定向或设置 NO_COLOR 时自动关闭
+	WrapWidth int    `json:"wrap_width"` // 换行宽度，0 表示跟随终端宽度
+	Style     string `json:"style"`      // Markdown 样式：auto（默认）、dark、light、notty、ascii、dracula
+	AssumeYes bool   `json:"assume_yes"` // 标准输入不是终端时自动确认中、高风险操作（--yes），默认拒绝；极高风险操作始终需要在终端确认
+}
+
+// ClockConfig 时钟偏差检查配置，0 或空值表示使用默认值
+type ClockConfig struct {
+	Disabled   bool   `json:"disabled"`
+	Endpoint   string `json:"endpoint"`    // 无法读取 chrony/timesyncd/ntpd 状态时，用该地址的 HTTP Date 头对比本地时间
+	WarnMS     int    `json:"warn_ms"`     // 偏差超过该值告警（毫秒），默认 500
+	CriticalMS int    `json:"critical_ms"` // 偏差超过该值按严重故障告警（毫秒），默认 5000
+}
+
+// AccountsConfig 主机账号审计：特权用户、sudoers 文件和 SSH 公钥相对基线的变化
+type AccountsConfig struct {
+	Disabled bool     `json:"disabled"`
+	Groups   []string `json:"groups"` // 视为拥有 sudo 权限的用户组，默认 sudo、wheel、admin
+}
+
+// ZombieConfig 僵尸进程分析：受保护的父进程和建议终止父进程的阈值
+type ZombieConfig struct {
+	Protected     []string `json:"protected"`      // 额外受保护的父进程名称，PID 1、systemd、containerd、dockerd、sshd 等始终受保护
+	KillThreshold int      `json:"kill_threshold"` // 非受保护父进程的僵尸数超过该值时才建议终止父进程，默认 5
+}
+
+// TopProcessesConfig 负载或内存告警时附带的 CPU、内存占用最高的进程，日报中同样附带
+type TopProcessesConfig struct {
+	Disabled bool `json:"disabled"`
+	Count    int  `json:"count"`     // 按 CPU 和按 RSS 各列出的进程数，默认 5
+	MaxChars int  `json:"max_chars"` // 进程列表的最大字符数，超出时截断，默认 2000（钉钉消息上限为 20000）
+}
+
+// ContainerLogsConfig 容器日志大小检查，0 或空值表示使用默认值
+type ContainerLogsConfig struct {
+	Disabled      bool   `json:"disabled"`
+	MaxSizeMB     int    `json:"max_size_mb"`     // 单个容器的当前日志文件超过该大小告警（MB），默认 1024
+	GrowthMB      int    `json:"growth_mb"`       // 日志自上次巡检增长超过该值告警（MB），默认 500
+	RotateMaxSize string `json:"rotate_max_size"` // 修复建议中的 max-size，默认 100m
+	RotateMaxFile int    `json:"rotate_max_file"` // 修复建议中的 max-file，默认 3
+}
+
+// 监控规则的检查类型
+const (
+	CheckTypeHTTP = "http" // HTTP 请求，默认
+	CheckTypeTCP  = "tcp"  // TCP 端口是否可以连接
+	CheckTypeTLS  = "tls"  // TLS 证书是否有效及剩余天数
+)
+
+// DefaultCertWarnDays TLS 证书剩余天数低于该值时告警
+const DefaultCertWarnDays = 14
+
+// HTTPRule 监控规则：HTTP 请求（默认）、TCP 端口或 TLS 证书检查，由 type 区分
 type HTTPRule struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
-	Code int    `json:"code"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type,omitempty"` // http（默认）、tcp 或 tls
+	URL          string            `json:"url,omitempty"`
+	Host         string            `json:"host,omitempty"`           // tcp/tls 检查的主机，tls 检查同时用作 SNI 和证书校验的域名
+	Port         int               `json:"port,omitempty"`           // tcp/tls 检查的端口，tls 默认 443
+	Timeout      int               `json:"timeout,omitempty"`        // tcp/tls 检查的连接超时（秒），默认 10
+	WarnDays     int               `json:"warn_days,omitempty"`      // tls 证书剩余天数低于该值时告警，默认 14
+	Method       string            `json:"method,omitempty"`         // 请求方法，默认 GET
+	Headers      map[string]string `json:"headers,omitempty"`        // 请求头，如 Authorization；值中的 ${VAR} 在请求时从环境变量读取，密钥不必写入配置
+	Code         int               `json:"code"`                     // 期望的状态码，默认 200
+	CodeRange    string            `json:"code_range,omitempty"`     // 期望的状态码范围，如 200-299 或 2xx，设置后忽略 code
+	BodyMatch    string            `json:"body_match,omitempty"`     // 响应体必须匹配的正则表达式
+	MaxLatencyMS int               `json:"max_latency_ms,omitempty"` // 响应时间超过该毫秒数时判定为缓慢，0 表示不检查
+	Interval     int               `json:"interval"`                 // 执行间隔（秒），默认 30；面板和巡检读取最近一次的结果
+}
+
+// ErrInvalidStatusRange 状态码范围格式无效
+var ErrInvalidStatusRange = errors.New("invalid status code range")
+
+// ExpectedStatus 规则期望的状态码范围 [lo, hi]：code_range 优先，其次 code，默认 200
+func (r HTTPRule) ExpectedStatus() (int, int, error) {
+	spec := strings.TrimSpace(r.CodeRange)
+	if spec == "" {
+		code := r.Code
+		if code == 0 {
+			code = 200
+		}
+		return code, code, nil
+	}
+	if len(spec) == 3 && strings.HasSuffix(strings.ToLower(spec), "xx") && spec[0] >= '1' && spec[0] <= '5' {
+		lo := int(spec[0]-'0') * 100
+		return lo, lo + 99, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		to = from
+	}
+	lo, err1 := strconv.Atoi(strings.TrimSpace(from))
+	hi, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if err1 != nil || err2 != nil || lo < 100 || hi > 599 || lo > hi {
+		return 0, 0, fmt.Errorf("%w: %q (use 200-299 or 2xx)", ErrInvalidStatusRange, r.CodeRange)
+	}
+	return lo, hi, nil
+}
+
+// 模型用途，models.routes 的键
+const (
+	UseChat           = "chat"            // 对话（Web 与命令行）
+	UsePatrolAnalysis = "patrol_analysis" // 巡检异常分析
+	UseOptimizer      = "optimizer"       // Compose 优化建议的 AI 补充
+)
+
+// DefaultModelProfile 由 api_key、base_url、model 组成的默认模型配置名，未指定路由的用途使用该配置
+const DefaultModelProfile = "default"
+
+// ModelProfile 一个模型配置：接口地址、密钥和请求参数，未设置的字段使用顶层 api_key、base_url、model
+type ModelProfile struct {
+	Name        string   `json:"name"`        // 配置名称，在 routes 和 fallback 中引用
+	BaseURL     string   `json:"base_url"`    // OpenAI 兼容接口地址
+	APIKeyEnv   string   `json:"api_key_env"` // 读取 API Key 的环境变量名，密钥不写入配置文件
+	Model       string   `json:"model"`       // 模型名称
+	Temperature *float32 `json:"temperature"` // 采样温度，为空时使用各用途的默认值
+	MaxTokens   int      `json:"max_tokens"`  // 单次回答的最大 token 数，0 表示不限制
+}
+
+// ModelsConfig 多模型配置：各用途使用的模型配置，以及连接失败时改用的备用配置
+type ModelsConfig struct {
+	Profiles []ModelProfile    `json:"profiles"`
+	Routes   map[string]string `json:"routes"`   // 用途（chat、patrol_analysis、optimizer）到配置名称，未列出的用途使用 default
+	Fallback string            `json:"fallback"` // 主配置连接失败时重试一次的配置名称，为空时不重试
+}
+
+// Profile 按名称查找模型配置，default 不在 profiles 中时返回 false
+func (m ModelsConfig) Profile(name string) (ModelProfile, bool) {
+	for _, profile := range m.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return ModelProfile{}, false
+}
+
+// Route 用途使用的模型配置名称
+func (m ModelsConfig) Route(useCase string) string {
+	if name := m.Routes[useCase]; name != "" {
+		return name
+	}
+	return DefaultModelProfile
+}
+
+// AILimitConfig AI 调用限流配置
+// 速率单位为每分钟请求数，0 表示使用默认值
+type AILimitConfig struct {
+	UserRate      float64 `json:"user_rate"`      // 单用户持续速率
+	UserBurst     int     `json:"user_burst"`     // 单用户突发容量
+	GlobalRate    float64 `json:"global_rate"`    // 全局持续速率
+	GlobalBurst   int     `json:"global_burst"`   // 全局突发容量
+	MaxConcurrent int     `json:"max_concurrent"` // 同时运行的 Agent 循环上限
+	MaxQueue      int     `json:"max_queue"`      // 排队上限，超过后直接拒绝
+}
+
+// SnapshotConfig 容器卷快照配置
+type SnapshotConfig struct {
+	Dir         string `json:"dir"`          // 快照存放目录
+	Retention   int    `json:"retention"`    // 每个容器保留的快照数量
+	QuotaMB     int64  `json:"quota_mb"`     // 快照目录总容量上限（MB）
+	HelperImage string `json:"helper_image"` // 用于读写卷的辅助镜像
+}
+
+// BackupConfig 配置备份：nginx 站点配置、compose 项目、qwq 的 SQLite 数据库和配置文件
+type BackupConfig struct {
+	Dir             string `json:"dir"`              // 备份存放目录，默认 /var/backups/qwq/config
+	Retention       int    `json:"retention"`        // 保留最近的备份数量，默认 7
+	NginxDir        string `json:"nginx_dir"`        // 备份的 nginx 配置目录，默认 websites.nginx_sites_dir
+	DisableSchedule bool   `json:"disable_schedule"` // 不在巡检中每天自动备份
+}
+
+// RemoteConfig 通过 SSH 巡检和执行命令的远程主机（主机列表保存在数据库中）
+type RemoteConfig struct {
+	KnownHosts            string `json:"known_hosts"`              // 校验主机密钥的 known_hosts 文件，默认 ~/.ssh/known_hosts
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key"` // 不校验主机密钥，仅用于测试环境
+	ConnectTimeout        int    `json:"connect_timeout"`          // 建立连接的超时（秒），默认 10 秒
+	StatsInterval         int    `json:"stats_interval"`           // 采集远程主机监控数据的间隔（秒），默认 10 秒
+}
+
+// LogRetentionConfig 日志保留配置，0 表示使用默认值
+type LogRetentionConfig struct {
+	MaxSizeMB  int   `json:"max_size_mb"`  // 单个日志文件轮转阈值（MB）
+	MaxBackups int   `json:"max_backups"`  // 保留的轮转文件数量
+	MaxAgeDays int   `json:"max_age_days"` // 轮转文件最长保留天数
+	MaxTotalMB int64 `json:"max_total_mb"` // 轮转文件总大小上限（MB），仅 qwq logs prune 时生效
+	NoCompress bool  `json:"no_compress"`  // 不压缩轮转文件
+}
+
+// TemplateSourceConfig 应用商店远程模板源（Git 仓库）
+type TemplateSourceConfig struct {
+	ID        string `json:"id"`         // 模板源ID，用于 API 和命令行引用
+	URL       string `json:"url"`        // Git 仓库地址
+	Branch    string `json:"branch"`     // 分支，为空时使用远程默认分支
+	DeployKey string `json:"deploy_key"` // SSH 部署私钥文件路径（可选）
+}
+
+// AppStoreConfig 应用商店配置
+type AppStoreConfig struct {
+	Sources      []TemplateSourceConfig `json:"sources"`
+	SyncInterval int                    `json:"sync_interval"` // 定时同步间隔（分钟），0 表示不定时同步
+	CacheDir     string                 `json:"cache_dir"`     // 仓库克隆缓存目录
+}
+
+// DatabaseConfig 数据库连接配置
+type DatabaseConfig struct {
+	Type          string `json:"type"` // sqlite（默认）或 postgres
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	User          string `json:"user"`
+	Password      string `json:"password"`
+	DBName        string `json:"dbname"`
+	SSLMode       string `json:"sslmode"`
+	DSN           string `json:"dsn"`             // PostgreSQL 连接串，非空时忽略 host 等字段
+	Path          string `json:"path"`            // SQLite 共享数据库文件，所有服务共用，默认 data/qwq.db
+	Dir           string `json:"dir"`             // SQLite 按服务分库的目录（<dir>/<服务>.db），path 为空时生效
+	BusyTimeoutMS int    `json:"busy_timeout_ms"` // SQLite 等待写锁的时间（毫秒），0 表示使用默认值
+	MaxOpenConns  int    `json:"max_open_conns"`  // 连接池最大连接数，0 表示使用默认值
+}
+
+// HealthScoreConfig 健康评分配置，0 表示使用默认值
+type HealthScoreConfig struct {
+	IncidentsWeight    float64 `json:"incidents_weight"`    // 未关闭异常
+	ResourcesWeight    float64 `json:"resources_weight"`    // CPU/内存/磁盘余量
+	ServicesWeight     float64 `json:"services_weight"`     // 服务/HTTP 检查
+	CertificatesWeight float64 `json:"certificates_weight"` // 证书到期
+	DeploymentsWeight  float64 `json:"deployments_weight"`  // 近 7 天部署失败率
+	PatrolWeight       float64 `json:"patrol_weight"`       // 巡检检查项失败
+	CPUThreshold       float64 `json:"cpu_threshold"`       // CPU 使用率阈值（百分比，按 1 分钟负载/核数计算）
+	MemThreshold       float64 `json:"mem_threshold"`       // 内存使用率阈值（百分比）
+	DiskThreshold      float64 `json:"disk_threshold"`      // 磁盘使用率阈值（百分比）
+	CertWarnDays       int     `json:"cert_warn_days"`      // 证书到期预警天数
+	DropThreshold      int     `json:"drop_threshold"`      // 相邻两次巡检评分下降超过该值时告警，负数表示不告警
+}
+
+// StatusPageConfig 只读公开状态页配置
+type StatusPageConfig struct {
+	Enabled            bool   `json:"enabled"`
+	Token              string `json:"token"`                // 非空时访问需携带 ?token= 或 Bearer Token
+	Title              string `json:"title"`                // 页面标题，默认使用主机名
+	ShowIncidentTitles bool   `json:"show_incident_titles"` // 是否展示异常标题，默认只展示数量
+	CacheSeconds       int    `json:"cache_seconds"`        // 缓存时间（秒），0 表示使用默认值
+}
+
+// AutoExecRule 自动执行策略规则，按顺序匹配，第一条匹配的规则生效
+type AutoExecRule struct {
+	Name    string `json:"name"`    // 规则名称，用于审计日志，为空时使用序号
+	Match   string `json:"match"`   // 匹配方式：prefix（命令前缀，按单词边界）或 regex
+	Pattern string `json:"pattern"` // 前缀或正则表达式
+	Action  string `json:"action"`  // auto 或 allow（自动执行）、confirm（需要确认）或 deny（拒绝）
+	Reason  string `json:"reason"`  // 命中规则时展示给用户的说明，可选
+}
+
+// AutoExecCase 自动执行策略测试用例，qwq config check 时校验
+type AutoExecCase struct {
+	Command string `json:"command"`
+	Expect  string `json:"expect"` // 期望的处理方式：auto/confirm/deny
+}
+
+// AutoExecConfig 对话中命令自动执行策略，未配置规则时使用内置默认策略
+type AutoExecConfig struct {
+	Rules   []AutoExecRule `json:"rules"`
+	Default string         `json:"default"` // 没有规则匹配时的处理方式，默认 confirm
+	Tests   []AutoExecCase `json:"tests"`
+	// ApprovalTimeout Web 对话中等待用户确认命令的时间（秒），默认 120，超时视为拒绝
+	ApprovalTimeout int `json:"approval_timeout"`
+}
+
+// ImageBuildConfig 部署前在主机上构建镜像（compose 服务的 build），0 或空值表示使用默认值
+type ImageBuildConfig struct {
+	Builder      string   `json:"builder"`       // 构建方式：api（默认，Docker Engine API）或 buildctl（BuildKit）
+	BuildkitAddr string   `json:"buildkit_addr"` // buildctl 连接的 buildkitd 地址，为空时使用 buildctl 的默认地址
+	AllowedDirs  []string `json:"allowed_dirs"`  // 允许作为本地构建上下文的目录，未配置时只能从 git 仓库构建
+	WorkspaceDir string   `json:"workspace_dir"` // 克隆 git 仓库的工作目录，默认 data/build，多次部署之间保留
+	CacheMaxGB   float64  `json:"cache_max_gb"`  // 构建缓存上限（GB），默认 20，超出后清理到该大小；负数表示不清理
+}
+
+// DeploymentApprovalConfig 部署审批配置
+type DeploymentApprovalConfig struct {
+	AllowSelfApproval bool `json:"allow_self_approval"` // 是否允许发起人审批自己的部署
+	ExpiryHours       int  `json:"expiry_hours"`        // 待审批部署的过期时间（小时），0 表示使用默认值
+	Notify            bool `json:"notify"`              // 有新的待审批部署时推送通知
+}
+
+// AnalysisBudgetConfig 后台 AI 分析的上下文预算，0 表示使用默认值
+type AnalysisBudgetConfig struct {
+	MaxTokens int `json:"max_tokens"` // 单次分析请求中异常报告的估算 token 上限
+	KeepLines int `json:"keep_lines"` // 压缩时每段原始输出保留的首尾行数
+	// ContextTokens 模型上下文窗口的估算 token 数，默认 32000；对话中的命令输出按剩余空间压缩
+	ContextTokens int `json:"context_tokens"`
+	// HistoryTokens 对话历史的估算 token 上限，超出时较早的对话压缩为摘要，默认为上下文窗口扣除回复预留后的四分之三
+	HistoryTokens int `json:"history_tokens"`
+	KeepTurns     int `json:"keep_turns"` // 压缩对话历史时原样保留的最近轮数，默认 4
+}
+
+// FirewallConfig 主机防火墙配置
+type FirewallConfig struct {
+	Manage      bool   `json:"manage"`       // 是否允许 qwq 管理专用链中的放行规则，关闭时只提供只读的暴露面报告
+	Chain       string `json:"chain"`        // qwq 专用的 iptables 链名，默认 QWQ-ALLOW
+	PublicPorts []int  `json:"public_ports"` // 有意对外开放的端口，暴露在所有网卡上时不告警
+}
+
+// ArchiveS3Config 归档文件上传的 S3 兼容对象存储，endpoint 为空时只保存本地文件
+type ArchiveS3Config struct {
+	Endpoint  string `json:"endpoint"` // 如 https://s3.amazonaws.com 或 http://minio:9000
+	Region    string `json:"region"`   // 默认 us-east-1
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"` // 对象 key 前缀
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// ArchiveConfig 历史记录归档配置，0 表示使用默认值
+type ArchiveConfig struct {
+	Enabled       bool            `json:"enabled"`        // 是否在 web/patrol 模式下定时归档
+	MaxAgeDays    int             `json:"max_age_days"`   // 保留天数，超过的记录被归档，默认 90
+	Dir           string          `json:"dir"`            // 归档文件目录，默认 archive
+	IntervalHours int             `json:"interval_hours"` // 定时归档间隔（小时），默认 24
+	S3            ArchiveS3Config `json:"s3"`
+}
+
+// NotifyChannelConfig 命名通知渠道
+type NotifyChannelConfig struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`               // dingtalk、slack、telegram、email 或 webhook
+	Disabled       bool   `json:"disabled,omitempty"` // 停用该渠道：引用它的路由照常匹配，但不再发送
+	Webhook        string `json:"webhook"`            // 钉钉机器人、Slack Incoming Webhook 或通用 Webhook 的地址
+	TelegramToken  string `json:"telegram_token"`     // Telegram Bot Token
+	TelegramChatID string `json:"telegram_chat_id"`   // Telegram 会话 ID
+
+	// email 渠道
+	SMTPHost     string   `json:"smtp_host,omitempty"`
+	SMTPPort     int      `json:"smtp_port,omitempty"`     // 默认 starttls 587、ssl 465、none 25
+	SMTPSecurity string   `json:"smtp_security,omitempty"` // starttls（默认）、ssl 或 none
+	SMTPUsername string   `json:"smtp_username,omitempty"` // 为空时不认证
+	SMTPPassword string   `json:"smtp_password,omitempty"`
+	From         string   `json:"from,omitempty"`
+	To           []string `json:"to,omitempty"`
+
+	// webhook 渠道
+	Secret          string `json:"secret,omitempty"`           // 设置后用 HMAC-SHA256 对请求体签名
+	SignatureHeader string `json:"signature_header,omitempty"` // 签名所在的请求头，默认 X-QWQ-Signature
+	Template        string `json:"template,omitempty"`         // JSON 请求体模板，{{title}}、{{body}} 替换为标题和正文，默认 {"title":"{{title}}","body":"{{body}}"}
+
+	QuietHours []NotifyQuietHoursConfig `json:"quiet_hours"` // 静默时段，时段内的 warning/info 通知排队，结束后合并为一条摘要发送
+}
+
+// NotifyQuietHoursConfig 渠道的静默时段，critical 通知不受静默时段影响
+type NotifyQuietHoursConfig struct {
+	Hours    string   `json:"hours"`    // 时段，如 "22:00-08:00"，支持跨零点，起止相同表示全天
+	Days     []string `json:"days"`     // 星期（mon、tue ... sun），跨零点的时段按开始的那天计算，为空表示每天
+	Timezone string   `json:"timezone"` // 时区，如 Asia/Shanghai，为空时为 UTC，与主机时区无关
+}
+
+// NotifyRouteConfig 通知路由规则，条件为空表示不限制，按顺序匹配，第一条匹配的规则生效
+type NotifyRouteConfig struct {
+	Name          string   `json:"name"`           // 规则名称，记录在巡检结果中，为空时使用序号
+	Severities    []string `json:"severities"`     // 严重程度：critical、warning、info
+	Categories    []string `json:"categories"`     // 异常类别（巡检检查项名称），支持 * 通配符，如 rule:*
+	Hosts         []string `json:"hosts"`          // 主机名，支持 * 通配符
+	Tags          []string `json:"tags"`           // 事件带有其中任意一个标签时匹配
+	Hours         string   `json:"hours"`          // 生效时段，如 "09:00-18:00"，支持跨零点
+	Channels      []string `json:"channels"`       // 接收通知的渠道名称
+	EscalateAfter int      `json:"escalate_after"` // 严重异常持续未恢复超过该分钟数后升级通知，0 表示不升级
+	EscalateTo    []string `json:"escalate_to"`    // 升级通知的渠道名称
+}
+
+// NotifyRoutingConfig 通知路由配置，未配置时所有通知发送到 default 渠道（webhook/telegram_token 配置）
+type NotifyRoutingConfig struct {
+	Channels []NotifyChannelConfig `json:"channels"`
+	Routes   []NotifyRouteConfig   `json:"routes"`
+	Default  []string              `json:"default"` // 没有规则匹配时的渠道，默认 ["default"]
+	Tags     []string              `json:"tags"`    // 本机标签，附加到本机产生的所有事件上
+}
+
+// AlertmanagerConfig 巡检异常推送到 Prometheus Alertmanager 的配置
+type AlertmanagerConfig struct {
+	URL    string            `json:"url"`    // Alertmanager 地址，如 http://alertmanager:9093，为空时不推送
+	Labels map[string]string `json:"labels"` // 附加到所有告警上的标签，如 {"team": "ops"}
+}
+
+// PagerDutyConfig 巡检异常推送到 PagerDuty Events v2 的配置
+type PagerDutyConfig struct {
+	RoutingKey   string `json:"routing_key"`   // Events v2 集成的 Integration Key，为空时不推送
+	URL          string `json:"url"`           // 事件接口地址，默认 https://events.pagerduty.com/v2/enqueue
+	CriticalOnly bool   `json:"critical_only"` // 只推送严重异常，警告不呼叫值班人员
+}
+
+// IntegrationsConfig 外部告警系统集成，与通知路由并行推送巡检异常
+type IntegrationsConfig struct {
+	Alertmanager AlertmanagerConfig `json:"alertmanager"`
+	PagerDuty    PagerDutyConfig    `json:"pagerduty"`
+	Retries      int                `json:"retries"` // 推送失败后的重试次数，默认 3，按指数退避
 }
 
 // Config 全局配置
 type Config struct {
-	ApiKey          string       `json:"api_key"`
-	BaseURL         string       `json:"base_url"`
-	Model           string       `json:"model"`
-	DingTalkWebhook string       `json:"webhook"`
-	TelegramToken   string       `json:"telegram_token"`
-	TelegramChatID  string       `json:"telegram_chat_id"`
-	WebUser         string       `json:"web_user"`
-	WebPassword     string       `json:"web_password"`
-	KnowledgeFile   string       `json:"knowledge_file"`
-	DebugMode       bool         `json:"debug"`
-	PatrolRules     []PatrolRule `json:"patrol_rules"`
-	HTTPRules       []HTTPRule   `json:"http_rules"`
+	ApiKey             string                   `json:"api_key"`
+	BaseURL            string                   `json:"base_url"`
+	Model              string                   `json:"model"`
+	NoStream           bool                     `json:"no_stream"` // Web 对话不使用流式响应，等模型生成完整回答后一次发送
+	Models             ModelsConfig             `json:"models"`
+	DingTalkWebhook    string                   `json:"webhook"`
+	TelegramToken      string                   `json:"telegram_token"`
+	TelegramChatID     string                   `json:"telegram_chat_id"`
+	WebhookProbe       bool                     `json:"webhook_probe"` // 启动时探测通知渠道连通性并记录到日志
+	WebUser            string                   `json:"web_user"`
+	WebPassword        string                   `json:"web_password"`
+	Auth               AuthConfig               `json:"auth"`
+	KnowledgeFile      string                   `json:"knowledge_file"`
+	DebugMode          bool                     `json:"debug"`
+	PatrolRules        []PatrolRule             `json:"patrol_rules"`
+	HTTPRules          []HTTPRule               `json:"http_rules"`
+	AILimits           AILimitConfig            `json:"ai_limits"`
+	Snapshot           SnapshotConfig           `json:"snapshot"`
+	Backup             BackupConfig             `json:"backup"`
+	Remote             RemoteConfig             `json:"remote"`
+	DockerBackend      string                   `json:"docker_backend"` // Docker 操作方式：api（默认，通过 Docker Engine API）或 cli
+	LogRetention       LogRetentionConfig       `json:"log_retention"`
+	Patrol             PatrolConfig             `json:"patrol"`
+	Database           DatabaseConfig           `json:"database"`
+	AppStore           AppStoreConfig           `json:"appstore"`
+	HealthScore        HealthScoreConfig        `json:"health_score"`
+	StatusPage         StatusPageConfig         `json:"status_page"`
+	AutoExec           AutoExecConfig           `json:"autoexec"`
+	CommandTimeout     int                      `json:"command_timeout"` // 单条 shell 命令的超时（秒），0 表示默认 60 秒
+	DeploymentApproval DeploymentApprovalConfig `json:"deployment_approval"`
+	ImageBuild         ImageBuildConfig         `json:"image_build"`
+	AnalysisBudget     AnalysisBudgetConfig     `json:"analysis_budget"`
+	Firewall           FirewallConfig           `json:"firewall"`
+	NotifyRouting      NotifyRoutingConfig      `json:"notify_routing"`
+	Integrations       IntegrationsConfig       `json:"integrations"`
+	Archive            ArchiveConfig            `json:"archive"`
+	Modules            ModulesConfig            `json:"modules"`
+	CORS               CORSConfig               `json:"cors"`
+	TrustedProxies     []string                 `json:"trusted_proxies"` // 可信反向代理的 IP 或 CIDR，只有来自这些地址的请求才读取 X-Forwarded-For / X-Real-IP
+	Terminal           TerminalConfig           `json:"terminal"`
+	Resources          ResourcesConfig          `json:"resources"`
+	Drift              DriftConfig              `json:"drift"`
+	ComposeAnalysis    ComposeAnalysisConfig    `json:"compose_analysis"`
+	Cache              CacheConfig              `json:"cache"`
+	ChatHistory        ChatHistoryConfig        `json:"chat_history"`
+	Files              FilesConfig              `json:"files"`
+	Websites           WebsitesConfig           `json:"websites"`
+	ACME               ACMEConfig               `json:"acme"`
+	DNS                DNSConfig                `json:"dns"`
+	Events             EventsConfig             `json:"events"`
+	Anomalies          AnomaliesConfig          `json:"anomalies"`
+	AgentRecordDir     string                   `json:"agent_record_dir"` // 录制 Agent 对话（请求、响应、命令结果）到该目录，用于回放回归测试
+	OverridesFile      string                   `json:"overrides_file"`   // 运行时修改的配置保存位置，默认为配置文件旁的 <name>.overrides.json
 }
 
 var (
+	// GlobalConfig 启动时的配置缓冲区：命令行参数绑定到这里，Init 在其上加载配置文件和环境变量后发布为快照。
+	// Init 之后不再读写，运行期间通过 Current 读取配置
 	GlobalConfig    Config
 	CachedKnowledge string
+
+	// loadedPath 已加载的配置文件路径，用于热加载
+	loadedPath string
 )
 
 func Init(configPath string) error {
@@ -46,6 +619,7 @@ func Init(configPath string) error {
 		if err := loadFromFile(configPath); err != nil {
 			return fmt.Errorf("加载配置文件失败: %v", err)
 		}
+		loadedPath = configPath
 	}
 
 	// 环境变量覆盖
@@ -56,27 +630,97 @@ func Init(configPath string) error {
 		GlobalConfig.BaseURL = envBase
 	}
 
-	// 必填检查 (Ollama 模式下 ApiKey 可以随便填，但不能为空)
-	if GlobalConfig.ApiKey == "" {
-		return errors.New("critical: 未找到 API Key")
+	warnings, err := ValidateWebhooks(&GlobalConfig)
+	if err != nil {
+		return fmt.Errorf("通知地址配置无效: %w", err)
 	}
+	webhookWarnings = warnings
+	startup := GlobalConfig
+	Store(&startup)
+
+	// 运行时修改的配置保存在单独的覆盖文件中，配置文件保持不变
+	overridesFile := GlobalConfig.OverridesFile
+	if overridesFile == "" {
+		overridesFile = defaultOverridesPath(configPath)
+	}
+	if err := loadOverrides(overridesFile); err != nil {
+		return err
+	}
+
+	// 未配置 API Key 时不再报错：AI 功能禁用，面板、巡检、容器管理等照常可用
+	// (Ollama 等本地端点只需配置 base_url)
 
 	// 加载知识库
-	if GlobalConfig.KnowledgeFile != "" {
-		content, err := os.ReadFile(GlobalConfig.KnowledgeFile)
+	if knowledgeFile := Current().KnowledgeFile; knowledgeFile != "" {
+		content, err := os.ReadFile(knowledgeFile)
 		if err == nil {
 			CachedKnowledge = string(content)
-			fmt.Printf("📚 已加载知识库: %s (%d bytes)\n", GlobalConfig.KnowledgeFile, len(content))
+			fmt.Printf("📚 已加载知识库: %s (%d bytes)\n", knowledgeFile, len(content))
 		}
 	}
 
 	return nil
 }
 
+// Files 启动时加载的配置文件和运行时覆盖文件的路径，没有配置文件时只包含覆盖文件
+func Files() []string {
+	var files []string
+	if loadedPath != "" {
+		files = append(files, loadedPath)
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if overridesPath != "" {
+		files = append(files, overridesPath)
+	}
+	return files
+}
+
+// ReloadAILimits 从配置文件重新加载 AI 限流配置
+// 只更新限流相关字段，其余配置保持当前值；以新快照发布，正在读取旧快照的请求不受影响
+func ReloadAILimits() error {
+	if loadedPath == "" {
+		return errors.New("未指定配置文件，无法热加载")
+	}
+	data, err := os.ReadFile(loadedPath)
+	if err != nil {
+		return err
+	}
+	var fresh struct {
+		AILimits AILimitConfig `json:"ai_limits"`
+	}
+	if err := json.Unmarshal(StripComments(data), &fresh); err != nil {
+		return err
+	}
+	Update(func(cfg *Config) { cfg.AILimits = fresh.AILimits })
+	return nil
+}
+
 func loadFromFile(path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, &GlobalConfig)
-}
\ No newline at end of file
+	// 命令行参数优先于配置文件：qwq init 生成的文件包含所有字段，空值不能覆盖参数
+	flags := GlobalConfig
+	if err := json.Unmarshal(StripComments(data), &GlobalConfig); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		dst  *string
+		flag string
+	}{
+		{&GlobalConfig.DingTalkWebhook, flags.DingTalkWebhook},
+		{&GlobalConfig.WebUser, flags.WebUser},
+		{&GlobalConfig.WebPassword, flags.WebPassword},
+		{&GlobalConfig.KnowledgeFile, flags.KnowledgeFile},
+		{&GlobalConfig.AgentRecordDir, flags.AgentRecordDir},
+	} {
+		if field.flag != "" {
+			*field.dst = field.flag
+		}
+	}
+	GlobalConfig.Terminal.NoColor = GlobalConfig.Terminal.NoColor || flags.Terminal.NoColor
+	GlobalConfig.Terminal.AssumeYes = GlobalConfig.Terminal.AssumeYes || flags.Terminal.AssumeYes
+	return nil
+}
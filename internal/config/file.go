@@ -0,0 +1,291 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// logSizePattern docker log-opt max-size 的取值
+var logSizePattern = regexp.MustCompile(`^[1-9][0-9]*[kmg]$`)
+
+// ErrInvalidConfig 配置值无效
+var ErrInvalidConfig = errors.New("invalid config")
+
+// topLevelComments qwq init 写入配置文件时附在顶层字段前的说明
+var topLevelComments = map[string]string{
+	"api_key":             "AI 服务 API Key，留空且未配置 base_url 时禁用 AI 功能（也可用环境变量 OPENAI_API_KEY）",
+	"base_url":            "OpenAI 兼容接口地址，如 https://api.openai.com/v1 或 Ollama 的 http://127.0.0.1:11434/v1",
+	"model":               "模型名称",
+	"models":              "多模型配置：profiles 定义模型，routes 指定对话、巡检分析、优化建议各自使用的模型，fallback 为连接失败时的备用模型",
+	"webhook":             "钉钉机器人 Webhook（默认通知渠道）",
+	"telegram_token":      "Telegram Bot Token（默认通知渠道）",
+	"telegram_chat_id":    "Telegram 会话 ID",
+	"webhook_probe":       "启动时探测通知渠道连通性并记录到日志",
+	"web_user":            "Web 控制台用户名，与 web_password 都为空时不启用认证",
+	"web_password":        "Web 控制台密码",
+	"knowledge_file":      "知识库文件，内容会附加到 AI 对话的上下文中",
+	"debug":               "输出调试日志",
+	"patrol_rules":        "自定义巡检规则：命令 stdout 有输出即告警",
+	"http_rules":          "HTTP 监控规则",
+	"ai_limits":           "AI 调用限流，0 表示使用默认值",
+	"snapshot":            "容器卷快照",
+	"docker_backend":      "Docker 操作方式：api（默认）或 cli",
+	"log_retention":       "日志轮转与保留",
+	"patrol":              "巡检执行配置与阈值，0 表示使用默认值（磁盘 85%、1 分钟负载 4.0、时钟偏差 500ms、容器日志 1GB）",
+	"database":            "数据库，默认使用 SQLite",
+	"appstore":            "应用商店模板源与同步",
+	"health_score":        "主机健康评分权重与阈值",
+	"status_page":         "只读公开状态页",
+	"autoexec":            "对话中命令自动执行策略，未配置规则时使用内置默认策略",
+	"deployment_approval": "部署审批",
+	"analysis_budget":     "后台 AI 分析的上下文预算",
+	"firewall":            "主机防火墙",
+	"notify_routing":      "通知路由：命名渠道和按严重程度、类别、时段分发的规则",
+	"integrations":        "外部告警系统：巡检异常同时推送到 Alertmanager 和 PagerDuty，异常恢复后自动关闭",
+	"archive":             "历史记录归档",
+	"modules":             "可选模块开关，默认全部启用",
+	"cors":                "API 跨域访问，默认只允许同源；前端单独部署时在 allowed_origins 中列出其地址",
+	"trusted_proxies":     "可信反向代理（IP 或 CIDR），如本机 nginx 填 127.0.0.1；只有来自这些地址的请求才使用 X-Forwarded-For 中的客户端地址",
+	"resources":           "qwq 自身的内存缓存上限，运行在容器中且接近内存限制时自动收缩并告警",
+	"drift":               "检测生成的 nginx 配置和 compose 项目文件是否被手工修改，发现后阻止下一次覆盖，直到在面板中选择保留或覆盖",
+	"compose_analysis":    "定时重新分析所有 Compose 项目的架构和性能，记录健康评分趋势，评分下降时通知；no_ai_suggestions 关闭优化建议的 AI 补充",
+	"cache":               "进程内缓存（AI 分析结果、HTTP 检查结果）：默认延迟写入数据库，重启后恢复",
+	"terminal":            "命令行对话的终端输出：颜色、换行宽度和 Markdown 样式",
+	"agent_record_dir":    "录制 Agent 对话到该目录（脱敏后的 JSON），用于回放回归测试，留空不录制",
+	"overrides_file":      "运行时修改的配置保存位置，默认为配置文件旁的 <name>.overrides.json",
+}
+
+// StripComments 去掉 JSON 中字符串以外的 // 行注释和 /* */ 块注释，配置文件因此可以带注释
+func StripComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			out = append(out, c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				if data[i] == '\n' {
+					out = append(out, '\n')
+				}
+				i++
+			}
+			i++
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// LoadFile 读取配置文件（支持注释）但不发布为当前配置，供 qwq init 合并已有配置
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(StripComments(data), &cfg); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, filepath.Base(path), err)
+	}
+	return &cfg, nil
+}
+
+// Validate 校验配置中的取值范围，qwq config check 和 qwq init 使用
+func Validate(cfg *Config) error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidConfig}, args...)...))
+	}
+
+	if cfg.WebPassword != "" && strings.TrimSpace(cfg.WebUser) == "" {
+		invalid("web_password is set but web_user is empty")
+	}
+	if p := cfg.Patrol; p.DiskThreshold < 0 || p.DiskThreshold > 100 {
+		invalid("patrol.disk_threshold must be between 0 and 100")
+	}
+	if cfg.Patrol.LoadThreshold < 0 {
+		invalid("patrol.load_threshold must not be negative")
+	}
+	if cfg.Patrol.Concurrency < 0 || cfg.Patrol.CheckTimeout < 0 {
+		invalid("patrol.concurrency and patrol.check_timeout must not be negative")
+	}
+	if c := cfg.Patrol.Clock; c.WarnMS < 0 || c.CriticalMS < 0 {
+		invalid("patrol.clock thresholds must not be negative")
+	} else if c.WarnMS > 0 && c.CriticalMS > 0 && c.WarnMS > c.CriticalMS {
+		invalid("patrol.clock.warn_ms must not exceed critical_ms")
+	}
+	if c := cfg.Patrol.ContainerLogs; c.MaxSizeMB < 0 || c.GrowthMB < 0 || c.RotateMaxFile < 0 {
+		invalid("patrol.container_logs thresholds must not be negative")
+	}
+	if size := cfg.Patrol.ContainerLogs.RotateMaxSize; size != "" && !logSizePattern.MatchString(size) {
+		invalid("patrol.container_logs.rotate_max_size %q must look like 100m, 1g or 500k", size)
+	}
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if origin == "*" {
+			if cfg.CORS.AllowCredentials {
+				invalid("cors.allowed_origins must not contain * when allow_credentials is set")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			invalid("cors.allowed_origins entry %q must be scheme://host[:port]", origin)
+		}
+	}
+	if cfg.CORS.MaxAge < 0 {
+		invalid("cors.max_age must not be negative")
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				invalid("trusted_proxies entry %q must be an IP or CIDR", proxy)
+			}
+		}
+	}
+	if r := cfg.Resources; r.StatsHistory < 0 || r.LogBuffer < 0 || r.MetricsHistory < 0 {
+		invalid("resources limits must not be negative")
+	}
+	if p := cfg.Resources.PressurePercent; p < 0 || p > 100 {
+		invalid("resources.pressure_percent must be between 0 and 100")
+	}
+	for _, endpoint := range []struct{ field, value string }{
+		{"integrations.alertmanager.url", cfg.Integrations.Alertmanager.URL},
+		{"integrations.pagerduty.url", cfg.Integrations.PagerDuty.URL},
+	} {
+		if endpoint.value == "" {
+			continue
+		}
+		if u, err := url.Parse(endpoint.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("%s %q must be an http(s) URL", endpoint.field, endpoint.value)
+		}
+	}
+	if cfg.Integrations.Retries < 0 {
+		invalid("integrations.retries must not be negative")
+	}
+	if cfg.Drift.Interval < 0 {
+		invalid("drift.interval must not be negative")
+	}
+	if cfg.ComposeAnalysis.IntervalHours < 0 {
+		invalid("compose_analysis.interval_hours must not be negative")
+	}
+	if cfg.Terminal.WrapWidth < 0 {
+		invalid("terminal.wrap_width must not be negative")
+	}
+	switch cfg.Terminal.Style {
+	case "", "auto", "dark", "light", "notty", "ascii", "dracula":
+	default:
+		invalid("terminal.style %q is not a known style", cfg.Terminal.Style)
+	}
+	validateModels(cfg.Models, invalid)
+	switch cfg.DockerBackend {
+	case "", "api", "cli":
+	default:
+		invalid("docker_backend must be api or cli, got %q", cfg.DockerBackend)
+	}
+	return errors.Join(errs...)
+}
+
+// validateModels 检查模型配置：名称唯一，routes 和 fallback 引用的配置存在，用途已知
+func validateModels(m ModelsConfig, invalid func(format string, args ...interface{})) {
+	names := map[string]bool{DefaultModelProfile: true}
+	for i, profile := range m.Profiles {
+		switch {
+		case profile.Name == "":
+			invalid("models.profiles[%d] has no name", i)
+			continue
+		case profile.Name == DefaultModelProfile:
+			invalid("models.profiles name %q is reserved for api_key/base_url/model", profile.Name)
+		case names[profile.Name]:
+			invalid("models.profiles name %q is duplicated", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.BaseURL != "" {
+			if u, err := url.Parse(profile.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				invalid("models.profiles %q base_url %q must be an http(s) URL", profile.Name, profile.BaseURL)
+			}
+		}
+		if t := profile.Temperature; t != nil && (*t < 0 || *t > 2) {
+			invalid("models.profiles %q temperature must be between 0 and 2", profile.Name)
+		}
+		if profile.MaxTokens < 0 {
+			invalid("models.profiles %q max_tokens must not be negative", profile.Name)
+		}
+	}
+	for useCase, name := range m.Routes {
+		switch useCase {
+		case UseChat, UsePatrolAnalysis, UseOptimizer:
+		default:
+			invalid("models.routes use case %q must be chat, patrol_analysis or optimizer", useCase)
+		}
+		if !names[name] {
+			invalid("models.routes %s refers to unknown profile %q", useCase, name)
+		}
+	}
+	if m.Fallback != "" && !names[m.Fallback] {
+		invalid("models.fallback refers to unknown profile %q", m.Fallback)
+	}
+}
+
+// RenderCommented 将配置渲染为带注释的 JSON，顶层字段前附带说明
+func RenderCommented(cfg *Config) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// qwq 配置文件，由 qwq init 生成。支持 // 注释，修改后可运行 qwq config check 校验\n")
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, `  "`) && !strings.HasPrefix(line, `   `) {
+			key, _, _ := strings.Cut(strings.TrimPrefix(line, `  "`), `"`)
+			if comment := topLevelComments[key]; comment != "" {
+				buf.WriteString("  // " + comment + "\n")
+			}
+		}
+		buf.WriteString(line + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFile 原子写入配置文件，文件包含密钥，权限为 0600
+func WriteFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	input := `// header
+{
+  /* block
+     comment */
+  "base_url": "http://127.0.0.1:11434/v1", // trailing
+  "model": "a \"//quoted\" /* name */"
+}`
+	got := string(StripComments([]byte(input)))
+	for _, want := range []string{`"base_url": "http://127.0.0.1:11434/v1",`, `"model": "a \"//quoted\" /* name */"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q to survive, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "header") || strings.Contains(got, "block") || strings.Contains(got, "trailing") {
+		t.Errorf("Expected comments to be removed, got:\n%s", got)
+	}
+	// 保留换行，JSON 报错时的行号与原文件一致
+	if strings.Count(got, "\n") != strings.Count(input, "\n") {
+		t.Errorf("Expected line count to be preserved, got:\n%s", got)
+	}
+}
+
+func TestRenderCommented_RoundTrip(t *testing.T) {
+	cfg := &Config{
+		BaseURL:  "http://127.0.0.1:11434/v1",
+		WebUser:  "admin",
+		Patrol:   PatrolConfig{DiskThreshold: 90, LoadThreshold: 6.5},
+		Modules:  ModulesConfig{DisableGateway: true},
+		AutoExec: AutoExecConfig{Default: "confirm"},
+	}
+	data, err := RenderCommented(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "// ") || !strings.Contains(string(data), "  // "+topLevelComments["modules"]+"\n  \"modules\"") {
+		t.Errorf("Expected comments before top-level keys, got:\n%s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), "qwq.json")
+	if err := WriteFile(path, data); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600 config file, got %v %v", info.Mode(), err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if loaded.BaseURL != cfg.BaseURL || !reflect.DeepEqual(loaded.Patrol, cfg.Patrol) || loaded.Modules != cfg.Modules {
+		t.Errorf("Round trip mismatch: %+v", loaded)
+	}
+
+	if err := os.WriteFile(path, []byte("{ // broken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(&Config{WebUser: "admin", WebPassword: "secret", Patrol: PatrolConfig{DiskThreshold: 85}}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	models := ModelsConfig{
+		Profiles: []ModelProfile{{Name: "local", BaseURL: "http://127.0.0.1:11434/v1", Model: "qwen2.5:7b"}},
+		Routes:   map[string]string{UsePatrolAnalysis: "local", UseChat: "default"},
+		Fallback: "local",
+	}
+	if err := Validate(&Config{Models: models}); err != nil {
+		t.Errorf("Expected valid model profiles, got %v", err)
+	}
+
+	cfg := &Config{
+		WebPassword:     "secret",
+		DockerBackend:   "podman",
+		CORS:            CORSConfig{AllowedOrigins: []string{"*", "ops.example.com"}, AllowCredentials: true},
+		Terminal:        TerminalConfig{WrapWidth: -1, Style: "neon"},
+		TrustedProxies:  []string{"10.0.0.0/8", "nginx"},
+		Resources:       ResourcesConfig{LogBuffer: -1, PressurePercent: 150},
+		Drift:           DriftConfig{Interval: -5},
+		ComposeAnalysis: ComposeAnalysisConfig{IntervalHours: -1},
+		Patrol:          PatrolConfig{DiskThreshold: 120, LoadThreshold: -1, Clock: ClockConfig{WarnMS: 6000, CriticalMS: 5000}, ContainerLogs: ContainerLogsConfig{RotateMaxSize: "100MB"}},
+		Models: ModelsConfig{
+			Profiles: []ModelProfile{{Name: "local", BaseURL: "127.0.0.1:11434"}, {Name: "local"}, {Name: "default"}},
+			Routes:   map[string]string{UseChat: "local", "summary": "local", UseOptimizer: "gpt"},
+			Fallback: "backup",
+		},
+	}
+	err := Validate(cfg)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig, got %v", err)
+	}
+	for _, want := range []string{"web_user", "disk_threshold", "load_threshold", "warn_ms", "docker_backend", "contain *", "ops.example.com", "wrap_width", "terminal.style", `"nginx"`, "resources limits", "pressure_percent", "drift.interval", "compose_analysis.interval_hours", "rotate_max_size",
+		`base_url "127.0.0.1:11434"`, `"local" is duplicated`, `"default" is reserved`, `use case "summary"`, `unknown profile "gpt"`, `models.fallback`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %s to be reported, got %v", want, err)
+		}
+	}
+}
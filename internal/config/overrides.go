@@ -0,0 +1,561 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 可在运行时修改的配置部分
+const (
+	SectionPatrolRules   = "patrol_rules"
+	SectionHTTPRules     = "http_rules"
+	SectionNotifyRouting = "notify_routing"
+	SectionHealthScore   = "health_score"
+)
+
+// DynamicSections 所有可在运行时修改的配置部分
+var DynamicSections = []string{SectionPatrolRules, SectionHTTPRules, SectionNotifyRouting, SectionHealthScore}
+
+var (
+	// ErrVersionConflict 修改基于的版本已过期（其他人已修改），需要重新读取后再提交
+	ErrVersionConflict = errors.New("config version conflict")
+	// ErrInvalidDynamic 运行时配置校验失败
+	ErrInvalidDynamic = errors.New("invalid dynamic config")
+)
+
+// DynamicValues 运行时配置的值，字段为 nil 表示该部分未被覆盖（或不修改）
+type DynamicValues struct {
+	PatrolRules   *[]PatrolRule        `json:"patrol_rules,omitempty"`
+	HTTPRules     *[]HTTPRule          `json:"http_rules,omitempty"`
+	NotifyRouting *NotifyRoutingConfig `json:"notify_routing,omitempty"`
+	HealthScore   *HealthScoreConfig   `json:"health_score,omitempty"`
+}
+
+// httpMethodPattern HTTP 监控允许的请求方法格式（大写字母）
+var httpMethodPattern = regexp.MustCompile(`^[A-Z]+$`)
+
+// OverrideMeta 运行时覆盖的修改人和时间
+type OverrideMeta struct {
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// overrides 覆盖文件内容，版本号每次修改递增，用于乐观锁
+type overrides struct {
+	Version int                     `json:"version"`
+	Values  DynamicValues           `json:"values"`
+	Meta    map[string]OverrideMeta `json:"meta,omitempty"`
+}
+
+// DynamicSection 一部分运行时配置的当前生效值及来源
+type DynamicSection struct {
+	Source    string      `json:"source"` // file 或 override
+	Value     interface{} `json:"value"`
+	UpdatedBy string      `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time  `json:"updated_at,omitempty"`
+}
+
+// DynamicState 运行时配置的当前状态
+type DynamicState struct {
+	Version  int                       `json:"version"`
+	File     string                    `json:"overrides_file"`
+	Sections map[string]DynamicSection `json:"sections"`
+}
+
+var (
+	overridesMu   sync.Mutex
+	overridesPath string
+	current       overrides
+	// fileDynamic 配置文件中的值，撤销覆盖时恢复
+	fileDynamic DynamicValues
+)
+
+// defaultOverridesPath 覆盖文件默认放在配置文件旁边：qwq.json -> qwq.overrides.json
+func defaultOverridesPath(configPath string) string {
+	if configPath == "" {
+		return "qwq.overrides.json"
+	}
+	return strings.TrimSuffix(configPath, filepath.Ext(configPath)) + ".overrides.json"
+}
+
+// loadOverrides 记录配置文件中的值并应用覆盖文件，在 Init 中调用
+func loadOverrides(path string) error {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	overridesPath = path
+	fileDynamic = snapshotDynamic()
+	current = overrides{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return fmt.Errorf("运行时配置文件 %s 无效（删除该文件可恢复为配置文件中的值）: %w", path, err)
+	}
+	applyDynamic(current.Values)
+	return nil
+}
+
+// snapshotDynamic 复制当前生效的运行时配置
+func snapshotDynamic() DynamicValues {
+	cfg := Current()
+	patrolRules := append([]PatrolRule{}, cfg.PatrolRules...)
+	httpRules := append([]HTTPRule{}, cfg.HTTPRules...)
+	var routing NotifyRoutingConfig
+	copyJSON(&routing, cfg.NotifyRouting)
+	health := cfg.HealthScore
+	return DynamicValues{PatrolRules: &patrolRules, HTTPRules: &httpRules, NotifyRouting: &routing, HealthScore: &health}
+}
+
+// applyDynamic 将非 nil 的部分写入新的配置快照
+func applyDynamic(values DynamicValues) {
+	Update(func(cfg *Config) {
+		if values.PatrolRules != nil {
+			cfg.PatrolRules = *values.PatrolRules
+		}
+		if values.HTTPRules != nil {
+			cfg.HTTPRules = *values.HTTPRules
+		}
+		if values.NotifyRouting != nil {
+			cfg.NotifyRouting = *values.NotifyRouting
+		}
+		if values.HealthScore != nil {
+			cfg.HealthScore = *values.HealthScore
+		}
+	})
+}
+
+// Dynamic 返回运行时配置的当前生效值及来源
+func Dynamic() DynamicState {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	effective := snapshotDynamic()
+	state := DynamicState{Version: current.Version, File: overridesPath, Sections: make(map[string]DynamicSection)}
+	for _, section := range DynamicSections {
+		entry := DynamicSection{Source: "file", Value: sectionValue(effective, section)}
+		if sectionValue(current.Values, section) != nil {
+			entry.Source = "override"
+			if meta, ok := current.Meta[section]; ok {
+				updatedAt := meta.UpdatedAt
+				entry.UpdatedBy, entry.UpdatedAt = meta.UpdatedBy, &updatedAt
+			}
+		}
+		state.Sections[section] = entry
+	}
+	return state
+}
+
+// ApplyDynamic 校验并应用运行时修改，写入覆盖文件（配置文件保持不变）。
+// version 必须等于当前版本，否则返回 ErrVersionConflict；返回各部分的变更摘要（敏感字段已掩码）和新版本号
+func ApplyDynamic(update DynamicValues, version int, user string) (map[string]string, int, error) {
+	if err := validateDynamic(&update); err != nil {
+		return nil, 0, err
+	}
+
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if version != current.Version {
+		return nil, current.Version, fmt.Errorf("%w: submitted version %d, current version %d", ErrVersionConflict, version, current.Version)
+	}
+
+	effective := snapshotDynamic()
+	next := cloneOverrides(current)
+	diffs := make(map[string]string)
+	now := time.Now()
+	for _, section := range DynamicSections {
+		value := sectionValue(update, section)
+		if value == nil {
+			continue
+		}
+		diffs[section] = DiffJSON(sectionValue(effective, section), value)
+		setSection(&next.Values, section, value)
+		next.Meta[section] = OverrideMeta{UpdatedBy: user, UpdatedAt: now}
+	}
+	if len(diffs) == 0 {
+		return nil, current.Version, fmt.Errorf("%w: no sections to update", ErrInvalidDynamic)
+	}
+	next.Version++
+	if err := saveOverrides(next); err != nil {
+		return nil, current.Version, err
+	}
+	current = next
+	applyDynamic(update)
+	return diffs, current.Version, nil
+}
+
+// RevertDynamic 撤销指定部分的运行时覆盖，恢复为配置文件中的值，sections 为空时撤销全部
+func RevertDynamic(sections []string, version int, user string) (map[string]string, int, error) {
+	if len(sections) == 0 {
+		sections = DynamicSections
+	}
+	for _, section := range sections {
+		if !containsString(DynamicSections, section) {
+			return nil, 0, fmt.Errorf("%w: unknown section %q", ErrInvalidDynamic, section)
+		}
+	}
+
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if version != current.Version {
+		return nil, current.Version, fmt.Errorf("%w: submitted version %d, current version %d", ErrVersionConflict, version, current.Version)
+	}
+
+	effective := snapshotDynamic()
+	next := cloneOverrides(current)
+	var restore DynamicValues
+	diffs := make(map[string]string)
+	for _, section := range sections {
+		if sectionValue(next.Values, section) == nil {
+			continue
+		}
+		fileValue := sectionValue(fileDynamic, section)
+		diffs[section] = DiffJSON(sectionValue(effective, section), fileValue)
+		setSection(&next.Values, section, nil)
+		setSection(&restore, section, fileValue)
+		delete(next.Meta, section)
+	}
+	if len(diffs) == 0 {
+		return diffs, current.Version, nil
+	}
+	next.Version++
+	if err := saveOverrides(next); err != nil {
+		return nil, current.Version, err
+	}
+	current = next
+	var restored DynamicValues
+	copyJSON(&restored, restore)
+	applyDynamic(restored)
+	return diffs, current.Version, nil
+}
+
+// validateCheckRule 校验一条监控规则（http_rules[i]）
+func validateCheckRule(i int, rule HTTPRule) error {
+	switch rule.Type {
+	case "", CheckTypeHTTP:
+		u, err := url.Parse(rule.URL)
+		if strings.TrimSpace(rule.Name) == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: http_rules[%d]: name and an http(s) url are required", ErrInvalidDynamic, i)
+		}
+		if rule.Code != 0 && (rule.Code < 100 || rule.Code > 599) {
+			return fmt.Errorf("%w: http_rules[%s]: invalid status code %d", ErrInvalidDynamic, rule.Name, rule.Code)
+		}
+		if _, _, err := rule.ExpectedStatus(); err != nil {
+			return fmt.Errorf("%w: http_rules[%s]: %v", ErrInvalidDynamic, rule.Name, err)
+		}
+		if rule.Method != "" && !httpMethodPattern.MatchString(rule.Method) {
+			return fmt.Errorf("%w: http_rules[%s]: invalid method %q", ErrInvalidDynamic, rule.Name, rule.Method)
+		}
+		if rule.BodyMatch != "" {
+			if _, err := regexp.Compile(rule.BodyMatch); err != nil {
+				return fmt.Errorf("%w: http_rules[%s]: invalid body_match: %v", ErrInvalidDynamic, rule.Name, err)
+			}
+		}
+		if rule.MaxLatencyMS < 0 {
+			return fmt.Errorf("%w: http_rules[%s]: max_latency_ms must not be negative", ErrInvalidDynamic, rule.Name)
+		}
+	case CheckTypeTCP, CheckTypeTLS:
+		if strings.TrimSpace(rule.Name) == "" || strings.TrimSpace(rule.Host) == "" {
+			return fmt.Errorf("%w: http_rules[%d]: name and host are required for %s checks", ErrInvalidDynamic, i, rule.Type)
+		}
+		if (rule.Type == CheckTypeTCP && rule.Port == 0) || rule.Port < 0 || rule.Port > 65535 {
+			return fmt.Errorf("%w: http_rules[%s]: invalid port %d", ErrInvalidDynamic, rule.Name, rule.Port)
+		}
+		if rule.WarnDays < 0 {
+			return fmt.Errorf("%w: http_rules[%s]: warn_days must not be negative", ErrInvalidDynamic, rule.Name)
+		}
+	default:
+		return fmt.Errorf("%w: http_rules[%d]: unknown check type %q (use http, tcp or tls)", ErrInvalidDynamic, i, rule.Type)
+	}
+	if rule.Timeout < 0 {
+		return fmt.Errorf("%w: http_rules[%s]: timeout must not be negative", ErrInvalidDynamic, rule.Name)
+	}
+	if rule.Interval < 0 {
+		return fmt.Errorf("%w: http_rules[%s]: interval must not be negative", ErrInvalidDynamic, rule.Name)
+	}
+	return nil
+}
+
+// validateDynamic 校验修改内容，并规范化通知渠道中的 Webhook
+func validateDynamic(update *DynamicValues) error {
+	if update.PatrolRules != nil {
+		seen := make(map[string]bool)
+		for i, rule := range *update.PatrolRules {
+			if strings.TrimSpace(rule.Name) == "" || strings.TrimSpace(rule.Command) == "" {
+				return fmt.Errorf("%w: patrol_rules[%d]: name and command are required", ErrInvalidDynamic, i)
+			}
+			if seen[rule.Name] {
+				return fmt.Errorf("%w: patrol_rules: duplicate name %q", ErrInvalidDynamic, rule.Name)
+			}
+			if rule.Timeout < 0 {
+				return fmt.Errorf("%w: patrol_rules[%s]: timeout must not be negative", ErrInvalidDynamic, rule.Name)
+			}
+			seen[rule.Name] = true
+		}
+	}
+	if update.HTTPRules != nil {
+		for i, rule := range *update.HTTPRules {
+			if err := validateCheckRule(i, rule); err != nil {
+				return err
+			}
+		}
+	}
+	if update.NotifyRouting != nil {
+		cfg := Config{NotifyRouting: *update.NotifyRouting}
+		if _, err := ValidateWebhooks(&cfg); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDynamic, err)
+		}
+		*update.NotifyRouting = cfg.NotifyRouting
+	}
+	if h := update.HealthScore; h != nil {
+		for name, weight := range map[string]float64{
+			"incidents_weight": h.IncidentsWeight, "resources_weight": h.ResourcesWeight, "services_weight": h.ServicesWeight,
+			"certificates_weight": h.CertificatesWeight, "deployments_weight": h.DeploymentsWeight, "patrol_weight": h.PatrolWeight,
+		} {
+			if weight < 0 {
+				return fmt.Errorf("%w: health_score.%s must not be negative", ErrInvalidDynamic, name)
+			}
+		}
+		for name, threshold := range map[string]float64{"cpu_threshold": h.CPUThreshold, "mem_threshold": h.MemThreshold, "disk_threshold": h.DiskThreshold} {
+			if threshold < 0 || threshold > 100 {
+				return fmt.Errorf("%w: health_score.%s must be between 0 and 100", ErrInvalidDynamic, name)
+			}
+		}
+		if h.CertWarnDays < 0 {
+			return fmt.Errorf("%w: health_score.cert_warn_days must not be negative", ErrInvalidDynamic)
+		}
+	}
+	return nil
+}
+
+// saveOverrides 原子写入覆盖文件
+func saveOverrides(next overrides) error {
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(overridesPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := overridesPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("保存运行时配置失败: %w", err)
+	}
+	if err := os.Rename(tmp, overridesPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存运行时配置失败: %w", err)
+	}
+	return nil
+}
+
+func cloneOverrides(o overrides) overrides {
+	next := overrides{Version: o.Version, Meta: make(map[string]OverrideMeta, len(o.Meta))}
+	copyJSON(&next.Values, o.Values)
+	for section, meta := range o.Meta {
+		next.Meta[section] = meta
+	}
+	return next
+}
+
+// sectionValue 返回指定部分的值，未设置时返回 nil
+func sectionValue(values DynamicValues, section string) interface{} {
+	var value interface{}
+	switch section {
+	case SectionPatrolRules:
+		value = values.PatrolRules
+	case SectionHTTPRules:
+		value = values.HTTPRules
+	case SectionNotifyRouting:
+		value = values.NotifyRouting
+	case SectionHealthScore:
+		value = values.HealthScore
+	}
+	if v := reflect.ValueOf(value); !v.IsValid() || v.IsNil() {
+		return nil
+	}
+	return value
+}
+
+// setSection 设置指定部分的值，value 为 nil 时清除
+func setSection(values *DynamicValues, section string, value interface{}) {
+	switch section {
+	case SectionPatrolRules:
+		values.PatrolRules, _ = value.(*[]PatrolRule)
+	case SectionHTTPRules:
+		values.HTTPRules, _ = value.(*[]HTTPRule)
+	case SectionNotifyRouting:
+		values.NotifyRouting, _ = value.(*NotifyRoutingConfig)
+	case SectionHealthScore:
+		values.HealthScore, _ = value.(*HealthScoreConfig)
+	}
+}
+
+// copyJSON 通过 JSON 深拷贝
+func copyJSON(dst, src interface{}) {
+	data, _ := json.Marshal(src)
+	json.Unmarshal(data, dst)
+}
+
+// DiffJSON 生成两个值的可读差异：列表按元素列出增删，对象按字段列出变化；webhook、token 等敏感字段会被掩码
+func DiffJSON(before, after interface{}) string {
+	var lines []string
+	diffValue("", maskSecrets("", toGeneric(before)), maskSecrets("", toGeneric(after)), &lines)
+	if len(lines) == 0 {
+		return "无变化"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func toGeneric(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var generic interface{}
+	json.Unmarshal(data, &generic)
+	return generic
+}
+
+func diffValue(prefix string, before, after interface{}, lines *[]string) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	beforeMap, okBefore := before.(map[string]interface{})
+	afterMap, okAfter := after.(map[string]interface{})
+	if okBefore && okAfter {
+		keys := make(map[string]bool)
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			diffValue(name, beforeMap[key], afterMap[key], lines)
+		}
+		return
+	}
+
+	beforeList, okBefore := before.([]interface{})
+	afterList, okAfter := after.([]interface{})
+	if (okBefore || before == nil) && (okAfter || after == nil) {
+		label := prefix
+		if label != "" {
+			label += ": "
+		}
+		removed, added := listDiff(beforeList, afterList)
+		for _, item := range removed {
+			*lines = append(*lines, label+"- "+item)
+		}
+		for _, item := range added {
+			*lines = append(*lines, label+"+ "+item)
+		}
+		if len(removed) == 0 && len(added) == 0 {
+			*lines = append(*lines, label+"顺序调整")
+		}
+		return
+	}
+
+	name := prefix
+	if name == "" {
+		name = "value"
+	}
+	*lines = append(*lines, fmt.Sprintf("%s: %s → %s", name, compactJSON(before), compactJSON(after)))
+}
+
+// listDiff 按元素内容比较两个列表，返回删除和新增的元素
+func listDiff(before, after []interface{}) ([]string, []string) {
+	return missingFrom(before, after), missingFrom(after, before)
+}
+
+// missingFrom 返回 list 中不在 other 里的元素（按出现次数计算）
+func missingFrom(list, other []interface{}) []string {
+	count := make(map[string]int)
+	for _, item := range other {
+		count[compactJSON(item)]++
+	}
+	var missing []string
+	for _, item := range list {
+		key := compactJSON(item)
+		if count[key] > 0 {
+			count[key]--
+			continue
+		}
+		missing = append(missing, key)
+	}
+	return missing
+}
+
+func compactJSON(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// maskSecrets 掩码 webhook、token、密码和签名密钥字段
+func maskSecrets(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			masked[k] = maskSecrets(k, item)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskSecrets(key, item)
+		}
+		return masked
+	case string:
+		switch {
+		case v == "":
+		case key == "webhook":
+			return maskWebhook(v)
+		case strings.Contains(key, "token"), strings.Contains(key, "password"), key == "secret":
+			return maskSensitiveValue("TOKEN", v)
+		}
+	}
+	return value
+}
+
+// maskWebhook 掩码 Webhook 中的密钥：钉钉的 access_token，Slack 等路径中的最后一段
+func maskWebhook(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return "****"
+	}
+	if u.Query().Get("access_token") != "" {
+		return maskWebhookURL(value)
+	}
+	if i := strings.LastIndex(u.Path, "/"); i >= 0 && i < len(u.Path)-1 {
+		secret := u.Path[i+1:]
+		return strings.Replace(value, secret, maskSensitiveValue("TOKEN", secret), 1)
+	}
+	return value
+}
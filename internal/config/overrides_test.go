@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupOverrides(t *testing.T) string {
+	saved := Current()
+	t.Cleanup(func() {
+		Store(saved)
+		loadOverrides(filepath.Join(t.TempDir(), "none.json"))
+	})
+	Store(&Config{
+		PatrolRules: []PatrolRule{{Name: "nginx", Command: "systemctl is-active nginx"}},
+		HTTPRules:   []HTTPRule{{Name: "home", URL: "https://example.com", Code: 200}},
+	})
+	path := filepath.Join(t.TempDir(), "qwq.overrides.json")
+	if err := loadOverrides(path); err != nil {
+		t.Fatalf("loadOverrides: %v", err)
+	}
+	return path
+}
+
+func TestApplyDynamic(t *testing.T) {
+	path := setupOverrides(t)
+
+	rules := []PatrolRule{{Name: "nginx", Command: "systemctl is-active nginx"}, {Name: "redis", Command: "redis-cli ping"}}
+	diffs, version, err := ApplyDynamic(DynamicValues{PatrolRules: &rules}, 0, "alice")
+	if err != nil || version != 1 {
+		t.Fatalf("ApplyDynamic: %v (version %d)", err, version)
+	}
+	if !strings.Contains(diffs[SectionPatrolRules], `+ {"command":"redis-cli ping","name":"redis"}`) || strings.Contains(diffs[SectionPatrolRules], "- ") {
+		t.Errorf("Unexpected diff:\n%s", diffs[SectionPatrolRules])
+	}
+	if len(Current().PatrolRules) != 2 {
+		t.Errorf("Change should apply immediately, got %+v", Current().PatrolRules)
+	}
+
+	state := Dynamic()
+	if state.Version != 1 || state.Sections[SectionPatrolRules].Source != "override" || state.Sections[SectionPatrolRules].UpdatedBy != "alice" || state.Sections[SectionHTTPRules].Source != "file" {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	// 旧版本的修改被拒绝
+	if _, _, err := ApplyDynamic(DynamicValues{PatrolRules: &rules}, 0, "bob"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	// 重启后覆盖仍然生效
+	Update(func(cfg *Config) {
+		cfg.PatrolRules = []PatrolRule{{Name: "nginx", Command: "systemctl is-active nginx"}}
+	})
+	if err := loadOverrides(path); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(Current().PatrolRules) != 2 || Dynamic().Version != 1 {
+		t.Errorf("Overrides should survive a restart, got %+v", Current().PatrolRules)
+	}
+
+	diffs, version, err = RevertDynamic([]string{SectionPatrolRules}, 1, "alice")
+	if err != nil || version != 2 || !strings.Contains(diffs[SectionPatrolRules], `- {"command":"redis-cli ping","name":"redis"}`) {
+		t.Fatalf("RevertDynamic: %v %v", diffs, err)
+	}
+	if len(Current().PatrolRules) != 1 || Dynamic().Sections[SectionPatrolRules].Source != "file" {
+		t.Errorf("Revert should restore the file config, got %+v", Current().PatrolRules)
+	}
+	data, _ := os.ReadFile(path)
+	var saved overrides
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != 2 || saved.Values.PatrolRules != nil {
+		t.Errorf("Unexpected overrides file: %s", data)
+	}
+}
+
+func TestApplyDynamic_Validation(t *testing.T) {
+	setupOverrides(t)
+
+	cases := map[string]DynamicValues{
+		"patrol":    {PatrolRules: &[]PatrolRule{{Name: "empty"}}},
+		"duplicate": {PatrolRules: &[]PatrolRule{{Name: "a", Command: "true"}, {Name: "a", Command: "true"}}},
+		"http":      {HTTPRules: &[]HTTPRule{{Name: "bad", URL: "ftp://example.com"}}},
+		"interval":  {HTTPRules: &[]HTTPRule{{Name: "home", URL: "https://example.com", Interval: -1}}},
+		"range":     {HTTPRules: &[]HTTPRule{{Name: "home", URL: "https://example.com", CodeRange: "299-200"}}},
+		"body":      {HTTPRules: &[]HTTPRule{{Name: "home", URL: "https://example.com", BodyMatch: "("}}},
+		"tcp":       {HTTPRules: &[]HTTPRule{{Name: "db", Type: CheckTypeTCP, Host: "10.0.0.8"}}},
+		"type":      {HTTPRules: &[]HTTPRule{{Name: "dns", Type: "udp", Host: "10.0.0.8", Port: 53}}},
+		"threshold": {HealthScore: &HealthScoreConfig{DiskThreshold: 120}},
+		"webhook":   {NotifyRouting: &NotifyRoutingConfig{Channels: []NotifyChannelConfig{{Name: "ops", Type: "dingtalk", Webhook: "http://example.com"}}}},
+	}
+	for name, update := range cases {
+		if _, _, err := ApplyDynamic(update, 0, "alice"); !errors.Is(err, ErrInvalidDynamic) {
+			t.Errorf("%s: expected ErrInvalidDynamic, got %v", name, err)
+		}
+	}
+	if Dynamic().Version != 0 {
+		t.Error("Rejected changes must not bump the version")
+	}
+}
+
+func TestDiffJSON_MasksSecrets(t *testing.T) {
+	before := NotifyRoutingConfig{Channels: []NotifyChannelConfig{{Name: "ops", Type: "slack", Webhook: "https://hooks.slack.com/services/T0/B0/abcdefghijkl"}}}
+	after := NotifyRoutingConfig{Channels: before.Channels, Default: []string{"ops"}}
+	diff := DiffJSON(before, after)
+	if diff != `default: + "ops"` {
+		t.Errorf("Unexpected diff %q", diff)
+	}
+
+	diff = DiffJSON(before, NotifyRoutingConfig{})
+	if strings.Contains(diff, "abcdefghijkl") || !strings.Contains(diff, "abcd****ijkl") {
+		t.Errorf("Webhook secrets must be masked: %s", diff)
+	}
+
+	mail := NotifyRoutingConfig{Channels: []NotifyChannelConfig{{Name: "mail", Type: "email", SMTPPassword: "mailpassword123"}, {Name: "hook", Type: "webhook", Secret: "hooksecret4567"}}}
+	diff = DiffJSON(mail, NotifyRoutingConfig{})
+	if strings.Contains(diff, "mailpassword123") || strings.Contains(diff, "hooksecret4567") {
+		t.Errorf("Passwords and signing secrets must be masked: %s", diff)
+	}
+}
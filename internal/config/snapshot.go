@@ -0,0 +1,41 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// snapshot 当前生效的配置，发布后不再修改，读取方无需加锁
+	snapshot atomic.Pointer[Config]
+	// updateMu 串行化 Update，避免并发修改互相覆盖
+	updateMu sync.Mutex
+	// emptyConfig Init 之前读取到的零值配置
+	emptyConfig Config
+)
+
+// Current 返回当前生效配置的只读快照
+// 快照发布后不会被修改，热加载和运行时修改会发布新的快照；调用方不得修改返回值（包括其中的切片和 map），
+// 同一次操作中需要多个字段一致时应只调用一次 Current
+func Current() *Config {
+	if cfg := snapshot.Load(); cfg != nil {
+		return cfg
+	}
+	return &emptyConfig
+}
+
+// Store 发布一份完整的配置快照，cfg 发布后不得再修改
+func Store(cfg *Config) {
+	snapshot.Store(cfg)
+}
+
+// Update 复制当前快照，在副本上执行 fn 后原子发布并返回新快照
+// fn 中替换切片或 map 字段时需整体赋值新值，不能原地修改旧快照共享的元素
+func Update(fn func(cfg *Config)) *Config {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	next := *Current()
+	fn(&next)
+	snapshot.Store(&next)
+	return &next
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidWebhook 通知地址无法解析或不属于对应的通知服务
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// 各通知服务的 Webhook 域名、路径前缀和允许的查询参数
+var webhookProviders = map[string]struct {
+	host   string
+	path   string
+	params []string
+}{
+	"dingtalk": {host: "oapi.dingtalk.com", path: "/robot/send", params: []string{"access_token", "timestamp", "sign"}},
+	"slack":    {host: "hooks.slack.com", path: "/services/"},
+	"telegram": {host: "api.telegram.org", path: "/bot"},
+}
+
+// shellEscaped 从命令行或 .env 粘贴时常被反斜杠转义的字符，如 "send\?access_token\=..."
+const shellEscaped = "?&=;#!$*()[]{}<>|'\" "
+
+var (
+	dingTalkTokenPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	telegramTokenPattern = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]{30,}$`)
+)
+
+var webhookWarnings []string
+
+// WebhookWarnings 返回最近一次加载配置时发现的可疑 Webhook 配置
+func WebhookWarnings() []string {
+	return webhookWarnings
+}
+
+// NormalizeWebhook 校验并规范化 Webhook 地址：去掉首尾空白、引号和 shell 转义留下的反斜杠，
+// 缺少协议时补全 https://。provider 为 dingtalk、slack 或 telegram 时校验域名和路径，为空时只要求 https。
+// 返回规范化后的地址和不影响使用但可疑的警告
+func NormalizeWebhook(provider, raw string) (string, []string, error) {
+	value := strings.Trim(strings.TrimSpace(raw), `"'`)
+	value = unescapeShell(value)
+	if value == "" {
+		return "", nil, nil
+	}
+
+	var warnings []string
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+		warnings = append(warnings, "缺少协议，已按 https:// 处理")
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %q 无法解析: %v", ErrInvalidWebhook, maskWebhookURL(value), err)
+	}
+	if u.Scheme != "https" {
+		return "", nil, fmt.Errorf("%w: 必须使用 https (解析结果 %s)", ErrInvalidWebhook, describeWebhook(u))
+	}
+	if u.Host == "" {
+		return "", nil, fmt.Errorf("%w: 缺少主机名 (解析结果 %s)", ErrInvalidWebhook, describeWebhook(u))
+	}
+
+	known, ok := webhookProviders[provider]
+	if !ok {
+		return u.String(), warnings, nil
+	}
+	if !strings.EqualFold(u.Hostname(), known.host) {
+		return "", nil, fmt.Errorf("%w: %s Webhook 的主机应为 %s (解析结果 %s)", ErrInvalidWebhook, provider, known.host, describeWebhook(u))
+	}
+	if !strings.HasPrefix(u.Path, known.path) || (strings.HasSuffix(known.path, "/") && len(u.Path) == len(known.path)) {
+		return "", nil, fmt.Errorf("%w: %s Webhook 的路径应以 %s 开头 (解析结果 %s)", ErrInvalidWebhook, provider, known.path, describeWebhook(u))
+	}
+
+	query := u.Query()
+	if provider == "dingtalk" {
+		token := query.Get("access_token")
+		if token == "" {
+			return "", nil, fmt.Errorf("%w: 钉钉 Webhook 缺少 access_token (解析结果 %s)", ErrInvalidWebhook, describeWebhook(u))
+		}
+		if !dingTalkTokenPattern.MatchString(token) {
+			warnings = append(warnings, fmt.Sprintf("access_token 长度为 %d，钉钉的 token 通常是 64 位十六进制，可能在粘贴时被截断", len(token)))
+		}
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := query[key]
+		switch {
+		case known.params != nil && !containsString(known.params, key):
+			warnings = append(warnings, fmt.Sprintf("未知的查询参数 %q", key))
+		case len(values) > 1:
+			warnings = append(warnings, fmt.Sprintf("查询参数 %q 出现了 %d 次", key, len(values)))
+		case values[0] == "":
+			warnings = append(warnings, fmt.Sprintf("查询参数 %q 为空", key))
+		}
+	}
+	return u.String(), warnings, nil
+}
+
+// ValidateTelegramToken 校验 Telegram Bot Token 格式（<bot id>:<secret>）
+func ValidateTelegramToken(token string) error {
+	if token == "" || telegramTokenPattern.MatchString(token) {
+		return nil
+	}
+	return fmt.Errorf("%w: Telegram Bot Token 格式应为 <bot id>:<secret> (解析结果 %q, 长度 %d)", ErrInvalidWebhook, maskSensitiveValue("TOKEN", token), len(token))
+}
+
+// ValidateWebhooks 规范化配置中的所有通知地址（默认渠道和 notify_routing 命名渠道），
+// 返回警告和所有无效地址的错误
+func ValidateWebhooks(cfg *Config) ([]string, error) {
+	var warnings []string
+	var errs []error
+	check := func(field, provider string, value *string) {
+		normalized, found, err := NormalizeWebhook(provider, *value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		*value = normalized
+		for _, warning := range found {
+			warnings = append(warnings, field+": "+warning)
+		}
+	}
+	checkToken := func(field string, token *string) {
+		*token = strings.TrimSpace(*token)
+		if err := ValidateTelegramToken(*token); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+
+	check("webhook", "dingtalk", &cfg.DingTalkWebhook)
+	checkToken("telegram_token", &cfg.TelegramToken)
+	for i := range cfg.NotifyRouting.Channels {
+		channel := &cfg.NotifyRouting.Channels[i]
+		field := fmt.Sprintf("notify_routing.channels[%s]", channel.Name)
+		switch channel.Type {
+		case "dingtalk", "slack":
+			check(field+".webhook", channel.Type, &channel.Webhook)
+		case "telegram":
+			checkToken(field+".telegram_token", &channel.TelegramToken)
+		}
+	}
+	return warnings, errors.Join(errs...)
+}
+
+// unescapeShell 去掉 shell 转义字符前的反斜杠，其余反斜杠保持原样
+func unescapeShell(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && strings.IndexByte(shellEscaped, value[i+1]) >= 0 {
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// describeWebhook 展示地址的解析结果，用于错误信息，token 类参数会被掩码
+func describeWebhook(u *url.URL) string {
+	query := u.Query()
+	for key, values := range query {
+		for i, value := range values {
+			values[i] = maskSensitiveValue(key, value)
+		}
+	}
+	path := u.Path
+	if strings.HasPrefix(path, "/bot") {
+		// Telegram 的 token 在路径中
+		bot, rest, _ := strings.Cut(strings.TrimPrefix(path, "/bot"), "/")
+		path = "/bot" + maskSensitiveValue("TOKEN", bot) + "/" + rest
+	}
+	rawQuery, err := url.QueryUnescape(query.Encode())
+	if err != nil {
+		rawQuery = query.Encode()
+	}
+	return fmt.Sprintf("scheme=%q host=%q path=%q query=%q", u.Scheme, u.Host, path, rawQuery)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
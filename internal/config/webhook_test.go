@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testDingTalkToken = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestNormalizeWebhook_DingTalk(t *testing.T) {
+	want := "https://oapi.dingtalk.com/robot/send?access_token=" + testDingTalkToken
+	for _, raw := range []string{
+		want,
+		"  " + want + "\n",
+		`"` + want + `"`,
+		`https://oapi.dingtalk.com/robot/send\?access_token\=` + testDingTalkToken,
+	} {
+		got, warnings, err := NormalizeWebhook("dingtalk", raw)
+		if err != nil || got != want || len(warnings) != 0 {
+			t.Errorf("NormalizeWebhook(%q) = %q, %v, %v", raw, got, warnings, err)
+		}
+	}
+
+	got, warnings, err := NormalizeWebhook("dingtalk", "oapi.dingtalk.com/robot/send?access_token="+testDingTalkToken)
+	if err != nil || got != want || len(warnings) != 1 || !strings.Contains(warnings[0], "https://") {
+		t.Errorf("Expected missing scheme to be added with a warning, got %q %v %v", got, warnings, err)
+	}
+}
+
+func TestNormalizeWebhook_Warnings(t *testing.T) {
+	_, warnings, err := NormalizeWebhook("dingtalk", "https://oapi.dingtalk.com/robot/send?access_token=0123456789abcdef&foo=1")
+	if err != nil {
+		t.Fatalf("Suspicious webhooks should only warn, got %v", err)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "截断") || !strings.Contains(warnings[1], `"foo"`) {
+		t.Errorf("Expected truncated token and unknown param warnings, got %v", warnings)
+	}
+}
+
+func TestNormalizeWebhook_Invalid(t *testing.T) {
+	cases := map[string]struct{ provider, raw, want string }{
+		"http":       {"dingtalk", "http://oapi.dingtalk.com/robot/send?access_token=" + testDingTalkToken, `scheme="http"`},
+		"wrong host": {"dingtalk", "https://example.com/robot/send?access_token=" + testDingTalkToken, `host="example.com"`},
+		"no token":   {"dingtalk", "https://oapi.dingtalk.com/robot/send", "access_token"},
+		"slack path": {"slack", "https://hooks.slack.com/services/", `path="/services/"`},
+		"bad url":    {"", "https://exa mple.com/%zz", "无法解析"},
+		"masked":     {"dingtalk", "http://oapi.dingtalk.com/robot/send?access_token=" + testDingTalkToken, "0123****cdef"},
+	}
+	for name, tc := range cases {
+		_, _, err := NormalizeWebhook(tc.provider, tc.raw)
+		if !errors.Is(err, ErrInvalidWebhook) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected ErrInvalidWebhook mentioning %q, got %v", name, tc.want, err)
+		}
+		if err != nil && strings.Contains(err.Error(), testDingTalkToken) {
+			t.Errorf("%s: error must not leak the token: %v", name, err)
+		}
+	}
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	cfg := Config{
+		DingTalkWebhook: ` https://oapi.dingtalk.com/robot/send\?access_token\=` + testDingTalkToken,
+		NotifyRouting: NotifyRoutingConfig{Channels: []NotifyChannelConfig{
+			{Name: "ops", Type: "slack", Webhook: "hooks.slack.com/services/T000/B000/XXXX"},
+			{Name: "oncall", Type: "telegram", TelegramToken: "not-a-token"},
+		}},
+	}
+	warnings, err := ValidateWebhooks(&cfg)
+	if cfg.DingTalkWebhook != "https://oapi.dingtalk.com/robot/send?access_token="+testDingTalkToken {
+		t.Errorf("Default webhook not normalized: %q", cfg.DingTalkWebhook)
+	}
+	if cfg.NotifyRouting.Channels[0].Webhook != "https://hooks.slack.com/services/T000/B000/XXXX" {
+		t.Errorf("Slack webhook not normalized: %q", cfg.NotifyRouting.Channels[0].Webhook)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "notify_routing.channels[ops].webhook") {
+		t.Errorf("Expected one warning for the slack channel, got %v", warnings)
+	}
+	if !errors.Is(err, ErrInvalidWebhook) || !strings.Contains(err.Error(), "notify_routing.channels[oncall].telegram_token") {
+		t.Errorf("Expected invalid telegram token error, got %v", err)
+	}
+}
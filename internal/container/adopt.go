@@ -0,0 +1,549 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"qwq/internal/logger"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrContainerManaged 容器已属于某个 Compose 项目
+	ErrContainerManaged = errors.New("container is already managed by a compose project")
+	// ErrInspectUnsupported Docker 执行器不支持读取容器完整配置
+	ErrInspectUnsupported = errors.New("docker executor does not support container inspection")
+	// ErrNotAdopted 项目不是通过纳管创建的
+	ErrNotAdopted = errors.New("project was not adopted from a container")
+)
+
+// ContainerInspector 读取容器和镜像的完整配置，用于纳管已有容器
+type ContainerInspector interface {
+	InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	InspectImageConfig(ctx context.Context, image string) (*container.Config, error)
+}
+
+// AdoptionResult 纳管结果
+type AdoptionResult struct {
+	Project  *ComposeProject `json:"project"`
+	Warnings []string        `json:"warnings"` // 无法用 compose 表达的配置
+}
+
+// DriftReport 纳管容器的配置漂移检查结果
+type DriftReport struct {
+	ProjectID   uint      `json:"project_id"`
+	ProjectName string    `json:"project_name"`
+	ContainerID string    `json:"container_id"`
+	Drifted     bool      `json:"drifted"`
+	Differences []string  `json:"differences"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// AdoptionService 将 docker run 启动的容器纳管为单服务 Compose 项目
+// 纳管不会重建容器：只生成等价的 compose 定义，注册自愈，并定期比对容器实际配置与定义
+type AdoptionService struct {
+	db             *gorm.DB
+	composeService ComposeService
+	executor       DockerExecutor
+	healingService SelfHealingService
+}
+
+// NewAdoptionService 创建纳管服务，healingService 为 nil 时不注册自愈
+func NewAdoptionService(db *gorm.DB, composeService ComposeService, executor DockerExecutor, healingService SelfHealingService) *AdoptionService {
+	return &AdoptionService{
+		db:             db,
+		composeService: composeService,
+		executor:       executor,
+		healingService: healingService,
+	}
+}
+
+// ListUnmanaged 列出运行中且不属于任何 Compose 项目的容器
+func (s *AdoptionService) ListUnmanaged(ctx context.Context) ([]ContainerSummary, error) {
+	lister, ok := s.executor.(ContainerLister)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+	containers, err := lister.ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projectNames, adoptedIDs, err := s.managedSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ContainerSummary, 0)
+	for _, c := range containers {
+		if c.State != "running" || projectNames[c.Labels[composeProjectLabel]] || adoptedIDs[shortID(c.ID)] {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// managedSets 已有项目名称和已纳管的容器短 ID
+func (s *AdoptionService) managedSets(ctx context.Context) (map[string]bool, map[string]bool, error) {
+	var projects []ComposeProject
+	if err := s.db.WithContext(ctx).Select("name", "adopted_container_id").Find(&projects).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	names := make(map[string]bool, len(projects))
+	adopted := make(map[string]bool)
+	for _, project := range projects {
+		names[project.Name] = true
+		if project.AdoptedContainerID != "" {
+			adopted[shortID(project.AdoptedContainerID)] = true
+		}
+	}
+	return names, adopted, nil
+}
+
+// Adopt 纳管容器：生成单服务 compose 定义并保存为 adopted 项目，注册到自愈服务
+// 无法用 compose 表达的配置不会导致失败，而是作为警告返回并记录在项目描述中
+func (s *AdoptionService) Adopt(ctx context.Context, containerID, author string) (*AdoptionResult, error) {
+	inspector, ok := s.executor.(ContainerInspector)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+	info, err := inspector.InspectContainer(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if info.ContainerJSONBase == nil || info.Config == nil {
+		return nil, fmt.Errorf("failed to inspect container %s: incomplete inspect data", containerID)
+	}
+
+	projectNames, adoptedIDs, err := s.managedSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if projectNames[info.Config.Labels[composeProjectLabel]] || adoptedIDs[shortID(info.ID)] {
+		return nil, ErrContainerManaged
+	}
+
+	// 镜像配置用于去掉镜像自带的环境变量、标签和命令，读取失败时保留容器上的全部配置
+	imageConfig, _ := inspector.InspectImageConfig(ctx, info.Config.Image)
+	cfg, serviceName, warnings := SynthesizeCompose(info, imageConfig)
+
+	content, err := s.composeService.RenderComposeConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("纳管自容器 %s (%s)", strings.TrimPrefix(info.Name, "/"), shortID(info.ID))
+	if len(warnings) > 0 {
+		description += "\n无法用 compose 表达的配置:\n- " + strings.Join(warnings, "\n- ")
+	}
+	project := &ComposeProject{
+		Name:               uniqueProjectName(serviceName, projectNames),
+		DisplayName:        strings.TrimPrefix(info.Name, "/"),
+		Description:        description,
+		Content:            content,
+		Status:             ProjectStatusRunning,
+		Adopted:            true,
+		AdoptedContainerID: info.ID,
+		TenantID:           1,
+	}
+	if err := s.composeService.CreateProject(ctx, project); err != nil {
+		return nil, err
+	}
+
+	if s.healingService != nil {
+		if err := s.healingService.RegisterContainer(ctx, info.ID, healingConfigFor(cfg.Services[serviceName])); err != nil {
+			warnings = append(warnings, fmt.Sprintf("注册自愈失败: %v", err))
+		}
+	}
+
+	logger.Info("[AUDIT] 📥 容器已纳管: %s -> 项目 %s (%d 条警告) by %s", shortID(info.ID), project.Name, len(warnings), author)
+	return &AdoptionResult{Project: project, Warnings: warnings}, nil
+}
+
+// CheckDrift 比对纳管容器的实际配置与项目中的 compose 定义
+func (s *AdoptionService) CheckDrift(ctx context.Context, projectID uint) (*DriftReport, error) {
+	project, err := s.composeService.GetProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if !project.Adopted || project.AdoptedContainerID == "" {
+		return nil, ErrNotAdopted
+	}
+	inspector, ok := s.executor.(ContainerInspector)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+
+	report := &DriftReport{
+		ProjectID:   project.ID,
+		ProjectName: project.Name,
+		ContainerID: project.AdoptedContainerID,
+		Differences: []string{},
+		CheckedAt:   time.Now(),
+	}
+	declared, err := s.composeService.ParseComposeFile(ctx, project.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := inspector.InspectContainer(ctx, project.AdoptedContainerID)
+	if err != nil || info.ContainerJSONBase == nil || info.Config == nil {
+		report.Drifted = true
+		report.Differences = append(report.Differences, "容器不存在或无法读取")
+		return report, nil
+	}
+	imageConfig, _ := inspector.InspectImageConfig(ctx, info.Config.Image)
+	actual, _, _ := SynthesizeCompose(info, imageConfig)
+
+	report.Differences = diffServices(singleService(declared), singleService(actual))
+	report.Drifted = len(report.Differences) > 0
+	return report, nil
+}
+
+// CheckAllDrift 检查所有纳管项目的配置漂移
+func (s *AdoptionService) CheckAllDrift(ctx context.Context) ([]*DriftReport, error) {
+	var projects []ComposeProject
+	if err := s.db.WithContext(ctx).Where("adopted = ?", true).Find(&projects).Error; err != nil {
+		return nil, fmt.Errorf("failed to list adopted projects: %w", err)
+	}
+	reports := make([]*DriftReport, 0, len(projects))
+	for _, project := range projects {
+		report, err := s.CheckDrift(ctx, project.ID)
+		if err != nil {
+			logger.Info("⚠️ 纳管项目 %s 漂移检查失败: %v", project.Name, err)
+			continue
+		}
+		if report.Drifted {
+			logger.Info("⚠️ 纳管项目 %s 配置漂移: %s", project.Name, strings.Join(report.Differences, "; "))
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+var invalidProjectChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// uniqueProjectName 与已有项目重名时追加序号
+func uniqueProjectName(base string, existing map[string]bool) string {
+	name := base
+	for i := 2; existing[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name
+}
+
+// adoptedServiceName 纳管生成的 compose 定义中的服务名称，由容器名称转换而来
+func adoptedServiceName(containerName string) string {
+	name := strings.Trim(invalidProjectChars.ReplaceAllString(strings.ToLower(containerName), "-"), "-")
+	if name == "" {
+		return "app"
+	}
+	return name
+}
+
+// SynthesizeCompose 根据容器 inspect 结果生成等价的单服务 compose 定义
+// imageConfig 为镜像自带的配置，与之相同的环境变量、标签、命令和健康检查不会写入定义
+// 返回的警告列出无法用 compose 表达而被忽略的配置
+func SynthesizeCompose(info types.ContainerJSON, imageConfig *container.Config) (*ComposeConfig, string, []string) {
+	containerName := strings.TrimPrefix(info.Name, "/")
+	serviceName := adoptedServiceName(containerName)
+	if imageConfig == nil {
+		imageConfig = &container.Config{}
+	}
+	hostConfig := info.HostConfig
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+
+	var warnings []string
+	service := &Service{
+		Image:         info.Config.Image,
+		ContainerName: containerName,
+		User:          info.Config.User,
+		Privileged:    hostConfig.Privileged,
+		ExtraHosts:    hostConfig.ExtraHosts,
+	}
+	if info.Config.WorkingDir != imageConfig.WorkingDir {
+		service.WorkingDir = info.Config.WorkingDir
+	}
+	if !equalStrings(info.Config.Cmd, imageConfig.Cmd) {
+		service.Command = []string(info.Config.Cmd)
+	}
+	if !equalStrings(info.Config.Entrypoint, imageConfig.Entrypoint) {
+		service.Entrypoint = []string(info.Config.Entrypoint)
+	}
+	if len(hostConfig.DNS) > 0 {
+		service.DNS = hostConfig.DNS
+	}
+
+	// 环境变量和标签只保留容器上新增或修改的部分
+	imageEnv := make(map[string]bool, len(imageConfig.Env))
+	for _, env := range imageConfig.Env {
+		imageEnv[env] = true
+	}
+	var env []string
+	for _, item := range info.Config.Env {
+		if !imageEnv[item] {
+			env = append(env, item)
+		}
+	}
+	if len(env) > 0 {
+		sort.Strings(env)
+		service.Environment = env
+	}
+	for key, value := range info.Config.Labels {
+		if strings.HasPrefix(key, "com.docker.compose.") || imageConfig.Labels[key] == value {
+			continue
+		}
+		if service.Labels == nil {
+			service.Labels = make(map[string]string)
+		}
+		service.Labels[key] = value
+	}
+
+	// 端口映射
+	for port, bindings := range hostConfig.PortBindings {
+		suffix := ""
+		if port.Proto() != "tcp" {
+			suffix = "/" + port.Proto()
+		}
+		for _, binding := range bindings {
+			mapping := port.Port() + suffix
+			if binding.HostPort != "" {
+				mapping = binding.HostPort + ":" + mapping
+			}
+			if ip := net.ParseIP(binding.HostIP); ip != nil && !ip.IsUnspecified() {
+				if ip.To4() == nil {
+					warnings = append(warnings, fmt.Sprintf("端口 %s 绑定的 IPv6 地址 %s 已忽略", port, binding.HostIP))
+				} else if binding.HostPort != "" {
+					mapping = binding.HostIP + ":" + mapping
+				}
+			}
+			service.Ports = append(service.Ports, mapping)
+		}
+	}
+	sort.Strings(service.Ports)
+
+	// 挂载：绑定挂载使用主机路径，命名卷声明为外部卷以复用已有数据
+	var volumes map[string]*Volume
+	for _, m := range info.Mounts {
+		mode := ""
+		if !m.RW {
+			mode = ":ro"
+		}
+		switch m.Type {
+		case mount.TypeBind:
+			service.Volumes = append(service.Volumes, m.Source+":"+m.Destination+mode)
+		case mount.TypeVolume:
+			if isAnonymousVolume(m.Name) {
+				warnings = append(warnings, fmt.Sprintf("匿名卷 %s (挂载到 %s) 无法复用，重建容器后数据不会保留", shortID(m.Name), m.Destination))
+				service.Volumes = append(service.Volumes, m.Destination)
+				continue
+			}
+			if volumes == nil {
+				volumes = make(map[string]*Volume)
+			}
+			volumes[m.Name] = &Volume{External: true, Name: m.Name}
+			service.Volumes = append(service.Volumes, m.Name+":"+m.Destination+mode)
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s 类型的挂载 %s 无法表达", m.Type, m.Destination))
+		}
+	}
+	sort.Strings(service.Volumes)
+
+	// 重启策略
+	switch policy := hostConfig.RestartPolicy; policy.Name {
+	case "", container.RestartPolicyDisabled:
+		service.Restart = "no"
+	case container.RestartPolicyOnFailure:
+		service.Restart = "on-failure"
+		if policy.MaximumRetryCount > 0 {
+			warnings = append(warnings, fmt.Sprintf("重启策略的最大重试次数 %d 已忽略", policy.MaximumRetryCount))
+		}
+	default:
+		service.Restart = string(policy.Name)
+	}
+
+	// 网络：默认 bridge 网络无需声明，自定义网络声明为外部网络
+	var networks map[string]*Network
+	mode := string(hostConfig.NetworkMode)
+	switch {
+	case mode == "" || mode == "default" || mode == "bridge":
+	case mode == "host" || mode == "none" || strings.HasPrefix(mode, "container:"):
+		warnings = append(warnings, fmt.Sprintf("网络模式 %s 无法表达", mode))
+	}
+	if info.NetworkSettings != nil {
+		var names []string
+		for name := range info.NetworkSettings.Networks {
+			if name != "bridge" && name != "host" && name != "none" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if networks == nil {
+				networks = make(map[string]*Network)
+			}
+			networks[name] = &Network{External: true, Name: name}
+		}
+		if len(names) > 0 {
+			service.Networks = names
+		}
+	}
+
+	// 资源限制
+	if hostConfig.Memory > 0 || hostConfig.NanoCPUs > 0 {
+		limits := &ResourceLimit{}
+		if hostConfig.Memory > 0 {
+			limits.Memory = fmt.Sprintf("%db", hostConfig.Memory)
+		}
+		if hostConfig.NanoCPUs > 0 {
+			limits.CPUs = fmt.Sprintf("%g", float64(hostConfig.NanoCPUs)/1e9)
+		}
+		service.Deploy = &DeployConfig{Resources: &ResourcesConfig{Limits: limits}}
+	}
+
+	// 健康检查
+	if hc := info.Config.Healthcheck; hc != nil && len(hc.Test) > 0 && !equalHealthcheck(hc, imageConfig.Healthcheck) {
+		service.HealthCheck = &HealthCheck{Test: []string(hc.Test), Retries: hc.Retries}
+		if hc.Interval > 0 {
+			service.HealthCheck.Interval = hc.Interval.String()
+		}
+		if hc.Timeout > 0 {
+			service.HealthCheck.Timeout = hc.Timeout.String()
+		}
+		if hc.StartPeriod > 0 {
+			service.HealthCheck.StartPeriod = hc.StartPeriod.String()
+		}
+	}
+
+	// 日志驱动
+	if lc := hostConfig.LogConfig; lc.Type != "" && (lc.Type != "json-file" || len(lc.Config) > 0) {
+		service.Logging = &LoggingConfig{Driver: lc.Type, Options: lc.Config}
+	}
+
+	// 当前 compose 模型无法表达的配置
+	if len(hostConfig.Devices) > 0 {
+		devices := make([]string, 0, len(hostConfig.Devices))
+		for _, device := range hostConfig.Devices {
+			devices = append(devices, device.PathOnHost+":"+device.PathInContainer)
+		}
+		warnings = append(warnings, "设备映射无法表达: "+strings.Join(devices, ", "))
+	}
+	for _, unsupported := range []struct {
+		name   string
+		values []string
+	}{
+		{"cap_add", hostConfig.CapAdd},
+		{"cap_drop", hostConfig.CapDrop},
+		{"security_opt", hostConfig.SecurityOpt},
+	} {
+		if len(unsupported.values) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s 无法表达: %s", unsupported.name, strings.Join(unsupported.values, ", ")))
+		}
+	}
+	if hostConfig.PidMode != "" {
+		warnings = append(warnings, fmt.Sprintf("pid 模式 %s 无法表达", hostConfig.PidMode))
+	}
+	if ipc := string(hostConfig.IpcMode); ipc != "" && ipc != "private" && ipc != "shareable" {
+		warnings = append(warnings, fmt.Sprintf("ipc 模式 %s 无法表达", ipc))
+	}
+	if len(hostConfig.Sysctls) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d 个 sysctl 配置无法表达", len(hostConfig.Sysctls)))
+	}
+	if len(hostConfig.Tmpfs) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d 个 tmpfs 挂载无法表达", len(hostConfig.Tmpfs)))
+	}
+	if len(hostConfig.Ulimits) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d 个 ulimit 配置无法表达", len(hostConfig.Ulimits)))
+	}
+
+	cfg := &ComposeConfig{
+		Version:  "3.8",
+		Services: map[string]*Service{serviceName: service},
+		Networks: networks,
+		Volumes:  volumes,
+	}
+	return cfg, serviceName, warnings
+}
+
+var anonymousVolumePattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// isAnonymousVolume 匿名卷名称为 64 位十六进制
+func isAnonymousVolume(name string) bool {
+	return anonymousVolumePattern.MatchString(name)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalHealthcheck(a, b *container.HealthConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return equalStrings(a.Test, b.Test) && a.Interval == b.Interval && a.Timeout == b.Timeout &&
+		a.StartPeriod == b.StartPeriod && a.Retries == b.Retries
+}
+
+// singleService 返回单服务项目中的服务定义
+func singleService(cfg *ComposeConfig) *Service {
+	for _, service := range cfg.Services {
+		return service
+	}
+	return &Service{}
+}
+
+// diffServices 比较声明的服务定义与容器实际配置
+func diffServices(declared, actual *Service) []string {
+	var diffs []string
+	compare := func(field, want, got string) {
+		if want != got {
+			diffs = append(diffs, fmt.Sprintf("%s: 定义为 %q，实际为 %q", field, want, got))
+		}
+	}
+	compareList := func(field string, want, got []string) {
+		want = append([]string(nil), want...)
+		got = append([]string(nil), got...)
+		sort.Strings(want)
+		sort.Strings(got)
+		compare(field, strings.Join(want, ", "), strings.Join(got, ", "))
+	}
+
+	compare("image", declared.Image, actual.Image)
+	compare("restart", declared.Restart, actual.Restart)
+	compare("privileged", fmt.Sprint(declared.Privileged), fmt.Sprint(actual.Privileged))
+	compareList("environment", environmentList(declared.Environment), environmentList(actual.Environment))
+	compareList("ports", declared.Ports, actual.Ports)
+	compareList("volumes", declared.Volumes, actual.Volumes)
+	compareList("networks", stringList(declared.Networks), stringList(actual.Networks))
+
+	var wantLabels, gotLabels []string
+	for key, value := range declared.Labels {
+		wantLabels = append(wantLabels, key+"="+value)
+	}
+	for key, value := range actual.Labels {
+		gotLabels = append(gotLabels, key+"="+value)
+	}
+	compareList("labels", wantLabels, gotLabels)
+	return diffs
+}
@@ -0,0 +1,214 @@
+package container
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// inspectingExecutor 返回预设 inspect 结果的执行器
+type inspectingExecutor struct {
+	*mockDockerExecutor
+	containers map[string]types.ContainerJSON
+	images     map[string]*container.Config
+}
+
+func (e *inspectingExecutor) ListContainers(ctx context.Context) ([]ContainerSummary, error) {
+	var result []ContainerSummary
+	for _, info := range e.containers {
+		result = append(result, ContainerSummary{
+			ID:     shortID(info.ID),
+			Name:   strings.TrimPrefix(info.Name, "/"),
+			Image:  info.Config.Image,
+			State:  info.State.Status,
+			Labels: info.Config.Labels,
+		})
+	}
+	return result, nil
+}
+
+func (e *inspectingExecutor) InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	for id, info := range e.containers {
+		if strings.HasPrefix(id, containerID) {
+			return info, nil
+		}
+	}
+	return types.ContainerJSON{}, errors.New("no such container")
+}
+
+func (e *inspectingExecutor) InspectImageConfig(ctx context.Context, image string) (*container.Config, error) {
+	if cfg, ok := e.images[image]; ok {
+		return cfg, nil
+	}
+	return nil, errors.New("no such image")
+}
+
+const adoptTestContainerID = "4f2a9c1be0d7a3f6c5e8b9d0a1b2c3d4e5f60718293a4b5c6d7e8f9012345678"
+
+func adoptTestContainer() types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    adoptTestContainerID,
+			Name:  "/Legacy_Web",
+			State: &types.ContainerState{Status: "running"},
+			HostConfig: &container.HostConfig{
+				PortBindings: nat.PortMap{
+					"80/tcp": {{HostIP: "0.0.0.0", HostPort: "8080"}},
+					"53/udp": {{HostIP: "127.0.0.1", HostPort: "5353"}},
+				},
+				RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 5},
+				NetworkMode:   "bridge",
+				CapAdd:        []string{"NET_ADMIN"},
+				Resources: container.Resources{
+					Devices: []container.DeviceMapping{{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse"}},
+				},
+			},
+		},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeBind, Source: "/srv/www", Destination: "/usr/share/nginx/html", RW: false},
+			{Type: mount.TypeVolume, Name: "web-cache", Destination: "/var/cache/nginx", RW: true},
+		},
+		Config: &container.Config{
+			Image:  "nginx:1.25",
+			Env:    []string{"PATH=/usr/bin", "APP_ENV=prod"},
+			Labels: map[string]string{"maintainer": "nginx", "team": "web"},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"bridge": {}},
+		},
+	}
+}
+
+func setupAdoptionTest(t *testing.T) (*AdoptionService, *inspectingExecutor, SelfHealingService) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}, &FailureRecord{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	executor := &inspectingExecutor{
+		mockDockerExecutor: newMockDockerExecutor(),
+		containers:         map[string]types.ContainerJSON{adoptTestContainerID: adoptTestContainer()},
+		images: map[string]*container.Config{
+			"nginx:1.25": {Env: []string{"PATH=/usr/bin"}, Labels: map[string]string{"maintainer": "nginx"}},
+		},
+	}
+	healing := NewSelfHealingService(db, executor, NewMockNotificationService())
+	return NewAdoptionService(db, NewComposeService(db), executor, healing), executor, healing
+}
+
+func TestSynthesizeCompose(t *testing.T) {
+	cfg, name, warnings := SynthesizeCompose(adoptTestContainer(), &container.Config{
+		Env:    []string{"PATH=/usr/bin"},
+		Labels: map[string]string{"maintainer": "nginx"},
+	})
+	if name != "legacy_web" {
+		t.Fatalf("service name = %q", name)
+	}
+	service := cfg.Services[name]
+	if service.Image != "nginx:1.25" || service.Restart != "on-failure" {
+		t.Errorf("image/restart = %q/%q", service.Image, service.Restart)
+	}
+	if env, ok := service.Environment.([]string); !ok || len(env) != 1 || env[0] != "APP_ENV=prod" {
+		t.Errorf("environment should drop image defaults, got %v", service.Environment)
+	}
+	if len(service.Labels) != 1 || service.Labels["team"] != "web" {
+		t.Errorf("labels should drop image defaults, got %v", service.Labels)
+	}
+	wantPorts := []string{"127.0.0.1:5353:53/udp", "8080:80"}
+	if strings.Join(service.Ports, ",") != strings.Join(wantPorts, ",") {
+		t.Errorf("ports = %v, want %v", service.Ports, wantPorts)
+	}
+	wantVolumes := []string{"/srv/www:/usr/share/nginx/html:ro", "web-cache:/var/cache/nginx"}
+	if strings.Join(service.Volumes, ",") != strings.Join(wantVolumes, ",") {
+		t.Errorf("volumes = %v, want %v", service.Volumes, wantVolumes)
+	}
+	if v := cfg.Volumes["web-cache"]; v == nil || !v.External {
+		t.Errorf("named volume should be declared external, got %+v", v)
+	}
+
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"cap_add", "/dev/fuse", "最大重试次数 5"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("warnings should mention %q, got:\n%s", want, joined)
+		}
+	}
+}
+
+func TestAdoptionService_Adopt(t *testing.T) {
+	service, _, healing := setupAdoptionTest(t)
+	ctx := context.Background()
+
+	unmanaged, err := service.ListUnmanaged(ctx)
+	if err != nil || len(unmanaged) != 1 {
+		t.Fatalf("ListUnmanaged = %v, %v; want one container", unmanaged, err)
+	}
+
+	result, err := service.Adopt(ctx, unmanaged[0].ID, "alice")
+	if err != nil {
+		t.Fatalf("Adopt: %v", err)
+	}
+	project := result.Project
+	if !project.Adopted || project.AdoptedContainerID != adoptTestContainerID || project.Status != ProjectStatusRunning {
+		t.Errorf("unexpected project: %+v", project)
+	}
+	if len(result.Warnings) == 0 || !strings.Contains(project.Description, "cap_add") {
+		t.Errorf("warnings should be returned and recorded, got %v / %q", result.Warnings, project.Description)
+	}
+	if _, err := healing.GetContainerHealth(ctx, adoptTestContainerID); err != nil {
+		t.Errorf("container should be registered with healing: %v", err)
+	}
+
+	if unmanaged, _ := service.ListUnmanaged(ctx); len(unmanaged) != 0 {
+		t.Errorf("adopted container should no longer be listed, got %v", unmanaged)
+	}
+	if _, err := service.Adopt(ctx, adoptTestContainerID, "alice"); !errors.Is(err, ErrContainerManaged) {
+		t.Errorf("second adopt: want ErrContainerManaged, got %v", err)
+	}
+}
+
+func TestAdoptionService_CheckDrift(t *testing.T) {
+	service, executor, _ := setupAdoptionTest(t)
+	ctx := context.Background()
+
+	result, err := service.Adopt(ctx, adoptTestContainerID, "alice")
+	if err != nil {
+		t.Fatalf("Adopt: %v", err)
+	}
+	report, err := service.CheckDrift(ctx, result.Project.ID)
+	if err != nil {
+		t.Fatalf("CheckDrift: %v", err)
+	}
+	if report.Drifted {
+		t.Fatalf("freshly adopted container should not drift: %v", report.Differences)
+	}
+
+	// 容器被手动以新镜像重建
+	changed := adoptTestContainer()
+	changed.Config.Image = "nginx:1.27"
+	executor.containers[adoptTestContainerID] = changed
+	reports, err := service.CheckAllDrift(ctx)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("CheckAllDrift = %v, %v", reports, err)
+	}
+	if !reports[0].Drifted || !strings.Contains(strings.Join(reports[0].Differences, "\n"), "nginx:1.27") {
+		t.Errorf("image change should be reported, got %+v", reports[0])
+	}
+}
@@ -0,0 +1,263 @@
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+
+	"gorm.io/gorm"
+)
+
+// DefaultAnalysisInterval 定时重新分析 Compose 项目的默认间隔
+const DefaultAnalysisInterval = 7 * 24 * time.Hour
+
+// analysisHistoryLimit 历史接口默认返回的记录数
+const analysisHistoryLimit = 52
+
+// AnalysisRun 一次项目架构分析和性能评估的结果，用于绘制健康评分趋势
+type AnalysisRun struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	ProjectID        uint      `json:"project_id" gorm:"not null;index"`
+	ContentHash      string    `json:"content_hash" gorm:"size:64"` // 分析时项目内容的 sha256，内容未变化时跳过分析
+	HealthScore      int       `json:"health_score"`                // 架构健康评分 (0-100)
+	PerformanceScore int       `json:"performance_score"`           // 性能评估总分 (0-100)
+	Critical         int       `json:"critical"`                    // 各严重程度的问题数
+	High             int       `json:"high"`
+	Medium           int       `json:"medium"`
+	Low              int       `json:"low"`
+	Info             int       `json:"info"`
+	Issues           []string  `json:"issues" gorm:"type:text;serializer:json"` // 问题摘要（服务: 标题），用于找出新增的问题
+	CreatedAt        time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (AnalysisRun) TableName() string {
+	return "compose_analysis_runs"
+}
+
+// newIssues 本次分析相对上一次新增的问题
+func (r *AnalysisRun) newIssues(previous *AnalysisRun) []string {
+	seen := make(map[string]bool, len(previous.Issues))
+	for _, issue := range previous.Issues {
+		seen[issue] = true
+	}
+	var added []string
+	for _, issue := range r.Issues {
+		if !seen[issue] {
+			added = append(added, issue)
+		}
+	}
+	return added
+}
+
+// ScoreDrop 项目健康评分相对上一次分析下降
+type ScoreDrop struct {
+	Project   string   `json:"project"`
+	Previous  int      `json:"previous"`
+	Current   int      `json:"current"`
+	NewIssues []string `json:"new_issues,omitempty"`
+}
+
+// AnalysisResult 一轮定时分析的结果
+type AnalysisResult struct {
+	Analyzed int         `json:"analyzed"`
+	Skipped  int         `json:"skipped"` // 内容未变化而跳过的项目
+	Failed   []string    `json:"failed,omitempty"`
+	Drops    []ScoreDrop `json:"drops,omitempty"`
+}
+
+// ProjectScore 项目最近一次分析的评分
+type ProjectScore struct {
+	Project string       `json:"project"`
+	Run     *AnalysisRun `json:"run"`
+}
+
+// AnalysisHistory 定时重新分析所有 Compose 项目并记录健康评分历史
+type AnalysisHistory struct {
+	db        *gorm.DB
+	compose   ComposeService
+	parser    *ComposeParser
+	optimizer ArchitectureOptimizer
+	notify    func(notify.Event) notify.Decision
+}
+
+// NewAnalysisHistory 创建项目分析历史服务
+func NewAnalysisHistory(db *gorm.DB, composeService ComposeService) *AnalysisHistory {
+	return &AnalysisHistory{
+		db:        db,
+		compose:   composeService,
+		parser:    NewComposeParser(),
+		optimizer: NewArchitectureOptimizer(),
+		notify:    notify.SendEvent,
+	}
+}
+
+// AnalysisInterval 配置的定时分析间隔，未配置时每周一次
+func AnalysisInterval() time.Duration {
+	if hours := config.Current().ComposeAnalysis.IntervalHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return DefaultAnalysisInterval
+}
+
+// contentHash 项目内容的 sha256
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// RunAll 重新分析所有项目，内容和上一次分析相同的项目跳过；评分下降时发送 info 级别的通知
+func (h *AnalysisHistory) RunAll(ctx context.Context) (*AnalysisResult, error) {
+	projects, err := h.compose.ListProjects(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := &AnalysisResult{}
+	for _, project := range projects {
+		previous, err := h.latest(ctx, project.ID)
+		if err != nil {
+			return result, err
+		}
+		hash := contentHash(project.Content)
+		if previous != nil && previous.ContentHash == hash {
+			result.Skipped++
+			continue
+		}
+		run, err := h.analyze(ctx, project, hash)
+		if err != nil {
+			logger.Info("⚠️ Compose 项目 %s 定时分析失败: %v", project.Name, err)
+			result.Failed = append(result.Failed, project.Name)
+			continue
+		}
+		result.Analyzed++
+		if previous != nil && run.HealthScore < previous.HealthScore {
+			drop := ScoreDrop{Project: project.Name, Previous: previous.HealthScore, Current: run.HealthScore, NewIssues: run.newIssues(previous)}
+			result.Drops = append(result.Drops, drop)
+			h.reportDrop(drop)
+		}
+	}
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("%d 个项目分析失败: %s", len(result.Failed), strings.Join(result.Failed, ", "))
+	}
+	return result, nil
+}
+
+// analyze 分析项目并保存结果
+func (h *AnalysisHistory) analyze(ctx context.Context, project *ComposeProject, hash string) (*AnalysisRun, error) {
+	cfg, err := h.parser.Parse(project.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	analysis, err := h.optimizer.AnalyzeArchitecture(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze architecture: %w", err)
+	}
+	evaluation, err := h.optimizer.EvaluatePerformance(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate performance: %w", err)
+	}
+
+	run := &AnalysisRun{
+		ProjectID:        project.ID,
+		ContentHash:      hash,
+		HealthScore:      analysis.HealthScore,
+		PerformanceScore: evaluation.OverallScore,
+	}
+	for _, issue := range analysis.Issues {
+		switch issue.Severity {
+		case SeverityCritical:
+			run.Critical++
+		case SeverityHigh:
+			run.High++
+		case SeverityMedium:
+			run.Medium++
+		case SeverityLow:
+			run.Low++
+		default:
+			run.Info++
+		}
+		summary := issue.Title
+		if issue.Service != "" {
+			summary = issue.Service + ": " + issue.Title
+		}
+		run.Issues = append(run.Issues, summary)
+	}
+	sort.Strings(run.Issues)
+	if err := h.db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to save analysis run: %w", err)
+	}
+	return run, nil
+}
+
+// reportDrop 发送评分下降通知
+func (h *AnalysisHistory) reportDrop(drop ScoreDrop) {
+	logger.Info("📉 Compose 项目 %s 健康评分下降: %d -> %d", drop.Project, drop.Previous, drop.Current)
+	content := fmt.Sprintf("📉 **Compose 项目健康评分下降**\n\n项目: %s\n评分: %d → %d", drop.Project, drop.Previous, drop.Current)
+	if len(drop.NewIssues) > 0 {
+		content += "\n新增问题:\n- " + strings.Join(drop.NewIssues, "\n- ")
+	}
+	h.notify(notify.Event{
+		Severity: notify.SeverityInfo,
+		Category: "compose-analysis",
+		Target:   drop.Project,
+		Title:    "Compose 项目健康评分下降",
+		Content:  content,
+	})
+}
+
+// latest 项目最近一次分析，没有记录时返回 nil
+func (h *AnalysisHistory) latest(ctx context.Context, projectID uint) (*AnalysisRun, error) {
+	var run AnalysisRun
+	err := h.db.WithContext(ctx).Where("project_id = ?", projectID).Order("created_at DESC, id DESC").First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// History 项目的分析历史，按时间升序，limit 为 0 时返回最近 52 次
+func (h *AnalysisHistory) History(ctx context.Context, projectID uint, limit int) ([]*AnalysisRun, error) {
+	if limit <= 0 {
+		limit = analysisHistoryLimit
+	}
+	var runs []*AnalysisRun
+	if err := h.db.WithContext(ctx).Where("project_id = ?", projectID).
+		Order("created_at DESC, id DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	return runs, nil
+}
+
+// Worst 最近一次分析评分最低的项目，没有分析记录时返回 nil
+func (h *AnalysisHistory) Worst(ctx context.Context) (*ProjectScore, error) {
+	projects, err := h.compose.ListProjects(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var worst *ProjectScore
+	for _, project := range projects {
+		run, err := h.latest(ctx, project.ID)
+		if err != nil {
+			return nil, err
+		}
+		if run != nil && (worst == nil || run.HealthScore < worst.Run.HealthScore) {
+			worst = &ProjectScore{Project: project.Name, Run: run}
+		}
+	}
+	return worst, nil
+}
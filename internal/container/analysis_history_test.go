@@ -0,0 +1,151 @@
+package container
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"qwq/internal/notify"
+
+	"github.com/gorilla/mux"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// degradedTestContent 比 revisionTestContent 多出特权容器和暴露的数据库端口
+const degradedTestContent = `version: "3.8"
+services:
+  web:
+    image: nginx:latest
+    ports:
+      - "80:80"
+  db:
+    image: mysql:latest
+    privileged: true
+    ports:
+      - "3306:3306"
+`
+
+func setupAnalysisHistoryTest(t *testing.T) (*AnalysisHistory, *gorm.DB, *ComposeProject, *[]notify.Event) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}, &AnalysisRun{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	composeService := NewComposeService(db)
+	project := &ComposeProject{Name: "shop", Content: revisionTestContent, TenantID: 1}
+	if err := composeService.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	var events []notify.Event
+	history := NewAnalysisHistory(db, composeService)
+	history.notify = func(event notify.Event) notify.Decision {
+		events = append(events, event)
+		return notify.Decision{}
+	}
+	return history, db, project, &events
+}
+
+func TestAnalysisHistory_RunAll(t *testing.T) {
+	history, db, project, events := setupAnalysisHistoryTest(t)
+	ctx := context.Background()
+
+	result, err := history.RunAll(ctx)
+	if err != nil {
+		t.Fatalf("RunAll: %v", err)
+	}
+	if result.Analyzed != 1 || result.Skipped != 0 {
+		t.Fatalf("Expected the project to be analyzed, got %+v", result)
+	}
+
+	// 内容未变化时跳过
+	result, err = history.RunAll(ctx)
+	if err != nil {
+		t.Fatalf("RunAll: %v", err)
+	}
+	if result.Analyzed != 0 || result.Skipped != 1 {
+		t.Fatalf("Expected the unchanged project to be skipped, got %+v", result)
+	}
+
+	if err := db.Model(project).Update("content", degradedTestContent).Error; err != nil {
+		t.Fatal(err)
+	}
+	result, err = history.RunAll(ctx)
+	if err != nil {
+		t.Fatalf("RunAll: %v", err)
+	}
+	if result.Analyzed != 1 || len(result.Drops) != 1 {
+		t.Fatalf("Expected a score drop, got %+v", result)
+	}
+	drop := result.Drops[0]
+	if drop.Project != "shop" || drop.Current >= drop.Previous || len(drop.NewIssues) == 0 {
+		t.Errorf("Unexpected drop %+v", drop)
+	}
+	if len(*events) != 1 || (*events)[0].Severity != notify.SeverityInfo || (*events)[0].Target != "shop" {
+		t.Errorf("Expected one info event for the project, got %+v", *events)
+	}
+
+	runs, err := history.History(ctx, project.ID, 0)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(runs) != 2 || runs[0].HealthScore != drop.Previous || runs[1].HealthScore != drop.Current {
+		t.Fatalf("Expected two runs in chronological order, got %+v", runs)
+	}
+	if runs[1].Critical+runs[1].High+runs[1].Medium+runs[1].Low+runs[1].Info != len(runs[1].Issues) {
+		t.Errorf("Severity counts should add up to the issue count, got %+v", runs[1])
+	}
+
+	worst, err := history.Worst(ctx)
+	if err != nil || worst == nil || worst.Project != "shop" || worst.Run.ID != runs[1].ID {
+		t.Errorf("Expected the latest run as the worst project, got %+v %v", worst, err)
+	}
+}
+
+func TestAPIHandler_GetAnalysisHistory(t *testing.T) {
+	history, db, project, _ := setupAnalysisHistoryTest(t)
+	if _, err := history.RunAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewAPIHandler(db)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/compose/%d/analysis/history", project.ID), nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without analysis history, got %d", rec.Code)
+	}
+
+	handler.SetAnalysisHistory(history)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/compose/%d/analysis/history", project.ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Project string         `json:"project"`
+		Runs    []*AnalysisRun `json:"runs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Project != "shop" || len(body.Runs) != 1 {
+		t.Errorf("Unexpected history %+v", body)
+	}
+}
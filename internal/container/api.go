@@ -0,0 +1,851 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"qwq/internal/apierror"
+	"qwq/internal/pagination"
+	"qwq/internal/portaudit"
+	"qwq/internal/session"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// PermissionPipelinesManage 创建、修改、删除和运行流水线所需的权限
+const PermissionPipelinesManage = "pipelines:manage"
+
+// streamUpgrader 部署事件推送的 WebSocket 升级器，只接受同源请求
+var streamUpgrader = websocket.Upgrader{}
+
+// containerErrors 容器服务错误到 API 错误码的映射
+var containerErrors = []apierror.Mapping{
+	{Err: ErrProjectNotFound, Status: http.StatusNotFound, Code: "PROJECT_NOT_FOUND"},
+	{Err: ErrProjectAlreadyExists, Status: http.StatusConflict, Code: "PROJECT_ALREADY_EXISTS"},
+	{Err: ErrInvalidComposeFile, Status: http.StatusUnprocessableEntity, Code: "COMPOSE_INVALID"},
+	{Err: ErrRevisionNotFound, Status: http.StatusNotFound, Code: "REVISION_NOT_FOUND"},
+	{Err: ErrServiceNotFound, Status: http.StatusNotFound, Code: "COMPOSE_SERVICE_NOT_FOUND"},
+	{Err: ErrHealthCheckExists, Status: http.StatusConflict, Code: "HEALTHCHECK_EXISTS"},
+	{Err: ErrNoHealthCheckSuggestion, Status: http.StatusUnprocessableEntity, Code: "HEALTHCHECK_NO_SUGGESTION"},
+	{Err: ErrInvalidLogRotation, Status: http.StatusBadRequest, Code: "LOG_ROTATION_INVALID"},
+	{Err: ErrTruncateNotConfirmed, Status: http.StatusBadRequest, Code: "LOG_TRUNCATE_NOT_CONFIRMED"},
+	{Err: ErrNoServiceContainers, Status: http.StatusConflict, Code: "SERVICE_NO_CONTAINERS"},
+	{Err: ErrSelfApproval, Status: http.StatusForbidden, Code: "DEPLOYMENT_SELF_APPROVAL"},
+	{Err: ErrRejectReasonRequired, Status: http.StatusBadRequest, Code: "DEPLOYMENT_REJECT_REASON_REQUIRED"},
+	{Err: ErrNotPendingApproval, Status: http.StatusConflict, Code: "DEPLOYMENT_NOT_PENDING"},
+	{Err: ErrApprovalExpired, Status: http.StatusConflict, Code: "DEPLOYMENT_APPROVAL_EXPIRED"},
+	{Err: ErrContainerManaged, Status: http.StatusConflict, Code: "CONTAINER_ALREADY_MANAGED"},
+	{Err: ErrNotAdopted, Status: http.StatusBadRequest, Code: "PROJECT_NOT_ADOPTED"},
+	{Err: ErrInspectUnsupported, Status: http.StatusNotImplemented, Code: "CONTAINER_INSPECT_UNSUPPORTED"},
+	{Err: ErrPipelineNotFound, Status: http.StatusNotFound, Code: "PIPELINE_NOT_FOUND"},
+	{Err: ErrInvalidPipeline, Status: http.StatusUnprocessableEntity, Code: "PIPELINE_INVALID"},
+	{Err: ErrPipelineAlreadyExists, Status: http.StatusConflict, Code: "PIPELINE_ALREADY_EXISTS"},
+	{Err: ErrPipelineRunning, Status: http.StatusConflict, Code: "PIPELINE_RUNNING"},
+	{Err: ErrNoBuildServices, Status: http.StatusUnprocessableEntity, Code: "BUILD_NO_SERVICES"},
+	{Err: ErrBuildContextNotAllowed, Status: http.StatusForbidden, Code: "BUILD_CONTEXT_NOT_ALLOWED"},
+	{Err: ErrBuildFailed, Status: http.StatusUnprocessableEntity, Code: "BUILD_FAILED"},
+	{Err: ErrInvalidProbe, Status: http.StatusUnprocessableEntity, Code: "PROBE_INVALID"},
+	{Err: portaudit.ErrPortConflict, Status: http.StatusConflict, Code: "PORT_CONFLICT"},
+}
+
+// API 处理器直接返回的错误
+var (
+	errInvalidBody        = apierror.New(http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+	errDeploymentNotFound = apierror.New(http.StatusNotFound, "DEPLOYMENT_NOT_FOUND", "deployment not found")
+	// errComposeInvalid Compose 内容校验失败，details 为带行号的校验结果
+	errComposeInvalid = apierror.New(http.StatusUnprocessableEntity, "COMPOSE_INVALID", "compose validation failed")
+)
+
+// PermissionChecker 检查请求用户是否拥有指定权限
+type PermissionChecker func(r *http.Request, permission string) bool
+
+// APIHandler Compose 编辑器 API 处理器
+type APIHandler struct {
+	composeService    ComposeService      // Compose 服务
+	permissionChecker PermissionChecker   // 权限检查，未设置时拒绝需要权限的操作
+	adoptionService   *AdoptionService    // 容器纳管，未设置时相关接口返回 503
+	pipelineService   *PipelineService    // 部署流水线，未设置时相关接口返回 503
+	analysisHistory   *AnalysisHistory    // 定时分析历史，未设置时相关接口返回 503
+	logRotation       *LogRotationService // 日志轮转修复，未设置时相关接口返回 503
+	buildService      *BuildService       // 镜像构建，未设置时相关接口返回 503
+}
+
+// NewAPIHandler 创建 API 处理器
+func NewAPIHandler(db *gorm.DB) *APIHandler {
+	return &APIHandler{composeService: NewComposeService(db)}
+}
+
+// SetPermissionChecker 设置权限检查函数
+func (h *APIHandler) SetPermissionChecker(checker PermissionChecker) {
+	h.permissionChecker = checker
+}
+
+// SetAdoptionService 设置容器纳管服务
+func (h *APIHandler) SetAdoptionService(service *AdoptionService) {
+	h.adoptionService = service
+}
+
+// SetPipelineService 设置部署流水线服务
+func (h *APIHandler) SetPipelineService(service *PipelineService) {
+	h.pipelineService = service
+}
+
+// SetAnalysisHistory 设置项目定时分析历史服务
+func (h *APIHandler) SetAnalysisHistory(history *AnalysisHistory) {
+	h.analysisHistory = history
+}
+
+// SetLogRotationService 设置容器日志轮转服务
+func (h *APIHandler) SetLogRotationService(service *LogRotationService) {
+	h.logRotation = service
+}
+
+// SetBuildService 设置镜像构建服务
+func (h *APIHandler) SetBuildService(service *BuildService) {
+	h.buildService = service
+}
+
+// RegisterRoutes 注册路由
+func (h *APIHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/api/compose/{project}/content", h.UpdateContent).Methods("PUT")
+	router.HandleFunc("/api/compose/{project}/revisions", h.ListRevisions).Methods("GET")
+	router.HandleFunc("/api/compose/{project}/revisions/{revision}/revert", h.RevertRevision).Methods("POST")
+	router.HandleFunc("/api/compose/{project}/deployments", h.ListDeployments).Methods("GET")
+	router.HandleFunc("/api/compose/{project}/build", h.BuildImages).Methods("POST")
+	router.HandleFunc("/api/deployments/approvals", h.ListPendingApprovals).Methods("GET")
+	router.HandleFunc("/api/deployments/{id}/approve", h.ApproveDeployment).Methods("POST")
+	router.HandleFunc("/api/deployments/{id}/reject", h.RejectDeployment).Methods("POST")
+	router.HandleFunc("/api/containers/unmanaged", h.ListUnmanagedContainers).Methods("GET")
+	router.HandleFunc("/api/containers/{id}/adopt", h.AdoptContainer).Methods("POST")
+	router.HandleFunc("/api/compose/{project}/drift", h.CheckDrift).Methods("GET")
+	router.HandleFunc("/api/compose/{project}/analysis/history", h.GetAnalysisHistory).Methods("GET")
+	router.HandleFunc("/api/compose/{project}/optimizations", h.GetOptimizations).Methods("GET")
+	router.HandleFunc("/api/compose/{project}/services/{name}/suggest-healthcheck", h.SuggestHealthCheck).Methods("POST")
+	router.HandleFunc("/api/compose/{project}/services/{name}/log-rotation", h.ApplyLogRotation).Methods("POST")
+	router.HandleFunc("/api/pipelines", h.ListPipelines).Methods("GET")
+	router.HandleFunc("/api/pipelines", h.CreatePipeline).Methods("POST")
+	router.HandleFunc("/api/pipelines/{id}", h.GetPipeline).Methods("GET")
+	router.HandleFunc("/api/pipelines/{id}", h.UpdatePipeline).Methods("PUT")
+	router.HandleFunc("/api/pipelines/{id}", h.DeletePipeline).Methods("DELETE")
+	router.HandleFunc("/api/pipelines/{id}/run", h.RunPipeline).Methods("POST")
+	router.HandleFunc("/api/pipelines/{id}/runs", h.ListPipelineRuns).Methods("GET")
+	router.HandleFunc("/ws/deployments/{id}/events", h.StreamDeploymentEvents).Methods("GET")
+}
+
+// UpdateContent 校验并保存 Compose 内容
+// 校验失败返回 422 和带行号的错误列表，内容不会被保存
+func (h *APIHandler) UpdateContent(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+
+	result, err := h.composeService.SaveProjectContent(r.Context(), project.ID, req.Content, getAuthor(r), req.Message)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	if !result.Valid {
+		respondServiceError(w, r, errComposeInvalid.WithDetails(result))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// ListRevisions 列出项目的修订历史
+func (h *APIHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.composeService.ListRevisions(r.Context(), project.ID)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"revisions": revisions,
+		"total":     len(revisions),
+	})
+}
+
+// RevertRevision 将项目回滚到指定修订
+func (h *APIHandler) RevertRevision(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+
+	revision, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+
+	result, err := h.composeService.RevertToRevision(r.Context(), project.ID, revision, getAuthor(r))
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	if !result.Valid {
+		respondServiceError(w, r, errComposeInvalid.WithDetails(result))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// deploymentListSpec 部署记录列表允许的排序字段和过滤参数，默认最新的在前
+var deploymentListSpec = pagination.Spec{
+	Sort:        map[string]string{"id": "id", "created_at": "created_at", "started_at": "started_at", "completed_at": "completed_at", "status": "status", "version": "version"},
+	DefaultSort: "-created_at",
+	Filters:     map[string]string{"status": "status", "strategy": "strategy", "requested_by": "requested_by"},
+}
+
+// ListDeployments 分页列出项目的部署记录
+func (h *APIHandler) ListDeployments(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+	q, err := pagination.Parse(r.URL.Query(), deploymentListSpec)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+
+	page, err := h.composeService.QueryDeployments(r.Context(), project.ID, q)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, page)
+}
+
+// BuildImages 单独构建项目中带 build 的服务的镜像，请求体 services 为空时构建全部
+// 构建在后台执行，返回的记录可通过 /ws/deployments/{id}/events 查看构建日志
+func (h *APIHandler) BuildImages(w http.ResponseWriter, r *http.Request) {
+	if h.buildService == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Image builds are not configured")
+		return
+	}
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Services []string `json:"services"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+
+	run, err := h.buildService.Build(WithRequester(r.Context(), getAuthor(r)), project.ID, req.Services)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, run)
+}
+
+// SuggestHealthCheck 为缺少健康检查的服务生成 healthcheck 配置
+// 请求体 apply 为 true（或 ?apply=true）时直接写入项目内容并生成新修订
+func (h *APIHandler) SuggestHealthCheck(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Apply   bool   `json:"apply"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+	if apply, err := strconv.ParseBool(r.URL.Query().Get("apply")); err == nil && apply {
+		req.Apply = true
+	}
+
+	name := mux.Vars(r)["name"]
+	config, err := h.composeService.ParseComposeFile(r.Context(), project.Content)
+	if err != nil {
+		respondServiceError(w, r, apierror.Wrap(http.StatusUnprocessableEntity, "COMPOSE_INVALID", err))
+		return
+	}
+	service, exists := config.Services[name]
+	if !exists {
+		respondServiceError(w, r, fmt.Errorf("%w: %s", ErrServiceNotFound, name))
+		return
+	}
+	if service.HealthCheck != nil {
+		respondServiceError(w, r, fmt.Errorf("%w: %s", ErrHealthCheckExists, name))
+		return
+	}
+	suggestion, err := SuggestHealthCheck(name, service)
+	if err != nil {
+		respondServiceError(w, r, apierror.Wrap(http.StatusUnprocessableEntity, "COMPOSE_INVALID", err))
+		return
+	}
+
+	response := map[string]interface{}{"suggestion": suggestion}
+	if req.Apply {
+		content, err := ApplyHealthCheck(project.Content, name, suggestion.HealthCheck)
+		if err != nil {
+			respondServiceError(w, r, apierror.Wrap(http.StatusUnprocessableEntity, "COMPOSE_INVALID", err))
+			return
+		}
+		message := req.Message
+		if message == "" {
+			message = "add " + suggestion.Kind + " healthcheck to " + name
+		}
+		result, err := h.composeService.SaveProjectContent(r.Context(), project.ID, content, getAuthor(r), message)
+		if err != nil {
+			respondServiceError(w, r, err)
+			return
+		}
+		if !result.Valid {
+			respondServiceError(w, r, errComposeInvalid.WithDetails(result))
+			return
+		}
+		response["result"] = result
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// ApplyLogRotation 为服务写入 json-file 日志轮转配置并生成新修订，max_size/max_file 缺省时使用 DefaultLogRotation
+// truncate 为 true 时在写入后为服务的容器保存日志快照并清空当前日志，必须同时以 confirm 传入服务名称确认
+func (h *APIHandler) ApplyLogRotation(w http.ResponseWriter, r *http.Request) {
+	if h.logRotation == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Log rotation is not configured")
+		return
+	}
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MaxSize  string `json:"max_size"`
+		MaxFile  int    `json:"max_file"`
+		Message  string `json:"message"`
+		Truncate bool   `json:"truncate"`
+		Confirm  string `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	// 先检查确认，避免写入修订后才发现无法清空
+	if req.Truncate && req.Confirm != name {
+		respondServiceError(w, r, fmt.Errorf("%w: set confirm to %q", ErrTruncateNotConfirmed, name))
+		return
+	}
+	rotation := DefaultLogRotation
+	if req.MaxSize != "" {
+		rotation.MaxSize = req.MaxSize
+	}
+	if req.MaxFile != 0 {
+		rotation.MaxFile = req.MaxFile
+	}
+
+	result, err := h.logRotation.Apply(r.Context(), project, name, rotation, getAuthor(r), req.Message)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	if !result.Valid {
+		respondServiceError(w, r, errComposeInvalid.WithDetails(result))
+		return
+	}
+
+	response := map[string]interface{}{
+		"result":  result,
+		"snippet": rotation.Snippet(),
+	}
+	if req.Truncate {
+		snapshots, err := h.logRotation.Truncate(r.Context(), project, name)
+		if err != nil {
+			respondServiceError(w, r, err)
+			return
+		}
+		response["snapshots"] = snapshots
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// ListPendingApprovals 列出等待审批的部署
+func (h *APIHandler) ListPendingApprovals(w http.ResponseWriter, r *http.Request) {
+	deployments, err := h.composeService.ListPendingApprovals(r.Context())
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"deployments": deployments,
+		"total":       len(deployments),
+	})
+}
+
+// ApproveDeployment 审批通过部署，需要 deployments:approve 权限
+// 默认不允许发起人审批自己的部署（deployment_approval.allow_self_approval）
+func (h *APIHandler) ApproveDeployment(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorizeApproval(w, r)
+	if !ok {
+		return
+	}
+
+	deployment, err := h.composeService.ApproveDeployment(r.Context(), id, getAuthor(r))
+	if err != nil {
+		respondDeploymentError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, deployment)
+}
+
+// RejectDeployment 拒绝部署，需要 deployments:approve 权限，请求体需包含 reason
+func (h *APIHandler) RejectDeployment(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorizeApproval(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+
+	deployment, err := h.composeService.RejectDeployment(r.Context(), id, getAuthor(r), req.Reason)
+	if err != nil {
+		respondDeploymentError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, deployment)
+}
+
+// authorizeApproval 校验审批权限并解析部署 ID
+func (h *APIHandler) authorizeApproval(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	if h.permissionChecker == nil || !h.permissionChecker(r, PermissionDeploymentsApprove) {
+		respondError(w, r, http.StatusForbidden, "Permission denied: "+PermissionDeploymentsApprove)
+		return 0, false
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid deployment ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ListUnmanagedContainers 列出运行中且不属于任何 Compose 项目的容器
+func (h *APIHandler) ListUnmanagedContainers(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdoption(w, r) {
+		return
+	}
+	containers, err := h.adoptionService.ListUnmanaged(r.Context())
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"containers": containers,
+		"total":      len(containers),
+	})
+}
+
+// AdoptContainer 将容器纳管为单服务 Compose 项目
+// 无法用 compose 表达的配置不会拒绝纳管，而是在 warnings 中列出
+func (h *APIHandler) AdoptContainer(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdoption(w, r) {
+		return
+	}
+	result, err := h.adoptionService.Adopt(r.Context(), mux.Vars(r)["id"], getAuthor(r))
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, result)
+}
+
+// CheckDrift 检查纳管项目的容器配置是否偏离 compose 定义
+func (h *APIHandler) CheckDrift(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdoption(w, r) {
+		return
+	}
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+	report, err := h.adoptionService.CheckDrift(r.Context(), project.ID)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+func (h *APIHandler) requireAdoption(w http.ResponseWriter, r *http.Request) bool {
+	if h.adoptionService == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Container adoption is not configured")
+		return false
+	}
+	return true
+}
+
+// GetOptimizations 返回项目的优化建议，AI 可用时附带 source=ai 的补充建议，?ai=false 只返回规则建议
+func (h *APIHandler) GetOptimizations(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if r.URL.Query().Get("ai") == "false" {
+		ctx = WithoutAISuggestions(ctx)
+	}
+	suggestions, err := h.composeService.GetOptimizationSuggestions(ctx, project.ID)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"project":     project.Name,
+		"suggestions": suggestions,
+		"total":       len(suggestions),
+	})
+}
+
+// GetAnalysisHistory 返回项目定时分析的健康评分、问题数和性能评分序列，按时间升序，?limit= 限制条数
+func (h *APIHandler) GetAnalysisHistory(w http.ResponseWriter, r *http.Request) {
+	if h.analysisHistory == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Compose analysis history is not configured")
+		return
+	}
+	project, ok := h.resolveProject(w, r)
+	if !ok {
+		return
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondError(w, r, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := h.analysisHistory.History(r.Context(), project.ID, limit)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"project": project.Name,
+		"runs":    runs,
+		"total":   len(runs),
+	})
+}
+
+// ListPipelines 列出流水线，?project= 按项目（ID 或名称）过滤
+func (h *APIHandler) ListPipelines(w http.ResponseWriter, r *http.Request) {
+	if !h.requirePipelines(w, r) {
+		return
+	}
+	var projectID uint
+	if key := r.URL.Query().Get("project"); key != "" {
+		project, ok := h.lookupProject(w, r, key)
+		if !ok {
+			return
+		}
+		projectID = project.ID
+	}
+	pipelines, err := h.pipelineService.ListPipelines(r.Context(), projectID)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pipelines": pipelines,
+		"total":     len(pipelines),
+	})
+}
+
+// CreatePipeline 创建流水线，请求体 {"project": "shop", "name": "release", "definition": "<YAML>"}
+// 定义无效（包括被命令执行策略拒绝的 shell 命令）返回 422
+func (h *APIHandler) CreatePipeline(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizePipelines(w, r) {
+		return
+	}
+	var req struct {
+		Project    string `json:"project"`
+		Name       string `json:"name"`
+		Definition string `json:"definition"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+	project, ok := h.lookupProject(w, r, req.Project)
+	if !ok {
+		return
+	}
+	pipeline := &Pipeline{ProjectID: project.ID, Name: req.Name, Definition: req.Definition, CreatedBy: getAuthor(r)}
+	if err := h.pipelineService.CreatePipeline(r.Context(), pipeline); err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, pipeline)
+}
+
+// GetPipeline 获取流水线定义
+func (h *APIHandler) GetPipeline(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pipelineID(w, r)
+	if !ok {
+		return
+	}
+	pipeline, err := h.pipelineService.GetPipeline(r.Context(), id)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, pipeline)
+}
+
+// UpdatePipeline 替换流水线定义，请求体 {"definition": "<YAML>"}
+func (h *APIHandler) UpdatePipeline(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizePipelines(w, r) {
+		return
+	}
+	id, ok := h.pipelineID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Definition string `json:"definition"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondServiceError(w, r, errInvalidBody)
+		return
+	}
+	pipeline, err := h.pipelineService.UpdatePipeline(r.Context(), id, req.Definition, getAuthor(r))
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, pipeline)
+}
+
+// DeletePipeline 删除流水线
+func (h *APIHandler) DeletePipeline(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizePipelines(w, r) {
+		return
+	}
+	id, ok := h.pipelineID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.pipelineService.DeletePipeline(r.Context(), id, getAuthor(r)); err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunPipeline 开始运行流水线，返回 202 和运行记录，进度通过 /ws/deployments/{run_id}/events 推送
+func (h *APIHandler) RunPipeline(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizePipelines(w, r) {
+		return
+	}
+	id, ok := h.pipelineID(w, r)
+	if !ok {
+		return
+	}
+	run, err := h.pipelineService.Run(WithRequester(r.Context(), getAuthor(r)), id)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, run)
+}
+
+// ListPipelineRuns 列出流水线的运行记录
+func (h *APIHandler) ListPipelineRuns(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pipelineID(w, r)
+	if !ok {
+		return
+	}
+	runs, err := h.pipelineService.ListRuns(r.Context(), id)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"runs":  runs,
+		"total": len(runs),
+	})
+}
+
+// StreamDeploymentEvents 通过 WebSocket 推送部署或流水线运行的事件和状态变化，结束后关闭连接
+func (h *APIHandler) StreamDeploymentEvents(w http.ResponseWriter, r *http.Request) {
+	if !h.requirePipelines(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+	if _, err := h.pipelineService.GetRun(r.Context(), uint(id)); err != nil {
+		respondDeploymentError(w, r, err)
+		return
+	}
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// 客户端断开时停止推送
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	h.pipelineService.Stream(ctx, uint(id), func(frame DeploymentStreamFrame) error {
+		return conn.WriteJSON(frame)
+	})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func (h *APIHandler) requirePipelines(w http.ResponseWriter, r *http.Request) bool {
+	if h.pipelineService == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Deployment pipelines are not configured")
+		return false
+	}
+	return true
+}
+
+// authorizePipelines 校验流水线服务已配置且请求用户拥有 pipelines:manage 权限
+func (h *APIHandler) authorizePipelines(w http.ResponseWriter, r *http.Request) bool {
+	if !h.requirePipelines(w, r) {
+		return false
+	}
+	if h.permissionChecker == nil || !h.permissionChecker(r, PermissionPipelinesManage) {
+		respondError(w, r, http.StatusForbidden, "Permission denied: "+PermissionPipelinesManage)
+		return false
+	}
+	return true
+}
+
+// pipelineID 解析路径中的流水线 ID
+func (h *APIHandler) pipelineID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	if !h.requirePipelines(w, r) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid pipeline ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// resolveProject 根据路径中的项目 ID 或名称查找项目
+func (h *APIHandler) resolveProject(w http.ResponseWriter, r *http.Request) (*ComposeProject, bool) {
+	return h.lookupProject(w, r, mux.Vars(r)["project"])
+}
+
+// lookupProject 根据项目 ID 或名称查找项目，找不到时写入错误响应
+func (h *APIHandler) lookupProject(w http.ResponseWriter, r *http.Request, key string) (*ComposeProject, bool) {
+	var project *ComposeProject
+	var err error
+	if id, parseErr := strconv.ParseUint(key, 10, 32); parseErr == nil {
+		project, err = h.composeService.GetProject(r.Context(), uint(id))
+	} else {
+		project, err = h.composeService.GetProjectByName(r.Context(), key, getTenantID(r))
+	}
+	if err != nil {
+		respondServiceError(w, r, err)
+		return nil, false
+	}
+	return project, true
+}
+
+// respondJSON 返回 JSON 响应
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// respondError 返回指定状态码的错误响应，错误码按状态码选择
+func respondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	apierror.Respond(w, r, status, message)
+}
+
+// respondServiceError 按 containerErrors 返回统一的错误响应，未知错误只返回请求 ID
+func respondServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err, containerErrors...)
+}
+
+// respondDeploymentError 部署记录不存在时返回 DEPLOYMENT_NOT_FOUND，其余错误同 respondServiceError
+func respondDeploymentError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errDeploymentNotFound
+	}
+	respondServiceError(w, r, err)
+}
+
+// getAuthor 获取修订作者，优先使用登录令牌或 Basic Auth 的用户名
+func getAuthor(r *http.Request) string {
+	if claims := session.FromContext(r.Context()); claims != nil {
+		return claims.Subject
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return "unknown"
+}
+
+// getTenantID 获取当前租户 ID
+// TODO: 从认证上下文中获取租户ID
+func getTenantID(r *http.Request) uint {
+	return 1
+}
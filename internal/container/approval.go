@@ -0,0 +1,258 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+)
+
+var (
+	// ErrNotPendingApproval 部署不处于等待审批状态
+	ErrNotPendingApproval = errors.New("deployment is not pending approval")
+	// ErrSelfApproval 发起人不能审批自己的部署
+	ErrSelfApproval = errors.New("requester cannot approve their own deployment")
+	// ErrApprovalExpired 审批已过期
+	ErrApprovalExpired = errors.New("deployment approval has expired")
+	// ErrRejectReasonRequired 拒绝部署时必须填写原因
+	ErrRejectReasonRequired = errors.New("reject reason is required")
+)
+
+// DefaultApprovalExpiry 待审批部署的默认过期时间
+const DefaultApprovalExpiry = 24 * time.Hour
+
+// PermissionDeploymentsApprove 审批部署所需的权限
+const PermissionDeploymentsApprove = "deployments:approve"
+
+type requesterKey struct{}
+
+// WithRequester 在上下文中记录发起操作的用户，Deploy 据此记录部署发起人
+func WithRequester(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, requesterKey{}, user)
+}
+
+// RequesterFromContext 获取上下文中记录的发起人，未记录时返回空字符串
+func RequesterFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(requesterKey{}).(string)
+	return user
+}
+
+// requiresApproval 项目带有生产环境标签、项目或本次部署配置要求审批时，部署需要人工审批
+func requiresApproval(project *ComposeProject, deployConfig *DeploymentConfig) bool {
+	return project.RequireApproval || project.Environment == EnvironmentProduction ||
+		(deployConfig != nil && deployConfig.RequireApproval)
+}
+
+// approvalExpiry 待审批部署的过期时间
+func approvalExpiry() time.Duration {
+	if hours := config.Current().DeploymentApproval.ExpiryHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return DefaultApprovalExpiry
+}
+
+// requestApproval 记录审批请求事件，按配置推送通知
+func (s *deploymentServiceImpl) requestApproval(ctx context.Context, deployment *Deployment, project *ComposeProject) {
+	s.recordEvent(ctx, deployment.ID, "approval_requested", "",
+		fmt.Sprintf("项目 %s 的部署等待审批，发起人: %s", project.Name, deployment.RequestedBy), "")
+	logger.Info("[AUDIT] 🛂 部署等待审批: #%d 项目 %s by %s", deployment.ID, project.Name, deployment.RequestedBy)
+
+	if config.Current().DeploymentApproval.Notify {
+		notify.SendEvent(notify.Event{
+			Severity: notify.SeverityInfo,
+			Category: "deployment",
+			Target:   project.Name,
+			Title:    "部署等待审批",
+			Content: fmt.Sprintf("🛂 **部署等待审批**\n\n项目: %s\n部署: #%d\n发起人: %s\n过期时间: %s",
+				project.Name, deployment.ID, deployment.RequestedBy, deployment.ApprovalExpiresAt.Format("2006-01-02 15:04:05")),
+		})
+	}
+}
+
+// loadPendingApproval 获取等待审批的部署，已过期的部署会被标记为过期
+func (s *deploymentServiceImpl) loadPendingApproval(ctx context.Context, deploymentID uint) (*Deployment, error) {
+	deployment, err := s.GetDeployment(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if deployment.Status != DeploymentStatusPendingApproval {
+		return nil, fmt.Errorf("%w: status is %s", ErrNotPendingApproval, deployment.Status)
+	}
+	if deployment.ApprovalExpiresAt != nil && time.Now().After(*deployment.ApprovalExpiresAt) {
+		s.expirePendingApprovals(ctx, time.Now())
+		return nil, ErrApprovalExpired
+	}
+	return deployment, nil
+}
+
+// ApproveDeployment 审批通过部署，状态转为等待中并开始执行
+func (s *deploymentServiceImpl) ApproveDeployment(ctx context.Context, deploymentID uint, approver string) (*Deployment, error) {
+	deployment, err := s.loadPendingApproval(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Current().DeploymentApproval.AllowSelfApproval && deployment.RequestedBy != "" && deployment.RequestedBy == approver {
+		return nil, ErrSelfApproval
+	}
+
+	if deployment.Strategy == DeployStrategyPipeline {
+		return s.approvePipelineStep(ctx, deployment, approver)
+	}
+
+	var deployConfig DeploymentConfig
+	if err := json.Unmarshal([]byte(deployment.Config), &deployConfig); err != nil {
+		return nil, fmt.Errorf("failed to decode deployment config: %w", err)
+	}
+	project, err := s.composeService.GetProject(ctx, deployment.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	// 部署发起时记录的修订即为审批的内容，避免审批期间的修改未经审批就上线
+	if deployment.RevisionID != nil {
+		var revision ComposeRevision
+		if err := s.db.WithContext(ctx).First(&revision, *deployment.RevisionID).Error; err == nil {
+			project.Content = revision.Content
+		}
+	}
+	composeConfig, err := s.composeService.ParseComposeFile(ctx, project.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	// 审批期间端口可能已被占用，冲突时记录保持等待审批，释放端口后可再次审批
+	if err := s.auditPorts(ctx, project, composeConfig); err != nil {
+		return nil, err
+	}
+
+	// 只有仍处于等待审批状态的记录才会被更新，避免并发审批重复执行部署
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&Deployment{}).
+		Where("id = ? AND status = ?", deploymentID, DeploymentStatusPendingApproval).
+		Updates(map[string]interface{}{
+			"status":      DeploymentStatusPending,
+			"approved_by": approver,
+			"approved_at": &now,
+			"started_at":  &now,
+			"message":     "审批通过，等待执行",
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to approve deployment: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotPendingApproval
+	}
+
+	s.recordEvent(ctx, deploymentID, "deployment_approved", "", fmt.Sprintf("部署已由 %s 审批通过", approver), "")
+	logger.Info("[AUDIT] ✅ 部署审批通过: #%d 项目 %s by %s", deploymentID, project.Name, approver)
+
+	deployment, err = s.GetDeployment(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, deploymentID, "deployment_started", "",
+		fmt.Sprintf("开始部署项目 %s，策略: %s", project.Name, deployConfig.Strategy), "")
+	go s.executeDeployment(context.Background(), deployment, project, composeConfig, &deployConfig)
+	return deployment, nil
+}
+
+// approvePipelineStep 审批通过流水线运行中等待审批的步骤，状态转为进行中，由流水线继续执行后续步骤
+func (s *deploymentServiceImpl) approvePipelineStep(ctx context.Context, run *Deployment, approver string) (*Deployment, error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&Deployment{}).
+		Where("id = ? AND status = ?", run.ID, DeploymentStatusPendingApproval).
+		Updates(map[string]interface{}{
+			"status":      DeploymentStatusInProgress,
+			"approved_by": approver,
+			"approved_at": &now,
+			"message":     "审批通过，继续执行流水线",
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to approve pipeline step: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotPendingApproval
+	}
+
+	s.recordEvent(ctx, run.ID, "deployment_approved", "", fmt.Sprintf("流水线步骤已由 %s 审批通过", approver), "")
+	logger.Info("[AUDIT] ✅ 流水线步骤审批通过: #%d by %s", run.ID, approver)
+	return s.GetDeployment(ctx, run.ID)
+}
+
+// RejectDeployment 拒绝部署，原因记录在部署记录上
+func (s *deploymentServiceImpl) RejectDeployment(ctx context.Context, deploymentID uint, approver, reason string) (*Deployment, error) {
+	if reason == "" {
+		return nil, ErrRejectReasonRequired
+	}
+	if _, err := s.loadPendingApproval(ctx, deploymentID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&Deployment{}).
+		Where("id = ? AND status = ?", deploymentID, DeploymentStatusPendingApproval).
+		Updates(map[string]interface{}{
+			"status":        DeploymentStatusRejected,
+			"approved_by":   approver,
+			"approved_at":   &now,
+			"completed_at":  &now,
+			"reject_reason": reason,
+			"message":       "部署审批被拒绝",
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to reject deployment: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotPendingApproval
+	}
+
+	s.recordEvent(ctx, deploymentID, "deployment_rejected", "", fmt.Sprintf("部署已被 %s 拒绝: %s", approver, reason), "")
+	logger.Info("[AUDIT] ⛔ 部署审批被拒绝: #%d by %s, 原因: %s", deploymentID, approver, reason)
+	return s.GetDeployment(ctx, deploymentID)
+}
+
+// ListPendingApprovals 列出等待审批的部署，先将已过期的部署标记为过期
+func (s *deploymentServiceImpl) ListPendingApprovals(ctx context.Context) ([]*Deployment, error) {
+	s.expirePendingApprovals(ctx, time.Now())
+
+	var deployments []*Deployment
+	if err := s.db.WithContext(ctx).Preload("Project").
+		Where("status = ?", DeploymentStatusPendingApproval).
+		Order("created_at ASC").
+		Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pending approvals: %w", err)
+	}
+	return deployments, nil
+}
+
+// expirePendingApprovals 将超过审批期限的部署标记为过期
+func (s *deploymentServiceImpl) expirePendingApprovals(ctx context.Context, now time.Time) {
+	var expired []*Deployment
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND approval_expires_at < ?", DeploymentStatusPendingApproval, now).
+		Find(&expired).Error; err != nil {
+		return
+	}
+	for _, deployment := range expired {
+		s.expireApproval(ctx, deployment.ID, now)
+	}
+}
+
+// expireApproval 将仍在等待审批的部署标记为过期
+func (s *deploymentServiceImpl) expireApproval(ctx context.Context, deploymentID uint, now time.Time) {
+	result := s.db.WithContext(ctx).Model(&Deployment{}).
+		Where("id = ? AND status = ?", deploymentID, DeploymentStatusPendingApproval).
+		Updates(map[string]interface{}{
+			"status":       DeploymentStatusExpired,
+			"completed_at": &now,
+			"message":      "审批已过期",
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	s.recordEvent(ctx, deploymentID, "approval_expired", "", "部署审批已过期，部署未执行", "")
+	logger.Info("[AUDIT] ⌛ 部署审批已过期: #%d", deploymentID)
+}
@@ -0,0 +1,239 @@
+package container
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qwq/internal/apierror"
+	"qwq/internal/pagination"
+
+	"github.com/gorilla/mux"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// countingExecutor 记录 StartProject 调用次数，用于确认审批前没有触碰容器
+type countingExecutor struct {
+	*mockDockerExecutor
+	starts int32
+}
+
+func (e *countingExecutor) StartProject(ctx context.Context, projectName, composeContent string) error {
+	atomic.AddInt32(&e.starts, 1)
+	return nil
+}
+
+func setupApprovalTest(t *testing.T) (*deploymentServiceImpl, *countingExecutor, *gorm.DB, *ComposeProject) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}, &Deployment{}, &DeploymentEvent{}, &ServiceInstance{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	composeService := NewComposeService(db)
+	project := &ComposeProject{Name: "shop", Content: revisionTestContent, TenantID: 1, Environment: EnvironmentProduction}
+	if err := composeService.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	executor := &countingExecutor{mockDockerExecutor: newMockDockerExecutor()}
+	service := NewDeploymentService(db, composeService, executor).(*deploymentServiceImpl)
+	service.composeFiles = nil
+	service.ports = nil
+	return service, executor, db, project
+}
+
+func requestDeployment(t *testing.T, service *deploymentServiceImpl, projectID uint) *Deployment {
+	ctx := WithRequester(context.Background(), "alice")
+	deployment, err := service.Deploy(ctx, projectID, &DeploymentConfig{Strategy: DeployStrategyRecreate, HealthCheckRetries: 1})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	return deployment
+}
+
+func eventTypes(t *testing.T, service *deploymentServiceImpl, deploymentID uint) map[string]bool {
+	events, err := service.GetDeploymentEvents(context.Background(), deploymentID)
+	if err != nil {
+		t.Fatalf("GetDeploymentEvents: %v", err)
+	}
+	types := make(map[string]bool)
+	for _, event := range events {
+		types[event.EventType] = true
+	}
+	return types
+}
+
+func TestDeploymentApproval_Approve(t *testing.T) {
+	service, executor, _, project := setupApprovalTest(t)
+	ctx := context.Background()
+
+	deployment := requestDeployment(t, service, project.ID)
+	if deployment.Status != DeploymentStatusPendingApproval || deployment.RequestedBy != "alice" {
+		t.Fatalf("Expected pending approval requested by alice, got %s by %q", deployment.Status, deployment.RequestedBy)
+	}
+	if atomic.LoadInt32(&executor.starts) != 0 {
+		t.Fatal("Containers must not be touched before approval")
+	}
+
+	if _, err := service.ApproveDeployment(ctx, deployment.ID, "alice"); !errors.Is(err, ErrSelfApproval) {
+		t.Fatalf("Expected ErrSelfApproval, got %v", err)
+	}
+
+	approved, err := service.ApproveDeployment(ctx, deployment.ID, "bob")
+	if err != nil {
+		t.Fatalf("ApproveDeployment: %v", err)
+	}
+	if approved.ApprovedBy != "bob" || approved.ApprovedAt == nil {
+		t.Errorf("Expected approval by bob to be recorded, got %+v", approved)
+	}
+	if _, err := service.ApproveDeployment(ctx, deployment.ID, "carol"); !errors.Is(err, ErrNotPendingApproval) {
+		t.Errorf("Second approval must fail with ErrNotPendingApproval, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, err := service.GetDeployment(ctx, deployment.ID)
+		if err != nil {
+			t.Fatalf("GetDeployment: %v", err)
+		}
+		if current.Status == DeploymentStatusCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Deployment did not complete after approval, status %s: %s", current.Status, current.Message)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&executor.starts) != 1 {
+		t.Errorf("Expected the project to be started once, got %d", executor.starts)
+	}
+	if types := eventTypes(t, service, deployment.ID); !types["approval_requested"] || !types["deployment_approved"] {
+		t.Errorf("Missing approval events: %v", types)
+	}
+}
+
+func TestDeploymentApproval_RejectAndExpire(t *testing.T) {
+	service, executor, db, project := setupApprovalTest(t)
+	ctx := context.Background()
+
+	rejected := requestDeployment(t, service, project.ID)
+	if _, err := service.RejectDeployment(ctx, rejected.ID, "bob", ""); !errors.Is(err, ErrRejectReasonRequired) {
+		t.Fatalf("Expected ErrRejectReasonRequired, got %v", err)
+	}
+	result, err := service.RejectDeployment(ctx, rejected.ID, "bob", "release freeze")
+	if err != nil {
+		t.Fatalf("RejectDeployment: %v", err)
+	}
+	if result.Status != DeploymentStatusRejected || result.RejectReason != "release freeze" {
+		t.Errorf("Expected rejected with reason, got %s %q", result.Status, result.RejectReason)
+	}
+
+	expired := requestDeployment(t, service, project.ID)
+	past := time.Now().Add(-time.Minute)
+	db.Model(&Deployment{}).Where("id = ?", expired.ID).Update("approval_expires_at", &past)
+
+	pending, err := service.ListPendingApprovals(ctx)
+	if err != nil {
+		t.Fatalf("ListPendingApprovals: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending approvals, got %d", len(pending))
+	}
+	if _, err := service.ApproveDeployment(ctx, expired.ID, "bob"); !errors.Is(err, ErrNotPendingApproval) {
+		t.Errorf("Expired deployment must not be approvable, got %v", err)
+	}
+	current, _ := service.GetDeployment(ctx, expired.ID)
+	if current.Status != DeploymentStatusExpired || !eventTypes(t, service, expired.ID)["approval_expired"] {
+		t.Errorf("Expected expired status and event, got %s", current.Status)
+	}
+	if atomic.LoadInt32(&executor.starts) != 0 {
+		t.Error("Rejected or expired deployments must not touch containers")
+	}
+}
+
+func TestApprovalAPI_RequiresPermission(t *testing.T) {
+	handler := &APIHandler{composeService: NewComposeService(nil)}
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/deployments/1/approve", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without permission checker, got %d", rec.Code)
+	}
+
+	handler.SetPermissionChecker(func(r *http.Request, permission string) bool { return false })
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/deployments/1/reject", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when permission is denied, got %d", rec.Code)
+	}
+}
+
+func TestAPIHandler_ListDeployments(t *testing.T) {
+	_, _, db, project := setupApprovalTest(t)
+	other := &ComposeProject{Name: "blog", Content: revisionTestContent, TenantID: 1}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		status := DeploymentStatusCompleted
+		if i == 2 {
+			status = DeploymentStatusFailed
+		}
+		db.Create(&Deployment{ProjectID: project.ID, Version: fmt.Sprintf("v%d", i), Strategy: DeployStrategyRecreate, Status: status})
+	}
+	db.Create(&Deployment{ProjectID: other.ID, Version: "v1", Strategy: DeployStrategyRecreate, Status: DeploymentStatusCompleted})
+
+	router := mux.NewRouter()
+	NewAPIHandler(db).RegisterRoutes(router)
+	get := func(query string) (*httptest.ResponseRecorder, pagination.Page[*Deployment]) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/compose/%d/deployments%s", project.ID, query), nil))
+		var page pagination.Page[*Deployment]
+		json.Unmarshal(rec.Body.Bytes(), &page)
+		return rec, page
+	}
+
+	rec, page := get("")
+	if rec.Code != http.StatusOK || page.Total != 5 || len(page.Items) != 5 || page.Page != 1 || page.PageSize != pagination.DefaultPageSize {
+		t.Fatalf("Expected the project's deployments on the first page, got %d %+v", rec.Code, page)
+	}
+	if page.Items[0].Version != "v5" {
+		t.Errorf("Expected the newest deployment first, got %s", page.Items[0].Version)
+	}
+	if _, page = get("?page=3&pageSize=2&sort=id"); len(page.Items) != 1 || page.Items[0].Version != "v5" {
+		t.Errorf("Expected the last partial page, got %+v", page)
+	}
+	if _, page = get("?page=4&pageSize=2"); page.Total != 5 || page.Items == nil || len(page.Items) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v", page)
+	}
+	if _, page = get("?status=failed"); page.Total != 1 || page.Items[0].Version != "v2" {
+		t.Errorf("Expected the failed deployment, got %+v", page)
+	}
+
+	for query, code := range map[string]string{"?page=-1": pagination.CodeInvalidPagination, "?sort=config": pagination.CodeInvalidSort} {
+		rec, _ := get(query)
+		var envelope apierror.Envelope
+		json.Unmarshal(rec.Body.Bytes(), &envelope)
+		if rec.Code != http.StatusBadRequest || envelope.Code != code {
+			t.Errorf("%s: expected %s, got %d %+v", query, code, rec.Code, envelope)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"qwq/internal/backup"
+)
+
+// composeBackupStore 通过 ComposeService 导出和写回配置备份中的 Compose 项目
+type composeBackupStore struct {
+	service ComposeService
+}
+
+// ComposeBackupStore 配置备份使用的 Compose 项目来源，写回已有项目时会记录一个修订，可以从修订历史回滚
+func ComposeBackupStore(service ComposeService) backup.ComposeStore {
+	return &composeBackupStore{service: service}
+}
+
+// ExportProjects 导出所有租户的项目
+func (s *composeBackupStore) ExportProjects(ctx context.Context) ([]backup.ComposeProjectFile, error) {
+	projects, err := s.service.ListProjects(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]backup.ComposeProjectFile, 0, len(projects))
+	for _, project := range projects {
+		files = append(files, backup.ComposeProjectFile{
+			Name:        project.Name,
+			DisplayName: project.DisplayName,
+			Description: project.Description,
+			Environment: project.Environment,
+			UserID:      project.UserID,
+			TenantID:    project.TenantID,
+			Content:     project.Content,
+		})
+	}
+	return files, nil
+}
+
+// ImportProject 写回项目内容，项目已被删除时重新创建（状态为草稿，不会自动部署）
+func (s *composeBackupStore) ImportProject(ctx context.Context, file backup.ComposeProjectFile) error {
+	project, err := s.service.GetProjectByName(ctx, file.Name, file.TenantID)
+	if errors.Is(err, ErrProjectNotFound) {
+		return s.service.CreateProject(ctx, &ComposeProject{
+			Name:        file.Name,
+			DisplayName: file.DisplayName,
+			Description: file.Description,
+			Environment: file.Environment,
+			UserID:      file.UserID,
+			TenantID:    file.TenantID,
+			Content:     file.Content,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if project.Content == file.Content {
+		return nil
+	}
+
+	result, err := s.service.SaveProjectContent(ctx, project.ID, file.Content, "backup-restore", "恢复配置备份")
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidComposeFile, strings.Join(messages, "; "))
+	}
+	return nil
+}
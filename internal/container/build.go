@@ -0,0 +1,568 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/utils"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNoBuildServices 项目中没有需要构建的服务
+	ErrNoBuildServices = errors.New("no services with a build context")
+	// ErrBuildContextNotAllowed 本地构建上下文不在允许的目录中
+	ErrBuildContextNotAllowed = errors.New("build context is not in an allowed directory")
+	// ErrBuildFailed 镜像构建失败，正在运行的版本不受影响
+	ErrBuildFailed = errors.New("image build failed")
+)
+
+// DeployStrategyBuild 单独构建镜像的运行记录，与流水线运行一样是一条部署记录，构建日志以部署事件记录
+const DeployStrategyBuild DeployStrategy = "build"
+
+const (
+	defaultBuildWorkspace = "data/build"
+	defaultBuildCacheGB   = 20
+	// 构建日志按块写入部署事件，避免每行一条记录
+	buildLogChunkLines    = 50
+	buildLogChunkInterval = 2 * time.Second
+	buildLogMaxLine       = 1000
+)
+
+// UnmarshalYAML 支持 build 的简写形式，如 build: ./app
+func (b *BuildConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		b.Context = value.Value
+		return nil
+	}
+	type plain BuildConfig
+	return value.Decode((*plain)(b))
+}
+
+// ImageBuildRequest 构建一个镜像的参数
+type ImageBuildRequest struct {
+	ContextDir string            // 构建上下文目录
+	Dockerfile string            // 相对构建上下文的 Dockerfile，为空时使用 Dockerfile
+	Args       map[string]string // 构建参数
+	Target     string            // 多阶段构建的目标阶段
+	Tags       []string          // 镜像标签
+	Labels     map[string]string // 镜像标签（label）
+}
+
+// ImageBuilder 镜像构建后端
+// 构建缓存由后端自行保留，多次部署之间复用
+type ImageBuilder interface {
+	// BuildImage 构建镜像，构建输出逐行回调 log
+	BuildImage(ctx context.Context, req *ImageBuildRequest, log func(line string)) error
+	// BuildCacheUsage 构建缓存占用的字节数
+	BuildCacheUsage(ctx context.Context) (int64, error)
+	// PruneBuildCache 清理构建缓存直到不超过 keep 字节，返回释放的字节数
+	PruneBuildCache(ctx context.Context, keep int64) (int64, error)
+}
+
+// ServiceBuild 一个服务的构建结果
+type ServiceBuild struct {
+	Service  string `json:"service"`
+	Image    string `json:"image"`
+	Source   string `json:"source"` // 本地目录，或 git 仓库地址@提交
+	Duration string `json:"duration"`
+}
+
+// BuildService 构建 compose 服务的镜像（build 字段）
+// 本地上下文必须位于 image_build.allowed_dirs 之内；git 上下文克隆到工作目录，多次构建之间保留
+type BuildService struct {
+	db             *gorm.DB
+	composeService ComposeService
+
+	builderOnce sync.Once
+	builder     ImageBuilder
+	// git 执行 git 命令，测试时替换
+	git func(ctx context.Context, dir string, args ...string) (string, error)
+}
+
+// buildLocks 同一项目的构建串行执行，git 工作目录不能被并发检出
+var buildLocks sync.Map
+
+// NewBuildService 创建构建服务，builder 为 nil 时首次构建时按配置创建
+func NewBuildService(db *gorm.DB, composeService ComposeService, builder ImageBuilder) *BuildService {
+	return &BuildService{db: db, composeService: composeService, builder: builder, git: runGit}
+}
+
+func (b *BuildService) imageBuilder() ImageBuilder {
+	b.builderOnce.Do(func() {
+		if b.builder == nil {
+			b.builder = NewImageBuilder()
+		}
+	})
+	return b.builder
+}
+
+// Build 单独构建项目的镜像，services 为空时构建所有带 build 的服务
+// 返回策略为 build 的运行记录，构建在后台执行，日志通过 /ws/deployments/{id}/events 推送
+func (b *BuildService) Build(ctx context.Context, projectID uint, services []string) (*Deployment, error) {
+	project, err := b.composeService.GetProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	composeConfig, err := b.composeService.ParseComposeFile(ctx, project.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidComposeFile, err)
+	}
+	names, err := buildableServices(composeConfig, services)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	run := &Deployment{
+		ProjectID:   project.ID,
+		Version:     fmt.Sprintf("build-%d", now.Unix()),
+		Strategy:    DeployStrategyBuild,
+		Status:      DeploymentStatusInProgress,
+		StartedAt:   &now,
+		Message:     fmt.Sprintf("构建 %d 个服务的镜像", len(names)),
+		RequestedBy: RequesterFromContext(ctx),
+		UserID:      project.UserID,
+		TenantID:    project.TenantID,
+	}
+	if revision, err := b.composeService.GetLatestRevision(ctx, project.ID); err == nil && revision != nil {
+		run.RevisionID = &revision.ID
+	}
+	if err := b.db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create build record: %w", err)
+	}
+	logger.Info("[AUDIT] 🔨 开始构建项目 %s 的镜像 (%s) #%d by %s", project.Name, strings.Join(names, ", "), run.ID, run.RequestedBy)
+
+	go b.runBuild(context.Background(), run, project, composeConfig.Services, names)
+	return run, nil
+}
+
+// runBuild 执行单独的构建并更新运行记录
+func (b *BuildService) runBuild(ctx context.Context, run *Deployment, project *ComposeProject, services map[string]*Service, names []string) {
+	builds, err := func() (builds []ServiceBuild, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				utils.RecordPanic("image-build", r, debug.Stack())
+				err = fmt.Errorf("build panicked: %v", r)
+			}
+		}()
+		return b.BuildServices(ctx, run, project, services, names)
+	}()
+
+	now := time.Now()
+	updates := map[string]interface{}{"progress": 100, "completed_at": &now}
+	if err != nil {
+		updates["status"] = DeploymentStatusFailed
+		updates["message"] = fmt.Sprintf("镜像构建失败: %v", err)
+	} else {
+		updates["status"] = DeploymentStatusCompleted
+		updates["message"] = fmt.Sprintf("已构建 %d 个镜像", len(builds))
+		updates["images"] = encodeBuiltImages(builds)
+	}
+	b.db.WithContext(ctx).Model(&Deployment{}).Where("id = ?", run.ID).Updates(updates)
+}
+
+// BuildServices 依次构建服务的镜像，镜像以部署版本为标签
+// 任一服务构建失败时立即返回，此时尚未改动任何容器，正在运行的版本不受影响
+func (b *BuildService) BuildServices(ctx context.Context, deployment *Deployment, project *ComposeProject,
+	services map[string]*Service, names []string) ([]ServiceBuild, error) {
+
+	lock, _ := buildLocks.LoadOrStore(project.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	builder := b.imageBuilder()
+	builds := make([]ServiceBuild, 0, len(names))
+	for _, name := range names {
+		service := services[name]
+		if service == nil || service.Build == nil {
+			return builds, fmt.Errorf("%w: service %s has no build context", ErrNoBuildServices, name)
+		}
+		start := time.Now()
+		tag := buildImageTag(project.Name, name, service.Image, deployment.Version)
+		b.recordEvent(ctx, deployment.ID, "build_started", name, fmt.Sprintf("开始构建服务 %s 的镜像 %s", name, tag), "")
+
+		contextDir, source, err := b.prepareContext(ctx, project, name, service.Build)
+		if err == nil {
+			logs := newBuildLog(func(lines []string) {
+				details, _ := json.Marshal(map[string]interface{}{"lines": lines})
+				b.recordEvent(ctx, deployment.ID, "build_log", name, lines[len(lines)-1], string(details))
+			})
+			err = builder.BuildImage(ctx, &ImageBuildRequest{
+				ContextDir: contextDir,
+				Dockerfile: service.Build.Dockerfile,
+				Args:       service.Build.Args,
+				Target:     service.Build.Target,
+				Tags:       []string{tag},
+				Labels: map[string]string{
+					"qwq.project": project.Name,
+					"qwq.service": name,
+					"qwq.version": deployment.Version,
+				},
+			}, logs.Line)
+			logs.Flush()
+		}
+		if err != nil {
+			b.recordEvent(ctx, deployment.ID, "build_failed", name, fmt.Sprintf("服务 %s 的镜像构建失败: %v", name, err), "")
+			return builds, fmt.Errorf("%w: service %s: %v", ErrBuildFailed, name, err)
+		}
+
+		build := ServiceBuild{Service: name, Image: tag, Source: source, Duration: time.Since(start).Round(time.Millisecond).String()}
+		details, _ := json.Marshal(build)
+		b.recordEvent(ctx, deployment.ID, "build_succeeded", name, fmt.Sprintf("服务 %s 的镜像已构建: %s", name, tag), string(details))
+		builds = append(builds, build)
+	}
+
+	b.pruneCache(ctx, deployment.ID)
+	return builds, nil
+}
+
+// prepareContext 解析构建上下文，返回本地目录和用于记录的来源
+func (b *BuildService) prepareContext(ctx context.Context, project *ComposeProject, service string, build *BuildConfig) (string, string, error) {
+	if build.Dockerfile != "" && !filepath.IsLocal(build.Dockerfile) {
+		return "", "", fmt.Errorf("dockerfile %s must be inside the build context", build.Dockerfile)
+	}
+
+	repo, ok := parseGitContext(build.Context)
+	if !ok {
+		dir, err := allowedLocalContext(build.Context)
+		return dir, dir, err
+	}
+
+	workspace := filepath.Join(buildWorkspace(), fmt.Sprintf("%d-%s", project.ID, dockerName(project.Name)), dockerName(service))
+	commit, err := b.checkout(ctx, workspace, repo)
+	if err != nil {
+		return "", "", err
+	}
+	dir := workspace
+	if repo.Subdir != "" {
+		if !filepath.IsLocal(repo.Subdir) {
+			return "", "", fmt.Errorf("git subdirectory %s must be inside the repository", repo.Subdir)
+		}
+		dir = filepath.Join(workspace, repo.Subdir)
+	}
+	return dir, repo.URL + "@" + commit, nil
+}
+
+// gitContext git 构建上下文，格式与 compose 相同：<地址>#<分支、标签或提交>:<子目录>
+type gitContext struct {
+	URL    string
+	Ref    string
+	Subdir string
+}
+
+// parseGitContext 判断构建上下文是否为 git 仓库
+func parseGitContext(s string) (gitContext, bool) {
+	base, fragment, _ := strings.Cut(s, "#")
+	switch {
+	case strings.HasPrefix(base, "git@"), strings.HasPrefix(base, "git://"), strings.HasPrefix(base, "ssh://"):
+	case strings.HasPrefix(base, "https://") || strings.HasPrefix(base, "http://"):
+		if !strings.HasSuffix(base, ".git") && fragment == "" {
+			return gitContext{}, false
+		}
+	default:
+		return gitContext{}, false
+	}
+	ref, subdir, _ := strings.Cut(fragment, ":")
+	return gitContext{URL: base, Ref: ref, Subdir: subdir}, true
+}
+
+// checkout 在工作目录中检出指定版本并返回提交号，已有的克隆只做增量拉取
+func (b *BuildService) checkout(ctx context.Context, dir string, repo gitContext) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create build workspace: %w", err)
+		}
+		if _, err := b.git(ctx, dir, "init", "-q"); err != nil {
+			return "", err
+		}
+		if _, err := b.git(ctx, dir, "remote", "add", "origin", repo.URL); err != nil {
+			return "", err
+		}
+	} else if _, err := b.git(ctx, dir, "remote", "set-url", "origin", repo.URL); err != nil {
+		return "", err
+	}
+
+	ref := repo.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := b.git(ctx, dir, "fetch", "-q", "--depth", "1", "origin", ref); err != nil {
+		return "", err
+	}
+	if _, err := b.git(ctx, dir, "checkout", "-q", "-f", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := b.git(ctx, dir, "clean", "-q", "-fdx"); err != nil {
+		return "", err
+	}
+	return b.git(ctx, dir, "rev-parse", "HEAD")
+}
+
+// runGit 执行 git 命令，禁止交互式输入凭据
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// allowedLocalContext 解析本地构建上下文，解析符号链接后必须位于允许的目录之内
+// 相对路径相对第一个允许的目录
+func allowedLocalContext(path string) (string, error) {
+	dirs := config.Current().ImageBuild.AllowedDirs
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("%w: image_build.allowed_dirs is not configured", ErrBuildContextNotAllowed)
+	}
+	if path == "" {
+		path = "."
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dirs[0], path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("build context %s: %w", path, err)
+	}
+	for _, dir := range dirs {
+		allowed, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(allowed, resolved); err == nil && filepath.IsLocal(rel) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrBuildContextNotAllowed, path)
+}
+
+// buildableServices 需要构建的服务，按名称排序；services 为空时为所有带 build 的服务
+func buildableServices(composeConfig *ComposeConfig, services []string) ([]string, error) {
+	var names []string
+	if len(services) == 0 {
+		for name, service := range composeConfig.Services {
+			if service.Build != nil {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for _, name := range services {
+			service, ok := composeConfig.Services[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+			}
+			if service.Build == nil {
+				return nil, fmt.Errorf("%w: service %s has no build context", ErrNoBuildServices, name)
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, ErrNoBuildServices
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// buildImageTag 构建出的镜像标签：服务声明了 image 时沿用其仓库名，否则为 <项目>-<服务>，标签为部署版本
+func buildImageTag(project, service, image, version string) string {
+	repo, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	if repo == "" {
+		repo = dockerName(project + "-" + service)
+	}
+	tag := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, version)
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return repo + ":" + tag
+}
+
+// dockerName 转换为合法的镜像仓库名：小写字母、数字和 -
+func dockerName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, s)
+	return strings.Trim(name, "-_.")
+}
+
+// ApplyBuiltImages 将服务的 build 替换为构建好的镜像，部署和回滚启动的都是带版本标签的镜像
+// 通过 yaml.Node 修改，保留其余字段和顺序
+func ApplyBuiltImages(content string, images map[string]string) (string, error) {
+	if len(images) == 0 {
+		return content, nil
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidComposeFile, err)
+	}
+	if len(root.Content) == 0 {
+		return "", fmt.Errorf("%w: empty document", ErrInvalidComposeFile)
+	}
+	services := mappingValue(root.Content[0], "services")
+	for name, image := range images {
+		service := mappingValue(services, name)
+		if service == nil || service.Kind != yaml.MappingNode {
+			return "", fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+		}
+		for i := 0; i+1 < len(service.Content); i += 2 {
+			if service.Content[i].Value == "build" {
+				service.Content = append(service.Content[:i], service.Content[i+2:]...)
+				break
+			}
+		}
+		if existing := mappingValue(service, "image"); existing != nil {
+			existing.Value = image
+		} else {
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "image"}
+			value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: image}
+			service.Content = append([]*yaml.Node{key, value}, service.Content...)
+		}
+	}
+	return marshalYAML(&root)
+}
+
+// encodeBuiltImages 编码构建结果，保存在部署记录中供回滚使用
+func encodeBuiltImages(builds []ServiceBuild) string {
+	images := make(map[string]string, len(builds))
+	for _, build := range builds {
+		images[build.Service] = build.Image
+	}
+	encoded, _ := json.Marshal(images)
+	return string(encoded)
+}
+
+// decodeBuiltImages 解析部署记录中保存的镜像，没有构建时返回 nil
+func decodeBuiltImages(encoded string) map[string]string {
+	if encoded == "" {
+		return nil
+	}
+	var images map[string]string
+	if err := json.Unmarshal([]byte(encoded), &images); err != nil {
+		return nil
+	}
+	return images
+}
+
+// pruneCache 构建缓存超过上限时清理到上限以内
+func (b *BuildService) pruneCache(ctx context.Context, deploymentID uint) {
+	limit := buildCacheLimit()
+	if limit <= 0 {
+		return
+	}
+	builder := b.imageBuilder()
+	usage, err := builder.BuildCacheUsage(ctx)
+	if err != nil {
+		logger.Info("⚠️ 读取构建缓存占用失败: %v", err)
+		return
+	}
+	if usage <= limit {
+		return
+	}
+	reclaimed, err := builder.PruneBuildCache(ctx, limit)
+	if err != nil {
+		logger.Info("⚠️ 清理构建缓存失败: %v", err)
+		return
+	}
+	message := fmt.Sprintf("构建缓存 %.1fGB 超过上限 %.1fGB，已清理 %.1fGB",
+		float64(usage)/(1<<30), float64(limit)/(1<<30), float64(reclaimed)/(1<<30))
+	logger.Info("🧹 %s", message)
+	b.recordEvent(ctx, deploymentID, "build_cache_pruned", "", message, "")
+}
+
+// buildCacheLimit 构建缓存上限（字节），0 表示不清理
+func buildCacheLimit() int64 {
+	gb := config.Current().ImageBuild.CacheMaxGB
+	if gb < 0 {
+		return 0
+	}
+	if gb == 0 {
+		gb = defaultBuildCacheGB
+	}
+	return int64(gb * (1 << 30))
+}
+
+// buildWorkspace 克隆 git 仓库的工作目录
+func buildWorkspace() string {
+	if dir := config.Current().ImageBuild.WorkspaceDir; dir != "" {
+		return dir
+	}
+	return defaultBuildWorkspace
+}
+
+func (b *BuildService) recordEvent(ctx context.Context, deploymentID uint, eventType, serviceName, message, details string) {
+	b.db.WithContext(ctx).Create(&DeploymentEvent{
+		DeploymentID: deploymentID,
+		EventType:    eventType,
+		ServiceName:  serviceName,
+		Message:      message,
+		Details:      details,
+	})
+}
+
+// buildLog 按块收集构建输出：每满一定行数或间隔一定时间写入一条事件
+type buildLog struct {
+	flush func(lines []string)
+	lines []string
+	last  time.Time
+}
+
+func newBuildLog(flush func(lines []string)) *buildLog {
+	return &buildLog{flush: flush, last: time.Now()}
+}
+
+// Line 追加一行构建输出
+func (l *buildLog) Line(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(line) > buildLogMaxLine {
+		line = line[:buildLogMaxLine] + "..."
+	}
+	l.lines = append(l.lines, line)
+	if len(l.lines) >= buildLogChunkLines || time.Since(l.last) >= buildLogChunkInterval {
+		l.Flush()
+	}
+}
+
+// Flush 写入尚未记录的输出
+func (l *buildLog) Flush() {
+	if len(l.lines) == 0 {
+		return
+	}
+	l.flush(l.lines)
+	l.lines = nil
+	l.last = time.Now()
+}
@@ -0,0 +1,440 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// 镜像构建后端
+const (
+	ImageBuilderAPI      = "api"
+	ImageBuilderBuildctl = "buildctl"
+)
+
+// NewImageBuilder 按 image_build.builder 创建构建后端
+// 默认通过 Docker Engine API 构建；配置 buildctl 时使用 BuildKit，构建结果通过 docker load 导入本机
+func NewImageBuilder() ImageBuilder {
+	cfg := config.Current().ImageBuild
+	if cfg.Builder == ImageBuilderBuildctl {
+		return &buildctlImageBuilder{addr: cfg.BuildkitAddr}
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		logger.Info("⚠️ Docker API 客户端初始化失败，镜像构建回退到 buildctl: %v", err)
+		return &buildctlImageBuilder{addr: cfg.BuildkitAddr}
+	}
+	return &apiImageBuilder{client: cli}
+}
+
+// imageBuildClient 构建用到的 Docker SDK 方法子集，便于在测试中替换
+type imageBuildClient interface {
+	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error)
+	BuildCachePrune(ctx context.Context, opts types.BuildCachePruneOptions) (*types.BuildCachePruneReport, error)
+}
+
+// apiImageBuilder 通过 Docker Engine API 构建，构建上下文在本地打包后上传
+type apiImageBuilder struct {
+	client imageBuildClient
+}
+
+// BuildImage 上传构建上下文并读取构建输出流
+func (b *apiImageBuilder) BuildImage(ctx context.Context, req *ImageBuildRequest, log func(line string)) error {
+	dockerfile := req.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	buildContext := tarBuildContext(req.ContextDir, filepath.ToSlash(dockerfile))
+	defer buildContext.Close()
+
+	args := make(map[string]*string, len(req.Args))
+	for k, v := range req.Args {
+		value := v
+		args[k] = &value
+	}
+	resp, err := b.client.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        req.Tags,
+		Dockerfile:  filepath.ToSlash(dockerfile),
+		BuildArgs:   args,
+		Labels:      req.Labels,
+		Target:      req.Target,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start image build: %w", err)
+	}
+	defer resp.Body.Close()
+	return readBuildStream(resp.Body, log)
+}
+
+// readBuildStream 解析构建接口返回的 JSON 消息流，遇到 error 消息时返回错误
+func readBuildStream(r io.Reader, log func(line string)) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Stream      string `json:"stream"`
+			Status      string `json:"status"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read build output: %w", err)
+		}
+		if msg.Error != "" || msg.ErrorDetail.Message != "" {
+			if msg.ErrorDetail.Message != "" {
+				return errors.New(msg.ErrorDetail.Message)
+			}
+			return errors.New(msg.Error)
+		}
+		for _, line := range strings.Split(msg.Stream+msg.Status, "\n") {
+			log(line)
+		}
+	}
+}
+
+// BuildCacheUsage 构建缓存占用
+func (b *apiImageBuilder) BuildCacheUsage(ctx context.Context) (int64, error) {
+	usage, err := b.client.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.BuildCacheObject}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read build cache usage: %w", err)
+	}
+	var total int64
+	for _, cache := range usage.BuildCache {
+		total += cache.Size
+	}
+	return total, nil
+}
+
+// PruneBuildCache 清理构建缓存，保留 keep 字节
+func (b *apiImageBuilder) PruneBuildCache(ctx context.Context, keep int64) (int64, error) {
+	report, err := b.client.BuildCachePrune(ctx, types.BuildCachePruneOptions{All: true, KeepStorage: keep})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune build cache: %w", err)
+	}
+	return int64(report.SpaceReclaimed), nil
+}
+
+// buildctlImageBuilder 通过 buildctl 使用 BuildKit 构建，输出 docker 格式的镜像并导入本机
+type buildctlImageBuilder struct {
+	addr string // buildkitd 地址，为空时使用 buildctl 的默认地址
+}
+
+func (b *buildctlImageBuilder) command(ctx context.Context, args ...string) *exec.Cmd {
+	if b.addr != "" {
+		args = append([]string{"--addr", b.addr}, args...)
+	}
+	return exec.CommandContext(ctx, "buildctl", args...)
+}
+
+// BuildImage 执行 buildctl build，构建输出通过管道交给 docker load
+func (b *buildctlImageBuilder) BuildImage(ctx context.Context, req *ImageBuildRequest, log func(line string)) error {
+	dockerfile := req.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	args := []string{
+		"build", "--frontend", "dockerfile.v0", "--progress", "plain",
+		"--local", "context=" + req.ContextDir,
+		"--local", "dockerfile=" + filepath.Join(req.ContextDir, filepath.Dir(dockerfile)),
+		"--opt", "filename=" + filepath.Base(dockerfile),
+	}
+	for _, k := range sortedKeys(req.Args) {
+		args = append(args, "--opt", "build-arg:"+k+"="+req.Args[k])
+	}
+	if req.Target != "" {
+		args = append(args, "--opt", "target="+req.Target)
+	}
+	for _, k := range sortedKeys(req.Labels) {
+		args = append(args, "--opt", "label:"+k+"="+req.Labels[k])
+	}
+	args = append(args, "--output", `type=docker,"name=`+strings.Join(req.Tags, ",")+`"`)
+
+	// 两个进程直接通过管道相连，镜像流不经过本进程
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	build := b.command(ctx, args...)
+	stderr := &lineWriter{log: log}
+	build.Stdout = writer
+	build.Stderr = stderr
+	load := exec.CommandContext(ctx, "docker", "load")
+	load.Stdin = reader
+	var loadOutput bytes.Buffer
+	load.Stdout = &loadOutput
+	load.Stderr = &loadOutput
+
+	if err := load.Start(); err != nil {
+		reader.Close()
+		writer.Close()
+		return fmt.Errorf("failed to start docker load: %w", err)
+	}
+	reader.Close()
+	buildErr := build.Start()
+	writer.Close()
+	if buildErr == nil {
+		buildErr = build.Wait()
+	}
+	loadErr := load.Wait()
+	stderr.Close()
+	if buildErr != nil {
+		return fmt.Errorf("buildctl build failed: %w", buildErr)
+	}
+	if loadErr != nil {
+		return fmt.Errorf("docker load failed: %v: %s", loadErr, strings.TrimSpace(loadOutput.String()))
+	}
+	log(strings.TrimSpace(loadOutput.String()))
+	return nil
+}
+
+// BuildCacheUsage 解析 buildctl du 输出的 Total 行
+func (b *buildctlImageBuilder) BuildCacheUsage(ctx context.Context) (int64, error) {
+	output, err := b.command(ctx, "du").CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("buildctl du failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return parseBuildctlTotal(string(output))
+}
+
+// PruneBuildCache 执行 buildctl prune --keep-storage，单位为 MB
+func (b *buildctlImageBuilder) PruneBuildCache(ctx context.Context, keep int64) (int64, error) {
+	output, err := b.command(ctx, "prune", "--keep-storage", strconv.FormatInt(keep/(1<<20), 10)).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("buildctl prune failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	reclaimed, _ := parseBuildctlTotal(string(output))
+	return reclaimed, nil
+}
+
+// parseBuildctlTotal 解析 buildctl du / prune 输出末尾的 "Total: 1.2GB"
+func parseBuildctlTotal(output string) (int64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "Total:" {
+			return parseHumanSize(fields[1])
+		}
+	}
+	return 0, fmt.Errorf("unexpected buildctl output: %s", strings.TrimSpace(output))
+}
+
+// parseHumanSize 解析 1.2GB、512MB、100B 这类十进制单位的大小
+func parseHumanSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1}}
+	upper := strings.ToUpper(s)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(upper[:len(upper)-len(u.suffix)]), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(n * u.scale), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid size %q", s)
+}
+
+// lineWriter 按行回调写入的内容
+type lineWriter struct {
+	log func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close 输出最后一行不完整的内容
+func (w *lineWriter) Close() {
+	if len(w.buf) > 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// tarBuildContext 将构建上下文打包为 tar 流，按 .dockerignore 排除文件
+// Dockerfile 和 .dockerignore 本身总是包含在内，与 docker build 一致
+func tarBuildContext(dir, dockerfile string) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeBuildContext(writer, dir, dockerfile))
+	}()
+	return reader
+}
+
+func writeBuildContext(w io.Writer, dir, dockerfile string) error {
+	rules, err := readDockerignore(dir)
+	if err != nil {
+		return err
+	}
+	negated := false
+	for _, rule := range rules {
+		negated = negated || rule.negate
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != dockerfile && rel != ".dockerignore" && dockerignored(rules, rel) {
+			// 有 ! 规则时目录下的文件可能被重新包含，不能整个跳过
+			if d.IsDir() && !negated {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive build context: %w", err)
+	}
+	return tw.Close()
+}
+
+// dockerignoreRule .dockerignore 中的一条规则，! 开头的规则重新包含匹配的文件
+type dockerignoreRule struct {
+	pattern string
+	negate  bool
+}
+
+// readDockerignore 读取构建上下文根目录的 .dockerignore，不存在时返回空
+func readDockerignore(dir string) ([]dockerignoreRule, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rules []dockerignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := dockerignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = strings.TrimSpace(line[1:])
+		}
+		rule.pattern = strings.TrimPrefix(path.Clean(filepath.ToSlash(line)), "/")
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// dockerignored 按顺序应用规则，最后一条匹配的规则决定是否排除
+// 规则匹配文件本身或其任一上级目录，支持 ** 匹配任意层目录
+func dockerignored(rules []dockerignoreRule, rel string) bool {
+	ignored := false
+	for _, rule := range rules {
+		for p := rel; ; {
+			if matchPathPattern(strings.Split(rule.pattern, "/"), strings.Split(p, "/")) {
+				ignored = !rule.negate
+				break
+			}
+			i := strings.LastIndex(p, "/")
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+	}
+	return ignored
+}
+
+func matchPathPattern(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchPathPattern(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
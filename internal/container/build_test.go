@@ -0,0 +1,451 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const buildTestContent = `version: "3.8"
+services:
+  api:
+    build:
+      context: api
+      args:
+        VERSION: "1"
+    ports:
+      - "8080:8080"
+  worker:
+    image: registry.local:5000/shop/worker:latest
+    build: worker
+  db:
+    image: postgres:16
+`
+
+// fakeImageBuilder 记录构建请求，fail 不为空时该服务构建失败
+type fakeImageBuilder struct {
+	mu       sync.Mutex
+	requests []*ImageBuildRequest
+	fail     string
+	usage    int64
+	pruned   int64
+}
+
+func (f *fakeImageBuilder) BuildImage(ctx context.Context, req *ImageBuildRequest, log func(line string)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	log("Step 1/2 : FROM alpine")
+	if filepath.Base(req.ContextDir) == f.fail {
+		log("ERROR: exit code 1")
+		return errors.New("exit code 1")
+	}
+	log("Successfully tagged " + req.Tags[0])
+	return nil
+}
+
+func (f *fakeImageBuilder) BuildCacheUsage(ctx context.Context) (int64, error) {
+	return f.usage, nil
+}
+
+func (f *fakeImageBuilder) PruneBuildCache(ctx context.Context, keep int64) (int64, error) {
+	f.pruned = keep
+	return f.usage - keep, nil
+}
+
+// projectExecutor 记录项目级操作，用于确认构建失败时没有触碰容器
+type projectExecutor struct {
+	*mockDockerExecutor
+	mu       sync.Mutex
+	stops    int
+	contents []string
+}
+
+func (e *projectExecutor) StartProject(ctx context.Context, projectName, composeContent string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.contents = append(e.contents, composeContent)
+	return nil
+}
+
+func (e *projectExecutor) StopProject(ctx context.Context, projectName string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stops++
+	return nil
+}
+
+// allowBuildDir 创建允许的构建目录及其中的服务上下文
+func allowBuildDir(t *testing.T, services ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, service := range services {
+		if err := os.MkdirAll(filepath.Join(dir, service), 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, service, "Dockerfile"), []byte("FROM alpine\n"), 0644)
+	}
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.ImageBuild.AllowedDirs = []string{dir} })
+	return dir
+}
+
+func setupBuildTest(t *testing.T) (*deploymentServiceImpl, *fakeImageBuilder, *projectExecutor, *ComposeProject) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}, &Deployment{}, &DeploymentEvent{}, &ServiceInstance{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	composeService := NewComposeService(db)
+	project := &ComposeProject{Name: "shop", Content: buildTestContent, TenantID: 1}
+	if err := composeService.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	builder := &fakeImageBuilder{}
+	executor := &projectExecutor{mockDockerExecutor: newMockDockerExecutor()}
+	executor.containerStatus["mock-container-id"] = "running"
+	service := NewDeploymentService(db, composeService, executor).(*deploymentServiceImpl)
+	service.composeFiles = nil
+	service.ports = nil
+	service.builds = NewBuildService(db, composeService, builder)
+	return service, builder, executor, project
+}
+
+// waitDeployment 等待部署结束
+func waitDeployment(t *testing.T, service *deploymentServiceImpl, id uint) *Deployment {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deployment, err := service.GetDeployment(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetDeployment: %v", err)
+		}
+		if deploymentFinished(deployment.Status) {
+			return deployment
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Deployment #%d did not finish: %s", id, deployment.Message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestApplyBuiltImages(t *testing.T) {
+	content, err := ApplyBuiltImages(buildTestContent, map[string]string{
+		"api":    "shop-api:v1",
+		"worker": "registry.local:5000/shop/worker:v1",
+	})
+	if err != nil {
+		t.Fatalf("ApplyBuiltImages: %v", err)
+	}
+	cfg, err := NewComposeParser().Parse(content)
+	if err != nil {
+		t.Fatalf("Rewritten content does not parse: %v", err)
+	}
+	if cfg.Services["api"].Image != "shop-api:v1" || cfg.Services["api"].Build != nil || len(cfg.Services["api"].Ports) != 1 {
+		t.Errorf("Expected api to use the built image and keep its ports, got %+v", cfg.Services["api"])
+	}
+	if cfg.Services["worker"].Image != "registry.local:5000/shop/worker:v1" || cfg.Services["worker"].Build != nil {
+		t.Errorf("Expected worker's image to be replaced, got %+v", cfg.Services["worker"])
+	}
+	if cfg.Services["db"].Image != "postgres:16" {
+		t.Errorf("Expected other services to be untouched, got %+v", cfg.Services["db"])
+	}
+	if _, err := ApplyBuiltImages(buildTestContent, map[string]string{"missing": "x:1"}); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("Expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+func TestBuildImageTagAndGitContext(t *testing.T) {
+	for _, tc := range []struct{ image, want string }{
+		{"", "shop-api:v17"},
+		{"registry.local:5000/shop/api:latest", "registry.local:5000/shop/api:v17"},
+		{"shop/api@sha256:abc", "shop/api:v17"},
+	} {
+		if got := buildImageTag("Shop", "api", tc.image, "v17"); got != tc.want {
+			t.Errorf("buildImageTag(%q) = %q, want %q", tc.image, got, tc.want)
+		}
+	}
+
+	repo, ok := parseGitContext("https://git.example.com/shop.git#v1.2.0:services/api")
+	if !ok || repo.URL != "https://git.example.com/shop.git" || repo.Ref != "v1.2.0" || repo.Subdir != "services/api" {
+		t.Errorf("Unexpected git context %+v", repo)
+	}
+	for _, local := range []string{"./api", "/srv/apps/api", "https://example.com/context.tar.gz"} {
+		if _, ok := parseGitContext(local); ok {
+			t.Errorf("Expected %q not to be a git context", local)
+		}
+	}
+}
+
+func TestAllowedLocalContext(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.ImageBuild.AllowedDirs = nil })
+	if _, err := allowedLocalContext("/tmp"); !errors.Is(err, ErrBuildContextNotAllowed) {
+		t.Errorf("Expected local contexts to be rejected without allowed_dirs, got %v", err)
+	}
+
+	dir := allowBuildDir(t, "api")
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	resolved, _ := filepath.EvalSymlinks(filepath.Join(dir, "api"))
+	if got, err := allowedLocalContext("api"); err != nil || got != resolved {
+		t.Errorf("Expected a relative context inside the allowed dir, got %q, %v", got, err)
+	}
+	for _, path := range []string{outside, "escape", "../" + filepath.Base(outside)} {
+		if _, err := allowedLocalContext(path); !errors.Is(err, ErrBuildContextNotAllowed) {
+			t.Errorf("Expected %q to be rejected, got %v", path, err)
+		}
+	}
+}
+
+func TestBuildService_GitCheckout(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	workspace := t.TempDir()
+	config.Update(func(cfg *config.Config) { cfg.ImageBuild.WorkspaceDir = workspace })
+
+	var commands []string
+	service := NewBuildService(nil, nil, nil)
+	service.git = func(ctx context.Context, dir string, args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		if args[0] == "init" {
+			os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+		}
+		return "abc123", nil
+	}
+	project := &ComposeProject{ID: 7, Name: "shop"}
+	build := &BuildConfig{Context: "git@git.example.com:shop.git#main"}
+	dir, source, err := service.prepareContext(context.Background(), project, "api", build)
+	if err != nil {
+		t.Fatalf("prepareContext: %v", err)
+	}
+	if dir != filepath.Join(workspace, "7-shop", "api") || source != "git@git.example.com:shop.git@abc123" {
+		t.Errorf("Unexpected checkout %q from %q", dir, source)
+	}
+	if commands[0] != "init -q" || commands[3] != "checkout -q -f FETCH_HEAD" {
+		t.Errorf("Unexpected git commands %v", commands)
+	}
+
+	// 工作目录在多次构建之间保留，之后只更新远程地址并增量拉取
+	commands = nil
+	if _, _, err := service.prepareContext(context.Background(), project, "api", build); err != nil {
+		t.Fatalf("prepareContext: %v", err)
+	}
+	if commands[0] != "remote set-url origin git@git.example.com:shop.git" || commands[1] != "fetch -q --depth 1 origin main" {
+		t.Errorf("Expected the existing clone to be reused, got %v", commands)
+	}
+}
+
+func TestDeploy_BuildsImagesBeforeStarting(t *testing.T) {
+	allowBuildDir(t, "api", "worker")
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.ImageBuild.CacheMaxGB = 1 })
+
+	service, builder, executor, project := setupBuildTest(t)
+	builder.usage = 3 << 30
+	deployment, err := service.Deploy(context.Background(), project.ID, &DeploymentConfig{Strategy: DeployStrategyRecreate, HealthCheckRetries: 1})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	done := waitDeployment(t, service, deployment.ID)
+	if done.Status != DeploymentStatusCompleted {
+		t.Fatalf("Expected the deployment to complete, got %s: %s", done.Status, done.Message)
+	}
+
+	if len(builder.requests) != 2 || builder.requests[0].Args["VERSION"] != "1" {
+		t.Fatalf("Expected api and worker to be built, got %+v", builder.requests)
+	}
+	apiTag := "shop-api:" + deployment.Version
+	if builder.requests[0].Tags[0] != apiTag || builder.requests[1].Tags[0] != "registry.local:5000/shop/worker:"+deployment.Version {
+		t.Errorf("Expected images to be tagged with the deployment version, got %v %v", builder.requests[0].Tags, builder.requests[1].Tags)
+	}
+	if len(executor.contents) != 1 || !strings.Contains(executor.contents[0], "image: "+apiTag) || strings.Contains(executor.contents[0], "build") {
+		t.Errorf("Expected the built images to be started, got %q", executor.contents)
+	}
+	if images := decodeBuiltImages(done.Images); images["api"] != apiTag {
+		t.Errorf("Expected the built images to be recorded, got %q", done.Images)
+	}
+	if builder.pruned != 1<<30 {
+		t.Errorf("Expected the build cache to be pruned to the cap, got %d", builder.pruned)
+	}
+	types := eventTypes(t, service, deployment.ID)
+	for _, eventType := range []string{"build_started", "build_log", "build_succeeded", "build_cache_pruned", "deployment_completed"} {
+		if !types[eventType] {
+			t.Errorf("Expected a %s event, got %v", eventType, types)
+		}
+	}
+}
+
+func TestDeploy_FailedBuildKeepsRunningVersion(t *testing.T) {
+	allowBuildDir(t, "api", "worker")
+	service, builder, executor, project := setupBuildTest(t)
+	builder.fail = "worker"
+
+	deployment, err := service.Deploy(context.Background(), project.ID, &DeploymentConfig{
+		Strategy: DeployStrategyRecreate, HealthCheckRetries: 1, RollbackOnFailure: true,
+	})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	done := waitDeployment(t, service, deployment.ID)
+	if done.Status != DeploymentStatusFailed || !strings.Contains(done.Message, "worker") {
+		t.Fatalf("Expected the deployment to fail on the worker build, got %s: %s", done.Status, done.Message)
+	}
+	if executor.stops != 0 || len(executor.contents) != 0 {
+		t.Errorf("Expected no containers to be touched, got %d stops and %d starts", executor.stops, len(executor.contents))
+	}
+	types := eventTypes(t, service, deployment.ID)
+	if !types["build_failed"] || types["rollback_started"] {
+		t.Errorf("Expected a failed build without rollback, got %v", types)
+	}
+}
+
+func TestBuildService_StandaloneBuild(t *testing.T) {
+	allowBuildDir(t, "api", "worker")
+	service, builder, executor, project := setupBuildTest(t)
+
+	if _, err := service.builds.Build(context.Background(), project.ID, []string{"db"}); !errors.Is(err, ErrNoBuildServices) {
+		t.Errorf("Expected ErrNoBuildServices for a service without build, got %v", err)
+	}
+	run, err := service.builds.Build(WithRequester(context.Background(), "alice"), project.ID, []string{"api"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	done := waitDeployment(t, service, run.ID)
+	if done.Status != DeploymentStatusCompleted || done.Strategy != DeployStrategyBuild || done.RequestedBy != "alice" {
+		t.Fatalf("Unexpected build record %+v", done)
+	}
+	if len(builder.requests) != 1 || len(executor.contents) != 0 {
+		t.Errorf("Expected only the api image to be built, got %d builds and %d starts", len(builder.requests), len(executor.contents))
+	}
+}
+
+func TestPipelineRun_BuildStepFeedsDeploy(t *testing.T) {
+	allowBuildDir(t, "api", "worker")
+	service, _, _, _ := setupPipelineTest(t)
+	builder := &fakeImageBuilder{}
+	service.deployer.builds = NewBuildService(service.db, service.compose, builder)
+	project := &ComposeProject{Name: "built", Content: buildTestContent, TenantID: 1}
+	if err := service.compose.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+
+	pipeline := createPipeline(t, service, project, `steps:
+  - name: build
+    type: build
+  - name: deploy
+    type: deploy
+    health_check_delay: 0
+    health_check_retries: 1
+`)
+	run, err := service.Run(WithRequester(context.Background(), "alice"), pipeline.ID)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	waitRun(t, service, run.ID, DeploymentStatusCompleted)
+	if len(builder.requests) != 2 {
+		t.Errorf("Expected the deploy step to reuse the built images, got %d builds", len(builder.requests))
+	}
+
+	if _, err := ParsePipelineDefinition("steps:\n  - name: b\n    type: build\n    strategy: recreate\n"); !errors.Is(err, ErrInvalidPipeline) {
+		t.Errorf("Expected a strategy on a build step to be rejected, got %v", err)
+	}
+}
+
+func TestBuildContextArchive_HonoursDockerignore(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":           "FROM alpine\n",
+		".dockerignore":        "# local files\nnode_modules\n**/*.log\nsecrets/\n!secrets/public.pem\n",
+		"main.go":              "package main\n",
+		"node_modules/x/a.js":  "x",
+		"logs/app.log":         "log",
+		"secrets/key.pem":      "private",
+		"secrets/public.pem":   "public",
+		"internal/pkg/util.go": "package pkg\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeBuildContext(&buf, dir, "Dockerfile"); err != nil {
+		t.Fatalf("writeBuildContext: %v", err)
+	}
+	var files []string
+	reader := tar.NewReader(&buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	sort.Strings(files)
+	want := []string{".dockerignore", "Dockerfile", "internal/pkg/util.go", "main.go", "secrets/public.pem"}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v in the build context, got %v", want, files)
+	}
+}
+
+func TestReadBuildStream(t *testing.T) {
+	stream := `{"stream":"Step 1/2 : FROM alpine\n"}
+{"stream":" ---> 8ca4688f4f35\n"}
+{"errorDetail":{"message":"The command '/bin/sh -c make' returned a non-zero code: 2"},"error":"The command '/bin/sh -c make' returned a non-zero code: 2"}
+`
+	var lines []string
+	err := readBuildStream(strings.NewReader(stream), func(line string) {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "non-zero code: 2") {
+		t.Errorf("Expected the build error to be returned, got %v", err)
+	}
+	if len(lines) != 2 || lines[0] != "Step 1/2 : FROM alpine" {
+		t.Errorf("Unexpected build output %q", lines)
+	}
+
+	if size, err := parseBuildctlTotal("ID\tRECLAIMABLE\tSIZE\nabc\ttrue\t1.2GB\nShared:\t\t0B\nTotal:\t\t2.5GB\n"); err != nil || size != 2500000000 {
+		t.Errorf("Expected 2.5GB, got %d, %v", size, err)
+	}
+}
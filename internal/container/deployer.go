@@ -2,9 +2,18 @@ package container
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"runtime/debug"
+	"sort"
 	"time"
 
+	"qwq/internal/drift"
+	"qwq/internal/events"
+	"qwq/internal/pagination"
+	"qwq/internal/portaudit"
+	"qwq/internal/utils"
+
 	"gorm.io/gorm"
 )
 
@@ -14,11 +23,17 @@ type DeploymentService interface {
 	Deploy(ctx context.Context, projectID uint, config *DeploymentConfig) (*Deployment, error)
 	GetDeployment(ctx context.Context, id uint) (*Deployment, error)
 	ListDeployments(ctx context.Context, projectID uint) ([]*Deployment, error)
+	QueryDeployments(ctx context.Context, projectID uint, q pagination.Query) (*pagination.Page[*Deployment], error)
 	
 	// 部署控制
 	RollbackDeployment(ctx context.Context, deploymentID uint) error
 	CancelDeployment(ctx context.Context, deploymentID uint) error
 	
+	// 部署审批
+	ApproveDeployment(ctx context.Context, deploymentID uint, approver string) (*Deployment, error)
+	RejectDeployment(ctx context.Context, deploymentID uint, approver, reason string) (*Deployment, error)
+	ListPendingApprovals(ctx context.Context) ([]*Deployment, error)
+	
 	// 状态监控
 	GetDeploymentStatus(ctx context.Context, deploymentID uint) (*DeploymentStatus, error)
 	GetDeploymentEvents(ctx context.Context, deploymentID uint) ([]*DeploymentEvent, error)
@@ -31,6 +46,10 @@ type deploymentServiceImpl struct {
 	composeService  ComposeService
 	dockerExecutor  DockerExecutor
 	healingService  SelfHealingService
+	composeFiles    *drift.Tracker // 记录部署时写入的 compose 项目文件，为 nil 时不写入
+	ports           *portaudit.Checker // 部署前检查主机端口，为 nil 时不检查
+	builds          *BuildService      // 部署前构建带 build 的服务，为 nil 时这些服务无法部署
+	probes          *ProbeRunner       // 部署后验证探针，为 nil 时配置了探针的部署失败
 }
 
 // NewDeploymentService 创建部署服务实例
@@ -39,6 +58,10 @@ func NewDeploymentService(db *gorm.DB, composeService ComposeService, dockerExec
 		db:             db,
 		composeService: composeService,
 		dockerExecutor: dockerExecutor,
+		composeFiles:   drift.Default,
+		ports:          portaudit.Default,
+		builds:         NewBuildService(db, composeService, nil),
+		probes:         NewProbeRunner(dockerExecutor),
 	}
 }
 
@@ -55,6 +78,13 @@ func (s *deploymentServiceImpl) Deploy(ctx context.Context, projectID uint, conf
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
 
+	// 项目文件被手工修改且尚未处理时拒绝部署，避免覆盖外部修改
+	if s.composeFiles != nil {
+		if err := s.composeFiles.Check(composeFilePath(project)); err != nil {
+			return nil, err
+		}
+	}
+
 	// 解析 Compose 配置
 	composeConfig, err := s.composeService.ParseComposeFile(ctx, project.Content)
 	if err != nil {
@@ -73,23 +103,70 @@ func (s *deploymentServiceImpl) Deploy(ctx context.Context, projectID uint, conf
 		}
 	}
 
+	// 只部署部分服务时其余服务保持不动，只有滚动更新逐个服务替换容器
+	if len(config.Services) > 0 {
+		if config.Strategy != DeployStrategyRollingUpdate {
+			return nil, fmt.Errorf("deploying selected services requires the %s strategy", DeployStrategyRollingUpdate)
+		}
+		for _, name := range config.Services {
+			if _, ok := composeConfig.Services[name]; !ok {
+				return nil, fmt.Errorf("service %s not found in compose file", name)
+			}
+		}
+	}
+
+	if err := ValidateProbes(config.Probes, composeConfig); err != nil {
+		return nil, err
+	}
+
+	// 端口被占用时在创建部署记录之前失败，不触碰任何容器
+	if err := s.auditPorts(ctx, project, composeConfig); err != nil {
+		return nil, err
+	}
+
 	// 创建部署记录
 	now := time.Now()
 	deployment := &Deployment{
-		ProjectID:  projectID,
-		Version:    fmt.Sprintf("v%d", time.Now().Unix()),
-		Strategy:   config.Strategy,
-		Status:     DeploymentStatusPending,
-		Progress:   0,
-		StartedAt:  &now,
-		UserID:     project.UserID,
-		TenantID:   project.TenantID,
+		ProjectID:   projectID,
+		Version:     fmt.Sprintf("v%d", time.Now().Unix()),
+		Strategy:    config.Strategy,
+		Status:      DeploymentStatusPending,
+		Progress:    0,
+		StartedAt:   &now,
+		RequestedBy: RequesterFromContext(ctx),
+		UserID:      project.UserID,
+		TenantID:    project.TenantID,
+	}
+
+	// 需要审批的部署只创建记录，审批通过后再执行
+	needsApproval := requiresApproval(project, config)
+	if needsApproval {
+		encoded, err := json.Marshal(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode deployment config: %w", err)
+		}
+		expiresAt := now.Add(approvalExpiry())
+		deployment.Status = DeploymentStatusPendingApproval
+		deployment.StartedAt = nil
+		deployment.ApprovalExpiresAt = &expiresAt
+		deployment.Config = string(encoded)
+		deployment.Message = "等待审批"
+	}
+
+	// 记录部署所使用的内容修订，便于追溯和回滚
+	if revision, err := s.composeService.GetLatestRevision(ctx, projectID); err == nil && revision != nil {
+		deployment.RevisionID = &revision.ID
 	}
 
 	if err := s.db.WithContext(ctx).Create(deployment).Error; err != nil {
 		return nil, fmt.Errorf("failed to create deployment: %w", err)
 	}
 
+	if needsApproval {
+		s.requestApproval(ctx, deployment, project)
+		return deployment, nil
+	}
+
 	// 记录部署开始事件
 	s.recordEvent(ctx, deployment.ID, "deployment_started", "", 
 		fmt.Sprintf("开始部署项目 %s，策略: %s", project.Name, config.Strategy), "")
@@ -103,22 +180,52 @@ func (s *deploymentServiceImpl) Deploy(ctx context.Context, projectID uint, conf
 // executeDeployment 执行部署逻辑
 func (s *deploymentServiceImpl) executeDeployment(ctx context.Context, deployment *Deployment, 
 	project *ComposeProject, config *ComposeConfig, deployConfig *DeploymentConfig) {
+
+	// 部署协程 panic 时标记部署失败，而不是让整个进程退出
+	defer func() {
+		if r := recover(); r != nil {
+			utils.RecordPanic("deployment-executor", r, debug.Stack())
+			s.handleDeploymentFailure(ctx, deployment, fmt.Errorf("deployment panicked: %v", r), deployConfig)
+		}
+	}()
 	
 	// 更新状态为进行中
 	s.updateDeploymentStatus(ctx, deployment.ID, DeploymentStatusInProgress, 10, "开始部署...")
 
-	var err error
+	// 构建镜像和写入项目文件都在改动容器之前，失败时正在运行的版本不受影响，不需要回滚
+	noRollback := *deployConfig
+	noRollback.RollbackOnFailure = false
+
+	built, config, err := s.buildImages(ctx, deployment, project, config, deployConfig)
+	if err != nil {
+		s.handleDeploymentFailure(ctx, deployment, err, &noRollback)
+		return
+	}
+
+	// 写入项目文件（用户编写的原始内容）；发现外部修改时直接失败
+	if s.composeFiles != nil {
+		if err := s.composeFiles.Write(composeDriftFile(project), []byte(project.Content), 0644); err != nil {
+			s.handleDeploymentFailure(ctx, deployment, err, &noRollback)
+			return
+		}
+	}
+
 	switch deployConfig.Strategy {
 	case DeployStrategyRecreate:
-		err = s.deployRecreate(ctx, deployment, project, config, deployConfig)
+		err = s.deployRecreate(ctx, deployment, built, config, deployConfig)
 	case DeployStrategyRollingUpdate:
-		err = s.deployRollingUpdate(ctx, deployment, project, config, deployConfig)
+		err = s.deployRollingUpdate(ctx, deployment, built, config, deployConfig)
 	case DeployStrategyBlueGreen:
-		err = s.deployBlueGreen(ctx, deployment, project, config, deployConfig)
+		err = s.deployBlueGreen(ctx, deployment, built, config, deployConfig)
 	default:
 		err = fmt.Errorf("unsupported deployment strategy: %s", deployConfig.Strategy)
 	}
 
+	// 容器运行不代表服务可用：健康检查通过后执行部署后验证，失败时与部署失败一样处理（按配置回滚）
+	if err == nil && len(deployConfig.Probes) > 0 {
+		err = s.runProbes(ctx, deployment, project.Name, config, deployConfig.Probes)
+	}
+
 	if err != nil {
 		s.handleDeploymentFailure(ctx, deployment, err, deployConfig)
 		return
@@ -136,6 +243,58 @@ func (s *deploymentServiceImpl) executeDeployment(ctx context.Context, deploymen
 	s.recordEvent(ctx, deployment.ID, "deployment_completed", "", "部署成功完成", "")
 }
 
+// buildImages 构建本次部署涉及的带 build 的服务，返回改用构建出的镜像的项目内容和配置
+// 部署配置中已给出镜像的服务（如流水线 build 步骤的产物）不再构建；没有 build 的项目原样返回
+func (s *deploymentServiceImpl) buildImages(ctx context.Context, deployment *Deployment,
+	project *ComposeProject, config *ComposeConfig, deployConfig *DeploymentConfig) (*ComposeProject, *ComposeConfig, error) {
+
+	images := make(map[string]string)
+	var names []string
+	for name, service := range selectedServices(config, deployConfig) {
+		if service.Build == nil {
+			continue
+		}
+		if image := deployConfig.Images[name]; image != "" {
+			images[name] = image
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(images) == 0 && len(names) == 0 {
+		return project, config, nil
+	}
+
+	if len(names) > 0 {
+		if s.builds == nil {
+			return nil, nil, fmt.Errorf("%w: image builds are not configured", ErrBuildFailed)
+		}
+		sort.Strings(names)
+		s.updateDeploymentStatus(ctx, deployment.ID, DeploymentStatusInProgress, 10, "构建镜像...")
+		builds, err := s.builds.BuildServices(ctx, deployment, project, config.Services, names)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, build := range builds {
+			images[build.Service] = build.Image
+		}
+	}
+
+	content, err := ApplyBuiltImages(project.Content, images)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, _ := json.Marshal(images)
+	s.db.WithContext(ctx).Model(&Deployment{}).Where("id = ?", deployment.ID).Update("images", string(encoded))
+
+	built := *project
+	built.Content = content
+	for name, image := range images {
+		config.Services[name].Image = image
+		config.Services[name].Build = nil
+	}
+	return &built, config, nil
+}
+
 // deployRecreate 重建策略部署
 func (s *deploymentServiceImpl) deployRecreate(ctx context.Context, deployment *Deployment, 
 	project *ComposeProject, config *ComposeConfig, deployConfig *DeploymentConfig) error {
@@ -183,11 +342,12 @@ func (s *deploymentServiceImpl) deployRollingUpdate(ctx context.Context, deploym
 	
 	s.updateDeploymentStatus(ctx, deployment.ID, DeploymentStatusInProgress, 20, "开始滚动更新...")
 	
-	totalServices := len(config.Services)
+	services := selectedServices(config, deployConfig)
+	totalServices := len(services)
 	completedServices := 0
 	
 	// 逐个服务进行滚动更新
-	for serviceName, service := range config.Services {
+	for serviceName, service := range services {
 		s.recordEvent(ctx, deployment.ID, "service_updating", serviceName, 
 			fmt.Sprintf("开始更新服务: %s", serviceName), "")
 		
@@ -294,6 +454,20 @@ func (s *deploymentServiceImpl) deployBlueGreen(ctx context.Context, deployment
 	return nil
 }
 
+// selectedServices 本次部署涉及的服务，未指定时为全部服务
+func selectedServices(config *ComposeConfig, deployConfig *DeploymentConfig) map[string]*Service {
+	if len(deployConfig.Services) == 0 {
+		return config.Services
+	}
+	services := make(map[string]*Service, len(deployConfig.Services))
+	for _, name := range deployConfig.Services {
+		if service, ok := config.Services[name]; ok {
+			services[name] = service
+		}
+	}
+	return services
+}
+
 // waitForHealthy 等待所有服务健康
 func (s *deploymentServiceImpl) waitForHealthy(ctx context.Context, deployment *Deployment, 
 	config *ComposeConfig, deployConfig *DeploymentConfig) error {
@@ -372,7 +546,7 @@ func (s *deploymentServiceImpl) recordServiceInstances(ctx context.Context, depl
 			
 			// 注册到自愈服务
 			if s.healingService != nil {
-				healingConfig := s.buildHealingConfig(service)
+				healingConfig := healingConfigFor(service)
 				if err := s.healingService.RegisterContainer(ctx, containerID, healingConfig); err != nil {
 					// 记录警告但不失败
 					s.recordEvent(ctx, deployment.ID, "healing_registration_warning", serviceName,
@@ -385,8 +559,8 @@ func (s *deploymentServiceImpl) recordServiceInstances(ctx context.Context, depl
 	return nil
 }
 
-// buildHealingConfig 根据服务配置构建自愈配置
-func (s *deploymentServiceImpl) buildHealingConfig(service *Service) *HealingConfig {
+// healingConfigFor 根据服务配置构建自愈配置
+func healingConfigFor(service *Service) *HealingConfig {
 	config := DefaultHealingConfig()
 	
 	// 根据服务的重启策略调整自愈配置
@@ -476,8 +650,9 @@ func (s *deploymentServiceImpl) performRollback(ctx context.Context, deployment
 	// 查找上一个成功的部署
 	var previousDeployment Deployment
 	err := s.db.WithContext(ctx).
-		Where("project_id = ? AND id < ? AND status = ?", 
-			deployment.ProjectID, deployment.ID, DeploymentStatusCompleted).
+		Where("project_id = ? AND id < ? AND status = ? AND strategy NOT IN ?", 
+			deployment.ProjectID, deployment.ID, DeploymentStatusCompleted,
+			[]DeployStrategy{DeployStrategyPipeline, DeployStrategyBuild}).
 		Order("id DESC").
 		First(&previousDeployment).Error
 	
@@ -502,7 +677,14 @@ func (s *deploymentServiceImpl) performRollback(ctx context.Context, deployment
 	
 	// 启动上一个版本
 	// 注意：这里简化处理，实际应该保存每个部署的完整配置
-	if err := s.dockerExecutor.StartProject(ctx, project.Name, project.Content); err != nil {
+	// 上一个版本构建过镜像时启动当时的镜像，而不是重新构建
+	content := project.Content
+	if images := decodeBuiltImages(previousDeployment.Images); len(images) > 0 {
+		if rewritten, err := ApplyBuiltImages(content, images); err == nil {
+			content = rewritten
+		}
+	}
+	if err := s.dockerExecutor.StartProject(ctx, project.Name, content); err != nil {
 		return fmt.Errorf("failed to start previous version: %w", err)
 	}
 	
@@ -516,7 +698,8 @@ func (s *deploymentServiceImpl) CancelDeployment(ctx context.Context, deployment
 		return err
 	}
 	
-	if deployment.Status != DeploymentStatusPending && deployment.Status != DeploymentStatusInProgress {
+	if deployment.Status != DeploymentStatusPending && deployment.Status != DeploymentStatusInProgress &&
+		deployment.Status != DeploymentStatusPendingApproval {
 		return fmt.Errorf("cannot cancel deployment in %s status", deployment.Status)
 	}
 	
@@ -558,6 +741,22 @@ func (s *deploymentServiceImpl) ListDeployments(ctx context.Context, projectID u
 	return deployments, nil
 }
 
+// QueryDeployments 分页列出项目的部署记录
+func (s *deploymentServiceImpl) QueryDeployments(ctx context.Context, projectID uint, q pagination.Query) (*pagination.Page[*Deployment], error) {
+	query := s.db.WithContext(ctx).Model(&Deployment{})
+	
+	if projectID > 0 {
+		query = query.Where("project_id = ?", projectID)
+	}
+	
+	page, err := pagination.Find[*Deployment](query, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	
+	return page, nil
+}
+
 // GetDeploymentStatus 获取部署状态
 func (s *deploymentServiceImpl) GetDeploymentStatus(ctx context.Context, deploymentID uint) (*DeploymentStatus, error) {
 	deployment, err := s.GetDeployment(ctx, deploymentID)
@@ -612,4 +811,27 @@ func (s *deploymentServiceImpl) recordEvent(ctx context.Context, deploymentID ui
 		Details:      details,
 	}
 	s.db.WithContext(ctx).Create(event)
+	if timelineDeploymentEvents[eventType] {
+		s.emitTimelineEvent(ctx, deploymentID, eventType, message)
+	}
+}
+
+// timelineDeploymentEvents 同时记录到事件时间线的部署事件，部署过程中的中间步骤只保存在部署事件中
+var timelineDeploymentEvents = map[string]bool{
+	"deployment_started": true, "deployment_completed": true, "deployment_failed": true,
+	"deployment_cancelled": true, "rollback_started": true, "rollback_completed": true,
+}
+
+// emitTimelineEvent 把部署的关键节点记录到事件时间线，目标为项目名和部署编号
+func (s *deploymentServiceImpl) emitTimelineEvent(ctx context.Context, deploymentID uint, eventType, message string) {
+	var deployment Deployment
+	target := fmt.Sprintf("deployment #%d", deploymentID)
+	actor := ""
+	if err := s.db.WithContext(ctx).Preload("Project").First(&deployment, deploymentID).Error; err == nil {
+		if deployment.Project != nil {
+			target = fmt.Sprintf("%s #%d", deployment.Project.Name, deploymentID)
+		}
+		actor = deployment.RequestedBy
+	}
+	events.Emit(events.TypeDeployment, eventType, actor, target, message)
 }
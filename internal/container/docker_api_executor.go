@@ -0,0 +1,578 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// dockerAPIClient 执行器用到的 Docker SDK 方法子集，便于在测试中替换
+type dockerAPIClient interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig,
+		networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error)
+	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
+	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerPause(ctx context.Context, containerID string) error
+	ContainerUnpause(ctx context.Context, containerID string) error
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
+	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	ContainerExecCreate(ctx context.Context, container string, options container.ExecOptions) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
+}
+
+// apiDockerExecutor 基于 Docker Engine API 的执行器
+// 不依赖 docker CLI，只需挂载 /var/run/docker.sock 或设置 DOCKER_HOST
+type apiDockerExecutor struct {
+	client dockerAPIClient
+	parser *ComposeParser
+}
+
+// NewAPIDockerExecutor 创建基于 Docker SDK 的执行器
+// 连接参数来自环境变量 DOCKER_HOST、DOCKER_CERT_PATH 等，默认使用本地 socket
+func NewAPIDockerExecutor() (DockerExecutor, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	return newAPIDockerExecutor(cli), nil
+}
+
+func newAPIDockerExecutor(cli dockerAPIClient) *apiDockerExecutor {
+	return &apiDockerExecutor{client: cli, parser: NewComposeParser()}
+}
+
+// StartProject 按 compose 定义创建网络、卷并依赖顺序启动所有服务
+// 服务已有容器时直接启动现有容器，与 docker compose up -d 行为一致
+func (e *apiDockerExecutor) StartProject(ctx context.Context, projectName, composeContent string) error {
+	cfg, err := e.parser.Parse(composeContent)
+	if err != nil {
+		return fmt.Errorf("failed to parse compose content: %w", err)
+	}
+
+	order, err := serviceStartOrder(cfg.Services)
+	if err != nil {
+		return err
+	}
+
+	if err := e.ensureNetworks(ctx, projectName, cfg); err != nil {
+		return err
+	}
+	if err := e.ensureVolumes(ctx, projectName, cfg); err != nil {
+		return err
+	}
+
+	for _, serviceName := range order {
+		existing, err := e.GetServiceContainers(ctx, projectName, serviceName)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			for _, id := range existing {
+				if err := e.StartContainer(ctx, id); err != nil {
+					return fmt.Errorf("failed to start service %s: %w", serviceName, err)
+				}
+			}
+			continue
+		}
+		if _, err := e.startService(ctx, projectName, serviceName, cfg.Services[serviceName], cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopProject 停止项目
+func (e *apiDockerExecutor) StopProject(ctx context.Context, projectName string) error {
+	ids, err := e.listByLabels(ctx, projectName, "")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := e.StopContainer(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveProject 删除项目的容器和网络（保留数据卷）
+func (e *apiDockerExecutor) RemoveProject(ctx context.Context, projectName string) error {
+	ids, err := e.listByLabels(ctx, projectName, "")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := e.RemoveContainer(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	networks, err := e.client.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel+"="+projectName)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
+	for _, n := range networks {
+		if err := e.client.NetworkRemove(ctx, n.ID); err != nil {
+			return fmt.Errorf("failed to remove network %s: %w", n.Name, err)
+		}
+	}
+	return nil
+}
+
+// StartService 创建并启动一个新的服务实例，返回容器 ID
+func (e *apiDockerExecutor) StartService(ctx context.Context, projectName, serviceName string,
+	service *Service) (string, error) {
+	return e.startService(ctx, projectName, serviceName, service, nil)
+}
+
+func (e *apiDockerExecutor) startService(ctx context.Context, projectName, serviceName string,
+	service *Service, cfg *ComposeConfig) (string, error) {
+	if service == nil {
+		return "", fmt.Errorf("service %s is not defined", serviceName)
+	}
+	if service.Image == "" {
+		if service.Build != nil {
+			return "", errBuildNotSupported
+		}
+		return "", fmt.Errorf("service %s has no image", serviceName)
+	}
+
+	if err := e.ensureImage(ctx, service.Image); err != nil {
+		return "", err
+	}
+
+	existing, err := e.listByLabels(ctx, projectName, serviceName)
+	if err != nil {
+		return "", err
+	}
+	number := len(existing) + 1
+
+	containerConfig, hostConfig, networkingConfig, err := buildContainerSpec(projectName, serviceName, service, cfg, number)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := e.client.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil,
+		serviceContainerName(projectName, serviceName, service, number))
+	if err != nil {
+		return "", fmt.Errorf("failed to create container for service %s: %w", serviceName, err)
+	}
+	if err := e.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", fmt.Errorf("failed to start container for service %s: %w", serviceName, err)
+	}
+	return resp.ID, nil
+}
+
+// ensureImage 本地不存在镜像时拉取
+func (e *apiDockerExecutor) ensureImage(ctx context.Context, ref string) error {
+	if _, _, err := e.client.ImageInspectWithRaw(ctx, ref); err == nil {
+		return nil
+	}
+	reader, err := e.client.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", ref, err)
+	}
+	defer reader.Close()
+	// 必须读完进度流，拉取才会完成
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// ensureNetworks 创建项目默认网络和声明的非外部网络
+func (e *apiDockerExecutor) ensureNetworks(ctx context.Context, projectName string, cfg *ComposeConfig) error {
+	existing, err := e.client.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
+	names := make(map[string]bool, len(existing))
+	for _, n := range existing {
+		names[n.Name] = true
+	}
+
+	wanted := map[string]*Network{"default": nil}
+	for name, def := range cfg.Networks {
+		wanted[name] = def
+	}
+	for _, name := range sortedKeys(wanted) {
+		def := wanted[name]
+		if def != nil && def.External {
+			continue
+		}
+		actual := networkName(projectName, name, cfg)
+		if names[actual] {
+			continue
+		}
+		options := network.CreateOptions{Labels: map[string]string{composeProjectLabel: projectName}}
+		if def != nil {
+			options.Driver = def.Driver
+			options.Options = def.DriverOpts
+			for k, v := range def.Labels {
+				options.Labels[k] = v
+			}
+		}
+		if _, err := e.client.NetworkCreate(ctx, actual, options); err != nil {
+			return fmt.Errorf("failed to create network %s: %w", actual, err)
+		}
+	}
+	return nil
+}
+
+// ensureVolumes 创建声明的非外部命名卷（已存在时 Docker 直接返回现有卷）
+func (e *apiDockerExecutor) ensureVolumes(ctx context.Context, projectName string, cfg *ComposeConfig) error {
+	for _, name := range sortedKeys(cfg.Volumes) {
+		def := cfg.Volumes[name]
+		if def != nil && def.External {
+			continue
+		}
+		options := volume.CreateOptions{
+			Name:   projectResourceName(projectName, name),
+			Labels: map[string]string{composeProjectLabel: projectName},
+		}
+		if def != nil {
+			if def.Name != "" {
+				options.Name = def.Name
+			}
+			options.Driver = def.Driver
+			options.DriverOpts = def.DriverOpts
+			for k, v := range def.Labels {
+				options.Labels[k] = v
+			}
+		}
+		if _, err := e.client.VolumeCreate(ctx, options); err != nil {
+			return fmt.Errorf("failed to create volume %s: %w", options.Name, err)
+		}
+	}
+	return nil
+}
+
+// StopService 停止服务的所有容器
+func (e *apiDockerExecutor) StopService(ctx context.Context, projectName, serviceName string) error {
+	ids, err := e.listByLabels(ctx, projectName, serviceName)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := e.StopContainer(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetServiceContainers 获取服务的所有容器，projectName 为空时匹配所有项目
+func (e *apiDockerExecutor) GetServiceContainers(ctx context.Context, projectName, serviceName string) ([]string, error) {
+	return e.listByLabels(ctx, projectName, serviceName)
+}
+
+func (e *apiDockerExecutor) listByLabels(ctx context.Context, projectName, serviceName string) ([]string, error) {
+	args := filters.NewArgs()
+	if projectName != "" {
+		args.Add("label", composeProjectLabel+"="+projectName)
+	}
+	if serviceName != "" {
+		args.Add("label", composeServiceLabel+"="+serviceName)
+	}
+
+	containers, err := e.client.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// StartContainer 启动容器
+func (e *apiDockerExecutor) StartContainer(ctx context.Context, containerID string) error {
+	return e.client.ContainerStart(ctx, containerID, container.StartOptions{})
+}
+
+// StopContainer 停止容器
+func (e *apiDockerExecutor) StopContainer(ctx context.Context, containerID string) error {
+	return e.client.ContainerStop(ctx, containerID, container.StopOptions{})
+}
+
+// RemoveContainer 强制删除容器
+func (e *apiDockerExecutor) RemoveContainer(ctx context.Context, containerID string) error {
+	return e.client.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+}
+
+// RemoveContainerAndVolumes 强制删除容器及其匿名卷
+func (e *apiDockerExecutor) RemoveContainerAndVolumes(ctx context.Context, containerID string) error {
+	return e.client.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+}
+
+// PauseContainer 暂停容器中的所有进程
+func (e *apiDockerExecutor) PauseContainer(ctx context.Context, containerID string) error {
+	return e.client.ContainerPause(ctx, containerID)
+}
+
+// UnpauseContainer 恢复暂停的容器
+func (e *apiDockerExecutor) UnpauseContainer(ctx context.Context, containerID string) error {
+	return e.client.ContainerUnpause(ctx, containerID)
+}
+
+// GetContainerStatus 获取容器状态
+func (e *apiDockerExecutor) GetContainerStatus(ctx context.Context, containerID string) (string, error) {
+	info, err := e.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	if info.ContainerJSONBase == nil || info.State == nil {
+		return "", fmt.Errorf("container %s has no state", containerID)
+	}
+	health := ""
+	if info.State.Health != nil {
+		health = info.State.Health.Status
+	}
+	return containerStatus(info.State.Status, health), nil
+}
+
+// GetContainerInfo 获取容器信息
+func (e *apiDockerExecutor) GetContainerInfo(ctx context.Context, containerID string) (*ContainerInfo, error) {
+	info, err := e.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if info.ContainerJSONBase == nil || info.State == nil {
+		return nil, fmt.Errorf("container %s has no state", containerID)
+	}
+
+	result := &ContainerInfo{
+		ID:        info.ID,
+		Name:      strings.TrimPrefix(info.Name, "/"),
+		Status:    info.State.Status,
+		StartedAt: parseDockerTime(info.State.StartedAt),
+	}
+	if info.Config != nil {
+		result.Image = info.Config.Image
+		result.Labels = info.Config.Labels
+	}
+	if info.State.Health != nil {
+		result.Health = info.State.Health.Status
+	}
+	return result, nil
+}
+
+// InspectContainer 获取容器完整配置
+func (e *apiDockerExecutor) InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	info, err := e.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return types.ContainerJSON{}, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	return info, nil
+}
+
+// ExecInContainer 在容器内执行命令并等待结束，返回合并的输出和退出码
+func (e *apiDockerExecutor) ExecInContainer(ctx context.Context, containerID string, command []string) (string, int, error) {
+	created, err := e.client.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to create exec: %w", err)
+	}
+	attached, err := e.client.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to attach exec: %w", err)
+	}
+	defer attached.Close()
+
+	var output strings.Builder
+	if _, err := stdcopy.StdCopy(&output, &output, attached.Reader); err != nil {
+		return output.String(), -1, fmt.Errorf("failed to read exec output: %w", err)
+	}
+	inspect, err := e.client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return output.String(), -1, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	return output.String(), inspect.ExitCode, nil
+}
+
+// InspectImageConfig 获取镜像自带的容器配置
+func (e *apiDockerExecutor) InspectImageConfig(ctx context.Context, image string) (*container.Config, error) {
+	info, _, err := e.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image: %w", err)
+	}
+	if info.Config == nil {
+		return nil, fmt.Errorf("image %s has no config", image)
+	}
+	return info.Config, nil
+}
+
+// ListContainers 列出所有容器
+func (e *apiDockerExecutor) ListContainers(ctx context.Context) ([]ContainerSummary, error) {
+	containers, err := e.client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	result := make([]ContainerSummary, 0, len(containers))
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		summary := ContainerSummary{
+			ID:     shortID(c.ID),
+			Name:   name,
+			Image:  c.Image,
+			Status: c.Status,
+			State:  c.State,
+			Health: healthFromStatus(c.Status),
+			Labels: c.Labels,
+		}
+		for _, port := range c.Ports {
+			if port.PublicPort == 0 {
+				continue
+			}
+			summary.Ports = append(summary.Ports, PublishedPort{
+				HostIP:        port.IP,
+				HostPort:      int(port.PublicPort),
+				ContainerPort: int(port.PrivatePort),
+				Proto:         port.Type,
+			})
+		}
+		result = append(result, summary)
+	}
+	return result, nil
+}
+
+// networkName 项目网络的实际名称
+func networkName(projectName, name string, cfg *ComposeConfig) string {
+	if cfg != nil {
+		if def := cfg.Networks[name]; def != nil && def.Name != "" {
+			return def.Name
+		}
+	}
+	return projectResourceName(projectName, name)
+}
+
+// buildContainerSpec 将 compose 服务定义转换为 Docker API 的容器配置
+func buildContainerSpec(projectName, serviceName string, service *Service, cfg *ComposeConfig, number int) (
+	*container.Config, *container.HostConfig, *network.NetworkingConfig, error) {
+
+	labels := map[string]string{
+		composeProjectLabel: projectName,
+		composeServiceLabel: serviceName,
+		composeNumberLabel:  strconv.Itoa(number),
+	}
+	for k, v := range service.Labels {
+		labels[k] = v
+	}
+
+	exposed, bindings, err := nat.ParsePortSpecs(service.Ports)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid ports for service %s: %w", serviceName, err)
+	}
+
+	containerConfig := &container.Config{
+		Image:        service.Image,
+		Env:          environmentList(service.Environment),
+		Cmd:          commandList(service.Command),
+		Entrypoint:   commandList(service.Entrypoint),
+		Labels:       labels,
+		User:         service.User,
+		WorkingDir:   service.WorkingDir,
+		ExposedPorts: exposed,
+	}
+	if service.HealthCheck != nil {
+		healthcheck, err := buildHealthcheck(service.HealthCheck)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid healthcheck for service %s: %w", serviceName, err)
+		}
+		containerConfig.Healthcheck = healthcheck
+	}
+
+	var volumes map[string]*Volume
+	if cfg != nil {
+		volumes = cfg.Volumes
+	}
+	binds := make([]string, 0, len(service.Volumes))
+	for _, v := range service.Volumes {
+		binds = append(binds, projectVolumeBind(projectName, v, volumes))
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds:        binds,
+		PortBindings: bindings,
+		RestartPolicy: container.RestartPolicy{
+			Name: container.RestartPolicyMode(service.Restart),
+		},
+		ExtraHosts: service.ExtraHosts,
+		DNS:        stringList(service.DNS),
+		Privileged: service.Privileged,
+	}
+
+	networks := stringList(service.Networks)
+	if len(networks) == 0 {
+		networks = []string{"default"}
+	}
+	endpoints := make(map[string]*network.EndpointSettings, len(networks))
+	for _, name := range networks {
+		endpoints[networkName(projectName, name, cfg)] = &network.EndpointSettings{Aliases: []string{serviceName}}
+	}
+	// 创建容器时只能指定一个网络，多个网络由 Docker 25+ 支持，低版本需要在启动后再连接
+	hostConfig.NetworkMode = container.NetworkMode(networkName(projectName, networks[0], cfg))
+
+	return containerConfig, hostConfig, &network.NetworkingConfig{EndpointsConfig: endpoints}, nil
+}
+
+// buildHealthcheck 转换 compose 健康检查配置
+func buildHealthcheck(hc *HealthCheck) (*container.HealthConfig, error) {
+	result := &container.HealthConfig{Retries: hc.Retries}
+	switch test := hc.Test.(type) {
+	case string:
+		result.Test = []string{"CMD-SHELL", test}
+	default:
+		result.Test = stringList(test)
+	}
+
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{
+		{hc.Interval, &result.Interval},
+		{hc.Timeout, &result.Timeout},
+		{hc.StartPeriod, &result.StartPeriod},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, err
+		}
+		*d.target = parsed
+	}
+	return result, nil
+}
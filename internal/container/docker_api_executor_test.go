@@ -0,0 +1,406 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakeContainer Mock SDK 中的容器
+type fakeContainer struct {
+	id      string
+	name    string
+	config  *container.Config
+	host    *container.HostConfig
+	state   string
+	health  string
+	removed bool
+}
+
+// mockDockerAPI 内存中的 Docker SDK 客户端
+type mockDockerAPI struct {
+	containers []*fakeContainer
+	networks   []network.Summary
+	volumes    []string
+	pulled     []string
+	images     map[string]bool
+}
+
+func newMockDockerAPI() *mockDockerAPI {
+	return &mockDockerAPI{images: map[string]bool{}}
+}
+
+func (m *mockDockerAPI) find(id string) *fakeContainer {
+	for _, c := range m.containers {
+		if !c.removed && (c.id == id || c.name == id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *mockDockerAPI) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+	var result []types.Container
+	for _, c := range m.containers {
+		if c.removed {
+			continue
+		}
+		match := true
+		for _, label := range options.Filters.Get("label") {
+			key, value, _ := strings.Cut(label, "=")
+			if c.config.Labels[key] != value {
+				match = false
+			}
+		}
+		if match {
+			status := "Exited (0) 1 minute ago"
+			if c.state == "running" {
+				status = "Up 2 minutes"
+			}
+			result = append(result, types.Container{
+				ID: c.id, Names: []string{"/" + c.name}, Image: c.config.Image,
+				Status: status, State: c.state, Labels: c.config.Labels,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (m *mockDockerAPI) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	c := m.find(id)
+	if c == nil {
+		return types.ContainerJSON{}, errors.New("no such container")
+	}
+	state := &types.ContainerState{Status: c.state, StartedAt: "2024-01-01T00:00:00Z"}
+	if c.health != "" {
+		state.Health = &types.Health{Status: c.health}
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: c.id, Name: "/" + c.name, State: state},
+		Config:            c.config,
+	}, nil
+}
+
+func (m *mockDockerAPI) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	if m.find(name) != nil {
+		return container.CreateResponse{}, errors.New("name conflict")
+	}
+	id := strings.Repeat(string(rune('a'+len(m.containers))), 64)
+	m.containers = append(m.containers, &fakeContainer{id: id, name: name, config: config, host: hostConfig, state: "created"})
+	return container.CreateResponse{ID: id}, nil
+}
+
+func (m *mockDockerAPI) ContainerStart(ctx context.Context, id string, options container.StartOptions) error {
+	c := m.find(id)
+	if c == nil {
+		return errors.New("no such container")
+	}
+	c.state = "running"
+	return nil
+}
+
+func (m *mockDockerAPI) ContainerStop(ctx context.Context, id string, options container.StopOptions) error {
+	c := m.find(id)
+	if c == nil {
+		return errors.New("no such container")
+	}
+	c.state = "exited"
+	return nil
+}
+
+func (m *mockDockerAPI) ContainerRemove(ctx context.Context, id string, options container.RemoveOptions) error {
+	c := m.find(id)
+	if c == nil {
+		return errors.New("no such container")
+	}
+	c.removed = true
+	return nil
+}
+
+func (m *mockDockerAPI) ContainerPause(ctx context.Context, id string) error {
+	c := m.find(id)
+	if c == nil {
+		return errors.New("no such container")
+	}
+	c.state = "paused"
+	return nil
+}
+
+func (m *mockDockerAPI) ContainerUnpause(ctx context.Context, id string) error {
+	c := m.find(id)
+	if c == nil {
+		return errors.New("no such container")
+	}
+	c.state = "running"
+	return nil
+}
+
+func (m *mockDockerAPI) ImageInspectWithRaw(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+	if !m.images[ref] {
+		return types.ImageInspect{}, nil, errors.New("no such image")
+	}
+	return types.ImageInspect{ID: ref}, nil, nil
+}
+
+func (m *mockDockerAPI) ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+	m.pulled = append(m.pulled, ref)
+	m.images[ref] = true
+	return io.NopCloser(strings.NewReader(`{"status":"done"}`)), nil
+}
+
+func (m *mockDockerAPI) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	var result []network.Summary
+	for _, n := range m.networks {
+		match := true
+		for _, label := range options.Filters.Get("label") {
+			key, value, _ := strings.Cut(label, "=")
+			if n.Labels[key] != value {
+				match = false
+			}
+		}
+		if match {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockDockerAPI) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	m.networks = append(m.networks, network.Summary{ID: "net-" + name, Name: name, Labels: options.Labels})
+	return network.CreateResponse{ID: "net-" + name}, nil
+}
+
+func (m *mockDockerAPI) NetworkRemove(ctx context.Context, id string) error {
+	for i, n := range m.networks {
+		if n.ID == id {
+			m.networks = append(m.networks[:i], m.networks[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such network")
+}
+
+func (m *mockDockerAPI) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	m.volumes = append(m.volumes, options.Name)
+	return volume.Volume{Name: options.Name}, nil
+}
+
+func (m *mockDockerAPI) ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (types.IDResponse, error) {
+	return types.IDResponse{}, errors.New("exec is not supported by the mock")
+}
+
+func (m *mockDockerAPI) ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+	return types.HijackedResponse{}, errors.New("exec is not supported by the mock")
+}
+
+func (m *mockDockerAPI) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	return container.ExecInspect{}, errors.New("exec is not supported by the mock")
+}
+
+const testAPICompose = `
+version: "3.8"
+services:
+  web:
+    image: nginx:1.25
+    ports:
+      - "8080:80"
+    depends_on:
+      - db
+    environment:
+      MODE: prod
+  db:
+    image: postgres:16
+    restart: unless-stopped
+    volumes:
+      - pgdata:/var/lib/postgresql/data
+    healthcheck:
+      test: pg_isready
+      interval: 10s
+      retries: 3
+volumes:
+  pgdata:
+`
+
+func TestAPIDockerExecutor_StartProject(t *testing.T) {
+	api := newMockDockerAPI()
+	api.images["postgres:16"] = true
+	executor := newAPIDockerExecutor(api)
+	ctx := context.Background()
+
+	if err := executor.StartProject(ctx, "shop", testAPICompose); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+
+	if len(api.containers) != 2 || api.containers[0].name != "shop-db-1" || api.containers[1].name != "shop-web-1" {
+		t.Fatalf("Expected db to be created before web, got %+v", api.containers)
+	}
+	if len(api.pulled) != 1 || api.pulled[0] != "nginx:1.25" {
+		t.Errorf("Expected only missing image to be pulled, got %v", api.pulled)
+	}
+	if len(api.networks) != 1 || api.networks[0].Name != "shop_default" {
+		t.Errorf("Expected project default network, got %+v", api.networks)
+	}
+	if len(api.volumes) != 1 || api.volumes[0] != "shop_pgdata" {
+		t.Errorf("Expected project volume, got %v", api.volumes)
+	}
+
+	db, web := api.containers[0], api.containers[1]
+	if db.host.Binds[0] != "shop_pgdata:/var/lib/postgresql/data" || db.host.RestartPolicy.Name != "unless-stopped" {
+		t.Errorf("Unexpected db host config: %+v", db.host)
+	}
+	if db.config.Healthcheck == nil || db.config.Healthcheck.Test[0] != "CMD-SHELL" || db.config.Healthcheck.Retries != 3 {
+		t.Errorf("Unexpected db healthcheck: %+v", db.config.Healthcheck)
+	}
+	if web.config.Env[0] != "MODE=prod" || len(web.host.PortBindings) != 1 {
+		t.Errorf("Unexpected web config: env=%v ports=%v", web.config.Env, web.host.PortBindings)
+	}
+
+	// 再次启动时复用已有容器
+	executor.StopProject(ctx, "shop")
+	if err := executor.StartProject(ctx, "shop", testAPICompose); err != nil {
+		t.Fatalf("Second StartProject failed: %v", err)
+	}
+	if len(api.containers) != 2 || web.state != "running" {
+		t.Errorf("Expected existing containers to be restarted, got %d containers", len(api.containers))
+	}
+
+	ids, _ := executor.GetServiceContainers(ctx, "", "web")
+	if len(ids) != 1 || ids[0] != web.id {
+		t.Errorf("Expected web container by service label, got %v", ids)
+	}
+
+	if err := executor.RemoveProject(ctx, "shop"); err != nil {
+		t.Fatalf("RemoveProject failed: %v", err)
+	}
+	if ids, _ := executor.GetServiceContainers(ctx, "shop", ""); len(ids) != 0 || len(api.networks) != 0 {
+		t.Errorf("Expected containers and networks to be removed, got %v / %+v", ids, api.networks)
+	}
+}
+
+func TestAPIDockerExecutor_StatusAndInfo(t *testing.T) {
+	api := newMockDockerAPI()
+	api.images["redis:7"] = true
+	executor := newAPIDockerExecutor(api)
+	ctx := context.Background()
+
+	id, err := executor.StartService(ctx, "cache", "redis", &Service{Image: "redis:7"})
+	if err != nil {
+		t.Fatalf("StartService failed: %v", err)
+	}
+
+	if status, _ := executor.GetContainerStatus(ctx, id); status != "running" {
+		t.Errorf("Expected running, got %s", status)
+	}
+	api.containers[0].health = "starting"
+	if status, _ := executor.GetContainerStatus(ctx, id); status != "starting" {
+		t.Errorf("Expected health status to take precedence, got %s", status)
+	}
+
+	info, err := executor.GetContainerInfo(ctx, id)
+	if err != nil || info.Name != "cache-redis-1" || info.Image != "redis:7" || info.StartedAt == nil {
+		t.Errorf("Unexpected container info: %+v, %v", info, err)
+	}
+	if info.Labels[composeServiceLabel] != "redis" {
+		t.Errorf("Expected compose labels, got %v", info.Labels)
+	}
+
+	// 滚动更新时新实例编号递增
+	second, _ := executor.StartService(ctx, "cache", "redis", &Service{Image: "redis:7"})
+	if api.find(second).name != "cache-redis-2" {
+		t.Errorf("Expected second instance name cache-redis-2, got %s", api.find(second).name)
+	}
+
+	list, _ := executor.ListContainers(ctx)
+	if len(list) != 2 || list[0].Name != "cache-redis-1" || len(list[0].ID) != 12 || list[0].State != "running" {
+		t.Errorf("Unexpected container list: %+v", list)
+	}
+}
+
+// roundTripFunc 以函数实现 HTTP 传输，模拟 Docker Engine API
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestAPIDockerExecutor_MockTransport(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	var requests []string
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		status, body := http.StatusOK, ""
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1.43/containers/json":
+			body = `[{"Id":"` + id + `","Names":["/shop-web-1"],"Image":"nginx:1.25","State":"running","Status":"Up 5 minutes (healthy)",` +
+				`"Ports":[{"IP":"0.0.0.0","PrivatePort":80,"PublicPort":8080,"Type":"tcp"}]}]`
+		case "GET /v1.43/containers/shop-web-1/json":
+			body = `{"Id":"` + id + `","Name":"/shop-web-1","State":{"Status":"running","StartedAt":"2026-03-01T12:00:00Z","Health":{"Status":"healthy"}},"Config":{"Image":"nginx:1.25"}}`
+		case "POST /v1.43/containers/shop-web-1/stop", "POST /v1.43/containers/shop-web-1/start":
+			status = http.StatusNoContent
+		default:
+			status, body = http.StatusNotFound, `{"message":"No such container"}`
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{"Content-Type": {"application/json"}}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://docker.invalid:2375"), client.WithVersion("1.43"), client.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := newAPIDockerExecutor(cli)
+	ctx := context.Background()
+
+	list, err := executor.ListContainers(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != id[:12] || list[0].Name != "shop-web-1" || list[0].Health != "healthy" || len(list[0].Ports) != 1 {
+		t.Fatalf("Unexpected container list: %+v, %v", list, err)
+	}
+	if status, err := executor.GetContainerStatus(ctx, "shop-web-1"); err != nil || status != "healthy" {
+		t.Errorf("Expected the health status used by deployment health waits, got %q, %v", status, err)
+	}
+	if info, err := executor.GetContainerInfo(ctx, "shop-web-1"); err != nil || info.ID != id || info.StartedAt == nil {
+		t.Errorf("Unexpected container info: %+v, %v", info, err)
+	}
+	if err := executor.StopContainer(ctx, "shop-web-1"); err != nil {
+		t.Errorf("StopContainer failed: %v", err)
+	}
+	if err := executor.StartContainer(ctx, "shop-web-1"); err != nil {
+		t.Errorf("StartContainer failed: %v", err)
+	}
+	if _, err := executor.GetContainerStatus(ctx, "missing"); !client.IsErrNotFound(err) {
+		t.Errorf("Expected a not found error for an unknown container, got %v", err)
+	}
+	if got := strings.Join(requests, ", "); !strings.Contains(got, "POST /v1.43/containers/shop-web-1/stop, POST /v1.43/containers/shop-web-1/start") {
+		t.Errorf("Expected the stop and start requests to reach the API, got %s", got)
+	}
+}
+
+func TestAPIDockerExecutor_BuildNotSupported(t *testing.T) {
+	executor := newAPIDockerExecutor(newMockDockerAPI())
+	_, err := executor.StartService(context.Background(), "app", "api", &Service{Build: &BuildConfig{Context: "."}})
+	if !errors.Is(err, errBuildNotSupported) {
+		t.Errorf("Expected errBuildNotSupported, got %v", err)
+	}
+}
+
+func TestHealthFromStatus(t *testing.T) {
+	tests := map[string]string{
+		"Up 2 hours (healthy)":            "healthy",
+		"Up 5 seconds (health: starting)": "starting",
+		"Up 1 minute (unhealthy)":         "unhealthy",
+		"Exited (1) 3 minutes ago":        "",
+	}
+	for status, want := range tests {
+		if got := healthFromStatus(status); got != want {
+			t.Errorf("healthFromStatus(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
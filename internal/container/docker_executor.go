@@ -2,7 +2,21 @@ package container
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 )
 
 // DockerExecutor Docker 执行器接口
@@ -12,12 +26,12 @@ type DockerExecutor interface {
 	StartProject(ctx context.Context, projectName, composeContent string) error
 	StopProject(ctx context.Context, projectName string) error
 	RemoveProject(ctx context.Context, projectName string) error
-	
+
 	// 服务级操作
 	StartService(ctx context.Context, projectName, serviceName string, service *Service) (containerID string, err error)
 	StopService(ctx context.Context, projectName, serviceName string) error
 	GetServiceContainers(ctx context.Context, projectName, serviceName string) ([]string, error)
-	
+
 	// 容器级操作
 	StartContainer(ctx context.Context, containerID string) error
 	StopContainer(ctx context.Context, containerID string) error
@@ -26,112 +40,663 @@ type DockerExecutor interface {
 	GetContainerInfo(ctx context.Context, containerID string) (*ContainerInfo, error)
 }
 
+// JobRunner 以项目中某个服务的定义运行一次性任务（如数据库迁移），返回任务输出
+// 执行器未实现时流水线回退到 docker CLI
+type JobRunner interface {
+	RunJob(ctx context.Context, projectName, composeContent, serviceName string, command []string) (string, error)
+}
+
+// ContainerLister 列出主机上的所有容器，供容器列表页使用
+type ContainerLister interface {
+	ListContainers(ctx context.Context) ([]ContainerSummary, error)
+}
+
+// ContainerOperator 容器列表页的管理操作，两种执行器都实现
+type ContainerOperator interface {
+	PauseContainer(ctx context.Context, containerID string) error
+	UnpauseContainer(ctx context.Context, containerID string) error
+	// RemoveContainerAndVolumes 强制删除容器及其匿名卷
+	RemoveContainerAndVolumes(ctx context.Context, containerID string) error
+	InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error)
+}
+
 // ContainerInfo 容器信息
 type ContainerInfo struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	Image     string     `json:"image"`
-	Status    string     `json:"status"`
-	Health    string     `json:"health"`
-	StartedAt *time.Time `json:"started_at"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Image     string            `json:"image"`
+	Status    string            `json:"status"`
+	Health    string            `json:"health"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	StartedAt *time.Time        `json:"started_at"`
+}
+
+// ContainerSummary 容器列表项
+type ContainerSummary struct {
+	ID     string            `json:"id"`     // 短 ID（12 位）
+	Name   string            `json:"name"`   // 容器名称（不含前导 /）
+	Image  string            `json:"image"`  // 镜像
+	Status string            `json:"status"` // 状态描述，如 "Up 2 hours"
+	State  string            `json:"state"`  // 运行状态，如 running、exited
+	Health string            `json:"health"` // 健康检查状态，未配置时为空
+	Labels map[string]string `json:"labels,omitempty"`
+	Ports  []PublishedPort   `json:"ports,omitempty"` // 发布到主机的端口
 }
 
-// dockerExecutorImpl Docker 执行器实现
-// 这是一个基于 docker-compose 命令行的简单实现
-type dockerExecutorImpl struct {
-	// 可以在这里添加 Docker 客户端或其他依赖
+// PublishedPort 容器发布到主机的端口
+type PublishedPort struct {
+	HostIP        string `json:"host_ip"` // 监听地址，0.0.0.0 或 :: 表示所有网卡
+	HostPort      int    `json:"host_port"`
+	ContainerPort int    `json:"container_port"`
+	Proto         string `json:"proto"`
 }
 
+// Docker Compose 使用的标签，两种执行器创建的容器都遵循该约定
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeNumberLabel  = "com.docker.compose.container-number"
+)
+
+// Docker 执行器后端
+const (
+	DockerBackendAPI = "api"
+	DockerBackendCLI = "cli"
+)
+
 // NewDockerExecutor 创建 Docker 执行器实例
+// 默认通过 Docker Engine API（DOCKER_HOST 或本地 socket）操作，
+// 配置 docker_backend: cli 或 API 客户端创建失败时回退到 docker CLI
 func NewDockerExecutor() DockerExecutor {
-	return &dockerExecutorImpl{}
+	if config.Current().DockerBackend == DockerBackendCLI {
+		return NewCLIDockerExecutor()
+	}
+
+	executor, err := NewAPIDockerExecutor()
+	if err != nil {
+		logger.Info("⚠️ Docker API 客户端初始化失败，回退到 docker CLI: %v", err)
+		return NewCLIDockerExecutor()
+	}
+	return executor
+}
+
+// cliDockerExecutor 基于 docker / docker compose 命令行的执行器
+type cliDockerExecutor struct{}
+
+// NewCLIDockerExecutor 创建基于 docker CLI 的执行器
+func NewCLIDockerExecutor() DockerExecutor {
+	return &cliDockerExecutor{}
+}
+
+// run 执行 docker 命令，失败时返回包含 stderr 的错误
+func (e *cliDockerExecutor) run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// writeComposeFile 将 compose 内容写入临时文件，调用方负责删除
+func writeComposeFile(composeContent string) (string, error) {
+	file, err := os.CreateTemp("", "qwq-compose-*.yml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create compose file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(composeContent); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write compose file: %w", err)
+	}
+	return file.Name(), nil
 }
 
 // StartProject 启动项目
-func (e *dockerExecutorImpl) StartProject(ctx context.Context, projectName, composeContent string) error {
-	// TODO: 实现实际的 Docker Compose 启动逻辑
-	// 1. 将 composeContent 写入临时文件
-	// 2. 执行 docker-compose -p projectName -f tempfile up -d
-	// 3. 清理临时文件
-	return nil
+func (e *cliDockerExecutor) StartProject(ctx context.Context, projectName, composeContent string) error {
+	path, err := writeComposeFile(composeContent)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	_, err = e.run(ctx, "compose", "-p", projectName, "-f", path, "up", "-d", "--remove-orphans")
+	return err
+}
+
+// RunJob 以 docker compose run 运行一次性任务，结束后删除容器
+func (e *cliDockerExecutor) RunJob(ctx context.Context, projectName, composeContent, serviceName string, command []string) (string, error) {
+	path, err := writeComposeFile(composeContent)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+
+	args := []string{"compose", "-p", projectName, "-f", path, "run", "--rm", "-T", serviceName}
+	return e.run(ctx, append(args, command...)...)
 }
 
 // StopProject 停止项目
-func (e *dockerExecutorImpl) StopProject(ctx context.Context, projectName string) error {
-	// TODO: 实现实际的 Docker Compose 停止逻辑
-	// 执行 docker-compose -p projectName stop
-	return nil
+func (e *cliDockerExecutor) StopProject(ctx context.Context, projectName string) error {
+	ids, err := e.listByLabels(ctx, projectName, "")
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	_, err = e.run(ctx, append([]string{"stop"}, ids...)...)
+	return err
 }
 
-// RemoveProject 删除项目
-func (e *dockerExecutorImpl) RemoveProject(ctx context.Context, projectName string) error {
-	// TODO: 实现实际的 Docker Compose 删除逻辑
-	// 执行 docker-compose -p projectName down
-	return nil
+// RemoveProject 删除项目（保留数据卷）
+func (e *cliDockerExecutor) RemoveProject(ctx context.Context, projectName string) error {
+	ids, err := e.listByLabels(ctx, projectName, "")
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		if _, err := e.run(ctx, append([]string{"rm", "-f"}, ids...)...); err != nil {
+			return err
+		}
+	}
+
+	networks, err := e.run(ctx, "network", "ls", "-q", "--filter", "label="+composeProjectLabel+"="+projectName)
+	if err != nil || networks == "" {
+		return err
+	}
+	_, err = e.run(ctx, append([]string{"network", "rm"}, strings.Fields(networks)...)...)
+	return err
 }
 
-// StartService 启动服务
-func (e *dockerExecutorImpl) StartService(ctx context.Context, projectName, serviceName string, 
+// StartService 以 docker run 启动一个服务实例，返回容器 ID
+func (e *cliDockerExecutor) StartService(ctx context.Context, projectName, serviceName string,
 	service *Service) (string, error) {
-	// TODO: 实现实际的服务启动逻辑
-	// 1. 创建容器
-	// 2. 启动容器
-	// 3. 返回容器ID
-	return "mock-container-id", nil
+	if service == nil || service.Image == "" {
+		return "", fmt.Errorf("service %s has no image", serviceName)
+	}
+
+	existing, err := e.listByLabels(ctx, projectName, serviceName)
+	if err != nil {
+		return "", err
+	}
+	number := len(existing) + 1
+
+	args := []string{"run", "-d",
+		"--name", serviceContainerName(projectName, serviceName, service, number),
+		"--label", composeProjectLabel + "=" + projectName,
+		"--label", composeServiceLabel + "=" + serviceName,
+		"--label", fmt.Sprintf("%s=%d", composeNumberLabel, number),
+	}
+	for _, key := range sortedKeys(service.Labels) {
+		args = append(args, "--label", key+"="+service.Labels[key])
+	}
+	for _, env := range environmentList(service.Environment) {
+		args = append(args, "-e", env)
+	}
+	for _, port := range service.Ports {
+		args = append(args, "-p", port)
+	}
+	for _, volume := range service.Volumes {
+		args = append(args, "-v", projectVolumeBind(projectName, volume, nil))
+	}
+	for _, host := range service.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+	for _, dns := range stringList(service.DNS) {
+		args = append(args, "--dns", dns)
+	}
+	if networks := stringList(service.Networks); len(networks) > 0 {
+		args = append(args, "--network", projectResourceName(projectName, networks[0]))
+	}
+	if service.Restart != "" {
+		args = append(args, "--restart", service.Restart)
+	}
+	if service.User != "" {
+		args = append(args, "--user", service.User)
+	}
+	if service.WorkingDir != "" {
+		args = append(args, "--workdir", service.WorkingDir)
+	}
+	if service.Privileged {
+		args = append(args, "--privileged")
+	}
+	entrypoint := commandList(service.Entrypoint)
+	if len(entrypoint) > 0 {
+		args = append(args, "--entrypoint", entrypoint[0])
+	}
+	args = append(args, service.Image)
+	if len(entrypoint) > 1 {
+		args = append(args, entrypoint[1:]...)
+	}
+	args = append(args, commandList(service.Command)...)
+
+	return e.run(ctx, args...)
 }
 
-// StopService 停止服务
-func (e *dockerExecutorImpl) StopService(ctx context.Context, projectName, serviceName string) error {
-	// TODO: 实现实际的服务停止逻辑
-	return nil
+// StopService 停止服务的所有容器
+func (e *cliDockerExecutor) StopService(ctx context.Context, projectName, serviceName string) error {
+	ids, err := e.listByLabels(ctx, projectName, serviceName)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	_, err = e.run(ctx, append([]string{"stop"}, ids...)...)
+	return err
+}
+
+// GetServiceContainers 获取服务的所有容器，projectName 为空时匹配所有项目
+func (e *cliDockerExecutor) GetServiceContainers(ctx context.Context, projectName, serviceName string) ([]string, error) {
+	return e.listByLabels(ctx, projectName, serviceName)
 }
 
-// GetServiceContainers 获取服务的所有容器
-func (e *dockerExecutorImpl) GetServiceContainers(ctx context.Context, projectName, serviceName string) ([]string, error) {
-	// TODO: 实现实际的容器查询逻辑
-	// 执行 docker ps --filter label=com.docker.compose.project=projectName --filter label=com.docker.compose.service=serviceName
-	return []string{}, nil
+// listByLabels 按 compose 标签查询容器 ID
+func (e *cliDockerExecutor) listByLabels(ctx context.Context, projectName, serviceName string) ([]string, error) {
+	args := []string{"ps", "-a", "-q", "--no-trunc"}
+	if projectName != "" {
+		args = append(args, "--filter", "label="+composeProjectLabel+"="+projectName)
+	}
+	if serviceName != "" {
+		args = append(args, "--filter", "label="+composeServiceLabel+"="+serviceName)
+	}
+	out, err := e.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
 }
 
 // StartContainer 启动容器
-func (e *dockerExecutorImpl) StartContainer(ctx context.Context, containerID string) error {
-	// TODO: 实现实际的容器启动逻辑
-	// 执行 docker start containerID
-	return nil
+func (e *cliDockerExecutor) StartContainer(ctx context.Context, containerID string) error {
+	_, err := e.run(ctx, "start", containerID)
+	return err
 }
 
 // StopContainer 停止容器
-func (e *dockerExecutorImpl) StopContainer(ctx context.Context, containerID string) error {
-	// TODO: 实现实际的容器停止逻辑
-	// 执行 docker stop containerID
-	return nil
+func (e *cliDockerExecutor) StopContainer(ctx context.Context, containerID string) error {
+	_, err := e.run(ctx, "stop", containerID)
+	return err
 }
 
 // RemoveContainer 删除容器
-func (e *dockerExecutorImpl) RemoveContainer(ctx context.Context, containerID string) error {
-	// TODO: 实现实际的容器删除逻辑
-	// 执行 docker rm containerID
-	return nil
+func (e *cliDockerExecutor) RemoveContainer(ctx context.Context, containerID string) error {
+	_, err := e.run(ctx, "rm", "-f", containerID)
+	return err
+}
+
+// RemoveContainerAndVolumes 强制删除容器及其匿名卷
+func (e *cliDockerExecutor) RemoveContainerAndVolumes(ctx context.Context, containerID string) error {
+	_, err := e.run(ctx, "rm", "-f", "-v", containerID)
+	return err
+}
+
+// PauseContainer 暂停容器中的所有进程
+func (e *cliDockerExecutor) PauseContainer(ctx context.Context, containerID string) error {
+	_, err := e.run(ctx, "pause", containerID)
+	return err
+}
+
+// UnpauseContainer 恢复暂停的容器
+func (e *cliDockerExecutor) UnpauseContainer(ctx context.Context, containerID string) error {
+	_, err := e.run(ctx, "unpause", containerID)
+	return err
+}
+
+// cliInspect docker inspect 输出中用到的字段
+type cliInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status    string `json:"Status"`
+		StartedAt string `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+func (e *cliDockerExecutor) inspect(ctx context.Context, containerID string) (*cliInspect, error) {
+	out, err := e.run(ctx, "inspect", "--type", "container", containerID)
+	if err != nil {
+		return nil, err
+	}
+	var result []cliInspect
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse docker inspect output: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("container %s not found", containerID)
+	}
+	return &result[0], nil
 }
 
 // GetContainerStatus 获取容器状态
-func (e *dockerExecutorImpl) GetContainerStatus(ctx context.Context, containerID string) (string, error) {
-	// TODO: 实现实际的状态查询逻辑
-	// 执行 docker inspect --format='{{.State.Status}}' containerID
-	return "running", nil
+func (e *cliDockerExecutor) GetContainerStatus(ctx context.Context, containerID string) (string, error) {
+	info, err := e.inspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	health := ""
+	if info.State.Health != nil {
+		health = info.State.Health.Status
+	}
+	return containerStatus(info.State.Status, health), nil
 }
 
 // GetContainerInfo 获取容器信息
-func (e *dockerExecutorImpl) GetContainerInfo(ctx context.Context, containerID string) (*ContainerInfo, error) {
-	// TODO: 实现实际的容器信息查询逻辑
-	// 执行 docker inspect containerID
-	now := time.Now()
-	return &ContainerInfo{
-		ID:        containerID,
-		Name:      "mock-container",
-		Image:     "mock-image:latest",
-		Status:    "running",
-		Health:    "healthy",
-		StartedAt: &now,
-	}, nil
+func (e *cliDockerExecutor) GetContainerInfo(ctx context.Context, containerID string) (*ContainerInfo, error) {
+	info, err := e.inspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	result := &ContainerInfo{
+		ID:        info.ID,
+		Name:      strings.TrimPrefix(info.Name, "/"),
+		Image:     info.Config.Image,
+		Status:    info.State.Status,
+		Labels:    info.Config.Labels,
+		StartedAt: parseDockerTime(info.State.StartedAt),
+	}
+	if info.State.Health != nil {
+		result.Health = info.State.Health.Status
+	}
+	return result, nil
+}
+
+// InspectContainer 获取容器完整配置
+func (e *cliDockerExecutor) InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	out, err := e.run(ctx, "inspect", "--type", "container", containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	var result []types.ContainerJSON
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return types.ContainerJSON{}, fmt.Errorf("failed to parse docker inspect output: %w", err)
+	}
+	if len(result) == 0 {
+		return types.ContainerJSON{}, fmt.Errorf("container %s not found", containerID)
+	}
+	return result[0], nil
+}
+
+// ExecInContainer 通过 docker exec 在容器内执行命令，命令以非零状态退出时返回退出码而不是错误
+func (e *cliDockerExecutor) ExecInContainer(ctx context.Context, containerID string, command []string) (string, int, error) {
+	out, err := exec.CommandContext(ctx, "docker", append([]string{"exec", containerID}, command...)...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return string(out), -1, fmt.Errorf("docker exec: %w", err)
+	}
+	return string(out), 0, nil
+}
+
+// InspectImageConfig 获取镜像自带的容器配置
+func (e *cliDockerExecutor) InspectImageConfig(ctx context.Context, image string) (*container.Config, error) {
+	out, err := e.run(ctx, "image", "inspect", image)
+	if err != nil {
+		return nil, err
+	}
+	var result []types.ImageInspect
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse docker image inspect output: %w", err)
+	}
+	if len(result) == 0 || result[0].Config == nil {
+		return nil, fmt.Errorf("image %s not found", image)
+	}
+	return result[0].Config, nil
+}
+
+// ListContainers 列出所有容器
+// 使用 JSON 格式输出，容器名称中包含任意字符也能正确解析
+func (e *cliDockerExecutor) ListContainers(ctx context.Context) ([]ContainerSummary, error) {
+	out, err := e.run(ctx, "ps", "-a", "--no-trunc", "--format", "{{json .}}")
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []ContainerSummary
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var item struct {
+			ID     string `json:"ID"`
+			Image  string `json:"Image"`
+			Names  string `json:"Names"`
+			Status string `json:"Status"`
+			State  string `json:"State"`
+			Labels string `json:"Labels"`
+			Ports  string `json:"Ports"`
+		}
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, fmt.Errorf("failed to parse docker ps output: %w", err)
+		}
+		containers = append(containers, ContainerSummary{
+			ID:     shortID(item.ID),
+			Name:   item.Names,
+			Image:  item.Image,
+			Status: item.Status,
+			State:  item.State,
+			Health: healthFromStatus(item.Status),
+			Labels: parseLabelList(item.Labels),
+			Ports:  parsePortList(item.Ports),
+		})
+	}
+	return containers, nil
+}
+
+// parsePortList 解析 docker ps 输出的 "0.0.0.0:8080->80/tcp, :::8080->80/tcp, 443/tcp"，只返回发布到主机的端口
+func parsePortList(ports string) []PublishedPort {
+	var result []PublishedPort
+	for _, item := range strings.Split(ports, ",") {
+		host, target, ok := strings.Cut(strings.TrimSpace(item), "->")
+		if !ok {
+			continue
+		}
+		sep := strings.LastIndex(host, ":")
+		if sep < 0 {
+			continue
+		}
+		containerPort, proto, _ := strings.Cut(target, "/")
+		hostPort, err1 := strconv.Atoi(host[sep+1:])
+		port, err2 := strconv.Atoi(containerPort)
+		if err1 != nil || err2 != nil {
+			// 端口范围等格式不展开
+			continue
+		}
+		if proto == "" {
+			proto = "tcp"
+		}
+		result = append(result, PublishedPort{HostIP: host[:sep], HostPort: hostPort, ContainerPort: port, Proto: proto})
+	}
+	return result
+}
+
+// containerStatus 将容器状态和健康检查状态合并为部署流程使用的状态
+// 配置了健康检查时返回 healthy/unhealthy/starting，否则返回容器状态
+func containerStatus(state, health string) string {
+	if state == "running" && health != "" && health != "none" {
+		return health
+	}
+	return state
+}
+
+// healthFromStatus 从 "Up 2 hours (healthy)" 形式的状态描述中提取健康状态
+func healthFromStatus(status string) string {
+	for _, health := range []string{"unhealthy", "healthy", "health: starting"} {
+		if strings.Contains(status, "("+health+")") {
+			return strings.TrimPrefix(health, "health: ")
+		}
+	}
+	return ""
+}
+
+// parseLabelList 解析 docker ps 输出的 "k1=v1,k2=v2" 标签
+func parseLabelList(labels string) map[string]string {
+	if labels == "" {
+		return nil
+	}
+	result := make(map[string]string)
+	for _, pair := range strings.Split(labels, ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func parseDockerTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.IsZero() || t.Year() <= 1 {
+		return nil
+	}
+	return &t
 }
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// serviceContainerName 服务容器名称，遵循 compose 的 <project>-<service>-<n> 约定
+func serviceContainerName(projectName, serviceName string, service *Service, number int) string {
+	if service.ContainerName != "" && number == 1 {
+		return service.ContainerName
+	}
+	return fmt.Sprintf("%s-%s-%d", projectName, serviceName, number)
+}
+
+// projectResourceName 项目内网络、卷的实际名称
+func projectResourceName(projectName, name string) string {
+	return projectName + "_" + name
+}
+
+// projectVolumeBind 将 compose 卷声明转换为 docker 的 bind 格式
+// 命名卷加上项目前缀（external 卷或自定义 name 的卷除外），宿主机路径保持不变
+func projectVolumeBind(projectName, volume string, volumes map[string]*Volume) string {
+	source, rest, ok := strings.Cut(volume, ":")
+	if !ok || source == "" || strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") {
+		return volume
+	}
+	if def, exists := volumes[source]; exists && def != nil {
+		if def.Name != "" {
+			return def.Name + ":" + rest
+		}
+		if def.External {
+			return volume
+		}
+	}
+	return projectResourceName(projectName, source) + ":" + rest
+}
+
+// environmentList 将 compose 环境变量（数组或映射）转换为 KEY=VALUE 列表
+func environmentList(env interface{}) []string {
+	switch v := env.(type) {
+	case []interface{}:
+		return stringList(v)
+	case []string:
+		return v
+	case map[string]interface{}:
+		result := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			if v[key] == nil {
+				result = append(result, key)
+			} else {
+				result = append(result, fmt.Sprintf("%s=%v", key, v[key]))
+			}
+		}
+		return result
+	case map[string]string:
+		result := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			result = append(result, key+"="+v[key])
+		}
+		return result
+	}
+	return nil
+}
+
+// commandList 将 compose 命令（字符串或数组）转换为参数列表
+func commandList(cmd interface{}) []string {
+	if s, ok := cmd.(string); ok {
+		return strings.Fields(s)
+	}
+	return stringList(cmd)
+}
+
+// stringList 将字符串、数组或映射（取键）转换为字符串列表
+func stringList(v interface{}) []string {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			result = append(result, fmt.Sprint(item))
+		}
+		return result
+	case map[string]interface{}:
+		return sortedKeys(value)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serviceStartOrder 按 depends_on 对服务排序，存在循环依赖时返回错误
+func serviceStartOrder(services map[string]*Service) ([]string, error) {
+	var order []string
+	state := make(map[string]int) // 0 未访问，1 访问中，2 已完成
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("circular dependency at service %s", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		if service := services[name]; service != nil {
+			for _, dep := range stringList(service.DependsOn) {
+				if _, ok := services[dep]; ok {
+					if err := visit(dep); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range sortedKeys(services) {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// errBuildNotSupported API 执行器不支持 build，需要使用 CLI 后端
+var errBuildNotSupported = errors.New("service build is not supported by the api docker backend, use docker_backend: cli")
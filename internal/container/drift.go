@@ -0,0 +1,54 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"qwq/internal/drift"
+)
+
+// ErrInvalidComposeImport 手工修改后的 compose 文件没有通过校验，不能作为新修订导入
+var ErrInvalidComposeImport = errors.New("external compose changes are invalid")
+
+// composeFilePath 部署时写入的 compose 项目文件路径，目录名带项目 ID，不同租户的同名项目互不覆盖
+func composeFilePath(project *ComposeProject) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(project.Name)
+	return filepath.Join(drift.ComposeDir(), fmt.Sprintf("%d-%s", project.ID, name), "docker-compose.yml")
+}
+
+func composeDriftFile(project *ComposeProject) drift.File {
+	return drift.File{
+		Path:  composeFilePath(project),
+		Kind:  drift.KindCompose,
+		Owner: project.Name,
+		Ref:   strconv.FormatUint(uint64(project.ID), 10),
+	}
+}
+
+// NewComposeDriftHandler compose 项目文件被手工修改后的处理方式：保留时校验外部内容并保存为项目的新修订
+func NewComposeDriftHandler(composeService ComposeService) drift.Handler {
+	return drift.Handler{
+		Import: func(ctx context.Context, file drift.File, external, actor string) error {
+			id, err := strconv.ParseUint(file.Ref, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrProjectNotFound, file.Owner)
+			}
+			result, err := composeService.SaveProjectContent(ctx, uint(id), external, actor, "import external changes to "+file.Path)
+			if err != nil {
+				return err
+			}
+			if !result.Valid {
+				messages := make([]string, 0, len(result.Errors))
+				for _, e := range result.Errors {
+					messages = append(messages, fmt.Sprintf("line %d: %s", e.Line, e.Message))
+				}
+				return fmt.Errorf("%w: %s", ErrInvalidComposeImport, strings.Join(messages, "; "))
+			}
+			return nil
+		},
+	}
+}
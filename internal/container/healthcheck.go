@@ -0,0 +1,231 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrServiceNotFound Compose 文件中不存在指定服务
+	ErrServiceNotFound = errors.New("compose service not found")
+	// ErrHealthCheckExists 服务已配置健康检查
+	ErrHealthCheckExists = errors.New("service already has a healthcheck")
+	// ErrNoHealthCheckSuggestion 镜像无法识别且没有暴露端口，无法生成健康检查
+	ErrNoHealthCheckSuggestion = errors.New("cannot suggest a healthcheck: unknown image and no exposed port")
+)
+
+// 生成的健康检查类型
+const (
+	HealthCheckKindNginx    = "nginx"
+	HealthCheckKindHTTP     = "http"
+	HealthCheckKindMySQL    = "mysql"
+	HealthCheckKindMariaDB  = "mariadb"
+	HealthCheckKindPostgres = "postgres"
+	HealthCheckKindRedis    = "redis"
+	HealthCheckKindMongo    = "mongo"
+	HealthCheckKindRabbitMQ = "rabbitmq"
+	HealthCheckKindTCP      = "tcp"
+)
+
+// httpServerImages 默认提供 HTTP 服务的镜像及其默认端口
+var httpServerImages = map[string]string{
+	"httpd":  "80",
+	"caddy":  "80",
+	"tomcat": "8080",
+}
+
+// httpPorts 通用应用暴露这些端口时按 HTTP 服务处理，其余端口只做 TCP 检查
+var httpPorts = map[string]bool{
+	"80": true, "3000": true, "5000": true, "8000": true, "8080": true, "8081": true, "8888": true, "9000": true,
+}
+
+// HealthCheckSuggestion 为缺少健康检查的服务生成的建议配置
+type HealthCheckSuggestion struct {
+	Service     string       `json:"service"`        // 服务名称
+	Kind        string       `json:"kind"`           // 检查类型，如 postgres、http、tcp
+	Port        string       `json:"port,omitempty"` // 检查的容器端口
+	HealthCheck *HealthCheck `json:"healthcheck"`    // 建议的健康检查配置
+	YAML        string       `json:"yaml"`           // 可直接粘贴到服务定义下的 YAML 片段
+}
+
+// SuggestHealthCheck 根据服务镜像和端口生成健康检查
+// 识别 nginx、mysql、mariadb、postgres、redis、mongo、rabbitmq 等常见镜像；
+// 其他镜像暴露常见 HTTP 端口时检查 HTTP，否则对第一个暴露端口做 TCP 检查
+func SuggestHealthCheck(name string, service *Service) (*HealthCheckSuggestion, error) {
+	if service == nil {
+		return nil, ErrServiceNotFound
+	}
+
+	image := baseImageName(service.Image)
+	port := firstContainerPort(service)
+	suggestion := &HealthCheckSuggestion{Service: name}
+	check := &HealthCheck{Interval: "30s", Timeout: "5s", Retries: 3, StartPeriod: "10s"}
+
+	switch {
+	case imageIs(image, "nginx"), imageIs(image, "openresty"):
+		suggestion.Kind = HealthCheckKindNginx
+		suggestion.Port = portOr(port, "80")
+		check.Test = httpCheckCommand(suggestion.Port)
+	case imageIs(image, "mysql"), imageIs(image, "percona"):
+		suggestion.Kind = HealthCheckKindMySQL
+		check.Test = []string{"CMD", "mysqladmin", "ping", "-h", "localhost"}
+		check.StartPeriod = "30s"
+	case imageIs(image, "mariadb"):
+		suggestion.Kind = HealthCheckKindMariaDB
+		check.Test = []string{"CMD", "healthcheck.sh", "--connect", "--innodb_initialized"}
+		check.StartPeriod = "30s"
+	case imageIs(image, "postgres"), imageIs(image, "postgis"), imageIs(image, "timescaledb"):
+		suggestion.Kind = HealthCheckKindPostgres
+		// $$ 避免 compose 在宿主机上插值，由容器内的 shell 读取 POSTGRES_USER
+		check.Test = []string{"CMD-SHELL", "pg_isready -U $${POSTGRES_USER:-postgres}"}
+		check.StartPeriod = "30s"
+	case imageIs(image, "redis"):
+		suggestion.Kind = HealthCheckKindRedis
+		check.Test = []string{"CMD", "redis-cli", "ping"}
+	case imageIs(image, "valkey"):
+		suggestion.Kind = HealthCheckKindRedis
+		check.Test = []string{"CMD", "valkey-cli", "ping"}
+	case imageIs(image, "mongo"):
+		suggestion.Kind = HealthCheckKindMongo
+		// 6.0 起镜像只带 mongosh，旧版本只有 mongo
+		check.Test = []string{"CMD-SHELL", `mongosh --quiet --eval "db.adminCommand('ping')" || mongo --quiet --eval "db.adminCommand('ping')"`}
+		check.StartPeriod = "30s"
+	case imageIs(image, "rabbitmq"):
+		suggestion.Kind = HealthCheckKindRabbitMQ
+		check.Test = []string{"CMD", "rabbitmq-diagnostics", "-q", "ping"}
+		check.Timeout = "10s"
+		check.StartPeriod = "60s"
+	case httpServerImages[image] != "":
+		suggestion.Kind = HealthCheckKindHTTP
+		suggestion.Port = portOr(port, httpServerImages[image])
+		check.Test = httpCheckCommand(suggestion.Port)
+	case httpPorts[port]:
+		suggestion.Kind = HealthCheckKindHTTP
+		suggestion.Port = port
+		check.Test = httpCheckCommand(port)
+	case port != "":
+		suggestion.Kind = HealthCheckKindTCP
+		suggestion.Port = port
+		check.Test = []string{"CMD-SHELL", fmt.Sprintf("nc -z localhost %s || bash -c ': > /dev/tcp/localhost/%s' || exit 1", port, port)}
+	default:
+		return nil, fmt.Errorf("%w: service %s (%s)", ErrNoHealthCheckSuggestion, name, service.Image)
+	}
+
+	suggestion.HealthCheck = check
+	snippet, err := marshalYAML(map[string]*HealthCheck{"healthcheck": check})
+	if err != nil {
+		return nil, err
+	}
+	suggestion.YAML = snippet
+	return suggestion, nil
+}
+
+// ApplyHealthCheck 在 Compose 内容中为服务写入健康检查，保留其他字段和注释
+func ApplyHealthCheck(content, serviceName string, check *HealthCheck) (string, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidComposeFile, err)
+	}
+	if len(root.Content) == 0 {
+		return "", fmt.Errorf("%w: empty document", ErrInvalidComposeFile)
+	}
+	services := mappingValue(root.Content[0], "services")
+	service := mappingValue(services, serviceName)
+	if service == nil || service.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%w: %s", ErrServiceNotFound, serviceName)
+	}
+	if mappingValue(service, "healthcheck") != nil {
+		return "", fmt.Errorf("%w: %s", ErrHealthCheckExists, serviceName)
+	}
+
+	var value yaml.Node
+	if err := value.Encode(check); err != nil {
+		return "", fmt.Errorf("failed to encode healthcheck: %w", err)
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "healthcheck"}
+	service.Content = append(service.Content, key, &value)
+
+	return marshalYAML(&root)
+}
+
+// mappingValue 返回映射节点中指定键的值节点
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// marshalYAML 以两空格缩进输出 YAML，与常见 compose 文件保持一致
+func marshalYAML(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return "", fmt.Errorf("failed to marshal yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to marshal yaml: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// httpCheckCommand 优先使用 curl，精简镜像中回退到 wget
+func httpCheckCommand(port string) []string {
+	url := fmt.Sprintf("http://localhost:%s/", port)
+	return []string{"CMD-SHELL", fmt.Sprintf("curl -fsS %s > /dev/null || wget -q --spider %s || exit 1", url, url)}
+}
+
+// baseImageName 去掉镜像的仓库地址、命名空间、标签和摘要，如 docker.io/bitnami/redis:7 -> redis
+func baseImageName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, "/"); i >= 0 {
+		image = image[i+1:]
+	}
+	image, _, _ = strings.Cut(image, ":")
+	return strings.ToLower(image)
+}
+
+// imageIs 判断镜像名是否为指定镜像或其变体，如 nginx-unprivileged
+func imageIs(image, name string) bool {
+	return image == name || strings.HasPrefix(image, name+"-")
+}
+
+// firstContainerPort 返回第一个端口映射或 expose 中的容器端口
+func firstContainerPort(service *Service) string {
+	for _, spec := range append(append([]string{}, service.Ports...), service.Expose...) {
+		if port := containerPort(spec); port != "" {
+			return port
+		}
+	}
+	return ""
+}
+
+// containerPort 从 "8080:80"、"127.0.0.1:8080:80/tcp"、"3000-3005" 等写法中取出容器端口
+func containerPort(spec string) string {
+	spec, _, _ = strings.Cut(strings.TrimSpace(spec), "/")
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		spec = spec[i+1:]
+	}
+	spec, _, _ = strings.Cut(spec, "-")
+	if spec == "" || strings.Trim(spec, "0123456789") != "" {
+		return ""
+	}
+	return spec
+}
+
+func portOr(port, fallback string) string {
+	if port == "" {
+		return fallback
+	}
+	return port
+}
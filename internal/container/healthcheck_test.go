@@ -0,0 +1,147 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSuggestHealthCheck_KnownImages(t *testing.T) {
+	tests := []struct {
+		image string
+		ports []string
+		kind  string
+		test  string
+	}{
+		{"nginx:1.25-alpine", []string{"8080:80"}, HealthCheckKindNginx, "CMD-SHELL curl -fsS http://localhost:80/ > /dev/null || wget -q --spider http://localhost:80/ || exit 1"},
+		{"nginxinc/nginx-unprivileged", []string{"8080"}, HealthCheckKindNginx, "CMD-SHELL curl -fsS http://localhost:8080/ > /dev/null || wget -q --spider http://localhost:8080/ || exit 1"},
+		{"mysql:8.0", nil, HealthCheckKindMySQL, "CMD mysqladmin ping -h localhost"},
+		{"mariadb:11", nil, HealthCheckKindMariaDB, "CMD healthcheck.sh --connect --innodb_initialized"},
+		{"docker.io/library/postgres:16", []string{"5432:5432"}, HealthCheckKindPostgres, "CMD-SHELL pg_isready -U $${POSTGRES_USER:-postgres}"},
+		{"bitnami/redis:7.2", nil, HealthCheckKindRedis, "CMD redis-cli ping"},
+		{"valkey/valkey:8", nil, HealthCheckKindRedis, "CMD valkey-cli ping"},
+		{"mongo:7@sha256:abcdef", nil, HealthCheckKindMongo, `CMD-SHELL mongosh --quiet --eval "db.adminCommand('ping')" || mongo --quiet --eval "db.adminCommand('ping')"`},
+		{"rabbitmq:3-management", []string{"15672:15672"}, HealthCheckKindRabbitMQ, "CMD rabbitmq-diagnostics -q ping"},
+		{"httpd:2.4", nil, HealthCheckKindHTTP, "CMD-SHELL curl -fsS http://localhost:80/ > /dev/null || wget -q --spider http://localhost:80/ || exit 1"},
+		{"registry.example.com/shop/api:v2", []string{"127.0.0.1:18080:8080/tcp"}, HealthCheckKindHTTP, "CMD-SHELL curl -fsS http://localhost:8080/ > /dev/null || wget -q --spider http://localhost:8080/ || exit 1"},
+		{"example/worker", []string{"6000-6005:7000-7005"}, HealthCheckKindTCP, "CMD-SHELL nc -z localhost 7000 || bash -c ': > /dev/tcp/localhost/7000' || exit 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			suggestion, err := SuggestHealthCheck("svc", &Service{Image: tt.image, Ports: tt.ports})
+			if err != nil {
+				t.Fatalf("SuggestHealthCheck: %v", err)
+			}
+			if suggestion.Kind != tt.kind {
+				t.Errorf("Expected kind %s, got %s", tt.kind, suggestion.Kind)
+			}
+			if got := strings.Join(suggestion.HealthCheck.Test.([]string), " "); got != tt.test {
+				t.Errorf("Unexpected test command:\n got: %s\nwant: %s", got, tt.test)
+			}
+			check := suggestion.HealthCheck
+			if check.Interval == "" || check.Timeout == "" || check.Retries == 0 || check.StartPeriod == "" {
+				t.Errorf("Expected full timing settings, got %+v", check)
+			}
+			if !strings.HasPrefix(suggestion.YAML, "healthcheck:\n  test:\n") {
+				t.Errorf("Unexpected YAML snippet:\n%s", suggestion.YAML)
+			}
+		})
+	}
+}
+
+func TestSuggestHealthCheck_ExposeAndUnknown(t *testing.T) {
+	suggestion, err := SuggestHealthCheck("app", &Service{Image: "example/app", Expose: []string{"3000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestion.Kind != HealthCheckKindHTTP || suggestion.Port != "3000" {
+		t.Errorf("Expected HTTP check on exposed port 3000, got %s %s", suggestion.Kind, suggestion.Port)
+	}
+
+	if _, err := SuggestHealthCheck("job", &Service{Image: "example/batch"}); !errors.Is(err, ErrNoHealthCheckSuggestion) {
+		t.Errorf("Expected ErrNoHealthCheckSuggestion, got %v", err)
+	}
+}
+
+func TestGenerateOptimizations_HealthCheckCodeExample(t *testing.T) {
+	config, err := NewComposeParser().Parse(revisionTestContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimizer := NewArchitectureOptimizer()
+	analysis, err := optimizer.AnalyzeArchitecture(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suggestions, err := optimizer.GenerateOptimizations(context.Background(), analysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, suggestion := range suggestions {
+		if suggestion.Title == issueMissingHealthCheck {
+			if !strings.Contains(suggestion.CodeExample, "curl -fsS http://localhost:80/") {
+				t.Errorf("Expected nginx healthcheck snippet, got:\n%s", suggestion.CodeExample)
+			}
+			return
+		}
+	}
+	t.Fatal("Expected a missing healthcheck suggestion")
+}
+
+func TestSuggestHealthCheckAPI_Apply(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	handler := &APIHandler{composeService: service}
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/api/compose/demo/services/missing/suggest-healthcheck", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown service, got %d", rec.Code)
+	}
+
+	// 只生成建议，不修改内容
+	rec := post("/api/compose/demo/services/web/suggest-healthcheck", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"kind":"nginx"`) {
+		t.Fatalf("Expected nginx suggestion, got %d %s", rec.Code, rec.Body.String())
+	}
+	if revisions, _ := service.ListRevisions(context.Background(), project.ID); len(revisions) != 0 {
+		t.Fatalf("Suggesting must not create a revision, got %d", len(revisions))
+	}
+
+	rec = post("/api/compose/demo/services/web/suggest-healthcheck", `{"apply":true}`)
+	var resp struct {
+		Result *ContentUpdateResult `json:"result"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Result == nil || resp.Result.Revision.Revision != 2 || resp.Result.Revision.Author != "alice" {
+		t.Fatalf("Expected a new revision, got %d %+v", rec.Code, resp.Result)
+	}
+	if !strings.Contains(resp.Result.Diff, "+    healthcheck:") {
+		t.Errorf("Unexpected diff:\n%s", resp.Result.Diff)
+	}
+
+	saved, _ := service.GetProject(context.Background(), project.ID)
+	config, err := NewComposeParser().Parse(saved.Content)
+	if err != nil || config.Services["web"].HealthCheck == nil || config.Services["web"].Image != "nginx:latest" {
+		t.Fatalf("Expected saved content with healthcheck, got %v:\n%s", err, saved.Content)
+	}
+
+	if rec := post("/api/compose/demo/services/web/suggest-healthcheck?apply=true", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 once a healthcheck exists, got %d", rec.Code)
+	}
+}
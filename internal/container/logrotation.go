@@ -0,0 +1,324 @@
+package container
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"qwq/internal/backup"
+	"qwq/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLogRotation 建议的 json-file 日志轮转参数：单个文件 100MB，保留 3 个
+var DefaultLogRotation = LogRotation{MaxSize: "100m", MaxFile: 3}
+
+var (
+	// ErrInvalidLogRotation 日志轮转参数不合法
+	ErrInvalidLogRotation = errors.New("invalid log rotation")
+	// ErrTruncateNotConfirmed 清空日志需要在请求中确认服务名称
+	ErrTruncateNotConfirmed = errors.New("log truncation requires explicit confirmation")
+	// ErrNoServiceContainers 服务没有可清空日志的容器
+	ErrNoServiceContainers = errors.New("service has no containers")
+	// ErrLogFileUnreadable 容器日志文件无法读取，通常是 qwq 无权访问 Docker 数据目录
+	ErrLogFileUnreadable = errors.New("container log files are not readable")
+)
+
+// logSizePattern docker log-opt max-size 的取值，如 10m、1g、500k
+var logSizePattern = regexp.MustCompile(`^[1-9][0-9]*[kmg]$`)
+
+// LogFile 容器的日志文件
+type LogFile struct {
+	ContainerID string `json:"container_id"`
+	Name        string `json:"name"`                 // 容器名称（不含前导 /）
+	Project     string `json:"project,omitempty"`    // Compose 项目名称
+	Service     string `json:"service,omitempty"`    // Compose 服务名称
+	ProjectID   uint   `json:"project_id,omitempty"` // 所属的 qwq 项目（部署或纳管），不受管理时为 0
+	Driver      string `json:"driver"`               // 日志驱动
+	MaxSize     string `json:"max_size,omitempty"`   // 已配置的 max-size，未配置时为空
+	Path        string `json:"path"`
+	Size        int64  `json:"size"` // 当前文件大小（字节），不含已轮转的文件
+}
+
+// Managed 容器是否属于 qwq 管理的项目，管理的项目可以一键写入日志轮转配置
+func (f LogFile) Managed() bool {
+	return f.ProjectID != 0 && f.Service != ""
+}
+
+// LogRotation json-file 日志轮转参数
+type LogRotation struct {
+	MaxSize string `json:"max_size"` // 单个日志文件上限，如 100m
+	MaxFile int    `json:"max_file"` // 保留的文件数
+}
+
+// Validate 校验轮转参数
+func (r LogRotation) Validate() error {
+	if !logSizePattern.MatchString(r.MaxSize) {
+		return fmt.Errorf("%w: max-size %q must look like 100m, 1g or 500k", ErrInvalidLogRotation, r.MaxSize)
+	}
+	if r.MaxFile < 1 {
+		return fmt.Errorf("%w: max-file must be at least 1", ErrInvalidLogRotation)
+	}
+	return nil
+}
+
+// Logging 对应的 compose logging 配置
+func (r LogRotation) Logging() *LoggingConfig {
+	return &LoggingConfig{
+		Driver: "json-file",
+		Options: map[string]string{
+			"max-size": r.MaxSize,
+			"max-file": strconv.Itoa(r.MaxFile),
+		},
+	}
+}
+
+// Snippet 可直接粘贴到 compose 服务定义中的 logging 配置
+func (r LogRotation) Snippet() string {
+	return fmt.Sprintf("logging:\n  driver: json-file\n  options:\n    max-size: \"%s\"\n    max-file: \"%d\"\n", r.MaxSize, r.MaxFile)
+}
+
+// ApplyLogRotation 为服务写入 json-file 日志轮转配置，替换已有的 logging 配置
+// 通过 yaml.Node 修改，保留其余字段的顺序
+func ApplyLogRotation(content, serviceName string, rotation LogRotation) (string, error) {
+	if err := rotation.Validate(); err != nil {
+		return "", err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidComposeFile, err)
+	}
+	if len(root.Content) == 0 {
+		return "", fmt.Errorf("%w: empty document", ErrInvalidComposeFile)
+	}
+	services := mappingValue(root.Content[0], "services")
+	service := mappingValue(services, serviceName)
+	if service == nil || service.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%w: %s", ErrServiceNotFound, serviceName)
+	}
+
+	var value yaml.Node
+	if err := value.Encode(rotation.Logging()); err != nil {
+		return "", fmt.Errorf("failed to encode logging: %w", err)
+	}
+	if existing := mappingValue(service, "logging"); existing != nil {
+		*existing = value
+	} else {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "logging"}
+		service.Content = append(service.Content, key, &value)
+	}
+
+	return marshalYAML(&root)
+}
+
+// ScanLogFiles 通过容器 inspect 的 LogPath 读取每个容器的日志文件大小，按大小降序返回
+// journald、syslog 等不落盘的日志驱动没有 LogPath，会被跳过
+func ScanLogFiles(ctx context.Context, executor DockerExecutor) ([]LogFile, error) {
+	lister, ok := executor.(ContainerLister)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+	inspector, ok := executor.(ContainerInspector)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+	containers, err := lister.ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]LogFile, 0, len(containers))
+	var statErr error
+	for _, c := range containers {
+		info, err := inspector.InspectContainer(ctx, c.ID)
+		if err != nil || info.ContainerJSONBase == nil || info.LogPath == "" {
+			// 列出后被删除的容器同样跳过
+			continue
+		}
+		stat, err := os.Stat(info.LogPath)
+		if err != nil {
+			if statErr == nil {
+				statErr = err
+			}
+			continue
+		}
+		file := LogFile{
+			ContainerID: c.ID,
+			Name:        strings.TrimPrefix(info.Name, "/"),
+			Project:     c.Labels[composeProjectLabel],
+			Service:     c.Labels[composeServiceLabel],
+			Path:        info.LogPath,
+			Size:        stat.Size(),
+		}
+		if info.HostConfig != nil {
+			file.Driver = info.HostConfig.LogConfig.Type
+			file.MaxSize = info.HostConfig.LogConfig.Config["max-size"]
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 && statErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLogFileUnreadable, statErr)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+	return files, nil
+}
+
+// LogSnapshot 清空日志前保存的快照
+type LogSnapshot struct {
+	Container string `json:"container"`
+	LogPath   string `json:"log_path"`
+	File      string `json:"file"` // gzip 压缩的快照文件
+	Size      int64  `json:"size"` // 清空前的日志大小（字节）
+}
+
+// LogRotationService 扫描容器日志并为受管理的项目写入日志轮转配置
+type LogRotationService struct {
+	composeService ComposeService
+	executor       DockerExecutor
+	snapshotDir    string
+	now            func() time.Time
+}
+
+// NewLogRotationService 创建日志轮转服务，日志快照保存在卷快照目录的 logs 子目录下
+func NewLogRotationService(composeService ComposeService, executor DockerExecutor) *LogRotationService {
+	dir := config.Current().Snapshot.Dir
+	if dir == "" {
+		dir = backup.DefaultSnapshotDir
+	}
+	return &LogRotationService{
+		composeService: composeService,
+		executor:       executor,
+		snapshotDir:    filepath.Join(dir, "logs"),
+		now:            time.Now,
+	}
+}
+
+// Scan 扫描容器日志文件，并标记属于 qwq 管理项目的容器
+func (s *LogRotationService) Scan(ctx context.Context) ([]LogFile, error) {
+	files, err := ScanLogFiles(ctx, s.executor)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := s.composeService.ListProjects(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*ComposeProject, len(projects))
+	adopted := make(map[string]*ComposeProject)
+	for _, project := range projects {
+		byName[project.Name] = project
+		if project.AdoptedContainerID != "" {
+			adopted[shortID(project.AdoptedContainerID)] = project
+		}
+	}
+	for i := range files {
+		file := &files[i]
+		if project, ok := adopted[shortID(file.ContainerID)]; ok {
+			file.ProjectID = project.ID
+			file.Project = project.Name
+			file.Service = adoptedServiceName(file.Name)
+		} else if project, ok := byName[file.Project]; ok {
+			file.ProjectID = project.ID
+		}
+	}
+	return files, nil
+}
+
+// Apply 为项目中的服务写入日志轮转配置并保存为新修订，重新部署后生效
+func (s *LogRotationService) Apply(ctx context.Context, project *ComposeProject, serviceName string, rotation LogRotation, author, message string) (*ContentUpdateResult, error) {
+	content, err := ApplyLogRotation(project.Content, serviceName, rotation)
+	if err != nil {
+		return nil, err
+	}
+	if message == "" {
+		message = fmt.Sprintf("add log rotation (max-size %s, max-file %d) to %s", rotation.MaxSize, rotation.MaxFile, serviceName)
+	}
+	return s.composeService.SaveProjectContent(ctx, project.ID, content, author, message)
+}
+
+// Truncate 清空服务所有容器的当前日志，每个文件先压缩保存快照，快照失败时不会清空
+// 调用方负责确认，该方法本身不做任何确认
+func (s *LogRotationService) Truncate(ctx context.Context, project *ComposeProject, serviceName string) ([]LogSnapshot, error) {
+	inspector, ok := s.executor.(ContainerInspector)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+
+	var ids []string
+	if project.AdoptedContainerID != "" {
+		ids = []string{project.AdoptedContainerID}
+	} else {
+		containers, err := s.executor.GetServiceContainers(ctx, project.Name, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		ids = containers
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoServiceContainers, serviceName)
+	}
+
+	snapshots := make([]LogSnapshot, 0, len(ids))
+	for _, id := range ids {
+		info, err := inspector.InspectContainer(ctx, id)
+		if err != nil {
+			return snapshots, err
+		}
+		if info.ContainerJSONBase == nil || info.LogPath == "" {
+			continue
+		}
+		name := strings.TrimPrefix(info.Name, "/")
+		snapshot, err := s.snapshotLog(name, info.LogPath)
+		if err != nil {
+			return snapshots, err
+		}
+		if err := os.Truncate(info.LogPath, 0); err != nil {
+			return snapshots, fmt.Errorf("failed to truncate log of %s: %w", name, err)
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, nil
+}
+
+// snapshotLog 将日志文件压缩复制到快照目录
+func (s *LogRotationService) snapshotLog(name, path string) (*LogSnapshot, error) {
+	if err := os.MkdirAll(s.snapshotDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log snapshot dir: %w", err)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log of %s: %w", name, err)
+	}
+	defer src.Close()
+
+	target := filepath.Join(s.snapshotDir, fmt.Sprintf("%s-%s.log.gz", name, s.now().Format("20060102-150405")))
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log snapshot: %w", err)
+	}
+	gz := gzip.NewWriter(dst)
+	size, err := io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return nil, fmt.Errorf("failed to write log snapshot of %s: %w", name, err)
+	}
+	return &LogSnapshot{Container: name, LogPath: path, File: target, Size: size}, nil
+}
@@ -0,0 +1,212 @@
+package container
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/gorilla/mux"
+)
+
+// logExecutor 服务容器查询返回预设 ID 的执行器
+type logExecutor struct {
+	*inspectingExecutor
+	serviceContainers map[string][]string
+}
+
+func (e *logExecutor) GetServiceContainers(ctx context.Context, projectName, serviceName string) ([]string, error) {
+	return e.serviceContainers[projectName+"/"+serviceName], nil
+}
+
+// logTestContainer 日志写入 dir 下的容器，size 为日志大小
+func logTestContainer(t *testing.T, dir, id, name string, labels map[string]string, size int) types.ContainerJSON {
+	path := filepath.Join(dir, id+"-json.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         id,
+			Name:       "/" + name,
+			LogPath:    path,
+			State:      &types.ContainerState{Status: "running"},
+			HostConfig: &container.HostConfig{LogConfig: container.LogConfig{Type: "json-file"}},
+		},
+		Config: &container.Config{Image: "nginx:latest", Labels: labels},
+	}
+}
+
+func TestApplyLogRotation(t *testing.T) {
+	content, err := ApplyLogRotation(revisionTestContent, "web", DefaultLogRotation)
+	if err != nil {
+		t.Fatalf("ApplyLogRotation failed: %v", err)
+	}
+	config, err := NewComposeParser().Parse(content)
+	if err != nil {
+		t.Fatalf("Result does not parse: %v\n%s", err, content)
+	}
+	logging := config.Services["web"].Logging
+	if logging == nil || logging.Driver != "json-file" || logging.Options["max-size"] != "100m" || logging.Options["max-file"] != "3" {
+		t.Fatalf("Unexpected logging: %+v\n%s", logging, content)
+	}
+
+	// 已有 logging 配置时整体替换
+	replaced, err := ApplyLogRotation(content, "web", LogRotation{MaxSize: "50m", MaxFile: 5})
+	if err != nil {
+		t.Fatalf("ApplyLogRotation failed: %v", err)
+	}
+	if strings.Count(replaced, "logging:") != 1 || !strings.Contains(replaced, "max-size: 50m") {
+		t.Errorf("Expected logging to be replaced:\n%s", replaced)
+	}
+
+	if _, err := ApplyLogRotation(revisionTestContent, "missing", DefaultLogRotation); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("Expected ErrServiceNotFound, got %v", err)
+	}
+	for _, rotation := range []LogRotation{{MaxSize: "100", MaxFile: 3}, {MaxSize: "0m", MaxFile: 3}, {MaxSize: "10m"}} {
+		if _, err := ApplyLogRotation(revisionTestContent, "web", rotation); !errors.Is(err, ErrInvalidLogRotation) {
+			t.Errorf("Expected ErrInvalidLogRotation for %+v, got %v", rotation, err)
+		}
+	}
+}
+
+func TestLogRotationService_Scan(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	dir := t.TempDir()
+
+	adopted := &ComposeProject{Name: "legacy", Content: revisionTestContent, TenantID: 1, Adopted: true, AdoptedContainerID: "bbbbbbbbbbbbcccc"}
+	if err := service.CreateProject(context.Background(), adopted); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	executor := &inspectingExecutor{
+		mockDockerExecutor: newMockDockerExecutor(),
+		containers: map[string]types.ContainerJSON{
+			"aaaaaaaaaaaa": logTestContainer(t, dir, "aaaaaaaaaaaa", "demo-web-1",
+				map[string]string{composeProjectLabel: "demo", composeServiceLabel: "web"}, 10),
+			"bbbbbbbbbbbbcccc": logTestContainer(t, dir, "bbbbbbbbbbbbcccc", "Legacy_App", nil, 30),
+			"dddddddddddd": logTestContainer(t, dir, "dddddddddddd", "other-db-1",
+				map[string]string{composeProjectLabel: "other", composeServiceLabel: "db"}, 20),
+		},
+	}
+	// journald 没有落盘的日志文件
+	journald := logTestContainer(t, dir, "eeeeeeeeeeee", "journal", nil, 1)
+	journald.LogPath = ""
+	executor.containers["eeeeeeeeeeee"] = journald
+
+	files, err := NewLogRotationService(service, executor).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 log files, got %+v", files)
+	}
+	if files[0].Name != "Legacy_App" || files[1].Name != "other-db-1" || files[2].Name != "demo-web-1" {
+		t.Fatalf("Expected files sorted by size, got %+v", files)
+	}
+	if !files[0].Managed() || files[0].ProjectID != adopted.ID || files[0].Service != "legacy_app" {
+		t.Errorf("Adopted container should map to its project, got %+v", files[0])
+	}
+	if files[1].Managed() || files[1].Project != "other" {
+		t.Errorf("Unknown compose project should not be managed, got %+v", files[1])
+	}
+	if !files[2].Managed() || files[2].ProjectID != project.ID || files[2].Size != 10 {
+		t.Errorf("Deployed container should map to its project, got %+v", files[2])
+	}
+}
+
+func TestLogRotationAPI(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	dir := t.TempDir()
+	executor := &logExecutor{
+		inspectingExecutor: &inspectingExecutor{
+			mockDockerExecutor: newMockDockerExecutor(),
+			containers: map[string]types.ContainerJSON{
+				"aaaaaaaaaaaa": logTestContainer(t, dir, "aaaaaaaaaaaa", "demo-web-1", nil, 4096),
+			},
+		},
+		serviceContainers: map[string][]string{"demo/web": {"aaaaaaaaaaaa"}},
+	}
+	handler := &APIHandler{composeService: service}
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/compose/demo/services/web/log-rotation", strings.NewReader(body))
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post(""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 without log rotation service, got %d", rec.Code)
+	}
+	rotation := NewLogRotationService(service, executor)
+	rotation.snapshotDir = filepath.Join(dir, "snapshots")
+	handler.SetLogRotationService(rotation)
+	logPath := executor.containers["aaaaaaaaaaaa"].LogPath
+
+	// 未确认时既不写修订也不清空
+	rec := post(`{"truncate":true,"confirm":"yes"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "LOG_TRUNCATE_NOT_CONFIRMED") {
+		t.Fatalf("Expected 400 without confirmation, got %d %s", rec.Code, rec.Body.String())
+	}
+	if revisions, _ := service.ListRevisions(context.Background(), project.ID); len(revisions) != 0 {
+		t.Fatalf("Unconfirmed request must not create a revision, got %d", len(revisions))
+	}
+	if info, _ := os.Stat(logPath); info.Size() != 4096 {
+		t.Fatalf("Unconfirmed request must not truncate the log, size %d", info.Size())
+	}
+
+	if rec := post(`{"max_size":"10"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid max_size, got %d", rec.Code)
+	}
+
+	// 只写入轮转配置
+	rec = post("")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if info, _ := os.Stat(logPath); info.Size() != 4096 {
+		t.Fatalf("Applying rotation must not truncate the log, size %d", info.Size())
+	}
+	saved, _ := service.GetProject(context.Background(), project.ID)
+	if !strings.Contains(saved.Content, "max-size: 100m") {
+		t.Fatalf("Expected rotation in saved content:\n%s", saved.Content)
+	}
+
+	rec = post(`{"max_size":"20m","max_file":2,"truncate":true,"confirm":"web"}`)
+	var resp struct {
+		Result    *ContentUpdateResult `json:"result"`
+		Snapshots []LogSnapshot        `json:"snapshots"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Result == nil || len(resp.Snapshots) != 1 {
+		t.Fatalf("Expected revision and snapshot, got %d %+v", rec.Code, resp)
+	}
+	if info, _ := os.Stat(logPath); info.Size() != 0 {
+		t.Errorf("Expected log to be truncated, size %d", info.Size())
+	}
+	snapshot, err := os.Open(resp.Snapshots[0].File)
+	if err != nil {
+		t.Fatalf("Snapshot missing: %v", err)
+	}
+	defer snapshot.Close()
+	gz, err := gzip.NewReader(snapshot)
+	if err != nil {
+		t.Fatalf("Snapshot is not gzip: %v", err)
+	}
+	data, _ := io.ReadAll(gz)
+	if len(data) != 4096 || resp.Snapshots[0].Size != 4096 {
+		t.Errorf("Snapshot should hold the original log, got %d bytes", len(data))
+	}
+}
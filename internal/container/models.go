@@ -15,6 +15,10 @@ type ComposeProject struct {
 	Content     string         `json:"content" gorm:"type:text;not null"`                 // Compose 文件内容（YAML）
 	Version     string         `json:"version"`                                           // Compose 文件版本
 	Status      ProjectStatus  `json:"status" gorm:"not null;index"`                      // 项目状态
+	Environment string         `json:"environment" gorm:"index"`                          // 运行环境标签，如 production
+	RequireApproval bool       `json:"require_approval"`                                  // 部署前是否需要人工审批
+	Adopted     bool           `json:"adopted" gorm:"index"`                              // 是否由已有容器纳管而来
+	AdoptedContainerID string  `json:"adopted_container_id,omitempty" gorm:"index"`       // 纳管的容器 ID
 	UserID      uint           `json:"user_id" gorm:"index"`                              // 用户ID
 	TenantID    uint           `json:"tenant_id" gorm:"index;uniqueIndex:idx_name_tenant"` // 租户ID
 	CreatedAt   time.Time      `json:"created_at"`
@@ -52,6 +56,7 @@ type Service struct {
 	Entrypoint    interface{}         `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`         // 入口点
 	Environment   interface{}         `yaml:"environment,omitempty" json:"environment,omitempty"`       // 环境变量（数组或映射）
 	Ports         []string            `yaml:"ports,omitempty" json:"ports,omitempty"`                   // 端口映射
+	Expose        []string            `yaml:"expose,omitempty" json:"expose,omitempty"`                 // 仅对内暴露的端口
 	Volumes       []string            `yaml:"volumes,omitempty" json:"volumes,omitempty"`               // 卷挂载
 	Networks      interface{}         `yaml:"networks,omitempty" json:"networks,omitempty"`             // 网络（数组或映射）
 	DependsOn     interface{}         `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`         // 依赖服务
@@ -192,6 +197,15 @@ type Deployment struct {
 	StartedAt       *time.Time       `json:"started_at"`                                      // 开始时间
 	CompletedAt     *time.Time       `json:"completed_at"`                                    // 完成时间
 	RollbackVersion string           `json:"rollback_version"`                                // 回滚版本
+	RevisionID      *uint            `json:"revision_id,omitempty" gorm:"index"`              // 部署使用的 Compose 文件修订版本
+	RequestedBy     string           `json:"requested_by"`                                    // 发起部署的用户
+	ApprovedBy      string           `json:"approved_by,omitempty"`                           // 审批（通过或拒绝）的用户
+	ApprovedAt      *time.Time       `json:"approved_at,omitempty"`                           // 审批时间
+	ApprovalExpiresAt *time.Time     `json:"approval_expires_at,omitempty"`                   // 审批过期时间
+	RejectReason    string           `json:"reject_reason,omitempty" gorm:"type:text"`        // 拒绝原因
+	Config          string           `json:"-" gorm:"type:text"`                              // 部署配置（JSON），审批通过后据此执行部署
+	PipelineID      *uint            `json:"pipeline_id,omitempty" gorm:"index"`              // 流水线运行记录所属的流水线
+	Images          string           `json:"images,omitempty" gorm:"type:text"`               // 本次构建的镜像（JSON，服务名 -> 镜像标签），回滚时使用
 	UserID          uint             `json:"user_id" gorm:"index"`                            // 用户ID
 	TenantID        uint             `json:"tenant_id" gorm:"index"`                          // 租户ID
 	CreatedAt       time.Time        `json:"created_at"`
@@ -199,6 +213,9 @@ type Deployment struct {
 	DeletedAt       gorm.DeletedAt   `json:"-" gorm:"index"`
 }
 
+// EnvironmentProduction 生产环境标签，带此标签的项目部署前需要审批
+const EnvironmentProduction = "production"
+
 // DeployStrategy 部署策略
 type DeployStrategy string
 
@@ -218,8 +235,23 @@ const (
 	DeploymentStatusFailed     DeploymentStatus = "failed"      // 失败
 	DeploymentStatusRollingBack DeploymentStatus = "rolling_back" // 回滚中
 	DeploymentStatusRolledBack DeploymentStatus = "rolled_back" // 已回滚
+	DeploymentStatusPendingApproval DeploymentStatus = "pending_approval" // 等待审批
+	DeploymentStatusRejected   DeploymentStatus = "rejected"    // 审批被拒绝
+	DeploymentStatusExpired    DeploymentStatus = "expired"     // 审批已过期
 )
 
+// ComposeRevision Compose 文件修订记录
+// 每次通过编辑器保存内容都会生成一条新修订，用于差异对比和回滚
+type ComposeRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ProjectID uint      `json:"project_id" gorm:"not null;index"`    // 项目ID
+	Revision  int       `json:"revision" gorm:"not null"`            // 修订号（项目内递增）
+	Content   string    `json:"content" gorm:"type:text;not null"`   // Compose 文件内容
+	Author    string    `json:"author"`                              // 修改人
+	Message   string    `json:"message"`                             // 修改说明
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // ServiceInstance 服务实例（运行中的容器）
 type ServiceInstance struct {
 	ID            uint           `json:"id" gorm:"primaryKey"`
@@ -258,6 +290,10 @@ type DeploymentConfig struct {
 	HealthCheckRetries int          `json:"health_check_retries"`        // 健康检查重试次数
 	RollbackOnFailure bool          `json:"rollback_on_failure"`         // 失败时自动回滚
 	BlueGreenTimeout  int            `json:"blue_green_timeout"`          // 蓝绿部署切换超时（秒）
+	RequireApproval   bool           `json:"require_approval"`            // 本次部署是否需要人工审批
+	Services          []string       `json:"services,omitempty"`          // 只部署这些服务（仅滚动更新），为空时部署全部服务
+	Images            map[string]string `json:"images,omitempty"` // 已构建好的镜像（服务名 -> 镜像标签），这些服务不再构建
+	Probes            []DeployProbe     `json:"probes,omitempty"` // 部署后验证探针，健康检查通过后执行
 }
 
 // TableName 指定表名
@@ -270,6 +306,11 @@ func (Deployment) TableName() string {
 	return "deployments"
 }
 
+// TableName 指定表名
+func (ComposeRevision) TableName() string {
+	return "compose_revisions"
+}
+
 // TableName 指定表名
 func (ServiceInstance) TableName() string {
 	return "service_instances"
@@ -61,6 +61,9 @@ type ArchitectureIssue struct {
 	Suggestion  string        `json:"suggestion"`  // 修复建议
 }
 
+// issueMissingHealthCheck 缺少健康检查的问题标题，生成优化建议时据此附上 healthcheck 片段
+const issueMissingHealthCheck = "缺少健康检查配置"
+
 // IssueSeverity 问题严重程度
 type IssueSeverity string
 
@@ -96,6 +99,7 @@ type ServiceAnalysis struct {
 	Networks          []string            `json:"networks"`           // 连接的网络
 	SecurityIssues    []*SecurityIssue    `json:"security_issues"`    // 安全问题
 	PerformanceHints  []*PerformanceHint  `json:"performance_hints"`  // 性能提示
+	SuggestedHealthCheck *HealthCheckSuggestion `json:"suggested_health_check,omitempty"` // 缺少健康检查时生成的建议配置
 }
 
 // SecurityIssue 安全问题
@@ -167,6 +171,7 @@ type OptimizationSuggestion struct {
 	AffectedServices []string          `json:"affected_services"` // 影响的服务
 	EstimatedImpact *ImpactEstimate    `json:"estimated_impact"` // 预估影响
 	CodeExample     string             `json:"code_example,omitempty"` // 代码示例
+	Source          string             `json:"source"` // 来源：rules（内置规则）或 ai（AI 补充）
 }
 
 // OptimizationCategory 优化类别
@@ -353,8 +358,8 @@ type PerformanceComparison struct {
 
 // architectureOptimizerImpl AI 架构优化分析器实现
 type architectureOptimizerImpl struct {
-	// 可以注入 AI 服务客户端
-	// aiClient AIClient
+	advisor OptimizationAdvisor // 为空时使用 SetOptimizationAdvisor 注入的全局实现
+	breaker *adviceBreaker      // 为空时使用全局熔断器
 }
 
 // NewArchitectureOptimizer 创建架构优化分析器实例
@@ -438,6 +443,11 @@ func (o *architectureOptimizerImpl) analyzeService(serviceName string, service *
 	// 生成性能提示
 	analysis.PerformanceHints = o.generatePerformanceHints(serviceName, service)
 
+	// 缺少健康检查时生成建议配置
+	if service.HealthCheck == nil {
+		analysis.SuggestedHealthCheck, _ = SuggestHealthCheck(serviceName, service)
+	}
+
 	return analysis
 }
 
@@ -496,7 +506,7 @@ func (o *architectureOptimizerImpl) detectServiceIssues(serviceName string, serv
 			Severity:    SeverityMedium,
 			Category:    CategoryReliability,
 			Service:     serviceName,
-			Title:       "缺少健康检查配置",
+			Title:       issueMissingHealthCheck,
 			Description: fmt.Sprintf("服务 %s 没有配置健康检查", serviceName),
 			Impact:      "无法自动检测服务健康状态，可能导致故障服务继续接收流量",
 			Suggestion:  "添加 healthcheck 配置，定期检查服务健康状态",
@@ -791,14 +801,19 @@ func (o *architectureOptimizerImpl) GenerateOptimizations(ctx context.Context, a
 	for _, issue := range analysis.Issues {
 		suggestion := o.issueToOptimization(issue)
 		if suggestion != nil {
+			o.attachHealthCheckExample(suggestion, issue, analysis)
 			suggestions = append(suggestions, suggestion)
 		}
 	}
 
 	// 添加通用优化建议
 	suggestions = append(suggestions, o.generateGeneralOptimizations(analysis)...)
+	for _, suggestion := range suggestions {
+		suggestion.Source = SuggestionSourceRules
+	}
 
-	return suggestions, nil
+	// 可选的 AI 补充，失败时只返回规则建议
+	return o.enrichWithAI(ctx, analysis, suggestions), nil
 }
 
 // issueToOptimization 将问题转换为优化建议
@@ -843,6 +858,20 @@ func (o *architectureOptimizerImpl) issueToOptimization(issue *ArchitectureIssue
 	}
 }
 
+// attachHealthCheckExample 为缺少健康检查的建议附上生成的 healthcheck 片段
+func (o *architectureOptimizerImpl) attachHealthCheckExample(suggestion *OptimizationSuggestion, issue *ArchitectureIssue, analysis *ArchitectureAnalysis) {
+	if issue.Title != issueMissingHealthCheck {
+		return
+	}
+	service := analysis.ServiceAnalysis[issue.Service]
+	if service == nil || service.SuggestedHealthCheck == nil {
+		return
+	}
+	generated := service.SuggestedHealthCheck
+	suggestion.CodeExample = generated.YAML
+	suggestion.Implementation = fmt.Sprintf("在服务 %s 下添加以下 %s 健康检查，或调用 suggest-healthcheck 接口直接应用", issue.Service, generated.Kind)
+}
+
 // estimateOptimizationImpact 估算优化影响
 func (o *architectureOptimizerImpl) estimateOptimizationImpact(issue *ArchitectureIssue) *ImpactEstimate {
 	impact := &ImpactEstimate{
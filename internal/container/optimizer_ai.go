@@ -0,0 +1,355 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+)
+
+const (
+	// SuggestionSourceRules 内置规则生成的优化建议
+	SuggestionSourceRules = "rules"
+	// SuggestionSourceAI AI 补充的优化建议
+	SuggestionSourceAI = "ai"
+)
+
+const (
+	// maxAISuggestions 合并的 AI 建议上限，避免模型输出过多泛泛的建议
+	maxAISuggestions = 8
+	// adviceTimeout 单次 AI 补充的超时时间，超时后只返回规则建议
+	adviceTimeout = 90 * time.Second
+	// adviceFailureLimit 连续失败达到该次数后暂停 AI 补充
+	adviceFailureLimit = 3
+	// adviceCooldown 暂停 AI 补充的时长
+	adviceCooldown = 10 * time.Minute
+)
+
+// ErrAdvisorUnavailable AI 补充处于熔断状态
+var ErrAdvisorUnavailable = errors.New("optimization advisor paused after repeated failures")
+
+// OptimizationAdvisor 为优化建议提供 AI 补充，由启动时注入（Agent 依赖 container，不能反向引用）
+// 实现方负责限流和上下文预算，超出时返回错误
+type OptimizationAdvisor interface {
+	Advise(ctx context.Context, system, prompt string) (string, error)
+}
+
+var (
+	advisorMu      sync.RWMutex
+	defaultAdvisor OptimizationAdvisor
+)
+
+// SetOptimizationAdvisor 设置全局的优化建议 AI 补充，nil 表示只使用规则建议
+func SetOptimizationAdvisor(advisor OptimizationAdvisor) {
+	advisorMu.Lock()
+	defer advisorMu.Unlock()
+	defaultAdvisor = advisor
+}
+
+func currentAdvisor() OptimizationAdvisor {
+	advisorMu.RLock()
+	defer advisorMu.RUnlock()
+	return defaultAdvisor
+}
+
+type skipAIKey struct{}
+
+// WithoutAISuggestions 本次生成优化建议时跳过 AI 补充，如 ?ai=false 或批量分析
+func WithoutAISuggestions(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipAIKey{}, true)
+}
+
+// aiSuggestionsSkipped 是否跳过 AI 补充：配置关闭或本次请求要求跳过
+func aiSuggestionsSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipAIKey{}).(bool)
+	return skip || config.Current().ComposeAnalysis.NoAISuggestions
+}
+
+// adviceBreaker AI 补充的熔断器：连续失败 adviceFailureLimit 次后暂停 adviceCooldown
+type adviceBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+func (b *adviceBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.now().Before(b.openUntil)
+}
+
+func (b *adviceBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= adviceFailureLimit {
+		b.failures = 0
+		b.openUntil = b.now().Add(adviceCooldown)
+	}
+}
+
+var defaultAdviceBreaker = &adviceBreaker{now: time.Now}
+
+// optimizationSummary 发送给模型的紧凑架构摘要
+type optimizationSummary struct {
+	Complexity  ComplexityLevel            `json:"complexity"`
+	HealthScore int                        `json:"health_score"`
+	Services    []summaryService           `json:"services"`
+	Layers      [][]string                 `json:"dependency_layers"`
+	Issues      []summaryIssue             `json:"issues"`
+	Resources   map[string]string          `json:"resources,omitempty"`
+	Existing    []string                   `json:"existing_suggestions"`
+	Networks    map[string]*summaryNetwork `json:"networks,omitempty"`
+}
+
+type summaryService struct {
+	Name          string   `json:"name"`
+	Image         string   `json:"image"`
+	Ports         []string `json:"ports,omitempty"`
+	DependsOn     []string `json:"depends_on,omitempty"`
+	Networks      []string `json:"networks,omitempty"`
+	HealthCheck   bool     `json:"healthcheck"`
+	Limits        bool     `json:"resource_limits"`
+	RestartPolicy string   `json:"restart,omitempty"`
+	CPU           string   `json:"cpu_limit,omitempty"`
+	Memory        string   `json:"memory_limit,omitempty"`
+}
+
+type summaryIssue struct {
+	Service  string        `json:"service,omitempty"`
+	Severity IssueSeverity `json:"severity"`
+	Category IssueCategory `json:"category"`
+	Title    string        `json:"title"`
+}
+
+type summaryNetwork struct {
+	Driver   string   `json:"driver,omitempty"`
+	Services []string `json:"services"`
+}
+
+// aiSuggestion 模型返回的一条建议
+type aiSuggestion struct {
+	Service        string   `json:"service"`
+	Category       string   `json:"category"`
+	Priority       string   `json:"priority"`
+	Title          string   `json:"title"`
+	Description    string   `json:"description"`
+	Benefits       []string `json:"benefits"`
+	Implementation string   `json:"implementation"`
+	ComposeDiff    string   `json:"compose_diff"`
+}
+
+// optimizationAdvicePrompt 要求模型只输出 JSON 数组，便于解析
+const optimizationAdvicePrompt = `You are a senior SRE reviewing a Docker Compose project. You receive a JSON summary of the project produced by a rule-based analyzer: services, detected issues, dependency layers (layer 0 starts first), resource estimates and the titles of suggestions already generated.
+Give at most 8 prioritized, context-aware recommendations that go beyond the existing suggestions: focus on how the services interact (startup order, shared databases, exposed ports, missing limits on critical-path services).
+Reply with a JSON array only, no prose. Each element:
+{"service": "<affected service or empty for the whole project>", "category": "performance|security|reliability|cost|maintainability", "priority": "critical|high|medium|low", "title": "<short title>", "description": "<why it matters for this project>", "benefits": ["..."], "implementation": "<steps>", "compose_diff": "<unified diff against the compose file, or empty>"}
+Write title, description, benefits and implementation in Chinese.`
+
+// enrichWithAI 在规则建议之后请求 AI 补充，任何失败都只返回规则建议
+func (o *architectureOptimizerImpl) enrichWithAI(ctx context.Context, analysis *ArchitectureAnalysis, suggestions []*OptimizationSuggestion) []*OptimizationSuggestion {
+	advisor := o.advisor
+	if advisor == nil {
+		advisor = currentAdvisor()
+	}
+	if advisor == nil || aiSuggestionsSkipped(ctx) {
+		return suggestions
+	}
+	breaker := o.breaker
+	if breaker == nil {
+		breaker = defaultAdviceBreaker
+	}
+	if !breaker.allow() {
+		logger.Debug("Compose 优化建议 AI 补充已跳过: %v", ErrAdvisorUnavailable)
+		return suggestions
+	}
+
+	prompt, err := json.Marshal(o.buildOptimizationSummary(analysis, suggestions))
+	if err != nil {
+		return suggestions
+	}
+	adviceCtx, cancel := context.WithTimeout(ctx, adviceTimeout)
+	defer cancel()
+	reply, err := advisor.Advise(adviceCtx, optimizationAdvicePrompt, string(prompt))
+	var advice []*OptimizationSuggestion
+	if err == nil {
+		advice, err = parseAISuggestions(reply, analysis)
+	}
+	// 调用方取消不计入熔断
+	if ctx.Err() == nil {
+		breaker.record(err)
+	}
+	if err != nil {
+		logger.Info("⚠️ Compose 优化建议 AI 补充失败，只返回规则建议: %v", err)
+		return suggestions
+	}
+	return mergeSuggestions(suggestions, advice)
+}
+
+// buildOptimizationSummary 构造发送给模型的架构摘要，只包含结构化信息，不包含环境变量等敏感内容
+func (o *architectureOptimizerImpl) buildOptimizationSummary(analysis *ArchitectureAnalysis, suggestions []*OptimizationSuggestion) *optimizationSummary {
+	summary := &optimizationSummary{
+		Complexity:  analysis.Complexity,
+		HealthScore: analysis.HealthScore,
+		Issues:      make([]summaryIssue, 0, len(analysis.Issues)),
+		Existing:    make([]string, 0, len(suggestions)),
+	}
+
+	names := make([]string, 0, len(analysis.ServiceAnalysis))
+	for name := range analysis.ServiceAnalysis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dependencies := make(map[string]*ServiceDependency, len(names))
+	for _, name := range names {
+		service := analysis.ServiceAnalysis[name]
+		item := summaryService{
+			Name:          name,
+			Image:         service.Image,
+			Ports:         service.ExposedPorts,
+			DependsOn:     service.Dependencies,
+			Networks:      service.Networks,
+			HealthCheck:   service.HasHealthCheck,
+			Limits:        service.HasResourceLimits,
+			RestartPolicy: service.RestartPolicy,
+		}
+		if analysis.ResourceUsage != nil {
+			if estimate := analysis.ResourceUsage.Services[name]; estimate != nil && estimate.HasLimits {
+				item.CPU, item.Memory = estimate.CPULimit, estimate.MemoryLimit
+			}
+		}
+		summary.Services = append(summary.Services, item)
+		dependencies[name] = &ServiceDependency{ServiceName: name, Dependents: make([]string, 0)}
+	}
+	// 只保留项目内定义的依赖，否则分层会把不存在的服务当成循环依赖
+	for _, name := range names {
+		for _, dep := range analysis.ServiceAnalysis[name].Dependencies {
+			if target, ok := dependencies[dep]; ok {
+				dependencies[name].Dependencies = append(dependencies[name].Dependencies, dep)
+				target.Dependents = append(target.Dependents, name)
+			}
+		}
+	}
+	summary.Layers = o.topologicalSort(dependencies)
+	for _, layer := range summary.Layers {
+		sort.Strings(layer)
+	}
+
+	for _, issue := range analysis.Issues {
+		summary.Issues = append(summary.Issues, summaryIssue{Service: issue.Service, Severity: issue.Severity, Category: issue.Category, Title: issue.Title})
+	}
+	sort.SliceStable(summary.Issues, func(i, j int) bool { return summary.Issues[i].Service < summary.Issues[j].Service })
+
+	if usage := analysis.ResourceUsage; usage != nil {
+		summary.Resources = map[string]string{"cpu": usage.TotalCPU, "memory": usage.TotalMemory}
+	}
+	if topology := analysis.NetworkTopology; topology != nil && len(topology.Networks) > 0 {
+		summary.Networks = make(map[string]*summaryNetwork, len(topology.Networks))
+		for name, network := range topology.Networks {
+			services := append([]string(nil), network.ConnectedServices...)
+			sort.Strings(services)
+			summary.Networks[name] = &summaryNetwork{Driver: network.Driver, Services: services}
+		}
+	}
+	for _, suggestion := range suggestions {
+		title := suggestion.Title
+		if len(suggestion.AffectedServices) > 0 {
+			title = strings.Join(suggestion.AffectedServices, ",") + ": " + title
+		}
+		summary.Existing = append(summary.Existing, title)
+	}
+	sort.Strings(summary.Existing)
+	return summary
+}
+
+// parseAISuggestions 解析模型返回的 JSON 数组（允许包在代码块或说明文字中），
+// 丢弃类别无效、标题为空或指向不存在服务的条目
+func parseAISuggestions(reply string, analysis *ArchitectureAnalysis) ([]*OptimizationSuggestion, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("AI reply contains no JSON array")
+	}
+	var items []aiSuggestion
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &items); err != nil {
+		return nil, fmt.Errorf("failed to parse AI suggestions: %w", err)
+	}
+
+	suggestions := make([]*OptimizationSuggestion, 0, len(items))
+	for _, item := range items {
+		category := OptimizationCategory(strings.ToLower(strings.TrimSpace(item.Category)))
+		switch category {
+		case OptimizationPerformance, OptimizationSecurity, OptimizationReliability, OptimizationCost, OptimizationMaintainability:
+		default:
+			continue
+		}
+		service := strings.TrimSpace(item.Service)
+		if item.Title == "" || (service != "" && analysis.ServiceAnalysis[service] == nil) {
+			continue
+		}
+		priority := OptimizationPriority(strings.ToLower(strings.TrimSpace(item.Priority)))
+		switch priority {
+		case PriorityCritical, PriorityHigh, PriorityMedium, PriorityLow:
+		default:
+			priority = PriorityMedium
+		}
+
+		suggestion := &OptimizationSuggestion{
+			ID:             fmt.Sprintf("ai-%s-%s", service, category),
+			Source:         SuggestionSourceAI,
+			Category:       category,
+			Priority:       priority,
+			Title:          item.Title,
+			Description:    item.Description,
+			Benefits:       item.Benefits,
+			Implementation: item.Implementation,
+			CodeExample:    item.ComposeDiff,
+		}
+		if service == "" {
+			suggestion.ID = fmt.Sprintf("ai-project-%s", category)
+		} else {
+			suggestion.AffectedServices = []string{service}
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, nil
+}
+
+// suggestionKey 去重键：影响的服务 + 类别
+func suggestionKey(suggestion *OptimizationSuggestion) string {
+	services := append([]string(nil), suggestion.AffectedServices...)
+	sort.Strings(services)
+	return strings.Join(services, ",") + "|" + string(suggestion.Category)
+}
+
+// mergeSuggestions 合并规则建议和 AI 建议：规则建议全部保留，
+// 与已有建议的服务和类别相同的 AI 建议被丢弃，AI 建议最多保留 maxAISuggestions 条
+func mergeSuggestions(rules, advice []*OptimizationSuggestion) []*OptimizationSuggestion {
+	seen := make(map[string]bool, len(rules)+len(advice))
+	for _, suggestion := range rules {
+		seen[suggestionKey(suggestion)] = true
+	}
+	merged := rules
+	added := 0
+	for _, suggestion := range advice {
+		key := suggestionKey(suggestion)
+		if seen[key] || added == maxAISuggestions {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, suggestion)
+		added++
+	}
+	return merged
+}
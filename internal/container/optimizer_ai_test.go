@@ -0,0 +1,170 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+)
+
+// fakeAdvisor 返回固定回复并记录收到的请求
+type fakeAdvisor struct {
+	reply   string
+	err     error
+	calls   int
+	prompts []string
+}
+
+func (f *fakeAdvisor) Advise(ctx context.Context, system, prompt string) (string, error) {
+	f.calls++
+	f.prompts = append(f.prompts, prompt)
+	return f.reply, f.err
+}
+
+// aiGoldenReply 包含重复、无效和指向不存在服务的条目
+const aiGoldenReply = "以下是建议：\n```json\n" + `[
+  {"service": "web", "category": "reliability", "priority": "high", "title": "和规则建议重复", "description": "应被去重"},
+  {"service": "api", "category": "performance", "priority": "HIGH", "title": "为 api 配置连接池", "description": "api 和 db 同在关键路径上", "benefits": ["降低数据库连接峰值"], "implementation": "设置 DB_POOL_SIZE", "compose_diff": "+      DB_POOL_SIZE: \"20\""},
+  {"service": "api", "category": "performance", "priority": "low", "title": "同一服务同一类别的第二条", "description": "应被去重"},
+  {"service": "ghost", "category": "security", "priority": "high", "title": "不存在的服务", "description": "应被丢弃"},
+  {"service": "db", "category": "fun", "priority": "high", "title": "无效类别", "description": "应被丢弃"},
+  {"service": "", "category": "cost", "priority": "urgent", "title": "按需缩减开发环境副本", "description": "项目级建议，未知优先级按 medium"}
+]` + "\n```"
+
+func goldenConfig() *ComposeConfig {
+	return &ComposeConfig{
+		Version: "3.8",
+		Services: map[string]*Service{
+			"web": {Image: "nginx:latest", Ports: []string{"80:80"}, DependsOn: []interface{}{"api"}},
+			"api": {
+				Image:     "myapp:1.0.0",
+				DependsOn: []interface{}{"db", "cache"},
+				Restart:   "on-failure",
+				Deploy:    &DeployConfig{Resources: &ResourcesConfig{Limits: &ResourceLimit{CPUs: "1.0", Memory: "512M"}}},
+			},
+			"db": {Image: "postgres:13", Restart: "unless-stopped"},
+		},
+	}
+}
+
+func TestArchitectureOptimizer_AIEnrichmentGolden(t *testing.T) {
+	advisor := &fakeAdvisor{reply: aiGoldenReply}
+	optimizer := &architectureOptimizerImpl{advisor: advisor, breaker: &adviceBreaker{now: time.Now}}
+	ctx := context.Background()
+
+	analysis, err := optimizer.AnalyzeArchitecture(ctx, goldenConfig())
+	if err != nil {
+		t.Fatalf("AnalyzeArchitecture failed: %v", err)
+	}
+	suggestions, err := optimizer.GenerateOptimizations(ctx, analysis)
+	if err != nil {
+		t.Fatalf("GenerateOptimizations failed: %v", err)
+	}
+	if advisor.calls != 1 {
+		t.Fatalf("Expected one AI call, got %d", advisor.calls)
+	}
+
+	type goldenSuggestion struct {
+		ID       string               `json:"id"`
+		Source   string               `json:"source"`
+		Category OptimizationCategory `json:"category"`
+		Priority OptimizationPriority `json:"priority"`
+		Services []string             `json:"affected_services"`
+		Title    string               `json:"title"`
+		Diff     string               `json:"code_example,omitempty"`
+	}
+	got := struct {
+		Prompt      json.RawMessage    `json:"prompt"`
+		Suggestions []goldenSuggestion `json:"suggestions"`
+	}{Prompt: json.RawMessage(advisor.prompts[0])}
+	for _, s := range suggestions {
+		item := goldenSuggestion{ID: s.ID, Source: s.Source, Category: s.Category, Priority: s.Priority, Services: s.AffectedServices, Title: s.Title}
+		if s.Source == SuggestionSourceAI {
+			item.Diff = s.CodeExample
+		}
+		got.Suggestions = append(got.Suggestions, item)
+	}
+	// 规则建议按服务遍历 map 生成，顺序不固定
+	sort.SliceStable(got.Suggestions, func(i, j int) bool {
+		a, b := got.Suggestions[i], got.Suggestions[j]
+		if a.Source != b.Source {
+			return a.Source > b.Source
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Title < b.Title
+	})
+	actual, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "optimizer_ai.golden.json")
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", golden, err)
+	}
+	if strings.TrimSpace(string(want)) != strings.TrimSpace(string(actual)) {
+		t.Errorf("Merged suggestions differ from %s:\n%s", golden, actual)
+	}
+}
+
+func TestArchitectureOptimizer_AIEnrichmentFallback(t *testing.T) {
+	ctx := context.Background()
+	rulesOnly := func(t *testing.T, optimizer *architectureOptimizerImpl, ctx context.Context) []*OptimizationSuggestion {
+		t.Helper()
+		analysis, err := optimizer.AnalyzeArchitecture(ctx, goldenConfig())
+		if err != nil {
+			t.Fatalf("AnalyzeArchitecture failed: %v", err)
+		}
+		suggestions, err := optimizer.GenerateOptimizations(ctx, analysis)
+		if err != nil {
+			t.Fatalf("Expected AI failures not to fail the analysis, got %v", err)
+		}
+		for _, s := range suggestions {
+			if s.Source != SuggestionSourceRules {
+				t.Errorf("Expected rule-only output, got %s from %q", s.ID, s.Source)
+			}
+		}
+		return suggestions
+	}
+
+	// AI 失败或回复无法解析时只返回规则建议，连续失败后熔断
+	now := time.Now()
+	breaker := &adviceBreaker{now: func() time.Time { return now }}
+	failing := &fakeAdvisor{err: errors.New("upstream 502")}
+	optimizer := &architectureOptimizerImpl{advisor: failing, breaker: breaker}
+	for i := 0; i < adviceFailureLimit+2; i++ {
+		rulesOnly(t, optimizer, ctx)
+	}
+	if failing.calls != adviceFailureLimit {
+		t.Errorf("Expected the breaker to stop calling the AI after %d failures, got %d calls", adviceFailureLimit, failing.calls)
+	}
+	now = now.Add(adviceCooldown)
+	failing.err, failing.reply = nil, "抱歉，我无法给出建议"
+	rulesOnly(t, optimizer, ctx)
+	if failing.calls != adviceFailureLimit+1 {
+		t.Errorf("Expected the AI to be retried after the cooldown, got %d calls", failing.calls)
+	}
+
+	// 请求参数或配置关闭时不调用 AI
+	skipped := &fakeAdvisor{reply: aiGoldenReply}
+	optimizer = &architectureOptimizerImpl{advisor: skipped, breaker: &adviceBreaker{now: time.Now}}
+	rulesOnly(t, optimizer, WithoutAISuggestions(ctx))
+
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.ComposeAnalysis.NoAISuggestions = true })
+	rulesOnly(t, optimizer, ctx)
+	if skipped.calls != 0 {
+		t.Errorf("Expected skipped enrichment not to call the AI, got %d calls", skipped.calls)
+	}
+}
@@ -0,0 +1,238 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"qwq/internal/security"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidPipeline 流水线定义无效
+	ErrInvalidPipeline = errors.New("invalid pipeline definition")
+	// ErrPipelineNotFound 流水线未找到
+	ErrPipelineNotFound = errors.New("pipeline not found")
+	// ErrPipelineAlreadyExists 同一租户下已存在同名流水线
+	ErrPipelineAlreadyExists = errors.New("pipeline already exists")
+	// ErrPipelineRunning 流水线已有运行中的实例
+	ErrPipelineRunning = errors.New("pipeline is already running")
+)
+
+// DeployStrategyPipeline 流水线运行记录使用的策略，运行本身也是一条部署记录，
+// 步骤状态以部署事件记录，人工审批步骤复用部署审批
+const DeployStrategyPipeline DeployStrategy = "pipeline"
+
+// StepType 流水线步骤类型
+type StepType string
+
+const (
+	StepDeploy         StepType = "deploy"          // 部署项目（可只部署部分服务）
+	StepBuild          StepType = "build"           // 构建带 build 的服务的镜像，后续 deploy 步骤直接使用
+	StepComposeRunJob  StepType = "compose-run-job" // 以项目中的服务运行一次性任务，如数据库迁移
+	StepHTTPCheck      StepType = "http-check"      // 检查 HTTP 接口返回期望的状态码
+	StepManualApproval StepType = "manual-approval" // 等待人工审批
+	StepShell          StepType = "shell"           // 执行 shell 命令，受命令执行策略约束
+)
+
+// FailurePolicy 步骤失败后的处理方式
+type FailurePolicy string
+
+const (
+	FailureAbort    FailurePolicy = "abort"    // 终止流水线（默认）
+	FailureContinue FailurePolicy = "continue" // 记录失败后继续执行后续步骤
+	FailureRollback FailurePolicy = "rollback" // 回滚本次运行中最后一次成功的部署后终止
+)
+
+// 各类型步骤未设置 timeout 时的默认超时，人工审批步骤默认使用部署审批的过期时间
+var defaultStepTimeouts = map[StepType]time.Duration{
+	StepDeploy:        30 * time.Minute,
+	StepBuild:         30 * time.Minute,
+	StepComposeRunJob: 30 * time.Minute,
+	StepHTTPCheck:     5 * time.Minute,
+	StepShell:         10 * time.Minute,
+}
+
+// Pipeline 流水线定义，名称在租户内唯一
+type Pipeline struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	ProjectID  uint            `json:"project_id" gorm:"not null;index"`              // 所属 Compose 项目
+	Project    *ComposeProject `json:"project,omitempty" gorm:"foreignKey:ProjectID"` // 关联项目
+	Name       string          `json:"name" gorm:"not null;index"`                    // 流水线名称
+	Definition string          `json:"definition" gorm:"type:text;not null"`          // YAML 定义
+	CreatedBy  string          `json:"created_by"`                                    // 创建人
+	UpdatedBy  string          `json:"updated_by"`                                    // 最后修改人
+	TenantID   uint            `json:"tenant_id" gorm:"index"`                        // 租户ID
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt  `json:"-" gorm:"index"`
+}
+
+// TableName 指定表名
+func (Pipeline) TableName() string {
+	return "pipelines"
+}
+
+// PipelineDefinition 流水线的 YAML 定义
+type PipelineDefinition struct {
+	Steps []PipelineStep `yaml:"steps" json:"steps"`
+}
+
+// PipelineStep 流水线步骤，除通用字段外只有与类型对应的字段生效
+type PipelineStep struct {
+	Name      string        `yaml:"name" json:"name"`
+	Type      StepType      `yaml:"type" json:"type"`
+	Timeout   string        `yaml:"timeout,omitempty" json:"timeout,omitempty"`       // 超时，如 10m
+	OnFailure FailurePolicy `yaml:"on_failure,omitempty" json:"on_failure,omitempty"` // 失败处理，默认 abort
+
+	// deploy、build（services）
+	Strategy           DeployStrategy `yaml:"strategy,omitempty" json:"strategy,omitempty"` // 部署策略，只部署部分服务时为 rolling_update
+	Services           []string       `yaml:"services,omitempty" json:"services,omitempty"` // 只部署（构建）这些服务，为空时为全部服务
+	HealthCheckDelay   *int           `yaml:"health_check_delay,omitempty" json:"health_check_delay,omitempty"`
+	HealthCheckRetries int            `yaml:"health_check_retries,omitempty" json:"health_check_retries,omitempty"`
+	Probes             []DeployProbe  `yaml:"probes,omitempty" json:"probes,omitempty"` // deploy 步骤的部署后验证探针
+
+	// compose-run-job（service + command）、shell（command）
+	Service string      `yaml:"service,omitempty" json:"service,omitempty"`
+	Command interface{} `yaml:"command,omitempty" json:"command,omitempty"` // 字符串，任务也可以是参数数组
+
+	// http-check
+	URL          string `yaml:"url,omitempty" json:"url,omitempty"`
+	ExpectStatus int    `yaml:"expect_status,omitempty" json:"expect_status,omitempty"` // 默认 200
+	Retries      int    `yaml:"retries,omitempty" json:"retries,omitempty"`             // 总尝试次数，默认 1
+	Interval     string `yaml:"interval,omitempty" json:"interval,omitempty"`           // 重试间隔，默认 5s
+
+	// manual-approval
+	Message string `yaml:"message,omitempty" json:"message,omitempty"` // 审批说明
+}
+
+// timeout 步骤的超时时间，解析时已校验格式
+func (s *PipelineStep) timeout() time.Duration {
+	if d, err := time.ParseDuration(s.Timeout); err == nil && d > 0 {
+		return d
+	}
+	if s.Type == StepManualApproval {
+		return approvalExpiry()
+	}
+	return defaultStepTimeouts[s.Type]
+}
+
+// onFailure 步骤的失败处理方式
+func (s *PipelineStep) onFailure() FailurePolicy {
+	if s.OnFailure == "" {
+		return FailureAbort
+	}
+	return s.OnFailure
+}
+
+// shellCommand shell 步骤的命令
+func (s *PipelineStep) shellCommand() string {
+	command, _ := s.Command.(string)
+	return strings.TrimSpace(command)
+}
+
+// ParsePipelineDefinition 解析并校验流水线定义
+// 命令执行策略拒绝的 shell 命令在保存时即报错，需要确认的命令在运行时先等待审批
+func ParsePipelineDefinition(content string) (*PipelineDefinition, error) {
+	var def PipelineDefinition
+	if err := yaml.Unmarshal([]byte(content), &def); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPipeline, err)
+	}
+	if len(def.Steps) == 0 {
+		return nil, fmt.Errorf("%w: at least one step is required", ErrInvalidPipeline)
+	}
+
+	names := make(map[string]bool, len(def.Steps))
+	for i := range def.Steps {
+		step := &def.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step-%d", i+1)
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("%w: duplicate step name %q", ErrInvalidPipeline, step.Name)
+		}
+		names[step.Name] = true
+		if err := validateStep(step); err != nil {
+			return nil, fmt.Errorf("%w: step %s: %v", ErrInvalidPipeline, step.Name, err)
+		}
+	}
+	return &def, nil
+}
+
+// validateStep 校验单个步骤
+func validateStep(step *PipelineStep) error {
+	if step.Timeout != "" {
+		if d, err := time.ParseDuration(step.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", step.Timeout)
+		}
+	}
+	switch step.onFailure() {
+	case FailureAbort, FailureContinue, FailureRollback:
+	default:
+		return fmt.Errorf("invalid on_failure %q (abort, continue or rollback)", step.OnFailure)
+	}
+
+	switch step.Type {
+	case StepDeploy:
+		if step.Strategy == "" {
+			step.Strategy = DeployStrategyRecreate
+			if len(step.Services) > 0 {
+				step.Strategy = DeployStrategyRollingUpdate
+			}
+		}
+		switch step.Strategy {
+		case DeployStrategyRecreate, DeployStrategyRollingUpdate, DeployStrategyBlueGreen:
+		default:
+			return fmt.Errorf("unsupported strategy %q", step.Strategy)
+		}
+		if len(step.Services) > 0 && step.Strategy != DeployStrategyRollingUpdate {
+			return fmt.Errorf("services can only be deployed individually with %s", DeployStrategyRollingUpdate)
+		}
+		if err := ValidateProbes(step.Probes, nil); err != nil {
+			return err
+		}
+	case StepBuild:
+		if step.Strategy != "" {
+			return errors.New("strategy is only valid for deploy steps")
+		}
+	case StepComposeRunJob:
+		if step.Service == "" {
+			return errors.New("service is required")
+		}
+	case StepHTTPCheck:
+		u, err := url.Parse(step.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url %q", step.URL)
+		}
+		if step.ExpectStatus != 0 && (step.ExpectStatus < 100 || step.ExpectStatus > 599) {
+			return fmt.Errorf("invalid expect_status %d", step.ExpectStatus)
+		}
+		if step.Retries < 0 {
+			return errors.New("retries must not be negative")
+		}
+		if step.Interval != "" {
+			if d, err := time.ParseDuration(step.Interval); err != nil || d < 0 {
+				return fmt.Errorf("invalid interval %q", step.Interval)
+			}
+		}
+	case StepManualApproval:
+	case StepShell:
+		command := step.shellCommand()
+		if command == "" {
+			return errors.New("command must be a non-empty string")
+		}
+		if decision := security.EvaluateAutoExec(command); decision.Action == security.ActionDeny {
+			return fmt.Errorf("command denied by policy (rule %s)", decision.Rule)
+		}
+	case "":
+		return errors.New("type is required")
+	default:
+		return fmt.Errorf("unknown type %q", step.Type)
+	}
+	return nil
+}
@@ -0,0 +1,661 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"qwq/internal/logger"
+	"qwq/internal/security"
+	"qwq/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// errStepRejected 人工审批步骤被拒绝
+var errStepRejected = errors.New("approval rejected")
+
+const (
+	// defaultPipelinePoll 等待部署完成和审批结果的轮询间隔
+	defaultPipelinePoll = 2 * time.Second
+	// maxStepOutput 步骤事件中保留的输出长度
+	maxStepOutput = 4000
+)
+
+// PipelineService 流水线定义管理和运行
+// 每次运行创建一条策略为 pipeline 的部署记录，步骤状态以部署事件记录（service_name 为步骤名），
+// 人工审批步骤和需要确认的 shell 命令将运行记录置为等待审批，通过部署审批接口审批或拒绝
+type PipelineService struct {
+	db       *gorm.DB
+	compose  ComposeService
+	deployer *deploymentServiceImpl
+	jobs     JobRunner
+	client   *http.Client
+	shell    func(ctx context.Context, command string) *utils.ShellResult
+	poll     time.Duration
+}
+
+// NewPipelineService 创建流水线服务，执行器未实现 JobRunner 时一次性任务通过 docker CLI 运行
+func NewPipelineService(db *gorm.DB, composeService ComposeService, dockerExecutor DockerExecutor) *PipelineService {
+	jobs, ok := dockerExecutor.(JobRunner)
+	if !ok {
+		jobs = &cliDockerExecutor{}
+	}
+	return &PipelineService{
+		db:       db,
+		compose:  composeService,
+		deployer: NewDeploymentService(db, composeService, dockerExecutor).(*deploymentServiceImpl),
+		jobs:     jobs,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		shell:    utils.RunShellContext,
+		poll:     defaultPipelinePoll,
+	}
+}
+
+// CreatePipeline 校验定义并创建流水线，租户取所属项目的租户
+func (p *PipelineService) CreatePipeline(ctx context.Context, pipeline *Pipeline) error {
+	if pipeline.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPipeline)
+	}
+	if _, err := ParsePipelineDefinition(pipeline.Definition); err != nil {
+		return err
+	}
+	project, err := p.compose.GetProject(ctx, pipeline.ProjectID)
+	if err != nil {
+		return err
+	}
+	pipeline.TenantID = project.TenantID
+
+	var count int64
+	if err := p.db.WithContext(ctx).Model(&Pipeline{}).
+		Where("name = ? AND tenant_id = ?", pipeline.Name, pipeline.TenantID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check pipeline existence: %w", err)
+	}
+	if count > 0 {
+		return ErrPipelineAlreadyExists
+	}
+	if err := p.db.WithContext(ctx).Create(pipeline).Error; err != nil {
+		return fmt.Errorf("failed to create pipeline: %w", err)
+	}
+	logger.Info("[AUDIT] 🧩 流水线已创建: %s（项目 %s）by %s", pipeline.Name, project.Name, pipeline.CreatedBy)
+	return nil
+}
+
+// GetPipeline 获取流水线
+func (p *PipelineService) GetPipeline(ctx context.Context, id uint) (*Pipeline, error) {
+	var pipeline Pipeline
+	if err := p.db.WithContext(ctx).First(&pipeline, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPipelineNotFound
+		}
+		return nil, fmt.Errorf("failed to get pipeline: %w", err)
+	}
+	return &pipeline, nil
+}
+
+// GetPipelineByName 按名称获取租户内的流水线
+func (p *PipelineService) GetPipelineByName(ctx context.Context, name string, tenantID uint) (*Pipeline, error) {
+	var pipeline Pipeline
+	if err := p.db.WithContext(ctx).Where("name = ? AND tenant_id = ?", name, tenantID).First(&pipeline).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPipelineNotFound
+		}
+		return nil, fmt.Errorf("failed to get pipeline: %w", err)
+	}
+	return &pipeline, nil
+}
+
+// ListPipelines 列出项目的流水线，projectID 为 0 时列出全部
+func (p *PipelineService) ListPipelines(ctx context.Context, projectID uint) ([]*Pipeline, error) {
+	var pipelines []*Pipeline
+	query := p.db.WithContext(ctx).Model(&Pipeline{})
+	if projectID > 0 {
+		query = query.Where("project_id = ?", projectID)
+	}
+	if err := query.Order("name ASC").Find(&pipelines).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pipelines: %w", err)
+	}
+	return pipelines, nil
+}
+
+// UpdatePipeline 校验并替换流水线定义，运行中的实例继续使用开始运行时的定义
+func (p *PipelineService) UpdatePipeline(ctx context.Context, id uint, definition, actor string) (*Pipeline, error) {
+	pipeline, err := p.GetPipeline(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParsePipelineDefinition(definition); err != nil {
+		return nil, err
+	}
+	if err := p.db.WithContext(ctx).Model(pipeline).Updates(map[string]interface{}{
+		"definition": definition,
+		"updated_by": actor,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update pipeline: %w", err)
+	}
+	logger.Info("[AUDIT] 🧩 流水线定义已更新: %s by %s", pipeline.Name, actor)
+	return p.GetPipeline(ctx, id)
+}
+
+// DeletePipeline 删除流水线，历史运行记录保留
+func (p *PipelineService) DeletePipeline(ctx context.Context, id uint, actor string) error {
+	pipeline, err := p.GetPipeline(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := p.db.WithContext(ctx).Delete(pipeline).Error; err != nil {
+		return fmt.Errorf("failed to delete pipeline: %w", err)
+	}
+	logger.Info("[AUDIT] 🗑️ 流水线已删除: %s by %s", pipeline.Name, actor)
+	return nil
+}
+
+// ListRuns 列出流水线的运行记录，最新的在前
+func (p *PipelineService) ListRuns(ctx context.Context, pipelineID uint) ([]*Deployment, error) {
+	var runs []*Deployment
+	if err := p.db.WithContext(ctx).Where("pipeline_id = ?", pipelineID).
+		Order("id DESC").Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pipeline runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetRun 获取运行记录（即部署记录）
+func (p *PipelineService) GetRun(ctx context.Context, runID uint) (*Deployment, error) {
+	return p.deployer.GetDeployment(ctx, runID)
+}
+
+// CancelRun 取消运行，正在执行的步骤结束后不再执行后续步骤
+func (p *PipelineService) CancelRun(ctx context.Context, runID uint) error {
+	return p.deployer.CancelDeployment(ctx, runID)
+}
+
+// EventsSince 获取部署记录中 ID 大于 afterID 的事件，用于增量推送
+func (p *PipelineService) EventsSince(ctx context.Context, deploymentID, afterID uint) ([]*DeploymentEvent, error) {
+	var events []*DeploymentEvent
+	if err := p.db.WithContext(ctx).
+		Where("deployment_id = ? AND id > ?", deploymentID, afterID).
+		Order("id ASC").
+		Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to get deployment events: %w", err)
+	}
+	return events, nil
+}
+
+// Run 开始运行流水线，返回运行记录；同一流水线同时只能有一个运行中的实例
+// 发起人从 ctx 中读取（WithRequester），人工审批时默认不允许发起人自己审批
+func (p *PipelineService) Run(ctx context.Context, pipelineID uint) (*Deployment, error) {
+	pipeline, err := p.GetPipeline(ctx, pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	def, err := ParsePipelineDefinition(pipeline.Definition)
+	if err != nil {
+		return nil, err
+	}
+	project, err := p.compose.GetProject(ctx, pipeline.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	var running int64
+	if err := p.db.WithContext(ctx).Model(&Deployment{}).
+		Where("pipeline_id = ? AND status IN ?", pipeline.ID, []DeploymentStatus{
+			DeploymentStatusPending, DeploymentStatusInProgress, DeploymentStatusPendingApproval,
+		}).Count(&running).Error; err != nil {
+		return nil, fmt.Errorf("failed to check running pipelines: %w", err)
+	}
+	if running > 0 {
+		return nil, ErrPipelineRunning
+	}
+
+	now := time.Now()
+	run := &Deployment{
+		ProjectID:   project.ID,
+		Version:     fmt.Sprintf("%s-%d", pipeline.Name, now.Unix()),
+		Strategy:    DeployStrategyPipeline,
+		Status:      DeploymentStatusInProgress,
+		StartedAt:   &now,
+		Message:     "流水线开始运行",
+		RequestedBy: RequesterFromContext(ctx),
+		PipelineID:  &pipeline.ID,
+		UserID:      project.UserID,
+		TenantID:    project.TenantID,
+	}
+	if err := p.db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create pipeline run: %w", err)
+	}
+
+	p.deployer.recordEvent(ctx, run.ID, "pipeline_started", "",
+		fmt.Sprintf("流水线 %s 开始运行，共 %d 个步骤", pipeline.Name, len(def.Steps)), "")
+	logger.Info("[AUDIT] 🧩 流水线开始运行: %s #%d by %s", pipeline.Name, run.ID, run.RequestedBy)
+
+	go p.execute(context.Background(), run, pipeline, def, project)
+	return run, nil
+}
+
+// stepResult 步骤执行结果，记录在步骤事件的 details 中
+type stepResult struct {
+	Output       string            `json:"output,omitempty"`
+	DeploymentID uint              `json:"deployment_id,omitempty"` // deploy 步骤创建的部署记录
+	Images       map[string]string `json:"images,omitempty"`        // build 步骤构建出的镜像
+	Duration     string            `json:"duration"`
+}
+
+// execute 依次执行各步骤，按步骤的失败处理方式决定是否继续
+func (p *PipelineService) execute(ctx context.Context, run *Deployment, pipeline *Pipeline,
+	def *PipelineDefinition, project *ComposeProject) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			utils.RecordPanic("pipeline-runner", r, debug.Stack())
+			p.finish(ctx, run, pipeline, DeploymentStatusFailed, fmt.Sprintf("流水线执行异常: %v", r))
+		}
+	}()
+
+	var lastDeployment uint          // 本次运行中最后一次成功的部署，rollback 时回滚该部署
+	built := make(map[string]string) // build 步骤构建出的镜像，后续 deploy 步骤不再重新构建
+	var failed []string
+	total := len(def.Steps)
+	for i := range def.Steps {
+		step := &def.Steps[i]
+		if current, err := p.deployer.GetDeployment(ctx, run.ID); err == nil && current.Status != DeploymentStatusInProgress {
+			p.deployer.recordEvent(ctx, run.ID, "step_skipped", step.Name, "流水线已被取消，跳过剩余步骤", "")
+			return
+		}
+		p.deployer.updateDeploymentStatus(ctx, run.ID, DeploymentStatusInProgress, i*100/total,
+			fmt.Sprintf("执行步骤 %s（%d/%d）", step.Name, i+1, total))
+		p.deployer.recordEvent(ctx, run.ID, "step_started", step.Name,
+			fmt.Sprintf("开始执行 %s 步骤 %s", step.Type, step.Name), "")
+
+		start := time.Now()
+		stepCtx, cancel := context.WithTimeout(ctx, step.timeout())
+		result, err := p.runStep(stepCtx, run, project, step, built)
+		if err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("步骤超时（%s）: %w", step.timeout(), err)
+		}
+		cancel()
+		result.Duration = time.Since(start).Round(time.Millisecond).String()
+		details, _ := json.Marshal(result)
+
+		if err == nil {
+			switch step.Type {
+			case StepDeploy:
+				lastDeployment = result.DeploymentID
+			case StepBuild:
+				for service, image := range result.Images {
+					built[service] = image
+				}
+			}
+			p.deployer.recordEvent(ctx, run.ID, "step_succeeded", step.Name, fmt.Sprintf("步骤 %s 执行成功", step.Name), string(details))
+			continue
+		}
+
+		p.deployer.recordEvent(ctx, run.ID, "step_failed", step.Name, fmt.Sprintf("步骤 %s 失败: %v", step.Name, err), string(details))
+		switch step.onFailure() {
+		case FailureContinue:
+			failed = append(failed, step.Name)
+			if errors.Is(err, errStepRejected) || errors.Is(err, ErrApprovalExpired) {
+				p.deployer.updateDeploymentStatus(ctx, run.ID, DeploymentStatusInProgress, (i+1)*100/total,
+					fmt.Sprintf("步骤 %s 未获审批，继续执行", step.Name))
+			}
+			continue
+		case FailureRollback:
+			p.rollback(ctx, run, lastDeployment)
+		}
+		status := DeploymentStatusFailed
+		switch {
+		case errors.Is(err, errStepRejected):
+			status = DeploymentStatusRejected
+		case errors.Is(err, ErrApprovalExpired):
+			status = DeploymentStatusExpired
+		}
+		p.finish(ctx, run, pipeline, status, fmt.Sprintf("步骤 %s 失败: %v", step.Name, err))
+		return
+	}
+
+	message := "流水线运行完成"
+	if len(failed) > 0 {
+		message = fmt.Sprintf("流水线运行完成，失败后继续的步骤: %s", strings.Join(failed, ", "))
+	}
+	p.finish(ctx, run, pipeline, DeploymentStatusCompleted, message)
+}
+
+// runStep 执行单个步骤，built 为之前的 build 步骤构建出的镜像
+func (p *PipelineService) runStep(ctx context.Context, run *Deployment, project *ComposeProject, step *PipelineStep,
+	built map[string]string) (stepResult, error) {
+	switch step.Type {
+	case StepDeploy:
+		return p.runDeploy(ctx, run, project, step, built)
+	case StepBuild:
+		return p.runBuild(ctx, run, project, step)
+	case StepComposeRunJob:
+		output, err := p.jobs.RunJob(ctx, project.Name, project.Content, step.Service, commandList(step.Command))
+		return stepResult{Output: truncateStepOutput(output)}, err
+	case StepHTTPCheck:
+		return p.runHTTPCheck(ctx, step)
+	case StepManualApproval:
+		message := step.Message
+		if message == "" {
+			message = fmt.Sprintf("流水线步骤 %s 等待审批", step.Name)
+		}
+		return p.awaitApproval(ctx, run, project, step, message)
+	case StepShell:
+		return p.runShell(ctx, run, project, step)
+	}
+	return stepResult{}, fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// runDeploy 部署项目并等待部署结束；项目需要审批时部署本身进入审批流程
+func (p *PipelineService) runDeploy(ctx context.Context, run *Deployment, project *ComposeProject, step *PipelineStep,
+	built map[string]string) (stepResult, error) {
+	deployConfig := &DeploymentConfig{
+		Strategy:           step.Strategy,
+		Services:           step.Services,
+		Images:             built,
+		Probes:             step.Probes,
+		MaxSurge:           1,
+		HealthCheckDelay:   10,
+		HealthCheckRetries: 3,
+		RollbackOnFailure:  true,
+	}
+	if step.HealthCheckDelay != nil {
+		deployConfig.HealthCheckDelay = *step.HealthCheckDelay
+	}
+	if step.HealthCheckRetries > 0 {
+		deployConfig.HealthCheckRetries = step.HealthCheckRetries
+	}
+
+	deployment, err := p.deployer.Deploy(WithRequester(ctx, run.RequestedBy), project.ID, deployConfig)
+	if err != nil {
+		return stepResult{}, err
+	}
+	result := stepResult{DeploymentID: deployment.ID}
+	p.deployer.recordEvent(ctx, run.ID, "step_progress", step.Name, fmt.Sprintf("已创建部署 #%d", deployment.ID), "")
+
+	ticker := time.NewTicker(p.poll)
+	defer ticker.Stop()
+	for {
+		current, err := p.deployer.GetDeployment(ctx, deployment.ID)
+		if err != nil {
+			return result, err
+		}
+		if current.Status == DeploymentStatusCompleted {
+			return result, nil
+		}
+		if deploymentFinished(current.Status) {
+			return result, fmt.Errorf("部署 #%d %s: %s", deployment.ID, current.Status, current.Message)
+		}
+		select {
+		case <-ctx.Done():
+			// 超时后取消仍在等待或执行中的部署，避免其在流水线结束后继续运行
+			p.deployer.CancelDeployment(context.Background(), deployment.ID)
+			return result, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// runBuild 构建镜像，构建日志记录在流水线运行记录中，镜像以运行版本为标签
+func (p *PipelineService) runBuild(ctx context.Context, run *Deployment, project *ComposeProject, step *PipelineStep) (stepResult, error) {
+	if p.deployer.builds == nil {
+		return stepResult{}, fmt.Errorf("%w: image builds are not configured", ErrBuildFailed)
+	}
+	composeConfig, err := p.compose.ParseComposeFile(ctx, project.Content)
+	if err != nil {
+		return stepResult{}, fmt.Errorf("%w: %v", ErrInvalidComposeFile, err)
+	}
+	names, err := buildableServices(composeConfig, step.Services)
+	if err != nil {
+		return stepResult{}, err
+	}
+	builds, err := p.deployer.builds.BuildServices(ctx, run, project, composeConfig.Services, names)
+	result := stepResult{Images: make(map[string]string, len(builds))}
+	for _, build := range builds {
+		result.Images[build.Service] = build.Image
+	}
+	return result, err
+}
+
+// runHTTPCheck 请求接口直到返回期望的状态码或用完尝试次数
+func (p *PipelineService) runHTTPCheck(ctx context.Context, step *PipelineStep) (stepResult, error) {
+	expect := step.ExpectStatus
+	if expect == 0 {
+		expect = http.StatusOK
+	}
+	attempts := step.Retries
+	if attempts <= 0 {
+		attempts = 1
+	}
+	interval := 5 * time.Second
+	if d, err := time.ParseDuration(step.Interval); err == nil {
+		interval = d
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return stepResult{}, fmt.Errorf("%v (last error: %v)", ctx.Err(), lastErr)
+			case <-time.After(interval):
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, step.URL, nil)
+		if err != nil {
+			return stepResult{}, err
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == expect {
+			return stepResult{Output: fmt.Sprintf("%s 返回 %d（第 %d 次尝试）", step.URL, resp.StatusCode, attempt)}, nil
+		}
+		lastErr = fmt.Errorf("unexpected status %d (expected %d)", resp.StatusCode, expect)
+	}
+	return stepResult{}, fmt.Errorf("%s 检查失败（%d 次尝试）: %w", step.URL, attempts, lastErr)
+}
+
+// runShell 按命令执行策略执行 shell 命令：拒绝的命令不执行，需要确认的命令先等待审批
+func (p *PipelineService) runShell(ctx context.Context, run *Deployment, project *ComposeProject, step *PipelineStep) (stepResult, error) {
+	command := step.shellCommand()
+	decision := security.EvaluateAutoExec(command)
+	switch decision.Action {
+	case security.ActionDeny:
+		return stepResult{}, fmt.Errorf("命令被执行策略拒绝（规则 %s）: %s", decision.Rule, command)
+	case security.ActionConfirm:
+		message := fmt.Sprintf("流水线步骤 %s 的命令需要确认（规则 %s）: %s", step.Name, decision.Rule, command)
+		if _, err := p.awaitApproval(ctx, run, project, step, message); err != nil {
+			return stepResult{}, err
+		}
+	}
+
+	logger.Info("[AUDIT] 🧩 流水线执行命令: #%d %s: %s by %s", run.ID, step.Name, command, run.RequestedBy)
+	result := p.shell(ctx, command)
+	output := stepResult{Output: truncateStepOutput(result.Combined())}
+	if !result.OK() {
+		return output, fmt.Errorf("命令执行失败: exit code %d", result.ExitCode)
+	}
+	return output, nil
+}
+
+// awaitApproval 将运行记录置为等待审批并等待审批结果，审批通过、拒绝和过期都复用部署审批
+func (p *PipelineService) awaitApproval(ctx context.Context, run *Deployment, project *ComposeProject,
+	step *PipelineStep, message string) (stepResult, error) {
+
+	expiresAt := time.Now().Add(step.timeout())
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(expiresAt) {
+		expiresAt = deadline
+	}
+	result := p.db.WithContext(ctx).Model(&Deployment{}).
+		Where("id = ? AND status = ?", run.ID, DeploymentStatusInProgress).
+		Updates(map[string]interface{}{
+			"status":              DeploymentStatusPendingApproval,
+			"approval_expires_at": &expiresAt,
+			"message":             message,
+		})
+	if result.Error != nil {
+		return stepResult{}, fmt.Errorf("failed to request approval: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return stepResult{}, errors.New("pipeline run is no longer in progress")
+	}
+	p.deployer.recordEvent(ctx, run.ID, "step_awaiting_approval", step.Name, message, "")
+	waiting := *run
+	waiting.ApprovalExpiresAt = &expiresAt
+	p.deployer.requestApproval(ctx, &waiting, project)
+
+	ticker := time.NewTicker(p.poll)
+	defer ticker.Stop()
+	for {
+		current, err := p.deployer.GetDeployment(ctx, run.ID)
+		if err != nil {
+			return stepResult{}, err
+		}
+		switch current.Status {
+		case DeploymentStatusInProgress:
+			return stepResult{Output: fmt.Sprintf("由 %s 审批通过", current.ApprovedBy)}, nil
+		case DeploymentStatusRejected:
+			return stepResult{}, fmt.Errorf("%w by %s: %s", errStepRejected, current.ApprovedBy, current.RejectReason)
+		case DeploymentStatusExpired:
+			return stepResult{}, ErrApprovalExpired
+		case DeploymentStatusPendingApproval:
+		default:
+			return stepResult{}, fmt.Errorf("pipeline run is %s", current.Status)
+		}
+		if !time.Now().Before(expiresAt) {
+			p.deployer.expireApproval(context.Background(), run.ID, time.Now())
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			p.deployer.expireApproval(context.Background(), run.ID, time.Now())
+			return stepResult{}, ErrApprovalExpired
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollback 回滚本次运行中最后一次成功的部署
+func (p *PipelineService) rollback(ctx context.Context, run *Deployment, deploymentID uint) {
+	if deploymentID == 0 {
+		p.deployer.recordEvent(ctx, run.ID, "pipeline_rollback_skipped", "", "本次运行没有成功的部署，无需回滚", "")
+		return
+	}
+	p.deployer.recordEvent(ctx, run.ID, "pipeline_rollback_started", "", fmt.Sprintf("开始回滚部署 #%d", deploymentID), "")
+	if err := p.deployer.RollbackDeployment(ctx, deploymentID); err != nil {
+		p.deployer.recordEvent(ctx, run.ID, "pipeline_rollback_failed", "", fmt.Sprintf("回滚部署 #%d 失败: %v", deploymentID, err), "")
+		return
+	}
+	p.deployer.recordEvent(ctx, run.ID, "pipeline_rollback_completed", "", fmt.Sprintf("部署 #%d 已回滚", deploymentID), "")
+}
+
+// finish 记录运行结果
+func (p *PipelineService) finish(ctx context.Context, run *Deployment, pipeline *Pipeline, status DeploymentStatus, message string) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       status,
+		"message":      message,
+		"completed_at": &now,
+	}
+	if status == DeploymentStatusCompleted {
+		updates["progress"] = 100
+	}
+	p.db.WithContext(ctx).Model(&Deployment{}).Where("id = ?", run.ID).Updates(updates)
+
+	eventType := "pipeline_completed"
+	if status != DeploymentStatusCompleted {
+		eventType = "pipeline_failed"
+	}
+	p.deployer.recordEvent(ctx, run.ID, eventType, "", message, "")
+	logger.Info("[AUDIT] 🧩 流水线运行结束: %s #%d %s: %s", pipeline.Name, run.ID, status, message)
+}
+
+// truncateStepOutput 截断步骤输出，保留末尾（错误信息通常在最后）
+func truncateStepOutput(output string) string {
+	if len(output) <= maxStepOutput {
+		return output
+	}
+	start := len(output) - maxStepOutput
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return "...(truncated)\n" + output[start:]
+}
+
+// DeploymentStreamFrame 部署事件推送的消息：新事件（type=event）或状态变化（type=status）
+type DeploymentStreamFrame struct {
+	Type     string           `json:"type"`
+	Event    *DeploymentEvent `json:"event,omitempty"`
+	Status   DeploymentStatus `json:"status,omitempty"`
+	Progress int              `json:"progress,omitempty"`
+	Message  string           `json:"message,omitempty"`
+}
+
+// Stream 推送部署（包括流水线运行）的已有事件和后续的新事件与状态变化，部署结束或 ctx 结束时返回
+// 流水线运行以 pipeline_completed / pipeline_failed 事件为结束标志，审批被拒绝后仍可能继续执行
+func (p *PipelineService) Stream(ctx context.Context, deploymentID uint, send func(DeploymentStreamFrame) error) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastEvent uint
+	var last DeploymentStreamFrame
+	for {
+		events, err := p.EventsSince(ctx, deploymentID, lastEvent)
+		if err != nil {
+			return err
+		}
+		finished := false
+		for _, event := range events {
+			if err := send(DeploymentStreamFrame{Type: "event", Event: event}); err != nil {
+				return err
+			}
+			lastEvent = event.ID
+			finished = finished || event.EventType == "pipeline_completed" || event.EventType == "pipeline_failed"
+		}
+
+		current, err := p.deployer.GetDeployment(ctx, deploymentID)
+		if err != nil {
+			return err
+		}
+		frame := DeploymentStreamFrame{Type: "status", Status: current.Status, Progress: current.Progress, Message: current.Message}
+		if frame != last {
+			if err := send(frame); err != nil {
+				return err
+			}
+			last = frame
+		}
+		if current.Strategy != DeployStrategyPipeline {
+			finished = deploymentFinished(current.Status)
+		}
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// deploymentFinished 部署是否已结束
+func deploymentFinished(status DeploymentStatus) bool {
+	switch status {
+	case DeploymentStatusCompleted, DeploymentStatusFailed, DeploymentStatusRolledBack,
+		DeploymentStatusRejected, DeploymentStatusExpired:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+package container
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qwq/internal/apierror"
+	"qwq/internal/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeJobRunner 记录一次性任务的调用
+type fakeJobRunner struct {
+	mu    sync.Mutex
+	calls []string
+	err   error
+}
+
+func (f *fakeJobRunner) RunJob(ctx context.Context, projectName, composeContent, serviceName string, command []string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, serviceName+" "+strings.Join(command, " "))
+	return "migrated", f.err
+}
+
+func setupPipelineTest(t *testing.T) (*PipelineService, *fakeJobRunner, *[]string, *ComposeProject) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}, &Deployment{}, &DeploymentEvent{},
+		&ServiceInstance{}, &Pipeline{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	composeService := NewComposeService(db)
+	project := &ComposeProject{Name: "shop", Content: revisionTestContent, TenantID: 1}
+	if err := composeService.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	jobs := &fakeJobRunner{}
+	var commands []string
+	executor := newMockDockerExecutor()
+	executor.containerStatus["mock-container-id"] = "running"
+	service := NewPipelineService(db, composeService, executor)
+	service.deployer.composeFiles = nil
+	service.jobs = jobs
+	service.poll = 10 * time.Millisecond
+	service.shell = func(ctx context.Context, command string) *utils.ShellResult {
+		commands = append(commands, command)
+		if strings.HasPrefix(command, "ls /missing") {
+			return &utils.ShellResult{Command: command, ExitCode: 1, Err: "exit status 1"}
+		}
+		return &utils.ShellResult{Command: command, Stdout: "ok"}
+	}
+	return service, jobs, &commands, project
+}
+
+func createPipeline(t *testing.T, service *PipelineService, project *ComposeProject, definition string) *Pipeline {
+	t.Helper()
+	pipeline := &Pipeline{ProjectID: project.ID, Name: "release", Definition: definition, CreatedBy: "alice"}
+	if err := service.CreatePipeline(context.Background(), pipeline); err != nil {
+		t.Fatalf("CreatePipeline: %v", err)
+	}
+	return pipeline
+}
+
+// waitRun 等待流水线运行结束，确认其最终状态
+func waitRun(t *testing.T, service *PipelineService, runID uint, status DeploymentStatus) *Deployment {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, err := service.EventsSince(context.Background(), runID, 0)
+		if err != nil {
+			t.Fatalf("EventsSince: %v", err)
+		}
+		if n := len(events); n > 0 && strings.HasPrefix(events[n-1].EventType, "pipeline_") && events[n-1].EventType != "pipeline_started" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Pipeline run #%d did not finish", runID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	run, err := service.GetRun(context.Background(), runID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.Status != status {
+		t.Fatalf("Expected run status %s, got %s: %s", status, run.Status, run.Message)
+	}
+	return run
+}
+
+// stepEvents 按顺序返回步骤事件，格式为 "步骤名:事件类型"
+func stepEvents(t *testing.T, service *PipelineService, runID uint) []string {
+	t.Helper()
+	events, err := service.deployer.GetDeploymentEvents(context.Background(), runID)
+	if err != nil {
+		t.Fatalf("GetDeploymentEvents: %v", err)
+	}
+	var result []string
+	for _, event := range events {
+		if event.ServiceName != "" && event.EventType != "step_started" {
+			result = append(result, event.ServiceName+":"+event.EventType)
+		}
+	}
+	return result
+}
+
+func TestParsePipelineDefinition(t *testing.T) {
+	def, err := ParsePipelineDefinition(`
+steps:
+  - name: deploy-web
+    type: deploy
+    services: [web]
+  - type: manual-approval
+`)
+	if err != nil {
+		t.Fatalf("ParsePipelineDefinition: %v", err)
+	}
+	if def.Steps[0].Strategy != DeployStrategyRollingUpdate || def.Steps[0].onFailure() != FailureAbort {
+		t.Errorf("Expected a rolling update that aborts on failure by default, got %+v", def.Steps[0])
+	}
+	if def.Steps[1].Name != "step-2" || def.Steps[1].timeout() != approvalExpiry() {
+		t.Errorf("Expected a generated name and the approval expiry as timeout, got %+v", def.Steps[1])
+	}
+
+	invalid := map[string]string{
+		"no steps":       "steps: []",
+		"unknown type":   "steps:\n  - name: a\n    type: ftp",
+		"duplicate name": "steps:\n  - name: a\n    type: manual-approval\n  - name: a\n    type: manual-approval",
+		"bad timeout":    "steps:\n  - type: manual-approval\n    timeout: soon",
+		"bad policy":     "steps:\n  - type: manual-approval\n    on_failure: retry",
+		"partial deploy": "steps:\n  - type: deploy\n    strategy: recreate\n    services: [web]",
+		"job service":    "steps:\n  - type: compose-run-job\n    command: migrate",
+		"bad url":        "steps:\n  - type: http-check\n    url: localhost/health",
+		"denied command": "steps:\n  - type: shell\n    command: rm -rf /",
+	}
+	for name, content := range invalid {
+		if _, err := ParsePipelineDefinition(content); !errors.Is(err, ErrInvalidPipeline) {
+			t.Errorf("%s: expected ErrInvalidPipeline, got %v", name, err)
+		}
+	}
+}
+
+func TestPipelineRun_ExecutesStepsInOrder(t *testing.T) {
+	service, jobs, commands, project := setupPipelineTest(t)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次请求时服务尚未就绪
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	pipeline := createPipeline(t, service, project, `
+steps:
+  - name: migrate
+    type: compose-run-job
+    service: web
+    command: ["./migrate", "up"]
+  - name: deploy-web
+    type: deploy
+    services: [web]
+    health_check_delay: 0
+    health_check_retries: 1
+  - name: smoke
+    type: http-check
+    url: `+srv.URL+`
+    retries: 3
+    interval: 1ms
+  - name: notify
+    type: shell
+    command: echo done
+`)
+	run, err := service.Run(WithRequester(context.Background(), "alice"), pipeline.ID)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if run.Strategy != DeployStrategyPipeline || run.PipelineID == nil || *run.PipelineID != pipeline.ID {
+		t.Fatalf("Expected a pipeline run record, got %+v", run)
+	}
+	if _, err := service.Run(context.Background(), pipeline.ID); !errors.Is(err, ErrPipelineRunning) {
+		t.Errorf("Expected ErrPipelineRunning while the pipeline runs, got %v", err)
+	}
+
+	waitRun(t, service, run.ID, DeploymentStatusCompleted)
+	want := []string{"migrate:step_succeeded", "deploy-web:step_progress", "deploy-web:step_succeeded",
+		"smoke:step_succeeded", "notify:step_succeeded"}
+	if got := stepEvents(t, service, run.ID); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected step events %v, got %v", want, got)
+	}
+	if len(jobs.calls) != 1 || jobs.calls[0] != "web ./migrate up" {
+		t.Errorf("Expected the migration job to run in the web service, got %v", jobs.calls)
+	}
+	if len(*commands) != 1 || (*commands)[0] != "echo done" {
+		t.Errorf("Expected the shell step to run once, got %v", *commands)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected the HTTP check to retry once, got %d requests", hits.Load())
+	}
+	runs, _ := service.ListRuns(context.Background(), pipeline.ID)
+	if len(runs) != 1 {
+		t.Errorf("Expected one run, got %d", len(runs))
+	}
+}
+
+func TestPipelineRun_FailurePolicies(t *testing.T) {
+	service, _, commands, project := setupPipelineTest(t)
+	pipeline := createPipeline(t, service, project, `
+steps:
+  - name: optional
+    type: shell
+    command: ls /missing-optional
+    on_failure: continue
+  - name: required
+    type: shell
+    command: ls /missing-required
+  - name: never
+    type: shell
+    command: echo never
+`)
+	run, err := service.Run(context.Background(), pipeline.ID)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	final := waitRun(t, service, run.ID, DeploymentStatusFailed)
+	if !strings.Contains(final.Message, "required") {
+		t.Errorf("Expected the failing step in the message, got %q", final.Message)
+	}
+	want := []string{"optional:step_failed", "required:step_failed"}
+	if got := stepEvents(t, service, run.ID); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected step events %v, got %v", want, got)
+	}
+	if len(*commands) != 2 {
+		t.Errorf("Expected the step after an aborting failure not to run, got %v", *commands)
+	}
+}
+
+func TestPipelineRun_ApprovalGates(t *testing.T) {
+	service, _, commands, project := setupPipelineTest(t)
+	ctx := context.Background()
+	pipeline := createPipeline(t, service, project, `
+steps:
+  - name: go-live
+    type: manual-approval
+    message: release to production
+  - name: restart
+    type: shell
+    command: systemctl restart nginx
+`)
+	run, err := service.Run(WithRequester(ctx, "alice"), pipeline.ID)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var waiting *Deployment
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		waiting, _ = service.GetRun(ctx, run.ID)
+		if waiting.Status == DeploymentStatusPendingApproval || time.Now().After(deadline) {
+			break
+		}
+	}
+	if waiting.Message != "release to production" || waiting.ApprovalExpiresAt == nil {
+		t.Errorf("Expected the step message and an expiry, got %+v", waiting)
+	}
+	pending, _ := service.deployer.ListPendingApprovals(ctx)
+	if len(pending) != 1 || pending[0].ID != run.ID {
+		t.Fatalf("Expected the run to be listed as a pending approval, got %+v", pending)
+	}
+	if _, err := service.deployer.ApproveDeployment(ctx, run.ID, "alice"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("Expected ErrSelfApproval, got %v", err)
+	}
+	if _, err := service.deployer.ApproveDeployment(ctx, run.ID, "bob"); err != nil {
+		t.Fatalf("ApproveDeployment: %v", err)
+	}
+
+	// 策略要求确认的命令同样先等待审批，拒绝后不执行
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, _ := service.GetRun(ctx, run.ID)
+		if current.Status == DeploymentStatusPendingApproval && strings.Contains(current.Message, "systemctl restart nginx") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the shell step to wait for confirmation, got %s: %s", current.Status, current.Message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := service.deployer.RejectDeployment(ctx, run.ID, "bob", "not now"); err != nil {
+		t.Fatalf("RejectDeployment: %v", err)
+	}
+	final := waitRun(t, service, run.ID, DeploymentStatusRejected)
+	if !strings.Contains(final.Message, "not now") {
+		t.Errorf("Expected the reject reason in the run message, got %q", final.Message)
+	}
+	if len(*commands) != 0 {
+		t.Errorf("Rejected commands must not run, got %v", *commands)
+	}
+	want := []string{"go-live:step_awaiting_approval", "go-live:step_succeeded", "restart:step_awaiting_approval", "restart:step_failed"}
+	if got := stepEvents(t, service, run.ID); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected step events %v, got %v", want, got)
+	}
+}
+
+func TestPipelineService_StreamEndsWithRun(t *testing.T) {
+	service, _, _, project := setupPipelineTest(t)
+	pipeline := createPipeline(t, service, project, "steps:\n  - name: hello\n    type: shell\n    command: echo hello\n")
+	run, err := service.Run(context.Background(), pipeline.ID)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var frames []DeploymentStreamFrame
+	if err := service.Stream(ctx, run.ID, func(frame DeploymentStreamFrame) error {
+		frames = append(frames, frame)
+		return nil
+	}); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	last := frames[len(frames)-1]
+	if last.Type != "status" || last.Status != DeploymentStatusCompleted {
+		t.Errorf("Expected the stream to end with the completed status, got %+v", last)
+	}
+	var sawStep bool
+	for _, frame := range frames {
+		sawStep = sawStep || (frame.Event != nil && frame.Event.EventType == "step_succeeded" && frame.Event.ServiceName == "hello")
+	}
+	if !sawStep {
+		t.Errorf("Expected the step event to be streamed, got %+v", frames)
+	}
+}
+
+func TestPipelineAPI_RequiresPermission(t *testing.T) {
+	service, _, _, project := setupPipelineTest(t)
+	pipeline := createPipeline(t, service, project, "steps:\n  - type: shell\n    command: echo hello\n")
+	handler := &APIHandler{composeService: service.compose}
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pipelines", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without a pipeline service, got %d", rec.Code)
+	}
+
+	handler.SetPipelineService(service)
+	handler.SetPermissionChecker(func(r *http.Request, permission string) bool { return false })
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/pipelines/1/run", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when permission is denied, got %d", rec.Code)
+	}
+
+	handler.SetPermissionChecker(func(r *http.Request, permission string) bool { return permission == PermissionPipelinesManage })
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/pipelines/1",
+		strings.NewReader(`{"definition": "steps:\n  - type: shell\n    command: mkfs.ext4 /dev/sdb1\n"}`)))
+	var envelope apierror.Envelope
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	if rec.Code != http.StatusUnprocessableEntity || envelope.Code != "PIPELINE_INVALID" || envelope.RequestID == "" {
+		t.Errorf("Expected 422 PIPELINE_INVALID for a denied command, got %d: %+v", rec.Code, envelope)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pipelines/999", nil))
+	envelope = apierror.Envelope{}
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	if rec.Code != http.StatusNotFound || envelope.Code != "PIPELINE_NOT_FOUND" {
+		t.Errorf("Expected 404 PIPELINE_NOT_FOUND, got %d: %+v", rec.Code, envelope)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/pipelines/1/run", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	runs, _ := service.ListRuns(context.Background(), pipeline.ID)
+	if len(runs) != 1 || runs[0].RequestedBy != "unknown" {
+		t.Fatalf("Expected one run requested by the API user, got %+v", runs)
+	}
+	waitRun(t, service, runs[0].ID, DeploymentStatusCompleted)
+}
@@ -0,0 +1,103 @@
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"qwq/internal/logger"
+	"qwq/internal/portaudit"
+
+	"gorm.io/gorm"
+)
+
+// composeBindings 解析 Compose 配置中所有发布到主机的端口
+func composeBindings(config *ComposeConfig) ([]portaudit.Binding, []string) {
+	ports := make(map[string][]interface{}, len(config.Services))
+	for name, service := range config.Services {
+		if service == nil {
+			continue
+		}
+		for _, port := range service.Ports {
+			ports[name] = append(ports[name], port)
+		}
+	}
+	return portaudit.ParseServices(ports)
+}
+
+// auditPorts 在创建部署记录和任何容器之前检查主机端口，有冲突时返回 *portaudit.ConflictError
+// 项目自身正在运行的容器发布的端口会在重建时释放，不算冲突
+func (s *deploymentServiceImpl) auditPorts(ctx context.Context, project *ComposeProject, config *ComposeConfig) error {
+	if s.ports == nil {
+		return nil
+	}
+	bindings, errs := composeBindings(config)
+	report := s.ports.Audit(ctx, bindings, portaudit.Options{Project: project.Name})
+	report.Errors = append(errs, report.Errors...)
+	for _, msg := range report.Errors {
+		logger.Info("⚠️ 项目 %s 端口检查: %s", project.Name, msg)
+	}
+	return report.Err()
+}
+
+// ProjectPortSource 数据库中运行中和更新中的 Compose 项目发布的端口
+func ProjectPortSource(db *gorm.DB) portaudit.Source {
+	return func(ctx context.Context) ([]portaudit.Claim, error) {
+		var projects []*ComposeProject
+		err := db.WithContext(ctx).
+			Where("status IN ?", []ProjectStatus{ProjectStatusRunning, ProjectStatusUpdating}).
+			Find(&projects).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to list projects: %w", err)
+		}
+		parser := NewComposeParser()
+		var claims []portaudit.Claim
+		for _, project := range projects {
+			config, err := parser.Parse(project.Content)
+			if err != nil {
+				continue // 无法解析的项目不可能发布端口
+			}
+			bindings, _ := composeBindings(config)
+			for _, b := range bindings {
+				claims = append(claims, portaudit.Claim{
+					Kind:    portaudit.KindProject,
+					Owner:   fmt.Sprintf("%s/%s", project.Name, b.Service),
+					Project: project.Name,
+					HostIP:  b.HostIP,
+					Port:    b.Port,
+					Proto:   b.Proto,
+				})
+			}
+		}
+		return claims, nil
+	}
+}
+
+// ContainerPortSource 正在运行的容器实际发布的端口，包括不受 qwq 管理的容器
+func ContainerPortSource(lister ContainerLister) portaudit.Source {
+	return func(ctx context.Context) ([]portaudit.Claim, error) {
+		containers, err := lister.ListContainers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %w", err)
+		}
+		var claims []portaudit.Claim
+		for _, c := range containers {
+			if c.State != "running" {
+				continue
+			}
+			for _, p := range c.Ports {
+				if p.HostPort == 0 {
+					continue
+				}
+				claims = append(claims, portaudit.Claim{
+					Kind:    portaudit.KindContainer,
+					Owner:   c.Name,
+					Project: c.Labels[composeProjectLabel],
+					HostIP:  p.HostIP,
+					Port:    p.HostPort,
+					Proto:   p.Proto,
+				})
+			}
+		}
+		return claims, nil
+	}
+}
@@ -0,0 +1,83 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"qwq/internal/apierror"
+	"qwq/internal/portaudit"
+)
+
+// listingExecutor 返回预设的正在运行的容器
+type listingExecutor struct {
+	*countingExecutor
+	containers []ContainerSummary
+}
+
+func (e *listingExecutor) ListContainers(ctx context.Context) ([]ContainerSummary, error) {
+	return e.containers, nil
+}
+
+func TestDeploy_PortConflictFailsFast(t *testing.T) {
+	service, executor, db, project := setupApprovalTest(t)
+	ctx := context.Background()
+
+	// 正在部署的 shop 项目自己的容器监听 80，另一个运行中的项目 blog 也发布了 80
+	blog := &ComposeProject{Name: "blog", Content: revisionTestContent, TenantID: 1, Status: ProjectStatusRunning}
+	if err := db.Create(blog).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := &listingExecutor{countingExecutor: executor, containers: []ContainerSummary{
+		{Name: "shop-web-1", State: "running", Labels: map[string]string{composeProjectLabel: "shop"}, Ports: []PublishedPort{{HostIP: "0.0.0.0", HostPort: 80, ContainerPort: 80, Proto: "tcp"}}},
+		{Name: "stale", State: "exited", Ports: []PublishedPort{{HostIP: "0.0.0.0", HostPort: 81, ContainerPort: 80, Proto: "tcp"}}},
+	}}
+	checker := &portaudit.Checker{Sockets: func() ([]portaudit.Socket, error) {
+		return []portaudit.Socket{{Address: "0.0.0.0", Port: 80, Proto: "tcp"}}, nil
+	}}
+	checker.SetSource("projects", ProjectPortSource(db))
+	checker.SetSource("containers", ContainerPortSource(listing))
+	service.ports = checker
+
+	_, err := service.Deploy(ctx, project.ID, &DeploymentConfig{Strategy: DeployStrategyRecreate})
+	var conflictErr *portaudit.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("Expected a port conflict, got %v", err)
+	}
+	conflicts := conflictErr.Report.Conflicts
+	if len(conflicts) != 1 || conflicts[0].OwnerKind != portaudit.KindProject || conflicts[0].Owner != "blog/web" || conflicts[0].SuggestedPort != 81 {
+		t.Fatalf("Expected conflict with blog suggesting 81, got %+v", conflicts)
+	}
+	var count int64
+	db.Model(&Deployment{}).Count(&count)
+	if count != 0 || atomic.LoadInt32(&executor.starts) != 0 {
+		t.Errorf("Expected no deployment record and no container start, got %d records and %d starts", count, executor.starts)
+	}
+
+	rec := httptest.NewRecorder()
+	respondServiceError(rec, httptest.NewRequest("POST", "/api/compose/shop/deploy", nil), err)
+	var envelope struct {
+		Code    string            `json:"code"`
+		Details *portaudit.Report `json:"details"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != 409 || envelope.Code != "PORT_CONFLICT" || envelope.Details == nil || envelope.Details.Conflicts[0].Port != 80 {
+		t.Errorf("Expected 409 PORT_CONFLICT with the report, got %d %+v", rec.Code, envelope)
+	}
+	if mapped := apierror.Lookup(err, containerErrors...); mapped.Details == nil {
+		t.Error("Expected details to be attached to the mapped error")
+	}
+
+	// blog 停止后端口只被 shop 自己的容器占用，可以部署
+	if err := db.Model(blog).Update("status", ProjectStatusStopped).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Deploy(ctx, project.ID, &DeploymentConfig{Strategy: DeployStrategyRecreate}); err != nil {
+		t.Errorf("Expected deployment to proceed, got %v", err)
+	}
+}
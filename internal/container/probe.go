@@ -0,0 +1,373 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidProbe 部署后验证探针配置无效
+var ErrInvalidProbe = errors.New("invalid deployment probe")
+
+// ErrProbeFailed 部署后验证探针失败
+var ErrProbeFailed = errors.New("deployment probe failed")
+
+// ProbeType 部署后验证探针类型
+type ProbeType string
+
+const (
+	ProbeHTTP ProbeType = "http" // HTTP GET，检查状态码和响应内容
+	ProbeTCP  ProbeType = "tcp"  // TCP 连接
+	ProbeExec ProbeType = "exec" // 在服务容器内执行命令，检查退出码
+)
+
+// 探针默认值
+const (
+	defaultProbeInterval = 5 * time.Second
+	defaultProbeTimeout  = 10 * time.Second
+	// maxProbeOutput 记录到部署事件中的探针输出长度上限
+	maxProbeOutput = 4096
+)
+
+// DeployProbe 部署后验证探针，在健康检查通过后执行，任一探针失败时部署失败（并按 rollback_on_failure 回滚）
+// url 和 address 中的主机名为 compose 服务名时解析为该服务容器的地址，其他主机名原样使用
+type DeployProbe struct {
+	Name string    `yaml:"name,omitempty" json:"name,omitempty"` // 名称，默认为类型和目标
+	Type ProbeType `yaml:"type" json:"type"`
+
+	// http
+	URL          string `yaml:"url,omitempty" json:"url,omitempty"`                     // 如 http://web:8080/healthz
+	ExpectStatus int    `yaml:"expect_status,omitempty" json:"expect_status,omitempty"` // 默认 200
+	ExpectBody   string `yaml:"expect_body,omitempty" json:"expect_body,omitempty"`     // 响应体需包含的内容
+
+	// tcp
+	Address string `yaml:"address,omitempty" json:"address,omitempty"` // 如 db:5432
+
+	// exec
+	Service        string   `yaml:"service,omitempty" json:"service,omitempty"`                   // 执行命令的服务
+	Command        []string `yaml:"command,omitempty" json:"command,omitempty"`                   // 命令及参数
+	ExpectExitCode int      `yaml:"expect_exit_code,omitempty" json:"expect_exit_code,omitempty"` // 默认 0
+
+	Delay    int `yaml:"delay,omitempty" json:"delay,omitempty"`       // 第一次执行前等待的秒数，给应用预热的时间
+	Retries  int `yaml:"retries,omitempty" json:"retries,omitempty"`   // 总尝试次数，默认 1
+	Interval int `yaml:"interval,omitempty" json:"interval,omitempty"` // 重试间隔（秒），默认 5
+	Timeout  int `yaml:"timeout,omitempty" json:"timeout,omitempty"`   // 每次尝试的超时（秒），默认 10
+}
+
+// Label 探针在部署事件中显示的名称
+func (p *DeployProbe) Label() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	switch p.Type {
+	case ProbeHTTP:
+		return "http " + p.URL
+	case ProbeTCP:
+		return "tcp " + p.Address
+	}
+	return "exec " + p.Service
+}
+
+// ProbeResult 一个探针的执行结果
+type ProbeResult struct {
+	Probe    string `json:"probe"`
+	Passed   bool   `json:"passed"`
+	Attempts int    `json:"attempts"`
+	Output   string `json:"output,omitempty"` // 最后一次尝试的输出或错误
+}
+
+// ContainerExecer 在运行中的容器内执行命令，返回合并的 stdout/stderr 和退出码
+// 执行器未实现时探针通过 docker CLI 执行
+type ContainerExecer interface {
+	ExecInContainer(ctx context.Context, containerID string, command []string) (output string, exitCode int, err error)
+}
+
+// ValidateProbes 校验探针配置，exec 探针的服务必须存在于 compose 文件中
+func ValidateProbes(probes []DeployProbe, config *ComposeConfig) error {
+	for i := range probes {
+		probe := &probes[i]
+		if probe.Delay < 0 || probe.Retries < 0 || probe.Interval < 0 || probe.Timeout < 0 {
+			return fmt.Errorf("%w: %s: delay, retries, interval and timeout must not be negative", ErrInvalidProbe, probe.Label())
+		}
+		switch probe.Type {
+		case ProbeHTTP:
+			u, err := url.Parse(probe.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+				return fmt.Errorf("%w: %s: url must be an http(s) URL", ErrInvalidProbe, probe.Label())
+			}
+		case ProbeTCP:
+			if _, port, err := net.SplitHostPort(probe.Address); err != nil || port == "" {
+				return fmt.Errorf("%w: %s: address must be host:port", ErrInvalidProbe, probe.Label())
+			}
+		case ProbeExec:
+			if len(probe.Command) == 0 {
+				return fmt.Errorf("%w: %s: command is required", ErrInvalidProbe, probe.Label())
+			}
+			if config != nil {
+				if _, ok := config.Services[probe.Service]; !ok {
+					return fmt.Errorf("%w: %s: service %q not found in compose file", ErrInvalidProbe, probe.Label(), probe.Service)
+				}
+			}
+		default:
+			return fmt.Errorf("%w: unknown type %q, want http, tcp or exec", ErrInvalidProbe, probe.Type)
+		}
+	}
+	return nil
+}
+
+// ProbeRunner 执行部署后验证探针
+type ProbeRunner struct {
+	executor  DockerExecutor
+	inspector ContainerInspector
+	execer    ContainerExecer
+	client    *http.Client
+}
+
+// NewProbeRunner 创建探针执行器，执行器不支持读取容器配置或在容器内执行命令时回退到 docker CLI
+func NewProbeRunner(executor DockerExecutor) *ProbeRunner {
+	inspector, ok := executor.(ContainerInspector)
+	if !ok {
+		inspector = &cliDockerExecutor{}
+	}
+	execer, ok := executor.(ContainerExecer)
+	if !ok {
+		execer = &cliDockerExecutor{}
+	}
+	return &ProbeRunner{
+		executor:  executor,
+		inspector: inspector,
+		execer:    execer,
+		// 探针检查的是刚部署的版本本身，不跟随重定向
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+	}
+}
+
+// Run 依次执行探针，每个探针开始和结束时调用 report（可为 nil）；遇到第一个失败的探针即返回
+func (r *ProbeRunner) Run(ctx context.Context, projectName string, services map[string]*Service,
+	probes []DeployProbe, report func(probe *DeployProbe, result *ProbeResult)) error {
+
+	for i := range probes {
+		probe := &probes[i]
+		if report != nil {
+			report(probe, nil)
+		}
+		result := r.runProbe(ctx, projectName, services, probe)
+		if report != nil {
+			report(probe, result)
+		}
+		if !result.Passed {
+			return fmt.Errorf("%w: %s: %s", ErrProbeFailed, result.Probe, result.Output)
+		}
+	}
+	return nil
+}
+
+// runProbe 等待预热时间后按重试次数执行探针
+func (r *ProbeRunner) runProbe(ctx context.Context, projectName string, services map[string]*Service, probe *DeployProbe) *ProbeResult {
+	result := &ProbeResult{Probe: probe.Label()}
+	attempts := probe.Retries
+	if attempts <= 0 {
+		attempts = 1
+	}
+	interval := defaultProbeInterval
+	if probe.Interval > 0 {
+		interval = time.Duration(probe.Interval) * time.Second
+	}
+	timeout := defaultProbeTimeout
+	if probe.Timeout > 0 {
+		timeout = time.Duration(probe.Timeout) * time.Second
+	}
+
+	wait := time.Duration(probe.Delay) * time.Second
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				result.Output = ctx.Err().Error()
+				return result
+			case <-time.After(wait):
+			}
+		}
+		wait = interval
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		output, err := r.attempt(attemptCtx, projectName, services, probe)
+		cancel()
+		result.Attempts = attempt
+		result.Output = truncateProbeOutput(output)
+		if err == nil {
+			result.Passed = true
+			return result
+		}
+		result.Output = truncateProbeOutput(strings.TrimSpace(err.Error() + "\n" + output))
+	}
+	return result
+}
+
+// attempt 执行一次探针，返回输出；未满足期望时返回错误
+func (r *ProbeRunner) attempt(ctx context.Context, projectName string, services map[string]*Service, probe *DeployProbe) (string, error) {
+	switch probe.Type {
+	case ProbeHTTP:
+		return r.probeHTTP(ctx, projectName, services, probe)
+	case ProbeTCP:
+		address, err := r.resolve(ctx, projectName, services, probe.Address)
+		if err != nil {
+			return "", err
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return "connected to " + address, nil
+	case ProbeExec:
+		containerID, err := r.serviceContainer(ctx, projectName, probe.Service)
+		if err != nil {
+			return "", err
+		}
+		output, code, err := r.execer.ExecInContainer(ctx, containerID, probe.Command)
+		if err != nil {
+			return output, err
+		}
+		if code != probe.ExpectExitCode {
+			return output, fmt.Errorf("exit code %d (expected %d)", code, probe.ExpectExitCode)
+		}
+		return output, nil
+	}
+	return "", fmt.Errorf("%w: unknown type %q", ErrInvalidProbe, probe.Type)
+}
+
+func (r *ProbeRunner) probeHTTP(ctx context.Context, projectName string, services map[string]*Service, probe *DeployProbe) (string, error) {
+	u, err := url.Parse(probe.URL)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	address, err := r.resolve(ctx, projectName, services, net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return "", err
+	}
+	u.Host = address
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	expect := probe.ExpectStatus
+	if expect == 0 {
+		expect = http.StatusOK
+	}
+	output := fmt.Sprintf("%s 返回 %d\n%s", u.String(), resp.StatusCode, body)
+	if resp.StatusCode != expect {
+		return output, fmt.Errorf("unexpected status %d (expected %d)", resp.StatusCode, expect)
+	}
+	if probe.ExpectBody != "" && !strings.Contains(string(body), probe.ExpectBody) {
+		return output, fmt.Errorf("response body does not contain %q", probe.ExpectBody)
+	}
+	return output, nil
+}
+
+// resolve 将 host:port 中的 compose 服务名替换为该服务容器的 IP 地址
+func (r *ProbeRunner) resolve(ctx context.Context, projectName string, services map[string]*Service, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := services[host]; !ok {
+		return address, nil
+	}
+	containerID, err := r.serviceContainer(ctx, projectName, host)
+	if err != nil {
+		return "", err
+	}
+	info, err := r.inspector.InspectContainer(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container of service %s: %w", host, err)
+	}
+	if info.NetworkSettings == nil {
+		return "", fmt.Errorf("service %s has no network address", host)
+	}
+	// 多个网络时优先使用项目默认网络，其余按网络名排序取第一个有地址的
+	names := make([]string, 0, len(info.NetworkSettings.Networks))
+	for name := range info.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == projectName+"_default") != (names[j] == projectName+"_default") {
+			return names[i] == projectName+"_default"
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		if endpoint := info.NetworkSettings.Networks[name]; endpoint != nil && endpoint.IPAddress != "" {
+			return net.JoinHostPort(endpoint.IPAddress, port), nil
+		}
+	}
+	return "", fmt.Errorf("service %s has no network address", host)
+}
+
+// serviceContainer 服务的第一个容器
+func (r *ProbeRunner) serviceContainer(ctx context.Context, projectName, service string) (string, error) {
+	containers, err := r.executor.GetServiceContainers(ctx, projectName, service)
+	if err != nil {
+		return "", fmt.Errorf("failed to get containers for service %s: %w", service, err)
+	}
+	if len(containers) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNoServiceContainers, service)
+	}
+	return containers[0], nil
+}
+
+func truncateProbeOutput(output string) string {
+	if len(output) <= maxProbeOutput {
+		return output
+	}
+	return strings.ToValidUTF8(output[:maxProbeOutput], "") + "\n...(已截断)"
+}
+
+// runProbes 执行部署后验证探针，探针的开始和结果以部署事件记录，部署事件流中实时可见
+func (s *deploymentServiceImpl) runProbes(ctx context.Context, deployment *Deployment, projectName string,
+	config *ComposeConfig, probes []DeployProbe) error {
+
+	if s.probes == nil {
+		return fmt.Errorf("%w: probes are not configured", ErrProbeFailed)
+	}
+	s.updateDeploymentStatus(ctx, deployment.ID, DeploymentStatusInProgress, 95,
+		fmt.Sprintf("执行部署后验证 (%d 个探针)...", len(probes)))
+	return s.probes.Run(ctx, projectName, config.Services, probes, func(probe *DeployProbe, result *ProbeResult) {
+		if result == nil {
+			s.recordEvent(ctx, deployment.ID, "probe_started", probe.Service, "开始验证: "+probe.Label(), "")
+			return
+		}
+		details, _ := json.Marshal(result)
+		if result.Passed {
+			s.recordEvent(ctx, deployment.ID, "probe_passed", probe.Service,
+				fmt.Sprintf("验证通过: %s（第 %d 次尝试）", result.Probe, result.Attempts), string(details))
+			return
+		}
+		s.recordEvent(ctx, deployment.ID, "probe_failed", probe.Service,
+			fmt.Sprintf("验证失败: %s（%d 次尝试）", result.Probe, result.Attempts), string(details))
+	})
+}
@@ -0,0 +1,249 @@
+package container
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// probeExecutor 每个服务一个容器，容器位于项目默认网络的 127.0.0.1，exec 返回预设的退出码
+type probeExecutor struct {
+	*mockDockerExecutor
+	mu       sync.Mutex
+	exitCode int
+	commands [][]string
+}
+
+func (e *probeExecutor) GetServiceContainers(ctx context.Context, projectName, serviceName string) ([]string, error) {
+	return []string{"c-" + serviceName}, nil
+}
+
+func (e *probeExecutor) InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+		"bridge":       {IPAddress: "10.0.0.2"},
+		"shop_default": {IPAddress: "127.0.0.1"},
+	}}}, nil
+}
+
+func (e *probeExecutor) InspectImageConfig(ctx context.Context, image string) (*container.Config, error) {
+	return nil, errors.New("not supported")
+}
+
+func (e *probeExecutor) ExecInContainer(ctx context.Context, containerID string, command []string) (string, int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands = append(e.commands, append([]string{containerID}, command...))
+	return "PONG", e.exitCode, nil
+}
+
+func setupProbeTest(t *testing.T) (*deploymentServiceImpl, *probeExecutor, *ComposeProject) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}, &Deployment{}, &DeploymentEvent{}, &ServiceInstance{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	composeService := NewComposeService(db)
+	project := &ComposeProject{Name: "shop", Content: revisionTestContent, TenantID: 1}
+	if err := composeService.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	executor := &probeExecutor{mockDockerExecutor: newMockDockerExecutor()}
+	executor.containerStatus["c-web"] = "running"
+	service := NewDeploymentService(db, composeService, executor).(*deploymentServiceImpl)
+	service.composeFiles = nil
+	service.ports = nil
+	return service, executor, project
+}
+
+// probeServer 返回 status 和 body 的 HTTP 服务，返回其端口
+func probeServer(t *testing.T, status int, body string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	return port
+}
+
+func TestValidateProbes(t *testing.T) {
+	config := &ComposeConfig{Services: map[string]*Service{"web": {Image: "nginx"}}}
+	valid := []DeployProbe{
+		{Type: ProbeHTTP, URL: "http://web:8080/healthz"},
+		{Type: ProbeTCP, Address: "db:5432"},
+		{Type: ProbeExec, Service: "web", Command: []string{"nginx", "-t"}},
+	}
+	if err := ValidateProbes(valid, config); err != nil {
+		t.Errorf("Expected valid probes, got %v", err)
+	}
+
+	for name, probe := range map[string]DeployProbe{
+		"unknown type":    {Type: "grpc"},
+		"url scheme":      {Type: ProbeHTTP, URL: "web:8080/healthz"},
+		"missing port":    {Type: ProbeTCP, Address: "db"},
+		"missing command": {Type: ProbeExec, Service: "web"},
+		"unknown service": {Type: ProbeExec, Service: "worker", Command: []string{"true"}},
+		"negative retry":  {Type: ProbeTCP, Address: "db:5432", Retries: -1},
+	} {
+		if err := ValidateProbes([]DeployProbe{probe}, config); !errors.Is(err, ErrInvalidProbe) {
+			t.Errorf("%s: expected ErrInvalidProbe, got %v", name, err)
+		}
+	}
+
+	// 流水线中尚无 compose 文件时不检查服务
+	if err := ValidateProbes([]DeployProbe{{Type: ProbeExec, Service: "worker", Command: []string{"true"}}}, nil); err != nil {
+		t.Errorf("Expected the service check to be skipped without a compose file, got %v", err)
+	}
+}
+
+func TestProbeRunner_Run(t *testing.T) {
+	executor := &probeExecutor{mockDockerExecutor: newMockDockerExecutor()}
+	runner := NewProbeRunner(executor)
+	services := map[string]*Service{"web": {Image: "nginx"}}
+	port := probeServer(t, http.StatusOK, `{"status":"ok"}`)
+
+	var reports []string
+	report := func(probe *DeployProbe, result *ProbeResult) {
+		if result == nil {
+			reports = append(reports, "start "+probe.Label())
+		} else {
+			reports = append(reports, fmt.Sprintf("%s %v", result.Probe, result.Passed))
+		}
+	}
+	probes := []DeployProbe{
+		{Name: "health", Type: ProbeHTTP, URL: "http://web:" + port + "/healthz", ExpectBody: `"ok"`},
+		{Name: "port", Type: ProbeTCP, Address: "web:" + port},
+		{Name: "ping", Type: ProbeExec, Service: "web", Command: []string{"redis-cli", "ping"}},
+	}
+	if err := runner.Run(context.Background(), "shop", services, probes, report); err != nil {
+		t.Fatalf("Expected all probes to pass, got %v", err)
+	}
+	want := "start health,health true,start port,port true,start ping,ping true"
+	if got := strings.Join(reports, ","); got != want {
+		t.Errorf("reports = %s, want %s", got, want)
+	}
+	if len(executor.commands) != 1 || strings.Join(executor.commands[0], " ") != "c-web redis-cli ping" {
+		t.Errorf("Expected the command to run in the web container, got %v", executor.commands)
+	}
+
+	// 退出码不符时失败，后续探针不再执行
+	executor.exitCode = 1
+	reports = nil
+	err := runner.Run(context.Background(), "shop", services, probes[2:], report)
+	if !errors.Is(err, ErrProbeFailed) || !strings.Contains(err.Error(), "exit code 1") {
+		t.Errorf("Expected the exec probe to fail, got %v", err)
+	}
+
+	// 响应体不包含期望内容
+	probes[0].ExpectBody = "ready"
+	if err := runner.Run(context.Background(), "shop", services, probes[:1], nil); !errors.Is(err, ErrProbeFailed) {
+		t.Errorf("Expected the body check to fail, got %v", err)
+	}
+}
+
+func TestDeploy_FailingProbeRollsBack(t *testing.T) {
+	service, _, project := setupProbeTest(t)
+	ctx := context.Background()
+	port := probeServer(t, http.StatusBadGateway, "upstream not ready")
+
+	first, err := service.Deploy(ctx, project.ID, &DeploymentConfig{Strategy: DeployStrategyRecreate, HealthCheckRetries: 1})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if deployment := waitDeployment(t, service, first.ID); deployment.Status != DeploymentStatusCompleted {
+		t.Fatalf("Expected the first deployment to complete, got %s: %s", deployment.Status, deployment.Message)
+	}
+
+	second, err := service.Deploy(ctx, project.ID, &DeploymentConfig{
+		Strategy:           DeployStrategyRecreate,
+		HealthCheckRetries: 1,
+		RollbackOnFailure:  true,
+		Probes:             []DeployProbe{{Type: ProbeHTTP, URL: "http://web:" + port + "/healthz", Retries: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	deployment := waitDeployment(t, service, second.ID)
+	if deployment.Status != DeploymentStatusRolledBack {
+		t.Fatalf("Expected the failing probe to roll the deployment back, got %s: %s", deployment.Status, deployment.Message)
+	}
+
+	seen := eventTypes(t, service, second.ID)
+	if !seen["probe_started"] || !seen["probe_failed"] || seen["probe_passed"] {
+		t.Errorf("Expected probe start and failure events, got %v", seen)
+	}
+	events, _ := service.GetDeploymentEvents(ctx, second.ID)
+	for _, event := range events {
+		if event.EventType != "probe_failed" {
+			continue
+		}
+		var result ProbeResult
+		if err := json.Unmarshal([]byte(event.Details), &result); err != nil {
+			t.Fatalf("Expected the probe result in the event details: %v", err)
+		}
+		if result.Attempts != 1 || !strings.Contains(result.Output, "502") || !strings.Contains(result.Output, "upstream not ready") {
+			t.Errorf("Expected the status and response in the probe output, got %+v", result)
+		}
+	}
+}
+
+func TestDeploy_PassingProbes(t *testing.T) {
+	service, executor, project := setupProbeTest(t)
+	port := probeServer(t, http.StatusOK, "ok")
+
+	deployment, err := service.Deploy(context.Background(), project.ID, &DeploymentConfig{
+		Strategy:           DeployStrategyRecreate,
+		HealthCheckRetries: 1,
+		Probes: []DeployProbe{
+			{Type: ProbeHTTP, URL: "http://web:" + port + "/", ExpectBody: "ok"},
+			{Type: ProbeExec, Service: "web", Command: []string{"nginx", "-t"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if deployment = waitDeployment(t, service, deployment.ID); deployment.Status != DeploymentStatusCompleted {
+		t.Fatalf("Expected the deployment to complete, got %s: %s", deployment.Status, deployment.Message)
+	}
+	if seen := eventTypes(t, service, deployment.ID); !seen["probe_passed"] || seen["probe_failed"] {
+		t.Errorf("Expected probe_passed events, got %v", seen)
+	}
+	if len(executor.commands) != 1 {
+		t.Errorf("Expected the exec probe to run once, got %v", executor.commands)
+	}
+}
+
+func TestDeploy_InvalidProbe(t *testing.T) {
+	service, _, project := setupProbeTest(t)
+	_, err := service.Deploy(context.Background(), project.ID, &DeploymentConfig{
+		Probes: []DeployProbe{{Type: ProbeExec, Service: "worker", Command: []string{"true"}}},
+	})
+	if !errors.Is(err, ErrInvalidProbe) {
+		t.Errorf("Expected ErrInvalidProbe, got %v", err)
+	}
+}
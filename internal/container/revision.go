@@ -0,0 +1,270 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"qwq/internal/utils"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// DefaultMaxRevisions 每个项目默认保留的修订数量
+const DefaultMaxRevisions = 20
+
+var (
+	// ErrRevisionNotFound 修订记录未找到
+	ErrRevisionNotFound = errors.New("compose revision not found")
+
+	// yamlLineRegex 从 yaml 解析错误中提取行号
+	yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+)
+
+// ContentUpdateResult 保存 Compose 内容的结果
+type ContentUpdateResult struct {
+	Valid    bool               `json:"valid"`              // 内容是否通过校验
+	Errors   []*ValidationError `json:"errors,omitempty"`   // 校验错误（带行号）
+	Revision *ComposeRevision   `json:"revision,omitempty"` // 新生成的修订
+	Diff     string             `json:"diff"`               // 相对上一版本的 unified diff
+}
+
+// CheckComposeContent 校验 Compose 内容并返回带行号的结构化错误
+// 先经过 ParseComposeFile 的语法解析，再执行语义校验
+func CheckComposeContent(content string) []*ValidationError {
+	parser := NewComposeParser()
+
+	config, err := parser.Parse(content)
+	if err != nil {
+		return yamlErrorsToValidationErrors(err)
+	}
+
+	result := parser.Validate(config)
+	if result.Valid {
+		return nil
+	}
+
+	// 通过 YAML 节点树为语义错误补充行号
+	var root yaml.Node
+	if yaml.Unmarshal([]byte(content), &root) == nil {
+		for _, e := range result.Errors {
+			if e.Line == 0 {
+				e.Line = locateFieldLine(&root, e.Field)
+			}
+		}
+	}
+	return result.Errors
+}
+
+// yamlErrorsToValidationErrors 将 yaml 解析错误拆分为逐行的校验错误
+func yamlErrorsToValidationErrors(err error) []*ValidationError {
+	var typeErr *yaml.TypeError
+	var messages []string
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	result := make([]*ValidationError, 0, len(messages))
+	for _, msg := range messages {
+		line := 0
+		if m := yamlLineRegex.FindStringSubmatch(msg); len(m) > 1 {
+			line, _ = strconv.Atoi(m[1])
+		}
+		result = append(result, &ValidationError{
+			Field:   "content",
+			Message: strings.TrimPrefix(msg, "failed to parse compose file: "),
+			Line:    line,
+		})
+	}
+	return result
+}
+
+// locateFieldLine 根据 "services.web.ports" 形式的字段路径定位所在行
+// 找不到完整路径时返回最深一级已匹配键的行号
+func locateFieldLine(root *yaml.Node, field string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := 0
+	for _, key := range strings.Split(field, ".") {
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return line
+}
+
+// SaveProjectContent 校验并保存项目的 Compose 内容
+// 校验失败时不落库，返回带行号的错误；成功时生成新修订并返回与上一版本的差异
+func (s *composeServiceImpl) SaveProjectContent(ctx context.Context, projectID uint, content, author, message string) (*ContentUpdateResult, error) {
+	project, err := s.GetProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if validationErrors := CheckComposeContent(content); len(validationErrors) > 0 {
+		return &ContentUpdateResult{Valid: false, Errors: validationErrors}, nil
+	}
+
+	previous := project.Content
+	result := &ContentUpdateResult{Valid: true}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 首次编辑时把原始内容保存为基线修订，保证可以回滚到编辑前
+		var count int64
+		if err := tx.Model(&ComposeRevision{}).Where("project_id = ?", projectID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count revisions: %w", err)
+		}
+		if count == 0 && previous != "" {
+			baseline := &ComposeRevision{ProjectID: projectID, Revision: 1, Content: previous, Author: "system", Message: "initial content"}
+			if err := tx.Create(baseline).Error; err != nil {
+				return fmt.Errorf("failed to create baseline revision: %w", err)
+			}
+		}
+
+		revision, err := s.appendRevision(tx, projectID, content, author, message)
+		if err != nil {
+			return err
+		}
+		result.Revision = revision
+
+		project.Content = content
+		if config, err := s.parser.Parse(content); err == nil {
+			project.Version = config.Version
+		}
+		if err := tx.Save(project).Error; err != nil {
+			return fmt.Errorf("failed to update project: %w", err)
+		}
+
+		return s.pruneRevisions(tx, projectID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Diff = utils.UnifiedDiff(previous, content,
+		fmt.Sprintf("%s (previous)", project.Name),
+		fmt.Sprintf("%s (revision %d)", project.Name, result.Revision.Revision))
+	return result, nil
+}
+
+// ListRevisions 列出项目的修订记录（最新的在前）
+func (s *composeServiceImpl) ListRevisions(ctx context.Context, projectID uint) ([]*ComposeRevision, error) {
+	if _, err := s.GetProject(ctx, projectID); err != nil {
+		return nil, err
+	}
+
+	var revisions []*ComposeRevision
+	if err := s.db.WithContext(ctx).
+		Where("project_id = ?", projectID).
+		Order("revision DESC").
+		Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// RevertToRevision 将项目内容恢复到指定修订
+// 回滚本身会生成一条新修订，因此历史不会被改写
+func (s *composeServiceImpl) RevertToRevision(ctx context.Context, projectID uint, revision int, author string) (*ContentUpdateResult, error) {
+	var target ComposeRevision
+	if err := s.db.WithContext(ctx).
+		Where("project_id = ? AND revision = ?", projectID, revision).
+		First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+
+	return s.SaveProjectContent(ctx, projectID, target.Content, author, fmt.Sprintf("revert to revision %d", revision))
+}
+
+// GetLatestRevision 获取项目的最新修订，没有修订时返回 nil
+func (s *composeServiceImpl) GetLatestRevision(ctx context.Context, projectID uint) (*ComposeRevision, error) {
+	return latestRevision(s.db.WithContext(ctx), projectID)
+}
+
+// appendRevision 在事务中追加一条修订
+func (s *composeServiceImpl) appendRevision(tx *gorm.DB, projectID uint, content, author, message string) (*ComposeRevision, error) {
+	latest, err := latestRevision(tx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	next := 1
+	if latest != nil {
+		next = latest.Revision + 1
+	}
+
+	revision := &ComposeRevision{
+		ProjectID: projectID,
+		Revision:  next,
+		Content:   content,
+		Author:    author,
+		Message:   message,
+	}
+	if err := tx.Create(revision).Error; err != nil {
+		return nil, fmt.Errorf("failed to create revision: %w", err)
+	}
+	return revision, nil
+}
+
+// pruneRevisions 只保留最近 maxRevisions 条修订
+func (s *composeServiceImpl) pruneRevisions(tx *gorm.DB, projectID uint) error {
+	limit := s.maxRevisions
+	if limit <= 0 {
+		limit = DefaultMaxRevisions
+	}
+
+	var keep []uint
+	if err := tx.Model(&ComposeRevision{}).
+		Where("project_id = ?", projectID).
+		Order("revision DESC").
+		Limit(limit).
+		Pluck("id", &keep).Error; err != nil {
+		return fmt.Errorf("failed to select revisions: %w", err)
+	}
+	if len(keep) < limit {
+		return nil
+	}
+
+	if err := tx.Where("project_id = ? AND id NOT IN ?", projectID, keep).
+		Delete(&ComposeRevision{}).Error; err != nil {
+		return fmt.Errorf("failed to prune revisions: %w", err)
+	}
+	return nil
+}
+
+// latestRevision 查询项目的最新修订
+func latestRevision(db *gorm.DB, projectID uint) (*ComposeRevision, error) {
+	var revision ComposeRevision
+	err := db.Where("project_id = ?", projectID).Order("revision DESC").First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest revision: %w", err)
+	}
+	return &revision, nil
+}
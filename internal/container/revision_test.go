@@ -0,0 +1,166 @@
+package container
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	// 使用纯 Go 实现的 SQLite 驱动
+	_ "modernc.org/sqlite"
+)
+
+const revisionTestContent = `version: "3.8"
+services:
+  web:
+    image: nginx:latest
+    ports:
+      - "80:80"
+`
+
+func setupRevisionTestService(t *testing.T) (*composeServiceImpl, *ComposeProject) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&ComposeProject{}, &ComposeRevision{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	service := NewComposeService(db).(*composeServiceImpl)
+	project := &ComposeProject{Name: "demo", Content: revisionTestContent, TenantID: 1}
+	if err := service.CreateProject(context.Background(), project); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	return service, project
+}
+
+func TestCheckComposeContent_SyntaxErrorLine(t *testing.T) {
+	content := "version: \"3.8\"\nservices:\n  web:\n\timage: nginx\n"
+
+	errs := CheckComposeContent(content)
+	if len(errs) == 0 {
+		t.Fatal("Expected syntax error for tab indentation")
+	}
+	if errs[0].Line != 4 {
+		t.Errorf("Expected error on line 4, got %d (%s)", errs[0].Line, errs[0].Message)
+	}
+}
+
+func TestCheckComposeContent_ValidationErrorLine(t *testing.T) {
+	content := "version: \"3.8\"\nservices:\n  web:\n    image: nginx\n    restart: sometimes\n"
+
+	errs := CheckComposeContent(content)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 validation error, got %d", len(errs))
+	}
+	if errs[0].Field != "services.web.restart" || errs[0].Line != 5 {
+		t.Errorf("Unexpected error: field=%s line=%d", errs[0].Field, errs[0].Line)
+	}
+}
+
+func TestSaveProjectContent_InvalidNotSaved(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	ctx := context.Background()
+
+	result, err := service.SaveProjectContent(ctx, project.ID, "services:\n\tweb: {}\n", "alice", "")
+	if err != nil {
+		t.Fatalf("SaveProjectContent failed: %v", err)
+	}
+	if result.Valid || len(result.Errors) == 0 {
+		t.Fatal("Expected invalid result with errors")
+	}
+
+	saved, _ := service.GetProject(ctx, project.ID)
+	if saved.Content != revisionTestContent {
+		t.Error("Invalid content should not be saved")
+	}
+	revisions, _ := service.ListRevisions(ctx, project.ID)
+	if len(revisions) != 0 {
+		t.Errorf("Expected no revisions, got %d", len(revisions))
+	}
+}
+
+func TestSaveProjectContent_CreatesRevisionWithDiff(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	ctx := context.Background()
+
+	updated := strings.Replace(revisionTestContent, "nginx:latest", "nginx:1.25", 1)
+	result, err := service.SaveProjectContent(ctx, project.ID, updated, "alice", "pin nginx")
+	if err != nil {
+		t.Fatalf("SaveProjectContent failed: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("Expected valid result, got errors: %v", result.Errors)
+	}
+	if result.Revision.Revision != 2 || result.Revision.Author != "alice" {
+		t.Errorf("Unexpected revision: %+v", result.Revision)
+	}
+	if !strings.Contains(result.Diff, "-    image: nginx:latest") || !strings.Contains(result.Diff, "+    image: nginx:1.25") {
+		t.Errorf("Unexpected diff:\n%s", result.Diff)
+	}
+
+	// 首次编辑会保留原始内容作为基线修订
+	revisions, _ := service.ListRevisions(ctx, project.ID)
+	if len(revisions) != 2 || revisions[1].Content != revisionTestContent {
+		t.Errorf("Expected baseline and new revision, got %d", len(revisions))
+	}
+}
+
+func TestSaveProjectContent_PrunesOldRevisions(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	service.maxRevisions = 3
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		content := strings.Replace(revisionTestContent, "nginx:latest", fmt.Sprintf("nginx:1.%d", i), 1)
+		if _, err := service.SaveProjectContent(ctx, project.ID, content, "bob", ""); err != nil {
+			t.Fatalf("SaveProjectContent failed: %v", err)
+		}
+	}
+
+	revisions, _ := service.ListRevisions(ctx, project.ID)
+	if len(revisions) != 3 {
+		t.Fatalf("Expected 3 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Revision != 6 || revisions[2].Revision != 4 {
+		t.Errorf("Expected revisions 6..4, got %d..%d", revisions[0].Revision, revisions[2].Revision)
+	}
+}
+
+func TestRevertToRevision(t *testing.T) {
+	service, project := setupRevisionTestService(t)
+	ctx := context.Background()
+
+	updated := strings.Replace(revisionTestContent, "nginx:latest", "nginx:1.25", 1)
+	if _, err := service.SaveProjectContent(ctx, project.ID, updated, "alice", ""); err != nil {
+		t.Fatalf("SaveProjectContent failed: %v", err)
+	}
+
+	result, err := service.RevertToRevision(ctx, project.ID, 1, "alice")
+	if err != nil {
+		t.Fatalf("RevertToRevision failed: %v", err)
+	}
+	if result.Revision.Revision != 3 {
+		t.Errorf("Expected revert to create revision 3, got %d", result.Revision.Revision)
+	}
+
+	saved, _ := service.GetProject(ctx, project.ID)
+	if saved.Content != revisionTestContent {
+		t.Error("Project content should be restored")
+	}
+
+	if _, err := service.RevertToRevision(ctx, project.ID, 99, "alice"); err != ErrRevisionNotFound {
+		t.Errorf("Expected ErrRevisionNotFound, got %v", err)
+	}
+}
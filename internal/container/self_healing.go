@@ -6,6 +6,9 @@ import (
 	"sync"
 	"time"
 
+	"qwq/internal/events"
+	"qwq/internal/utils"
+
 	"gorm.io/gorm"
 )
 
@@ -89,6 +92,9 @@ func (FailureRecord) TableName() string {
 	return "container_failure_records"
 }
 
+// healingActor 事件时间线上自愈操作的操作者
+const healingActor = "self-healing"
+
 // monitoredContainer 被监控的容器
 type monitoredContainer struct {
 	containerID string
@@ -140,7 +146,10 @@ func NewSelfHealingService(db *gorm.DB, executor DockerExecutor, notifyService N
 // Start 启动自愈监控
 func (s *selfHealingServiceImpl) Start(ctx context.Context) error {
 	s.wg.Add(1)
-	go s.monitorLoop(ctx)
+	go func() {
+		defer s.wg.Done()
+		utils.Supervise(ctx, "self-healing", s.monitorLoop)
+	}()
 	return nil
 }
 
@@ -223,8 +232,6 @@ func (s *selfHealingServiceImpl) GetFailureHistory(ctx context.Context, containe
 
 // monitorLoop 监控循环
 func (s *selfHealingServiceImpl) monitorLoop(ctx context.Context) {
-	defer s.wg.Done()
-
 	ticker := time.NewTicker(10 * time.Second) // 每10秒检查一次
 	defer ticker.Stop()
 
@@ -360,6 +367,8 @@ func (s *selfHealingServiceImpl) healContainer(ctx context.Context, container *m
 				"action": "none",
 				"reason": "restart_limit_exceeded",
 			})
+		events.Emit(events.TypeHealing, "restart_limit_exceeded", healingActor, container.containerID,
+			fmt.Sprintf("超过重启次数限制（%d 秒内 %d 次），不再自动重启", container.config.RestartWindow, container.config.MaxRestarts))
 		
 		return
 	}
@@ -382,6 +391,7 @@ func (s *selfHealingServiceImpl) healContainer(ctx context.Context, container *m
 			"action": "restart",
 			"result": "failed",
 		})
+		events.Emit(events.TypeHealing, "restart_failed", healingActor, container.containerID, fmt.Sprintf("自动重启失败: %v", err))
 	} else {
 		// 重启成功
 		container.restartTimes = append(container.restartTimes, now)
@@ -401,6 +411,8 @@ func (s *selfHealingServiceImpl) healContainer(ctx context.Context, container *m
 			"result": "success",
 			"restart_count": len(container.restartTimes),
 		})
+		events.Emit(events.TypeHealing, "restart", healingActor, container.containerID,
+			fmt.Sprintf("容器不健康，已自动重启（窗口内第 %d 次）", len(container.restartTimes)))
 	}
 
 	// 更新故障记录的操作结果
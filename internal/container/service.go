@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 
+	"qwq/internal/pagination"
+
 	"gorm.io/gorm"
 )
 
@@ -38,13 +40,23 @@ type ComposeService interface {
 	// 可视化编辑
 	GetProjectStructure(ctx context.Context, projectID uint) (*ComposeConfig, error)
 	UpdateProjectStructure(ctx context.Context, projectID uint, config *ComposeConfig) error
+
+	// 编辑器内容与修订历史
+	SaveProjectContent(ctx context.Context, projectID uint, content, author, message string) (*ContentUpdateResult, error)
+	ListRevisions(ctx context.Context, projectID uint) ([]*ComposeRevision, error)
+	RevertToRevision(ctx context.Context, projectID uint, revision int, author string) (*ContentUpdateResult, error)
+	GetLatestRevision(ctx context.Context, projectID uint) (*ComposeRevision, error)
 	
 	// 部署管理（集成部署服务）
 	Deploy(ctx context.Context, projectID uint, config *DeploymentConfig) (*Deployment, error)
 	GetDeployment(ctx context.Context, id uint) (*Deployment, error)
 	ListDeployments(ctx context.Context, projectID uint) ([]*Deployment, error)
+	QueryDeployments(ctx context.Context, projectID uint, q pagination.Query) (*pagination.Page[*Deployment], error)
 	RollbackDeployment(ctx context.Context, deploymentID uint) error
 	GetDeploymentStatus(ctx context.Context, deploymentID uint) (*DeploymentStatus, error)
+	ApproveDeployment(ctx context.Context, deploymentID uint, approver string) (*Deployment, error)
+	RejectDeployment(ctx context.Context, deploymentID uint, approver, reason string) (*Deployment, error)
+	ListPendingApprovals(ctx context.Context) ([]*Deployment, error)
 	
 	// AI 架构优化分析
 	AnalyzeProjectArchitecture(ctx context.Context, projectID uint) (*ArchitectureAnalysis, error)
@@ -61,6 +73,7 @@ type composeServiceImpl struct {
 	parser            *ComposeParser
 	deploymentService DeploymentService
 	optimizer         ArchitectureOptimizer
+	maxRevisions      int // 每个项目保留的修订数量，0 表示使用默认值
 }
 
 // NewComposeService 创建 Compose 服务实例
@@ -337,6 +350,11 @@ func (s *composeServiceImpl) ListDeployments(ctx context.Context, projectID uint
 	return s.deploymentService.ListDeployments(ctx, projectID)
 }
 
+// QueryDeployments 分页列出部署
+func (s *composeServiceImpl) QueryDeployments(ctx context.Context, projectID uint, q pagination.Query) (*pagination.Page[*Deployment], error) {
+	return s.deploymentService.QueryDeployments(ctx, projectID, q)
+}
+
 // RollbackDeployment 回滚部署
 func (s *composeServiceImpl) RollbackDeployment(ctx context.Context, deploymentID uint) error {
 	return s.deploymentService.RollbackDeployment(ctx, deploymentID)
@@ -347,6 +365,21 @@ func (s *composeServiceImpl) GetDeploymentStatus(ctx context.Context, deployment
 	return s.deploymentService.GetDeploymentStatus(ctx, deploymentID)
 }
 
+// ApproveDeployment 审批通过部署
+func (s *composeServiceImpl) ApproveDeployment(ctx context.Context, deploymentID uint, approver string) (*Deployment, error) {
+	return s.deploymentService.ApproveDeployment(ctx, deploymentID, approver)
+}
+
+// RejectDeployment 拒绝部署
+func (s *composeServiceImpl) RejectDeployment(ctx context.Context, deploymentID uint, approver, reason string) (*Deployment, error) {
+	return s.deploymentService.RejectDeployment(ctx, deploymentID, approver, reason)
+}
+
+// ListPendingApprovals 列出等待审批的部署
+func (s *composeServiceImpl) ListPendingApprovals(ctx context.Context) ([]*Deployment, error) {
+	return s.deploymentService.ListPendingApprovals(ctx)
+}
+
 // AnalyzeProjectArchitecture 分析项目架构
 func (s *composeServiceImpl) AnalyzeProjectArchitecture(ctx context.Context, projectID uint) (*ArchitectureAnalysis, error) {
 	// 获取项目
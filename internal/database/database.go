@@ -3,11 +3,16 @@ package database
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	_ "modernc.org/sqlite"
 )
 
 var (
@@ -24,14 +29,41 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	DSN      string // PostgreSQL 连接串，非空时优先于 Host 等字段
 	FilePath string // SQLite 文件路径
 	Debug    bool   // 是否开启调试模式
+
+	BusyTimeout  time.Duration // SQLite 等待写锁的时间，0 表示使用 DefaultBusyTimeout
+	MaxOpenConns int           // 连接池最大连接数，0 表示使用默认值
 }
 
-// Init 初始化数据库连接
-func Init(cfg Config) error {
+// DefaultBusyTimeout SQLite 默认的写锁等待时间
+const DefaultBusyTimeout = 5 * time.Second
+
+// 默认连接池大小：SQLite 同一时刻只有一个写入者，连接过多只会加剧锁竞争
+const (
+	defaultSQLiteMaxOpenConns   = 4
+	defaultPostgresMaxOpenConns = 100
+)
+
+// sqliteDSN 生成 SQLite 连接串，每个新连接都会执行这些 PRAGMA
+// WAL 允许读写并发；busy_timeout 让写入者排队等待而不是立即返回 "database is locked"；
+// _txlock=immediate 使事务一开始就获取写锁，避免读事务升级为写事务时无法等待锁而直接失败
+func sqliteDSN(path string, busyTimeout time.Duration) string {
+	pragmas := []string{
+		fmt.Sprintf("_pragma=busy_timeout(%d)", busyTimeout.Milliseconds()),
+		"_pragma=foreign_keys(1)",
+		"_txlock=immediate",
+	}
+	if path != ":memory:" {
+		pragmas = append(pragmas, "_pragma=journal_mode(WAL)", "_pragma=synchronous(NORMAL)")
+	}
+	return "file:" + path + "?" + strings.Join(pragmas, "&")
+}
+
+// Open 打开数据库连接并配置连接池
+func Open(cfg Config) (*gorm.DB, error) {
 	var dialector gorm.Dialector
-	var err error
 
 	// 配置日志级别
 	logLevel := logger.Silent
@@ -47,41 +79,87 @@ func Init(cfg Config) error {
 	}
 
 	// 根据数据库类型选择驱动
+	maxOpen := defaultPostgresMaxOpenConns
 	switch cfg.Type {
 	case "postgres":
-		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-			cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+		dsn := cfg.DSN
+		if dsn == "" {
+			dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+				cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+		}
 		dialector = postgres.Open(dsn)
 	case "sqlite":
-		// SQLite需要CGO支持，在Windows环境下可能不可用
-		// 建议使用PostgreSQL作为生产数据库
-		return fmt.Errorf("SQLite需要CGO支持，请使用PostgreSQL数据库")
+		// 使用纯 Go 实现的 SQLite 驱动，不需要 CGO
+		if cfg.FilePath == "" {
+			return nil, fmt.Errorf("SQLite 文件路径不能为空")
+		}
+		if err := checkMigrated(cfg.FilePath); err != nil {
+			return nil, err
+		}
+		if cfg.FilePath != ":memory:" {
+			if err := os.MkdirAll(filepath.Dir(cfg.FilePath), 0755); err != nil {
+				return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+			}
+		}
+		busyTimeout := cfg.BusyTimeout
+		if busyTimeout <= 0 {
+			busyTimeout = DefaultBusyTimeout
+		}
+		dialector = sqlite.Dialector{DriverName: "sqlite", DSN: sqliteDSN(cfg.FilePath, busyTimeout)}
+		maxOpen = defaultSQLiteMaxOpenConns
+		if cfg.FilePath == ":memory:" {
+			// 内存数据库每个连接相互独立，只能使用一个连接
+			maxOpen = 1
+		}
 	default:
-		return fmt.Errorf("不支持的数据库类型: %s (支持: postgres)", cfg.Type)
+		return nil, fmt.Errorf("不支持的数据库类型: %s (支持: sqlite, postgres)", cfg.Type)
+	}
+	if cfg.MaxOpenConns > 0 && cfg.FilePath != ":memory:" {
+		maxOpen = cfg.MaxOpenConns
 	}
 
 	// 打开数据库连接
-	DB, err = gorm.Open(dialector, gormConfig)
+	db, err := gorm.Open(dialector, gormConfig)
 	if err != nil {
-		return fmt.Errorf("连接数据库失败: %w", err)
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
 	}
 
 	// 配置连接池
-	sqlDB, err := DB.DB()
+	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("获取数据库实例失败: %w", err)
+		return nil, fmt.Errorf("获取数据库实例失败: %w", err)
 	}
 
 	// 设置连接池参数
-	sqlDB.SetMaxIdleConns(10)           // 最大空闲连接数
-	sqlDB.SetMaxOpenConns(100)          // 最大打开连接数
-	sqlDB.SetConnMaxLifetime(time.Hour) // 连接最大生命周期
+	sqlDB.SetMaxIdleConns(min(10, maxOpen)) // 最大空闲连接数
+	sqlDB.SetMaxOpenConns(maxOpen)          // 最大打开连接数
+	sqlDB.SetConnMaxLifetime(time.Hour)     // 连接最大生命周期
+	if cfg.FilePath == ":memory:" {
+		// 内存数据库的连接关闭后数据随之丢失，连接不过期
+		sqlDB.SetConnMaxLifetime(0)
+	}
 
-	log.Printf("✅ 数据库连接成功 (类型: %s)", cfg.Type)
+	return db, nil
+}
 
+// Init 初始化全局数据库连接
+func Init(cfg Config) error {
+	db, err := Open(cfg)
+	if err != nil {
+		return err
+	}
+	DB = db
+	log.Printf("✅ 数据库连接成功 (类型: %s)", cfg.Type)
 	return nil
 }
 
+// CoreSchema 用户、租户、权限和审计日志表结构
+var CoreSchema = Schema{
+	Service: "core",
+	Version: 1,
+	Models:  []interface{}{&User{}, &Tenant{}, &Permission{}, &RolePermission{}, &AuditLog{}},
+}
+
 // AutoMigrate 自动迁移数据库表结构
 func AutoMigrate() error {
 	if DB == nil {
@@ -89,13 +167,7 @@ func AutoMigrate() error {
 	}
 
 	// 自动迁移所有模型
-	err := DB.AutoMigrate(
-		&User{},
-		&Tenant{},
-		&Permission{},
-		&RolePermission{},
-		&AuditLog{},
-	)
+	err := Migrate(DB, CoreSchema)
 
 	if err != nil {
 		return fmt.Errorf("数据库迁移失败: %w", err)
@@ -150,6 +222,7 @@ func InitDefaultData() error {
 		{Name: "tenant:read", Resource: "tenant", Action: "read", Description: "查看租户"},
 		{Name: "tenant:write", Resource: "tenant", Action: "write", Description: "创建/修改租户"},
 		{Name: "tenant:delete", Resource: "tenant", Action: "delete", Description: "删除租户"},
+		{Name: "deployments:approve", Resource: "deployments", Action: "approve", Description: "审批生产环境部署"},
 	}
 
 	for _, perm := range defaultPermissions {
@@ -10,8 +10,6 @@ import (
 
 // TestDatabaseInit 测试数据库初始化
 func TestDatabaseInit(t *testing.T) {
-	t.Skip("跳过需要CGO的SQLite测试")
-	
 	// 使用内存SQLite数据库进行测试
 	cfg := Config{
 		Type:     "sqlite",
@@ -72,8 +70,6 @@ func TestDatabaseInit(t *testing.T) {
 
 // TestRBACService 测试RBAC服务
 func TestRBACService(t *testing.T) {
-	t.Skip("跳过需要CGO的SQLite测试")
-	
 	// 初始化测试数据库
 	cfg := Config{
 		Type:     "sqlite",
@@ -251,8 +247,6 @@ func TestRBACService(t *testing.T) {
 
 // TestAuditService 测试审计服务
 func TestAuditService(t *testing.T) {
-	t.Skip("跳过需要CGO的SQLite测试")
-	
 	// 初始化测试数据库
 	cfg := Config{
 		Type:     "sqlite",
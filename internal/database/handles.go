@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// DefaultSQLitePath 未配置数据库时所有服务共用的 SQLite 文件
+const DefaultSQLitePath = "data/qwq.db"
+
+// HandleConfig 服务数据库句柄的分配方式
+type HandleConfig struct {
+	Config
+	// Dir SQLite 按服务分库的目录，FilePath 为空时每个服务使用 <Dir>/<服务>.db
+	Dir string
+}
+
+var handles = struct {
+	sync.Mutex
+	config HandleConfig
+	open   map[string]*gorm.DB // 按数据库文件（或 PostgreSQL 连接）缓存，共享同一文件的服务共用连接池
+}{open: make(map[string]*gorm.DB)}
+
+// Configure 设置服务数据库句柄的分配方式，应在启动时、第一次调用 Handle 之前调用
+// 类型为空时使用 SQLite；SQLite 既未配置文件也未配置目录时所有服务共用 DefaultSQLitePath
+func Configure(cfg HandleConfig) {
+	if cfg.Type == "" {
+		cfg.Type = "sqlite"
+	}
+	if cfg.Type == "sqlite" && cfg.FilePath == "" && cfg.Dir == "" {
+		cfg.FilePath = DefaultSQLitePath
+	}
+	handles.Lock()
+	handles.config = cfg
+	handles.Unlock()
+}
+
+// Handle 获取服务使用的数据库连接
+// 同一个数据库只打开一次，服务之间不应各自打开连接，否则连接池和锁等待配置无法统一
+func Handle(service string) (*gorm.DB, error) {
+	handles.Lock()
+	defer handles.Unlock()
+
+	cfg := handleConfig(service)
+	key := cfg.Type
+	if cfg.Type == "sqlite" {
+		key = cfg.FilePath
+	}
+	if db, ok := handles.open[key]; ok {
+		return db, nil
+	}
+
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("打开 %s 数据库失败: %w", service, err)
+	}
+	handles.open[key] = db
+	return db, nil
+}
+
+// HandleFile 服务使用的 SQLite 文件，使用 PostgreSQL 时为空
+func HandleFile(service string) string {
+	handles.Lock()
+	defer handles.Unlock()
+	if cfg := handleConfig(service); cfg.Type == "sqlite" {
+		return cfg.FilePath
+	}
+	return ""
+}
+
+// handleConfig 服务的连接配置，调用方持有 handles 锁
+func handleConfig(service string) Config {
+	cfg := handles.config.Config
+	if cfg.Type == "" {
+		cfg.Type, cfg.FilePath = "sqlite", DefaultSQLitePath
+	}
+	if cfg.Type == "sqlite" && cfg.FilePath == "" {
+		cfg.FilePath = filepath.Join(handles.config.Dir, service+".db")
+	}
+	return cfg
+}
+
+// CloseHandles 关闭所有服务数据库连接
+func CloseHandles() error {
+	handles.Lock()
+	defer handles.Unlock()
+
+	var firstErr error
+	for key, db := range handles.open {
+		if sqlDB, err := db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		delete(handles.open, key)
+	}
+	return firstErr
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// 模拟两个共用数据库文件的服务（如部署服务和 DNS 校验）
+type smokeDeployment struct {
+	ID     uint
+	Name   string
+	Status string
+}
+
+type smokeDNSRecord struct {
+	ID       uint
+	Domain   string
+	Verified bool
+}
+
+func TestHandle_SharedSQLiteUnderConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	Configure(HandleConfig{Config: Config{Type: "sqlite", FilePath: filepath.Join(dir, "qwq.db")}})
+	t.Cleanup(func() {
+		CloseHandles()
+		Configure(HandleConfig{})
+	})
+
+	deployDB, err := Handle("deployment")
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if dnsDB, _ := Handle("dns"); dnsDB != deployDB {
+		t.Fatal("Services sharing one file should share one connection pool")
+	}
+	var mode string
+	deployDB.Raw("PRAGMA journal_mode").Scan(&mode)
+	if !strings.EqualFold(mode, "wal") {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	// 独立打开的连接池（如另一个进程）与共享句柄竞争同一个文件
+	otherDB, err := Open(Config{Type: "sqlite", FilePath: filepath.Join(dir, "qwq.db")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := otherDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	deploySchema := Schema{Service: "deployment", Version: 1, Models: []interface{}{&smokeDeployment{}}}
+	dnsSchema := Schema{Service: "dns", Version: 1, Models: []interface{}{&smokeDNSRecord{}}}
+	if err := Migrate(deployDB, deploySchema, dnsSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	const writes = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*writes)
+	hammer := func(db *gorm.DB, write func(tx *gorm.DB, i int) error) {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			// 先读后写的事务最容易触发 "database is locked"
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var count int64
+				if err := tx.Model(&smokeDeployment{}).Count(&count).Error; err != nil {
+					return err
+				}
+				return write(tx, i)
+			})
+			if err != nil {
+				errs <- err
+			}
+		}
+	}
+	wg.Add(2)
+	go hammer(deployDB, func(tx *gorm.DB, i int) error {
+		return tx.Create(&smokeDeployment{Name: fmt.Sprintf("app-%d", i), Status: "running"}).Error
+	})
+	go hammer(otherDB, func(tx *gorm.DB, i int) error {
+		return tx.Create(&smokeDNSRecord{Domain: fmt.Sprintf("d%d.example.com", i), Verified: i%2 == 0}).Error
+	})
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Concurrent write failed: %v", err)
+	}
+
+	var deployments, records int64
+	deployDB.Model(&smokeDeployment{}).Count(&deployments)
+	deployDB.Model(&smokeDNSRecord{}).Count(&records)
+	if deployments != writes || records != writes {
+		t.Errorf("Expected %d rows each, got %d deployments and %d records", writes, deployments, records)
+	}
+}
+
+func TestMigrate_RecordsSchemaVersion(t *testing.T) {
+	db, err := Open(Config{Type: "sqlite", FilePath: ":memory:"})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	schema := Schema{Service: "deployment", Version: 1, Models: []interface{}{&smokeDeployment{}}}
+	if err := Migrate(db, schema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if version, err := SchemaVersion(db, "deployment"); err != nil || version != 1 {
+		t.Fatalf("SchemaVersion = %d, %v", version, err)
+	}
+
+	// 版本未变化时不再迁移：新增的模型不会被创建
+	schema.Models = append(schema.Models, &smokeDNSRecord{})
+	if err := Migrate(db, schema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if db.Migrator().HasTable(&smokeDNSRecord{}) {
+		t.Error("Migration with an already applied version should be skipped")
+	}
+	schema.Version = 2
+	if err := Migrate(db, schema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !db.Migrator().HasTable(&smokeDNSRecord{}) {
+		t.Error("Bumped schema version should migrate new models")
+	}
+	if version, _ := SchemaVersion(db, "deployment"); version != 2 {
+		t.Errorf("SchemaVersion = %d, want 2", version)
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
+
+	"qwq/internal/realip"
 )
 
 // ContextKey 上下文键类型
@@ -221,27 +222,9 @@ func (m *PermissionMiddleware) getActionFromMethod(method string) string {
 	}
 }
 
-// getClientIP 获取客户端IP地址
+// getClientIP 获取客户端IP地址，只有来自可信代理的请求才使用转发头
 func (m *PermissionMiddleware) getClientIP(r *http.Request) string {
-	// 尝试从X-Forwarded-For头获取
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// 尝试从X-Real-IP头获取
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// 使用RemoteAddr
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
-	}
-	return ip
+	return realip.FromRequest(r)
 }
 
 // respondError 返回错误响应
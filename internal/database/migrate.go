@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration 记录每个服务已应用的表结构版本
+type SchemaMigration struct {
+	Service   string `gorm:"primaryKey;size:64"`
+	Version   int    `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+// Schema 一个服务的表结构，模型变化时递增 Version
+type Schema struct {
+	Service string
+	Version int
+	Models  []interface{}
+}
+
+// Migrate 在启动时执行表结构迁移，已记录的版本不低于 Version 的服务直接跳过
+func Migrate(db *gorm.DB, schemas ...Schema) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("创建 schema_migrations 失败: %w", err)
+	}
+	for _, schema := range schemas {
+		var applied SchemaMigration
+		err := db.Where("service = ?", schema.Service).First(&applied).Error
+		if err == nil && applied.Version >= schema.Version {
+			continue
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("读取 %s 表结构版本失败: %w", schema.Service, err)
+		}
+
+		if err := db.AutoMigrate(schema.Models...); err != nil {
+			return fmt.Errorf("%s 表结构迁移失败: %w", schema.Service, err)
+		}
+		applied = SchemaMigration{Service: schema.Service, Version: schema.Version, AppliedAt: time.Now().UTC()}
+		if err := db.Save(&applied).Error; err != nil {
+			return fmt.Errorf("记录 %s 表结构版本失败: %w", schema.Service, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion 返回服务已应用的表结构版本，未迁移时返回 0
+func SchemaVersion(db *gorm.DB, service string) (int, error) {
+	var applied SchemaMigration
+	err := db.Where("service = ?", service).First(&applied).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return applied.Version, err
+}
@@ -0,0 +1,573 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultTransferBatch 迁移时每个事务写入的行数
+const DefaultTransferBatch = 500
+
+// spotChecks 迁移后每张表抽查的行数
+const spotChecks = 5
+
+var (
+	// ErrTargetNotEmpty 目标数据库中已有数据，迁移只写入空库，避免与已有数据混在一起
+	ErrTargetNotEmpty = errors.New("target database is not empty")
+	// ErrSchemaMismatch 目标数据库的表结构版本与当前版本不同
+	ErrSchemaMismatch = errors.New("target schema version does not match")
+	// ErrIncompatible 源数据中有目标数据库无法保存的值
+	ErrIncompatible = errors.New("source data is incompatible with the target database")
+	// ErrVerifyFailed 迁移后的行数或抽查的行与源数据不一致
+	ErrVerifyFailed = errors.New("migrated data does not match the source")
+)
+
+// sqliteOnlyTypes SQLite 接受但 PostgreSQL 没有的列类型，模型中显式声明时需要改为右侧的类型
+var sqliteOnlyTypes = map[string]string{
+	"datetime": "timestamptz",
+	"blob":     "bytea",
+	"tinyint":  "smallint",
+	"longtext": "text",
+	"double":   "double precision",
+}
+
+// TransferSource 一个服务的源数据库
+type TransferSource struct {
+	Schema Schema
+	DB     *gorm.DB
+}
+
+// Incompatibility 检查时发现的问题，Blocking 为 true 时迁移不会开始
+type Incompatibility struct {
+	Service  string `json:"service"`
+	Table    string `json:"table"`
+	Column   string `json:"column,omitempty"`
+	Problem  string `json:"problem"`
+	Rows     int64  `json:"rows,omitempty"` // 受影响的行数，列类型问题为 0
+	Blocking bool   `json:"blocking"`
+}
+
+// PlannedTable 将要复制的表
+type PlannedTable struct {
+	Service string `json:"service"`
+	Table   string `json:"table"`
+	Rows    int64  `json:"rows"`
+}
+
+// TransferPlan 迁移前的检查结果，不写入任何数据
+type TransferPlan struct {
+	Tables            []PlannedTable    `json:"tables"`
+	Incompatibilities []Incompatibility `json:"incompatibilities,omitempty"`
+	Upgrades          []string          `json:"upgrades,omitempty"` // 源数据库将先升级表结构的服务，如 "container: 2 -> 3"
+}
+
+// Blocking 是否有阻止迁移的问题
+func (p *TransferPlan) Blocking() bool {
+	for _, inc := range p.Incompatibilities {
+		if inc.Blocking {
+			return true
+		}
+	}
+	return false
+}
+
+// TableResult 一张表的迁移结果
+type TableResult struct {
+	Service string `json:"service"`
+	Table   string `json:"table"`
+	Rows    int64  `json:"rows"`
+	Checked int    `json:"checked"` // 哈希一致的抽查行数
+}
+
+// Transfer 把各服务的数据复制到目标数据库，通常是从 SQLite 迁移到 PostgreSQL
+// 迁移期间不应有进程写入源数据库
+type Transfer struct {
+	Target    *gorm.DB
+	Sources   []TransferSource
+	BatchSize int                                              // 每个事务写入的行数，0 表示 DefaultTransferBatch
+	Progress  func(service, table string, copied, total int64) // 每写入一批调用一次
+}
+
+// Check 检查目标数据库是否为空（或表结构版本一致且没有数据），并扫描源数据中目标数据库无法保存的值
+func (t *Transfer) Check(ctx context.Context) (*TransferPlan, error) {
+	plan := &TransferPlan{}
+	hasVersions := t.Target.Migrator().HasTable(&SchemaMigration{})
+	for _, src := range t.Sources {
+		var version int
+		if src.DB.Migrator().HasTable(&SchemaMigration{}) {
+			v, err := SchemaVersion(src.DB, src.Schema.Service)
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 源表结构版本失败: %w", src.Schema.Service, err)
+			}
+			version = v
+		}
+		if version < src.Schema.Version {
+			plan.Upgrades = append(plan.Upgrades, fmt.Sprintf("%s: %d -> %d", src.Schema.Service, version, src.Schema.Version))
+		}
+		if hasVersions {
+			target, err := SchemaVersion(t.Target, src.Schema.Service)
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 目标表结构版本失败: %w", src.Schema.Service, err)
+			}
+			if target != 0 && target != src.Schema.Version {
+				return nil, fmt.Errorf("%w: %s 目标版本 %d，当前版本 %d", ErrSchemaMismatch, src.Schema.Service, target, src.Schema.Version)
+			}
+		}
+
+		for _, model := range src.Schema.Models {
+			sch, err := parseModel(src.DB, model)
+			if err != nil {
+				return nil, err
+			}
+			plan.Incompatibilities = append(plan.Incompatibilities, columnTypeProblems(src.Schema.Service, sch)...)
+			if t.Target.Migrator().HasTable(sch.Table) {
+				var count int64
+				if err := t.Target.WithContext(ctx).Unscoped().Model(model).Count(&count).Error; err != nil {
+					return nil, fmt.Errorf("统计目标表 %s 失败: %w", sch.Table, err)
+				}
+				if count > 0 {
+					return nil, fmt.Errorf("%w: %s 已有 %d 行", ErrTargetNotEmpty, sch.Table, count)
+				}
+			}
+			if !src.DB.Migrator().HasTable(sch.Table) {
+				continue
+			}
+			var rows int64
+			if err := src.DB.WithContext(ctx).Unscoped().Model(model).Count(&rows).Error; err != nil {
+				return nil, fmt.Errorf("统计 %s 失败: %w", sch.Table, err)
+			}
+			plan.Tables = append(plan.Tables, PlannedTable{Service: src.Schema.Service, Table: sch.Table, Rows: rows})
+			problems, err := t.scanRows(ctx, src, model, sch, rows)
+			if err != nil {
+				return nil, err
+			}
+			plan.Incompatibilities = append(plan.Incompatibilities, problems...)
+		}
+	}
+	plan.Incompatibilities = append(plan.Incompatibilities, t.unmanagedTables()...)
+	return plan, nil
+}
+
+// Run 检查通过后先把源数据库升级到当前表结构版本，再在目标数据库建表、按批复制并校验
+// 中途失败时目标数据库中可能已有部分数据，需要清空后重新执行
+func (t *Transfer) Run(ctx context.Context) ([]TableResult, error) {
+	plan, err := t.Check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Blocking() {
+		return nil, fmt.Errorf("%w: 先用 dry-run 查看详情", ErrIncompatible)
+	}
+	var results []TableResult
+	for _, src := range t.Sources {
+		if err := Migrate(src.DB, src.Schema); err != nil {
+			return results, fmt.Errorf("升级源数据库失败: %w", err)
+		}
+		if err := Migrate(t.Target, src.Schema); err != nil {
+			return results, fmt.Errorf("创建目标表结构失败: %w", err)
+		}
+		for _, model := range src.Schema.Models {
+			result, err := t.copyTable(ctx, src, model)
+			if err != nil {
+				return results, err
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// copyTable 按主键顺序分批读取并写入，写完后校验行数并抽查几行的哈希
+func (t *Transfer) copyTable(ctx context.Context, src TransferSource, model interface{}) (TableResult, error) {
+	sch, err := parseModel(src.DB, model)
+	if err != nil {
+		return TableResult{}, err
+	}
+	result := TableResult{Service: src.Schema.Service, Table: sch.Table}
+	var total int64
+	if err := src.DB.WithContext(ctx).Unscoped().Model(model).Count(&total).Error; err != nil {
+		return result, fmt.Errorf("统计 %s 失败: %w", sch.Table, err)
+	}
+
+	// 插入后逐行修正的列：PostgreSQL 的 jsonb 不接受空字符串，插入时写入 NULL（读回时仍为空字符串），非空值随后写入；
+	// GORM 插入时会把带 default 标签的零值（如 false）替换为默认值，随后改回零值
+	var jsonbColumns, defaultColumns []*schema.Field
+	omit := []string{clause.Associations}
+	for _, field := range sch.Fields {
+		switch {
+		case field.DBName == "":
+		case isJSONB(field) && field.FieldType.Kind() == reflect.String:
+			jsonbColumns = append(jsonbColumns, field)
+			omit = append(omit, field.DBName)
+		case field.DefaultValueInterface != nil && !field.PrimaryKey:
+			defaultColumns = append(defaultColumns, field)
+		}
+	}
+
+	batch := t.batchSize()
+	for offset := int64(0); offset < total; offset += int64(batch) {
+		rows, err := readBatch(ctx, src.DB, model, sch, offset, batch)
+		if err != nil {
+			return result, err
+		}
+		if rows.Len() == 0 {
+			break
+		}
+		// 插入时 GORM 会把默认值写回结构体，需要先记下要修正的值
+		fixes := make([]map[string]interface{}, rows.Len())
+		for i := range fixes {
+			row := rows.Index(i)
+			for _, field := range jsonbColumns {
+				if value, _ := field.ValueOf(ctx, row); value.(string) != "" {
+					fixes[i] = setFix(fixes[i], field.DBName, value)
+				}
+			}
+			for _, field := range defaultColumns {
+				if value, zero := field.ValueOf(ctx, row); zero {
+					fixes[i] = setFix(fixes[i], field.DBName, value)
+				}
+			}
+		}
+		err = t.Target.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// Select("*") 使没有默认值的零值字段也写入
+			insert := tx.Session(&gorm.Session{SkipHooks: true}).Select("*").Omit(omit...)
+			if err := insert.Create(rows.Addr().Interface()).Error; err != nil {
+				return err
+			}
+			for i, fix := range fixes {
+				if fix == nil {
+					continue
+				}
+				if err := tx.Session(&gorm.Session{SkipHooks: true}).Unscoped().Model(rows.Index(i).Addr().Interface()).UpdateColumns(fix).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("写入 %s 失败（第 %d 行起）: %w", sch.Table, offset+1, err)
+		}
+		result.Rows += int64(rows.Len())
+		if t.Progress != nil {
+			t.Progress(src.Schema.Service, sch.Table, result.Rows, total)
+		}
+	}
+	if err := resetSequence(ctx, t.Target, sch); err != nil {
+		return result, fmt.Errorf("重置 %s 自增序列失败: %w", sch.Table, err)
+	}
+
+	var copied int64
+	if err := t.Target.WithContext(ctx).Unscoped().Model(model).Count(&copied).Error; err != nil {
+		return result, fmt.Errorf("统计目标表 %s 失败: %w", sch.Table, err)
+	}
+	if copied != total {
+		return result, fmt.Errorf("%w: %s 源 %d 行，目标 %d 行", ErrVerifyFailed, sch.Table, total, copied)
+	}
+	for _, offset := range spotOffsets(total) {
+		want, err := readBatch(ctx, src.DB, model, sch, offset, 1)
+		if err != nil {
+			return result, err
+		}
+		got, err := readBatch(ctx, t.Target, model, sch, offset, 1)
+		if err != nil {
+			return result, err
+		}
+		if got.Len() != 1 || rowHash(ctx, sch, want.Index(0)) != rowHash(ctx, sch, got.Index(0)) {
+			return result, fmt.Errorf("%w: %s 第 %d 行不一致", ErrVerifyFailed, sch.Table, offset+1)
+		}
+		result.Checked++
+	}
+	return result, nil
+}
+
+// scanRows 逐行检查目标数据库无法原样保存的值
+func (t *Transfer) scanRows(ctx context.Context, src TransferSource, model interface{}, sch *schema.Schema, total int64) ([]Incompatibility, error) {
+	type problem struct {
+		column string
+		valueProblem
+	}
+	counts := make(map[problem]int64)
+	batch := t.batchSize()
+	for offset := int64(0); offset < total; offset += int64(batch) {
+		rows, err := readBatch(ctx, src.DB, model, sch, offset, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < rows.Len(); i++ {
+			for _, field := range sch.Fields {
+				if field.DBName == "" || field.Serializer != nil {
+					continue
+				}
+				value, _ := field.ValueOf(ctx, rows.Index(i))
+				for _, p := range valueProblems(field, value) {
+					counts[problem{field.DBName, p}]++
+				}
+			}
+		}
+		if rows.Len() < batch {
+			break
+		}
+	}
+	var result []Incompatibility
+	for p, n := range counts {
+		result = append(result, Incompatibility{Service: src.Schema.Service, Table: sch.Table, Column: p.column, Problem: p.text, Rows: n, Blocking: p.blocking})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Column != result[j].Column {
+			return result[i].Column < result[j].Column
+		}
+		return result[i].Problem < result[j].Problem
+	})
+	return result, nil
+}
+
+// valueProblem 单个值的问题
+type valueProblem struct {
+	text     string
+	blocking bool
+}
+
+// valueProblems 单个值在 PostgreSQL 中的问题：SQLite 不检查长度、不校验 JSON，文本中也允许 NUL 字符
+func valueProblems(field *schema.Field, value interface{}) []valueProblem {
+	switch v := value.(type) {
+	case string:
+		var problems []valueProblem
+		if strings.ContainsRune(v, 0) {
+			problems = append(problems, valueProblem{"包含 NUL 字符，PostgreSQL 文本无法保存", true})
+		}
+		if isJSONB(field) {
+			if v == "" {
+				problems = append(problems, valueProblem{"jsonb 列为空字符串，将写入 NULL", false})
+			} else if !json.Valid([]byte(v)) {
+				problems = append(problems, valueProblem{"jsonb 列不是合法的 JSON", true})
+			}
+		} else if field.Size > 0 && field.TagSettings["TYPE"] == "" && utf8.RuneCountInString(v) > field.Size {
+			problems = append(problems, valueProblem{fmt.Sprintf("超过 varchar(%d) 长度", field.Size), true})
+		}
+		return problems
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return []valueProblem{{"超出 bigint 范围", true}}
+		}
+	case uint64:
+		if v > math.MaxInt64 {
+			return []valueProblem{{"超出 bigint 范围", true}}
+		}
+	}
+	return nil
+}
+
+// columnTypeProblems 模型中显式声明的 SQLite 专用列类型
+func columnTypeProblems(service string, sch *schema.Schema) []Incompatibility {
+	var result []Incompatibility
+	for _, field := range sch.Fields {
+		declared := strings.ToLower(strings.TrimSpace(field.TagSettings["TYPE"]))
+		if mapped, ok := sqliteOnlyTypes[declared]; ok {
+			result = append(result, Incompatibility{
+				Service: service, Table: sch.Table, Column: field.DBName, Blocking: true,
+				Problem: fmt.Sprintf("列类型 %s 是 SQLite 专用类型，需要在模型中改为 %s", declared, mapped),
+			})
+		}
+	}
+	return result
+}
+
+// unmanagedTables 源数据库中不属于任何服务表结构的表，这些表不会被复制
+func (t *Transfer) unmanagedTables() []Incompatibility {
+	managed := map[string]bool{"schema_migrations": true, "sqlite_sequence": true}
+	var dbs []*gorm.DB
+	seen := make(map[*gorm.DB]bool)
+	for _, src := range t.Sources {
+		for _, model := range src.Schema.Models {
+			if sch, err := parseModel(src.DB, model); err == nil {
+				managed[sch.Table] = true
+			}
+		}
+		if !seen[src.DB] {
+			seen[src.DB] = true
+			dbs = append(dbs, src.DB)
+		}
+	}
+	var result []Incompatibility
+	reported := make(map[string]bool)
+	for _, db := range dbs {
+		tables, err := db.Migrator().GetTables()
+		if err != nil {
+			continue
+		}
+		for _, table := range tables {
+			if managed[table] || reported[table] || strings.HasPrefix(table, "sqlite_") {
+				continue
+			}
+			reported[table] = true
+			result = append(result, Incompatibility{Table: table, Problem: "不属于任何服务的表结构，不会被复制"})
+		}
+	}
+	return result
+}
+
+func setFix(fix map[string]interface{}, column string, value interface{}) map[string]interface{} {
+	if fix == nil {
+		fix = make(map[string]interface{})
+	}
+	fix[column] = value
+	return fix
+}
+
+func (t *Transfer) batchSize() int {
+	if t.BatchSize > 0 {
+		return t.BatchSize
+	}
+	return DefaultTransferBatch
+}
+
+func parseModel(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("解析模型 %T 失败: %w", model, err)
+	}
+	return stmt.Schema, nil
+}
+
+// readBatch 按主键顺序读取一批行，包括软删除的行，返回元素为模型结构体的切片
+func readBatch(ctx context.Context, db *gorm.DB, model interface{}, sch *schema.Schema, offset int64, limit int) (reflect.Value, error) {
+	rows := reflect.New(reflect.SliceOf(sch.ModelType))
+	tx := db.WithContext(ctx).Unscoped().Model(model)
+	for _, field := range sch.PrimaryFields {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: field.DBName}})
+	}
+	if err := tx.Offset(int(offset)).Limit(limit).Find(rows.Interface()).Error; err != nil {
+		return rows.Elem(), fmt.Errorf("读取 %s 失败: %w", sch.Table, err)
+	}
+	return rows.Elem(), nil
+}
+
+// resetSequence 复制时写入了原有的自增 ID，PostgreSQL 的序列需要推进到最大值之后
+func resetSequence(ctx context.Context, db *gorm.DB, sch *schema.Schema) error {
+	field := sch.PrioritizedPrimaryField
+	if db.Dialector.Name() != "postgres" || field == nil || !field.AutoIncrement {
+		return nil
+	}
+	quote := func(name string) string {
+		var b strings.Builder
+		db.Dialector.QuoteTo(&b, name)
+		return b.String()
+	}
+	sql := fmt.Sprintf("SELECT setval(pg_get_serial_sequence(?, ?), MAX(%s)) FROM %s", quote(field.DBName), quote(sch.Table))
+	return db.WithContext(ctx).Exec(sql, sch.Table, field.DBName).Error
+}
+
+// spotOffsets 抽查的行：第一行、最后一行和中间均匀分布的几行
+func spotOffsets(total int64) []int64 {
+	if total <= spotChecks {
+		offsets := make([]int64, total)
+		for i := range offsets {
+			offsets[i] = int64(i)
+		}
+		return offsets
+	}
+	offsets := make([]int64, spotChecks)
+	for i := range offsets {
+		offsets[i] = int64(i) * (total - 1) / (spotChecks - 1)
+	}
+	return offsets
+}
+
+// rowHash 行内容的哈希，时间统一为 UTC 微秒精度（PostgreSQL 的精度），jsonb 按解析后的内容比较
+func rowHash(ctx context.Context, sch *schema.Schema, row reflect.Value) string {
+	h := sha256.New()
+	for _, field := range sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		value, _ := field.ValueOf(ctx, row)
+		switch v := value.(type) {
+		case time.Time:
+			value = v.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+		case *time.Time:
+			if v != nil {
+				value = v.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+			}
+		case gorm.DeletedAt:
+			if v.Valid {
+				value = v.Time.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+			} else {
+				value = nil
+			}
+		case string:
+			if isJSONB(field) && v != "" {
+				var parsed interface{}
+				if json.Unmarshal([]byte(v), &parsed) == nil {
+					canonical, _ := json.Marshal(parsed)
+					value = string(canonical)
+				}
+			}
+		}
+		encoded, _ := json.Marshal(value)
+		fmt.Fprintf(h, "%s=%s\n", field.DBName, encoded)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isJSONB(field *schema.Field) bool {
+	return strings.EqualFold(string(field.DataType), "jsonb") || strings.EqualFold(field.TagSettings["TYPE"], "jsonb")
+}
+
+// MigratedSuffix 迁移完成后在 SQLite 文件旁写入的标记文件后缀，如 data/qwq.db.migrated
+const MigratedSuffix = ".migrated"
+
+// ErrMigrated SQLite 数据库已迁移到其他数据库，继续写入会使两边的数据分叉
+var ErrMigrated = errors.New("sqlite database has been migrated")
+
+// MigratedMarker 标记文件的内容
+type MigratedMarker struct {
+	Target     string    `json:"target"` // 目标数据库，不含密码
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// MarkMigrated 在 SQLite 文件旁写入标记，之后 Open 拒绝打开该文件
+func MarkMigrated(path, target string) error {
+	data, err := json.MarshalIndent(MigratedMarker{Target: target, MigratedAt: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+MigratedSuffix, data, 0600)
+}
+
+// MigratedTo 读取 SQLite 文件的迁移标记，未迁移时返回 nil
+func MigratedTo(path string) *MigratedMarker {
+	data, err := os.ReadFile(path + MigratedSuffix)
+	if err != nil {
+		return nil
+	}
+	var marker MigratedMarker
+	json.Unmarshal(data, &marker) // 内容损坏时仍视为已迁移
+	return &marker
+}
+
+// checkMigrated 已迁移的 SQLite 文件不再打开
+func checkMigrated(path string) error {
+	if path == ":memory:" {
+		return nil
+	}
+	if marker := MigratedTo(path); marker != nil {
+		return fmt.Errorf("%w: %s 已于 %s 迁移到 %s，请把 database.type 改为 postgres（确认不再需要后可删除 %s）",
+			ErrMigrated, path, marker.MigratedAt.Local().Format("2006-01-02 15:04"), marker.Target, path+MigratedSuffix)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 模拟迁移时容易丢失数据的字段：带默认值的布尔、软删除、jsonb 和限长字符串
+type transferSite struct {
+	ID        uint
+	Domain    string   `gorm:"size:16"`
+	Enabled   bool     `gorm:"default:true"`
+	Labels    string   `gorm:"type:jsonb"`
+	Tags      []string `gorm:"type:text;serializer:json"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+type transferEntry struct {
+	Namespace string `gorm:"primaryKey;size:32"`
+	Key       string `gorm:"primaryKey"`
+	Value     string
+}
+
+var transferSchema = Schema{Service: "sites", Version: 2, Models: []interface{}{&transferSite{}, &transferEntry{}}}
+
+func openTransferDB(t *testing.T, path string) *gorm.DB {
+	db, err := Open(Config{Type: "sqlite", FilePath: path})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func seedTransferSource(t *testing.T, db *gorm.DB) {
+	if err := Migrate(db, transferSchema); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		site := &transferSite{Domain: "site" + string(rune('a'+i)) + ".com", Labels: `{"b": 1, "a": 2}`, Tags: []string{"x"}}
+		if i%3 == 0 {
+			site.Labels = ""
+		}
+		if err := db.Create(site).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 零值会被 GORM 忽略，需要单独更新
+	db.Model(&transferSite{}).Where("id = ?", 2).Update("enabled", false)
+	db.Delete(&transferSite{}, 3)
+	db.Create(&transferEntry{Namespace: "ai", Key: "k1", Value: "v1"})
+	db.Create(&transferEntry{Namespace: "ai", Key: "k2", Value: "v2"})
+	db.Create(&transferEntry{Namespace: "http", Key: "k1", Value: "v3"})
+}
+
+func TestTransfer_CopiesAndVerifies(t *testing.T) {
+	dir := t.TempDir()
+	src := openTransferDB(t, filepath.Join(dir, "src.db"))
+	target := openTransferDB(t, filepath.Join(dir, "target.db"))
+	seedTransferSource(t, src)
+	ctx := context.Background()
+
+	var progress []int64
+	transfer := &Transfer{
+		Target:    target,
+		Sources:   []TransferSource{{Schema: transferSchema, DB: src}},
+		BatchSize: 5,
+		Progress: func(service, table string, copied, total int64) {
+			if table == "transfer_sites" {
+				progress = append(progress, copied)
+			}
+		},
+	}
+	plan, err := transfer.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if plan.Blocking() || len(plan.Tables) != 2 || plan.Tables[0].Rows != 12 {
+		t.Fatalf("Expected a non-blocking plan counting the soft-deleted row, got %+v", plan)
+	}
+	if len(plan.Incompatibilities) != 1 || plan.Incompatibilities[0].Column != "labels" || plan.Incompatibilities[0].Rows != 4 {
+		t.Errorf("Expected the empty jsonb values to be reported, got %+v", plan.Incompatibilities)
+	}
+	if target.Migrator().HasTable("transfer_sites") {
+		t.Fatal("Check must not write to the target")
+	}
+
+	results, err := transfer.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 2 || results[0].Rows != 12 || results[0].Checked != spotChecks || results[1].Rows != 3 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if len(progress) != 3 || progress[2] != 12 {
+		t.Errorf("Expected progress after every batch, got %v", progress)
+	}
+
+	var disabled, deleted transferSite
+	target.First(&disabled, 2)
+	if disabled.Enabled || disabled.Labels != `{"b": 1, "a": 2}` || len(disabled.Tags) != 1 {
+		t.Errorf("Expected false, jsonb and serialized values to be preserved, got %+v", disabled)
+	}
+	if err := target.Unscoped().First(&deleted, 3).Error; err != nil || !deleted.DeletedAt.Valid {
+		t.Errorf("Expected the soft-deleted row to be copied, got %+v %v", deleted, err)
+	}
+	var empty transferSite
+	target.First(&empty, 1)
+	if empty.Labels != "" {
+		t.Errorf("Expected an empty jsonb value to read back empty, got %q", empty.Labels)
+	}
+	if version, _ := SchemaVersion(target, "sites"); version != 2 {
+		t.Errorf("Expected the target schema version to be recorded, got %d", version)
+	}
+
+	// 目标已有数据时拒绝再次迁移
+	if _, err := transfer.Check(ctx); !errors.Is(err, ErrTargetNotEmpty) {
+		t.Errorf("Expected ErrTargetNotEmpty, got %v", err)
+	}
+}
+
+func TestTransfer_RejectsTargetMismatchAndBadData(t *testing.T) {
+	dir := t.TempDir()
+	src := openTransferDB(t, filepath.Join(dir, "src.db"))
+	seedTransferSource(t, src)
+	ctx := context.Background()
+
+	// 目标库是旧版本的空表结构
+	target := openTransferDB(t, filepath.Join(dir, "target.db"))
+	old := transferSchema
+	old.Version = 1
+	if err := Migrate(target, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Transfer{Target: target, Sources: []TransferSource{{Schema: transferSchema, DB: src}}}).Check(ctx); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected ErrSchemaMismatch, got %v", err)
+	}
+
+	// SQLite 不检查长度和 JSON，PostgreSQL 会拒绝；未声明的表会被报告
+	src.Exec("UPDATE transfer_sites SET domain = ? WHERE id = 4", "a-very-long-domain-name.example.com")
+	src.Exec("UPDATE transfer_sites SET labels = ? WHERE id = 5", "{broken")
+	src.Exec("CREATE TABLE legacy_notes (id integer)")
+	fresh := openTransferDB(t, filepath.Join(dir, "fresh.db"))
+	transfer := &Transfer{Target: fresh, Sources: []TransferSource{{Schema: transferSchema, DB: src}}}
+	plan, err := transfer.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, inc := range plan.Incompatibilities {
+		found[inc.Table+"."+inc.Column] = found[inc.Table+"."+inc.Column] || inc.Blocking
+		if inc.Table == "legacy_notes" && inc.Blocking {
+			t.Error("Unmanaged tables should be reported without blocking")
+		}
+	}
+	if !plan.Blocking() || !found["transfer_sites.domain"] || !found["transfer_sites.labels"] {
+		t.Errorf("Expected blocking problems for domain and labels, got %+v", plan.Incompatibilities)
+	}
+	if _, err := transfer.Run(ctx); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Expected ErrIncompatible, got %v", err)
+	}
+	if fresh.Migrator().HasTable("transfer_sites") {
+		t.Error("Expected nothing to be written when the check fails")
+	}
+}
+
+func TestMarkMigrated_RefusesOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qwq.db")
+	openTransferDB(t, path)
+	if err := MarkMigrated(path, "postgres://qwq@db/qwq"); err != nil {
+		t.Fatal(err)
+	}
+	if marker := MigratedTo(path); marker == nil || marker.Target != "postgres://qwq@db/qwq" {
+		t.Fatalf("Expected the marker to be readable, got %+v", marker)
+	}
+	if _, err := Open(Config{Type: "sqlite", FilePath: path}); !errors.Is(err, ErrMigrated) {
+		t.Errorf("Expected ErrMigrated, got %v", err)
+	}
+}
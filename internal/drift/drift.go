@@ -0,0 +1,521 @@
+// Package drift 检测 qwq 托管的文件（生成的 nginx 配置、compose 项目文件）被外部修改：
+// 每次托管写入后记录内容和哈希，定期（Linux 上文件变化时立即）重新计算哈希，
+// 发现外部修改时记录漂移事件和相对上次托管版本的 unified diff，并阻止下一次托管写入，
+// 直到运维选择保留外部修改（导入到站点自定义配置或 compose 修订）或用托管版本覆盖
+package drift
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/utils"
+)
+
+const (
+	KindNginx   = "nginx"
+	KindCompose = "compose"
+
+	StatusOpen        = "open"
+	StatusKept        = "kept"
+	StatusOverwritten = "overwritten"
+
+	ActionKeep      = "keep"
+	ActionOverwrite = "overwrite"
+
+	// DefaultInterval 定期重新计算哈希的间隔
+	DefaultInterval = time.Minute
+	// DefaultComposeDir 部署时写入 compose 项目文件的目录
+	DefaultComposeDir = "data/compose"
+	// maxEvents 保留的漂移事件数，超出时丢弃最早的已处理事件
+	maxEvents = 200
+)
+
+var (
+	// ErrConflict 托管文件存在未处理的外部修改，需先保留或覆盖
+	ErrConflict = errors.New("managed file was modified outside qwq")
+	// ErrEventNotFound 漂移事件不存在
+	ErrEventNotFound = errors.New("drift event not found")
+	// ErrResolved 漂移事件已处理
+	ErrResolved = errors.New("drift event already resolved")
+	// ErrInvalidAction 处理方式不是 keep 或 overwrite
+	ErrInvalidAction = errors.New("drift action must be keep or overwrite")
+)
+
+// File 一个托管文件最近一次托管写入的内容
+type File struct {
+	Path       string    `json:"path"`
+	Kind       string    `json:"kind"`
+	Owner      string    `json:"owner"`         // 站点域名或 compose 项目名
+	Ref        string    `json:"ref,omitempty"` // 所属对象的 ID，导入外部修改时定位
+	Hash       string    `json:"hash"`
+	Content    string    `json:"content"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Event 一次外部修改
+type Event struct {
+	ID           int64      `json:"id"`
+	Path         string     `json:"path"`
+	Kind         string     `json:"kind"`
+	Owner        string     `json:"owner"`
+	DetectedAt   time.Time  `json:"detected_at"`
+	ManagedHash  string     `json:"managed_hash"`
+	ExternalHash string     `json:"external_hash"` // 文件被删除时为空
+	Missing      bool       `json:"missing"`
+	Diff         string     `json:"diff"`
+	Status       string     `json:"status"`
+	ResolvedBy   string     `json:"resolved_by,omitempty"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Handler 某类托管文件的处理方式
+type Handler struct {
+	// Import 保留外部修改时把外部内容导入 qwq 的托管数据，之后的托管写入才会包含这些修改
+	Import func(ctx context.Context, file File, external string, actor string) error
+	// Apply 覆盖外部修改后使托管版本生效，如重载 nginx，可为空
+	Apply func(ctx context.Context, file File) error
+}
+
+// state 持久化的内容
+type state struct {
+	Files  map[string]*File `json:"files"`
+	Events []*Event         `json:"events"`
+	NextID int64            `json:"next_id"`
+}
+
+// Tracker 托管文件的哈希记录和漂移事件
+type Tracker struct {
+	mu       sync.Mutex
+	path     string
+	state    state
+	handlers map[string]Handler
+	loaded   bool
+	now      func() time.Time
+}
+
+// NewTracker 创建漂移跟踪器，path 为空时不持久化
+func NewTracker(path string) *Tracker {
+	return &Tracker{
+		path:     path,
+		state:    state{Files: make(map[string]*File), NextID: 1},
+		handlers: make(map[string]Handler),
+		now:      time.Now,
+	}
+}
+
+// Default 全局漂移跟踪器
+var Default = NewTracker("qwq_drift.json")
+
+// Enabled 是否开启外部修改检测
+func Enabled() bool {
+	return !config.Current().Drift.Disabled
+}
+
+// ComposeDir 部署时写入 compose 项目文件的目录
+func ComposeDir() string {
+	if dir := config.Current().Drift.ComposeDir; dir != "" {
+		return dir
+	}
+	return DefaultComposeDir
+}
+
+func interval() time.Duration {
+	if s := config.Current().Drift.Interval; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return DefaultInterval
+}
+
+// Hash 内容的 sha256
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// SetHandler 设置某类文件保留或覆盖外部修改时的处理方式
+func (t *Tracker) SetHandler(kind string, handler Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[kind] = handler
+}
+
+// Load 读取持久化的记录；其他方法首次调用时自动读取
+func (t *Tracker) Load() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.loadLocked()
+}
+
+// ensureLoadedLocked 首次使用时读取持久化的记录，调用方持有锁
+func (t *Tracker) ensureLoadedLocked() {
+	if t.loaded {
+		return
+	}
+	if err := t.loadLocked(); err != nil {
+		logger.Info("⚠️ 读取托管文件记录失败: %v", err)
+	}
+}
+
+func (t *Tracker) loadLocked() error {
+	t.loaded = true
+	if t.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("failed to parse drift state: %w", err)
+	}
+	if st.Files == nil {
+		st.Files = make(map[string]*File)
+	}
+	if st.NextID < 1 {
+		st.NextID = 1
+	}
+	t.state = st
+	return nil
+}
+
+// saveLocked 原子写入记录，调用方持有锁
+func (t *Tracker) saveLocked() {
+	if t.path == "" {
+		return
+	}
+	data, err := json.Marshal(t.state)
+	if err == nil {
+		tmp := t.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, t.path)
+		}
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存托管文件记录失败: %v", err)
+	}
+}
+
+// Write 托管写入 target.Path：先检查文件自上次托管写入后是否被外部修改，有未处理的外部修改时返回 ErrConflict，
+// 否则写入内容并记录哈希。检查、写入和记录在同一把锁内完成，不会把自己的写入误判为外部修改
+func (t *Tracker) Write(target File, content []byte, perm os.FileMode) error {
+	path := filepath.Clean(target.Path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+
+	if Enabled() {
+		t.scanFileLocked(path)
+		if ev := t.openEventLocked(path); ev != nil {
+			return conflictError(ev)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	target.Path = path
+	t.recordLocked(target, string(content))
+	t.saveLocked()
+	return nil
+}
+
+// Check 文件有未处理的外部修改时返回 ErrConflict
+func (t *Tracker) Check(path string) error {
+	if !Enabled() {
+		return nil
+	}
+	path = filepath.Clean(path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+	t.scanFileLocked(path)
+	if ev := t.openEventLocked(path); ev != nil {
+		return conflictError(ev)
+	}
+	return nil
+}
+
+// Forget 托管文件被 qwq 删除后停止跟踪
+func (t *Tracker) Forget(path string) {
+	path = filepath.Clean(path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+	if _, ok := t.state.Files[path]; !ok {
+		return
+	}
+	delete(t.state.Files, path)
+	t.saveLocked()
+}
+
+func conflictError(ev *Event) error {
+	return fmt.Errorf("%w: %s (drift event #%d, keep or overwrite it before qwq regenerates this file)", ErrConflict, ev.Path, ev.ID)
+}
+
+// recordLocked 记录 file 的托管内容
+func (t *Tracker) recordLocked(file File, content string) {
+	file.Hash = Hash([]byte(content))
+	file.Content = content
+	file.RecordedAt = t.now()
+	t.state.Files[file.Path] = &file
+}
+
+func (t *Tracker) openEventLocked(path string) *Event {
+	for _, ev := range t.state.Events {
+		if ev.Path == path && ev.Status == StatusOpen {
+			return ev
+		}
+	}
+	return nil
+}
+
+// Scan 重新计算所有托管文件的哈希，返回新发现的漂移事件
+func (t *Tracker) Scan() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+	paths := make([]string, 0, len(t.state.Files))
+	for path := range t.state.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var found []Event
+	for _, path := range paths {
+		if ev := t.scanFileLocked(path); ev != nil {
+			found = append(found, *ev)
+		}
+	}
+	return found
+}
+
+// scanFileLocked 比较文件当前内容与托管版本，发现外部修改且没有未处理的事件时记录新事件
+func (t *Tracker) scanFileLocked(path string) *Event {
+	file, ok := t.state.Files[path]
+	if !ok || t.openEventLocked(path) != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return nil
+	}
+	external := string(data)
+	hash := ""
+	if !missing {
+		if hash = Hash(data); hash == file.Hash {
+			return nil
+		}
+	}
+
+	ev := &Event{
+		ID:           t.state.NextID,
+		Path:         path,
+		Kind:         file.Kind,
+		Owner:        file.Owner,
+		DetectedAt:   t.now(),
+		ManagedHash:  file.Hash,
+		ExternalHash: hash,
+		Missing:      missing,
+		Diff:         utils.UnifiedDiff(file.Content, external, path+" (qwq)", path+" (external)"),
+		Status:       StatusOpen,
+	}
+	t.state.NextID++
+	t.state.Events = append(t.state.Events, ev)
+	t.trimEventsLocked()
+	t.saveLocked()
+	if missing {
+		logger.Info("⚠️ qwq 托管的文件被外部删除: %s (%s %s)，漂移事件 #%d", path, file.Kind, file.Owner, ev.ID)
+	} else {
+		logger.Info("⚠️ qwq 托管的文件被外部修改: %s (%s %s)，漂移事件 #%d，处理前不会再覆盖该文件", path, file.Kind, file.Owner, ev.ID)
+	}
+	return ev
+}
+
+// trimEventsLocked 只保留最近 maxEvents 个事件，未处理的事件不丢弃
+func (t *Tracker) trimEventsLocked() {
+	excess := len(t.state.Events) - maxEvents
+	if excess <= 0 {
+		return
+	}
+	kept := t.state.Events[:0]
+	for _, ev := range t.state.Events {
+		if excess > 0 && ev.Status != StatusOpen {
+			excess--
+			continue
+		}
+		kept = append(kept, ev)
+	}
+	t.state.Events = kept
+}
+
+// Events 漂移事件，最新的在前；open 为 true 时只返回未处理的事件
+func (t *Tracker) Events(open bool) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+	events := make([]Event, 0, len(t.state.Events))
+	for i := len(t.state.Events) - 1; i >= 0; i-- {
+		if ev := t.state.Events[i]; !open || ev.Status == StatusOpen {
+			events = append(events, *ev)
+		}
+	}
+	return events
+}
+
+// Files 跟踪中的托管文件（不含内容）
+func (t *Tracker) Files() []File {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+	files := make([]File, 0, len(t.state.Files))
+	for _, file := range t.state.Files {
+		f := *file
+		f.Content = ""
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Resolve 处理漂移事件：keep 把外部内容导入托管数据并作为新的托管版本，
+// overwrite 用上次托管写入的内容覆盖文件并使其生效。处理结果记录审计日志
+func (t *Tracker) Resolve(ctx context.Context, id int64, action, actor string) (*Event, error) {
+	if action != ActionKeep && action != ActionOverwrite {
+		return nil, ErrInvalidAction
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+
+	var ev *Event
+	for _, e := range t.state.Events {
+		if e.ID == id {
+			ev = e
+		}
+	}
+	if ev == nil {
+		return nil, fmt.Errorf("%w: #%d", ErrEventNotFound, id)
+	}
+	if ev.Status != StatusOpen {
+		return nil, fmt.Errorf("%w: #%d is %s", ErrResolved, id, ev.Status)
+	}
+	file, ok := t.state.Files[ev.Path]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is no longer managed", ErrEventNotFound, ev.Path)
+	}
+	handler := t.handlers[ev.Kind]
+
+	switch action {
+	case ActionKeep:
+		if ev.Missing {
+			// 保留删除：不再跟踪该文件
+			delete(t.state.Files, ev.Path)
+			ev.Status = StatusKept
+			break
+		}
+		data, err := os.ReadFile(ev.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", ev.Path, err)
+		}
+		if handler.Import != nil {
+			if err := handler.Import(ctx, *file, string(data), actor); err != nil {
+				return nil, fmt.Errorf("failed to import external changes: %w", err)
+			}
+		}
+		t.recordLocked(*file, string(data))
+		ev.Status = StatusKept
+	case ActionOverwrite:
+		if err := os.MkdirAll(filepath.Dir(ev.Path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(ev.Path, []byte(file.Content), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", ev.Path, err)
+		}
+		t.recordLocked(*file, file.Content)
+		ev.Status = StatusOverwritten
+	}
+	now := t.now()
+	ev.ResolvedBy, ev.ResolvedAt = actor, &now
+	t.saveLocked()
+	logger.Info("[AUDIT] drift event #%d on %s resolved with %s by %s", ev.ID, ev.Path, action, actor)
+
+	if action == ActionOverwrite && handler.Apply != nil {
+		if err := handler.Apply(ctx, *t.state.Files[ev.Path]); err != nil {
+			return ev, fmt.Errorf("file restored but failed to apply it: %w", err)
+		}
+	}
+	result := *ev
+	return &result, nil
+}
+
+// AddedLines diff 中外部新增的行（不含文件头），用于把外部修改导入到自定义配置
+func AddedLines(diff string) []string {
+	var lines []string
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
+			lines = append(lines, line[1:])
+		}
+	}
+	return lines
+}
+
+// Run 定期重新计算托管文件的哈希；支持 inotify 时监听托管文件所在目录，文件变化后立即检测
+func (t *Tracker) Run(ctx context.Context) {
+	changed := make(chan struct{}, 1)
+	go watch(ctx, t.dirs, changed)
+
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+			// 编辑器保存通常是多次写入，稍等片刻再比较
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		if Enabled() {
+			t.Scan()
+		}
+	}
+}
+
+// dirs 托管文件所在的目录
+func (t *Tracker) dirs() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ensureLoadedLocked()
+	seen := make(map[string]bool)
+	var dirs []string
+	for path := range t.state.Files {
+		if dir := filepath.Dir(path); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
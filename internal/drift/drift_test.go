@@ -0,0 +1,168 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const managedConfig = "server {\n    listen 80;\n    server_name a.com;\n}\n"
+
+func newTestTracker(t *testing.T) (*Tracker, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sites", "a_com.conf")
+	tracker := NewTracker(filepath.Join(dir, "drift.json"))
+	if err := tracker.Write(File{Path: path, Kind: KindNginx, Owner: "a.com"}, []byte(managedConfig), 0644); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return tracker, path, filepath.Join(dir, "drift.json")
+}
+
+func editExternally(t *testing.T, path string) {
+	t.Helper()
+	edited := strings.Replace(managedConfig, "    listen 80;\n", "    listen 80;\n    gzip on;\n", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTracker_DetectsExternalEditAndBlocksWrite(t *testing.T) {
+	tracker, path, statePath := newTestTracker(t)
+	if events := tracker.Scan(); len(events) != 0 {
+		t.Fatalf("Expected no drift after a managed write, got %+v", events)
+	}
+	// 再次托管写入不受影响
+	if err := tracker.Write(File{Path: path, Kind: KindNginx, Owner: "a.com"}, []byte(managedConfig), 0644); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	editExternally(t, path)
+	events := tracker.Scan()
+	if len(events) != 1 || events[0].Status != StatusOpen || events[0].Owner != "a.com" {
+		t.Fatalf("Expected one open drift event, got %+v", events)
+	}
+	if !strings.Contains(events[0].Diff, "+    gzip on;") {
+		t.Errorf("Expected the diff against the managed version, got %q", events[0].Diff)
+	}
+	if again := tracker.Scan(); len(again) != 0 {
+		t.Errorf("Expected no duplicate event for the same drift, got %+v", again)
+	}
+
+	err := tracker.Write(File{Path: path, Kind: KindNginx, Owner: "a.com"}, []byte("regenerated"), 0644)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected ErrConflict while drift is open, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "gzip on;") {
+		t.Errorf("Expected external changes to be left in place, got %q", data)
+	}
+	if err := tracker.Check(path); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected Check to report the conflict, got %v", err)
+	}
+
+	// 重启后仍然记得未处理的事件
+	reloaded := NewTracker(statePath)
+	if open := reloaded.Events(true); len(open) != 1 || open[0].ID != events[0].ID {
+		t.Errorf("Expected the open event to be persisted, got %+v", open)
+	}
+}
+
+func TestTracker_ResolveOverwrite(t *testing.T) {
+	tracker, path, _ := newTestTracker(t)
+	applied := 0
+	tracker.SetHandler(KindNginx, Handler{Apply: func(ctx context.Context, file File) error {
+		applied++
+		return nil
+	}})
+	editExternally(t, path)
+	events := tracker.Scan()
+
+	if _, err := tracker.Resolve(context.Background(), events[0].ID, "merge", "alice"); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("Expected ErrInvalidAction, got %v", err)
+	}
+	ev, err := tracker.Resolve(context.Background(), events[0].ID, ActionOverwrite, "alice")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if ev.Status != StatusOverwritten || ev.ResolvedBy != "alice" || ev.ResolvedAt == nil || applied != 1 {
+		t.Errorf("Expected overwritten event resolved by alice and applied once, got %+v (applied %d)", ev, applied)
+	}
+	if data, _ := os.ReadFile(path); string(data) != managedConfig {
+		t.Errorf("Expected the managed version to be restored, got %q", data)
+	}
+	if _, err := tracker.Resolve(context.Background(), events[0].ID, ActionKeep, "bob"); !errors.Is(err, ErrResolved) {
+		t.Errorf("Expected ErrResolved on second resolution, got %v", err)
+	}
+	if err := tracker.Write(File{Path: path, Kind: KindNginx, Owner: "a.com"}, []byte("regenerated"), 0644); err != nil {
+		t.Errorf("Expected managed writes to resume, got %v", err)
+	}
+}
+
+func TestTracker_ResolveKeepImportsExternalContent(t *testing.T) {
+	tracker, path, _ := newTestTracker(t)
+	var imported string
+	tracker.SetHandler(KindNginx, Handler{Import: func(ctx context.Context, file File, external, actor string) error {
+		if file.Content != managedConfig {
+			t.Errorf("Expected the managed version to be passed to the importer, got %q", file.Content)
+		}
+		imported = external
+		return nil
+	}})
+	editExternally(t, path)
+	events := tracker.Scan()
+
+	ev, err := tracker.Resolve(context.Background(), events[0].ID, ActionKeep, "alice")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if ev.Status != StatusKept || !strings.Contains(imported, "gzip on;") {
+		t.Errorf("Expected kept event with imported external content, got %+v / %q", ev, imported)
+	}
+	// 外部内容成为新的托管版本
+	if events := tracker.Scan(); len(events) != 0 {
+		t.Errorf("Expected no drift after keeping external changes, got %+v", events)
+	}
+}
+
+func TestTracker_ImportFailureKeepsEventOpen(t *testing.T) {
+	tracker, path, _ := newTestTracker(t)
+	tracker.SetHandler(KindNginx, Handler{Import: func(ctx context.Context, file File, external, actor string) error {
+		return errors.New("no proxy config")
+	}})
+	editExternally(t, path)
+	events := tracker.Scan()
+
+	if _, err := tracker.Resolve(context.Background(), events[0].ID, ActionKeep, "alice"); err == nil {
+		t.Fatal("Expected the import error")
+	}
+	if open := tracker.Events(true); len(open) != 1 {
+		t.Errorf("Expected the event to stay open, got %+v", open)
+	}
+}
+
+func TestTracker_DeletedFile(t *testing.T) {
+	tracker, path, _ := newTestTracker(t)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	events := tracker.Scan()
+	if len(events) != 1 || !events[0].Missing {
+		t.Fatalf("Expected a missing-file event, got %+v", events)
+	}
+	if _, err := tracker.Resolve(context.Background(), events[0].ID, ActionKeep, "alice"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if files := tracker.Files(); len(files) != 0 {
+		t.Errorf("Expected the deleted file to no longer be tracked, got %+v", files)
+	}
+}
+
+func TestAddedLines(t *testing.T) {
+	diff := "--- a\n+++ b\n@@ -1,2 +1,3 @@\n server {\n+    gzip on;\n-    listen 80;\n }\n"
+	if got := AddedLines(diff); len(got) != 1 || got[0] != "    gzip on;" {
+		t.Errorf("Expected only the added line, got %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package drift
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// watchMask 文件内容或目录项变化
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_MOVED_TO | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_ATTRIB
+
+// watch 用 inotify 监听托管文件所在目录，有变化时通知 changed；目录列表定期刷新，新的托管文件所在目录随之加入监听。
+// inotify 不可用时只依赖定期检测
+func watch(ctx context.Context, dirs func() []string, changed chan<- struct{}) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return
+	}
+	// 非阻塞的 fd 交给运行时的网络轮询器，Close 可以打断阻塞中的 Read
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	watched := make(map[string]bool)
+	refresh := func() {
+		for _, dir := range dirs() {
+			if watched[dir] {
+				continue
+			}
+			if _, err := syscall.InotifyAddWatch(fd, dir, watchMask); err == nil {
+				watched[dir] = true
+			}
+		}
+	}
+	refresh()
+
+	go func() {
+		ticker := time.NewTicker(interval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				f.Close()
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := f.Read(buf); err != nil {
+			return
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
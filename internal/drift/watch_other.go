@@ -0,0 +1,8 @@
+//go:build !linux
+
+package drift
+
+import "context"
+
+// watch 非 Linux 平台不监听文件事件，只依赖定期检测
+func watch(ctx context.Context, dirs func() []string, changed chan<- struct{}) {}
@@ -0,0 +1,219 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"qwq/internal/logger"
+
+	"github.com/docker/docker/api/types"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// dockerMinBackoff Docker 守护进程不可用时首次重试的等待时间，之后每次翻倍
+	dockerMinBackoff = time.Second
+	// dockerMaxBackoff 重试等待时间上限
+	dockerMaxBackoff = 30 * time.Second
+	// dockerActor Docker 事件的操作者
+	dockerActor = "dockerd"
+)
+
+// dockerActions 记录到时间线的 Docker 事件，其余事件（exec、attach、top 等）过于频繁，不记录
+var dockerActions = map[dockerevents.Type]map[dockerevents.Action]bool{
+	dockerevents.ContainerEventType: {
+		dockerevents.ActionCreate: true, dockerevents.ActionStart: true, dockerevents.ActionRestart: true,
+		dockerevents.ActionStop: true, dockerevents.ActionKill: true, dockerevents.ActionDie: true,
+		dockerevents.ActionOOM: true, dockerevents.ActionDestroy: true, dockerevents.ActionPause: true,
+		dockerevents.ActionUnPause: true, dockerevents.ActionHealthStatusUnhealthy: true,
+	},
+	dockerevents.ImageEventType: {
+		dockerevents.ActionPull: true, dockerevents.ActionDelete: true, dockerevents.ActionTag: true,
+		dockerevents.ActionUnTag: true, dockerevents.ActionLoad: true, dockerevents.ActionImport: true,
+	},
+	dockerevents.NetworkEventType: {
+		dockerevents.ActionCreate: true, dockerevents.ActionDestroy: true,
+		dockerevents.ActionConnect: true, dockerevents.ActionDisconnect: true,
+	},
+	dockerevents.VolumeEventType: {
+		dockerevents.ActionCreate: true, dockerevents.ActionDestroy: true,
+	},
+	dockerevents.DaemonEventType: {
+		dockerevents.ActionReload: true,
+	},
+}
+
+// dockerEventsClient 事件收集用到的 Docker SDK 方法子集，便于在测试中替换
+type dockerEventsClient interface {
+	Ping(ctx context.Context) (types.Ping, error)
+	Events(ctx context.Context, options dockerevents.ListOptions) (<-chan dockerevents.Message, <-chan error)
+}
+
+// DockerCollector 订阅 Docker 事件写入时间线
+// 连接断开（如 Docker 守护进程重启）后等待守护进程恢复并从最后收到的事件时间重新订阅，
+// 重新订阅时重复收到的事件按去重键忽略
+type DockerCollector struct {
+	client dockerEventsClient
+	store  *Store
+	since  time.Time // 最后收到的事件时间
+	sleep  func(ctx context.Context, d time.Duration) bool
+}
+
+// NewDockerCollector 创建 Docker 事件收集器，连接参数来自 DOCKER_HOST 等环境变量
+func NewDockerCollector(store *Store) (*DockerCollector, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	return newDockerCollector(cli, store), nil
+}
+
+func newDockerCollector(cli dockerEventsClient, store *Store) *DockerCollector {
+	return &DockerCollector{client: cli, store: store, sleep: sleepContext}
+}
+
+// Run 持续收集 Docker 事件直到 ctx 取消
+// 首次订阅从时间线中最后一个 Docker 事件开始（不早于保留时间），补上 qwq 未运行期间的事件
+func (c *DockerCollector) Run(ctx context.Context) {
+	if latest, err := c.store.Latest(ctx, SourceDocker); err == nil && latest.After(c.store.now().Add(-c.store.retention)) {
+		c.since = latest
+	}
+	backoff := dockerMinBackoff
+	connected := true
+	for ctx.Err() == nil {
+		if _, err := c.client.Ping(ctx); err != nil {
+			if connected {
+				logger.Info("⚠️ Docker 守护进程不可用，等待恢复后重新订阅事件: %v", err)
+				connected = false
+			}
+			if !c.sleep(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, dockerMaxBackoff)
+			continue
+		}
+		if !connected {
+			c.record(ctx, Event{Source: SourceQwq, Type: TypeDaemon, Action: "reconnected",
+				Actor: "qwq", Target: dockerActor, Message: "Docker 守护进程已恢复，重新订阅事件"})
+			connected = true
+		}
+		backoff = dockerMinBackoff
+
+		err := c.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Info("⚠️ Docker 事件订阅中断: %v", err)
+		c.record(ctx, Event{Source: SourceQwq, Type: TypeDaemon, Action: "disconnected",
+			Actor: "qwq", Target: dockerActor, Message: fmt.Sprintf("Docker 事件订阅中断: %v", err)})
+		connected = false
+		if !c.sleep(ctx, backoff) {
+			return
+		}
+	}
+}
+
+// subscribe 订阅一次 Docker 事件，返回订阅中断的原因
+func (c *DockerCollector) subscribe(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := filters.NewArgs()
+	for eventType := range dockerActions {
+		args.Add("type", string(eventType))
+	}
+	options := dockerevents.ListOptions{Filters: args}
+	if !c.since.IsZero() {
+		// Docker 返回时间不早于 since 的事件，同一时刻的事件会再次收到，由去重键忽略
+		options.Since = fmt.Sprintf("%d.%09d", c.since.Unix(), c.since.Nanosecond())
+	}
+	messages, errs := c.client.Events(ctx, options)
+	for {
+		select {
+		case msg := <-messages:
+			event, ok := dockerEvent(msg)
+			if !ok {
+				continue
+			}
+			c.record(ctx, event)
+			if event.Time.After(c.since) {
+				c.since = event.Time
+			}
+		case err := <-errs:
+			if err == nil {
+				err = fmt.Errorf("event stream closed")
+			}
+			return err
+		}
+	}
+}
+
+func (c *DockerCollector) record(ctx context.Context, event Event) {
+	if _, err := c.store.Record(ctx, event); err != nil && ctx.Err() == nil {
+		logger.Info("⚠️ 记录 Docker 事件失败: %v", err)
+	}
+}
+
+// dockerEvent 把 Docker 事件转换为时间线事件，不需要记录的事件返回 false
+func dockerEvent(msg dockerevents.Message) (Event, bool) {
+	if !dockerActions[msg.Type][msg.Action] {
+		return Event{}, false
+	}
+	at := time.Unix(0, msg.TimeNano)
+	if msg.TimeNano == 0 {
+		at = time.Unix(msg.Time, 0)
+	}
+	target := msg.Actor.Attributes["name"]
+	if target == "" {
+		target = msg.Actor.ID
+	}
+	action := string(msg.Action)
+	if strings.HasPrefix(action, string(dockerevents.ActionHealthStatus)) {
+		action = "unhealthy"
+	}
+	message := fmt.Sprintf("%s %s %s", msg.Type, target, action)
+	switch {
+	case msg.Type == dockerevents.ContainerEventType && msg.Action == dockerevents.ActionDie:
+		message += fmt.Sprintf(" (exit code %s)", msg.Actor.Attributes["exitCode"])
+	case msg.Type == dockerevents.ContainerEventType && msg.Action == dockerevents.ActionOOM:
+		message = fmt.Sprintf("container %s was killed by the OOM killer", target)
+	case msg.Type == dockerevents.NetworkEventType && msg.Actor.Attributes["container"] != "":
+		message += " " + shortID(msg.Actor.Attributes["container"])
+	}
+	if image := msg.Actor.Attributes["image"]; image != "" && msg.Type == dockerevents.ContainerEventType {
+		message += " [" + image + "]"
+	}
+	return Event{
+		Time:    at,
+		Source:  SourceDocker,
+		Type:    string(msg.Type),
+		Action:  action,
+		Actor:   dockerActor,
+		Target:  target,
+		Message: message,
+		// 同一对象同一时刻的同一动作只记录一次；网络事件还要区分连接的容器
+		DedupKey: fmt.Sprintf("docker:%s:%s:%s:%s:%d", msg.Type, msg.Actor.ID, msg.Action, shortID(msg.Actor.Attributes["container"]), at.UnixNano()),
+	}, true
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
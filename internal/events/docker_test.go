@@ -0,0 +1,115 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	dockerevents "github.com/docker/docker/api/types/events"
+)
+
+// fakeDocker 模拟守护进程：每次订阅按顺序返回一组事件，发送完后返回错误（守护进程重启）
+type fakeDocker struct {
+	mu       sync.Mutex
+	streams  [][]dockerevents.Message
+	since    []string
+	pingErrs []error
+	done     func()
+}
+
+func (f *fakeDocker) Ping(ctx context.Context) (types.Ping, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pingErrs) > 0 {
+		err := f.pingErrs[0]
+		f.pingErrs = f.pingErrs[1:]
+		return types.Ping{}, err
+	}
+	return types.Ping{}, nil
+}
+
+func (f *fakeDocker) Events(ctx context.Context, options dockerevents.ListOptions) (<-chan dockerevents.Message, <-chan error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.since = append(f.since, options.Since)
+	messages := make(chan dockerevents.Message)
+	errs := make(chan error, 1)
+	if len(f.streams) == 0 {
+		f.done()
+		go func() {
+			<-ctx.Done()
+			errs <- ctx.Err()
+		}()
+		return messages, errs
+	}
+	stream := f.streams[0]
+	f.streams = f.streams[1:]
+	go func() {
+		for _, msg := range stream {
+			messages <- msg
+		}
+		errs <- errors.New("unexpected EOF")
+	}()
+	return messages, errs
+}
+
+func dockerMessage(action dockerevents.Action, name string, at time.Time) dockerevents.Message {
+	return dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: action,
+		Actor: dockerevents.Actor{
+			ID:         "c0ffee" + name,
+			Attributes: map[string]string{"name": name, "image": "postgres:16", "exitCode": "137"},
+		},
+		Time:     at.Unix(),
+		TimeNano: at.UnixNano(),
+	}
+}
+
+func TestDockerCollector_ResubscribesWithoutDuplicates(t *testing.T) {
+	store := newTestStore(t)
+	base := time.Now().Add(-time.Minute).Truncate(time.Second)
+	restart := dockerMessage(dockerevents.ActionRestart, "db", base.Add(2*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &fakeDocker{
+		streams: [][]dockerevents.Message{
+			{
+				dockerMessage(dockerevents.ActionStart, "db", base),
+				dockerMessage(dockerevents.ActionExecCreate, "db", base.Add(time.Second)), // 不记录
+				restart,
+			},
+			// 守护进程重启后从最后一个事件的时间重新订阅，该事件会再次收到
+			{restart, dockerMessage(dockerevents.ActionDie, "db", base.Add(3*time.Second))},
+		},
+		pingErrs: []error{nil, errors.New("connection refused")},
+		done:     cancel,
+	}
+	collector := newDockerCollector(fake, store)
+	collector.sleep = func(ctx context.Context, d time.Duration) bool { return ctx.Err() == nil }
+	collector.Run(ctx)
+
+	if len(fake.since) != 3 || fake.since[0] != "" {
+		t.Fatalf("Expected a fresh subscription followed by two resubscriptions, got %q", fake.since)
+	}
+	if want := fmt.Sprintf("%d.000000000", restart.Time); fake.since[1] != want {
+		t.Errorf("Expected the resubscription to resume from the last event, got %q want %q", fake.since[1], want)
+	}
+
+	list, _ := store.Query(context.Background(), Query{Types: []string{TypeContainer}})
+	if len(list) != 3 {
+		t.Fatalf("Expected start, restart and die once each, got %+v", list)
+	}
+	if list[2].Action != "die" || list[2].Target != "db" || list[2].Message != "container db die (exit code 137) [postgres:16]" {
+		t.Errorf("Unexpected die event %+v", list[2])
+	}
+	daemon, _ := store.Query(context.Background(), Query{Types: []string{TypeDaemon}})
+	if len(daemon) != 4 || daemon[0].Action != "disconnected" || daemon[1].Action != "reconnected" {
+		t.Errorf("Expected the daemon restart on the timeline, got %+v", daemon)
+	}
+}
@@ -0,0 +1,261 @@
+// Package events 把 Docker 守护进程的事件（容器启停、OOM、镜像拉取、网络和卷变化）和 qwq 自身的重要操作
+// （巡检异常、部署、自愈重启、配置变更）统一记录到一条时间线上，供控制台展示和事件复盘包引用
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qwq/internal/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 事件来源
+const (
+	SourceDocker = "docker"
+	SourceQwq    = "qwq"
+)
+
+// 事件类型，Docker 事件沿用 Docker 的对象类型
+const (
+	TypeContainer  = "container"
+	TypeImage      = "image"
+	TypeNetwork    = "network"
+	TypeVolume     = "volume"
+	TypeDaemon     = "daemon"     // Docker 守护进程连接断开、恢复
+	TypeAnomaly    = "anomaly"    // 巡检发现的异常
+	TypeDeployment = "deployment" // 部署开始、完成、失败、回滚
+	TypeHealing    = "healing"    // 自愈重启
+	TypeConfig     = "config"     // 运行时配置变更
+)
+
+const (
+	// DefaultRetention 事件默认保留时间
+	DefaultRetention = 7 * 24 * time.Hour
+	// DefaultPruneInterval 清理过期事件的间隔
+	DefaultPruneInterval = time.Hour
+	// DefaultQueryLimit 查询默认返回的事件数
+	DefaultQueryLimit = 500
+	// MaxQueryLimit 单次查询最多返回的事件数
+	MaxQueryLimit = 5000
+	// subscriberBuffer 每个订阅者缓冲的事件数，消费过慢时丢弃新事件，不阻塞记录
+	subscriberBuffer = 64
+)
+
+// ErrInvalidQuery 查询的时间范围无效
+var ErrInvalidQuery = errors.New("invalid event query")
+
+// Event 时间线上的一个事件
+type Event struct {
+	ID      uint      `json:"id" gorm:"primaryKey"`
+	Time    time.Time `json:"time" gorm:"index;not null"`
+	Source  string    `json:"source" gorm:"size:16;not null"`
+	Type    string    `json:"type" gorm:"size:32;index;not null"`
+	Action  string    `json:"action" gorm:"size:64"`
+	Actor   string    `json:"actor"`  // 操作者：用户、巡检、自愈或 Docker 守护进程
+	Target  string    `json:"target"` // 操作对象：容器名、镜像、部署、配置项等
+	Message string    `json:"message" gorm:"type:text"`
+	// DedupKey 去重键，重新订阅 Docker 事件时重复收到的事件被忽略
+	DedupKey string `json:"-" gorm:"size:191;uniqueIndex;not null"`
+}
+
+func (Event) TableName() string { return "timeline_events" }
+
+// Query 事件查询条件，From/To 为空时不限制，Types 为空时返回所有类型
+type Query struct {
+	From  time.Time
+	To    time.Time
+	Types []string
+	Limit int
+}
+
+// Matches 事件是否符合查询条件（忽略 Limit），用于过滤实时推送
+func (q Query) Matches(event Event) bool {
+	if !q.From.IsZero() && event.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && event.Time.After(q.To) {
+		return false
+	}
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Store 事件时间线存储，记录的事件同时推送给实时订阅者
+type Store struct {
+	db        *gorm.DB
+	retention time.Duration
+	now       func() time.Time
+	seq       atomic.Uint64
+
+	mu      sync.Mutex
+	subs    map[int]chan Event
+	nextSub int
+}
+
+// NewStore 创建事件存储，retention <= 0 时使用 DefaultRetention
+func NewStore(db *gorm.DB, retention time.Duration) *Store {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Store{db: db, retention: retention, now: time.Now, subs: make(map[int]chan Event)}
+}
+
+// Retention 事件保留时间
+func (s *Store) Retention() time.Duration {
+	return s.retention
+}
+
+// Record 记录事件，返回是否为新事件；去重键已存在时不记录也不推送
+// 未设置时间、来源和去重键时分别使用当前时间、qwq 和自动生成的唯一键
+func (s *Store) Record(ctx context.Context, event Event) (bool, error) {
+	if event.Time.IsZero() {
+		event.Time = s.now()
+	}
+	if event.Source == "" {
+		event.Source = SourceQwq
+	}
+	if event.DedupKey == "" {
+		event.DedupKey = fmt.Sprintf("%s:%d:%d", event.Source, event.Time.UnixNano(), s.seq.Add(1))
+	}
+	event.ID = 0
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "dedup_key"}}, DoNothing: true}).Create(&event)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record event: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	s.publish(event)
+	return true, nil
+}
+
+// Query 按时间顺序返回符合条件的事件，超过 Limit 时返回最近的 Limit 个
+func (s *Store) Query(ctx context.Context, q Query) ([]Event, error) {
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return nil, fmt.Errorf("%w: to is before from", ErrInvalidQuery)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+	tx := s.db.WithContext(ctx).Model(&Event{})
+	if !q.From.IsZero() {
+		tx = tx.Where("time >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("time <= ?", q.To)
+	}
+	if len(q.Types) > 0 {
+		tx = tx.Where("type IN ?", q.Types)
+	}
+	var list []Event
+	if err := tx.Order("time DESC").Order("id DESC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return list, nil
+}
+
+// Latest 某个来源最近一个事件的时间，没有事件时为零值；Docker 事件订阅据此从上次的位置继续
+func (s *Store) Latest(ctx context.Context, source string) (time.Time, error) {
+	var event Event
+	err := s.db.WithContext(ctx).Where("source = ?", source).Order("time DESC").Limit(1).Find(&event).Error
+	return event.Time, err
+}
+
+// Prune 删除超过保留时间的事件，返回删除的数量
+func (s *Store) Prune(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Where("time < ?", s.now().Add(-s.retention)).Delete(&Event{})
+	return result.RowsAffected, result.Error
+}
+
+// Subscribe 订阅新记录的事件，返回的函数取消订阅并关闭通道
+func (s *Store) Subscribe() (<-chan Event, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextSub
+	s.nextSub++
+	ch := make(chan Event, subscriberBuffer)
+	s.subs[id] = ch
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subs[id]; ok {
+			delete(s.subs, id)
+			close(ch)
+		}
+	}
+}
+
+func (s *Store) publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// ParseTypes 解析逗号分隔的事件类型
+func ParseTypes(value string) []string {
+	var types []string
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+var (
+	defaultStore   *Store
+	defaultStoreMu sync.RWMutex
+)
+
+// SetDefault 设置全局事件存储，巡检、部署、自愈和配置变更通过它记录事件
+func SetDefault(store *Store) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+	defaultStore = store
+}
+
+// Default 返回全局事件存储，未启用时为 nil
+func Default() *Store {
+	defaultStoreMu.RLock()
+	defer defaultStoreMu.RUnlock()
+	return defaultStore
+}
+
+// Emit 向全局事件存储记录一个 qwq 事件，未启用时忽略；记录失败只写日志，不影响调用方
+func Emit(eventType, action, actor, target, message string) {
+	store := Default()
+	if store == nil {
+		return
+	}
+	event := Event{Source: SourceQwq, Type: eventType, Action: action, Actor: actor, Target: target, Message: message}
+	if _, err := store.Record(context.Background(), event); err != nil {
+		logger.Info("⚠️ 记录事件失败: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Event{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(db, 24*time.Hour)
+}
+
+func TestStore_RecordDeduplicates(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	updates, cancel := store.Subscribe()
+	defer cancel()
+
+	event := Event{Time: time.Now(), Source: SourceDocker, Type: TypeContainer, Action: "start", Target: "db", DedupKey: "docker:container:abc:start::1"}
+	if added, err := store.Record(ctx, event); err != nil || !added {
+		t.Fatalf("Expected the event to be recorded, got %v %v", added, err)
+	}
+	if added, err := store.Record(ctx, event); err != nil || added {
+		t.Fatalf("Expected the duplicate to be ignored, got %v %v", added, err)
+	}
+	// 没有去重键的 qwq 事件每次都记录
+	for i := 0; i < 2; i++ {
+		if _, err := store.Record(ctx, Event{Type: TypeConfig, Action: "updated", Target: "patrol_rules"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := store.Query(ctx, Query{})
+	if err != nil || len(list) != 3 {
+		t.Fatalf("Expected 3 events, got %d: %v", len(list), err)
+	}
+	if list[1].Source != SourceQwq || list[1].Time.IsZero() {
+		t.Errorf("Expected defaults for qwq events, got %+v", list[1])
+	}
+	if len(updates) != 3 {
+		t.Errorf("Expected subscribers to receive only new events, got %d", len(updates))
+	}
+}
+
+func TestStore_Query(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 14, 30, 0, 0, time.UTC)
+	for i, eventType := range []string{TypeContainer, TypeDeployment, TypeContainer, TypeAnomaly, TypeContainer} {
+		store.Record(ctx, Event{Time: base.Add(time.Duration(i) * time.Minute), Type: eventType, Target: "app"})
+	}
+
+	list, _ := store.Query(ctx, Query{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)})
+	if len(list) != 3 || !list[0].Time.Equal(base.Add(time.Minute)) || list[2].Type != TypeAnomaly {
+		t.Errorf("Expected the 3 events in the window in time order, got %+v", list)
+	}
+	list, _ = store.Query(ctx, Query{Types: ParseTypes("container, anomaly")})
+	if len(list) != 4 {
+		t.Errorf("Expected 4 container and anomaly events, got %d", len(list))
+	}
+	// 超过 Limit 时返回最近的事件
+	list, _ = store.Query(ctx, Query{Limit: 2})
+	if len(list) != 2 || !list[1].Time.Equal(base.Add(4*time.Minute)) {
+		t.Errorf("Expected the 2 latest events, got %+v", list)
+	}
+	if _, err := store.Query(ctx, Query{From: base, To: base.Add(-time.Hour)}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+	if !(Query{Types: []string{TypeContainer}}).Matches(Event{Type: TypeContainer}) || (Query{From: base}).Matches(Event{Time: base.Add(-time.Second)}) {
+		t.Error("Matches disagrees with Query")
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	store.Record(ctx, Event{Time: now.Add(-25 * time.Hour), Type: TypeContainer})
+	store.Record(ctx, Event{Time: now.Add(-time.Hour), Type: TypeContainer})
+
+	if n, err := store.Prune(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected one expired event to be pruned, got %d %v", n, err)
+	}
+	if list, _ := store.Query(ctx, Query{}); len(list) != 1 {
+		t.Errorf("Expected the recent event to be kept, got %d", len(list))
+	}
+}
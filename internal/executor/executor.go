@@ -1,33 +1,43 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"os/signal"
 	"qwq/internal/agent"
 	"qwq/internal/logger"
+	"qwq/internal/security"
+	"qwq/internal/utils"
 
 	"github.com/charmbracelet/glamour"
 )
 
+// SmartRun 按自动执行策略检查并确认后执行命令，失败时请求 AI 分析原因
 func SmartRun(cmdStr string) {
+	if !approve(cmdStr) {
+		fmt.Println("已取消")
+		return
+	}
 	fmt.Printf("🚀 执行命令: %s\n", cmdStr)
 	
-	cmd := exec.Command("bash", "-c", cmdStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	err := cmd.Run()
-	
-	if err == nil {
+	// 输出实时显示在终端并同时采集，失败后直接分析采集到的输出，不再重新执行一遍命令
+	// 用户在终端中执行的命令不限制时间；命令运行在独立的进程组中，Ctrl-C 时终止整个进程组
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	res := utils.RunShellWith(ctx, cmdStr, utils.ShellOptions{Timeout: -1, Stdout: os.Stdout, Stderr: os.Stderr})
+	stop()
+
+	if res.OK() {
 		logger.Info("✅ 命令执行成功")
 		return
 	}
+	if res.Cancelled {
+		fmt.Println("\n已中断")
+		return
+	}
 
 	fmt.Println("\n❌ 命令执行失败，正在请求 AI 分析原因...")
-	
-	out, _ := exec.Command("bash", "-c", cmdStr).CombinedOutput()
-	errorLog := string(out)
+	errorLog := res.Combined()
 
 	prompt := fmt.Sprintf(`我执行了命令 "%s" 失败了。
 报错信息如下：
@@ -43,4 +53,20 @@ func SmartRun(cmdStr string) {
 	r, _ := glamour.NewTermRenderer(glamour.WithAutoStyle(), glamour.WithWordWrap(100))
 	rendered, _ := r.Render(suggestion)
 	fmt.Println(rendered)
-}
\ No newline at end of file
+}
+
+// approve 与 AI 对话使用同一份自动执行策略：规则拒绝的命令不执行，规则要求确认的命令即使风险较低也需要确认，
+// 其余按风险等级确认；毁灭性操作仍可在终端中输入验证码后执行
+func approve(cmdStr string) bool {
+	decision := security.EvaluateAutoExec(cmdStr)
+	logger.Info("[AUDIT] ⚙️ 自动执行策略: %q -> %s (规则: %s)", cmdStr, decision.Action, decision.Rule)
+	switch {
+	case decision.Action == security.ActionDeny && decision.Rule != security.RuleSecurity:
+		fmt.Printf("❌ [拦截] 策略禁止执行（%s）\n", decision.Describe())
+		return false
+	case decision.Action == security.ActionConfirm && security.CheckRisk(cmdStr) == security.RiskLow:
+		fmt.Printf("\n\033[33m⚠️  [需要确认] %s（%s）\033[0m\n", cmdStr, decision.Describe())
+		return utils.Confirm("确认执行? (y/N): ", utils.ConfirmYes)
+	}
+	return utils.ConfirmExecution(cmdStr)
+}
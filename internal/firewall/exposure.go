@@ -0,0 +1,151 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// 监听来源
+const (
+	KindContainer = "container" // 容器发布的端口
+	KindWebsite   = "website"   // 网站监听端口
+)
+
+// dockerUserChain Docker 为用户规则预留的链，发布端口的流量经 FORWARD 转发，不经过 INPUT
+const dockerUserChain = "DOCKER-USER"
+
+// Listener 主机上对外监听的端口
+type Listener struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`    // 容器名称或网站域名
+	Address string `json:"address"` // 监听地址，空、0.0.0.0 或 :: 表示所有网卡
+	Port    int    `json:"port"`
+	Proto   string `json:"proto"`
+	// TargetPort 容器端口，DOCKER-USER 链中 --dport 匹配的是 DNAT 之后的容器端口
+	TargetPort int  `json:"target_port,omitempty"`
+	Public     bool `json:"public"` // 有意对外开放（网站端口或配置的 public_ports），不告警
+}
+
+// Exposure 单个监听端口的暴露情况
+type Exposure struct {
+	Listener
+	Exposed bool   `json:"exposed"` // 可被任意来源访问
+	Warn    bool   `json:"warn"`    // 暴露且不是有意开放的端口
+	Reason  string `json:"reason"`
+}
+
+// Report 暴露面报告
+type Report struct {
+	Backends          []string   `json:"backends"`
+	InputPolicy       string     `json:"input_policy"`
+	Exposures         []Exposure `json:"exposures"`
+	Errors            []string   `json:"errors,omitempty"`
+	ManagementEnabled bool       `json:"management_enabled"`
+	CheckedAt         time.Time  `json:"checked_at"`
+}
+
+// Warnings 需要告警的暴露端口
+func (r *Report) Warnings() []Exposure {
+	var warnings []Exposure
+	for _, exposure := range r.Exposures {
+		if exposure.Warn {
+			warnings = append(warnings, exposure)
+		}
+	}
+	return warnings
+}
+
+// AllInterfaces 监听地址是否为所有网卡
+func AllInterfaces(address string) bool {
+	if address == "" || address == "*" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// Analyze 将监听端口与防火墙规则交叉比对
+// 容器端口的流量经 DOCKER-USER 链转发，INPUT 默认策略和 ufw 规则对其无效，只有 DOCKER-USER 或 qwq 专用链中的规则生效；
+// 主机端口以 INPUT 默认策略和其余链中的规则判断。存在对所有来源放行的规则，或没有任何拒绝规则时视为暴露
+func Analyze(state *State, listeners []Listener, managedChain string) *Report {
+	report := &Report{
+		Backends:    state.Backends,
+		InputPolicy: state.InputPolicy,
+		Exposures:   make([]Exposure, 0, len(listeners)),
+		Errors:      state.Errors,
+		CheckedAt:   time.Now(),
+	}
+	for _, listener := range listeners {
+		exposure := Exposure{Listener: listener}
+		exposure.Exposed, exposure.Reason = evaluate(state, listener, managedChain)
+		exposure.Warn = exposure.Exposed && !listener.Public
+		report.Exposures = append(report.Exposures, exposure)
+	}
+	sort.SliceStable(report.Exposures, func(i, j int) bool {
+		a, b := report.Exposures[i], report.Exposures[j]
+		if a.Warn != b.Warn {
+			return a.Warn
+		}
+		return a.Port < b.Port
+	})
+	return report
+}
+
+func evaluate(state *State, listener Listener, managedChain string) (bool, string) {
+	if !AllInterfaces(listener.Address) {
+		return false, fmt.Sprintf("仅监听 %s", listener.Address)
+	}
+
+	var openAccept, restriction *Rule
+	for i := range state.Rules {
+		rule := &state.Rules[i]
+		if !appliesTo(rule, listener, managedChain) {
+			continue
+		}
+		if !rule.matchesPort(listener.Port, listener.Proto) &&
+			!(listener.TargetPort != 0 && rule.matchesPort(listener.TargetPort, listener.Proto)) {
+			continue
+		}
+		switch {
+		case rule.Action == ActionAccept && rule.Source == AnySource && rule.Port != 0:
+			// 不限端口的放行规则通常针对内网网卡（如 -i eth1 -j ACCEPT），不作为暴露依据
+			if openAccept == nil {
+				openAccept = rule
+			}
+		case rule.Action == ActionDrop && rule.Source == AnySource:
+			if restriction == nil {
+				restriction = rule
+			}
+		}
+	}
+
+	switch {
+	case openAccept != nil:
+		return true, fmt.Sprintf("%s 链中存在对所有来源放行 %d/%s 的规则", openAccept.Chain, listener.Port, listener.Proto)
+	case restriction != nil:
+		return false, fmt.Sprintf("%s 链中的规则限制了访问来源", restriction.Chain)
+	case listener.Kind != KindContainer && state.InputPolicy == ActionDrop:
+		return false, "入站默认策略为拒绝，且没有对所有来源放行的规则"
+	case listener.Kind == KindContainer:
+		return true, "Docker 发布端口绕过 INPUT 链和 ufw，DOCKER-USER 链中没有限制来源的规则"
+	default:
+		return true, "监听所有网卡，且没有限制来源的防火墙规则"
+	}
+}
+
+// appliesTo 规则所在的链是否作用于该监听端口的流量
+func appliesTo(rule *Rule, listener Listener, managedChain string) bool {
+	if rule.Chain == managedChain {
+		return true
+	}
+	if listener.Kind == KindContainer {
+		return rule.Chain == dockerUserChain
+	}
+	switch rule.Chain {
+	case dockerUserChain, "FORWARD", "OUTPUT", "forward", "output":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,356 @@
+// Package firewall 读取主机防火墙状态，分析已发布端口的暴露面，并管理 qwq 专用链中的放行规则
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// 防火墙后端
+const (
+	BackendIPTables = "iptables"
+	BackendNFT      = "nftables"
+	BackendUFW      = "ufw"
+)
+
+// 规则动作
+const (
+	ActionAccept = "accept"
+	ActionDrop   = "drop" // 包含 REJECT
+)
+
+// AnySource 不限制来源
+const AnySource = ""
+
+// ErrNoBackend 没有可读取的防火墙后端
+var ErrNoBackend = errors.New("no readable firewall backend (iptables/nft/ufw)")
+
+// Rule 防火墙规则中与端口暴露相关的部分
+type Rule struct {
+	Backend string `json:"backend"`
+	Chain   string `json:"chain"`
+	Proto   string `json:"proto,omitempty"`    // 为空表示所有协议
+	Port    int    `json:"port,omitempty"`     // 为 0 表示所有端口
+	PortEnd int    `json:"port_end,omitempty"` // 端口范围的结束端口，单个端口时为 0
+	Source  string `json:"source,omitempty"`   // 来源地址，为空表示不限制来源
+	Action  string `json:"action"`
+}
+
+// matchesPort 规则是否覆盖指定端口和协议
+func (r Rule) matchesPort(port int, proto string) bool {
+	if r.Proto != "" && r.Proto != proto {
+		return false
+	}
+	if r.Port == 0 {
+		return true
+	}
+	if r.PortEnd == 0 {
+		return r.Port == port
+	}
+	return port >= r.Port && port <= r.PortEnd
+}
+
+// State 主机防火墙状态
+type State struct {
+	Backends    []string `json:"backends"`     // 读取成功的后端
+	InputPolicy string   `json:"input_policy"` // 入站默认策略：accept 或 drop
+	Rules       []Rule   `json:"rules"`
+	Errors      []string `json:"errors,omitempty"` // 读取失败的后端及原因
+}
+
+// Runner 执行命令，stdin 非空时作为标准输入
+type Runner func(ctx context.Context, stdin string, name string, args ...string) (string, error)
+
+// ExecRunner 直接执行命令，不经过 shell，参数中的 CIDR 等用户输入不会被解释
+func ExecRunner(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// ReadState 依次读取 iptables、nftables 和 ufw 的状态
+// 未安装或无权限读取的后端记录在 Errors 中；全部失败时返回 ErrNoBackend
+func ReadState(ctx context.Context, run Runner) (*State, error) {
+	state := &State{InputPolicy: ActionAccept}
+	readers := []struct {
+		backend string
+		name    string
+		args    []string
+		parse   func(string) (string, []Rule)
+	}{
+		{BackendIPTables, "iptables-save", []string{"-t", "filter"}, ParseIPTablesSave},
+		{BackendNFT, "nft", []string{"list", "ruleset"}, ParseNFT},
+		{BackendUFW, "ufw", []string{"status", "verbose"}, ParseUFW},
+	}
+	for _, reader := range readers {
+		out, err := run(ctx, "", reader.name, reader.args...)
+		if err != nil {
+			state.Errors = append(state.Errors, fmt.Sprintf("%s: %v", reader.backend, err))
+			continue
+		}
+		policy, rules := reader.parse(out)
+		if policy == "" && len(rules) == 0 {
+			// 后端可用但未启用（如 ufw inactive、没有 nft 规则）
+			continue
+		}
+		state.Backends = append(state.Backends, reader.backend)
+		if policy == ActionDrop {
+			state.InputPolicy = ActionDrop
+		}
+		state.Rules = append(state.Rules, rules...)
+	}
+	if len(state.Backends) == 0 && len(state.Errors) == len(readers) {
+		return state, ErrNoBackend
+	}
+	return state, nil
+}
+
+// isLocalInterface 只匹配本地回环或 Docker 网桥的规则与外部暴露无关
+func isLocalInterface(iface string) bool {
+	iface = strings.Trim(iface, `"`)
+	return iface == "lo" || iface == "docker0" || strings.HasPrefix(iface, "br-")
+}
+
+// normalizeSource 将不限制来源的写法统一为 AnySource
+func normalizeSource(source string) string {
+	switch source {
+	case "0.0.0.0/0", "::/0", "Anywhere", "Anywhere (v6)":
+		return AnySource
+	}
+	return source
+}
+
+// parsePorts 解析 "5432"、"8000:8100"、"8000-8100"、"80,443" 形式的端口
+func parsePorts(spec string) [][2]int {
+	var result [][2]int
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		start, end, isRange := strings.Cut(item, ":")
+		if !isRange {
+			start, end, isRange = strings.Cut(item, "-")
+		}
+		from, err := strconv.Atoi(strings.TrimSpace(start))
+		if err != nil {
+			continue
+		}
+		to := 0
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(end)); err != nil {
+				continue
+			}
+		}
+		result = append(result, [2]int{from, to})
+	}
+	return result
+}
+
+// expandPorts 按端口列表展开规则，没有端口时保留一条覆盖所有端口的规则
+func expandPorts(rule Rule, ports [][2]int) []Rule {
+	if len(ports) == 0 {
+		return []Rule{rule}
+	}
+	rules := make([]Rule, 0, len(ports))
+	for _, port := range ports {
+		rule.Port, rule.PortEnd = port[0], port[1]
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ParseIPTablesSave 解析 iptables-save 输出的 filter 表，返回 INPUT 默认策略和规则
+// 连接状态、回环和 Docker 网桥相关的规则不影响外部暴露，直接跳过
+func ParseIPTablesSave(out string) (string, []Rule) {
+	policy := ""
+	var rules []Rule
+	inFilter := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "*"):
+			inFilter = line == "*filter"
+			continue
+		case !inFilter:
+			continue
+		case strings.HasPrefix(line, ":INPUT "):
+			if fields := strings.Fields(line); len(fields) > 1 && fields[1] == "DROP" {
+				policy = ActionDrop
+			} else if policy == "" {
+				policy = ActionAccept
+			}
+			continue
+		case !strings.HasPrefix(line, "-A "):
+			continue
+		}
+
+		fields := strings.Fields(line)
+		rule := Rule{Backend: BackendIPTables, Chain: fields[1]}
+		var ports [][2]int
+		skip := false
+		for i := 2; i < len(fields); i++ {
+			next := ""
+			if i+1 < len(fields) {
+				next = fields[i+1]
+			}
+			switch fields[i] {
+			case "-p":
+				rule.Proto = next
+			case "-s":
+				rule.Source = normalizeSource(next)
+			case "-i":
+				// "! -i docker0" 表示来自外部网卡的流量
+				skip = skip || (fields[i-1] != "!" && isLocalInterface(next))
+			case "--dport", "--dports", "--ctorigdstport":
+				ports = parsePorts(next)
+			case "--ctstate", "--state":
+				skip = true
+			case "-j":
+				switch next {
+				case "ACCEPT":
+					rule.Action = ActionAccept
+				case "DROP", "REJECT":
+					rule.Action = ActionDrop
+				}
+			}
+		}
+		if skip || rule.Action == "" {
+			continue
+		}
+		rules = append(rules, expandPorts(rule, ports)...)
+	}
+	return policy, rules
+}
+
+// ParseNFT 解析 nft list ruleset 输出，返回 input 钩子链的默认策略和规则
+// 只识别常见的 "tcp dport 5432 ip saddr 10.0.0.0/8 accept" 形式
+func ParseNFT(out string) (string, []Rule) {
+	policy := ""
+	var rules []Rule
+	chain := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "chain ") {
+			chain = strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(line, "chain ")), " {")
+			continue
+		}
+		if strings.Contains(line, "hook input") {
+			if strings.Contains(line, "policy drop") {
+				policy = ActionDrop
+			} else if policy == "" {
+				policy = ActionAccept
+			}
+			continue
+		}
+		if chain == "" || strings.Contains(line, "ct state") || strings.HasPrefix(line, "type ") {
+			continue
+		}
+
+		fields := strings.Fields(strings.NewReplacer("{", " { ", "}", " } ").Replace(line))
+		rule := Rule{Backend: BackendNFT, Chain: chain}
+		var ports [][2]int
+		skip := false
+		for i := 0; i < len(fields); i++ {
+			next := ""
+			if i+1 < len(fields) {
+				next = fields[i+1]
+			}
+			switch fields[i] {
+			case "tcp", "udp":
+				if next == "dport" && i+2 < len(fields) {
+					rule.Proto = fields[i]
+					spec := fields[i+2]
+					if spec == "{" {
+						var items []string
+						for j := i + 3; j < len(fields) && fields[j] != "}"; j++ {
+							items = append(items, strings.TrimSuffix(fields[j], ","))
+						}
+						spec = strings.Join(items, ",")
+					}
+					ports = parsePorts(spec)
+				}
+			case "saddr":
+				rule.Source = normalizeSource(next)
+			case "iifname", "iif":
+				skip = skip || isLocalInterface(next)
+			case "accept":
+				rule.Action = ActionAccept
+			case "drop", "reject":
+				rule.Action = ActionDrop
+			}
+		}
+		if skip || rule.Action == "" {
+			continue
+		}
+		rules = append(rules, expandPorts(rule, ports)...)
+	}
+	return policy, rules
+}
+
+// ParseUFW 解析 ufw status verbose 输出，ufw 未启用时返回空
+func ParseUFW(out string) (string, []Rule) {
+	if !strings.Contains(out, "Status: active") {
+		return "", nil
+	}
+	policy := ActionAccept
+	var rules []Rule
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Default:") {
+			if strings.Contains(line, "deny (incoming)") || strings.Contains(line, "reject (incoming)") {
+				policy = ActionDrop
+			}
+			continue
+		}
+
+		// 规则行形如 "5432/tcp    ALLOW IN    10.0.0.0/8"
+		var action string
+		var to, from string
+		for _, keyword := range []string{"ALLOW", "DENY", "REJECT", "LIMIT"} {
+			if idx := strings.Index(line, " "+keyword); idx > 0 {
+				to = strings.TrimSpace(line[:idx])
+				rest := strings.TrimSpace(line[idx+len(keyword)+1:])
+				rest = strings.TrimSpace(strings.TrimPrefix(rest, "IN"))
+				from = rest
+				action = ActionAccept
+				if keyword == "DENY" || keyword == "REJECT" {
+					action = ActionDrop
+				}
+				break
+			}
+		}
+		if action == "" || strings.HasPrefix(to, "To") || strings.HasPrefix(from, "OUT") {
+			continue
+		}
+		to = strings.TrimSpace(strings.TrimSuffix(to, "(v6)"))
+		portSpec, proto, _ := strings.Cut(to, "/")
+		if strings.Contains(portSpec, " on ") {
+			// 指定网卡的规则（如 "5432 on docker0"）
+			iface := strings.TrimSpace(portSpec[strings.Index(portSpec, " on ")+4:])
+			if isLocalInterface(iface) {
+				continue
+			}
+			portSpec = portSpec[:strings.Index(portSpec, " on ")]
+		}
+		if portSpec == "Anywhere" {
+			portSpec = ""
+		}
+		rule := Rule{Backend: BackendUFW, Chain: "ufw", Proto: proto, Source: normalizeSource(from), Action: action}
+		rules = append(rules, expandPorts(rule, parsePorts(portSpec))...)
+	}
+	return policy, rules
+}
@@ -0,0 +1,183 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testIPTablesSave = `# Generated by iptables-save
+*nat
+:PREROUTING ACCEPT [0:0]
+-A DOCKER ! -i docker0 -p tcp -m tcp --dport 5432 -j DNAT --to-destination 172.17.0.2:5432
+COMMIT
+*filter
+:INPUT DROP [0:0]
+:FORWARD DROP [0:0]
+:OUTPUT ACCEPT [0:0]
+:DOCKER-USER - [0:0]
+-A INPUT -i lo -j ACCEPT
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT
+-A INPUT -p tcp -m multiport --dports 80,443 -j ACCEPT
+-A INPUT -s 10.0.0.0/8 -p tcp -m tcp --dport 9100 -j ACCEPT
+-A DOCKER -d 172.17.0.2/32 ! -i docker0 -o docker0 -p tcp -m tcp --dport 5432 -j ACCEPT
+-A DOCKER-USER -s 10.0.0.0/8 -p tcp -m tcp --dport 6379 -j ACCEPT
+-A DOCKER-USER -p tcp -m tcp --dport 6379 -j DROP
+-A DOCKER-USER -j RETURN
+COMMIT
+`
+
+func TestParseIPTablesSave(t *testing.T) {
+	policy, rules := ParseIPTablesSave(testIPTablesSave)
+	if policy != ActionDrop {
+		t.Errorf("policy = %q, want drop", policy)
+	}
+	want := map[string]bool{
+		"INPUT tcp 22  accept":                   true,
+		"INPUT tcp 80  accept":                   true,
+		"INPUT tcp 443  accept":                  true,
+		"INPUT tcp 9100 10.0.0.0/8 accept":       true,
+		"DOCKER tcp 5432  accept":                true,
+		"DOCKER-USER tcp 6379 10.0.0.0/8 accept": true,
+		"DOCKER-USER tcp 6379  drop":             true,
+	}
+	for _, rule := range rules {
+		key := strings.Join([]string{rule.Chain, rule.Proto, strconv.Itoa(rule.Port), rule.Source, rule.Action}, " ")
+		if !want[key] {
+			t.Errorf("unexpected rule %q", key)
+		}
+		delete(want, key)
+	}
+	for key := range want {
+		t.Errorf("missing rule %q", key)
+	}
+}
+
+func TestParseNFTAndUFW(t *testing.T) {
+	nft := `table inet filter {
+	chain input {
+		type filter hook input priority filter; policy drop;
+		ct state established,related accept
+		iifname "lo" accept
+		tcp dport { 22, 443 } accept
+		tcp dport 5432 ip saddr 192.168.1.0/24 accept
+	}
+}`
+	policy, rules := ParseNFT(nft)
+	if policy != ActionDrop || len(rules) != 3 {
+		t.Fatalf("nft: policy=%q rules=%+v", policy, rules)
+	}
+	if rules[2].Port != 5432 || rules[2].Source != "192.168.1.0/24" {
+		t.Errorf("nft source rule = %+v", rules[2])
+	}
+
+	ufw := `Status: active
+Logging: on (low)
+Default: deny (incoming), allow (outgoing), deny (routed)
+
+To                         Action      From
+--                         ------      ----
+22/tcp                     ALLOW IN    Anywhere
+3306/tcp                   ALLOW IN    10.0.0.0/8
+8000:8100/tcp              ALLOW IN    Anywhere
+22/tcp (v6)                ALLOW IN    Anywhere (v6)
+`
+	policy, rules = ParseUFW(ufw)
+	if policy != ActionDrop || len(rules) != 4 {
+		t.Fatalf("ufw: policy=%q rules=%+v", policy, rules)
+	}
+	if !rules[2].matchesPort(8050, "tcp") || rules[2].Source != AnySource {
+		t.Errorf("ufw range rule = %+v", rules[2])
+	}
+	if policy, rules := ParseUFW("Status: inactive\n"); policy != "" || rules != nil {
+		t.Errorf("inactive ufw should be ignored, got %q %v", policy, rules)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	policy, rules := ParseIPTablesSave(testIPTablesSave)
+	state := &State{Backends: []string{BackendIPTables}, InputPolicy: policy, Rules: rules}
+	listeners := []Listener{
+		{Kind: KindContainer, Name: "postgres", Address: "0.0.0.0", Port: 5432, Proto: "tcp", TargetPort: 5432},
+		{Kind: KindContainer, Name: "redis", Address: "0.0.0.0", Port: 6379, Proto: "tcp", TargetPort: 6379},
+		{Kind: KindContainer, Name: "admin", Address: "127.0.0.1", Port: 8080, Proto: "tcp", TargetPort: 80},
+		{Kind: KindWebsite, Name: "example.com", Port: 443, Proto: "tcp", Public: true},
+		{Kind: "host", Name: "node_exporter", Port: 9100, Proto: "tcp"},
+	}
+	report := Analyze(state, listeners, DefaultChain)
+
+	byName := make(map[string]Exposure)
+	for _, exposure := range report.Exposures {
+		byName[exposure.Name] = exposure
+	}
+	// INPUT 默认拒绝对 Docker 发布端口无效
+	if e := byName["postgres"]; !e.Exposed || !e.Warn {
+		t.Errorf("postgres should be exposed: %+v", e)
+	}
+	if e := byName["redis"]; e.Exposed {
+		t.Errorf("redis is restricted in DOCKER-USER: %+v", e)
+	}
+	if e := byName["admin"]; e.Exposed {
+		t.Errorf("loopback listener is not exposed: %+v", e)
+	}
+	if e := byName["example.com"]; !e.Exposed || e.Warn {
+		t.Errorf("public website port should be exposed without warning: %+v", e)
+	}
+	if e := byName["node_exporter"]; e.Exposed {
+		t.Errorf("host port behind drop policy with source-restricted accept: %+v", e)
+	}
+	if warnings := report.Warnings(); len(warnings) != 1 || warnings[0].Name != "postgres" {
+		t.Errorf("warnings = %+v", warnings)
+	}
+}
+
+func TestManager_IdempotentApply(t *testing.T) {
+	rule, err := AllowRule{Port: 5432, CIDR: "10.1.2.3"}.Normalize()
+	if err != nil || rule.CIDR != "10.1.2.3/32" || rule.Proto != "tcp" {
+		t.Fatalf("Normalize = %+v, %v", rule, err)
+	}
+	if _, err := (AllowRule{Port: 5432, CIDR: "10.0.0.0/8; rm -rf /"}).Normalize(); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("invalid cidr should be rejected, got %v", err)
+	}
+
+	rules, changed := Plan(nil, rule, false)
+	if !changed || len(rules) != 1 {
+		t.Fatalf("Plan add = %v, %v", rules, changed)
+	}
+	if _, changed := Plan(rules, rule, false); changed {
+		t.Error("adding an existing rule should be a no-op")
+	}
+
+	restore := RenderRestore("QWQ-ALLOW", rules)
+	if restore != RenderRestore("QWQ-ALLOW", append([]AllowRule(nil), rules...)) {
+		t.Error("render should be deterministic")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(restore), "\n") {
+		if strings.HasPrefix(line, "-A ") && !strings.HasPrefix(line, "-A QWQ-ALLOW ") {
+			t.Errorf("rule outside managed chain: %q", line)
+		}
+	}
+
+	// 已存在跳转规则时不重复插入
+	var commands []string
+	run := func(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return "", nil
+	}
+	manager := NewManager("", run)
+	if err := manager.Apply(context.Background(), rules); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	for _, command := range commands {
+		if strings.Contains(command, " -I ") {
+			t.Errorf("jump rule already present, should not insert: %q", command)
+		}
+	}
+	parsed := parseManagedRules("-A QWQ-ALLOW -s 10.1.2.3/32 -p tcp -m conntrack --ctorigdstport 5432 --ctdir ORIGINAL -j ACCEPT\n-A QWQ-ALLOW -p tcp -m conntrack --ctorigdstport 5432 --ctdir ORIGINAL -j DROP\n", DefaultChain)
+	if len(parsed) != 1 || parsed[0] != rule {
+		t.Errorf("parseManagedRules = %+v", parsed)
+	}
+}
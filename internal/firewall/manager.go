@@ -0,0 +1,196 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultChain qwq 专用的 iptables 链
+const DefaultChain = "QWQ-ALLOW"
+
+// ErrInvalidRule 放行规则无效
+var ErrInvalidRule = errors.New("invalid firewall rule")
+
+// AllowRule 允许某个来源网段访问端口
+// 专用链中每个受管端口末尾都有一条 DROP 规则，未放行的来源无法访问
+type AllowRule struct {
+	Port  int    `json:"port"`
+	Proto string `json:"proto"`
+	CIDR  string `json:"cidr"`
+}
+
+// Normalize 校验规则并规范化：协议默认 tcp，单个 IP 转为 /32 或 /128
+func (r AllowRule) Normalize() (AllowRule, error) {
+	if r.Port < 1 || r.Port > 65535 {
+		return r, fmt.Errorf("%w: port %d out of range", ErrInvalidRule, r.Port)
+	}
+	if r.Proto == "" {
+		r.Proto = "tcp"
+	}
+	if r.Proto != "tcp" && r.Proto != "udp" {
+		return r, fmt.Errorf("%w: unsupported proto %q", ErrInvalidRule, r.Proto)
+	}
+	if ip := net.ParseIP(r.CIDR); ip != nil {
+		if ip.To4() != nil {
+			r.CIDR = ip.String() + "/32"
+		} else {
+			r.CIDR = ip.String() + "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(r.CIDR)
+	if err != nil {
+		return r, fmt.Errorf("%w: invalid cidr %q", ErrInvalidRule, r.CIDR)
+	}
+	if network.IP.To4() == nil {
+		// 专用链只写入 iptables（IPv4）
+		return r, fmt.Errorf("%w: only IPv4 cidr is supported", ErrInvalidRule)
+	}
+	r.CIDR = network.String()
+	return r, nil
+}
+
+// Manager 管理 qwq 专用链，只修改该链及跳转到该链的规则，不触碰其他规则
+type Manager struct {
+	Chain string
+	Run   Runner
+}
+
+// NewManager 创建专用链管理器，chain 为空时使用 DefaultChain
+func NewManager(chain string, run Runner) *Manager {
+	if chain == "" {
+		chain = DefaultChain
+	}
+	if run == nil {
+		run = ExecRunner
+	}
+	return &Manager{Chain: chain, Run: run}
+}
+
+// Rules 读取专用链中的放行规则，专用链不存在时返回空列表
+func (m *Manager) Rules(ctx context.Context) ([]AllowRule, error) {
+	out, err := m.Run(ctx, "", "iptables-save", "-t", "filter")
+	if err != nil {
+		return nil, err
+	}
+	return parseManagedRules(out, m.Chain), nil
+}
+
+// parseManagedRules 从 iptables-save 输出中提取专用链中的放行规则
+func parseManagedRules(out, chain string) []AllowRule {
+	rules := make([]AllowRule, 0)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "-A" || fields[1] != chain {
+			continue
+		}
+		var rule AllowRule
+		accept := false
+		for i := 2; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "-p":
+				rule.Proto = fields[i+1]
+			case "-s":
+				rule.CIDR = fields[i+1]
+			case "--ctorigdstport", "--dport":
+				rule.Port, _ = strconv.Atoi(fields[i+1])
+			case "-j":
+				accept = fields[i+1] == "ACCEPT"
+			}
+		}
+		if accept && rule.Port > 0 && rule.CIDR != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// Plan 计算新增或删除一条规则后的规则集，规则集不变时 changed 为 false
+func Plan(current []AllowRule, rule AllowRule, remove bool) (rules []AllowRule, changed bool) {
+	for _, existing := range current {
+		if existing == rule {
+			if remove {
+				changed = true
+				continue
+			}
+			return current, false
+		}
+		rules = append(rules, existing)
+	}
+	if remove {
+		return rules, changed
+	}
+	return append(rules, rule), true
+}
+
+// RenderRestore 生成 iptables-restore --noflush 的输入，以事务方式重建专用链
+// 声明链会清空该链已有规则，其他链保持不变；相同的规则集总是生成相同的内容
+func RenderRestore(chain string, rules []AllowRule) string {
+	sorted := append([]AllowRule(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Proto != b.Proto {
+			return a.Proto < b.Proto
+		}
+		return a.CIDR < b.CIDR
+	})
+
+	// 按原始目标端口匹配（conntrack），INPUT 和 DOCKER-USER（DNAT 之后）中都能匹配主机端口
+	match := func(rule AllowRule) string {
+		return fmt.Sprintf("-p %s -m conntrack --ctorigdstport %d --ctdir ORIGINAL", rule.Proto, rule.Port)
+	}
+	var builder strings.Builder
+	builder.WriteString("*filter\n")
+	builder.WriteString(fmt.Sprintf(":%s - [0:0]\n", chain))
+	for _, rule := range sorted {
+		builder.WriteString(fmt.Sprintf("-A %s -s %s %s -j ACCEPT\n", chain, rule.CIDR, match(rule)))
+	}
+	for i, rule := range sorted {
+		if i+1 < len(sorted) && sorted[i+1].Port == rule.Port && sorted[i+1].Proto == rule.Proto {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("-A %s %s -j DROP\n", chain, match(rule)))
+	}
+	builder.WriteString(fmt.Sprintf("-A %s -j RETURN\n", chain))
+	builder.WriteString("COMMIT\n")
+	return builder.String()
+}
+
+// jumpChains 需要跳转到专用链的内置链：INPUT 作用于主机端口，DOCKER-USER 作用于容器发布的端口
+var jumpChains = []string{"INPUT", dockerUserChain}
+
+// Commands 应用规则集需要执行的操作，用于确认前的预览
+func (m *Manager) Commands(rules []AllowRule) []string {
+	commands := []string{"iptables-restore --noflush <<EOF\n" + RenderRestore(m.Chain, rules) + "EOF"}
+	for _, chain := range jumpChains {
+		commands = append(commands, fmt.Sprintf("iptables -C %s -j %s || iptables -I %s 1 -j %s", chain, m.Chain, chain, m.Chain))
+	}
+	return commands
+}
+
+// Apply 重建专用链并确保内置链跳转到专用链，重复执行结果相同
+func (m *Manager) Apply(ctx context.Context, rules []AllowRule) error {
+	if _, err := m.Run(ctx, RenderRestore(m.Chain, rules), "iptables-restore", "--noflush"); err != nil {
+		return fmt.Errorf("failed to apply %s chain: %w", m.Chain, err)
+	}
+	for _, chain := range jumpChains {
+		if _, err := m.Run(ctx, "", "iptables", "-C", chain, "-j", m.Chain); err == nil {
+			continue
+		}
+		if _, err := m.Run(ctx, "", "iptables", "-I", chain, "1", "-j", m.Chain); err != nil {
+			if chain == dockerUserChain {
+				// 未安装 Docker 时没有 DOCKER-USER 链
+				continue
+			}
+			return fmt.Errorf("failed to add jump from %s: %w", chain, err)
+		}
+	}
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"qwq/internal/realip"
 )
 
 // ServiceRegistry 服务注册表
@@ -231,6 +233,20 @@ func (g *Gateway) proxyRequest(w http.ResponseWriter, r *http.Request, service *
 		originalDirector(req)
 		req.Header.Set("X-Forwarded-Host", r.Host)
 		req.Header.Set("X-Gateway-Version", "1.0")
+		// 转发真实客户端地址：直连对端不是可信代理时丢弃其携带的转发头，
+		// ReverseProxy 随后把对端地址追加到 X-Forwarded-For
+		trustedPeer := realip.PeerTrusted(r, realip.Proxies())
+		if !trustedPeer {
+			req.Header.Del(realip.HeaderForwardedFor)
+		}
+		req.Header.Set(realip.HeaderRealIP, realip.FromRequest(r))
+		if !trustedPeer || req.Header.Get(realip.HeaderForwardedProto) == "" {
+			proto := "http"
+			if r.TLS != nil {
+				proto = "https"
+			}
+			req.Header.Set(realip.HeaderForwardedProto, proto)
+		}
 	}
 
 	proxy.ServeHTTP(w, r)
@@ -306,10 +322,8 @@ func RateLimitMiddleware(requestsPerMinute int) Middleware {
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientIP := r.RemoteAddr
-			if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-				clientIP = strings.Split(forwarded, ",")[0]
-			}
+			// 只有来自可信代理的请求才按 X-Forwarded-For 区分客户端，避免伪造地址绕过限流
+			clientIP := realip.FromRequest(r)
 
 			mu.Lock()
 			c, exists := clients[clientIP]
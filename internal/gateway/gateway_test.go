@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"qwq/internal/config"
 )
 
 // **Feature: enhanced-aiops-platform, Property 21: API 规范一致性**
@@ -408,4 +410,57 @@ func TestHealthCheckEndpoint(t *testing.T) {
 	if response.Code != 200 {
 		t.Errorf("Health check should return code=200, got %d", response.Code)
 	}
-}
\ No newline at end of file
+}
+
+func TestProxyForwardsClientIP(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.TrustedProxies = []string{"10.0.0.0/8"} })
+
+	var headers http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	gateway := NewGateway()
+	gateway.RegisterService("qwq", backend.URL, "/health", "1.0")
+	gateway.AddRoute("/api/", "qwq", nil)
+
+	proxy := func(peer, forwardedFor string) http.Header {
+		req := httptest.NewRequest("GET", "/api/stats", nil)
+		req.RemoteAddr = peer
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			req.Header.Set("X-Real-IP", "6.6.6.6")
+		}
+		gateway.ServeHTTP(httptest.NewRecorder(), req)
+		return headers
+	}
+
+	// 不可信的客户端伪造的转发头被丢弃
+	h := proxy("203.0.113.9:51000", "6.6.6.6")
+	if h.Get("X-Forwarded-For") != "203.0.113.9" || h.Get("X-Real-IP") != "203.0.113.9" || h.Get("X-Forwarded-Proto") != "http" {
+		t.Errorf("Expected spoofed headers to be replaced, got %v", h)
+	}
+
+	// 可信的上游代理：保留转发链并追加上游地址
+	h = proxy("10.0.0.2:40000", "198.51.100.7")
+	if h.Get("X-Forwarded-For") != "198.51.100.7, 10.0.0.2" || h.Get("X-Real-IP") != "198.51.100.7" {
+		t.Errorf("Expected forwarded chain from a trusted proxy, got %v", h)
+	}
+}
+
+func TestRateLimiting_IgnoresSpoofedForwardedFor(t *testing.T) {
+	handler := RateLimitMiddleware(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, spoofed := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		req.Header.Set("X-Forwarded-For", spoofed)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if i == 1 && w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected a spoofed X-Forwarded-For not to reset the limit, got %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+// DeploymentWindow 部署失败率的统计窗口
+const DeploymentWindow = 7 * 24 * time.Hour
+
+// DeploymentLog 记录部署结果，只保留统计窗口内的数据
+type DeploymentLog struct {
+	mu      sync.Mutex
+	entries []deploymentEntry
+}
+
+type deploymentEntry struct {
+	at      time.Time
+	success bool
+}
+
+// DefaultDeployments 全局部署结果记录，部署流程结束时调用 Record
+var DefaultDeployments = &DeploymentLog{}
+
+// Record 记录一次部署结果
+func (l *DeploymentLog) Record(at time.Time, success bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, deploymentEntry{at: at, success: success})
+	l.pruneLocked(at)
+}
+
+// Counts 返回 now 之前统计窗口内的部署次数和失败次数
+func (l *DeploymentLog) Counts(now time.Time) (total, failed int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pruneLocked(now)
+	for _, entry := range l.entries {
+		if entry.at.After(now) {
+			continue
+		}
+		total++
+		if !entry.success {
+			failed++
+		}
+	}
+	return total, failed
+}
+
+func (l *DeploymentLog) pruneLocked(now time.Time) {
+	cutoff := now.Add(-DeploymentWindow)
+	drop := 0
+	for drop < len(l.entries) && l.entries[drop].at.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		l.entries = append([]deploymentEntry(nil), l.entries[drop:]...)
+	}
+}
+
+// DropDetector 检测相邻两次巡检之间的评分下降
+type DropDetector struct {
+	mu       sync.Mutex
+	previous *int
+}
+
+// Observe 记录本次评分，返回上一次评分以及下降幅度是否超过 threshold
+// 第一次调用或 threshold 不大于 0 时不会报告下降
+func (d *DropDetector) Observe(score, threshold int) (previous int, dropped bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.previous != nil {
+		previous = *d.previous
+		dropped = threshold > 0 && previous-score > threshold
+	}
+	d.previous = &score
+	return previous, dropped
+}
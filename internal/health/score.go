@@ -0,0 +1,352 @@
+// Package health 计算主机整体健康评分（0-100）
+// 评分由多个维度组成，每个维度按权重扣分，并给出每一项扣分的原因
+package health
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 评分维度
+const (
+	ComponentIncidents    = "incidents"    // 未关闭的异常及其严重程度
+	ComponentResources    = "resources"    // CPU/内存/磁盘余量
+	ComponentServices     = "services"     // 服务/HTTP 检查
+	ComponentCertificates = "certificates" // 证书到期
+	ComponentDeployments  = "deployments"  // 近 7 天部署失败率
+	ComponentPatrol       = "patrol"       // 巡检检查项失败
+)
+
+// Severity 异常严重程度
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityWarning  Severity = "warning"
+	SeverityInfo     Severity = "info"
+)
+
+// severityShare 单个异常按严重程度扣除的维度权重比例
+var severityShare = map[Severity]float64{
+	SeverityCritical: 0.5,
+	SeverityWarning:  0.2,
+	SeverityInfo:     0.05,
+}
+
+// Weights 各维度权重，总和不为 100 时按比例归一化
+type Weights struct {
+	Incidents    float64 `json:"incidents"`
+	Resources    float64 `json:"resources"`
+	Services     float64 `json:"services"`
+	Certificates float64 `json:"certificates"`
+	Deployments  float64 `json:"deployments"`
+	Patrol       float64 `json:"patrol"`
+}
+
+// DefaultWeights 默认权重
+var DefaultWeights = Weights{
+	Incidents:    25,
+	Resources:    20,
+	Services:     20,
+	Certificates: 10,
+	Deployments:  10,
+	Patrol:       15,
+}
+
+// Thresholds 资源使用率阈值（百分比）与证书预警天数
+type Thresholds struct {
+	CPU          float64 `json:"cpu"`
+	Memory       float64 `json:"memory"`
+	Disk         float64 `json:"disk"`
+	CertWarnDays int     `json:"cert_warn_days"`
+}
+
+// DefaultThresholds 默认阈值
+var DefaultThresholds = Thresholds{CPU: 90, Memory: 90, Disk: 85, CertWarnDays: 30}
+
+// resourceWarnBand 使用率距阈值多少个百分点内开始线性扣分
+const resourceWarnBand = 20.0
+
+// Incident 未关闭的异常
+type Incident struct {
+	Title    string   `json:"title"`
+	Severity Severity `json:"severity"`
+}
+
+// ServiceCheck 服务检查结果
+type ServiceCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+}
+
+// Certificate 证书到期信息
+type Certificate struct {
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Inputs 评分输入
+// 资源使用率小于 0 表示数据不可用，该项不扣分
+type Inputs struct {
+	Now                time.Time
+	Incidents          []Incident
+	CPUPct             float64
+	MemPct             float64
+	DiskPct            float64
+	Services           []ServiceCheck
+	Certificates       []Certificate
+	DeploymentsTotal   int // 近 7 天部署次数
+	DeploymentsFailed  int // 近 7 天部署失败次数
+	PatrolChecksTotal  int // 最近一次巡检的检查项数量
+	PatrolChecksFailed int // 最近一次巡检告警或超时的检查项数量
+}
+
+// Deduction 一项扣分及原因
+type Deduction struct {
+	Component string  `json:"component"`
+	Points    float64 `json:"points"`
+	Reason    string  `json:"reason"`
+}
+
+// ComponentScore 单个维度的扣分汇总
+type ComponentScore struct {
+	Name     string  `json:"name"`
+	Weight   float64 `json:"weight"`   // 归一化后的权重，即该维度最多扣除的分数
+	Deducted float64 `json:"deducted"` // 实际扣除的分数
+}
+
+// Report 健康评分结果
+type Report struct {
+	Score      int              `json:"score"`
+	ComputedAt time.Time        `json:"computed_at"`
+	Components []ComponentScore `json:"components"`
+	Breakdown  []Deduction      `json:"breakdown"`
+}
+
+// Score 根据输入计算健康评分
+func Score(in Inputs, weights Weights, thresholds Thresholds) *Report {
+	if in.Now.IsZero() {
+		in.Now = time.Now()
+	}
+	weights = weights.normalized()
+	thresholds = thresholds.withDefaults()
+
+	report := &Report{ComputedAt: in.Now}
+	components := []struct {
+		name   string
+		weight float64
+		score  func(weight float64) []Deduction
+	}{
+		{ComponentIncidents, weights.Incidents, func(w float64) []Deduction { return scoreIncidents(in, w) }},
+		{ComponentResources, weights.Resources, func(w float64) []Deduction { return scoreResources(in, thresholds, w) }},
+		{ComponentServices, weights.Services, func(w float64) []Deduction { return scoreServices(in, w) }},
+		{ComponentCertificates, weights.Certificates, func(w float64) []Deduction { return scoreCertificates(in, thresholds, w) }},
+		{ComponentDeployments, weights.Deployments, func(w float64) []Deduction { return scoreDeployments(in, w) }},
+		{ComponentPatrol, weights.Patrol, func(w float64) []Deduction { return scorePatrol(in, w) }},
+	}
+
+	total := 0.0
+	for _, component := range components {
+		deductions := component.score(component.weight)
+		// 单个维度的扣分不超过其权重，超出部分按比例缩减
+		sum := 0.0
+		for _, d := range deductions {
+			sum += d.Points
+		}
+		if sum > component.weight && sum > 0 {
+			scale := component.weight / sum
+			for i := range deductions {
+				deductions[i].Points *= scale
+			}
+			sum = component.weight
+		}
+		for i := range deductions {
+			deductions[i].Component = component.name
+			deductions[i].Points = round1(deductions[i].Points)
+		}
+		report.Breakdown = append(report.Breakdown, deductions...)
+		report.Components = append(report.Components, ComponentScore{
+			Name:     component.name,
+			Weight:   round1(component.weight),
+			Deducted: round1(sum),
+		})
+		total += sum
+	}
+
+	report.Score = int(math.Round(math.Max(0, 100-total)))
+	return report
+}
+
+// Summary 一行文字摘要，用于报告和告警
+func (r *Report) Summary() string {
+	if len(r.Breakdown) == 0 {
+		return fmt.Sprintf("健康评分 %d/100，无扣分项", r.Score)
+	}
+	sorted := append([]Deduction(nil), r.Breakdown...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Points > sorted[j].Points })
+	parts := make([]string, 0, 3)
+	for i, d := range sorted {
+		if i == 3 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (-%.1f)", d.Reason, d.Points))
+	}
+	return fmt.Sprintf("健康评分 %d/100，主要扣分: %s", r.Score, strings.Join(parts, "; "))
+}
+
+// normalized 将权重归一化为总和 100，全部为 0 时使用默认权重
+func (w Weights) normalized() Weights {
+	values := []*float64{&w.Incidents, &w.Resources, &w.Services, &w.Certificates, &w.Deployments, &w.Patrol}
+	sum := 0.0
+	for _, v := range values {
+		if *v < 0 {
+			*v = 0
+		}
+		sum += *v
+	}
+	if sum == 0 {
+		return DefaultWeights
+	}
+	for _, v := range values {
+		*v = *v * 100 / sum
+	}
+	return w
+}
+
+// withDefaults 未配置的阈值使用默认值
+func (t Thresholds) withDefaults() Thresholds {
+	if t.CPU <= 0 {
+		t.CPU = DefaultThresholds.CPU
+	}
+	if t.Memory <= 0 {
+		t.Memory = DefaultThresholds.Memory
+	}
+	if t.Disk <= 0 {
+		t.Disk = DefaultThresholds.Disk
+	}
+	if t.CertWarnDays <= 0 {
+		t.CertWarnDays = DefaultThresholds.CertWarnDays
+	}
+	return t
+}
+
+// scoreIncidents 每个未关闭的异常按严重程度扣分
+func scoreIncidents(in Inputs, weight float64) []Deduction {
+	var deductions []Deduction
+	for _, incident := range in.Incidents {
+		share, ok := severityShare[incident.Severity]
+		if !ok {
+			share = severityShare[SeverityWarning]
+		}
+		deductions = append(deductions, Deduction{
+			Points: weight * share,
+			Reason: fmt.Sprintf("未关闭的%s异常: %s", incident.Severity, incident.Title),
+		})
+	}
+	return deductions
+}
+
+// scoreResources 使用率进入阈值前 resourceWarnBand 个百分点后线性扣分，达到阈值时扣满该资源的份额
+func scoreResources(in Inputs, thresholds Thresholds, weight float64) []Deduction {
+	share := weight / 3
+	var deductions []Deduction
+	for _, resource := range []struct {
+		name      string
+		usage     float64
+		threshold float64
+	}{
+		{"CPU", in.CPUPct, thresholds.CPU},
+		{"内存", in.MemPct, thresholds.Memory},
+		{"磁盘", in.DiskPct, thresholds.Disk},
+	} {
+		if resource.usage < 0 {
+			continue
+		}
+		ratio := (resource.usage - (resource.threshold - resourceWarnBand)) / resourceWarnBand
+		if ratio <= 0 {
+			continue
+		}
+		reason := fmt.Sprintf("%s使用率 %.1f%% 接近阈值 %.0f%%", resource.name, resource.usage, resource.threshold)
+		if ratio >= 1 {
+			ratio = 1
+			reason = fmt.Sprintf("%s使用率 %.1f%% 超过阈值 %.0f%%", resource.name, resource.usage, resource.threshold)
+		}
+		deductions = append(deductions, Deduction{Points: share * ratio, Reason: reason})
+	}
+	return deductions
+}
+
+// scoreServices 按失败的服务检查占比扣分
+func scoreServices(in Inputs, weight float64) []Deduction {
+	if len(in.Services) == 0 {
+		return nil
+	}
+	var deductions []Deduction
+	for _, service := range in.Services {
+		if service.Healthy {
+			continue
+		}
+		deductions = append(deductions, Deduction{
+			Points: weight / float64(len(in.Services)),
+			Reason: fmt.Sprintf("服务检查失败: %s", service.Name),
+		})
+	}
+	return deductions
+}
+
+// scoreCertificates 已过期扣满，7 天内到期扣 60%，预警期内按剩余天数线性扣分
+func scoreCertificates(in Inputs, thresholds Thresholds, weight float64) []Deduction {
+	var deductions []Deduction
+	for _, cert := range in.Certificates {
+		days := cert.ExpiresAt.Sub(in.Now).Hours() / 24
+		switch {
+		case days <= 0:
+			deductions = append(deductions, Deduction{
+				Points: weight,
+				Reason: fmt.Sprintf("证书已过期: %s", cert.Name),
+			})
+		case days <= 7:
+			deductions = append(deductions, Deduction{
+				Points: weight * 0.6,
+				Reason: fmt.Sprintf("证书 %.0f 天内到期: %s", math.Ceil(days), cert.Name),
+			})
+		case days <= float64(thresholds.CertWarnDays):
+			deductions = append(deductions, Deduction{
+				Points: weight * 0.3 * (1 - days/float64(thresholds.CertWarnDays)),
+				Reason: fmt.Sprintf("证书 %.0f 天后到期: %s", math.Ceil(days), cert.Name),
+			})
+		}
+	}
+	return deductions
+}
+
+// scoreDeployments 按近 7 天部署失败率扣分
+func scoreDeployments(in Inputs, weight float64) []Deduction {
+	if in.DeploymentsTotal <= 0 || in.DeploymentsFailed <= 0 {
+		return nil
+	}
+	rate := math.Min(1, float64(in.DeploymentsFailed)/float64(in.DeploymentsTotal))
+	return []Deduction{{
+		Points: weight * rate,
+		Reason: fmt.Sprintf("近 7 天部署失败 %d/%d (%.0f%%)", in.DeploymentsFailed, in.DeploymentsTotal, rate*100),
+	}}
+}
+
+// scorePatrol 按最近一次巡检失败的检查项占比扣分
+func scorePatrol(in Inputs, weight float64) []Deduction {
+	if in.PatrolChecksTotal <= 0 || in.PatrolChecksFailed <= 0 {
+		return nil
+	}
+	rate := math.Min(1, float64(in.PatrolChecksFailed)/float64(in.PatrolChecksTotal))
+	return []Deduction{{
+		Points: weight * rate,
+		Reason: fmt.Sprintf("巡检检查项失败 %d/%d", in.PatrolChecksFailed, in.PatrolChecksTotal),
+	}}
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
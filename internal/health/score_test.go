@@ -0,0 +1,163 @@
+package health
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+// healthyInputs 没有任何扣分项的输入
+func healthyInputs() Inputs {
+	return Inputs{
+		Now:                testNow,
+		CPUPct:             10,
+		MemPct:             30,
+		DiskPct:            40,
+		Services:           []ServiceCheck{{Name: "api", Healthy: true}},
+		Certificates:       []Certificate{{Name: "example.com", ExpiresAt: testNow.Add(90 * 24 * time.Hour)}},
+		DeploymentsTotal:   5,
+		PatrolChecksTotal:  5,
+		PatrolChecksFailed: 0,
+	}
+}
+
+// deductionFor 返回指定维度的扣分项
+func deductionFor(report *Report, component string) []Deduction {
+	var deductions []Deduction
+	for _, d := range report.Breakdown {
+		if d.Component == component {
+			deductions = append(deductions, d)
+		}
+	}
+	return deductions
+}
+
+func TestScore_Healthy(t *testing.T) {
+	report := Score(healthyInputs(), DefaultWeights, DefaultThresholds)
+	if report.Score != 100 || len(report.Breakdown) != 0 {
+		t.Fatalf("Expected 100 without deductions, got %d %+v", report.Score, report.Breakdown)
+	}
+	if len(report.Components) != 6 {
+		t.Errorf("Expected 6 components, got %d", len(report.Components))
+	}
+}
+
+func TestScore_DeductionPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutate    func(in *Inputs)
+		component string
+		points    float64
+		reason    string
+	}{
+		{"critical incident", func(in *Inputs) {
+			in.Incidents = []Incident{{Title: "OOM", Severity: SeverityCritical}}
+		}, ComponentIncidents, 12.5, "critical"},
+		{"warning incident", func(in *Inputs) {
+			in.Incidents = []Incident{{Title: "zombie", Severity: SeverityWarning}}
+		}, ComponentIncidents, 5, "zombie"},
+		{"info incident", func(in *Inputs) {
+			in.Incidents = []Incident{{Title: "notice", Severity: SeverityInfo}}
+		}, ComponentIncidents, 1.3, "notice"},
+		{"unknown severity counts as warning", func(in *Inputs) {
+			in.Incidents = []Incident{{Title: "custom", Severity: "weird"}}
+		}, ComponentIncidents, 5, "custom"},
+		{"incidents capped at weight", func(in *Inputs) {
+			for i := 0; i < 5; i++ {
+				in.Incidents = append(in.Incidents, Incident{Title: "down", Severity: SeverityCritical})
+			}
+		}, ComponentIncidents, 25, "down"},
+		{"disk over threshold", func(in *Inputs) { in.DiskPct = 95 }, ComponentResources, 6.7, "超过阈值"},
+		{"memory near threshold", func(in *Inputs) { in.MemPct = 80 }, ComponentResources, 3.3, "接近阈值"},
+		{"cpu over threshold", func(in *Inputs) { in.CPUPct = 150 }, ComponentResources, 6.7, "CPU"},
+		{"failed service", func(in *Inputs) {
+			in.Services = []ServiceCheck{{Name: "api", Healthy: true}, {Name: "web", Healthy: false}}
+		}, ComponentServices, 10, "web"},
+		{"expired certificate", func(in *Inputs) {
+			in.Certificates = []Certificate{{Name: "old.com", ExpiresAt: testNow.Add(-time.Hour)}}
+		}, ComponentCertificates, 10, "已过期"},
+		{"certificate within a week", func(in *Inputs) {
+			in.Certificates = []Certificate{{Name: "soon.com", ExpiresAt: testNow.Add(3 * 24 * time.Hour)}}
+		}, ComponentCertificates, 6, "3 天内到期"},
+		{"certificate in warning window", func(in *Inputs) {
+			in.Certificates = []Certificate{{Name: "later.com", ExpiresAt: testNow.Add(15 * 24 * time.Hour)}}
+		}, ComponentCertificates, 1.5, "15 天后到期"},
+		{"deployment failures", func(in *Inputs) {
+			in.DeploymentsTotal, in.DeploymentsFailed = 4, 1
+		}, ComponentDeployments, 2.5, "1/4"},
+		{"patrol failures", func(in *Inputs) {
+			in.PatrolChecksTotal, in.PatrolChecksFailed = 6, 2
+		}, ComponentPatrol, 5, "2/6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := healthyInputs()
+			tt.mutate(&in)
+			report := Score(in, DefaultWeights, DefaultThresholds)
+
+			deductions := deductionFor(report, tt.component)
+			if len(deductions) == 0 {
+				t.Fatalf("Expected deduction for %s, got %+v", tt.component, report.Breakdown)
+			}
+			total := 0.0
+			for _, d := range deductions {
+				total += d.Points
+			}
+			if total < tt.points-0.2 || total > tt.points+0.2 {
+				t.Errorf("Expected %.1f points deducted, got %.1f", tt.points, total)
+			}
+			if !strings.Contains(deductions[0].Reason, tt.reason) {
+				t.Errorf("Expected reason to mention %q, got %q", tt.reason, deductions[0].Reason)
+			}
+			if len(report.Breakdown) != len(deductions) {
+				t.Errorf("Unexpected deductions in other components: %+v", report.Breakdown)
+			}
+		})
+	}
+}
+
+func TestScore_UnknownResourcesAndEmptyInputs(t *testing.T) {
+	report := Score(Inputs{Now: testNow, CPUPct: -1, MemPct: -1, DiskPct: -1}, DefaultWeights, DefaultThresholds)
+	if report.Score != 100 {
+		t.Errorf("Unavailable data must not deduct, got %d %+v", report.Score, report.Breakdown)
+	}
+}
+
+func TestScore_WeightsNormalized(t *testing.T) {
+	in := healthyInputs()
+	in.Services = []ServiceCheck{{Name: "web", Healthy: false}}
+
+	// 只有服务维度有权重时，服务全部失败应扣满 100 分
+	report := Score(in, Weights{Services: 1}, DefaultThresholds)
+	if report.Score != 0 {
+		t.Errorf("Expected score 0, got %d", report.Score)
+	}
+
+	if Score(in, Weights{}, DefaultThresholds).Score != 80 {
+		t.Error("Zero weights should fall back to defaults")
+	}
+}
+
+func TestDeploymentLogAndDropDetector(t *testing.T) {
+	log := &DeploymentLog{}
+	log.Record(testNow.Add(-8*24*time.Hour), false)
+	log.Record(testNow.Add(-time.Hour), true)
+	log.Record(testNow.Add(-time.Minute), false)
+	if total, failed := log.Counts(testNow); total != 2 || failed != 1 {
+		t.Errorf("Expected 2 deployments with 1 failure in window, got %d/%d", total, failed)
+	}
+
+	var detector DropDetector
+	if _, dropped := detector.Observe(95, 10); dropped {
+		t.Error("First observation must not report a drop")
+	}
+	if previous, dropped := detector.Observe(80, 10); !dropped || previous != 95 {
+		t.Errorf("Expected drop from 95, got %d %v", previous, dropped)
+	}
+	if _, dropped := detector.Observe(75, 10); dropped {
+		t.Error("Drop of 5 must not exceed threshold 10")
+	}
+}
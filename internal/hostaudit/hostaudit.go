@@ -0,0 +1,524 @@
+// Package hostaudit 审计主机账号：UID 0 和 sudo 组用户、sudoers 文件哈希、各用户 authorized_keys 中的公钥指纹，
+// 与本地保存的基线对比并描述变化。第一次审计建立基线不告警；合法变更后由运维接受当前状态为新基线。
+// 基线只保存用户名、文件哈希和公钥指纹，不保存任何密钥内容
+package hostaudit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+)
+
+// 变化类型
+const (
+	ChangeUserAdded       = "user_added"
+	ChangeUserRemoved     = "user_removed"
+	ChangeUserPrivilege   = "user_privilege_changed"
+	ChangeKeyAdded        = "key_added"
+	ChangeKeyRemoved      = "key_removed"
+	ChangeSudoersAdded    = "sudoers_added"
+	ChangeSudoersModified = "sudoers_modified"
+	ChangeSudoersRemoved  = "sudoers_removed"
+)
+
+// unreadableHash 无权限读取的 sudoers 文件记录的哈希
+const unreadableHash = "unreadable"
+
+// DefaultGroups 默认视为拥有 sudo 权限的用户组
+var DefaultGroups = []string{"sudo", "wheel", "admin"}
+
+// ErrNoSnapshot 无法读取 /etc/passwd，本机不支持账号审计
+var ErrNoSnapshot = errors.New("host accounts are not readable")
+
+// Key authorized_keys 中的一个公钥，只记录指纹，不记录公钥本身
+type Key struct {
+	Fingerprint string `json:"fingerprint"` // 与 ssh-keygen -lf 相同的 SHA256:... 格式
+	Type        string `json:"type"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// Snapshot 一次账号审计的结果
+type Snapshot struct {
+	Privileged map[string]string `json:"privileged"`           // 特权用户 → 特权来源，如 "uid 0"、"group sudo"
+	Sudoers    map[string]string `json:"sudoers"`              // sudoers 文件路径 → SHA256
+	Keys       map[string][]Key  `json:"authorized_keys"`      // 用户名 → 公钥指纹
+	Unreadable []string          `json:"unreadable,omitempty"` // 无权限读取的 authorized_keys 所属用户，不参与对比
+	TakenAt    time.Time         `json:"taken_at"`
+}
+
+// Change 相对基线的一项变化
+type Change struct {
+	Kind    string `json:"kind"`
+	Subject string `json:"subject"` // 用户名或 sudoers 文件路径
+	Key     *Key   `json:"key,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// Title 变化的标题，同一变化在多次巡检之间不变
+func (c Change) Title() string {
+	switch c.Kind {
+	case ChangeUserAdded:
+		return fmt.Sprintf("新增特权用户 (%s)", c.Subject)
+	case ChangeUserRemoved:
+		return fmt.Sprintf("特权用户被移除 (%s)", c.Subject)
+	case ChangeUserPrivilege:
+		return fmt.Sprintf("用户特权来源变化 (%s)", c.Subject)
+	case ChangeKeyAdded:
+		return fmt.Sprintf("新增 SSH 公钥 (%s %s)", c.Subject, c.Key.Fingerprint)
+	case ChangeKeyRemoved:
+		return fmt.Sprintf("SSH 公钥被移除 (%s %s)", c.Subject, c.Key.Fingerprint)
+	case ChangeSudoersAdded:
+		return fmt.Sprintf("新增 sudoers 文件 (%s)", c.Subject)
+	case ChangeSudoersModified:
+		return fmt.Sprintf("sudoers 文件被修改 (%s)", c.Subject)
+	case ChangeSudoersRemoved:
+		return fmt.Sprintf("sudoers 文件被删除 (%s)", c.Subject)
+	}
+	return c.Kind + " (" + c.Subject + ")"
+}
+
+// Report 一次审计与基线的对比结果
+type Report struct {
+	Baselined bool      `json:"baselined"` // 本次建立了基线（第一次审计），不告警
+	Baseline  *Snapshot `json:"baseline"`
+	Current   *Snapshot `json:"current"`
+	Changes   []Change  `json:"changes"`
+	Warnings  []string  `json:"warnings,omitempty"` // 读取失败的文件等
+}
+
+// Auditor 采集账号快照并与保存在本地的基线对比
+type Auditor struct {
+	mu       sync.Mutex
+	path     string
+	root     string
+	baseline *Snapshot
+	loaded   bool
+	now      func() time.Time
+}
+
+// NewAuditor 创建审计器，path 为基线文件（为空时不持久化），root 为主机文件系统根目录
+func NewAuditor(path, root string) *Auditor {
+	return &Auditor{path: path, root: root, now: time.Now}
+}
+
+// Default 全局账号审计器
+var Default = NewAuditor("qwq_host_audit.json", "/")
+
+// Enabled 是否开启账号审计
+func Enabled() bool {
+	return !config.Current().Patrol.Accounts.Disabled
+}
+
+func groups() []string {
+	if groups := config.Current().Patrol.Accounts.Groups; len(groups) > 0 {
+		return groups
+	}
+	return DefaultGroups
+}
+
+// Check 采集当前快照并与基线对比，没有基线时以当前快照建立基线
+func (a *Auditor) Check() (*Report, error) {
+	current, warnings, err := a.Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ensureLoadedLocked()
+	report := &Report{Current: current, Warnings: warnings}
+	if a.baseline == nil {
+		a.baseline = current
+		a.saveLocked()
+		report.Baselined = true
+	}
+	report.Baseline = a.baseline
+	report.Changes = Diff(a.baseline, current)
+	return report, nil
+}
+
+// Accept 将当前状态接受为新基线，用于确认合法的账号变更
+func (a *Auditor) Accept(actor string) (*Snapshot, error) {
+	current, _, err := a.Collect()
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ensureLoadedLocked()
+	changes := 0
+	if a.baseline != nil {
+		changes = len(Diff(a.baseline, current))
+	}
+	a.baseline = current
+	a.saveLocked()
+	logger.Info("[AUDIT] 接受主机账号当前状态为新基线（%d 项变化） by %s", changes, actor)
+	return current, nil
+}
+
+// Baseline 当前基线，尚未建立时返回 nil
+func (a *Auditor) Baseline() *Snapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ensureLoadedLocked()
+	return a.baseline
+}
+
+func (a *Auditor) ensureLoadedLocked() {
+	if a.loaded {
+		return
+	}
+	a.loaded = true
+	if a.path == "" {
+		return
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Info("⚠️ 读取主机账号基线失败: %v", err)
+		}
+		return
+	}
+	var baseline Snapshot
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		logger.Info("⚠️ 主机账号基线格式错误，将重新建立: %v", err)
+		return
+	}
+	a.baseline = &baseline
+}
+
+// saveLocked 原子写入基线，调用方持有锁
+func (a *Auditor) saveLocked() {
+	if a.path == "" {
+		return
+	}
+	data, err := json.Marshal(a.baseline)
+	if err == nil {
+		tmp := a.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, a.path)
+		}
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存主机账号基线失败: %v", err)
+	}
+}
+
+// passwdEntry /etc/passwd 中的一个用户
+type passwdEntry struct {
+	name string
+	uid  int
+	gid  string
+	home string
+}
+
+// Collect 采集当前账号快照，返回读取失败的文件作为警告
+func (a *Auditor) Collect() (*Snapshot, []string, error) {
+	users, err := readPasswd(a.hostPath("/etc/passwd"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNoSnapshot, err)
+	}
+	var warnings []string
+	snapshot := &Snapshot{
+		Privileged: make(map[string]string),
+		Sudoers:    make(map[string]string),
+		Keys:       make(map[string][]Key),
+		TakenAt:    a.now(),
+	}
+
+	reasons := make(map[string][]string)
+	for _, user := range users {
+		if user.uid == 0 {
+			reasons[user.name] = append(reasons[user.name], "uid 0")
+		}
+	}
+	members, gids, err := readGroups(a.hostPath("/etc/group"), groups())
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("读取 /etc/group 失败: %v", err))
+	}
+	for _, user := range users {
+		if group, ok := gids[user.gid]; ok {
+			members[group] = append(members[group], user.name)
+		}
+	}
+	for group, names := range members {
+		for _, name := range names {
+			reason := "group " + group
+			if !contains(reasons[name], reason) {
+				reasons[name] = append(reasons[name], reason)
+			}
+		}
+	}
+	for name, list := range reasons {
+		sort.Strings(list)
+		snapshot.Privileged[name] = strings.Join(list, ", ")
+	}
+
+	sudoers := []string{"/etc/sudoers"}
+	if entries, err := os.ReadDir(a.hostPath("/etc/sudoers.d")); err == nil {
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				sudoers = append(sudoers, "/etc/sudoers.d/"+entry.Name())
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		warnings = append(warnings, fmt.Sprintf("读取 /etc/sudoers.d 失败: %v", err))
+	}
+	for _, path := range sudoers {
+		data, err := os.ReadFile(a.hostPath(path))
+		switch {
+		case err == nil:
+			sum := sha256.Sum256(data)
+			snapshot.Sudoers[path] = hex.EncodeToString(sum[:])
+		case os.IsNotExist(err):
+		default:
+			snapshot.Sudoers[path] = unreadableHash
+			warnings = append(warnings, fmt.Sprintf("读取 %s 失败: %v", path, err))
+		}
+	}
+
+	// 多个用户共用一个主目录时（如 /nonexistent）只读取一次
+	homes := make(map[string]bool)
+	for _, user := range users {
+		if user.home == "" || user.home == "/" || homes[user.home] {
+			continue
+		}
+		homes[user.home] = true
+		var keys []Key
+		unreadable := false
+		for _, name := range []string{"authorized_keys", "authorized_keys2"} {
+			path := filepath.Join(user.home, ".ssh", name)
+			found, err := readAuthorizedKeys(a.hostPath(path))
+			if err != nil {
+				if !os.IsNotExist(err) {
+					unreadable = true
+					warnings = append(warnings, fmt.Sprintf("读取 %s 失败: %v", path, err))
+				}
+				continue
+			}
+			keys = append(keys, found...)
+		}
+		if unreadable {
+			snapshot.Unreadable = append(snapshot.Unreadable, user.name)
+		}
+		if len(keys) > 0 {
+			snapshot.Keys[user.name] = keys
+		}
+	}
+	sort.Strings(snapshot.Unreadable)
+	return snapshot, warnings, nil
+}
+
+// hostPath 主机文件在当前文件系统中的路径
+func (a *Auditor) hostPath(path string) string {
+	return filepath.Join(a.root, path)
+}
+
+func readPasswd(path string) ([]passwdEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var users []passwdEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		users = append(users, passwdEntry{name: fields[0], uid: uid, gid: fields[3], home: fields[5]})
+	}
+	return users, scanner.Err()
+}
+
+// readGroups 读取指定用户组的成员，同时返回这些组的 GID，主组为这些组的用户同样拥有权限
+func readGroups(path string, names []string) (map[string][]string, map[string]string, error) {
+	members := make(map[string][]string)
+	gids := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return members, gids, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 4 || !contains(names, fields[0]) {
+			continue
+		}
+		gids[fields[2]] = fields[0]
+		for _, member := range strings.Split(fields[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				members[fields[0]] = append(members[fields[0]], member)
+			}
+		}
+	}
+	return members, gids, scanner.Err()
+}
+
+// readAuthorizedKeys 解析 authorized_keys，只返回公钥指纹、类型和注释
+func readAuthorizedKeys(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, ok := ParseAuthorizedKey(line); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// ParseAuthorizedKey 解析 authorized_keys 的一行（可带选项前缀），计算与 ssh-keygen -lf 相同的 SHA256 指纹
+func ParseAuthorizedKey(line string) (Key, bool) {
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if !isKeyType(fields[i]) {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(blob)
+		return Key{
+			Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+			Type:        fields[i],
+			Comment:     strings.Join(fields[i+2:], " "),
+		}, true
+	}
+	return Key{}, false
+}
+
+func isKeyType(field string) bool {
+	return strings.HasPrefix(field, "ssh-") || strings.HasPrefix(field, "ecdsa-sha2-") || strings.HasPrefix(field, "sk-")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 对比基线和当前快照，按特权用户、SSH 公钥、sudoers 文件的顺序返回变化
+// 当前无权限读取的 authorized_keys 不参与对比，避免误报公钥被移除
+func Diff(baseline, current *Snapshot) []Change {
+	var changes []Change
+	for _, name := range sortedKeys(baseline.Privileged, current.Privileged) {
+		before, had := baseline.Privileged[name]
+		after, has := current.Privileged[name]
+		switch {
+		case !had:
+			changes = append(changes, Change{Kind: ChangeUserAdded, Subject: name, Detail: fmt.Sprintf("用户 %s 获得特权（%s）", name, after)})
+		case !has:
+			changes = append(changes, Change{Kind: ChangeUserRemoved, Subject: name, Detail: fmt.Sprintf("用户 %s 不再拥有特权（原为 %s）", name, before)})
+		case before != after:
+			changes = append(changes, Change{Kind: ChangeUserPrivilege, Subject: name, Detail: fmt.Sprintf("用户 %s 的特权来源由 %s 变为 %s", name, before, after)})
+		}
+	}
+
+	skip := make(map[string]bool, len(current.Unreadable))
+	for _, name := range current.Unreadable {
+		skip[name] = true
+	}
+	for _, name := range sortedKeys(baseline.Keys, current.Keys) {
+		if skip[name] {
+			continue
+		}
+		before := keySet(baseline.Keys[name])
+		after := keySet(current.Keys[name])
+		for _, key := range current.Keys[name] {
+			if _, ok := before[key.Fingerprint]; !ok {
+				key := key
+				changes = append(changes, Change{Kind: ChangeKeyAdded, Subject: name, Key: &key, Detail: describeKey("用户 "+name+" 的 authorized_keys 新增公钥", key)})
+			}
+		}
+		for _, key := range baseline.Keys[name] {
+			if _, ok := after[key.Fingerprint]; !ok {
+				key := key
+				changes = append(changes, Change{Kind: ChangeKeyRemoved, Subject: name, Key: &key, Detail: describeKey("用户 "+name+" 的 authorized_keys 移除了公钥", key)})
+			}
+		}
+	}
+
+	for _, path := range sortedKeys(baseline.Sudoers, current.Sudoers) {
+		before, had := baseline.Sudoers[path]
+		after, has := current.Sudoers[path]
+		switch {
+		case !had:
+			changes = append(changes, Change{Kind: ChangeSudoersAdded, Subject: path, Detail: fmt.Sprintf("新增 sudoers 文件 %s (sha256 %s)", path, shortHash(after))})
+		case !has:
+			changes = append(changes, Change{Kind: ChangeSudoersRemoved, Subject: path, Detail: fmt.Sprintf("sudoers 文件 %s 被删除", path)})
+		case before != after:
+			changes = append(changes, Change{Kind: ChangeSudoersModified, Subject: path, Detail: fmt.Sprintf("sudoers 文件 %s 内容变化 (sha256 %s → %s)", path, shortHash(before), shortHash(after))})
+		}
+	}
+	return changes
+}
+
+func describeKey(prefix string, key Key) string {
+	detail := fmt.Sprintf("%s %s %s", prefix, key.Type, key.Fingerprint)
+	if key.Comment != "" {
+		detail += fmt.Sprintf("（注释 %s）", key.Comment)
+	}
+	return detail
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func keySet(keys []Key) map[string]Key {
+	set := make(map[string]Key, len(keys))
+	for _, key := range keys {
+		set[key.Fingerprint] = key
+	}
+	return set
+}
+
+// sortedKeys 两个 map 的键的并集，按字典序排列
+func sortedKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
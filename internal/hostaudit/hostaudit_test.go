@@ -0,0 +1,137 @@
+package hostaudit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testPasswd = `root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin
+alice:x:1000:1000:Alice:/home/alice:/bin/bash
+bob:x:1001:1001:Bob:/home/bob:/bin/bash
+`
+	testGroup = `root:x:0:
+sudo:x:27:alice
+wheel:x:10:
+alice:x:1000:
+bob:x:1001:
+`
+	// 测试用公钥，非真实密钥
+	testKeyA = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGJ0ZXN0LWtleS1hLWZvci1ob3N0YXVkaXQtdGVzdHM= alice@laptop"
+	testKeyB = `no-port-forwarding,command="/bin/echo hi" ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQC0ZXN0 deploy key`
+)
+
+// writeHost 在临时目录中写入主机文件
+func writeHost(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseAuthorizedKey(t *testing.T) {
+	key, ok := ParseAuthorizedKey(testKeyB)
+	if !ok || key.Type != "ssh-rsa" || key.Comment != "deploy key" || !strings.HasPrefix(key.Fingerprint, "SHA256:") {
+		t.Fatalf("Unexpected key %+v", key)
+	}
+	if strings.Contains(key.Fingerprint, "AAAAB3") {
+		t.Error("Fingerprint must not contain the key material")
+	}
+	if _, ok := ParseAuthorizedKey("not a key"); ok {
+		t.Error("Expected garbage to be rejected")
+	}
+}
+
+func TestAuditor_BaselineAndChanges(t *testing.T) {
+	root := t.TempDir()
+	writeHost(t, root, map[string]string{
+		"/etc/passwd":                       testPasswd,
+		"/etc/group":                        testGroup,
+		"/etc/sudoers":                      "root ALL=(ALL) ALL\n",
+		"/home/alice/.ssh/authorized_keys":  testKeyA + "\n",
+		"/etc/sudoers.d/README":             "# placeholder\n",
+		"/root/.ssh/authorized_keys":        "# no keys\n",
+		"/home/bob/.ssh/authorized_keys2":   "",
+		"/nonexistent/.ssh/authorized_keys": "",
+	})
+	baselinePath := filepath.Join(t.TempDir(), "baseline.json")
+	auditor := NewAuditor(baselinePath, root)
+
+	report, err := auditor.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Baselined || len(report.Changes) != 0 {
+		t.Fatalf("First audit should only establish a baseline, got %+v", report)
+	}
+	if report.Current.Privileged["root"] != "uid 0" || report.Current.Privileged["alice"] != "group sudo" || len(report.Current.Privileged) != 2 {
+		t.Errorf("Unexpected privileged users %v", report.Current.Privileged)
+	}
+	data, _ := os.ReadFile(baselinePath)
+	if strings.Contains(string(data), "AAAAC3") || strings.Contains(string(data), "root ALL") {
+		t.Errorf("Baseline must only store hashes and fingerprints, got %s", data)
+	}
+
+	// bob 加入 wheel、获得一个新公钥，sudoers.d 中新增文件
+	writeHost(t, root, map[string]string{
+		"/etc/group":                       strings.Replace(testGroup, "wheel:x:10:", "wheel:x:10:bob", 1),
+		"/home/bob/.ssh/authorized_keys":   testKeyB + "\n",
+		"/etc/sudoers.d/90-bob":            "bob ALL=(ALL) NOPASSWD:ALL\n",
+		"/etc/sudoers":                     "root ALL=(ALL) ALL\n%wheel ALL=(ALL) ALL\n",
+		"/home/alice/.ssh/authorized_keys": "",
+	})
+	// 重新加载基线
+	auditor = NewAuditor(baselinePath, root)
+	report, err = auditor.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, change := range report.Changes {
+		titles = append(titles, change.Kind+" "+change.Subject)
+	}
+	want := []string{
+		"user_added bob",
+		"key_removed alice",
+		"key_added bob",
+		"sudoers_modified /etc/sudoers",
+		"sudoers_added /etc/sudoers.d/90-bob",
+	}
+	if report.Baselined || strings.Join(titles, ";") != strings.Join(want, ";") {
+		t.Fatalf("Expected %v, got %v", want, titles)
+	}
+	if added := report.Changes[2]; !strings.Contains(added.Detail, "deploy key") || !strings.Contains(added.Title(), added.Key.Fingerprint) {
+		t.Errorf("Key change should describe the comment and fingerprint, got %+v", added)
+	}
+
+	if _, err := auditor.Accept("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := auditor.Check(); len(report.Changes) != 0 {
+		t.Errorf("Accepted state should no longer report changes, got %+v", report.Changes)
+	}
+}
+
+func TestDiff_SkipsUnreadableKeys(t *testing.T) {
+	baseline := &Snapshot{Keys: map[string][]Key{"root": {{Fingerprint: "SHA256:a", Type: "ssh-ed25519"}}}}
+	current := &Snapshot{Keys: map[string][]Key{}, Unreadable: []string{"root"}}
+	if changes := Diff(baseline, current); len(changes) != 0 {
+		t.Errorf("Unreadable key files should not be reported as removed, got %+v", changes)
+	}
+}
+
+func TestAuditor_NoPasswd(t *testing.T) {
+	if _, err := NewAuditor("", t.TempDir()).Check(); err == nil {
+		t.Error("Expected an error without /etc/passwd")
+	}
+}
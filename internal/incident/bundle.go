@@ -0,0 +1,475 @@
+package incident
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"qwq/internal/events"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+	"qwq/internal/security"
+)
+
+var (
+	// ErrIncidentNotFound 巡检记录不存在
+	ErrIncidentNotFound = errors.New("incident not found")
+	// ErrNoAnomalies 巡检记录没有异常，不是事件
+	ErrNoAnomalies = errors.New("patrol run has no anomalies")
+)
+
+// DefaultMargin 指标历史和审计日志在事件前后额外包含的时间
+const DefaultMargin = 30 * time.Minute
+
+// auditMarker 审计日志行的标记
+const auditMarker = "[AUDIT]"
+
+// TimelineEvent 事件时间线中的一项
+type TimelineEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"` // patrol_started / finding / patrol_finished / notified / chat / command / audit / event
+	Detail string    `json:"detail"`
+	Source string    `json:"source,omitempty"` // 对话会话 ID、日志文件名或时间线事件的来源和类型
+}
+
+// Timeline 复盘包中的 timeline.json
+type Timeline struct {
+	ID         int64           `json:"id"`
+	Trigger    string          `json:"trigger"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Anomalies  int             `json:"anomalies"`
+	Notified   bool            `json:"notified"`
+	From       time.Time       `json:"from"` // 复盘包覆盖的时间范围
+	To         time.Time       `json:"to"`
+	Events     []TimelineEvent `json:"events"`
+}
+
+// Command 关联对话中执行过的命令及其输出
+type Command struct {
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+	User    string    `json:"user"`
+	Command string    `json:"command"`
+	Output  string    `json:"output"`
+}
+
+// Bundle 巡检事件复盘包生成器
+type Bundle struct {
+	Runs        *patrol.Store
+	Transcripts *Transcripts
+	History     *monitor.History
+	LogFiles    func() ([]logger.LogFile, error) // 审计日志来源
+	Events      *events.Store                    // 事件时间线，为空时复盘包不包含同时段的其他事件
+	Margin      time.Duration
+}
+
+// NewBundle 使用全局巡检记录、对话记录、指标历史、日志文件和事件时间线创建复盘包生成器
+func NewBundle() *Bundle {
+	return &Bundle{
+		Runs:        patrol.DefaultStore,
+		Transcripts: DefaultTranscripts,
+		History:     monitor.DefaultHistory,
+		LogFiles:    logger.ListFiles,
+		Events:      events.Default(),
+		Margin:      DefaultMargin,
+	}
+}
+
+// Write 将巡检事件的复盘包以 zip 格式写入 w，内容逐个文件流式写出，所有文本都经过脱敏
+// 包含 timeline.json、run.json、analysis.md、transcripts/*.jsonl、commands.json、events.json、audit.log 和 stats.csv
+func (b *Bundle) Write(w io.Writer, id int64) error {
+	run, ok := b.Runs.Get(id)
+	if !ok {
+		return fmt.Errorf("%w: #%d", ErrIncidentNotFound, id)
+	}
+	if run.Anomalies == 0 {
+		return fmt.Errorf("%w: #%d", ErrNoAnomalies, id)
+	}
+
+	finished := run.FinishedAt
+	if finished.IsZero() {
+		finished = run.StartedAt
+	}
+	from, to := run.StartedAt.Add(-b.Margin), finished.Add(b.Margin)
+
+	transcripts, err := b.Transcripts.ForIncident(id)
+	if err != nil {
+		return err
+	}
+	audit, err := b.auditLines(from, to)
+	if err != nil {
+		return err
+	}
+	commands := collectCommands(transcripts)
+	related, err := b.relatedEvents(from, to)
+	if err != nil {
+		return err
+	}
+
+	timeline := Timeline{
+		ID: run.ID, Trigger: run.Trigger, StartedAt: run.StartedAt, FinishedAt: run.FinishedAt,
+		Anomalies: run.Anomalies, Notified: run.Notified, From: from, To: to,
+		Events: buildEvents(run, transcripts, audit, related),
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeJSON(zw, "timeline.json", timeline); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "run.json", run); err != nil {
+		return err
+	}
+	if err := writeEntry(zw, "analysis.md", func(w io.Writer) error {
+		_, err := io.WriteString(w, formatAnalysis(run))
+		return err
+	}); err != nil {
+		return err
+	}
+	for _, transcript := range transcripts {
+		transcript := transcript
+		if err := writeEntry(zw, "transcripts/"+transcript.Session+".jsonl", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			for _, entry := range transcript.Entries {
+				if err := enc.Encode(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if err := writeJSON(zw, "commands.json", commands); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "events.json", related); err != nil {
+		return err
+	}
+	if err := writeEntry(zw, "audit.log", func(w io.Writer) error {
+		for _, line := range audit {
+			if _, err := fmt.Fprintf(w, "%s %s\n", line.Time.Format("2006-01-02 15:04:05"), line.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := writeEntry(zw, "stats.csv", func(w io.Writer) error {
+		return b.writeStats(w, from, to)
+	}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeEntry 在 zip 中创建文件，写入的内容按行脱敏
+func writeEntry(zw *zip.Writer, name string, fn func(w io.Writer) error) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	rw := &redactWriter{w: f}
+	if err := fn(rw); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return rw.Flush()
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	return writeEntry(zw, name, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	})
+}
+
+// redactWriter 按行脱敏后写入，IP、邮箱和密钥都不会跨行
+type redactWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	r.buf = append(r.buf, p...)
+	for {
+		i := bytes.IndexByte(r.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(r.w, security.Redact(string(r.buf[:i+1]))); err != nil {
+			return 0, err
+		}
+		r.buf = r.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush 写出最后一行未换行的内容
+func (r *redactWriter) Flush() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, security.Redact(string(r.buf)))
+	r.buf = nil
+	return err
+}
+
+// formatAnalysis 生成 analysis.md：AI 分析、压缩发送的异常和原始异常报告
+func formatAnalysis(run *patrol.Run) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# 巡检事件 #%d 复盘\n\n", run.ID)
+	fmt.Fprintf(&builder, "- 触发方式: %s\n- 开始时间: %s\n- 异常数量: %d\n\n",
+		run.Trigger, run.StartedAt.Format("2006-01-02 15:04:05"), run.Anomalies)
+	builder.WriteString("## AI 分析\n\n")
+	if run.Analysis != "" {
+		builder.WriteString(run.Analysis + "\n\n")
+	} else {
+		builder.WriteString("(无)\n\n")
+	}
+	if len(run.Condensed) > 0 {
+		builder.WriteString("## 压缩后发送给 AI 的异常\n\n")
+		for _, title := range run.Condensed {
+			builder.WriteString("- " + title + "\n")
+		}
+		builder.WriteString("\n")
+	}
+	if run.Report != "" {
+		builder.WriteString("## 异常报告\n\n```\n" + run.Report + "\n```\n")
+	}
+	return builder.String()
+}
+
+// collectCommands 将对话中的命令与紧随其后的输出配对
+func collectCommands(transcripts []Transcript) []Command {
+	commands := []Command{}
+	for _, transcript := range transcripts {
+		for i, entry := range transcript.Entries {
+			if entry.Role != RoleCommand {
+				continue
+			}
+			command := Command{Time: entry.Time, Session: entry.Session, User: entry.User, Command: entry.Content}
+			if i+1 < len(transcript.Entries) && transcript.Entries[i+1].Role == RoleOutput {
+				command.Output = transcript.Entries[i+1].Content
+			}
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// buildEvents 合并巡检过程、关联对话、审计日志和同时段的时间线事件，按时间排序
+func buildEvents(run *patrol.Run, transcripts []Transcript, audit []auditLine, related []events.Event) []TimelineEvent {
+	timeline := []TimelineEvent{{Time: run.StartedAt, Kind: "patrol_started", Detail: "巡检开始 (" + run.Trigger + ")"}}
+	for _, finding := range run.Findings() {
+		timeline = append(timeline, TimelineEvent{Time: run.StartedAt, Kind: "finding", Detail: finding.Title})
+	}
+	if !run.FinishedAt.IsZero() {
+		timeline = append(timeline, TimelineEvent{Time: run.FinishedAt, Kind: "patrol_finished", Detail: fmt.Sprintf("巡检结束，%d 项异常", run.Anomalies)})
+		if run.Notified {
+			timeline = append(timeline, TimelineEvent{Time: run.FinishedAt, Kind: "notified", Detail: "告警已推送"})
+		}
+	}
+	for _, transcript := range transcripts {
+		for _, entry := range transcript.Entries {
+			kind := "chat"
+			if entry.Role == RoleOutput {
+				continue
+			}
+			if entry.Role == RoleCommand {
+				kind = "command"
+			}
+			timeline = append(timeline, TimelineEvent{
+				Time:   entry.Time,
+				Kind:   kind,
+				Detail: entry.User + " (" + entry.Role + "): " + firstLine(entry.Content),
+				Source: entry.Session,
+			})
+		}
+	}
+	for _, line := range audit {
+		timeline = append(timeline, TimelineEvent{Time: line.Time, Kind: "audit", Detail: line.Text, Source: line.File})
+	}
+	for _, event := range related {
+		detail := event.Message
+		if event.Actor != "" {
+			detail += " by " + event.Actor
+		}
+		timeline = append(timeline, TimelineEvent{Time: event.Time, Kind: "event", Detail: detail, Source: event.Source + "/" + event.Type})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].Time.Before(timeline[j].Time) })
+	return timeline
+}
+
+// relatedEvents 复盘时间范围内时间线上的其他事件（Docker 事件、部署、自愈、配置变更），未启用时间线时为空
+func (b *Bundle) relatedEvents(from, to time.Time) ([]events.Event, error) {
+	if b.Events == nil {
+		return []events.Event{}, nil
+	}
+	list, err := b.Events.Query(context.Background(), events.Query{From: from, To: to, Limit: events.MaxQueryLimit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	if list == nil {
+		list = []events.Event{}
+	}
+	return list, nil
+}
+
+func firstLine(text string) string {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i] + " …"
+	}
+	if len(text) > 200 {
+		text = text[:200] + " …"
+	}
+	return text
+}
+
+// auditLine 审计日志中的一行
+type auditLine struct {
+	Time time.Time
+	Text string
+	File string
+}
+
+// auditLines 读取时间范围内的审计日志
+// 日志行只记录时分秒，日期取时间范围内能落入该范围的那一天，只读取范围开始后写入过的日志文件
+func (b *Bundle) auditLines(from, to time.Time) ([]auditLine, error) {
+	if b.LogFiles == nil {
+		return nil, nil
+	}
+	files, err := b.LogFiles()
+	if errors.Is(err, logger.ErrNotInitialized) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []auditLine
+	for _, file := range files {
+		if file.ModTime.Before(from) {
+			continue
+		}
+		found, err := readAuditFile(file, from, to)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, found...)
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	return lines, nil
+}
+
+func readAuditFile(file logger.LogFile, from, to time.Time) ([]auditLine, error) {
+	f, err := os.Open(file.Path())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if file.Compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var lines []auditLine
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if !strings.Contains(text, auditMarker) {
+			continue
+		}
+		t, ok := lineTime(text, from, to)
+		if !ok {
+			continue
+		}
+		lines = append(lines, auditLine{Time: t, Text: strings.TrimSpace(text[strings.Index(text, "]")+1:]), File: file.Name})
+	}
+	return lines, scanner.Err()
+}
+
+// lineTime 解析 "[15:04:05] ..." 格式的日志时间，并放到 [from, to] 内的某一天
+func lineTime(text string, from, to time.Time) (time.Time, bool) {
+	if len(text) < 10 || text[0] != '[' || text[9] != ']' {
+		return time.Time{}, false
+	}
+	clock, err := time.ParseInLocation("15:04:05", text[1:9], from.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	for day := from; !day.After(to.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		t := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, from.Location())
+		if !t.Before(from) && !t.After(to) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// writeStats 写出时间范围内的指标历史，每行一个时间点，每列一个指标的平均值
+func (b *Bundle) writeStats(w io.Writer, from, to time.Time) error {
+	rows := make(map[time.Time]map[string]float64)
+	if b.History != nil {
+		buckets := int(to.Sub(from) / time.Minute)
+		for _, metric := range monitor.KnownMetrics {
+			series, err := b.History.Query(metric, from, to, buckets, monitor.AggAvg)
+			if err != nil {
+				return err
+			}
+			for _, point := range series.Points {
+				if rows[point.Time] == nil {
+					rows[point.Time] = make(map[string]float64)
+				}
+				rows[point.Time][metric] = point.Value
+			}
+		}
+	}
+	times := make([]time.Time, 0, len(rows))
+	for t := range rows {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"time"}, monitor.KnownMetrics...)); err != nil {
+		return err
+	}
+	for _, t := range times {
+		record := []string{t.Format(time.RFC3339)}
+		for _, metric := range monitor.KnownMetrics {
+			if v, ok := rows[t][metric]; ok {
+				record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+			} else {
+				record = append(record, "")
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
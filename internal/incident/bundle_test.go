@@ -0,0 +1,205 @@
+package incident
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/events"
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+
+	"github.com/sashabaranov/go-openai"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func setupBundle(t *testing.T) (*Bundle, *patrol.Run) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	runs := patrol.NewStore(10)
+	run := &patrol.Run{
+		Trigger:    "schedule",
+		StartedAt:  start,
+		FinishedAt: start.Add(10 * time.Second),
+		Anomalies:  1,
+		Report:     "disk usage 95% on 10.0.0.5",
+		Analysis:   "清理 /var/log",
+		Results: []*patrol.CheckResult{{
+			Check:    "disk",
+			Verdict:  patrol.VerdictAlert,
+			Findings: []patrol.Finding{{Title: "磁盘告警 (/dev/sda1)"}},
+		}},
+	}
+	runs.Save(run)
+	runs.Save(&patrol.Run{Trigger: "manual", StartedAt: start})
+
+	history := monitor.NewHistory("", time.Minute, 24*time.Hour)
+	history.Add(start, map[string]float64{monitor.MetricLoad: 3.5, monitor.MetricDiskPct: 95})
+	history.Add(start.Add(2*time.Minute), map[string]float64{monitor.MetricLoad: 1.5})
+	history.Add(start.Add(-2*time.Hour), map[string]float64{monitor.MetricLoad: 9})
+
+	transcripts := NewTranscripts(t.TempDir())
+	linked := transcripts.Session(SourceWeb, "admin")
+	linked.Record(RoleUser, "巡检 #1 的磁盘告警怎么处理？ops@example.com")
+	linked.RecordMessages([]openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+			Function: openai.FunctionCall{Name: "execute_shell_command", Arguments: `{"command":"du -sh /var/log","reason":"check"}`},
+		}}},
+		{Role: openai.ChatMessageRoleTool, Content: "2.1G /var/log"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "日志占用 2.1G"},
+	})
+	transcripts.Session(SourceCLI, "root").Record(RoleUser, "巡检 #2 是什么")
+
+	return &Bundle{Runs: runs, Transcripts: transcripts, History: history, Margin: DefaultMargin}, run
+}
+
+func readBundle(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestBundle_Write(t *testing.T) {
+	bundle, run := setupBundle(t)
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, run.ID); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+
+	for _, name := range []string{"timeline.json", "run.json", "analysis.md", "commands.json", "events.json", "audit.log", "stats.csv"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Missing %s in bundle", name)
+		}
+	}
+	var transcriptFiles []string
+	for name := range files {
+		if strings.HasPrefix(name, "transcripts/") {
+			transcriptFiles = append(transcriptFiles, name)
+		}
+	}
+	if len(transcriptFiles) != 1 || !strings.HasPrefix(transcriptFiles[0], "transcripts/web-") {
+		t.Errorf("Expected only the linked web session, got %v", transcriptFiles)
+	}
+
+	var timeline Timeline
+	if err := json.Unmarshal([]byte(files["timeline.json"]), &timeline); err != nil {
+		t.Fatalf("Invalid timeline: %v", err)
+	}
+	kinds := make(map[string]int)
+	for _, event := range timeline.Events {
+		kinds[event.Kind]++
+	}
+	if kinds["finding"] != 1 || kinds["command"] != 1 || kinds["chat"] != 2 {
+		t.Errorf("Unexpected timeline events %+v", timeline.Events)
+	}
+
+	var commands []Command
+	json.Unmarshal([]byte(files["commands.json"]), &commands)
+	if len(commands) != 1 || commands[0].Command != "du -sh /var/log" || commands[0].Output != "2.1G /var/log" {
+		t.Errorf("Expected command paired with output, got %+v", commands)
+	}
+
+	for name, content := range files {
+		if strings.Contains(content, "10.0.0.5") || strings.Contains(content, "ops@example.com") {
+			t.Errorf("%s must be redacted:\n%s", name, content)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(files["stats.csv"]), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "time,load,") || !strings.Contains(lines[1], ",3.5,") {
+		t.Errorf("Expected 2 stats rows inside the window, got %q", files["stats.csv"])
+	}
+}
+
+func TestBundle_RelatedEvents(t *testing.T) {
+	bundle, run := setupBundle(t)
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&events.Event{})
+	store := events.NewStore(db, 0)
+	ctx := context.Background()
+	store.Record(ctx, events.Event{Time: run.StartedAt.Add(-time.Minute), Source: events.SourceDocker, Type: events.TypeContainer,
+		Action: "restart", Actor: "dockerd", Target: "db", Message: "container db restart"})
+	store.Record(ctx, events.Event{Time: run.StartedAt.Add(-2 * time.Hour), Type: events.TypeDeployment, Message: "too early"})
+	bundle.Events = store
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, run.ID); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+	var related []events.Event
+	if err := json.Unmarshal([]byte(files["events.json"]), &related); err != nil || len(related) != 1 || related[0].Target != "db" {
+		t.Fatalf("Expected only the restart inside the window, got %v %s", err, files["events.json"])
+	}
+	var timeline Timeline
+	json.Unmarshal([]byte(files["timeline.json"]), &timeline)
+	if first := timeline.Events[0]; first.Kind != "event" || first.Detail != "container db restart by dockerd" || first.Source != "docker/container" {
+		t.Errorf("Expected the restart to open the timeline, got %+v", first)
+	}
+}
+
+func TestBundle_WriteErrors(t *testing.T) {
+	bundle, _ := setupBundle(t)
+	if err := bundle.Write(io.Discard, 99); !errors.Is(err, ErrIncidentNotFound) {
+		t.Errorf("Expected ErrIncidentNotFound, got %v", err)
+	}
+	if err := bundle.Write(io.Discard, 2); !errors.Is(err, ErrNoAnomalies) {
+		t.Errorf("Expected ErrNoAnomalies, got %v", err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	for text, want := range map[string][]int64{
+		"看一下巡检 #12 和 incident#3":         {12, 3},
+		"http://host/patrol/runs/7 又出现了": {7},
+		"run 5 commands":                 nil,
+	} {
+		got := References(text)
+		if len(got) != len(want) {
+			t.Errorf("References(%q) = %v, want %v", text, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("References(%q) = %v, want %v", text, got, want)
+			}
+		}
+	}
+}
+
+func TestLineTime(t *testing.T) {
+	from := time.Date(2026, 6, 1, 23, 30, 0, 0, time.Local)
+	to := from.Add(time.Hour)
+	if got, ok := lineTime("[00:10:00] [AUDIT] x", from, to); !ok || got.Day() != 2 {
+		t.Errorf("Expected line after midnight to fall on the next day, got %v %v", got, ok)
+	}
+	if _, ok := lineTime("[12:00:00] [AUDIT] x", from, to); ok {
+		t.Error("Expected line outside the window to be skipped")
+	}
+}
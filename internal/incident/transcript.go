@@ -0,0 +1,271 @@
+// Package incident 记录 Web 和 CLI 的对话记录，并把巡检事件的时间线、相关对话、执行过的命令、
+// 指标历史和 AI 分析打包成可分享的复盘包
+package incident
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+	"qwq/internal/security"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 对话来源
+const (
+	SourceWeb = "web"
+	SourceCLI = "cli"
+)
+
+// 对话条目角色
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleCommand   = "command" // Agent 或快速命令执行的命令
+	RoleOutput    = "output"  // 命令输出
+)
+
+// systemOutputPrefix Agent 回传文本回退命令输出时使用的前缀
+const systemOutputPrefix = "[System Output]:"
+
+// maxEntryLength 单条记录内容的最大长度，超长的命令输出被截断
+const maxEntryLength = 64 * 1024
+
+// referenceRegex 对话中引用巡检事件的写法，如 "巡检 #12"、"incident #12" 或面板链接 /patrol/runs/12
+var referenceRegex = regexp.MustCompile(`(?i)(?:(?:incident|patrol|run|巡检|事件|告警)\s*#\s*|/patrol/runs/|/incidents/)(\d+)`)
+
+// Entry 对话记录中的一条消息
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Session   string    `json:"session"`
+	Source    string    `json:"source"`
+	User      string    `json:"user"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Incidents []int64   `json:"incidents,omitempty"` // 内容中引用的巡检记录 ID
+}
+
+// Transcript 一次对话会话的完整记录
+type Transcript struct {
+	Session string  `json:"session"`
+	Source  string  `json:"source"`
+	User    string  `json:"user"`
+	Entries []Entry `json:"entries"`
+}
+
+// Transcripts 对话记录存储，每个会话一个 JSONL 文件，写入前脱敏
+type Transcripts struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewTranscripts 创建对话记录存储，dir 为空时不记录
+func NewTranscripts(dir string) *Transcripts {
+	return &Transcripts{dir: dir}
+}
+
+// DefaultTranscripts 全局对话记录存储
+var DefaultTranscripts = NewTranscripts("qwq_transcripts")
+
+// References 提取文本中引用的巡检记录 ID
+func References(text string) []int64 {
+	var ids []int64
+	for _, match := range referenceRegex.FindAllStringSubmatch(text, -1) {
+		id, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil && !containsID(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Session 开始一个新的对话会话
+func (t *Transcripts) Session(source, user string) *Session {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	id := fmt.Sprintf("%s-%s-%s", source, time.Now().Format("20060102-150405"), hex.EncodeToString(buf))
+	return &Session{store: t, ID: id, Source: source, User: user}
+}
+
+// append 追加一条记录，写入失败不影响对话
+func (t *Transcripts) append(entry Entry) error {
+	if t.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(t.dir, entry.Session+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ForIncident 返回引用过指定巡检记录的全部会话，按开始时间排序
+func (t *Transcripts) ForIncident(id int64) ([]Transcript, error) {
+	if t.dir == "" {
+		return nil, nil
+	}
+	files, err := filepath.Glob(filepath.Join(t.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var transcripts []Transcript
+	for _, file := range files {
+		transcript, linked, err := readTranscript(file, id)
+		if err != nil {
+			return nil, err
+		}
+		if linked {
+			transcripts = append(transcripts, transcript)
+		}
+	}
+	sort.Slice(transcripts, func(i, j int) bool {
+		return transcripts[i].Entries[0].Time.Before(transcripts[j].Entries[0].Time)
+	})
+	return transcripts, nil
+}
+
+// Delete 删除一个会话的对话记录，会话不存在时忽略
+func (t *Transcripts) Delete(session string) error {
+	if t.dir == "" {
+		return nil
+	}
+	if session == "" || session != filepath.Base(session) || strings.HasPrefix(session, ".") {
+		return fmt.Errorf("invalid transcript session %q", session)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.Remove(filepath.Join(t.dir, session+".jsonl")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// readTranscript 读取会话文件，并判断其中是否引用了指定巡检记录
+func readTranscript(path string, id int64) (Transcript, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Transcript{}, false, err
+	}
+	defer f.Close()
+
+	var transcript Transcript
+	linked := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*maxEntryLength)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if containsID(entry.Incidents, id) {
+			linked = true
+		}
+		transcript.Entries = append(transcript.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return Transcript{}, false, fmt.Errorf("failed to read transcript %s: %w", filepath.Base(path), err)
+	}
+	if len(transcript.Entries) == 0 {
+		return transcript, false, nil
+	}
+	first := transcript.Entries[0]
+	transcript.Session, transcript.Source, transcript.User = first.Session, first.Source, first.User
+	return transcript, linked, nil
+}
+
+// Session 正在进行的对话会话
+type Session struct {
+	store  *Transcripts
+	ID     string
+	Source string
+	User   string
+	// Tee 收到每条脱敏后的记录，如同时写入 Web 控制台的对话历史；为 nil 时忽略
+	Tee func(role, content string)
+}
+
+// Record 记录一条消息
+func (s *Session) Record(role, content string) {
+	if s == nil || strings.TrimSpace(content) == "" {
+		return
+	}
+	if len(content) > maxEntryLength {
+		content = content[:maxEntryLength] + "\n... (truncated)"
+	}
+	content = security.Redact(content)
+	entry := Entry{
+		Time:      time.Now(),
+		Session:   s.ID,
+		Source:    s.Source,
+		User:      s.User,
+		Role:      role,
+		Content:   content,
+		Incidents: References(content),
+	}
+	if err := s.store.append(entry); err != nil {
+		logger.Info("记录对话失败: %v", err)
+	}
+	if s.Tee != nil {
+		s.Tee(role, content)
+	}
+}
+
+// RecordMessages 记录 Agent 对话新增的消息：回答、调用的命令和命令输出
+// 用户消息由调用方在附加上下文之前单独记录
+func (s *Session) RecordMessages(msgs []openai.ChatCompletionMessage) {
+	for _, msg := range msgs {
+		switch msg.Role {
+		case openai.ChatMessageRoleAssistant:
+			s.Record(RoleAssistant, msg.Content)
+			for _, call := range msg.ToolCalls {
+				var args map[string]string
+				json.Unmarshal([]byte(call.Function.Arguments), &args)
+				if command := args["command"]; command != "" {
+					s.Record(RoleCommand, command)
+				} else {
+					s.Record(RoleCommand, call.Function.Name+" "+call.Function.Arguments)
+				}
+			}
+		case openai.ChatMessageRoleTool:
+			s.Record(RoleOutput, msg.Content)
+		case openai.ChatMessageRoleUser:
+			// 从回答文本中捕获并自动执行的命令，输出以用户消息的形式回传给模型
+			if output, ok := strings.CutPrefix(msg.Content, systemOutputPrefix); ok {
+				s.Record(RoleOutput, strings.TrimPrefix(output, "\n"))
+			}
+		}
+	}
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
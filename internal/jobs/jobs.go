@@ -0,0 +1,415 @@
+// Package jobs 统一调度后台定时任务：每个任务以名称、执行间隔和处理函数注册，
+// 每次执行的开始/结束时间、结果和错误记录到数据库，支持手动触发和暂停
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+	"qwq/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidJob 任务定义无效
+	ErrInvalidJob = errors.New("invalid job")
+	// ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobQueued 任务已在执行队列中，同一任务同时最多排队一次
+	ErrJobQueued = errors.New("job already queued")
+)
+
+// 执行结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailed  = "failed"
+)
+
+// 触发方式
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// DefaultFailureThreshold 连续失败达到该次数时任务视为异常
+const DefaultFailureThreshold = 3
+
+// maxErrorLength 记录的错误信息最大长度
+const maxErrorLength = 2000
+
+// Job 定时任务
+type Job struct {
+	Name        string
+	Description string
+	Interval    time.Duration
+	// RunAtStart 启动后经过 StartDelay 立即执行一次，否则等待一个 Interval 后首次执行
+	RunAtStart bool
+	StartDelay time.Duration
+	Handler    func(ctx context.Context) error
+}
+
+// JobRun 一次任务执行记录
+type JobRun struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Job        string    `json:"job" gorm:"size:64;index"`
+	Trigger    string    `json:"trigger" gorm:"size:16"`
+	StartedAt  time.Time `json:"started_at" gorm:"index"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Outcome    string    `json:"outcome" gorm:"size:16"`
+	Error      string    `json:"error,omitempty" gorm:"type:text"`
+}
+
+// JobState 任务的持久化状态，暂停在重启后仍然有效
+type JobState struct {
+	Name      string    `json:"name" gorm:"primaryKey;size:64"`
+	Paused    bool      `json:"paused"`
+	PausedBy  string    `json:"paused_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Status 任务状态，用于面板展示
+type Status struct {
+	Name                string     `json:"name"`
+	Description         string     `json:"description"`
+	Interval            string     `json:"interval"`
+	Paused              bool       `json:"paused"`
+	PausedBy            string     `json:"paused_by,omitempty"`
+	Running             bool       `json:"running"`
+	Queued              bool       `json:"queued"`
+	NextRun             *time.Time `json:"next_run,omitempty"` // 暂停时为空
+	LastRun             *JobRun    `json:"last_run,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Failing             bool       `json:"failing"` // 连续失败次数达到阈值
+	History             []*JobRun  `json:"history,omitempty"`
+}
+
+// entry 已注册任务的运行状态
+type entry struct {
+	job      Job
+	queue    chan string // 待执行的手动触发，容量为 1
+	running  bool
+	paused   bool
+	pausedBy string
+	next     time.Time
+	failures int
+	last     *JobRun
+}
+
+// Scheduler 任务调度器
+// 每个任务在独立的 goroutine 中按间隔执行，同一任务不会并发执行；
+// 执行期间的手动触发排队一次，执行结束后立即补跑
+type Scheduler struct {
+	db               *gorm.DB
+	FailureThreshold int
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	started bool
+}
+
+// NewScheduler 创建任务调度器，db 为 nil 时执行记录只保留在内存中（仅最近一次）
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{db: db, FailureThreshold: DefaultFailureThreshold, jobs: make(map[string]*entry)}
+}
+
+// Register 注册任务，需在 Start 之前调用
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || len(job.Name) > 64 || job.Interval <= 0 || job.Handler == nil {
+		return fmt.Errorf("%w: %q requires a name, a positive interval and a handler", ErrInvalidJob, job.Name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("%w: %s registered after the scheduler started", ErrInvalidJob, job.Name)
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: duplicate job %s", ErrInvalidJob, job.Name)
+	}
+	s.jobs[job.Name] = &entry{job: job, queue: make(chan string, 1)}
+	return nil
+}
+
+// Start 恢复暂停状态和连续失败次数，并在监管下启动所有任务，直到 ctx 取消
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.started = true
+	entries := make([]*entry, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		s.restore(ctx, e)
+		e := e
+		go utils.Supervise(ctx, "job:"+e.job.Name, func(ctx context.Context) {
+			s.loop(ctx, e)
+		})
+	}
+	logger.Info("📅 已启动 %d 个定时任务", len(entries))
+}
+
+// restore 从数据库读取暂停状态、最近一次执行和连续失败次数
+func (s *Scheduler) restore(ctx context.Context, e *entry) {
+	if s.db == nil {
+		return
+	}
+	var state JobState
+	if err := s.db.WithContext(ctx).Where("name = ?", e.job.Name).Limit(1).Find(&state).Error; err != nil {
+		logger.Info("⚠️ 读取任务 %s 状态失败: %v", e.job.Name, err)
+	}
+	var runs []*JobRun
+	if err := s.db.WithContext(ctx).Where("job = ?", e.job.Name).Order("id DESC").Limit(s.threshold()).Find(&runs).Error; err != nil {
+		logger.Info("⚠️ 读取任务 %s 执行记录失败: %v", e.job.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.paused, e.pausedBy = state.Paused, state.PausedBy
+	if len(runs) > 0 {
+		e.last = runs[0]
+	}
+	for _, run := range runs {
+		if run.Outcome != OutcomeFailed {
+			break
+		}
+		e.failures++
+	}
+}
+
+// loop 按间隔执行任务，暂停时跳过定时执行，手动触发不受暂停影响
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	first := e.job.Interval
+	if e.job.RunAtStart {
+		first = e.job.StartDelay
+	}
+	timer := time.NewTimer(first)
+	defer timer.Stop()
+	s.setNext(e, time.Now().Add(first))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case trigger := <-e.queue:
+			s.execute(ctx, e, trigger)
+		case <-timer.C:
+			if s.isPaused(e) {
+				logger.Debug("⏸️ 任务 %s 已暂停，跳过本次执行", e.job.Name)
+			} else {
+				s.execute(ctx, e, TriggerSchedule)
+			}
+			s.setNext(e, time.Now().Add(e.job.Interval))
+			timer.Reset(e.job.Interval)
+		}
+	}
+}
+
+// Trigger 手动触发任务，任务正在执行时排队到本次执行结束后；已有排队时返回 ErrJobQueued
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	select {
+	case e.queue <- TriggerManual:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrJobQueued, name)
+	}
+}
+
+// Pause 暂停任务的定时执行，直到 Resume
+func (s *Scheduler) Pause(ctx context.Context, name, user string) error {
+	return s.setPaused(ctx, name, true, user)
+}
+
+// Resume 恢复任务的定时执行
+func (s *Scheduler) Resume(ctx context.Context, name string) error {
+	return s.setPaused(ctx, name, false, "")
+}
+
+func (s *Scheduler) setPaused(ctx context.Context, name string, paused bool, user string) error {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if s.db != nil {
+		state := JobState{Name: name, Paused: paused, PausedBy: user, UpdatedAt: time.Now()}
+		if err := s.db.WithContext(ctx).Save(&state).Error; err != nil {
+			return fmt.Errorf("failed to save job state: %w", err)
+		}
+	}
+	s.mu.Lock()
+	e.paused, e.pausedBy = paused, user
+	s.mu.Unlock()
+	return nil
+}
+
+// execute 执行一次任务并记录结果，处理函数 panic 按失败记录
+func (s *Scheduler) execute(ctx context.Context, e *entry, trigger string) {
+	s.mu.Lock()
+	e.running = true
+	s.mu.Unlock()
+
+	run := &JobRun{Job: e.job.Name, Trigger: trigger, StartedAt: time.Now()}
+	err := runHandler(ctx, e.job)
+	run.FinishedAt = time.Now()
+	run.DurationMS = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.Outcome = OutcomeSuccess
+	if err != nil {
+		run.Outcome = OutcomeFailed
+		run.Error = err.Error()
+		if len(run.Error) > maxErrorLength {
+			run.Error = run.Error[:maxErrorLength]
+		}
+	}
+	if s.db != nil {
+		if dbErr := s.db.WithContext(context.WithoutCancel(ctx)).Create(run).Error; dbErr != nil {
+			logger.Info("⚠️ 保存任务 %s 执行记录失败: %v", e.job.Name, dbErr)
+		}
+	}
+
+	s.mu.Lock()
+	e.running = false
+	e.last = run
+	if err != nil {
+		e.failures++
+	} else {
+		e.failures = 0
+	}
+	failures := e.failures
+	s.mu.Unlock()
+
+	if err != nil {
+		logger.Info("❌ 任务 %s 执行失败 (连续 %d 次): %v", e.job.Name, failures, err)
+	}
+}
+
+// runHandler 执行处理函数，panic 时记录堆栈并转换为错误
+func runHandler(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.RecordPanic("job:"+job.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Handler(ctx)
+}
+
+func (s *Scheduler) setNext(e *entry, next time.Time) {
+	s.mu.Lock()
+	e.next = next
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) isPaused(e *entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return e.paused
+}
+
+func (s *Scheduler) threshold() int {
+	if s.FailureThreshold > 0 {
+		return s.FailureThreshold
+	}
+	return DefaultFailureThreshold
+}
+
+// List 返回所有任务的状态（按名称排序），history 为每个任务附带的最近执行记录条数
+func (s *Scheduler) List(ctx context.Context, history int) ([]*Status, error) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	statuses := make([]*Status, 0, len(names))
+	for _, name := range names {
+		status, err := s.Get(ctx, name, history)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Get 返回任务状态和最近 history 条执行记录
+func (s *Scheduler) Get(ctx context.Context, name string, history int) (*Status, error) {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	status := &Status{
+		Name:                name,
+		Description:         e.job.Description,
+		Interval:            e.job.Interval.String(),
+		Paused:              e.paused,
+		PausedBy:            e.pausedBy,
+		Running:             e.running,
+		Queued:              len(e.queue) > 0,
+		LastRun:             e.last,
+		ConsecutiveFailures: e.failures,
+		Failing:             e.failures >= s.threshold(),
+	}
+	if !e.paused && !e.next.IsZero() {
+		next := e.next
+		status.NextRun = &next
+	}
+	s.mu.Unlock()
+
+	if history > 0 && s.db != nil {
+		if err := s.db.WithContext(ctx).Where("job = ?", name).Order("id DESC").Limit(history).Find(&status.History).Error; err != nil {
+			return nil, fmt.Errorf("failed to list job runs: %w", err)
+		}
+	}
+	return status, nil
+}
+
+// Failing 返回连续失败次数达到阈值的任务
+func (s *Scheduler) Failing() []*Status {
+	statuses, _ := s.List(context.Background(), 0)
+	var failing []*Status
+	for _, status := range statuses {
+		if status.Failing {
+			failing = append(failing, status)
+		}
+	}
+	return failing
+}
+
+var (
+	defaultScheduler   *Scheduler
+	defaultSchedulerMu sync.RWMutex
+)
+
+// SetDefault 设置全局任务调度器
+func SetDefault(scheduler *Scheduler) {
+	defaultSchedulerMu.Lock()
+	defaultScheduler = scheduler
+	defaultSchedulerMu.Unlock()
+}
+
+// Default 返回全局任务调度器，未启动时返回 nil
+func Default() *Scheduler {
+	defaultSchedulerMu.RLock()
+	defer defaultSchedulerMu.RUnlock()
+	return defaultScheduler
+}
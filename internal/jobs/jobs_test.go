@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&JobRun{}, &JobState{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+// waitFor 等待条件成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScheduler_RegisterValidation(t *testing.T) {
+	scheduler := NewScheduler(nil)
+	handler := func(ctx context.Context) error { return nil }
+	if err := scheduler.Register(Job{Name: "a", Handler: handler}); !errors.Is(err, ErrInvalidJob) {
+		t.Errorf("Expected ErrInvalidJob without interval, got %v", err)
+	}
+	if err := scheduler.Register(Job{Name: "a", Interval: time.Hour, Handler: handler}); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Register(Job{Name: "a", Interval: time.Hour, Handler: handler}); !errors.Is(err, ErrInvalidJob) {
+		t.Errorf("Expected ErrInvalidJob for duplicate, got %v", err)
+	}
+	if err := scheduler.Trigger("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestScheduler_ScheduleAndRecord(t *testing.T) {
+	db := setupDB(t)
+	scheduler := NewScheduler(db)
+	var runs int32
+	scheduler.Register(Job{Name: "tick", Interval: 20 * time.Millisecond, RunAtStart: true, Handler: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx)
+
+	waitFor(t, "scheduled runs", func() bool { return atomic.LoadInt32(&runs) >= 3 })
+	status, err := scheduler.Get(ctx, "tick", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastRun == nil || status.LastRun.Outcome != OutcomeSuccess || status.NextRun == nil || len(status.History) < 2 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.History[0].Trigger != TriggerSchedule || status.History[0].FinishedAt.Before(status.History[0].StartedAt) {
+		t.Errorf("Unexpected run record %+v", status.History[0])
+	}
+}
+
+func TestScheduler_TriggerSingleFlight(t *testing.T) {
+	scheduler := NewScheduler(setupDB(t))
+	release := make(chan struct{})
+	var running, maxRunning, runs int32
+	scheduler.Register(Job{Name: "slow", Interval: time.Hour, Handler: func(ctx context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		if n > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, n)
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx)
+
+	if err := scheduler.Trigger("slow"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first run", func() bool { return atomic.LoadInt32(&running) == 1 })
+	if err := scheduler.Trigger("slow"); err != nil {
+		t.Fatalf("Expected trigger during a run to be queued, got %v", err)
+	}
+	if err := scheduler.Trigger("slow"); !errors.Is(err, ErrJobQueued) {
+		t.Errorf("Expected ErrJobQueued, got %v", err)
+	}
+	status, _ := scheduler.Get(ctx, "slow", 0)
+	if !status.Running || !status.Queued {
+		t.Errorf("Expected running and queued, got %+v", status)
+	}
+
+	close(release)
+	waitFor(t, "queued run", func() bool { return atomic.LoadInt32(&runs) == 2 })
+	if atomic.LoadInt32(&maxRunning) != 1 {
+		t.Errorf("Expected runs to be serialized, got %d concurrent", maxRunning)
+	}
+}
+
+func TestScheduler_PauseSkipsScheduleAndPersists(t *testing.T) {
+	db := setupDB(t)
+	scheduler := NewScheduler(db)
+	var runs int32
+	job := Job{Name: "paused", Interval: 10 * time.Millisecond, Handler: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}}
+	scheduler.Register(job)
+	if err := scheduler.Pause(context.Background(), "paused", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		t.Fatalf("Expected paused job to skip scheduled runs, ran %d times", n)
+	}
+	status, _ := scheduler.Get(ctx, "paused", 0)
+	if !status.Paused || status.PausedBy != "admin" || status.NextRun != nil {
+		t.Errorf("Unexpected paused status %+v", status)
+	}
+
+	// 重启后仍保持暂停
+	restarted := NewScheduler(db)
+	restarted.Register(job)
+	restarted.Start(ctx)
+	if status, _ := restarted.Get(ctx, "paused", 0); !status.Paused {
+		t.Error("Expected pause to survive a restart")
+	}
+
+	// 手动执行不受暂停影响
+	restarted.Trigger("paused")
+	waitFor(t, "manual run", func() bool { return atomic.LoadInt32(&runs) == 1 })
+
+	if err := restarted.Resume(ctx, "paused"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "resumed runs", func() bool { return atomic.LoadInt32(&runs) >= 3 })
+}
+
+func TestScheduler_FailuresAndPanics(t *testing.T) {
+	db := setupDB(t)
+	scheduler := NewScheduler(db)
+	scheduler.FailureThreshold = 2
+	var calls int32
+	job := Job{Name: "broken", Interval: time.Hour, Handler: func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		return errors.New("connection refused")
+	}}
+	scheduler.Register(job)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx)
+
+	scheduler.Trigger("broken")
+	waitFor(t, "first failure", func() bool {
+		status, _ := scheduler.Get(ctx, "broken", 0)
+		return status.ConsecutiveFailures == 1
+	})
+	if len(scheduler.Failing()) != 0 {
+		t.Error("Expected job below the threshold not to be failing")
+	}
+	scheduler.Trigger("broken")
+	waitFor(t, "second failure", func() bool { return len(scheduler.Failing()) == 1 })
+
+	status, _ := scheduler.Get(ctx, "broken", 10)
+	if len(status.History) != 2 || status.History[1].Error != "panic: boom" || status.LastRun.Error != "connection refused" {
+		t.Errorf("Unexpected history %+v", status.History)
+	}
+
+	// 重启后从执行记录恢复连续失败次数
+	restarted := NewScheduler(db)
+	restarted.FailureThreshold = 2
+	restarted.Register(job)
+	restarted.Start(ctx)
+	if failing := restarted.Failing(); len(failing) != 1 || failing[0].ConsecutiveFailures != 2 {
+		t.Errorf("Expected failures restored from history, got %+v", failing)
+	}
+}
@@ -1,11 +1,12 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -16,25 +17,153 @@ var (
 	WebBuffer []string
 	bufferMu  sync.Mutex
 	
-	// 日志记录器
-	infoLogger *log.Logger
+	// 日志写入通道，由单个写入协程串行写入文件和控制台，避免多行交错
+	writerMu sync.RWMutex
+	entries  chan writerEntry
+	writerWG sync.WaitGroup
+
+	// logPath 当前日志文件路径，rotator 为其轮转器
+	logPath string
+	rotator *lumberjack.Logger
+
+	// debugEnabled 是否输出调试日志
+	debugEnabled bool
+
+	// consoleMuted 为 true 时日志只写入文件，全屏终端界面（qwq top）运行期间设置
+	consoleMuted atomic.Bool
 )
 
-// 初始化日志系统
-func Init(logPath string, debug bool) {
+// console 可静默的控制台输出
+type console struct{}
+
+func (console) Write(p []byte) (int, error) {
+	if consoleMuted.Load() {
+		return len(p), nil
+	}
+	return os.Stdout.Write(p)
+}
+
+// SetConsole 是否同时输出到控制台，关闭后日志仍写入文件和 Web 内存缓冲
+func SetConsole(enabled bool) {
+	consoleMuted.Store(!enabled)
+}
+
+// ErrNotInitialized 日志系统未初始化（未写入文件）
+var ErrNotInitialized = errors.New("logger not initialized")
+
+// writerEntry 写入协程处理的消息：一行日志及其结构化记录，或一次轮转请求
+type writerEntry struct {
+	line    string
+	record  []byte
+	rotated chan error
+}
+
+// 初始化日志系统，使用默认保留策略
+func Init(path string, debug bool) {
+	InitWithRetention(path, debug, DefaultRetention)
+}
+
+// InitWithRetention 按指定保留策略初始化日志系统
+// 日志文件以追加模式打开，轮转后的旧文件由 lumberjack 按同一策略清理
+func InitWithRetention(path string, debug bool, policy RetentionPolicy) {
+	policy = policy.withDefaults()
+
 	// 配置日志轮转
-	rotator := &lumberjack.Logger{
-		Filename:   logPath,
-		MaxSize:    10,   // 每个日志文件最大 10MB
-		MaxBackups: 5,    // 最多保留 5 个旧文件
-		MaxAge:     30,   // 最多保留 30 天
-		Compress:   true, // 旧日志压缩保存
+	r := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    policy.MaxSizeMB,
+		MaxBackups: policy.MaxBackups,
+		MaxAge:     policy.maxAgeDays(),
+		Compress:   policy.Compress,
 	}
 
 	// 多重输出：同时输出到 控制台 + 文件
-	multiWriter := io.MultiWriter(os.Stdout, rotator)
+	multiWriter := io.MultiWriter(console{}, r)
+
+	Close() // 重复初始化时先排空旧的写入协程
+	openRecords(path, policy)
+	startWriter(multiWriter, r.Rotate)
+	writerMu.Lock()
+	logPath, rotator = path, r
+	writerMu.Unlock()
+	debugEnabled = debug
+}
+
+// startWriter 启动日志写入协程
+// 每条日志以一次 Write 调用完整写出，时间戳由我们自己格式化；
+// 轮转请求也在该协程中执行，因此轮转前后的日志不会丢失或交错
+func startWriter(out io.Writer, rotate func() error) {
+	writerMu.Lock()
+	defer writerMu.Unlock()
+
+	ch := make(chan writerEntry, 1024)
+	entries = ch
+	writerWG.Add(1)
+	go func() {
+		defer writerWG.Done()
+		for entry := range ch {
+			if entry.rotated != nil {
+				var err error
+				if rotate != nil {
+					err = rotate()
+				}
+				entry.rotated <- err
+				continue
+			}
+			io.WriteString(out, entry.line+"\n")
+			if entry.record != nil {
+				writeRecord(entry.record)
+			}
+		}
+	}()
+}
+
+// Rotate 立即轮转日志文件，在此之前提交的日志全部写入旧文件
+func Rotate() error {
+	writerMu.RLock()
+	if entries == nil || rotator == nil {
+		writerMu.RUnlock()
+		return ErrNotInitialized
+	}
+	done := make(chan error, 1)
+	entries <- writerEntry{rotated: done}
+	writerMu.RUnlock()
+	return <-done
+}
 
-	infoLogger = log.New(multiWriter, "", 0) // 时间戳由我们自己格式化
+// Path 当前日志文件路径，未初始化时为空
+func Path() string {
+	writerMu.RLock()
+	defer writerMu.RUnlock()
+	return logPath
+}
+
+// Close 停止写入协程并等待缓冲中的日志全部写出
+// 之后的日志直接输出到控制台
+func Close() {
+	writerMu.Lock()
+	if entries != nil {
+		close(entries)
+		entries = nil
+	}
+	writerMu.Unlock()
+	writerWG.Wait()
+}
+
+// write 将日志交给写入协程，未初始化时直接输出到控制台
+func write(entry string) {
+	writeEntry(entry, nil)
+}
+
+// writeEntry 将日志和结构化记录交给写入协程，记录为空时只写文本日志
+func writeEntry(entry string, record []byte) {
+	writerMu.RLock()
+	defer writerMu.RUnlock()
+	if entries != nil {
+		entries <- writerEntry{line: entry, record: record}
+		return
+	}
+	fmt.Fprintln(console{}, entry) // Fallback
 }
 
 // 记录普通日志
@@ -43,22 +172,50 @@ func Info(format string, v ...interface{}) {
 	ts := time.Now().Format("15:04:05")
 	logEntry := fmt.Sprintf("[%s] %s", ts, msg)
 
-	// 1. 写入文件和控制台
-	if infoLogger != nil {
-		infoLogger.Println(logEntry)
-	} else {
-		fmt.Println(logEntry) // Fallback
-	}
+	// 1. 写入文件和控制台，同时追加结构化日志供历史查询
+	writeEntry(logEntry, newRecord(levelOf(msg), msg, 1))
 
-	// 2. 写入 Web 内存缓冲 (保留最近 100 条)
+	// 2. 写入 Web 内存缓冲 (保留最近 bufferLimit 条)
 	bufferMu.Lock()
 	defer bufferMu.Unlock()
 	WebBuffer = append(WebBuffer, logEntry)
-	if len(WebBuffer) > 100 {
-		WebBuffer = WebBuffer[1:]
+	if len(WebBuffer) > bufferLimit {
+		WebBuffer = WebBuffer[len(WebBuffer)-bufferLimit:]
 	}
 }
 
+// DefaultBufferLimit Web 内存缓冲默认保留的日志条数
+const DefaultBufferLimit = 100
+
+// bufferLimit Web 内存缓冲保留的日志条数，受 bufferMu 保护
+var bufferLimit = DefaultBufferLimit
+
+// SetBufferLimit 调整 Web 内存缓冲保留的日志条数，超出部分立即丢弃；自身内存紧张时由资源守护调小
+func SetBufferLimit(n int) {
+	if n <= 0 {
+		n = DefaultBufferLimit
+	}
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+	bufferLimit = n
+	if len(WebBuffer) > n {
+		WebBuffer = append([]string(nil), WebBuffer[len(WebBuffer)-n:]...)
+	}
+}
+
+// Debug 记录调试日志
+// 仅在 debug 模式下输出到文件和控制台，不进入 Web 内存缓冲
+func Debug(format string, v ...interface{}) {
+	if !debugEnabled {
+		return
+	}
+	msg := fmt.Sprintf(format, v...)
+	ts := time.Now().Format("15:04:05")
+	logEntry := fmt.Sprintf("[%s] [DEBUG] %s", ts, msg)
+
+	writeEntry(logEntry, newRecord(LevelDebug, msg, 1))
+}
+
 // GetWebLogs 获取 Web 端日志
 func GetWebLogs() []string {
 	bufferMu.Lock()
@@ -0,0 +1,232 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// TestRotate_NoLinesLostAcrossRotation 持续写入的同时强制轮转，所有行都应完整落盘
+func TestRotate_NoLinesLostAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "qwq.log")
+	r := &lumberjack.Logger{Filename: path, MaxSize: 100}
+	defer r.Close()
+
+	Close()
+	startWriter(r, r.Rotate)
+	writerMu.Lock()
+	logPath, rotator = path, r
+	writerMu.Unlock()
+	defer func() {
+		Close()
+		writerMu.Lock()
+		logPath, rotator = "", nil
+		writerMu.Unlock()
+	}()
+
+	const writers, lines = 4, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				write(fmt.Sprintf("writer=%d line=%d", w, i))
+			}
+		}(w)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond)
+		if err := Rotate(); err != nil {
+			t.Fatalf("Rotate failed: %v", err)
+		}
+	}
+	wg.Wait()
+	Close()
+
+	files, err := listLogFiles(path)
+	if err != nil {
+		t.Fatalf("listLogFiles failed: %v", err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("Expected rotated files, got %+v", files)
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		f, err := os.Open(file.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "writer=") {
+				t.Errorf("Corrupted line %q in %s", line, file.Name)
+			}
+			if seen[line] {
+				t.Errorf("Duplicated line %q", line)
+			}
+			seen[line] = true
+		}
+		f.Close()
+	}
+	if len(seen) != writers*lines {
+		t.Errorf("Expected %d lines, got %d", writers*lines, len(seen))
+	}
+}
+
+func TestPruneLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "qwq.log")
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotatedName := func(age time.Duration) string {
+		return "qwq-" + now.Add(-age).Format(rotatedTimeFormat) + ".log"
+	}
+
+	writeFile("qwq.log", "current\n")
+	writeFile("other.txt", "not a log")
+	writeFile(rotatedName(time.Hour), "newest\n")
+	writeFile(rotatedName(2*time.Hour)+".gz", "already compressed")
+	writeFile(rotatedName(3*time.Hour), "third\n")
+	writeFile(rotatedName(4*time.Hour), "beyond count\n")
+	writeFile(rotatedName(40*24*time.Hour), "too old\n")
+
+	policy := RetentionPolicy{MaxBackups: 3, MaxAge: 7 * 24 * time.Hour, Compress: true}
+	result, err := pruneLogFiles(path, policy, now)
+	if err != nil {
+		t.Fatalf("pruneLogFiles failed: %v", err)
+	}
+
+	if len(result.Deleted) != 2 || result.Deleted[0] != rotatedName(4*time.Hour) || result.Deleted[1] != rotatedName(40*24*time.Hour) {
+		t.Errorf("Unexpected deleted files: %v", result.Deleted)
+	}
+	if len(result.Compressed) != 2 {
+		t.Errorf("Expected 2 files to be compressed, got %v", result.Compressed)
+	}
+
+	files, _ := listLogFiles(path)
+	if len(files) != 4 || files[0].Name != "qwq.log" {
+		t.Fatalf("Unexpected remaining files: %+v", files)
+	}
+	for _, file := range files[1:] {
+		if !file.Compressed {
+			t.Errorf("Expected %s to be compressed", file.Name)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, rotatedName(time.Hour)+".gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(gz); string(data) != "newest\n" {
+		t.Errorf("Unexpected compressed content %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.txt")); err != nil {
+		t.Errorf("Non-log file should be untouched: %v", err)
+	}
+}
+
+// TestQuery_ConcurrentWritersAndRotation 多个协程写入并不断轮转时查询，结果完整有序，轮转文件也能查到
+func TestQuery_ConcurrentWritersAndRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qwq.log")
+	SetConsole(false)
+	InitWithRetention(path, false, RetentionPolicy{MaxSizeMB: 1, MaxBackups: 5})
+	defer func() {
+		Close()
+		SetConsole(true)
+		writerMu.Lock()
+		logPath, rotator = "", nil
+		writerMu.Unlock()
+		recordsMu.Lock()
+		records.Close()
+		records, recordsPath = nil, ""
+		recordsMu.Unlock()
+	}()
+
+	start := time.Now()
+	Info("❌ 巡检失败: disk full")
+	const writers, lines = 4, 1500
+	padding := strings.Repeat("x", 200)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				Info("writer=%d line=%d %s", w, i, padding)
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		case <-time.After(20 * time.Millisecond):
+		}
+		list, err := Query(time.Time{}, "", MaxQueryLimit)
+		if err != nil {
+			t.Fatalf("Query during writes: %v", err)
+		}
+		for i := 1; i < len(list); i++ {
+			if list[i].Time.Before(list[i-1].Time) {
+				t.Fatalf("Entries out of order at %d: %v before %v", i, list[i].Time, list[i-1].Time)
+			}
+		}
+	}
+	Close()
+
+	if files, _ := listLogFiles(structuredPath(path)); len(files) < 2 {
+		t.Fatalf("Expected the structured log to rotate, got %+v", files)
+	}
+	list, err := Query(start, "", MaxQueryLimit)
+	if err != nil || len(list) != MaxQueryLimit {
+		t.Fatalf("Expected %d entries, got %d: %v", MaxQueryLimit, len(list), err)
+	}
+	seen := make(map[string]bool)
+	for _, entry := range list {
+		if seen[entry.Message] || entry.Level != LevelInfo || entry.Source != "logger" {
+			t.Errorf("Unexpected entry %+v", entry)
+		}
+		seen[entry.Message] = true
+	}
+
+	// 最早的错误日志已在轮转文件中
+	errorsOnly, err := Query(start, LevelWarn, 10)
+	if err != nil || len(errorsOnly) != 1 || errorsOnly[0].Level != LevelError || errorsOnly[0].Message != "❌ 巡检失败: disk full" {
+		t.Errorf("Expected the error entry from a rotated file, got %+v %v", errorsOnly, err)
+	}
+	if list, _ := Query(time.Now().Add(time.Minute), "", 0); len(list) != 0 {
+		t.Errorf("Expected nothing after since, got %d", len(list))
+	}
+	if _, err := Query(time.Time{}, "fatal", 0); !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("Expected ErrInvalidLevel, got %v", err)
+	}
+}
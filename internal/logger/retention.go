@@ -0,0 +1,260 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lumberjack 轮转文件名中的时间格式，如 qwq-2024-05-02T12-00-00.000.log
+const rotatedTimeFormat = "2006-01-02T15-04-05.000"
+
+// ErrInvalidLogFile 请求的文件不是日志目录中的日志文件
+var ErrInvalidLogFile = errors.New("invalid log file")
+
+// RetentionPolicy 日志保留策略，零值字段使用默认值
+type RetentionPolicy struct {
+	MaxSizeMB  int           // 单个日志文件达到该大小后轮转
+	MaxBackups int           // 保留的轮转文件数量，超出的最旧文件被删除
+	MaxAge     time.Duration // 轮转文件最长保留时间
+	MaxTotalMB int64         // 轮转文件总大小上限，0 表示不限制
+	Compress   bool          // 是否压缩轮转文件
+}
+
+// DefaultRetention 默认保留策略：10MB 轮转，保留 5 个、30 天，压缩保存
+var DefaultRetention = RetentionPolicy{
+	MaxSizeMB:  10,
+	MaxBackups: 5,
+	MaxAge:     30 * 24 * time.Hour,
+	Compress:   true,
+}
+
+func (p RetentionPolicy) withDefaults() RetentionPolicy {
+	if p.MaxSizeMB <= 0 {
+		p.MaxSizeMB = DefaultRetention.MaxSizeMB
+	}
+	if p.MaxBackups <= 0 {
+		p.MaxBackups = DefaultRetention.MaxBackups
+	}
+	if p.MaxAge <= 0 {
+		p.MaxAge = DefaultRetention.MaxAge
+	}
+	return p
+}
+
+// maxAgeDays lumberjack 以天为单位，向上取整
+func (p RetentionPolicy) maxAgeDays() int {
+	day := 24 * time.Hour
+	return int((p.MaxAge + day - 1) / day)
+}
+
+// LogFile 日志目录中的日志文件
+type LogFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Rotated    bool      `json:"rotated"`    // 是否为轮转后的旧文件
+	Compressed bool      `json:"compressed"` // 是否已 gzip 压缩
+
+	path      string
+	rotatedAt time.Time
+}
+
+// Path 文件的完整路径
+func (f LogFile) Path() string {
+	return f.path
+}
+
+// ListFiles 列出当前日志文件及其轮转文件，轮转文件按时间从新到旧排列
+func ListFiles() ([]LogFile, error) {
+	path := Path()
+	if path == "" {
+		return nil, ErrNotInitialized
+	}
+	return listLogFiles(path)
+}
+
+// ResolveFile 将文件名解析为日志目录中的日志文件，拒绝目录穿越和非日志文件
+// 文件名为空时返回当前日志文件
+func ResolveFile(name string) (LogFile, error) {
+	files, err := ListFiles()
+	if err != nil {
+		return LogFile{}, err
+	}
+	for _, file := range files {
+		if name == file.Name || (name == "" && !file.Rotated) {
+			return file, nil
+		}
+	}
+	return LogFile{}, fmt.Errorf("%w: %s", ErrInvalidLogFile, name)
+}
+
+// PruneResult 清理结果
+type PruneResult struct {
+	Deleted    []string `json:"deleted"`
+	Compressed []string `json:"compressed"`
+	FreedBytes int64    `json:"freed_bytes"`
+}
+
+// Prune 按保留策略清理当前日志的轮转文件
+func Prune(policy RetentionPolicy) (*PruneResult, error) {
+	path := Path()
+	if path == "" {
+		return nil, ErrNotInitialized
+	}
+	return pruneLogFiles(path, policy.withDefaults(), time.Now())
+}
+
+// listLogFiles 列出 path 对应的日志文件
+func listLogFiles(path string) ([]LogFile, error) {
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var current []LogFile
+	var rotated []LogFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		file := LogFile{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime(), path: filepath.Join(dir, entry.Name())}
+
+		if entry.Name() == base {
+			current = append(current, file)
+			continue
+		}
+		// 轮转文件: <prefix><时间><ext>[.gz]
+		name := entry.Name()
+		if strings.HasSuffix(name, ".gz") {
+			file.Compressed = true
+			name = strings.TrimSuffix(name, ".gz")
+		}
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		ts, err := time.Parse(rotatedTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			continue
+		}
+		file.Rotated = true
+		file.rotatedAt = ts
+		rotated = append(rotated, file)
+	}
+
+	sort.Slice(rotated, func(i, j int) bool { return rotated[i].rotatedAt.After(rotated[j].rotatedAt) })
+	return append(current, rotated...), nil
+}
+
+// pruneLogFiles 删除超出数量、时间和总大小限制的轮转文件，并压缩保留下来的未压缩文件
+func pruneLogFiles(path string, policy RetentionPolicy, now time.Time) (*PruneResult, error) {
+	files, err := listLogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{Deleted: []string{}, Compressed: []string{}}
+	var kept []LogFile
+	var total int64
+	for _, file := range files {
+		if !file.Rotated {
+			continue
+		}
+		expired := now.Sub(file.rotatedAt) > policy.MaxAge
+		overCount := len(kept) >= policy.MaxBackups
+		overSize := policy.MaxTotalMB > 0 && total+file.Size > policy.MaxTotalMB*1024*1024
+		if expired || overCount || overSize {
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				return result, err
+			}
+			result.Deleted = append(result.Deleted, file.Name)
+			result.FreedBytes += file.Size
+			continue
+		}
+		kept = append(kept, file)
+		total += file.Size
+	}
+
+	if !policy.Compress {
+		return result, nil
+	}
+	for _, file := range kept {
+		if file.Compressed {
+			continue
+		}
+		size, err := compressFile(file.path)
+		if os.IsNotExist(err) {
+			continue // 已被 lumberjack 自身的清理协程处理
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Compressed = append(result.Compressed, file.Name)
+		result.FreedBytes += file.Size - size
+	}
+	return result, nil
+}
+
+// compressFile 将文件压缩为 .gz 并删除原文件，返回压缩后的大小
+func compressFile(path string) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	if err := os.Remove(path); err != nil {
+		return 0, err
+	}
+
+	compressed, err := os.Stat(path + ".gz")
+	if err != nil {
+		return 0, err
+	}
+	return compressed.Size(), nil
+}
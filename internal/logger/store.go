@@ -0,0 +1,235 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 日志级别，查询时按最低级别过滤
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levelRanks = map[string]int{LevelDebug: 0, LevelInfo: 1, LevelWarn: 2, LevelError: 3}
+
+const (
+	// DefaultQueryLimit 查询结构化日志默认返回的条数
+	DefaultQueryLimit = 100
+	// MaxQueryLimit 查询结构化日志最多返回的条数
+	MaxQueryLimit = 1000
+)
+
+// ErrInvalidLevel 查询的日志级别无效
+var ErrInvalidLevel = errors.New("invalid log level")
+
+// Entry 持久化的结构化日志，每行一个 JSON 对象
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Source  string    `json:"source"` // 记录日志的包，如 patrol、server
+	Message string    `json:"message"`
+}
+
+var (
+	// records 结构化日志文件的轮转器，与文本日志使用相同的轮转和保留策略
+	// 写入协程写入时持有写锁，查询在持有读锁时打开文件，轮转不会发生在列出和打开文件之间
+	recordsMu   sync.RWMutex
+	records     *lumberjack.Logger
+	recordsPath string
+)
+
+// structuredPath 结构化日志文件路径：qwq.log 对应 qwq.jsonl，轮转文件名不会与文本日志混淆
+func structuredPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".jsonl"
+}
+
+// openRecords 按保留策略打开结构化日志文件；轮转文件不压缩，便于查询时直接读取
+func openRecords(path string, policy RetentionPolicy) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+	if records != nil {
+		records.Close()
+	}
+	recordsPath = structuredPath(path)
+	records = &lumberjack.Logger{
+		Filename:   recordsPath,
+		MaxSize:    policy.MaxSizeMB,
+		MaxBackups: policy.MaxBackups,
+		MaxAge:     policy.maxAgeDays(),
+	}
+}
+
+// writeRecord 在写入协程中追加一条结构化日志，写满时由 lumberjack 轮转
+func writeRecord(record []byte) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+	if records != nil {
+		records.Write(record)
+	}
+}
+
+// newRecord 编码一条结构化日志，skip 为调用 Info/Debug 的栈帧深度
+func newRecord(level, msg string, skip int) []byte {
+	data, err := json.Marshal(Entry{Time: time.Now(), Level: level, Source: callerPackage(skip + 1), Message: msg})
+	if err != nil {
+		return nil
+	}
+	return append(data, '\n')
+}
+
+// callerPackage 调用方所在的包名，如 qwq/internal/patrol.(*Runner).run 对应 patrol
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// levelOf 普通日志的级别：沿用日志中的 ❌、⚠️ 标记区分错误和警告
+func levelOf(msg string) string {
+	switch {
+	case strings.Contains(msg, "❌"):
+		return LevelError
+	case strings.Contains(msg, "⚠️"):
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// Query 查询持久化的结构化日志：不早于 since（零值不限）、不低于 level（为空不限），
+// 按时间顺序返回最近的 limit 条（<=0 时为 DefaultQueryLimit，最多 MaxQueryLimit）
+// 当前文件和轮转文件都会读取，查询期间发生轮转或旧文件被删除不影响已打开的文件
+func Query(since time.Time, level string, limit int) ([]Entry, error) {
+	minRank := 0
+	if level != "" {
+		rank, ok := levelRanks[strings.ToLower(level)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLevel, level)
+		}
+		minRank = rank
+	}
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+
+	opened, err := openRecordFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, file := range opened {
+			file.f.Close()
+		}
+	}()
+
+	// 从最新的文件开始读取，凑够 limit 条后不再读取更早的文件
+	var result []Entry
+	for _, file := range opened {
+		if !since.IsZero() && file.modTime.Before(since) {
+			break
+		}
+		matched, err := readRecords(file.f, file.compressed, since, minRank)
+		if err != nil {
+			return nil, err
+		}
+		result = append(matched, result...)
+		if len(result) >= limit {
+			break
+		}
+	}
+	// 时间在进入写入队列前记录，并发写入时文件中的顺序可能略有先后
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	if len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result, nil
+}
+
+type recordFile struct {
+	f          *os.File
+	modTime    time.Time
+	compressed bool
+}
+
+// openRecordFiles 在读锁下列出并打开结构化日志文件（从新到旧），此后轮转只会重命名或删除文件，已打开的文件仍可完整读取
+func openRecordFiles() ([]recordFile, error) {
+	recordsMu.RLock()
+	defer recordsMu.RUnlock()
+	if records == nil {
+		return nil, ErrNotInitialized
+	}
+	files, err := listLogFiles(recordsPath)
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]recordFile, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file.Path())
+		if err != nil {
+			continue
+		}
+		opened = append(opened, recordFile{f: f, modTime: file.ModTime, compressed: file.Compressed})
+	}
+	return opened, nil
+}
+
+// readRecords 读取一个文件中符合条件的日志，跳过无法解析的行（如写入中断留下的半行）
+func readRecords(f *os.File, compressed bool, since time.Time, minRank int) ([]Entry, error) {
+	var r io.Reader = f
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil
+		}
+		defer gz.Close()
+		r = gz
+	}
+	var matched []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if entry.Time.Before(since) || levelRanks[entry.Level] < minRank {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+		return matched, err
+	}
+	return matched, nil
+}
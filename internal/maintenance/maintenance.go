@@ -0,0 +1,353 @@
+// Package maintenance 提供维护窗口：窗口内命中范围的告警照常检测和记录，但不发送通知，
+// 窗口结束时汇总被静默的事件发送一次摘要
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"qwq/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidWindow 维护窗口参数无效
+	ErrInvalidWindow = errors.New("invalid maintenance window")
+	// ErrWindowNotFound 维护窗口不存在
+	ErrWindowNotFound = errors.New("maintenance window not found")
+)
+
+// DefaultCheckInterval 检查窗口是否到期的默认间隔
+const DefaultCheckInterval = time.Minute
+
+// summaryMaxTitles 摘要中每个类别最多列出的事件标题数
+const summaryMaxTitles = 5
+
+// maxContentLength 记录的事件内容最大长度
+const maxContentLength = 4000
+
+// Window 维护窗口，范围字段为空表示不限制，多个范围字段同时配置时需全部满足
+type Window struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	StartsAt   time.Time  `json:"start" gorm:"index"`
+	EndsAt     time.Time  `json:"end" gorm:"index"`
+	Hosts      []string   `json:"hosts,omitempty" gorm:"type:text;serializer:json"`      // 主机名（支持通配符）
+	Categories []string   `json:"categories,omitempty" gorm:"type:text;serializer:json"` // 异常类别（支持通配符），如 disk、rule:nginx*
+	Targets    []string   `json:"targets,omitempty" gorm:"type:text;serializer:json"`    // 网站域名或 Compose 项目名，匹配事件对象或标签
+	Reason     string     `json:"reason" gorm:"type:text"`
+	CreatedBy  string     `json:"created_by"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty" gorm:"index"` // 窗口结束并已发送摘要的时间
+	Suppressed int64      `json:"suppressed" gorm:"-"`              // 被静默的事件数，查询时填充
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SuppressedEvent 维护窗口内被静默的通知事件
+type SuppressedEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	WindowID   uint      `json:"window_id" gorm:"index;not null"`
+	Severity   string    `json:"severity"`
+	Category   string    `json:"category" gorm:"index"`
+	Host       string    `json:"host"`
+	Target     string    `json:"target,omitempty"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content" gorm:"type:text"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Active 窗口在指定时间是否生效
+func (w *Window) Active(now time.Time) bool {
+	return w.ClosedAt == nil && !now.Before(w.StartsAt) && now.Before(w.EndsAt)
+}
+
+// Label 窗口说明，用于日志和异常标记
+func (w *Window) Label() string {
+	if w.Reason == "" {
+		return fmt.Sprintf("维护窗口 #%d", w.ID)
+	}
+	return fmt.Sprintf("维护窗口 #%d: %s", w.ID, w.Reason)
+}
+
+// Matches 事件是否在窗口范围内
+func (w *Window) Matches(event notify.Event) bool {
+	host := event.Host
+	if host == "" {
+		host = utils.GetHostname()
+	}
+	if len(w.Hosts) > 0 && !matchAny(w.Hosts, host) {
+		return false
+	}
+	if len(w.Categories) > 0 && !matchAny(w.Categories, event.Category) {
+		return false
+	}
+	if len(w.Targets) > 0 {
+		for _, value := range append([]string{event.Target}, event.Tags...) {
+			if value != "" && matchAny(w.Targets, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager 维护窗口管理，窗口和被静默的事件保存在数据库中，CLI 和 Web 服务共享
+type Manager struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewManager 创建维护窗口管理器
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db, now: time.Now}
+}
+
+// Create 创建维护窗口，开始时间为空时立即开始
+func (m *Manager) Create(ctx context.Context, window *Window) error {
+	now := m.now()
+	if window.StartsAt.IsZero() {
+		window.StartsAt = now
+	}
+	if !window.EndsAt.After(window.StartsAt) {
+		return fmt.Errorf("%w: end must be after start", ErrInvalidWindow)
+	}
+	if !window.EndsAt.After(now) {
+		return fmt.Errorf("%w: window already ended", ErrInvalidWindow)
+	}
+	for _, patterns := range [][]string{window.Hosts, window.Categories, window.Targets} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: bad pattern %q", ErrInvalidWindow, pattern)
+			}
+		}
+	}
+	window.ID, window.ClosedAt = 0, nil
+	if err := m.db.WithContext(ctx).Create(window).Error; err != nil {
+		return fmt.Errorf("failed to create maintenance window: %w", err)
+	}
+	logger.Info("[AUDIT] 🔧 维护窗口已创建: #%d %s ~ %s by %s (%s)", window.ID,
+		window.StartsAt.Format("2006-01-02 15:04"), window.EndsAt.Format("2006-01-02 15:04"), window.CreatedBy, window.Reason)
+	return nil
+}
+
+// Active 当前生效的维护窗口
+func (m *Manager) Active(ctx context.Context) ([]*Window, error) {
+	now := m.now()
+	var windows []*Window
+	if err := m.db.WithContext(ctx).
+		Where("closed_at IS NULL AND starts_at <= ? AND ends_at > ?", now, now).
+		Order("starts_at").Find(&windows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list active maintenance windows: %w", err)
+	}
+	return windows, m.fillCounts(ctx, windows)
+}
+
+// List 最近的维护窗口（最新的在前），包括已结束的窗口
+func (m *Manager) List(ctx context.Context, limit int) ([]*Window, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	var windows []*Window
+	if err := m.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&windows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list maintenance windows: %w", err)
+	}
+	return windows, m.fillCounts(ctx, windows)
+}
+
+func (m *Manager) fillCounts(ctx context.Context, windows []*Window) error {
+	for _, window := range windows {
+		if err := m.db.WithContext(ctx).Model(&SuppressedEvent{}).Where("window_id = ?", window.ID).Count(&window.Suppressed).Error; err != nil {
+			return fmt.Errorf("failed to count suppressed events: %w", err)
+		}
+	}
+	return nil
+}
+
+// Suppress 事件命中生效的维护窗口时记录事件并返回窗口说明，可作为 notify.Suppressor 使用
+func (m *Manager) Suppress(event notify.Event) (string, bool) {
+	ctx := context.Background()
+	windows, err := m.Active(ctx)
+	if err != nil {
+		// 查询失败时宁可多发告警，也不能丢失
+		logger.Info("⚠️ 查询维护窗口失败，通知照常发送: %v", err)
+		return "", false
+	}
+	for _, window := range windows {
+		if !window.Matches(event) {
+			continue
+		}
+		occurred := event.Time
+		if occurred.IsZero() {
+			occurred = m.now()
+		}
+		content := event.Content
+		if len(content) > maxContentLength {
+			content = content[:maxContentLength]
+		}
+		record := &SuppressedEvent{
+			WindowID: window.ID, Severity: event.Severity, Category: event.Category, Host: event.Host,
+			Target: event.Target, Title: event.Title, Content: content, OccurredAt: occurred,
+		}
+		if err := m.db.WithContext(ctx).Create(record).Error; err != nil {
+			logger.Info("⚠️ 记录被静默的事件失败，通知照常发送: %v", err)
+			return "", false
+		}
+		return window.Label(), true
+	}
+	return "", false
+}
+
+// End 提前结束维护窗口并发送摘要
+func (m *Manager) End(ctx context.Context, id uint, user string) (*Window, error) {
+	var window Window
+	if err := m.db.WithContext(ctx).First(&window, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWindowNotFound
+		}
+		return nil, fmt.Errorf("failed to get maintenance window: %w", err)
+	}
+	if window.ClosedAt != nil {
+		return &window, nil
+	}
+	if now := m.now(); now.Before(window.EndsAt) {
+		window.EndsAt = now
+		if err := m.db.WithContext(ctx).Model(&window).Update("ends_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to end maintenance window: %w", err)
+		}
+	}
+	logger.Info("[AUDIT] 🔧 维护窗口提前结束: #%d by %s", window.ID, user)
+	if err := m.close(ctx, &window); err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+// CloseExpired 关闭已到期的窗口并发送摘要，返回本次关闭的窗口
+func (m *Manager) CloseExpired(ctx context.Context) ([]*Window, error) {
+	var windows []*Window
+	if err := m.db.WithContext(ctx).Where("closed_at IS NULL AND ends_at <= ?", m.now()).Find(&windows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list expired maintenance windows: %w", err)
+	}
+	closed := windows[:0]
+	for _, window := range windows {
+		if err := m.close(ctx, window); err != nil {
+			return closed, err
+		}
+		if window.ClosedAt != nil {
+			closed = append(closed, window)
+		}
+	}
+	return closed, nil
+}
+
+// close 标记窗口已关闭并发送摘要；只有成功标记的进程发送摘要，避免 CLI 和 Web 服务重复发送
+func (m *Manager) close(ctx context.Context, window *Window) error {
+	now := m.now()
+	result := m.db.WithContext(ctx).Model(&Window{}).Where("id = ? AND closed_at IS NULL", window.ID).Update("closed_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to close maintenance window: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	window.ClosedAt = &now
+
+	summary, count, err := m.Summary(ctx, window)
+	if err != nil {
+		return err
+	}
+	window.Suppressed = count
+	logger.Info("🔧 维护窗口已结束: #%d，静默事件 %d 条", window.ID, count)
+	notify.SendEvent(notify.Event{
+		Severity: notify.SeverityInfo,
+		Category: "maintenance",
+		Title:    "维护窗口结束",
+		Content:  summary,
+	})
+	return nil
+}
+
+// Summary 汇总窗口内被静默的事件，按类别统计并列出部分事件标题
+func (m *Manager) Summary(ctx context.Context, window *Window) (string, int64, error) {
+	var events []SuppressedEvent
+	if err := m.db.WithContext(ctx).Where("window_id = ?", window.ID).Order("occurred_at").Find(&events).Error; err != nil {
+		return "", 0, fmt.Errorf("failed to list suppressed events: %w", err)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("🔧 **维护窗口结束** [%s]\n\n%s\n时间: %s ~ %s\n",
+		utils.GetHostname(), window.Label(), window.StartsAt.Format("2006-01-02 15:04"), window.EndsAt.Format("2006-01-02 15:04")))
+	if len(events) == 0 {
+		builder.WriteString("\n维护期间没有被静默的告警。")
+		return builder.String(), 0, nil
+	}
+
+	byCategory := make(map[string][]SuppressedEvent)
+	for _, event := range events {
+		category := event.Category
+		if category == "" {
+			category = "其他"
+		}
+		byCategory[category] = append(byCategory[category], event)
+	}
+	categories := make([]string, 0, len(byCategory))
+	for category := range byCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	builder.WriteString(fmt.Sprintf("\n维护期间共静默 %d 条告警:\n", len(events)))
+	for _, category := range categories {
+		items := byCategory[category]
+		builder.WriteString(fmt.Sprintf("\n**%s** (%d 条)\n", category, len(items)))
+		for i, item := range items {
+			if i == summaryMaxTitles {
+				builder.WriteString(fmt.Sprintf("- ... 另有 %d 条\n", len(items)-summaryMaxTitles))
+				break
+			}
+			builder.WriteString(fmt.Sprintf("- %s [%s] %s\n", item.OccurredAt.Format("15:04"), item.Severity, item.Title))
+		}
+	}
+	return builder.String(), int64(len(events)), nil
+}
+
+var (
+	defaultManager   *Manager
+	defaultManagerMu sync.RWMutex
+)
+
+// SetDefault 设置全局维护窗口管理器并接入通知静默，传 nil 时关闭维护窗口功能
+func SetDefault(manager *Manager) {
+	defaultManagerMu.Lock()
+	defaultManager = manager
+	defaultManagerMu.Unlock()
+	if manager == nil {
+		notify.SetSuppressor(nil)
+		return
+	}
+	notify.SetSuppressor(manager.Suppress)
+}
+
+// Default 全局维护窗口管理器，未启用时返回 nil
+func Default() *Manager {
+	defaultManagerMu.RLock()
+	defer defaultManagerMu.RUnlock()
+	return defaultManager
+}
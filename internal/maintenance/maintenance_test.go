@@ -0,0 +1,144 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/notify"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func setupManager(t *testing.T) (*Manager, *time.Time) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open SQL database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open GORM database: %v", err)
+	}
+	if err := db.AutoMigrate(&Window{}, &SuppressedEvent{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	manager := NewManager(db)
+	manager.now = func() time.Time { return now }
+	SetDefault(manager)
+	t.Cleanup(func() { SetDefault(nil) })
+	return manager, &now
+}
+
+func TestManager_SuppressInScope(t *testing.T) {
+	manager, now := setupManager(t)
+	ctx := context.Background()
+
+	window := &Window{EndsAt: now.Add(2 * time.Hour), Categories: []string{"disk", "rule:pg*"}, Reason: "db upgrade"}
+	if err := manager.Create(ctx, window); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if reason, ok := notify.Suppressed(notify.Event{Severity: notify.SeverityWarning, Category: "rule:pg_replication", Title: "复制延迟"}); !ok || !strings.Contains(reason, "db upgrade") {
+		t.Errorf("Expected event in scope to be suppressed, got %q %v", reason, ok)
+	}
+	if _, ok := notify.Suppressed(notify.Event{Severity: notify.SeverityCritical, Category: "http", Title: "网站不可用"}); ok {
+		t.Error("Events outside the window scope must still be sent")
+	}
+	if _, ok := notify.Suppressed(notify.Event{Severity: notify.SeverityInfo, Category: "disk", Title: "日报"}); ok {
+		t.Error("Info events are not alerts and must not be suppressed")
+	}
+
+	active, err := manager.Active(ctx)
+	if err != nil || len(active) != 1 || active[0].Suppressed != 1 {
+		t.Fatalf("Expected one active window with one suppressed event, got %+v (%v)", active, err)
+	}
+
+	// 窗口结束后不再静默
+	*now = now.Add(3 * time.Hour)
+	if _, ok := notify.Suppressed(notify.Event{Severity: notify.SeverityWarning, Category: "disk", Title: "磁盘告警"}); ok {
+		t.Error("Expired windows must not suppress events")
+	}
+}
+
+func TestManager_TargetScope(t *testing.T) {
+	manager, now := setupManager(t)
+	window := &Window{EndsAt: now.Add(time.Hour), Targets: []string{"shop"}}
+	if err := manager.Create(context.Background(), window); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !window.Matches(notify.Event{Target: "shop"}) || !window.Matches(notify.Event{Tags: []string{"shop"}}) {
+		t.Error("Window should match events for its target")
+	}
+	if window.Matches(notify.Event{Category: "disk"}) {
+		t.Error("Window with targets should not match unrelated events")
+	}
+}
+
+func TestManager_CloseExpiredSummarizes(t *testing.T) {
+	manager, now := setupManager(t)
+	ctx := context.Background()
+
+	if err := manager.Create(ctx, &Window{EndsAt: now.Add(-time.Minute)}); !errors.Is(err, ErrInvalidWindow) {
+		t.Errorf("Expected ErrInvalidWindow for a window in the past, got %v", err)
+	}
+
+	window := &Window{EndsAt: now.Add(time.Hour), Reason: "kernel upgrade"}
+	if err := manager.Create(ctx, window); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		manager.Suppress(notify.Event{Severity: notify.SeverityWarning, Category: "disk", Title: "磁盘告警"})
+	}
+	manager.Suppress(notify.Event{Severity: notify.SeverityCritical, Category: "oom", Title: "OOM"})
+
+	if closed, _ := manager.CloseExpired(ctx); len(closed) != 0 {
+		t.Fatalf("Window should still be open, closed %v", closed)
+	}
+	*now = now.Add(time.Hour)
+	closed, err := manager.CloseExpired(ctx)
+	if err != nil || len(closed) != 1 || closed[0].Suppressed != 8 || closed[0].ClosedAt == nil {
+		t.Fatalf("Expected window to close with 8 suppressed events, got %+v (%v)", closed, err)
+	}
+	if closed, _ := manager.CloseExpired(ctx); len(closed) != 0 {
+		t.Errorf("Window should only be closed once, got %v", closed)
+	}
+
+	summary, count, err := manager.Summary(ctx, window)
+	if err != nil || count != 8 {
+		t.Fatalf("Summary: %d %v", count, err)
+	}
+	for _, want := range []string{"kernel upgrade", "共静默 8 条", "**disk** (7 条)", "另有 2 条", "[critical] OOM"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestManager_End(t *testing.T) {
+	manager, now := setupManager(t)
+	ctx := context.Background()
+	window := &Window{EndsAt: now.Add(2 * time.Hour)}
+	if err := manager.Create(ctx, window); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	*now = now.Add(30 * time.Minute)
+	ended, err := manager.End(ctx, window.ID, "alice")
+	if err != nil || ended.ClosedAt == nil || !ended.EndsAt.Equal(*now) {
+		t.Fatalf("Expected window to end now, got %+v (%v)", ended, err)
+	}
+	if active, _ := manager.Active(ctx); len(active) != 0 {
+		t.Errorf("Ended window should not be active, got %v", active)
+	}
+	if _, err := manager.End(ctx, 404, "alice"); !errors.Is(err, ErrWindowNotFound) {
+		t.Errorf("Expected ErrWindowNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+// Package metrics 采集主机的负载、内存、磁盘和 TCP 连接数
+// Linux 上直接读取 /proc 和 statfs，不再每次采集都启动 uptime、free、df、ss 进程；
+// 没有 /proc 的平台（如 macOS）回退到原来的 shell 命令。数值的单位和取整方式与这些命令的输出一致
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"qwq/internal/utils"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported 当前平台无法直接读取该指标，需要回退到 shell 命令
+var ErrUnsupported = errors.New("metric not available on this platform")
+
+// procRoot /proc 的位置，测试时指向 testdata 中的副本
+var procRoot = "/proc"
+
+// runShell 回退时执行的 shell 命令，只解析 stdout
+var runShell = func(c string) string { return utils.RunShell(c).Stdout }
+
+// Snapshot 一次采集的主机指标
+type Snapshot struct {
+	Load       string // 1、5、15 分钟平均负载，与 uptime 输出相同，如 "0.52, 0.58, 0.59"
+	MemTotalMB uint64 // 与 free -m 的 total 相同
+	MemUsedMB  uint64 // 与 free -m 的 used 相同
+	DiskPct    string // 根目录使用率，与 df 相同（向上取整，不含 %）
+	DiskAvail  string // 根目录可用空间，与 df -h 相同，如 "4.0G"
+	TCPConn    string // 已建立的 TCP 连接数，与 ss -s 的 estab 相同
+}
+
+// MemPct 内存使用百分比
+func (s Snapshot) MemPct() float64 {
+	if s.MemTotalMB == 0 {
+		return 0
+	}
+	return float64(s.MemUsedMB) / float64(s.MemTotalMB) * 100
+}
+
+// Collect 采集一次主机指标，单项读取失败时回退到对应的 shell 命令
+func Collect() Snapshot {
+	var s Snapshot
+	var err error
+	if s.Load, err = Load(); err != nil {
+		s.Load = strings.TrimSpace(runShell("uptime | awk -F'load average:' '{ print $2 }'"))
+	}
+	if s.MemTotalMB, s.MemUsedMB, err = Memory(); err != nil {
+		fmt.Sscanf(runShell("free -m | awk 'NR==2{print $2,$3}'"), "%d %d", &s.MemTotalMB, &s.MemUsedMB)
+	}
+	if s.DiskPct, s.DiskAvail, err = Disk("/"); err != nil {
+		s.DiskPct, s.DiskAvail = "0", "0G"
+		if parts := strings.Fields(runShell("df -h / | awk 'NR==2 {print $5,$4}'")); len(parts) >= 2 {
+			s.DiskPct, s.DiskAvail = strings.TrimSuffix(parts[0], "%"), parts[1]
+		}
+	}
+	if s.TCPConn, err = TCPEstablished(); err != nil {
+		s.TCPConn = strings.TrimSpace(runShell("ss -s | grep 'TCP:' | grep -oE 'estab [0-9]+' | awk '{print $2}'"))
+		if s.TCPConn == "" {
+			s.TCPConn = "0"
+		}
+	}
+	return s
+}
+
+// Load 读取 /proc/loadavg
+func Load() (string, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return "", err
+	}
+	return parseLoadavg(data)
+}
+
+// parseLoadavg /proc/loadavg 与 uptime 一样保留两位小数，直接使用原始字段
+func parseLoadavg(data []byte) (string, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected loadavg %q", data)
+	}
+	return strings.Join(fields[:3], ", "), nil
+}
+
+// Memory 读取 /proc/meminfo，返回与 free -m 相同的 total 和 used（MiB）
+func Memory() (totalMB, usedMB uint64, err error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseMeminfo(data)
+}
+
+// ParseMeminfo 解析 /proc/meminfo 的内容（如经 SSH 读取的远程主机），结果与 Memory 相同
+func ParseMeminfo(data []byte) (totalMB, usedMB uint64, err error) {
+	return parseMeminfo(data)
+}
+
+// parseMeminfo 按 procps-ng 的算法计算：used = MemTotal - MemAvailable，
+// 没有 MemAvailable 的旧内核使用 MemTotal - MemFree - Buffers - Cached - SReclaimable；free -m 对 KiB 截断取整
+func parseMeminfo(data []byte) (totalMB, usedMB uint64, err error) {
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			values[key] = v
+		}
+	}
+	total, ok := values["MemTotal"]
+	if !ok || total == 0 {
+		return 0, 0, errors.New("meminfo has no MemTotal")
+	}
+	var used uint64
+	if available, ok := values["MemAvailable"]; ok && available <= total {
+		used = total - available
+	} else {
+		cached := values["MemFree"] + values["Buffers"] + values["Cached"] + values["SReclaimable"]
+		if cached <= total {
+			used = total - cached
+		} else {
+			used = total - values["MemFree"]
+		}
+	}
+	return total / 1024, used / 1024, nil
+}
+
+// TCPEstablished 已建立的 TCP 连接数：读取 /proc/net/snmp 的 CurrEstab（ss -s 的 estab 即该值），
+// 不可用时统计 /proc/net/tcp 和 tcp6 中 ESTABLISHED 和 CLOSE_WAIT 状态的连接
+func TCPEstablished() (string, error) {
+	if data, err := os.ReadFile(filepath.Join(procRoot, "net", "snmp")); err == nil {
+		if n, err := parseSNMPCurrEstab(data); err == nil {
+			return strconv.Itoa(n), nil
+		}
+	}
+	total := 0
+	found := false
+	for _, name := range []string{"tcp", "tcp6"} {
+		data, err := os.ReadFile(filepath.Join(procRoot, "net", name))
+		if err != nil {
+			continue
+		}
+		found = true
+		total += countEstablished(data)
+	}
+	if !found {
+		return "", ErrUnsupported
+	}
+	return strconv.Itoa(total), nil
+}
+
+// parseSNMPCurrEstab 解析 /proc/net/snmp 中成对出现的 Tcp: 标题行和数值行
+func parseSNMPCurrEstab(data []byte) (int, error) {
+	var header []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "Tcp:" {
+			continue
+		}
+		if header == nil {
+			header = fields
+			continue
+		}
+		for i, name := range header {
+			if name == "CurrEstab" && i < len(fields) {
+				return strconv.Atoi(fields[i])
+			}
+		}
+		break
+	}
+	return 0, errors.New("snmp has no Tcp CurrEstab")
+}
+
+// countEstablished 统计 /proc/net/tcp 中状态为 01 (ESTABLISHED) 和 08 (CLOSE_WAIT) 的连接，与 CurrEstab 的口径一致
+func countEstablished(data []byte) int {
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] == "sl" {
+			continue
+		}
+		if fields[3] == "01" || fields[3] == "08" {
+			n++
+		}
+	}
+	return n
+}
+
+// Disk 挂载点的使用率和可用空间，格式与 df -h 相同
+func Disk(path string) (pct, avail string, err error) {
+	total, free, available, err := statfs(path)
+	if err != nil {
+		return "", "", err
+	}
+	used := total - free
+	return strconv.FormatUint(dfPercent(used, available), 10), HumanSize(available), nil
+}
+
+// dfPercent 与 df 相同：used / (used + avail)，向上取整
+func dfPercent(used, avail uint64) uint64 {
+	if used+avail == 0 {
+		return 0
+	}
+	u100 := used * 100
+	pct := u100 / (used + avail)
+	if u100%(used+avail) != 0 {
+		pct++
+	}
+	return pct
+}
+
+// HumanSize 与 df -h 相同的大小格式：1024 进制、向上取整，小于 10 时保留一位小数，如 512K、4.0G、12G
+func HumanSize(bytes uint64) string {
+	if bytes < 1024 {
+		return strconv.FormatUint(bytes, 10)
+	}
+	units := []string{"K", "M", "G", "T", "P", "E"}
+	div := uint64(1024)
+	unit := 0
+	for unit < len(units)-1 && bytes/div >= 1024 {
+		div *= 1024
+		unit++
+	}
+	// 以十分之一为单位向上取整
+	tenths := bytes / div * 10
+	rem := bytes % div
+	tenths += (rem*10 + div - 1) / div
+	if tenths < 100 {
+		return fmt.Sprintf("%d.%d%s", tenths/10, tenths%10, units[unit])
+	}
+	whole := (bytes + div - 1) / div
+	if whole >= 1024 && unit < len(units)-1 {
+		return "1.0" + units[unit+1]
+	}
+	return fmt.Sprintf("%d%s", whole, units[unit])
+}
+
+// remoteSeparator 远程采集时分隔各项输出的标记
+const remoteSeparator = "__qwq_metrics__"
+
+// remoteCommand 远程采集使用的命令：一次读取 loadavg、meminfo、snmp 和根目录的 df -Pk，只建立一个会话
+var remoteCommand = strings.Join([]string{
+	"cat /proc/loadavg",
+	"cat /proc/meminfo",
+	"cat /proc/net/snmp",
+	"df -Pk / | awk 'NR==2{print $3,$4}'",
+}, "; echo "+remoteSeparator+"; ")
+
+// CollectWith 通过 shell 在其他主机上采集指标（如经 SSH 执行），解析方式与本机读取 /proc 相同
+// 负载或内存无法解析时返回错误，其余单项缺失时保持零值
+func CollectWith(shell func(cmd string) string) (Snapshot, error) {
+	parts := strings.Split(shell(remoteCommand), remoteSeparator)
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	var s Snapshot
+	var err error
+	if s.Load, err = parseLoadavg([]byte(parts[0])); err != nil {
+		return s, err
+	}
+	if s.MemTotalMB, s.MemUsedMB, err = parseMeminfo([]byte(parts[1])); err != nil {
+		return s, err
+	}
+	s.TCPConn = "0"
+	if n, err := parseSNMPCurrEstab([]byte(parts[2])); err == nil {
+		s.TCPConn = strconv.Itoa(n)
+	}
+	s.DiskPct, s.DiskAvail = "0", "0G"
+	var usedKB, availKB uint64
+	if n, _ := fmt.Sscanf(strings.TrimSpace(parts[3]), "%d %d", &usedKB, &availKB); n == 2 {
+		s.DiskPct, s.DiskAvail = strconv.FormatUint(dfPercent(usedKB, availKB), 10), HumanSize(availKB*1024)
+	}
+	return s, nil
+}
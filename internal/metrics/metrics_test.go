@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// useProc 让采集读取 testdata 中的 /proc 副本，回退到 shell 时返回 fallback
+func useProc(t *testing.T, root string, fallback string) *[]string {
+	t.Helper()
+	savedRoot, savedShell := procRoot, runShell
+	t.Cleanup(func() { procRoot, runShell = savedRoot, savedShell })
+	var commands []string
+	procRoot = root
+	runShell = func(c string) string {
+		commands = append(commands, c)
+		return fallback
+	}
+	return &commands
+}
+
+func TestParseLoadavg(t *testing.T) {
+	got, err := parseLoadavg(readFixture(t, "loadavg"))
+	if err != nil || got != "0.52, 0.58, 0.59" {
+		t.Errorf("Expected uptime-style load averages, got %q %v", got, err)
+	}
+	if _, err := parseLoadavg([]byte("0.52\n")); err == nil {
+		t.Error("Expected an error for a truncated loadavg")
+	}
+}
+
+func TestParseMeminfo(t *testing.T) {
+	// free -m: used = MemTotal - MemAvailable，KiB 截断为 MiB
+	total, used, err := parseMeminfo(readFixture(t, "meminfo"))
+	if err != nil || total != 7841 || used != 2837 {
+		t.Errorf("Expected 7841/2837 MiB, got %d/%d %v", total, used, err)
+	}
+	// 没有 MemAvailable 时减去 free、buffers 和 cache
+	total, used, err = parseMeminfo(readFixture(t, "meminfo_legacy"))
+	if err != nil || total != 2000 || used != 950 {
+		t.Errorf("Expected 2000/950 MiB without MemAvailable, got %d/%d %v", total, used, err)
+	}
+	if _, _, err := parseMeminfo([]byte("SwapTotal: 0 kB\n")); err == nil {
+		t.Error("Expected an error without MemTotal")
+	}
+}
+
+func TestTCPEstablished(t *testing.T) {
+	n, err := parseSNMPCurrEstab(readFixture(t, "net/snmp"))
+	if err != nil || n != 37 {
+		t.Errorf("Expected CurrEstab 37, got %d %v", n, err)
+	}
+	// ESTABLISHED 和 CLOSE_WAIT 计入，LISTEN 和 TIME_WAIT 不计入
+	if got := countEstablished(readFixture(t, "net/tcp")); got != 3 {
+		t.Errorf("Expected 3 established IPv4 connections, got %d", got)
+	}
+	if got := countEstablished(readFixture(t, "net/tcp6")); got != 1 {
+		t.Errorf("Expected 1 established IPv6 connection, got %d", got)
+	}
+
+	// 没有 /proc/net/snmp 时统计连接表
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "net"), 0755)
+	for _, name := range []string{"tcp", "tcp6"} {
+		os.WriteFile(filepath.Join(dir, "net", name), readFixture(t, "net/"+name), 0644)
+	}
+	useProc(t, dir, "")
+	if got, err := TCPEstablished(); err != nil || got != "4" {
+		t.Errorf("Expected 4 connections from the tables, got %q %v", got, err)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	const k, m, g = 1024, 1024 * 1024, 1024 * 1024 * 1024
+	cases := map[uint64]string{
+		512:              "512",
+		1536:             "1.5K",
+		512 * k:          "512K",
+		4 * g:            "4.0G",
+		4*g + 1:          "4.1G", // 与 df -h 一样向上取整
+		9*g + 400*m:      "9.4G",
+		9*g + 1000*m:     "10G",
+		37*g + 1:         "38G",
+		1023*g + 600*m:   "1.0T",
+		3*1024*g + 512*g: "3.5T",
+		2 << 50:          "2.0P",
+	}
+	for size, want := range cases {
+		if got := HumanSize(size); got != want {
+			t.Errorf("HumanSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestDfPercent(t *testing.T) {
+	// 与 df 一致：向上取整，保留给 root 的块不计入分母
+	if got := dfPercent(40, 60); got != 40 {
+		t.Errorf("Expected 40%%, got %d", got)
+	}
+	if got := dfPercent(1, 2); got != 34 {
+		t.Errorf("Expected 34%%, got %d", got)
+	}
+	if got := dfPercent(0, 0); got != 0 {
+		t.Errorf("Expected 0 for an empty filesystem, got %d", got)
+	}
+}
+
+func TestCollect_ReadsProc(t *testing.T) {
+	commands := useProc(t, "testdata", "")
+	s := Collect()
+	if s.Load != "0.52, 0.58, 0.59" || s.MemTotalMB != 7841 || s.MemUsedMB != 2837 || s.TCPConn != "37" {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+	if runtime.GOOS == "linux" {
+		if len(*commands) != 0 {
+			t.Errorf("Expected no shell commands on linux, ran %q", *commands)
+		}
+		if s.DiskPct == "" || s.DiskAvail == "" {
+			t.Errorf("Expected disk usage from statfs, got %+v", s)
+		}
+	}
+}
+
+func TestCollect_FallsBackToShell(t *testing.T) {
+	commands := useProc(t, t.TempDir(), "")
+	s := Collect()
+	// load、内存和 TCP 都回退到 shell 命令
+	if len(*commands) < 3 {
+		t.Errorf("Expected shell fallbacks when /proc is missing, ran %q", *commands)
+	}
+	if s.TCPConn != "0" || s.MemPct() != 0 {
+		t.Errorf("Expected empty defaults from the failed fallback, got %+v", s)
+	}
+}
+
+func TestCollectWith_ParsesRemoteOutput(t *testing.T) {
+	var outputs []string
+	for _, name := range []string{"loadavg", "meminfo", "net/snmp"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, string(data))
+	}
+	outputs = append(outputs, "47185920 4194304\n")
+	var ran []string
+	s, err := CollectWith(func(c string) string {
+		ran = append(ran, c)
+		return strings.Join(outputs, remoteSeparator+"\n")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("Expected a single command, ran %q", ran)
+	}
+	if s.Load != "0.52, 0.58, 0.59" || s.MemTotalMB != 7841 || s.MemUsedMB != 2837 || s.TCPConn != "37" || s.DiskPct != "92" || s.DiskAvail != "4.0G" {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+
+	// 连接断开等没有输出的情况返回错误
+	if _, err := CollectWith(func(string) string { return "" }); err == nil {
+		t.Error("Expected an error for empty output")
+	}
+}
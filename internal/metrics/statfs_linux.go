@@ -0,0 +1,15 @@
+//go:build linux
+
+package metrics
+
+import "syscall"
+
+// statfs 挂载点的总容量、剩余空间和非特权用户可用空间（字节）
+func statfs(path string) (total, free, avail uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	size := uint64(st.Bsize)
+	return st.Blocks * size, st.Bfree * size, st.Bavail * size, nil
+}
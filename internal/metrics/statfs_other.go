@@ -0,0 +1,8 @@
+//go:build !linux
+
+package metrics
+
+// statfs 非 Linux 平台回退到 df 命令
+func statfs(path string) (total, free, avail uint64, err error) {
+	return 0, 0, 0, ErrUnsupported
+}
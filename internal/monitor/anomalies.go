@@ -0,0 +1,322 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"qwq/internal/pagination"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultAnomalyRetention 巡检记录和异常历史的默认保留时间
+	DefaultAnomalyRetention = 90 * 24 * time.Hour
+	// DefaultAnomalyPruneInterval 清理过期异常历史的间隔
+	DefaultAnomalyPruneInterval = 6 * time.Hour
+	// MaxSummaryDays 异常统计最多返回的天数
+	MaxSummaryDays = 366
+)
+
+// ErrInvalidAnomalyQuery 异常查询的时间范围无效
+var ErrInvalidAnomalyQuery = errors.New("invalid anomaly query")
+
+// PatrolRecord 一次巡检的持久化记录
+type PatrolRecord struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RunID     int64     `json:"run_id" gorm:"index"` // 巡检记录编号，对应 /api/patrol/runs/{id}（重启后可能重复）
+	Trigger   string    `json:"trigger" gorm:"size:32"`
+	StartedAt time.Time `json:"started_at" gorm:"index;not null"`
+	Duration  int64     `json:"duration_ms"`
+	Checks    int       `json:"checks"`
+	Anomalies int       `json:"anomalies"`
+	Analysis  string    `json:"analysis,omitempty" gorm:"type:text"`
+}
+
+func (PatrolRecord) TableName() string { return "patrol_history" }
+
+// Anomaly 一个持续的异常：从首次发现到恢复之间多次巡检发现的同一异常只记录一行
+type Anomaly struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// Fingerprint 告警指纹（主机、检查项和标题），同一异常在多次巡检之间不变
+	Fingerprint string `json:"fingerprint" gorm:"size:64;index;not null"`
+	Type        string `json:"type" gorm:"size:64;index;not null"` // 检查项名称，如 disk、load
+	Host        string `json:"host" gorm:"size:128;index"`         // 远程主机名称，本机为空
+	Title       string `json:"title" gorm:"size:255"`
+	Severity    string `json:"severity" gorm:"size:16;index"`
+	Snippet     string `json:"snippet" gorm:"type:text"`  // 最近一次发现时的原始数据
+	Analysis    string `json:"analysis" gorm:"type:text"` // 最近一次发现时的 AI 分析
+	// FirstRecordID、LastRecordID 首次和最近一次发现该异常的巡检记录
+	FirstRecordID uint       `json:"first_record_id"`
+	LastRecordID  uint       `json:"last_record_id"`
+	FirstSeen     time.Time  `json:"first_seen" gorm:"index;not null"`
+	LastSeen      time.Time  `json:"last_seen" gorm:"index;not null"`
+	Occurrences   int        `json:"occurrences"`
+	ResolvedAt    *time.Time `json:"resolved_at" gorm:"index"`
+}
+
+func (Anomaly) TableName() string { return "patrol_anomalies" }
+
+// AnomalyModels 异常历史的表结构
+var AnomalyModels = []interface{}{&PatrolRecord{}, &Anomaly{}}
+
+// Observation 一次巡检中发现的异常
+type Observation struct {
+	Fingerprint string
+	Type        string
+	Host        string
+	Title       string
+	Severity    string
+	Snippet     string
+}
+
+// PatrolOutcome 一次巡检的结果，Unchecked 中的检查项（type@host，本机为 type）本轮超时或跳过，
+// 它们的未恢复异常保持原状，不因为没有出现而被标记为已恢复
+type PatrolOutcome struct {
+	Record    PatrolRecord
+	Observed  []Observation
+	Unchecked []string
+}
+
+// CheckKey 检查项在 Unchecked 中的键
+func CheckKey(check, host string) string {
+	if host == "" {
+		return check
+	}
+	return check + "@" + host
+}
+
+// AnomalyQuery 异常查询条件，From/To 为空时不限制，Resolved 为 nil 时返回全部
+// 时间范围按异常持续期间判断：首次发现不晚于 To，且最近一次发现不早于 From
+type AnomalyQuery struct {
+	From     time.Time
+	To       time.Time
+	Resolved *bool
+}
+
+// AnomalyListSpec 异常列表允许的排序字段和过滤参数，默认最近发现的在前
+var AnomalyListSpec = pagination.Spec{
+	Sort: map[string]string{
+		"first_seen": "first_seen", "last_seen": "last_seen", "resolved_at": "resolved_at",
+		"occurrences": "occurrences", "type": "type", "severity": "severity",
+	},
+	DefaultSort: "-first_seen",
+	Filters:     map[string]string{"type": "type", "host": "host", "severity": "severity"},
+}
+
+// DailyCount 某天首次发现的某类异常数量
+type DailyCount struct {
+	Date  string `json:"date"` // 本地时区的日期，如 2024-05-02
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// AnomalyStore 巡检记录和异常历史
+type AnomalyStore struct {
+	db        *gorm.DB
+	retention time.Duration
+	now       func() time.Time
+
+	// mu 串行化巡检结果的写入，避免手动和定时巡检同时更新同一异常
+	mu sync.Mutex
+}
+
+// NewAnomalyStore 创建异常历史存储，retention <= 0 时使用 DefaultAnomalyRetention
+func NewAnomalyStore(db *gorm.DB, retention time.Duration) *AnomalyStore {
+	if retention <= 0 {
+		retention = DefaultAnomalyRetention
+	}
+	return &AnomalyStore{db: db, retention: retention, now: time.Now}
+}
+
+// Retention 异常历史保留时间
+func (s *AnomalyStore) Retention() time.Duration {
+	return s.retention
+}
+
+// Record 保存一次巡检及其异常：已有未恢复的同一异常时更新最近发现时间，否则新建；
+// 本轮已检查但没有再出现的未恢复异常标记为已恢复，恢复时间为本轮巡检的开始时间
+func (s *AnomalyStore) Record(ctx context.Context, outcome PatrolOutcome, analysis string) (*PatrolRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := outcome.Record
+	record.ID = 0
+	record.Analysis = analysis
+	if record.StartedAt.IsZero() {
+		record.StartedAt = s.now()
+	}
+	record.Anomalies = len(outcome.Observed)
+	seenAt := record.StartedAt
+
+	unchecked := make(map[string]bool, len(outcome.Unchecked))
+	for _, key := range outcome.Unchecked {
+		unchecked[key] = true
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		var open []Anomaly
+		if err := tx.Where("resolved_at IS NULL").Find(&open).Error; err != nil {
+			return err
+		}
+		byFingerprint := make(map[string]*Anomaly, len(open))
+		for i := range open {
+			byFingerprint[open[i].Fingerprint] = &open[i]
+		}
+
+		observed := make(map[string]bool, len(outcome.Observed))
+		for _, o := range outcome.Observed {
+			if observed[o.Fingerprint] {
+				continue
+			}
+			observed[o.Fingerprint] = true
+			if existing, ok := byFingerprint[o.Fingerprint]; ok {
+				updates := map[string]interface{}{
+					"severity": o.Severity, "snippet": o.Snippet, "last_record_id": record.ID,
+					"last_seen": seenAt, "occurrences": existing.Occurrences + 1,
+				}
+				if analysis != "" {
+					updates["analysis"] = analysis
+				}
+				if err := tx.Model(existing).Updates(updates).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			anomaly := Anomaly{
+				Fingerprint: o.Fingerprint, Type: o.Type, Host: o.Host, Title: o.Title,
+				Severity: o.Severity, Snippet: o.Snippet, Analysis: analysis,
+				FirstRecordID: record.ID, LastRecordID: record.ID,
+				FirstSeen: seenAt, LastSeen: seenAt, Occurrences: 1,
+			}
+			if err := tx.Create(&anomaly).Error; err != nil {
+				return err
+			}
+		}
+
+		var resolved []uint
+		for _, anomaly := range open {
+			if !observed[anomaly.Fingerprint] && !unchecked[CheckKey(anomaly.Type, anomaly.Host)] {
+				resolved = append(resolved, anomaly.ID)
+			}
+		}
+		if len(resolved) > 0 {
+			return tx.Model(&Anomaly{}).Where("id IN ?", resolved).Update("resolved_at", seenAt).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record patrol history: %w", err)
+	}
+	return &record, nil
+}
+
+// scope 按时间范围和恢复状态过滤
+func (s *AnomalyStore) scope(ctx context.Context, q AnomalyQuery) (*gorm.DB, error) {
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return nil, fmt.Errorf("%w: to is before from", ErrInvalidAnomalyQuery)
+	}
+	tx := s.db.WithContext(ctx).Model(&Anomaly{})
+	if !q.From.IsZero() {
+		tx = tx.Where("last_seen >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("first_seen <= ?", q.To)
+	}
+	if q.Resolved != nil {
+		if *q.Resolved {
+			tx = tx.Where("resolved_at IS NOT NULL")
+		} else {
+			tx = tx.Where("resolved_at IS NULL")
+		}
+	}
+	return tx, nil
+}
+
+// List 分页查询异常，排序和 type、host、severity 过滤按 AnomalyListSpec
+func (s *AnomalyStore) List(ctx context.Context, q AnomalyQuery, page pagination.Query) (*pagination.Page[Anomaly], error) {
+	tx, err := s.scope(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Find[Anomaly](tx, page)
+}
+
+// Summary 按天（本地时区）和类型统计 [from, to] 内首次发现的异常数量，按日期和类型排序
+func (s *AnomalyStore) Summary(ctx context.Context, from, to time.Time, types []string) ([]DailyCount, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidAnomalyQuery)
+	}
+	if to.Sub(from) > MaxSummaryDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: range exceeds %d days", ErrInvalidAnomalyQuery, MaxSummaryDays)
+	}
+	tx := s.db.WithContext(ctx).Model(&Anomaly{}).Where("first_seen >= ? AND first_seen <= ?", from, to)
+	if len(types) > 0 {
+		tx = tx.Where("type IN ?", types)
+	}
+	var rows []struct {
+		Type      string
+		FirstSeen time.Time
+	}
+	if err := tx.Select("type", "first_seen").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// 日期在 Go 中按本地时区计算，SQLite 和 PostgreSQL 的日期函数不同
+	counts := make(map[DailyCount]int)
+	for _, row := range rows {
+		counts[DailyCount{Date: row.FirstSeen.Local().Format("2006-01-02"), Type: row.Type}]++
+	}
+	summary := make([]DailyCount, 0, len(counts))
+	for key, count := range counts {
+		key.Count = count
+		summary = append(summary, key)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Date != summary[j].Date {
+			return summary[i].Date < summary[j].Date
+		}
+		return summary[i].Type < summary[j].Type
+	})
+	return summary, nil
+}
+
+// Prune 删除超过保留时间的巡检记录和已恢复的异常，返回删除的异常数量
+// 未恢复的异常无论多久都保留
+func (s *AnomalyStore) Prune(ctx context.Context) (int64, error) {
+	cutoff := s.now().Add(-s.retention)
+	result := s.db.WithContext(ctx).Where("resolved_at IS NOT NULL AND resolved_at < ?", cutoff).Delete(&Anomaly{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := s.db.WithContext(ctx).Where("started_at < ?", cutoff).Delete(&PatrolRecord{}).Error; err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+var (
+	defaultAnomalies   *AnomalyStore
+	defaultAnomaliesMu sync.RWMutex
+)
+
+// SetDefaultAnomalies 设置全局异常历史存储，巡检结束后写入
+func SetDefaultAnomalies(store *AnomalyStore) {
+	defaultAnomaliesMu.Lock()
+	defer defaultAnomaliesMu.Unlock()
+	defaultAnomalies = store
+}
+
+// DefaultAnomalies 返回全局异常历史存储，未启用时为 nil
+func DefaultAnomalies() *AnomalyStore {
+	defaultAnomaliesMu.RLock()
+	defer defaultAnomaliesMu.RUnlock()
+	return defaultAnomalies
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"qwq/internal/pagination"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func openAnomalyStore(t *testing.T) *AnomalyStore {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(AnomalyModels...); err != nil {
+		t.Fatal(err)
+	}
+	return NewAnomalyStore(db, 0)
+}
+
+func TestAnomalyStore_RecordResolvesAnomaliesThatStopAppearing(t *testing.T) {
+	store := openAnomalyStore(t)
+	ctx := context.Background()
+	base := time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local)
+	disk := Observation{Fingerprint: "disk-sda1", Type: "disk", Title: "磁盘告警 (/dev/sda1)", Severity: "warning", Snippet: "91%"}
+	load := Observation{Fingerprint: "load-web-1", Type: "load", Host: "web-1", Title: "高负载", Severity: "warning", Snippet: "5.12"}
+
+	record := func(at time.Time, analysis string, unchecked []string, observed ...Observation) {
+		t.Helper()
+		outcome := PatrolOutcome{Record: PatrolRecord{Trigger: "schedule", StartedAt: at}, Observed: observed, Unchecked: unchecked}
+		if _, err := store.Record(ctx, outcome, analysis); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(base, "磁盘快满了", nil, disk, load)
+	disk.Snippet = "93%"
+	record(base.Add(5*time.Minute), "清理日志", nil, disk, load)
+	// load 所在主机本轮无法检查，异常保持未恢复；disk 不再出现，标记为已恢复
+	record(base.Add(10*time.Minute), "", []string{CheckKey("load", "web-1")})
+
+	page, err := store.List(ctx, AnomalyQuery{}, pagination.Query{Page: 1, PageSize: 10, Column: "type"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 {
+		t.Fatalf("Expected one row per continuous anomaly, got %+v", page.Items)
+	}
+	gotDisk, gotLoad := page.Items[0], page.Items[1]
+	if gotDisk.Occurrences != 2 || gotDisk.Snippet != "93%" || gotDisk.Analysis != "清理日志" || !gotDisk.LastSeen.Equal(base.Add(5*time.Minute)) {
+		t.Errorf("Expected the disk anomaly to be updated by the second run, got %+v", gotDisk)
+	}
+	if gotDisk.ResolvedAt == nil || !gotDisk.ResolvedAt.Equal(base.Add(10*time.Minute)) {
+		t.Errorf("Expected the disk anomaly to be resolved by the third run, got %v", gotDisk.ResolvedAt)
+	}
+	if gotLoad.ResolvedAt != nil || gotLoad.Host != "web-1" {
+		t.Errorf("Expected the unchecked load anomaly to stay open, got %+v", gotLoad)
+	}
+
+	// 恢复后再次出现时记为新的异常
+	record(base.Add(15*time.Minute), "", nil, disk)
+	resolved := false
+	page, _ = store.List(ctx, AnomalyQuery{Resolved: &resolved}, pagination.Query{Page: 1, PageSize: 10})
+	if page.Total != 1 || page.Items[0].Type != "disk" || page.Items[0].Occurrences != 1 {
+		t.Errorf("Expected only the reopened disk anomaly to be open, got %+v", page.Items)
+	}
+	page, _ = store.List(ctx, AnomalyQuery{From: base.Add(11 * time.Minute)}, pagination.Query{Page: 1, PageSize: 10})
+	if page.Total != 1 {
+		t.Errorf("Expected only anomalies seen after the window start, got %+v", page.Items)
+	}
+	if _, err := store.List(ctx, AnomalyQuery{From: base, To: base.Add(-time.Hour)}, pagination.Query{Page: 1, PageSize: 10}); !errors.Is(err, ErrInvalidAnomalyQuery) {
+		t.Errorf("Expected ErrInvalidAnomalyQuery, got %v", err)
+	}
+}
+
+func TestAnomalyStore_SummaryAndPrune(t *testing.T) {
+	store := openAnomalyStore(t)
+	ctx := context.Background()
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	store.now = func() time.Time { return now }
+
+	runs := []struct {
+		at       time.Time
+		observed []Observation
+	}{
+		{now.AddDate(0, 0, -100), []Observation{{Fingerprint: "old", Type: "disk"}}},
+		{now.AddDate(0, 0, -95), nil},
+		{now.AddDate(0, 0, -2), []Observation{{Fingerprint: "a", Type: "disk"}, {Fingerprint: "b", Type: "load"}}},
+		{now.AddDate(0, 0, -2).Add(time.Hour), []Observation{{Fingerprint: "c", Type: "disk"}}},
+		{now.AddDate(0, 0, -1), []Observation{{Fingerprint: "d", Type: "load"}}},
+	}
+	for _, run := range runs {
+		if _, err := store.Record(ctx, PatrolOutcome{Record: PatrolRecord{StartedAt: run.at}, Observed: run.observed}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := store.Summary(ctx, now.AddDate(0, 0, -7), now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DailyCount{{"2024-05-08", "disk", 2}, {"2024-05-08", "load", 1}, {"2024-05-09", "load", 1}}
+	if len(summary) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, summary)
+	}
+	for i := range want {
+		if summary[i] != want[i] {
+			t.Errorf("Expected %v at %d, got %v", want[i], i, summary[i])
+		}
+	}
+	if summary, _ := store.Summary(ctx, now.AddDate(0, 0, -7), now, []string{"load"}); len(summary) != 2 {
+		t.Errorf("Expected the type filter to keep two days, got %v", summary)
+	}
+	if _, err := store.Summary(ctx, now, now.AddDate(0, 0, -1), nil); !errors.Is(err, ErrInvalidAnomalyQuery) {
+		t.Errorf("Expected ErrInvalidAnomalyQuery, got %v", err)
+	}
+
+	// 只删除超过保留期的已恢复异常和巡检记录
+	deleted, err := store.Prune(ctx)
+	if err != nil || deleted != 1 {
+		t.Fatalf("Expected the 100 days old anomaly to be pruned, got %d %v", deleted, err)
+	}
+	var records int64
+	store.db.Model(&PatrolRecord{}).Count(&records)
+	if records != 3 {
+		t.Errorf("Expected the old patrol records to be pruned, got %d records", records)
+	}
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pseudoFilesystems 不占用磁盘空间的文件系统，不计入挂载点用量
+var pseudoFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true, "cgroup": true, "cgroup2": true,
+	"securityfs": true, "pstore": true, "bpf": true, "debugfs": true, "tracefs": true, "configfs": true, "fusectl": true,
+	"mqueue": true, "hugetlbfs": true, "autofs": true, "binfmt_misc": true, "rpc_pipefs": true, "nsfs": true,
+	"overlay": true, "squashfs": true, "ramfs": true, "efivarfs": true, "selinuxfs": true,
+}
+
+// MountUsage 一个挂载点的磁盘用量
+type MountUsage struct {
+	Mount  string  `json:"mount"`
+	Device string  `json:"device"`
+	FSType string  `json:"fstype"`
+	Total  uint64  `json:"total"` // 字节
+	Used   uint64  `json:"used"`
+	Avail  uint64  `json:"avail"` // 非 root 用户可用
+	Pct    float64 `json:"pct"`   // 与 df 相同：used / (used + avail)
+}
+
+// mountPoint /proc/mounts 中的一项
+type mountPoint struct {
+	Device, Mount, FSType string
+}
+
+// parseMounts 解析 /proc/mounts，跳过伪文件系统；同一设备挂载多次（bind mount）时只保留最短的挂载点
+func parseMounts(data []byte) []mountPoint {
+	byDevice := make(map[string]mountPoint)
+	var order []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || pseudoFilesystems[fields[2]] {
+			continue
+		}
+		// 挂载点中的空格等字符以八进制转义
+		mount := mountPoint{Device: fields[0], Mount: unescapeMount(fields[1]), FSType: fields[2]}
+		existing, ok := byDevice[mount.Device]
+		if !ok {
+			order = append(order, mount.Device)
+		}
+		if !ok || len(mount.Mount) < len(existing.Mount) {
+			byDevice[mount.Device] = mount
+		}
+	}
+	mounts := make([]mountPoint, 0, len(order))
+	for _, device := range order {
+		mounts = append(mounts, byDevice[device])
+	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Mount < mounts[j].Mount })
+	return mounts
+}
+
+// unescapeMount 还原 /proc/mounts 中 \040 形式的转义
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isOctal(c byte) bool { return c >= '0' && c <= '7' }
+
+// DiskMounts 所有真实文件系统挂载点的磁盘用量，按挂载点排序
+func DiskMounts() ([]MountUsage, error) {
+	data, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	var usages []MountUsage
+	for _, mount := range parseMounts(data) {
+		usage, err := statMount(mount)
+		if err != nil || usage.Total == 0 {
+			continue // 无权限访问或已卸载
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// diskPct 与 df 相同的使用率，保留一位小数
+func diskPct(used, avail uint64) float64 {
+	if used+avail == 0 {
+		return 0
+	}
+	pct := float64(used) * 100 / float64(used+avail)
+	return float64(int(pct*10+0.5)) / 10
+}
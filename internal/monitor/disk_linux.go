@@ -0,0 +1,26 @@
+//go:build linux
+
+package monitor
+
+import "syscall"
+
+// statMount 读取挂载点的容量
+func statMount(mount mountPoint) (MountUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(mount.Mount, &st); err != nil {
+		return MountUsage{}, err
+	}
+	size := uint64(st.Bsize)
+	total := st.Blocks * size
+	used := (st.Blocks - st.Bfree) * size
+	avail := st.Bavail * size
+	return MountUsage{
+		Mount:  mount.Mount,
+		Device: mount.Device,
+		FSType: mount.FSType,
+		Total:  total,
+		Used:   used,
+		Avail:  avail,
+		Pct:    diskPct(used, avail),
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package monitor
+
+import "errors"
+
+// statMount 非 Linux 平台没有 /proc/mounts，不会被调用
+func statMount(mount mountPoint) (MountUsage, error) {
+	return MountUsage{}, errors.New("disk usage is only supported on linux")
+}
@@ -0,0 +1,41 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+const fakeProcMounts = `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+tmpfs /run tmpfs rw,nosuid,nodev 0 0
+/dev/sdb1 /data xfs rw,relatime 0 0
+/dev/sdb1 /var/lib/docker/volumes/x xfs rw,relatime 0 0
+overlay /var/lib/docker/overlay2/abc/merged overlay rw 0 0
+/dev/sdc1 /mnt/backup\040disk ext4 rw 0 0
+`
+
+func TestParseMounts(t *testing.T) {
+	got := parseMounts([]byte(fakeProcMounts))
+	want := []mountPoint{
+		{Device: "/dev/sda1", Mount: "/", FSType: "ext4"},
+		{Device: "/dev/sdb1", Mount: "/data", FSType: "xfs"},
+		{Device: "/dev/sdc1", Mount: "/mnt/backup disk", FSType: "ext4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMounts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiskPct(t *testing.T) {
+	// 与 df 一致：保留给 root 的块不计入分母
+	if got := diskPct(40, 60); got != 40 {
+		t.Errorf("Expected 40%%, got %v", got)
+	}
+	if got := diskPct(1, 2); got != 33.3 {
+		t.Errorf("Expected 33.3%%, got %v", got)
+	}
+	if got := diskPct(0, 0); got != 0 {
+		t.Errorf("Expected 0 for an empty filesystem, got %v", got)
+	}
+}
@@ -0,0 +1,389 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 历史指标名称
+const (
+	MetricLoad    = "load"     // 1 分钟平均负载
+	MetricMemPct  = "mem_pct"  // 内存使用百分比
+	MetricDiskPct = "disk_pct" // 根目录磁盘使用百分比
+	MetricTCPConn = "tcp_conn" // TCP 已建立连接数
+
+	MetricHealthScore = "health_score" // 主机健康评分，每次巡检记录一次
+)
+
+// Aggregation 分桶聚合方式
+type Aggregation string
+
+const (
+	AggAvg Aggregation = "avg"
+	AggMin Aggregation = "min"
+	AggMax Aggregation = "max"
+)
+
+// 查询参数
+const (
+	DefaultQueryBuckets = 24
+	MaxQueryBuckets     = 60 // 防止返回给模型的序列过长
+)
+
+var (
+	// ErrUnknownMetric 未知指标
+	ErrUnknownMetric = errors.New("unknown metric")
+	// ErrInvalidAggregation 不支持的聚合方式
+	ErrInvalidAggregation = errors.New("invalid aggregation")
+)
+
+// KnownMetrics 支持查询的指标
+var KnownMetrics = []string{MetricLoad, MetricMemPct, MetricDiskPct, MetricTCPConn, MetricHealthScore}
+
+// stat 单个时间片内某指标的统计值
+type stat struct {
+	Sum   float64 `json:"s"`
+	Count int     `json:"n"`
+	Min   float64 `json:"lo"`
+	Max   float64 `json:"hi"`
+}
+
+func (s *stat) add(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+// historyPoint 一个时间片（默认 1 分钟）的统计数据
+type historyPoint struct {
+	Time   time.Time        `json:"t"`
+	Values map[string]*stat `json:"v"`
+}
+
+// History 监控指标历史
+// 采样按固定时间片聚合保存，超过保留期的数据被丢弃，可持久化到 JSON 文件
+type History struct {
+	mu         sync.RWMutex
+	path       string
+	resolution time.Duration
+	retention  time.Duration
+	maxPoints  int // 最多保留的时间片数，0 表示只按保留期丢弃
+	points     []*historyPoint
+}
+
+// NewHistory 创建指标历史存储，path 为空时不持久化
+func NewHistory(path string, resolution, retention time.Duration) *History {
+	return &History{path: path, resolution: resolution, retention: retention}
+}
+
+// DefaultHistory 全局指标历史：1 分钟粒度，保留 7 天
+var DefaultHistory = NewHistory("qwq_stats_history.json", time.Minute, 7*24*time.Hour)
+
+// Add 记录一次采样
+func (h *History) Add(t time.Time, values map[string]float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	slot := t.Truncate(h.resolution)
+	var point *historyPoint
+	if n := len(h.points); n > 0 && h.points[n-1].Time.Equal(slot) {
+		point = h.points[n-1]
+	} else {
+		point = &historyPoint{Time: slot, Values: make(map[string]*stat)}
+		h.points = append(h.points, point)
+	}
+	for name, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		s, ok := point.Values[name]
+		if !ok {
+			s = &stat{}
+			point.Values[name] = s
+		}
+		s.add(v)
+	}
+
+	// 丢弃超过保留期的数据
+	cutoff := slot.Add(-h.retention)
+	drop := 0
+	for drop < len(h.points) && h.points[drop].Time.Before(cutoff) {
+		drop++
+	}
+	if h.maxPoints > 0 && len(h.points)-drop > h.maxPoints {
+		drop = len(h.points) - h.maxPoints
+	}
+	if drop > 0 {
+		h.points = append([]*historyPoint(nil), h.points[drop:]...)
+	}
+}
+
+// SetMaxPoints 限制保留的时间片数，超出部分（最早的数据）立即丢弃，0 表示只按保留期丢弃
+func (h *History) SetMaxPoints(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxPoints = n
+	if n > 0 && len(h.points) > n {
+		h.points = append([]*historyPoint(nil), h.points[len(h.points)-n:]...)
+	}
+}
+
+// Len 当前保留的时间片数
+func (h *History) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.points)
+}
+
+// Load 从文件加载历史数据，文件不存在时忽略
+func (h *History) Load() error {
+	if h.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var points []*historyPoint
+	if err := json.Unmarshal(data, &points); err != nil {
+		return fmt.Errorf("failed to parse stats history: %w", err)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.maxPoints > 0 && len(points) > h.maxPoints {
+		points = points[len(points)-h.maxPoints:]
+	}
+	h.points = points
+	return nil
+}
+
+// Save 原子写入历史数据
+func (h *History) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	h.mu.RLock()
+	data, err := json.Marshal(h.points)
+	h.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// SeriesPoint 聚合后的序列点
+type SeriesPoint struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"v"`
+}
+
+// SeriesSummary 序列摘要，便于模型直接判断趋势
+type SeriesSummary struct {
+	Trend      string   `json:"trend"` // rising / falling / flat / unknown
+	Min        float64  `json:"min"`
+	Max        float64  `json:"max"`
+	Avg        float64  `json:"avg"`
+	Current    float64  `json:"current"`
+	DayAgo     *float64 `json:"day_ago,omitempty"`      // 24 小时前的值
+	DeltaVsDay *float64 `json:"delta_vs_24h,omitempty"` // 当前值与 24 小时前的差值
+}
+
+// Series 指标查询结果
+type Series struct {
+	Metric      string        `json:"metric"`
+	Aggregation Aggregation   `json:"aggregation"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Bucket      string        `json:"bucket"`
+	Points      []SeriesPoint `json:"points"`
+	Summary     SeriesSummary `json:"summary"`
+}
+
+// Query 查询指标在 [from, to] 内的分桶聚合序列，buckets 超过上限时被截断
+func (h *History) Query(metric string, from, to time.Time, buckets int, agg Aggregation) (*Series, error) {
+	if !isKnownMetric(metric) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetric, metric)
+	}
+	if agg == "" {
+		agg = AggAvg
+	}
+	if agg != AggAvg && agg != AggMin && agg != AggMax {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAggregation, agg)
+	}
+	if buckets <= 0 {
+		buckets = DefaultQueryBuckets
+	}
+	if buckets > MaxQueryBuckets {
+		buckets = MaxQueryBuckets
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid time range")
+	}
+
+	width := to.Sub(from) / time.Duration(buckets)
+	if width < h.resolution {
+		width = h.resolution
+		buckets = int(math.Ceil(float64(to.Sub(from)) / float64(width)))
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	aggregated := make([]stat, buckets)
+	var overall stat
+	var current float64
+	for _, point := range h.points {
+		if point.Time.Before(from) || point.Time.After(to) {
+			continue
+		}
+		s, ok := point.Values[metric]
+		if !ok || s.Count == 0 {
+			continue
+		}
+		index := int(point.Time.Sub(from) / width)
+		if index >= buckets {
+			index = buckets - 1
+		}
+		bucket := &aggregated[index]
+		if bucket.Count == 0 || s.Min < bucket.Min {
+			bucket.Min = s.Min
+		}
+		if bucket.Count == 0 || s.Max > bucket.Max {
+			bucket.Max = s.Max
+		}
+		bucket.Sum += s.Sum
+		bucket.Count += s.Count
+
+		overall.add(s.Sum / float64(s.Count))
+		current = s.Sum / float64(s.Count)
+	}
+
+	series := &Series{
+		Metric:      metric,
+		Aggregation: agg,
+		From:        from,
+		To:          to,
+		Bucket:      width.String(),
+		Points:      []SeriesPoint{},
+	}
+	for i, bucket := range aggregated {
+		if bucket.Count == 0 {
+			continue
+		}
+		var value float64
+		switch agg {
+		case AggMin:
+			value = bucket.Min
+		case AggMax:
+			value = bucket.Max
+		default:
+			value = bucket.Sum / float64(bucket.Count)
+		}
+		series.Points = append(series.Points, SeriesPoint{
+			Time:  from.Add(time.Duration(i) * width),
+			Value: round2(value),
+		})
+	}
+
+	series.Summary = SeriesSummary{Trend: "unknown"}
+	if overall.Count > 0 {
+		series.Summary.Min = round2(overall.Min)
+		series.Summary.Max = round2(overall.Max)
+		series.Summary.Avg = round2(overall.Sum / float64(overall.Count))
+		series.Summary.Current = round2(current)
+		series.Summary.Trend = trend(series.Points)
+		if dayAgo, ok := h.valueAtLocked(metric, to.Add(-24*time.Hour)); ok {
+			delta := round2(current - dayAgo)
+			dayAgo = round2(dayAgo)
+			series.Summary.DayAgo = &dayAgo
+			series.Summary.DeltaVsDay = &delta
+		}
+	}
+	return series, nil
+}
+
+// valueAtLocked 获取最接近时间 t 的平均值（误差在 30 分钟内）
+func (h *History) valueAtLocked(metric string, t time.Time) (float64, bool) {
+	const tolerance = 30 * time.Minute
+	best := -1
+	var bestDiff time.Duration
+	for i, point := range h.points {
+		s, ok := point.Values[metric]
+		if !ok || s.Count == 0 {
+			continue
+		}
+		diff := point.Time.Sub(t)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= tolerance && (best < 0 || diff < bestDiff) {
+			best, bestDiff = i, diff
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	s := h.points[best].Values[metric]
+	return s.Sum / float64(s.Count), true
+}
+
+// trend 比较序列前后三分之一的均值判断趋势，相对变化小于 5% 视为平稳
+func trend(points []SeriesPoint) string {
+	if len(points) < 3 {
+		return "unknown"
+	}
+	third := len(points) / 3
+	head, tail := 0.0, 0.0
+	for i := 0; i < third; i++ {
+		head += points[i].Value
+		tail += points[len(points)-1-i].Value
+	}
+	head /= float64(third)
+	tail /= float64(third)
+
+	base := math.Max(math.Abs(head), 1)
+	change := (tail - head) / base
+	switch {
+	case change > 0.05:
+		return "rising"
+	case change < -0.05:
+		return "falling"
+	default:
+		return "flat"
+	}
+}
+
+func isKnownMetric(metric string) bool {
+	for _, known := range KnownMetrics {
+		if metric == known {
+			return true
+		}
+	}
+	return false
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory_QueryAggregatesAndSummarizes(t *testing.T) {
+	h := NewHistory("", time.Minute, 7*24*time.Hour)
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	// 24 小时前的基准值
+	h.Add(now.Add(-24*time.Hour), map[string]float64{MetricMemPct: 40})
+	// 最近一小时内存持续上涨：每分钟两个采样
+	for i := 0; i < 60; i++ {
+		ts := now.Add(-time.Hour + time.Duration(i)*time.Minute)
+		h.Add(ts, map[string]float64{MetricMemPct: 50 + float64(i)})
+		h.Add(ts.Add(30*time.Second), map[string]float64{MetricMemPct: 51 + float64(i)})
+	}
+
+	series, err := h.Query(MetricMemPct, now.Add(-time.Hour), now, 6, AggMax)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(series.Points) != 6 {
+		t.Fatalf("Expected 6 buckets, got %d", len(series.Points))
+	}
+	if series.Points[0].Value != 60 {
+		t.Errorf("Expected max of first bucket to be 60, got %v", series.Points[0].Value)
+	}
+	if series.Summary.Trend != "rising" {
+		t.Errorf("Expected rising trend, got %s", series.Summary.Trend)
+	}
+	if series.Summary.Current != 109.5 {
+		t.Errorf("Expected current 109.5, got %v", series.Summary.Current)
+	}
+	if series.Summary.DayAgo == nil || *series.Summary.DayAgo != 40 || *series.Summary.DeltaVsDay != 69.5 {
+		t.Errorf("Unexpected 24h comparison: %+v", series.Summary)
+	}
+
+	if _, err := h.Query("cpu", now.Add(-time.Hour), now, 6, AggAvg); !errors.Is(err, ErrUnknownMetric) {
+		t.Errorf("Expected ErrUnknownMetric, got %v", err)
+	}
+	if _, err := h.Query(MetricLoad, now.Add(-time.Hour), now, 6, "p99"); !errors.Is(err, ErrInvalidAggregation) {
+		t.Errorf("Expected ErrInvalidAggregation, got %v", err)
+	}
+
+	// 桶数量上限
+	series, _ = h.Query(MetricMemPct, now.Add(-24*time.Hour), now, 1000, AggAvg)
+	if len(series.Points) > MaxQueryBuckets {
+		t.Errorf("Expected at most %d points, got %d", MaxQueryBuckets, len(series.Points))
+	}
+}
+
+func TestHistory_RetentionAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	h := NewHistory(path, time.Minute, time.Hour)
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	h.Add(now.Add(-2*time.Hour), map[string]float64{MetricLoad: 9})
+	h.Add(now, map[string]float64{MetricLoad: 1.5, MetricTCPConn: 12})
+	if len(h.points) != 1 {
+		t.Fatalf("Expected expired point to be dropped, got %d points", len(h.points))
+	}
+
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded := NewHistory(path, time.Minute, time.Hour)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	series, err := loaded.Query(MetricTCPConn, now.Add(-time.Hour), now.Add(time.Minute), 0, AggAvg)
+	if err != nil || len(series.Points) != 1 || series.Points[0].Value != 12 {
+		t.Errorf("Unexpected series after reload: %+v, %v", series, err)
+	}
+
+	if err := NewHistory(filepath.Join(t.TempDir(), "missing.json"), time.Minute, time.Hour).Load(); err != nil {
+		t.Errorf("Expected missing file to be ignored, got %v", err)
+	}
+}
+
+func TestHistory_MaxPoints(t *testing.T) {
+	h := NewHistory("", time.Minute, 24*time.Hour)
+	start := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		h.Add(start.Add(time.Duration(i)*time.Minute), map[string]float64{MetricLoad: float64(i)})
+	}
+
+	h.SetMaxPoints(4)
+	if h.Len() != 4 {
+		t.Fatalf("Expected history to shrink to 4 points, got %d", h.Len())
+	}
+	h.Add(start.Add(10*time.Minute), map[string]float64{MetricLoad: 10})
+	series, err := h.Query(MetricLoad, start, start.Add(time.Hour), 60, AggMax)
+	if err != nil || len(series.Points) != 4 || series.Points[0].Value != 7 || series.Points[3].Value != 10 {
+		t.Errorf("Expected the newest 4 points to be kept, got %+v, %v", series, err)
+	}
+
+	h.SetMaxPoints(0)
+	h.Add(start.Add(11*time.Minute), map[string]float64{MetricLoad: 11})
+	if h.Len() != 5 {
+		t.Errorf("Expected retention-only trimming after removing the cap, got %d points", h.Len())
+	}
+}
@@ -1,57 +1,340 @@
 package monitor
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"os"
+	"qwq/internal/cache"
 	"qwq/internal/config"
+	"regexp"
+	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	// DefaultCheckInterval HTTP 检查默认执行间隔
+	DefaultCheckInterval = 30 * time.Second
+	// DefaultCheckConcurrency 同时执行的 HTTP 检查数量上限
+	DefaultCheckConcurrency = 4
+	// checkTimeout 单次 HTTP 检查的超时时间
+	checkTimeout = 10 * time.Second
+	// maxStartupJitter 启动后第一次检查的最大随机延迟，避免所有检查同时发出
+	maxStartupJitter = 10 * time.Second
+	// staleIntervals 结果超过该倍数的间隔未更新即视为过期
+	staleIntervals = 2
+	// maxMatchBody 匹配 body_match 时读取的响应体上限
+	maxMatchBody = 1 << 20
+)
+
 // CheckResult 检查结果
 type CheckResult struct {
-	Name    string
-	URL     string
-	Success bool
-	Latency string
-	Error   string
+	Name       string
+	Type       string // http、tcp 或 tls
+	URL        string // HTTP 检查的地址，tcp/tls 检查为 host:port
+	Success    bool
+	Degraded   bool // 检查成功但需要关注：响应时间超过 max_latency_ms，或证书剩余天数低于 warn_days
+	StatusCode int  // 响应状态码，连接失败或非 HTTP 检查时为 0
+	DaysLeft   int  // TLS 证书剩余天数，已过期时为负数
+	Latency    string
+	LatencyMS  int64
+	Error      string
+	CheckedAt  time.Time // 执行时间，尚未执行过时为零值
+	Stale      bool      // 超过两个检查间隔没有更新（或尚未执行过），面板应置灰显示
 }
 
-// RunChecks 执行所有 HTTP 检查
-func RunChecks() []CheckResult {
-	var results []CheckResult
-	client := http.Client{
-		Timeout: 10 * time.Second, // 10秒超时
-	}
-
-	for _, rule := range config.GlobalConfig.HTTPRules {
-		start := time.Now()
-		resp, err := client.Get(rule.URL)
-		latency := time.Since(start).Milliseconds()
-		
-		res := CheckResult{
-			Name:    rule.Name,
-			URL:     rule.URL,
-			Latency: fmt.Sprintf("%dms", latency),
-		}
-
-		expectedCode := rule.Code
-		if expectedCode == 0 {
-			expectedCode = 200
-		}
-
-		if err != nil {
-			res.Success = false
-			res.Error = fmt.Sprintf("连接失败: %v", err)
-		} else {
-			defer resp.Body.Close()
-			if resp.StatusCode != expectedCode {
-				res.Success = false
-				res.Error = fmt.Sprintf("状态码异常: %d (期望 %d)", resp.StatusCode, expectedCode)
-			} else {
-				res.Success = true
+// CheckInterval 规则的执行间隔
+func CheckInterval(rule config.HTTPRule) time.Duration {
+	if rule.Interval > 0 {
+		return time.Duration(rule.Interval) * time.Second
+	}
+	return DefaultCheckInterval
+}
+
+// checkKey 规则的缓存键，名称或地址变化视为新的检查
+func checkKey(rule config.HTTPRule) string {
+	return rule.Name + "\x00" + checkTarget(rule)
+}
+
+// checkEntry 一个检查的调度状态，结果保存在 CheckScheduler.results
+type checkEntry struct {
+	next    time.Time // 下次执行时间
+	running bool
+	done    chan struct{} // 执行中时非 nil，结束时关闭
+}
+
+// CheckScheduler HTTP 检查调度器：每个检查按自己的间隔在后台执行，结果缓存后供面板实时监控和巡检读取，
+// 同一检查不会并发执行，所有检查同时执行的数量不超过上限
+type CheckScheduler struct {
+	mu      sync.Mutex
+	entries map[string]*checkEntry
+	results *cache.Cache[CheckResult] // 按 checkKey 缓存的最近一次结果
+	sem     chan struct{}
+	client  *http.Client
+	roots   *x509.CertPool // 校验 TLS 证书的根证书，nil 时使用系统根证书
+	rules   func() []config.HTTPRule
+	now     func() time.Time
+	jitter  func(max time.Duration) time.Duration
+}
+
+// NewCheckScheduler 创建 HTTP 检查调度器，检查规则从当前配置读取，运行时修改规则后自动生效
+func NewCheckScheduler(concurrency int) *CheckScheduler {
+	return newCheckScheduler(concurrency, nil)
+}
+
+// newCheckScheduler 创建 HTTP 检查调度器，store 非空时检查结果随该缓存 Store 持久化，重启后面板立即显示上次的结果
+func newCheckScheduler(concurrency int, store *cache.Store) *CheckScheduler {
+	if concurrency <= 0 {
+		concurrency = DefaultCheckConcurrency
+	}
+	return &CheckScheduler{
+		entries: make(map[string]*checkEntry),
+		results: cache.New[CheckResult](store, "monitor.http", cache.Options{}),
+		sem:     make(chan struct{}, concurrency),
+		client:  &http.Client{Timeout: checkTimeout},
+		rules:   func() []config.HTTPRule { return config.Current().HTTPRules },
+		now:     time.Now,
+		jitter: func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
 			}
+			return rand.N(max)
+		},
+	}
+}
+
+// DefaultChecks 全局 HTTP 检查调度器
+var DefaultChecks = newCheckScheduler(DefaultCheckConcurrency, cache.Default)
+
+// RunChecks 所有 HTTP 检查的缓存结果，不会发出请求
+func RunChecks() []CheckResult {
+	return DefaultChecks.Results()
+}
+
+// Run 按各检查的间隔在后台执行 HTTP 检查，直到 ctx 结束
+func (s *CheckScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		s.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch 启动到期的检查，并清理已从配置中删除的检查
+func (s *CheckScheduler) dispatch(ctx context.Context) {
+	rules := s.rules()
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	configured := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		key := checkKey(rule)
+		configured[key] = true
+		entry := s.entryLocked(rule, now)
+		if entry.running || now.Before(entry.next) {
+			continue
 		}
+		// 之后每次执行在间隔上加减 10% 的随机偏移，避免检查逐渐对齐
+		interval := CheckInterval(rule)
+		entry.next = now.Add(interval - interval/10 + s.jitter(interval/5))
+		s.startLocked(ctx, rule, entry)
+	}
+	for key, entry := range s.entries {
+		if !configured[key] && !entry.running {
+			delete(s.entries, key)
+		}
+	}
+	for _, key := range s.results.Keys() {
+		if entry, ok := s.entries[key]; !configured[key] && (!ok || !entry.running) {
+			s.results.Delete(key)
+		}
+	}
+}
+
+// entryLocked 检查的调度状态，新检查的第一次执行在启动后随机延迟
+func (s *CheckScheduler) entryLocked(rule config.HTTPRule, now time.Time) *checkEntry {
+	key := checkKey(rule)
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &checkEntry{next: now.Add(s.jitter(min(CheckInterval(rule), maxStartupJitter)))}
+		s.entries[key] = entry
+	}
+	return entry
+}
+
+// startLocked 在后台执行一次检查，调用方持有锁
+func (s *CheckScheduler) startLocked(ctx context.Context, rule config.HTTPRule, entry *checkEntry) {
+	entry.running = true
+	entry.done = make(chan struct{})
+	go func() {
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			s.finish(checkKey(rule), entry, nil)
+			return
+		}
+		res := s.check(ctx, rule)
+		<-s.sem
+		s.finish(checkKey(rule), entry, &res)
+	}()
+}
+
+func (s *CheckScheduler) finish(key string, entry *checkEntry, res *CheckResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if res != nil {
+		s.results.Set(key, *res)
+	}
+	entry.running = false
+	close(entry.done)
+	entry.done = nil
+}
+
+// Refresh 立即执行所有检查（已在执行中的等待其结束）并返回结果，巡检需要最新结果时使用
+func (s *CheckScheduler) Refresh(ctx context.Context) []CheckResult {
+	rules := s.rules()
+	now := s.now()
+	var waits []chan struct{}
+	s.mu.Lock()
+	for _, rule := range rules {
+		entry := s.entryLocked(rule, now)
+		if !entry.running {
+			entry.next = now.Add(CheckInterval(rule))
+			s.startLocked(ctx, rule, entry)
+		}
+		waits = append(waits, entry.done)
+	}
+	s.mu.Unlock()
+
+	for _, done := range waits {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return s.Results()
+		}
+	}
+	return s.Results()
+}
+
+// Results 按配置顺序返回各检查的缓存结果，尚未执行过的检查标记为过期
+func (s *CheckScheduler) Results() []CheckResult {
+	rules := s.rules()
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]CheckResult, 0, len(rules))
+	for _, rule := range rules {
+		res, ok := s.results.Get(checkKey(rule))
+		if !ok {
+			results = append(results, CheckResult{Name: rule.Name, Type: checkType(rule), URL: checkTarget(rule), Error: "尚未检查", Stale: true})
+			continue
+		}
+		res.Stale = now.Sub(res.CheckedAt) > staleIntervals*CheckInterval(rule)
 		results = append(results, res)
 	}
 	return results
-}
\ No newline at end of file
+}
+
+// check 按规则类型执行一次检查
+func (s *CheckScheduler) check(ctx context.Context, rule config.HTTPRule) CheckResult {
+	res := CheckResult{
+		Name:      rule.Name,
+		Type:      checkType(rule),
+		URL:       checkTarget(rule),
+		CheckedAt: s.now(),
+	}
+	switch res.Type {
+	case CheckTypeTCP:
+		s.checkTCP(ctx, rule, &res)
+	case CheckTypeTLS:
+		s.checkTLS(ctx, rule, &res)
+	default:
+		s.checkHTTP(ctx, rule, &res)
+	}
+	return res
+}
+
+// checkHTTP 执行一次 HTTP 检查：状态码不在期望范围内或响应体不匹配时失败，成功但超过延迟阈值时标记为缓慢
+func (s *CheckScheduler) checkHTTP(ctx context.Context, rule config.HTTPRule, res *CheckResult) {
+	lo, hi, err := rule.ExpectedStatus()
+	if err != nil {
+		res.Error = fmt.Sprintf("规则无效: %v", err)
+		return
+	}
+	var bodyMatch *regexp.Regexp
+	if rule.BodyMatch != "" {
+		if bodyMatch, err = regexp.Compile(rule.BodyMatch); err != nil {
+			res.Error = fmt.Sprintf("规则无效: body_match: %v", err)
+			return
+		}
+	}
+	method := rule.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, method, rule.URL, nil)
+	var resp *http.Response
+	if err == nil {
+		for name, value := range rule.Headers {
+			// 请求头的值可以引用环境变量，密钥不出现在配置和面板中
+			req.Header.Set(name, os.ExpandEnv(value))
+		}
+		if host := req.Header.Get("Host"); host != "" {
+			req.Host = host
+		}
+		resp, err = s.client.Do(req)
+	}
+	if err != nil {
+		res.setLatency(time.Since(start))
+		res.Error = fmt.Sprintf("连接失败: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+
+	var body []byte
+	if bodyMatch != nil {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxMatchBody))
+	}
+	res.setLatency(time.Since(start))
+	switch {
+	case resp.StatusCode < lo || resp.StatusCode > hi:
+		res.Error = fmt.Sprintf("状态码异常: %d (期望 %s)", resp.StatusCode, expectedStatus(lo, hi))
+	case err != nil:
+		res.Error = fmt.Sprintf("读取响应失败: %v", err)
+	case bodyMatch != nil && !bodyMatch.Match(body):
+		res.Error = fmt.Sprintf("响应内容不匹配: %s", rule.BodyMatch)
+	default:
+		res.Success = true
+		if rule.MaxLatencyMS > 0 && res.LatencyMS > int64(rule.MaxLatencyMS) {
+			res.Degraded = true
+			res.Error = fmt.Sprintf("响应缓慢: %dms (阈值 %dms)", res.LatencyMS, rule.MaxLatencyMS)
+		}
+	}
+}
+
+func (r *CheckResult) setLatency(d time.Duration) {
+	r.LatencyMS = d.Milliseconds()
+	r.Latency = fmt.Sprintf("%dms", r.LatencyMS)
+}
+
+// expectedStatus 期望状态码的显示形式
+func expectedStatus(lo, hi int) string {
+	if lo == hi {
+		return strconv.Itoa(lo)
+	}
+	return fmt.Sprintf("%d-%d", lo, hi)
+}
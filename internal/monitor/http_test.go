@@ -0,0 +1,195 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScheduler 使用固定时钟、无随机延迟的调度器
+func newTestScheduler(concurrency int, rules []config.HTTPRule) (*CheckScheduler, *time.Time) {
+	s := NewCheckScheduler(concurrency)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.rules = func() []config.HTTPRule { return rules }
+	s.now = func() time.Time { return now }
+	s.jitter = func(time.Duration) time.Duration { return 0 }
+	return s, &now
+}
+
+// waitIdle 等待所有检查执行结束
+func waitIdle(t *testing.T, s *CheckScheduler) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		s.mu.Lock()
+		running := false
+		for _, entry := range s.entries {
+			running = running || entry.running
+		}
+		s.mu.Unlock()
+		if !running {
+			return
+		}
+	}
+	t.Fatal("checks did not finish")
+}
+
+func TestCheckScheduler_CachesResultsPerInterval(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+	s, now := newTestScheduler(2, []config.HTTPRule{{Name: "home", URL: srv.URL, Interval: 30}})
+	ctx := context.Background()
+
+	if results := s.Results(); len(results) != 1 || !results[0].Stale || !results[0].CheckedAt.IsZero() {
+		t.Fatalf("Expected a stale placeholder before the first check, got %+v", results)
+	}
+
+	s.dispatch(ctx)
+	waitIdle(t, s)
+	results := s.Results()
+	if len(results) != 1 || !results[0].Success || results[0].Stale || !results[0].CheckedAt.Equal(*now) {
+		t.Fatalf("Expected a fresh successful result, got %+v", results)
+	}
+
+	// 间隔内读取结果和调度都不会再发出请求
+	*now = now.Add(10 * time.Second)
+	s.dispatch(ctx)
+	waitIdle(t, s)
+	s.Results()
+	if hits.Load() != 1 {
+		t.Errorf("Expected one request within the interval, got %d", hits.Load())
+	}
+
+	*now = now.Add(25 * time.Second)
+	s.dispatch(ctx)
+	waitIdle(t, s)
+	if hits.Load() != 2 {
+		t.Errorf("Expected the check to run again after its interval, got %d", hits.Load())
+	}
+
+	// 超过两个间隔没有更新即为过期
+	*now = now.Add(61 * time.Second)
+	if results := s.Results(); !results[0].Stale {
+		t.Errorf("Expected the result to be stale after two intervals, got %+v", results[0])
+	}
+	if results := s.Refresh(ctx); results[0].Stale || hits.Load() != 3 {
+		t.Errorf("Expected Refresh to run the check immediately, got %+v (%d requests)", results[0], hits.Load())
+	}
+}
+
+func TestCheckScheduler_CapsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		inFlight.Add(-1)
+	}))
+	defer srv.Close()
+
+	var rules []config.HTTPRule
+	for i := 0; i < 6; i++ {
+		rules = append(rules, config.HTTPRule{Name: fmt.Sprintf("svc%d", i), URL: fmt.Sprintf("%s/%d", srv.URL, i)})
+	}
+	s, _ := newTestScheduler(2, rules)
+	s.dispatch(context.Background())
+	// 执行中的检查不会被重复调度
+	s.dispatch(context.Background())
+
+	for deadline := time.Now().Add(2 * time.Second); inFlight.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if peak.Load() != 2 {
+		t.Errorf("Expected at most 2 concurrent checks, peak was %d", peak.Load())
+	}
+	close(release)
+	waitIdle(t, s)
+	for _, res := range s.Results() {
+		if !res.Success {
+			t.Errorf("Expected %s to succeed, got %+v", res.Name, res)
+		}
+	}
+}
+
+func TestCheckScheduler_DropsRemovedRules(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	rules := []config.HTTPRule{{Name: "api", URL: srv.URL}}
+	s, _ := newTestScheduler(1, rules)
+	s.rules = func() []config.HTTPRule { return rules }
+	s.dispatch(context.Background())
+	waitIdle(t, s)
+	if results := s.Results(); results[0].Success || results[0].Error == "" {
+		t.Errorf("Expected an unexpected status code failure, got %+v", results[0])
+	}
+
+	rules = nil
+	s.dispatch(context.Background())
+	if len(s.entries) != 0 || len(s.Results()) != 0 {
+		t.Errorf("Expected removed rules to be dropped, got %d entries", len(s.entries))
+	}
+}
+
+func TestCheck_MatchesRequestAndResponse(t *testing.T) {
+	t.Setenv("QWQ_TEST_HEALTH_TOKEN", "secret")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead && r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(30 * time.Millisecond)
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer srv.Close()
+	auth := map[string]string{"Authorization": "Bearer ${QWQ_TEST_HEALTH_TOKEN}"}
+
+	tests := []struct {
+		name     string
+		rule     config.HTTPRule
+		success  bool
+		degraded bool
+		status   int
+	}{
+		{"header and body", config.HTTPRule{URL: srv.URL, Headers: auth, BodyMatch: `"status":\s*"ok"`}, true, false, 200},
+		{"missing header", config.HTTPRule{URL: srv.URL}, false, false, 401},
+		{"body mismatch", config.HTTPRule{URL: srv.URL, Headers: auth, BodyMatch: "healthy"}, false, false, 200},
+		{"code range", config.HTTPRule{URL: srv.URL + "/created", Headers: auth, CodeRange: "2xx"}, true, false, 201},
+		{"exact code", config.HTTPRule{URL: srv.URL + "/created", Headers: auth}, false, false, 201},
+		{"method", config.HTTPRule{URL: srv.URL, Method: http.MethodHead}, true, false, 200},
+		{"slow", config.HTTPRule{URL: srv.URL + "/slow", Headers: auth, MaxLatencyMS: 10}, true, true, 200},
+	}
+	s, _ := newTestScheduler(1, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name = tt.name
+			res := s.check(context.Background(), tt.rule)
+			if res.Success != tt.success || res.Degraded != tt.degraded || res.StatusCode != tt.status {
+				t.Errorf("Expected success=%v degraded=%v status=%d, got %+v", tt.success, tt.degraded, tt.status, res)
+			}
+			if !tt.success && res.Error == "" {
+				t.Error("Expected an error for a failed check")
+			}
+		})
+	}
+}
@@ -43,4 +43,37 @@ func UpdateAppMetrics(results []CheckResult) {
 		}
 		AppStatus.WithLabelValues(res.Name, res.URL).Set(val)
 	}
-}
\ No newline at end of file
+}
+// Panics 已恢复的 panic 次数，按来源（HTTP 处理器、后台任务名）区分
+var Panics = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "qwq_panics_total",
+	Help: "Total recovered panics",
+}, []string{"source"})
+
+// qwq 自身的资源限制和占用，Go 运行时（go_*）和进程（process_*）指标由默认注册表提供
+var (
+	SelfRSS = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "qwq_self_rss_bytes",
+		Help: "Resident memory of the qwq process",
+	})
+	SelfGoroutines = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "qwq_self_goroutines",
+		Help: "Goroutines in the qwq process",
+	})
+	SelfMemoryLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "qwq_self_memory_limit_bytes",
+		Help: "Memory limit of the qwq cgroup (0 = unlimited)",
+	})
+	SelfCPULimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "qwq_self_cpu_limit_cores",
+		Help: "CPU quota of the qwq cgroup in cores (0 = unlimited)",
+	})
+	SelfGOMAXPROCS = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "qwq_self_gomaxprocs",
+		Help: "GOMAXPROCS of the qwq process",
+	})
+	SelfMemoryPressure = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "qwq_self_memory_pressure",
+		Help: "1 when qwq is near its memory limit and in-memory caches are shrunk",
+	})
+)
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net"
+	"qwq/internal/config"
+	"strconv"
+	"time"
+)
+
+// 检查类型，对应 http_rules 中的 type
+const (
+	CheckTypeHTTP = config.CheckTypeHTTP
+	CheckTypeTCP  = config.CheckTypeTCP
+	CheckTypeTLS  = config.CheckTypeTLS
+)
+
+// defaultTLSPort TLS 检查的默认端口
+const defaultTLSPort = 443
+
+// checkType 规则的检查类型，未设置时为 HTTP
+func checkType(rule config.HTTPRule) string {
+	if rule.Type == "" {
+		return CheckTypeHTTP
+	}
+	return rule.Type
+}
+
+// checkTarget 检查的目标：HTTP 检查为地址，tcp/tls 检查为 host:port
+func checkTarget(rule config.HTTPRule) string {
+	switch checkType(rule) {
+	case CheckTypeTCP, CheckTypeTLS:
+		port := rule.Port
+		if port == 0 && rule.Type == CheckTypeTLS {
+			port = defaultTLSPort
+		}
+		return net.JoinHostPort(rule.Host, strconv.Itoa(port))
+	default:
+		return rule.URL
+	}
+}
+
+// dialTimeout tcp/tls 检查的连接超时
+func dialTimeout(rule config.HTTPRule) time.Duration {
+	if rule.Timeout > 0 {
+		return time.Duration(rule.Timeout) * time.Second
+	}
+	return checkTimeout
+}
+
+// checkTCP 检查端口是否可以连接，Latency 为建立连接的时间
+func (s *CheckScheduler) checkTCP(ctx context.Context, rule config.HTTPRule, res *CheckResult) {
+	start := time.Now()
+	dialer := net.Dialer{Timeout: dialTimeout(rule)}
+	conn, err := dialer.DialContext(ctx, "tcp", res.URL)
+	res.setLatency(time.Since(start))
+	if err != nil {
+		res.Error = fmt.Sprintf("连接失败: %v", err)
+		return
+	}
+	conn.Close()
+	res.Success = true
+}
+
+// checkTLS 完成 TLS 握手后检查服务端证书：证书无效或已过期时失败，剩余天数低于 warn_days 时标记为需要关注
+func (s *CheckScheduler) checkTLS(ctx context.Context, rule config.HTTPRule, res *CheckResult) {
+	start := time.Now()
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: dialTimeout(rule)},
+		// 先取得证书再校验，过期的证书也能报告剩余天数
+		Config: &tls.Config{ServerName: rule.Host, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", res.URL)
+	res.setLatency(time.Since(start))
+	if err != nil {
+		res.Error = fmt.Sprintf("TLS 握手失败: %v", err)
+		return
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	conn.Close()
+	if len(state.PeerCertificates) == 0 {
+		res.Error = "服务端没有提供证书"
+		return
+	}
+
+	leaf := state.PeerCertificates[0]
+	now := time.Now()
+	res.DaysLeft = int(math.Floor(leaf.NotAfter.Sub(now).Hours() / 24))
+	if now.After(leaf.NotAfter) {
+		res.Error = fmt.Sprintf("证书已于 %s 过期", leaf.NotAfter.Format(time.DateOnly))
+		return
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: rule.Host, Roots: s.roots, Intermediates: intermediates, CurrentTime: now}); err != nil {
+		res.Error = fmt.Sprintf("证书校验失败: %v", err)
+		return
+	}
+
+	res.Success = true
+	warnDays := rule.WarnDays
+	if warnDays == 0 {
+		warnDays = config.DefaultCertWarnDays
+	}
+	if res.DaysLeft < warnDays {
+		res.Degraded = true
+		res.Error = fmt.Sprintf("证书将在 %d 天后过期 (%s)", res.DaysLeft, leaf.NotAfter.Format(time.DateOnly))
+	}
+}
@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCertServer 使用自签名证书的本地 TLS 服务，证书在 notAfter 过期，返回服务和信任该证书的根证书池
+func newCertServer(t *testing.T, notAfter time.Time) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "qwq test"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              notAfter,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return srv, roots
+}
+
+// hostPort 服务监听的主机和端口
+func hostPort(t *testing.T, srv *httptest.Server) (string, int) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+func TestCheck_TLSCertificateExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		trusted  bool
+		success  bool
+		degraded bool
+		days     int
+	}{
+		{"valid", time.Now().Add(90*24*time.Hour + time.Hour), true, true, false, 90},
+		{"expiring", time.Now().Add(5*24*time.Hour + time.Hour), true, true, true, 5},
+		{"expired", time.Now().Add(-24*time.Hour + time.Hour), true, false, false, -1},
+		{"untrusted", time.Now().Add(90*24*time.Hour + time.Hour), false, false, false, 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, roots := newCertServer(t, tt.notAfter)
+			host, port := hostPort(t, srv)
+			s, _ := newTestScheduler(1, nil)
+			if tt.trusted {
+				s.roots = roots
+			} else {
+				s.roots = x509.NewCertPool()
+			}
+			res := s.check(context.Background(), config.HTTPRule{Name: "site", Type: CheckTypeTLS, Host: host, Port: port})
+			if res.Success != tt.success || res.Degraded != tt.degraded || res.DaysLeft != tt.days || res.Type != CheckTypeTLS {
+				t.Errorf("Expected success=%v degraded=%v days=%d, got %+v", tt.success, tt.degraded, tt.days, res)
+			}
+			if (!tt.success || tt.degraded) && res.Error == "" {
+				t.Error("Expected an error describing the certificate problem")
+			}
+		})
+	}
+}
+
+func TestCheck_TCPAndTLSFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	host, port := hostPort(t, srv)
+	s, _ := newTestScheduler(1, nil)
+	ctx := context.Background()
+
+	if res := s.check(ctx, config.HTTPRule{Name: "db", Type: CheckTypeTCP, Host: host, Port: port}); !res.Success || res.URL != srv.Listener.Addr().String() || res.Latency == "" {
+		t.Errorf("Expected the open port to be reachable, got %+v", res)
+	}
+	// 明文服务上的 TLS 握手失败
+	if res := s.check(ctx, config.HTTPRule{Name: "site", Type: CheckTypeTLS, Host: host, Port: port, Timeout: 2}); res.Success || !strings.Contains(res.Error, "握手") {
+		t.Errorf("Expected a handshake failure, got %+v", res)
+	}
+	srv.Close()
+	if res := s.check(ctx, config.HTTPRule{Name: "db", Type: CheckTypeTCP, Host: host, Port: port, Timeout: 1}); res.Success || res.Error == "" {
+		t.Errorf("Expected the closed port to fail, got %+v", res)
+	}
+}
+
+func TestCheckScheduler_MixesCheckTypes(t *testing.T) {
+	srv, roots := newCertServer(t, time.Now().Add(30*24*time.Hour))
+	host, port := hostPort(t, srv)
+	s, _ := newTestScheduler(2, []config.HTTPRule{
+		{Name: "home", URL: srv.URL + "/", Code: 200},
+		{Name: "port", Type: CheckTypeTCP, Host: host, Port: port},
+		{Name: "cert", Type: CheckTypeTLS, Host: host, Port: port},
+	})
+	s.roots = roots
+	s.client = srv.Client()
+
+	results := s.Refresh(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("Expected all three checks, got %+v", results)
+	}
+	for i, want := range []string{CheckTypeHTTP, CheckTypeTCP, CheckTypeTLS} {
+		if results[i].Type != want || !results[i].Success || results[i].Stale {
+			t.Errorf("Expected a fresh successful %s result, got %+v", want, results[i])
+		}
+	}
+}
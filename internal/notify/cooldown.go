@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"qwq/internal/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultAlertCooldown 同一异常重复推送的默认冷却时间
+const DefaultAlertCooldown = time.Hour
+
+// DefaultAlertStateFile 已推送告警状态的持久化文件
+const DefaultAlertStateFile = "qwq_alert_state.json"
+
+var severityRanks = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityCritical: 2}
+
+// FiredAlert 已推送、尚未恢复的告警
+type FiredAlert struct {
+	Fingerprint string    `json:"fingerprint"`
+	Category    string    `json:"category"`
+	Title       string    `json:"title"`
+	Severity    string    `json:"severity"`
+	Host        string    `json:"host,omitempty"` // 告警所属的主机，远程主机的告警恢复时按该主机发送
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSent    time.Time `json:"last_sent"`
+}
+
+// AlertState 跟踪已推送到通知渠道的告警：冷却时间内重复出现的异常不再推送，严重程度升高时立即推送；
+// 本轮不再出现的告警视为已恢复。每轮结束后原子写入文件，重启后冷却时间和恢复通知不受影响
+type AlertState struct {
+	mu     sync.Mutex
+	path   string // 为空时不持久化
+	loaded bool
+	fired  map[string]FiredAlert
+}
+
+// NewAlertState 创建告警状态，第一次使用时从文件加载
+func NewAlertState(path string) *AlertState {
+	return &AlertState{path: path, fired: make(map[string]FiredAlert)}
+}
+
+// Fire 记录本轮出现的告警，返回是否需要推送：第一次出现、严重程度升高或距上次推送超过冷却时间
+// cooldown <= 0 时每轮都推送
+func (s *AlertState) Fire(now time.Time, alert ExternalAlert, cooldown time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ensureLoadedLocked()
+
+	state, ok := s.fired[alert.Fingerprint]
+	if !ok {
+		state = FiredAlert{Fingerprint: alert.Fingerprint, FirstSeen: now}
+	}
+	send := !ok || cooldown <= 0 || now.Sub(state.LastSent) >= cooldown ||
+		severityRanks[alert.Event.Severity] > severityRanks[state.Severity]
+	state.Category, state.Title, state.Severity, state.Host = alert.Event.Category, alert.Event.Title, alert.Event.Severity, alert.Event.Host
+	if send {
+		state.LastSent = now
+	}
+	s.fired[alert.Fingerprint] = state
+	return send
+}
+
+// Resolve 本轮未出现在 active 中的告警视为已恢复，返回这些告警（按首次出现时间排列）并保存状态
+func (s *AlertState) Resolve(active []string) []FiredAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ensureLoadedLocked()
+
+	seen := make(map[string]bool, len(active))
+	for _, fingerprint := range active {
+		seen[fingerprint] = true
+	}
+	var resolved []FiredAlert
+	for fingerprint, state := range s.fired {
+		if seen[fingerprint] {
+			continue
+		}
+		delete(s.fired, fingerprint)
+		resolved = append(resolved, state)
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].FirstSeen.Before(resolved[j].FirstSeen) })
+	s.saveLocked()
+	return resolved
+}
+
+func (s *AlertState) ensureLoadedLocked() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	if s.path == "" {
+		return
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Info("⚠️ 读取告警状态失败: %v", err)
+		}
+		return
+	}
+	var list []FiredAlert
+	if err := json.Unmarshal(data, &list); err != nil {
+		logger.Info("⚠️ 告警状态格式错误，已忽略: %v", err)
+		return
+	}
+	for _, state := range list {
+		s.fired[state.Fingerprint] = state
+	}
+}
+
+// saveLocked 原子写入告警状态，调用方持有锁
+func (s *AlertState) saveLocked() {
+	if s.path == "" {
+		return
+	}
+	list := make([]FiredAlert, 0, len(s.fired))
+	for _, state := range s.fired {
+		list = append(list, state)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Fingerprint < list[j].Fingerprint })
+	data, err := json.Marshal(list)
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存告警状态失败: %v", err)
+	}
+}
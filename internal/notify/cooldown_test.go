@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAlertState_CooldownAndEscalation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := NewAlertState(path)
+	now := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	alert := func(severity string) ExternalAlert {
+		return ExternalAlert{Fingerprint: "abc", Event: Event{Severity: severity, Category: "disk", Title: "磁盘告警 (/dev/sda1)"}}
+	}
+
+	steps := []struct {
+		at       time.Duration
+		severity string
+		send     bool
+	}{
+		{0, SeverityWarning, true},
+		{5 * time.Minute, SeverityWarning, false},
+		{10 * time.Minute, SeverityCritical, true}, // 严重程度升高
+		{15 * time.Minute, SeverityWarning, false},
+		{20 * time.Minute, SeverityCritical, true}, // 降级后再次升高
+		{70 * time.Minute, SeverityCritical, false},
+		{80 * time.Minute, SeverityCritical, true}, // 超过冷却时间，再次提醒
+	}
+	for _, step := range steps {
+		if got := state.Fire(now.Add(step.at), alert(step.severity), time.Hour); got != step.send {
+			t.Errorf("Fire at +%v (%s) = %v, want %v", step.at, step.severity, got, step.send)
+		}
+	}
+	if resolved := state.Resolve([]string{"abc"}); len(resolved) != 0 {
+		t.Errorf("Active alerts should not resolve, got %+v", resolved)
+	}
+
+	// 重启后保留上次推送时间
+	reloaded := NewAlertState(path)
+	if reloaded.Fire(now.Add(90*time.Minute), alert(SeverityCritical), time.Hour) {
+		t.Error("Expected the cooldown to survive a reload")
+	}
+	resolved := reloaded.Resolve(nil)
+	if len(resolved) != 1 || resolved[0].Title != "磁盘告警 (/dev/sda1)" || !resolved[0].FirstSeen.Equal(now) {
+		t.Errorf("Expected the alert to resolve with its first occurrence, got %+v", resolved)
+	}
+	if !NewAlertState(path).Fire(now, alert(SeverityWarning), time.Hour) {
+		t.Error("A resolved alert should notify again when it comes back")
+	}
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/textproto"
+	"os"
+	"qwq/internal/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDeliveryLogFile 通知投递记录的持久化文件，每行一条 JSON
+	DefaultDeliveryLogFile = "qwq_notify_history.jsonl"
+	// MaxDeliveryRecords 内存中保留和接口返回的最近投递记录数
+	MaxDeliveryRecords = 100
+	// DefaultNotifyAttempts 每个渠道发送一条通知的最多尝试次数
+	DefaultNotifyAttempts = 3
+	// notifyBackoff 第一次重试前的等待时间，之后每次翻倍并加上随机抖动
+	notifyBackoff = time.Second
+	// maxDeliveryLines 投递记录文件超过该行数时重写为最近的 MaxDeliveryRecords 条
+	maxDeliveryLines = 1000
+)
+
+// 投递结果
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+)
+
+// DeliveryRecord 一条通知向一个渠道的投递记录
+type DeliveryRecord struct {
+	Channel  string    `json:"channel"`
+	Title    string    `json:"title"`
+	Time     time.Time `json:"time"` // 最后一次尝试结束的时间
+	Attempts int       `json:"attempts"`
+	Status   string    `json:"status"` // sent 或 failed
+	Error    string    `json:"error,omitempty"`
+}
+
+// retryableError 可以重试的发送错误，如限流（钉钉 errcode 130101、HTTP 429）和服务端 5xx
+type retryableError struct{ error }
+
+func (e retryableError) Unwrap() error { return e.error }
+
+// isRetryable 发送错误是否是暂时的：网络错误、SMTP 4xx 临时错误和标记为可重试的错误，
+// 其余错误（如地址或 token 无效）重试也不会成功
+func isRetryable(err error) bool {
+	var netErr net.Error
+	var smtpErr *textproto.Error
+	var retryable retryableError
+	return errors.As(err, &netErr) || (errors.As(err, &smtpErr) && smtpErr.Code/100 == 4) || errors.As(err, &retryable)
+}
+
+// sendWithRetry 发送一条通知，暂时的失败按指数退避（带随机抖动）重试，返回投递记录
+func sendWithRetry(notifier Notifier, title, content string, attempts int, backoff time.Duration) DeliveryRecord {
+	record := DeliveryRecord{Channel: notifier.Name(), Title: title}
+	wait := backoff
+	for {
+		record.Attempts++
+		err := notifier.Send(title, content)
+		if err == nil {
+			record.Status, record.Error = DeliverySent, ""
+			break
+		}
+		record.Status, record.Error = DeliveryFailed, err.Error()
+		if record.Attempts >= attempts || !isRetryable(err) {
+			break
+		}
+		time.Sleep(wait + rand.N(wait/2+1))
+		wait *= 2
+	}
+	record.Time = time.Now()
+	return record
+}
+
+// DeliveryLog 最近的通知投递记录，追加写入 JSONL 文件，重启后仍可查询
+type DeliveryLog struct {
+	mu      sync.Mutex
+	path    string // 为空时不持久化
+	loaded  bool
+	lines   int // 文件中的行数
+	records []DeliveryRecord
+}
+
+// NewDeliveryLog 创建投递记录，第一次使用时从文件加载最近的记录
+func NewDeliveryLog(path string) *DeliveryLog {
+	return &DeliveryLog{path: path}
+}
+
+// DefaultDeliveryLog 全局投递记录，默认只保存在内存中，qwq 启动时替换为写入 DefaultDeliveryLogFile 的记录
+var DefaultDeliveryLog = NewDeliveryLog("")
+
+// Add 追加一条投递记录
+func (l *DeliveryLog) Add(record DeliveryRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ensureLoadedLocked()
+	l.records = append(l.records, record)
+	if len(l.records) > MaxDeliveryRecords {
+		l.records = append([]DeliveryRecord(nil), l.records[len(l.records)-MaxDeliveryRecords:]...)
+	}
+	if l.path == "" {
+		return
+	}
+	if l.lines >= maxDeliveryLines {
+		l.rewriteLocked()
+		return
+	}
+	data, _ := json.Marshal(record)
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		f.Close()
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存通知投递记录失败: %v", err)
+		return
+	}
+	l.lines++
+}
+
+// Recent 最近的投递记录，最新的在前
+func (l *DeliveryLog) Recent() []DeliveryRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ensureLoadedLocked()
+	recent := make([]DeliveryRecord, len(l.records))
+	for i, record := range l.records {
+		recent[len(l.records)-1-i] = record
+	}
+	return recent
+}
+
+func (l *DeliveryLog) ensureLoadedLocked() {
+	if l.loaded {
+		return
+	}
+	l.loaded = true
+	if l.path == "" {
+		return
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Info("⚠️ 读取通知投递记录失败: %v", err)
+		}
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		l.lines++
+		var record DeliveryRecord
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			l.records = append(l.records, record)
+		}
+	}
+	if len(l.records) > MaxDeliveryRecords {
+		l.records = append([]DeliveryRecord(nil), l.records[len(l.records)-MaxDeliveryRecords:]...)
+	}
+}
+
+// rewriteLocked 把文件原子重写为内存中的最近记录，调用方持有锁
+func (l *DeliveryLog) rewriteLocked() {
+	var buf bytes.Buffer
+	for _, record := range l.records {
+		data, _ := json.Marshal(record)
+		buf.Write(append(data, '\n'))
+	}
+	tmp := l.path + ".tmp"
+	err := os.WriteFile(tmp, buf.Bytes(), 0600)
+	if err == nil {
+		err = os.Rename(tmp, l.path)
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存通知投递记录失败: %v", err)
+		return
+	}
+	l.lines = len(l.records)
+}
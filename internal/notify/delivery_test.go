@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouter_RetriesTransientFailures(t *testing.T) {
+	router, _ := NewRouter(testRoutingConfig())
+	router.history = NewDeliveryLog("")
+	router.backoff = time.Millisecond
+	calls := map[string]int{}
+	router.channels["ops"] = funcNotifier{"ops", func(title, content string) error {
+		calls["ops"]++
+		if calls["ops"] < 3 {
+			return retryableError{errors.New("钉钉返回错误 errcode 130101: send too fast")}
+		}
+		return nil
+	}}
+	router.channels["oncall"] = funcNotifier{"oncall", func(title, content string) error {
+		calls["oncall"]++
+		return errors.New("telegram returned 401 Unauthorized")
+	}}
+	router.channels["dba"] = funcNotifier{"dba", func(title, content string) error {
+		calls["dba"]++
+		return retryableError{errors.New("slack returned 503 Service Unavailable")}
+	}}
+
+	failures := router.Deliver([]string{"ops", "oncall", "dba"}, "磁盘告警", "")
+	if calls["ops"] != 3 || failures["ops"] != nil {
+		t.Errorf("Expected ops to succeed on the third attempt, got %d attempts, %v", calls["ops"], failures["ops"])
+	}
+	if calls["oncall"] != 1 || failures["oncall"] == nil {
+		t.Errorf("Expected a permanent failure not to be retried, got %d attempts", calls["oncall"])
+	}
+	if calls["dba"] != DefaultNotifyAttempts || !strings.Contains(fmt.Sprint(failures["dba"]), "attempts: 3") {
+		t.Errorf("Expected dba to give up after %d attempts, got %d: %v", DefaultNotifyAttempts, calls["dba"], failures["dba"])
+	}
+
+	records := router.history.Recent()
+	if len(records) != 3 {
+		t.Fatalf("Expected one record per channel, got %+v", records)
+	}
+	byChannel := map[string]DeliveryRecord{}
+	for _, record := range records {
+		byChannel[record.Channel] = record
+	}
+	if r := byChannel["ops"]; r.Status != DeliverySent || r.Attempts != 3 || r.Title != "磁盘告警" || r.Error != "" {
+		t.Errorf("Unexpected ops record %+v", r)
+	}
+	if r := byChannel["oncall"]; r.Status != DeliveryFailed || r.Attempts != 1 || !strings.Contains(r.Error, "401") {
+		t.Errorf("Unexpected oncall record %+v", r)
+	}
+}
+
+func TestDingTalk_ClassifiesErrcode(t *testing.T) {
+	response := `{"errcode":130101,"errmsg":"send too fast, exceed 20 times per minute"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	service := NewDingTalkNotificationService(srv.URL)
+	if err := service.SendAlert("告警", "内容"); err == nil || !isRetryable(err) {
+		t.Errorf("Expected rate limiting to be retryable, got %v", err)
+	}
+	response = `{"errcode":310000,"errmsg":"keywords not in content"}`
+	if err := service.SendAlert("告警", "内容"); err == nil || isRetryable(err) || !strings.Contains(err.Error(), "keywords") {
+		t.Errorf("Expected a permanent error with the errmsg, got %v", err)
+	}
+	response = `{"errcode":0,"errmsg":"ok"}`
+	if err := service.SendAlert("告警", "内容"); err != nil {
+		t.Errorf("Expected success, got %v", err)
+	}
+}
+
+func TestDeliveryLog_PersistsRecentRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	log := NewDeliveryLog(path)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxDeliveryRecords+20; i++ {
+		log.Add(DeliveryRecord{Channel: "ops", Title: fmt.Sprintf("告警 %d", i), Time: start.Add(time.Duration(i) * time.Minute), Attempts: 1, Status: DeliverySent})
+	}
+
+	reloaded := NewDeliveryLog(path).Recent()
+	if len(reloaded) != MaxDeliveryRecords {
+		t.Fatalf("Expected %d records after reload, got %d", MaxDeliveryRecords, len(reloaded))
+	}
+	if reloaded[0].Title != fmt.Sprintf("告警 %d", MaxDeliveryRecords+19) || reloaded[len(reloaded)-1].Title != "告警 20" {
+		t.Errorf("Expected the newest records first, got %q ... %q", reloaded[0].Title, reloaded[len(reloaded)-1].Title)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"qwq/internal/logger"
 	"time"
@@ -149,23 +150,45 @@ func (d *DingTalkNotificationService) sendMessage(message *DingTalkMessage) erro
 	// 设置请求头，指定内容类型为 JSON
 	req.Header.Set("Content-Type", "application/json")
 
-	// 发送 HTTP 请求
+	// 发送 HTTP 请求，网络错误可以重试
 	resp, err := d.httpClient.Do(req)
 	if err != nil {
-		logger.Info("❌ 钉钉发送失败: %v", err)
-		return fmt.Errorf("发送请求失败: %v", err)
+		return fmt.Errorf("发送请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// 检查响应状态码，钉钉 API 成功时返回 200
+	// 检查响应状态码，钉钉 API 成功时返回 200；限流和服务端错误可以重试
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("钉钉服务器返回错误状态码: %d", resp.StatusCode)
+		err := fmt.Errorf("钉钉服务器返回错误状态码: %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return retryableError{err}
+		}
+		return err
+	}
+
+	// 钉钉在 HTTP 200 的响应体中返回业务错误码，非 0 表示消息没有发出
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&result); err != nil {
+		return fmt.Errorf("解析钉钉响应失败: %v", err)
+	}
+	if result.ErrCode != 0 {
+		err := fmt.Errorf("钉钉返回错误 errcode %d: %s", result.ErrCode, result.ErrMsg)
+		if result.ErrCode == dingTalkRateLimited {
+			return retryableError{err}
+		}
+		return err
 	}
 
 	logger.Info("✅ 钉钉消息发送成功")
 	return nil
 }
 
+// dingTalkRateLimited 钉钉机器人发送过快被限流的错误码（每个机器人每分钟最多 20 条），稍后重试可以成功
+const dingTalkRateLimited = 130101
+
 // contains 检查字符串是否包含子字符串
 // 自定义实现的字符串包含检查，避免引入额外依赖
 // 参数：s - 主字符串，substr - 要查找的子字符串
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"qwq/internal/config"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP 连接的加密方式
+const (
+	SMTPStartTLS = "starttls" // 明文连接后升级为 TLS，默认端口 587
+	SMTPSSL      = "ssl"      // 直接建立 TLS 连接，默认端口 465
+	SMTPNone     = "none"     // 不加密，默认端口 25，只适合本机或内网的中继
+)
+
+// smtpTimeout 连接并发送一封邮件的超时时间
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier 通过 SMTP 发送纯文本邮件的渠道，Markdown 正文转换为纯文本
+type SMTPNotifier struct {
+	name      string
+	Host      string
+	Port      int
+	Security  string
+	Username  string
+	Password  string
+	From      string
+	To        []string
+	tlsConfig *tls.Config // 测试时替换根证书，nil 时按 Host 校验证书
+}
+
+// NewSMTPNotifier 根据 email 渠道配置创建 SMTP 渠道
+func NewSMTPNotifier(channel config.NotifyChannelConfig) (*SMTPNotifier, error) {
+	n := &SMTPNotifier{
+		name:     channel.Name,
+		Host:     channel.SMTPHost,
+		Port:     channel.SMTPPort,
+		Security: strings.ToLower(channel.SMTPSecurity),
+		Username: channel.SMTPUsername,
+		Password: channel.SMTPPassword,
+		From:     channel.From,
+		To:       channel.To,
+	}
+	if n.Host == "" || n.From == "" || len(n.To) == 0 {
+		return nil, errors.New("email channel requires smtp_host, from and to")
+	}
+	if n.Security == "" {
+		n.Security = SMTPStartTLS
+	}
+	defaultPorts := map[string]int{SMTPStartTLS: 587, SMTPSSL: 465, SMTPNone: 25}
+	if _, ok := defaultPorts[n.Security]; !ok {
+		return nil, fmt.Errorf("unknown smtp_security %q, want starttls, ssl or none", channel.SMTPSecurity)
+	}
+	if n.Port == 0 {
+		n.Port = defaultPorts[n.Security]
+	}
+	if n.Port < 0 || n.Port > 65535 {
+		return nil, fmt.Errorf("invalid smtp_port %d", n.Port)
+	}
+	for _, addr := range append([]string{n.From}, n.To...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return nil, fmt.Errorf("invalid email address %q", addr)
+		}
+	}
+	return n, nil
+}
+
+// Name 渠道名称
+func (n *SMTPNotifier) Name() string { return n.name }
+
+// Send 发送一封邮件，标题为主题，正文转换为纯文本
+func (n *SMTPNotifier) Send(title, body string) error {
+	client, err := n.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	from, _ := mail.ParseAddress(n.From)
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	for _, to := range n.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", addr.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(n.message(title, body, time.Now())); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial 按加密方式连接 SMTP 服务器
+func (n *SMTPNotifier) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	tlsConfig := n.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: n.Host}
+	}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if n.Security == SMTPSSL {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smtp connect %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp connect %s: %w", addr, err)
+	}
+	if n.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp server %s does not support STARTTLS (set smtp_security to ssl or none)", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// message 生成邮件内容：UTF-8 纯文本，主题按 RFC 2047 编码，正文为 quoted-printable
+func (n *SMTPNotifier) message(title, body string, now time.Time) []byte {
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", n.From},
+		{"To", strings.Join(n.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", title)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(MarkdownToText(body), "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+var (
+	mdHeading = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	mdQuote   = regexp.MustCompile(`(?m)^>\s?`)
+	mdFence   = regexp.MustCompile("(?m)^```.*\n?")
+	mdImage   = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	mdBold    = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdCode    = regexp.MustCompile("`([^`]+)`")
+)
+
+// MarkdownToText 把通知中的 Markdown 转换为纯文本：去掉标题、引用、加粗和代码标记，链接保留地址
+func MarkdownToText(md string) string {
+	text := mdFence.ReplaceAllString(md, "")
+	text = mdHeading.ReplaceAllString(text, "")
+	text = mdQuote.ReplaceAllString(text, "")
+	text = mdImage.ReplaceAllString(text, "$1 ($2)")
+	text = mdLink.ReplaceAllString(text, "$1 ($2)")
+	text = mdBold.ReplaceAllString(text, "$1$2")
+	text = mdCode.ReplaceAllString(text, "$1")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"strings"
+	"testing"
+
+	"qwq/internal/config"
+)
+
+// fakeSMTP 接收一封邮件的本地 SMTP 服务（不加密，支持 AUTH PLAIN），返回端口和收到的命令、邮件内容
+func fakeSMTP(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var got []string
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				done <- got
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			got = append(got, line)
+			switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+			case "EHLO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				reply("235 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				got = append(got, data.String())
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				done <- got
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, done
+}
+
+func TestSMTPNotifier_SendsPlainText(t *testing.T) {
+	port, done := fakeSMTP(t)
+	notifier, err := NewSMTPNotifier(config.NotifyChannelConfig{
+		Name: "oncall", Type: "email", SMTPHost: "127.0.0.1", SMTPPort: port, SMTPSecurity: SMTPNone,
+		SMTPUsername: "qwq", SMTPPassword: "secret", From: "qwq <qwq@example.com>", To: []string{"oncall@example.com", "ops@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Send("🚨 磁盘告警", "## 巡检发现异常\n\n**/data** 使用率 `95%`\n> [查看面板](https://qwq.example.com)"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := <-done
+	joined := strings.Join(got, "\n")
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00qwq\x00secret"))
+	for _, want := range []string{"AUTH PLAIN " + auth, "MAIL FROM:<qwq@example.com>", "RCPT TO:<oncall@example.com>", "RCPT TO:<ops@example.com>", "Subject: =?utf-8?q?"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected %q in the SMTP session:\n%s", want, joined)
+		}
+	}
+	_, data, _ := strings.Cut(got[len(got)-2], "\r\n\r\n")
+	body, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "巡检发现异常\r\n\r\n/data 使用率 95%\r\n查看面板 (https://qwq.example.com)"; strings.TrimRight(string(body), "\r\n") != want {
+		t.Errorf("Expected plain text body %q, got %q", want, body)
+	}
+}
+
+func TestNewSMTPNotifier_Validates(t *testing.T) {
+	base := config.NotifyChannelConfig{Name: "mail", Type: "email", SMTPHost: "smtp.example.com", From: "qwq@example.com", To: []string{"ops@example.com"}}
+	n, err := NewSMTPNotifier(base)
+	if err != nil || n.Security != SMTPStartTLS || n.Port != 587 {
+		t.Fatalf("Expected STARTTLS on 587 by default, got %+v %v", n, err)
+	}
+	ssl := base
+	ssl.SMTPSecurity = "SSL"
+	if n, err := NewSMTPNotifier(ssl); err != nil || n.Port != 465 {
+		t.Errorf("Expected port 465 for ssl, got %+v %v", n, err)
+	}
+
+	for name, mutate := range map[string]func(*config.NotifyChannelConfig){
+		"no host":     func(c *config.NotifyChannelConfig) { c.SMTPHost = "" },
+		"no to":       func(c *config.NotifyChannelConfig) { c.To = nil },
+		"bad address": func(c *config.NotifyChannelConfig) { c.To = []string{"not an address"} },
+		"security":    func(c *config.NotifyChannelConfig) { c.SMTPSecurity = "tls13" },
+		"port":        func(c *config.NotifyChannelConfig) { c.SMTPPort = 70000 },
+	} {
+		channel := base
+		mutate(&channel)
+		if _, err := NewSMTPNotifier(channel); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSMTPNotifier_RequiresStartTLS(t *testing.T) {
+	port, _ := fakeSMTP(t)
+	notifier, err := NewNotifier(config.NotifyChannelConfig{Name: "mail", Type: "email", SMTPHost: "127.0.0.1", SMTPPort: port, From: "qwq@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Send("t", "b"); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected a STARTTLS error from a server without it, got %v", err)
+	}
+	if notifier.Name() != "mail" {
+		t.Errorf("Unexpected name %q", notifier.Name())
+	}
+}
@@ -10,7 +10,9 @@ import (
 // ExampleDingTalkNotification 演示钉钉通知服务的使用
 func ExampleDingTalkNotification() {
 	// 1. 设置配置
-	config.GlobalConfig.DingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=your_token_here"
+	config.Update(func(cfg *config.Config) {
+		cfg.DingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=your_token_here"
+	})
 	
 	// 2. 初始化通知服务
 	InitNotificationService()
@@ -78,11 +80,9 @@ func ExampleBackwardCompatibility() {
 // ExampleNotificationWithoutConfig 演示未配置通知服务的处理
 func ExampleNotificationWithoutConfig() {
 	// 清空配置
-	originalWebhook := config.GlobalConfig.DingTalkWebhook
-	config.GlobalConfig.DingTalkWebhook = ""
-	defer func() {
-		config.GlobalConfig.DingTalkWebhook = originalWebhook
-	}()
+	original := config.Current()
+	config.Update(func(cfg *config.Config) { cfg.DingTalkWebhook = "" })
+	defer config.Store(original)
 	
 	// 重新初始化
 	InitNotificationService()
@@ -0,0 +1,333 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"qwq/internal/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 外部告警系统
+const (
+	TargetAlertmanager = "alertmanager"
+	TargetPagerDuty    = "pagerduty"
+)
+
+// 推送动作
+const (
+	ActionTrigger = "trigger"
+	ActionResolve = "resolve"
+)
+
+const (
+	// DefaultPagerDutyURL PagerDuty Events v2 接口地址
+	DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	// DefaultIntegrationRetries 推送失败后的默认重试次数
+	DefaultIntegrationRetries = 3
+	// integrationBackoff 第一次重试前的等待时间，之后每次加倍
+	integrationBackoff = time.Second
+	// integrationTimeout 单次推送请求的超时时间
+	integrationTimeout = 10 * time.Second
+)
+
+// ExternalAlert 推送到外部告警系统的告警，Fingerprint 在异常持续期间保持不变
+type ExternalAlert struct {
+	Fingerprint string
+	Event       Event // Category 为检查项名称，Title 为异常标题，Content 为异常详情
+	StartsAt    time.Time
+	EndsAt      time.Time // 非零表示异常已恢复
+}
+
+// Resolved 告警是否已恢复
+func (a ExternalAlert) Resolved() bool {
+	return !a.EndsAt.IsZero()
+}
+
+// Fingerprint 根据主机、类别和标题计算告警指纹，同一异常在多次巡检之间指纹相同
+func Fingerprint(host, category, title string) string {
+	sum := sha256.Sum256([]byte(host + "\x00" + category + "\x00" + title))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Delivery 一次外部推送的结果，记录在巡检异常上，推送失败本身也可见
+type Delivery struct {
+	Target   string    `json:"target"` // alertmanager 或 pagerduty
+	Action   string    `json:"action"` // trigger 或 resolve
+	OK       bool      `json:"ok"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Integrations 外部告警系统推送：Alertmanager 和 PagerDuty Events v2
+type Integrations struct {
+	cfg     config.IntegrationsConfig
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewIntegrations 根据配置创建外部告警推送，未配置地址或密钥的系统不推送
+func NewIntegrations(cfg config.IntegrationsConfig) *Integrations {
+	return &Integrations{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: integrationTimeout},
+		backoff: integrationBackoff,
+	}
+}
+
+// DefaultIntegrations 根据当前配置创建外部告警推送
+func DefaultIntegrations() *Integrations {
+	return NewIntegrations(config.Current().Integrations)
+}
+
+// Enabled 是否配置了任意一个外部告警系统
+func (in *Integrations) Enabled() bool {
+	return in.cfg.Alertmanager.URL != "" || in.cfg.PagerDuty.RoutingKey != ""
+}
+
+// Push 推送告警（已恢复的告警发送恢复通知），返回每个告警指纹的推送结果
+// Alertmanager 每次接收全部告警，需要在每轮巡检中重复推送仍存在的告警；
+// PagerDuty 以指纹作为 dedup_key，重复推送不会再次呼叫，恢复后自动关闭事件
+func (in *Integrations) Push(ctx context.Context, alerts []ExternalAlert) map[string][]Delivery {
+	deliveries := make(map[string][]Delivery)
+	if len(alerts) == 0 {
+		return deliveries
+	}
+	if in.cfg.Alertmanager.URL != "" {
+		delivery := in.retry(ctx, TargetAlertmanager, func() error { return in.postAlertmanager(ctx, alerts) })
+		for _, alert := range alerts {
+			d := delivery
+			d.Action = action(alert)
+			deliveries[alert.Fingerprint] = append(deliveries[alert.Fingerprint], d)
+		}
+	}
+	if in.cfg.PagerDuty.RoutingKey != "" {
+		for _, alert := range alerts {
+			if in.cfg.PagerDuty.CriticalOnly && alert.Event.Severity != SeverityCritical {
+				continue
+			}
+			delivery := in.retry(ctx, TargetPagerDuty, func() error { return in.postPagerDuty(ctx, alert) })
+			delivery.Action = action(alert)
+			deliveries[alert.Fingerprint] = append(deliveries[alert.Fingerprint], delivery)
+		}
+	}
+	return deliveries
+}
+
+func action(alert ExternalAlert) string {
+	if alert.Resolved() {
+		return ActionResolve
+	}
+	return ActionTrigger
+}
+
+// permanentError 不需要重试的错误，如请求被拒绝（4xx）
+type permanentError struct{ error }
+
+// retry 执行推送，失败后按指数退避重试
+func (in *Integrations) retry(ctx context.Context, target string, send func() error) Delivery {
+	retries := in.cfg.Retries
+	if retries == 0 {
+		retries = DefaultIntegrationRetries
+	}
+	delivery := Delivery{Target: target}
+	wait := in.backoff
+	for {
+		delivery.Attempts++
+		err := send()
+		if err == nil {
+			delivery.OK, delivery.Error = true, ""
+			break
+		}
+		delivery.Error = err.Error()
+		if _, permanent := err.(permanentError); permanent || delivery.Attempts > retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			delivery.Error += fmt.Sprintf(" (%v)", ctx.Err())
+			delivery.Time = time.Now()
+			return delivery
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	delivery.Time = time.Now()
+	return delivery
+}
+
+// post 发送 JSON 请求，429 和 5xx 可以重试，其余非 2xx 状态码不再重试
+func (in *Integrations) post(ctx context.Context, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return permanentError{err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := in.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanentError{err}
+}
+
+// amAlert Alertmanager v2 API 的告警
+type amAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+// postAlertmanager 推送到 Alertmanager 的 /api/v2/alerts
+// Alertmanager 按标签集合识别告警，fingerprint 标签携带 qwq 的告警指纹；恢复的告警设置 endsAt
+func (in *Integrations) postAlertmanager(ctx context.Context, alerts []ExternalAlert) error {
+	body := make([]amAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		labels := map[string]string{
+			"alertname":   "QwqPatrol",
+			"severity":    alert.Event.Severity,
+			"instance":    alert.Event.Host,
+			"check":       alert.Event.Category,
+			"finding":     alert.Event.Title,
+			"fingerprint": alert.Fingerprint,
+		}
+		for key, value := range in.cfg.Alertmanager.Labels {
+			if _, reserved := labels[key]; !reserved {
+				labels[key] = value
+			}
+		}
+		am := amAlert{
+			Labels: labels,
+			Annotations: map[string]string{
+				"summary":     fmt.Sprintf("[%s] %s", alert.Event.Host, alert.Event.Title),
+				"description": alert.Event.Content,
+			},
+			StartsAt: alert.StartsAt,
+		}
+		if alert.Resolved() {
+			endsAt := alert.EndsAt
+			am.EndsAt = &endsAt
+		}
+		body = append(body, am)
+	}
+	return in.post(ctx, strings.TrimSuffix(in.cfg.Alertmanager.URL, "/")+"/api/v2/alerts", body)
+}
+
+// pdEvent PagerDuty Events v2 事件
+type pdEvent struct {
+	RoutingKey  string     `json:"routing_key"`
+	EventAction string     `json:"event_action"`
+	DedupKey    string     `json:"dedup_key"`
+	Client      string     `json:"client,omitempty"`
+	Payload     *pdPayload `json:"payload,omitempty"`
+}
+
+type pdPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Component     string            `json:"component,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// postPagerDuty 推送一个 PagerDuty 事件，告警指纹作为 dedup_key
+func (in *Integrations) postPagerDuty(ctx context.Context, alert ExternalAlert) error {
+	event := pdEvent{
+		RoutingKey:  in.cfg.PagerDuty.RoutingKey,
+		EventAction: action(alert),
+		DedupKey:    alert.Fingerprint,
+		Client:      "qwq",
+	}
+	if !alert.Resolved() {
+		event.Payload = &pdPayload{
+			Summary:       fmt.Sprintf("[%s] %s", alert.Event.Host, alert.Event.Title),
+			Source:        alert.Event.Host,
+			Severity:      alert.Event.Severity,
+			Timestamp:     alert.StartsAt,
+			Component:     alert.Event.Category,
+			CustomDetails: map[string]string{"detail": alert.Event.Content},
+		}
+	}
+	url := in.cfg.PagerDuty.URL
+	if url == "" {
+		url = DefaultPagerDutyURL
+	}
+	return in.post(ctx, url, event)
+}
+
+// AlertTracker 跟踪已推送到外部告警系统的告警，本轮未出现的告警视为已恢复
+type AlertTracker struct {
+	mu   sync.Mutex
+	open map[string]ExternalAlert
+}
+
+// NewAlertTracker 创建告警跟踪器
+func NewAlertTracker() *AlertTracker {
+	return &AlertTracker{open: make(map[string]ExternalAlert)}
+}
+
+// Restore 恢复重启前仍未恢复的告警，已跟踪的告警不受影响
+func (t *AlertTracker) Restore(alerts []ExternalAlert) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, alert := range alerts {
+		if _, ok := t.open[alert.Fingerprint]; !ok {
+			t.open[alert.Fingerprint] = alert
+		}
+	}
+}
+
+// Observe 记录本轮仍存在的告警，返回需要推送的告警（保留首次出现的时间）和本轮恢复的告警（设置 EndsAt）
+// held 中的指纹（如维护期间静默的异常）保持打开但本轮不推送
+func (t *AlertTracker) Observe(now time.Time, alerts []ExternalAlert, held []string) (firing, resolved []ExternalAlert) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]bool, len(alerts)+len(held))
+	for _, fingerprint := range held {
+		seen[fingerprint] = true
+	}
+	for _, alert := range alerts {
+		seen[alert.Fingerprint] = true
+		if previous, ok := t.open[alert.Fingerprint]; ok {
+			alert.StartsAt = previous.StartsAt
+		} else if alert.StartsAt.IsZero() {
+			alert.StartsAt = now
+		}
+		t.open[alert.Fingerprint] = alert
+		firing = append(firing, alert)
+	}
+	for fingerprint, alert := range t.open {
+		if seen[fingerprint] {
+			continue
+		}
+		delete(t.open, fingerprint)
+		alert.EndsAt = now
+		resolved = append(resolved, alert)
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Fingerprint < resolved[j].Fingerprint })
+	return firing, resolved
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testAlert(fingerprint, severity string) ExternalAlert {
+	return ExternalAlert{
+		Fingerprint: fingerprint,
+		Event:       Event{Severity: severity, Category: "disk", Host: "web-1", Title: "磁盘告警 (/dev/sda1)", Content: "91%"},
+		StartsAt:    time.Date(2026, 1, 1, 14, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestIntegrations_Alertmanager(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" || r.Method != http.MethodPost {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var batch []map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&batch)
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	in := NewIntegrations(config.IntegrationsConfig{Alertmanager: config.AlertmanagerConfig{
+		URL:    srv.URL + "/",
+		Labels: map[string]string{"team": "ops", "severity": "ignored"},
+	}})
+	resolved := testAlert("bbb", SeverityWarning)
+	resolved.EndsAt = resolved.StartsAt.Add(time.Hour)
+	deliveries := in.Push(context.Background(), []ExternalAlert{testAlert("aaa", SeverityCritical), resolved})
+
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("Expected one batch with both alerts, got %v", batches)
+	}
+	labels := batches[0][0]["labels"].(map[string]interface{})
+	if labels["fingerprint"] != "aaa" || labels["severity"] != SeverityCritical || labels["team"] != "ops" || labels["instance"] != "web-1" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if _, ok := batches[0][0]["endsAt"]; ok {
+		t.Errorf("Firing alert should not set endsAt, got %v", batches[0][0])
+	}
+	if batches[0][1]["endsAt"] != "2026-01-01T15:00:00Z" {
+		t.Errorf("Resolved alert should set endsAt, got %v", batches[0][1]["endsAt"])
+	}
+	if d := deliveries["bbb"]; len(d) != 1 || !d[0].OK || d[0].Action != ActionResolve || d[0].Target != TargetAlertmanager {
+		t.Errorf("Unexpected deliveries %+v", deliveries)
+	}
+}
+
+func TestIntegrations_PagerDutyRetries(t *testing.T) {
+	var mu sync.Mutex
+	var events []pdEvent
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event pdEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	in := NewIntegrations(config.IntegrationsConfig{PagerDuty: config.PagerDutyConfig{RoutingKey: "key", URL: srv.URL, CriticalOnly: true}})
+	in.backoff = time.Millisecond
+	resolved := testAlert("aaa", SeverityCritical)
+	resolved.EndsAt = time.Now()
+	deliveries := in.Push(context.Background(), []ExternalAlert{testAlert("aaa", SeverityCritical), testAlert("warn", SeverityWarning)})
+	in.Push(context.Background(), []ExternalAlert{resolved})
+
+	if d := deliveries["aaa"]; len(d) != 1 || !d[0].OK || d[0].Attempts != 3 {
+		t.Errorf("Expected the trigger to succeed on the third attempt, got %+v", d)
+	}
+	if _, ok := deliveries["warn"]; ok {
+		t.Error("Warnings should not page with critical_only")
+	}
+	if len(events) != 2 || events[0].EventAction != ActionTrigger || events[0].DedupKey != "aaa" || events[0].Payload == nil || events[0].Payload.Severity != SeverityCritical {
+		t.Fatalf("Unexpected trigger event %+v", events)
+	}
+	if events[1].EventAction != ActionResolve || events[1].DedupKey != "aaa" || events[1].Payload != nil {
+		t.Errorf("Unexpected resolve event %+v", events[1])
+	}
+}
+
+func TestIntegrations_GivesUp(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(`{"message":"invalid routing key"}`))
+	}))
+	defer srv.Close()
+
+	in := NewIntegrations(config.IntegrationsConfig{PagerDuty: config.PagerDutyConfig{RoutingKey: "bad", URL: srv.URL}, Retries: 2})
+	in.backoff = time.Millisecond
+	// 4xx 不重试
+	d := in.Push(context.Background(), []ExternalAlert{testAlert("aaa", SeverityCritical)})["aaa"][0]
+	if d.OK || d.Attempts != 1 || hits != 1 || d.Error == "" {
+		t.Errorf("Expected a single failed attempt, got %+v (%d requests)", d, hits)
+	}
+
+	status = http.StatusBadGateway
+	d = in.Push(context.Background(), []ExternalAlert{testAlert("aaa", SeverityCritical)})["aaa"][0]
+	if d.OK || d.Attempts != 3 || hits != 4 {
+		t.Errorf("Expected retries to be exhausted, got %+v (%d requests)", d, hits)
+	}
+}
+
+func TestAlertTracker(t *testing.T) {
+	start := time.Date(2026, 1, 1, 14, 0, 0, 0, time.UTC)
+	tracker := NewAlertTracker()
+	disk := ExternalAlert{Fingerprint: Fingerprint("web-1", "disk", "磁盘告警 (/dev/sda1)")}
+	load := ExternalAlert{Fingerprint: Fingerprint("web-1", "load", "高负载")}
+	if disk.Fingerprint == load.Fingerprint || disk.Fingerprint != Fingerprint("web-1", "disk", "磁盘告警 (/dev/sda1)") {
+		t.Fatal("Fingerprints should be stable and distinct")
+	}
+
+	firing, resolved := tracker.Observe(start, []ExternalAlert{disk, load}, nil)
+	if len(firing) != 2 || len(resolved) != 0 || !firing[0].StartsAt.Equal(start) {
+		t.Fatalf("Unexpected first round %+v / %+v", firing, resolved)
+	}
+	// 持续存在的告警保留首次出现时间，维护期间静默的告警保持打开
+	firing, resolved = tracker.Observe(start.Add(time.Minute), []ExternalAlert{disk}, []string{load.Fingerprint})
+	if len(firing) != 1 || !firing[0].StartsAt.Equal(start) || len(resolved) != 0 {
+		t.Fatalf("Unexpected second round %+v / %+v", firing, resolved)
+	}
+	firing, resolved = tracker.Observe(start.Add(2*time.Minute), nil, nil)
+	if len(firing) != 0 || len(resolved) != 2 || !resolved[0].Resolved() || !resolved[0].EndsAt.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("Expected both alerts to resolve, got %+v", resolved)
+	}
+	if _, resolved = tracker.Observe(start.Add(3*time.Minute), nil, nil); len(resolved) != 0 {
+		t.Errorf("Resolved alerts should only resolve once, got %+v", resolved)
+	}
+
+	tracker.Restore([]ExternalAlert{disk})
+	if _, resolved = tracker.Observe(start.Add(4*time.Minute), nil, nil); len(resolved) != 1 {
+		t.Errorf("Restored alerts should resolve, got %+v", resolved)
+	}
+}
@@ -10,7 +10,9 @@ import (
 // TestNotificationIntegration 测试通知系统集成
 func TestNotificationIntegration(t *testing.T) {
 	// 设置测试配置
-	config.GlobalConfig.DingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=test_token"
+	config.Update(func(cfg *config.Config) {
+		cfg.DingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=test_token"
+	})
 	
 	// 初始化通知服务
 	InitNotificationService()
@@ -61,11 +63,9 @@ func TestNotificationIntegration(t *testing.T) {
 // TestNotificationServiceWithoutConfig 测试未配置通知服务的情况
 func TestNotificationServiceWithoutConfig(t *testing.T) {
 	// 清空配置
-	originalWebhook := config.GlobalConfig.DingTalkWebhook
-	config.GlobalConfig.DingTalkWebhook = ""
-	defer func() {
-		config.GlobalConfig.DingTalkWebhook = originalWebhook
-	}()
+	original := config.Current()
+	config.Update(func(cfg *config.Config) { cfg.DingTalkWebhook = "" })
+	defer config.Store(original)
 	
 	// 重新初始化
 	InitNotificationService()
@@ -82,7 +82,9 @@ func TestNotificationServiceWithoutConfig(t *testing.T) {
 // TestBackwardCompatibility 测试向后兼容性
 func TestBackwardCompatibility(t *testing.T) {
 	// 设置测试配置
-	config.GlobalConfig.DingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=test_token"
+	config.Update(func(cfg *config.Config) {
+		cfg.DingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=test_token"
+	})
 	
 	// 测试原有的 Send 函数
 	t.Run("原有Send函数兼容性", func(t *testing.T) {
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"qwq/internal/config"
+)
+
+// Notifier 一个通知渠道，Send 发送标题和 Markdown 正文
+type Notifier interface {
+	Name() string
+	Send(title, body string) error
+}
+
+// funcNotifier 用发送函数实现的渠道
+type funcNotifier struct {
+	name string
+	send func(title, body string) error
+}
+
+// Name 渠道名称
+func (n funcNotifier) Name() string { return n.name }
+
+// Send 发送消息
+func (n funcNotifier) Send(title, body string) error { return n.send(title, body) }
+
+// NewNotifier 根据渠道配置创建渠道，配置不完整时返回错误
+func NewNotifier(channel config.NotifyChannelConfig) (Notifier, error) {
+	switch channel.Type {
+	case "dingtalk":
+		if channel.Webhook == "" {
+			return nil, errors.New("dingtalk channel requires webhook")
+		}
+		service := NewDingTalkNotificationService(channel.Webhook)
+		return funcNotifier{channel.Name, service.SendAlert}, nil
+	case "telegram":
+		if channel.TelegramToken == "" || channel.TelegramChatID == "" {
+			return nil, errors.New("telegram channel requires telegram_token and telegram_chat_id")
+		}
+		return funcNotifier{channel.Name, func(title, body string) error {
+			return postTelegram(channel.TelegramToken, channel.TelegramChatID, title, body)
+		}}, nil
+	case "slack":
+		if channel.Webhook == "" {
+			return nil, errors.New("slack channel requires webhook")
+		}
+		return funcNotifier{channel.Name, func(title, body string) error {
+			return postSlack(channel.Webhook, title, body)
+		}}, nil
+	case "email":
+		return NewSMTPNotifier(channel)
+	case "webhook":
+		return NewWebhookNotifier(channel)
+	}
+	return nil, fmt.Errorf("unsupported type %q", channel.Type)
+}
@@ -3,6 +3,7 @@ package notify
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"qwq/internal/config"
@@ -12,30 +13,35 @@ import (
 // 全局统一通知服务实例
 var globalNotificationService *UnifiedNotificationService
 
-// InitNotificationService 初始化全局通知服务
+// InitNotificationService 初始化全局通知服务和通知路由
 func InitNotificationService() {
 	globalNotificationService = NewUnifiedNotificationService()
+	if err := InitRouter(); err != nil {
+		logger.Info("⚠️ 通知路由配置无效，全部发送到 default 渠道: %v", err)
+	}
 }
 
-// Send 发送通知消息（保持向后兼容）
+// Send 发送通知消息（保持向后兼容），按路由规则作为 info 级别事件发送
 func Send(title, content string) {
+	SendEvent(Event{Severity: SeverityInfo, Title: title, Content: content})
+}
+
+// sendDefault 通过全局通知配置发送消息，即 default 渠道
+func sendDefault(title, content string) error {
 	// 如果全局服务未初始化，使用原有逻辑
 	if globalNotificationService == nil {
-		if config.GlobalConfig.DingTalkWebhook != "" {
-			go sendDingTalk(title, content)
+		var errs []error
+		if config.Current().DingTalkWebhook != "" {
+			errs = append(errs, sendDingTalk(title, content))
 		}
-		if config.GlobalConfig.TelegramToken != "" && config.GlobalConfig.TelegramChatID != "" {
-			go sendTelegram(title, content)
+		if config.Current().TelegramToken != "" && config.Current().TelegramChatID != "" {
+			errs = append(errs, sendTelegram(title, content))
 		}
-		return
+		return errors.Join(errs...)
 	}
 
 	// 使用新的统一通知服务
-	go func() {
-		if err := globalNotificationService.SendAlert(title, content); err != nil {
-			logger.Info("❌ 通知发送失败: %v", err)
-		}
-	}()
+	return globalNotificationService.SendAlert(title, content)
 }
 
 // SendStatusReport 发送状态报告
@@ -70,37 +76,65 @@ func GetNotificationService() NotificationService {
 	return globalNotificationService
 }
 
-// 原有的发送函数（保持向后兼容）
-func sendDingTalk(title, msg string) {
-	payload := map[string]interface{}{
-		"msgtype": "markdown",
-		"markdown": map[string]string{
-			"title": title,
-			"text":  msg,
-		},
+// 原有的发送函数（保持向后兼容），失败时返回错误由调用方重试和记录
+func sendDingTalk(title, msg string) error {
+	if err := NewDingTalkNotificationService(config.Current().DingTalkWebhook).SendAlert(title, msg); err != nil {
+		return fmt.Errorf("钉钉: %w", err)
 	}
-	jsonData, _ := json.Marshal(payload)
-	resp, err := http.Post(config.GlobalConfig.DingTalkWebhook, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		logger.Info("❌ 钉钉发送失败: %v", err)
-		return
+	return nil
+}
+
+func sendTelegram(title, msg string) error {
+	if err := postTelegram(config.Current().TelegramToken, config.Current().TelegramChatID, title, msg); err != nil {
+		return fmt.Errorf("telegram: %w", err)
 	}
-	defer resp.Body.Close()
+	return nil
 }
 
-func sendTelegram(title, msg string) {
+// telegramAPI Telegram Bot API 地址
+var telegramAPI = "https://api.telegram.org"
+
+// postTelegram 通过 Telegram Bot 发送 Markdown 消息
+func postTelegram(token, chatID, title, msg string) error {
 	text := fmt.Sprintf("*%s*\n\n%s", title, msg)
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", config.GlobalConfig.TelegramToken)
+	url := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, token)
 	payload := map[string]string{
-		"chat_id":    config.GlobalConfig.TelegramChatID,
+		"chat_id":    chatID,
 		"text":       text,
 		"parse_mode": "Markdown",
 	}
 	jsonData, _ := json.Marshal(payload)
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		logger.Info("❌ Telegram 发送失败: %v", err)
-		return
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError("telegram", resp)
+	}
+	return nil
+}
+
+// postSlack 通过 Slack Incoming Webhook 发送消息
+func postSlack(webhook, title, msg string) error {
+	payload := map[string]string{"text": fmt.Sprintf("*%s*\n\n%s", title, msg)}
+	jsonData, _ := json.Marshal(payload)
+	resp, err := http.Post(webhook, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
-}
\ No newline at end of file
+	if resp.StatusCode != http.StatusOK {
+		return statusError("slack", resp)
+	}
+	return nil
+}
+
+// statusError 渠道返回的错误状态码，限流（429）和服务端错误（5xx）可以重试
+func statusError(service string, resp *http.Response) error {
+	err := fmt.Errorf("%s returned %s", service, resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return retryableError{err}
+	}
+	return err
+}
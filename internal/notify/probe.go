@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"qwq/internal/config"
+	"strings"
+	"time"
+)
+
+// ProbeResult 通知渠道连通性探测结果
+type ProbeResult struct {
+	Channel string        `json:"channel"`
+	Type    string        `json:"type"`
+	OK      bool          `json:"ok"`
+	Detail  string        `json:"detail"`
+	Latency time.Duration `json:"latency"`
+}
+
+// probeClient 探测使用的 HTTP 客户端，超时较短避免拖慢启动
+var probeClient = &http.Client{Timeout: 5 * time.Second}
+
+// ProbeChannels 探测默认渠道和 notify_routing 中所有命名渠道。
+// 探测请求不包含消息内容，不会在群里产生消息：钉钉和 Slack 发送空消息体，通过错误码区分地址是否有效；
+// Telegram 调用 getMe 校验 token；邮件完成连接和认证但不发信，通用 Webhook 只检查能否建立连接；停用的渠道不探测
+func ProbeChannels(ctx context.Context) []ProbeResult {
+	channels := append([]config.NotifyChannelConfig(nil), config.Current().NotifyRouting.Channels...)
+	if config.Current().DingTalkWebhook != "" {
+		channels = append([]config.NotifyChannelConfig{{Name: DefaultChannel, Type: "dingtalk", Webhook: config.Current().DingTalkWebhook}}, channels...)
+	}
+	if config.Current().TelegramToken != "" {
+		channels = append(channels, config.NotifyChannelConfig{Name: DefaultChannel, Type: "telegram", TelegramToken: config.Current().TelegramToken})
+	}
+
+	results := make([]ProbeResult, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Disabled {
+			continue
+		}
+		start := time.Now()
+		ok, detail := probeChannel(ctx, channel)
+		results = append(results, ProbeResult{
+			Channel: channel.Name,
+			Type:    channel.Type,
+			OK:      ok,
+			Detail:  detail,
+			Latency: time.Since(start),
+		})
+	}
+	return results
+}
+
+// probeChannel 探测单个渠道，返回是否可用和说明
+func probeChannel(ctx context.Context, channel config.NotifyChannelConfig) (bool, string) {
+	switch channel.Type {
+	case "dingtalk":
+		return probeDingTalk(ctx, channel.Webhook)
+	case "slack":
+		return probeSlack(ctx, channel.Webhook)
+	case "telegram":
+		return probeTelegram(ctx, channel.TelegramToken)
+	case "email":
+		return probeSMTP(channel)
+	case "webhook":
+		return probeWebhook(ctx, channel)
+	}
+	return false, fmt.Sprintf("unsupported type %q", channel.Type)
+}
+
+// probeDingTalk 向机器人发送空消息体：地址有效时钉钉返回参数错误，token 无效时错误信息中包含 token
+func probeDingTalk(ctx context.Context, webhook string) (bool, string) {
+	body, status, err := probeRequest(ctx, http.MethodPost, webhook, "{}")
+	if err != nil {
+		return false, err.Error()
+	}
+	if status != http.StatusOK {
+		return false, fmt.Sprintf("HTTP %d", status)
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false, "unexpected response: " + truncateProbeBody(body)
+	}
+	if result.ErrCode == 300001 || strings.Contains(strings.ToLower(result.ErrMsg), "token") {
+		return false, fmt.Sprintf("access_token 无效 (errcode %d: %s)", result.ErrCode, result.ErrMsg)
+	}
+	return true, fmt.Sprintf("reachable (errcode %d: %s)", result.ErrCode, result.ErrMsg)
+}
+
+// probeSlack 发送空消息体：地址有效时 Slack 返回 400 no_text/invalid_payload，地址失效时返回 403/404
+func probeSlack(ctx context.Context, webhook string) (bool, string) {
+	body, status, err := probeRequest(ctx, http.MethodPost, webhook, "")
+	if err != nil {
+		return false, err.Error()
+	}
+	text := truncateProbeBody(body)
+	if status == http.StatusBadRequest && (text == "no_text" || text == "invalid_payload") {
+		return true, "reachable (" + text + ")"
+	}
+	if status == http.StatusOK {
+		return true, "reachable"
+	}
+	return false, fmt.Sprintf("HTTP %d: %s", status, text)
+}
+
+// probeTelegram 调用 getMe 校验 Bot Token
+func probeTelegram(ctx context.Context, token string) (bool, string) {
+	body, _, err := probeRequest(ctx, http.MethodGet, fmt.Sprintf("%s/bot%s/getMe", telegramAPI, token), "")
+	if err != nil {
+		return false, err.Error()
+	}
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      struct {
+			Username string `json:"username"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false, "unexpected response: " + truncateProbeBody(body)
+	}
+	if !result.OK {
+		return false, result.Description
+	}
+	return true, "bot @" + result.Result.Username
+}
+
+// probeSMTP 连接 SMTP 服务器，完成 STARTTLS/SSL 和认证后退出，不发送邮件
+func probeSMTP(channel config.NotifyChannelConfig) (bool, string) {
+	n, err := NewSMTPNotifier(channel)
+	if err != nil {
+		return false, err.Error()
+	}
+	client, err := n.dial()
+	if err != nil {
+		return false, err.Error()
+	}
+	defer client.Close()
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return false, "smtp auth: " + err.Error()
+		}
+	}
+	client.Quit()
+	return true, fmt.Sprintf("reachable (%s)", n.Security)
+}
+
+// probeWebhook 只检查地址能否建立连接：通用 Webhook 收到任何请求都可能创建事件，不发送请求
+func probeWebhook(ctx context.Context, channel config.NotifyChannelConfig) (bool, string) {
+	n, err := NewWebhookNotifier(channel)
+	if err != nil {
+		return false, err.Error()
+	}
+	u, _ := url.Parse(n.URL)
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	dialer := net.Dialer{Timeout: probeClient.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return false, err.Error()
+	}
+	conn.Close()
+	return true, "reachable (no request sent)"
+}
+
+func probeRequest(ctx context.Context, method, target, payload string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, strings.NewReader(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+	if payload != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return body, resp.StatusCode, err
+}
+
+func truncateProbeBody(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
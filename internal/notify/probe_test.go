@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProbeDingTalk(t *testing.T) {
+	response := `{"errcode":40035,"errmsg":"缺少参数 json"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	if ok, detail := probeDingTalk(context.Background(), srv.URL); !ok {
+		t.Errorf("Expected webhook to be reachable, got %q", detail)
+	}
+	response = `{"errcode":300001,"errmsg":"token is not exist"}`
+	if ok, detail := probeDingTalk(context.Background(), srv.URL); ok || !strings.Contains(detail, "access_token") {
+		t.Errorf("Expected invalid token, got %v %q", ok, detail)
+	}
+}
+
+func TestProbeSlack(t *testing.T) {
+	status, body := http.StatusBadRequest, "no_text"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	if ok, detail := probeSlack(context.Background(), srv.URL); !ok {
+		t.Errorf("Expected webhook to be reachable, got %q", detail)
+	}
+	status, body = http.StatusNotFound, "no_service"
+	if ok, detail := probeSlack(context.Background(), srv.URL); ok || !strings.Contains(detail, "no_service") {
+		t.Errorf("Expected missing webhook, got %v %q", ok, detail)
+	}
+}
+
+func TestProbeTelegram(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:abc/getMe" {
+			w.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"username":"qwq_bot"}}`))
+	}))
+	defer srv.Close()
+	saved := telegramAPI
+	telegramAPI = srv.URL
+	defer func() { telegramAPI = saved }()
+
+	if ok, detail := probeTelegram(context.Background(), "123:abc"); !ok || detail != "bot @qwq_bot" {
+		t.Errorf("Expected valid bot, got %v %q", ok, detail)
+	}
+	if ok, detail := probeTelegram(context.Background(), "bad"); ok || detail != "Unauthorized" {
+		t.Errorf("Expected unauthorized, got %v %q", ok, detail)
+	}
+}
@@ -0,0 +1,352 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	// 静默时段使用配置中的时区，主机（如精简容器镜像）没有时区数据库时也能解析
+	_ "time/tzdata"
+)
+
+// 渠道的投递方式
+const (
+	ChannelDeliver  = "deliver"  // 立即发送
+	ChannelQueue    = "queue"    // 处于静默时段，排队到时段结束后合并为摘要发送
+	ChannelEscalate = "escalate" // 处于静默时段，但 critical 事件越过静默时段立即发送
+	ChannelDisabled = "disabled" // 渠道已停用，不发送
+)
+
+// DefaultQuietQueueFile 静默时段排队通知的持久化文件
+const DefaultQuietQueueFile = "qwq_notify_queue.json"
+
+// maxQueued 排队通知的上限，超出后丢弃最早的通知，避免长时间静默时无限增长
+const maxQueued = 1000
+
+// ChannelDelivery 事件在一个渠道上的投递方式
+type ChannelDelivery struct {
+	Channel string    `json:"channel"`
+	Action  string    `json:"action"`
+	Until   time.Time `json:"until,omitempty"` // 所处静默时段的结束时间
+}
+
+// quietWindow 编译后的静默时段
+type quietWindow struct {
+	from, to int // 当天分钟数，from >= to 表示跨零点（相同表示全天）
+	days     [7]bool
+	loc      *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseQuietHours 校验并编译渠道的静默时段
+func parseQuietHours(configs []config.NotifyQuietHoursConfig) ([]quietWindow, error) {
+	windows := make([]quietWindow, 0, len(configs))
+	for _, qc := range configs {
+		from, to, err := parseHours(qc.Hours)
+		if err != nil {
+			return nil, fmt.Errorf("quiet_hours: %v", err)
+		}
+		w := quietWindow{from: from, to: to, loc: time.UTC}
+		if qc.Timezone != "" {
+			if w.loc, err = time.LoadLocation(qc.Timezone); err != nil {
+				return nil, fmt.Errorf("quiet_hours: unknown timezone %q", qc.Timezone)
+			}
+		}
+		for _, day := range qc.Days {
+			weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+			if !ok {
+				return nil, fmt.Errorf("quiet_hours: unknown day %q, want mon..sun", day)
+			}
+			w.days[weekday] = true
+		}
+		if len(qc.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// until t 处于静默时段时返回时段的结束时间
+func (w quietWindow) until(t time.Time) (time.Time, bool) {
+	local := t.In(w.loc)
+	minute := local.Hour()*60 + local.Minute()
+	at := func(days, minutes int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, minutes/60, minutes%60, 0, 0, w.loc)
+	}
+	weekday := local.Weekday()
+	if w.from < w.to {
+		if w.days[weekday] && minute >= w.from && minute < w.to {
+			return at(0, w.to), true
+		}
+		return time.Time{}, false
+	}
+	// 跨零点的时段属于开始的那天：开始当天的晚上，或前一天开始的时段在今天凌晨的部分
+	if w.days[weekday] && minute >= w.from {
+		return at(1, w.to), true
+	}
+	if w.days[(weekday+6)%7] && minute < w.to {
+		return at(0, w.to), true
+	}
+	return time.Time{}, false
+}
+
+// quietUntil 渠道在 t 时是否处于静默时段，返回最晚的结束时间
+func (r *Router) quietUntil(channel string, t time.Time) (time.Time, bool) {
+	var latest time.Time
+	for _, w := range r.quiet[channel] {
+		if end, ok := w.until(t); ok && end.After(latest) {
+			latest = end
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// deliveries 计算事件在各渠道上的投递方式
+func (r *Router) deliveries(event Event, channels []string) []ChannelDelivery {
+	result := make([]ChannelDelivery, 0, len(channels))
+	for _, name := range channels {
+		delivery := ChannelDelivery{Channel: name, Action: ChannelDeliver}
+		if r.disabled[name] {
+			delivery.Action = ChannelDisabled
+		} else if until, quiet := r.quietUntil(name, event.Time); quiet {
+			delivery.Until = until
+			delivery.Action = ChannelQueue
+			if event.Severity == SeverityCritical {
+				delivery.Action = ChannelEscalate
+			}
+		}
+		result = append(result, delivery)
+	}
+	return result
+}
+
+// Hold 将事件排队到处于静默时段的渠道，返回需要立即发送的渠道
+func (r *Router) Hold(event Event, decision Decision) []string {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	deliveries := decision.Deliveries
+	if deliveries == nil {
+		deliveries = r.deliveries(event, decision.Channels)
+	}
+	var now []string
+	var queued []QueuedNotification
+	for _, delivery := range deliveries {
+		if delivery.Action == ChannelDisabled {
+			continue
+		}
+		if delivery.Action != ChannelQueue {
+			now = append(now, delivery.Channel)
+			continue
+		}
+		queued = append(queued, QueuedNotification{
+			Channel:  delivery.Channel,
+			Key:      event.incidentKey(),
+			Severity: event.Severity,
+			Title:    event.Title,
+			Content:  event.Content,
+			Time:     event.Time,
+		})
+		logger.Info("🌙 渠道 %s 处于静默时段，通知排队至 %s: %s", delivery.Channel,
+			delivery.Until.Format("2006-01-02 15:04 MST"), event.Title)
+	}
+	if len(queued) > 0 {
+		r.queue.Add(queued...)
+	}
+	return now
+}
+
+// incidentKey 摘要中合并通知的键，未设置 Key 时使用类别、主机、对象和标题
+func (e Event) incidentKey() string {
+	if e.Key != "" {
+		return e.Key
+	}
+	return strings.Join([]string{e.Category, e.Host, e.Target, e.Title}, "|")
+}
+
+// FlushQuiet 向已结束静默时段的渠道发送排队通知的摘要，每个渠道一条；发送失败的通知重新排队
+func (r *Router) FlushQuiet(now time.Time) error {
+	batches := r.queue.Take(func(channel string) bool {
+		_, quiet := r.quietUntil(channel, now)
+		return !quiet
+	})
+	channels := make([]string, 0, len(batches))
+	for channel := range batches {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	var errs []error
+	for _, channel := range channels {
+		items := batches[channel]
+		notifier, ok := r.channels[channel]
+		if !ok || r.disabled[channel] {
+			logger.Info("⚠️ 渠道 %s 已不存在或已停用，丢弃 %d 条静默时段通知", channel, len(items))
+			continue
+		}
+		title, content := r.digest(channel, items)
+		if err := r.send(channel, notifier, title, content); err != nil {
+			r.queue.Add(items...)
+			errs = append(errs, fmt.Errorf("channel %s: %w", channel, err))
+			continue
+		}
+		logger.Info("🌙 已向渠道 %s 发送静默时段摘要 (%d 条通知)", channel, len(items))
+	}
+	return errors.Join(errs...)
+}
+
+// digest 将排队通知按异常合并为一条摘要：同一异常只保留最新的内容，并记录次数和时间范围
+func (r *Router) digest(channel string, items []QueuedNotification) (string, string) {
+	loc := time.UTC
+	if windows := r.quiet[channel]; len(windows) > 0 {
+		loc = windows[0].loc
+	}
+	type incident struct {
+		first, last QueuedNotification
+		count       int
+	}
+	groups := make(map[string]*incident)
+	var order []string
+	for _, item := range items {
+		group, ok := groups[item.Key]
+		if !ok {
+			group = &incident{first: item}
+			groups[item.Key] = group
+			order = append(order, item.Key)
+		}
+		group.count++
+		if !item.Time.Before(group.last.Time) {
+			group.last = item
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🌙 **静默时段通知摘要** (%d 个异常，共 %d 条通知)\n", len(order), len(items))
+	for _, key := range order {
+		group := groups[key]
+		span := group.first.Time.In(loc).Format("01-02 15:04")
+		if group.count > 1 {
+			span += " ~ " + group.last.Time.In(loc).Format("01-02 15:04")
+		}
+		fmt.Fprintf(&b, "\n---\n\n**%s** [%s] ×%d (%s)\n\n%s\n", group.last.Title, group.last.Severity, group.count, span, group.last.Content)
+	}
+	return "静默时段通知摘要", b.String()
+}
+
+// QueuedNotification 静默时段内排队的通知
+type QueuedNotification struct {
+	Channel  string    `json:"channel"`
+	Key      string    `json:"key"`
+	Severity string    `json:"severity"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Time     time.Time `json:"time"`
+}
+
+// QuietQueue 静默时段的排队通知，每次变化后原子写入文件，重启后继续发送
+type QuietQueue struct {
+	mu     sync.Mutex
+	path   string // 为空时不持久化
+	loaded bool
+	items  []QueuedNotification
+}
+
+// NewQuietQueue 创建排队通知队列，第一次使用时从文件加载
+func NewQuietQueue(path string) *QuietQueue {
+	return &QuietQueue{path: path}
+}
+
+// DefaultQuietQueue 全局排队通知队列
+var DefaultQuietQueue = NewQuietQueue(DefaultQuietQueueFile)
+
+// Add 追加排队通知，超出上限时丢弃最早的通知
+func (q *QuietQueue) Add(items ...QueuedNotification) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ensureLoadedLocked()
+	q.items = append(q.items, items...)
+	sort.SliceStable(q.items, func(i, j int) bool { return q.items[i].Time.Before(q.items[j].Time) })
+	if dropped := len(q.items) - maxQueued; dropped > 0 {
+		logger.Info("⚠️ 静默时段排队通知超过 %d 条，丢弃最早的 %d 条", maxQueued, dropped)
+		q.items = append([]QueuedNotification(nil), q.items[dropped:]...)
+	}
+	q.saveLocked()
+}
+
+// Take 取出 ready 返回 true 的渠道的全部排队通知，按渠道分组
+func (q *QuietQueue) Take(ready func(channel string) bool) map[string][]QueuedNotification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ensureLoadedLocked()
+	taken := make(map[string][]QueuedNotification)
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if ready(item.Channel) {
+			taken[item.Channel] = append(taken[item.Channel], item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	if len(taken) > 0 {
+		q.items = kept
+		q.saveLocked()
+	}
+	return taken
+}
+
+// Pending 当前排队的通知
+func (q *QuietQueue) Pending() []QueuedNotification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ensureLoadedLocked()
+	return append([]QueuedNotification(nil), q.items...)
+}
+
+func (q *QuietQueue) ensureLoadedLocked() {
+	if q.loaded {
+		return
+	}
+	q.loaded = true
+	if q.path == "" {
+		return
+	}
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Info("⚠️ 读取静默时段排队通知失败: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &q.items); err != nil {
+		logger.Info("⚠️ 静默时段排队通知格式错误，已忽略: %v", err)
+		q.items = nil
+	}
+}
+
+// saveLocked 原子写入排队通知，调用方持有锁
+func (q *QuietQueue) saveLocked() {
+	if q.path == "" {
+		return
+	}
+	data, err := json.Marshal(q.items)
+	if err == nil {
+		tmp := q.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, q.path)
+		}
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存静默时段排队通知失败: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"errors"
+	"path/filepath"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func quietRouter(t *testing.T, quiet ...config.NotifyQuietHoursConfig) *Router {
+	t.Helper()
+	cfg := testRoutingConfig()
+	cfg.Channels[0].QuietHours = quiet
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	router.queue = NewQuietQueue(filepath.Join(t.TempDir(), "queue.json"))
+	return router
+}
+
+func TestQuietWindow_UsesConfiguredTimezone(t *testing.T) {
+	// 上海周五 22:00 - 周六 08:00 静默，主机时间为 UTC
+	router := quietRouter(t, config.NotifyQuietHoursConfig{Hours: "22:00-08:00", Days: []string{"fri"}, Timezone: "Asia/Shanghai"})
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	cases := []struct {
+		at    time.Time
+		quiet bool
+	}{
+		{time.Date(2026, 1, 2, 13, 59, 0, 0, time.UTC), false}, // 周五 21:59 (上海)
+		{time.Date(2026, 1, 2, 14, 0, 0, 0, time.UTC), true},   // 周五 22:00
+		{time.Date(2026, 1, 2, 23, 30, 0, 0, time.UTC), true},  // 周六 07:30，属于周五开始的时段
+		{time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), false},   // 周六 08:00
+		{time.Date(2026, 1, 3, 14, 30, 0, 0, time.UTC), false}, // 周六 22:30 不在生效的星期内
+	}
+	for _, c := range cases {
+		until, quiet := router.quietUntil("ops", c.at)
+		if quiet != c.quiet {
+			t.Errorf("quietUntil(%s) = %v, want %v", c.at.In(shanghai), quiet, c.quiet)
+		}
+		if quiet && !until.Equal(time.Date(2026, 1, 3, 8, 0, 0, 0, shanghai)) {
+			t.Errorf("Expected the window to end at Saturday 08:00 Shanghai, got %s", until)
+		}
+	}
+
+	// 起止相同表示全天
+	router = quietRouter(t, config.NotifyQuietHoursConfig{Hours: "00:00-00:00", Days: []string{"sun"}})
+	if until, quiet := router.quietUntil("ops", time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC)); !quiet || !until.Equal(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected all of Sunday to be quiet, got %v %s", quiet, until)
+	}
+}
+
+func TestRouter_MatchReportsDeliveries(t *testing.T) {
+	router := quietRouter(t, config.NotifyQuietHoursConfig{Hours: "22:00-08:00"})
+	night := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 1, 1, 14, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		event  Event
+		action string
+	}{
+		{Event{Severity: SeverityWarning, Category: "disk", Time: night}, ChannelQueue},
+		{Event{Severity: SeverityInfo, Category: "report", Time: night}, ChannelQueue},
+		{Event{Severity: SeverityWarning, Category: "disk", Time: day}, ChannelDeliver},
+	} {
+		decision := router.Match(c.event)
+		if len(decision.Deliveries) != 1 || decision.Deliveries[0].Channel != "ops" || decision.Deliveries[0].Action != c.action {
+			t.Errorf("Match(%s at %s) deliveries = %+v, want %s", c.event.Severity, c.event.Time, decision.Deliveries, c.action)
+		}
+	}
+
+	// critical 越过静默时段
+	cfg := testRoutingConfig()
+	cfg.Routes = []config.NotifyRouteConfig{{Name: "critical", Severities: []string{SeverityCritical}, Channels: []string{"ops"}}}
+	cfg.Channels[0].QuietHours = []config.NotifyQuietHoursConfig{{Hours: "22:00-08:00"}}
+	router, _ = NewRouter(cfg)
+	decision := router.Match(Event{Severity: SeverityCritical, Time: night})
+	if delivery := decision.Deliveries[0]; delivery.Action != ChannelEscalate || delivery.Until.Hour() != 8 {
+		t.Errorf("Expected critical events to escalate through quiet hours, got %+v", delivery)
+	}
+}
+
+func TestRouter_QuietHoursDigest(t *testing.T) {
+	router := quietRouter(t, config.NotifyQuietHoursConfig{Hours: "22:00-08:00", Timezone: "Asia/Shanghai"})
+	var sent []string
+	router.channels["ops"] = funcNotifier{"ops", func(title, content string) error {
+		sent = append(sent, content)
+		return nil
+	}}
+	start := time.Date(2026, 1, 1, 17, 0, 0, 0, time.UTC) // 上海 01:00
+	for i := 0; i < 40; i++ {
+		event := Event{Severity: SeverityWarning, Category: "disk", Key: "disk", Title: "磁盘告警", Content: "/ 使用率 9" + string(rune('0'+i%10)) + "%", Time: start.Add(time.Duration(i) * 5 * time.Minute)}
+		if now := router.Hold(event, router.Match(event)); len(now) != 0 {
+			t.Fatalf("Expected the warning to be queued, got %v", now)
+		}
+	}
+	load := Event{Severity: SeverityWarning, Category: "load", Title: "负载过高", Content: "load 12", Time: start}
+	router.Hold(load, router.Match(load))
+
+	// 排队的通知在重启后仍然存在
+	reloaded := NewQuietQueue(router.queue.path)
+	if pending := reloaded.Pending(); len(pending) != 41 {
+		t.Fatalf("Expected 41 persisted notifications, got %d", len(pending))
+	}
+	router.queue = reloaded
+
+	if err := router.FlushQuiet(start.Add(5 * time.Hour)); err != nil || len(sent) != 0 {
+		t.Fatalf("Nothing should be sent before the window ends, got %v %v", sent, err)
+	}
+	if err := router.FlushQuiet(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("Expected one digest, got %d", len(sent))
+	}
+	digest := sent[0]
+	if strings.Count(digest, "磁盘告警") != 1 || !strings.Contains(digest, "×40") || !strings.Contains(digest, "负载过高") || !strings.Contains(digest, "01-02 01:00 ~ 01-02 04:15") {
+		t.Errorf("Expected notifications grouped by incident, got:\n%s", digest)
+	}
+	if len(router.queue.Pending()) != 0 {
+		t.Error("Expected the queue to be empty after the digest")
+	}
+}
+
+func TestRouter_FailedDigestIsRequeued(t *testing.T) {
+	router := quietRouter(t, config.NotifyQuietHoursConfig{Hours: "22:00-08:00"})
+	router.channels["ops"] = funcNotifier{"ops", func(title, content string) error { return errors.New("unreachable") }}
+	event := Event{Severity: SeverityWarning, Title: "磁盘告警", Time: time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)}
+	router.Hold(event, router.Match(event))
+	if err := router.FlushQuiet(time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("Expected the send failure to be reported")
+	}
+	if len(router.queue.Pending()) != 1 {
+		t.Error("Expected the notification to stay queued for the next attempt")
+	}
+}
+
+func TestNewRouter_InvalidQuietHours(t *testing.T) {
+	for name, quiet := range map[string]config.NotifyQuietHoursConfig{
+		"bad hours":    {Hours: "night"},
+		"bad day":      {Hours: "22:00-08:00", Days: []string{"funday"}},
+		"bad timezone": {Hours: "22:00-08:00", Timezone: "Mars/Olympus"},
+	} {
+		cfg := testRoutingConfig()
+		cfg.Channels[0].QuietHours = []config.NotifyQuietHoursConfig{quiet}
+		if _, err := NewRouter(cfg); !errors.Is(err, ErrInvalidRouting) {
+			t.Errorf("%s: expected ErrInvalidRouting, got %v", name, err)
+		}
+	}
+}
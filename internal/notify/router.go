@@ -0,0 +1,447 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件严重程度
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// DefaultChannel 内置渠道，使用 webhook、telegram_token 等全局通知配置
+const DefaultChannel = "default"
+
+// DefaultRoute 没有规则匹配时记录的路由名称
+const DefaultRoute = "default"
+
+// ErrInvalidRouting 通知路由配置无效
+var ErrInvalidRouting = errors.New("invalid notify routing")
+
+// Event 待发送的通知事件
+type Event struct {
+	Severity string
+	Category string // 异常类别，巡检异常为检查项名称
+	Host     string
+	Target   string // 受影响的对象，如网站域名或 Compose 项目名
+	Tags     []string
+	Title    string
+	Content  string
+	Time     time.Time // 为空时使用当前时间，用于匹配生效时段和静默时段
+	Key      string    // 异常标识，静默时段摘要按它合并同一异常的多条通知，为空时使用类别、主机、对象和标题
+}
+
+// Decision 路由结果
+type Decision struct {
+	Route         string            `json:"route"`
+	Channels      []string          `json:"channels"`
+	EscalateAfter time.Duration     `json:"escalate_after,omitempty"`
+	EscalateTo    []string          `json:"escalate_to,omitempty"`
+	Deliveries    []ChannelDelivery `json:"deliveries,omitempty"` // 各渠道的投递方式（立即发送、静默时段排队或 critical 越过静默时段）
+}
+
+// route 编译后的路由规则
+type route struct {
+	config.NotifyRouteConfig
+	from, to int // 生效时段（当天分钟数），from 为 -1 表示全天
+}
+
+// Router 按规则将通知事件分发到命名渠道
+type Router struct {
+	routes   []route
+	defaults []string
+	tags     []string
+	channels map[string]Notifier
+	disabled map[string]bool // 配置为停用的渠道，路由照常匹配但不发送
+	quiet    map[string][]quietWindow
+	queue    *QuietQueue
+	history  *DeliveryLog  // 每次投递的记录，为 nil 时不记录
+	attempts int           // 每个渠道的最多尝试次数
+	backoff  time.Duration // 第一次重试前的等待时间
+}
+
+// NewRouter 校验路由配置并创建路由器，未配置路由时所有事件发送到 default 渠道
+func NewRouter(cfg config.NotifyRoutingConfig) (*Router, error) {
+	r := &Router{
+		defaults: cfg.Default,
+		tags:     cfg.Tags,
+		channels: map[string]Notifier{DefaultChannel: funcNotifier{DefaultChannel, sendDefault}},
+		disabled: make(map[string]bool),
+		quiet:    make(map[string][]quietWindow),
+		queue:    DefaultQuietQueue,
+		history:  DefaultDeliveryLog,
+		attempts: DefaultNotifyAttempts,
+		backoff:  notifyBackoff,
+	}
+	if len(r.defaults) == 0 {
+		r.defaults = []string{DefaultChannel}
+	}
+
+	for _, channel := range cfg.Channels {
+		if channel.Name == "" {
+			return nil, fmt.Errorf("%w: channel without name", ErrInvalidRouting)
+		}
+		if _, exists := r.channels[channel.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate channel %q", ErrInvalidRouting, channel.Name)
+		}
+		notifier, err := NewNotifier(channel)
+		if err != nil {
+			return nil, fmt.Errorf("%w: channel %q: %v", ErrInvalidRouting, channel.Name, err)
+		}
+		r.channels[channel.Name] = notifier
+		r.disabled[channel.Name] = channel.Disabled
+		if len(channel.QuietHours) > 0 {
+			windows, err := parseQuietHours(channel.QuietHours)
+			if err != nil {
+				return nil, fmt.Errorf("%w: channel %q: %v", ErrInvalidRouting, channel.Name, err)
+			}
+			r.quiet[channel.Name] = windows
+		}
+	}
+	if err := r.checkChannels("default", r.defaults); err != nil {
+		return nil, err
+	}
+
+	for i, rc := range cfg.Routes {
+		if rc.Name == "" {
+			rc.Name = "#" + strconv.Itoa(i+1)
+		}
+		compiled := route{NotifyRouteConfig: rc, from: -1}
+		for _, severity := range rc.Severities {
+			if severity != SeverityCritical && severity != SeverityWarning && severity != SeverityInfo {
+				return nil, fmt.Errorf("%w: route %s: unknown severity %q", ErrInvalidRouting, rc.Name, severity)
+			}
+		}
+		for _, pattern := range append(append([]string(nil), rc.Categories...), rc.Hosts...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%w: route %s: bad pattern %q", ErrInvalidRouting, rc.Name, pattern)
+			}
+		}
+		if rc.Hours != "" {
+			from, to, err := parseHours(rc.Hours)
+			if err != nil {
+				return nil, fmt.Errorf("%w: route %s: %v", ErrInvalidRouting, rc.Name, err)
+			}
+			compiled.from, compiled.to = from, to
+		}
+		if len(rc.Channels) == 0 {
+			return nil, fmt.Errorf("%w: route %s has no channels", ErrInvalidRouting, rc.Name)
+		}
+		if err := r.checkChannels("route "+rc.Name, rc.Channels); err != nil {
+			return nil, err
+		}
+		if rc.EscalateAfter < 0 || (rc.EscalateAfter > 0 && len(rc.EscalateTo) == 0) {
+			return nil, fmt.Errorf("%w: route %s: escalate_after requires escalate_to", ErrInvalidRouting, rc.Name)
+		}
+		if err := r.checkChannels("route "+rc.Name+" escalation", rc.EscalateTo); err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, compiled)
+	}
+	return r, nil
+}
+
+// checkChannels 确认引用的渠道都已定义
+func (r *Router) checkChannels(owner string, names []string) error {
+	for _, name := range names {
+		if _, ok := r.channels[name]; !ok {
+			return fmt.Errorf("%w: %s references unknown channel %q", ErrInvalidRouting, owner, name)
+		}
+	}
+	return nil
+}
+
+// SendTest 向单个渠道同步发送一条消息并返回发送结果，qwq init 用它验证新配置的渠道
+func SendTest(channel config.NotifyChannelConfig, title, content string) error {
+	notifier, err := NewNotifier(channel)
+	if err != nil {
+		return err
+	}
+	return notifier.Send(title, content)
+}
+
+// parseHours 解析 "09:00-18:00" 形式的时段，返回当天的起止分钟数
+func parseHours(spec string) (int, int, error) {
+	start, end, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid hours %q, want HH:MM-HH:MM", spec)
+	}
+	from, err := parseClock(strings.TrimSpace(start))
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseClock(strings.TrimSpace(end))
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// matchAny 值匹配任意一个通配符模式，模式列表为空时总是匹配
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matches 事件是否满足规则的所有条件
+func (rt route) matches(event Event, tags []string) bool {
+	if len(rt.Severities) > 0 && !hasValue(rt.Severities, event.Severity) {
+		return false
+	}
+	if !matchAny(rt.Categories, event.Category) || !matchAny(rt.Hosts, event.Host) {
+		return false
+	}
+	if len(rt.Tags) > 0 {
+		tagged := false
+		for _, tag := range tags {
+			tagged = tagged || hasValue(rt.Tags, tag)
+		}
+		if !tagged {
+			return false
+		}
+	}
+	if rt.from >= 0 {
+		minute := event.Time.Hour()*60 + event.Time.Minute()
+		if rt.from <= rt.to {
+			return minute >= rt.from && minute < rt.to
+		}
+		// 跨零点，如 22:00-08:00
+		return minute >= rt.from || minute < rt.to
+	}
+	return true
+}
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 按顺序匹配路由规则，没有规则匹配时使用默认渠道
+func (r *Router) Match(event Event) Decision {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	tags := append(append([]string(nil), event.Tags...), r.tags...)
+	for _, rt := range r.routes {
+		if !rt.matches(event, tags) {
+			continue
+		}
+		decision := Decision{Route: rt.Name, Channels: rt.Channels, Deliveries: r.deliveries(event, rt.Channels)}
+		if rt.EscalateAfter > 0 {
+			decision.EscalateAfter = time.Duration(rt.EscalateAfter) * time.Minute
+			decision.EscalateTo = rt.EscalateTo
+		}
+		return decision
+	}
+	return Decision{Route: DefaultRoute, Channels: r.defaults, Deliveries: r.deliveries(event, r.defaults)}
+}
+
+// send 向一个渠道发送消息，暂时的失败重试，每次投递写入投递记录；重试后仍失败时返回最后一次的错误
+func (r *Router) send(name string, notifier Notifier, title, content string) error {
+	record := sendWithRetry(notifier, title, content, r.attempts, r.backoff)
+	record.Channel = name
+	if r.history != nil {
+		r.history.Add(record)
+	}
+	if record.Status == DeliveryFailed {
+		return fmt.Errorf("%s (attempts: %d)", record.Error, record.Attempts)
+	}
+	return nil
+}
+
+// Deliver 向路由结果中的各渠道发送消息，跳过停用的渠道；一个渠道失败不影响其他渠道，返回每个失败渠道的错误
+func (r *Router) Deliver(channels []string, title, content string) map[string]error {
+	failures := make(map[string]error)
+	for _, name := range channels {
+		notifier, ok := r.channels[name]
+		if !ok {
+			failures[name] = errors.New("unknown channel")
+			continue
+		}
+		if r.disabled[name] {
+			continue
+		}
+		if err := r.send(name, notifier, title, content); err != nil {
+			failures[name] = err
+		}
+	}
+	return failures
+}
+
+// Send 在后台发送消息，失败的渠道写入日志
+func (r *Router) Send(channels []string, title, content string) {
+	go func() {
+		for name, err := range r.Deliver(channels, title, content) {
+			logger.Info("❌ 通知发送失败 (渠道 %s): %v", name, err)
+		}
+	}()
+}
+
+// Dispatch 匹配路由并在后台发送事件，返回路由结果；被静默的事件只记录不发送，处于渠道静默时段的事件排队
+func (r *Router) Dispatch(event Event) Decision {
+	decision := r.Match(event)
+	if reason, ok := Suppressed(event); ok {
+		logger.Info("🔕 通知已静默 (%s): %s", reason, event.Title)
+		return decision
+	}
+	r.Send(r.Hold(event, decision), event.Title, event.Content)
+	return decision
+}
+
+// Suppressor 判断事件是否需要静默（如处于维护窗口内），命中时由实现方记录事件并返回静默原因
+type Suppressor func(event Event) (reason string, suppressed bool)
+
+var (
+	suppressor   Suppressor
+	suppressorMu sync.RWMutex
+)
+
+// SetSuppressor 设置全局静默判断，传 nil 时不静默任何事件
+func SetSuppressor(s Suppressor) {
+	suppressorMu.Lock()
+	suppressor = s
+	suppressorMu.Unlock()
+}
+
+// Suppressed 事件是否被静默；info 级别的事件（审批请求、维护摘要等）不是告警，从不静默
+func Suppressed(event Event) (string, bool) {
+	if event.Severity == SeverityInfo {
+		return "", false
+	}
+	suppressorMu.RLock()
+	s := suppressor
+	suppressorMu.RUnlock()
+	if s == nil {
+		return "", false
+	}
+	return s(event)
+}
+
+// Incident 一个持续存在的异常，Key 在多次巡检之间保持不变
+type Incident struct {
+	Key      string
+	Event    Event
+	Decision Decision
+}
+
+type openIncident struct {
+	since     time.Time
+	escalated bool
+}
+
+// Escalator 跟踪未恢复的严重异常，持续时间超过路由规则的升级阈值后升级一次
+type Escalator struct {
+	mu   sync.Mutex
+	open map[string]*openIncident
+}
+
+// NewEscalator 创建升级跟踪器
+func NewEscalator() *Escalator {
+	return &Escalator{open: make(map[string]*openIncident)}
+}
+
+// Observe 记录本轮仍存在的异常，未出现的异常视为已恢复；返回本轮需要升级的异常
+// 只有严重程度为 critical 且路由规则配置了升级的异常会被跟踪
+func (e *Escalator) Observe(now time.Time, incidents []Incident) []Incident {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]bool, len(incidents))
+	var due []Incident
+	for _, incident := range incidents {
+		if incident.Event.Severity != SeverityCritical || incident.Decision.EscalateAfter <= 0 {
+			continue
+		}
+		seen[incident.Key] = true
+		state, ok := e.open[incident.Key]
+		if !ok {
+			state = &openIncident{since: now}
+			e.open[incident.Key] = state
+		}
+		if !state.escalated && now.Sub(state.since) >= incident.Decision.EscalateAfter {
+			state.escalated = true
+			due = append(due, incident)
+		}
+	}
+	for key := range e.open {
+		if !seen[key] {
+			delete(e.open, key)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Key < due[j].Key })
+	return due
+}
+
+// Escalate 将异常升级通知发送到升级渠道
+func (r *Router) Escalate(incident Incident) {
+	title := "⏫ 异常升级: " + incident.Event.Title
+	content := fmt.Sprintf("⏫ **异常持续 %v 未恢复，升级通知** (路由 %s)\n\n%s",
+		incident.Decision.EscalateAfter, incident.Decision.Route, incident.Event.Content)
+	r.Send(incident.Decision.EscalateTo, title, content)
+}
+
+var (
+	defaultRouter   *Router
+	defaultRouterMu sync.RWMutex
+)
+
+// InitRouter 根据配置初始化全局路由器，配置无效时回退到只使用 default 渠道
+func InitRouter() error {
+	router, err := NewRouter(config.Current().NotifyRouting)
+	if err != nil {
+		router, _ = NewRouter(config.NotifyRoutingConfig{})
+	}
+	defaultRouterMu.Lock()
+	defaultRouter = router
+	defaultRouterMu.Unlock()
+	return err
+}
+
+// DefaultRouter 获取全局路由器
+func DefaultRouter() *Router {
+	defaultRouterMu.RLock()
+	router := defaultRouter
+	defaultRouterMu.RUnlock()
+	if router == nil {
+		if err := InitRouter(); err != nil {
+			logger.Info("⚠️ 通知路由配置无效，全部发送到 default 渠道: %v", err)
+		}
+		return DefaultRouter()
+	}
+	return router
+}
+
+// SendEvent 按路由规则发送通知事件
+func SendEvent(event Event) Decision {
+	return DefaultRouter().Dispatch(event)
+}
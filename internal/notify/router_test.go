@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRoutingConfig() config.NotifyRoutingConfig {
+	return config.NotifyRoutingConfig{
+		Channels: []config.NotifyChannelConfig{
+			{Name: "ops", Type: "dingtalk", Webhook: "https://oapi.dingtalk.com/robot/send?access_token=ops"},
+			{Name: "oncall", Type: "telegram", TelegramToken: "token", TelegramChatID: "42"},
+			{Name: "dba", Type: "dingtalk", Webhook: "https://oapi.dingtalk.com/robot/send?access_token=dba"},
+		},
+		Routes: []config.NotifyRouteConfig{
+			{Name: "night-critical", Severities: []string{SeverityCritical}, Hours: "22:00-08:00", Channels: []string{"oncall"}},
+			{Name: "db", Categories: []string{"rule:pg*"}, Tags: []string{"db"}, Channels: []string{"dba"}},
+			{Name: "critical", Severities: []string{SeverityCritical}, Channels: []string{"ops"}, EscalateAfter: 30, EscalateTo: []string{"oncall"}},
+		},
+		Default: []string{"ops"},
+		Tags:    []string{"prod"},
+	}
+}
+
+func TestRouter_Match(t *testing.T) {
+	router, err := NewRouter(testRoutingConfig())
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	day := time.Date(2026, 1, 1, 14, 0, 0, 0, time.Local)
+	night := time.Date(2026, 1, 1, 3, 0, 0, 0, time.Local)
+
+	cases := []struct {
+		event    Event
+		route    string
+		channels string
+	}{
+		{Event{Severity: SeverityCritical, Category: "http", Time: night}, "night-critical", "oncall"},
+		{Event{Severity: SeverityCritical, Category: "http", Time: day}, "critical", "ops"},
+		{Event{Severity: SeverityWarning, Category: "rule:pg_replication", Tags: []string{"db"}, Time: day}, "db", "dba"},
+		{Event{Severity: SeverityWarning, Category: "rule:pg_replication", Time: day}, DefaultRoute, "ops"},
+		{Event{Severity: SeverityWarning, Category: "disk", Time: day}, DefaultRoute, "ops"},
+	}
+	for _, c := range cases {
+		decision := router.Match(c.event)
+		if decision.Route != c.route || strings.Join(decision.Channels, ",") != c.channels {
+			t.Errorf("Match(%s/%s) = %s %v, want %s %s", c.event.Severity, c.event.Category, decision.Route, decision.Channels, c.route, c.channels)
+		}
+	}
+	if decision := router.Match(cases[1].event); decision.EscalateAfter != 30*time.Minute || decision.EscalateTo[0] != "oncall" {
+		t.Errorf("Expected escalation to oncall after 30m, got %+v", decision)
+	}
+
+	// 本机标签参与匹配
+	cfg := testRoutingConfig()
+	cfg.Routes = []config.NotifyRouteConfig{{Name: "prod", Tags: []string{"prod"}, Channels: []string{"oncall"}}}
+	router, _ = NewRouter(cfg)
+	if decision := router.Match(Event{Severity: SeverityInfo}); decision.Route != "prod" {
+		t.Errorf("Host tags should be matched, got %+v", decision)
+	}
+
+	// 未配置路由时发送到 default 渠道
+	router, _ = NewRouter(config.NotifyRoutingConfig{})
+	if decision := router.Match(Event{Severity: SeverityCritical}); decision.Route != DefaultRoute || decision.Channels[0] != DefaultChannel {
+		t.Errorf("Expected built-in default channel, got %+v", decision)
+	}
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	for name, mutate := range map[string]func(*config.NotifyRoutingConfig){
+		"unknown channel":  func(c *config.NotifyRoutingConfig) { c.Routes[0].Channels = []string{"nobody"} },
+		"bad hours":        func(c *config.NotifyRoutingConfig) { c.Routes[0].Hours = "late" },
+		"bad severity":     func(c *config.NotifyRoutingConfig) { c.Routes[0].Severities = []string{"urgent"} },
+		"escalation":       func(c *config.NotifyRoutingConfig) { c.Routes[2].EscalateTo = nil },
+		"duplicate":        func(c *config.NotifyRoutingConfig) { c.Channels[1].Name = "ops" },
+		"missing webhook":  func(c *config.NotifyRoutingConfig) { c.Channels[0].Webhook = "" },
+		"unknown default":  func(c *config.NotifyRoutingConfig) { c.Default = []string{"nobody"} },
+		"reserved default": func(c *config.NotifyRoutingConfig) { c.Channels[0].Name = DefaultChannel },
+	} {
+		cfg := testRoutingConfig()
+		mutate(&cfg)
+		if _, err := NewRouter(cfg); !errors.Is(err, ErrInvalidRouting) {
+			t.Errorf("%s: expected ErrInvalidRouting, got %v", name, err)
+		}
+	}
+}
+
+func TestEscalator(t *testing.T) {
+	router, _ := NewRouter(testRoutingConfig())
+	start := time.Date(2026, 1, 1, 14, 0, 0, 0, time.Local)
+	event := Event{Severity: SeverityCritical, Category: "http", Time: start}
+	incident := Incident{Key: "http", Event: event, Decision: router.Match(event)}
+	warning := Event{Severity: SeverityWarning, Category: "disk", Time: start}
+	ignored := Incident{Key: "disk", Event: warning, Decision: router.Match(warning)}
+
+	escalator := NewEscalator()
+	if due := escalator.Observe(start, []Incident{incident, ignored}); len(due) != 0 {
+		t.Fatalf("Nothing should escalate immediately, got %v", due)
+	}
+	if due := escalator.Observe(start.Add(31*time.Minute), []Incident{incident, ignored}); len(due) != 1 || due[0].Key != "http" {
+		t.Fatalf("Expected http to escalate after 31m, got %v", due)
+	}
+	if due := escalator.Observe(start.Add(60*time.Minute), []Incident{incident}); len(due) != 0 {
+		t.Errorf("Incident should only escalate once, got %v", due)
+	}
+
+	// 恢复后再次出现重新计时
+	escalator.Observe(start.Add(61*time.Minute), nil)
+	if due := escalator.Observe(start.Add(62*time.Minute), []Incident{incident}); len(due) != 0 {
+		t.Errorf("Recovered incident should restart its timer, got %v", due)
+	}
+}
+
+func TestRouter_Deliver(t *testing.T) {
+	router, _ := NewRouter(testRoutingConfig())
+	var got []string
+	router.channels["ops"] = funcNotifier{"ops", func(title, content string) error {
+		got = append(got, "ops:"+title)
+		return nil
+	}}
+	router.channels["oncall"] = funcNotifier{"oncall", func(title, content string) error {
+		return errors.New("unreachable")
+	}}
+	failures := router.Deliver([]string{"ops", "oncall"}, "磁盘告警", "/ 使用率 95%")
+	if len(got) != 1 || got[0] != "ops:磁盘告警" {
+		t.Errorf("ops delivery = %v", got)
+	}
+	if len(failures) != 1 || failures["oncall"] == nil {
+		t.Errorf("Expected oncall failure to be reported, got %v", failures)
+	}
+}
+
+func TestRouter_SkipsDisabledChannels(t *testing.T) {
+	cfg := testRoutingConfig()
+	for i := range cfg.Channels {
+		cfg.Channels[i].Disabled = cfg.Channels[i].Name == "oncall"
+	}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, name := range []string{"ops", "oncall"} {
+		router.channels[name] = funcNotifier{name, func(title, content string) error {
+			got = append(got, name)
+			return nil
+		}}
+	}
+	if failures := router.Deliver([]string{"ops", "oncall"}, "磁盘告警", ""); len(failures) != 0 || len(got) != 1 || got[0] != "ops" {
+		t.Errorf("Expected only the enabled channel to be sent, got %v %v", got, failures)
+	}
+	event := Event{Severity: SeverityCritical, Title: "磁盘告警"}
+	deliveries := router.deliveries(event, []string{"ops", "oncall"})
+	if deliveries[1].Action != ChannelDisabled {
+		t.Errorf("Expected oncall to be reported as disabled, got %+v", deliveries)
+	}
+	if now := router.Hold(event, Decision{Channels: []string{"ops", "oncall"}}); len(now) != 1 || now[0] != "ops" {
+		t.Errorf("Expected disabled channels to be dropped, got %v", now)
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	var body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	channel := config.NotifyChannelConfig{Name: "slack", Type: "slack", Webhook: srv.URL}
+	if err := SendTest(channel, "qwq 测试消息", "通知渠道配置成功"); err != nil {
+		t.Fatalf("SendTest: %v", err)
+	}
+	if !strings.Contains(body, "qwq 测试消息") {
+		t.Errorf("Expected the message to be posted, got %q", body)
+	}
+
+	status = http.StatusForbidden
+	if err := SendTest(channel, "qwq 测试消息", ""); err == nil {
+		t.Error("Expected an error for a rejected webhook")
+	}
+	if err := SendTest(config.NotifyChannelConfig{Type: "telegram"}, "t", ""); err == nil {
+		t.Error("Expected an error for an incomplete channel")
+	}
+}
@@ -87,8 +87,8 @@ func NewUnifiedNotificationService() *UnifiedNotificationService {
 	service := &UnifiedNotificationService{}
 	
 	// 初始化钉钉服务
-	if config.GlobalConfig.DingTalkWebhook != "" {
-		service.dingTalkService = NewDingTalkNotificationService(config.GlobalConfig.DingTalkWebhook)
+	if config.Current().DingTalkWebhook != "" {
+		service.dingTalkService = NewDingTalkNotificationService(config.Current().DingTalkWebhook)
 	}
 	
 	return service
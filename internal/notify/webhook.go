@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"qwq/internal/config"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWebhookTemplate 通用 Webhook 默认的请求体模板
+	DefaultWebhookTemplate = `{"title":"{{title}}","body":"{{body}}"}`
+	// DefaultSignatureHeader 通用 Webhook 默认的签名请求头，值为 sha256=<十六进制 HMAC>
+	DefaultSignatureHeader = "X-QWQ-Signature"
+	// webhookTimeout 通用 Webhook 请求的超时时间
+	webhookTimeout = 10 * time.Second
+)
+
+// WebhookNotifier 向任意地址 POST JSON 的渠道，请求体由模板生成，可选 HMAC-SHA256 签名
+type WebhookNotifier struct {
+	name            string
+	URL             string
+	Secret          string
+	SignatureHeader string
+	Template        string
+	client          *http.Client
+}
+
+// NewWebhookNotifier 根据 webhook 渠道配置创建通用 Webhook 渠道，模板替换后必须是合法的 JSON
+func NewWebhookNotifier(channel config.NotifyChannelConfig) (*WebhookNotifier, error) {
+	u, err := url.Parse(channel.Webhook)
+	if channel.Webhook == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("webhook channel requires an http(s) webhook url")
+	}
+	n := &WebhookNotifier{
+		name:            channel.Name,
+		URL:             channel.Webhook,
+		Secret:          channel.Secret,
+		SignatureHeader: channel.SignatureHeader,
+		Template:        channel.Template,
+		client:          &http.Client{Timeout: webhookTimeout},
+	}
+	if n.Template == "" {
+		n.Template = DefaultWebhookTemplate
+	}
+	if n.SignatureHeader == "" {
+		n.SignatureHeader = DefaultSignatureHeader
+	}
+	if !json.Valid(n.render(`示例 "标题"`, "第一行\n第二行")) {
+		return nil, errors.New(`webhook template is not valid JSON; {{title}} and {{body}} must be inside JSON strings`)
+	}
+	return n, nil
+}
+
+// Name 渠道名称
+func (n *WebhookNotifier) Name() string { return n.name }
+
+// Send 按模板生成请求体并发送，非 2xx 状态码视为失败
+func (n *WebhookNotifier) Send(title, body string) error {
+	payload := n.render(title, body)
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		req.Header.Set(n.SignatureHeader, Sign(n.Secret, payload))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return retryableError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// render 把模板中的 {{title}}、{{body}} 替换为转义后的文本，占位符应位于 JSON 字符串内
+func (n *WebhookNotifier) render(title, body string) []byte {
+	return []byte(strings.NewReplacer("{{title}}", jsonEscape(title), "{{body}}", jsonEscape(body)).Replace(n.Template))
+}
+
+// jsonEscape 转义为 JSON 字符串的内容（不含两端的引号）
+func jsonEscape(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+// Sign 请求体的签名 sha256=<十六进制 HMAC-SHA256>，接收方用相同的密钥计算并比较
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
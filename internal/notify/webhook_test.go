@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"qwq/internal/config"
+)
+
+func TestWebhookNotifier_TemplateAndSignature(t *testing.T) {
+	var body []byte
+	var signature string
+	status := http.StatusAccepted
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Incident-Signature")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	notifier, err := NewWebhookNotifier(config.NotifyChannelConfig{
+		Name: "incident", Type: "webhook", Webhook: srv.URL, Secret: "s3cret", SignatureHeader: "X-Incident-Signature",
+		Template: `{"source":"qwq","summary":"{{title}}","details":{"text":"{{body}}"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Send(`磁盘 "/" 告警`, "使用率 95%\n请处理"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	var payload struct {
+		Summary string `json:"summary"`
+		Details struct {
+			Text string `json:"text"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Summary != `磁盘 "/" 告警` || payload.Details.Text != "使用率 95%\n请处理" {
+		t.Errorf("Unexpected payload %s: %v", body, err)
+	}
+	if signature != Sign("s3cret", body) || !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Expected an HMAC signature of the body, got %q", signature)
+	}
+
+	status = http.StatusInternalServerError
+	if err := notifier.Send("t", "b"); err == nil {
+		t.Error("Expected an error for a failed delivery")
+	}
+}
+
+func TestNewWebhookNotifier_Validates(t *testing.T) {
+	n, err := NewWebhookNotifier(config.NotifyChannelConfig{Name: "hook", Webhook: "http://10.0.0.5/hooks/qwq"})
+	if err != nil || n.Template != DefaultWebhookTemplate || n.SignatureHeader != DefaultSignatureHeader {
+		t.Fatalf("Expected defaults, got %+v %v", n, err)
+	}
+	if _, err := NewWebhookNotifier(config.NotifyChannelConfig{Name: "hook", Webhook: "ftp://10.0.0.5"}); err == nil {
+		t.Error("Expected an error for a non-http url")
+	}
+	// 占位符不在 JSON 字符串内时替换结果不是合法的 JSON
+	if _, err := NewWebhookNotifier(config.NotifyChannelConfig{Name: "hook", Webhook: "https://example.com", Template: `{"text": {{body}}}`}); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
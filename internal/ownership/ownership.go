@@ -0,0 +1,138 @@
+// Package ownership 登记各模块中带所属用户（user_id）的表，删除用户时把其资源整体转给另一个用户
+package ownership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// SystemUserID 内置的系统用户，删除用户时确认放弃（orphan=acknowledge）的资源转给它
+const SystemUserID uint = 0
+
+// ownerColumn 资源表中所属用户的列
+const ownerColumn = "user_id"
+
+// ErrNoOwnerColumn 登记的模型没有 user_id 列
+var ErrNoOwnerColumn = errors.New("model has no user_id column")
+
+// owned 一个服务中带所属用户列的表
+type owned struct {
+	service string
+	db      *gorm.DB
+	tables  []string
+}
+
+// Registry 各模块登记的资源表
+type Registry struct {
+	mu    sync.RWMutex
+	owned []owned
+}
+
+// NewRegistry 创建空的登记表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 登记服务中带 user_id 列的模型，db 为该服务使用的数据库连接
+func (r *Registry) Register(service string, db *gorm.DB, models ...interface{}) error {
+	entry := owned{service: service, db: db}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("parse %s model: %w", service, err)
+		}
+		if stmt.Schema.LookUpField(ownerColumn) == nil {
+			return fmt.Errorf("%w: %s.%s", ErrNoOwnerColumn, service, stmt.Schema.Table)
+		}
+		entry.tables = append(entry.tables, stmt.Schema.Table)
+	}
+	r.mu.Lock()
+	r.owned = append(r.owned, entry)
+	r.mu.Unlock()
+	return nil
+}
+
+// Tables 已登记的表，格式为 "服务.表"
+func (r *Registry) Tables() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var tables []string
+	for _, entry := range r.owned {
+		for _, table := range entry.tables {
+			tables = append(tables, entry.service+"."+table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Transfer 把 from 的全部资源（含软删除的记录）转给 to，返回每张表（"服务.表"）转移的行数
+// 每个数据库一个事务，所有表更新成功后才依次提交，任一更新失败时全部回滚
+func (r *Registry) Transfer(ctx context.Context, from, to uint) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		order []*gorm.DB
+		txs   = make(map[*gorm.DB]*gorm.DB)
+	)
+	rollback := func() {
+		for _, db := range order {
+			txs[db].Rollback()
+		}
+	}
+	counts := make(map[string]int64)
+	for _, entry := range r.owned {
+		tx, ok := txs[entry.db]
+		if !ok {
+			tx = entry.db.WithContext(ctx).Begin()
+			if tx.Error != nil {
+				rollback()
+				return nil, fmt.Errorf("begin %s transaction: %w", entry.service, tx.Error)
+			}
+			txs[entry.db] = tx
+			order = append(order, entry.db)
+		}
+		for _, table := range entry.tables {
+			res := tx.Table(table).Where(ownerColumn+" = ?", from).Update(ownerColumn, to)
+			if res.Error != nil {
+				rollback()
+				return nil, fmt.Errorf("transfer %s.%s: %w", entry.service, table, res.Error)
+			}
+			counts[entry.service+"."+table] = res.RowsAffected
+		}
+	}
+	for i, db := range order {
+		if err := txs[db].Commit().Error; err != nil {
+			for _, rest := range order[i+1:] {
+				txs[rest].Rollback()
+			}
+			return nil, fmt.Errorf("commit ownership transfer: %w", err)
+		}
+	}
+	return counts, nil
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultRegistry *Registry
+)
+
+// SetDefault 设置全局登记表，Web 服务删除用户时通过它转移资源
+func SetDefault(registry *Registry) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultRegistry = registry
+}
+
+// Default 返回全局登记表，未启用时为 nil
+func Default() *Registry {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRegistry
+}
@@ -0,0 +1,122 @@
+package ownership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"qwq/internal/container"
+	"qwq/internal/website"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// setupRegistry 网站和容器模块各使用一个数据库，与按服务分库时一致
+func setupRegistry(t *testing.T) (*Registry, *gorm.DB, *gorm.DB) {
+	t.Helper()
+	sites := openTestDB(t, &website.Website{}, &website.DNSRecord{})
+	projects := openTestDB(t, &container.ComposeProject{}, &container.Deployment{})
+	registry := NewRegistry()
+	if err := registry.Register("website", sites, &website.Website{}, &website.DNSRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("container", projects, &container.ComposeProject{}, &container.Deployment{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sites.Create(&website.Website{Name: "shop", Domain: "shop.example.com", UserID: 2, TenantID: 1})
+	sites.Create(&website.Website{Name: "blog", Domain: "blog.example.com", UserID: 3, TenantID: 1})
+	deleted := &website.Website{Name: "old", Domain: "old.example.com", UserID: 2, TenantID: 1}
+	sites.Create(deleted)
+	sites.Delete(deleted)
+	sites.Create(&website.DNSRecord{Domain: "example.com", Type: "A", Name: "shop", Value: "10.0.0.1", UserID: 2, TenantID: 1})
+	project := &container.ComposeProject{Name: "shop", Content: "services: {}", Status: container.ProjectStatusRunning, UserID: 2, TenantID: 1}
+	projects.Create(project)
+	projects.Create(&container.Deployment{ProjectID: project.ID, Version: "v1", Strategy: container.DeployStrategyRecreate, Status: container.DeploymentStatusCompleted, UserID: 2})
+	return registry, sites, projects
+}
+
+func countOwned(t *testing.T, db *gorm.DB, table string, user uint) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Table(table).Where("user_id = ?", user).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRegistry_Transfer(t *testing.T) {
+	registry, sites, projects := setupRegistry(t)
+
+	counts, err := registry.Transfer(context.Background(), 2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"website.websites": 2, "website.dns_records": 1, "container.compose_projects": 1, "container.deployments": 1}
+	for table, n := range want {
+		if counts[table] != n {
+			t.Errorf("%s: transferred %d, want %d (%v)", table, counts[table], n, counts)
+		}
+	}
+	if n := countOwned(t, sites, "websites", 5); n != 2 {
+		t.Errorf("Expected soft-deleted websites to be transferred too, got %d", n)
+	}
+	if n := countOwned(t, sites, "websites", 3); n != 1 {
+		t.Errorf("Other users' websites should not move, got %d", n)
+	}
+	if n := countOwned(t, projects, "compose_projects", 2) + countOwned(t, projects, "deployments", 2); n != 0 {
+		t.Errorf("Expected nothing left for the deleted user, got %d", n)
+	}
+
+	// 确认放弃的资源转给系统用户
+	if _, err := registry.Transfer(context.Background(), 3, SystemUserID); err != nil {
+		t.Fatal(err)
+	}
+	if n := countOwned(t, sites, "websites", SystemUserID); n != 1 {
+		t.Errorf("Expected the website to belong to the system user, got %d", n)
+	}
+}
+
+func TestRegistry_TransferRollsBack(t *testing.T) {
+	registry, sites, projects := setupRegistry(t)
+	// 容器模块的部署表丢失时，已更新的网站和项目都要回滚
+	if err := projects.Migrator().DropTable(&container.Deployment{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Transfer(context.Background(), 2, 5); err == nil {
+		t.Fatal("Expected the transfer to fail")
+	}
+	if n := countOwned(t, sites, "websites", 2); n != 2 {
+		t.Errorf("Expected websites to stay with the user after a failed transfer, got %d", n)
+	}
+	if n := countOwned(t, projects, "compose_projects", 2); n != 1 {
+		t.Errorf("Expected projects to stay with the user after a failed transfer, got %d", n)
+	}
+}
+
+func TestRegistry_RegisterRequiresOwnerColumn(t *testing.T) {
+	db := openTestDB(t, &container.ComposeRevision{})
+	if err := NewRegistry().Register("container", db, &container.ComposeRevision{}); !errors.Is(err, ErrNoOwnerColumn) {
+		t.Errorf("Expected ErrNoOwnerColumn, got %v", err)
+	}
+}
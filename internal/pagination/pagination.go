@@ -0,0 +1,207 @@
+// Package pagination 列表接口统一的分页、排序和过滤：
+// GET /api/xxx?page=2&pageSize=50&sort=-created_at&status=running
+// 响应为 {"items": [...], "total": 123, "page": 2, "pageSize": 50}。
+// 省略参数时返回第一页和 DefaultPageSize 条；排序字段和过滤参数只接受接口声明的白名单，
+// 数据库列名不会直接来自请求
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"qwq/internal/apierror"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultPageSize 未指定 pageSize 时每页的条数
+	DefaultPageSize = 20
+	// MaxPageSize 每页最多的条数，超出时按该值返回
+	MaxPageSize = 200
+)
+
+// 错误码
+const (
+	CodeInvalidPagination = "INVALID_PAGINATION"
+	CodeInvalidSort       = "INVALID_SORT_FIELD"
+)
+
+var (
+	ErrInvalidPage = errors.New("invalid page")
+	ErrInvalidSort = errors.New("invalid sort field")
+)
+
+// Spec 列表接口允许的排序字段和过滤参数
+type Spec struct {
+	Sort        map[string]string // 排序字段名到列名的映射
+	DefaultSort string            // 未指定 sort 时的排序字段，"-" 前缀表示降序
+	Filters     map[string]string // 过滤参数名到列名的映射，按相等匹配
+}
+
+// Filter 一个过滤条件
+type Filter struct {
+	Param  string
+	Column string
+	Value  string
+}
+
+// Query 解析后的分页参数
+type Query struct {
+	Page     int
+	PageSize int
+	Sort     string // 排序字段名，为空时不排序
+	Column   string // 排序字段对应的列名
+	Desc     bool
+	Filters  []Filter // 按参数名排序
+}
+
+// Page 一页结果
+type Page[T any] struct {
+	Items    []T   `json:"items"`
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"pageSize"`
+}
+
+// Parse 按 spec 解析查询参数：page 和 pageSize 必须是正整数，pageSize 超过 MaxPageSize 时按最大值返回；
+// sort 为 spec.Sort 中的字段名，"-" 前缀表示降序，不在白名单中时返回 INVALID_SORT_FIELD
+func Parse(values url.Values, spec Spec) (Query, error) {
+	q := Query{Page: 1, PageSize: DefaultPageSize}
+	var err error
+	if q.Page, err = positive(values, "page", 1); err != nil {
+		return q, err
+	}
+	if q.PageSize, err = positive(values, "pageSize", DefaultPageSize); err != nil {
+		return q, err
+	}
+	q.PageSize = min(q.PageSize, MaxPageSize)
+
+	field := values.Get("sort")
+	if field == "" {
+		field = spec.DefaultSort
+	}
+	if field != "" {
+		q.Desc = strings.HasPrefix(field, "-")
+		q.Sort = strings.TrimPrefix(field, "-")
+		column, ok := spec.Sort[q.Sort]
+		if !ok {
+			return q, apierror.Wrap(http.StatusBadRequest, CodeInvalidSort, fmt.Errorf("%w: %s", ErrInvalidSort, q.Sort)).
+				WithDetails(map[string]interface{}{"field": q.Sort, "allowed": spec.SortFields()})
+		}
+		q.Column = column
+	}
+
+	for param, column := range spec.Filters {
+		if value := strings.TrimSpace(values.Get(param)); value != "" {
+			q.Filters = append(q.Filters, Filter{Param: param, Column: column, Value: value})
+		}
+	}
+	sort.Slice(q.Filters, func(i, j int) bool { return q.Filters[i].Param < q.Filters[j].Param })
+	return q, nil
+}
+
+// positive 读取正整数参数，省略时返回默认值
+func positive(values url.Values, name string, def int) (int, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, apierror.Wrap(http.StatusBadRequest, CodeInvalidPagination, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidPage, name)).
+			WithDetails(map[string]string{"field": name})
+	}
+	return n, nil
+}
+
+// SortFields 允许的排序字段名，按名称排序
+func (s Spec) SortFields() []string {
+	fields := make([]string, 0, len(s.Sort))
+	for field := range s.Sort {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Filter 过滤参数的值，未指定时为空
+func (q Query) Filter(param string) string {
+	for _, f := range q.Filters {
+		if f.Param == param {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Offset 当前页之前的条数
+func (q Query) Offset() int {
+	return (q.Page - 1) * q.PageSize
+}
+
+// Find 在 db（已设置 Model 和权限条件）上应用过滤条件，统计总数后按排序字段和 id 查询当前页
+func Find[T any](db *gorm.DB, q Query) (*Page[T], error) {
+	for _, f := range q.Filters {
+		db = db.Where(clause.Eq{Column: clause.Column{Name: f.Column}, Value: f.Value})
+	}
+	page := &Page[T]{Items: []T{}, Page: q.Page, PageSize: q.PageSize}
+	if err := db.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	if int64(q.Offset()) >= page.Total {
+		return page, nil
+	}
+
+	query := db.Session(&gorm.Session{})
+	if q.Column != "" {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: q.Column}, Desc: q.Desc})
+	}
+	// id 作为第二排序键，保证排序字段相同的行在各页之间顺序稳定
+	if q.Column != "id" {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: q.Desc})
+	}
+	if err := query.Offset(q.Offset()).Limit(q.PageSize).Find(&page.Items).Error; err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Slice 对内存中的列表过滤、排序和分页，field 返回条目在指定列上的值，
+// 过滤按相等匹配（不区分大小写），排序按字符串比较，相同时保持原顺序
+func Slice[T any](items []T, q Query, field func(item T, column string) string) *Page[T] {
+	filtered := make([]T, 0, len(items))
+	for _, item := range items {
+		matched := true
+		for _, f := range q.Filters {
+			if !strings.EqualFold(field(item, f.Column), f.Value) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			filtered = append(filtered, item)
+		}
+	}
+	if q.Column != "" {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := field(filtered[i], q.Column), field(filtered[j], q.Column)
+			if q.Desc {
+				return a > b
+			}
+			return a < b
+		})
+	}
+
+	page := &Page[T]{Items: []T{}, Total: int64(len(filtered)), Page: q.Page, PageSize: q.PageSize}
+	if start := q.Offset(); start < len(filtered) {
+		page.Items = filtered[start:min(start+q.PageSize, len(filtered))]
+	}
+	return page
+}
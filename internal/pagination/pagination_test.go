@@ -0,0 +1,138 @@
+package pagination
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"qwq/internal/apierror"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+type record struct {
+	ID     uint `gorm:"primaryKey"`
+	Name   string
+	Status string
+}
+
+var testSpec = Spec{
+	Sort:        map[string]string{"name": "name", "id": "id"},
+	DefaultSort: "-id",
+	Filters:     map[string]string{"status": "status"},
+}
+
+func TestParse(t *testing.T) {
+	q, err := Parse(url.Values{}, testSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 1 || q.PageSize != DefaultPageSize || q.Sort != "id" || !q.Desc || len(q.Filters) != 0 {
+		t.Errorf("Expected defaults, got %+v", q)
+	}
+
+	q, err = Parse(url.Values{"page": {"3"}, "pageSize": {"1000"}, "sort": {"name"}, "status": {"running"}, "other": {"x"}}, testSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 3 || q.PageSize != MaxPageSize || q.Column != "name" || q.Desc || q.Filter("status") != "running" || len(q.Filters) != 1 {
+		t.Errorf("Unexpected query %+v", q)
+	}
+
+	for _, values := range []url.Values{{"page": {"0"}}, {"page": {"x"}}, {"pageSize": {"-1"}}} {
+		_, err := Parse(values, testSpec)
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Code != CodeInvalidPagination || !errors.Is(err, ErrInvalidPage) {
+			t.Errorf("%v: expected INVALID_PAGINATION, got %v", values, err)
+		}
+	}
+
+	_, err = Parse(url.Values{"sort": {"-password"}}, testSpec)
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidSort || !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("Expected INVALID_SORT_FIELD, got %v", err)
+	}
+	if details := apiErr.Details.(map[string]interface{}); fmt.Sprint(details["allowed"]) != "[id name]" {
+		t.Errorf("Expected the allowed fields in details, got %v", details)
+	}
+}
+
+func TestFind(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&record{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		status := "running"
+		if i%2 == 0 {
+			status = "stopped"
+		}
+		db.Create(&record{Name: fmt.Sprintf("r%d", i), Status: status})
+	}
+
+	page, err := Find[*record](db.Model(&record{}), Query{Page: 2, PageSize: 2, Column: "id", Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 5 || len(page.Items) != 2 || page.Items[0].ID != 3 || page.Items[1].ID != 2 {
+		t.Errorf("Unexpected second page %+v", page)
+	}
+
+	page, err = Find[*record](db.Model(&record{}), Query{Page: 3, PageSize: 2, Column: "id"})
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != 5 {
+		t.Errorf("Expected the last partial page, got %+v %v", page, err)
+	}
+
+	page, err = Find[*record](db.Model(&record{}), Query{Page: 9, PageSize: 2})
+	if err != nil || page.Total != 5 || page.Items == nil || len(page.Items) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v %v", page, err)
+	}
+
+	page, err = Find[*record](db.Model(&record{}), Query{Page: 1, PageSize: 10, Column: "name", Filters: []Filter{{Param: "status", Column: "status", Value: "stopped"}}})
+	if err != nil || page.Total != 2 || len(page.Items) != 2 || page.Items[0].Name != "r2" {
+		t.Errorf("Expected filtered results, got %+v %v", page, err)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	items := []record{{ID: 1, Name: "b", Status: "up"}, {ID: 2, Name: "a", Status: "down"}, {ID: 3, Name: "c", Status: "UP"}}
+	field := func(r record, column string) string {
+		if column == "status" {
+			return r.Status
+		}
+		return r.Name
+	}
+
+	page := Slice(items, Query{Page: 1, PageSize: 2, Column: "name"}, field)
+	if page.Total != 3 || len(page.Items) != 2 || page.Items[0].Name != "a" || page.Items[1].Name != "b" {
+		t.Errorf("Unexpected first page %+v", page)
+	}
+	page = Slice(items, Query{Page: 2, PageSize: 2, Column: "name"}, field)
+	if len(page.Items) != 1 || page.Items[0].Name != "c" {
+		t.Errorf("Unexpected last page %+v", page)
+	}
+	page = Slice(items, Query{Page: 5, PageSize: 2}, field)
+	if page.Items == nil || len(page.Items) != 0 || page.Total != 3 {
+		t.Errorf("Expected an empty page past the end, got %+v", page)
+	}
+	page = Slice(items, Query{Page: 1, PageSize: 10, Column: "name", Desc: true, Filters: []Filter{{Column: "status", Value: "up"}}}, field)
+	if page.Total != 2 || page.Items[0].Name != "c" {
+		t.Errorf("Expected case-insensitive filtering, got %+v", page)
+	}
+	if items[0].Name != "b" {
+		t.Error("Slice must not reorder the input")
+	}
+}
@@ -0,0 +1,93 @@
+package patrol
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"qwq/internal/backup"
+)
+
+const (
+	// configBackupEvery 定时配置备份的间隔
+	configBackupEvery = 24 * time.Hour
+	// configBackupRetryEvery 定时备份失败后重试的最短间隔，期间的巡检沿用上次的失败
+	configBackupRetryEvery = time.Hour
+)
+
+// ConfigBackupRunner 执行和查询配置备份，*backup.ConfigBackupManager 实现了该接口
+type ConfigBackupRunner interface {
+	Latest() (*backup.ConfigBackup, error)
+	Backup(ctx context.Context, trigger string) (*backup.ConfigBackup, error)
+}
+
+// ConfigBackups 配置备份管理器，由 Web 和巡检模式启动时注入
+// 未注入或配置了 backup.disable_schedule 时巡检不包含定时配置备份
+var ConfigBackups ConfigBackupRunner
+
+// configBackupState 上次定时备份失败的时间和错误，DefaultChecks 每次重新创建检查项，需要跨巡检保存
+type configBackupState struct {
+	mu       sync.Mutex
+	failedAt time.Time
+	err      error
+}
+
+var lastConfigBackup = &configBackupState{}
+
+// BackupCheck 定时配置备份：距上次备份超过一天时备份 nginx 配置、compose 项目、数据库和配置文件，失败时告警
+type BackupCheck struct {
+	Backups ConfigBackupRunner
+	Now     func() time.Time   // 为空时使用 time.Now
+	state   *configBackupState // 为空时使用跨巡检共享的记录
+}
+
+// Name 检查项名称
+func (c *BackupCheck) Name() string { return "config-backup" }
+
+// Timeout 备份数据库可能需要较长时间
+func (c *BackupCheck) Timeout() time.Duration { return 5 * time.Minute }
+
+// Run 执行定时配置备份
+func (c *BackupCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+	state := c.state
+	if state == nil {
+		state = lastConfigBackup
+	}
+
+	latest, err := c.Backups.Latest()
+	if err != nil {
+		result.Skip("无法读取备份记录: %v", err)
+		return result
+	}
+	if latest != nil && now.Sub(latest.CreatedAt) < configBackupEvery {
+		result.Observe("最近一次配置备份 %s 创建于 %s", latest.ID, latest.CreatedAt.Format("2006-01-02 15:04"))
+		return result
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.err != nil && now.Sub(state.failedAt) < configBackupRetryEvery {
+		result.Observe("距上次备份失败不足 %s，沿用 %s 的结果", configBackupRetryEvery, state.failedAt.Format("15:04"))
+	} else if created, err := c.Backups.Backup(ctx, "scheduled"); err != nil {
+		state.failedAt, state.err = now, err
+		result.Observe("定时配置备份失败")
+	} else {
+		state.failedAt, state.err = time.Time{}, nil
+		result.Observe("创建了配置备份 %s（%d 字节）", created.ID, created.Size)
+	}
+	result.Threshold("距上次成功备份超过 %s 时执行备份", configBackupEvery)
+
+	if state.err != nil {
+		detail := state.err.Error()
+		if latest != nil {
+			detail += "\n最近一次成功的备份: " + latest.ID
+		}
+		result.Alert(Finding{Title: "定时配置备份失败", Detail: detail})
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/website"
+)
+
+const (
+	// certRenewEvery 两次证书续期之间的最短间隔，期间的巡检沿用上次的结果，
+	// 避免续期失败时每次巡检都重试而触发 Let's Encrypt 的失败验证频率限制
+	certRenewEvery = time.Hour
+	// certCriticalDays 续期失败且证书在这么多天内过期时按严重故障告警
+	certCriticalDays = 7
+)
+
+// CertRenewals 续期进入续期窗口的证书并重载 nginx，由 Web 和巡检模式启动时注入（需要网站数据库）
+// 未注入时巡检不包含证书检查
+var CertRenewals func(ctx context.Context) ([]website.RenewalResult, error)
+
+// certRenewalState 上次续期的时间和结果，DefaultChecks 每次重新创建检查项，需要跨巡检保存
+type certRenewalState struct {
+	mu      sync.Mutex
+	at      time.Time
+	results []website.RenewalResult
+	err     error
+}
+
+var lastCertRenewal = &certRenewalState{}
+
+// CertCheck 证书检查：续期进入续期窗口的证书，续期失败或续期后重载 nginx 失败时告警
+type CertCheck struct {
+	Renew func(ctx context.Context) ([]website.RenewalResult, error)
+	Now   func() time.Time  // 为空时使用 time.Now
+	state *certRenewalState // 为空时使用跨巡检共享的记录
+}
+
+// Name 检查项名称
+func (c *CertCheck) Name() string { return "certificates" }
+
+// Timeout ACME 签发需要等待 CA 验证，DNS-01 还要等待记录生效
+func (c *CertCheck) Timeout() time.Duration { return 10 * time.Minute }
+
+// Run 执行证书检查
+func (c *CertCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+	state := c.state
+	if state == nil {
+		state = lastCertRenewal
+	}
+
+	state.mu.Lock()
+	if state.at.IsZero() || now.Sub(state.at) >= certRenewEvery {
+		state.results, state.err = c.Renew(ctx)
+		state.at = now
+		result.Observe("续期了 %d 张进入续期窗口的证书", len(state.results))
+	} else {
+		result.Observe("距上次续期不足 %s，沿用 %s 的结果（%d 张证书）", certRenewEvery, state.at.Format("15:04"), len(state.results))
+	}
+	results, err := state.results, state.err
+	state.mu.Unlock()
+
+	if err != nil && len(results) == 0 {
+		result.Skip("无法检查证书: %v", err)
+		return result
+	}
+
+	var failed []string
+	critical := false
+	for _, renewal := range results {
+		if renewal.Err == nil {
+			continue
+		}
+		line := fmt.Sprintf("- %s：%v", renewal.Cert.Domain, renewal.Err)
+		if expiry := renewal.Cert.ExpiryDate; expiry != nil {
+			days := int(expiry.Sub(now).Hours() / 24)
+			line += fmt.Sprintf("（%s 过期，剩余 %d 天）", expiry.Format("2006-01-02"), days)
+			if days < certCriticalDays {
+				critical = true
+			}
+		}
+		failed = append(failed, line)
+	}
+	result.Threshold("%d 张证书续期失败", len(failed))
+
+	if len(failed) > 0 {
+		result.Alert(Finding{
+			Title:    "证书自动续期失败",
+			Detail:   fmt.Sprintf("%d 张证书续期失败，原证书在过期前仍然有效，下次巡检会重试：\n%s", len(failed), strings.Join(failed, "\n")),
+			Critical: critical,
+		})
+	}
+	if err != nil {
+		result.Alert(Finding{Title: "证书续期后重载 nginx 失败", Detail: err.Error()})
+	}
+	return result
+}
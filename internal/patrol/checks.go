@@ -0,0 +1,564 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/drift"
+	"qwq/internal/firewall"
+	"qwq/internal/hostaudit"
+	"qwq/internal/jobs"
+	"qwq/internal/metrics"
+	"qwq/internal/monitor"
+	"qwq/internal/selfguard"
+	"qwq/internal/utils"
+)
+
+const (
+	// DefaultDiskThreshold 磁盘使用率告警阈值（百分比）
+	DefaultDiskThreshold = 85
+	// DefaultLoadThreshold 1 分钟负载告警阈值
+	DefaultLoadThreshold = 4.0
+	// DefaultMemThreshold 内存使用率告警阈值（百分比）
+	DefaultMemThreshold = 90.0
+)
+
+// ExposureReport 生成端口暴露面报告，由 Web 服务启动时注入（需要容器和网站信息）
+// 未注入时巡检不包含端口暴露检查
+var ExposureReport func(ctx context.Context) (*firewall.Report, error)
+
+// DefaultChecks 返回默认的巡检检查项
+// 包括磁盘、负载、内存、OOM、僵尸进程、时钟偏差、自定义规则、HTTP 服务、端口暴露、定时任务、托管文件外部修改、主机账号审计、容器日志、证书续期检查和定时配置备份
+func DefaultChecks(shell ShellFunc) []PatrolCheck {
+	checks := systemChecks(shell)
+	if !config.Current().Patrol.Clock.Disabled {
+		checks = append(checks, NewClockCheck(shell))
+	}
+	for _, rule := range config.Current().PatrolRules {
+		checks = append(checks, &RuleCheck{Shell: shell, Rule: rule})
+	}
+	if len(config.Current().HTTPRules) > 0 {
+		checks = append(checks, &HTTPCheck{Refresh: config.Current().Patrol.HTTPRefresh})
+	}
+	if ExposureReport != nil {
+		checks = append(checks, &ExposureCheck{Report: ExposureReport})
+	}
+	if scheduler := jobs.Default(); scheduler != nil {
+		checks = append(checks, &JobCheck{Failing: scheduler.Failing})
+	}
+	if selfguard.CurrentLimits().MemoryBytes > 0 {
+		checks = append(checks, &SelfCheck{Sample: selfguard.Current})
+	}
+	if drift.Enabled() {
+		checks = append(checks, &DriftCheck{Open: func() []drift.Event { return drift.Default.Events(true) }})
+	}
+	if hostaudit.Enabled() {
+		checks = append(checks, &AccountsCheck{Audit: hostaudit.Default.Check})
+	}
+	if ContainerLogs != nil && !config.Current().Patrol.ContainerLogs.Disabled {
+		checks = append(checks, NewContainerLogCheck(ContainerLogs))
+	}
+	if CertRenewals != nil {
+		checks = append(checks, &CertCheck{Renew: CertRenewals})
+	}
+	if ConfigBackups != nil {
+		checks = append(checks, &BackupCheck{Backups: ConfigBackups})
+	}
+	return checks
+}
+
+// systemChecks 磁盘、负载、内存、OOM 和僵尸进程检查，本机和远程主机使用相同的阈值
+// 负载和内存告警时附带在同一主机上采集的占用最高的进程
+func systemChecks(shell ShellFunc) []PatrolCheck {
+	diskThreshold, loadThreshold, memThreshold := DefaultDiskThreshold, DefaultLoadThreshold, DefaultMemThreshold
+	if threshold := config.Current().Patrol.DiskThreshold; threshold > 0 {
+		diskThreshold = threshold
+	}
+	if threshold := config.Current().Patrol.LoadThreshold; threshold > 0 {
+		loadThreshold = threshold
+	}
+	if threshold := config.Current().Patrol.MemThreshold; threshold > 0 {
+		memThreshold = threshold
+	}
+	offenders := NewTopOffenders(shell)
+	return []PatrolCheck{
+		&DiskCheck{Shell: shell, Threshold: diskThreshold},
+		&LoadCheck{Shell: shell, Threshold: loadThreshold, Offenders: offenders},
+		&MemoryCheck{Shell: shell, Threshold: memThreshold, Offenders: offenders},
+		&OOMCheck{Shell: shell},
+		&ZombieCheck{Shell: shell},
+	}
+}
+
+// maxTraceStderr 决策追踪中保留的 stderr 长度
+const maxTraceStderr = 500
+
+// runShell 执行命令，非零退出码和 stderr 记录到决策追踪中
+// 检查项只根据 stdout 判断，避免把 stderr 中的警告当成命令结果
+func runShell(result *CheckResult, shell ShellFunc, cmd string) *utils.ShellResult {
+	res := shell(cmd)
+	if res == nil {
+		res = &utils.ShellResult{Command: cmd, ExitCode: -1, Err: "no result"}
+	}
+	if !res.OK() {
+		result.Observe("命令退出码 %d: %s", res.ExitCode, cmd)
+	}
+	if stderr := strings.TrimSpace(res.Stderr); stderr != "" {
+		if len(stderr) > maxTraceStderr {
+			stderr = stderr[:maxTraceStderr] + "..."
+		}
+		result.Observe("stderr: %s", stderr)
+	}
+	return res
+}
+
+// DiskCheck 磁盘使用率检查（过滤虚拟设备）
+type DiskCheck struct {
+	Shell     ShellFunc
+	Threshold int
+}
+
+// Name 检查项名称
+func (c *DiskCheck) Name() string { return "disk" }
+
+// Run 执行磁盘检查
+func (c *DiskCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	// df 遇到无权限的挂载点时退出码非零，但 stdout 中其余行仍然有效
+	out := runShell(result, c.Shell, "df -h").Stdout
+	lines := strings.Split(out, "\n")
+	result.Observe("df -h 输出 %d 行", len(lines))
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "Filesystem") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			result.Filter("line skipped: too few fields: %s", line)
+			continue
+		}
+
+		device := fields[0]
+		mountPoint := fields[len(fields)-1]
+
+		if reason := IgnoredDiskReason(line, device, mountPoint); reason != "" {
+			result.Filter("line skipped: matched %s: %s", reason, device)
+			continue
+		}
+
+		usePct, err := strconv.Atoi(strings.TrimSuffix(fields[4], "%"))
+		if err != nil {
+			result.Filter("line skipped: cannot parse usage %q: %s", fields[4], device)
+			continue
+		}
+
+		if usePct > c.Threshold {
+			result.Threshold("%s (%s): %d%% > %d%%", device, mountPoint, usePct, c.Threshold)
+			result.Alert(Finding{Title: fmt.Sprintf("磁盘告警 (%s)", device), Detail: line, Fenced: true})
+		} else {
+			result.Threshold("%s (%s): %d%% <= %d%%", device, mountPoint, usePct, c.Threshold)
+		}
+	}
+
+	return result
+}
+
+// IgnoredDiskReason 判断是否应该忽略该磁盘设备，返回命中的过滤规则
+// 过滤虚拟设备和临时文件系统，避免误报；不忽略时返回空字符串
+func IgnoredDiskReason(line, device, mountPoint string) string {
+	// 检查设备名：过滤所有 loop 设备（虚拟块设备）
+	if strings.Contains(device, "/dev/loop") {
+		return "/dev/loop"
+	}
+	if strings.Contains(device, "loop") {
+		return "loop"
+	}
+
+	// 检查挂载点：过滤 snap 相关路径（Ubuntu snap 包）
+	for _, pattern := range []string{"/snap", "snap/", "/hostfs"} {
+		if strings.Contains(mountPoint, pattern) {
+			return pattern
+		}
+	}
+
+	// 检查整行：过滤虚拟文件系统
+	for _, pattern := range []string{"tmpfs", "overlay", "cdrom", "efivarfs"} {
+		if strings.Contains(line, pattern) {
+			return pattern
+		}
+	}
+
+	return ""
+}
+
+// LoadCheck 系统负载检查（1 分钟负载超过阈值时告警）
+type LoadCheck struct {
+	Shell     ShellFunc
+	Threshold float64
+	Offenders *TopOffenders // 告警时附带占用最高的进程，nil 表示不附带
+}
+
+// Name 检查项名称
+func (c *LoadCheck) Name() string { return "load" }
+
+// Run 执行负载检查
+func (c *LoadCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	res := runShell(result, c.Shell, "uptime | awk -F'load average:' '{ print $2 }'")
+	out := strings.TrimSpace(res.Stdout)
+	result.Observe("load average: %s", out)
+	if out == "" || !res.OK() {
+		result.Skip("无法获取负载数据")
+		return result
+	}
+
+	first := strings.TrimSpace(strings.Split(out, ",")[0])
+	load, err := strconv.ParseFloat(first, 64)
+	if err != nil {
+		result.Skip("无法解析 1 分钟负载 %q", first)
+		return result
+	}
+
+	if load > c.Threshold {
+		result.Threshold("1 分钟负载 %.2f > %.1f", load, c.Threshold)
+		result.Alert(Finding{Title: "高负载", Detail: withOffenders(result, c.Offenders, out), Fenced: true})
+	} else {
+		result.Threshold("1 分钟负载 %.2f <= %.1f", load, c.Threshold)
+	}
+	return result
+}
+
+// MemoryCheck 内存使用率检查（按 free 的口径计算，不含缓存）
+type MemoryCheck struct {
+	Shell     ShellFunc
+	Threshold float64
+	Offenders *TopOffenders // 告警时附带占用最高的进程，nil 表示不附带
+}
+
+// Name 检查项名称
+func (c *MemoryCheck) Name() string { return "memory" }
+
+// Run 执行内存检查
+func (c *MemoryCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	res := runShell(result, c.Shell, "cat /proc/meminfo")
+	totalMB, usedMB, err := metrics.ParseMeminfo([]byte(res.Stdout))
+	if err != nil || totalMB == 0 {
+		result.Skip("无法获取内存数据")
+		return result
+	}
+	pct := float64(usedMB) * 100 / float64(totalMB)
+	result.Observe("内存已用 %d MB / 共 %d MB (%.1f%%)", usedMB, totalMB, pct)
+
+	if pct > c.Threshold {
+		result.Threshold("%.1f%% > %.1f%%", pct, c.Threshold)
+		detail := fmt.Sprintf("已用 %d MB / 共 %d MB (%.1f%%)", usedMB, totalMB, pct)
+		result.Alert(Finding{Title: "内存告警", Detail: withOffenders(result, c.Offenders, detail), Fenced: true})
+	} else {
+		result.Threshold("%.1f%% <= %.1f%%", pct, c.Threshold)
+	}
+	return result
+}
+
+// withOffenders 在异常详情后附加占用最高的进程，采集失败时只保留原详情
+func withOffenders(result *CheckResult, offenders *TopOffenders, detail string) string {
+	if offenders == nil {
+		return detail
+	}
+	if table := offenders.Table(result); table != "" {
+		return detail + "\n\n" + table
+	}
+	return detail
+}
+
+// OOMCheck OOM（内存溢出）日志检查
+type OOMCheck struct {
+	Shell ShellFunc
+}
+
+// Name 检查项名称
+func (c *OOMCheck) Name() string { return "oom" }
+
+// Run 执行 OOM 检查
+func (c *OOMCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	res := runShell(result, c.Shell, "dmesg | grep -i 'out of memory' | tail -n 5")
+	trimmed := strings.TrimSpace(res.Stdout)
+	result.Observe("dmesg 匹配 %d 行", countLines(trimmed))
+
+	switch {
+	case strings.Contains(res.Stderr, "Operation not permitted") || strings.Contains(res.Stderr, "不允许的操作"):
+		result.Skip("无权限读取 dmesg")
+	case trimmed == "":
+		result.Threshold("未发现 out of memory 记录")
+	default:
+		result.Threshold("发现 out of memory 记录")
+		result.Alert(Finding{Title: "OOM日志", Detail: trimmed, Fenced: true})
+	}
+	return result
+}
+
+// RuleCheck 自定义巡检规则（命令 stdout 有输出即视为异常）
+type RuleCheck struct {
+	Shell ShellFunc
+	Rule  config.PatrolRule
+}
+
+// Name 检查项名称
+func (c *RuleCheck) Name() string { return "rule:" + c.Rule.Name }
+
+// Timeout 规则单独配置的超时时间
+func (c *RuleCheck) Timeout() time.Duration { return time.Duration(c.Rule.Timeout) * time.Second }
+
+// Run 执行自定义规则
+func (c *RuleCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	res := runShell(result, c.Shell, c.Rule.Command)
+	trimmed := strings.TrimSpace(res.Stdout)
+	result.Observe("命令 %q 输出 %d 行", c.Rule.Command, countLines(trimmed))
+
+	switch {
+	case !res.OK():
+		result.Filter("output ignored: command exited with status %d", res.ExitCode)
+	case trimmed == "":
+		result.Threshold("无输出")
+	default:
+		result.Threshold("有输出，规则命中")
+		result.Alert(Finding{Title: c.Rule.Name, Detail: trimmed, Fenced: true})
+	}
+	return result
+}
+
+// failureTitles、degradedTitles 各类型监控检查失败和需要关注时的异常标题
+var (
+	failureTitles  = map[string]string{monitor.CheckTypeHTTP: "HTTP异常", monitor.CheckTypeTCP: "端口不可达", monitor.CheckTypeTLS: "证书异常"}
+	degradedTitles = map[string]string{monitor.CheckTypeHTTP: "HTTP响应缓慢", monitor.CheckTypeTCP: "端口响应缓慢", monitor.CheckTypeTLS: "证书即将过期"}
+)
+
+// HTTPCheck HTTP、TCP 端口和 TLS 证书检查，默认读取后台检查的最近结果
+type HTTPCheck struct {
+	Refresh bool // 重新执行所有检查，不使用缓存结果
+}
+
+// Name 检查项名称
+func (c *HTTPCheck) Name() string { return "http" }
+
+// Run 执行 HTTP 检查。缓存结果过期或尚未检查时（如后台检查未运行）重新执行
+func (c *HTTPCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	results := monitor.RunChecks()
+	refresh := c.Refresh
+	for _, res := range results {
+		refresh = refresh || res.Stale
+	}
+	if refresh {
+		results = monitor.DefaultChecks.Refresh(ctx)
+	}
+	for _, res := range results {
+		if res.CheckedAt.IsZero() {
+			result.Observe("%s (%s): 未能在超时前完成检查", res.Name, res.URL)
+			continue
+		}
+		if res.Success && !res.Degraded {
+			result.Observe("%s (%s): ok, %s", res.Name, res.URL, res.Latency)
+			continue
+		}
+		result.Observe("%s (%s): %s", res.Name, res.URL, res.Error)
+		if res.Degraded {
+			// 服务可用但响应缓慢或证书即将过期，按警告处理
+			result.Alert(Finding{Title: fmt.Sprintf("%s (%s)", degradedTitles[res.Type], res.Name), Detail: res.Error})
+			continue
+		}
+		result.Alert(Finding{Title: fmt.Sprintf("%s (%s)", failureTitles[res.Type], res.Name), Detail: res.Error, Critical: true})
+	}
+	return result
+}
+
+// countLines 统计非空文本的行数
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	return len(strings.Split(s, "\n"))
+}
+
+// ExposureCheck 端口暴露检查：监听所有网卡且没有限制来源的防火墙规则的端口
+type ExposureCheck struct {
+	Report func(ctx context.Context) (*firewall.Report, error)
+}
+
+// Name 检查项名称
+func (c *ExposureCheck) Name() string { return "firewall" }
+
+// Run 执行端口暴露检查
+func (c *ExposureCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	report, err := c.Report(ctx)
+	if err != nil {
+		result.Skip("无法读取防火墙状态: %v", err)
+		return result
+	}
+	result.Observe("防火墙后端: %s，入站默认策略: %s，监听端口 %d 个",
+		strings.Join(report.Backends, ","), report.InputPolicy, len(report.Exposures))
+
+	for _, exposure := range report.Exposures {
+		if !exposure.Warn {
+			result.Filter("%s %d/%s: %s", exposure.Name, exposure.Port, exposure.Proto, exposure.Reason)
+			continue
+		}
+		result.Alert(Finding{
+			Title:  fmt.Sprintf("端口暴露 (%d/%s %s)", exposure.Port, exposure.Proto, exposure.Name),
+			Detail: exposure.Reason,
+		})
+	}
+	return result
+}
+
+// JobCheck 定时任务检查：连续失败次数达到阈值的任务
+type JobCheck struct {
+	Failing func() []*jobs.Status
+}
+
+// Name 检查项名称
+func (c *JobCheck) Name() string { return "jobs" }
+
+// Run 执行定时任务检查
+func (c *JobCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	failing := c.Failing()
+	result.Observe("连续失败的定时任务 %d 个", len(failing))
+	for _, status := range failing {
+		detail := fmt.Sprintf("连续失败 %d 次", status.ConsecutiveFailures)
+		if status.LastRun != nil && status.LastRun.Error != "" {
+			detail += "，最近一次错误: " + status.LastRun.Error
+		}
+		result.Alert(Finding{Title: fmt.Sprintf("定时任务失败 (%s)", status.Name), Detail: detail})
+	}
+	if len(failing) == 0 {
+		result.Threshold("所有定时任务运行正常")
+	}
+	return result
+}
+
+// SelfCheck qwq 自身内存检查：所在容器设置了内存限制时，RSS 达到 resources.pressure_percent 即告警
+type SelfCheck struct {
+	Sample func() selfguard.Stats
+}
+
+// Name 检查项名称
+func (c *SelfCheck) Name() string { return "self" }
+
+// Run 执行自身内存检查
+func (c *SelfCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	stats := c.Sample()
+	if stats.MemoryLimitBytes <= 0 {
+		result.Skip("未检测到内存限制")
+		return result
+	}
+	result.Observe("qwq RSS %d MB / 限制 %d MB (%.1f%%)，协程 %d 个",
+		stats.RSSBytes>>20, stats.MemoryLimitBytes>>20, stats.MemoryPercent, stats.Goroutines)
+	if !stats.Pressure {
+		result.Threshold("未达到内存紧张阈值")
+		return result
+	}
+	result.Threshold("%.1f%% 达到内存紧张阈值", stats.MemoryPercent)
+	result.Alert(Finding{
+		Title: "qwq 自身内存接近限制",
+		Detail: fmt.Sprintf("RSS %d MB，堆 %d MB，内存限制 %d MB (%.1f%%)，协程 %d 个。已收缩内存中的缓存，请调大容器内存限制或降低 resources 中的缓存上限",
+			stats.RSSBytes>>20, stats.HeapBytes>>20, stats.MemoryLimitBytes>>20, stats.MemoryPercent, stats.Goroutines),
+		Critical: true,
+	})
+	return result
+}
+
+// maxDriftDiff 告警详情中保留的 diff 长度
+const maxDriftDiff = 1500
+
+// DriftCheck 托管文件检查：生成的 nginx 配置或 compose 项目文件被手工修改且尚未处理
+type DriftCheck struct {
+	Open func() []drift.Event
+}
+
+// Name 检查项名称
+func (c *DriftCheck) Name() string { return "drift" }
+
+// Run 执行托管文件检查
+func (c *DriftCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	events := c.Open()
+	result.Observe("未处理的外部修改 %d 个", len(events))
+	for _, ev := range events {
+		detail := fmt.Sprintf("%s %s 的文件 %s 于 %s 被外部修改，qwq 将不再覆盖它，请在面板中选择保留外部修改或覆盖 (事件 #%d)",
+			ev.Kind, ev.Owner, ev.Path, ev.DetectedAt.Format("2006-01-02 15:04:05"), ev.ID)
+		if ev.Missing {
+			detail = fmt.Sprintf("%s %s 的文件 %s 于 %s 被外部删除 (事件 #%d)", ev.Kind, ev.Owner, ev.Path, ev.DetectedAt.Format("2006-01-02 15:04:05"), ev.ID)
+		} else if diff := ev.Diff; diff != "" {
+			if len(diff) > maxDriftDiff {
+				diff = diff[:maxDriftDiff] + "\n..."
+			}
+			detail += "\n" + diff
+		}
+		result.Alert(Finding{Title: fmt.Sprintf("托管文件被外部修改 (%s)", ev.Path), Detail: detail})
+	}
+	if len(events) == 0 {
+		result.Threshold("托管文件与 qwq 记录的版本一致")
+	}
+	return result
+}
+
+// AccountsCheck 主机账号审计：特权用户、sudoers 文件或 SSH 公钥相对基线发生变化时告警，
+// 第一次执行建立基线不告警，变化被接受为新基线之前每次巡检都会告警
+type AccountsCheck struct {
+	Audit func() (*hostaudit.Report, error)
+}
+
+// Name 检查项名称
+func (c *AccountsCheck) Name() string { return "security:accounts" }
+
+// Run 执行主机账号审计
+func (c *AccountsCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	report, err := c.Audit()
+	if err != nil {
+		result.Skip("无法读取主机账号: %v", err)
+		return result
+	}
+	for _, warning := range report.Warnings {
+		result.Observe("%s", warning)
+	}
+	result.Observe("特权用户 %d 个，sudoers 文件 %d 个，%d 个用户配置了 SSH 公钥",
+		len(report.Current.Privileged), len(report.Current.Sudoers), len(report.Current.Keys))
+	if report.Baselined {
+		result.Threshold("首次审计，已建立基线")
+		return result
+	}
+	for _, change := range report.Changes {
+		result.Alert(Finding{
+			Title:  change.Title(),
+			Detail: change.Detail + "。确认是正常变更后，将当前状态接受为新基线 (POST /api/host-audit/accept)",
+		})
+	}
+	if len(report.Changes) == 0 {
+		result.Threshold("与 %s 建立的基线一致", report.Baseline.TakenAt.Format("2006-01-02 15:04:05"))
+	}
+	return result
+}
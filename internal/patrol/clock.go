@@ -0,0 +1,391 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/utils"
+)
+
+const (
+	// DefaultClockWarn 时钟偏差告警阈值
+	DefaultClockWarn = 500 * time.Millisecond
+	// DefaultClockCritical 时钟偏差严重故障阈值，超过后 TLS 握手和 JWT 校验可能失败
+	DefaultClockCritical = 5 * time.Second
+	// DefaultClockEndpoint 无法读取本机时间同步状态时用于对比的 HTTP 地址
+	DefaultClockEndpoint = "https://www.cloudflare.com"
+)
+
+// 时钟偏差的测量方式
+const (
+	ClockMethodChrony    = "chrony"
+	ClockMethodTimesyncd = "timesyncd"
+	ClockMethodNTPd      = "ntpd"
+	ClockMethodHTTP      = "http"
+)
+
+// httpDateResolution HTTP Date 头只精确到秒
+const httpDateResolution = time.Second
+
+// ClockStatus 时钟偏差测量结果
+// Offset 为本地时间减去参考时间，正数表示本地时钟偏快
+type ClockStatus struct {
+	Method      string        `json:"method"`
+	Source      string        `json:"source,omitempty"` // 同步源或对比的 HTTP 地址
+	Offset      time.Duration `json:"offset"`
+	OffsetMS    float64       `json:"offset_ms"`
+	Uncertainty time.Duration `json:"uncertainty,omitempty"` // 测量误差，HTTP 对比时为 Date 头精度加半个往返时间
+	Synced      bool          `json:"synced"`                // 时间同步服务是否处于同步状态，HTTP 对比时为 false
+	Container   bool          `json:"container"`
+	Note        string        `json:"note,omitempty"`
+	MeasuredAt  time.Time     `json:"measured_at"`
+}
+
+// Describe 单行描述，用于日报和决策追踪
+func (s *ClockStatus) Describe() string {
+	text := fmt.Sprintf("%+.1fms (%s", s.OffsetMS, s.Method)
+	if s.Source != "" {
+		text += ", " + s.Source
+	}
+	text += ")"
+	if s.Uncertainty > 0 {
+		text += fmt.Sprintf(" ±%dms", s.Uncertainty.Milliseconds())
+	}
+	return text
+}
+
+var (
+	lastClockMu sync.RWMutex
+	lastClock   *ClockStatus
+)
+
+// LastClockStatus 最近一次巡检测得的时钟偏差，尚未测量时返回 nil
+func LastClockStatus() *ClockStatus {
+	lastClockMu.RLock()
+	defer lastClockMu.RUnlock()
+	return lastClock
+}
+
+// ClockProbe 时钟偏差测量
+// 依次尝试 chrony、systemd-timesyncd 和 ntpd，都不可用或运行在容器中时对比 HTTP Date 头
+type ClockProbe struct {
+	Shell       ShellFunc
+	Endpoint    string
+	Client      *http.Client
+	InContainer func() bool
+	now         func() time.Time
+}
+
+// NewClockProbe 按配置创建时钟偏差测量
+func NewClockProbe(shell ShellFunc) *ClockProbe {
+	endpoint := config.Current().Patrol.Clock.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultClockEndpoint
+	}
+	return &ClockProbe{Shell: shell, Endpoint: endpoint, InContainer: inContainer}
+}
+
+// Measure 测量时钟偏差
+func (p *ClockProbe) Measure(ctx context.Context) (*ClockStatus, error) {
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+
+	container := p.InContainer != nil && p.InContainer()
+	if !container {
+		for _, measure := range []func() *ClockStatus{p.chrony, p.timesyncd, p.ntpd} {
+			if status := measure(); status != nil {
+				status.OffsetMS = durationMS(status.Offset)
+				status.MeasuredAt = now()
+				return status, nil
+			}
+		}
+	}
+
+	status, err := p.httpDate(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	status.Container = container
+	if container {
+		status.Note = "容器环境中无法调整主机时钟，使用 HTTP Date 对比"
+	} else {
+		status.Note = "未找到 chrony/timesyncd/ntpd 状态，使用 HTTP Date 对比"
+	}
+	return status, nil
+}
+
+// chrony 解析 chronyc tracking
+func (p *ClockProbe) chrony() *ClockStatus {
+	res := p.Shell("chronyc tracking")
+	if unavailable(res) {
+		return nil
+	}
+	out := res.Stdout
+	status := &ClockStatus{Method: ClockMethodChrony}
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "Reference ID":
+			status.Source = value
+			if open, close := strings.Index(value, "("), strings.Index(value, ")"); open >= 0 && close > open {
+				status.Source = value[open+1 : close]
+			}
+		case "System time":
+			// 0.000012345 seconds fast of NTP time
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				continue
+			}
+			if fields[2] == "slow" {
+				seconds = -seconds
+			}
+			status.Offset = time.Duration(seconds * float64(time.Second))
+			found = true
+		case "Leap status":
+			status.Synced = value != "Not synchronised"
+		}
+	}
+	if !found {
+		return nil
+	}
+	return status
+}
+
+// timesyncd 解析 timedatectl timesync-status
+// timesyncd 的 Offset 为参考时间减去本地时间，取反后与其他方式保持一致
+func (p *ClockProbe) timesyncd() *ClockStatus {
+	res := p.Shell("timedatectl timesync-status")
+	if unavailable(res) {
+		return nil
+	}
+	out := res.Stdout
+	status := &ClockStatus{Method: ClockMethodTimesyncd}
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Server":
+			status.Source = strings.TrimSpace(value)
+		case "Offset":
+			offset, err := parseSystemdDuration(strings.TrimSpace(value))
+			if err != nil {
+				continue
+			}
+			status.Offset = -offset
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	status.Synced = strings.TrimSpace(p.Shell("timedatectl show -p NTPSynchronized --value").Stdout) == "yes"
+	return status
+}
+
+// ntpd 解析 ntpq -pn 中当前同步源（以 * 开头）的 offset（毫秒）
+// ntpq 的 offset 为参考时间减去本地时间，取反后与其他方式保持一致
+func (p *ClockProbe) ntpd() *ClockStatus {
+	res := p.Shell("ntpq -pn")
+	if unavailable(res) {
+		return nil
+	}
+	out := res.Stdout
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || !strings.HasPrefix(fields[0], "*") {
+			continue
+		}
+		ms, err := strconv.ParseFloat(fields[8], 64)
+		if err != nil {
+			continue
+		}
+		return &ClockStatus{
+			Method: ClockMethodNTPd,
+			Source: strings.TrimPrefix(fields[0], "*"),
+			Offset: -time.Duration(ms * float64(time.Millisecond)),
+			Synced: true,
+		}
+	}
+	return nil
+}
+
+// httpDate 对比 HTTP Date 头估算偏差
+// Date 头截断到秒，参考时间取该秒的中点，误差为半秒加半个往返时间
+func (p *ClockProbe) httpDate(ctx context.Context, now func() time.Time) (*ClockStatus, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	sent := now()
+	resp, err := client.Do(req)
+	received := now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", p.Endpoint, err)
+	}
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return nil, fmt.Errorf("%s returned no valid Date header", p.Endpoint)
+	}
+	rtt := received.Sub(sent)
+	local := sent.Add(rtt / 2)
+	reference := date.Add(httpDateResolution / 2)
+	offset := local.Sub(reference)
+	return &ClockStatus{
+		Method:      ClockMethodHTTP,
+		Source:      p.Endpoint,
+		Offset:      offset,
+		OffsetMS:    durationMS(offset),
+		Uncertainty: httpDateResolution/2 + rtt/2,
+		MeasuredAt:  received,
+	}, nil
+}
+
+// ClockCheck 时钟偏差和时间同步状态检查
+type ClockCheck struct {
+	Probe    *ClockProbe
+	Warn     time.Duration
+	Critical time.Duration
+}
+
+// NewClockCheck 按配置创建时钟偏差检查
+func NewClockCheck(shell ShellFunc) *ClockCheck {
+	cfg := config.Current().Patrol.Clock
+	check := &ClockCheck{Probe: NewClockProbe(shell), Warn: DefaultClockWarn, Critical: DefaultClockCritical}
+	if cfg.WarnMS > 0 {
+		check.Warn = time.Duration(cfg.WarnMS) * time.Millisecond
+	}
+	if cfg.CriticalMS > 0 {
+		check.Critical = time.Duration(cfg.CriticalMS) * time.Millisecond
+	}
+	return check
+}
+
+// Name 检查项名称
+func (c *ClockCheck) Name() string { return "clock" }
+
+// Run 执行时钟偏差检查
+// 偏差扣除测量误差后仍超过阈值才告警，避免 HTTP 对比的秒级精度造成误报
+func (c *ClockCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	status, err := c.Probe.Measure(ctx)
+	if err != nil {
+		result.Skip("无法测量时钟偏差: %v", err)
+		return result
+	}
+	lastClockMu.Lock()
+	lastClock = status
+	lastClockMu.Unlock()
+
+	result.Observe("时钟偏差 %s，同步状态: %v", status.Describe(), status.Synced)
+	if status.Note != "" {
+		result.Observe("%s", status.Note)
+	}
+
+	skew := status.Offset
+	if skew < 0 {
+		skew = -skew
+	}
+	skew -= status.Uncertainty
+	detail := fmt.Sprintf("本地时钟偏差 %s", status.Describe())
+	switch {
+	case skew > c.Critical:
+		result.Threshold("|偏差| %v > %v", skew.Round(time.Millisecond), c.Critical)
+		result.Alert(Finding{Title: "时钟严重偏差", Detail: detail, Critical: true})
+	case skew > c.Warn:
+		result.Threshold("|偏差| %v > %v", skew.Round(time.Millisecond), c.Warn)
+		result.Alert(Finding{Title: "时钟偏差", Detail: detail})
+	default:
+		result.Threshold("|偏差| %v <= %v", maxDuration(skew, 0).Round(time.Millisecond), c.Warn)
+	}
+	if !status.Synced && status.Method != ClockMethodHTTP {
+		result.Observe("%s 未处于同步状态", status.Method)
+	}
+	return result
+}
+
+// unavailable 判断时间同步工具是否不可用（未安装、服务未运行或没有输出）
+func unavailable(res *utils.ShellResult) bool {
+	if res == nil || !res.OK() || strings.TrimSpace(res.Stdout) == "" {
+		return true
+	}
+	out := res.Stdout + res.Stderr
+	return strings.Contains(out, "not found") || strings.Contains(out, "Cannot talk to chronyd") || strings.Contains(out, "Failed to")
+}
+
+// parseSystemdDuration 解析 systemd 格式的时长，如 "-2.163ms"、"+4min 0.5s"
+func parseSystemdDuration(value string) (time.Duration, error) {
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimLeft(value, "+-")
+	var total time.Duration
+	for _, part := range strings.Fields(value) {
+		part = strings.Replace(part, "min", "m", 1)
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
+
+// inContainer 判断是否运行在容器中
+func inContainer() bool {
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	data, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, marker := range []string{"docker", "kubepods", "containerd", "lxc"} {
+		if strings.Contains(string(data), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func durationMS(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*10) / 10
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
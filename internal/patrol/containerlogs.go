@@ -0,0 +1,179 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"qwq/internal/config"
+	"qwq/internal/container"
+)
+
+const (
+	// DefaultContainerLogMaxMB 单个容器当前日志文件的告警大小（MB）
+	DefaultContainerLogMaxMB = 1024
+	// DefaultContainerLogGrowthMB 日志自上次巡检增长的告警阈值（MB）
+	DefaultContainerLogGrowthMB = 500
+)
+
+// maxListedLogs 告警中列出的容器数
+const maxListedLogs = 10
+
+// ContainerLogs 扫描容器日志文件，由 Web 和巡检模式启动时注入（需要 Docker 和项目信息）
+// 未注入时巡检不包含容器日志检查
+var ContainerLogs func(ctx context.Context) ([]container.LogFile, error)
+
+// logSizeHistory 上次巡检时各容器的日志大小，DefaultChecks 每次重新创建检查项，增长量需要跨巡检保存
+type logSizeHistory struct {
+	mu    sync.Mutex
+	sizes map[string]int64
+}
+
+// swap 记录本次大小并返回上次的大小，已删除容器的记录随之丢弃
+func (h *logSizeHistory) swap(files []container.LogFile) map[string]int64 {
+	current := make(map[string]int64, len(files))
+	for _, file := range files {
+		current[file.ContainerID] = file.Size
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	previous := h.sizes
+	h.sizes = current
+	return previous
+}
+
+var lastLogSizes = &logSizeHistory{}
+
+// ContainerLogCheck 容器日志检查：当前日志文件超过上限，或自上次巡检增长过快
+type ContainerLogCheck struct {
+	Scan     func(ctx context.Context) ([]container.LogFile, error)
+	MaxMB    int                   // 0 表示 DefaultContainerLogMaxMB
+	GrowthMB int                   // 0 表示 DefaultContainerLogGrowthMB
+	Rotation container.LogRotation // 修复建议中的轮转参数，空值表示 container.DefaultLogRotation
+	history  *logSizeHistory       // 为空时使用跨巡检共享的记录
+}
+
+// NewContainerLogCheck 按当前配置创建容器日志检查
+func NewContainerLogCheck(scan func(ctx context.Context) ([]container.LogFile, error)) *ContainerLogCheck {
+	cfg := config.Current().Patrol.ContainerLogs
+	rotation := container.DefaultLogRotation
+	if cfg.RotateMaxSize != "" {
+		rotation.MaxSize = cfg.RotateMaxSize
+	}
+	if cfg.RotateMaxFile > 0 {
+		rotation.MaxFile = cfg.RotateMaxFile
+	}
+	return &ContainerLogCheck{Scan: scan, MaxMB: cfg.MaxSizeMB, GrowthMB: cfg.GrowthMB, Rotation: rotation}
+}
+
+// Name 检查项名称
+func (c *ContainerLogCheck) Name() string { return "container_logs" }
+
+// Run 执行容器日志检查
+func (c *ContainerLogCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	files, err := c.Scan(ctx)
+	if err != nil {
+		result.Skip("无法读取容器日志: %v", err)
+		return result
+	}
+	history := c.history
+	if history == nil {
+		history = lastLogSizes
+	}
+	previous := history.swap(files)
+
+	maxMB, growthMB := c.MaxMB, c.GrowthMB
+	if maxMB <= 0 {
+		maxMB = DefaultContainerLogMaxMB
+	}
+	if growthMB <= 0 {
+		growthMB = DefaultContainerLogGrowthMB
+	}
+	maxBytes, growthBytes := int64(maxMB)<<20, int64(growthMB)<<20
+
+	var total int64
+	var lines []string
+	var managed []container.LogFile
+	for _, file := range files {
+		total += file.Size
+		last, seen := previous[file.ContainerID]
+		growth := file.Size - last
+		oversized := file.Size > maxBytes
+		growing := seen && growth > growthBytes
+		if !oversized && !growing {
+			continue
+		}
+		line := fmt.Sprintf("- %s：%s", containerLabel(file), formatBytes(file.Size))
+		if seen && growth > 0 {
+			line += fmt.Sprintf("，较上次巡检 +%s", formatBytes(growth))
+		}
+		if file.MaxSize == "" {
+			line += "，未配置 max-size"
+		} else {
+			line += "，max-size " + file.MaxSize
+		}
+		lines = append(lines, line)
+		if file.Managed() {
+			managed = append(managed, file)
+		}
+	}
+	result.Observe("容器日志 %d 个，合计 %s", len(files), formatBytes(total))
+	if len(lines) == 0 {
+		result.Threshold("所有容器日志 ≤ %dMB 且增长 ≤ %dMB", maxMB, growthMB)
+		return result
+	}
+	result.Threshold("%d 个容器日志 > %dMB 或增长 > %dMB", len(lines), maxMB, growthMB)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d 个容器的日志超过 %dMB 或自上次巡检增长超过 %dMB：\n", len(lines), maxMB, growthMB)
+	for i, line := range lines {
+		if i == maxListedLogs {
+			fmt.Fprintf(&b, "- ……另有 %d 个\n", len(lines)-maxListedLogs)
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n在 compose 服务定义中加入日志轮转，重新创建容器后生效：\n```yaml\n")
+	b.WriteString(c.rotation().Snippet())
+	b.WriteString("```\n")
+	if len(managed) > 0 {
+		b.WriteString("\nqwq 管理的项目可一键写入新修订（请求体加 \"truncate\": true 和 \"confirm\": \"<服务名>\" 会在保存快照后清空当前日志，不会自动执行）：\n")
+		for _, file := range managed {
+			fmt.Fprintf(&b, "- POST /api/compose/%d/services/%s/log-rotation\n", file.ProjectID, file.Service)
+		}
+	}
+	result.Alert(Finding{Title: "容器日志过大", Detail: strings.TrimRight(b.String(), "\n")})
+	return result
+}
+
+// rotation 修复建议使用的轮转参数
+func (c *ContainerLogCheck) rotation() container.LogRotation {
+	if c.Rotation.MaxSize == "" {
+		return container.DefaultLogRotation
+	}
+	return c.Rotation
+}
+
+// containerLabel 告警中的容器名称，属于 Compose 项目时附带项目和服务
+func containerLabel(file container.LogFile) string {
+	if file.Project != "" && file.Service != "" {
+		return fmt.Sprintf("%s (%s/%s)", file.Name, file.Project, file.Service)
+	}
+	return file.Name
+}
+
+// formatBytes 以 KB/MB/GB 显示字节数
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
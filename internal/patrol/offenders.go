@@ -0,0 +1,153 @@
+package patrol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"qwq/internal/config"
+	"qwq/internal/metrics"
+)
+
+const (
+	// DefaultTopProcesses 负载或内存告警时按 CPU 和按 RSS 各列出的进程数
+	DefaultTopProcesses = 5
+	// DefaultTopProcessesChars 进程列表的默认最大字符数，保证告警消息不超过钉钉 Markdown 的 20000 字符上限
+	DefaultTopProcessesChars = 2000
+)
+
+// Process ps 输出中的一个进程
+type Process struct {
+	PID     int
+	User    string
+	CPU     float64 // %CPU
+	Mem     float64 // %MEM
+	RSSKB   uint64
+	Command string
+}
+
+// TopOffenders 采集 CPU 和内存（RSS）占用最高的进程，通过 Shell 执行 ps，本机和远程主机相同
+type TopOffenders struct {
+	Shell    ShellFunc
+	Count    int // 每个列表的进程数，<=0 时使用 DefaultTopProcesses
+	MaxChars int // 输出的最大字符数，<=0 时使用 DefaultTopProcessesChars
+}
+
+// NewTopOffenders 按 patrol.top_processes 配置创建，配置为关闭时返回 nil
+func NewTopOffenders(shell ShellFunc) *TopOffenders {
+	cfg := config.Current().Patrol.TopProcesses
+	if cfg.Disabled {
+		return nil
+	}
+	return &TopOffenders{Shell: shell, Count: cfg.Count, MaxChars: cfg.MaxChars}
+}
+
+func (t *TopOffenders) count() int {
+	if t.Count > 0 {
+		return t.Count
+	}
+	return DefaultTopProcesses
+}
+
+func (t *TopOffenders) maxChars() int {
+	if t.MaxChars > 0 {
+		return t.MaxChars
+	}
+	return DefaultTopProcessesChars
+}
+
+// topCommand 按 key 降序列出前 n 个进程，不输出标题行
+func topCommand(key string, n int) string {
+	return fmt.Sprintf("ps -eo pid=,user=,pcpu=,pmem=,rss=,comm= --sort=-%s | head -n %d", key, n)
+}
+
+// Top 按 CPU 和按 RSS 排序的进程，ps 执行失败（如不支持 --sort 的平台）时对应列表为空
+func (t *TopOffenders) Top(result *CheckResult) (byCPU, byRSS []Process) {
+	n := t.count()
+	byCPU = parseProcesses(runShell(result, t.Shell, topCommand("pcpu", n)).Stdout)
+	byRSS = parseProcesses(runShell(result, t.Shell, topCommand("rss", n)).Stdout)
+	return byCPU, byRSS
+}
+
+// parseProcesses 解析 ps -eo pid=,user=,pcpu=,pmem=,rss=,comm= 的输出，命令名中可以有空格
+func parseProcesses(out string) []Process {
+	var processes []Process
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		cpu, _ := strconv.ParseFloat(fields[2], 64)
+		mem, _ := strconv.ParseFloat(fields[3], 64)
+		rss, _ := strconv.ParseUint(fields[4], 10, 64)
+		processes = append(processes, Process{PID: pid, User: fields[1], CPU: cpu, Mem: mem, RSSKB: rss, Command: strings.Join(fields[5:], " ")})
+	}
+	return processes
+}
+
+// Table 附加在异常详情中的进程表，超出字符上限时截断并注明
+func (t *TopOffenders) Table(result *CheckResult) string {
+	byCPU, byRSS := t.Top(result)
+	if len(byCPU) == 0 && len(byRSS) == 0 {
+		result.Observe("无法获取进程列表")
+		return ""
+	}
+	result.Observe("采集 CPU 占用最高的 %d 个进程、内存占用最高的 %d 个进程", len(byCPU), len(byRSS))
+
+	var b strings.Builder
+	for _, section := range []struct {
+		title     string
+		processes []Process
+	}{{"CPU", byCPU}, {"RSS", byRSS}} {
+		if len(section.processes) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "Top %d by %s:\n%7s %-10s %5s %5s %7s %s\n", len(section.processes), section.title, "PID", "USER", "%CPU", "%MEM", "RSS", "COMMAND")
+		for _, p := range section.processes {
+			fmt.Fprintf(&b, "%7d %-10s %5.1f %5.1f %7s %s\n", p.PID, p.User, p.CPU, p.Mem, metrics.HumanSize(p.RSSKB*1024), p.Command)
+		}
+	}
+	return truncateBudget(strings.TrimSuffix(b.String(), "\n"), t.maxChars())
+}
+
+// Summary 日报中的紧凑进程列表，每个排序一行，如 "**CPU**: java 85.0%、nginx 3.2%"
+func (t *TopOffenders) Summary() string {
+	result := NewCheckResult("top")
+	byCPU, byRSS := t.Top(result)
+	var lines []string
+	if len(byCPU) > 0 {
+		parts := make([]string, 0, len(byCPU))
+		for _, p := range byCPU {
+			parts = append(parts, fmt.Sprintf("%s(%d) %.1f%%", p.Command, p.PID, p.CPU))
+		}
+		lines = append(lines, "**CPU**: "+strings.Join(parts, "、"))
+	}
+	if len(byRSS) > 0 {
+		parts := make([]string, 0, len(byRSS))
+		for _, p := range byRSS {
+			parts = append(parts, fmt.Sprintf("%s(%d) %s", p.Command, p.PID, metrics.HumanSize(p.RSSKB*1024)))
+		}
+		lines = append(lines, "**内存**: "+strings.Join(parts, "、"))
+	}
+	return truncateBudget(strings.Join(lines, "  \n"), t.maxChars())
+}
+
+// truncateBudget 超过 max 个字符时在行边界截断并注明省略的字符数
+func truncateBudget(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	kept := string(runes[:max])
+	if i := strings.LastIndex(kept, "\n"); i > 0 {
+		kept = kept[:i]
+	}
+	return fmt.Sprintf("%s\n...(进程列表已截断，省略 %d 个字符)", kept, len(runes)-len([]rune(kept)))
+}
@@ -0,0 +1,237 @@
+// Package patrol 提供系统巡检能力
+// 每个检查项返回结构化结果和决策追踪，便于解释"为什么告警 / 为什么没有告警"
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"qwq/internal/notify"
+	"qwq/internal/utils"
+)
+
+// Verdict 检查结论
+type Verdict string
+
+const (
+	VerdictOK      Verdict = "ok"      // 正常
+	VerdictAlert   Verdict = "alert"   // 触发告警
+	VerdictSkipped Verdict = "skipped" // 数据不可用，跳过判断
+	VerdictTimeout Verdict = "timeout" // 检查超时
+)
+
+// TraceKind 决策追踪步骤类型
+type TraceKind string
+
+const (
+	TraceObserved  TraceKind = "observed"  // 观察到的原始数据
+	TraceFilter    TraceKind = "filter"    // 应用的过滤规则
+	TraceThreshold TraceKind = "threshold" // 阈值比较
+	TraceVerdict   TraceKind = "verdict"   // 最终结论
+)
+
+// ShellFunc 执行 Shell 命令并返回结构化结果，便于在测试中替换
+type ShellFunc func(cmd string) *utils.ShellResult
+
+// PatrolCheck 巡检检查项接口
+type PatrolCheck interface {
+	// Name 检查项名称
+	Name() string
+	// Run 执行检查并返回结构化结果
+	Run(ctx context.Context) *CheckResult
+}
+
+// TimeoutOverrider 可选接口，检查项需要不同于默认值的超时时间时实现
+type TimeoutOverrider interface {
+	// Timeout 返回该检查项的超时时间，0 表示使用默认值
+	Timeout() time.Duration
+}
+
+// TraceStep 决策追踪中的一步
+type TraceStep struct {
+	Kind   TraceKind `json:"kind"`
+	Detail string    `json:"detail"`
+}
+
+// Finding 检查发现的异常
+type Finding struct {
+	Title  string `json:"title"`  // 异常标题，如 "磁盘告警 (/dev/sda1)"
+	Detail string `json:"detail"` // 异常详情
+	Fenced bool   `json:"fenced"` // 详情是否以代码块形式展示
+	// Critical 该异常属于严重故障，用于同一检查项按程度区分警告和严重故障（如时钟偏差）
+	Critical bool `json:"critical,omitempty"`
+	// Fingerprint 告警指纹（主机、检查项和标题的哈希），同一异常在多次巡检之间不变
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Deliveries 推送到外部告警系统（Alertmanager、PagerDuty）的结果
+	Deliveries []notify.Delivery `json:"deliveries,omitempty"`
+	// Cooldown 冷却时间内已推送过且严重程度未升高，本轮没有推送到通知渠道
+	Cooldown bool `json:"cooldown,omitempty"`
+	// Host 发现异常的远程主机，本机的异常为空
+	Host string `json:"host,omitempty"`
+}
+
+// Label 带主机名的异常标题，如 "[web-1] 磁盘告警 (/dev/sda1)"，本机的异常只有标题
+func (f Finding) Label() string {
+	if f.Host == "" {
+		return f.Title
+	}
+	return fmt.Sprintf("[%s] %s", f.Host, f.Title)
+}
+
+// Markdown 将异常渲染为告警消息中的 Markdown 片段
+func (f Finding) Markdown() string {
+	if f.Fenced {
+		return fmt.Sprintf("**%s**:\n```\n%s\n```", f.Label(), f.Detail)
+	}
+	return fmt.Sprintf("**%s**:\n%s", f.Label(), f.Detail)
+}
+
+// CheckResult 单个检查项的结构化结果
+type CheckResult struct {
+	Check    string        `json:"check"`
+	Verdict  Verdict       `json:"verdict"`
+	Findings []Finding     `json:"findings,omitempty"`
+	Trace    []TraceStep   `json:"trace"`
+	Duration time.Duration `json:"duration"`
+	// DurationMS 检查耗时（毫秒），便于面板中定位慢检查项
+	DurationMS int64 `json:"duration_ms"`
+	// Route 告警命中的通知路由规则
+	Route string `json:"route,omitempty"`
+	// Maintenance 异常发生在维护期间时记录所在的维护窗口，通知已静默
+	Maintenance string `json:"maintenance,omitempty"`
+	// Host 检查的远程主机，本机的检查为空
+	Host string `json:"host,omitempty"`
+}
+
+// CriticalChecks 异常属于严重故障的检查项，其余检查项的异常按警告处理
+var CriticalChecks = map[string]bool{"oom": true}
+
+// Critical 检查项是否发现了严重故障
+func (r *CheckResult) Critical() bool {
+	if r.Verdict != VerdictAlert {
+		return false
+	}
+	if CriticalChecks[r.Check] {
+		return true
+	}
+	for _, finding := range r.Findings {
+		if finding.Critical {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCheckResult 创建检查结果
+func NewCheckResult(check string) *CheckResult {
+	return &CheckResult{Check: check, Verdict: VerdictOK}
+}
+
+// Observe 记录观察到的原始数据
+func (r *CheckResult) Observe(format string, v ...interface{}) {
+	r.addTrace(TraceObserved, format, v...)
+}
+
+// Filter 记录过滤规则的命中情况
+func (r *CheckResult) Filter(format string, v ...interface{}) {
+	r.addTrace(TraceFilter, format, v...)
+}
+
+// Threshold 记录阈值比较过程
+func (r *CheckResult) Threshold(format string, v ...interface{}) {
+	r.addTrace(TraceThreshold, format, v...)
+}
+
+// Alert 记录一条异常，结论变为告警
+func (r *CheckResult) Alert(finding Finding) {
+	r.Findings = append(r.Findings, finding)
+	r.Verdict = VerdictAlert
+}
+
+// Skip 标记检查被跳过
+func (r *CheckResult) Skip(format string, v ...interface{}) {
+	r.Verdict = VerdictSkipped
+	r.addTrace(TraceVerdict, format, v...)
+}
+
+// finish 追加最终结论
+func (r *CheckResult) finish() {
+	if len(r.Trace) > 0 && r.Trace[len(r.Trace)-1].Kind == TraceVerdict {
+		return
+	}
+	switch r.Verdict {
+	case VerdictTimeout:
+		r.addTrace(TraceVerdict, "超时")
+	case VerdictAlert:
+		r.addTrace(TraceVerdict, "告警：%d 项异常", len(r.Findings))
+	default:
+		r.addTrace(TraceVerdict, "正常")
+	}
+}
+
+func (r *CheckResult) addTrace(kind TraceKind, format string, v ...interface{}) {
+	r.Trace = append(r.Trace, TraceStep{Kind: kind, Detail: fmt.Sprintf(format, v...)})
+}
+
+// Run 一次巡检记录
+type Run struct {
+	ID         int64          `json:"id"`
+	Trigger    string         `json:"trigger"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Results    []*CheckResult `json:"results"`
+	Anomalies  int            `json:"anomalies"`
+	Report     string         `json:"report,omitempty"`
+	Analysis   string         `json:"analysis,omitempty"`
+	Condensed  []string       `json:"condensed,omitempty"` // 超出分析预算、压缩后才发送给 AI 的异常标题
+	Notified   bool           `json:"notified"`
+	// Resolved 本轮已恢复、向外部告警系统发送了恢复通知的异常
+	Resolved []ResolvedAlert `json:"resolved,omitempty"`
+}
+
+// ResolvedAlert 已恢复的异常及恢复通知的推送结果
+type ResolvedAlert struct {
+	Fingerprint string            `json:"fingerprint"`
+	Check       string            `json:"check"`
+	Title       string            `json:"title"`
+	Deliveries  []notify.Delivery `json:"deliveries,omitempty"`
+}
+
+// cooledDown 是否有异常因处于冷却时间内而没有推送
+func (run *Run) cooledDown() bool {
+	for _, finding := range run.Findings() {
+		if finding.Cooldown {
+			return true
+		}
+	}
+	return false
+}
+
+// Findings 返回所有检查项的异常
+func (run *Run) Findings() []Finding {
+	var findings []Finding
+	for _, result := range run.Results {
+		findings = append(findings, result.Findings...)
+	}
+	return findings
+}
+
+// FormatTrace 将决策追踪格式化为纯文本
+// 可直接附加到事件记录中，供运维人员对巡检决策提出异议时参考
+func (run *Run) FormatTrace() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Patrol run #%d (%s) %s\n", run.ID, run.Trigger, run.StartedAt.Format("2006-01-02 15:04:05")))
+	for _, result := range run.Results {
+		name := result.Check
+		if result.Host != "" {
+			name += "@" + result.Host
+		}
+		builder.WriteString(fmt.Sprintf("\n[%s] %s (%v)\n", result.Verdict, name, result.Duration.Round(time.Millisecond)))
+		for _, step := range result.Trace {
+			builder.WriteString(fmt.Sprintf("  %-9s %s\n", step.Kind, step.Detail))
+		}
+	}
+	return builder.String()
+}
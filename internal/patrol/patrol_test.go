@@ -0,0 +1,1012 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/backup"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/drift"
+	"qwq/internal/hostaudit"
+	"qwq/internal/jobs"
+	"qwq/internal/notify"
+	"qwq/internal/remote"
+	"qwq/internal/selfguard"
+	"qwq/internal/utils"
+	"qwq/internal/website"
+)
+
+const testDFOutput = `Filesystem      Size  Used Avail Use% Mounted on
+/dev/sda1        50G   46G  4.0G  91% /
+/dev/loop0       56M   56M     0 100% /snap/core18/2128
+tmpfs           2.0G     0  2.0G   0% /dev/shm
+/dev/sdb1       100G   20G   80G  20% /data
+`
+
+// fakeShell 根据命令前缀返回预设的 stdout
+func fakeShell(outputs map[string]string) ShellFunc {
+	results := make(map[string]*utils.ShellResult, len(outputs))
+	for prefix, out := range outputs {
+		results[prefix] = &utils.ShellResult{Stdout: out}
+	}
+	return fakeResults(results)
+}
+
+// fakeResults 根据命令前缀返回预设的执行结果
+func fakeResults(results map[string]*utils.ShellResult) ShellFunc {
+	return func(cmd string) *utils.ShellResult {
+		for prefix, res := range results {
+			if strings.HasPrefix(cmd, prefix) {
+				copied := *res
+				copied.Command = cmd
+				return &copied
+			}
+		}
+		return &utils.ShellResult{Command: cmd}
+	}
+}
+
+func hasTrace(result *CheckResult, kind TraceKind, substr string) bool {
+	for _, step := range result.Trace {
+		if step.Kind == kind && strings.Contains(step.Detail, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDiskCheck_Trace(t *testing.T) {
+	check := &DiskCheck{Shell: fakeShell(map[string]string{"df": testDFOutput}), Threshold: 85}
+	result := check.Run(context.Background())
+
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 {
+		t.Fatalf("Expected 1 alert finding, got verdict=%s findings=%d", result.Verdict, len(result.Findings))
+	}
+	if result.Findings[0].Title != "磁盘告警 (/dev/sda1)" {
+		t.Errorf("Unexpected finding: %s", result.Findings[0].Title)
+	}
+
+	checks := []struct {
+		kind   TraceKind
+		substr string
+	}{
+		{TraceFilter, "line skipped: matched /dev/loop"},
+		{TraceFilter, "matched tmpfs"},
+		{TraceThreshold, "/dev/sda1 (/): 91% > 85%"},
+		{TraceThreshold, "/dev/sdb1 (/data): 20% <= 85%"},
+	}
+	for _, c := range checks {
+		if !hasTrace(result, c.kind, c.substr) {
+			t.Errorf("Expected %s trace containing %q, got %+v", c.kind, c.substr, result.Trace)
+		}
+	}
+}
+
+func TestChecks_EvaluateStdoutOnly(t *testing.T) {
+	// df 因无权限的挂载点退出码非零，stdout 中的其余行仍然参与判断
+	disk := &DiskCheck{Shell: fakeResults(map[string]*utils.ShellResult{
+		"df": {Stdout: testDFOutput, Stderr: "df: /mnt/secret: Permission denied\n", ExitCode: 1, Err: "exit status 1"},
+	}), Threshold: 85}
+	result := disk.Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 {
+		t.Fatalf("Expected disk alert from stdout, got verdict=%s findings=%d", result.Verdict, len(result.Findings))
+	}
+	if !hasTrace(result, TraceObserved, "退出码 1") || !hasTrace(result, TraceObserved, "stderr: df: /mnt/secret: Permission denied") {
+		t.Errorf("Expected exit code and stderr in trace, got %+v", result.Trace)
+	}
+
+	// 规则命令只在 stderr 中输出警告时不视为命中
+	rule := &RuleCheck{
+		Shell: fakeResults(map[string]*utils.ShellResult{"check": {Stderr: "warning: deprecated flag\n"}}),
+		Rule:  config.PatrolRule{Name: "custom", Command: "check"},
+	}
+	result = rule.Run(context.Background())
+	if result.Verdict != VerdictOK || !hasTrace(result, TraceObserved, "stderr: warning: deprecated flag") {
+		t.Errorf("Expected stderr-only output to be traced without alerting, got %s %+v", result.Verdict, result.Trace)
+	}
+
+	// 非零退出的规则命令输出被忽略
+	rule.Shell = fakeResults(map[string]*utils.ShellResult{"check": {Stdout: "partial\n", ExitCode: 2, Err: "exit status 2"}})
+	result = rule.Run(context.Background())
+	if result.Verdict != VerdictOK || !hasTrace(result, TraceFilter, "command exited with status 2") {
+		t.Errorf("Expected failed command output to be ignored, got %s %+v", result.Verdict, result.Trace)
+	}
+}
+
+func TestLoadCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		verdict Verdict
+	}{
+		{"high load", " 5.12, 3.00, 2.00", VerdictAlert},
+		{"normal load", " 0.50, 0.40, 0.30", VerdictOK},
+		{"no data", "", VerdictSkipped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &LoadCheck{Shell: fakeShell(map[string]string{"uptime": tt.output}), Threshold: 4.0}
+			if got := check.Run(context.Background()).Verdict; got != tt.verdict {
+				t.Errorf("Expected %s, got %s", tt.verdict, got)
+			}
+		})
+	}
+}
+
+const testPSOutput = `   1201 mysql       85.0 31.2 2621440 mysqld
+    880 www-data     3.2  1.1   90112 php-fpm: pool www
+`
+
+const testMeminfo = `MemTotal:        8000000 kB
+MemFree:          200000 kB
+MemAvailable:     400000 kB
+Buffers:           10000 kB
+Cached:           150000 kB
+`
+
+func TestLoadCheck_AttachesTopOffenders(t *testing.T) {
+	shell := fakeShell(map[string]string{"uptime": " 5.12, 3.00, 2.00", "ps": testPSOutput})
+	check := &LoadCheck{Shell: shell, Threshold: 4.0, Offenders: &TopOffenders{Shell: shell}}
+	result := check.Run(context.Background())
+	if result.Verdict != VerdictAlert {
+		t.Fatalf("Expected alert, got %s", result.Verdict)
+	}
+	detail := result.Findings[0].Detail
+	for _, want := range []string{"5.12, 3.00, 2.00", "Top 2 by CPU:", "Top 2 by RSS:", "mysqld", "2.5G", "php-fpm: pool www"} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("Expected detail to contain %q, got %s", want, detail)
+		}
+	}
+
+	// ps 失败时只保留负载数据
+	shell = fakeShell(map[string]string{"uptime": " 5.12, 3.00, 2.00"})
+	check = &LoadCheck{Shell: shell, Threshold: 4.0, Offenders: &TopOffenders{Shell: shell}}
+	if detail := check.Run(context.Background()).Findings[0].Detail; detail != "5.12, 3.00, 2.00" {
+		t.Errorf("Expected only the load average without processes, got %q", detail)
+	}
+}
+
+func TestMemoryCheck(t *testing.T) {
+	shell := fakeShell(map[string]string{"cat /proc/meminfo": testMeminfo, "ps": testPSOutput})
+	result := (&MemoryCheck{Shell: shell, Threshold: 90, Offenders: &TopOffenders{Shell: shell}}).Run(context.Background())
+	if result.Verdict != VerdictAlert || result.Findings[0].Title != "内存告警" || !strings.Contains(result.Findings[0].Detail, "mysqld") {
+		t.Fatalf("Expected a memory alert with the top processes, got %s %+v", result.Verdict, result.Findings)
+	}
+	if result := (&MemoryCheck{Shell: shell, Threshold: 99}).Run(context.Background()); result.Verdict != VerdictOK {
+		t.Errorf("Expected OK below the threshold, got %s", result.Verdict)
+	}
+	if result := (&MemoryCheck{Shell: fakeShell(nil), Threshold: 90}).Run(context.Background()); result.Verdict != VerdictSkipped {
+		t.Errorf("Expected skipped without meminfo, got %s", result.Verdict)
+	}
+}
+
+func TestTopOffenders_Budget(t *testing.T) {
+	var out strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&out, "%d root 10.0 1.0 1024 worker-with-a-long-command-name-%d\n", 1000+i, i)
+	}
+	offenders := &TopOffenders{Shell: fakeShell(map[string]string{"ps": out.String()}), Count: 50, MaxChars: 500}
+	table := offenders.Table(NewCheckResult("load"))
+	if n := len([]rune(table)); n > 600 || !strings.Contains(table, "进程列表已截断") {
+		t.Errorf("Expected the table to be truncated to the budget with a note, got %d chars: %s", n, table)
+	}
+	if summary := offenders.Summary(); len([]rune(summary)) > 600 || !strings.Contains(summary, "进程列表已截断") {
+		t.Errorf("Expected the summary to be truncated, got %s", summary)
+	}
+	if summary := (&TopOffenders{Shell: fakeShell(map[string]string{"ps": testPSOutput})}).Summary(); !strings.Contains(summary, "**CPU**: mysqld(1201) 85.0%") || !strings.Contains(summary, "**内存**: mysqld(1201) 2.5G") {
+		t.Errorf("Unexpected summary %s", summary)
+	}
+}
+
+func TestDefaultChecks_ConfiguredThresholds(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+
+	thresholds := func() (int, float64) {
+		var disk int
+		var load float64
+		for _, check := range DefaultChecks(fakeShell(nil)) {
+			switch c := check.(type) {
+			case *DiskCheck:
+				disk = c.Threshold
+			case *LoadCheck:
+				load = c.Threshold
+			}
+		}
+		return disk, load
+	}
+
+	config.Update(func(cfg *config.Config) { cfg.Patrol.DiskThreshold, cfg.Patrol.LoadThreshold = 0, 0 })
+	if disk, load := thresholds(); disk != DefaultDiskThreshold || load != DefaultLoadThreshold {
+		t.Errorf("Expected default thresholds, got %d %v", disk, load)
+	}
+	config.Update(func(cfg *config.Config) { cfg.Patrol.DiskThreshold, cfg.Patrol.LoadThreshold = 90, 8 })
+	if disk, load := thresholds(); disk != 90 || load != 8 {
+		t.Errorf("Expected configured thresholds, got %d %v", disk, load)
+	}
+}
+
+func TestRunner_DropsVirtualDeviceFindings(t *testing.T) {
+	rule := &RuleCheck{
+		Shell: fakeShell(map[string]string{"check": "overlay 100% /var/lib/docker"}),
+		Rule:  config.PatrolRule{Name: "custom", Command: "check"},
+	}
+	run := NewRunner([]PatrolCheck{rule}).Run(context.Background(), "test")
+
+	if run.Anomalies != 0 || run.Report != "" {
+		t.Errorf("Expected virtual device finding to be dropped, got %d anomalies", run.Anomalies)
+	}
+	result := run.Results[0]
+	if result.Verdict != VerdictOK || !hasTrace(result, TraceFilter, "matched overlay") {
+		t.Errorf("Expected drop to be traced, got %+v", result.Trace)
+	}
+	if last := result.Trace[len(result.Trace)-1]; last.Kind != TraceVerdict {
+		t.Errorf("Expected trace to end with verdict, got %s", last.Kind)
+	}
+}
+
+func TestStore_ListAndGet(t *testing.T) {
+	store := NewStore(2)
+	for i := 0; i < 3; i++ {
+		store.Save(&Run{Trigger: "test"})
+	}
+
+	runs := store.List(0)
+	if len(runs) != 2 || runs[0].ID != 3 || runs[1].ID != 2 {
+		t.Fatalf("Expected runs 3,2, got %d runs", len(runs))
+	}
+	if _, ok := store.Get(1); ok {
+		t.Error("Expected oldest run to be evicted")
+	}
+	if run, ok := store.Get(3); !ok || run.ID != 3 {
+		t.Error("Expected to find run 3")
+	}
+}
+
+func TestStore_LoadAndFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.json")
+	store := NewStore(5)
+	if err := store.Load(path); err != nil {
+		t.Fatalf("Expected missing file to be ignored, got %v", err)
+	}
+	store.Save(&Run{Trigger: "test", Anomalies: 1})
+	store.Save(&Run{Trigger: "test"})
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	reloaded := NewStore(5)
+	if err := reloaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if run, ok := reloaded.Get(1); !ok || run.Anomalies != 1 {
+		t.Fatalf("Expected run 1 to be restored, got %+v", run)
+	}
+	reloaded.Save(&Run{Trigger: "test"})
+	if runs := reloaded.List(1); runs[0].ID != 3 {
+		t.Errorf("Expected IDs to continue after reload, got %d", runs[0].ID)
+	}
+}
+
+// panicCheck 模拟有缺陷的巡检规则
+type panicCheck struct{}
+
+func (panicCheck) Name() string                         { return "broken" }
+func (panicCheck) Run(ctx context.Context) *CheckResult { panic("bad rule") }
+
+func TestRunner_RecoversPanickingCheck(t *testing.T) {
+	load := &LoadCheck{Shell: fakeShell(map[string]string{"uptime": " 5.12, 3.00, 2.00"}), Threshold: 4.0}
+	run := NewRunner([]PatrolCheck{panicCheck{}, load}).Run(context.Background(), "test")
+
+	if len(run.Results) != 2 {
+		t.Fatalf("Expected both checks to produce results, got %d", len(run.Results))
+	}
+	if broken := run.Results[0]; broken.Verdict != VerdictSkipped || !hasTrace(broken, TraceVerdict, "bad rule") {
+		t.Errorf("Expected panicking check to be skipped, got %+v", broken)
+	}
+	if run.Results[1].Verdict != VerdictAlert || run.Anomalies != 1 {
+		t.Errorf("Expected remaining checks to keep running, got %d anomalies", run.Anomalies)
+	}
+}
+
+// sleepCheck 模拟耗时的检查项
+type sleepCheck struct {
+	name    string
+	delay   time.Duration
+	timeout time.Duration
+}
+
+func (c sleepCheck) Name() string           { return c.name }
+func (c sleepCheck) Timeout() time.Duration { return c.timeout }
+func (c sleepCheck) Run(ctx context.Context) *CheckResult {
+	time.Sleep(c.delay)
+	return NewCheckResult(c.name)
+}
+
+func TestRunner_ConcurrentOrderedWithTimeouts(t *testing.T) {
+	checks := []PatrolCheck{
+		sleepCheck{name: "slow", delay: 80 * time.Millisecond},
+		sleepCheck{name: "stuck", delay: time.Second},
+		sleepCheck{name: "fast", delay: time.Millisecond},
+		sleepCheck{name: "override", delay: 80 * time.Millisecond, timeout: 500 * time.Millisecond},
+	}
+	runner := &Runner{Checks: checks, Concurrency: 4, Timeout: 150 * time.Millisecond}
+
+	start := time.Now()
+	run := runner.Run(context.Background(), "test")
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Errorf("Expected checks to run concurrently, took %v", elapsed)
+	}
+
+	for i, name := range []string{"slow", "stuck", "fast", "override"} {
+		if run.Results[i].Check != name {
+			t.Fatalf("Expected result %d to be %s, got %s", i, name, run.Results[i].Check)
+		}
+	}
+
+	stuck := run.Results[1]
+	if stuck.Verdict != VerdictTimeout || len(stuck.Findings) != 1 || stuck.Findings[0].Title != "检查超时 (stuck)" {
+		t.Errorf("Expected timeout finding, got %+v", stuck)
+	}
+	if run.Anomalies != 1 {
+		t.Errorf("Expected only the timed-out check to be an anomaly, got %d", run.Anomalies)
+	}
+	if run.Results[0].DurationMS < 80 || run.Results[3].Verdict != VerdictOK {
+		t.Errorf("Expected durations recorded and per-check override honoured, got %+v / %+v", run.Results[0], run.Results[3])
+	}
+
+	// 单个工作协程时按顺序执行
+	runner.Concurrency = 1
+	runner.Checks = []PatrolCheck{checks[2], checks[0]}
+	if run := runner.Run(context.Background(), "test"); run.Results[0].Check != "fast" || run.Anomalies != 0 {
+		t.Errorf("Unexpected sequential run: %+v", run.Results)
+	}
+}
+
+// useAlertState 使用临时文件保存已推送告警的状态，测试之间互不影响
+func useAlertState(t *testing.T) string {
+	t.Helper()
+	saved := alertState
+	t.Cleanup(func() { alertState = saved })
+	path := filepath.Join(t.TempDir(), "alert_state.json")
+	alertState = notify.NewAlertState(path)
+	return path
+}
+
+func TestNotifyRun_SuppressedDuringMaintenance(t *testing.T) {
+	useAlertState(t)
+	notify.SetSuppressor(func(event notify.Event) (string, bool) {
+		return "维护窗口 #1: db upgrade", event.Category == "disk"
+	})
+	t.Cleanup(func() { notify.SetSuppressor(nil) })
+
+	disk := NewCheckResult("disk")
+	disk.Alert(Finding{Title: "磁盘告警 (/dev/sda1)", Detail: "91%"})
+	run := &Run{Results: []*CheckResult{disk}}
+	if notifyRun(run) {
+		t.Error("Run with only suppressed findings should not notify")
+	}
+	if disk.Maintenance != "维护窗口 #1: db upgrade" || disk.Route != "" {
+		t.Errorf("Expected finding to be tagged with the maintenance window, got %+v", disk)
+	}
+
+	load := NewCheckResult("load")
+	load.Alert(Finding{Title: "负载过高", Detail: "load 12"})
+	run.Results = append(run.Results, load)
+	if !notifyRun(run) || load.Maintenance != "" || load.Route == "" {
+		t.Errorf("Findings outside the window should still be routed, got %+v", load)
+	}
+}
+
+func TestNotifyRun_ExportsAndResolvesAlerts(t *testing.T) {
+	useAlertState(t)
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		alertTracker = notify.NewAlertTracker()
+	})
+	alertTracker = notify.NewAlertTracker()
+	var posts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posts = append(posts, string(body))
+	}))
+	defer srv.Close()
+	cfg := *saved
+	cfg.Integrations = config.IntegrationsConfig{Alertmanager: config.AlertmanagerConfig{URL: srv.URL}}
+	config.Store(&cfg)
+
+	disk := NewCheckResult("disk")
+	disk.Alert(Finding{Title: "磁盘告警 (/dev/sda1)", Detail: "91%"})
+	run := &Run{Results: []*CheckResult{disk}}
+	notifyRun(run)
+	finding := disk.Findings[0]
+	if finding.Fingerprint == "" || len(finding.Deliveries) != 1 || !finding.Deliveries[0].OK || finding.Deliveries[0].Action != notify.ActionTrigger {
+		t.Fatalf("Expected the finding to record its delivery, got %+v", finding)
+	}
+
+	// 异常消失后发送恢复通知，结果记录在巡检记录上
+	recovered := &Run{Results: []*CheckResult{NewCheckResult("disk")}}
+	exportAlerts(recovered, nil, nil)
+	if len(recovered.Resolved) != 1 || recovered.Resolved[0].Fingerprint != finding.Fingerprint || recovered.Resolved[0].Deliveries[0].Action != notify.ActionResolve {
+		t.Fatalf("Expected the disk alert to resolve, got %+v", recovered.Resolved)
+	}
+	if len(posts) != 2 || !strings.Contains(posts[1], `"endsAt"`) || !strings.Contains(posts[1], finding.Fingerprint) {
+		t.Errorf("Expected a resolve notification with endsAt, got %v", posts)
+	}
+}
+
+func TestNotifyRun_CooldownEscalationAndResolve(t *testing.T) {
+	path := useAlertState(t)
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		notify.InitRouter()
+	})
+	posts := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posts <- string(body)
+	}))
+	defer srv.Close()
+	config.Update(func(cfg *config.Config) {
+		cfg.Patrol.AlertCooldown = 0
+		cfg.NotifyRouting = config.NotifyRoutingConfig{
+			Channels: []config.NotifyChannelConfig{{Name: "ops", Type: "slack", Webhook: srv.URL}},
+			Default:  []string{"ops"},
+		}
+	})
+	if err := notify.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+	expectPost := func(want string) {
+		t.Helper()
+		select {
+		case post := <-posts:
+			if !strings.Contains(post, want) {
+				t.Errorf("Expected a notification containing %q, got %s", want, post)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a notification containing %q", want)
+		}
+	}
+	diskRun := func(critical bool) (*Run, *CheckResult) {
+		disk := NewCheckResult("disk")
+		disk.Alert(Finding{Title: "磁盘告警 (/dev/sda1)", Detail: "91%", Critical: critical})
+		return &Run{Results: []*CheckResult{disk}}, disk
+	}
+
+	run, _ := diskRun(false)
+	if !notifyRun(run) {
+		t.Fatal("The first occurrence should be notified")
+	}
+	expectPost("磁盘告警 (/dev/sda1)")
+
+	// 冷却时间内重复出现不再推送，重启后（重新加载状态文件）同样如此
+	for i := 0; i < 2; i++ {
+		run, disk := diskRun(false)
+		if notifyRun(run) || !disk.Findings[0].Cooldown || !run.cooledDown() {
+			t.Errorf("Expected the repeat to be suppressed, got %+v", disk.Findings[0])
+		}
+		alertState = notify.NewAlertState(path)
+	}
+
+	// 严重程度升高时立即推送
+	run, disk := diskRun(true)
+	if !notifyRun(run) || disk.Findings[0].Cooldown {
+		t.Error("Expected the escalated finding to be notified")
+	}
+	expectPost("磁盘告警 (/dev/sda1)")
+
+	// 异常消失后发送恢复通知，之后不再重复
+	notifyRun(&Run{Results: []*CheckResult{NewCheckResult("disk")}})
+	expectPost("告警恢复")
+	notifyRun(&Run{Results: []*CheckResult{NewCheckResult("disk")}})
+	select {
+	case post := <-posts:
+		t.Errorf("Unexpected notification %s", post)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAccountsCheck(t *testing.T) {
+	snapshot := &hostaudit.Snapshot{Privileged: map[string]string{"root": "uid 0"}}
+	report := &hostaudit.Report{Baselined: true, Baseline: snapshot, Current: snapshot}
+	check := &AccountsCheck{Audit: func() (*hostaudit.Report, error) { return report, nil }}
+	if result := check.Run(context.Background()); result.Verdict != VerdictOK {
+		t.Errorf("Establishing the baseline should not alert, got %+v", result)
+	}
+
+	key := hostaudit.Key{Fingerprint: "SHA256:abc", Type: "ssh-ed25519", Comment: "mallory"}
+	report = &hostaudit.Report{Baseline: snapshot, Current: snapshot, Changes: []hostaudit.Change{
+		{Kind: hostaudit.ChangeKeyAdded, Subject: "root", Key: &key, Detail: "用户 root 的 authorized_keys 新增公钥"},
+	}}
+	result := check.Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 || result.Findings[0].Title != "新增 SSH 公钥 (root SHA256:abc)" || result.Critical() {
+		t.Errorf("Expected a warning for the new key, got %+v", result)
+	}
+}
+
+const testChronyTracking = `Reference ID    : A9FEA97B (169.254.169.123)
+Stratum         : 4
+System time     : 0.750000000 seconds slow of NTP time
+Last offset     : -0.000012345 seconds
+Leap status     : Normal
+`
+
+const testTimesyncStatus = `       Server: 91.189.89.198 (ntp.ubuntu.com)
+Poll interval: 32s (min: 32s; max 34min 8s)
+       Offset: -6.5s
+        Delay: 60.394ms
+`
+
+const testNTPQ = `     remote           refid      st t when poll reach   delay   offset  jitter
+==============================================================================
++10.0.0.2        .GPS.            1 u   35   64  377    0.512   90.000   0.045
+*10.0.0.1        .GPS.            1 u   35   64  377    0.512   -0.123   0.045
+`
+
+func TestClockCheck_Sources(t *testing.T) {
+	notFound := "bash: line 1: chronyc: not found"
+	cases := []struct {
+		name     string
+		outputs  map[string]string
+		method   string
+		source   string
+		offsetMS float64
+		verdict  Verdict
+		critical bool
+	}{
+		{"chrony", map[string]string{"chronyc": testChronyTracking}, ClockMethodChrony, "169.254.169.123", -750, VerdictAlert, false},
+		{"timesyncd", map[string]string{"chronyc": notFound, "timedatectl timesync": testTimesyncStatus, "timedatectl show": "yes"},
+			ClockMethodTimesyncd, "91.189.89.198 (ntp.ubuntu.com)", 6500, VerdictAlert, true},
+		{"ntpd", map[string]string{"chronyc": notFound, "timedatectl": notFound, "ntpq": testNTPQ}, ClockMethodNTPd, "10.0.0.1", 0.1, VerdictOK, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			check := &ClockCheck{
+				Probe:    &ClockProbe{Shell: fakeShell(tc.outputs), InContainer: func() bool { return false }},
+				Warn:     DefaultClockWarn,
+				Critical: DefaultClockCritical,
+			}
+			result := check.Run(context.Background())
+			status := LastClockStatus()
+			if status == nil || status.Method != tc.method || status.Source != tc.source || status.OffsetMS != tc.offsetMS || !status.Synced {
+				t.Fatalf("Unexpected status %+v", status)
+			}
+			if result.Verdict != tc.verdict || result.Critical() != tc.critical {
+				t.Errorf("Expected verdict=%s critical=%v, got %s %v", tc.verdict, tc.critical, result.Verdict, result.Critical())
+			}
+		})
+	}
+}
+
+func TestClockCheck_HTTPFallbackInContainer(t *testing.T) {
+	skew := 3 * time.Second
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-skew).UTC().Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+
+	shellCalled := false
+	shell := func(cmd string) *utils.ShellResult {
+		shellCalled = true
+		return &utils.ShellResult{Stdout: testChronyTracking}
+	}
+	check := &ClockCheck{
+		Probe:    &ClockProbe{Shell: shell, Endpoint: srv.URL, InContainer: func() bool { return true }},
+		Warn:     DefaultClockWarn,
+		Critical: DefaultClockCritical,
+	}
+	result := check.Run(context.Background())
+
+	if shellCalled {
+		t.Error("Expected time sync tools to be skipped inside a container")
+	}
+	status := LastClockStatus()
+	if status.Method != ClockMethodHTTP || !status.Container || status.Uncertainty < httpDateResolution/2 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+	if status.Offset < skew-1500*time.Millisecond || status.Offset > skew+1500*time.Millisecond {
+		t.Errorf("Expected offset near %v, got %v", skew, status.Offset)
+	}
+	if result.Verdict != VerdictAlert || result.Critical() {
+		t.Errorf("Expected warning, got verdict=%s critical=%v", result.Verdict, result.Critical())
+	}
+	if !hasTrace(result, TraceObserved, "容器环境") {
+		t.Errorf("Expected container note in trace: %+v", result.Trace)
+	}
+}
+
+func TestParseSystemdDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"-2.163ms":   -2163 * time.Microsecond,
+		"+4min 0.5s": 4*time.Minute + 500*time.Millisecond,
+		"12us":       12 * time.Microsecond,
+	} {
+		if got, err := parseSystemdDuration(value); err != nil || got != want {
+			t.Errorf("parseSystemdDuration(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+}
+
+func TestJobCheck_AlertsOnFailingJobs(t *testing.T) {
+	failing := []*jobs.Status{{Name: "archive", ConsecutiveFailures: 3, LastRun: &jobs.JobRun{Error: "disk full"}}}
+	result := (&JobCheck{Failing: func() []*jobs.Status { return failing }}).Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 || !strings.Contains(result.Findings[0].Detail, "disk full") {
+		t.Fatalf("Expected alert for failing job, got %+v", result)
+	}
+
+	failing = nil
+	if result := (&JobCheck{Failing: func() []*jobs.Status { return failing }}).Run(context.Background()); result.Verdict != VerdictOK {
+		t.Errorf("Expected OK without failing jobs, got %s", result.Verdict)
+	}
+}
+
+func TestHTTPCheck_SlowIsWarningDownIsCritical(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+
+	config.Update(func(cfg *config.Config) {
+		cfg.HTTPRules = []config.HTTPRule{{Name: "api", URL: srv.URL, MaxLatencyMS: 5}}
+	})
+	result := (&HTTPCheck{Refresh: true}).Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 || !strings.Contains(result.Findings[0].Title, "缓慢") || result.Critical() {
+		t.Fatalf("Expected a warning for a slow service, got %+v", result)
+	}
+
+	config.Update(func(cfg *config.Config) {
+		cfg.HTTPRules = []config.HTTPRule{{Name: "api", URL: srv.URL + "/down", MaxLatencyMS: 5}}
+	})
+	if result := (&HTTPCheck{Refresh: true}).Run(context.Background()); !result.Critical() || len(result.Findings) != 1 {
+		t.Errorf("Expected a critical alert for a failing service, got %+v", result)
+	}
+}
+
+func TestSelfCheck_AlertsNearMemoryLimit(t *testing.T) {
+	stats := selfguard.Stats{RSSBytes: 95 << 20, MemoryLimitBytes: 100 << 20, MemoryPercent: 95, Pressure: true}
+	result := (&SelfCheck{Sample: func() selfguard.Stats { return stats }}).Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 || !result.Findings[0].Critical {
+		t.Fatalf("Expected critical alert near the memory limit, got %+v", result)
+	}
+
+	stats.Pressure, stats.MemoryPercent = false, 40
+	if result := (&SelfCheck{Sample: func() selfguard.Stats { return stats }}).Run(context.Background()); result.Verdict != VerdictOK {
+		t.Errorf("Expected OK below the pressure threshold, got %s", result.Verdict)
+	}
+}
+
+func TestDriftCheck_AlertsOnExternalChanges(t *testing.T) {
+	events := []drift.Event{{ID: 3, Path: "/etc/nginx/sites-available/a_com.conf", Kind: drift.KindNginx, Owner: "a.com",
+		Diff: "--- a\n+++ b\n@@ -1 +1,2 @@\n+gzip on;\n", Status: drift.StatusOpen}}
+	result := (&DriftCheck{Open: func() []drift.Event { return events }}).Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 || result.Findings[0].Critical {
+		t.Fatalf("Expected a warning for the drifted file, got %+v", result)
+	}
+	if !strings.Contains(result.Findings[0].Detail, "+gzip on;") || !strings.Contains(result.Findings[0].Detail, "#3") {
+		t.Errorf("Expected the diff and event id in the detail, got %q", result.Findings[0].Detail)
+	}
+
+	events = nil
+	if result := (&DriftCheck{Open: func() []drift.Event { return events }}).Run(context.Background()); result.Verdict != VerdictOK {
+		t.Errorf("Expected OK without open drift events, got %s", result.Verdict)
+	}
+}
+
+// zombieShell 伪造的进程表和各父进程的 cgroup
+func zombieShell(ps string, cgroups map[int]string) ShellFunc {
+	outputs := map[string]string{"ps -A": ps}
+	for pid, cgroup := range cgroups {
+		outputs[fmt.Sprintf("cat /proc/%d/cgroup", pid)] = cgroup
+	}
+	return fakeShell(outputs)
+}
+
+func TestZombieCheck_ProtectedParent(t *testing.T) {
+	ps := `    1     0 Ss   systemd
+  812     1 Sl   containerd
+  901   812 Z    runc
+  902   812 Z    runc
+`
+	check := &ZombieCheck{Analyzer: &ZombieAnalyzer{Shell: zombieShell(ps, map[int]string{812: "0::/system.slice/containerd.service\n"})}}
+	result := check.Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 {
+		t.Fatalf("Expected a zombie alert, got %s %+v", result.Verdict, result.Findings)
+	}
+	detail := result.Findings[0].Detail
+	if !strings.Contains(detail, "containerd (PID 812)") || !strings.Contains(detail, "受保护") || !strings.Contains(detail, "kill -s SIGCHLD 812") {
+		t.Errorf("Expected the protected parent with a SIGCHLD suggestion, got:\n%s", detail)
+	}
+	if strings.Contains(detail, "kill -TERM") || strings.Contains(detail, "kill -9") {
+		t.Errorf("A protected parent must never be suggested for killing, got:\n%s", detail)
+	}
+
+	analysis, err := NewZombieAnalyzer(zombieShell("  5     1 Z    sh\n", nil)).Analyze(NewCheckResult("zombie"))
+	if err != nil || len(analysis.Parents) != 1 || !analysis.Parents[0].Protected {
+		t.Errorf("Zombies reparented to PID 1 should be attributed to a protected init, got %+v %v", analysis, err)
+	}
+}
+
+func TestZombieAnalyzer_ContainerParent(t *testing.T) {
+	id := strings.Repeat("3f2a9c1b4d5e", 5) + "abcd"
+	ps := ` 4100  4000 Ss   node
+ 4201  4100 Z    sh
+`
+	cgroup := "12:pids:/docker/" + id + "\n0::/system.slice/docker-" + id + ".scope\n"
+	analyzer := &ZombieAnalyzer{Shell: zombieShell(ps, map[int]string{4100: cgroup}), KillThreshold: 0}
+	analysis, err := analyzer.Analyze(NewCheckResult("zombie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := analysis.Parents[0]
+	if parent.Container != id[:12] || parent.Protected || parent.Escalate || parent.Name != "node" {
+		t.Errorf("Expected an unprotected container parent below the threshold, got %+v", parent)
+	}
+	if len(parent.Suggestion) != 1 || parent.Suggestion[0] != "kill -s SIGCHLD 4100" {
+		t.Errorf("Expected only a SIGCHLD suggestion, got %v", parent.Suggestion)
+	}
+	if !strings.Contains(strings.Join(parent.Reasoning, "\n"), "init: true") {
+		t.Errorf("Expected the container init hint, got %v", parent.Reasoning)
+	}
+}
+
+func TestZombieAnalyzer_MassZombies(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("  300     1 S    worker\n  400     1 S    tini\n  401   400 Z    job\n")
+	for pid := 1000; pid < 1020; pid++ {
+		fmt.Fprintf(&b, " %d   300 Z    task\n", pid)
+	}
+	analyzer := &ZombieAnalyzer{Shell: zombieShell(b.String(), nil), Protected: []string{"worker"}, KillThreshold: 5}
+	analysis, err := analyzer.Analyze(NewCheckResult("zombie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Total != 21 || len(analysis.Parents) != 2 || analysis.Parents[0].PID != 300 {
+		t.Fatalf("Expected zombies grouped by parent, most first, got %+v", analysis)
+	}
+	// 配置的受保护进程即使僵尸数超过阈值也不建议终止
+	if parent := analysis.Parents[0]; !parent.Protected || parent.Escalate || len(parent.Suggestion) != 1 {
+		t.Errorf("Expected the configured protected parent not to escalate, got %+v", parent)
+	}
+
+	analyzer.Protected = nil
+	analysis, _ = analyzer.Analyze(NewCheckResult("zombie"))
+	parent := analysis.Parents[0]
+	if !parent.Escalate || len(parent.Suggestion) != 2 || parent.Suggestion[1] != "kill -TERM 300" {
+		t.Errorf("Expected escalation to kill the parent with 20 zombies, got %+v", parent)
+	}
+	if markdown := analysis.Markdown(); !strings.Contains(markdown, "等 20 个") || !strings.Contains(markdown, "不会自动执行") {
+		t.Errorf("Expected a truncated zombie list and the no-auto-run note, got:\n%s", markdown)
+	}
+}
+
+func TestContainerLogCheck_SizeAndGrowth(t *testing.T) {
+	files := []container.LogFile{
+		{ContainerID: "aaa", Name: "shop-web-1", Project: "shop", Service: "web", ProjectID: 7, Size: 3 << 30},
+		{ContainerID: "bbb", Name: "worker", Size: 10 << 20, MaxSize: "100m"},
+	}
+	check := &ContainerLogCheck{Scan: func(ctx context.Context) ([]container.LogFile, error) { return files, nil }, GrowthMB: 100, history: &logSizeHistory{}}
+	result := check.Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 {
+		t.Fatalf("Expected alert for the oversized log, got %+v", result)
+	}
+	detail := result.Findings[0].Detail
+	for _, want := range []string{"shop-web-1 (shop/web)：3.0GB", "未配置 max-size", "max-size: \"100m\"", "POST /api/compose/7/services/web/log-rotation", "不会自动执行"} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("Expected %q in detail:\n%s", want, detail)
+		}
+	}
+	// 首次巡检没有基线，不按增长告警
+	if strings.Contains(detail, "worker") {
+		t.Errorf("Small log should not be reported on the first patrol:\n%s", detail)
+	}
+
+	files = []container.LogFile{{ContainerID: "bbb", Name: "worker", Size: 300 << 20, MaxSize: "100m"}}
+	result = check.Run(context.Background())
+	if result.Verdict != VerdictAlert || !strings.Contains(result.Findings[0].Detail, "worker：300.0MB，较上次巡检 +290.0MB") {
+		t.Fatalf("Expected growth alert, got %+v", result)
+	}
+	if strings.Contains(result.Findings[0].Detail, "POST /api/compose") {
+		t.Errorf("Unmanaged containers should not offer the one-click fix:\n%s", result.Findings[0].Detail)
+	}
+
+	if result := check.Run(context.Background()); result.Verdict != VerdictOK {
+		t.Errorf("Expected OK once the log stops growing, got %s", result.Verdict)
+	}
+
+	check.Scan = func(ctx context.Context) ([]container.LogFile, error) { return nil, container.ErrLogFileUnreadable }
+	if result := check.Run(context.Background()); result.Verdict != VerdictSkipped {
+		t.Errorf("Expected skip when logs are unreadable, got %s", result.Verdict)
+	}
+}
+
+func TestCertCheck_RenewalFailures(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	soon, later := now.AddDate(0, 0, 3), now.AddDate(0, 0, 20)
+	calls := 0
+	results := []website.RenewalResult{
+		{Cert: &website.SSLCert{Domain: "shop.example.com", ExpiryDate: &later}},
+		{Cert: &website.SSLCert{Domain: "api.example.com", ExpiryDate: &soon}, Err: fmt.Errorf("urn:ietf:params:acme:error:unauthorized")},
+	}
+	check := &CertCheck{
+		Renew: func(ctx context.Context) ([]website.RenewalResult, error) { calls++; return results, nil },
+		Now:   func() time.Time { return now },
+		state: &certRenewalState{},
+	}
+
+	result := check.Run(context.Background())
+	if result.Verdict != VerdictAlert || len(result.Findings) != 1 || !result.Findings[0].Critical {
+		t.Fatalf("Expected a critical renewal alert for a certificate expiring in 3 days, got %+v", result)
+	}
+	if detail := result.Findings[0].Detail; !strings.Contains(detail, "api.example.com：urn:ietf:params:acme:error:unauthorized（2026-03-04 过期，剩余 3 天）") || strings.Contains(detail, "shop.example.com") {
+		t.Errorf("Expected only the failed certificate in the detail:\n%s", detail)
+	}
+
+	// 一小时内的巡检沿用上次的结果，不再请求 CA
+	now = now.Add(10 * time.Minute)
+	if result := check.Run(context.Background()); calls != 1 || result.Verdict != VerdictAlert {
+		t.Errorf("Expected the cached failure without another attempt, got %d calls %s", calls, result.Verdict)
+	}
+
+	now = now.Add(time.Hour)
+	results = results[:1]
+	if result := check.Run(context.Background()); calls != 2 || result.Verdict != VerdictOK {
+		t.Errorf("Expected a retry after an hour to clear the alert, got %d calls %s", calls, result.Verdict)
+	}
+
+	now = now.Add(time.Hour)
+	check.Renew = func(ctx context.Context) ([]website.RenewalResult, error) {
+		return results, fmt.Errorf("failed to reload nginx")
+	}
+	if result := check.Run(context.Background()); result.Verdict != VerdictAlert || result.Findings[0].Title != "证书续期后重载 nginx 失败" {
+		t.Errorf("Expected a reload failure alert, got %+v", result)
+	}
+	now = now.Add(time.Hour)
+	check.Renew = func(ctx context.Context) ([]website.RenewalResult, error) {
+		return nil, fmt.Errorf("database is locked")
+	}
+	if result := check.Run(context.Background()); result.Verdict != VerdictSkipped {
+		t.Errorf("Expected skip when certificates cannot be listed, got %s", result.Verdict)
+	}
+}
+
+// fakeConfigBackups 记录备份次数的配置备份管理器
+type fakeConfigBackups struct {
+	latest *backup.ConfigBackup
+	err    error
+	calls  int
+	now    func() time.Time
+}
+
+func (f *fakeConfigBackups) Latest() (*backup.ConfigBackup, error) { return f.latest, nil }
+
+func (f *fakeConfigBackups) Backup(ctx context.Context, trigger string) (*backup.ConfigBackup, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.latest = &backup.ConfigBackup{ID: "qwq-config-new", Trigger: trigger, CreatedAt: f.now()}
+	return f.latest, nil
+}
+
+func TestBackupCheck_Schedule(t *testing.T) {
+	now := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	backups := &fakeConfigBackups{
+		latest: &backup.ConfigBackup{ID: "qwq-config-old", CreatedAt: now.Add(-2 * time.Hour)},
+		err:    fmt.Errorf("no space left on device"),
+		now:    func() time.Time { return now },
+	}
+	check := &BackupCheck{Backups: backups, Now: func() time.Time { return now }, state: &configBackupState{}}
+
+	if result := check.Run(context.Background()); result.Verdict != VerdictOK || backups.calls != 0 {
+		t.Fatalf("Expected no backup within a day of the last one, got %s with %d calls", result.Verdict, backups.calls)
+	}
+
+	now = now.Add(23 * time.Hour)
+	result := check.Run(context.Background())
+	if result.Verdict != VerdictAlert || backups.calls != 1 || result.Findings[0].Title != "定时配置备份失败" {
+		t.Fatalf("Expected a failed scheduled backup to alert, got %+v", result)
+	}
+	if detail := result.Findings[0].Detail; !strings.Contains(detail, "no space left on device") || !strings.Contains(detail, "qwq-config-old") {
+		t.Errorf("Expected the error and the last good backup in the detail:\n%s", detail)
+	}
+
+	// 一小时内沿用失败结果，不重复备份
+	now = now.Add(10 * time.Minute)
+	if result := check.Run(context.Background()); result.Verdict != VerdictAlert || backups.calls != 1 {
+		t.Errorf("Expected the cached failure without another attempt, got %s with %d calls", result.Verdict, backups.calls)
+	}
+
+	now = now.Add(time.Hour)
+	backups.err = nil
+	if result := check.Run(context.Background()); result.Verdict != VerdictOK || backups.calls != 2 || backups.latest.Trigger != "scheduled" {
+		t.Errorf("Expected a successful retry to clear the alert, got %s with %d calls", result.Verdict, backups.calls)
+	}
+}
+
+// fakeExecutor 按命令前缀返回预设 stdout 的远程执行目标
+type fakeExecutor struct {
+	name  string
+	shell ShellFunc
+}
+
+func (e *fakeExecutor) Name() string { return e.name }
+
+func (e *fakeExecutor) Run(ctx context.Context, cmd string, opts utils.ShellOptions) *utils.ShellResult {
+	return e.shell(cmd)
+}
+
+// fakeHosts 内存中的远程主机，failures 中的主机连接失败
+type fakeHosts struct {
+	hosts    []remote.Host
+	failures map[string]error
+}
+
+func (f *fakeHosts) List(ctx context.Context) ([]remote.Host, error) { return f.hosts, nil }
+
+func (f *fakeHosts) Connect(ctx context.Context, host remote.Host) (remote.Executor, error) {
+	if err := f.failures[host.Name]; err != nil {
+		return nil, err
+	}
+	return &fakeExecutor{name: host.Name, shell: fakeShell(map[string]string{"df": testDFOutput})}, nil
+}
+
+func TestRemoteChecks_TagsHostsAndConnectionFailures(t *testing.T) {
+	saved := RemoteHosts
+	t.Cleanup(func() { RemoteHosts = saved })
+	if checks := RemoteChecks(context.Background()); len(checks) != 0 {
+		t.Fatalf("Expected no remote checks without hosts, got %d", len(checks))
+	}
+	RemoteHosts = &fakeHosts{
+		hosts:    []remote.Host{{Name: "db-1"}, {Name: "web-1"}},
+		failures: map[string]error{"db-1": fmt.Errorf("dial tcp 10.0.0.2:22: connection refused")},
+	}
+
+	checks := append([]PatrolCheck{&DiskCheck{Shell: fakeShell(map[string]string{"df": testDFOutput}), Threshold: 85}}, RemoteChecks(context.Background())...)
+	run := NewRunner(checks).Run(context.Background(), "manual")
+	byName := map[string]*CheckResult{}
+	for _, result := range run.Results {
+		byName[result.Check+"@"+result.Host] = result
+	}
+	if len(run.Results) != 7 || byName["disk@"] == nil || byName["load@web-1"] == nil || byName["zombie@web-1"] == nil {
+		t.Fatalf("Expected local checks plus the web-1 system checks, got %v", byName)
+	}
+
+	local, remoteDisk := byName["disk@"], byName["disk@web-1"]
+	if local.Findings[0].Label() != "磁盘告警 (/dev/sda1)" || remoteDisk.Findings[0].Label() != "[web-1] 磁盘告警 (/dev/sda1)" {
+		t.Errorf("Expected remote findings to be labelled with the host, got %q %q", local.Findings[0].Label(), remoteDisk.Findings[0].Label())
+	}
+	conn := byName["host-connection@db-1"]
+	if conn == nil || !conn.Critical() || conn.Findings[0].Title != "主机无法连接 (db-1)" || !strings.Contains(conn.Findings[0].Detail, "connection refused") {
+		t.Fatalf("Expected a critical connection failure for db-1, got %+v", conn)
+	}
+	if !strings.Contains(run.Report, "**[web-1] 磁盘告警 (/dev/sda1)**") {
+		t.Errorf("Expected the report to name the host, got %s", run.Report)
+	}
+
+	// 不同主机上的同一异常指纹不同
+	event := notify.Event{Host: "local"}
+	findingAlerts(local, event)
+	event.Host = resultHost(remoteDisk, "local")
+	findingAlerts(remoteDisk, event)
+	if local.Findings[0].Fingerprint == remoteDisk.Findings[0].Fingerprint {
+		t.Error("Expected per-host fingerprints")
+	}
+}
@@ -0,0 +1,132 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"qwq/internal/logger"
+	"qwq/internal/remote"
+)
+
+// remoteConnectTimeout 巡检开始前连接远程主机的总超时，单台主机的超时由 remote.connect_timeout 控制
+const remoteConnectTimeout = 30 * time.Second
+
+// RemoteHostSource 列出和连接远程主机，*remote.Manager 实现了该接口
+type RemoteHostSource interface {
+	List(ctx context.Context) ([]remote.Host, error)
+	Connect(ctx context.Context, host remote.Host) (remote.Executor, error)
+}
+
+// RemoteHosts 远程主机管理器，由 Web 和巡检模式启动时注入
+// 未注入或没有添加主机时只巡检本机
+var RemoteHosts RemoteHostSource
+
+// HostTarget 可选接口，在远程主机上执行的检查项实现，执行器据此在结果和异常上标记主机名
+type HostTarget interface {
+	Host() string
+}
+
+// tagHost 在结果和每个异常上标记主机名
+func (r *CheckResult) tagHost(host string) {
+	if host == "" {
+		return
+	}
+	r.Host = host
+	for i := range r.Findings {
+		r.Findings[i].Host = host
+	}
+}
+
+// resultHost 告警中使用的主机名，本机的结果使用 local
+func resultHost(result *CheckResult, local string) string {
+	if result.Host != "" {
+		return result.Host
+	}
+	return local
+}
+
+// hostCheck 在远程主机上执行的检查项，名称与本机的检查项相同，通过主机名区分
+type hostCheck struct {
+	PatrolCheck
+	host string
+}
+
+// Host 检查的远程主机
+func (c *hostCheck) Host() string { return c.host }
+
+// Timeout 沿用被包装检查项的超时时间
+func (c *hostCheck) Timeout() time.Duration {
+	if override, ok := c.PatrolCheck.(TimeoutOverrider); ok {
+		return override.Timeout()
+	}
+	return 0
+}
+
+// HostChecks 在远程主机上执行的检查项：磁盘、负载、OOM 和僵尸进程，阈值与本机相同
+func HostChecks(host string, shell ShellFunc) []PatrolCheck {
+	checks := systemChecks(shell)
+	for i, check := range checks {
+		checks[i] = &hostCheck{PatrolCheck: check, host: host}
+	}
+	return checks
+}
+
+// ConnectionCheck 远程主机无法连接时作为单独的严重异常上报，该主机的其他检查项不再执行
+type ConnectionCheck struct {
+	HostName string
+	Err      error
+}
+
+// Name 检查项名称
+func (c *ConnectionCheck) Name() string { return "host-connection" }
+
+// Host 无法连接的远程主机
+func (c *ConnectionCheck) Host() string { return c.HostName }
+
+// Run 上报连接失败
+func (c *ConnectionCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+	result.Observe("连接失败: %v", c.Err)
+	result.Alert(Finding{Title: fmt.Sprintf("主机无法连接 (%s)", c.HostName), Detail: c.Err.Error(), Critical: true})
+	return result
+}
+
+// RemoteChecks 并行连接所有远程主机，返回各主机的检查项；无法连接的主机返回 ConnectionCheck
+// 结果按主机名排列，与连接完成的顺序无关
+func RemoteChecks(ctx context.Context) []PatrolCheck {
+	source := RemoteHosts
+	if source == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteConnectTimeout)
+	defer cancel()
+	hosts, err := source.List(ctx)
+	if err != nil {
+		logger.Info("❌ 读取远程主机失败，本轮只巡检本机: %v", err)
+		return nil
+	}
+
+	perHost := make([][]PatrolCheck, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host remote.Host) {
+			defer wg.Done()
+			executor, err := source.Connect(ctx, host)
+			if err != nil {
+				perHost[i] = []PatrolCheck{&ConnectionCheck{HostName: host.Name, Err: err}}
+				return
+			}
+			perHost[i] = HostChecks(host.Name, remote.ShellFunc(executor))
+		}(i, host)
+	}
+	wg.Wait()
+
+	var checks []PatrolCheck
+	for _, hostChecks := range perHost {
+		checks = append(checks, hostChecks...)
+	}
+	return checks
+}
@@ -0,0 +1,634 @@
+package patrol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/agent"
+	"qwq/internal/config"
+	"qwq/internal/events"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"qwq/internal/utils"
+)
+
+const (
+	// DefaultMaxRuns 内存中保留的巡检记录数量
+	DefaultMaxRuns = 50
+	// DefaultConcurrency 默认同时执行的检查项数量
+	DefaultConcurrency = 4
+	// DefaultCheckTimeout 单个检查项的默认超时时间
+	DefaultCheckTimeout = time.Minute
+	// DefaultRunsFile 巡检记录持久化文件，供重启后和 CLI 查看历史事件
+	DefaultRunsFile = "qwq_patrol_runs.json"
+)
+
+// virtualDeviceKeywords 告警内容中出现这些关键字时视为虚拟设备误报
+var virtualDeviceKeywords = []string{"/dev/loop", "/snap", "snap/", "/hostfs", "overlay", "tmpfs"}
+
+// Runner 巡检执行器
+type Runner struct {
+	Checks      []PatrolCheck
+	Concurrency int           // 同时执行的检查项数量，<=0 时使用 DefaultConcurrency
+	Timeout     time.Duration // 单个检查项默认超时，<=0 时使用 DefaultCheckTimeout
+}
+
+// NewRunner 创建巡检执行器
+func NewRunner(checks []PatrolCheck) *Runner {
+	return &Runner{Checks: checks, Concurrency: DefaultConcurrency, Timeout: DefaultCheckTimeout}
+}
+
+// Run 并发执行所有检查项并汇总结果
+// 结果按检查项注册顺序排列，与完成顺序无关
+func (r *Runner) Run(ctx context.Context, trigger string) *Run {
+	run := &Run{Trigger: trigger, StartedAt: time.Now()}
+
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	results := make([]*CheckResult, len(r.Checks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, check := range r.Checks {
+		wg.Add(1)
+		go func(i int, check PatrolCheck) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			result := r.runWithTimeout(ctx, check)
+			result.Duration = time.Since(start)
+			result.DurationMS = result.Duration.Milliseconds()
+			if result.Verdict != VerdictTimeout {
+				dropVirtualDeviceFindings(result)
+			}
+			if target, ok := check.(HostTarget); ok {
+				result.tagHost(target.Host())
+			}
+			result.finish()
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+	run.Results = results
+
+	findings := run.Findings()
+	run.Anomalies = len(findings)
+	if len(findings) > 0 {
+		parts := make([]string, 0, len(findings))
+		for _, finding := range findings {
+			parts = append(parts, finding.Markdown())
+		}
+		run.Report = strings.Join(parts, "\n")
+	}
+	run.FinishedAt = time.Now()
+	return run
+}
+
+// runWithTimeout 在检查项自己的超时时间内执行
+// ShellFunc 无法被中断，超时后检查项在后台继续运行直至结束，其结果被丢弃
+func (r *Runner) runWithTimeout(ctx context.Context, check PatrolCheck) *CheckResult {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	if override, ok := check.(TimeoutOverrider); ok && override.Timeout() > 0 {
+		timeout = override.Timeout()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan *CheckResult, 1)
+	go func() { done <- runCheck(ctx, check) }()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		result := NewCheckResult(check.Name())
+		result.Observe("超时时间 %v", timeout)
+		result.Alert(Finding{
+			Title:  fmt.Sprintf("检查超时 (%s)", check.Name()),
+			Detail: fmt.Sprintf("check timed out after %v", timeout),
+		})
+		result.Verdict = VerdictTimeout
+		return result
+	}
+}
+
+// runCheck 执行单个检查项，检查项 panic 时记为跳过，不影响其他检查项
+func runCheck(ctx context.Context, check PatrolCheck) (result *CheckResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.RecordPanic("patrol check "+check.Name(), r, debug.Stack())
+			result = NewCheckResult(check.Name())
+			result.Skip("检查项异常退出: %v", r)
+		}
+	}()
+	return check.Run(ctx)
+}
+
+// dropVirtualDeviceFindings 过滤掉涉及虚拟设备的异常（避免误报）
+func dropVirtualDeviceFindings(result *CheckResult) {
+	if len(result.Findings) == 0 {
+		return
+	}
+
+	kept := result.Findings[:0]
+	for _, finding := range result.Findings {
+		if keyword := matchVirtualDevice(finding.Markdown()); keyword != "" {
+			result.Filter("finding dropped: %s matched %s", finding.Title, keyword)
+			continue
+		}
+		kept = append(kept, finding)
+	}
+	result.Findings = kept
+	if len(kept) == 0 {
+		result.Verdict = VerdictOK
+	}
+}
+
+func matchVirtualDevice(text string) string {
+	for _, keyword := range virtualDeviceKeywords {
+		if strings.Contains(text, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// Store 巡检记录存储
+// 使用读写锁保护并发访问，只保留最近的若干条记录，调用 Load 后可持久化到 JSON 文件
+type Store struct {
+	mu     sync.RWMutex
+	runs   []*Run
+	nextID int64
+	max    int
+	path   string
+}
+
+// NewStore 创建巡检记录存储
+func NewStore(max int) *Store {
+	if max <= 0 {
+		max = DefaultMaxRuns
+	}
+	return &Store{max: max, nextID: 1}
+}
+
+// Save 保存巡检记录并分配 ID
+func (s *Store) Save(run *Run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.ID = s.nextID
+	s.nextID++
+	s.runs = append(s.runs, run)
+	if len(s.runs) > s.max {
+		s.runs = s.runs[len(s.runs)-s.max:]
+	}
+}
+
+// List 列出最近的巡检记录（最新的在前）
+func (s *Store) List(limit int) []*Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 || limit > len(s.runs) {
+		limit = len(s.runs)
+	}
+	result := make([]*Run, 0, limit)
+	for i := len(s.runs) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, s.runs[i])
+	}
+	return result
+}
+
+// Get 根据 ID 获取巡检记录
+func (s *Store) Get(id int64) (*Run, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, run := range s.runs {
+		if run.ID == id {
+			return run, true
+		}
+	}
+	return nil, false
+}
+
+// Load 从文件加载巡检记录并在之后的 Flush 中写回该文件，文件不存在时忽略
+func (s *Store) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var runs []*Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return fmt.Errorf("failed to parse patrol runs: %w", err)
+	}
+	if len(runs) > s.max {
+		runs = runs[len(runs)-s.max:]
+	}
+	s.runs = runs
+	for _, run := range runs {
+		if run.ID >= s.nextID {
+			s.nextID = run.ID + 1
+		}
+	}
+	return nil
+}
+
+// Flush 原子写入巡检记录，未调用 Load 时不持久化
+func (s *Store) Flush() error {
+	s.mu.RLock()
+	path := s.path
+	if path == "" {
+		s.mu.RUnlock()
+		return nil
+	}
+	data, err := json.Marshal(s.runs)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// DefaultStore 全局巡检记录存储
+var DefaultStore = NewStore(DefaultMaxRuns)
+
+// Perform 执行一次系统巡检
+// 发现异常时调用 AI 分析并推送告警，巡检记录（含决策追踪）保存到 DefaultStore
+func Perform(trigger string) *Run {
+	logger.Info("正在执行系统巡检...")
+
+	checks := append(DefaultChecks(utils.RunShell), RemoteChecks(context.Background())...)
+	// 手动触发的巡检需要最新结果，HTTP 检查不读取缓存
+	if trigger == "manual" {
+		for _, check := range checks {
+			if http, ok := check.(*HTTPCheck); ok {
+				http.Refresh = true
+			}
+		}
+	}
+	runner := NewRunner(checks)
+	if cfg := config.Current().Patrol; cfg.Concurrency > 0 {
+		runner.Concurrency = cfg.Concurrency
+	}
+	if cfg := config.Current().Patrol; cfg.CheckTimeout > 0 {
+		runner.Timeout = time.Duration(cfg.CheckTimeout) * time.Second
+	}
+	run := runner.Run(context.Background(), trigger)
+	DefaultStore.Save(run)
+	logger.Debug("巡检决策追踪:\n%s", run.FormatTrace())
+
+	if run.Anomalies > 0 {
+		recordFindings(run)
+		logger.Info("🚨 发现异常，正在请求 AI 分析...")
+
+		// 调用 AI 分析异常原因和解决方案，报告超出上下文预算时压缩后再发送
+		analysis, condensed := agent.AnalyzeReportWithAI(run.ReportSections())
+		run.Analysis = CleanAIAnalysis(analysis)
+		run.Condensed = condensed
+
+		// 组装告警消息并按通知路由推送，维护期间的异常只记录不推送，冷却时间内重复出现的异常不再推送
+		run.Notified = notifyRun(run)
+		switch {
+		case run.Notified:
+			logger.Info("告警已推送")
+		case run.cooledDown():
+			logger.Info("🔕 异常在冷却时间内已推送过，本轮不再重复推送")
+		default:
+			logger.Info("🔕 异常均发生在维护期间，告警已静默")
+		}
+	} else {
+		// 所有异常已恢复，清除升级跟踪，发送恢复通知并关闭外部告警
+		escalator.Observe(time.Now(), nil)
+		resolveAlerts(notify.DefaultRouter(), utils.GetHostname(), nil)
+		exportAlerts(run, nil, nil)
+		logger.Info("✔ 系统健康")
+	}
+	if err := DefaultStore.Flush(); err != nil {
+		logger.Info("保存巡检记录失败: %v", err)
+	}
+	return run
+}
+
+// recordFindings 把巡检发现的异常记录到事件时间线
+func recordFindings(run *Run) {
+	for _, result := range run.Results {
+		for _, finding := range result.Findings {
+			events.Emit(events.TypeAnomaly, "detected", "patrol ("+run.Trigger+")", result.Check, finding.Label())
+		}
+	}
+}
+
+// escalator 跟踪多次巡检之间持续未恢复的严重异常
+var escalator = notify.NewEscalator()
+
+// alertState 跟踪已推送到通知渠道的异常，用于冷却时间内去重和发送恢复通知
+var alertState = notify.NewAlertState(notify.DefaultAlertStateFile)
+
+// alertCooldown 同一异常重复推送的冷却时间，配置为负数时每次巡检都推送
+func alertCooldown() time.Duration {
+	minutes := config.Current().Patrol.AlertCooldown
+	switch {
+	case minutes < 0:
+		return 0
+	case minutes == 0:
+		return notify.DefaultAlertCooldown
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// notifyRun 按通知路由推送巡检告警，返回是否推送了告警（排队到静默时段结束后发送的也算）
+// 每个检查项按类别（检查项名称）和严重程度匹配路由，命中的规则记录在检查结果上；发往相同渠道的异常合并为一条消息
+// 处于维护窗口内的异常标记在检查结果上，不推送也不参与升级；冷却时间内已推送过的异常标记在异常上，严重程度未升高时不再推送
+// 之前推送过、本轮不再出现的异常发送恢复通知
+func notifyRun(run *Run) bool {
+	router := notify.DefaultRouter()
+	host := utils.GetHostname()
+	now := time.Now()
+	cooldown := alertCooldown()
+
+	type group struct {
+		channels []string
+		parts    []string
+	}
+	groups := make(map[string]*group)
+	var order []string
+	var incidents []notify.Incident
+	var alerts []notify.ExternalAlert
+	var held []string
+	queued := false
+	for _, result := range run.Results {
+		if len(result.Findings) == 0 {
+			continue
+		}
+		parts := make([]string, 0, len(result.Findings))
+		for _, finding := range result.Findings {
+			parts = append(parts, finding.Markdown())
+		}
+		event := notify.Event{
+			Severity: notify.SeverityWarning,
+			Category: result.Check,
+			Host:     host,
+			Key:      result.Check,
+			Title:    "系统告警",
+			Content:  strings.Join(parts, "\n"),
+		}
+		// 远程主机的异常按该主机路由和去重，同一检查项在不同主机上分别升级
+		if result.Host != "" {
+			event.Host = result.Host
+			event.Key = result.Check + "@" + result.Host
+		}
+		if result.Critical() {
+			event.Severity = notify.SeverityCritical
+		}
+		resultAlerts := findingAlerts(result, event)
+		if reason, ok := notify.Suppressed(event); ok {
+			result.Maintenance = reason
+			for _, alert := range resultAlerts {
+				held = append(held, alert.Fingerprint)
+			}
+			continue
+		}
+		alerts = append(alerts, resultAlerts...)
+		decision := router.Match(event)
+		result.Route = decision.Route
+		incidents = append(incidents, notify.Incident{Key: event.Key, Event: event, Decision: decision})
+
+		// 冷却时间内重复出现的异常不再推送，升级和外部告警不受影响
+		parts = parts[:0]
+		for i, alert := range resultAlerts {
+			if !alertState.Fire(now, alert, cooldown) {
+				result.Findings[i].Cooldown = true
+				continue
+			}
+			parts = append(parts, result.Findings[i].Markdown())
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		event.Content = strings.Join(parts, "\n")
+
+		// 处于渠道静默时段的非严重异常单独排队，静默时段结束后按检查项合并到摘要中
+		channels := router.Hold(event, decision)
+		if len(channels) < len(decision.Channels) {
+			queued = true
+		}
+		if len(channels) == 0 {
+			continue
+		}
+		key := strings.Join(channels, ",")
+		if groups[key] == nil {
+			groups[key] = &group{channels: channels}
+			order = append(order, key)
+		}
+		groups[key].parts = append(groups[key].parts, parts...)
+	}
+
+	for _, key := range order {
+		alertMsg := fmt.Sprintf("🚨 **系统告警** [%s]\n\n%s\n\n💡 **处理建议**:\n%s", host, strings.Join(groups[key].parts, "\n"), run.Analysis)
+		if len(run.Condensed) > 0 {
+			alertMsg += fmt.Sprintf("\n\nℹ️ 以下异常内容过长，已压缩后交给 AI 分析: %s", strings.Join(run.Condensed, "、"))
+		}
+		router.Send(groups[key].channels, "系统告警", alertMsg)
+	}
+	active := append([]string(nil), held...)
+	for _, alert := range alerts {
+		active = append(active, alert.Fingerprint)
+	}
+	resolveAlerts(router, host, active)
+	for _, incident := range escalator.Observe(now, incidents) {
+		logger.Info("⏫ 异常 %s 持续未恢复，升级通知: %s", incident.Key, strings.Join(incident.Decision.EscalateTo, ","))
+		router.Escalate(incident)
+	}
+	exportAlerts(run, alerts, held)
+	return len(order) > 0 || queued
+}
+
+// resolveAlerts 为之前推送过、本轮不在 active 中的异常发送恢复通知，按原来的严重程度和检查项匹配路由，发往相同渠道的合并为一条消息
+func resolveAlerts(router *notify.Router, host string, active []string) {
+	resolved := alertState.Resolve(active)
+	if len(resolved) == 0 {
+		return
+	}
+	groups := make(map[string][]string)
+	channels := make(map[string][]string)
+	var order []string
+	for _, alert := range resolved {
+		title, event := alert.Title, notify.Event{Severity: alert.Severity, Category: alert.Category, Host: host, Key: alert.Category, Title: "告警恢复"}
+		if alert.Host != "" && alert.Host != host {
+			title = Finding{Title: alert.Title, Host: alert.Host}.Label()
+			event.Host, event.Key = alert.Host, alert.Category+"@"+alert.Host
+		}
+		logger.Info("✅ 异常已恢复: %s (%s)", title, alert.Category)
+		events.Emit(events.TypeAnomaly, "resolved", "patrol", alert.Category, title)
+		line := fmt.Sprintf("- **%s**（%s，持续 %v）", title, alert.Category, time.Since(alert.FirstSeen).Round(time.Minute))
+		event.Content = line
+		if _, ok := notify.Suppressed(event); ok {
+			continue
+		}
+		targets := router.Hold(event, router.Match(event))
+		if len(targets) == 0 {
+			continue
+		}
+		key := strings.Join(targets, ",")
+		if _, ok := groups[key]; !ok {
+			channels[key] = targets
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], line)
+	}
+	for _, key := range order {
+		router.Send(channels[key], "告警恢复", fmt.Sprintf("✅ **告警恢复** [%s]\n\n%s", host, strings.Join(groups[key], "\n")))
+	}
+}
+
+// findingAlerts 为检查结果中的每个异常计算指纹并生成外部告警，严重程度与检查项的通知事件一致
+func findingAlerts(result *CheckResult, event notify.Event) []notify.ExternalAlert {
+	alerts := make([]notify.ExternalAlert, 0, len(result.Findings))
+	for i := range result.Findings {
+		finding := &result.Findings[i]
+		finding.Fingerprint = notify.Fingerprint(event.Host, result.Check, finding.Title)
+		alert := notify.ExternalAlert{Fingerprint: finding.Fingerprint, Event: event}
+		alert.Event.Title = finding.Title
+		alert.Event.Content = finding.Detail
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+var (
+	// alertTracker 跟踪已推送到外部告警系统、尚未恢复的异常
+	alertTracker = notify.NewAlertTracker()
+	// restoreAlerts 第一次推送前从上一次巡检记录恢复未关闭的告警，重启后已恢复的异常仍能自动关闭
+	restoreAlerts sync.Once
+	// exportTimeout 一轮外部告警推送（含重试）的总超时
+	exportTimeout = time.Minute
+)
+
+// exportAlerts 将本轮异常推送到外部告警系统，并为上一轮存在、本轮消失的异常发送恢复通知
+// 推送结果记录在异常和 run.Resolved 上；推送失败时按通知路由发送一条警告，值班系统收不到告警这件事本身可见
+func exportAlerts(run *Run, alerts []notify.ExternalAlert, held []string) {
+	integrations := notify.DefaultIntegrations()
+	if !integrations.Enabled() {
+		return
+	}
+	restoreAlerts.Do(func() { alertTracker.Restore(previousAlerts(run)) })
+
+	firing, resolved := alertTracker.Observe(time.Now(), alerts, held)
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	deliveries := integrations.Push(ctx, append(firing, resolved...))
+
+	var failures []string
+	record := func(title string, ds []notify.Delivery) {
+		for _, d := range ds {
+			if !d.OK {
+				failures = append(failures, fmt.Sprintf("- %s %s (%s): %s，已尝试 %d 次", d.Target, d.Action, title, d.Error, d.Attempts))
+			}
+		}
+	}
+	for _, result := range run.Results {
+		for i := range result.Findings {
+			finding := &result.Findings[i]
+			if ds, ok := deliveries[finding.Fingerprint]; ok {
+				finding.Deliveries = ds
+				record(finding.Title, ds)
+			}
+		}
+	}
+	for _, alert := range resolved {
+		ds := deliveries[alert.Fingerprint]
+		run.Resolved = append(run.Resolved, ResolvedAlert{
+			Fingerprint: alert.Fingerprint,
+			Check:       alert.Event.Category,
+			Title:       alert.Event.Title,
+			Deliveries:  ds,
+		})
+		record(alert.Event.Title+" 恢复", ds)
+	}
+
+	if len(failures) > 0 {
+		logger.Info("❌ 外部告警推送失败:\n%s", strings.Join(failures, "\n"))
+		notify.SendEvent(notify.Event{
+			Severity: notify.SeverityWarning,
+			Category: "integrations",
+			Host:     utils.GetHostname(),
+			Title:    "外部告警推送失败",
+			Content:  "⚠️ **以下告警未能推送到外部告警系统，值班人员可能没有收到**:\n" + strings.Join(failures, "\n"),
+		})
+	}
+}
+
+// previousAlerts 上一次巡检中已推送、尚未恢复的告警
+func previousAlerts(current *Run) []notify.ExternalAlert {
+	host := utils.GetHostname()
+	for _, run := range DefaultStore.List(0) {
+		if run == current {
+			continue
+		}
+		var alerts []notify.ExternalAlert
+		for _, result := range run.Results {
+			for _, finding := range result.Findings {
+				if finding.Fingerprint == "" || len(finding.Deliveries) == 0 {
+					continue
+				}
+				severity := notify.SeverityWarning
+				if result.Critical() {
+					severity = notify.SeverityCritical
+				}
+				alerts = append(alerts, notify.ExternalAlert{
+					Fingerprint: finding.Fingerprint,
+					Event:       notify.Event{Severity: severity, Category: result.Check, Host: resultHost(result, host), Title: finding.Title, Content: finding.Detail},
+					StartsAt:    run.StartedAt,
+				})
+			}
+		}
+		return alerts
+	}
+	return nil
+}
+
+// ReportSections 将异常转换为 AI 分析报告的分段
+func (run *Run) ReportSections() []agent.ReportSection {
+	findings := run.Findings()
+	sections := make([]agent.ReportSection, 0, len(findings))
+	for _, finding := range findings {
+		sections = append(sections, agent.ReportSection{Title: finding.Label(), Detail: finding.Detail, Fenced: finding.Fenced})
+	}
+	return sections
+}
+
+// CleanAIAnalysis 清理 AI 分析结果
+// 标记已过滤的虚拟设备，避免用户混淆
+func CleanAIAnalysis(analysis string) string {
+	analysis = strings.Replace(analysis, "/dev/loop", "[排除] /dev/loop", -1)
+	analysis = strings.Replace(analysis, "/snap", "[排除] /snap", -1)
+	analysis = strings.Replace(analysis, "overlay", "[排除] overlay", -1)
+	return analysis
+}
@@ -0,0 +1,291 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"qwq/internal/config"
+)
+
+// DefaultZombieKillThreshold 非受保护父进程的僵尸数超过该值时才建议终止父进程
+const DefaultZombieKillThreshold = 5
+
+// DefaultProtectedParents 始终受保护的父进程，终止它们会导致主机或所有容器失去服务
+// containerd-shim-runc-v2 等长名称在 ps 的 comm 中被截断为 15 个字符
+var DefaultProtectedParents = []string{
+	"init", "systemd", "containerd", "containerd-shim", "dockerd", "docker-proxy",
+	"sshd", "kubelet", "crio", "conmon", "tini", "dumb-init",
+}
+
+// maxListedZombies 每个父进程在告警中列出的僵尸 PID 数
+const maxListedZombies = 10
+
+// processInfo 进程表中的一行
+type processInfo struct {
+	PID   int
+	PPID  int
+	State string
+	Name  string
+}
+
+// ZombieParent 一个父进程及其未回收的僵尸子进程
+type ZombieParent struct {
+	PID        int      `json:"pid"`
+	Name       string   `json:"name"`                // 父进程名称，进程表中找不到时为空
+	Container  string   `json:"container,omitempty"` // 父进程所在容器 ID（12 位），不在容器中时为空
+	Cgroup     string   `json:"cgroup,omitempty"`    // 父进程的 cgroup 路径
+	Protected  bool     `json:"protected"`           // 父进程受保护，不建议终止
+	Zombies    []int    `json:"zombies"`             // 僵尸子进程 PID
+	Names      []string `json:"names"`               // 僵尸子进程名称（去重）
+	Suggestion []string `json:"suggestion"`          // 建议的处置命令，只供参考，不会自动执行
+	Reasoning  []string `json:"reasoning"`           // 得出建议的理由
+	Escalate   bool     `json:"escalate,omitempty"`  // 僵尸数超过阈值，建议终止父进程
+}
+
+// ZombieAnalysis 僵尸进程的结构化分析
+type ZombieAnalysis struct {
+	Total   int             `json:"total"`
+	Parents []*ZombieParent `json:"parents"` // 按僵尸数从多到少排列
+}
+
+// ZombieAnalyzer 按父进程分析僵尸进程，判断父进程是否受保护、是否运行在容器中，给出分级的处置建议
+type ZombieAnalyzer struct {
+	Shell         ShellFunc
+	Protected     []string // 额外受保护的父进程名称
+	KillThreshold int      // 0 表示 DefaultZombieKillThreshold
+}
+
+// NewZombieAnalyzer 按当前配置创建僵尸进程分析器
+func NewZombieAnalyzer(shell ShellFunc) *ZombieAnalyzer {
+	cfg := config.Current().Patrol.Zombie
+	return &ZombieAnalyzer{Shell: shell, Protected: cfg.Protected, KillThreshold: cfg.KillThreshold}
+}
+
+// parseProcessTable 解析 ps -A -o pid=,ppid=,stat=,comm= 的输出
+func parseProcessTable(out string) []processInfo {
+	var procs []processInfo
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		procs = append(procs, processInfo{PID: pid, PPID: ppid, State: fields[2], Name: strings.Join(fields[3:], " ")})
+	}
+	return procs
+}
+
+// containerIDPattern cgroup 路径中的容器 ID：docker/<id>、docker-<id>.scope、cri-containerd-<id>.scope、libpod-<id>.scope、kubepods 下的 <id>
+var containerIDPattern = regexp.MustCompile(`[/-]([0-9a-f]{64})(?:\.scope)?(?:/|$)`)
+
+// parseCgroup 从 /proc/<pid>/cgroup 中取出 cgroup 路径和容器 ID
+func parseCgroup(out string) (path, container string) {
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		// 格式为 hierarchy-ID:controllers:path，cgroup v2 只有 0::<path> 一行
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			continue
+		}
+		if path == "" || parts[0] == "0" {
+			path = parts[2]
+		}
+		if match := containerIDPattern.FindStringSubmatch(parts[2]); match != nil && container == "" {
+			container = match[1][:12]
+		}
+	}
+	return path, container
+}
+
+// protectedReason 父进程受保护的原因，不受保护时为空
+func (a *ZombieAnalyzer) protectedReason(pid int, name string) string {
+	if pid == 1 {
+		return "PID 1（init 进程）"
+	}
+	for _, protected := range DefaultProtectedParents {
+		if name == protected {
+			return "关键服务 " + name
+		}
+	}
+	for _, protected := range a.Protected {
+		if name == protected {
+			return "配置的受保护进程 " + name
+		}
+	}
+	return ""
+}
+
+// Analyze 读取进程表并按父进程汇总僵尸进程，没有僵尸进程时 Total 为 0
+func (a *ZombieAnalyzer) Analyze(result *CheckResult) (*ZombieAnalysis, error) {
+	res := runShell(result, a.Shell, "ps -A -o pid=,ppid=,stat=,comm=")
+	if !res.OK() {
+		return nil, fmt.Errorf("ps 命令执行失败")
+	}
+	procs := parseProcessTable(res.Stdout)
+	result.Observe("进程表 %d 个进程", len(procs))
+
+	byPID := make(map[int]processInfo, len(procs))
+	for _, proc := range procs {
+		byPID[proc.PID] = proc
+	}
+	analysis := &ZombieAnalysis{}
+	parents := make(map[int]*ZombieParent)
+	for _, proc := range procs {
+		if !strings.HasPrefix(strings.ToUpper(proc.State), "Z") {
+			continue
+		}
+		analysis.Total++
+		parent, ok := parents[proc.PPID]
+		if !ok {
+			parent = &ZombieParent{PID: proc.PPID, Name: byPID[proc.PPID].Name}
+			parents[proc.PPID] = parent
+			analysis.Parents = append(analysis.Parents, parent)
+		}
+		parent.Zombies = append(parent.Zombies, proc.PID)
+		if !containsString(parent.Names, proc.Name) {
+			parent.Names = append(parent.Names, proc.Name)
+		}
+	}
+
+	threshold := a.KillThreshold
+	if threshold <= 0 {
+		threshold = DefaultZombieKillThreshold
+	}
+	for _, parent := range analysis.Parents {
+		a.assess(result, parent, threshold)
+	}
+	sort.SliceStable(analysis.Parents, func(i, j int) bool {
+		return len(analysis.Parents[i].Zombies) > len(analysis.Parents[j].Zombies)
+	})
+	return analysis, nil
+}
+
+// assess 判断父进程是否受保护、是否在容器中，并给出处置建议：先发送 SIGCHLD 提醒父进程回收，
+// 只有非受保护且僵尸数超过阈值的父进程才建议终止
+func (a *ZombieAnalyzer) assess(result *CheckResult, parent *ZombieParent, threshold int) {
+	if parent.PID > 0 {
+		cgroup := runShell(result, a.Shell, fmt.Sprintf("cat /proc/%d/cgroup", parent.PID))
+		if cgroup.OK() {
+			parent.Cgroup, parent.Container = parseCgroup(cgroup.Stdout)
+		}
+	}
+	name := parent.Name
+	if name == "" {
+		name = "未知进程"
+	}
+	count := len(parent.Zombies)
+	parent.Reasoning = append(parent.Reasoning, fmt.Sprintf("%d 个僵尸进程的父进程是 %s (PID %d)，僵尸进程只能由父进程回收，直接终止僵尸进程无效", count, name, parent.PID))
+	if parent.Container != "" {
+		parent.Reasoning = append(parent.Reasoning, fmt.Sprintf("父进程运行在容器 %s 中，通常是容器的主进程没有回收子进程，可考虑为容器启用 init（docker run --init 或 compose 中 init: true）", parent.Container))
+	}
+
+	parent.Suggestion = append(parent.Suggestion, fmt.Sprintf("kill -s SIGCHLD %d", parent.PID))
+	if reason := a.protectedReason(parent.PID, parent.Name); reason != "" {
+		parent.Protected = true
+		parent.Reasoning = append(parent.Reasoning, fmt.Sprintf("⚠️ 父进程是%s，受保护，不要终止它，否则主机或其上的所有容器会中断；僵尸进程本身不占用内存，只占用 PID", reason))
+		if parent.Container != "" {
+			parent.Suggestion = append(parent.Suggestion, "docker restart "+parent.Container)
+		}
+		result.Filter("parent %d (%s) is protected: %s", parent.PID, name, reason)
+		return
+	}
+	if count > threshold {
+		parent.Escalate = true
+		parent.Reasoning = append(parent.Reasoning, fmt.Sprintf("僵尸数 %d 超过阈值 %d，SIGCHLD 之后仍未回收时可终止父进程，僵尸进程会被 init 接管并回收", count, threshold))
+		if parent.Container != "" {
+			parent.Suggestion = append(parent.Suggestion, "docker restart "+parent.Container)
+		} else {
+			parent.Suggestion = append(parent.Suggestion, fmt.Sprintf("kill -TERM %d", parent.PID))
+		}
+	} else {
+		parent.Reasoning = append(parent.Reasoning, fmt.Sprintf("僵尸数未超过阈值 %d，不建议终止父进程，观察是否持续增长", threshold))
+	}
+}
+
+// Markdown 告警详情：每个父进程的僵尸数、是否受保护、建议和理由，同时作为 AI 分析的输入
+func (a *ZombieAnalysis) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "共 %d 个僵尸进程，来自 %d 个父进程。以下命令只是建议，不会自动执行：\n", a.Total, len(a.Parents))
+	for _, parent := range a.Parents {
+		name := parent.Name
+		if name == "" {
+			name = "未知进程"
+		}
+		fmt.Fprintf(&b, "\n- 父进程 %s (PID %d)", name, parent.PID)
+		if parent.Container != "" {
+			fmt.Fprintf(&b, "，容器 %s", parent.Container)
+		}
+		if parent.Protected {
+			b.WriteString("，受保护")
+		}
+		pids := parent.Zombies
+		more := ""
+		if len(pids) > maxListedZombies {
+			more = fmt.Sprintf(" 等 %d 个", len(pids))
+			pids = pids[:maxListedZombies]
+		}
+		fmt.Fprintf(&b, "：僵尸 %d 个 (%s)，PID %s%s\n", len(parent.Zombies), strings.Join(parent.Names, ", "), joinInts(pids), more)
+		for _, reason := range parent.Reasoning {
+			fmt.Fprintf(&b, "  - %s\n", reason)
+		}
+		fmt.Fprintf(&b, "  - 建议: `%s`\n", strings.Join(parent.Suggestion, "`，仍未回收时 `"))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ZombieCheck 僵尸进程检查（状态为 Z 的进程），按父进程给出结构化的分析和处置建议
+type ZombieCheck struct {
+	Shell    ShellFunc
+	Analyzer *ZombieAnalyzer // 为空时按当前配置创建
+}
+
+// Name 检查项名称
+func (c *ZombieCheck) Name() string { return "zombie" }
+
+// Run 执行僵尸进程检查
+func (c *ZombieCheck) Run(ctx context.Context) *CheckResult {
+	result := NewCheckResult(c.Name())
+
+	analyzer := c.Analyzer
+	if analyzer == nil {
+		analyzer = NewZombieAnalyzer(c.Shell)
+	}
+	analysis, err := analyzer.Analyze(result)
+	if err != nil {
+		result.Skip(err.Error())
+		return result
+	}
+
+	result.Observe("僵尸进程 %d 个，父进程 %d 个", analysis.Total, len(analysis.Parents))
+	if analysis.Total == 0 {
+		result.Threshold("0 个僵尸进程")
+		return result
+	}
+	result.Threshold("%d > 0", analysis.Total)
+	result.Alert(Finding{Title: "僵尸进程", Detail: analysis.Markdown()})
+	return result
+}
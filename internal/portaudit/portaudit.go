@@ -0,0 +1,410 @@
+// Package portaudit 在启动 Compose 项目或安装应用之前检查主机端口：
+// 解析待发布的端口，与主机上正在监听的 socket、其他项目和应用实例发布的端口比较，
+// 有冲突时在创建任何容器之前返回结构化报告（端口、占用者、建议的替代端口）
+package portaudit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 端口占用者类型
+const (
+	KindProcess   = "process"   // 主机上监听的进程
+	KindContainer = "container" // 正在运行的容器
+	KindProject   = "project"   // qwq 管理的 Compose 项目
+	KindApp       = "app"       // 应用商店实例
+	KindService   = "service"   // 同一项目中的另一个服务
+)
+
+// maxSuggestPort 建议替代端口的上限
+const maxSuggestPort = 65535
+
+// ErrPortConflict 待发布的主机端口已被占用
+var ErrPortConflict = errors.New("host port conflict")
+
+// Binding 待发布到主机的端口
+type Binding struct {
+	Service string `json:"service"`
+	HostIP  string `json:"host_ip,omitempty"` // 为空表示所有网卡
+	Port    int    `json:"port"`
+	Proto   string `json:"proto"`
+}
+
+// Claim 其他项目、应用或容器已发布的端口
+type Claim struct {
+	Kind    string `json:"kind"`
+	Owner   string `json:"owner"`             // 项目名、实例名或容器名
+	Project string `json:"project,omitempty"` // 所属 Compose 项目，用于排除正在部署的项目自身
+	HostIP  string `json:"host_ip,omitempty"`
+	Port    int    `json:"port"`
+	Proto   string `json:"proto"`
+}
+
+// Source 提供一类已发布端口，如数据库中的项目或应用实例
+type Source func(ctx context.Context) ([]Claim, error)
+
+// Conflict 一个被占用的端口
+type Conflict struct {
+	Binding
+	OwnerKind     string `json:"owner_kind"`
+	Owner         string `json:"owner"`
+	SuggestedPort int    `json:"suggested_port,omitempty"` // 下一个可用端口
+	Parameter     string `json:"parameter,omitempty"`      // 可自动改用 SuggestedPort 的模板参数
+}
+
+// Report 端口检查结果
+type Report struct {
+	Checked   int        `json:"checked"`
+	Conflicts []Conflict `json:"conflicts"`
+	Errors    []string   `json:"errors,omitempty"` // 无法解析的端口定义或读取失败的来源，不阻止部署
+}
+
+// Err 有冲突时返回 *ConflictError，否则返回 nil
+func (r *Report) Err() error {
+	if len(r.Conflicts) == 0 {
+		return nil
+	}
+	return &ConflictError{Report: r}
+}
+
+// ConflictError 端口冲突错误，Details 返回完整报告
+type ConflictError struct {
+	Report *Report
+}
+
+func (e *ConflictError) Error() string {
+	parts := make([]string, 0, len(e.Report.Conflicts))
+	for _, c := range e.Report.Conflicts {
+		part := fmt.Sprintf("%d/%s (%s) is used by %s %s", c.Port, c.Proto, c.Service, c.OwnerKind, c.Owner)
+		if c.SuggestedPort > 0 {
+			part += fmt.Sprintf(", try %d", c.SuggestedPort)
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("%s: %s", ErrPortConflict, strings.Join(parts, "; "))
+}
+
+func (e *ConflictError) Unwrap() error { return ErrPortConflict }
+
+// Details 返回给 API 客户端的结构化报告
+func (e *ConflictError) Details() interface{} { return e.Report }
+
+// ParsePort 解析 compose 端口定义，支持短格式（"8080:80"、"127.0.0.1:8080:80/udp"、"8000-8001:80-81"）
+// 和长格式（published/target/protocol/host_ip）；没有指定主机端口时由 Docker 随机分配，不返回绑定
+func ParsePort(service string, spec interface{}) ([]Binding, error) {
+	switch v := spec.(type) {
+	case string:
+		return parseShort(service, v)
+	case int, float64:
+		return nil, nil // 只有容器端口
+	case map[string]interface{}:
+		return parseLong(service, v)
+	}
+	return nil, fmt.Errorf("service %s: unsupported port definition %v", service, spec)
+}
+
+func parseShort(service, spec string) ([]Binding, error) {
+	spec = strings.TrimSpace(spec)
+	proto := "tcp"
+	if base, p, ok := strings.Cut(spec, "/"); ok {
+		spec, proto = base, strings.ToLower(p)
+	}
+	sep := strings.LastIndex(spec, ":")
+	if sep < 0 {
+		return nil, nil
+	}
+	host := spec[:sep]
+	hostIP := ""
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		hostIP, host = strings.Trim(host[:i], "[]"), host[i+1:]
+	}
+	if host == "" {
+		return nil, nil
+	}
+	ports, err := parseRange(host)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: invalid port mapping %q", service, spec)
+	}
+	return bindings(service, hostIP, proto, ports), nil
+}
+
+func parseLong(service string, spec map[string]interface{}) ([]Binding, error) {
+	proto, _ := spec["protocol"].(string)
+	if proto == "" {
+		proto = "tcp"
+	}
+	hostIP, _ := spec["host_ip"].(string)
+	var published string
+	switch v := spec["published"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		published = v
+	case int:
+		published = strconv.Itoa(v)
+	case float64:
+		published = strconv.Itoa(int(v))
+	}
+	ports, err := parseRange(published)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: invalid published port %v", service, spec["published"])
+	}
+	return bindings(service, hostIP, strings.ToLower(proto), ports), nil
+}
+
+func parseRange(value string) ([]int, error) {
+	first, last, isRange := strings.Cut(value, "-")
+	start, err := strconv.Atoi(first)
+	if err != nil || start <= 0 || start > maxSuggestPort {
+		return nil, fmt.Errorf("invalid port %q", value)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.Atoi(last); err != nil || end < start || end > maxSuggestPort {
+			return nil, fmt.Errorf("invalid port range %q", value)
+		}
+	}
+	ports := make([]int, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func bindings(service, hostIP, proto string, ports []int) []Binding {
+	result := make([]Binding, 0, len(ports))
+	for _, port := range ports {
+		result = append(result, Binding{Service: service, HostIP: hostIP, Port: port, Proto: proto})
+	}
+	return result
+}
+
+// ParseServices 解析各服务的端口定义，服务按名称排序；无法解析的定义记录在 errs 中
+func ParseServices(ports map[string][]interface{}) (result []Binding, errs []string) {
+	names := make([]string, 0, len(ports))
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, spec := range ports[name] {
+			parsed, err := ParsePort(name, spec)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			result = append(result, parsed...)
+		}
+	}
+	return result, errs
+}
+
+// isWildcard 监听地址是否为所有网卡
+func isWildcard(address string) bool {
+	if address == "" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// overlaps 两个监听地址的端口是否互相占用：任一方监听所有网卡，或地址相同
+func overlaps(a, b string) bool {
+	if isWildcard(a) || isWildcard(b) {
+		return true
+	}
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return a == b
+}
+
+// Options 单次检查的参数
+type Options struct {
+	// Project 正在部署的项目名，该项目自身发布的端口（包括正在运行的容器）不算冲突
+	Project string
+	// Claims 调用方已知的其他占用，与注册的来源合并
+	Claims []Claim
+}
+
+// Checker 端口检查器
+type Checker struct {
+	// Sockets 读取主机上正在监听的 socket
+	Sockets func() ([]Socket, error)
+	// Process 按 socket inode 查找进程名，找不到时返回空字符串
+	Process func(inode uint64) string
+
+	mu      sync.RWMutex
+	sources map[string]Source
+}
+
+// NewChecker 创建读取 /proc/net 的端口检查器
+func NewChecker() *Checker {
+	return &Checker{Sockets: ListSockets, Process: ProcessName}
+}
+
+// Default 全局端口检查器，启动时注册项目、应用实例和容器来源
+var Default = NewChecker()
+
+// SetSource 注册或替换（source 为 nil 时删除）一类已发布端口
+func (c *Checker) SetSource(name string, source Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if source == nil {
+		delete(c.sources, name)
+		return
+	}
+	if c.sources == nil {
+		c.sources = make(map[string]Source)
+	}
+	c.sources[name] = source
+}
+
+// claims 汇总调用方传入和所有来源的占用，重复的占用只保留一条；
+// 正在部署的项目自身的占用单独返回，不算冲突
+func (c *Checker) claims(ctx context.Context, opts Options, report *Report) (others, own []Claim) {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.sources))
+	sources := make(map[string]Source, len(c.sources))
+	for name, source := range c.sources {
+		names = append(names, name)
+		sources[name] = source
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	all := append([]Claim(nil), opts.Claims...)
+	for _, name := range names {
+		claims, err := sources[name](ctx)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		all = append(all, claims...)
+	}
+
+	seen := make(map[Claim]bool, len(all))
+	for _, claim := range all {
+		if claim.Proto == "" {
+			claim.Proto = "tcp"
+		}
+		if seen[claim] {
+			continue
+		}
+		seen[claim] = true
+		if opts.Project != "" && claim.Project == opts.Project {
+			own = append(own, claim)
+		} else {
+			others = append(others, claim)
+		}
+	}
+	return others, own
+}
+
+// Audit 检查待发布的端口，返回的报告中 Conflicts 为空表示可以部署
+// 冲突按其他项目和应用、主机上监听的 socket、同一项目中更早的服务的顺序查找占用者
+func (c *Checker) Audit(ctx context.Context, bindings []Binding, opts Options) *Report {
+	report := &Report{Checked: len(bindings), Conflicts: make([]Conflict, 0)}
+	if len(bindings) == 0 {
+		return report
+	}
+	others, own := c.claims(ctx, opts, report)
+
+	var sockets []Socket
+	if c.Sockets != nil {
+		var err error
+		if sockets, err = c.Sockets(); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("listening sockets: %v", err))
+		}
+	}
+
+	used := make(map[string]bool)
+	mark := func(port int, proto string) { used[portKey(port, proto)] = true }
+	for _, s := range sockets {
+		mark(s.Port, s.Proto)
+	}
+	for _, claim := range others {
+		mark(claim.Port, claim.Proto)
+	}
+	for _, b := range bindings {
+		mark(b.Port, b.Proto)
+	}
+
+	for i, b := range bindings {
+		conflict, found := Conflict{Binding: b}, false
+		for _, claim := range others {
+			if claim.Port == b.Port && claim.Proto == b.Proto && overlaps(claim.HostIP, b.HostIP) {
+				conflict.OwnerKind, conflict.Owner, found = claim.Kind, claim.Owner, true
+				break
+			}
+		}
+		if !found {
+			// 正在部署的项目自身的容器占用的端口会在重建时释放，对应的 socket 不算冲突
+			for _, s := range sockets {
+				if s.Port == b.Port && s.Proto == b.Proto && overlaps(s.Address, b.HostIP) && !ownedBy(own, s) {
+					conflict.OwnerKind, conflict.Owner, found = KindProcess, c.processLabel(s), true
+					break
+				}
+			}
+		}
+		if !found {
+			for _, earlier := range bindings[:i] {
+				if earlier.Port == b.Port && earlier.Proto == b.Proto && overlaps(earlier.HostIP, b.HostIP) {
+					conflict.OwnerKind, conflict.Owner, found = KindService, earlier.Service, true
+					break
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		if conflict.SuggestedPort = nextFree(b.Port, b.Proto, used); conflict.SuggestedPort > 0 {
+			mark(conflict.SuggestedPort, b.Proto)
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+	return report
+}
+
+func portKey(port int, proto string) string {
+	return strconv.Itoa(port) + "/" + proto
+}
+
+// ownedBy socket 是否由正在部署的项目自身的容器发布
+func ownedBy(own []Claim, s Socket) bool {
+	for _, claim := range own {
+		if claim.Kind == KindContainer && claim.Port == s.Port && claim.Proto == s.Proto && overlaps(claim.HostIP, s.Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// processLabel socket 占用者的描述，找不到进程时显示监听地址
+func (c *Checker) processLabel(s Socket) string {
+	address := net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+	if c.Process != nil && s.Inode != 0 {
+		if name := c.Process(s.Inode); name != "" {
+			return fmt.Sprintf("%s (%s)", name, address)
+		}
+	}
+	return address
+}
+
+// nextFree 从 port+1 开始查找没有被占用的端口
+func nextFree(port int, proto string, used map[string]bool) int {
+	for candidate := port + 1; candidate <= maxSuggestPort; candidate++ {
+		if !used[portKey(candidate, proto)] {
+			return candidate
+		}
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package portaudit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fakeProcNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F91 0100007F:D431 01 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+`
+
+const fakeProcNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:1538 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0
+`
+
+func TestParseProcNet(t *testing.T) {
+	sockets, err := ParseProcNet([]byte(fakeProcNetTCP), "tcp")
+	if err != nil {
+		t.Fatalf("ParseProcNet failed: %v", err)
+	}
+	want := []Socket{
+		{Address: "0.0.0.0", Port: 8080, Proto: "tcp", Inode: 1001},
+		{Address: "127.0.0.1", Port: 3306, Proto: "tcp", Inode: 1002},
+	}
+	if !reflect.DeepEqual(sockets, want) {
+		t.Errorf("Expected only listening sockets %v, got %v", want, sockets)
+	}
+
+	sockets, err = ParseProcNet([]byte(fakeProcNetTCP6), "tcp")
+	if err != nil {
+		t.Fatalf("ParseProcNet tcp6 failed: %v", err)
+	}
+	if len(sockets) != 1 || sockets[0].Address != "::1" || sockets[0].Port != 5432 {
+		t.Errorf("Expected ::1:5432, got %v", sockets)
+	}
+
+	if _, err := ParseProcNet([]byte("header\n 0: ZZ:1F90 00000000:0000 0A 0 0 0 0 0 1 1\n"), "tcp"); err == nil {
+		t.Error("Expected malformed address to fail")
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		spec interface{}
+		want []Binding
+	}{
+		{"8080:80", []Binding{{Service: "web", Port: 8080, Proto: "tcp"}}},
+		{"127.0.0.1:5353:53/UDP", []Binding{{Service: "web", HostIP: "127.0.0.1", Port: 5353, Proto: "udp"}}},
+		{"[::1]:9000:9000", []Binding{{Service: "web", HostIP: "::1", Port: 9000, Proto: "tcp"}}},
+		{"8000-8001:80-81", []Binding{{Service: "web", Port: 8000, Proto: "tcp"}, {Service: "web", Port: 8001, Proto: "tcp"}}},
+		{"80", nil},
+		{"127.0.0.1::80", nil},
+		{80, nil},
+		{map[string]interface{}{"target": 80, "published": "8443", "host_ip": "0.0.0.0"}, []Binding{{Service: "web", HostIP: "0.0.0.0", Port: 8443, Proto: "tcp"}}},
+		{map[string]interface{}{"target": 80}, nil},
+	}
+	for _, tt := range tests {
+		got, err := ParsePort("web", tt.spec)
+		if err != nil {
+			t.Errorf("ParsePort(%v) failed: %v", tt.spec, err)
+			continue
+		}
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePort(%v) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []interface{}{"abc:80", "9000-8000:80", "70000:80", true} {
+		if _, err := ParsePort("web", spec); err == nil {
+			t.Errorf("Expected ParsePort(%v) to fail", spec)
+		}
+	}
+}
+
+func fakeChecker(sockets ...Socket) *Checker {
+	return &Checker{
+		Sockets: func() ([]Socket, error) { return sockets, nil },
+		Process: func(inode uint64) string {
+			if inode == 1001 {
+				return "nginx[42]"
+			}
+			return ""
+		},
+	}
+}
+
+func TestAudit_SocketsAndProjects(t *testing.T) {
+	checker := fakeChecker(
+		Socket{Address: "0.0.0.0", Port: 8080, Proto: "tcp", Inode: 1001},
+		Socket{Address: "127.0.0.1", Port: 3306, Proto: "tcp", Inode: 1002},
+		Socket{Address: "0.0.0.0", Port: 9090, Proto: "tcp", Inode: 1003},
+	)
+	// 另一个项目发布了 8081，正在部署的 shop 项目自己的容器占用 9090
+	checker.SetSource("projects", func(ctx context.Context) ([]Claim, error) {
+		return []Claim{
+			{Kind: KindProject, Owner: "blog", Project: "blog", Port: 8081, Proto: "tcp"},
+			{Kind: KindProject, Owner: "shop", Project: "shop", Port: 9090, Proto: "tcp"},
+		}, nil
+	})
+	checker.SetSource("containers", func(ctx context.Context) ([]Claim, error) {
+		return []Claim{{Kind: KindContainer, Owner: "shop-api-1", Project: "shop", Port: 9090, Proto: "tcp"}}, nil
+	})
+	checker.SetSource("broken", func(ctx context.Context) ([]Claim, error) {
+		return nil, errors.New("database is locked")
+	})
+
+	bindings, errs := ParseServices(map[string][]interface{}{
+		"web":   {"8080:80", "8081:81"},
+		"api":   {"9090:9090"},
+		"db":    {"127.0.0.2:3306:3306"},
+		"cache": {"127.0.0.1:3306:6379"},
+		"proxy": {"8443:443"},
+		"admin": {"8443:443"},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected parse errors: %v", errs)
+	}
+
+	report := checker.Audit(context.Background(), bindings, Options{Project: "shop"})
+	type result struct {
+		service, kind, owner string
+		port, suggested      int
+	}
+	var got []result
+	for _, c := range report.Conflicts {
+		got = append(got, result{c.Service, c.OwnerKind, c.Owner, c.Port, c.SuggestedPort})
+	}
+	want := []result{
+		{"cache", KindProcess, "127.0.0.1:3306", 3306, 3307},
+		{"proxy", KindService, "admin", 8443, 8444},
+		{"web", KindProcess, "nginx[42] (0.0.0.0:8080)", 8080, 8082},
+		{"web", KindProject, "blog", 8081, 8083},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected conflicts:\n got %v\nwant %v", got, want)
+	}
+	if report.Checked != 7 || len(report.Errors) != 1 || !strings.Contains(report.Errors[0], "broken") {
+		t.Errorf("Expected 7 checked bindings and one source error, got %d %v", report.Checked, report.Errors)
+	}
+
+	err := report.Err()
+	var conflictErr *ConflictError
+	if !errors.Is(err, ErrPortConflict) || !errors.As(err, &conflictErr) || conflictErr.Details() != report {
+		t.Fatalf("Expected ConflictError wrapping ErrPortConflict, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "8081/tcp (web) is used by project blog, try 8083") {
+		t.Errorf("Expected readable conflict list, got %q", err)
+	}
+}
+
+func TestAudit_NoConflicts(t *testing.T) {
+	checker := fakeChecker(Socket{Address: "127.0.0.1", Port: 8080, Proto: "tcp"})
+	claims := []Claim{{Kind: KindApp, Owner: "wordpress-1", HostIP: "127.0.0.1", Port: 9000}}
+	bindings := []Binding{
+		{Service: "web", HostIP: "192.168.1.10", Port: 8080, Proto: "tcp"},
+		{Service: "web", Port: 8080, Proto: "udp"},
+		{Service: "php", HostIP: "192.168.1.10", Port: 9000, Proto: "tcp"},
+	}
+	report := checker.Audit(context.Background(), bindings, Options{Claims: claims})
+	if err := report.Err(); err != nil {
+		t.Errorf("Expected different addresses and protocols not to conflict, got %v", err)
+	}
+
+	// 调用方传入的占用和监听所有网卡的端口冲突
+	report = checker.Audit(context.Background(), []Binding{{Service: "php", Port: 9000, Proto: "tcp"}}, Options{Claims: claims})
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Owner != "wordpress-1" || report.Conflicts[0].SuggestedPort != 9001 {
+		t.Errorf("Expected conflict with the app instance, got %+v", report.Conflicts)
+	}
+}
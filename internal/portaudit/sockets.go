@@ -0,0 +1,120 @@
+package portaudit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procNetFiles 列出监听 socket 的 /proc/net 文件和对应协议
+var procNetFiles = []struct{ path, proto string }{
+	{"/proc/net/tcp", "tcp"},
+	{"/proc/net/tcp6", "tcp"},
+	{"/proc/net/udp", "udp"},
+	{"/proc/net/udp6", "udp"},
+}
+
+// Socket 主机上正在监听的 socket
+type Socket struct {
+	Address string // 监听地址，0.0.0.0 或 :: 表示所有网卡
+	Port    int
+	Proto   string
+	Inode   uint64
+}
+
+// ListSockets 读取 /proc/net 下正在监听的 TCP socket 和已绑定的 UDP socket
+// 某个文件不存在（如未启用 IPv6）时跳过
+func ListSockets() ([]Socket, error) {
+	var sockets []Socket
+	for _, file := range procNetFiles {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		parsed, err := ParseProcNet(data, file.proto)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.path, err)
+		}
+		sockets = append(sockets, parsed...)
+	}
+	return sockets, nil
+}
+
+// ParseProcNet 解析 /proc/net/{tcp,tcp6,udp,udp6} 的内容
+// TCP 只保留 LISTEN（0A）状态，UDP 只保留未连接（07）的 socket
+func ParseProcNet(data []byte, proto string) ([]Socket, error) {
+	state := "0A"
+	if proto == "udp" {
+		state = "07"
+	}
+	var sockets []Socket
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line == 0 || len(fields) < 10 {
+			continue // 表头
+		}
+		if fields[3] != state {
+			continue
+		}
+		address, port, err := parseHexAddress(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+1, err)
+		}
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+		sockets = append(sockets, Socket{Address: address, Port: port, Proto: proto, Inode: inode})
+	}
+	return sockets, scanner.Err()
+}
+
+// parseHexAddress 解析 "0100007F:1F90" 形式的地址，IP 按 4 字节一组以主机字节序（小端）存放
+func parseHexAddress(value string) (string, int, error) {
+	hexIP, hexPort, ok := strings.Cut(value, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address %q", value)
+	}
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", value)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", value)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return ip.String(), int(port), nil
+}
+
+// ProcessName 在 /proc/*/fd 中查找持有该 socket 的进程，返回 "名称[pid]"
+// 没有权限读取其他进程或找不到时返回空字符串
+func ProcessName(inode uint64) string {
+	target := fmt.Sprintf("socket:[%d]", inode)
+	pids, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range pids {
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || link != target {
+				continue
+			}
+			comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+			return fmt.Sprintf("%s[%s]", strings.TrimSpace(string(comm)), filepath.Base(dir))
+		}
+	}
+	return ""
+}
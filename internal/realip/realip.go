@@ -0,0 +1,144 @@
+// Package realip 在 qwq 运行于 nginx 反向代理或网关之后时解析真实客户端地址
+package realip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"qwq/internal/config"
+)
+
+const (
+	HeaderForwardedFor   = "X-Forwarded-For"
+	HeaderRealIP         = "X-Real-IP"
+	HeaderForwardedProto = "X-Forwarded-Proto"
+)
+
+// ErrInvalidProxy trusted_proxies 中的条目不是 IP 或 CIDR
+var ErrInvalidProxy = errors.New("invalid trusted proxy")
+
+// ParseTrusted 解析可信代理列表，条目为 CIDR（10.0.0.0/8）或单个 IP
+func ParseTrusted(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func trusted(addr netip.Addr, proxies []netip.Prefix) bool {
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddr 直连对端的地址
+func peerAddr(r *http.Request) (netip.Addr, string) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, host
+	}
+	return addr.Unmap(), addr.Unmap().String()
+}
+
+// PeerTrusted 直连对端是否为可信代理
+func PeerTrusted(r *http.Request, proxies []netip.Prefix) bool {
+	addr, _ := peerAddr(r)
+	return addr.IsValid() && trusted(addr, proxies)
+}
+
+// Resolve 解析真实客户端地址。直连对端不是可信代理时直接使用对端地址，转发头一律忽略；
+// 否则从右向左遍历 X-Forwarded-For，跳过可信代理，第一个不可信的地址即客户端（左侧的条目可能由客户端伪造）。
+// 没有 X-Forwarded-For 时使用 X-Real-IP；整条链都是可信代理时使用最左侧的地址
+func Resolve(r *http.Request, proxies []netip.Prefix) string {
+	peer, peerHost := peerAddr(r)
+	if !peer.IsValid() || !trusted(peer, proxies) {
+		return peerHost
+	}
+
+	var chain []string
+	for _, value := range r.Header.Values(HeaderForwardedFor) {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				chain = append(chain, hop)
+			}
+		}
+	}
+	if len(chain) == 0 {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(HeaderRealIP))); err == nil {
+			return addr.Unmap().String()
+		}
+		return peerHost
+	}
+
+	client := peerHost
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(chain[i])
+		if err != nil {
+			// 无法解析的条目之后的内容不可信，使用最后一个可信代理记录的地址
+			break
+		}
+		client = addr.Unmap().String()
+		if !trusted(addr.Unmap(), proxies) {
+			break
+		}
+	}
+	return client
+}
+
+type contextKey struct{}
+
+// WithClientIP 在 context 中记录客户端地址
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromRequest 请求的客户端地址，优先使用 Middleware 已解析的结果，否则按当前的可信代理配置解析
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+	return Resolve(r, Proxies())
+}
+
+// Proxies 当前配置的可信代理，配置无效时（已由配置校验报告）不信任任何代理
+func Proxies() []netip.Prefix {
+	proxies, err := ParseTrusted(config.Current().TrustedProxies)
+	if err != nil {
+		return nil
+	}
+	return proxies
+}
+
+// Middleware 解析真实客户端地址并写入请求 context，处理器通过 FromRequest 读取
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), Resolve(r, Proxies()))))
+	})
+}
@@ -0,0 +1,79 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"qwq/internal/config"
+)
+
+func request(peer string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	r.RemoteAddr = peer
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	proxies, err := ParseTrusted([]string{"127.0.0.1", "10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"direct client", "203.0.113.9:51000", nil, "203.0.113.9"},
+		{"spoofed headers from untrusted peer", "203.0.113.9:51000", map[string]string{HeaderForwardedFor: "1.1.1.1", HeaderRealIP: "1.1.1.1"}, "203.0.113.9"},
+		{"local nginx", "127.0.0.1:40000", map[string]string{HeaderForwardedFor: "198.51.100.7", HeaderRealIP: "198.51.100.7"}, "198.51.100.7"},
+		{"real ip header only", "127.0.0.1:40000", map[string]string{HeaderRealIP: "198.51.100.7"}, "198.51.100.7"},
+		{"trusted peer without headers", "127.0.0.1:40000", nil, "127.0.0.1"},
+		// 客户端自己带了伪造的 X-Forwarded-For，nginx 把真实地址追加在右侧
+		{"spoof through trusted proxy", "127.0.0.1:40000", map[string]string{HeaderForwardedFor: "6.6.6.6, 198.51.100.7"}, "198.51.100.7"},
+		// 网关 -> 内网 nginx -> qwq，链上的可信代理都被跳过
+		{"chained proxies", "10.0.0.3:40000", map[string]string{HeaderForwardedFor: "6.6.6.6, 198.51.100.7, 10.0.0.2, 10.0.0.5"}, "198.51.100.7"},
+		{"all hops trusted", "10.0.0.3:40000", map[string]string{HeaderForwardedFor: "10.0.0.9, 10.0.0.2"}, "10.0.0.9"},
+		{"garbage hop", "127.0.0.1:40000", map[string]string{HeaderForwardedFor: "198.51.100.7, not-an-ip, 10.0.0.2"}, "10.0.0.2"},
+		{"ipv6 loopback proxy", "[::1]:40000", map[string]string{HeaderForwardedFor: "2001:db8::1"}, "2001:db8::1"},
+		{"ipv4-mapped peer", "[::ffff:127.0.0.1]:40000", map[string]string{HeaderForwardedFor: "198.51.100.7"}, "198.51.100.7"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Resolve(request(tc.peer, tc.headers), proxies); got != tc.want {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTrusted_Invalid(t *testing.T) {
+	if _, err := ParseTrusted([]string{"10.0.0.0/8", "nginx"}); err == nil {
+		t.Error("Expected an error for a non-IP entry")
+	}
+}
+
+func TestMiddleware_UsesConfiguredProxies(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.TrustedProxies = []string{"127.0.0.1"} })
+
+	var got string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), request("127.0.0.1:40000", map[string]string{HeaderForwardedFor: "198.51.100.7"}))
+	if got != "198.51.100.7" {
+		t.Errorf("Expected forwarded client from a trusted proxy, got %s", got)
+	}
+
+	// 默认不信任任何代理
+	config.Update(func(cfg *config.Config) { cfg.TrustedProxies = nil })
+	handler.ServeHTTP(httptest.NewRecorder(), request("127.0.0.1:40000", map[string]string{HeaderForwardedFor: "198.51.100.7"}))
+	if got != "127.0.0.1" {
+		t.Errorf("Expected forwarded headers to be ignored without trusted proxies, got %s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"qwq/internal/utils"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Executor 执行 shell 命令的目标：本机或一台远程主机
+type Executor interface {
+	// Name 目标名称，本机为 local
+	Name() string
+	// Run 执行命令，超时和输出截断规则与 utils.RunShellWith 相同
+	Run(ctx context.Context, cmd string, opts utils.ShellOptions) *utils.ShellResult
+}
+
+// Local 在本机执行命令
+var Local Executor = localExecutor{}
+
+type localExecutor struct{}
+
+func (localExecutor) Name() string { return LocalName }
+
+func (localExecutor) Run(ctx context.Context, cmd string, opts utils.ShellOptions) *utils.ShellResult {
+	return utils.RunShellWith(ctx, cmd, opts)
+}
+
+// sshExecutor 通过连接池中的 SSH 连接在远程主机上执行命令，每条命令一个会话
+type sshExecutor struct {
+	host Host
+	pool *Pool
+}
+
+func (e *sshExecutor) Name() string { return e.host.Name }
+
+// Run 在远程主机上执行命令；超时或 ctx 取消时向远程进程发送 KILL 并关闭会话，已产生的输出保留在结果中
+func (e *sshExecutor) Run(parent context.Context, cmd string, opts utils.ShellOptions) *utils.ShellResult {
+	result := &utils.ShellResult{Command: cmd, ExitCode: -1}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = utils.ConfiguredTimeout()
+	}
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		result.Timeout = timeout
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	session, err := e.pool.session(ctx, e.host)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Err = err.Error()
+		return result
+	}
+	defer session.Close()
+
+	stdout, stderr := utils.NewShellOutput(opts.Stdout), utils.NewShellOutput(opts.Stderr)
+	session.Stdout, session.Stderr = stdout, stderr
+	done := make(chan error, 1)
+	go func() { done <- session.Run(cmd) }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		err = <-done
+	}
+	result.Duration = time.Since(start)
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+	result.Truncated = stdout.Truncated() || stderr.Truncated()
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+	}
+	if parent.Err() != nil {
+		result.Cancelled = true
+	} else if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		result.TimedOut = true
+	} else if err != nil {
+		result.Err = err.Error()
+	}
+	return result
+}
+
+// ShellFunc 把执行目标转换为只接收命令的函数，供巡检检查项使用
+func ShellFunc(executor Executor) func(cmd string) *utils.ShellResult {
+	return func(cmd string) *utils.ShellResult {
+		return executor.Run(context.Background(), cmd, utils.ShellOptions{})
+	}
+}
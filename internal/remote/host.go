@@ -0,0 +1,202 @@
+// Package remote 管理通过 SSH 巡检和执行命令的远程主机：主机保存在数据库中，
+// 命令通过 Executor 在本机或指定的远程主机上执行，每台主机复用一个 SSH 连接
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidHost 主机参数无效
+	ErrInvalidHost = errors.New("invalid remote host")
+	// ErrHostNotFound 主机不存在
+	ErrHostNotFound = errors.New("remote host not found")
+	// ErrHostExists 同名主机已存在
+	ErrHostExists = errors.New("remote host already exists")
+)
+
+// LocalName 本机的名称，/host local 和 /api/stats?host=local 表示本机
+const LocalName = "local"
+
+// DefaultPort SSH 默认端口
+const DefaultPort = 22
+
+// AuthMethod 认证方式
+type AuthMethod string
+
+const (
+	AuthKey   AuthMethod = "key"   // 私钥文件
+	AuthAgent AuthMethod = "agent" // SSH_AUTH_SOCK 指向的 ssh-agent
+)
+
+// hostNamePattern 主机名称只能包含字母、数字、点、下划线和连字符
+var hostNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// Host 远程主机
+type Host struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name" gorm:"uniqueIndex;not null"` // 巡检异常、监控数据和 /host 命令中使用的名称
+	Address   string     `json:"address" gorm:"not null"`          // 主机名或 IP
+	Port      int        `json:"port"`                             // 默认 22
+	User      string     `json:"user" gorm:"not null"`
+	Auth      AuthMethod `json:"auth"`                                              // key 或 agent，默认 key
+	KeyFile   string     `json:"key_file,omitempty"`                                // Auth 为 key 时使用的私钥文件
+	Labels    []string   `json:"labels,omitempty" gorm:"type:text;serializer:json"` // 分组标签，如 web、db
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Validate 检查参数并填充默认值
+func (h *Host) Validate() error {
+	switch {
+	case !hostNamePattern.MatchString(h.Name):
+		return fmt.Errorf("%w: name must be letters, digits, '.', '_' or '-'", ErrInvalidHost)
+	case h.Name == LocalName:
+		return fmt.Errorf("%w: %q is reserved for this machine", ErrInvalidHost, LocalName)
+	case h.Address == "":
+		return fmt.Errorf("%w: address is required", ErrInvalidHost)
+	case h.User == "":
+		return fmt.Errorf("%w: user is required", ErrInvalidHost)
+	}
+	if h.Port == 0 {
+		h.Port = DefaultPort
+	}
+	if h.Port < 1 || h.Port > 65535 {
+		return fmt.Errorf("%w: invalid port %d", ErrInvalidHost, h.Port)
+	}
+	if h.Auth == "" {
+		h.Auth = AuthKey
+	}
+	switch h.Auth {
+	case AuthKey:
+		if h.KeyFile == "" {
+			return fmt.Errorf("%w: key_file is required for key auth", ErrInvalidHost)
+		}
+	case AuthAgent:
+	default:
+		return fmt.Errorf("%w: auth must be key or agent", ErrInvalidHost)
+	}
+	return nil
+}
+
+// Manager 远程主机管理：主机的增删查和到各主机的 SSH 连接池
+type Manager struct {
+	db   *gorm.DB
+	pool *Pool
+}
+
+// NewManager 创建远程主机管理器，连接参数（known_hosts、超时）取自 remote 配置
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db, pool: NewPool(DialSSH)}
+}
+
+// NewManagerWithPool 使用指定连接池的管理器，测试中连接到进程内的 SSH 服务
+func NewManagerWithPool(db *gorm.DB, pool *Pool) *Manager {
+	return &Manager{db: db, pool: pool}
+}
+
+// List 列出所有主机（按名称排序）
+func (m *Manager) List(ctx context.Context) ([]Host, error) {
+	var hosts []Host
+	if err := m.db.WithContext(ctx).Order("name").Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list remote hosts: %w", err)
+	}
+	return hosts, nil
+}
+
+// Get 按名称获取主机
+func (m *Manager) Get(ctx context.Context, name string) (*Host, error) {
+	var host Host
+	if err := m.db.WithContext(ctx).Where("name = ?", name).First(&host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrHostNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to get remote host: %w", err)
+	}
+	return &host, nil
+}
+
+// Add 添加主机
+func (m *Manager) Add(ctx context.Context, host *Host) error {
+	if err := host.Validate(); err != nil {
+		return err
+	}
+	var count int64
+	if err := m.db.WithContext(ctx).Model(&Host{}).Where("name = ?", host.Name).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check remote host: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrHostExists, host.Name)
+	}
+	if err := m.db.WithContext(ctx).Create(host).Error; err != nil {
+		return fmt.Errorf("failed to create remote host: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除主机并关闭到该主机的连接
+func (m *Manager) Delete(ctx context.Context, name string) error {
+	result := m.db.WithContext(ctx).Where("name = ?", name).Delete(&Host{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete remote host: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrHostNotFound, name)
+	}
+	m.pool.Discard(name)
+	return nil
+}
+
+// Executor 按名称获取执行目标，名称为空或 local 时在本机执行
+func (m *Manager) Executor(ctx context.Context, name string) (Executor, error) {
+	if name == "" || name == LocalName {
+		return Local, nil
+	}
+	host, err := m.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return m.pool.Executor(*host), nil
+}
+
+// Connect 建立（或复用）到主机的连接，连接失败时返回错误，巡检据此把无法连接的主机作为异常
+func (m *Manager) Connect(ctx context.Context, host Host) (Executor, error) {
+	if err := host.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := m.pool.client(ctx, host); err != nil {
+		return nil, err
+	}
+	return m.pool.Executor(host), nil
+}
+
+// Close 关闭所有连接
+func (m *Manager) Close() {
+	m.pool.Close()
+}
+
+var (
+	defaultManager   *Manager
+	defaultManagerMu sync.RWMutex
+)
+
+// SetDefault 设置全局远程主机管理器，传 nil 时只能在本机执行
+func SetDefault(manager *Manager) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+	defaultManager = manager
+}
+
+// Default 全局远程主机管理器，未启用时返回 nil
+func Default() *Manager {
+	defaultManagerMu.RLock()
+	defer defaultManagerMu.RUnlock()
+	return defaultManager
+}
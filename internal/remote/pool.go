@@ -0,0 +1,221 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultConnectTimeout 建立 SSH 连接的默认超时
+const DefaultConnectTimeout = 10 * time.Second
+
+// Dialer 建立到主机的 SSH 连接
+type Dialer func(ctx context.Context, host Host) (*ssh.Client, error)
+
+// Pool SSH 连接池，每台主机保持一个连接，多条命令在同一连接上并发打开会话
+type Pool struct {
+	dial Dialer
+
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+// pooledClient 连接池中的连接，key 为建立连接时的地址和用户，主机参数修改后重新连接
+type pooledClient struct {
+	key    string
+	client *ssh.Client
+}
+
+// NewPool 创建连接池
+func NewPool(dial Dialer) *Pool {
+	return &Pool{dial: dial, clients: make(map[string]*pooledClient)}
+}
+
+// Executor 在主机上执行命令的执行目标，第一次执行命令时才建立连接
+func (p *Pool) Executor(host Host) Executor {
+	return &sshExecutor{host: host, pool: p}
+}
+
+func poolKey(host Host) string {
+	return fmt.Sprintf("%s@%s:%d/%s/%s", host.User, host.Address, host.Port, host.Auth, host.KeyFile)
+}
+
+// client 复用或建立到主机的连接
+func (p *Pool) client(ctx context.Context, host Host) (*ssh.Client, error) {
+	key := poolKey(host)
+	p.mu.Lock()
+	if pooled, ok := p.clients[host.Name]; ok {
+		if pooled.key == key {
+			p.mu.Unlock()
+			return pooled.client, nil
+		}
+		pooled.client.Close()
+		delete(p.clients, host.Name)
+	}
+	p.mu.Unlock()
+
+	client, err := p.dial(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s (%s): %w", host.Name, net.JoinHostPort(host.Address, strconv.Itoa(host.Port)), err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 并发建立的连接只保留一个
+	if pooled, ok := p.clients[host.Name]; ok && pooled.key == key {
+		client.Close()
+		return pooled.client, nil
+	}
+	p.clients[host.Name] = &pooledClient{key: key, client: client}
+	return client, nil
+}
+
+// session 在主机的连接上打开会话，连接已断开时重新连接一次
+func (p *Pool) session(ctx context.Context, host Host) (*ssh.Session, error) {
+	client, err := p.client(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+	p.discardClient(host.Name, client)
+	if client, err = p.client(ctx, host); err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
+// discardClient 关闭并移除失效的连接，已被替换为新连接时不处理
+func (p *Pool) discardClient(name string, client *ssh.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pooled, ok := p.clients[name]; ok && pooled.client == client {
+		pooled.client.Close()
+		delete(p.clients, name)
+	}
+}
+
+// Discard 关闭到主机的连接，主机被删除时调用
+func (p *Pool) Discard(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pooled, ok := p.clients[name]; ok {
+		pooled.client.Close()
+		delete(p.clients, name)
+	}
+}
+
+// Close 关闭所有连接
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, pooled := range p.clients {
+		pooled.client.Close()
+		delete(p.clients, name)
+	}
+}
+
+// DialSSH 按 remote 配置建立 SSH 连接：使用私钥文件或 ssh-agent 认证，按 known_hosts 校验主机密钥
+func DialSSH(ctx context.Context, host Host) (*ssh.Client, error) {
+	cfg := config.Current().Remote
+	timeout := DefaultConnectTimeout
+	if cfg.ConnectTimeout > 0 {
+		timeout = time.Duration(cfg.ConnectTimeout) * time.Second
+	}
+
+	hostKeyCallback, err := hostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auth, closeAuth, err := authMethod(host)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuth()
+
+	clientConfig := &ssh.ClientConfig{
+		User:            host.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}
+	addr := net.JoinHostPort(host.Address, strconv.Itoa(host.Port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// 握手同样受超时限制，连接建立后清除截止时间
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// hostKeyCallback 按 known_hosts 校验主机密钥，配置了 insecure_ignore_host_key 时不校验
+func hostKeyCallback(cfg config.RemoteConfig) (ssh.HostKeyCallback, error) {
+	if cfg.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	path := cfg.KnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("locate known_hosts: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("load known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// authMethod 主机的认证方式，返回的 close 在握手完成后关闭 ssh-agent 连接
+func authMethod(host Host) (ssh.AuthMethod, func(), error) {
+	switch host.Auth {
+	case AuthAgent:
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, errors.New("SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect to ssh-agent: %w", err)
+		}
+		return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), func() { conn.Close() }, nil
+	default:
+		data, err := os.ReadFile(host.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read key file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse key file %s: %w", host.KeyFile, err)
+		}
+		return ssh.PublicKeys(signer), func() {}, nil
+	}
+}
@@ -0,0 +1,318 @@
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/utils"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Host{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testServer 进程内的 SSH 服务，exec 请求用本机 bash 执行
+type testServer struct {
+	addr        string
+	hostKey     ssh.Signer
+	keyFile     string
+	connections atomic.Int32
+}
+
+func newSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+func startTestServer(t *testing.T) *testServer {
+	t.Helper()
+	hostKey, _ := newSigner(t)
+	clientKey, clientPriv := newSigner(t)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &testServer{addr: listener.Addr().String(), hostKey: hostKey, keyFile: keyFile}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, serverConfig)
+		}
+	}()
+	return server
+}
+
+func (s *testServer) serve(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.connections.Add(1)
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSession(channel, requests)
+	}
+}
+
+// serveSession 执行 exec 请求的命令，会话关闭或收到信号时终止命令
+func serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	var cmd *exec.Cmd
+	done := make(chan struct{})
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(true, nil)
+			cmd = exec.Command("bash", "-c", payload.Command)
+			cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+			if err := cmd.Start(); err != nil {
+				channel.Close()
+				return
+			}
+			go func() {
+				defer close(done)
+				status := 0
+				if err := cmd.Wait(); err != nil {
+					status = cmd.ProcessState.ExitCode()
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+				channel.Close()
+			}()
+		case "signal":
+			if cmd != nil {
+				cmd.Process.Kill()
+			}
+		default:
+			req.Reply(false, nil)
+		}
+	}
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+// host 指向测试服务的主机
+func (s *testServer) host(name string) *Host {
+	address, port, _ := net.SplitHostPort(s.addr)
+	p, _ := strconv.Atoi(port)
+	return &Host{Name: name, Address: address, Port: p, User: "ops", KeyFile: s.keyFile, Labels: []string{"web"}}
+}
+
+// useKnownHosts 把 key 作为测试服务的主机密钥写入 known_hosts 并配置到 remote.known_hosts
+func useKnownHosts(t *testing.T, addr string, key ssh.PublicKey) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte(knownhosts.Line([]string{addr}, key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	cfg := *saved
+	cfg.Remote = config.RemoteConfig{KnownHosts: path, ConnectTimeout: 5}
+	config.Store(&cfg)
+}
+
+func TestHost_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		host Host
+		ok   bool
+	}{
+		{"key auth", Host{Name: "web-1", Address: "10.0.0.1", User: "root", KeyFile: "/root/.ssh/id_ed25519"}, true},
+		{"agent auth", Host{Name: "db.prod", Address: "db.example.com", Port: 2222, User: "ops", Auth: AuthAgent}, true},
+		{"reserved name", Host{Name: LocalName, Address: "10.0.0.1", User: "root", Auth: AuthAgent}, false},
+		{"bad name", Host{Name: "web 1", Address: "10.0.0.1", User: "root", Auth: AuthAgent}, false},
+		{"missing address", Host{Name: "web-1", User: "root", Auth: AuthAgent}, false},
+		{"missing user", Host{Name: "web-1", Address: "10.0.0.1", Auth: AuthAgent}, false},
+		{"missing key file", Host{Name: "web-1", Address: "10.0.0.1", User: "root"}, false},
+		{"bad port", Host{Name: "web-1", Address: "10.0.0.1", Port: 70000, User: "root", Auth: AuthAgent}, false},
+		{"bad auth", Host{Name: "web-1", Address: "10.0.0.1", User: "root", Auth: "password"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.host.Validate()
+			if tt.ok != (err == nil) {
+				t.Fatalf("Expected ok=%v, got %v", tt.ok, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidHost) {
+				t.Errorf("Expected ErrInvalidHost, got %v", err)
+			}
+			if err == nil && (tt.host.Port == 0 || tt.host.Auth == "") {
+				t.Errorf("Expected defaults to be filled, got %+v", tt.host)
+			}
+		})
+	}
+}
+
+func TestManager_AddGetDelete(t *testing.T) {
+	manager := NewManager(openTestDB(t))
+	defer manager.Close()
+	ctx := context.Background()
+
+	host := &Host{Name: "web-1", Address: "10.0.0.1", User: "root", Auth: AuthAgent, Labels: []string{"web", "prod"}}
+	if err := manager.Add(ctx, host); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Add(ctx, &Host{Name: "web-1", Address: "10.0.0.2", User: "root", Auth: AuthAgent}); !errors.Is(err, ErrHostExists) {
+		t.Errorf("Expected ErrHostExists, got %v", err)
+	}
+	if err := manager.Add(ctx, &Host{Name: "db-1", Address: "10.0.0.3", User: "root", Auth: AuthAgent}); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := manager.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[0].Name != "db-1" || hosts[1].Port != DefaultPort || strings.Join(hosts[1].Labels, ",") != "web,prod" {
+		t.Fatalf("Unexpected hosts %+v", hosts)
+	}
+
+	if executor, err := manager.Executor(ctx, ""); err != nil || executor.Name() != LocalName {
+		t.Errorf("Expected the local executor for an empty name, got %v %v", executor, err)
+	}
+	if executor, err := manager.Executor(ctx, "web-1"); err != nil || executor.Name() != "web-1" {
+		t.Errorf("Expected the web-1 executor, got %v %v", executor, err)
+	}
+	if _, err := manager.Executor(ctx, "missing"); !errors.Is(err, ErrHostNotFound) {
+		t.Errorf("Expected ErrHostNotFound, got %v", err)
+	}
+
+	if err := manager.Delete(ctx, "web-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Delete(ctx, "web-1"); !errors.Is(err, ErrHostNotFound) {
+		t.Errorf("Expected ErrHostNotFound on second delete, got %v", err)
+	}
+}
+
+func TestSSHExecutor_RunTimeoutAndPooling(t *testing.T) {
+	server := startTestServer(t)
+	useKnownHosts(t, server.addr, server.hostKey.PublicKey())
+	manager := NewManager(openTestDB(t))
+	defer manager.Close()
+	ctx := context.Background()
+	if err := manager.Add(ctx, server.host("web-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	executor, err := manager.Executor(ctx, "web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := executor.Run(ctx, "echo out; echo err >&2; exit 3", utils.ShellOptions{})
+	if res.Stdout != "out\n" || res.Stderr != "err\n" || res.ExitCode != 3 || res.OK() || res.TimedOut {
+		t.Fatalf("Unexpected result %+v", res)
+	}
+	if res := executor.Run(ctx, "head -c 5000 /dev/zero | tr '\\0' x", utils.ShellOptions{}); !res.OK() || !res.Truncated {
+		t.Errorf("Expected the output to be truncated like local commands, got %+v", res)
+	}
+
+	start := time.Now()
+	res = executor.Run(ctx, "echo started; sleep 10", utils.ShellOptions{Timeout: 300 * time.Millisecond})
+	if !res.TimedOut || res.Stdout != "started\n" || time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected the command to time out with its partial output, got %+v", res)
+	}
+
+	// 同一主机的命令复用一个连接
+	if _, err := manager.Connect(ctx, *server.host("web-1")); err != nil {
+		t.Fatal(err)
+	}
+	if res := executor.Run(ctx, "true", utils.ShellOptions{}); !res.OK() {
+		t.Errorf("Expected the command to succeed after a timeout, got %+v", res)
+	}
+	if n := server.connections.Load(); n != 1 {
+		t.Errorf("Expected one pooled connection, got %d", n)
+	}
+}
+
+func TestDialSSH_RejectsUnknownHostKey(t *testing.T) {
+	server := startTestServer(t)
+	other, _ := newSigner(t)
+	useKnownHosts(t, server.addr, other.PublicKey())
+
+	manager := NewManager(openTestDB(t))
+	defer manager.Close()
+	if _, err := manager.Connect(context.Background(), *server.host("web-1")); err == nil || !strings.Contains(err.Error(), "web-1") {
+		t.Fatalf("Expected the host key mismatch to fail the connection, got %v", err)
+	}
+	if n := server.connections.Load(); n != 0 {
+		t.Errorf("Expected no established connection, got %d", n)
+	}
+}
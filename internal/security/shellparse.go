@@ -0,0 +1,455 @@
+package security
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// errShellSyntax 命令无法按 shell 语法拆分（如引号未闭合）
+var errShellSyntax = errors.New("shell syntax error")
+
+// maxShellDepth 命令替换、子shell 和 bash -c 的最大嵌套层数
+const maxShellDepth = 16
+
+// shellRedirect 命令中的一个重定向
+type shellRedirect struct {
+	Op     string // >、>>、<、<<、&>、>& 等
+	Target string
+}
+
+// writes 重定向是否写入文件：复制文件描述符和写入 /dev/null 等伪设备不算
+func (r shellRedirect) writes() bool {
+	if !strings.Contains(r.Op, ">") && r.Op != "<>" {
+		return false
+	}
+	if strings.HasSuffix(r.Op, "&") && (r.Target == "-" || isDigits(r.Target)) {
+		return false
+	}
+	switch r.Target {
+	case "/dev/null", "/dev/stdout", "/dev/stderr", "/dev/tty":
+		return false
+	}
+	return true
+}
+
+// shellCommand 拆分出的一条简单命令，引号已去除
+type shellCommand struct {
+	Args      []string
+	Redirects []shellRedirect
+}
+
+// parseShell 把命令拆分为简单命令：管道、&&、||、;、& 和换行分隔的每条命令，
+// 以及 $(...)、`...`、<(...) 和子shell 中的命令都会单独列出；引号内的内容只作为参数，不会被当作命令
+func parseShell(s string) ([]shellCommand, error) {
+	p := &shellParser{s: s}
+	if err := p.list(0, 0); err != nil {
+		return nil, err
+	}
+	return p.cmds, nil
+}
+
+type shellParser struct {
+	s        string
+	i        int
+	cmds     []shellCommand
+	heredocs []string // 当前行中等待读取正文的 here document 结束标记
+}
+
+// list 读取命令序列，直到输入结束或遇到 term（子shell 和命令替换的右括号）
+func (p *shellParser) list(term byte, depth int) error {
+	if depth > maxShellDepth {
+		return errShellSyntax
+	}
+	var cur shellCommand
+	flush := func() {
+		if len(cur.Args) > 0 || len(cur.Redirects) > 0 {
+			p.cmds = append(p.cmds, cur)
+		}
+		cur = shellCommand{}
+	}
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == ' ' || c == '\t':
+			p.i++
+		case c == '\\' && p.i+1 < len(p.s) && p.s[p.i+1] == '\n':
+			p.i += 2
+		case term != 0 && c == term:
+			p.i++
+			flush()
+			return nil
+		case c == '\n':
+			p.i++
+			flush()
+			p.skipHeredocs()
+		case c == ';' || c == '|' || c == '&' && !strings.HasPrefix(p.s[p.i:], "&>"):
+			p.i++
+			flush()
+		case c == ')':
+			return errShellSyntax
+		case c == '(' || (c == '<' || c == '>') && p.i+1 < len(p.s) && p.s[p.i+1] == '(':
+			// 子shell 或进程替换
+			if c != '(' {
+				p.i++
+			}
+			p.i++
+			if err := p.list(')', depth+1); err != nil {
+				return err
+			}
+			if c != '(' {
+				cur.Args = append(cur.Args, "<(...)")
+			}
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			if op := p.redirectOp(); op != "" {
+				p.skipBlanks()
+				target, err := p.word(depth)
+				if err != nil {
+					return err
+				}
+				if strings.HasPrefix(op, "<<") && op != "<<<" {
+					p.heredocs = append(p.heredocs, target)
+				}
+				cur.Redirects = append(cur.Redirects, shellRedirect{Op: op, Target: target})
+				continue
+			}
+			word, err := p.word(depth)
+			if err != nil {
+				return err
+			}
+			cur.Args = append(cur.Args, word)
+		}
+	}
+	if term != 0 {
+		return errShellSyntax
+	}
+	flush()
+	return nil
+}
+
+// redirectOp 读取当前位置的重定向运算符（可带文件描述符，如 2>），不是重定向时不移动位置
+func (p *shellParser) redirectOp() string {
+	j := p.i
+	for j < len(p.s) && p.s[j] >= '0' && p.s[j] <= '9' {
+		j++
+	}
+	rest := p.s[j:]
+	for _, op := range []string{"&>>", "<<<", "<<-", ">>", "<<", "<>", ">&", "<&", ">|", "&>", ">", "<"} {
+		if strings.HasPrefix(rest, op) && !(op[0] == '&' && j > p.i) {
+			p.i = j + len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *shellParser) skipBlanks() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// skipHeredocs 跳过 here document 的正文，正文不是命令
+func (p *shellParser) skipHeredocs() {
+	for _, delim := range p.heredocs {
+		for p.i < len(p.s) {
+			end := strings.IndexByte(p.s[p.i:], '\n')
+			line := p.s[p.i:]
+			if end >= 0 {
+				line = p.s[p.i : p.i+end]
+				p.i += end + 1
+			} else {
+				p.i = len(p.s)
+			}
+			if strings.TrimLeft(line, "\t") == delim {
+				break
+			}
+		}
+	}
+	p.heredocs = nil
+}
+
+// word 读取一个单词并去除引号和转义，其中的命令替换作为单独的命令记录
+func (p *shellParser) word(depth int) (string, error) {
+	var b strings.Builder
+	start := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch c {
+		case ' ', '\t', '\n', ';', '&', '|', '(', ')', '<', '>':
+			if p.i == start {
+				// 运算符由 list 处理，在单词开头出现说明缺少单词（如 "> ;"）
+				return "", errShellSyntax
+			}
+			return b.String(), nil
+		case '\\':
+			if p.i+1 < len(p.s) {
+				if p.s[p.i+1] != '\n' {
+					b.WriteByte(p.s[p.i+1])
+				}
+				p.i += 2
+				continue
+			}
+			p.i++
+		case '\'':
+			end := strings.IndexByte(p.s[p.i+1:], '\'')
+			if end < 0 {
+				return "", errShellSyntax
+			}
+			b.WriteString(p.s[p.i+1 : p.i+1+end])
+			p.i += end + 2
+		case '"':
+			if err := p.doubleQuoted(&b, depth); err != nil {
+				return "", err
+			}
+		case '$', '`':
+			if err := p.expansion(&b, depth); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return b.String(), nil
+}
+
+// doubleQuoted 读取双引号中的内容，其中的 $(...) 和 `...` 仍会执行
+func (p *shellParser) doubleQuoted(b *strings.Builder, depth int) error {
+	p.i++
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; c {
+		case '"':
+			p.i++
+			return nil
+		case '\\':
+			if p.i+1 < len(p.s) && strings.IndexByte("\"\\$`\n", p.s[p.i+1]) >= 0 {
+				if p.s[p.i+1] != '\n' {
+					b.WriteByte(p.s[p.i+1])
+				}
+				p.i += 2
+				continue
+			}
+			b.WriteByte(c)
+			p.i++
+		case '$', '`':
+			if err := p.expansion(b, depth); err != nil {
+				return err
+			}
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return errShellSyntax
+}
+
+// expansion 处理 $ 和反引号：命令替换中的命令单独记录，变量和算术展开原样保留在单词中
+func (p *shellParser) expansion(b *strings.Builder, depth int) error {
+	start := p.i
+	switch {
+	case strings.HasPrefix(p.s[p.i:], "$(("):
+		end := strings.Index(p.s[p.i:], "))")
+		if end < 0 {
+			return errShellSyntax
+		}
+		p.i += end + 2
+	case strings.HasPrefix(p.s[p.i:], "$("):
+		p.i += 2
+		if err := p.list(')', depth+1); err != nil {
+			return err
+		}
+	case strings.HasPrefix(p.s[p.i:], "${"):
+		end := strings.IndexByte(p.s[p.i:], '}')
+		if end < 0 {
+			return errShellSyntax
+		}
+		p.i += end + 1
+	case p.s[p.i] == '`':
+		end := strings.IndexByte(p.s[p.i+1:], '`')
+		if end < 0 {
+			return errShellSyntax
+		}
+		if depth+1 > maxShellDepth {
+			return errShellSyntax
+		}
+		inner := &shellParser{s: p.s[p.i+1 : p.i+1+end]}
+		if err := inner.list(0, depth+1); err != nil {
+			return err
+		}
+		p.cmds = append(p.cmds, inner.cmds...)
+		p.i += end + 2
+	default:
+		p.i++
+	}
+	b.WriteString(p.s[start:p.i])
+	return nil
+}
+
+// wrapperFlagArgs 包装命令中带参数的选项，如 sudo -u root
+var wrapperFlagArgs = map[string]string{
+	"sudo":    "ugCDhpTr",
+	"nice":    "n",
+	"ionice":  "cnp",
+	"xargs":   "nIPLdasE",
+	"timeout": "sk",
+	"env":     "uC",
+	"stdbuf":  "ioe",
+	"watch":   "nd",
+}
+
+// shellKeywords 不影响实际执行命令的关键字和前缀命令
+var shellKeywords = map[string]bool{
+	"{": true, "}": true, "!": true, "if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"while": true, "until": true, "do": true, "done": true, "exec": true, "command": true, "builtin": true,
+	"nohup": true, "time": true,
+}
+
+// unwrap 去掉 sudo、env、xargs、timeout 等包装命令和前置的变量赋值，返回实际执行的命令
+func unwrap(args []string) []string {
+	for len(args) > 0 {
+		name := path.Base(args[0])
+		switch {
+		case strings.Contains(args[0], "=") && !strings.HasPrefix(args[0], "="):
+			args = args[1:]
+			continue
+		case shellKeywords[name]:
+			args = args[1:]
+			continue
+		}
+		withArg, ok := wrapperFlagArgs[name]
+		if !ok {
+			return args
+		}
+		args = args[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+			flag := args[0]
+			args = args[1:]
+			if flag == "--" {
+				break
+			}
+			if !strings.HasPrefix(flag, "--") && strings.ContainsRune(withArg, rune(flag[len(flag)-1])) && len(args) > 0 {
+				args = args[1:]
+			}
+		}
+		// timeout 的第一个参数是时长
+		if name == "timeout" && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+// text 拼接命令用于规则匹配：包含空白或 shell 特殊字符的参数加上单引号
+func (c shellCommand) text() string {
+	args := unwrap(c.Args)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]#~") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		} else {
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellInterpreters 可以执行任意脚本的解释器
+var shellInterpreters = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true, "eval": true}
+
+// script 解释器要执行的脚本：bash -c 的参数或 eval 的参数；从标准输入读取脚本时 stdin 为 true
+func (c shellCommand) script() (script string, stdin, ok bool) {
+	args := unwrap(c.Args)
+	if len(args) == 0 || !shellInterpreters[path.Base(args[0])] {
+		return "", false, false
+	}
+	if path.Base(args[0]) == "eval" {
+		return strings.Join(args[1:], " "), false, true
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			// 执行脚本文件或从标准输入读取
+			return "", arg == "-" || arg == "--" && i == len(args)-1, true
+		}
+		if strings.HasPrefix(arg, "--") {
+			continue
+		}
+		if strings.Contains(arg, "c") {
+			if i+1 < len(args) {
+				return args[i+1], false, true
+			}
+			return "", false, true
+		}
+	}
+	return "", true, true
+}
+
+// destructive 命令是否属于毁灭性操作：递归删除根目录、格式化文件系统、覆盖块设备
+func (c shellCommand) destructive() bool {
+	for _, r := range c.Redirects {
+		if r.writes() && isBlockDevice(r.Target) {
+			return true
+		}
+	}
+	args := unwrap(c.Args)
+	if len(args) == 0 {
+		return false
+	}
+	name := path.Base(args[0])
+	switch {
+	case strings.HasPrefix(name, "mkfs") || name == "mke2fs":
+		return true
+	case name == "dd":
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "of=") && isBlockDevice(strings.TrimPrefix(arg, "of=")) {
+				return true
+			}
+		}
+	case name == "rm":
+		recursive, root := false, false
+		for _, arg := range args[1:] {
+			switch {
+			case arg == "--recursive" || arg == "--no-preserve-root":
+				recursive = true
+			case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+				recursive = recursive || strings.ContainsAny(arg, "rR")
+			case isRootPath(arg):
+				root = true
+			}
+		}
+		return recursive && root
+	}
+	return false
+}
+
+// isRootPath 是否为根目录或根目录下的所有文件
+func isRootPath(arg string) bool {
+	cleaned := strings.TrimRight(arg, "/")
+	return cleaned == "" && arg != "" || cleaned == "/*" || arg == "/*" || cleaned == "/." || cleaned == "~" || cleaned == "/.."
+}
+
+func isBlockDevice(target string) bool {
+	for _, prefix := range []string{"/dev/sd", "/dev/hd", "/dev/vd", "/dev/xvd", "/dev/nvme", "/dev/mmcblk", "/dev/dm-", "/dev/mapper/"} {
+		if strings.HasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
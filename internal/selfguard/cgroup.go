@@ -0,0 +1,153 @@
+package selfguard
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Limits 运行环境（cgroup）的资源限制，0 表示未限制
+type Limits struct {
+	CgroupVersion int     `json:"cgroup_version"` // 1 或 2，未检测到 cgroup 时为 0
+	CPU           float64 `json:"cpu_cores"`      // CPU 配额折算的核数
+	MemoryBytes   int64   `json:"memory_bytes"`
+}
+
+// unlimitedMemory cgroup v1 未设置内存限制时 memory.limit_in_bytes 为接近 int64 上限的值
+const unlimitedMemory = int64(1) << 62
+
+// DetectLimits 读取当前进程所在 cgroup（v1 或 v2）的 CPU 和内存限制
+func DetectLimits() Limits {
+	return detectLimits("/proc/self/cgroup", "/sys/fs/cgroup")
+}
+
+// detectLimits 从 procCgroup（/proc/self/cgroup 格式）定位 cgroup，在 root 下读取限制。
+// 容器中 /proc/self/cgroup 记录的可能是宿主机上的路径，按该路径找不到时回退到挂载点根目录；
+// 限制可能设置在上层 cgroup 上，逐级向上取最小值
+func detectLimits(procCgroup, root string) Limits {
+	data, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return Limits{}
+	}
+	var unified string
+	hasUnified := false
+	v1 := make(map[string][2]string) // 控制器 -> {挂载目录名, cgroup 路径}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified, hasUnified = parts[2], true
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			v1[controller] = [2]string{parts[1], parts[2]}
+		}
+	}
+
+	if hasUnified && fileExists(filepath.Join(root, "cgroup.controllers")) {
+		limits := Limits{CgroupVersion: 2}
+		for _, dir := range cgroupDirs(root, unified) {
+			if quota, period, ok := readCPUMax(filepath.Join(dir, "cpu.max")); ok {
+				limits.CPU = minLimit(limits.CPU, quota/period)
+			}
+			if mem, ok := readInt(filepath.Join(dir, "memory.max")); ok {
+				limits.MemoryBytes = minLimit(limits.MemoryBytes, mem)
+			}
+		}
+		return limits
+	}
+
+	if len(v1) == 0 {
+		return Limits{}
+	}
+	limits := Limits{CgroupVersion: 1}
+	if cpu, ok := v1["cpu"]; ok {
+		for _, dir := range cgroupDirs(v1Mount(root, cpu[0], "cpu"), cpu[1]) {
+			quota, okQuota := readInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+			period, okPeriod := readInt(filepath.Join(dir, "cpu.cfs_period_us"))
+			if okQuota && okPeriod && quota > 0 && period > 0 {
+				limits.CPU = minLimit(limits.CPU, float64(quota)/float64(period))
+			}
+		}
+	}
+	if mem, ok := v1["memory"]; ok {
+		for _, dir := range cgroupDirs(v1Mount(root, mem[0], "memory"), mem[1]) {
+			if limit, ok := readInt(filepath.Join(dir, "memory.limit_in_bytes")); ok && limit < unlimitedMemory {
+				limits.MemoryBytes = minLimit(limits.MemoryBytes, limit)
+			}
+		}
+	}
+	return limits
+}
+
+// v1Mount cgroup v1 控制器的挂载目录，合并挂载时目录名为 cpu,cpuacct，通常还有 cpu 符号链接
+func v1Mount(root, hierarchy, controller string) string {
+	if dir := filepath.Join(root, hierarchy); fileExists(dir) {
+		return dir
+	}
+	return filepath.Join(root, controller)
+}
+
+// cgroupDirs 从进程所在的 cgroup 到挂载点根目录的各级目录；路径在当前挂载命名空间中不存在时只返回根目录
+func cgroupDirs(mount, cgroupPath string) []string {
+	p := path.Clean("/" + cgroupPath)
+	if !fileExists(filepath.Join(mount, p)) {
+		return []string{mount}
+	}
+	var dirs []string
+	for {
+		dirs = append(dirs, filepath.Join(mount, p))
+		if p == "/" {
+			return dirs
+		}
+		p = path.Dir(p)
+	}
+}
+
+// readCPUMax 解析 cgroup v2 的 cpu.max（"<quota> <period>"，quota 为 max 表示不限制）
+func readCPUMax(file string) (float64, float64, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, 0, false
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+		return 0, 0, false
+	}
+	return quota, period, true
+}
+
+// readInt 读取只包含一个整数的 cgroup 文件，"max" 表示不限制
+func readInt(file string) (int64, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// minLimit 取较小的限制，0 表示未限制
+func minLimit[T int64 | float64](current, v T) T {
+	if current == 0 || v < current {
+		return v
+	}
+	return current
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
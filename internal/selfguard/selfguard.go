@@ -0,0 +1,221 @@
+// Package selfguard 让 qwq 感知自身所在容器的资源限制：按 CPU 配额设置 GOMAXPROCS、按内存限制设置 GC 目标，
+// 采集自身的内存和协程占用，接近内存限制时收缩内存中的缓存并通过巡检告警，避免负责发现 OOM 的进程自己被 OOM
+package selfguard
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+)
+
+const (
+	// DefaultPressurePercent 自身内存达到限制的该百分比时视为内存紧张
+	DefaultPressurePercent = 90
+	// DefaultStatsHistory 面板实时监控默认保留的数据点
+	DefaultStatsHistory = 60
+	// DefaultMetricsHistory 长期指标历史默认保留的时间片数（1 分钟粒度，7 天）
+	DefaultMetricsHistory = 7 * 24 * 60
+	// pressureShrink 内存紧张时缓存上限缩小的倍数
+	pressureShrink = 4
+	// sampleInterval 守护循环的采样间隔
+	sampleInterval = 5 * time.Second
+	// alertInterval 内存紧张时触发告警的最短间隔
+	alertInterval = 10 * time.Minute
+)
+
+// Stats qwq 自身的资源占用
+type Stats struct {
+	RSSBytes         uint64  `json:"rss_bytes"`
+	HeapBytes        uint64  `json:"heap_bytes"`
+	Goroutines       int     `json:"goroutines"`
+	NumGC            uint32  `json:"num_gc"`
+	LastGCPauseMS    float64 `json:"last_gc_pause_ms"`
+	GOMAXPROCS       int     `json:"gomaxprocs"`
+	CPULimit         float64 `json:"cpu_limit,omitempty"`
+	MemoryLimitBytes int64   `json:"memory_limit_bytes,omitempty"`
+	MemoryPercent    float64 `json:"memory_percent,omitempty"` // RSS 占内存限制的百分比
+	Pressure         bool    `json:"pressure"`                 // 达到 resources.pressure_percent，缓存已收缩
+}
+
+var (
+	limitsOnce sync.Once
+	limits     Limits
+	pressure   atomic.Bool
+	latest     atomic.Pointer[Stats]
+	lastAlert  time.Time
+
+	// OnPressure 进入内存紧张状态时调用（最多每 alertInterval 一次），由启动流程注入以立即执行巡检并告警
+	OnPressure func()
+
+	// detect 检测资源限制，测试中替换
+	detect = DetectLimits
+)
+
+// Init 检测资源限制并据此调整运行时：未设置 GOMAXPROCS 环境变量时按 CPU 配额设置 GOMAXPROCS，
+// 未设置 GOMEMLIMIT 时把 GC 的软内存上限设为内存限制的 pressure_percent，之后按配置设置各缓存上限
+func Init() Limits {
+	lim := loadLimits()
+	applyLimits()
+	return lim
+}
+
+// CurrentLimits 检测到的资源限制
+func CurrentLimits() Limits {
+	return loadLimits()
+}
+
+// loadLimits 首次调用时检测资源限制并调整运行时
+func loadLimits() Limits {
+	limitsOnce.Do(func() {
+		limits = detect()
+		if limits.CPU > 0 && os.Getenv("GOMAXPROCS") == "" {
+			if procs := max(int(math.Ceil(limits.CPU)), 1); procs < runtime.GOMAXPROCS(0) {
+				runtime.GOMAXPROCS(procs)
+			}
+		}
+		if limits.MemoryBytes > 0 && os.Getenv("GOMEMLIMIT") == "" {
+			debug.SetMemoryLimit(limits.MemoryBytes / 100 * int64(pressurePercent()))
+		}
+		if limits.CgroupVersion > 0 && (limits.CPU > 0 || limits.MemoryBytes > 0) {
+			logger.Info("📦 检测到 cgroup v%d 资源限制: CPU %.2f 核, 内存 %d MB, GOMAXPROCS=%d",
+				limits.CgroupVersion, limits.CPU, limits.MemoryBytes>>20, runtime.GOMAXPROCS(0))
+		}
+		monitor.SelfCPULimit.Set(limits.CPU)
+		monitor.SelfMemoryLimit.Set(float64(limits.MemoryBytes))
+		monitor.SelfGOMAXPROCS.Set(float64(runtime.GOMAXPROCS(0)))
+	})
+	return limits
+}
+
+func pressurePercent() int {
+	if p := config.Current().Resources.PressurePercent; p > 0 {
+		return p
+	}
+	return DefaultPressurePercent
+}
+
+// Cap 内存紧张时把缓存上限 base 缩小到四分之一，否则原样返回
+func Cap(base int) int {
+	if pressure.Load() {
+		return max(base/pressureShrink, 1)
+	}
+	return base
+}
+
+// StatsHistoryLimit 面板实时监控保留的数据点
+func StatsHistoryLimit() int {
+	return Cap(orDefault(config.Current().Resources.StatsHistory, DefaultStatsHistory))
+}
+
+func orDefault(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// applyLimits 按当前配置和内存状态设置日志缓冲和长期指标历史的上限
+func applyLimits() {
+	res := config.Current().Resources
+	logger.SetBufferLimit(Cap(orDefault(res.LogBuffer, logger.DefaultBufferLimit)))
+	monitor.DefaultHistory.SetMaxPoints(Cap(orDefault(res.MetricsHistory, DefaultMetricsHistory)))
+}
+
+// Sample 采集自身的资源占用并判断是否接近内存限制
+func Sample() Stats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	lim := CurrentLimits()
+	stats := Stats{
+		RSSBytes:         readRSS(mem.Sys),
+		HeapBytes:        mem.HeapAlloc,
+		Goroutines:       runtime.NumGoroutine(),
+		NumGC:            mem.NumGC,
+		LastGCPauseMS:    float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6,
+		GOMAXPROCS:       runtime.GOMAXPROCS(0),
+		CPULimit:         lim.CPU,
+		MemoryLimitBytes: lim.MemoryBytes,
+	}
+	if lim.MemoryBytes > 0 {
+		stats.MemoryPercent = math.Round(float64(stats.RSSBytes)/float64(lim.MemoryBytes)*1000) / 10
+		stats.Pressure = stats.MemoryPercent >= float64(pressurePercent())
+	}
+	return stats
+}
+
+// readRSS 读取 /proc/self/statm 中的常驻内存，不可用时使用 Go 运行时向系统申请的内存
+func readRSS(fallback uint64) uint64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return fallback
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return fallback
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return pages * uint64(os.Getpagesize())
+}
+
+// Current 守护循环最近一次的采样，循环未运行时立即采样
+func Current() Stats {
+	if stats := latest.Load(); stats != nil {
+		return *stats
+	}
+	return Sample()
+}
+
+// Run 定期采样自身资源占用，更新指标；进入内存紧张状态时收缩缓存、归还空闲内存并触发告警，恢复后还原缓存上限
+func Run(ctx context.Context) {
+	Init()
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for {
+		observe(Sample(), time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// observe 记录一次采样并处理内存紧张状态的变化
+func observe(stats Stats, now time.Time) {
+	latest.Store(&stats)
+	monitor.SelfRSS.Set(float64(stats.RSSBytes))
+	monitor.SelfGoroutines.Set(float64(stats.Goroutines))
+
+	if stats.Pressure == pressure.Load() {
+		return
+	}
+	pressure.Store(stats.Pressure)
+	applyLimits()
+	if !stats.Pressure {
+		monitor.SelfMemoryPressure.Set(0)
+		logger.Info("✅ qwq 自身内存已回落 (%.1f%% of %d MB)，缓存上限已恢复", stats.MemoryPercent, stats.MemoryLimitBytes>>20)
+		return
+	}
+	monitor.SelfMemoryPressure.Set(1)
+	logger.Info("⚠️ qwq 自身内存接近限制 (RSS %d MB, %.1f%% of %d MB)，已收缩内存缓存",
+		stats.RSSBytes>>20, stats.MemoryPercent, stats.MemoryLimitBytes>>20)
+	debug.FreeOSMemory()
+	if OnPressure != nil && now.Sub(lastAlert) >= alertInterval {
+		lastAlert = now
+		go OnPressure()
+	}
+}
@@ -0,0 +1,129 @@
+package selfguard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectLimits_V2(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "cgroup")
+	writeFiles(t, dir, map[string]string{
+		"proc":                                "0::/kubepods/pod1/qwq\n",
+		"cgroup/cgroup.controllers":           "cpu memory\n",
+		"cgroup/kubepods/pod1/cpu.max":        "max 100000\n",
+		"cgroup/kubepods/pod1/memory.max":     "536870912\n",
+		"cgroup/kubepods/pod1/qwq/cpu.max":    "150000 100000\n",
+		"cgroup/kubepods/pod1/qwq/memory.max": "max\n",
+	})
+
+	limits := detectLimits(filepath.Join(dir, "proc"), root)
+	if limits.CgroupVersion != 2 || limits.CPU != 1.5 || limits.MemoryBytes != 512<<20 {
+		t.Errorf("Expected v2 limits of 1.5 cores and the parent's 512 MB, got %+v", limits)
+	}
+
+	// 容器中记录的是宿主机路径，按挂载点根目录读取
+	writeFiles(t, dir, map[string]string{
+		"proc-host":         "0::/system.slice/docker-abc.scope\n",
+		"cgroup/cpu.max":    "200000 100000\n",
+		"cgroup/memory.max": "1073741824\n",
+	})
+	limits = detectLimits(filepath.Join(dir, "proc-host"), root)
+	if limits.CPU != 2 || limits.MemoryBytes != 1<<30 {
+		t.Errorf("Expected namespaced root limits, got %+v", limits)
+	}
+}
+
+func TestDetectLimits_V1(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"proc": "12:memory:/docker/abc\n" +
+			"4:cpu,cpuacct:/docker/abc\n" +
+			"1:name=systemd:/docker/abc\n",
+		"cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  "50000\n",
+		"cgroup/cpu,cpuacct/docker/abc/cpu.cfs_period_us": "100000\n",
+		"cgroup/cpu,cpuacct/cpu.cfs_quota_us":             "-1\n",
+		"cgroup/cpu,cpuacct/cpu.cfs_period_us":            "100000\n",
+		"cgroup/memory/docker/abc/memory.limit_in_bytes":  "9223372036854771712\n",
+		"cgroup/memory/docker/memory.limit_in_bytes":      "268435456\n",
+	})
+
+	limits := detectLimits(filepath.Join(dir, "proc"), filepath.Join(dir, "cgroup"))
+	if limits.CgroupVersion != 1 || limits.CPU != 0.5 || limits.MemoryBytes != 256<<20 {
+		t.Errorf("Expected v1 limits of 0.5 cores and 256 MB, got %+v", limits)
+	}
+
+	if limits := detectLimits(filepath.Join(dir, "missing"), filepath.Join(dir, "cgroup")); limits != (Limits{}) {
+		t.Errorf("Expected no limits without /proc/self/cgroup, got %+v", limits)
+	}
+}
+
+func TestObserve_ShrinksCachesUnderPressure(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) {
+		cfg.Resources = config.ResourcesConfig{StatsHistory: 40, LogBuffer: 80, MetricsHistory: 100}
+	})
+	savedHook := OnPressure
+	t.Cleanup(func() {
+		OnPressure = savedHook
+		observe(Stats{}, time.Now())
+		logger.SetBufferLimit(logger.DefaultBufferLimit)
+		monitor.DefaultHistory.SetMaxPoints(0)
+	})
+	alerts := make(chan struct{}, 2)
+	OnPressure = func() { alerts <- struct{}{} }
+
+	applyLimits()
+	for i := 0; i < 80; i++ {
+		logger.Info("line %d", i)
+	}
+	if StatsHistoryLimit() != 40 || len(logger.GetWebLogs()) != 80 {
+		t.Fatalf("Expected configured limits before pressure, got %d stats / %d logs", StatsHistoryLimit(), len(logger.GetWebLogs()))
+	}
+
+	now := time.Now()
+	observe(Stats{MemoryLimitBytes: 100 << 20, RSSBytes: 95 << 20, MemoryPercent: 95, Pressure: true}, now)
+	if StatsHistoryLimit() != 10 || len(logger.GetWebLogs()) != 20 {
+		t.Errorf("Expected limits shrunk to a quarter under pressure, got %d stats / %d logs", StatsHistoryLimit(), len(logger.GetWebLogs()))
+	}
+	select {
+	case <-alerts:
+	case <-time.After(time.Second):
+		t.Fatal("Expected OnPressure to be called when entering pressure")
+	}
+	if !Current().Pressure {
+		t.Error("Expected the latest sample to report pressure")
+	}
+
+	// 告警限速：alertInterval 内再次进入紧张状态不重复告警
+	observe(Stats{MemoryLimitBytes: 100 << 20}, now.Add(time.Minute))
+	if StatsHistoryLimit() != 40 {
+		t.Errorf("Expected limits restored after pressure clears, got %d", StatsHistoryLimit())
+	}
+	observe(Stats{MemoryLimitBytes: 100 << 20, Pressure: true}, now.Add(2*time.Minute))
+	select {
+	case <-alerts:
+		t.Error("Expected repeated pressure within alertInterval not to alert again")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/events"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+	"qwq/internal/notify"
+	"qwq/internal/pagination"
+	"qwq/internal/patrol"
+	"strconv"
+	"time"
+)
+
+// defaultSummaryWindow 异常统计未指定 from 时的时间范围
+const defaultSummaryWindow = 7 * 24 * time.Hour
+
+var errAnomaliesUnavailable = apierror.New(http.StatusServiceUnavailable, "ANOMALIES_UNAVAILABLE", "Anomaly history is not available")
+
+// RecordPatrolHistory 巡检结束后把巡检记录和异常写入异常历史，未启用时忽略；写入失败只记录日志
+func RecordPatrolHistory(run *patrol.Run) {
+	store := monitor.DefaultAnomalies()
+	if store == nil || run == nil {
+		return
+	}
+	if _, err := store.Record(context.Background(), patrolOutcome(run), run.Analysis); err != nil {
+		logger.Info("⚠️ 保存异常历史失败: %v", err)
+	}
+}
+
+// patrolOutcome 把巡检结果转换为异常历史的记录，超时和跳过的检查项记为未检查
+func patrolOutcome(run *patrol.Run) monitor.PatrolOutcome {
+	outcome := monitor.PatrolOutcome{Record: monitor.PatrolRecord{
+		RunID:     run.ID,
+		Trigger:   run.Trigger,
+		StartedAt: run.StartedAt,
+		Duration:  run.FinishedAt.Sub(run.StartedAt).Milliseconds(),
+		Checks:    len(run.Results),
+	}}
+	for _, result := range run.Results {
+		if result.Verdict == patrol.VerdictSkipped || result.Verdict == patrol.VerdictTimeout {
+			outcome.Unchecked = append(outcome.Unchecked, monitor.CheckKey(result.Check, result.Host))
+			continue
+		}
+		for _, finding := range result.Findings {
+			severity := notify.SeverityWarning
+			if finding.Critical || patrol.CriticalChecks[result.Check] {
+				severity = notify.SeverityCritical
+			}
+			outcome.Observed = append(outcome.Observed, monitor.Observation{
+				Fingerprint: notify.Fingerprint(result.Host, result.Check, finding.Title),
+				Type:        result.Check,
+				Host:        result.Host,
+				Title:       finding.Title,
+				Severity:    severity,
+				Snippet:     finding.Detail,
+			})
+		}
+	}
+	return outcome
+}
+
+// anomalyQuery 解析 from、to（RFC3339 或 Unix 秒）和 resolved 参数
+func anomalyQuery(r *http.Request) (monitor.AnomalyQuery, error) {
+	values := r.URL.Query()
+	var q monitor.AnomalyQuery
+	var err error
+	if q.From, err = parseEventTime(values.Get("from")); err != nil {
+		return q, requiredField("from", "from must be an RFC3339 time or unix seconds")
+	}
+	if q.To, err = parseEventTime(values.Get("to")); err != nil {
+		return q, requiredField("to", "to must be an RFC3339 time or unix seconds")
+	}
+	if value := values.Get("resolved"); value != "" {
+		resolved, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, requiredField("resolved", "resolved must be true or false")
+		}
+		q.Resolved = &resolved
+	}
+	return q, nil
+}
+
+// handleAnomalies 异常历史 GET /api/anomalies?from=&to=&type=&host=&severity=&resolved=&page=&pageSize=&sort=
+// 返回在时间范围内持续过的异常，默认最近首次发现的在前
+func handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	store := monitor.DefaultAnomalies()
+	if store == nil {
+		writeError(w, r, errAnomaliesUnavailable)
+		return
+	}
+	q, err := anomalyQuery(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	page, err := pagination.Parse(r.URL.Query(), monitor.AnomalyListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	result, err := store.List(r.Context(), q, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleAnomalySummary 按天和类型统计首次发现的异常数量 GET /api/anomalies/summary?from=&to=&type=disk,load
+// 未指定时统计最近 7 天，用于控制台绘制异常趋势图
+func handleAnomalySummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	store := monitor.DefaultAnomalies()
+	if store == nil {
+		writeError(w, r, errAnomaliesUnavailable)
+		return
+	}
+	q, err := anomalyQuery(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultSummaryWindow)
+	}
+	summary, err := store.Summary(r.Context(), q.From, q.To, events.ParseTypes(r.URL.Query().Get("type")))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":           q.From,
+		"to":             q.To,
+		"days":           summary,
+		"retention_days": int(store.Retention() / (24 * time.Hour)),
+	})
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAnomalyHistoryAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleAnomalies(rec, httptest.NewRequest(http.MethodGet, "/api/anomalies", nil))
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusServiceUnavailable || envelope.Code != "ANOMALIES_UNAVAILABLE" {
+		t.Fatalf("Expected 503 without an anomaly store, got %d %+v", rec.Code, envelope)
+	}
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(monitor.AnomalyModels...); err != nil {
+		t.Fatal(err)
+	}
+	monitor.SetDefaultAnomalies(monitor.NewAnomalyStore(db, 0))
+	t.Cleanup(func() { monitor.SetDefaultAnomalies(nil) })
+
+	start := time.Now().Add(-time.Hour)
+	run := func(id int64, at time.Time, results ...*patrol.CheckResult) *patrol.Run {
+		return &patrol.Run{ID: id, Trigger: "schedule", StartedAt: at, FinishedAt: at.Add(time.Second), Results: results, Analysis: "AI 分析"}
+	}
+	result := func(check, host string, verdict patrol.Verdict, findings ...patrol.Finding) *patrol.CheckResult {
+		return &patrol.CheckResult{Check: check, Host: host, Verdict: verdict, Findings: findings}
+	}
+	RecordPatrolHistory(run(1, start,
+		result("disk", "", patrol.VerdictAlert, patrol.Finding{Title: "磁盘告警 (/dev/sda1)", Detail: "91%"}),
+		result("oom", "web-1", patrol.VerdictAlert, patrol.Finding{Title: "OOM日志", Detail: "Out of memory: Killed process 42"}),
+	))
+	// 第二轮 disk 恢复，web-1 的 OOM 检查被跳过，异常保持未恢复
+	RecordPatrolHistory(run(2, start.Add(5*time.Minute), result("disk", "", patrol.VerdictOK), result("oom", "web-1", patrol.VerdictSkipped)))
+
+	list := func(query string) (*httptest.ResponseRecorder, []monitor.Anomaly) {
+		rec := httptest.NewRecorder()
+		handleAnomalies(rec, httptest.NewRequest(http.MethodGet, "/api/anomalies?"+query, nil))
+		var page struct {
+			Items []monitor.Anomaly `json:"items"`
+			Total int64             `json:"total"`
+		}
+		json.NewDecoder(rec.Body).Decode(&page)
+		return rec, page.Items
+	}
+	if rec, items := list("resolved=false"); rec.Code != http.StatusOK || len(items) != 1 || items[0].Type != "oom" || items[0].Host != "web-1" || items[0].Severity != "critical" {
+		t.Fatalf("Expected the open OOM anomaly on web-1, got %d %+v", rec.Code, items)
+	}
+	if _, items := list("type=disk&resolved=true"); len(items) != 1 || items[0].ResolvedAt == nil || items[0].Analysis != "AI 分析" || items[0].Severity != "warning" {
+		t.Errorf("Expected the resolved disk anomaly, got %+v", items)
+	}
+	if _, items := list("pageSize=1&sort=type"); len(items) != 1 || items[0].Type != "disk" {
+		t.Errorf("Expected the first page sorted by type, got %+v", items)
+	}
+	for _, query := range []string{"from=yesterday", "resolved=maybe", "sort=title", "page=0"} {
+		if rec, _ := list(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handleAnomalySummary(rec, httptest.NewRequest(http.MethodGet, "/api/anomalies/summary", nil))
+	var summary struct {
+		Days          []monitor.DailyCount `json:"days"`
+		RetentionDays int                  `json:"retention_days"`
+	}
+	json.NewDecoder(rec.Body).Decode(&summary)
+	if rec.Code != http.StatusOK || len(summary.Days) != 2 || summary.RetentionDays != 90 {
+		t.Errorf("Expected counts for disk and oom over the last 7 days, got %d %+v", rec.Code, summary)
+	}
+	rec = httptest.NewRecorder()
+	handleAnomalySummary(rec, httptest.NewRequest(http.MethodGet, "/api/anomalies/summary?from=1772380800&to=1772377200", nil))
+	if envelope := decodeEnvelope(t, rec); envelope.Code != "ANOMALIES_INVALID_QUERY" {
+		t.Errorf("Expected ANOMALIES_INVALID_QUERY for a reversed range, got %+v", envelope)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/archive"
+)
+
+// ArchiveStatusResponse 归档状态接口返回，从未执行过归档时 last_run 为空
+type ArchiveStatusResponse struct {
+	Dir     string             `json:"dir"`
+	Tables  []string           `json:"tables"`
+	LastRun *archive.RunResult `json:"last_run"`
+}
+
+// handleArchiveStatus 返回最近一次归档结果（包括 CLI 执行的归档）
+func handleArchiveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	archiver := archive.Default()
+	if archiver == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Archiving not enabled")
+		return
+	}
+	last, err := archiver.Status()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ArchiveStatusResponse{Dir: archiver.Dir(), Tables: archiver.Tables(), LastRun: last})
+}
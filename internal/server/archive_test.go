@@ -0,0 +1,37 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/archive"
+	"testing"
+)
+
+func TestHandleArchiveStatus(t *testing.T) {
+	t.Cleanup(func() { archive.SetDefault(nil) })
+
+	rec := httptest.NewRecorder()
+	handleArchiveStatus(rec, httptest.NewRequest(http.MethodGet, "/api/archive/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 when archiving is disabled, got %d", rec.Code)
+	}
+
+	dir := t.TempDir()
+	archive.SetDefault(archive.NewArchiver(dir, 0))
+	rec = httptest.NewRecorder()
+	handleArchiveStatus(rec, httptest.NewRequest(http.MethodGet, "/api/archive/status", nil))
+	var resp ArchiveStatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.LastRun != nil {
+		t.Fatalf("Expected empty status before the first run, got %s", rec.Body.String())
+	}
+
+	os.WriteFile(filepath.Join(dir, "last_run.json"), []byte(`{"tables":[{"table":"alerts","rows":3,"deleted":3}]}`), 0644)
+	rec = httptest.NewRecorder()
+	handleArchiveStatus(rec, httptest.NewRequest(http.MethodGet, "/api/archive/status", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.LastRun == nil || resp.LastRun.Tables[0].Deleted != 3 {
+		t.Errorf("Expected last run from the archive directory, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"qwq/internal/logger"
+	"qwq/internal/realip"
+	"qwq/internal/security"
+	"qwq/internal/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// auditMethodExec 对话中执行的命令在审计记录中的方法
+	auditMethodExec = "EXEC"
+	// maxAuditSummary 审计记录中请求摘要的最大长度
+	maxAuditSummary = 512
+	// auditPageSize 审计记录查询每页的条数
+	auditPageSize = 50
+)
+
+// auditSecretField 请求体中需要隐藏取值的字段，security.Redact 不处理密码和令牌；
+// 摘要截断处的值没有结束引号，同样隐藏
+var auditSecretField = regexp.MustCompile(`(?i)("[^"]*(?:password|secret|token|api_?key|private_?key)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|$)`)
+
+// AuditEntry 一条操作审计记录：Web API 的写请求，或 Web 对话中执行的命令（方法为 EXEC）
+type AuditEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Time       time.Time `json:"time" gorm:"index"`
+	User       string    `json:"user" gorm:"column:username;index"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path" gorm:"index"`
+	RemoteIP   string    `json:"remote_ip"`
+	Summary    string    `json:"summary"` // 脱敏后的请求体摘要，EXEC 为命令
+	Status     int       `json:"status"`  // 响应状态码，EXEC 为命令的退出码
+	DurationMS int64     `json:"duration_ms"`
+}
+
+func (AuditEntry) TableName() string { return "qwq_audit_log" }
+
+// recordAudit 保存审计记录，数据库不可用时只写入日志
+func recordAudit(entry AuditEntry) {
+	db, err := dashboardDB()
+	if err == nil {
+		err = db.Create(&entry).Error
+	}
+	if err != nil {
+		logger.Info("⚠️ 保存审计记录失败: %s %s by %s: %v", entry.Method, entry.Path, entry.User, err)
+	}
+}
+
+// auditRequest 记录认证通过的非 GET API 请求：用户、方法、路径、客户端地址、请求体摘要、状态码和耗时
+func auditRequest(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next(w, r)
+			return
+		}
+		start := time.Now()
+		summary := auditSummary(r)
+		rw := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+		recordAudit(AuditEntry{
+			Time:       start.UTC(),
+			User:       requestUser(r),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteIP:   realip.FromRequest(r),
+			Summary:    summary,
+			Status:     rw.status,
+			DurationMS: time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+// auditCommand 记录 Web 对话中执行的命令
+func auditCommand(r *http.Request, res *utils.ShellResult) {
+	recordAudit(AuditEntry{
+		Time:       time.Now().Add(-res.Duration).UTC(),
+		User:       requestUser(r),
+		Method:     auditMethodExec,
+		Path:       r.URL.Path,
+		RemoteIP:   realip.FromRequest(r),
+		Summary:    clipAudit(security.Redact(res.Command)),
+		Status:     res.ExitCode,
+		DurationMS: res.Duration.Milliseconds(),
+	})
+}
+
+// auditSummary 请求体的摘要：JSON 和表单取开头部分，隐藏密码类字段并经 security.Redact 脱敏；
+// 其他类型（如文件上传）只记录类型和长度。读取的部分放回请求体，不影响处理器
+func auditSummary(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return security.Redact(r.URL.RawQuery)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "application/json" && mediaType != "application/x-www-form-urlencoded" && !strings.HasPrefix(mediaType, "text/") {
+		return fmt.Sprintf("<%s, %d bytes>", mediaType, r.ContentLength)
+	}
+	head := make([]byte, maxAuditSummary)
+	n, _ := io.ReadFull(r.Body, head)
+	head = head[:n]
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	summary := string(head)
+	if mediaType == "application/x-www-form-urlencoded" {
+		summary = auditSecretField.ReplaceAllString(formAsJSON(summary), `$1"***"`)
+	} else {
+		summary = auditSecretField.ReplaceAllString(summary, `$1"***"`)
+	}
+	summary = security.Redact(summary)
+	if r.URL.RawQuery != "" {
+		summary = security.Redact(r.URL.RawQuery) + " " + summary
+	}
+	return clipAudit(strings.TrimSpace(summary))
+}
+
+// formAsJSON 把表单编码的请求体转换为 JSON，便于按字段名隐藏密码
+func formAsJSON(body string) string {
+	fields := make(map[string]string)
+	for _, pair := range strings.Split(body, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		fields[key] = value
+	}
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
+
+// clipAudit 截断到 maxAuditSummary 字节，不截断多字节字符
+func clipAudit(s string) string {
+	if len(s) <= maxAuditSummary {
+		return s
+	}
+	end := maxAuditSummary
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + "…"
+}
+
+// auditResponseWriter 记录响应状态码，实现 Flusher 保证流式响应正常工作
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// handleAudit 查询操作审计记录 GET /api/audit?user=&path=&from=&to=&page=
+// path 按前缀匹配，from、to 为 RFC3339 或 Unix 秒；最新的在前，每页 auditPageSize 条
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	values := r.URL.Query()
+	from, err := parseEventTime(values.Get("from"))
+	if err != nil {
+		writeError(w, r, requiredField("from", "from must be an RFC3339 time or unix seconds"))
+		return
+	}
+	to, err := parseEventTime(values.Get("to"))
+	if err != nil {
+		writeError(w, r, requiredField("to", "to must be an RFC3339 time or unix seconds"))
+		return
+	}
+	page := 1
+	if value := values.Get("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			writeError(w, r, requiredField("page", "page must be a positive integer"))
+			return
+		}
+	}
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	query := db.Model(&AuditEntry{})
+	if user := values.Get("user"); user != "" {
+		query = query.Where("username = ?", user)
+	}
+	if path := values.Get("path"); path != "" {
+		query = query.Where("path LIKE ? ESCAPE '\\'", escapeLike(path)+"%")
+	}
+	if !from.IsZero() {
+		query = query.Where("time >= ?", from.UTC())
+	}
+	if !to.IsZero() {
+		query = query.Where("time < ?", to.UTC())
+	}
+	// 计数和分页查询共用过滤条件
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		writeError(w, r, err)
+		return
+	}
+	entries := []AuditEntry{}
+	if err := query.Order("time DESC, id DESC").Offset((page - 1) * auditPageSize).Limit(auditPageSize).Find(&entries).Error; err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":   entries,
+		"total":     total,
+		"page":      page,
+		"page_size": auditPageSize,
+	})
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
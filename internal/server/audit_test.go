@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditRequest_RecordsMutations(t *testing.T) {
+	db := setupDashboard(t)
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "", "" })
+
+	var received string
+	handler := basicAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	body := `{"path":"/etc/app.conf","content":"upstream 10.0.0.5:8080","password":"hunter2"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/files/save", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	handler(httptest.NewRecorder(), req)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/files/list", nil))
+
+	if received != body {
+		t.Fatalf("Expected the handler to read the full body, got %q", received)
+	}
+	var entries []AuditEntry
+	db.Find(&entries)
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the POST to be audited, got %+v", entries)
+	}
+	entry := entries[0]
+	if entry.Method != http.MethodPost || entry.Path != "/api/files/save" || entry.Status != http.StatusAccepted || entry.User != "192.0.2.1" || entry.RemoteIP != "192.0.2.1" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if strings.Contains(entry.Summary, "hunter2") || strings.Contains(entry.Summary, "10.0.0.5") || !strings.Contains(entry.Summary, "/etc/app.conf") {
+		t.Errorf("Expected a redacted summary, got %q", entry.Summary)
+	}
+}
+
+func TestAuditSummary_TruncatedSecret(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("x", maxAuditSummary-30) + `","api_key":"abcdefghijklmnopqrstuvwxyz"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(body))
+	if summary := auditSummary(req); strings.Contains(summary, "abcdefgh") {
+		t.Errorf("A secret cut off by the summary limit must stay hidden, got %q", summary)
+	}
+	upload := httptest.NewRequest(http.MethodPost, "/api/files/upload", strings.NewReader("binary"))
+	upload.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	if summary := auditSummary(upload); summary != "<multipart/form-data, 6 bytes>" {
+		t.Errorf("Expected only the type and size of uploads, got %q", summary)
+	}
+}
+
+func TestHandleAudit_Filters(t *testing.T) {
+	db := setupDashboard(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < auditPageSize+5; i++ {
+		db.Create(&AuditEntry{Time: base.Add(time.Duration(i) * time.Minute), User: "alice", Method: http.MethodPost, Path: "/api/container/action", Status: http.StatusOK})
+	}
+	db.Create(&AuditEntry{Time: base.Add(-time.Hour), User: "bob", Method: auditMethodExec, Path: "/ws/chat", Summary: "df -h"})
+	db.Create(&AuditEntry{Time: base.Add(-time.Hour), User: "bob", Method: http.MethodDelete, Path: "/api/users/5", Status: http.StatusOK})
+
+	query := func(q string) (result struct {
+		Entries []AuditEntry `json:"entries"`
+		Total   int64        `json:"total"`
+		Page    int          `json:"page"`
+	}) {
+		rec := httptest.NewRecorder()
+		handleAudit(rec, httptest.NewRequest(http.MethodGet, "/api/audit?"+q, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", q, rec.Code, rec.Body.String())
+		}
+		json.NewDecoder(rec.Body).Decode(&result)
+		return result
+	}
+
+	if got := query("user=alice"); got.Total != auditPageSize+5 || len(got.Entries) != auditPageSize || !got.Entries[0].Time.Equal(base.Add((auditPageSize+4)*time.Minute)) {
+		t.Errorf("Expected the newest page first, got total %d, %d entries", got.Total, len(got.Entries))
+	}
+	if got := query("user=alice&page=2"); got.Page != 2 || len(got.Entries) != 5 {
+		t.Errorf("Expected the second page to hold the rest, got %d", len(got.Entries))
+	}
+	if got := query("path=/ws/"); got.Total != 1 || got.Entries[0].Summary != "df -h" {
+		t.Errorf("Expected the path prefix to match the executed command, got %+v", got.Entries)
+	}
+	if got := query("from=" + base.Add(-2*time.Hour).Format(time.RFC3339) + "&to=" + base.Format(time.RFC3339)); got.Total != 2 {
+		t.Errorf("Expected the time range to select bob's entries, got %d", got.Total)
+	}
+
+	rec := httptest.NewRecorder()
+	handleAudit(rec, httptest.NewRequest(http.MethodGet, "/api/audit?page=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid page to be rejected, got %d", rec.Code)
+	}
+}
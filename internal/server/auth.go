@@ -0,0 +1,222 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"qwq/internal/apitoken"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/realip"
+	"qwq/internal/session"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsAuthProtocol WebSocket 子协议中的认证标记：浏览器无法为 WebSocket 设置请求头，
+// 可以用 new WebSocket(url, ["bearer", token]) 传递登录令牌，服务端选择 bearer 子协议
+const wsAuthProtocol = "bearer"
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse 登录结果，token 在 Authorization: Bearer 头中使用
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Username  string    `json:"username"`
+	Roles     []string  `json:"roles"`
+}
+
+// MeResponse 当前用户，method 为认证方式：session（登录令牌）、basic、token（API 令牌）或 none（未开启认证）
+type MeResponse struct {
+	Username  string     `json:"username"`
+	Roles     []string   `json:"roles"`
+	Method    string     `json:"method"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// initSessions 按 auth 配置创建登录令牌管理器：未配置 jwt_secret 时使用首次启动生成并保存的密钥
+func initSessions() error {
+	cfg := config.Current().Auth
+	secret := []byte(cfg.JWTSecret)
+	if cfg.JWTSecret == "" {
+		path := cfg.SecretFile
+		if path == "" {
+			path = session.DefaultSecretFile
+		}
+		var err error
+		if secret, err = session.LoadSecret(path); err != nil {
+			return err
+		}
+	}
+	session.SetDefault(session.NewManager(secret, time.Duration(cfg.TokenTTLHours)*time.Hour))
+	return nil
+}
+
+// authenticateUser 校验用户名和密码，返回用户的角色：先匹配配置的管理员，再匹配用户列表中已启用且设置了密码的用户（bcrypt 哈希）
+func authenticateUser(username, password string) ([]string, bool) {
+	userCfg, passCfg := config.Current().WebUser, config.Current().WebPassword
+	if subtle.ConstantTimeCompare([]byte(username), []byte(userCfg)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(passCfg)) == 1 {
+		return []string{adminRole}, true
+	}
+	if username == userCfg {
+		return nil, false
+	}
+	user, ok := findUser(username)
+	if !ok || !user.Enabled || user.Password == "" || !checkPassword(user.Password, password) {
+		return nil, false
+	}
+	return user.Roles, true
+}
+
+// userRoles 用户当前的角色：配置的管理员为 admin，其他用户按用户列表
+func userRoles(username string) []string {
+	if config.Current().WebUser != "" && username == config.Current().WebUser {
+		return []string{adminRole}
+	}
+	if user, ok := findUser(username); ok {
+		return user.Roles
+	}
+	return []string{}
+}
+
+// handleAuthLogin 用户名密码登录，返回签名的登录令牌；不经过 basicAuth
+func handleAuthLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if config.Current().WebUser == "" || config.Current().WebPassword == "" {
+		writeError(w, r, errAuthDisabled)
+		return
+	}
+	manager := session.Default()
+	if manager == nil {
+		writeError(w, r, errSessionUnavailable)
+		return
+	}
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+	roles, ok := authenticateUser(req.Username, req.Password)
+	if !ok {
+		logger.Info("[AUDIT] 🔒 登录失败: 用户 %q from %s", req.Username, realip.FromRequest(r))
+		writeError(w, r, errInvalidLogin)
+		return
+	}
+	token, claims, err := manager.Issue(req.Username, roles)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	logger.Info("[AUDIT] 🔑 用户 %s 登录 from %s", req.Username, realip.FromRequest(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{Token: token, ExpiresAt: claims.Expiry(), Username: claims.Subject, Roles: claims.Roles})
+}
+
+// handleAuthLogout 注销当前的登录令牌，令牌在过期之前都会被拒绝
+func handleAuthLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	claims := session.FromContext(r.Context())
+	manager := session.Default()
+	if claims == nil || manager == nil {
+		writeError(w, r, errSessionRequired)
+		return
+	}
+	manager.Revoke(claims)
+	logger.Info("[AUDIT] 🔑 用户 %s 注销 from %s", claims.Subject, realip.FromRequest(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAuthMe 返回当前用户的用户名、角色和认证方式
+func handleAuthMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	resp := MeResponse{Roles: []string{}, Method: "none"}
+	if claims := session.FromContext(r.Context()); claims != nil {
+		expires := claims.Expiry()
+		resp = MeResponse{Username: claims.Subject, Roles: userRoles(claims.Subject), Method: "session", ExpiresAt: &expires}
+	} else if token := requestToken(r); token != nil {
+		resp = MeResponse{Username: token.Owner, Roles: userRoles(token.Owner), Method: "token", ExpiresAt: token.ExpiresAt}
+	} else if user, ok := authUser(r); ok && config.Current().WebUser != "" {
+		resp = MeResponse{Username: user, Roles: userRoles(user), Method: "basic"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// requestBearer 请求携带的 Bearer 令牌：Authorization 头；WebSocket 握手还可以用 ?token= 参数或 bearer 子协议
+func requestBearer(r *http.Request) (string, bool) {
+	if secret, ok := bearerToken(r); ok {
+		return secret, true
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		return "", false
+	}
+	if secret := r.URL.Query().Get("token"); secret != "" {
+		return secret, true
+	}
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == wsAuthProtocol && i+1 < len(protocols) {
+			return protocols[i+1], true
+		}
+	}
+	return "", false
+}
+
+// sessionAuth 校验登录令牌，通过后把声明放入请求上下文；过期、注销和无效的令牌都返回 401
+func sessionAuth(w http.ResponseWriter, r *http.Request, secret string, next http.HandlerFunc) {
+	manager := session.Default()
+	if manager == nil {
+		respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	claims, err := manager.Verify(secret)
+	if err != nil {
+		if !errors.Is(err, session.ErrTokenExpired) {
+			logger.Info("[AUDIT] 🔒 登录令牌认证失败: %v from %s", err, realip.FromRequest(r))
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if claims.Subject != config.Current().WebUser && !activeUser(claims.Subject) {
+		logger.Info("[AUDIT] 🔒 登录令牌所属用户 %s 已停用 from %s", claims.Subject, realip.FromRequest(r))
+		respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	next(w, r.WithContext(session.WithClaims(r.Context(), claims)))
+}
+
+// bearerAuth 按令牌格式分派：qwq_ 开头的是 API 令牌，其余按登录令牌校验
+func bearerAuth(w http.ResponseWriter, r *http.Request, secret string, next http.HandlerFunc) {
+	if strings.HasPrefix(secret, apitoken.Prefix) {
+		tokenAuth(w, r, secret, next)
+		return
+	}
+	sessionAuth(w, r, secret, next)
+}
+
+// authUser 认证的用户名：登录令牌的用户或 Basic Auth 用户名
+func authUser(r *http.Request) (string, bool) {
+	if claims := session.FromContext(r.Context()); claims != nil {
+		return claims.Subject, true
+	}
+	user, _, ok := r.BasicAuth()
+	return user, ok && user != ""
+}
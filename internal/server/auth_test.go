@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/session"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupSessions(t *testing.T, ttl time.Duration) {
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		session.SetDefault(nil)
+	})
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+	session.SetDefault(session.NewManager([]byte("0123456789abcdef0123456789abcdef"), ttl))
+}
+
+func login(t *testing.T, body string) (*httptest.ResponseRecorder, LoginResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleAuthLogin(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body)))
+	var resp LoginResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec, resp
+}
+
+func TestAuth_LoginMeLogout(t *testing.T) {
+	setupSessions(t, time.Hour)
+
+	if rec, _ := login(t, `{"username":"admin","password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong password, got %d", rec.Code)
+	}
+	rec, resp := login(t, `{"username":"admin","password":"secret"}`)
+	if rec.Code != http.StatusOK || resp.Token == "" || resp.Username != "admin" || time.Until(resp.ExpiresAt) < 59*time.Minute {
+		t.Fatalf("Expected a session token, got %d %+v", rec.Code, resp)
+	}
+
+	me := func(configure func(*http.Request)) (int, MeResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+		configure(req)
+		rec := httptest.NewRecorder()
+		basicAuth(handleAuthMe)(rec, req)
+		var me MeResponse
+		json.NewDecoder(rec.Body).Decode(&me)
+		return rec.Code, me
+	}
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+resp.Token) }
+	if code, got := me(bearer); code != http.StatusOK || got.Username != "admin" || got.Method != "session" || len(got.Roles) != 1 || got.Roles[0] != adminRole {
+		t.Errorf("Expected the session user, got %d %+v", code, got)
+	}
+	// 旧的 Basic Auth 仍然可用
+	if code, got := me(func(req *http.Request) { req.SetBasicAuth("admin", "secret") }); code != http.StatusOK || got.Method != "basic" {
+		t.Errorf("Expected basic auth to keep working, got %d %+v", code, got)
+	}
+	if code, _ := me(func(*http.Request) {}); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	bearer(req)
+	rec = httptest.NewRecorder()
+	basicAuth(handleAuthLogout)(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected logout to succeed, got %d %s", rec.Code, rec.Body.String())
+	}
+	if code, _ := me(bearer); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked token to get 401, got %d", code)
+	}
+}
+
+func TestAuth_ExpiredTokenIsUnauthorized(t *testing.T) {
+	setupSessions(t, time.Nanosecond)
+	_, resp := login(t, `{"username":"admin","password":"secret"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rec := httptest.NewRecorder()
+	basicAuth(handleAuthMe)(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Errorf("Expected 401 for an expired token, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestAuth_WebSocketToken(t *testing.T) {
+	setupSessions(t, time.Hour)
+	_, resp := login(t, `{"username":"admin","password":"secret"}`)
+
+	var user string
+	handler := basicAuth(func(w http.ResponseWriter, r *http.Request) { user = requestUser(r) })
+	upgrade := func(target string, protocols string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		if protocols != "" {
+			req.Header.Set("Sec-WebSocket-Protocol", protocols)
+		}
+		rec := httptest.NewRecorder()
+		user = ""
+		handler(rec, req)
+		return rec.Code
+	}
+	if upgrade("/ws/chat?token="+resp.Token, ""); user != "admin" {
+		t.Errorf("Expected the query token to authenticate, got %q", user)
+	}
+	if upgrade("/ws/chat", wsAuthProtocol+", "+resp.Token); user != "admin" {
+		t.Errorf("Expected the subprotocol token to authenticate, got %q", user)
+	}
+	if code := upgrade("/ws/chat?token=invalid", ""); code != http.StatusUnauthorized || user != "" {
+		t.Errorf("Expected 401 for an invalid token, got %d", code)
+	}
+	// 普通请求不接受查询参数中的令牌
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me?token="+resp.Token, nil)
+	rec := httptest.NewRecorder()
+	basicAuth(handleAuthMe)(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a query token outside WebSocket, got %d", rec.Code)
+	}
+}
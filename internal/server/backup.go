@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/backup"
+	"qwq/internal/logger"
+	"sync"
+)
+
+var (
+	// configBackups 配置备份管理器，由启动时注入；未注入时备份接口返回 503
+	configBackups   *backup.ConfigBackupManager
+	configBackupsMu sync.RWMutex
+)
+
+// errBackupsUnavailable 配置备份未启用
+var errBackupsUnavailable = apierror.New(http.StatusServiceUnavailable, "BACKUP_UNAVAILABLE", "Config backup is not available")
+
+// SetConfigBackups 设置控制台使用的配置备份管理器
+func SetConfigBackups(manager *backup.ConfigBackupManager) {
+	configBackupsMu.Lock()
+	defer configBackupsMu.Unlock()
+	configBackups = manager
+}
+
+// configBackupManager 当前的配置备份管理器，未设置时为 nil
+func configBackupManager() *backup.ConfigBackupManager {
+	configBackupsMu.RLock()
+	defer configBackupsMu.RUnlock()
+	return configBackups
+}
+
+// handleBackupRun 立即备份 nginx 配置、compose 项目、数据库和配置文件
+//
+//	POST /api/backup/run
+func handleBackupRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	manager := configBackupManager()
+	if manager == nil {
+		writeError(w, r, errBackupsUnavailable)
+		return
+	}
+
+	created, err := manager.Backup(r.Context(), "manual")
+	if err != nil {
+		logger.Info("[AUDIT] ❌ 配置备份失败 by %s: %v", requestActor(r), err)
+		writeError(w, r, err)
+		return
+	}
+	logger.Info("[AUDIT] 💾 创建配置备份 %s by %s", created.ID, requestActor(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// handleBackupList 列出配置备份（最新的在前）
+//
+//	GET /api/backup/list
+func handleBackupList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	manager := configBackupManager()
+	if manager == nil {
+		writeError(w, r, errBackupsUnavailable)
+		return
+	}
+
+	backups, err := manager.ListBackups()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if backups == nil {
+		backups = []*backup.ConfigBackup{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backups)
+}
+
+// handleBackupRestore 从配置备份恢复一个组件，不支持一次恢复全部组件
+//
+//	POST /api/backup/restore  body {"id": "...", "component": "nginx|compose|database|config"}
+func handleBackupRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	manager := configBackupManager()
+	if manager == nil {
+		writeError(w, r, errBackupsUnavailable)
+		return
+	}
+
+	var req struct {
+		ID        string `json:"id"`
+		Component string `json:"component"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+	if req.ID == "" {
+		respondError(w, r, http.StatusBadRequest, "Missing id")
+		return
+	}
+
+	result, err := manager.Restore(r.Context(), req.ID, req.Component)
+	if err != nil {
+		logger.Info("[AUDIT] ❌ 恢复配置备份失败: %s %s by %s: %v", req.ID, req.Component, requestActor(r), err)
+		writeError(w, r, err)
+		return
+	}
+	logger.Info("[AUDIT] ♻️ 恢复配置备份: %s %s by %s", req.ID, req.Component, requestActor(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
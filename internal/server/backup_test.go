@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/backup"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestConfigBackupAPI(t *testing.T) {
+	saved := configBackupManager()
+	t.Cleanup(func() { SetConfigBackups(saved) })
+
+	SetConfigBackups(nil)
+	rec := httptest.NewRecorder()
+	handleBackupList(rec, httptest.NewRequest(http.MethodGet, "/api/backup/list", nil))
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusServiceUnavailable || envelope.Code != "BACKUP_UNAVAILABLE" {
+		t.Fatalf("Expected 503 without a backup manager, got %d %+v", rec.Code, envelope)
+	}
+
+	dir := t.TempDir()
+	nginxDir := filepath.Join(dir, "sites")
+	os.MkdirAll(nginxDir, 0755)
+	os.WriteFile(filepath.Join(nginxDir, "a.com.conf"), []byte("server {}\n"), 0644)
+	var nginxCalls []string
+	nginx := func(ctx context.Context, args ...string) ([]byte, error) {
+		nginxCalls = append(nginxCalls, strings.Join(args, " "))
+		return nil, nil
+	}
+	SetConfigBackups(backup.NewConfigBackupManager(config.BackupConfig{Dir: filepath.Join(dir, "backups")}, backup.ConfigSources{NginxDir: nginxDir}, nginx))
+
+	rec = httptest.NewRecorder()
+	handleBackupRun(rec, httptest.NewRequest(http.MethodPost, "/api/backup/run", nil))
+	var created backup.ConfigBackup
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusCreated || created.ID == "" || created.Trigger != "manual" {
+		t.Fatalf("Expected a manual backup, got %d %+v", rec.Code, created)
+	}
+
+	rec = httptest.NewRecorder()
+	handleBackupList(rec, httptest.NewRequest(http.MethodGet, "/api/backup/list", nil))
+	var list []backup.ConfigBackup
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list) != 1 || list[0].ID != created.ID {
+		t.Fatalf("Expected the new backup in the list, got %d %+v", rec.Code, list)
+	}
+
+	restore := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleBackupRestore(rec, httptest.NewRequest(http.MethodPost, "/api/backup/restore", strings.NewReader(body)))
+		return rec
+	}
+	if rec := restore(`{"id":"` + created.ID + `","component":"all"}`); rec.Code != http.StatusBadRequest || decodeEnvelope(t, rec).Code != "BACKUP_INVALID_COMPONENT" {
+		t.Errorf("Expected 400 for a full restore, got %d", rec.Code)
+	}
+	if rec := restore(`{"id":"` + created.ID + `","component":"compose"}`); rec.Code != http.StatusNotFound || decodeEnvelope(t, rec).Code != "BACKUP_COMPONENT_NOT_FOUND" {
+		t.Errorf("Expected 404 for a component missing from the backup, got %d", rec.Code)
+	}
+	if rec := restore(`{"id":"missing","component":"nginx"}`); rec.Code != http.StatusNotFound || decodeEnvelope(t, rec).Code != "BACKUP_NOT_FOUND" {
+		t.Errorf("Expected 404 for an unknown backup, got %d", rec.Code)
+	}
+
+	os.WriteFile(filepath.Join(nginxDir, "a.com.conf"), []byte("broken"), 0644)
+	rec = restore(`{"id":"` + created.ID + `","component":"nginx"}`)
+	var result backup.RestoreResult
+	json.NewDecoder(rec.Body).Decode(&result)
+	if rec.Code != http.StatusOK || result.Component != "nginx" || strings.Join(nginxCalls, ",") != "-t,-s reload" {
+		t.Errorf("Expected nginx to be tested and reloaded, got %d %+v %v", rec.Code, result, nginxCalls)
+	}
+	if data, _ := os.ReadFile(filepath.Join(nginxDir, "a.com.conf")); string(data) != "server {}\n" {
+		t.Errorf("Expected the backed up site config, got %q", data)
+	}
+}
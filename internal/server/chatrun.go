@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"qwq/internal/agent"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultApprovalTimeout 等待用户确认命令的默认时间，超时视为拒绝
+const defaultApprovalTimeout = 2 * time.Minute
+
+// PermissionChatExec 在 Web 对话中确认执行自动执行策略要求确认的命令；没有该权限时这些命令一律跳过
+const PermissionChatExec = "chat:exec"
+
+// chatControl 客户端发送的控制帧，如 {"type":"cancel","id":"..."} 和
+// {"type":"approval_response","id":"...","approved":true}；其余消息视为用户输入
+type chatControl struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Approved bool   `json:"approved"`
+}
+
+// parseChatControl 解析控制帧，普通文本消息返回 false
+func parseChatControl(msg []byte) (chatControl, bool) {
+	trimmed := bytes.TrimSpace(msg)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return chatControl{}, false
+	}
+	var control chatControl
+	if err := json.Unmarshal(trimmed, &control); err != nil || control.Type == "" {
+		return chatControl{}, false
+	}
+	return control, true
+}
+
+// chatRun 一次正在执行的 Agent 运行
+type chatRun struct {
+	id        string
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// chatSession 一个聊天 WebSocket 连接：串行化写入，并跟踪当前的 Agent 运行以便取消
+type chatSession struct {
+	user    string
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu  sync.Mutex
+	run *chatRun
+	// approvals 等待用户确认的命令，键为 approval_request 的 id
+	approvals map[string]chan bool
+}
+
+// newID 运行和审批请求的随机 id
+func newID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// send 发送一帧消息，读协程和处理协程都会写入，需要加锁
+func (s *chatSession) send(frame interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.WriteJSON(frame)
+}
+
+// startRun 开始一次 Agent 运行，返回的 ctx 在运行被取消或连接断开时取消
+func (s *chatSession) startRun(parent context.Context) (context.Context, *chatRun) {
+	ctx, cancel := context.WithCancel(parent)
+	run := &chatRun{id: newID(), cancel: cancel}
+
+	s.mu.Lock()
+	s.run = run
+	s.mu.Unlock()
+	return ctx, run
+}
+
+// finishRun 结束运行，返回运行是否被取消
+func (s *chatSession) finishRun(run *chatRun) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.run == run {
+		s.run = nil
+	}
+	run.cancel()
+	return run.cancelled
+}
+
+// cancelRun 取消当前运行，id 为空时取消任意正在执行的运行；没有匹配的运行时返回 false
+func (s *chatSession) cancelRun(id, reason string) bool {
+	s.mu.Lock()
+	run := s.run
+	if run == nil || (id != "" && run.id != id) || run.cancelled {
+		s.mu.Unlock()
+		return false
+	}
+	run.cancelled = true
+	s.mu.Unlock()
+
+	run.cancel()
+	logger.Info("[AUDIT] ⏹️ Agent 运行已取消: %s by %s (%s)", run.id, s.user, reason)
+	return true
+}
+
+// approvalTimeout 等待用户确认命令的时间，可通过 autoexec.approval_timeout 配置
+func approvalTimeout() time.Duration {
+	if seconds := config.Current().AutoExec.ApprovalTimeout; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultApprovalTimeout
+}
+
+// requestApproval 下发 approval_request 并等待客户端的 approval_response，运行被取消、连接断开或超时时视为拒绝
+// 等待期间读协程照常处理其他消息，审批按 id 匹配，同一连接可以有多个待确认的命令
+func (s *chatSession) requestApproval(ctx context.Context, runID string, req agent.CommandApproval) bool {
+	id := newID()
+	ch := make(chan bool, 1)
+	s.mu.Lock()
+	if s.approvals == nil {
+		s.approvals = make(map[string]chan bool)
+	}
+	s.approvals[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.approvals, id)
+		s.mu.Unlock()
+	}()
+
+	timeout := approvalTimeout()
+	logger.Info("[AUDIT] ⏳ 等待用户确认命令: %q by %s (%s)", req.Command, s.user, req.Policy)
+	s.send(map[string]interface{}{
+		"type": "approval_request", "id": id, "run": runID,
+		"command": req.Command, "reason": req.Reason, "policy": req.Policy,
+		"timeout": int(timeout / time.Second),
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case approved := <-ch:
+		return approved
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		logger.Info("[AUDIT] ⌛ 命令确认超时，已拒绝: %q by %s", req.Command, s.user)
+		s.send(map[string]interface{}{"type": "approval_expired", "id": id, "run": runID})
+		return false
+	}
+}
+
+// resolveApproval 处理客户端对审批请求的回复，没有对应的待确认命令（已超时或 id 错误）时返回 false
+func (s *chatSession) resolveApproval(id string, approved bool) bool {
+	s.mu.Lock()
+	ch, ok := s.approvals[id]
+	if ok {
+		delete(s.approvals, id)
+	}
+	s.mu.Unlock()
+	if ok {
+		ch <- approved
+	}
+	return ok
+}
+
+// chatPermissions Web 对话中 Agent 工具的权限：启用认证时按用户的角色权限（userGrants）判断，
+// 配置的管理员和 admin 角色拥有全部权限；未启用认证时任何人都能连接，只允许只读操作
+func chatPermissions(user string) agent.PermissionFunc {
+	if config.Current().WebUser == "" || config.Current().WebPassword == "" {
+		return func(permission string) bool {
+			return strings.HasSuffix(permission, ":read")
+		}
+	}
+	return ownerPermissions(user)
+}
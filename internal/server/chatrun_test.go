@@ -0,0 +1,318 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/agent"
+	"qwq/internal/config"
+	"qwq/internal/incident"
+	"qwq/internal/security"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseChatControl(t *testing.T) {
+	if control, ok := parseChatControl([]byte(` {"type":"cancel","id":"abc"}`)); !ok || control.Type != "cancel" || control.ID != "abc" {
+		t.Errorf("Expected cancel frame, got %+v %v", control, ok)
+	}
+	if control, ok := parseChatControl([]byte(`{"type":"approval_response","id":"r1","approved":true}`)); !ok || control.ID != "r1" || !control.Approved {
+		t.Errorf("Expected approval response, got %+v %v", control, ok)
+	}
+	for _, input := range []string{"看看内存", `{"foo": 1}`, "{not json"} {
+		if _, ok := parseChatControl([]byte(input)); ok {
+			t.Errorf("%q should be treated as user input", input)
+		}
+	}
+}
+
+func TestWSChat_CancelRun(t *testing.T) {
+	saved := config.Current()
+	savedPolicy := security.CurrentAutoExecPolicy()
+	savedTranscripts := incident.DefaultTranscripts
+	t.Cleanup(func() {
+		config.Store(saved)
+		security.SetAutoExecPolicy(savedPolicy)
+		incident.DefaultTranscripts = savedTranscripts
+		agent.InitClient()
+	})
+	incident.DefaultTranscripts = incident.NewTranscripts(t.TempDir())
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"execute_shell_command","arguments":"{\"command\":\"echo partial; sleep 30\",\"reason\":\"scan\"}"}}
+		]}}]}`)
+	}))
+	defer api.Close()
+	config.Update(func(cfg *config.Config) { cfg.ApiKey, cfg.BaseURL = "test", api.URL })
+	agent.InitClient()
+	policy, err := security.NewAutoExecPolicy(config.AutoExecConfig{Rules: []config.AutoExecRule{
+		{Match: "prefix", Pattern: "echo", Action: "auto"},
+		{Match: "prefix", Pattern: "sleep", Action: "auto"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetAutoExecPolicy(policy)
+
+	srv := httptest.NewServer(http.HandlerFunc(handleWSChat))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("grep 一下大日志")); err != nil {
+		t.Fatal(err)
+	}
+	frames := make(map[string]map[string]string)
+	for {
+		var frame map[string]string
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON: %v (frames: %v)", err, frames)
+		}
+		frames[frame["type"]] = frame
+		// 命令开始执行后取消
+		if frame["type"] == "log" && strings.HasPrefix(frame["content"], "👉") {
+			time.Sleep(200 * time.Millisecond)
+			conn.WriteJSON(map[string]string{"type": "cancel", "id": frames["run"]["id"]})
+		}
+		if frame["type"] == "run_end" {
+			break
+		}
+	}
+
+	if frames["run"]["id"] == "" || frames["run_end"]["id"] != frames["run"]["id"] {
+		t.Errorf("run_end should carry the run id, got %v / %v", frames["run"], frames["run_end"])
+	}
+	if frames["run_end"]["status"] != "cancelled" {
+		t.Errorf("Expected cancelled run, got %v", frames["run_end"])
+	}
+	if !strings.Contains(frames["partial"]["content"], "partial") {
+		t.Errorf("Expected partial output frame, got %v", frames["partial"])
+	}
+}
+
+func TestWSChat_ApprovalRequest(t *testing.T) {
+	saved := config.Current()
+	savedPolicy := security.CurrentAutoExecPolicy()
+	savedTranscripts := incident.DefaultTranscripts
+	t.Cleanup(func() {
+		config.Store(saved)
+		security.SetAutoExecPolicy(savedPolicy)
+		incident.DefaultTranscripts = savedTranscripts
+		agent.InitClient()
+	})
+	incident.DefaultTranscripts = incident.NewTranscripts(t.TempDir())
+
+	// 第一次请求返回修改命令，收到工具结果后把结果作为回答返回
+	target := filepath.Join(t.TempDir(), "approved")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if last := req.Messages[len(req.Messages)-1]; last.Role == "tool" {
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, "tool: "+last.Content)
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"execute_shell_command","arguments":%q}}
+		]}}]}`, fmt.Sprintf(`{"command":"touch %s","reason":"创建标记文件"}`, target))
+	}))
+	defer api.Close()
+	config.Update(func(cfg *config.Config) {
+		cfg.ApiKey, cfg.BaseURL = "test", api.URL
+		cfg.WebUser, cfg.WebPassword = "admin", "secret"
+		cfg.AutoExec.ApprovalTimeout = 1
+	})
+	agent.InitClient()
+	policy, err := security.NewAutoExecPolicy(config.AutoExecConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	security.SetAutoExecPolicy(policy)
+
+	srv := httptest.NewServer(http.HandlerFunc(handleWSChat))
+	defer srv.Close()
+	dial := func(user string) *websocket.Conn {
+		t.Helper()
+		header := http.Header{}
+		if user != "" {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			req.SetBasicAuth(user, "secret")
+			header.Set("Authorization", req.Header.Get("Authorization"))
+		}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		return conn
+	}
+	// ask 发送一条消息，按 respond 回复审批请求，返回本次运行收到的各类帧和最终回答
+	ask := func(conn *websocket.Conn, respond func(request map[string]interface{})) (map[string]map[string]interface{}, string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("创建标记文件")); err != nil {
+			t.Fatal(err)
+		}
+		frames := make(map[string]map[string]interface{})
+		for {
+			var frame map[string]interface{}
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatalf("ReadJSON: %v (frames: %v)", err, frames)
+			}
+			kind, _ := frame["type"].(string)
+			frames[kind] = frame
+			if kind == "approval_request" {
+				respond(frame)
+			}
+			if kind == "run_end" {
+				answer, _ := frames["answer"]["content"].(string)
+				return frames, answer
+			}
+		}
+	}
+
+	conn := dial("admin")
+	frames, answer := ask(conn, func(request map[string]interface{}) {
+		// 等待确认期间的其他消息照常处理，未知 id 的回复不影响待确认的命令
+		conn.WriteJSON(map[string]interface{}{"type": "approval_response", "id": "unknown", "approved": true})
+		time.Sleep(100 * time.Millisecond)
+		conn.WriteJSON(map[string]interface{}{"type": "approval_response", "id": request["id"], "approved": true})
+	})
+	request := frames["approval_request"]
+	if request["command"] != "touch "+target || request["reason"] != "创建标记文件" || request["run"] != frames["run"]["id"] || request["timeout"] != float64(1) {
+		t.Errorf("Unexpected approval request %v", request)
+	}
+	if frames["status"]["id"] != "unknown" {
+		t.Errorf("Expected a status frame for the unknown approval id, got %v", frames["status"])
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("Expected the approved command to run: %v (answer %q)", err, answer)
+	}
+
+	os.Remove(target)
+	_, answer = ask(conn, func(request map[string]interface{}) {
+		conn.WriteJSON(map[string]interface{}{"type": "approval_response", "id": request["id"], "approved": false})
+	})
+	if _, err := os.Stat(target); err == nil || answer != "tool: User denied." {
+		t.Errorf("Expected the denied command to be skipped and reported to the model, got %q", answer)
+	}
+
+	// 不回复时超时视为拒绝
+	frames, answer = ask(conn, func(map[string]interface{}) {})
+	if frames["approval_expired"]["id"] != frames["approval_request"]["id"] || answer != "tool: User denied." {
+		t.Errorf("Expected the approval to expire and be denied, got %v %q", frames["approval_expired"], answer)
+	}
+
+	// 没有 chat:exec 权限时不请求确认，直接跳过
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "", "" })
+	frames, answer = ask(dial(""), func(map[string]interface{}) { t.Error("Unauthenticated chat should not be asked for approval") })
+	if _, ok := frames["approval_request"]; ok || answer != "tool: User denied." {
+		t.Errorf("Expected the command to be skipped without approval, got %q", answer)
+	}
+}
+
+func TestChatPermissions(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "", "" })
+	anonymous := chatPermissions("10.0.0.1")
+	if !anonymous(agent.PermissionContainerRead) || anonymous(agent.PermissionContainerWrite) {
+		t.Error("Unauthenticated chat should only get read permissions")
+	}
+
+	setupRBAC(t)
+	if !chatPermissions("admin")(agent.PermissionContainerWrite) {
+		t.Error("Authenticated admin should be allowed to deploy")
+	}
+
+	// 其他用户按角色权限判断，不再一律只读
+	db, _ := dashboardDB()
+	db.Create(&Role{Name: "operator", Permissions: []string{PermissionChatExec}})
+	db.Create(&User{Username: "operator", Roles: []string{"operator"}, Enabled: true})
+	operator := chatPermissions("operator")
+	if !operator(PermissionChatExec) || operator(agent.PermissionContainerWrite) {
+		t.Error("Operator should be allowed to approve exec in chat and nothing else")
+	}
+	if ops := chatPermissions("ops"); !ops("containers:write") || ops(PermissionChatExec) {
+		t.Error("Expected resource wildcards from the ops role")
+	}
+	if viewer := chatPermissions("viewer"); viewer(PermissionChatExec) || !viewer("containers:read") {
+		t.Error("Viewer should only get the role's read permissions")
+	}
+}
+
+func TestWSChat_StreamsAnswer(t *testing.T) {
+	saved := config.Current()
+	savedTranscripts := incident.DefaultTranscripts
+	t.Cleanup(func() {
+		config.Store(saved)
+		incident.DefaultTranscripts = savedTranscripts
+		agent.InitClient()
+	})
+	incident.DefaultTranscripts = incident.NewTranscripts(t.TempDir())
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"内存", "使用率", "正常"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer api.Close()
+	config.Update(func(cfg *config.Config) { cfg.ApiKey, cfg.BaseURL, cfg.NoStream = "test", api.URL, false })
+	agent.InitClient()
+
+	srv := httptest.NewServer(http.HandlerFunc(handleWSChat))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?stream=1", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("帮我总结一下今天的巡检结论")); err != nil {
+		t.Fatal(err)
+	}
+	// 第一轮回答以增量下发，结束时下发完整回答
+	var deltas []string
+	var done map[string]string
+	for done == nil {
+		var frame map[string]string
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON: %v (deltas: %q)", err, deltas)
+		}
+		switch frame["type"] {
+		case "answer_delta":
+			deltas = append(deltas, frame["content"])
+		case "answer_done":
+			done = frame
+		case "answer", "run_end":
+			t.Fatalf("Expected streamed frames before %v", frame)
+		}
+	}
+	if strings.Join(deltas, "") != "内存使用率正常" || len(deltas) != 3 {
+		t.Errorf("Expected the answer in 3 deltas, got %q", deltas)
+	}
+	if done["content"] != "内存使用率正常" || done["id"] == "" {
+		t.Errorf("Expected answer_done with the full answer, got %v", done)
+	}
+}
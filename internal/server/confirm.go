@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConfirmTokenHeader 携带确认令牌的请求头
+const ConfirmTokenHeader = "X-Confirm-Token"
+
+// confirmationTTL 确认令牌有效期
+const confirmationTTL = 5 * time.Minute
+
+// ConfirmationRequired 破坏性操作首次请求的返回，客户端展示 Preview 后携带 Token 重试
+type ConfirmationRequired struct {
+	ConfirmRequired bool        `json:"confirm_required"`
+	Action          string      `json:"action"`
+	Token           string      `json:"token"`
+	Preview         interface{} `json:"preview"`
+	ExpiresAt       time.Time   `json:"expires_at"`
+}
+
+type pendingConfirmation struct {
+	digest    string
+	expiresAt time.Time
+}
+
+// confirmations 等待确认的操作，令牌只能使用一次
+var confirmations = struct {
+	sync.Mutex
+	pending map[string]pendingConfirmation
+}{pending: make(map[string]pendingConfirmation)}
+
+// confirmationDigest 令牌绑定用户、操作和请求内容，内容变化后旧令牌失效
+func confirmationDigest(user, action string, payload interface{}) string {
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256(append([]byte(user+"\x00"+action+"\x00"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireConfirmation 破坏性操作的二次确认
+// 请求未携带有效的确认令牌时返回 428 和操作预览，返回 false；携带与本次操作匹配的令牌时消耗令牌并返回 true
+func requireConfirmation(w http.ResponseWriter, r *http.Request, action string, payload, preview interface{}) bool {
+	digest := confirmationDigest(requestUser(r), action, payload)
+	now := time.Now()
+
+	confirmations.Lock()
+	for token, pending := range confirmations.pending {
+		if now.After(pending.expiresAt) {
+			delete(confirmations.pending, token)
+		}
+	}
+	if token := r.Header.Get(ConfirmTokenHeader); token != "" {
+		if pending, ok := confirmations.pending[token]; ok && pending.digest == digest {
+			delete(confirmations.pending, token)
+			confirmations.Unlock()
+			return true
+		}
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	expiresAt := now.Add(confirmationTTL)
+	confirmations.pending[token] = pendingConfirmation{digest: digest, expiresAt: expiresAt}
+	confirmations.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionRequired)
+	json.NewEncoder(w).Encode(ConfirmationRequired{
+		ConfirmRequired: true,
+		Action:          action,
+		Token:           token,
+		Preview:         preview,
+		ExpiresAt:       expiresAt,
+	})
+	return false
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"qwq/internal/container"
+	"qwq/internal/logger"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// mountinfoContainerID 容器内 /proc/self/mountinfo 中 Docker 挂载的 hostname、resolv.conf 等文件所在目录的容器 ID
+var mountinfoContainerID = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+
+// selfContainerIDs qwq 自身所在容器的标识，测试中替换
+var selfContainerIDs = func() []string {
+	return detectSelfContainerIDs("/proc/self/mountinfo")
+}
+
+// detectSelfContainerIDs 从主机名（Docker 默认使用容器短 ID）和 mountinfo 中的完整容器 ID 识别自身所在的容器
+func detectSelfContainerIDs(mountinfo string) []string {
+	var ids []string
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		ids = append(ids, hostname)
+	}
+	if data, err := os.ReadFile(mountinfo); err == nil {
+		if match := mountinfoContainerID.FindSubmatch(data); match != nil {
+			ids = append(ids, string(match[1]))
+		}
+	}
+	return ids
+}
+
+// isSelfContainer 短 ID 为 id 的容器是否是 qwq 自身所在的容器
+func isSelfContainer(id string) bool {
+	for _, self := range selfContainerIDs() {
+		if self == id || len(self) == 64 && strings.HasPrefix(self, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerController 容器操作用到的执行器方法
+type containerController interface {
+	StartContainer(ctx context.Context, containerID string) error
+	StopContainer(ctx context.Context, containerID string) error
+	RemoveContainer(ctx context.Context, containerID string) error
+	container.ContainerOperator
+}
+
+// containerActionResult 容器操作的结果，失败时 error 为 Docker 返回的错误信息
+type containerActionResult struct {
+	Success bool                 `json:"success"`
+	ID      string               `json:"id"`
+	Action  string               `json:"action"`
+	Error   string               `json:"error,omitempty"`
+	Inspect *types.ContainerJSON `json:"inspect,omitempty"` // inspect 操作返回的容器详情
+}
+
+// handleContainerAction 执行容器操作 /api/container/action?id=&action=
+func handleContainerAction(w http.ResponseWriter, r *http.Request) {
+	executor, ok := containerExecutor().(containerController)
+	if !ok {
+		respondError(w, r, http.StatusServiceUnavailable, "Container actions are not supported by the docker backend")
+		return
+	}
+	serveContainerAction(w, r, executor, containerLister())
+}
+
+// serveContainerAction 校验 id 属于 lister 中的容器后通过执行器操作：
+// start、stop、restart（先停止再启动）、pause、unpause、remove（强制删除，需要 confirm=true，volumes=true 时删除匿名卷）和 inspect。
+// inspect 可以使用 GET，其他操作只接受 POST；不能删除 qwq 自身所在的容器
+func serveContainerAction(w http.ResponseWriter, r *http.Request, executor containerController, lister container.ContainerLister) {
+	query := r.URL.Query()
+	id := query.Get("id")
+	action := query.Get("action")
+
+	// 参数验证
+	if id == "" || action == "" {
+		respondError(w, r, http.StatusBadRequest, "Missing params")
+		return
+	}
+	switch action {
+	case "start", "stop", "restart", "pause", "unpause", "remove", "inspect":
+	default:
+		respondError(w, r, http.StatusBadRequest, "Invalid action")
+		return
+	}
+	if r.Method != http.MethodPost && (action != "inspect" || r.Method != http.MethodGet) {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	containerID, err := findContainer(r.Context(), lister, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	result := containerActionResult{ID: containerID, Action: action}
+	ctx := r.Context()
+	switch action {
+	case "start":
+		err = executor.StartContainer(ctx, containerID)
+	case "stop":
+		err = executor.StopContainer(ctx, containerID)
+	case "restart":
+		if err = executor.StopContainer(ctx, containerID); err == nil {
+			err = executor.StartContainer(ctx, containerID)
+		}
+	case "pause":
+		err = executor.PauseContainer(ctx, containerID)
+	case "unpause":
+		err = executor.UnpauseContainer(ctx, containerID)
+	case "remove":
+		if query.Get("confirm") != "true" {
+			writeError(w, r, errContainerRemoveConfirm)
+			return
+		}
+		if isSelfContainer(containerID) {
+			logger.Info("[AUDIT] 🚨 %s 尝试删除 qwq 自身所在的容器 %s", requestActor(r), containerID)
+			writeError(w, r, errContainerSelf)
+			return
+		}
+		if query.Get("volumes") == "true" {
+			err = executor.RemoveContainerAndVolumes(ctx, containerID)
+		} else {
+			err = executor.RemoveContainer(ctx, containerID)
+		}
+	case "inspect":
+		var info types.ContainerJSON
+		if info, err = executor.InspectContainer(ctx, containerID); err == nil {
+			result.Inspect = &info
+		}
+	}
+	status := http.StatusOK
+	result.Success = err == nil
+	if err != nil {
+		status, result.Error = http.StatusInternalServerError, err.Error()
+		logger.Info("[AUDIT] ❌ Web操作容器失败: %s %s by %s: %v", action, containerID, requestActor(r), err)
+	} else if action != "inspect" {
+		logger.Info("[AUDIT] 🐳 Web操作容器: %s %s by %s", action, containerID, requestActor(r))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os/exec"
+	"qwq/internal/apierror"
+	"qwq/internal/container"
+	"qwq/internal/logger"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultContainerLogTail 容器日志默认返回的行数
+	defaultContainerLogTail = 200
+	// maxContainerLogTail 容器日志一次最多返回的行数
+	maxContainerLogTail = 5000
+	// maxContainerLogLine 实时日志单行的最大长度，超出的部分被截断
+	maxContainerLogLine = 64 * 1024
+)
+
+// fullContainerID 完整的 64 位十六进制容器 ID
+var fullContainerID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// dockerCommand 创建 docker CLI 命令，参数不经过 shell；测试中替换为假命令
+var dockerCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "docker", args...)
+}
+
+// ContainerStats 一个容器的资源占用，解析自 docker stats --no-stream
+type ContainerStats struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	CPUPercent      float64 `json:"cpu_percent"`
+	MemUsageBytes   int64   `json:"mem_usage_bytes"`
+	MemLimitBytes   int64   `json:"mem_limit_bytes"`
+	MemPercent      float64 `json:"mem_percent"`
+	NetRxBytes      int64   `json:"net_rx_bytes"`
+	NetTxBytes      int64   `json:"net_tx_bytes"`
+	BlockReadBytes  int64   `json:"block_read_bytes"`
+	BlockWriteBytes int64   `json:"block_write_bytes"`
+	PIDs            int     `json:"pids"`
+}
+
+// findContainer 在容器列表中查找 id（短 ID、完整 ID 或名称），返回列表中的短 ID。
+// 传给 docker 的总是列表中的 ID，请求参数不会进入命令行
+func findContainer(ctx context.Context, lister container.ContainerLister, id string) (string, error) {
+	if id == "" {
+		return "", requiredField("id", "id is required")
+	}
+	containers, err := lister.ListContainers(ctx)
+	if err != nil {
+		return "", apierror.Wrap(http.StatusServiceUnavailable, apierror.CodeUnavailable, err)
+	}
+	for _, c := range containers {
+		if c.ID == id || c.Name == id || fullContainerID.MatchString(id) && strings.HasPrefix(id, c.ID) {
+			return c.ID, nil
+		}
+	}
+	return "", errContainerNotFound
+}
+
+// containerLogArgs 由 tail、since 查询参数生成 docker logs 的选项，tail 默认 defaultContainerLogTail，
+// 最多 maxContainerLogTail；since 为时长（如 10m）、RFC3339 时间或 Unix 秒
+func containerLogArgs(r *http.Request) ([]string, error) {
+	tail := defaultContainerLogTail
+	if value := r.URL.Query().Get("tail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, errInvalidLogTail
+		}
+		tail = min(n, maxContainerLogTail)
+	}
+	args := []string{"--tail=" + strconv.Itoa(tail)}
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err := parseEventTime(value)
+		if d, derr := time.ParseDuration(value); derr == nil && d > 0 {
+			since, err = time.Now().Add(-d), nil
+		}
+		if err != nil {
+			return nil, errInvalidLogSince
+		}
+		args = append(args, "--since="+strconv.FormatInt(since.Unix(), 10))
+	}
+	return args, nil
+}
+
+// handleContainerLogs 容器最近的日志 GET /api/container/logs?id=&tail=&since=
+func handleContainerLogs(w http.ResponseWriter, r *http.Request) {
+	serveContainerLogs(w, r, containerLister())
+}
+
+// serveContainerLogs 校验 id 属于 lister 中的容器后返回 docker logs 的输出（stdout 与 stderr 合并）
+func serveContainerLogs(w http.ResponseWriter, r *http.Request, lister container.ContainerLister) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	options, err := containerLogArgs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := findContainer(r.Context(), lister, r.URL.Query().Get("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	out, err := dockerCommand(r.Context(), append(append([]string{"logs"}, options...), id)...).CombinedOutput()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, strings.TrimSpace(string(out)))
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(out) == 0 {
+		lines = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "lines": lines})
+}
+
+// handleContainerStats 容器的资源占用 GET /api/container/stats?id=
+func handleContainerStats(w http.ResponseWriter, r *http.Request) {
+	serveContainerStats(w, r, containerLister())
+}
+
+// serveContainerStats 校验 id 属于 lister 中的容器后返回解析后的 docker stats
+func serveContainerStats(w http.ResponseWriter, r *http.Request, lister container.ContainerLister) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, err := findContainer(r.Context(), lister, r.URL.Query().Get("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	out, err := dockerCommand(r.Context(), "stats", "--no-stream", "--format", "{{json .}}", id).CombinedOutput()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, strings.TrimSpace(string(out)))
+		return
+	}
+	stats, err := parseDockerStats(strings.TrimSpace(string(out)))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// parseDockerStats 解析 docker stats --format '{{json .}}' 的一行输出，
+// 如 {"CPUPerc":"0.50%","MemUsage":"10MiB / 1.944GiB","NetIO":"1.2kB / 0B",...}
+func parseDockerStats(line string) (*ContainerStats, error) {
+	var raw struct {
+		ID       string `json:"ID"`
+		Name     string `json:"Name"`
+		CPUPerc  string `json:"CPUPerc"`
+		MemUsage string `json:"MemUsage"`
+		MemPerc  string `json:"MemPerc"`
+		NetIO    string `json:"NetIO"`
+		BlockIO  string `json:"BlockIO"`
+		PIDs     string `json:"PIDs"`
+	}
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse docker stats output: %w", err)
+	}
+	stats := &ContainerStats{ID: raw.ID, Name: raw.Name}
+	stats.CPUPercent = parsePercent(raw.CPUPerc)
+	stats.MemPercent = parsePercent(raw.MemPerc)
+	stats.MemUsageBytes, stats.MemLimitBytes = parseSizePair(raw.MemUsage)
+	stats.NetRxBytes, stats.NetTxBytes = parseSizePair(raw.NetIO)
+	stats.BlockReadBytes, stats.BlockWriteBytes = parseSizePair(raw.BlockIO)
+	stats.PIDs, _ = strconv.Atoi(raw.PIDs)
+	return stats, nil
+}
+
+// parsePercent 解析 "12.5%"，无法解析（如 "--"）时为 0
+func parsePercent(value string) float64 {
+	percent, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	return percent
+}
+
+// parseSizePair 解析 "10MiB / 1.944GiB" 形式的一对大小
+func parseSizePair(value string) (int64, int64) {
+	first, second, _ := strings.Cut(value, "/")
+	return parseDockerSize(first), parseDockerSize(second)
+}
+
+// dockerSizeUnits docker stats 输出的大小单位：内存使用二进制单位，网络和磁盘 IO 使用十进制单位
+var dockerSizeUnits = map[string]float64{
+	"b":  1,
+	"kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12, "pb": 1e15,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40, "pib": 1 << 50,
+}
+
+// parseDockerSize 解析 "1.944GiB"、"1.2kB"、"0B"，无法解析时为 0
+func parseDockerSize(value string) int64 {
+	value = strings.TrimSpace(value)
+	end := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end <= 0 {
+		return 0
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	multiplier, ok := dockerSizeUnits[strings.ToLower(value[end:])]
+	if err != nil || !ok {
+		return 0
+	}
+	return int64(math.Round(number * multiplier))
+}
+
+// handleWSContainerLogs 实时推送容器日志 /ws/container/logs?id=&tail=&since=
+func handleWSContainerLogs(w http.ResponseWriter, r *http.Request) {
+	serveWSContainerLogs(w, r, containerLister())
+}
+
+// serveWSContainerLogs 跟随 docker logs -f 的输出，每行一个文本帧；客户端断开时结束 docker 进程，
+// 容器退出时以关闭帧结束连接
+func serveWSContainerLogs(w http.ResponseWriter, r *http.Request, lister container.ContainerLister) {
+	options, err := containerLogArgs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := findContainer(r.Context(), lister, r.URL.Query().Get("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Info("WS Upgrade Error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// 客户端不发送消息，读协程只用于发现连接断开
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// stdout 和 stderr 写入同一个管道，保持两者的相对顺序
+	reader, writer := io.Pipe()
+	cmd := dockerCommand(ctx, append(append([]string{"logs", "--follow"}, options...), id)...)
+	cmd.Stdout, cmd.Stderr = writer, writer
+	if err := cmd.Start(); err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+	go func() {
+		writer.CloseWithError(cmd.Wait())
+	}()
+	logger.Info("[AUDIT] 📜 %s 开始跟随容器日志: %s", requestActor(r), id)
+
+	lines := bufio.NewReaderSize(reader, maxContainerLogLine)
+	for {
+		line, err := lines.ReadSlice('\n')
+		if len(line) > 0 {
+			if werr := conn.WriteMessage(websocket.TextMessage, []byte(strings.TrimRight(string(line), "\r\n"))); werr != nil {
+				cancel()
+				break
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			// 超长的行截断后丢弃剩余部分
+			for err == bufio.ErrBufferFull {
+				_, err = lines.ReadSlice('\n')
+			}
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				reason := "container log stream ended"
+				if err != io.EOF {
+					reason = err.Error()
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason))
+			}
+			break
+		}
+	}
+	// 等待 docker 进程退出，管道关闭后 Wait 协程结束
+	cancel()
+	io.Copy(io.Discard, reader)
+}
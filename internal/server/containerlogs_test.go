@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// logLister 日志测试使用的容器列表
+var logLister = staticLister{{ID: "0123456789ab", Name: "web", Image: "nginx", Status: "Up 2 hours"}}
+
+// fakeDocker 用 sh 脚本代替 docker，记录调用参数和命令的上下文
+func fakeDocker(t *testing.T, script string) (calls *[][]string, contexts chan context.Context) {
+	t.Helper()
+	saved := dockerCommand
+	t.Cleanup(func() { dockerCommand = saved })
+	calls = &[][]string{}
+	contexts = make(chan context.Context, 1)
+	dockerCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+		*calls = append(*calls, args)
+		select {
+		case contexts <- ctx:
+		default:
+		}
+		return exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	return calls, contexts
+}
+
+func TestFindContainer_OnlyListedIDs(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+		err  error
+	}{
+		{"0123456789ab", "0123456789ab", nil},
+		{"web", "0123456789ab", nil},
+		{"0123456789ab" + strings.Repeat("f", 52), "0123456789ab", nil},
+		{"0123456789ab; rm -rf /", "", errContainerNotFound},
+		{"$(reboot)", "", errContainerNotFound},
+		{"0123456789abc", "", errContainerNotFound},
+		{"--since=0", "", errContainerNotFound},
+	}
+	for _, tt := range tests {
+		got, err := findContainer(context.Background(), logLister, tt.id)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("findContainer(%q) = %q, %v; want %q, %v", tt.id, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestServeContainerLogs(t *testing.T) {
+	calls, _ := fakeDocker(t, `printf 'started\nlistening on :80\n'`)
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveContainerLogs(rec, httptest.NewRequest(http.MethodGet, "/api/container/logs?"+query, nil), logLister)
+		return rec
+	}
+
+	rec := get("id=web")
+	var body struct {
+		ID    string   `json:"id"`
+		Lines []string `json:"lines"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body.ID != "0123456789ab" || len(body.Lines) != 2 || body.Lines[1] != "listening on :80" {
+		t.Fatalf("Expected the log lines, got %d %+v", rec.Code, body)
+	}
+	if args := strings.Join((*calls)[0], " "); args != "logs --tail=200 0123456789ab" {
+		t.Errorf("Expected the default tail and the listed ID, got %q", args)
+	}
+
+	get("id=web&tail=100000&since=1h")
+	if args := (*calls)[1]; args[1] != "--tail=5000" || !strings.HasPrefix(args[2], "--since=") || args[3] != "0123456789ab" {
+		t.Errorf("Expected a bounded tail and a normalized since, got %q", args)
+	}
+
+	for query, code := range map[string]string{
+		"id=web%3Breboot":  "CONTAINER_NOT_FOUND",
+		"id=web&tail=-1":   "CONTAINER_LOG_TAIL_INVALID",
+		"id=web&since=abc": "CONTAINER_LOG_SINCE_INVALID",
+	} {
+		rec := get(query)
+		if envelope := decodeEnvelope(t, rec); envelope.Code != code {
+			t.Errorf("%s: expected %s, got %d %+v", query, code, rec.Code, envelope)
+		}
+	}
+	if len(*calls) != 2 {
+		t.Errorf("Rejected requests must not run docker, got %d calls", len(*calls))
+	}
+}
+
+func TestParseDockerStats(t *testing.T) {
+	line := `{"BlockIO":"4.1MB / 0B","CPUPerc":"12.50%","Container":"web","ID":"0123456789ab","MemPerc":"0.52%","MemUsage":"10.5MiB / 1.944GiB","Name":"web","NetIO":"1.2kB / 648B","PIDs":"5"}`
+	stats, err := parseDockerStats(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ContainerStats{
+		ID: "0123456789ab", Name: "web", CPUPercent: 12.5, MemPercent: 0.52,
+		MemUsageBytes: 11010048, MemLimitBytes: 2087354106,
+		NetRxBytes: 1200, NetTxBytes: 648, BlockReadBytes: 4100000, PIDs: 5,
+	}
+	if *stats != want {
+		t.Errorf("Expected %+v, got %+v", want, *stats)
+	}
+	if _, err := parseDockerStats("Error: No such container"); err == nil {
+		t.Error("Expected non-JSON output to be rejected")
+	}
+}
+
+func TestServeWSContainerLogs(t *testing.T) {
+	_, contexts := fakeDocker(t, `echo one; echo two >&2; exec sleep 30`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWSContainerLogs(w, r, logLister)
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"?id=unknown", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected an unknown container to be rejected before the upgrade, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?id=web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []string
+	for len(got) < 2 {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected two log lines, got %q: %v", got, err)
+		}
+		got = append(got, string(data))
+	}
+	if strings.Join(got, ",") != "one,two" {
+		t.Errorf("Expected stdout and stderr lines, got %q", got)
+	}
+
+	// 客户端断开后 docker 进程的上下文被取消
+	ctx := <-contexts
+	conn.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the log follower to be cancelled when the client disconnects")
+	}
+}
+
+func TestServeWSContainerLogs_StreamEnds(t *testing.T) {
+	fakeDocker(t, `echo bye`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWSContainerLogs(w, r, logLister)
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?id=web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "bye" {
+		t.Fatalf("Expected the last line, got %q %v", data, err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected a normal close when the container stops logging, got %v", err)
+	}
+}
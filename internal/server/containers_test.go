@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/container"
+	"qwq/internal/pagination"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// staticLister 返回固定容器列表
+type staticLister []container.ContainerSummary
+
+func (l staticLister) ListContainers(ctx context.Context) ([]container.ContainerSummary, error) {
+	return l, nil
+}
+
+func TestServeContainers_Pagination(t *testing.T) {
+	var lister staticLister
+	for i := 1; i <= 5; i++ {
+		status := "Up 2 hours"
+		if i == 3 {
+			status = "Exited (1) 5 minutes ago"
+		}
+		lister = append(lister, container.ContainerSummary{ID: fmt.Sprintf("c%d", i), Name: fmt.Sprintf("app-%d", 6-i), Image: "nginx", Status: status})
+	}
+	get := func(query string) (*httptest.ResponseRecorder, pagination.Page[DockerContainer]) {
+		rec := httptest.NewRecorder()
+		serveContainers(rec, httptest.NewRequest(http.MethodGet, "/api/containers"+query, nil), lister)
+		var page pagination.Page[DockerContainer]
+		json.Unmarshal(rec.Body.Bytes(), &page)
+		return rec, page
+	}
+
+	rec, page := get("")
+	if rec.Code != http.StatusOK || page.Total != 5 || len(page.Items) != 5 || page.Page != 1 || page.PageSize != pagination.DefaultPageSize {
+		t.Fatalf("Expected all containers on the first page, got %d %+v", rec.Code, page)
+	}
+	if page.Items[0].Name != "app-1" {
+		t.Errorf("Expected containers sorted by name, got %s first", page.Items[0].Name)
+	}
+	if _, page = get("?page=3&pageSize=2&sort=-name"); len(page.Items) != 1 || page.Items[0].Name != "app-1" {
+		t.Errorf("Expected the last partial page, got %+v", page)
+	}
+	if _, page = get("?page=4&pageSize=2"); page.Total != 5 || page.Items == nil || len(page.Items) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v", page)
+	}
+	if _, page = get("?state=exited"); page.Total != 1 || page.Items[0].ID != "c3" {
+		t.Errorf("Expected the exited container, got %+v", page)
+	}
+
+	for query, code := range map[string]string{"?pageSize=abc": pagination.CodeInvalidPagination, "?sort=id": pagination.CodeInvalidSort} {
+		rec, _ := get(query)
+		if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusBadRequest || envelope.Code != code {
+			t.Errorf("%s: expected %s, got %d %+v", query, code, rec.Code, envelope)
+		}
+	}
+}
+
+// fakeController 记录容器操作
+type fakeController struct {
+	calls []string
+	err   error
+}
+
+func (c *fakeController) record(action, id string) error {
+	c.calls = append(c.calls, action+" "+id)
+	return c.err
+}
+
+func (c *fakeController) StartContainer(ctx context.Context, id string) error {
+	return c.record("start", id)
+}
+
+func (c *fakeController) StopContainer(ctx context.Context, id string) error {
+	return c.record("stop", id)
+}
+
+func (c *fakeController) RemoveContainer(ctx context.Context, id string) error {
+	return c.record("rm", id)
+}
+
+func (c *fakeController) RemoveContainerAndVolumes(ctx context.Context, id string) error {
+	return c.record("rm -v", id)
+}
+
+func (c *fakeController) PauseContainer(ctx context.Context, id string) error {
+	return c.record("pause", id)
+}
+
+func (c *fakeController) UnpauseContainer(ctx context.Context, id string) error {
+	return c.record("unpause", id)
+}
+
+func (c *fakeController) InspectContainer(ctx context.Context, id string) (types.ContainerJSON, error) {
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id, Name: "/web"}}
+	return info, c.record("inspect", id)
+}
+
+func TestServeContainerAction(t *testing.T) {
+	saved := selfContainerIDs
+	t.Cleanup(func() { selfContainerIDs = saved })
+	selfContainerIDs = func() []string { return []string{"fedcba987654" + strings.Repeat("0", 52)} }
+	lister := staticLister{{ID: "0123456789ab", Name: "web"}, {ID: "fedcba987654", Name: "qwq"}}
+
+	tests := []struct {
+		method string
+		query  string
+		code   int
+		calls  string
+	}{
+		{http.MethodPost, "id=web&action=restart", http.StatusOK, "stop 0123456789ab,start 0123456789ab"},
+		{http.MethodPost, "id=0123456789ab&action=pause", http.StatusOK, "pause 0123456789ab"},
+		{http.MethodPost, "id=web&action=unpause", http.StatusOK, "unpause 0123456789ab"},
+		{http.MethodPost, "id=web&action=remove&confirm=true", http.StatusOK, "rm 0123456789ab"},
+		{http.MethodPost, "id=web&action=remove&confirm=true&volumes=true", http.StatusOK, "rm -v 0123456789ab"},
+		{http.MethodPost, "id=web&action=remove", http.StatusBadRequest, ""},
+		{http.MethodPost, "id=qwq&action=remove&confirm=true", http.StatusForbidden, ""},
+		{http.MethodGet, "id=web&action=stop", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "id=web%3Breboot&action=start", http.StatusNotFound, ""},
+		{http.MethodPost, "id=web&action=kill", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		controller := &fakeController{}
+		rec := httptest.NewRecorder()
+		serveContainerAction(rec, httptest.NewRequest(tt.method, "/api/container/action?"+tt.query, nil), controller, lister)
+		if rec.Code != tt.code || strings.Join(controller.calls, ",") != tt.calls {
+			t.Errorf("%s %s: expected %d %q, got %d %q", tt.method, tt.query, tt.code, tt.calls, rec.Code, controller.calls)
+		}
+		if tt.code == http.StatusOK {
+			var result containerActionResult
+			if json.NewDecoder(rec.Body).Decode(&result); !result.Success || result.ID != "0123456789ab" {
+				t.Errorf("%s: expected a success result, got %+v", tt.query, result)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	serveContainerAction(rec, httptest.NewRequest(http.MethodGet, "/api/container/action?id=web&action=inspect", nil), &fakeController{}, lister)
+	var result containerActionResult
+	if json.NewDecoder(rec.Body).Decode(&result); rec.Code != http.StatusOK || result.Inspect == nil || result.Inspect.Name != "/web" {
+		t.Errorf("Expected the inspect details, got %d %+v", rec.Code, result)
+	}
+
+	rec = httptest.NewRecorder()
+	serveContainerAction(rec, httptest.NewRequest(http.MethodPost, "/api/container/action?id=web&action=start", nil), &fakeController{err: errors.New("daemon unavailable")}, lister)
+	result = containerActionResult{}
+	if json.NewDecoder(rec.Body).Decode(&result); rec.Code != http.StatusInternalServerError || result.Success || result.Error != "daemon unavailable" {
+		t.Errorf("Expected the docker error in the result, got %d %+v", rec.Code, result)
+	}
+}
+
+func TestDetectSelfContainerIDs(t *testing.T) {
+	id := strings.Repeat("ab", 32)
+	mountinfo := filepath.Join(t.TempDir(), "mountinfo")
+	line := "812 790 254:1 /docker/containers/" + id + "/hostname /etc/hostname rw,relatime - ext4 /dev/vda1 rw\n"
+	if err := os.WriteFile(mountinfo, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ids := detectSelfContainerIDs(mountinfo)
+	if len(ids) != 2 || ids[1] != id {
+		t.Errorf("Expected the hostname and the container ID from mountinfo, got %v", ids)
+	}
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/chathistory"
+	"qwq/internal/config"
+	"qwq/internal/incident"
+	"qwq/internal/logger"
+	"qwq/internal/pagination"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 对话历史接口单独检查的权限
+const (
+	PermissionChatAudit   = "chat:audit"    // 查看所有用户的对话列表（只含标题、大小等元数据）
+	PermissionChatReadAll = "chat:read_all" // 读取其他用户的对话内容
+)
+
+// chatContextMessages 继续已有对话时恢复到 Agent 上下文的最近消息数，更早的消息只用于页面显示
+const chatContextMessages = 40
+
+// 对话历史接口的错误
+var (
+	errChatHistoryUnavailable  = apierror.New(http.StatusServiceUnavailable, "CHAT_HISTORY_UNAVAILABLE", "Chat history is not available")
+	errChatHistoryAuthRequired = apierror.New(http.StatusConflict, "CHAT_HISTORY_REQUIRES_AUTH", "Chat history requires web_user and web_password")
+)
+
+// chatOwner 对话历史的所属用户：认证用户名（API 令牌为其所属用户）；未开启认证时为空，对话不保存
+func chatOwner(r *http.Request) string {
+	if config.Current().WebUser == "" || config.Current().WebPassword == "" {
+		return ""
+	}
+	if token := requestToken(r); token != nil {
+		return token.Owner
+	}
+	user, _ := authUser(r)
+	return user
+}
+
+// chatHistory 对话历史接口的前置检查，失败时写入错误响应
+func chatHistory(w http.ResponseWriter, r *http.Request) (*chathistory.Manager, string, bool) {
+	owner := chatOwner(r)
+	if owner == "" {
+		writeError(w, r, errChatHistoryAuthRequired)
+		return nil, "", false
+	}
+	manager := chathistory.Default()
+	if manager == nil {
+		writeError(w, r, errChatHistoryUnavailable)
+		return nil, "", false
+	}
+	return manager, owner, true
+}
+
+// ConversationRequest 创建或重命名对话的请求
+type ConversationRequest struct {
+	Title string `json:"title"`
+}
+
+// ConversationHistory 对话及其全部消息，用于页面恢复对话
+type ConversationHistory struct {
+	Conversation *chathistory.Conversation `json:"conversation"`
+	Messages     []chathistory.Message     `json:"messages"`
+}
+
+// handleChatConversations /api/chat/conversations
+// GET 分页列出当前用户的对话，?all=true 列出所有用户的对话元数据（需要 chat:audit，可按 ?owner= 过滤）；POST 创建对话
+func handleChatConversations(w http.ResponseWriter, r *http.Request) {
+	manager, owner, ok := chatHistory(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		q, err := pagination.Parse(r.URL.Query(), chathistory.ListSpec)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		scope := owner
+		if all, _ := strconv.ParseBool(r.URL.Query().Get("all")); all {
+			if !requestPermissions(r)(PermissionChatAudit) {
+				logger.Info("[AUDIT] 🚨 无权限查看所有用户的对话列表 by %s", requestActor(r))
+				respondError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+			logger.Info("[AUDIT] 💬 查看所有用户的对话列表 by %s", requestActor(r))
+			scope = ""
+		}
+		page, err := manager.List(r.Context(), scope, q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	case http.MethodPost:
+		var req ConversationRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, r, errInvalidBody)
+				return
+			}
+		}
+		conversation, err := manager.Create(r.Context(), owner, req.Title)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(conversation)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleChatConversation /api/chat/conversations/{id}
+// GET 返回对话和全部消息（其他用户的对话需要 chat:read_all）；PATCH 重命名；DELETE 删除对话、消息和关联的对话记录
+func handleChatConversation(w http.ResponseWriter, r *http.Request) {
+	manager, owner, ok := chatHistory(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/chat/conversations/"), 10, 32)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		conversation, err := manager.Get(r.Context(), uint(id), owner)
+		if errors.Is(err, chathistory.ErrNotFound) && requestPermissions(r)(PermissionChatReadAll) {
+			if conversation, err = manager.Get(r.Context(), uint(id), ""); err == nil {
+				logger.Info("[AUDIT] 💬 读取用户 %s 的对话 #%d by %s", conversation.Owner, id, requestActor(r))
+			}
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		messages, err := manager.History(r.Context(), conversation.ID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ConversationHistory{Conversation: conversation, Messages: messages})
+	case http.MethodPatch, http.MethodPut:
+		var req ConversationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		if strings.TrimSpace(req.Title) == "" {
+			writeError(w, r, requiredField("title", "Conversation title is required"))
+			return
+		}
+		conversation, err := manager.Rename(r.Context(), uint(id), owner, req.Title)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversation)
+	case http.MethodDelete:
+		conversation, err := manager.Delete(r.Context(), uint(id), owner)
+		if conversation == nil {
+			writeError(w, r, err)
+			return
+		}
+		if err != nil {
+			logger.Info("⚠️ 对话 #%d 已删除，但部分关联数据清理失败: %v", id, err)
+		}
+		logger.Info("[AUDIT] 💬 对话已删除: #%d %q by %s", conversation.ID, conversation.Title, requestActor(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversation)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// chatConversation WebSocket 会话连接的对话，第一条消息时才创建新对话，避免每次打开页面都留下空对话
+type chatConversation struct {
+	manager    *chathistory.Manager
+	owner      string
+	transcript string // 本次连接的对话记录会话，作为对话的关联数据随对话删除
+	session    *chatSession
+	id         uint
+	title      string
+}
+
+// attachConversation 为认证用户的 WebSocket 会话连接对话：?conversation={id} 继续已有对话，
+// 返回其最近的问答用于恢复 Agent 上下文；未开启认证或对话历史不可用时返回 nil
+func attachConversation(r *http.Request, session *chatSession, transcript *incident.Session) (*chatConversation, []openai.ChatCompletionMessage) {
+	manager := chathistory.Default()
+	owner := chatOwner(r)
+	if manager == nil || owner == "" {
+		return nil, nil
+	}
+	c := &chatConversation{manager: manager, owner: owner, transcript: transcript.ID, session: session}
+	transcript.Tee = c.record
+
+	raw := r.URL.Query().Get("conversation")
+	if raw == "" || raw == "new" {
+		return c, nil
+	}
+	id, err := strconv.ParseUint(raw, 10, 32)
+	var conversation *chathistory.Conversation
+	if err == nil {
+		conversation, err = manager.Get(r.Context(), uint(id), owner)
+	}
+	if err != nil {
+		session.send(map[string]string{"type": "answer", "content": "⚠️ 对话不存在或无权访问，已开始新对话"})
+		return c, nil
+	}
+	c.id, c.title = conversation.ID, conversation.Title
+	c.link(r.Context())
+	session.send(c.frame())
+
+	history, err := manager.History(r.Context(), conversation.ID)
+	if err != nil {
+		logger.Info("读取对话 #%d 失败: %v", conversation.ID, err)
+		return c, nil
+	}
+	var messages []openai.ChatCompletionMessage
+	for _, message := range history {
+		switch message.Role {
+		case chathistory.RoleUser:
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: message.Content})
+		case chathistory.RoleAssistant:
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: message.Content})
+		}
+	}
+	if len(messages) > chatContextMessages {
+		messages = messages[len(messages)-chatContextMessages:]
+	}
+	return c, messages
+}
+
+// record 保存一条已脱敏的消息，新对话在第一条消息时创建；标题变化时通知页面
+func (c *chatConversation) record(role, content string) {
+	ctx := context.Background()
+	if c.id == 0 {
+		conversation, err := c.manager.Create(ctx, c.owner, "")
+		if err != nil {
+			logger.Info("创建对话失败: %v", err)
+			return
+		}
+		c.id = conversation.ID
+		c.link(ctx)
+		c.session.send(c.frame())
+	}
+	conversation, err := c.manager.Append(ctx, c.id, role, content)
+	if err != nil {
+		logger.Info("保存对话消息失败: %v", err)
+		return
+	}
+	if conversation != nil && conversation.Title != c.title {
+		c.title = conversation.Title
+		c.session.send(c.frame())
+	}
+}
+
+// link 把本次连接的对话记录关联到对话
+func (c *chatConversation) link(ctx context.Context) {
+	if err := c.manager.AddArtifact(ctx, c.id, chathistory.ArtifactTranscript, c.transcript); err != nil {
+		logger.Info("关联对话记录失败: %v", err)
+	}
+}
+
+// frame 当前对话的 ID 和标题
+func (c *chatConversation) frame() map[string]interface{} {
+	return map[string]interface{}{"type": "conversation", "id": c.id, "title": c.title}
+}
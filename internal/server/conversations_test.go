@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/apitoken"
+	"qwq/internal/chathistory"
+	"qwq/internal/config"
+	"qwq/internal/incident"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupChatHistory(t *testing.T) (*chathistory.Manager, string) {
+	t.Helper()
+	saved := config.Current()
+	savedTranscripts := incident.DefaultTranscripts
+	t.Cleanup(func() {
+		config.Store(saved)
+		incident.DefaultTranscripts = savedTranscripts
+		chathistory.SetDefault(nil)
+	})
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+	dir := t.TempDir()
+	incident.DefaultTranscripts = incident.NewTranscripts(dir)
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&chathistory.Conversation{}, &chathistory.Message{}, &chathistory.Artifact{}); err != nil {
+		t.Fatal(err)
+	}
+	manager := chathistory.NewManager(db, chathistory.Limits{})
+	manager.RegisterPurger(chathistory.ArtifactTranscript, incident.DefaultTranscripts.Delete)
+	chathistory.SetDefault(manager)
+	return manager, dir
+}
+
+// chatRequest 以管理员或指定令牌调用对话接口
+func chatRequest(method, path, body string, token *apitoken.Token) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != nil {
+		req = req.WithContext(withToken(req.Context(), token))
+	} else {
+		req.SetBasicAuth("admin", "secret")
+	}
+	rec := httptest.NewRecorder()
+	if path == "/api/chat/conversations" || strings.HasPrefix(path, "/api/chat/conversations?") {
+		handleChatConversations(rec, req)
+	} else {
+		handleChatConversation(rec, req)
+	}
+	return rec
+}
+
+func TestChatConversations_API(t *testing.T) {
+	manager, _ := setupChatHistory(t)
+	bobs, _ := manager.Create(context.Background(), "bob", "bob 的排查")
+
+	rec := chatRequest(http.MethodPost, "/api/chat/conversations", "", nil)
+	var created chathistory.Conversation
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusCreated || created.Owner != "admin" {
+		t.Fatalf("Expected a conversation owned by admin, got %d %+v", rec.Code, created)
+	}
+	rec = chatRequest(http.MethodPatch, fmt.Sprintf("/api/chat/conversations/%d", created.ID), `{"title":"磁盘告警"}`, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "磁盘告警") {
+		t.Fatalf("Rename: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 默认只列出自己的对话
+	rec = chatRequest(http.MethodGet, "/api/chat/conversations", "", nil)
+	if !strings.Contains(rec.Body.String(), `"total":1`) || strings.Contains(rec.Body.String(), "bob") {
+		t.Errorf("Expected only admin's conversation, got %s", rec.Body.String())
+	}
+
+	// 审计视图需要 chat:audit，只能列出元数据；读取内容需要 chat:read_all
+	auditor := &apitoken.Token{Name: "audit", Owner: "admin", Permissions: []string{PermissionChatAudit}}
+	if rec := chatRequest(http.MethodGet, "/api/chat/conversations?all=true", "", &apitoken.Token{Name: "logs", Owner: "admin", Permissions: []string{"logs:read"}}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without chat:audit, got %d", rec.Code)
+	}
+	rec = chatRequest(http.MethodGet, "/api/chat/conversations?all=true&owner=bob", "", auditor)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"total":1`) || !strings.Contains(rec.Body.String(), "bob 的排查") {
+		t.Errorf("Expected bob's conversation in the audit view, got %d %s", rec.Code, rec.Body.String())
+	}
+	bobPath := fmt.Sprintf("/api/chat/conversations/%d", bobs.ID)
+	if rec := chatRequest(http.MethodGet, bobPath, "", auditor); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected chat:audit not to read other users' conversations, got %d", rec.Code)
+	}
+	reader := &apitoken.Token{Name: "read", Owner: "admin", Permissions: []string{PermissionChatReadAll}}
+	if rec := chatRequest(http.MethodGet, bobPath, "", reader); rec.Code != http.StatusOK {
+		t.Errorf("Expected chat:read_all to read other users' conversations, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := chatRequest(http.MethodDelete, bobPath, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected other users' conversations not to be deleted, got %d", rec.Code)
+	}
+
+	// 未开启认证时不保存对话
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "", "" })
+	if rec := chatRequest(http.MethodGet, "/api/chat/conversations", "", nil); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without authentication, got %d", rec.Code)
+	}
+}
+
+func TestWSChat_PersistsConversation(t *testing.T) {
+	manager, dir := setupChatHistory(t)
+	srv := httptest.NewServer(http.HandlerFunc(handleWSChat))
+	defer srv.Close()
+	header := http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("admin:secret"))}}
+
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+query, header)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	// readConversation 读取到带标题的 conversation 帧为止
+	readConversation := func(conn *websocket.Conn) map[string]interface{} {
+		for {
+			var frame map[string]interface{}
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatalf("ReadJSON: %v", err)
+			}
+			if frame["type"] == "conversation" && frame["title"] != "" {
+				return frame
+			}
+		}
+	}
+
+	conn := dial("")
+	conn.WriteMessage(websocket.TextMessage, []byte("你好"))
+	frame := readConversation(conn)
+	conn.Close()
+	if frame["title"] != "你好" {
+		t.Fatalf("Expected the title from the first exchange, got %v", frame)
+	}
+	id := uint(frame["id"].(float64))
+	history, _ := manager.History(context.Background(), id)
+	if len(history) != 2 || history[0].Role != chathistory.RoleUser || history[1].Role != chathistory.RoleAssistant {
+		t.Fatalf("Expected the question and answer to be saved, got %+v", history)
+	}
+
+	// 刷新页面后继续同一个对话
+	conn = dial(fmt.Sprintf("?conversation=%d", id))
+	frame = readConversation(conn)
+	conn.Close()
+	if uint(frame["id"].(float64)) != id {
+		t.Errorf("Expected to attach to conversation %d, got %v", id, frame)
+	}
+
+	// 删除对话时一并删除两次连接的对话记录
+	transcripts, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(transcripts) == 0 {
+		t.Fatal("Expected transcripts to be recorded")
+	}
+	if rec := chatRequest(http.MethodDelete, fmt.Sprintf("/api/chat/conversations/%d", id), "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Delete: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, file := range transcripts {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be purged with the conversation", filepath.Base(file))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"qwq/internal/config"
+	"strconv"
+	"strings"
+)
+
+const (
+	// csrfCookie 双重提交的 CSRF token cookie，前端读取后放入 csrfHeader
+	csrfCookie = "qwq_csrf"
+	csrfHeader = "X-CSRF-Token"
+
+	// defaultCORSMaxAge 预检结果默认缓存时间（秒）
+	defaultCORSMaxAge = 600
+)
+
+// corsAllowedHeaders 跨域请求允许携带的请求头
+var corsAllowedHeaders = strings.Join([]string{"Authorization", "Content-Type", requestIDHeader, csrfHeader}, ", ")
+
+// sameOrigin Origin 与请求的 Host 一致，即页面由本服务提供
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// originAllowed 请求来源是否允许访问 API：没有 Origin（非浏览器或同源导航）、同源或在 cors.allowed_origins 中
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(r, origin) {
+		return true
+	}
+	return corsOriginListed(origin, false)
+}
+
+// corsOriginListed 来源是否在 cors.allowed_origins 中，exact 为 false 时 * 匹配任意来源
+func corsOriginListed(origin string, exact bool) bool {
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range config.Current().CORS.AllowedOrigins {
+		if allowed == "*" && !exact || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware 为 /api/ 请求应用跨域策略：默认只允许同源，cors.allowed_origins 中的来源
+// 获得 CORS 响应头并可以发起预检；其他来源的请求直接拒绝，避免已登录的浏览器被第三方页面利用
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !strings.HasPrefix(r.URL.Path, "/api/") || origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !corsOriginListed(origin, false) {
+			writeError(w, r, errOriginNotAllowed)
+			return
+		}
+
+		cfg := config.Current().CORS
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		// 只通过 * 匹配的来源不允许携带认证信息
+		if cfg.AllowCredentials && corsOriginListed(origin, true) {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+
+		// 预检请求
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			maxAge := cfg.MaxAge
+			if maxAge == 0 {
+				maxAge = defaultCORSMaxAge
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfMiddleware 携带 Cookie 的 /api/ 修改请求必须在 X-CSRF-Token 中回传 qwq_csrf cookie 的值（双重提交）。
+// 不带 Cookie 的请求（Basic Auth、API 客户端）不受影响，跨站来源已由 corsMiddleware 拒绝
+func csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || safeMethod(r.Method) || len(r.Cookies()) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cookie, err := r.Cookie(csrfCookie)
+		token := r.Header.Get(csrfHeader)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+			writeError(w, r, errInvalidCSRFToken)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCSRFToken 签发 CSRF token：写入 SameSite=Strict 的 cookie 并在响应中返回，前端在修改请求的 X-CSRF-Token 头中回传
+func handleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	token := ""
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		token = cookie.Value
+	} else {
+		b := make([]byte, 32)
+		rand.Read(b)
+		token = hex.EncodeToString(b)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token, "header": csrfHeader})
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
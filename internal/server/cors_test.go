@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func withCORS(t *testing.T, cors config.CORSConfig) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.CORS = cors })
+}
+
+func corsTestHandler() http.Handler {
+	return corsMiddleware(csrfMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+}
+
+func TestCORS_SameOriginOnlyByDefault(t *testing.T) {
+	withCORS(t, config.CORSConfig{})
+	handler := corsTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "http://qwq.local/api/trigger", nil)
+	req.Header.Set("Origin", "http://qwq.local")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected same-origin request to pass, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "http://qwq.local/api/trigger", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected disallowed origin to be rejected, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	withCORS(t, config.CORSConfig{AllowedOrigins: []string{"https://ops.example.com"}, AllowCredentials: true})
+	handler := corsTestHandler()
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "http://qwq.local/api/config/dynamic", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://ops.example.com")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 preflight, got %d", rec.Code)
+	}
+	h := rec.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://ops.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" ||
+		!strings.Contains(h.Get("Access-Control-Allow-Methods"), "PUT") || !strings.Contains(h.Get("Access-Control-Allow-Headers"), "Authorization") ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Unexpected preflight headers: %v", h)
+	}
+
+	if rec := preflight("https://other.example.com"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected preflight from unlisted origin to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestCORS_WildcardWithoutCredentials(t *testing.T) {
+	withCORS(t, config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+
+	req := httptest.NewRequest(http.MethodGet, "http://qwq.local/api/stats", nil)
+	req.Header.Set("Origin", "https://any.example")
+	rec := httptest.NewRecorder()
+	corsTestHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://any.example" {
+		t.Fatalf("Expected wildcard origin to pass, got %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Wildcard origins must not receive credentials")
+	}
+}
+
+func TestCSRF_RequiresTokenWithCookies(t *testing.T) {
+	withCORS(t, config.CORSConfig{})
+	handler := corsTestHandler()
+
+	// 无 Cookie 的 API 客户端不需要 token
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/trigger", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected cookie-less request to pass, got %d", rec.Code)
+	}
+
+	// 签发 token
+	rec = httptest.NewRecorder()
+	handleCSRFToken(rec, httptest.NewRequest(http.MethodGet, "/api/csrf", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("Expected a SameSite=Strict CSRF cookie, got %v", cookies)
+	}
+
+	post := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/trigger", nil)
+		req.AddCookie(cookies[0])
+		if token != "" {
+			req.Header.Set(csrfHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(""); code != http.StatusForbidden {
+		t.Errorf("Expected missing token to be rejected, got %d", code)
+	}
+	if code := post("forged"); code != http.StatusForbidden {
+		t.Errorf("Expected wrong token to be rejected, got %d", code)
+	}
+	if code := post(cookies[0].Value); code != http.StatusOK {
+		t.Errorf("Expected matching token to pass, got %d", code)
+	}
+}
+
+func TestWebSocket_CheckOrigin(t *testing.T) {
+	withCORS(t, config.CORSConfig{AllowedOrigins: []string{"https://ops.example.com"}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	for origin, allowed := range map[string]bool{
+		srv.URL:                   true,
+		"https://ops.example.com": true,
+		"https://evil.example":    false,
+	} {
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {origin}})
+		if conn != nil {
+			conn.Close()
+		}
+		if allowed && err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", origin, err)
+		}
+		if !allowed && (err == nil || resp == nil || resp.StatusCode != http.StatusForbidden) {
+			t.Errorf("Expected %s to be rejected with 403, got %v", origin, err)
+		}
+	}
+}
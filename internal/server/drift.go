@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/drift"
+	"qwq/internal/logger"
+	"strconv"
+	"strings"
+)
+
+// PermissionDriftResolve 处理托管文件外部修改（保留或覆盖）的权限
+const PermissionDriftResolve = "drift:resolve"
+
+// driftTracker 托管文件记录，测试中替换
+var driftTracker = drift.Default
+
+// handleDrift 托管文件和外部修改事件 GET /api/drift（?open=1 只返回未处理的事件）
+func handleDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": drift.Enabled(),
+		"files":   driftTracker.Files(),
+		"events":  driftTracker.Events(r.URL.Query().Get("open") != ""),
+	})
+}
+
+// handleDriftResolve 处理外部修改事件 POST /api/drift/{id}/resolve，body 为 {"action": "keep" | "overwrite"}
+func handleDriftResolve(w http.ResponseWriter, r *http.Request) {
+	idText, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/drift/"), "/")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil || action != "resolve" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !requestPermissions(r)(PermissionDriftResolve) {
+		logger.Info("[AUDIT] 🚨 无权限处理托管文件外部修改: #%d by %s", id, requestActor(r))
+		respondError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	event, err := driftTracker.Resolve(r.Context(), id, req.Action, requestActor(r))
+	if err != nil && event == nil {
+		switch {
+		case errors.Is(err, drift.ErrInvalidAction), errors.Is(err, drift.ErrEventNotFound), errors.Is(err, drift.ErrResolved):
+			writeError(w, r, err)
+		default:
+			// 恢复文件失败，原因需要展示给操作者
+			writeError(w, r, apierror.Wrap(http.StatusUnprocessableEntity, "DRIFT_RESOLVE_FAILED", err))
+		}
+		return
+	}
+	resp := map[string]interface{}{"event": event}
+	if err != nil {
+		// 文件已恢复，但重载等后续步骤失败
+		resp["warning"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/drift"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandleDriftResolve(t *testing.T) {
+	saved, savedTracker := config.Current(), driftTracker
+	t.Cleanup(func() {
+		config.Store(saved)
+		driftTracker = savedTracker
+	})
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.conf")
+	driftTracker = drift.NewTracker("")
+	if err := driftTracker.Write(drift.File{Path: path, Kind: drift.KindNginx, Owner: "a.com"}, []byte("listen 80;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("listen 8080;\n"), 0644)
+	driftTracker.Scan()
+
+	rec := httptest.NewRecorder()
+	handleDrift(rec, httptest.NewRequest(http.MethodGet, "/api/drift?open=1", nil))
+	var list struct {
+		Events []drift.Event `json:"events"`
+	}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list.Events) != 1 {
+		t.Fatalf("Expected one open drift event, got %d %+v", rec.Code, list)
+	}
+	id := list.Events[0].ID
+
+	post := func(path, body string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if admin {
+			req.SetBasicAuth("admin", "secret")
+		}
+		rec := httptest.NewRecorder()
+		handleDriftResolve(rec, req)
+		return rec
+	}
+	resolve := "/api/drift/" + strconv.FormatInt(id, 10) + "/resolve"
+	if rec := post(resolve, `{"action":"overwrite"}`, false); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for non-admin, got %d", rec.Code)
+	}
+	if rec := post(resolve, `{"action":"merge"}`, true); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown action, got %d", rec.Code)
+	}
+	if rec := post("/api/drift/999/resolve", `{"action":"keep"}`, true); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown event, got %d", rec.Code)
+	}
+	if rec := post(resolve, `{"action":"overwrite"}`, true); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", rec.Code, rec.Body)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "listen 80;\n" {
+		t.Errorf("Expected the managed version to be restored, got %q", data)
+	}
+	if rec := post(resolve, `{"action":"keep"}`, true); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an already resolved event, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"qwq/internal/config"
+	"qwq/internal/events"
+	"qwq/internal/logger"
+	"qwq/internal/notify"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DynamicConfigRequest 修改运行时配置的请求，只包含需要修改的部分，version 为读取时的版本号
+type DynamicConfigRequest struct {
+	Version int `json:"version"`
+	config.DynamicValues
+}
+
+// handleDynamicConfig 运行时配置（巡检规则、HTTP 监控、通知路由、健康评分阈值）：
+// GET 返回当前生效值及来源；PUT 校验后立即生效并保存到覆盖文件；DELETE ?section=&version= 恢复为配置文件中的值。
+// 提交的 version 与当前版本不一致时返回 409
+func handleDynamicConfig(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req DynamicConfigRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		if req.NotifyRouting != nil {
+			if _, err := notify.NewRouter(*req.NotifyRouting); err != nil {
+				writeError(w, r, invalidRequest(err))
+				return
+			}
+		}
+		diffs, version, err := config.ApplyDynamic(req.DynamicValues, req.Version, user)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		auditDynamicConfig("已修改", user, version, diffs)
+	case http.MethodDelete:
+		version, err := strconv.Atoi(r.URL.Query().Get("version"))
+		if err != nil {
+			writeError(w, r, requiredField("version", "version is required"))
+			return
+		}
+		var sections []string
+		if value := r.URL.Query().Get("section"); value != "" {
+			sections = strings.Split(value, ",")
+		}
+		diffs, version, err := config.RevertDynamic(sections, version, user)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		auditDynamicConfig("已恢复为配置文件中的值", user, version, diffs)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Dynamic())
+}
+
+// auditDynamicConfig 记录每个部分的变更并写入事件时间线，通知路由变化时重建路由器
+func auditDynamicConfig(action, user string, version int, diffs map[string]string) {
+	sections := make([]string, 0, len(diffs))
+	for section := range diffs {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		logger.Info("[AUDIT] ⚙️ 运行时配置 %s %s by %s (版本 %d):\n%s", section, action, user, version, diffs[section])
+		events.Emit(events.TypeConfig, "changed", user, section, fmt.Sprintf("运行时配置 %s %s (版本 %d)", section, action, version))
+		if section == config.SectionNotifyRouting {
+			if err := notify.InitRouter(); err != nil {
+				logger.Info("⚠️ 通知路由配置无效，全部发送到 default 渠道: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestHandleDynamicConfig(t *testing.T) {
+	saved, savedStartup := config.Current(), config.GlobalConfig
+	t.Cleanup(func() {
+		config.Store(saved)
+		config.GlobalConfig = savedStartup
+	})
+	config.GlobalConfig = config.Config{OverridesFile: filepath.Join(t.TempDir(), "qwq.overrides.json")}
+	if err := config.Init(""); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleDynamicConfig(rec, httptest.NewRequest(http.MethodPut, "/api/config/dynamic", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := put(`{"version":0,"http_rules":[{"name":"home","url":"https://example.com","code":200}]}`)
+	var state config.DynamicState
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("PUT failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if state.Version != 1 || state.Sections[config.SectionHTTPRules].Source != "override" || len(config.Current().HTTPRules) != 1 {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	if rec := put(`{"version":0,"http_rules":[]}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a stale version, got %d", rec.Code)
+	}
+	if rec := put(`{"version":1,"notify_routing":{"routes":[{"channels":["missing"]}]}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid routing, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleDynamicConfig(rec, httptest.NewRequest(http.MethodDelete, "/api/config/dynamic?section=http_rules&version=1", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil || state.Version != 2 || state.Sections[config.SectionHTTPRules].Source != "file" {
+		t.Errorf("Expected revert to file config, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(config.Current().HTTPRules) != 0 {
+		t.Errorf("Revert should restore file HTTP rules, got %+v", config.Current().HTTPRules)
+	}
+}
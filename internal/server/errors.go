@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/apitoken"
+	"qwq/internal/backup"
+	"qwq/internal/chathistory"
+	"qwq/internal/config"
+	"qwq/internal/drift"
+	"qwq/internal/events"
+	"qwq/internal/firewall"
+	"qwq/internal/hostaudit"
+	"qwq/internal/incident"
+	"qwq/internal/jobs"
+	"qwq/internal/logger"
+	"qwq/internal/maintenance"
+	"qwq/internal/monitor"
+	"qwq/internal/remote"
+	"qwq/internal/website"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// serverErrors 服务层错误到 API 错误码的映射，未列出的错误返回 INTERNAL
+var serverErrors = []apierror.Mapping{
+	{Err: config.ErrVersionConflict, Status: http.StatusConflict, Code: "CONFIG_VERSION_CONFLICT"},
+	{Err: config.ErrInvalidDynamic, Status: http.StatusBadRequest, Code: "CONFIG_INVALID"},
+	{Err: drift.ErrInvalidAction, Status: http.StatusBadRequest, Code: "DRIFT_INVALID_ACTION"},
+	{Err: drift.ErrEventNotFound, Status: http.StatusNotFound, Code: "DRIFT_EVENT_NOT_FOUND"},
+	{Err: drift.ErrResolved, Status: http.StatusConflict, Code: "DRIFT_ALREADY_RESOLVED"},
+	{Err: drift.ErrConflict, Status: http.StatusConflict, Code: "DRIFT_CONFLICT"},
+	{Err: firewall.ErrNoBackend, Status: http.StatusServiceUnavailable, Code: "FIREWALL_UNAVAILABLE"},
+	{Err: maintenance.ErrInvalidWindow, Status: http.StatusBadRequest, Code: "MAINTENANCE_INVALID_WINDOW"},
+	{Err: maintenance.ErrWindowNotFound, Status: http.StatusNotFound, Code: "MAINTENANCE_WINDOW_NOT_FOUND"},
+	{Err: backup.ErrSnapshotNotFound, Status: http.StatusNotFound, Code: "SNAPSHOT_NOT_FOUND"},
+	{Err: backup.ErrNoVolumes, Status: http.StatusUnprocessableEntity, Code: "SNAPSHOT_NO_VOLUMES"},
+	{Err: backup.ErrSnapshotQuota, Status: http.StatusInsufficientStorage, Code: "SNAPSHOT_QUOTA_EXCEEDED"},
+	{Err: backup.ErrConfigBackupNotFound, Status: http.StatusNotFound, Code: "BACKUP_NOT_FOUND"},
+	{Err: backup.ErrInvalidComponent, Status: http.StatusBadRequest, Code: "BACKUP_INVALID_COMPONENT"},
+	{Err: backup.ErrComponentNotInBackup, Status: http.StatusNotFound, Code: "BACKUP_COMPONENT_NOT_FOUND"},
+	{Err: backup.ErrNginxTestFailed, Status: http.StatusUnprocessableEntity, Code: "BACKUP_NGINX_TEST_FAILED"},
+	{Err: backup.ErrBackupFailed, Status: http.StatusInternalServerError, Code: "BACKUP_FAILED"},
+	{Err: backup.ErrRestoreFailed, Status: http.StatusInternalServerError, Code: "BACKUP_RESTORE_FAILED"},
+	{Err: jobs.ErrJobNotFound, Status: http.StatusNotFound, Code: "JOB_NOT_FOUND"},
+	{Err: jobs.ErrJobQueued, Status: http.StatusConflict, Code: "JOB_ALREADY_QUEUED"},
+	{Err: incident.ErrIncidentNotFound, Status: http.StatusNotFound, Code: "INCIDENT_NOT_FOUND"},
+	{Err: incident.ErrNoAnomalies, Status: http.StatusNotFound, Code: "INCIDENT_NO_ANOMALIES"},
+	{Err: hostaudit.ErrNoSnapshot, Status: http.StatusNotImplemented, Code: "HOST_AUDIT_UNSUPPORTED"},
+	{Err: apitoken.ErrInvalidRequest, Status: http.StatusBadRequest, Code: "TOKEN_INVALID"},
+	{Err: apitoken.ErrTokenNotFound, Status: http.StatusNotFound, Code: "TOKEN_NOT_FOUND"},
+	{Err: chathistory.ErrNotFound, Status: http.StatusNotFound, Code: "CONVERSATION_NOT_FOUND"},
+	{Err: chathistory.ErrInvalidRequest, Status: http.StatusBadRequest, Code: "CONVERSATION_INVALID"},
+	{Err: events.ErrInvalidQuery, Status: http.StatusBadRequest, Code: "EVENTS_INVALID_QUERY"},
+	{Err: monitor.ErrInvalidAnomalyQuery, Status: http.StatusBadRequest, Code: "ANOMALIES_INVALID_QUERY"},
+	{Err: logger.ErrNotInitialized, Status: http.StatusServiceUnavailable, Code: "LOGS_UNAVAILABLE"},
+	{Err: bcrypt.ErrPasswordTooLong, Status: http.StatusBadRequest, Code: "USER_PASSWORD_TOO_LONG"},
+	{Err: website.ErrInvalidBackend, Status: http.StatusBadRequest, Code: "WEBSITE_INVALID_BACKEND"},
+	{Err: errNginxTest, Status: http.StatusUnprocessableEntity, Code: "WEBSITE_NGINX_TEST_FAILED"},
+	{Err: errNginxReload, Status: http.StatusBadGateway, Code: "WEBSITE_NGINX_RELOAD_FAILED"},
+	{Err: website.ErrSSLCertNotFound, Status: http.StatusNotFound, Code: "SSL_CERT_NOT_FOUND"},
+	{Err: website.ErrRenewalNotDue, Status: http.StatusConflict, Code: "SSL_RENEWAL_NOT_DUE"},
+	{Err: remote.ErrInvalidHost, Status: http.StatusBadRequest, Code: "REMOTE_HOST_INVALID"},
+	{Err: remote.ErrHostNotFound, Status: http.StatusNotFound, Code: "REMOTE_HOST_NOT_FOUND"},
+	{Err: remote.ErrHostExists, Status: http.StatusConflict, Code: "REMOTE_HOST_EXISTS"},
+}
+
+// 内置管理接口的错误
+var (
+	errInvalidBody     = apierror.New(http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+	errWebsiteExists   = apierror.New(http.StatusConflict, "WEBSITE_DOMAIN_EXISTS", "Domain already exists")
+	errWebsiteNotFound = apierror.New(http.StatusNotFound, "WEBSITE_NOT_FOUND", "Website not found")
+	errInvalidDomain   = apierror.New(http.StatusBadRequest, "WEBSITE_INVALID_DOMAIN", "Domain must be a valid host name such as example.com")
+	errUsernameExists  = apierror.New(http.StatusConflict, "USER_USERNAME_EXISTS", "Username already exists")
+	errUserNotFound    = apierror.New(http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+	errRoleExists      = apierror.New(http.StatusConflict, "ROLE_NAME_EXISTS", "Role name already exists")
+	errRoleNotFound    = apierror.New(http.StatusNotFound, "ROLE_NOT_FOUND", "Role not found")
+	errBuiltinRole     = apierror.New(http.StatusConflict, "ROLE_BUILTIN", "The built-in admin role cannot be renamed or deleted")
+
+	errContainerNotFound      = apierror.New(http.StatusNotFound, "CONTAINER_NOT_FOUND", "Container not found")
+	errContainerRemoveConfirm = apierror.New(http.StatusBadRequest, "CONTAINER_REMOVE_CONFIRM_REQUIRED", "Removing a container requires confirm=true")
+	errContainerSelf          = apierror.New(http.StatusForbidden, "CONTAINER_SELF_PROTECTED", "Refusing to remove the container qwq is running in")
+	errInvalidLogTail         = apierror.New(http.StatusBadRequest, "CONTAINER_LOG_TAIL_INVALID", "tail must be a positive integer")
+	errInvalidLogSince        = apierror.New(http.StatusBadRequest, "CONTAINER_LOG_SINCE_INVALID", "since must be a duration like 10m, an RFC3339 time or unix seconds")
+
+	errLastAdmin          = apierror.New(http.StatusConflict, "USER_LAST_ADMIN", "Cannot delete the last admin user")
+	errUserDeleteTarget   = apierror.New(http.StatusBadRequest, "USER_DELETE_TARGET_REQUIRED", "Specify transfer_to or orphan=acknowledge to delete a user")
+	errUserTransferTarget = apierror.New(http.StatusBadRequest, "USER_TRANSFER_TARGET_INVALID", "transfer_to must be another existing user")
+
+	errOriginNotAllowed = apierror.New(http.StatusForbidden, "ORIGIN_NOT_ALLOWED", "origin not allowed")
+	errInvalidCSRFToken = apierror.New(http.StatusForbidden, "CSRF_TOKEN_INVALID", "missing or invalid CSRF token")
+	errPolicyTests      = apierror.New(http.StatusUnprocessableEntity, "POLICY_TESTS_FAILED", "policy tests failed")
+
+	errAuthDisabled       = apierror.New(http.StatusNotFound, "AUTH_DISABLED", "Authentication is not enabled (set web_user and web_password)")
+	errInvalidLogin       = apierror.New(http.StatusUnauthorized, "AUTH_INVALID_CREDENTIALS", "Invalid username or password")
+	errSessionRequired    = apierror.New(http.StatusBadRequest, "AUTH_SESSION_REQUIRED", "Logout requires a session token")
+	errSessionUnavailable = apierror.New(http.StatusServiceUnavailable, "AUTH_SESSION_UNAVAILABLE", "Session tokens are not available")
+)
+
+// writeError 按映射表返回统一的错误响应，未知错误只返回请求 ID
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err, serverErrors...)
+}
+
+// respondError 返回指定状态码的错误响应，错误码按状态码选择
+func respondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	apierror.Respond(w, r, status, message)
+}
+
+// invalidRequest 请求参数校验失败，错误信息原样返回给客户端
+func invalidRequest(err error) error {
+	return apierror.Wrap(http.StatusBadRequest, apierror.CodeValidation, err)
+}
+
+// requiredField 缺少必填字段，details 中给出字段名
+func requiredField(field, message string) error {
+	return apierror.New(http.StatusBadRequest, apierror.CodeValidation, message).WithDetails(map[string]string{"field": field})
+}
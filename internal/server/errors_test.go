@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/apierror"
+	"qwq/internal/jobs"
+	"strings"
+	"testing"
+)
+
+func decodeEnvelope(t *testing.T, rec *httptest.ResponseRecorder) apierror.Envelope {
+	t.Helper()
+	var envelope apierror.Envelope
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatalf("Expected an error envelope: %v", err)
+	}
+	return envelope
+}
+
+func TestWriteError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs/report/run", nil)
+	req.Header.Set(apierror.RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	writeError(rec, req, fmt.Errorf("%w: report", jobs.ErrJobNotFound))
+	envelope := decodeEnvelope(t, rec)
+	if rec.Code != http.StatusNotFound || envelope.Code != "JOB_NOT_FOUND" || envelope.RequestID != "req-1" || envelope.Message != "job not found: report" {
+		t.Errorf("Unexpected response %d %+v", rec.Code, envelope)
+	}
+
+	rec = httptest.NewRecorder()
+	writeError(rec, req, errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	envelope = decodeEnvelope(t, rec)
+	if rec.Code != http.StatusInternalServerError || envelope.Code != apierror.CodeInternal || strings.Contains(envelope.Message, "10.0.0.5") {
+		t.Errorf("Unknown errors must not leak details, got %d %+v", rec.Code, envelope)
+	}
+	if envelope.RequestID == "" || rec.Header().Get(apierror.RequestIDHeader) != envelope.RequestID {
+		t.Errorf("Expected the request ID in body and header, got %+v", envelope)
+	}
+}
+
+func TestHandleWebsites_ErrorCodes(t *testing.T) {
+	setupDashboard(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleWebsites(rec, httptest.NewRequest(http.MethodPost, "/api/websites", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := post(`{"domain":"example.com"}`); rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+		t.Fatalf("Expected website to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := post(`{"domain":"example.com"}`)
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusConflict || envelope.Code != "WEBSITE_DOMAIN_EXISTS" {
+		t.Errorf("Expected WEBSITE_DOMAIN_EXISTS, got %d %+v", rec.Code, envelope)
+	}
+	rec = post(`{}`)
+	envelope := decodeEnvelope(t, rec)
+	if details, _ := envelope.Details.(map[string]interface{}); rec.Code != http.StatusBadRequest || envelope.Code != apierror.CodeValidation || details["field"] != "domain" {
+		t.Errorf("Expected a field validation error, got %d %+v", rec.Code, envelope)
+	}
+	rec = post(`not json`)
+	if envelope := decodeEnvelope(t, rec); envelope.Code != "INVALID_REQUEST_BODY" {
+		t.Errorf("Expected INVALID_REQUEST_BODY, got %+v", envelope)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/events"
+	"qwq/internal/logger"
+	"strconv"
+	"time"
+)
+
+var errEventsUnavailable = apierror.New(http.StatusServiceUnavailable, "EVENTS_UNAVAILABLE", "Event timeline is not available")
+
+// eventsQuery 解析 from、to（RFC3339 或 Unix 秒）、type（逗号分隔）和 limit 参数
+func eventsQuery(r *http.Request) (events.Query, error) {
+	values := r.URL.Query()
+	q := events.Query{Types: events.ParseTypes(values.Get("type"))}
+	var err error
+	if q.From, err = parseEventTime(values.Get("from")); err != nil {
+		return q, requiredField("from", "from must be an RFC3339 time or unix seconds")
+	}
+	if q.To, err = parseEventTime(values.Get("to")); err != nil {
+		return q, requiredField("to", "to must be an RFC3339 time or unix seconds")
+	}
+	if value := values.Get("limit"); value != "" {
+		if q.Limit, err = strconv.Atoi(value); err != nil || q.Limit < 0 {
+			return q, requiredField("limit", "limit must be a positive integer")
+		}
+	}
+	return q, nil
+}
+
+func parseEventTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleEvents 事件时间线 GET /api/events?from=&to=&type=container,deployment&limit=
+// 按时间顺序返回，超过 limit（默认 500，最多 5000）时返回最近的事件
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	store := events.Default()
+	if store == nil {
+		writeError(w, r, errEventsUnavailable)
+		return
+	}
+	q, err := eventsQuery(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	list, err := store.Query(r.Context(), q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":         list,
+		"retention_days": int(store.Retention() / (24 * time.Hour)),
+	})
+}
+
+// handleWSEvents 实时推送新记录的事件 /ws/events?type=，每条消息为一个事件的 JSON
+// 控制台先通过 /api/events 加载历史，再用该连接追加新事件
+func handleWSEvents(w http.ResponseWriter, r *http.Request) {
+	store := events.Default()
+	if store == nil {
+		writeError(w, r, errEventsUnavailable)
+		return
+	}
+	q := events.Query{Types: events.ParseTypes(r.URL.Query().Get("type"))}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Info("WS Upgrade Error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	updates, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+
+	// 客户端不发送消息，读协程只用于发现连接断开
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			if !q.Matches(event) {
+				continue
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				logger.Debug("事件推送连接已断开: %v", err)
+				return
+			}
+		}
+	}
+}
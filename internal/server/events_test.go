@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/events"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupEvents(t *testing.T) *events.Store {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&events.Event{}); err != nil {
+		t.Fatal(err)
+	}
+	store := events.NewStore(db, 0)
+	events.SetDefault(store)
+	t.Cleanup(func() { events.SetDefault(nil) })
+	return store
+}
+
+func TestHandleEvents(t *testing.T) {
+	unavailable := httptest.NewRecorder()
+	handleEvents(unavailable, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	if unavailable.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without an event store, got %d", unavailable.Code)
+	}
+
+	store := setupEvents(t)
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 14, 30, 0, 0, time.UTC)
+	store.Record(ctx, events.Event{Time: base, Source: events.SourceDocker, Type: events.TypeContainer, Action: "restart", Target: "db"})
+	store.Record(ctx, events.Event{Time: base.Add(time.Minute), Type: events.TypeDeployment, Action: "deployment_started", Target: "shop #3"})
+	store.Record(ctx, events.Event{Time: base.Add(time.Hour), Type: events.TypeContainer, Action: "die", Target: "db"})
+
+	rec := httptest.NewRecorder()
+	handleEvents(rec, httptest.NewRequest(http.MethodGet, "/api/events?from=2026-03-01T14:00:00Z&to=2026-03-01T15:00:00Z&type=container", nil))
+	var body struct {
+		Events []events.Event `json:"events"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || len(body.Events) != 1 || body.Events[0].Action != "restart" {
+		t.Fatalf("Expected only the container restart in the window, got %d %+v", rec.Code, body.Events)
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2026-03-01", "limit=-1", "from=1772380800&to=1772377200"} {
+		rec := httptest.NewRecorder()
+		handleEvents(rec, httptest.NewRequest(http.MethodGet, "/api/events?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestHandleWSEvents(t *testing.T) {
+	store := setupEvents(t)
+	srv := httptest.NewServer(http.HandlerFunc(handleWSEvents))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?type=healing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 连接建立和订阅之间没有同步信号，持续记录事件直到收到推送
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			store.Record(context.Background(), events.Event{Type: events.TypeConfig, Target: "patrol_rules"})
+			store.Record(context.Background(), events.Event{Type: events.TypeHealing, Action: "restart", Target: "db"})
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var event events.Event
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Expected a live event, got %v", err)
+	}
+	if event.Type != events.TypeHealing || event.Target != "db" {
+		t.Errorf("Expected only healing events, got %+v", event)
+	}
+}
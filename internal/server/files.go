@@ -4,10 +4,14 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"qwq/internal/config"
 	"qwq/internal/logger"
 	"sort"
 	"strings"
@@ -37,6 +41,20 @@ var BlockList = []string{
 	"/boot",  // 系统启动文件目录
 }
 
+const (
+	// defaultMaxFileMB 在线查看和保存的文件大小上限（MB）的默认值
+	defaultMaxFileMB = 5
+	// defaultMaxUploadMB 上传文件大小上限（MB）的默认值
+	defaultMaxUploadMB = 100
+)
+
+var (
+	// ErrPathDenied 路径位于禁止访问的目录或允许的根目录之外（包括经符号链接逃逸）
+	ErrPathDenied = errors.New("access denied")
+	// ErrSpecialFile 设备、套接字、管道等特殊文件不支持查看和编辑
+	ErrSpecialFile = errors.New("access denied: special files (devices, sockets, pipes) are not supported")
+)
+
 // FileInfo 文件信息结构体
 // 包含文件的基本属性信息，用于前端文件列表显示
 type FileInfo struct {
@@ -57,9 +75,12 @@ type FileResponse struct {
 }
 
 // jsonResponse 发送 JSON 格式的响应
-// 统一处理 API 响应格式，设置正确的 Content-Type 头
+// 统一处理 API 响应格式，设置正确的 Content-Type 头；错误时 HTTP 状态码与 code 一致
 func jsonResponse(w http.ResponseWriter, code int, msg string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	if code != http.StatusOK {
+		w.WriteHeader(code)
+	}
 	json.NewEncoder(w).Encode(FileResponse{
 		Code: code,
 		Msg:  msg,
@@ -69,33 +90,139 @@ func jsonResponse(w http.ResponseWriter, code int, msg string, data interface{})
 
 // resolveSafePath 安全路径解析函数
 // 防止路径遍历攻击和访问敏感系统目录
+// 用户路径一律按宿主机根目录解析，解析符号链接后必须位于 files.allowed_roots 之内且不在 BlockList 中
 // 参数：userPath - 用户提供的路径
-// 返回：安全的绝对路径和可能的错误
+// 返回：安全的绝对路径（已解析符号链接）和可能的错误，拒绝访问时错误为 ErrPathDenied
 func resolveSafePath(userPath string) (string, error) {
-	// 清理路径，移除 ".." 等危险元素
-	cleanPath := filepath.Clean(userPath)
-	
-	// 如果用户路径是根路径，直接返回挂载点
-	if cleanPath == "/" || cleanPath == "" {
-		return MountPoint, nil
+	// 以 / 开头再清理，相对路径和多余的 ".." 都无法越过根目录
+	cleanPath := filepath.Clean("/" + userPath)
+	if blocked(cleanPath) {
+		return "", fmt.Errorf("%w: path '%s' is in blocklist", ErrPathDenied, cleanPath)
 	}
-	
-	// 检查是否访问被禁止的系统目录
-	for _, blocked := range BlockList {
-		if strings.HasPrefix(cleanPath, blocked) {
-			return "", fmt.Errorf("access denied: path '%s' is in blocklist", cleanPath)
+
+	// 将用户路径映射到容器内的实际路径，并解析其中的符号链接
+	mount, err := filepath.EvalSymlinks(MountPoint)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := evalExisting(filepath.Join(mount, cleanPath))
+	if err != nil {
+		return "", err
+	}
+
+	// 符号链接可能指向挂载点、允许的根目录之外或被禁止的目录
+	hostPath, err := filepath.Rel(mount, realPath)
+	if err != nil || !withinDir(realPath, mount) {
+		return "", fmt.Errorf("%w: path '%s' escapes the mount point", ErrPathDenied, cleanPath)
+	}
+	hostPath = filepath.Clean("/" + hostPath)
+	if blocked(hostPath) {
+		return "", fmt.Errorf("%w: path '%s' resolves to '%s' which is in blocklist", ErrPathDenied, cleanPath, hostPath)
+	}
+	for _, root := range allowedRoots(mount) {
+		if withinDir(realPath, root) {
+			return realPath, nil
 		}
 	}
-	
-	// 将用户路径映射到容器内的实际路径
-	realPath := filepath.Join(MountPoint, cleanPath)
-	
-	// 防止路径逃逸攻击（确保路径在挂载点内）
-	if !strings.HasPrefix(realPath, MountPoint) {
-		return "", fmt.Errorf("access denied: path escape detected")
+	return "", fmt.Errorf("%w: path '%s' resolves to '%s' which is outside the allowed roots", ErrPathDenied, cleanPath, hostPath)
+}
+
+// blocked 宿主机路径是否为 BlockList 中的目录或其子路径
+func blocked(hostPath string) bool {
+	for _, dir := range BlockList {
+		if withinDir(hostPath, dir) {
+			return true
+		}
 	}
-	
-	return realPath, nil
+	return false
+}
+
+// withinDir path 是否为 dir 本身或其子路径，两者都是清理过的绝对路径
+func withinDir(path, dir string) bool {
+	return path == dir || dir == "/" || strings.HasPrefix(path, dir+"/")
+}
+
+// allowedRoots 允许访问的根目录在挂载点内的实际路径（已解析符号链接），未配置时为整个挂载点
+func allowedRoots(mount string) []string {
+	roots := config.Current().Files.AllowedRoots
+	if len(roots) == 0 {
+		return []string{mount}
+	}
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		// 不存在的根目录按原样保留，创建后即可访问
+		realRoot, err := evalExisting(filepath.Join(mount, filepath.Clean("/"+root)))
+		if err == nil {
+			resolved = append(resolved, realRoot)
+		}
+	}
+	return resolved
+}
+
+// evalExisting 解析路径中的符号链接；末尾尚不存在的部分（如新建的文件）拼接在已解析的上级目录之后。
+// 指向不存在目标的符号链接直接拒绝，避免写入时创建到链接目标
+func evalExisting(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if _, lerr := os.Lstat(path); lerr == nil {
+		return "", fmt.Errorf("%w: '%s' is a broken symlink", ErrPathDenied, filepath.Base(path))
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	resolvedParent, err := evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// isRootPath 已解析的路径是否为挂载点或允许的根目录本身
+func isRootPath(realPath string) bool {
+	mount, err := filepath.EvalSymlinks(MountPoint)
+	if err != nil || realPath == mount {
+		return true
+	}
+	for _, root := range allowedRoots(mount) {
+		if realPath == root {
+			return true
+		}
+	}
+	return false
+}
+
+// maxFileBytes 在线查看和保存的文件大小上限（字节）
+func maxFileBytes() int64 {
+	mb := config.Current().Files.MaxFileMB
+	if mb <= 0 {
+		mb = defaultMaxFileMB
+	}
+	return int64(mb) << 20
+}
+
+// maxUploadBytes 上传的单个文件大小上限（字节）
+func maxUploadBytes() int64 {
+	mb := config.Current().Files.MaxUploadMB
+	if mb <= 0 {
+		mb = defaultMaxUploadMB
+	}
+	return int64(mb) << 20
+}
+
+// pathError 把路径解析的错误转换为响应：拒绝访问为 403，其他（如权限不足）为 500
+func pathError(w http.ResponseWriter, userPath string, err error) {
+	if errors.Is(err, ErrPathDenied) {
+		logger.Info("[AUDIT] 🚨 非法访问尝试: %s | Error: %v", userPath, err)
+		jsonResponse(w, 403, err.Error(), nil)
+		return
+	}
+	jsonResponse(w, 500, fmt.Sprintf("路径解析失败: %v", err), nil)
 }
 
 // handleFileList 处理文件列表请求
@@ -111,8 +238,7 @@ func handleFileList(w http.ResponseWriter, r *http.Request) {
 	// 安全路径解析，防止路径遍历攻击
 	realPath, err := resolveSafePath(userPath)
 	if err != nil {
-		logger.Info("[AUDIT] 🚨 非法访问尝试: %s | Error: %v", userPath, err)
-		jsonResponse(w, 403, err.Error(), nil)
+		pathError(w, userPath, err)
 		return
 	}
 
@@ -166,7 +292,7 @@ func handleFileContent(w http.ResponseWriter, r *http.Request) {
 	userPath := r.URL.Query().Get("path")
 	realPath, err := resolveSafePath(userPath)
 	if err != nil {
-		jsonResponse(w, 403, err.Error(), nil)
+		pathError(w, userPath, err)
 		return
 	}
 
@@ -176,10 +302,19 @@ func handleFileContent(w http.ResponseWriter, r *http.Request) {
 		jsonResponse(w, 404, "文件不存在", nil)
 		return
 	}
-	
-	// 限制文件大小，防止内存溢出（最大 2MB）
-	if info.Size() > 2*1024*1024 {
-		jsonResponse(w, 400, "文件过大 (>2MB)，不支持在线编辑", nil)
+	if info.IsDir() {
+		jsonResponse(w, 400, "目录不支持在线编辑", nil)
+		return
+	}
+	// 读取设备、管道等特殊文件可能阻塞或返回无限数据
+	if !info.Mode().IsRegular() {
+		jsonResponse(w, 403, ErrSpecialFile.Error(), nil)
+		return
+	}
+
+	// 限制文件大小，防止内存溢出
+	if limit := maxFileBytes(); info.Size() > limit {
+		jsonResponse(w, 413, fmt.Sprintf("文件过大 (>%dMB)，不支持在线编辑", limit>>20), nil)
 		return
 	}
 
@@ -211,20 +346,35 @@ func handleFileSave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体中的 JSON 数据
+	// 请求体按 JSON 转义后的最大长度限制，内容本身的大小在解析后检查
+	limit := maxFileBytes()
 	var req struct {
 		Path    string `json:"path"`    // 文件路径
 		Content string `json:"content"` // 文件内容
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 6*limit+4096)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			jsonResponse(w, 413, fmt.Sprintf("文件过大 (>%dMB)，不支持在线保存", limit>>20), nil)
+			return
+		}
 		jsonResponse(w, 400, "Invalid JSON", nil)
 		return
 	}
+	if int64(len(req.Content)) > limit {
+		jsonResponse(w, 413, fmt.Sprintf("文件过大 (>%dMB)，不支持在线保存", limit>>20), nil)
+		return
+	}
 
 	// 安全路径解析
 	realPath, err := resolveSafePath(req.Path)
 	if err != nil {
-		logger.Info("[AUDIT] 🚨 非法写入尝试: %s", req.Path)
-		jsonResponse(w, 403, err.Error(), nil)
+		pathError(w, req.Path, err)
+		return
+	}
+	// 只能覆盖普通文件，目录和特殊文件不能被替换
+	if info, err := os.Stat(realPath); err == nil && !info.Mode().IsRegular() {
+		jsonResponse(w, 403, ErrSpecialFile.Error(), nil)
 		return
 	}
 
@@ -251,20 +401,26 @@ func handleFileAction(w http.ResponseWriter, r *http.Request) {
 	// 安全路径解析
 	realPath, err := resolveSafePath(userPath)
 	if err != nil {
-		jsonResponse(w, 403, err.Error(), nil)
+		pathError(w, userPath, err)
 		return
 	}
 
 	// 根据操作类型执行相应操作
 	switch action {
 	case "delete":
-		// 防止删除根目录的安全检查
-		if userPath == "/" || realPath == MountPoint {
+		// 防止删除根目录和允许的根目录本身
+		if isRootPath(realPath) {
 			jsonResponse(w, 403, "禁止删除根目录", nil)
 			return
 		}
+		// 删除符号链接本身而不是链接目标：上级目录已校验，删除其中的原始文件名
+		target := realPath
+		cleanPath := filepath.Clean("/" + userPath)
+		if parent, perr := resolveSafePath(filepath.Dir(cleanPath)); perr == nil {
+			target = filepath.Join(parent, filepath.Base(cleanPath))
+		}
 		// 递归删除文件或目录
-		err = os.RemoveAll(realPath)
+		err = os.RemoveAll(target)
 		if err == nil {
 			logger.Info("[AUDIT] 🗑️ 文件/目录已删除: %s", userPath)
 		}
@@ -288,6 +444,151 @@ func handleFileAction(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, 200, "success", nil)
 }
 
+// handleFileUpload 处理文件上传请求 POST /api/files/upload?path=<目标目录>&overwrite=true
+// multipart 表单的 file 字段逐块写入目标目录下的临时文件，完整接收后重命名为上传的文件名；
+// 目标文件已存在时需要 overwrite=true，否则返回 409
+func handleFileUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonResponse(w, 405, "Method not allowed", nil)
+		return
+	}
+	userDir := r.URL.Query().Get("path")
+	overwrite := r.URL.Query().Get("overwrite") == "true"
+	dir, err := resolveSafePath(userDir)
+	if err != nil {
+		pathError(w, userDir, err)
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		jsonResponse(w, 404, "目标目录不存在", nil)
+		return
+	}
+
+	// 直接读取 multipart 流，不在内存或系统临时目录中缓存整个文件
+	limit := maxUploadBytes()
+	reader, err := r.MultipartReader()
+	if err != nil {
+		jsonResponse(w, 400, "需要 multipart/form-data 请求", nil)
+		return
+	}
+	var part io.Reader
+	var name string
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			jsonResponse(w, 400, "缺少 file 字段", nil)
+			return
+		}
+		if p.FormName() == "file" {
+			part, name = p, p.FileName()
+			break
+		}
+	}
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		jsonResponse(w, 400, "无效的文件名", nil)
+		return
+	}
+
+	// 目标文件名单独校验：同名的符号链接可能指向允许的目录之外
+	userPath := filepath.Join(filepath.Clean("/"+userDir), name)
+	target, err := resolveSafePath(userPath)
+	if err != nil {
+		pathError(w, userPath, err)
+		return
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(target); err == nil {
+		if !info.Mode().IsRegular() {
+			jsonResponse(w, 403, ErrSpecialFile.Error(), nil)
+			return
+		}
+		if !overwrite {
+			jsonResponse(w, 409, fmt.Sprintf("文件 %s 已存在，覆盖需要 overwrite=true", userPath), nil)
+			return
+		}
+		perm = info.Mode().Perm()
+	}
+
+	// 在目标目录中创建临时文件，保证重命名是原子操作
+	tmpFile, err := os.CreateTemp(filepath.Dir(target), "qwq_upload_*")
+	if err != nil {
+		jsonResponse(w, 500, fmt.Sprintf("上传失败: %v", err), nil)
+		return
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+	size, err := io.Copy(tmpFile, io.LimitReader(part, limit+1))
+	if err == nil && size > limit {
+		tmpFile.Close()
+		jsonResponse(w, 413, fmt.Sprintf("文件过大 (>%dMB)", limit>>20), nil)
+		return
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, target)
+	}
+	if err != nil {
+		logger.Info("[AUDIT] ❌ 文件上传失败: %s | Error: %v", userPath, err)
+		jsonResponse(w, 500, fmt.Sprintf("上传失败: %v", err), nil)
+		return
+	}
+
+	logger.Info("[AUDIT] 📤 文件已上传: %s (Size: %d bytes)", userPath, size)
+	jsonResponse(w, 200, "success", map[string]interface{}{
+		"path": userPath,
+		"size": size,
+	})
+}
+
+// handleFileDownload 处理文件下载请求 GET /api/files/download?path=
+// 以附件形式流式返回文件，支持 Range 请求分段下载大日志
+func handleFileDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonResponse(w, 405, "Method not allowed", nil)
+		return
+	}
+	userPath := r.URL.Query().Get("path")
+	realPath, err := resolveSafePath(userPath)
+	if err != nil {
+		pathError(w, userPath, err)
+		return
+	}
+	// 打开前检查类型：以读方式打开管道会一直阻塞到有写入方
+	info, err := os.Stat(realPath)
+	if err != nil {
+		jsonResponse(w, 404, "文件不存在", nil)
+		return
+	}
+	if info.IsDir() {
+		jsonResponse(w, 400, "不支持下载目录", nil)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		jsonResponse(w, 403, ErrSpecialFile.Error(), nil)
+		return
+	}
+	file, err := os.Open(realPath)
+	if err != nil {
+		jsonResponse(w, 500, "读取失败", nil)
+		return
+	}
+	defer file.Close()
+
+	// 附件名使用请求的文件名，符号链接下载时不暴露链接目标
+	name := filepath.Base(filepath.Clean("/" + userPath))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
 // atomicWriteFile 原子写入文件函数
 // 通过临时文件和重命名操作确保文件写入的原子性
 // 防止写入过程中系统崩溃导致的文件损坏
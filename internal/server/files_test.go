@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+)
+
+// setupFileJail 以临时目录为挂载点，只允许访问 /srv；/secret 在允许的根目录之外
+func setupFileJail(t *testing.T) string {
+	t.Helper()
+	mount := t.TempDir()
+	savedMount, savedConfig := MountPoint, config.Current()
+	t.Cleanup(func() {
+		MountPoint = savedMount
+		config.Store(savedConfig)
+	})
+	MountPoint = mount
+	config.Update(func(cfg *config.Config) {
+		cfg.Files = config.FilesConfig{AllowedRoots: []string{"/srv"}, MaxFileMB: 1, MaxUploadMB: 1}
+	})
+
+	for _, dir := range []string{"srv/app", "secret"} {
+		if err := os.MkdirAll(filepath.Join(mount, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"srv/app/app.conf": "listen 80", "secret/shadow": "root:x"} {
+		if err := os.WriteFile(filepath.Join(mount, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"srv/app/escape":   filepath.Join(mount, "secret"),
+		"srv/app/relative": "../../secret/shadow",
+		"srv/app/current":  "app.conf",
+		"srv/app/dangling": filepath.Join(mount, "secret/missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(mount, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mount
+}
+
+func TestFileManager_PathJail(t *testing.T) {
+	setupFileJail(t)
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{"allowed file", "/srv/app/app.conf", http.StatusOK},
+		{"relative path is rooted", "srv/app/app.conf", http.StatusOK},
+		{"symlink inside the jail", "/srv/app/current", http.StatusOK},
+		{"dot dot out of the root", "/srv/app/../../secret/shadow", http.StatusForbidden},
+		{"dot dot above the mount point", "../../../../secret/shadow", http.StatusForbidden},
+		{"encoded slashes", "/srv/app/..%2F..%2Fsecret%2Fshadow", http.StatusForbidden},
+		{"double encoded slashes stay literal", "/srv/app/..%252Fsecret", http.StatusNotFound},
+		{"symlinked directory escape", "/srv/app/escape/shadow", http.StatusForbidden},
+		{"relative symlink escape", "/srv/app/relative", http.StatusForbidden},
+		{"dangling symlink", "/srv/app/dangling", http.StatusForbidden},
+		{"outside the allowed roots", "/secret/shadow", http.StatusForbidden},
+		{"blocklist", "/proc/self/environ", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleFileContent(rec, httptest.NewRequest(http.MethodGet, "/api/files/content?path="+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("Expected %d, got %d %s", tt.code, rec.Code, rec.Body.String())
+			}
+			if strings.Contains(rec.Body.String(), "root:x") {
+				t.Errorf("The secret file must not be served: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFileManager_WritesStayInJail(t *testing.T) {
+	mount := setupFileJail(t)
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{"new file", "/srv/app/new.conf", http.StatusOK},
+		{"through a symlinked directory", "/srv/app/escape/evil", http.StatusForbidden},
+		{"through a dangling symlink", "/srv/app/dangling", http.StatusForbidden},
+		{"dot dot", "/srv/../secret/evil", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			body := `{"path":"` + tt.path + `","content":"pwned"}`
+			handleFileSave(rec, httptest.NewRequest(http.MethodPost, "/api/files/save", strings.NewReader(body)))
+			if rec.Code != tt.code {
+				t.Fatalf("Expected %d, got %d %s", tt.code, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(filepath.Join(mount, "secret")); len(entries) != 1 {
+		t.Errorf("Expected nothing to be written outside the jail, got %d entries", len(entries))
+	}
+
+	// 删除指向允许目录内文件的符号链接只删除链接本身
+	rec := httptest.NewRecorder()
+	handleFileAction(rec, httptest.NewRequest(http.MethodPost, "/api/files/action?type=delete&path=/srv/app/current", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the link to be deleted, got %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(mount, "srv/app/app.conf")); err != nil {
+		t.Errorf("Deleting a symlink must keep its target: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	handleFileAction(rec, httptest.NewRequest(http.MethodPost, "/api/files/action?type=delete&path=/srv", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected an allowed root to be protected, got %d", rec.Code)
+	}
+}
+
+func TestFileManager_SizeAndSpecialFiles(t *testing.T) {
+	mount := setupFileJail(t)
+	if err := os.WriteFile(filepath.Join(mount, "srv/app/big.log"), make([]byte, 1<<20+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(mount, "srv/app/app.sock"))
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	for path, code := range map[string]int{"/srv/app/big.log": http.StatusRequestEntityTooLarge, "/srv/app/app.sock": http.StatusForbidden} {
+		rec := httptest.NewRecorder()
+		handleFileContent(rec, httptest.NewRequest(http.MethodGet, "/api/files/content?path="+path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: expected %d, got %d %s", path, code, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{"path":"/srv/app/app.sock","content":"x"}`
+	handleFileSave(rec, httptest.NewRequest(http.MethodPost, "/api/files/save", strings.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a socket not to be overwritten, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	body = `{"path":"/srv/app/huge.txt","content":"` + strings.Repeat("x", 1<<20+1) + `"}`
+	handleFileSave(rec, httptest.NewRequest(http.MethodPost, "/api/files/save", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected an oversized save to be rejected, got %d", rec.Code)
+	}
+}
+
+// uploadRequest 构造上传 content 为 name 的 multipart 请求
+func uploadRequest(t *testing.T, query, name string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/files/upload?"+query, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestHandleFileUpload(t *testing.T) {
+	mount := setupFileJail(t)
+	tests := []struct {
+		name    string
+		query   string
+		file    string
+		content []byte
+		code    int
+	}{
+		{"new file", "path=/srv/app", "configs.tar.gz", []byte("v1"), http.StatusOK},
+		{"existing file without overwrite", "path=/srv/app", "configs.tar.gz", []byte("v2"), http.StatusConflict},
+		{"existing file with overwrite", "path=/srv/app&overwrite=true", "configs.tar.gz", []byte("v3"), http.StatusOK},
+		{"too large", "path=/srv/app", "big.bin", make([]byte, 1<<20+1), http.StatusRequestEntityTooLarge},
+		{"destination outside the jail", "path=/srv/app/escape", "evil", []byte("x"), http.StatusForbidden},
+		{"file name is a symlink out of the jail", "path=/srv/app&overwrite=true", "relative", []byte("x"), http.StatusForbidden},
+		{"directories in the file name are dropped", "path=/srv/app", "../../secret/evil", []byte("x"), http.StatusOK},
+		{"missing directory", "path=/srv/missing", "a.txt", []byte("x"), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleFileUpload(rec, uploadRequest(t, tt.query, tt.file, tt.content))
+			if rec.Code != tt.code {
+				t.Fatalf("Expected %d, got %d %s", tt.code, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(mount, "srv/app/configs.tar.gz")); string(data) != "v3" {
+		t.Errorf("Expected the overwrite to replace the file, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(mount, "secret/shadow")); string(data) != "root:x" {
+		t.Errorf("The file outside the jail must not change, got %q", data)
+	}
+	entries, _ := os.ReadDir(filepath.Join(mount, "srv/app"))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "qwq_upload_") || entry.Name() == "big.bin" {
+			t.Errorf("Expected rejected uploads to leave no files, found %s", entry.Name())
+		}
+	}
+}
+
+func TestHandleFileDownload(t *testing.T) {
+	mount := setupFileJail(t)
+	log := bytes.Repeat([]byte("0123456789"), 1<<18)
+	if err := os.WriteFile(filepath.Join(mount, "srv/app/access.log"), log, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleFileDownload(rec, httptest.NewRequest(http.MethodGet, "/api/files/download?path=/srv/app/access.log", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != len(log) || rec.Header().Get("Content-Disposition") != `attachment; filename=access.log` {
+		t.Fatalf("Expected the whole file as an attachment, got %d, %d bytes, %q", rec.Code, rec.Body.Len(), rec.Header().Get("Content-Disposition"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/files/download?path=/srv/app/access.log", nil)
+	req.Header.Set("Range", "bytes=12-15")
+	rec = httptest.NewRecorder()
+	handleFileDownload(rec, req)
+	if body, _ := io.ReadAll(rec.Body); rec.Code != http.StatusPartialContent || string(body) != "2345" {
+		t.Errorf("Expected the requested range, got %d %q", rec.Code, body)
+	}
+
+	for path, code := range map[string]int{"/srv/app/escape/shadow": http.StatusForbidden, "/srv/app": http.StatusBadRequest, "/srv/app/missing": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		handleFileDownload(rec, httptest.NewRequest(http.MethodGet, "/api/files/download?path="+path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: expected %d, got %d", path, code, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"qwq/internal/config"
+	"qwq/internal/firewall"
+	"qwq/internal/logger"
+	"sort"
+	"strings"
+)
+
+// firewallRunner 执行防火墙命令，测试中替换
+var firewallRunner firewall.Runner = firewall.ExecRunner
+
+// FirewallRulesResponse 专用链规则接口返回
+type FirewallRulesResponse struct {
+	Chain   string               `json:"chain"`
+	Rules   []firewall.AllowRule `json:"rules"`
+	Changed bool                 `json:"changed"`
+}
+
+// firewallManager 专用链管理器
+func firewallManager() *firewall.Manager {
+	return firewall.NewManager(config.Current().Firewall.Chain, firewallRunner)
+}
+
+// collectListeners 汇总容器发布的端口和网站监听端口
+// 网站由 Nginx 统一监听 80/443，视为有意对外开放
+func collectListeners(ctx context.Context) []firewall.Listener {
+	public := make(map[int]bool)
+	for _, port := range config.Current().Firewall.PublicPorts {
+		public[port] = true
+	}
+
+	var listeners []firewall.Listener
+	if summaries, err := containerLister().ListContainers(ctx); err == nil {
+		for _, c := range summaries {
+			if c.State != "running" {
+				continue
+			}
+			for _, port := range c.Ports {
+				listeners = append(listeners, firewall.Listener{
+					Kind:       firewall.KindContainer,
+					Name:       c.Name,
+					Address:    port.HostIP,
+					Port:       port.HostPort,
+					Proto:      port.Proto,
+					TargetPort: port.ContainerPort,
+					Public:     public[port.HostPort],
+				})
+			}
+		}
+	} else {
+		logger.Info("获取容器端口失败: %v", err)
+	}
+
+	domains := make(map[int][]string)
+	sites, err := listWebsites()
+	if err != nil {
+		logger.Info("获取网站列表失败: %v", err)
+	}
+	for _, site := range sites {
+		if !site.Enabled {
+			continue
+		}
+		domains[80] = append(domains[80], site.Domain)
+		if site.SSLEnabled {
+			domains[443] = append(domains[443], site.Domain)
+		}
+	}
+	ports := make([]int, 0, len(domains))
+	for port := range domains {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	for _, port := range ports {
+		listeners = append(listeners, firewall.Listener{
+			Kind:   firewall.KindWebsite,
+			Name:   strings.Join(domains[port], ","),
+			Port:   port,
+			Proto:  "tcp",
+			Public: true,
+		})
+	}
+	return listeners
+}
+
+// BuildExposureReport 读取防火墙状态并生成端口暴露面报告，不依赖专用链管理是否开启
+func BuildExposureReport(ctx context.Context) (*firewall.Report, error) {
+	state, err := firewall.ReadState(ctx, firewallRunner)
+	if err != nil {
+		return nil, err
+	}
+	report := firewall.Analyze(state, collectListeners(ctx), firewallManager().Chain)
+	report.ManagementEnabled = config.Current().Firewall.Manage
+	return report, nil
+}
+
+// handleFirewallExposure 端口暴露面报告（只读）
+// GET /api/firewall/exposure
+func handleFirewallExposure(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	report, err := BuildExposureReport(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleFirewallRules 查看、添加或删除 qwq 专用链中的放行规则
+// 需要开启 firewall.manage；POST/DELETE 请求体为 {"port": 5432, "proto": "tcp", "cidr": "10.0.0.0/8"}，
+// 修改需要二次确认：首次请求返回 428 和将执行的命令，携带 X-Confirm-Token 重试后才生效
+func handleFirewallRules(w http.ResponseWriter, r *http.Request) {
+	if !config.Current().Firewall.Manage {
+		respondError(w, r, http.StatusForbidden, "Firewall management is disabled (firewall.manage)")
+		return
+	}
+	manager := firewallManager()
+	current, err := manager.Rules(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeFirewallRules(w, manager.Chain, current, false)
+	case http.MethodPost, http.MethodDelete:
+		var rule firewall.AllowRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		rule, err := rule.Normalize()
+		if err != nil {
+			writeError(w, r, invalidRequest(err))
+			return
+		}
+		remove := r.Method == http.MethodDelete
+		rules, changed := firewall.Plan(current, rule, remove)
+		if !changed {
+			writeFirewallRules(w, manager.Chain, current, false)
+			return
+		}
+
+		action := "firewall.allow"
+		if remove {
+			action = "firewall.revoke"
+		}
+		if !requireConfirmation(w, r, action, rule, manager.Commands(rules)) {
+			return
+		}
+		if err := manager.Apply(r.Context(), rules); err != nil {
+			logger.Info("[AUDIT] 🧱 防火墙规则修改失败: %s %d/%s from %s by %s: %v", action, rule.Port, rule.Proto, rule.CIDR, requestActor(r), err)
+			writeError(w, r, err)
+			return
+		}
+		logger.Info("[AUDIT] 🧱 防火墙规则已修改: %s %d/%s from %s by %s", action, rule.Port, rule.Proto, rule.CIDR, requestActor(r))
+		writeFirewallRules(w, manager.Chain, rules, true)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func writeFirewallRules(w http.ResponseWriter, chain string, rules []firewall.AllowRule, changed bool) {
+	if rules == nil {
+		rules = []firewall.AllowRule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FirewallRulesResponse{Chain: chain, Rules: rules, Changed: changed})
+}
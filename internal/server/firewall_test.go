@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/firewall"
+	"strings"
+	"testing"
+)
+
+type fakeLister []container.ContainerSummary
+
+func (f fakeLister) ListContainers(ctx context.Context) ([]container.ContainerSummary, error) {
+	return f, nil
+}
+
+// fakeFirewall 模拟 iptables：iptables-restore 的输入会反映到后续的 iptables-save 输出
+type fakeFirewall struct {
+	chain    string
+	commands []string
+}
+
+func (f *fakeFirewall) run(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	f.commands = append(f.commands, name+" "+strings.Join(args, " "))
+	switch name {
+	case "iptables-save":
+		return "*filter\n:INPUT DROP [0:0]\n:DOCKER-USER - [0:0]\n-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT\n" + f.chain + "COMMIT\n", nil
+	case "iptables-restore":
+		f.chain = strings.TrimSuffix(strings.TrimPrefix(stdin, "*filter\n"), "COMMIT\n")
+		return "", nil
+	case "iptables":
+		return "", nil
+	}
+	return "", errors.New("not installed")
+}
+
+func TestFirewallExposureAndRules(t *testing.T) {
+	savedConfig, savedRunner := config.Current(), firewallRunner
+	t.Cleanup(func() {
+		config.Store(savedConfig)
+		firewallRunner = savedRunner
+	})
+	fake := &fakeFirewall{}
+	firewallRunner = fake.run
+	config.Update(func(cfg *config.Config) { cfg.Firewall = config.FirewallConfig{} })
+
+	dockerListerOnce.Do(func() {})
+	savedLister := dockerLister
+	t.Cleanup(func() { dockerLister = savedLister })
+	dockerLister = fakeLister{{Name: "postgres", State: "running", Ports: []container.PublishedPort{
+		{HostIP: "0.0.0.0", HostPort: 5432, ContainerPort: 5432, Proto: "tcp"},
+	}}}
+
+	// 未开启管理时也能查看暴露面
+	rec := httptest.NewRecorder()
+	handleFirewallExposure(rec, httptest.NewRequest(http.MethodGet, "/api/firewall/exposure", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report firewall.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if report.ManagementEnabled || len(report.Warnings()) != 1 {
+		t.Errorf("Expected postgres to be reported as exposed, got %+v", report)
+	}
+
+	body := `{"port": 5432, "cidr": "10.0.0.0/8"}`
+	rec = httptest.NewRecorder()
+	handleFirewallRules(rec, httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 when management is disabled, got %d", rec.Code)
+	}
+
+	config.Update(func(cfg *config.Config) { cfg.Firewall.Manage = true })
+	rec = httptest.NewRecorder()
+	handleFirewallRules(rec, httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body)))
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("Expected 428 before confirmation, got %d", rec.Code)
+	}
+	var confirm ConfirmationRequired
+	json.Unmarshal(rec.Body.Bytes(), &confirm)
+	if confirm.Token == "" || !strings.Contains(rec.Body.String(), "QWQ-ALLOW") {
+		t.Fatalf("Expected token and command preview, got %s", rec.Body.String())
+	}
+	for _, command := range fake.commands {
+		if strings.HasPrefix(command, "iptables-restore") {
+			t.Fatal("Rules must not be applied before confirmation")
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/firewall/rules", bytes.NewBufferString(body))
+	req.Header.Set(ConfirmTokenHeader, confirm.Token)
+	rec = httptest.NewRecorder()
+	handleFirewallRules(rec, req)
+	var result FirewallRulesResponse
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if rec.Code != http.StatusOK || !result.Changed || len(result.Rules) != 1 {
+		t.Fatalf("Expected rule to be applied, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 令牌只能使用一次，规则已存在时不再需要确认
+	req = httptest.NewRequest(http.MethodPost, "/api/firewall/rules", bytes.NewBufferString(body))
+	req.Header.Set(ConfirmTokenHeader, confirm.Token)
+	rec = httptest.NewRecorder()
+	handleFirewallRules(rec, req)
+	result = FirewallRulesResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if rec.Code != http.StatusOK || result.Changed || len(result.Rules) != 1 {
+		t.Errorf("Expected idempotent no-op, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"qwq/internal/config"
+	"qwq/internal/health"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+	"qwq/internal/notify"
+	"qwq/internal/patrol"
+	"qwq/internal/utils"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHealthDropThreshold 相邻两次巡检评分下降超过该值时告警
+const DefaultHealthDropThreshold = 15
+
+// healthDrops 记录上一次巡检的评分，用于检测评分骤降
+var healthDrops health.DropDetector
+
+// HealthScoreResponse 健康评分接口返回
+type HealthScoreResponse struct {
+	*health.Report
+	Trend []monitor.SeriesPoint `json:"trend"` // 评分历史，用于绘制趋势图
+}
+
+// healthWeights 根据配置生成评分权重，全部未配置时使用默认权重
+func healthWeights() health.Weights {
+	cfg := config.Current().HealthScore
+	return health.Weights{
+		Incidents:    cfg.IncidentsWeight,
+		Resources:    cfg.ResourcesWeight,
+		Services:     cfg.ServicesWeight,
+		Certificates: cfg.CertificatesWeight,
+		Deployments:  cfg.DeploymentsWeight,
+		Patrol:       cfg.PatrolWeight,
+	}
+}
+
+// healthThresholds 根据配置生成资源和证书阈值
+func healthThresholds() health.Thresholds {
+	cfg := config.Current().HealthScore
+	return health.Thresholds{
+		CPU:          cfg.CPUThreshold,
+		Memory:       cfg.MemThreshold,
+		Disk:         cfg.DiskThreshold,
+		CertWarnDays: cfg.CertWarnDays,
+	}
+}
+
+// ComputeHealthScore 根据最近的巡检结果、监控数据、网站证书和部署记录计算健康评分
+func ComputeHealthScore() *health.Report {
+	return health.Score(collectHealthInputs(), healthWeights(), healthThresholds())
+}
+
+// collectHealthInputs 汇总健康评分的输入数据
+func collectHealthInputs() health.Inputs {
+	now := time.Now()
+	in := health.Inputs{Now: now, CPUPct: -1, MemPct: -1, DiskPct: -1}
+
+	// 最近一次巡检：未关闭的异常和失败的检查项
+	if runs := patrol.DefaultStore.List(1); len(runs) > 0 {
+		for _, result := range runs[0].Results {
+			if result.Verdict == patrol.VerdictSkipped {
+				continue
+			}
+			in.PatrolChecksTotal++
+			if result.Verdict != patrol.VerdictAlert && result.Verdict != patrol.VerdictTimeout {
+				continue
+			}
+			in.PatrolChecksFailed++
+			severity := health.SeverityWarning
+			if result.Critical() {
+				severity = health.SeverityCritical
+			}
+			for _, finding := range result.Findings {
+				in.Incidents = append(in.Incidents, health.Incident{Title: finding.Title, Severity: severity})
+			}
+		}
+	}
+
+	// 最新的监控数据点：资源使用率和服务检查
+	statsCache.RLock()
+	var point *StatsPoint
+	if n := len(statsCache.History); n > 0 {
+		latest := statsCache.History[n-1]
+		point = &latest
+	}
+	statsCache.RUnlock()
+	if point == nil {
+		collected := collectOnePoint()
+		point = &collected
+	}
+	values := statsPointValues(*point)
+	if load, ok := values[monitor.MetricLoad]; ok {
+		in.CPUPct = load / float64(runtime.NumCPU()) * 100
+	}
+	if mem, ok := values[monitor.MetricMemPct]; ok && point.MemTotal != "0" {
+		in.MemPct = mem
+	}
+	if disk, ok := values[monitor.MetricDiskPct]; ok {
+		in.DiskPct = disk
+	}
+	if checks, ok := point.Services.([]monitor.CheckResult); ok {
+		for _, check := range checks {
+			// 尚未执行过的检查不参与评分
+			if check.CheckedAt.IsZero() {
+				continue
+			}
+			in.Services = append(in.Services, health.ServiceCheck{Name: check.Name, Healthy: check.Success})
+		}
+	}
+
+	// 启用 SSL 的网站证书
+	sites, _ := listWebsites()
+	for _, site := range sites {
+		if !site.SSLEnabled || site.SSLCertExpiry == "" {
+			continue
+		}
+		if expiry, err := time.Parse(time.RFC3339, site.SSLCertExpiry); err == nil {
+			in.Certificates = append(in.Certificates, health.Certificate{Name: site.Domain, ExpiresAt: expiry})
+		}
+	}
+
+	in.DeploymentsTotal, in.DeploymentsFailed = health.DefaultDeployments.Counts(now)
+	return in
+}
+
+// RecordHealthScore 巡检结束后计算并记录健康评分
+// 评分写入指标历史用于趋势展示；与上一次巡检相比下降超过阈值时推送告警
+func RecordHealthScore() *health.Report {
+	report := ComputeHealthScore()
+	monitor.DefaultHistory.Add(report.ComputedAt, map[string]float64{monitor.MetricHealthScore: float64(report.Score)})
+
+	threshold := config.Current().HealthScore.DropThreshold
+	if threshold == 0 {
+		threshold = DefaultHealthDropThreshold
+	}
+	if previous, dropped := healthDrops.Observe(report.Score, threshold); dropped {
+		logger.Info("📉 健康评分下降: %d -> %d", previous, report.Score)
+		msg := fmt.Sprintf("📉 **健康评分下降** [%s]\n\n评分 %d → %d（下降 %d 分，阈值 %d）\n\n%s",
+			utils.GetHostname(), previous, report.Score, previous-report.Score, threshold, formatDeductions(report))
+		notify.SendEvent(notify.Event{
+			Severity: notify.SeverityWarning,
+			Category: "health",
+			Host:     utils.GetHostname(),
+			Title:    "健康评分下降",
+			Content:  msg,
+		})
+	}
+	return report
+}
+
+// HealthTrend 返回最近 window 内的健康评分趋势摘要
+func HealthTrend(window time.Duration) (*monitor.Series, error) {
+	now := time.Now()
+	return monitor.DefaultHistory.Query(monitor.MetricHealthScore, now.Add(-window), now, monitor.DefaultQueryBuckets, monitor.AggAvg)
+}
+
+// formatDeductions 将扣分明细渲染为 Markdown 列表
+func formatDeductions(report *health.Report) string {
+	if len(report.Breakdown) == 0 {
+		return "无扣分项"
+	}
+	var builder strings.Builder
+	for _, d := range report.Breakdown {
+		builder.WriteString(fmt.Sprintf("- -%.1f %s\n", d.Points, d.Reason))
+	}
+	return builder.String()
+}
+
+// handleHealthScore 获取主机健康评分、扣分明细和评分趋势
+// GET /api/health/score?hours=24，hours 最大 168
+func handleHealthScore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	hours, _ := strconv.Atoi(r.URL.Query().Get("hours"))
+	if hours <= 0 {
+		hours = 24
+	}
+	if hours > 168 {
+		hours = 168
+	}
+
+	response := HealthScoreResponse{Report: ComputeHealthScore(), Trend: []monitor.SeriesPoint{}}
+	if series, err := HealthTrend(time.Duration(hours) * time.Hour); err == nil {
+		response.Trend = series.Points
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/hostaudit"
+	"qwq/internal/logger"
+)
+
+// PermissionHostAuditAccept 接受主机账号当前状态为新基线的权限
+const PermissionHostAuditAccept = "hostaudit:accept"
+
+// hostAuditor 主机账号审计器，测试中替换
+var hostAuditor = hostaudit.Default
+
+// handleHostAudit 主机账号审计 GET /api/host-audit，返回基线、当前快照和差异；尚无基线时以当前状态建立基线
+func handleHostAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	report, err := hostAuditor.Check()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": hostaudit.Enabled(),
+		"report":  report,
+	})
+}
+
+// handleHostAuditAccept 接受当前账号状态为新基线 POST /api/host-audit/accept，合法的用户或公钥变更后由运维确认
+func handleHostAuditAccept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !requestPermissions(r)(PermissionHostAuditAccept) {
+		logger.Info("[AUDIT] 🚨 无权限接受主机账号基线 by %s", requestActor(r))
+		respondError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	baseline, err := hostAuditor.Accept(requestActor(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"baseline": baseline})
+}
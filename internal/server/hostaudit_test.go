@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/hostaudit"
+	"testing"
+)
+
+func TestHandleHostAuditAccept(t *testing.T) {
+	saved, savedAuditor := config.Current(), hostAuditor
+	t.Cleanup(func() {
+		config.Store(saved)
+		hostAuditor = savedAuditor
+	})
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "etc"), 0755)
+	os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("root:x:0:0:root:/root:/bin/bash\n"), 0644)
+	hostAuditor = hostaudit.NewAuditor("", root)
+
+	get := func() hostaudit.Report {
+		rec := httptest.NewRecorder()
+		handleHostAudit(rec, httptest.NewRequest(http.MethodGet, "/api/host-audit", nil))
+		var resp struct {
+			Report hostaudit.Report `json:"report"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		return resp.Report
+	}
+	if report := get(); !report.Baselined {
+		t.Fatalf("Expected the first request to establish a baseline, got %+v", report)
+	}
+	os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("root:x:0:0:root:/root:/bin/bash\ntoor:x:0:0::/root:/bin/sh\n"), 0644)
+	if report := get(); len(report.Changes) != 1 || report.Changes[0].Kind != hostaudit.ChangeUserAdded {
+		t.Fatalf("Expected the new uid 0 user to be reported, got %+v", report.Changes)
+	}
+
+	post := func(admin bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/host-audit/accept", nil)
+		if admin {
+			req.SetBasicAuth("admin", "secret")
+		}
+		rec := httptest.NewRecorder()
+		handleHostAuditAccept(rec, req)
+		return rec.Code
+	}
+	if code := post(false); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for non-admin, got %d", code)
+	}
+	if code := post(true); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if report := get(); len(report.Changes) != 0 {
+		t.Errorf("Accepted state should be the new baseline, got %+v", report.Changes)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"qwq/internal/incident"
+	"qwq/internal/logger"
+	"strconv"
+	"strings"
+)
+
+// PermissionIncidentExport 导出事件复盘包的权限，复盘包包含对话、命令输出和审计日志
+const PermissionIncidentExport = "incident:export"
+
+// bundleBufferLimit 复盘包小于该大小时整体缓冲后返回（带 Content-Length，出错时能返回错误码），
+// 超过后改为边生成边发送，避免大包占用内存
+const bundleBufferLimit = 4 << 20
+
+// handleIncidentBundle 下载巡检事件复盘包 GET /api/incidents/{id}/bundle
+func handleIncidentBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/api/incidents/")
+	idStr, ok := strings.CutSuffix(rest, "/bundle")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid incident ID")
+		return
+	}
+
+	if !requestPermissions(r)(PermissionIncidentExport) {
+		logger.Info("[AUDIT] 🚨 无权限导出事件复盘包: #%d by %s", id, requestActor(r))
+		respondError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	filename := fmt.Sprintf("incident-%d.zip", id)
+	out := &spoolWriter{w: w, limit: bundleBufferLimit, header: func(h http.Header) {
+		h.Set("Content-Type", "application/zip")
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}}
+	if err := incident.NewBundle().Write(out, id); err != nil {
+		if out.streaming {
+			// 响应头已发送，只能中断连接，客户端会收到不完整的 zip
+			logger.Info("❌ 事件复盘包生成中断: #%d: %v", id, err)
+			panic(http.ErrAbortHandler)
+		}
+		writeError(w, r, err)
+		return
+	}
+	if err := out.Close(); err != nil {
+		logger.Info("❌ 事件复盘包发送失败: #%d: %v", id, err)
+		return
+	}
+	logger.Info("[AUDIT] 📦 事件复盘包已导出: #%d (%d bytes) by %s", id, out.written, requestActor(r))
+}
+
+// spoolWriter 在内存中缓冲不超过 limit 的内容，超出后发送响应头并转为直接写入响应
+type spoolWriter struct {
+	w         http.ResponseWriter
+	limit     int
+	header    func(http.Header)
+	buf       bytes.Buffer
+	streaming bool
+	written   int64
+}
+
+func (s *spoolWriter) Write(p []byte) (int, error) {
+	s.written += int64(len(p))
+	if !s.streaming && s.buf.Len()+len(p) <= s.limit {
+		return s.buf.Write(p)
+	}
+	if !s.streaming {
+		s.streaming = true
+		s.header(s.w.Header())
+		s.w.WriteHeader(http.StatusOK)
+		if _, err := s.w.Write(s.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		s.buf = bytes.Buffer{}
+	}
+	return s.w.Write(p)
+}
+
+// Close 未超出缓冲上限时一次性发送全部内容
+func (s *spoolWriter) Close() error {
+	if s.streaming {
+		return nil
+	}
+	s.header(s.w.Header())
+	s.w.Header().Set("Content-Length", strconv.Itoa(s.buf.Len()))
+	s.w.WriteHeader(http.StatusOK)
+	_, err := s.w.Write(s.buf.Bytes())
+	return err
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/patrol"
+	"testing"
+	"time"
+)
+
+func TestHandleIncidentBundle(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+
+	run := &patrol.Run{Trigger: "test", StartedAt: time.Now(), FinishedAt: time.Now(), Anomalies: 1}
+	patrol.DefaultStore.Save(run)
+	path := fmt.Sprintf("/api/incidents/%d/bundle", run.ID)
+
+	rec := httptest.NewRecorder()
+	handleIncidentBundle(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 for non-admin, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handleIncidentBundle(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" || rec.Header().Get("Content-Length") == "" {
+		t.Fatalf("Expected buffered zip, got %d %v", rec.Code, rec.Header())
+	}
+	if !bytes.HasPrefix(rec.Body.Bytes(), []byte("PK")) {
+		t.Error("Expected zip content")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/incidents/999999/bundle", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handleIncidentBundle(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown incident, got %d", rec.Code)
+	}
+}
+
+func TestSpoolWriter_StreamsPastLimit(t *testing.T) {
+	rec := httptest.NewRecorder()
+	out := &spoolWriter{w: rec, limit: 4, header: func(h http.Header) { h.Set("Content-Type", "application/zip") }}
+	out.Write([]byte("abc"))
+	if out.streaming || rec.Body.Len() != 0 {
+		t.Fatal("Expected content below the limit to be buffered")
+	}
+	out.Write([]byte("defg"))
+	if !out.streaming || rec.Body.String() != "abcdefg" {
+		t.Fatalf("Expected streaming after the limit, got %q", rec.Body.String())
+	}
+	out.Close()
+	if rec.Header().Get("Content-Length") != "" {
+		t.Error("Streamed response must not set Content-Length")
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/jobs"
+	"qwq/internal/logger"
+	"strings"
+)
+
+// PermissionJobsManage 手动执行、暂停和恢复定时任务的权限
+const PermissionJobsManage = "jobs:manage"
+
+// 任务列表和单个任务附带的最近执行记录条数
+const (
+	jobListHistory   = 10
+	jobDetailHistory = 50
+)
+
+// handleJobs 列出定时任务的下次/最近执行时间和最近执行记录 GET /api/jobs
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	scheduler := jobs.Default()
+	if scheduler == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Job scheduler not running")
+		return
+	}
+	statuses, err := scheduler.List(r.Context(), jobListHistory)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// handleJob 单个定时任务
+// GET /api/jobs/{name} 返回状态和执行记录；POST /api/jobs/{name}/run 手动执行；
+// POST /api/jobs/{name}/pause 暂停定时执行；POST /api/jobs/{name}/resume 恢复
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	scheduler := jobs.Default()
+	if scheduler == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Job scheduler not running")
+		return
+	}
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		status, err := scheduler.Get(r.Context(), name, jobDetailHistory)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !requestPermissions(r)(PermissionJobsManage) {
+		logger.Info("[AUDIT] 🚨 无权限操作定时任务: %s %s by %s", action, name, requestActor(r))
+		respondError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var err error
+	switch action {
+	case "run":
+		err = scheduler.Trigger(name)
+	case "pause":
+		err = scheduler.Pause(r.Context(), name, requestUser(r))
+	case "resume":
+		err = scheduler.Resume(r.Context(), name)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	logger.Info("[AUDIT] 📅 定时任务 %s: %s by %s", action, name, requestActor(r))
+
+	status, err := scheduler.Get(r.Context(), name, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if action == "run" {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(status)
+}
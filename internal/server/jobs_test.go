@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/jobs"
+	"testing"
+	"time"
+)
+
+func TestHandleJobs(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		jobs.SetDefault(nil)
+	})
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+
+	jobs.SetDefault(nil)
+	rec := httptest.NewRecorder()
+	handleJobs(rec, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 without a scheduler, got %d", rec.Code)
+	}
+
+	scheduler := jobs.NewScheduler(nil)
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	scheduler.Register(jobs.Job{Name: "report", Interval: time.Hour, Handler: func(ctx context.Context) error {
+		<-block
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	scheduler.Start(ctx)
+	jobs.SetDefault(scheduler)
+
+	rec = httptest.NewRecorder()
+	handleJobs(rec, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+	var statuses []*jobs.Status
+	json.NewDecoder(rec.Body).Decode(&statuses)
+	if rec.Code != http.StatusOK || len(statuses) != 1 || statuses[0].Name != "report" {
+		t.Fatalf("Expected job list, got %d %+v", rec.Code, statuses)
+	}
+
+	post := func(path string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if admin {
+			req.SetBasicAuth("admin", "secret")
+		}
+		rec := httptest.NewRecorder()
+		handleJob(rec, req)
+		return rec
+	}
+
+	if rec := post("/api/jobs/report/run", false); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for non-admin, got %d", rec.Code)
+	}
+	if rec := post("/api/jobs/missing/run", true); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown job, got %d", rec.Code)
+	}
+	if rec := post("/api/jobs/report/run", true); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", rec.Code)
+	}
+	// 第一次触发正在执行，第二次排队，第三次冲突
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if status, _ := scheduler.Get(ctx, "report", 0); status.Running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	post("/api/jobs/report/run", true)
+	if rec := post("/api/jobs/report/run", true); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while a run is queued, got %d", rec.Code)
+	}
+
+	rec = post("/api/jobs/report/pause", true)
+	var status jobs.Status
+	json.NewDecoder(rec.Body).Decode(&status)
+	if rec.Code != http.StatusOK || !status.Paused || status.PausedBy != "admin" {
+		t.Errorf("Expected paused job, got %d %+v", rec.Code, status)
+	}
+	if rec := post("/api/jobs/report/resume", true); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 on resume, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"qwq/internal/apierror"
+	"qwq/internal/logger"
+	"strconv"
+)
+
+// handleLogFiles 列出可下载的日志文件
+// GET /api/logs/files
+func handleLogFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	files, err := logger.ListFiles()
+	if err != nil {
+		writeError(w, r, apierror.Wrap(http.StatusServiceUnavailable, apierror.CodeUnavailable, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// handleLogDownload 下载日志文件
+// GET /api/logs/download?file=xxx，仅允许日志目录中的日志文件；
+// 未压缩的轮转文件在传输时即时 gzip 压缩
+func handleLogDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := r.URL.Query().Get("file")
+	file, err := logger.ResolveFile(name)
+	if err != nil {
+		if errors.Is(err, logger.ErrInvalidLogFile) {
+			logger.Info("[AUDIT] 🚨 非法日志下载尝试: %q by %s", name, requestActor(r))
+			respondError(w, r, http.StatusNotFound, "Log file not found")
+			return
+		}
+		writeError(w, r, apierror.Wrap(http.StatusServiceUnavailable, apierror.CodeUnavailable, err))
+		return
+	}
+
+	f, err := os.Open(file.Path())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "Failed to open log file")
+		return
+	}
+	defer f.Close()
+
+	logger.Info("[AUDIT] 📥 日志已下载: %s by %s", file.Name, requestActor(r))
+
+	switch {
+	case file.Rotated && !file.Compressed:
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", contentDisposition(file.Name+".gz"))
+		gz := gzip.NewWriter(w)
+		io.Copy(gz, f)
+		gz.Close()
+	case file.Compressed:
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", contentDisposition(file.Name))
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+		io.Copy(w, f)
+	default:
+		// 当前日志仍在写入，只发送打开时已有的内容
+		info, err := f.Stat()
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, "Failed to stat log file")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", contentDisposition(file.Name))
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		io.CopyN(w, f, info.Size())
+	}
+}
+
+// contentDisposition 生成附件下载头
+func contentDisposition(filename string) string {
+	return fmt.Sprintf("attachment; filename=%q", filename)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/logger"
+	"testing"
+)
+
+func TestHandleLogDownload(t *testing.T) {
+	dir := t.TempDir()
+	logger.InitWithRetention(filepath.Join(dir, "qwq.log"), false, logger.RetentionPolicy{Compress: false})
+	defer logger.Close()
+
+	rotated := "qwq-2024-05-02T12-00-00.000.log"
+	if err := os.WriteFile(filepath.Join(dir, rotated), []byte("old line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+
+	rec := httptest.NewRecorder()
+	handleLogDownload(rec, httptest.NewRequest(http.MethodGet, "/api/logs/download?file="+rotated, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="`+rotated+`.gz"` {
+		t.Errorf("Unexpected Content-Disposition %q", got)
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip body: %v", err)
+	}
+	if data, _ := io.ReadAll(gz); string(data) != "old line\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	for _, name := range []string{"secret.txt", "../qwq.log", "/etc/passwd"} {
+		rec = httptest.NewRecorder()
+		handleLogDownload(rec, httptest.NewRequest(http.MethodGet, "/api/logs/download?file="+name, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %q, got %d", name, rec.Code)
+		}
+	}
+}
+
+func TestHandleLogs_Query(t *testing.T) {
+	logger.InitWithRetention(filepath.Join(t.TempDir(), "qwq.log"), false, logger.RetentionPolicy{})
+	logger.Info("巡检完成")
+	logger.Info("⚠️ 磁盘使用率 91%%")
+	logger.Close()
+
+	rec := httptest.NewRecorder()
+	handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs?since=1700000000&level=warn", nil))
+	var body struct {
+		Entries []logger.Entry `json:"entries"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || len(body.Entries) != 1 || body.Entries[0].Message != "⚠️ 磁盘使用率 91%" || body.Entries[0].Source != "server" {
+		t.Fatalf("Expected only the warning, got %d %+v", rec.Code, body.Entries)
+	}
+
+	// 不带参数时仍返回内存中的日志行
+	rec = httptest.NewRecorder()
+	handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs", nil))
+	var lines []string
+	if err := json.NewDecoder(rec.Body).Decode(&lines); err != nil || len(lines) == 0 {
+		t.Errorf("Expected the in-memory buffer, got %v", err)
+	}
+
+	for _, query := range []string{"level=fatal", "since=yesterday", "limit=-5"} {
+		rec := httptest.NewRecorder()
+		handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"qwq/internal/maintenance"
+	"strconv"
+	"time"
+)
+
+// MaintenanceRequest 创建维护窗口的请求，end 和 duration 二选一
+type MaintenanceRequest struct {
+	Start      *time.Time `json:"start"`
+	End        *time.Time `json:"end"`
+	Duration   string     `json:"duration"` // Go duration，如 2h、30m
+	Hosts      []string   `json:"hosts"`
+	Categories []string   `json:"categories"`
+	Targets    []string   `json:"targets"`
+	Reason     string     `json:"reason"`
+}
+
+// MaintenanceResponse 维护窗口接口返回
+type MaintenanceResponse struct {
+	Active  []*maintenance.Window `json:"active"`
+	Windows []*maintenance.Window `json:"windows"`
+}
+
+// handleMaintenance 维护窗口：GET 返回生效中和最近的窗口；POST 创建窗口；DELETE ?id= 提前结束窗口并发送静默摘要
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	manager := maintenance.Default()
+	if manager == nil {
+		respondError(w, r, http.StatusServiceUnavailable, "Maintenance windows not available")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req MaintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		window, err := req.window(time.Now())
+		if err != nil {
+			writeError(w, r, invalidRequest(err))
+			return
+		}
+		window.CreatedBy = requestUser(r)
+		if err := manager.Create(r.Context(), window); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, "Invalid window id")
+			return
+		}
+		if _, err := manager.End(r.Context(), uint(id), requestUser(r)); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	active, err := manager.Active(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	windows, err := manager.List(r.Context(), 20)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MaintenanceResponse{Active: active, Windows: windows})
+}
+
+// window 将请求转换为维护窗口，开始时间默认为当前时间
+func (req MaintenanceRequest) window(now time.Time) (*maintenance.Window, error) {
+	window := &maintenance.Window{
+		StartsAt:   now,
+		Hosts:      req.Hosts,
+		Categories: req.Categories,
+		Targets:    req.Targets,
+		Reason:     req.Reason,
+	}
+	if req.Start != nil {
+		window.StartsAt = *req.Start
+	}
+	switch {
+	case req.End != nil && req.Duration != "":
+		return nil, errors.New("specify either end or duration, not both")
+	case req.End != nil:
+		window.EndsAt = *req.End
+	case req.Duration != "":
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			return nil, errors.New("invalid duration, use a value such as 2h or 30m")
+		}
+		window.EndsAt = window.StartsAt.Add(duration)
+	default:
+		return nil, errors.New("end or duration is required")
+	}
+	return window, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/maintenance"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func TestHandleMaintenance(t *testing.T) {
+	t.Cleanup(func() { maintenance.SetDefault(nil) })
+
+	maintenance.SetDefault(nil)
+	rec := httptest.NewRecorder()
+	handleMaintenance(rec, httptest.NewRequest(http.MethodGet, "/api/maintenance", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 without a manager, got %d", rec.Code)
+	}
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&maintenance.Window{}, &maintenance.SuppressedEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	maintenance.SetDefault(maintenance.NewManager(db))
+
+	post := func(body string) (*httptest.ResponseRecorder, MaintenanceResponse) {
+		rec := httptest.NewRecorder()
+		handleMaintenance(rec, httptest.NewRequest(http.MethodPost, "/api/maintenance", strings.NewReader(body)))
+		var resp MaintenanceResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	for _, body := range []string{`{"reason":"no end"}`, `{"duration":"soon"}`, `{"duration":"1h","end":"2030-01-01T00:00:00Z"}`, `{"end":"2001-01-01T00:00:00Z"}`} {
+		if rec, _ := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	rec, resp := post(`{"duration":"2h","categories":["disk"],"reason":"db upgrade"}`)
+	if rec.Code != http.StatusOK || len(resp.Active) != 1 || resp.Active[0].Reason != "db upgrade" {
+		t.Fatalf("Expected active window, got %d %+v", rec.Code, resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handleMaintenance(rec, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/maintenance?id=%d", resp.Active[0].ID), nil))
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || len(resp.Active) != 0 || len(resp.Windows) != 1 || resp.Windows[0].ClosedAt == nil {
+		t.Errorf("Expected window to be ended, got %d %+v", rec.Code, resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handleMaintenance(rec, httptest.NewRequest(http.MethodDelete, "/api/maintenance?id=404", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown window, got %d", rec.Code)
+	}
+}
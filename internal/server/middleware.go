@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/utils"
+	"runtime/debug"
+)
+
+// requestIDHeader 请求 ID 头，客户端传入时沿用，否则自动生成
+const requestIDHeader = apierror.RequestIDHeader
+
+// recoverMiddleware 捕获处理器中的 panic，避免单个请求导致整个守护进程退出
+// 记录堆栈、累加 panic 指标，并返回带请求 ID 的 INTERNAL 错误响应
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = apierror.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		rw := &trackingResponseWriter{ResponseWriter: w}
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v) // 由 net/http 处理的主动中断
+				}
+				utils.RecordPanic("http "+r.Method+" "+r.URL.Path+" ["+requestID+"]", v, debug.Stack())
+				if rw.wroteHeader || rw.hijacked {
+					return // 响应已部分写出，无法再返回错误
+				}
+				apierror.Respond(w, r, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// trackingResponseWriter 记录响应头是否已写出
+// 实现 Hijacker 和 Flusher，保证 WebSocket 和流式响应正常工作
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (w *trackingResponseWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *trackingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (w *trackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
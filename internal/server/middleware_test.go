@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/realip"
+	"testing"
+)
+
+func TestRecoverMiddleware_KeepsServingAfterPanic(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("handler bug")
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	srv := httptest.NewServer(recoverMiddleware(mux))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/panic", nil)
+	req.Header.Set(requestIDHeader, "req-123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", resp.StatusCode)
+	}
+	if body["request_id"] != "req-123" || resp.Header.Get(requestIDHeader) != "req-123" {
+		t.Errorf("Expected request ID in response, got %v", body)
+	}
+
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Server should keep serving after panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get(requestIDHeader) == "" {
+		t.Error("Expected generated request ID")
+	}
+}
+
+func TestRequestUser_BehindTrustedProxy(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.TrustedProxies = []string{"127.0.0.1"} })
+
+	var user, actor string
+	handler := realip.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, actor = requestUser(r), requestActor(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if user != "198.51.100.7" {
+		t.Errorf("Expected rate-limit key to be the real client, got %s", user)
+	}
+
+	req.SetBasicAuth("admin", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if user != "admin" || actor != "admin (198.51.100.7)" {
+		t.Errorf("Expected audit actor with client address, got %s / %s", user, actor)
+	}
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/notify"
+)
+
+// handleNotificationHistory 返回最近的通知投递记录（最新的在前），包括每个渠道的尝试次数和失败原因
+func handleNotificationHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"records": notify.DefaultDeliveryLog.Recent()})
+}
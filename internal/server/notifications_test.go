@@ -0,0 +1,36 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/notify"
+	"testing"
+	"time"
+)
+
+func TestHandleNotificationHistory(t *testing.T) {
+	saved := notify.DefaultDeliveryLog
+	t.Cleanup(func() { notify.DefaultDeliveryLog = saved })
+	notify.DefaultDeliveryLog = notify.NewDeliveryLog("")
+	notify.DefaultDeliveryLog.Add(notify.DeliveryRecord{Channel: "ops", Title: "磁盘告警", Time: time.Now(), Attempts: 1, Status: notify.DeliverySent})
+	notify.DefaultDeliveryLog.Add(notify.DeliveryRecord{Channel: "oncall", Title: "磁盘告警", Time: time.Now(), Attempts: 3, Status: notify.DeliveryFailed, Error: "telegram returned 502 Bad Gateway"})
+
+	rec := httptest.NewRecorder()
+	handleNotificationHistory(rec, httptest.NewRequest(http.MethodGet, "/api/notifications/history", nil))
+	var resp struct {
+		Records []notify.DeliveryRecord `json:"records"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Records) != 2 {
+		t.Fatalf("Expected two records, got %d %s", rec.Code, rec.Body.String())
+	}
+	if r := resp.Records[0]; r.Channel != "oncall" || r.Attempts != 3 || r.Status != notify.DeliveryFailed || r.Error == "" {
+		t.Errorf("Expected the newest failed delivery first, got %+v", r)
+	}
+
+	rec = httptest.NewRecorder()
+	handleNotificationHistory(rec, httptest.NewRequest(http.MethodPost, "/api/notifications/history", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/patrol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PatrolRunSummary 巡检记录摘要，用于列表展示
+type PatrolRunSummary struct {
+	ID         int64                     `json:"id"`
+	Trigger    string                    `json:"trigger"`
+	StartedAt  time.Time                 `json:"started_at"`
+	FinishedAt time.Time                 `json:"finished_at"`
+	Anomalies  int                       `json:"anomalies"`
+	Notified   bool                      `json:"notified"`
+	Verdicts   map[string]patrol.Verdict `json:"verdicts"`           // 检查项 -> 结论
+	Findings   []string                  `json:"findings,omitempty"` // 告警的异常标题，如 "disk: 磁盘告警 (/dev/sda1)"
+}
+
+// PatrolRunSummaries 最近的巡检记录摘要，最新的在前；limit <= 0 时返回全部
+func PatrolRunSummaries(limit int) []PatrolRunSummary {
+	runs := patrol.DefaultStore.List(limit)
+	summaries := make([]PatrolRunSummary, 0, len(runs))
+	for _, run := range runs {
+		summary := PatrolRunSummary{
+			ID:         run.ID,
+			Trigger:    run.Trigger,
+			StartedAt:  run.StartedAt,
+			FinishedAt: run.FinishedAt,
+			Anomalies:  run.Anomalies,
+			Notified:   run.Notified,
+			Verdicts:   make(map[string]patrol.Verdict, len(run.Results)),
+		}
+		for _, result := range run.Results {
+			summary.Verdicts[result.Check] = result.Verdict
+			if result.Verdict != patrol.VerdictAlert {
+				continue
+			}
+			for _, finding := range result.Findings {
+				summary.Findings = append(summary.Findings, result.Check+": "+finding.Title)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// handlePatrolRuns 列出最近的巡检记录
+// 支持 ?limit=N 限制返回数量
+func handlePatrolRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	summaries := PatrolRunSummaries(limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// handlePatrolRunDetail 获取单次巡检的完整结果和决策追踪
+// ?format=text 返回纯文本追踪，可直接附加到事件记录中
+func handlePatrolRunDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/patrol/runs/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid patrol run ID")
+		return
+	}
+
+	run, ok := patrol.DefaultStore.Get(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "Patrol run not found")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(run.FormatTrace()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/security"
+)
+
+// AutoExecPolicyResponse 自动执行策略接口返回
+type AutoExecPolicyResponse struct {
+	Builtin bool                  `json:"builtin"` // 是否为内置默认策略
+	Default security.Action       `json:"default"`
+	Rules   []config.AutoExecRule `json:"rules"`
+	Tests   []config.AutoExecCase `json:"tests"`
+}
+
+// handleAutoExecPolicy 查看或替换对话中命令自动执行策略
+// GET 返回当前策略；PUT 提交完整策略，规则无效返回 400，测试用例未通过返回 422 和失败列表
+// 修改只对当前进程生效，需要持久化时请同步修改配置文件的 autoexec 字段
+func handleAutoExecPolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAutoExecPolicy(w)
+	case http.MethodPut:
+		var cfg config.AutoExecConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		policy, failures, err := security.ValidateAutoExecConfig(cfg)
+		if err != nil {
+			writeError(w, r, invalidRequest(err))
+			return
+		}
+		if len(failures) > 0 {
+			writeError(w, r, errPolicyTests.WithDetails(map[string]interface{}{"failures": failures}))
+			return
+		}
+
+		security.SetAutoExecPolicy(policy)
+		config.Update(func(c *config.Config) { c.AutoExec = cfg })
+		logger.Info("[AUDIT] ⚙️ 自动执行策略已更新: %d 条规则, 默认 %s by %s", len(policy.Rules()), policy.Default(), requestActor(r))
+		writeAutoExecPolicy(w)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func writeAutoExecPolicy(w http.ResponseWriter) {
+	policy := security.CurrentAutoExecPolicy()
+	response := AutoExecPolicyResponse{
+		Builtin: policy.Builtin(),
+		Default: policy.Default(),
+		Rules:   policy.Rules(),
+		Tests:   config.Current().AutoExec.Tests,
+	}
+	if response.Tests == nil {
+		response.Tests = []config.AutoExecCase{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
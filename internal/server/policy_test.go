@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"qwq/internal/security"
+	"strings"
+	"testing"
+)
+
+func TestAutoExecPolicyAPI(t *testing.T) {
+	savedConfig := config.Current()
+	savedPolicy := security.CurrentAutoExecPolicy()
+	t.Cleanup(func() {
+		config.Store(savedConfig)
+		security.SetAutoExecPolicy(savedPolicy)
+	})
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleAutoExecPolicy(rec, httptest.NewRequest(http.MethodPut, "/api/policy/autoexec", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := put(`{"rules":[{"match":"regex","pattern":"(","action":"auto"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid regex, got %d", rec.Code)
+	}
+	rec := put(`{"rules":[{"match":"prefix","pattern":"journalctl","action":"auto"}],"tests":[{"command":"ls","expect":"auto"}]}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"got":"confirm"`) {
+		t.Errorf("Expected 422 with failures, got %d %s", rec.Code, rec.Body.String())
+	}
+	if security.EvaluateAutoExec("journalctl -u nginx").Action == security.ActionAuto {
+		t.Fatal("Rejected policy must not be applied")
+	}
+
+	rec = put(`{"rules":[{"name":"journal","match":"prefix","pattern":"journalctl","action":"auto"}],"tests":[{"command":"journalctl -u nginx","expect":"auto"}]}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"builtin":false`) {
+		t.Fatalf("Expected policy to be applied, got %d %s", rec.Code, rec.Body.String())
+	}
+	if decision := security.EvaluateAutoExec("journalctl -u nginx"); decision.Action != security.ActionAuto || decision.Rule != "journal" {
+		t.Errorf("Unexpected decision %+v", decision)
+	}
+}
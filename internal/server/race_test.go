@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qwq/internal/agent"
+	"qwq/internal/config"
+	"qwq/internal/hostaudit"
+	"qwq/internal/patrol"
+	"qwq/internal/utils"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentPatrolRequestsAndReload 巡检、Web 请求和配置热加载并发执行，配合 go test -race 检查数据竞争
+func TestConcurrentPatrolRequestsAndReload(t *testing.T) {
+	saved, savedStartup, savedAuditor := config.Current(), config.GlobalConfig, hostaudit.Default
+	t.Cleanup(func() {
+		config.Store(saved)
+		config.GlobalConfig = savedStartup
+		hostaudit.Default = savedAuditor
+		agent.InitClient()
+	})
+
+	dir := t.TempDir()
+	// 巡检包含账号审计，基线写入临时目录而不是当前目录
+	hostaudit.Default = hostaudit.NewAuditor(filepath.Join(dir, "qwq_host_audit.json"), "/")
+	path := filepath.Join(dir, "qwq.json")
+	write := func(rate int) {
+		body := fmt.Sprintf(`{"base_url":"http://127.0.0.1:1/v1","ai_limits":{"global_burst":%d},"patrol":{"clock":{"disabled":true}}}`, rate)
+		if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(10)
+	config.GlobalConfig = config.Config{OverridesFile: filepath.Join(dir, "qwq.overrides.json")}
+	if err := config.Init(path); err != nil {
+		t.Fatal(err)
+	}
+	agent.InitClient()
+
+	shell := func(cmd string) *utils.ShellResult { return &utils.ShellResult{Command: cmd} }
+	handlers := []http.HandlerFunc{handleDynamicConfig, handleAIStatus, handleAutoExecPolicy, handleHealthScore}
+
+	var wg sync.WaitGroup
+	const rounds = 20
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			patrol.NewRunner(patrol.DefaultChecks(shell)).Run(context.Background(), "test")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			for _, handler := range handlers {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+				}
+			}
+			chatPermissions("admin")(PermissionIncidentExport)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			write(10 + i)
+			if err := config.ReloadAILimits(); err != nil {
+				t.Errorf("ReloadAILimits: %v", err)
+			}
+			agent.InitClient()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			version := config.Dynamic().Version
+			body := fmt.Sprintf(`{"version":%d,"patrol_rules":[{"name":"r%d","command":"true"}]}`, version, i)
+			rec := httptest.NewRecorder()
+			handleDynamicConfig(rec, httptest.NewRequest(http.MethodPut, "/api/config/dynamic", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Errorf("PUT failed: %d %s", rec.Code, rec.Body.String())
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got := config.Current().AILimits.GlobalBurst; got != 10+rounds-1 {
+		t.Errorf("Expected last reload to win, got global_burst=%d", got)
+	}
+	if rules := config.Current().PatrolRules; len(rules) != 1 || rules[0].Name != fmt.Sprintf("r%d", rounds-1) {
+		t.Errorf("Expected last dynamic update to win, got %+v", rules)
+	}
+}
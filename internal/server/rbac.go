@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net/http"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/realip"
+	"strings"
+	"time"
+)
+
+// selfServiceRoutes 所有认证用户都可以访问的接口：自己的登录会话、API 令牌和对话，
+// 令牌能授予的权限和能读取的对话由接口本身限制
+var selfServiceRoutes = []string{"/api/auth/", "/api/tokens", "/api/chat/", "/api/csrf"}
+
+// seedRBAC 创建内置的 admin 角色，并把配置的 web_user 加入用户列表作为管理员
+// admin 角色始终拥有全部权限，不能删除或改名
+func seedRBAC() {
+	db, err := dashboardDB()
+	if err != nil {
+		logger.Info("❌ 控制台数据库不可用，无法创建内置管理员角色: %v", err)
+		return
+	}
+	var n int64
+	if db.Model(&Role{}).Where("name = ?", adminRole).Count(&n); n == 0 {
+		role := Role{Name: adminRole, Description: "内置管理员，拥有全部权限", Permissions: []string{"*"}, CreatedAt: time.Now().Format(time.RFC3339)}
+		if err := db.Create(&role).Error; err != nil {
+			logger.Info("❌ 创建内置管理员角色失败: %v", err)
+		}
+	}
+
+	webUser := config.Current().WebUser
+	if webUser == "" {
+		return
+	}
+	userWrites.Lock()
+	defer userWrites.Unlock()
+	if user, ok := findUser(webUser); ok {
+		if !hasRole(*user, adminRole) {
+			user.Roles = append(user.Roles, adminRole)
+			if err := db.Save(user).Error; err != nil {
+				logger.Info("❌ 设置管理员 %s 的角色失败: %v", webUser, err)
+			}
+		}
+		return
+	}
+	// 配置的管理员使用 web_password 登录，用户列表中不保存密码
+	user := User{Username: webUser, Roles: []string{adminRole}, Enabled: true, CreatedAt: time.Now().Format(time.RFC3339)}
+	if err := db.Create(&user).Error; err != nil {
+		logger.Info("❌ 添加管理员 %s 失败: %v", webUser, err)
+	}
+}
+
+// userGrants 用户当前拥有的权限：配置的管理员和 admin 角色的用户为 *，其他用户为角色权限的并集
+func userGrants(username string) map[string]bool {
+	if config.Current().WebUser != "" && username == config.Current().WebUser {
+		return map[string]bool{"*": true}
+	}
+	return userPermissions(username)
+}
+
+// userRoutePermission 用户访问该请求所需的权限，资源按 tokenRouteResources 的路径前缀确定：
+// 读请求需要资源的任一权限，DELETE 需要 <资源>:delete，其他写请求需要 <资源>:write；
+// 资源没有定义对应的操作时由接口自己检查（如 jobs:manage），未列出的路径只有读请求不需要权限
+func userRoutePermission(r *http.Request) (required string, allowed func(granted map[string]bool) bool) {
+	for _, prefix := range selfServiceRoutes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return "", func(map[string]bool) bool { return true }
+		}
+	}
+	resource := ""
+	for _, route := range tokenRouteResources {
+		if strings.HasPrefix(r.URL.Path, route.prefix) {
+			resource = route.resource
+			break
+		}
+	}
+	known := knownPermissions()
+	if resource == "" {
+		if safeMethod(r.Method) {
+			return "", func(map[string]bool) bool { return true }
+		}
+		return "*", func(granted map[string]bool) bool { return granted["*"] }
+	}
+	if safeMethod(r.Method) {
+		if !known[resource+":read"] {
+			return "", func(map[string]bool) bool { return true }
+		}
+		return resource + ":read", func(granted map[string]bool) bool {
+			for permission := range granted {
+				if permission == "*" || strings.HasPrefix(permission, resource+":") {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	action := "write"
+	if r.Method == http.MethodDelete && known[resource+":delete"] {
+		action = "delete"
+	}
+	if !known[resource+":"+action] {
+		return "", func(map[string]bool) bool { return true }
+	}
+	required = resource + ":" + action
+	return required, func(granted map[string]bool) bool {
+		return granted["*"] || granted[required] || granted[resource+":*"]
+	}
+}
+
+// authorize 按用户角色检查路由权限，缺少权限时返回 403；未开启认证时不检查
+// 使用 API 令牌时检查令牌所属用户，令牌本身的权限由 tokenAuth 检查
+func authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Current().WebUser == "" || config.Current().WebPassword == "" {
+			next(w, r)
+			return
+		}
+		user := requestUser(r)
+		required, allowed := userRoutePermission(r)
+		if !allowed(userGrants(user)) {
+			logger.Info("[AUDIT] 🚨 用户 %s 缺少权限 %s: %s %s from %s", user, required, r.Method, r.URL.Path, realip.FromRequest(r))
+			respondError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"testing"
+)
+
+// setupRBAC 配置的管理员 admin，只读用户 viewer（containers:read、logs:read）和运维 ops（containers:*）
+func setupRBAC(t *testing.T) {
+	t.Helper()
+	saved := config.Current()
+	setupDashboard(t)
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+
+	seedRBAC()
+	db, _ := dashboardDB()
+	db.Create([]Role{
+		{Name: "viewer", Permissions: []string{"containers:read", "logs:read"}},
+		{Name: "ops", Permissions: []string{"containers:*"}},
+	})
+	view, _ := hashPassword("view")
+	ops, _ := hashPassword("ops")
+	db.Create([]User{
+		{Username: "viewer", Password: view, Roles: []string{"viewer"}, Enabled: true},
+		{Username: "ops", Password: ops, Roles: []string{"ops"}, Enabled: true},
+	})
+}
+
+func TestAuthorize_ReadOnlyUserCannotWrite(t *testing.T) {
+	setupRBAC(t)
+	handler := basicAuth(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	request := func(user, pass, method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.SetBasicAuth(user, pass)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	cases := []struct {
+		user, pass, method, path string
+		want                     int
+	}{
+		{"viewer", "view", http.MethodGet, "/api/containers", http.StatusNoContent},
+		{"viewer", "view", http.MethodPost, "/api/container/action", http.StatusForbidden},
+		{"viewer", "view", http.MethodPost, "/api/files/save", http.StatusForbidden},
+		{"viewer", "view", http.MethodGet, "/api/files/list", http.StatusForbidden},
+		{"viewer", "view", http.MethodPost, "/api/trigger", http.StatusForbidden},
+		{"viewer", "view", http.MethodGet, "/api/stats", http.StatusNoContent},
+		{"viewer", "view", http.MethodGet, "/api/auth/me", http.StatusNoContent},
+		{"viewer", "wrong", http.MethodGet, "/api/containers", http.StatusUnauthorized},
+		{"ops", "ops", http.MethodPost, "/api/container/action", http.StatusNoContent},
+		{"ops", "ops", http.MethodDelete, "/api/users/2", http.StatusForbidden},
+		{"admin", "secret", http.MethodPost, "/api/files/save", http.StatusNoContent},
+		{"admin", "secret", http.MethodDelete, "/api/users/2", http.StatusNoContent},
+	}
+	for _, c := range cases {
+		if got := request(c.user, c.pass, c.method, c.path); got != c.want {
+			t.Errorf("%s %s %s = %d, want %d", c.user, c.method, c.path, got, c.want)
+		}
+	}
+
+	// 停用的用户不能登录
+	db, _ := dashboardDB()
+	db.Model(&User{ID: 2}).Update("enabled", false)
+	if got := request("viewer", "view", http.MethodGet, "/api/containers"); got != http.StatusUnauthorized {
+		t.Errorf("Expected a disabled user to get 401, got %d", got)
+	}
+}
+
+func TestHandleUserPermissions_RoleUnion(t *testing.T) {
+	setupRBAC(t)
+	permissions := func(id int) map[string]bool {
+		rec := httptest.NewRecorder()
+		handleUserPermissions(rec, httptest.NewRequest(http.MethodGet, "/api/users/permissions", nil), id)
+		var list []Permission
+		json.NewDecoder(rec.Body).Decode(&list)
+		got := map[string]bool{}
+		for _, p := range list {
+			got[p.Resource+":"+p.Action] = true
+		}
+		return got
+	}
+	if got := permissions(2); len(got) != 2 || !got["containers:read"] || !got["logs:read"] {
+		t.Errorf("Expected the viewer role permissions, got %v", got)
+	}
+	if got := permissions(3); len(got) != 2 || !got["containers:read"] || !got["containers:write"] {
+		t.Errorf("Expected containers:* to expand, got %v", got)
+	}
+	if got := permissions(1); len(got) != len(permissionsStore) {
+		t.Errorf("Expected the seeded admin to have every permission, got %d", len(got))
+	}
+}
+
+func TestSeedRBAC_BuiltinAdminRole(t *testing.T) {
+	setupRBAC(t)
+	seedRBAC()
+	db, _ := dashboardDB()
+	var roles []Role
+	var users []User
+	db.Order("id").Find(&roles)
+	db.Order("id").Find(&users)
+	if len(roles) != 3 || len(users) != 3 || users[0].ID != 1 || users[0].Username != "admin" || !hasRole(users[0], adminRole) {
+		t.Fatalf("Expected seeding to be idempotent, got %+v %+v", roles, users)
+	}
+	rec := httptest.NewRecorder()
+	handleRoleDetail(rec, httptest.NewRequest(http.MethodDelete, "/api/roles/1", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected the admin role to be protected, got %d", rec.Code)
+	}
+	// admin 角色的权限被修改后仍然拥有全部权限
+	roles[0].Permissions = nil
+	users[2].Roles = []string{adminRole}
+	db.Save(&roles[0])
+	db.Save(&users[2])
+	if !userGrants("ops")["*"] {
+		t.Error("Expected the built-in admin role to always pass")
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/metrics"
+	"qwq/internal/remote"
+	"qwq/internal/selfguard"
+	"qwq/internal/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRemoteStatsInterval 远程主机监控数据的默认采集间隔
+const defaultRemoteStatsInterval = 10 * time.Second
+
+var (
+	// remoteHosts 远程主机管理器，由启动时注入；未注入时只能查看本机的监控数据
+	remoteHosts   *remote.Manager
+	remoteHostsMu sync.RWMutex
+
+	// remoteStats 各远程主机的监控数据，与本机的 statsCache 一样最多保存 resources.stats_history 个数据点
+	remoteStats = struct {
+		sync.RWMutex
+		History map[string][]StatsPoint
+	}{History: make(map[string][]StatsPoint)}
+)
+
+// errRemoteHostsUnavailable 远程主机未启用
+var errRemoteHostsUnavailable = apierror.New(http.StatusServiceUnavailable, "REMOTE_HOSTS_UNAVAILABLE", "Remote hosts are not available")
+
+// SetRemoteHosts 设置控制台使用的远程主机管理器
+func SetRemoteHosts(manager *remote.Manager) {
+	remoteHostsMu.Lock()
+	defer remoteHostsMu.Unlock()
+	remoteHosts = manager
+}
+
+// remoteHostManager 当前的远程主机管理器，未设置时为 nil
+func remoteHostManager() *remote.Manager {
+	remoteHostsMu.RLock()
+	defer remoteHostsMu.RUnlock()
+	return remoteHosts
+}
+
+// remoteStatsInterval 远程主机监控数据的采集间隔，可通过 remote.stats_interval 配置
+func remoteStatsInterval() time.Duration {
+	if seconds := config.Current().Remote.StatsInterval; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultRemoteStatsInterval
+}
+
+// collectRemoteStatsLoop 定时通过 SSH 采集各远程主机的监控数据，没有注入管理器时不采集
+func collectRemoteStatsLoop(ctx context.Context) {
+	for {
+		interval := remoteStatsInterval()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if manager := remoteHostManager(); manager != nil {
+			collectRemoteStats(ctx, manager, interval)
+		}
+	}
+}
+
+// collectRemoteStats 并行采集所有远程主机的一个数据点，已删除主机的历史一并清除
+// 连接或采集失败时记录带 Error 的数据点，面板据此显示主机离线
+func collectRemoteStats(ctx context.Context, manager *remote.Manager, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	hosts, err := manager.List(ctx)
+	if err != nil {
+		logger.Info("❌ 读取远程主机失败: %v", err)
+		return
+	}
+
+	points := make([]StatsPoint, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host remote.Host) {
+			defer wg.Done()
+			points[i] = collectRemotePoint(ctx, manager, host, timeout)
+		}(i, host)
+	}
+	wg.Wait()
+
+	remoteStats.Lock()
+	defer remoteStats.Unlock()
+	current := make(map[string][]StatsPoint, len(hosts))
+	limit := selfguard.StatsHistoryLimit()
+	for i, host := range hosts {
+		history := append(remoteStats.History[host.Name], points[i])
+		if len(history) > limit {
+			history = history[len(history)-limit:]
+		}
+		current[host.Name] = history
+	}
+	remoteStats.History = current
+}
+
+// collectRemotePoint 在远程主机上采集一个数据点
+func collectRemotePoint(ctx context.Context, manager *remote.Manager, host remote.Host, timeout time.Duration) StatsPoint {
+	point := StatsPoint{Time: time.Now().Format("15:04:05")}
+	executor, err := manager.Connect(ctx, host)
+	if err != nil {
+		point.Error = err.Error()
+		return point
+	}
+	var runErr string
+	snap, err := metrics.CollectWith(func(cmd string) string {
+		res := executor.Run(ctx, cmd, utils.ShellOptions{Timeout: timeout})
+		if res.TimedOut || (res.ExitCode == -1 && res.Err != "") {
+			runErr = strings.TrimSpace(res.Combined())
+		}
+		return res.Stdout
+	})
+	if err != nil {
+		point.Error = err.Error()
+		if runErr != "" {
+			point.Error = runErr
+		}
+		return point
+	}
+	point.Load = snap.Load
+	point.MemPct = fmt.Sprintf("%.1f", snap.MemPct())
+	point.MemUsed = fmt.Sprintf("%d", snap.MemUsedMB)
+	point.MemTotal = fmt.Sprintf("%d", snap.MemTotalMB)
+	point.DiskPct = snap.DiskPct
+	point.DiskAvail = snap.DiskAvail
+	point.TcpConn = snap.TCPConn
+	return point
+}
+
+// remoteStatsHistory 远程主机的监控数据，主机不存在时返回 ErrHostNotFound
+func remoteStatsHistory(ctx context.Context, name string) ([]StatsPoint, error) {
+	manager := remoteHostManager()
+	if manager == nil {
+		return nil, fmt.Errorf("%w: %s", remote.ErrHostNotFound, name)
+	}
+	if _, err := manager.Get(ctx, name); err != nil {
+		return nil, err
+	}
+	remoteStats.RLock()
+	defer remoteStats.RUnlock()
+	history := append([]StatsPoint{}, remoteStats.History[name]...)
+	return history, nil
+}
+
+// hostRequest 添加远程主机的请求
+type hostRequest struct {
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	User    string            `json:"user"`
+	Auth    remote.AuthMethod `json:"auth"`
+	KeyFile string            `json:"key_file"`
+	Labels  []string          `json:"labels"`
+}
+
+// handleHosts 远程主机列表和添加主机
+//
+//	GET  /api/hosts
+//	POST /api/hosts  body {"name": "web-1", "address": "10.0.0.1", "user": "root", "auth": "key|agent", "key_file": "...", "labels": ["web"]}
+func handleHosts(w http.ResponseWriter, r *http.Request) {
+	manager := remoteHostManager()
+	if manager == nil {
+		writeError(w, r, errRemoteHostsUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hosts, err := manager.List(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if hosts == nil {
+			hosts = []remote.Host{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hosts)
+	case http.MethodPost:
+		var req hostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		host := &remote.Host{Name: req.Name, Address: req.Address, Port: req.Port, User: req.User, Auth: req.Auth, KeyFile: req.KeyFile, Labels: req.Labels}
+		if err := manager.Add(r.Context(), host); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		logger.Info("[AUDIT] 🖥️ 添加远程主机 %s (%s@%s:%d) by %s", host.Name, host.User, host.Address, host.Port, requestActor(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(host)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleHost 删除远程主机
+//
+//	DELETE /api/hosts/{name}
+func handleHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	manager := remoteHostManager()
+	if manager == nil {
+		writeError(w, r, errRemoteHostsUnavailable)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/hosts/")
+	if err := manager.Delete(r.Context(), name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	remoteStats.Lock()
+	delete(remoteStats.History, name)
+	remoteStats.Unlock()
+	logger.Info("[AUDIT] 🗑️ 删除远程主机 %s by %s", name, requestActor(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isRemoteHost 请求的主机是否为远程主机，空和 local 表示本机
+func isRemoteHost(name string) bool {
+	return name != "" && name != remote.LocalName
+}
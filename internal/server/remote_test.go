@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/remote"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func TestRemoteHostsAPIAndStats(t *testing.T) {
+	saved := remoteHostManager()
+	t.Cleanup(func() {
+		SetRemoteHosts(saved)
+		remoteStats.Lock()
+		remoteStats.History = make(map[string][]StatsPoint)
+		remoteStats.Unlock()
+	})
+
+	SetRemoteHosts(nil)
+	rec := httptest.NewRecorder()
+	handleHosts(rec, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusServiceUnavailable || envelope.Code != "REMOTE_HOSTS_UNAVAILABLE" {
+		t.Fatalf("Expected 503 without a host manager, got %d %+v", rec.Code, envelope)
+	}
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&remote.Host{}); err != nil {
+		t.Fatal(err)
+	}
+	// 连接总是失败，采集结果记录为带错误的数据点
+	pool := remote.NewPool(func(ctx context.Context, host remote.Host) (*ssh.Client, error) {
+		return nil, errors.New("connection refused")
+	})
+	manager := remote.NewManagerWithPool(db, pool)
+	SetRemoteHosts(manager)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleHosts(rec, httptest.NewRequest(http.MethodPost, "/api/hosts", strings.NewReader(body)))
+		return rec
+	}
+	if rec := post(`{"name":"web-1","address":"10.0.0.1","user":"root","auth":"agent","labels":["web"]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", rec.Code, rec.Body)
+	}
+	for body, code := range map[string]string{
+		`{"name":"web-1","address":"10.0.0.2","user":"root","auth":"agent"}`: "REMOTE_HOST_EXISTS",
+		`{"name":"local","address":"10.0.0.2","user":"root","auth":"agent"}`: "REMOTE_HOST_INVALID",
+		`{"name":"db-1","address":"10.0.0.2","user":"root"}`:                 "REMOTE_HOST_INVALID",
+	} {
+		if envelope := decodeEnvelope(t, post(body)); envelope.Code != code {
+			t.Errorf("Expected %s for %s, got %+v", code, body, envelope)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handleHosts(rec, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+	var hosts []remote.Host
+	json.NewDecoder(rec.Body).Decode(&hosts)
+	if len(hosts) != 1 || hosts[0].Name != "web-1" || hosts[0].Port != remote.DefaultPort {
+		t.Fatalf("Unexpected hosts %+v", hosts)
+	}
+
+	stats := func(host string) (*httptest.ResponseRecorder, []StatsPoint) {
+		rec := httptest.NewRecorder()
+		handleStats(rec, httptest.NewRequest(http.MethodGet, "/api/stats?host="+host, nil))
+		var points []StatsPoint
+		json.NewDecoder(rec.Body).Decode(&points)
+		return rec, points
+	}
+	if rec, _ := stats("missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown host, got %d", rec.Code)
+	}
+	if rec, points := stats("web-1"); rec.Code != http.StatusOK || len(points) != 0 {
+		t.Errorf("Expected no points before the first collection, got %d %+v", rec.Code, points)
+	}
+
+	collectRemoteStats(context.Background(), manager, time.Second)
+	if _, points := stats("web-1"); len(points) != 1 || !strings.Contains(points[0].Error, "connection refused") {
+		t.Errorf("Expected a point recording the connection failure, got %+v", points)
+	}
+
+	rec = httptest.NewRecorder()
+	handleHost(rec, httptest.NewRequest(http.MethodDelete, "/api/hosts/web-1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", rec.Code, rec.Body)
+	}
+	if rec, _ := stats("web-1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after deleting the host, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handleHost(rec, httptest.NewRequest(http.MethodDelete, "/api/hosts/web-1", nil))
+	if envelope := decodeEnvelope(t, rec); envelope.Code != "REMOTE_HOST_NOT_FOUND" {
+		t.Errorf("Expected REMOTE_HOST_NOT_FOUND on second delete, got %+v", envelope)
+	}
+}
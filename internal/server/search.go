@@ -0,0 +1,454 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"qwq/internal/appstore"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"qwq/internal/patrol"
+	"qwq/internal/website"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 搜索参数
+const (
+	SearchMinQueryLength    = 3
+	SearchMaxResults        = 20 // 每个数据源最多返回的结果数
+	SearchTotalTimeout      = 3 * time.Second
+	SearchSourceTimeout     = time.Second
+	searchSnippetContext    = 40
+	searchErrTimeoutMessage = "timeout"
+)
+
+// SearchCaller 发起搜索的用户
+type SearchCaller struct {
+	User     string
+	TenantID uint
+	can      func(resource string) bool
+}
+
+// Can 判断调用者是否有某类资源的读权限
+func (c SearchCaller) Can(resource string) bool {
+	return c.can == nil || c.can(resource)
+}
+
+// SearchResult 单条搜索结果
+type SearchResult struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Snippet string `json:"snippet,omitempty"`
+	Link    string `json:"link"` // 前端深链接
+}
+
+// SearchGroup 按数据源分组的搜索结果
+type SearchGroup struct {
+	Type    string         `json:"type"`
+	Results []SearchResult `json:"results"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// SearchResponse 搜索接口响应
+type SearchResponse struct {
+	Query  string        `json:"query"`
+	Groups []SearchGroup `json:"groups"`
+	TookMS int64         `json:"took_ms"`
+}
+
+// SearchSource 搜索数据源
+type SearchSource struct {
+	Type     string // 结果分组类型，如 websites、containers
+	Resource string // 所需的读权限资源，见 permissionsStore
+	Search   func(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error)
+}
+
+var searchSources = struct {
+	sync.RWMutex
+	list []SearchSource
+}{
+	list: []SearchSource{
+		{Type: "websites", Resource: "websites", Search: searchWebsites},
+		{Type: "containers", Resource: "containers", Search: searchContainers},
+		{Type: "incidents", Resource: "logs", Search: searchIncidents},
+		{Type: "logs", Resource: "logs", Search: searchLogs},
+	},
+}
+
+// RegisterSearchSource 注册额外的搜索数据源，依赖数据库的数据源（DNS 记录、应用实例）在启动时注册
+// 同类型的数据源会被替换
+func RegisterSearchSource(source SearchSource) {
+	searchSources.Lock()
+	defer searchSources.Unlock()
+	for i, existing := range searchSources.list {
+		if existing.Type == source.Type {
+			searchSources.list[i] = source
+			return
+		}
+	}
+	searchSources.list = append(searchSources.list, source)
+}
+
+// handleSearch 全局搜索
+// GET /api/search?q=xxx 并发查询所有数据源，单个数据源超时或出错不影响其他结果
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(query) < SearchMinQueryLength {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("Query must be at least %d characters", SearchMinQueryLength))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), SearchTotalTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runSearch(ctx, searchCaller(r), query))
+}
+
+// runSearch 并发执行所有有权限的数据源
+func runSearch(ctx context.Context, caller SearchCaller, query string) SearchResponse {
+	start := time.Now()
+
+	searchSources.RLock()
+	sources := make([]SearchSource, 0, len(searchSources.list))
+	for _, source := range searchSources.list {
+		if caller.Can(source.Resource) {
+			sources = append(sources, source)
+		}
+	}
+	searchSources.RUnlock()
+
+	groups := make([]SearchGroup, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source SearchSource) {
+			defer wg.Done()
+			groups[i] = searchOneSource(ctx, caller, source, query)
+		}(i, source)
+	}
+	wg.Wait()
+
+	return SearchResponse{Query: query, Groups: groups, TookMS: time.Since(start).Milliseconds()}
+}
+
+// searchOneSource 在独立超时内查询单个数据源
+// 数据源未响应 context 取消时也会按时返回，结果被丢弃
+func searchOneSource(ctx context.Context, caller SearchCaller, source SearchSource, query string) SearchGroup {
+	group := SearchGroup{Type: source.Type, Results: []SearchResult{}}
+
+	ctx, cancel := context.WithTimeout(ctx, SearchSourceTimeout)
+	defer cancel()
+
+	type outcome struct {
+		results []SearchResult
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		results, err := source.Search(ctx, caller, query)
+		done <- outcome{results, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			if errors.Is(out.err, context.DeadlineExceeded) {
+				group.Error = searchErrTimeoutMessage
+			} else {
+				logger.Info("搜索数据源 %s 失败: %v", source.Type, out.err)
+				group.Error = out.err.Error()
+			}
+			return group
+		}
+		if len(out.results) > SearchMaxResults {
+			out.results = out.results[:SearchMaxResults]
+		}
+		if out.results != nil {
+			group.Results = out.results
+		}
+	case <-ctx.Done():
+		group.Error = searchErrTimeoutMessage
+	}
+	return group
+}
+
+// searchCaller 根据请求构造调用者及其权限
+// 配置的管理员账号（或未启用认证时）拥有全部权限，其他用户按角色权限过滤，API 令牌还要求令牌本身拥有资源权限
+func searchCaller(r *http.Request) SearchCaller {
+	caller := SearchCaller{User: requestUser(r), TenantID: requestTenant(r)}
+
+	if token := requestToken(r); token != nil {
+		owner := ownerPermissions(token.Owner)
+		caller.can = func(resource string) bool {
+			return token.AllowsResource(resource) && owner(resource+":read")
+		}
+		return caller
+	}
+	user, ok := authUser(r)
+	if config.Current().WebUser == "" || (ok && user == config.Current().WebUser) {
+		return caller
+	}
+
+	granted := userPermissions(user)
+	caller.can = func(resource string) bool {
+		return granted["*"] || granted[resource+":*"] || granted[resource+":read"]
+	}
+	return caller
+}
+
+// userPermissions 汇总用户所有角色的权限
+func userPermissions(username string) map[string]bool {
+	granted := make(map[string]bool)
+
+	user, ok := findUser(username)
+	if !ok || !user.Enabled || len(user.Roles) == 0 {
+		return granted
+	}
+
+	var roles []Role
+	if db, err := dashboardDB(); err == nil {
+		db.Where("name IN ?", user.Roles).Find(&roles)
+	}
+	for _, roleName := range user.Roles {
+		// 内置的 admin 角色始终拥有全部权限
+		if roleName == adminRole {
+			granted["*"] = true
+		}
+	}
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			granted[permission] = true
+		}
+	}
+	return granted
+}
+
+// matchSnippet 不区分大小写匹配，返回匹配位置附近的片段
+func matchSnippet(text, query string) (string, bool) {
+	lower := strings.ToLower(text)
+	index := strings.Index(lower, strings.ToLower(query))
+	if index < 0 {
+		return "", false
+	}
+	if len(lower) != len(text) {
+		text = lower // 大小写转换改变了字节长度时退化为使用小写文本，保证下标有效
+	}
+
+	start := index - searchSnippetContext
+	if start < 0 {
+		start = 0
+	}
+	end := index + len(query) + searchSnippetContext
+	if end > len(text) {
+		end = len(text)
+	}
+	// 避免截断多字节字符
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	snippet := text[start:end]
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet, true
+}
+
+// anyMatch 返回第一个匹配字段的片段
+func anyMatch(query string, fields ...string) (string, bool) {
+	for _, field := range fields {
+		if snippet, ok := matchSnippet(field, query); ok {
+			return snippet, true
+		}
+	}
+	return "", false
+}
+
+func searchWebsites(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error) {
+	sites, err := listWebsites()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, site := range sites {
+		if snippet, ok := anyMatch(query, site.Domain, site.BackendURL); ok {
+			results = append(results, SearchResult{
+				ID:      fmt.Sprint(site.ID),
+				Title:   site.Domain,
+				Snippet: snippet,
+				Link:    fmt.Sprintf("/websites/%d", site.ID),
+			})
+		}
+	}
+	return results, nil
+}
+
+func searchContainers(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error) {
+	out, err := exec.CommandContext(ctx, "docker", "ps", "-a", "--format", "{{.ID}}|{{.Image}}|{{.Names}}").Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("docker ps: %w", err)
+	}
+
+	var results []SearchResult
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if snippet, ok := anyMatch(query, parts[2], parts[1]); ok {
+			results = append(results, SearchResult{
+				ID:      parts[0],
+				Title:   parts[2],
+				Snippet: snippet,
+				Link:    "/containers/" + parts[0],
+			})
+		}
+	}
+	return results, nil
+}
+
+// searchIncidents 搜索发现异常的巡检记录（检查项、告警内容和 AI 分析）
+func searchIncidents(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error) {
+	var results []SearchResult
+	for _, run := range patrol.DefaultStore.List(0) {
+		if run.Anomalies == 0 {
+			continue
+		}
+		fields := []string{run.Analysis}
+		for _, finding := range run.Findings() {
+			fields = append(fields, finding.Title, finding.Detail)
+		}
+		if snippet, ok := anyMatch(query, fields...); ok {
+			results = append(results, SearchResult{
+				ID:      fmt.Sprint(run.ID),
+				Title:   fmt.Sprintf("巡检 #%d (%d 项异常)", run.ID, run.Anomalies),
+				Snippet: snippet,
+				Link:    fmt.Sprintf("/patrol/runs/%d", run.ID),
+			})
+		}
+	}
+	return results, nil
+}
+
+// searchLogs 搜索内存中的最近日志，最新的在前
+func searchLogs(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error) {
+	logs := logger.GetWebLogs()
+
+	var results []SearchResult
+	for i := len(logs) - 1; i >= 0; i-- {
+		if snippet, ok := matchSnippet(logs[i], query); ok {
+			results = append(results, SearchResult{
+				ID:    fmt.Sprint(i),
+				Title: snippet,
+				Link:  fmt.Sprintf("/logs#%d", i),
+			})
+		}
+	}
+	return results, nil
+}
+
+// DNSRecordSearchSource 按记录名、完整域名和记录值搜索调用者租户的 DNS 记录，需要网站读权限
+func DNSRecordSearchSource(dns website.DNSService) SearchSource {
+	return SearchSource{Type: "dns", Resource: "websites", Search: func(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error) {
+		records, err := dns.ListDNSRecords(ctx, "", 0, caller.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		var results []SearchResult
+		for _, record := range records {
+			fqdn := record.Domain
+			if record.Name != "" && record.Name != "@" {
+				fqdn = record.Name + "." + record.Domain
+			}
+			if snippet, ok := anyMatch(query, fqdn, record.Value); ok {
+				results = append(results, SearchResult{
+					ID:      fmt.Sprint(record.ID),
+					Title:   fmt.Sprintf("%s %s", fqdn, record.Type),
+					Snippet: snippet,
+					Link:    fmt.Sprintf("/websites/dns/%d", record.ID),
+				})
+			}
+		}
+		return results, nil
+	}}
+}
+
+// AppInstanceSearchSource 按实例名、模板名和实例参数搜索调用者租户的应用实例，需要容器读权限
+func AppInstanceSearchSource(apps appstore.AppStoreService) SearchSource {
+	return SearchSource{Type: "apps", Resource: "containers", Search: func(ctx context.Context, caller SearchCaller, query string) ([]SearchResult, error) {
+		instances, err := apps.ListInstances(ctx, 0, caller.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		var results []SearchResult
+		for _, instance := range instances {
+			fields := []string{instance.Name}
+			if instance.Template != nil {
+				fields = append(fields, instance.Template.Name)
+			}
+			fields = append(fields, searchableParameters(instance)...)
+			if snippet, ok := anyMatch(query, fields...); ok {
+				results = append(results, SearchResult{
+					ID:      fmt.Sprint(instance.ID),
+					Title:   instance.Name,
+					Snippet: snippet,
+					Link:    fmt.Sprintf("/appstore/instances/%d", instance.ID),
+				})
+			}
+		}
+		return results, nil
+	}}
+}
+
+// searchableParameters 返回实例中模板声明的非密码参数值。实例配置是安装时的原始参数，
+// 包含密码，所以只搜索模板中声明且类型不是 password 的参数，没有模板时不搜索配置
+func searchableParameters(instance *appstore.ApplicationInstance) []string {
+	if instance.Template == nil || instance.Config == "" {
+		return nil
+	}
+	params, err := appstore.ParseTemplateParameters(instance.Template.Parameters)
+	if err != nil {
+		return nil
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(instance.Config), &config); err != nil {
+		return nil
+	}
+	var values []string
+	for _, param := range params {
+		if param.Type == appstore.ParamTypePassword {
+			continue
+		}
+		if value, ok := config[param.Name]; ok && value != nil {
+			values = append(values, fmt.Sprint(value))
+		}
+	}
+	return values
+}
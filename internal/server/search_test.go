@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/apitoken"
+	"qwq/internal/appstore"
+	"qwq/internal/website"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func withSearchSources(t *testing.T, sources ...SearchSource) {
+	searchSources.Lock()
+	saved := searchSources.list
+	searchSources.list = sources
+	searchSources.Unlock()
+	t.Cleanup(func() {
+		searchSources.Lock()
+		searchSources.list = saved
+		searchSources.Unlock()
+	})
+}
+
+func TestSearch_SlowAndFailingSourcesDoNotBreakResults(t *testing.T) {
+	withSearchSources(t,
+		SearchSource{Type: "fast", Search: func(ctx context.Context, c SearchCaller, q string) ([]SearchResult, error) {
+			return []SearchResult{{ID: "1", Title: q}}, nil
+		}},
+		SearchSource{Type: "slow", Search: func(ctx context.Context, c SearchCaller, q string) ([]SearchResult, error) {
+			time.Sleep(SearchSourceTimeout + 500*time.Millisecond) // 不响应取消
+			return []SearchResult{{ID: "late"}}, nil
+		}},
+		SearchSource{Type: "broken", Search: func(ctx context.Context, c SearchCaller, q string) ([]SearchResult, error) {
+			return nil, errors.New("boom")
+		}},
+	)
+
+	start := time.Now()
+	resp := runSearch(context.Background(), SearchCaller{}, "api.acme.com")
+	if elapsed := time.Since(start); elapsed > SearchSourceTimeout+300*time.Millisecond {
+		t.Errorf("Search should respect per-source timeout, took %v", elapsed)
+	}
+
+	if len(resp.Groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %d", len(resp.Groups))
+	}
+	if g := resp.Groups[0]; g.Error != "" || len(g.Results) != 1 {
+		t.Errorf("Fast source should return results, got %+v", g)
+	}
+	if g := resp.Groups[1]; g.Error != "timeout" || len(g.Results) != 0 {
+		t.Errorf("Slow source should time out, got %+v", g)
+	}
+	if g := resp.Groups[2]; g.Error != "boom" {
+		t.Errorf("Broken source should report its error, got %+v", g)
+	}
+}
+
+func TestSearch_PermissionFiltering(t *testing.T) {
+	found := func(ctx context.Context, c SearchCaller, q string) ([]SearchResult, error) {
+		return []SearchResult{{ID: "1"}}, nil
+	}
+	withSearchSources(t,
+		SearchSource{Type: "websites", Resource: "websites", Search: found},
+		SearchSource{Type: "logs", Resource: "logs", Search: found},
+	)
+
+	caller := SearchCaller{can: func(resource string) bool { return resource == "websites" }}
+	resp := runSearch(context.Background(), caller, "acme")
+	if len(resp.Groups) != 1 || resp.Groups[0].Type != "websites" {
+		t.Errorf("Expected only permitted sources to be searched, got %+v", resp.Groups)
+	}
+}
+
+func TestSearch_DNSRecordsAndAppInstancesByTenant(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&website.DNSRecord{}, &appstore.AppTemplate{}, &appstore.ApplicationInstance{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]website.DNSRecord{
+		{Domain: "acme.com", Type: website.DNSRecordA, Name: "api", Value: "10.0.0.1", UserID: 1, TenantID: 1},
+		{Domain: "acme.com", Type: website.DNSRecordCNAME, Name: "www", Value: "api.acme.com", UserID: 1, TenantID: 2},
+	})
+	template := &appstore.AppTemplate{
+		Name: "wikijs", DisplayName: "Wiki.js", Category: appstore.CategoryDevTools, Type: appstore.TemplateTypeDockerCompose, Version: "1", Content: "services: {}",
+		Parameters: `[{"name":"domain","type":"string"},{"name":"admin_password","type":"password"}]`,
+	}
+	db.Create(template)
+	db.Create(&[]appstore.ApplicationInstance{
+		{Name: "wiki", TemplateID: template.ID, Version: "1", Status: "running", Config: `{"domain":"api.acme.com","admin_password":"hunter2-secret","token":"hunter2-undeclared"}`, TenantID: 1},
+		{Name: "api-acme-blog", Version: "1", Status: "running", TenantID: 2},
+	})
+	withSearchSources(t,
+		DNSRecordSearchSource(website.NewDNSService(db)),
+		AppInstanceSearchSource(appstore.NewAppStoreService(db)),
+	)
+
+	// 控制台用户属于默认租户，API 令牌按令牌的租户搜索
+	caller := searchCaller(httptest.NewRequest(http.MethodGet, "/api/search?q=api.acme", nil))
+	if caller.TenantID != defaultTenantID {
+		t.Fatalf("Expected the default tenant, got %d", caller.TenantID)
+	}
+	resp := runSearch(context.Background(), caller, "api.acme")
+	if len(resp.Groups) != 2 || len(resp.Groups[0].Results) != 1 || resp.Groups[0].Results[0].Title != "api.acme.com A" {
+		t.Fatalf("Expected the tenant's DNS record, got %+v", resp.Groups)
+	}
+	if apps := resp.Groups[1]; apps.Type != "apps" || len(apps.Results) != 1 || apps.Results[0].Title != "wiki" {
+		t.Errorf("Expected the tenant's app instance, got %+v", apps)
+	}
+
+	// 密码参数和模板未声明的参数既不参与匹配，也不会出现在摘要中
+	resp = runSearch(context.Background(), caller, "hunter2")
+	if apps := resp.Groups[1]; len(apps.Results) != 0 {
+		t.Errorf("Expected password values to be unsearchable, got %+v", apps)
+	}
+	resp = runSearch(context.Background(), caller, "acme.com")
+	for _, result := range resp.Groups[1].Results {
+		if strings.Contains(result.Snippet, "hunter2") {
+			t.Errorf("Expected the snippet to omit passwords, got %q", result.Snippet)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search?q=api.acme", nil)
+	req = req.WithContext(withToken(req.Context(), &apitoken.Token{Owner: "admin", TenantID: 2, Permissions: []string{"*"}}))
+	if tenant := requestTenant(req); tenant != 2 {
+		t.Fatalf("Expected the token's tenant, got %d", tenant)
+	}
+	resp = runSearch(context.Background(), SearchCaller{TenantID: 2}, "api")
+	if dns := resp.Groups[0]; len(dns.Results) != 1 || dns.Results[0].Title != "www.acme.com CNAME" {
+		t.Errorf("Expected only tenant 2 DNS records, got %+v", dns)
+	}
+	if apps := resp.Groups[1]; len(apps.Results) != 1 || apps.Results[0].Title != "api-acme-blog" {
+		t.Errorf("Expected only tenant 2 app instances, got %+v", apps)
+	}
+}
+
+func TestHandleSearch_RejectsShortQuery(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=ab", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for short query, got %d", rec.Code)
+	}
+}
+
+func TestMatchSnippet(t *testing.T) {
+	snippet, ok := matchSnippet("upstream https://API.acme.com:8443/v1", "api.acme.com")
+	if !ok || snippet != "upstream https://API.acme.com:8443/v1" {
+		t.Errorf("Unexpected snippet %q", snippet)
+	}
+	if _, ok := matchSnippet("nothing here", "acme"); ok {
+		t.Error("Expected no match")
+	}
+}
@@ -3,26 +3,37 @@
 package server
 
 import (
-	"crypto/subtle"
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
 	"qwq/internal/agent"
 	"qwq/internal/config"
+	"qwq/internal/container"
 	"qwq/internal/deployment"
+	"qwq/internal/incident"
 	"qwq/internal/logger"
+	"qwq/internal/metrics"
 	"qwq/internal/monitor"
+	"qwq/internal/pagination"
+	"qwq/internal/patrol"
+	"qwq/internal/realip"
+	"qwq/internal/selfguard"
+	"qwq/internal/slash"
+	"qwq/internal/spa"
 	"qwq/internal/utils"
-	"qwq/internal/notify"
+	"qwq/internal/website"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	openai "github.com/sashabaranov/go-openai"
 )
 
@@ -34,15 +45,19 @@ import (
 // - dist/* : 嵌入 dist 目录下的所有文件（包括 index.html 等）
 // - dist/assets/* : 明确嵌入 assets 目录下的所有资源文件
 // 这种双重指定确保所有前端文件都被正确包含，避免 404 错误
+//
+// 编译前运行 go generate ./internal/server 检查 dist 是否完整（index.html 及其引用的资源都存在）
+//go:generate go run qwq/internal/spa/spacheck dist
 //go:embed dist/*
 //go:embed dist/assets/*
 var frontendDist embed.FS
 
 var (
 	// WebSocket 升级器配置
-	// 允许所有来源的连接，用于跨域 WebSocket 通信
+	// 与 API 使用相同的来源策略：同源或 cors.allowed_origins 中的来源
 	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin:  originAllowed,
+		Subprotocols: []string{wsAuthProtocol}, // 通过子协议传递登录令牌时回应 bearer
 	}
 	
 	// 外部回调函数，由主程序注入
@@ -59,29 +74,7 @@ var (
 	// 使用读写锁保护并发访问，存储最近的系统监控数据点
 	statsCache struct {
 		sync.RWMutex
-		History []StatsPoint // 历史监控数据，最多保存 60 个数据点
-	}
-	
-	// 网站配置存储
-	// 使用读写锁保护并发访问，存储网站配置信息
-	websitesStore struct {
-		sync.RWMutex
-		Websites []Website // 网站配置列表
-		NextID   int       // 下一个可用的ID
-	}
-	
-	// 用户数据存储
-	usersStore struct {
-		sync.RWMutex
-		Users []User // 用户列表
-		NextID int   // 下一个可用的ID
-	}
-	
-	// 角色数据存储
-	rolesStore struct {
-		sync.RWMutex
-		Roles []Role // 角色列表
-		NextID int   // 下一个可用的ID
+		History []StatsPoint // 历史监控数据，最多保存 resources.stats_history 个数据点
 	}
 	
 	// 权限数据存储（只读，预定义）
@@ -100,26 +93,31 @@ var (
 		{ID: 12, Resource: "files", Action: "read", Description: "查看文件"},
 		{ID: 13, Resource: "files", Action: "write", Description: "编辑文件"},
 		{ID: 14, Resource: "logs", Action: "read", Description: "查看日志"},
+		{ID: 15, Resource: "deployments", Action: "approve", Description: "审批生产环境部署"},
+		{ID: 16, Resource: "deployments", Action: "write", Description: "创建和执行部署"},
+		{ID: 17, Resource: "chat", Action: "audit", Description: "查看所有用户的对话列表"},
+		{ID: 18, Resource: "chat", Action: "read_all", Description: "读取其他用户的对话内容"},
+		{ID: 19, Resource: "audit", Action: "read", Description: "查看操作审计记录"},
 	}
 )
 
 // User 用户结构
 type User struct {
-	ID        int      `json:"id"`
-	Username  string   `json:"username"`
+	ID        int      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username  string   `json:"username" gorm:"uniqueIndex;not null"`
 	Email     string   `json:"email"`
-	Password  string   `json:"-"` // 密码不返回给前端
-	Roles     []string `json:"roles"`
+	Password  string   `json:"-"` // bcrypt 哈希，不返回给前端
+	Roles     []string `json:"roles" gorm:"type:text;serializer:json"`
 	Enabled   bool     `json:"enabled"`
 	CreatedAt string   `json:"created_at"`
 }
 
 // Role 角色结构
 type Role struct {
-	ID          int      `json:"id"`
-	Name        string   `json:"name"`
+	ID          int      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string   `json:"name" gorm:"uniqueIndex;not null"`
 	Description string   `json:"description"`
-	Permissions []string `json:"permissions"`
+	Permissions []string `json:"permissions" gorm:"type:text;serializer:json"`
 	CreatedAt   string   `json:"created_at"`
 }
 
@@ -143,6 +141,9 @@ type StatsPoint struct {
 	DiskAvail string      `json:"disk_avail"` // 根目录可用磁盘空间
 	TcpConn   string      `json:"tcp_conn"`   // 当前 TCP 连接数
 	Services  interface{} `json:"services"`   // HTTP 服务健康检查状态
+	Mounts    []monitor.MountUsage `json:"mounts,omitempty"` // 各挂载点的磁盘用量
+	Self      *selfguard.Stats `json:"self,omitempty"` // qwq 自身的资源占用
+	Error     string      `json:"error,omitempty"`      // 远程主机无法连接或采集失败的原因，此时其余字段为空
 }
 
 // DockerContainer Docker 容器信息结构
@@ -158,8 +159,8 @@ type DockerContainer struct {
 // Website 网站配置结构
 // 用于网站管理 API 的数据传输
 type Website struct {
-	ID            int    `json:"id"`             // 网站唯一标识符
-	Domain        string `json:"domain"`         // 域名
+	ID            int    `json:"id" gorm:"primaryKey;autoIncrement"` // 网站唯一标识符
+	Domain        string `json:"domain" gorm:"uniqueIndex;not null"` // 域名
 	BackendURL    string `json:"backend_url"`    // 后端服务地址
 	SSLEnabled    bool   `json:"ssl_enabled"`    // 是否启用SSL
 	Enabled       bool   `json:"enabled"`        // 网站是否启用
@@ -179,25 +180,63 @@ func Start(port string) {
 		fmt.Printf("无法创建日志文件: %v\n", err)
 	}
 
+	// 登录令牌的签名密钥首次启动时生成，初始化失败时仍可使用 Basic Auth
+	if err := initSessions(); err != nil {
+		logger.Info("❌ 登录令牌初始化失败，只能使用 Basic Auth: %v", err)
+	}
+	seedRBAC()
+
 	// 初始化部署集成服务，注入前端管理器适配器
 	deploymentService = deployment.NewIntegrationService(GetDefaultFrontendManagerAdapter())
 	logger.Info("🔧 部署集成服务已初始化")
 
+	// 巡检中的端口暴露检查需要容器和网站信息，由 Web 服务注入
+	patrol.ExposureReport = BuildExposureReport
+
 	// 启动后台监控数据采集协程
-	// 每 2 秒采集一次系统监控数据，保存到内存缓存中
-	go collectStatsLoop()
+	// 每 2 秒采集一次系统监控数据，保存到内存缓存中，并加载持久化的长期历史
+	if err := monitor.DefaultHistory.Load(); err != nil {
+		logger.Info("加载监控历史失败: %v", err)
+	}
+	if err := patrol.DefaultStore.Load(patrol.DefaultRunsFile); err != nil {
+		logger.Info("加载巡检记录失败: %v", err)
+	}
+	go utils.Supervise(context.Background(), "stats-collector", func(ctx context.Context) {
+		collectStatsLoop()
+	})
+	go utils.Supervise(context.Background(), "remote-stats", collectRemoteStatsLoop)
+	go utils.Supervise(context.Background(), "self-guard", selfguard.Run)
+	go utils.Supervise(context.Background(), "http-checks", monitor.DefaultChecks.Run)
 
 	// 注册核心 API 路由
+	http.HandleFunc("/api/auth/login", handleAuthLogin)                          // 用户名密码登录，签发登录令牌（JWT）
+	http.HandleFunc("/api/auth/logout", basicAuth(handleAuthLogout))            // 注销当前登录令牌
+	http.HandleFunc("/api/auth/me", basicAuth(handleAuthMe))                    // 当前用户的用户名和角色
 	http.HandleFunc("/api/logs", basicAuth(handleLogs))                         // 获取系统日志
-	http.HandleFunc("/api/stats", basicAuth(handleStats))                       // 获取监控统计数据
+	http.HandleFunc("/api/logs/files", basicAuth(handleLogFiles))               // 列出日志文件
+	http.HandleFunc("/api/logs/download", basicAuth(handleLogDownload))         // 下载日志文件
+	http.HandleFunc("/api/stats", basicAuth(handleStats))                       // 获取监控统计数据，?host= 查看远程主机
+	http.HandleFunc("/api/hosts", basicAuth(handleHosts))                       // 远程主机列表和添加主机
+	http.HandleFunc("/api/hosts/", basicAuth(handleHost))                       // 删除远程主机 /api/hosts/{name}
 	http.HandleFunc("/api/trigger", basicAuth(handleTrigger))                   // 手动触发巡检
+	http.HandleFunc("/api/patrol/runs/", basicAuth(handlePatrolRunDetail))      // 巡检记录详情（含决策追踪）
+	http.HandleFunc("/api/patrol/runs", basicAuth(handlePatrolRuns))            // 最近的巡检记录
 	http.HandleFunc("/api/containers", basicAuth(handleContainers))             // 获取容器列表
-	http.HandleFunc("/api/container/action", basicAuth(handleContainerAction))  // 容器操作 (启动/停止/重启)
-	
-	// 网站管理 API 路由
+	http.HandleFunc("/api/containers/", basicAuth(handleContainerSubroutes))    // 容器卷快照与恢复
+	http.HandleFunc("/api/backup/run", basicAuth(handleBackupRun))              // 立即备份配置
+	http.HandleFunc("/api/backup/list", basicAuth(handleBackupList))            // 配置备份列表
+	http.HandleFunc("/api/backup/restore", basicAuth(handleBackupRestore))      // 恢复配置备份的一个组件
+	http.HandleFunc("/api/container/action", basicAuth(handleContainerAction))  // 容器操作 (启动/停止/重启/暂停/删除/详情)
+	http.HandleFunc("/api/container/logs", basicAuth(handleContainerLogs))      // 容器最近的日志
+	http.HandleFunc("/api/container/stats", basicAuth(handleContainerStats))    // 容器资源占用
+	
+	// 网站管理 API 路由（modules.disable_websites 时不注册）
 	// 注意：更具体的路由需要先注册，确保路径匹配正确
-	http.HandleFunc("/api/websites/", basicAuth(handleWebsiteDetail))            // 网站详情、更新、删除、SSL管理
-	http.HandleFunc("/api/websites", basicAuth(handleWebsites))                  // 网站列表和创建
+	if !config.Current().Modules.DisableWebsites {
+		http.HandleFunc("/api/websites/", basicAuth(handleWebsiteDetail)) // 网站详情、更新、删除、SSL管理
+		http.HandleFunc("/api/websites", basicAuth(handleWebsites))       // 网站列表和创建
+		http.Handle(acmeChallengePath(), website.DefaultChallenges)      // ACME HTTP-01 挑战（CA 访问，不经过 basicAuth）
+	}
 	
 	// 用户管理 API 路由（返回空数组，避免前端报错）
 	http.HandleFunc("/api/users/", basicAuth(handleUserDetail))                  // 用户详情、更新、删除、权限管理
@@ -205,16 +244,22 @@ func Start(port string) {
 	http.HandleFunc("/api/roles/", basicAuth(handleRoleDetail))                 // 角色详情、更新、删除
 	http.HandleFunc("/api/roles", basicAuth(handleRoles))                       // 角色列表和创建
 	http.HandleFunc("/api/permissions", basicAuth(handlePermissions))           // 权限列表
+	http.HandleFunc("/api/tokens/", basicAuth(handleTokenDetail))               // 吊销 API 令牌
+	http.HandleFunc("/api/tokens", basicAuth(handleTokens))                     // API 令牌列表和创建
 
 	// 文件管理 API 路由
 	http.HandleFunc("/api/files/list", basicAuth(handleFileList))       // 浏览文件目录
 	http.HandleFunc("/api/files/content", basicAuth(handleFileContent)) // 读取文件内容
 	http.HandleFunc("/api/files/save", basicAuth(handleFileSave))       // 保存文件内容
 	http.HandleFunc("/api/files/action", basicAuth(handleFileAction))   // 文件操作 (删除/重命名/创建目录)
+	http.HandleFunc("/api/files/upload", basicAuth(handleFileUpload))     // 上传文件
+	http.HandleFunc("/api/files/download", basicAuth(handleFileDownload)) // 下载文件，支持 Range
 	
-	// 应用商店 API 路由
-	http.HandleFunc("/api/appstore/templates", basicAuth(handleAppStoreTemplates)) // 获取应用模板列表
-	http.HandleFunc("/api/appstore/instances", basicAuth(handleAppStoreInstances)) // 获取/创建应用实例
+	// 应用商店 API 路由（modules.disable_appstore 时不注册）
+	if !config.Current().Modules.DisableAppStore {
+		http.HandleFunc("/api/appstore/templates", basicAuth(handleAppStoreTemplates)) // 获取应用模板列表
+		http.HandleFunc("/api/appstore/instances", basicAuth(handleAppStoreInstances)) // 获取/创建应用实例
+	}
 	
 	// 数据库管理 API 路由
 	http.HandleFunc("/api/databases/connections", basicAuth(handleDatabaseConnections)) // 数据库连接管理
@@ -225,26 +270,45 @@ func Start(port string) {
 	http.HandleFunc("/api/deployment/status", basicAuth(handleDeploymentStatus))       // 部署状态
 	http.HandleFunc("/api/deployment/workflow", basicAuth(handleDeploymentWorkflow))   // 部署工作流
 	http.HandleFunc("/api/health", basicAuth(handleHealthCheck))                       // 健康检查
+	http.HandleFunc("/api/health/score", basicAuth(handleHealthScore))                 // 主机健康评分与扣分明细
+	http.HandleFunc("/api/csrf", basicAuth(handleCSRFToken))                          // 签发 CSRF token（双重提交 cookie）
+	http.HandleFunc("/api/ai/status", basicAuth(handleAIStatus))                      // AI 启用与限流状态
+	http.HandleFunc("/api/policy/autoexec", basicAuth(handleAutoExecPolicy))          // 对话命令自动执行策略
+	http.HandleFunc("/api/search", basicAuth(handleSearch))                           // 全局搜索
+	http.HandleFunc("/api/firewall/exposure", basicAuth(handleFirewallExposure))      // 端口暴露面报告（只读）
+	http.HandleFunc("/api/firewall/rules", basicAuth(handleFirewallRules))            // qwq 专用链放行规则（需开启 firewall.manage）
+	http.HandleFunc("/api/maintenance", basicAuth(handleMaintenance))                 // 维护窗口（静默告警）
+	http.HandleFunc("/api/archive/status", basicAuth(handleArchiveStatus))            // 最近一次历史记录归档结果
+	http.HandleFunc("/api/notifications/history", basicAuth(handleNotificationHistory)) // 最近 100 条通知投递记录（渠道、尝试次数、结果）
+	http.HandleFunc("/api/config/dynamic", basicAuth(handleDynamicConfig))            // 运行时配置（巡检规则、HTTP 监控、通知路由、评分阈值）
+	http.HandleFunc("/api/incidents/", basicAuth(handleIncidentBundle))               // 事件复盘包下载 /api/incidents/{id}/bundle
+	http.HandleFunc("/api/jobs", basicAuth(handleJobs))                               // 定时任务列表、下次/最近执行和执行记录
+	http.HandleFunc("/api/jobs/", basicAuth(handleJob))                               // 定时任务详情、手动执行 /run、暂停 /pause、恢复 /resume
+	http.HandleFunc("/api/drift", basicAuth(handleDrift))                             // 托管的 nginx/compose 文件及外部修改事件
+	http.HandleFunc("/api/drift/", basicAuth(handleDriftResolve))                     // 处理外部修改 /api/drift/{id}/resolve（保留或覆盖）
+	http.HandleFunc("/api/host-audit", basicAuth(handleHostAudit))                    // 主机账号审计：基线与当前状态的差异
+	http.HandleFunc("/api/host-audit/accept", basicAuth(handleHostAuditAccept))       // 接受当前账号状态为新基线
+	http.HandleFunc("/api/chat/conversations", basicAuth(handleChatConversations))    // 当前用户的对话列表、创建对话；?all=true 审计所有用户的对话
+	http.HandleFunc("/api/chat/conversations/", basicAuth(handleChatConversation))    // 对话历史、重命名、删除
+	http.HandleFunc("/api/audit", basicAuth(handleAudit))                             // 操作审计记录 ?user=&path=&from=&to=&page=
+	http.HandleFunc("/api/events", basicAuth(handleEvents))                           // 事件时间线：Docker 事件和巡检异常、部署、自愈、配置变更 ?from=&to=&type=
+	http.HandleFunc("/api/anomalies", basicAuth(handleAnomalies))                     // 巡检异常历史 ?from=&to=&type=&resolved=&page=&pageSize=
+	http.HandleFunc("/api/anomalies/summary", basicAuth(handleAnomalySummary))        // 每天各类异常的数量 ?from=&to=&type=
+	http.HandleFunc("/metrics", basicAuth(promhttp.Handler().ServeHTTP))              // Prometheus 指标
+
+	// 只读公开状态页（不经过 basicAuth，使用独立的处理器和字段白名单）
+	if config.Current().StatusPage.Enabled {
+		registerStatusPage(http.DefaultServeMux)
+	}
 
 	// WebSocket 实时通信接口
-	http.HandleFunc("/ws/chat", basicAuth(handleWSChat)) // AI 聊天 WebSocket 连接
+	http.HandleFunc("/ws/chat", basicAuth(handleWSChat))     // AI 聊天 WebSocket 连接
+	http.HandleFunc("/ws/events", basicAuth(handleWSEvents)) // 事件时间线实时推送
+	http.HandleFunc("/ws/container/logs", basicAuth(handleWSContainerLogs)) // 容器日志实时推送
 
 	// 前端静态资源服务配置
 	// 注意：必须在所有 API 路由之后注册，确保 API 路由优先匹配
 	
-	// 调试模式：检查 Go embed 文件系统内容
-	// 用于排查前端资源是否正确嵌入到二进制文件中
-	logger.Info("🔍 检查 embed 文件系统内容:")
-	if entries, err := fs.ReadDir(frontendDist, "."); err == nil {
-		// 遍历并记录所有嵌入的文件和目录
-		for _, entry := range entries {
-			logger.Info("  - %s (目录: %v)", entry.Name(), entry.IsDir())
-		}
-	} else {
-		// 如果读取失败，记录错误信息用于调试
-		logger.Info("  读取 embed 文件系统失败: %v", err)
-	}
-	
 	// 创建前端资源文件系统
 	// 尝试从 embed FS 的 "dist" 子目录创建文件系统
 	distFS, err := fs.Sub(frontendDist, "dist")
@@ -255,147 +319,34 @@ func Start(port string) {
 		distFS = frontendDist
 	}
 	
-	// 验证前端资源文件系统内容
-	// 确保前端构建产物已正确嵌入
-	logger.Info("🔍 检查前端资源文件系统:")
-	var distEntries []fs.DirEntry
-	if entries, err := fs.ReadDir(distFS, "."); err == nil {
-		// 保存目录条目列表，用于后续判断前端资源是否为空
-		distEntries = entries
-		// 记录所有前端资源文件，便于调试前端 404 问题
-		for _, entry := range entries {
-			logger.Info("  - %s (目录: %v)", entry.Name(), entry.IsDir())
-			
-			// 特别处理 assets 目录：详细列出其内容
-			// 这对于调试前端资源加载问题非常重要，可以确认关键的 JS/CSS 文件是否存在
-			if entry.Name() == "assets" && entry.IsDir() {
-				if assetEntries, err := fs.ReadDir(distFS, "assets"); err == nil {
-					logger.Info("    Assets 目录内容 (%d 个文件):", len(assetEntries))
-					// 显示所有 assets 文件，用于调试前端 404 问题
-					// 包括 Vue 插件文件、CSS 样式文件、JS 模块文件等
-					for _, asset := range assetEntries {
-						logger.Info("      * %s", asset.Name())
-					}
-				}
-			}
-		}
-	} else {
-		// 读取前端文件系统失败，这通常表示前端构建有问题
-		logger.Info("  读取前端文件系统失败: %v", err)
-	}
-	
 	// 前端资源服务处理
-	if len(distEntries) == 0 {
-		// 前端资源为空的错误处理
-		logger.Info("⚠️ 前端资源为空，可能是构建失败")
+	// 启动时一次性读取全部文件并计算 ETag 和 gzip 结果，带哈希的资源长期缓存，index.html 每次协商
+	site, err := spa.Load(distFS)
+	if err != nil {
+		// 前端资源不完整的错误处理，编译前可用 go generate ./internal/server 检查
+		logger.Info("⛔ 前端资源不完整，页面无法打开: %v。请运行 cd frontend && npm run build，把 dist 复制到 internal/server/dist 后重新编译", err)
 		http.HandleFunc("/", basicAuth(func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, "前端资源为空，请检查构建是否成功", http.StatusNotFound)
+			http.Error(w, "前端资源不完整，请检查构建是否成功: "+err.Error(), http.StatusServiceUnavailable)
 		}))
 	} else {
-		// 创建 SPA (单页应用) 处理器
-		// 支持 Vue Router 的 HTML5 History 模式路由
-		spaHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 获取请求路径，去除前导斜杠
-			path := strings.TrimPrefix(r.URL.Path, "/")
-			if path == "" {
-				path = "index.html"
-			}
-			
-			// 特殊处理 favicon.ico - 如果不存在，返回 204 No Content，避免浏览器报错
-			if path == "favicon.ico" {
-				content, err := fs.ReadFile(distFS, path)
-				if err != nil {
-					// favicon.ico 不存在时返回 204，不记录错误日志
-					w.WriteHeader(http.StatusNoContent)
-					return
-				}
-				w.Header().Set("Content-Type", "image/x-icon")
-				w.Write(content)
-				return
-			}
-			
-			// 检查是否是静态资源请求
-			isStaticResource := strings.HasPrefix(path, "assets/") || 
-			                   strings.HasSuffix(path, ".js") || 
-			                   strings.HasSuffix(path, ".css") || 
-			                   strings.HasSuffix(path, ".png") || 
-			                   strings.HasSuffix(path, ".jpg") || 
-			                   strings.HasSuffix(path, ".jpeg") || 
-			                   strings.HasSuffix(path, ".svg") || 
-			                   strings.HasSuffix(path, ".json") ||
-			                   strings.HasSuffix(path, ".woff") ||
-			                   strings.HasSuffix(path, ".woff2") ||
-			                   strings.HasSuffix(path, ".ttf") ||
-			                   strings.HasSuffix(path, ".map")
-			
-			// 尝试直接读取文件
-			content, err := fs.ReadFile(distFS, path)
-			if err != nil {
-				if isStaticResource {
-					// 静态资源不存在，记录日志并返回 404
-					logger.Info("静态资源未找到: %s (错误: %v)", path, err)
-					http.NotFound(w, r)
-					return
-				}
-				// 非静态资源（页面路由），返回 index.html（SPA fallback）
-				// 这样 Vue Router 可以处理所有前端路由
-				path = "index.html"
-				content, err = fs.ReadFile(distFS, path)
-				if err != nil {
-					http.Error(w, "index.html 读取失败: "+err.Error(), http.StatusInternalServerError)
-					return
-				}
-			} else if !isStaticResource && !strings.HasSuffix(path, ".html") {
-				// 如果文件存在但不是静态资源也不是 HTML，可能是目录或其他
-				// 为了安全，也返回 index.html
-				path = "index.html"
-				content, err = fs.ReadFile(distFS, path)
-				if err != nil {
-					http.Error(w, "index.html 读取失败: "+err.Error(), http.StatusInternalServerError)
-					return
-				}
-			}
-			
-			// 根据文件扩展名设置正确的 Content-Type
-			// 确保浏览器正确解析文件类型
-			contentType := "text/html; charset=utf-8"
-			if strings.HasSuffix(path, ".js") {
-				contentType = "application/javascript; charset=utf-8"
-			} else if strings.HasSuffix(path, ".css") {
-				contentType = "text/css; charset=utf-8"
-			} else if strings.HasSuffix(path, ".json") {
-				contentType = "application/json; charset=utf-8"
-			} else if strings.HasSuffix(path, ".png") {
-				contentType = "image/png"
-			} else if strings.HasSuffix(path, ".jpg") || strings.HasSuffix(path, ".jpeg") {
-				contentType = "image/jpeg"
-			} else if strings.HasSuffix(path, ".svg") {
-				contentType = "image/svg+xml"
-			} else if strings.HasSuffix(path, ".ico") {
-				contentType = "image/x-icon"
-			} else if strings.HasSuffix(path, ".woff") || strings.HasSuffix(path, ".woff2") {
-				contentType = "font/woff2"
-			} else if strings.HasSuffix(path, ".ttf") {
-				contentType = "font/ttf"
-			}
-			
-			// 设置响应头并返回文件内容
-			w.Header().Set("Content-Type", contentType)
-			w.Write(content)
-		})
-		
+		files, size := site.Files()
+		logger.Info("📦 前端资源已加载: %d 个文件, %d KB", files, size>>10)
 		// 注册根路径处理器，应用身份验证中间件
-		http.HandleFunc("/", basicAuth(spaHandler))
+		// 支持 Vue Router 的 HTML5 History 模式路由
+		http.HandleFunc("/", basicAuth(site.ServeHTTP))
 	}
 
+	// 生成的 nginx 配置把 HTTP-01 挑战转发到监听地址
+	listenAddr = port
+
 	// 获取实际端口号（去掉冒号）
 	displayPort := strings.TrimPrefix(port, ":")
 	logger.Info("🚀 qwq Dashboard started at http://localhost:%s", displayPort)
-	if config.GlobalConfig.WebUser != "" {
-		logger.Info("🔒 安全模式已开启 (Basic Auth)")
+	if config.Current().WebUser != "" {
+		logger.Info("🔒 安全模式已开启 (登录令牌 / Basic Auth)")
 	}
 
-	if err := http.ListenAndServe(port, nil); err != nil {
+	if err := http.ListenAndServe(port, recoverMiddleware(realip.Middleware(corsMiddleware(csrfMiddleware(http.DefaultServeMux))))); err != nil {
 		fmt.Printf("Web Server Error: %v\n", err)
 	}
 }
@@ -404,53 +355,85 @@ func Start(port string) {
 // 容器管理 API
 // ============================================
 
-// handleContainers 获取 Docker 容器列表
+// containerListSpec 容器列表允许的排序字段和过滤参数，默认按名称排序
+var containerListSpec = pagination.Spec{
+	Sort:        map[string]string{"name": "name", "image": "image", "status": "status", "state": "state"},
+	DefaultSort: "name",
+	Filters:     map[string]string{"state": "state", "name": "name", "image": "image"},
+}
+
+// handleContainers 分页获取 Docker 容器列表
 func handleContainers(w http.ResponseWriter, r *http.Request) {
-	cmd := `docker ps -a --format "{{.ID}}|{{.Image}}|{{.Status}}|{{.Names}}"`
-	output := utils.ExecuteShell(cmd)
-	
-	var containers []DockerContainer
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	for _, line := range lines {
-		if line == "" { continue }
-		parts := strings.Split(line, "|")
-		if len(parts) >= 4 {
-			state := "exited"
-			if strings.Contains(parts[2], "Up") {
-				state = "running"
-			}
-			containers = append(containers, DockerContainer{
-				ID:     parts[0],
-				Image:  parts[1],
-				Status: parts[2],
-				Name:   parts[3],
-				State:  state,
-			})
-		}
-	}
-	json.NewEncoder(w).Encode(containers)
+	serveContainers(w, r, containerLister())
 }
 
-// handleContainerAction 执行容器操作（启动/停止/重启）
-func handleContainerAction(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	action := r.URL.Query().Get("action")
-	
-	// 参数验证
-	if id == "" || action == "" { 
-		http.Error(w, "Missing params", 400)
-		return 
+// serveContainers 按查询参数过滤、排序并分页返回 lister 中的容器
+func serveContainers(w http.ResponseWriter, r *http.Request, lister container.ContainerLister) {
+	q, err := pagination.Parse(r.URL.Query(), containerListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if action != "start" && action != "stop" && action != "restart" { 
-		http.Error(w, "Invalid action", 400)
-		return 
+	summaries, err := lister.ListContainers(r.Context())
+	if err != nil {
+		logger.Info("获取容器列表失败: %v", err)
+	}
+
+	containers := make([]DockerContainer, 0, len(summaries))
+	for _, c := range summaries {
+		state := "exited"
+		if strings.Contains(c.Status, "(Paused)") {
+			state = "paused"
+		} else if strings.Contains(c.Status, "Up") {
+			state = "running"
+		}
+		containers = append(containers, DockerContainer{
+			ID:     c.ID,
+			Image:  c.Image,
+			Status: c.Status,
+			Name:   c.Name,
+			State:  state,
+		})
 	}
-	
-	// 执行 Docker 命令
-	cmd := fmt.Sprintf("docker %s %s", action, id)
-	logger.Info("Web操作容器: %s", cmd)
-	utils.ExecuteShell(cmd)
-	w.Write([]byte("success"))
+	page := pagination.Slice(containers, q, func(c DockerContainer, column string) string {
+		switch column {
+		case "image":
+			return c.Image
+		case "status":
+			return c.Status
+		case "state":
+			return c.State
+		}
+		return c.Name
+	})
+	json.NewEncoder(w).Encode(page)
+}
+
+var (
+	dockerExecutor     container.DockerExecutor
+	dockerExecutorOnce sync.Once
+	dockerLister       container.ContainerLister
+	dockerListerOnce   sync.Once
+)
+
+// containerExecutor 容器列表和容器操作共用的 Docker 执行器，后端由 docker_backend 配置决定
+func containerExecutor() container.DockerExecutor {
+	dockerExecutorOnce.Do(func() {
+		dockerExecutor = container.NewDockerExecutor()
+	})
+	return dockerExecutor
+}
+
+// containerLister 获取容器列表查询器，与容器操作使用同一个执行器
+func containerLister() container.ContainerLister {
+	dockerListerOnce.Do(func() {
+		if lister, ok := containerExecutor().(container.ContainerLister); ok {
+			dockerLister = lister
+		} else {
+			dockerLister = container.NewCLIDockerExecutor().(container.ContainerLister)
+		}
+	})
+	return dockerLister
 }
 
 // ============================================
@@ -461,60 +444,79 @@ func handleContainerAction(w http.ResponseWriter, r *http.Request) {
 func collectStatsLoop() {
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
-	for range ticker.C {
+	lastSave := time.Now()
+	for now := range ticker.C {
 		point := collectOnePoint()
 		statsCache.Lock()
 		statsCache.History = append(statsCache.History, point)
-		if len(statsCache.History) > 60 { statsCache.History = statsCache.History[1:] }
+		if limit := selfguard.StatsHistoryLimit(); len(statsCache.History) > limit {
+			statsCache.History = statsCache.History[len(statsCache.History)-limit:]
+		}
 		statsCache.Unlock()
+
+		// 同时写入长期指标历史，供 query_metrics 工具做趋势分析
+		monitor.DefaultHistory.Add(now, statsPointValues(point))
+		if now.Sub(lastSave) >= statsHistorySaveInterval {
+			if err := monitor.DefaultHistory.Save(); err != nil {
+				logger.Info("保存监控历史失败: %v", err)
+			}
+			lastSave = now
+		}
+	}
+}
+
+// statsHistorySaveInterval 监控历史落盘间隔
+const statsHistorySaveInterval = 5 * time.Minute
+
+// statsPointValues 将字符串形式的监控数据点转换为数值指标
+func statsPointValues(point StatsPoint) map[string]float64 {
+	values := make(map[string]float64)
+	// Load 形如 "1.20, 0.80, 0.50"，取 1 分钟平均值
+	if load := strings.TrimSpace(strings.Split(point.Load, ",")[0]); load != "" {
+		if v, err := strconv.ParseFloat(load, 64); err == nil {
+			values[monitor.MetricLoad] = v
+		}
+	}
+	for name, raw := range map[string]string{
+		monitor.MetricMemPct:  point.MemPct,
+		monitor.MetricDiskPct: point.DiskPct,
+		monitor.MetricTCPConn: point.TcpConn,
+	} {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil {
+			values[name] = v
+		}
 	}
+	return values
+}
+
+// CollectStats 采集一次系统监控数据，Web 服务未运行时 qwq top 直接使用同一采集逻辑
+func CollectStats() StatsPoint {
+	return collectOnePoint()
 }
 
 // collectOnePoint 采集一次系统监控数据
 // 包括：系统负载、内存使用、磁盘使用、TCP 连接数、服务状态
 func collectOnePoint() StatsPoint {
-	// 获取系统负载（1分钟、5分钟、15分钟平均值）
-	load := strings.TrimSpace(utils.ExecuteShell("uptime | awk -F'load average:' '{ print $2 }'"))
-	
-	// 获取内存使用情况（单位：MB）
-	memRaw := utils.ExecuteShell("free -m | awk 'NR==2{print $2,$3}'")
-	var memTotal, memUsed float64
-	fmt.Sscanf(memRaw, "%f %f", &memTotal, &memUsed)
-	memPct := 0.0
-	if memTotal > 0 { 
-		memPct = (memUsed / memTotal) * 100 
-	}
-	
-	// 获取根目录磁盘使用情况（仪表盘只显示根目录）
-	diskRaw := utils.ExecuteShell("df -h / | awk 'NR==2 {print $5,$4}'")
-	diskParts := strings.Fields(diskRaw)
-	diskPct := "0"
-	diskAvail := "0G"
-	if len(diskParts) >= 2 {
-		diskPct = strings.TrimSuffix(diskParts[0], "%")
-		diskAvail = diskParts[1]
-	}
-	
-	// 获取 TCP 连接数（已建立的连接）
-	tcpRaw := utils.ExecuteShell("ss -s | grep 'TCP:' | grep -oE 'estab [0-9]+' | awk '{print $2}'")
-	tcpConn := strings.TrimSpace(tcpRaw)
-	if tcpConn == "" { 
-		tcpConn = "0" 
-	}
-	
-	// 执行 HTTP 服务健康检查
+	// 负载、内存、根目录磁盘和 TCP 连接数，Linux 上读取 /proc 和 statfs，其他平台回退到 shell 命令
+	snap := metrics.Collect()
+
+	// HTTP 服务健康检查的最近结果，检查本身由后台调度器按各自的间隔执行
 	httpStatus := monitor.RunChecks()
+	self := selfguard.Current()
+	mounts, _ := monitor.DiskMounts()
 	
 	return StatsPoint{
 		Time:      time.Now().Format("15:04:05"),
-		Load:      load,
-		MemPct:    fmt.Sprintf("%.1f", memPct),
-		MemUsed:   fmt.Sprintf("%.0f", memUsed),
-		MemTotal:  fmt.Sprintf("%.0f", memTotal),
-		DiskPct:   diskPct,
-		DiskAvail: diskAvail,
-		TcpConn:   tcpConn,
+		Load:      snap.Load,
+		MemPct:    fmt.Sprintf("%.1f", snap.MemPct()),
+		MemUsed:   fmt.Sprintf("%d", snap.MemUsedMB),
+		MemTotal:  fmt.Sprintf("%d", snap.MemTotalMB),
+		DiskPct:   snap.DiskPct,
+		DiskAvail: snap.DiskAvail,
+		TcpConn:   snap.TCPConn,
 		Services:  httpStatus,
+		Mounts:    mounts,
+		Self:      &self,
 	}
 }
 
@@ -527,23 +529,32 @@ func collectOnePoint() StatsPoint {
 // 使用 constant time 比较防止时序攻击
 func basicAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userCfg := config.GlobalConfig.WebUser
-		passCfg := config.GlobalConfig.WebPassword
+		// 登录令牌和 API 令牌认证，未配置用户名密码时同样校验，保证操作记在令牌名下
+		if secret, ok := requestBearer(r); ok {
+			bearerAuth(w, r, secret, auditRequest(authorize(next)))
+			return
+		}
+
+		userCfg := config.Current().WebUser
+		passCfg := config.Current().WebPassword
 		
-		// 未配置认证，直接放行
+		// 未配置认证，直接放行，写请求仍记录审计
 		if userCfg == "" || passCfg == "" {
-			next(w, r)
+			auditRequest(next)(w, r)
 			return
 		}
 		
-		// 验证认证信息
+		// 验证认证信息：配置的管理员或用户列表中的用户，通过后按角色检查路由权限
 		user, pass, ok := r.BasicAuth()
-		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(userCfg)) != 1 || subtle.ConstantTimeCompare([]byte(pass), []byte(passCfg)) != 1 {
+		if _, valid := authenticateUser(user, pass); !ok || !valid {
+			if ok {
+				logger.Info("[AUDIT] 🔒 认证失败: 用户 %q from %s", user, realip.FromRequest(r))
+			}
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			respondError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-		next(w, r)
+		auditRequest(authorize(next))(w, r)
 	}
 }
 
@@ -556,6 +567,18 @@ func basicAuth(next http.HandlerFunc) http.HandlerFunc {
 // 1. 静态响应 - 快速回答常见问题
 // 2. 快速命令 - 直接执行预定义命令
 // 3. AI 对话 - 调用 AI 进行智能分析
+//
+// AI 对话开始时下发 {"type":"run","id":...}，客户端发送 {"type":"cancel","id":...} 可取消该运行：
+// 中断 AI 请求并终止正在执行的命令，结束时下发 {"type":"run_end","id":...,"status":"done|cancelled"}
+//
+// 自动执行策略要求确认的命令下发 {"type":"approval_request","id":...,"run":...,"command":...,"reason":...,"policy":...,"timeout":秒}，
+// Agent 暂停直到客户端回复 {"type":"approval_response","id":...,"approved":true|false}；超时（autoexec.approval_timeout，
+// 默认 120 秒）下发 {"type":"approval_expired","id":...} 并视为拒绝，拒绝的命令以 "User denied." 告知模型。只读命令照常自动执行，
+// 确认需要 chat:exec 权限（配置的管理员拥有全部权限），没有权限时需要确认的命令直接跳过
+//
+// ?stream=1 时回答以流式下发：生成过程中推送 {"type":"answer_delta","content":...} 增量，
+// 每轮结束推送 {"type":"answer_done","content":...} 完整回答（为空时保留已收到的增量）；
+// 模型或接口不支持流式响应时仍下发 {"type":"answer"}
 func handleWSChat(w http.ResponseWriter, r *http.Request) {
 	// 升级 HTTP 连接为 WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -565,58 +588,219 @@ func handleWSChat(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 	
-	// 初始化对话上下文
+	// 限流按用户区分：优先使用认证用户名，否则使用客户端地址
+	user := requestUser(r)
+	session := &chatSession{user: user, conn: conn}
+	stream := r.URL.Query().Get("stream") != ""
+	// 对话记录用于事件复盘包，引用了巡检事件的会话会被打包
+	transcript := incident.DefaultTranscripts.Session(incident.SourceWeb, user)
+	
+	// 初始化对话上下文；认证用户的对话保存到对话历史，?conversation={id} 继续已有对话
 	messages := agent.GetBaseMessages()
+	if _, history := attachConversation(r, session, transcript); len(history) > 0 {
+		messages = append(messages, history...)
+	}
+
+	// 读协程：Agent 运行期间也要能收到取消帧；连接断开时取消正在执行的运行，避免命令在后台继续运行
+	inputs := make(chan string, 8)
+	go func() {
+		defer close(inputs)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				session.cancelRun("", "连接断开")
+				return
+			}
+			if control, ok := parseChatControl(msg); ok {
+				switch control.Type {
+				case "cancel":
+					if !session.cancelRun(control.ID, "用户取消") {
+						session.send(map[string]string{"type": "status", "id": control.ID, "content": "没有正在执行的任务"})
+					}
+				case "approval_response":
+					if !session.resolveApproval(control.ID, control.Approved) {
+						session.send(map[string]string{"type": "status", "id": control.ID, "content": "没有待确认的命令（可能已超时）"})
+					}
+				}
+				continue
+			}
+			select {
+			case inputs <- string(msg):
+			default:
+				session.send(map[string]string{"type": "answer", "content": "⏳ 上一条指令仍在执行，请稍候或先取消"})
+			}
+		}
+	}()
 	
-	// 持续监听客户端消息
-	for {
-		_, msg, err := conn.ReadMessage()
-		if err != nil { break }
-		
-		input := string(msg)
-		
+	// 持续处理客户端消息
+	for input := range inputs {
+		transcript.Record(incident.RoleUser, input)
+
+		// 0. 斜杠命令直接执行，不经过 AI；未知命令给出相近的命令而不是交给 AI
+		if slash.IsCommand(input) {
+			ctx := slash.WithActor(r.Context(), requestActor(r))
+			result, err := SlashCommands.Dispatch(ctx, input, slashAuthorizer(r))
+			if err != nil {
+				session.send(map[string]string{"type": "answer", "content": slashMessage(err)})
+			} else {
+				content := result.Markdown()
+				transcript.Record(incident.RoleOutput, content)
+				session.send(map[string]interface{}{"type": "command", "result": result, "content": content})
+			}
+			session.send(map[string]string{"type": "status", "content": "等待指令..."})
+			continue
+		}
+
 		// 1. 尝试静态响应（最快）
 		staticResp := agent.CheckStaticResponse(input)
 		if staticResp != "" {
-			conn.WriteJSON(map[string]string{"type": "answer", "content": staticResp})
-			conn.WriteJSON(map[string]string{"type": "status", "content": "等待指令..."})
+			transcript.Record(incident.RoleAssistant, staticResp)
+			session.send(map[string]string{"type": "answer", "content": staticResp})
+			session.send(map[string]string{"type": "status", "content": "等待指令..."})
 			continue
 		}
 		
 		// 2. 尝试快速命令执行
 		quickCmd := agent.GetQuickCommand(input)
 		if quickCmd != "" {
-			conn.WriteJSON(map[string]string{"type": "status", "content": "⚡ 快速执行: " + quickCmd})
-			output := utils.ExecuteShell(quickCmd)
+			session.send(map[string]string{"type": "status", "content": "⚡ 快速执行: " + quickCmd})
+			res := utils.RunShellContext(r.Context(), quickCmd)
+			auditCommand(r, res)
+			output := res.Combined()
 			if strings.TrimSpace(output) == "" { output = "(No output)" }
+			transcript.Record(incident.RoleCommand, quickCmd)
+			transcript.Record(incident.RoleOutput, output)
 			finalOutput := fmt.Sprintf("```\n%s\n```", output)
-			conn.WriteJSON(map[string]string{"type": "answer", "content": finalOutput})
-			conn.WriteJSON(map[string]string{"type": "status", "content": "等待指令..."})
+			session.send(map[string]string{"type": "answer", "content": finalOutput})
+			session.send(map[string]string{"type": "status", "content": "等待指令..."})
 			continue
 		}
 		
 		// 3. AI 智能对话（最慢但最强大）
+		if !agent.Enabled() {
+			session.send(map[string]string{"type": "answer", "content": "⚠️ " + agent.ErrAIDisabled.Error()})
+			session.send(map[string]string{"type": "status", "content": "等待指令..."})
+			continue
+		}
+
+		// 先做速率限制，再申请 Agent 执行槽位，避免单个用户耗尽 AI 配额
+		if err := agent.DefaultLimiter.Allow(user); err != nil {
+			session.send(map[string]string{"type": "answer", "content": rateLimitMessage(err)})
+			session.send(map[string]string{"type": "status", "content": "等待指令..."})
+			continue
+		}
+
+		// 排队期间也可以取消
+		ctx, run := session.startRun(r.Context())
+		session.send(map[string]string{"type": "run", "id": run.id, "status": "started"})
+		release, err := agent.DefaultLimiter.Acquire(ctx, user, agent.PriorityInteractive, func(position int) {
+			session.send(map[string]string{"type": "status", "id": run.id, "content": fmt.Sprintf("⏳ Agent 繁忙，已排队，当前第 %d 位", position)})
+		})
+		if err != nil {
+			session.send(map[string]string{"type": "answer", "id": run.id, "content": rateLimitMessage(err)})
+			finishChatRun(session, run)
+			continue
+		}
+
+		// Agent 工具按调用者权限执行，部署记录发起人
+		ctx = container.WithRequester(agent.WithPermissions(ctx, requestPermissions(r)), user)
+		// 对话中执行的每条命令都写入操作审计
+		ctx = agent.WithCommandObserver(ctx, func(res *utils.ShellResult) { auditCommand(r, res) })
+		// 需要确认的命令通过 WebSocket 请求用户确认，没有 chat:exec 权限（如未启用认证）时仍然跳过
+		if requestPermissions(r)(PermissionChatExec) {
+			runID := run.id
+			ctx = agent.WithApprover(ctx, func(ctx context.Context, req agent.CommandApproval) bool {
+				return session.requestApproval(ctx, runID, req)
+			})
+		}
+
 		enhancedInput := input + " (Context: Current Linux Server)"
 		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: enhancedInput})
+		recorded := len(messages)
 		
 		// 最多执行 5 轮对话（防止无限循环）
-		for i := 0; i < 5; i++ {
-			conn.WriteJSON(map[string]string{"type": "status", "content": "🤖 思考中..."})
+		for i := 0; i < 5 && ctx.Err() == nil; i++ {
+			session.send(map[string]string{"type": "status", "id": run.id, "content": "🤖 思考中..."})
 			
-			// 处理 AI 响应，实时推送日志
-			respMsg, cont := agent.ProcessAgentStepForWeb(&messages, func(log string) {
-				conn.WriteJSON(map[string]string{"type": "log", "content": log})
+			// 处理 AI 响应，实时推送日志；命令被取消时推送已产生的部分输出
+			streamed := false
+			var onDelta func(string)
+			if stream {
+				onDelta = func(delta string) {
+					streamed = true
+					session.send(map[string]string{"type": "answer_delta", "id": run.id, "content": delta})
+				}
+			}
+			respMsg, cont := agent.ProcessAgentStepStream(ctx, &messages, onDelta, func(log string) {
+				session.send(map[string]string{"type": "log", "id": run.id, "content": log})
+			}, func(partial string) {
+				session.send(map[string]string{"type": "partial", "id": run.id, "content": partial})
 			})
+			transcript.RecordMessages(messages[recorded:])
+			recorded = len(messages)
 			
-			if respMsg.Content != "" {
-				conn.WriteJSON(map[string]string{"type": "answer", "content": respMsg.Content})
+			if streamed {
+				session.send(map[string]string{"type": "answer_done", "id": run.id, "content": respMsg.Content})
+			} else if respMsg.Content != "" {
+				session.send(map[string]string{"type": "answer", "id": run.id, "content": respMsg.Content})
 			}
 			
 			// 如果 AI 表示完成，退出循环
 			if !cont { break }
 		}
-		
-		conn.WriteJSON(map[string]string{"type": "status", "content": "等待指令..."})
+		release()
+		finishChatRun(session, run)
+	}
+}
+
+// finishChatRun 结束 Agent 运行并通知客户端运行结果
+func finishChatRun(session *chatSession, run *chatRun) {
+	status := "done"
+	if session.finishRun(run) {
+		status = "cancelled"
+		session.send(map[string]string{"type": "answer", "id": run.id, "content": "⏹️ 已取消"})
+	}
+	session.send(map[string]string{"type": "run_end", "id": run.id, "status": status})
+	session.send(map[string]string{"type": "status", "content": "等待指令..."})
+}
+
+// requestUser 获取请求用户标识：认证用户名（API 令牌为其所属用户），未认证时为客户端地址（经可信代理转发时为真实地址）
+func requestUser(r *http.Request) string {
+	if token := requestToken(r); token != nil {
+		return token.Owner
+	}
+	if user, ok := authUser(r); ok {
+		return user
+	}
+	return realip.FromRequest(r)
+}
+
+// requestActor 审计日志中的操作者：用户名（使用 API 令牌时附带令牌名称）和客户端地址
+func requestActor(r *http.Request) string {
+	ip := realip.FromRequest(r)
+	if token := requestToken(r); token != nil {
+		return fmt.Sprintf("%s via token %q (%s)", token.Owner, token.Name, ip)
+	}
+	if user, ok := authUser(r); ok {
+		return user + " (" + ip + ")"
+	}
+	return ip
+}
+
+// rateLimitMessage 将限流错误转换为友好提示
+func rateLimitMessage(err error) string {
+	var rateErr *agent.RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		seconds := int(rateErr.RetryAfter.Seconds()) + 1
+		if rateErr.Scope == "global" {
+			return fmt.Sprintf("⏳ AI 服务当前请求较多，请 %d 秒后再试", seconds)
+		}
+		return fmt.Sprintf("⏳ 提问太频繁了，请 %d 秒后再试", seconds)
+	case errors.Is(err, agent.ErrQueueFull):
+		return "⏳ Agent 繁忙且排队已满，请稍后再试"
+	default:
+		return "⚠️ 请求已取消: " + err.Error()
 	}
 }
 
@@ -624,14 +808,72 @@ func handleWSChat(w http.ResponseWriter, r *http.Request) {
 // 通用 API 处理器
 // ============================================
 
+// handleAIStatus 获取 AI 限流状态（活跃会话、排队情况、令牌余量）
+func handleAIStatus(w http.ResponseWriter, r *http.Request) {
+	status := aiStatusResponse{Enabled: agent.Enabled(), LimiterStatus: agent.DefaultLimiter.Status()}
+	if !status.Enabled {
+		status.Message = agent.ErrAIDisabled.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// aiStatusResponse AI 后端状态：是否启用及限流器状态
+type aiStatusResponse struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	agent.LimiterStatus
+}
+
 // handleLogs 获取系统日志
+// 不带参数时返回内存中的最近日志；?since=&level=&limit= 查询持久化的结构化日志（包括轮转文件），返回 {"entries": [...]}
+// since 为 RFC3339 时间或 Unix 秒，level 为最低级别（debug、info、warn、error）
 func handleLogs(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(logger.GetWebLogs())
+	values := r.URL.Query()
+	if !values.Has("since") && !values.Has("level") && !values.Has("limit") {
+		json.NewEncoder(w).Encode(logger.GetWebLogs())
+		return
+	}
+	since, err := parseEventTime(values.Get("since"))
+	if err != nil {
+		writeError(w, r, requiredField("since", "since must be an RFC3339 time or unix seconds"))
+		return
+	}
+	limit := 0
+	if value := values.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeError(w, r, requiredField("limit", "limit must be a positive integer"))
+			return
+		}
+	}
+	entries, err := logger.Query(since, values.Get("level"), limit)
+	if errors.Is(err, logger.ErrInvalidLevel) {
+		writeError(w, r, requiredField("level", "level must be one of debug, info, warn, error"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if entries == nil {
+		entries = []logger.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
 }
 
 // handleStats 获取监控统计数据
-// 返回最近 60 个数据点（2 分钟历史）
+// 返回最近 60 个数据点（2 分钟历史）；?host= 指定远程主机时返回该主机的数据，主机不存在时返回 404
 func handleStats(w http.ResponseWriter, r *http.Request) {
+	if host := r.URL.Query().Get("host"); isRemoteHost(host) {
+		history, err := remoteStatsHistory(r.Context(), host)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		json.NewEncoder(w).Encode(history)
+		return
+	}
 	statsCache.RLock()
 	defer statsCache.RUnlock()
 	
@@ -645,6 +887,7 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 // handleTrigger 手动触发巡检和状态推送
 // 异步执行，立即返回响应
 func handleTrigger(w http.ResponseWriter, r *http.Request) {
+	logger.Info("[AUDIT] 🔍 手动触发巡检 by %s", requestActor(r))
 	if TriggerPatrolFunc != nil { 
 		go TriggerPatrolFunc() 
 	}
@@ -663,152 +906,6 @@ func WebLog(msg string) {
 // 文件管理 API 处理器（在 files.go 中实现）
 // ============================================
 
-// ============================================
-// 系统巡检功能
-// ============================================
-
-// performPatrol 执行系统巡检
-// 检查项目：磁盘使用、系统负载、OOM 日志、僵尸进程、自定义规则、HTTP 服务
-// 发现异常时调用 AI 分析并推送告警
-func performPatrol() {
-	logger.Info("正在执行系统巡检...")
-	var anomalies []string
-
-	// 1. 磁盘使用率检查（过滤虚拟设备）
-	diskOut := utils.ExecuteShell("df -h")
-	diskLines := strings.Split(diskOut, "\n")
-
-	for _, line := range diskLines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "Filesystem") {
-			continue
-		}
-
-		// 解析字段
-		fields := strings.Fields(line)
-		if len(fields) < 5 {
-			continue
-		}
-		
-		device := fields[0]
-		mountPoint := fields[len(fields)-1]
-		
-		// 严格过滤：检查设备名和挂载点
-		if isIgnoredDisk(line, device, mountPoint) {
-			continue
-		}
-
-		// 解析使用率
-		useStr := strings.TrimSuffix(fields[4], "%")
-		usePct, err := strconv.Atoi(useStr)
-		if err == nil && usePct > 85 {
-			// 只有非 loop 设备且使用率 > 85% 才报警
-			anomalies = append(anomalies, fmt.Sprintf("**磁盘告警 (%s)**:\n```\n%s\n```", fields[0], line))
-		}
-	}
-
-	// 2. 系统负载检查（1分钟负载 > 4.0 时告警）
-	if out := utils.ExecuteShell("uptime | awk -F'load average:' '{ print $2 }' | awk '{ if ($1 > 4.0) print $0 }'"); strings.TrimSpace(out) != "" && !strings.Contains(out, "exit status") {
-		anomalies = append(anomalies, "**高负载**:\n```\n"+strings.TrimSpace(out)+"\n```")
-	}
-
-	// 3. OOM（内存溢出）日志检查
-	dmesgOut := utils.ExecuteShell("dmesg | grep -i 'out of memory' | tail -n 5")
-	if !strings.Contains(dmesgOut, "Operation not permitted") && !strings.Contains(dmesgOut, "不允许的操作") && strings.TrimSpace(dmesgOut) != "" && !strings.Contains(dmesgOut, "exit status") {
-		anomalies = append(anomalies, "**OOM日志**:\n```\n"+strings.TrimSpace(dmesgOut)+"\n```")
-	}
-
-	// 4. 僵尸进程检查（状态为 Z 的进程）
-	rawZombies := utils.ExecuteShell("ps -A -o stat,ppid,pid,cmd | awk '$1 ~ /^[Zz]/'")
-	if strings.TrimSpace(rawZombies) != "" && !strings.Contains(rawZombies, "exit status") {
-		detailZombie := "STAT    PPID     PID CMD\n" + rawZombies
-		anomalies = append(anomalies, "**僵尸进程**:\n```\n"+strings.TrimSpace(detailZombie)+"\n```")
-	}
-
-	// 5. 自定义巡检规则（从配置文件读取）
-	for _, rule := range config.GlobalConfig.PatrolRules {
-		out := utils.ExecuteShell(rule.Command)
-		if strings.TrimSpace(out) != "" && !strings.Contains(out, "exit status") {
-			logger.Info(fmt.Sprintf("⚠️ 触发自定义规则: %s", rule.Name))
-			anomalies = append(anomalies, fmt.Sprintf("**%s**:\n```\n%s\n```", rule.Name, strings.TrimSpace(out)))
-		}
-	}
-
-	// 6. HTTP 服务健康检查
-	httpResults := monitor.RunChecks()
-	for _, res := range httpResults {
-		if !res.Success {
-			logger.Info(fmt.Sprintf("⚠️ HTTP 监控失败: %s", res.Name))
-			anomalies = append(anomalies, fmt.Sprintf("**HTTP异常 (%s)**:\n%s", res.Name, res.Error))
-		}
-	}
-
-	// 过滤掉虚拟设备相关的告警（避免误报）
-	var cleanedAnomalies []string
-	for _, anomaly := range anomalies {
-		if !strings.Contains(anomaly, "/dev/loop") && 
-		   !strings.Contains(anomaly, "/snap") && 
-		   !strings.Contains(anomaly, "snap/") &&
-		   !strings.Contains(anomaly, "/hostfs") &&
-		   !strings.Contains(anomaly, "overlay") &&
-		   !strings.Contains(anomaly, "tmpfs") {
-			cleanedAnomalies = append(cleanedAnomalies, anomaly)
-		}
-	}
-
-	// 如果发现异常，调用 AI 分析并推送告警
-	if len(cleanedAnomalies) > 0 {
-		report := strings.Join(cleanedAnomalies, "\n")
-		logger.Info("🚨 发现异常，正在请求 AI 分析...")
-		
-		// 调用 AI 分析异常原因和解决方案
-		analysis := agent.AnalyzeWithAI(report)
-		analysis = cleanAIAnalysis(analysis)
-
-		// 组装告警消息并推送
-		alertMsg := fmt.Sprintf("🚨 **系统告警** [%s]\n\n%s\n\n💡 **处理建议**:\n%s", utils.GetHostname(), report, analysis)
-		notify.Send("系统告警", alertMsg)
-		logger.Info("告警已推送")
-	} else {
-		logger.Info("✔ 系统健康")
-	}
-}
-
-// isIgnoredDisk 判断是否应该忽略该磁盘设备
-// 过滤虚拟设备和临时文件系统，避免误报
-func isIgnoredDisk(line, device, mountPoint string) bool {
-	// 检查设备名：过滤所有 loop 设备（虚拟块设备）
-	if strings.Contains(device, "/dev/loop") || strings.Contains(device, "loop") {
-		return true
-	}
-	
-	// 检查挂载点：过滤 snap 相关路径（Ubuntu snap 包）
-	if strings.Contains(mountPoint, "/snap") || 
-	   strings.Contains(mountPoint, "snap/") ||
-	   strings.Contains(mountPoint, "/hostfs") {
-		return true
-	}
-	
-	// 检查整行：过滤虚拟文件系统
-	if strings.Contains(line, "tmpfs") ||      // 临时文件系统
-	   strings.Contains(line, "overlay") ||    // Docker overlay 文件系统
-	   strings.Contains(line, "cdrom") ||      // 光驱
-	   strings.Contains(line, "efivarfs") {    // EFI 变量文件系统
-		return true
-	}
-	
-	return false
-}
-
-// cleanAIAnalysis 清理 AI 分析结果
-// 标记已过滤的虚拟设备，避免用户混淆
-func cleanAIAnalysis(analysis string) string {
-	analysis = strings.Replace(analysis, "/dev/loop", "[排除] /dev/loop", -1)
-	analysis = strings.Replace(analysis, "/snap", "[排除] /snap", -1)
-	analysis = strings.Replace(analysis, "overlay", "[排除] overlay", -1)
-	return analysis
-}
-
 // ============================================
 // 网站管理 API
 // ============================================
@@ -817,17 +914,15 @@ func cleanAIAnalysis(analysis string) string {
 func handleWebsites(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// 获取网站列表
-		websitesStore.RLock()
-		defer websitesStore.RUnlock()
-		
-		// 确保返回数组格式，即使为空也返回 []
-		if websitesStore.Websites == nil {
-			websitesStore.Websites = []Website{}
+		// 获取网站列表，为空时返回 []
+		sites, err := listWebsites()
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(websitesStore.Websites)
-		
+		json.NewEncoder(w).Encode(sites)
+
 	case http.MethodPost:
 		// 创建新网站
 		var form struct {
@@ -836,32 +931,41 @@ func handleWebsites(w http.ResponseWriter, r *http.Request) {
 			SSLEnabled  bool   `json:"ssl_enabled"`
 			LoadBalance string `json:"load_balance"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
+
 		// 参数验证
 		if form.Domain == "" {
-			http.Error(w, "Domain is required", http.StatusBadRequest)
+			writeError(w, r, requiredField("domain", "Domain is required"))
 			return
 		}
-		
-		websitesStore.Lock()
-		defer websitesStore.Unlock()
-		
+		if !websiteDomain.MatchString(form.Domain) {
+			writeError(w, r, errInvalidDomain)
+			return
+		}
+
+		db, err := dashboardDB()
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
 		// 检查域名是否已存在
-		for _, site := range websitesStore.Websites {
-			if site.Domain == form.Domain {
-				http.Error(w, "Domain already exists", http.StatusConflict)
-				return
-			}
+		var n int64
+		if err := db.Model(&Website{}).Where("domain = ?", form.Domain).Count(&n).Error; err != nil {
+			writeError(w, r, err)
+			return
 		}
-		
-		// 创建新网站
+		if n > 0 {
+			writeError(w, r, errWebsiteExists)
+			return
+		}
+
+		// 创建新网站，ID 由数据库自增分配
 		newWebsite := Website{
-			ID:          websitesStore.NextID,
 			Domain:      form.Domain,
 			BackendURL:  form.BackendURL,
 			SSLEnabled:  form.SSLEnabled,
@@ -869,15 +973,29 @@ func handleWebsites(w http.ResponseWriter, r *http.Request) {
 			LoadBalance: form.LoadBalance,
 			CreatedAt:   time.Now().Format(time.RFC3339),
 		}
-		
-		websitesStore.NextID++
-		websitesStore.Websites = append(websitesStore.Websites, newWebsite)
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(newWebsite)
-		
+		if r.URL.Query().Get("dry_run") == "true" {
+			writeNginxPreview(w, r, &newWebsite)
+			return
+		}
+
+		// 先写入并校验 nginx 配置，失败时不保存网站记录
+		if err := applyWebsiteNginx(r.Context(), &newWebsite); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := db.Create(&newWebsite).Error; err != nil {
+			if rerr := removeWebsiteNginx(r.Context(), newWebsite.Domain); rerr != nil {
+				logger.Info("❌ 删除网站 %s 的 nginx 配置失败: %v", newWebsite.Domain, rerr)
+			}
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newWebsite)
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -887,46 +1005,42 @@ func handleWebsiteDetail(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/websites/")
 	parts := strings.Split(path, "/")
 	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "Website ID is required", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Website ID is required")
 		return
 	}
-	
+
 	idStr := parts[0]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid website ID", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid website ID")
 		return
 	}
-	
+
 	// 检查是否是SSL操作
 	if len(parts) >= 3 && parts[1] == "ssl" {
 		handleWebsiteSSL(w, r, id, parts[2])
 		return
 	}
-	
-	websitesStore.Lock()
-	defer websitesStore.Unlock()
-	
-	// 查找网站
-	index := -1
-	for i, site := range websitesStore.Websites {
-		if site.ID == id {
-			index = i
-			break
-		}
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	
-	if index == -1 {
-		http.Error(w, "Website not found", http.StatusNotFound)
+
+	// 查找网站
+	site, err := findRecord[Website](db, id, errWebsiteNotFound)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	
+
 	switch r.Method {
 	case http.MethodGet:
 		// 获取网站详情
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(websitesStore.Websites[index])
-		
+		json.NewEncoder(w).Encode(site)
+
 	case http.MethodPut:
 		// 更新网站
 		var form struct {
@@ -935,118 +1049,160 @@ func handleWebsiteDetail(w http.ResponseWriter, r *http.Request) {
 			SSLEnabled  *bool   `json:"ssl_enabled"`
 			LoadBalance *string `json:"load_balance"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
+
 		// 更新字段
+		previous := *site
 		if form.Enabled != nil {
-			websitesStore.Websites[index].Enabled = *form.Enabled
+			site.Enabled = *form.Enabled
 		}
 		if form.BackendURL != nil {
-			websitesStore.Websites[index].BackendURL = *form.BackendURL
+			site.BackendURL = *form.BackendURL
 		}
 		if form.SSLEnabled != nil {
-			websitesStore.Websites[index].SSLEnabled = *form.SSLEnabled
+			site.SSLEnabled = *form.SSLEnabled
 		}
 		if form.LoadBalance != nil {
-			websitesStore.Websites[index].LoadBalance = *form.LoadBalance
+			site.LoadBalance = *form.LoadBalance
 		}
-		
+		if r.URL.Query().Get("dry_run") == "true" {
+			writeNginxPreview(w, r, site)
+			return
+		}
+
+		// 启用时重新生成配置，停用时删除配置；nginx 拒绝新配置时不保存修改
+		if err := applyWebsiteNginx(r.Context(), site); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := db.Save(site).Error; err != nil {
+			if rerr := applyWebsiteNginx(r.Context(), &previous); rerr != nil {
+				logger.Info("❌ 恢复网站 %s 的 nginx 配置失败: %v", site.Domain, rerr)
+			}
+			writeError(w, r, err)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(websitesStore.Websites[index])
-		
+		json.NewEncoder(w).Encode(site)
+
 	case http.MethodDelete:
-		// 删除网站
-		websitesStore.Websites = append(websitesStore.Websites[:index], websitesStore.Websites[index+1:]...)
+		// 删除网站，先删除 nginx 配置并重载
+		if err := removeWebsiteNginx(r.Context(), site.Domain); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := db.Delete(&Website{}, id).Error; err != nil {
+			if rerr := applyWebsiteNginx(r.Context(), site); rerr != nil {
+				logger.Info("❌ 恢复网站 %s 的 nginx 配置失败: %v", site.Domain, rerr)
+			}
+			writeError(w, r, err)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
 // handleWebsiteSSL 处理SSL证书管理请求
 func handleWebsiteSSL(w http.ResponseWriter, r *http.Request, id int, action string) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
-	
-	websitesStore.Lock()
-	defer websitesStore.Unlock()
-	
-	// 查找网站
-	index := -1
-	for i, site := range websitesStore.Websites {
-		if site.ID == id {
-			index = i
-			break
-		}
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	
-	if index == -1 {
-		http.Error(w, "Website not found", http.StatusNotFound)
+
+	// 查找网站
+	site, err := findRecord[Website](db, id, errWebsiteNotFound)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	
+
+	var message string
 	switch action {
 	case "apply":
-		// 申请SSL证书（模拟）
-		websitesStore.Websites[index].SSLEnabled = true
-		// 设置证书有效期（模拟：1年后过期）
-		expiry := time.Now().AddDate(1, 0, 0)
-		websitesStore.Websites[index].SSLCertExpiry = expiry.Format(time.RFC3339)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "SSL证书申请成功"})
-		
+		message = "SSL证书申请成功"
+
 	case "renew":
-		// 续期SSL证书（模拟）
-		if !websitesStore.Websites[index].SSLEnabled {
-			http.Error(w, "SSL is not enabled for this website", http.StatusBadRequest)
+		if !site.SSLEnabled {
+			respondError(w, r, http.StatusBadRequest, "SSL is not enabled for this website")
 			return
 		}
-		// 更新证书有效期（模拟：1年后过期）
-		expiry := time.Now().AddDate(1, 0, 0)
-		websitesStore.Websites[index].SSLCertExpiry = expiry.Format(time.RFC3339)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "SSL证书续期成功"})
-		
+		message = "SSL证书续期成功"
+
 	default:
-		http.Error(w, "Invalid SSL action", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid SSL action")
+		return
+	}
+
+	// 通过 ACME 签发证书，成功后重新生成 nginx 配置启用 HTTPS
+	service := certificateService()
+	if service == nil {
+		writeError(w, r, errCertificatesUnavailable)
+		return
+	}
+	cert, err := issueWebsiteCertificate(r.Context(), service, site, action)
+	if err != nil {
+		logger.Info("[AUDIT] ❌ 网站 %s 的证书 %s 失败 by %s: %v", site.Domain, action, requestActor(r), err)
+		writeError(w, r, err)
+		return
+	}
+
+	previous := *site
+	site.SSLEnabled = true
+	site.SSLCertExpiry = cert.ExpiryDate.Format(time.RFC3339)
+	if err := applyWebsiteNginx(r.Context(), site); err != nil {
+		writeError(w, r, err)
+		return
 	}
+	if err := db.Save(site).Error; err != nil {
+		if rollback := applyWebsiteNginx(r.Context(), &previous); rollback != nil {
+			logger.Info("❌ 恢复网站 %s 的 nginx 配置失败: %v", site.Domain, rollback)
+		}
+		writeError(w, r, err)
+		return
+	}
+	logger.Info("[AUDIT] 🔒 网站 %s %s，有效期至 %s by %s", site.Domain, message, site.SSLCertExpiry, requestActor(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": message, "ssl_cert_expiry": site.SSLCertExpiry})
 }
 
 // ============================================
 // 用户管理 API
 // ============================================
 
-// handleUsers 处理用户列表和创建请求
+// handleUsers 处理用户列表和创建请求，返回的用户不包含密码
 func handleUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		// 获取用户列表
-		usersStore.RLock()
-		defer usersStore.RUnlock()
-		
-		// 创建返回列表，排除密码字段
-		users := make([]map[string]interface{}, len(usersStore.Users))
-		for i, user := range usersStore.Users {
-			users[i] = map[string]interface{}{
-				"id":         user.ID,
-				"username":   user.Username,
-				"email":      user.Email,
-				"roles":      user.Roles,
-				"enabled":    user.Enabled,
-				"created_at": user.CreatedAt,
-			}
+		users := []User{}
+		if err := db.Order("id").Find(&users).Error; err != nil {
+			writeError(w, r, err)
+			return
 		}
 		json.NewEncoder(w).Encode(users)
-		
+
 	case http.MethodPost:
 		// 创建新用户
 		var form struct {
@@ -1056,60 +1212,53 @@ func handleUsers(w http.ResponseWriter, r *http.Request) {
 			Roles    []string `json:"roles"`
 			Enabled  bool     `json:"enabled"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
+
 		// 参数验证
 		if form.Username == "" {
-			http.Error(w, "Username is required", http.StatusBadRequest)
+			writeError(w, r, requiredField("username", "Username is required"))
 			return
 		}
 		if form.Email == "" {
-			http.Error(w, "Email is required", http.StatusBadRequest)
+			writeError(w, r, requiredField("email", "Email is required"))
 			return
 		}
-		
-		usersStore.Lock()
-		defer usersStore.Unlock()
-		
+
+		userWrites.Lock()
+		defer userWrites.Unlock()
+
 		// 检查用户名是否已存在
-		for _, u := range usersStore.Users {
-			if u.Username == form.Username {
-				http.Error(w, "Username already exists", http.StatusConflict)
-				return
-			}
+		if _, ok := findUser(form.Username); ok {
+			writeError(w, r, errUsernameExists)
+			return
 		}
-		
-		// 创建新用户
+
+		// 创建新用户，ID 由数据库从 1 开始自增分配，0 保留给系统用户
 		newUser := User{
-			ID:        usersStore.NextID,
 			Username:  form.Username,
 			Email:     form.Email,
-			Password:  form.Password, // 实际应用中应该加密
 			Roles:     form.Roles,
 			Enabled:   form.Enabled,
 			CreatedAt: time.Now().Format(time.RFC3339),
 		}
-		
-		usersStore.NextID++
-		usersStore.Users = append(usersStore.Users, newUser)
-		
-		// 返回用户（不包含密码）
-		response := map[string]interface{}{
-			"id":         newUser.ID,
-			"username":   newUser.Username,
-			"email":      newUser.Email,
-			"roles":      newUser.Roles,
-			"enabled":    newUser.Enabled,
-			"created_at": newUser.CreatedAt,
-		}
-		json.NewEncoder(w).Encode(response)
-		
+		if form.Password != "" {
+			if newUser.Password, err = hashPassword(form.Password); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+		if err := db.Create(&newUser).Error; err != nil {
+			writeError(w, r, err)
+			return
+		}
+		json.NewEncoder(w).Encode(newUser)
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -1117,56 +1266,46 @@ func handleUsers(w http.ResponseWriter, r *http.Request) {
 func handleUserDetail(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/users/")
 	parts := strings.Split(path, "/")
-	
+
 	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "User ID is required")
 		return
 	}
-	
+
 	idStr := parts[0]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
-	
+
 	// 检查是否是权限管理操作
 	if len(parts) >= 2 && parts[1] == "permissions" {
 		handleUserPermissions(w, r, id)
 		return
 	}
-	
-	usersStore.Lock()
-	defer usersStore.Unlock()
-	
-	// 查找用户
-	index := -1
-	for i, user := range usersStore.Users {
-		if user.ID == id {
-			index = i
-			break
-		}
+
+	userWrites.Lock()
+	defer userWrites.Unlock()
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	
-	if index == -1 {
-		http.Error(w, "User not found", http.StatusNotFound)
+
+	// 查找用户
+	user, err := findRecord[User](db, id, errUserNotFound)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	
+
 	switch r.Method {
 	case http.MethodGet:
 		// 获取用户详情
-		user := usersStore.Users[index]
-		response := map[string]interface{}{
-			"id":         user.ID,
-			"username":   user.Username,
-			"email":      user.Email,
-			"roles":      user.Roles,
-			"enabled":    user.Enabled,
-			"created_at": user.CreatedAt,
-		}
-		json.NewEncoder(w).Encode(response)
-		
+		json.NewEncoder(w).Encode(user)
+
 	case http.MethodPut:
 		// 更新用户
 		var form struct {
@@ -1176,77 +1315,89 @@ func handleUserDetail(w http.ResponseWriter, r *http.Request) {
 			Roles    *[]string `json:"roles"`
 			Enabled  *bool     `json:"enabled"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
+
 		// 更新字段
-		if form.Username != nil {
-			usersStore.Users[index].Username = *form.Username
+		if form.Username != nil && *form.Username != user.Username {
+			if _, ok := findUser(*form.Username); ok {
+				writeError(w, r, errUsernameExists)
+				return
+			}
+			user.Username = *form.Username
 		}
 		if form.Email != nil {
-			usersStore.Users[index].Email = *form.Email
+			user.Email = *form.Email
 		}
 		if form.Password != nil {
-			usersStore.Users[index].Password = *form.Password
+			// 空密码表示不能用用户名密码登录
+			user.Password = ""
+			if *form.Password != "" {
+				if user.Password, err = hashPassword(*form.Password); err != nil {
+					writeError(w, r, err)
+					return
+				}
+			}
 		}
 		if form.Roles != nil {
-			usersStore.Users[index].Roles = *form.Roles
+			user.Roles = *form.Roles
 		}
 		if form.Enabled != nil {
-			usersStore.Users[index].Enabled = *form.Enabled
+			user.Enabled = *form.Enabled
 		}
-		
-		user := usersStore.Users[index]
-		response := map[string]interface{}{
-			"id":         user.ID,
-			"username":   user.Username,
-			"email":      user.Email,
-			"roles":      user.Roles,
-			"enabled":    user.Enabled,
-			"created_at": user.CreatedAt,
-		}
-		json.NewEncoder(w).Encode(response)
-		
+		if err := db.Save(user).Error; err != nil {
+			writeError(w, r, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+
 	case http.MethodDelete:
-		// 删除用户
-		usersStore.Users = append(usersStore.Users[:index], usersStore.Users[index+1:]...)
-		w.WriteHeader(http.StatusNoContent)
-		
+		// 删除用户：资源转给 ?transfer_to 指定的用户，或 ?orphan=acknowledge 确认转给系统用户
+		to, orphan, err := userDeleteTarget(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		result, err := deleteUser(r.Context(), db, *user, to, orphan, requestActor(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
 // handleUserPermissions 处理用户权限管理
 func handleUserPermissions(w http.ResponseWriter, r *http.Request, id int) {
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		// 获取用户权限列表
-		usersStore.RLock()
-		defer usersStore.RUnlock()
-		
-		// 查找用户
-		var user *User
-		for i := range usersStore.Users {
-			if usersStore.Users[i].ID == id {
-				user = &usersStore.Users[i]
-				break
-			}
-		}
-		
-		if user == nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+		user, err := findRecord[User](db, id, errUserNotFound)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
-		
-		// 根据用户的角色，返回所有权限
+
+		// 用户角色权限的并集，* 和 <资源>:* 展开为具体的权限
+		has := ownerPermissions(user.Username)
 		userPermissions := []map[string]interface{}{}
 		for _, perm := range permissionsStore {
-			// 简化处理：如果用户有角色，就返回所有权限
-			// 实际应用中应该根据角色关联的权限来返回
+			if !has(perm.Resource + ":" + perm.Action) {
+				continue
+			}
 			userPermissions = append(userPermissions, map[string]interface{}{
 				"resource":    perm.Resource,
 				"action":      perm.Action,
@@ -1254,41 +1405,30 @@ func handleUserPermissions(w http.ResponseWriter, r *http.Request, id int) {
 			})
 		}
 		json.NewEncoder(w).Encode(userPermissions)
-		
+
 	case http.MethodPut:
 		// 更新用户权限
 		var form struct {
 			Permissions []string `json:"permissions"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
-		usersStore.Lock()
-		defer usersStore.Unlock()
-		
+
 		// 查找用户
-		index := -1
-		for i, u := range usersStore.Users {
-			if u.ID == id {
-				index = i
-				break
-			}
-		}
-		
-		if index == -1 {
-			http.Error(w, "User not found", http.StatusNotFound)
+		if _, err := findRecord[User](db, id, errUserNotFound); err != nil {
+			writeError(w, r, err)
 			return
 		}
-		
+
 		// 这里简化处理，实际应该更新用户的权限关联
 		// 可以将权限转换为角色，或者单独存储用户权限
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-		
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -1299,15 +1439,23 @@ func handleUserPermissions(w http.ResponseWriter, r *http.Request, id int) {
 // handleRoles 处理角色列表和创建请求
 func handleRoles(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		// 获取角色列表
-		rolesStore.RLock()
-		defer rolesStore.RUnlock()
-		
-		json.NewEncoder(w).Encode(rolesStore.Roles)
-		
+		roles := []Role{}
+		if err := db.Order("id").Find(&roles).Error; err != nil {
+			writeError(w, r, err)
+			return
+		}
+		json.NewEncoder(w).Encode(roles)
+
 	case http.MethodPost:
 		// 创建新角色
 		var form struct {
@@ -1315,45 +1463,45 @@ func handleRoles(w http.ResponseWriter, r *http.Request) {
 			Description string   `json:"description"`
 			Permissions []string `json:"permissions"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
+
 		// 参数验证
 		if form.Name == "" {
-			http.Error(w, "Role name is required", http.StatusBadRequest)
+			writeError(w, r, requiredField("name", "Role name is required"))
 			return
 		}
-		
-		rolesStore.Lock()
-		defer rolesStore.Unlock()
-		
+
 		// 检查角色名是否已存在
-		for _, role := range rolesStore.Roles {
-			if role.Name == form.Name {
-				http.Error(w, "Role name already exists", http.StatusConflict)
-				return
-			}
+		var n int64
+		if err := db.Model(&Role{}).Where("name = ?", form.Name).Count(&n).Error; err != nil {
+			writeError(w, r, err)
+			return
 		}
-		
+		if n > 0 {
+			writeError(w, r, errRoleExists)
+			return
+		}
+
 		// 创建新角色
 		newRole := Role{
-			ID:          rolesStore.NextID,
 			Name:        form.Name,
 			Description: form.Description,
 			Permissions: form.Permissions,
 			CreatedAt:   time.Now().Format(time.RFC3339),
 		}
-		
-		rolesStore.NextID++
-		rolesStore.Roles = append(rolesStore.Roles, newRole)
-		
+		if err := db.Create(&newRole).Error; err != nil {
+			writeError(w, r, err)
+			return
+		}
+
 		json.NewEncoder(w).Encode(newRole)
-		
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -1361,41 +1509,37 @@ func handleRoles(w http.ResponseWriter, r *http.Request) {
 func handleRoleDetail(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/roles/")
 	parts := strings.Split(path, "/")
-	
+
 	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "Role ID is required", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Role ID is required")
 		return
 	}
-	
+
 	idStr := parts[0]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid role ID")
 		return
 	}
-	
-	rolesStore.Lock()
-	defer rolesStore.Unlock()
-	
-	// 查找角色
-	index := -1
-	for i, role := range rolesStore.Roles {
-		if role.ID == id {
-			index = i
-			break
-		}
+
+	db, err := dashboardDB()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	
-	if index == -1 {
-		http.Error(w, "Role not found", http.StatusNotFound)
+
+	// 查找角色
+	role, err := findRecord[Role](db, id, errRoleNotFound)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	
+
 	switch r.Method {
 	case http.MethodGet:
 		// 获取角色详情
-		json.NewEncoder(w).Encode(rolesStore.Roles[index])
-		
+		json.NewEncoder(w).Encode(role)
+
 	case http.MethodPut:
 		// 更新角色
 		var form struct {
@@ -1403,32 +1547,58 @@ func handleRoleDetail(w http.ResponseWriter, r *http.Request) {
 			Description *string   `json:"description"`
 			Permissions *[]string `json:"permissions"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
-		
+
+		// 内置的 admin 角色不能改名
+		if form.Name != nil && role.Name == adminRole && *form.Name != adminRole {
+			writeError(w, r, errBuiltinRole)
+			return
+		}
+
 		// 更新字段
-		if form.Name != nil {
-			rolesStore.Roles[index].Name = *form.Name
+		if form.Name != nil && *form.Name != role.Name {
+			var n int64
+			if err := db.Model(&Role{}).Where("name = ?", *form.Name).Count(&n).Error; err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if n > 0 {
+				writeError(w, r, errRoleExists)
+				return
+			}
+			role.Name = *form.Name
 		}
 		if form.Description != nil {
-			rolesStore.Roles[index].Description = *form.Description
+			role.Description = *form.Description
 		}
 		if form.Permissions != nil {
-			rolesStore.Roles[index].Permissions = *form.Permissions
+			role.Permissions = *form.Permissions
 		}
-		
-		json.NewEncoder(w).Encode(rolesStore.Roles[index])
-		
+		if err := db.Save(role).Error; err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(role)
+
 	case http.MethodDelete:
-		// 删除角色
-		rolesStore.Roles = append(rolesStore.Roles[:index], rolesStore.Roles[index+1:]...)
+		// 删除角色，内置的 admin 角色不能删除
+		if role.Name == adminRole {
+			writeError(w, r, errBuiltinRole)
+			return
+		}
+		if err := db.Delete(&Role{}, id).Error; err != nil {
+			writeError(w, r, err)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
-		
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -1466,7 +1636,7 @@ func handleAppStoreInstances(w http.ResponseWriter, r *http.Request) {
 		// 创建应用实例
 		var form map[string]interface{}
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
 		// 返回成功响应
@@ -1482,7 +1652,7 @@ func handleAppStoreInstances(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -1503,7 +1673,7 @@ func handleDatabaseConnections(w http.ResponseWriter, r *http.Request) {
 		// 创建数据库连接
 		var form map[string]interface{}
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
 		// 返回成功响应
@@ -1521,7 +1691,7 @@ func handleDatabaseConnections(w http.ResponseWriter, r *http.Request) {
 		// 更新数据库连接
 		var form map[string]interface{}
 		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, r, errInvalidBody)
 			return
 		}
 		json.NewEncoder(w).Encode(form)
@@ -1531,7 +1701,7 @@ func handleDatabaseConnections(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 // ============================================
@@ -1541,7 +1711,7 @@ func handleDatabaseConnections(w http.ResponseWriter, r *http.Request) {
 // handleDeploymentValidation 处理部署验证请求
 func handleDeploymentValidation(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1559,7 +1729,7 @@ func handleDeploymentValidation(w http.ResponseWriter, r *http.Request) {
 // handleDeploymentRepair 处理自动修复请求
 func handleDeploymentRepair(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1581,7 +1751,7 @@ func handleDeploymentRepair(w http.ResponseWriter, r *http.Request) {
 // handleDeploymentStatus 处理部署状态查询请求
 func handleDeploymentStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1595,7 +1765,7 @@ func handleDeploymentStatus(w http.ResponseWriter, r *http.Request) {
 // handleDeploymentWorkflow 处理部署工作流请求
 func handleDeploymentWorkflow(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1609,7 +1779,7 @@ func handleDeploymentWorkflow(w http.ResponseWriter, r *http.Request) {
 // handleHealthCheck 处理健康检查请求
 func handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"qwq/internal/logger"
+	"qwq/internal/slash"
+	"qwq/internal/utils"
+	"strconv"
+	"strings"
+)
+
+// SlashCommands 对话中的斜杠命令，Web 终端和 CLI 对话共用
+// 每条命令声明等价的 API，执行前按该 API 的权限规则检查
+var SlashCommands = slash.New()
+
+// slashIncidentLimit /incidents 默认列出的异常巡检数量
+const slashIncidentLimit = 10
+
+func init() {
+	SlashCommands.Register(slash.Command{
+		Name: "patrol", Summary: "立即在后台执行一次巡检",
+		Method: http.MethodPost, Path: "/api/trigger",
+		Run: slashPatrol,
+	})
+	SlashCommands.Register(slash.Command{
+		Name: "status", Summary: "当前的健康评分、负载、内存、磁盘和连接数",
+		Method: http.MethodGet, Path: "/api/stats",
+		Run: slashStatus,
+	})
+	SlashCommands.Register(slash.Command{
+		Name: "incidents", Args: "[n]", Summary: "最近发现异常的巡检及其告警",
+		Method: http.MethodGet, Path: "/api/patrol/runs",
+		Run: slashIncidents,
+	})
+	SlashCommands.Register(slash.Command{
+		Name: "containers", Summary: "容器列表和运行状态",
+		Method: http.MethodGet, Path: "/api/containers",
+		Run: slashContainers,
+	})
+}
+
+// slashAuthorizer 斜杠命令的权限检查，与等价 API 一致：
+// API 令牌按 tokenRoutePermission 检查路由权限，交互式会话与 basicAuth 保护的接口一样不受路由表限制
+func slashAuthorizer(r *http.Request) slash.Authorizer {
+	token := requestToken(r)
+	if token == nil {
+		return nil
+	}
+	return func(method, path string) bool {
+		_, allowed := tokenRoutePermission(&http.Request{Method: method, URL: &url.URL{Path: path}})
+		return allowed(token)
+	}
+}
+
+// slashMessage 命令失败时返回给用户的提示
+func slashMessage(err error) string {
+	switch {
+	case errors.Is(err, slash.ErrUnknownCommand):
+		return "❓ " + err.Error()
+	case errors.Is(err, slash.ErrForbidden):
+		return "🚫 " + err.Error()
+	default:
+		return "⚠️ " + err.Error()
+	}
+}
+
+func slashPatrol(ctx context.Context, args []string) (*slash.Result, error) {
+	if TriggerPatrolFunc == nil {
+		return nil, errors.New("巡检未启用")
+	}
+	logger.Info("[AUDIT] 🔍 手动触发巡检 (/patrol) by %s", slash.Actor(ctx))
+	go TriggerPatrolFunc()
+	return &slash.Result{Text: "🔍 已在后台开始巡检，完成后输入 /incidents 查看发现的异常"}, nil
+}
+
+func slashStatus(ctx context.Context, args []string) (*slash.Result, error) {
+	point := collectOnePoint()
+	report := ComputeHealthScore()
+	result := &slash.Result{
+		Title:   fmt.Sprintf("📊 服务器状态 [%s]", utils.GetHostname()),
+		Text:    fmt.Sprintf("**健康评分**: %d/100", report.Score),
+		Columns: []string{"指标", "状态"},
+	}
+	for i, d := range report.Breakdown {
+		if i == 3 {
+			result.Text += fmt.Sprintf("\n- … 另有 %d 项扣分", len(report.Breakdown)-i)
+			break
+		}
+		result.Text += fmt.Sprintf("\n- -%.1f %s", d.Points, d.Reason)
+	}
+	result.Rows = append(result.Rows,
+		[]string{"CPU负载", strings.TrimSpace(point.Load)},
+		[]string{"内存使用", fmt.Sprintf("%s%% (已用 %sM / 总计 %sM)", point.MemPct, point.MemUsed, point.MemTotal)},
+	)
+	if len(point.Mounts) == 0 {
+		result.Rows = append(result.Rows, []string{"系统磁盘", fmt.Sprintf("%s%% (剩余 %s)", point.DiskPct, point.DiskAvail)})
+	}
+	for _, m := range point.Mounts {
+		result.Rows = append(result.Rows, []string{"磁盘 " + m.Mount, fmt.Sprintf("%.0f%% (剩余 %.1fG)", m.Pct, float64(m.Avail)/(1<<30))})
+	}
+	result.Rows = append(result.Rows, []string{"TCP连接", point.TcpConn})
+	return result, nil
+}
+
+func slashIncidents(ctx context.Context, args []string) (*slash.Result, error) {
+	limit := slashIncidentLimit
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("用法: /incidents [n]，n 为正整数")
+		}
+		limit = n
+	}
+	result := &slash.Result{Title: "🚨 最近的异常", Columns: []string{"巡检", "时间", "触发", "异常数", "告警"}}
+	for _, run := range PatrolRunSummaries(0) {
+		if run.Anomalies == 0 {
+			continue
+		}
+		result.Rows = append(result.Rows, []string{
+			fmt.Sprintf("#%d", run.ID), run.StartedAt.Format("01-02 15:04"), run.Trigger,
+			strconv.Itoa(run.Anomalies), strings.Join(run.Findings, "; "),
+		})
+		if len(result.Rows) == limit {
+			break
+		}
+	}
+	if len(result.Rows) == 0 {
+		result.Text = "✅ 最近的巡检没有发现异常"
+	}
+	return result, nil
+}
+
+func slashContainers(ctx context.Context, args []string) (*slash.Result, error) {
+	containers, err := containerLister().ListContainers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取容器列表失败: %w", err)
+	}
+	result := &slash.Result{Title: fmt.Sprintf("🐳 容器 (%d)", len(containers)), Columns: []string{"名称", "镜像", "状态", "健康"}}
+	for _, c := range containers {
+		result.Rows = append(result.Rows, []string{c.Name, c.Image, c.Status, c.Health})
+	}
+	if len(containers) == 0 {
+		result.Text = "没有容器"
+	}
+	return result, nil
+}
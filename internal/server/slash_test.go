@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/apitoken"
+	"qwq/internal/slash"
+	"testing"
+)
+
+func TestSlashAuthorizer_MirrorsTokenRoutes(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ws/chat", nil)
+	if slashAuthorizer(req) != nil {
+		t.Error("Expected interactive sessions to be checked like basicAuth routes")
+	}
+
+	token := &apitoken.Token{Name: "viewer", Owner: "admin", Permissions: []string{"containers:read"}}
+	authorize := slashAuthorizer(req.WithContext(withToken(req.Context(), token)))
+	if !authorize(http.MethodGet, "/api/containers") || authorize(http.MethodPost, "/api/trigger") || authorize(http.MethodGet, "/api/stats") {
+		t.Error("Expected the token to reach only the routes its permissions cover")
+	}
+
+	saved := TriggerPatrolFunc
+	defer func() { TriggerPatrolFunc = saved }()
+	triggered := make(chan struct{}, 1)
+	TriggerPatrolFunc = func() { triggered <- struct{}{} }
+	if _, err := SlashCommands.Dispatch(context.Background(), "/patrol", authorize); !errors.Is(err, slash.ErrForbidden) {
+		t.Fatalf("Expected ErrForbidden, got %v", err)
+	}
+	token.Permissions = []string{"*"}
+	if _, err := SlashCommands.Dispatch(context.Background(), "/patrol", authorize); err != nil {
+		t.Fatal(err)
+	}
+	<-triggered
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"qwq/internal/backup"
+	"qwq/internal/logger"
+	"strings"
+)
+
+// handleContainerSubroutes 处理 /api/containers/{id}/... 的卷快照接口
+//
+//	POST /api/containers/{id}/snapshot   创建快照，body 可选 {"note": "..."}
+//	GET  /api/containers/{id}/snapshots  列出该容器的快照
+//	POST /api/containers/{id}/restore    从快照恢复，body {"snapshot_id": "..."}
+func handleContainerSubroutes(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/containers/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		respondError(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	id, action := parts[0], parts[1]
+
+	switch action {
+	case "snapshot":
+		handleCreateSnapshot(w, r, id)
+	case "snapshots":
+		handleListSnapshots(w, r, id)
+	case "restore":
+		handleRestoreSnapshot(w, r, id)
+	default:
+		respondError(w, r, http.StatusNotFound, "Not found")
+	}
+}
+
+func handleCreateSnapshot(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+	}
+
+	logger.Info("Web创建卷快照: %s", id)
+	snapshot, err := backup.DefaultSnapshotManager().CreateSnapshot(r.Context(), id, req.Note)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+func handleListSnapshots(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	snapshots, err := backup.DefaultSnapshotManager().ListSnapshots(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if snapshots == nil {
+		snapshots = []*backup.VolumeSnapshot{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+func handleRestoreSnapshot(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SnapshotID == "" {
+		respondError(w, r, http.StatusBadRequest, "Missing snapshot_id")
+		return
+	}
+
+	manager := backup.DefaultSnapshotManager()
+	snapshots, err := manager.ListSnapshots(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	found := false
+	for _, snapshot := range snapshots {
+		if snapshot.ID == req.SnapshotID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		writeError(w, r, backup.ErrSnapshotNotFound)
+		return
+	}
+
+	logger.Info("Web恢复卷快照: %s <- %s", id, req.SnapshotID)
+	snapshot, err := manager.RestoreSnapshot(r.Context(), req.SnapshotID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
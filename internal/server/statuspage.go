@@ -0,0 +1,229 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/health"
+	"qwq/internal/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStatusPageCacheSeconds 状态页默认缓存时间
+const DefaultStatusPageCacheSeconds = 30
+
+// 状态页整体状态
+const (
+	StatusOperational = "operational" // 正常
+	StatusDegraded    = "degraded"    // 部分异常
+	StatusOutage      = "outage"      // 严重故障
+)
+
+// StatusPageService 状态页展示的服务检查状态
+type StatusPageService struct {
+	Name string `json:"name"`
+	Up   bool   `json:"up"`
+}
+
+// StatusPageData 状态页数据
+// 只包含白名单字段：不暴露服务 URL、错误详情、扣分明细等内部信息
+type StatusPageData struct {
+	Title          string              `json:"title"`
+	Status         string              `json:"status"`
+	Score          int                 `json:"score"`
+	Services       []StatusPageService `json:"services"`
+	OpenIncidents  int                 `json:"open_incidents"`
+	IncidentTitles []string            `json:"incident_titles,omitempty"` // 仅在配置 show_incident_titles 时返回
+	Uptime         string              `json:"uptime"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+// registerStatusPage 注册只读状态页路由
+// 状态页使用独立的处理器，不经过 basicAuth，也不会转发到任何需要认证的 API
+func registerStatusPage(mux *http.ServeMux) {
+	mux.HandleFunc("/status", statusPageGuard(handleStatusPage))
+	mux.HandleFunc("/status/api", statusPageGuard(handleStatusPageAPI))
+}
+
+// statusPageGuard 状态页访问控制：只允许 GET/HEAD，按配置校验 Token，并设置缓存头
+func statusPageGuard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Current().StatusPage
+		if !cfg.Enabled {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if cfg.Token != "" {
+			token := r.URL.Query().Get("token")
+			if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+				token = strings.TrimPrefix(bearer, "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+				w.Header().Set("Cache-Control", "no-store")
+				respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+		}
+
+		maxAge := statusPageMaxAge()
+		// 允许 CDN 缓存；源站不可用时继续提供旧内容，避免事故期间回源压垮服务
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d, stale-if-error=%d", maxAge, maxAge*2, maxAge*10))
+		w.Header().Set("Vary", "Authorization")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		next(w, r)
+	}
+}
+
+// statusPageCache 状态页数据缓存，避免未认证请求频繁触发数据采集
+var statusPageCache struct {
+	sync.Mutex
+	data StatusPageData
+	at   time.Time
+}
+
+// cachedStatusPageData 在缓存有效期内复用状态页数据
+func cachedStatusPageData(maxAge time.Duration) StatusPageData {
+	statusPageCache.Lock()
+	defer statusPageCache.Unlock()
+	if statusPageCache.at.IsZero() || time.Since(statusPageCache.at) >= maxAge {
+		statusPageCache.data = buildStatusPageData()
+		statusPageCache.at = time.Now()
+	}
+	return statusPageCache.data
+}
+
+// statusPageMaxAge 状态页缓存时间（秒）
+func statusPageMaxAge() int {
+	if seconds := config.Current().StatusPage.CacheSeconds; seconds > 0 {
+		return seconds
+	}
+	return DefaultStatusPageCacheSeconds
+}
+
+// buildStatusPageData 根据健康评分输入生成状态页数据，逐字段复制白名单内容
+func buildStatusPageData() StatusPageData {
+	cfg := config.Current().StatusPage
+	in := collectHealthInputs()
+	report := health.Score(in, healthWeights(), healthThresholds())
+
+	data := StatusPageData{
+		Title:         cfg.Title,
+		Score:         report.Score,
+		Services:      []StatusPageService{},
+		OpenIncidents: len(in.Incidents),
+		Uptime:        hostUptime(),
+		UpdatedAt:     report.ComputedAt,
+	}
+	if data.Title == "" {
+		data.Title = utils.GetHostname()
+	}
+	for _, service := range in.Services {
+		data.Services = append(data.Services, StatusPageService{Name: service.Name, Up: service.Healthy})
+	}
+	if cfg.ShowIncidentTitles {
+		for _, incident := range in.Incidents {
+			data.IncidentTitles = append(data.IncidentTitles, incident.Title)
+		}
+	}
+
+	servicesDown := false
+	for _, service := range data.Services {
+		servicesDown = servicesDown || !service.Up
+	}
+	switch {
+	case data.Score < 50:
+		data.Status = StatusOutage
+	case data.Score < 80 || servicesDown || data.OpenIncidents > 0:
+		data.Status = StatusDegraded
+	default:
+		data.Status = StatusOperational
+	}
+	return data
+}
+
+// hostUptime 主机运行时间，读取 /proc/uptime
+func hostUptime() string {
+	raw, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return "N/A"
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return "N/A"
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "N/A"
+	}
+	uptime := time.Duration(seconds) * time.Second
+	days := int(uptime.Hours()) / 24
+	hours := int(uptime.Hours()) % 24
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh", days, hours)
+	}
+	return fmt.Sprintf("%dh %dm", hours, int(uptime.Minutes())%60)
+}
+
+// handleStatusPageAPI 状态页 JSON 数据
+// GET /status/api
+func handleStatusPageAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cachedStatusPageData(time.Duration(statusPageMaxAge()) * time.Second))
+}
+
+// statusPageTemplate 状态页 HTML，不加载面板前端资源
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - 系统状态</title>
+<style>
+body { background: #161920; color: #c9cdd4; font-family: -apple-system, "Segoe UI", sans-serif; margin: 0; padding: 40px 20px; }
+.container { max-width: 720px; margin: 0 auto; }
+h1 { color: #fff; font-size: 24px; }
+.banner { padding: 16px 20px; border-radius: 6px; color: #fff; font-weight: 600; margin-bottom: 24px; }
+.operational { background: #3a7d2c; } .degraded { background: #a8741a; } .outage { background: #b33a3a; }
+.card { background: #1d2129; border: 1px solid #2c3038; border-radius: 6px; padding: 16px 20px; margin-bottom: 16px; }
+.row { display: flex; justify-content: space-between; padding: 6px 0; }
+.up { color: #67C23A; } .down { color: #F56C6C; }
+.muted { color: #86909c; font-size: 12px; }
+</style>
+</head>
+<body>
+<div class="container">
+<h1>{{.Title}}</h1>
+<div class="banner {{.Status}}">{{if eq .Status "operational"}}所有系统运行正常{{else if eq .Status "degraded"}}部分服务异常{{else}}严重故障{{end}}</div>
+<div class="card">
+<div class="row"><span>健康评分</span><span>{{.Score}}/100</span></div>
+<div class="row"><span>未关闭的异常</span><span>{{.OpenIncidents}}</span></div>
+<div class="row"><span>运行时间</span><span>{{.Uptime}}</span></div>
+</div>
+{{if .IncidentTitles}}<div class="card">{{range .IncidentTitles}}<div class="row"><span>{{.}}</span></div>{{end}}</div>{{end}}
+{{if .Services}}<div class="card">{{range .Services}}<div class="row"><span>{{.Name}}</span>{{if .Up}}<span class="up">正常</span>{{else}}<span class="down">异常</span>{{end}}</div>{{end}}</div>{{end}}
+<div class="muted">更新时间 {{.UpdatedAt.Format "2006-01-02 15:04:05"}}</div>
+</div>
+</body>
+</html>
+`))
+
+// handleStatusPage 渲染状态页
+// GET /status
+func handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := cachedStatusPageData(time.Duration(statusPageMaxAge()) * time.Second)
+	if err := statusPageTemplate.Execute(w, data); err != nil {
+		respondError(w, r, http.StatusInternalServerError, "Failed to render status page")
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusPage(t *testing.T) {
+	saved := config.Current()
+	defer config.Store(saved)
+	config.Update(func(cfg *config.Config) {
+		cfg.StatusPage = config.StatusPageConfig{Enabled: true, Token: "dev-token", CacheSeconds: 60}
+	})
+
+	statsCache.Lock()
+	statsCache.History = []StatsPoint{{Load: "0.1", MemPct: "10", MemTotal: "1024", DiskPct: "20"}}
+	statsCache.Unlock()
+	statusPageCache.at = time.Time{}
+
+	mux := http.NewServeMux()
+	registerStatusPage(mux)
+
+	// 缺少 Token
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/api", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("Expected uncached 401 without token, got %d %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/api?token=dev-token", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "public") || !strings.Contains(cc, "max-age=60") {
+		t.Errorf("Unexpected Cache-Control %q", cc)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	allowed := map[string]bool{"title": true, "status": true, "score": true, "services": true,
+		"open_incidents": true, "incident_titles": true, "uptime": true, "updated_at": true}
+	for key := range body {
+		if !allowed[key] {
+			t.Errorf("Field %q is not in the status page allowlist", key)
+		}
+	}
+	if _, ok := body["incident_titles"]; ok {
+		t.Error("Incident titles must be hidden unless configured")
+	}
+
+	// 状态页路由不能访问认证 API，也不接受写操作
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/logs?token=dev-token", nil),
+		httptest.NewRequest(http.MethodGet, "/status/api/../../api/stats?token=dev-token", nil),
+	} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			t.Errorf("Expected %s to be unreachable, got 200", req.URL.Path)
+		}
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status?token=dev-token", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+
+	config.Update(func(cfg *config.Config) { cfg.StatusPage.Enabled = false })
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status?token=dev-token", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when disabled, got %d", rec.Code)
+	}
+}
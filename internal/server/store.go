@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"qwq/internal/database"
+	"qwq/internal/logger"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// DashboardModels Web 控制台用户、角色、网站和操作审计的表结构，由 dashboard 数据库迁移
+var DashboardModels = []interface{}{&User{}, &Role{}, &Website{}, &AuditEntry{}}
+
+func (User) TableName() string    { return "dashboard_users" }
+func (Role) TableName() string    { return "dashboard_roles" }
+func (Website) TableName() string { return "dashboard_websites" }
+
+var dashboardStore struct {
+	sync.Mutex
+	db *gorm.DB
+}
+
+// userWrites 串行化用户的写操作，保证用户名唯一和最后一个管理员的检查与写入之间没有其他修改
+var userWrites sync.Mutex
+
+// SetDashboardDB 设置保存用户、角色、网站和审计记录的数据库，调用方负责表结构迁移
+func SetDashboardDB(db *gorm.DB) {
+	dashboardStore.Lock()
+	defer dashboardStore.Unlock()
+	dashboardStore.db = db
+}
+
+// dashboardDB 用户、角色、网站和审计记录所在的数据库；未设置（数据库不可用）时使用内存数据库，重启后数据丢失
+func dashboardDB() (*gorm.DB, error) {
+	dashboardStore.Lock()
+	defer dashboardStore.Unlock()
+	if dashboardStore.db != nil {
+		return dashboardStore.db, nil
+	}
+	db, err := database.Open(database.Config{Type: "sqlite", FilePath: ":memory:"})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(DashboardModels...); err != nil {
+		return nil, err
+	}
+	logger.Info("⚠️ 未配置控制台数据库，用户、角色、网站和审计记录只保存在内存中")
+	dashboardStore.db = db
+	return db, nil
+}
+
+// findRecord 按 ID 读取一条记录，不存在时返回 notFound
+func findRecord[T any](db *gorm.DB, id int, notFound error) (*T, error) {
+	var record T
+	if err := db.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// findUser 按用户名查找用户，数据库不可用时视为不存在
+func findUser(username string) (*User, bool) {
+	db, err := dashboardDB()
+	if err != nil {
+		return nil, false
+	}
+	var user User
+	result := db.Where("username = ?", username).Limit(1).Find(&user)
+	return &user, result.Error == nil && result.RowsAffected == 1
+}
+
+// listWebsites 所有网站，按 ID 排序
+func listWebsites() ([]Website, error) {
+	db, err := dashboardDB()
+	if err != nil {
+		return nil, err
+	}
+	sites := []Website{}
+	return sites, db.Order("id").Find(&sites).Error
+}
+
+// hashPassword 生成密码的 bcrypt 哈希，超过 72 字节的密码返回 bcrypt.ErrPasswordTooLong
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkPassword 密码是否与 bcrypt 哈希匹配
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+// openDashboardDB 打开并迁移控制台数据库，dsn 为 :memory: 或文件路径
+func openDashboardDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(DashboardModels...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// setupDashboard 使用空的内存数据库保存用户、角色和网站，测试结束后恢复
+func setupDashboard(t *testing.T) *gorm.DB {
+	t.Helper()
+	dashboardStore.Lock()
+	saved := dashboardStore.db
+	dashboardStore.Unlock()
+	t.Cleanup(func() { SetDashboardDB(saved) })
+	db := openDashboardDB(t, ":memory:")
+	SetDashboardDB(db)
+	return db
+}
+
+func TestHandleUsers_StoresBcryptHash(t *testing.T) {
+	db := setupDashboard(t)
+	rec := httptest.NewRecorder()
+	handleUsers(rec, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"username":"alice","email":"a@example.com","password":"s3cret","roles":["viewer"],"enabled":true}`)))
+	var created map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusOK || created["id"] != float64(1) || created["username"] != "alice" {
+		t.Fatalf("Expected the first user to get ID 1, got %d %v", rec.Code, created)
+	}
+	if _, ok := created["password"]; ok {
+		t.Error("The password must not be returned")
+	}
+
+	var user User
+	db.First(&user, 1)
+	if user.Password == "s3cret" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("s3cret")) != nil {
+		t.Fatalf("Expected a bcrypt hash, got %q", user.Password)
+	}
+	if roles, ok := authenticateUser("alice", "s3cret"); !ok || len(roles) != 1 || roles[0] != "viewer" {
+		t.Errorf("Expected the hashed password to authenticate, got %v %v", roles, ok)
+	}
+	if _, ok := authenticateUser("alice", "wrong"); ok {
+		t.Error("Expected a wrong password to be rejected")
+	}
+
+	rec = httptest.NewRecorder()
+	handleUsers(rec, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"username":"bob","email":"b@example.com","password":"`+strings.Repeat("x", 73)+`"}`)))
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusBadRequest || envelope.Code != "USER_PASSWORD_TOO_LONG" {
+		t.Errorf("Expected USER_PASSWORD_TOO_LONG, got %d %+v", rec.Code, envelope)
+	}
+}
+
+func TestDashboardStore_SurvivesRestart(t *testing.T) {
+	setupDashboard(t)
+	path := filepath.Join(t.TempDir(), "dashboard.db")
+	SetDashboardDB(openDashboardDB(t, path))
+	rec := httptest.NewRecorder()
+	handleWebsites(rec, httptest.NewRequest(http.MethodPost, "/api/websites", strings.NewReader(`{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the website to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 重新打开数据库文件相当于重启
+	SetDashboardDB(openDashboardDB(t, path))
+	rec = httptest.NewRecorder()
+	handleWebsites(rec, httptest.NewRequest(http.MethodGet, "/api/websites", nil))
+	var sites []Website
+	json.NewDecoder(rec.Body).Decode(&sites)
+	if len(sites) != 1 || sites[0].ID != 1 || sites[0].Domain != "example.com" || !sites[0].Enabled {
+		t.Errorf("Expected the website to survive a restart, got %+v", sites)
+	}
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"qwq/internal/agent"
+	"qwq/internal/apierror"
+	"qwq/internal/apitoken"
+	"qwq/internal/config"
+	"qwq/internal/container"
+	"qwq/internal/logger"
+	"qwq/internal/realip"
+	"strconv"
+	"strings"
+)
+
+// 令牌管理接口的错误
+var (
+	errTokensUnavailable = apierror.New(http.StatusServiceUnavailable, "TOKENS_UNAVAILABLE", "API tokens are not available")
+	errTokenAuthRequired = apierror.New(http.StatusConflict, "TOKENS_REQUIRE_AUTH", "API tokens require web_user and web_password")
+	errTokenSelfManage   = apierror.New(http.StatusForbidden, "TOKEN_CANNOT_MANAGE_TOKENS", "API tokens cannot manage API tokens")
+)
+
+// tokenRouteResources API 路径前缀对应的权限资源，按顺序取第一个匹配的前缀
+// 令牌访问未列出的路径需要 * 权限；交互式会话不受此表限制
+var tokenRouteResources = []struct {
+	prefix   string
+	resource string
+}{
+	{"/api/websites", "websites"},
+	{"/api/users", "users"},
+	{"/api/roles", "roles"},
+	{"/api/permissions", "roles"},
+	{"/api/containers", "containers"},
+	{"/api/container/", "containers"},
+	{"/ws/container/", "containers"},
+	{"/api/files/", "files"},
+	{"/api/logs", "logs"},
+	{"/api/deployment/", "deployments"},
+	{"/api/deployments", "deployments"},
+	{"/api/compose/", "deployments"},
+	{"/api/pipelines", "deployments"},
+	{"/api/jobs", "jobs"},
+	{"/api/drift", "drift"},
+	{"/api/host-audit", "hostaudit"},
+	{"/api/incidents/", "incident"},
+	{"/api/chat/", "chat"},
+	{"/api/audit", "audit"},
+}
+
+// tokenPermissions 接口单独检查的权限，创建令牌时可以选择
+var tokenPermissions = []string{
+	PermissionJobsManage,
+	PermissionDriftResolve,
+	PermissionHostAuditAccept,
+	PermissionIncidentExport,
+	container.PermissionPipelinesManage,
+	PermissionChatExec,
+}
+
+// defaultTenantID 控制台用户所属的租户，控制台本身不区分租户，API 令牌记录创建时的租户
+const defaultTenantID = 1
+
+// requestTenant 请求所属的租户：使用 API 令牌时为令牌的租户，否则为默认租户
+func requestTenant(r *http.Request) uint {
+	if token := requestToken(r); token != nil && token.TenantID != 0 {
+		return token.TenantID
+	}
+	return defaultTenantID
+}
+
+// tokenKey 请求上下文中认证通过的 API 令牌
+type tokenKey struct{}
+
+// withToken 把认证通过的令牌放入上下文
+func withToken(ctx context.Context, token *apitoken.Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// requestToken 请求使用的 API 令牌，交互式会话返回 nil
+func requestToken(r *http.Request) *apitoken.Token {
+	token, _ := r.Context().Value(tokenKey{}).(*apitoken.Token)
+	return token
+}
+
+// requestPermissions 请求调用者的权限：API 令牌只拥有创建时选择且所属用户仍然拥有的权限，交互式会话同 chatPermissions
+func requestPermissions(r *http.Request) agent.PermissionFunc {
+	token := requestToken(r)
+	if token == nil {
+		return chatPermissions(requestUser(r))
+	}
+	owner := ownerPermissions(token.Owner)
+	return func(permission string) bool {
+		return token.Allows(permission) && owner(permission)
+	}
+}
+
+// ownerPermissions 用户当前拥有的权限（userGrants）：配置的管理员拥有全部权限，其他用户按启用状态和角色判断，
+// 资源的 <资源>:* 包含该资源的所有操作
+func ownerPermissions(owner string) func(permission string) bool {
+	granted := userGrants(owner)
+	return func(permission string) bool {
+		resource, _, _ := strings.Cut(permission, ":")
+		return granted["*"] || granted[permission] || granted[resource+":*"]
+	}
+}
+
+// knownPermissions 可以授予令牌的权限：权限列表中的资源操作和各接口单独检查的权限
+func knownPermissions() map[string]bool {
+	known := make(map[string]bool, len(permissionsStore)+len(tokenPermissions))
+	for _, permission := range permissionsStore {
+		known[permission.Resource+":"+permission.Action] = true
+	}
+	for _, permission := range tokenPermissions {
+		known[permission] = true
+	}
+	return known
+}
+
+// ValidateTokenPermissions 检查令牌权限是否都是已知权限且所属用户拥有
+// 支持 <resource>:* 和 *（只有管理员可以授予）
+func ValidateTokenPermissions(owner string, permissions []string) error {
+	if len(permissions) == 0 {
+		return fmt.Errorf("%w: at least one permission is required", apitoken.ErrInvalidRequest)
+	}
+	known := knownPermissions()
+	resources := make(map[string]bool)
+	for permission := range known {
+		resource, _, _ := strings.Cut(permission, ":")
+		resources[resource] = true
+	}
+	has := ownerPermissions(owner)
+	for _, permission := range permissions {
+		resource, action, _ := strings.Cut(permission, ":")
+		if !known[permission] && !(action == "*" && resources[resource]) && permission != "*" {
+			return fmt.Errorf("%w: unknown permission %q", apitoken.ErrInvalidRequest, permission)
+		}
+		if !has(permission) {
+			return fmt.Errorf("%w: %s does not have permission %q", apitoken.ErrInvalidRequest, owner, permission)
+		}
+	}
+	return nil
+}
+
+// tokenRoutePermission 令牌访问该请求所需的资源和操作
+// 读请求需要资源的任一权限；DELETE 在资源定义了 delete 操作时需要 delete 权限，否则与其他写请求一样需要非只读权限
+func tokenRoutePermission(r *http.Request) (resource string, allowed func(*apitoken.Token) bool) {
+	for _, route := range tokenRouteResources {
+		if strings.HasPrefix(r.URL.Path, route.prefix) {
+			resource = route.resource
+			break
+		}
+	}
+	if resource == "" {
+		return "*", func(token *apitoken.Token) bool { return token.Allows("*") }
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return resource, func(token *apitoken.Token) bool { return token.AllowsResource(resource) }
+	case http.MethodDelete:
+		if knownPermissions()[resource+":delete"] {
+			return resource + ":delete", func(token *apitoken.Token) bool { return token.Allows(resource + ":delete") }
+		}
+	}
+	return resource, func(token *apitoken.Token) bool {
+		for _, permission := range token.Permissions {
+			if permission == "*" || (strings.HasPrefix(permission, resource+":") && permission != resource+":read") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// bearerToken 从 Authorization: Bearer 头中读取令牌
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(secret), true
+}
+
+// tokenAuth 校验 Bearer 令牌和路由权限，通过后把令牌放入请求上下文
+func tokenAuth(w http.ResponseWriter, r *http.Request, secret string, next http.HandlerFunc) {
+	manager := apitoken.Default()
+	if manager == nil {
+		respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	token, err := manager.Authenticate(r.Context(), secret)
+	if err != nil {
+		if errors.Is(err, apitoken.ErrTokenExpired) || errors.Is(err, apitoken.ErrTokenRevoked) || errors.Is(err, apitoken.ErrInvalidToken) {
+			logger.Info("[AUDIT] 🔒 API 令牌认证失败: %v from %s", err, realip.FromRequest(r))
+		} else {
+			logger.Info("⚠️ API 令牌校验失败: %v", err)
+		}
+		respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if config.Current().WebUser != "" && token.Owner != config.Current().WebUser && !activeUser(token.Owner) {
+		logger.Info("[AUDIT] 🔒 API 令牌 %q 所属用户 %s 已停用 from %s", token.Name, token.Owner, realip.FromRequest(r))
+		respondError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	required, allowed := tokenRoutePermission(r)
+	if !allowed(token) {
+		logger.Info("[AUDIT] 🚨 API 令牌 %q 缺少权限 %s: %s %s from %s", token.Name, required, r.Method, r.URL.Path, realip.FromRequest(r))
+		respondError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	next(w, r.WithContext(withToken(r.Context(), token)))
+}
+
+// activeUser 用户是否存在且已启用
+func activeUser(username string) bool {
+	user, ok := findUser(username)
+	return ok && user.Enabled
+}
+
+// TokenCreateRequest 创建 API 令牌的请求
+type TokenCreateRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	ExpiresIn   string   `json:"expires_in"` // 有效期，如 90d、12h，为空表示不过期
+}
+
+// TokenCreateResponse 创建结果，token 为完整令牌，只返回这一次
+type TokenCreateResponse struct {
+	*apitoken.Token
+	Secret string `json:"token"`
+}
+
+// handleTokens API 令牌：GET 列出当前用户的令牌（只含前缀和最近使用时间）；POST 创建令牌
+// 令牌只能由交互式会话管理，使用令牌访问时返回 403
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+	manager, ok := tokenManager(w, r)
+	if !ok {
+		return
+	}
+	owner := requestUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := manager.List(r.Context(), owner)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	case http.MethodPost:
+		var req TokenCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, errInvalidBody)
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			writeError(w, r, requiredField("name", "Token name is required"))
+			return
+		}
+		if err := ValidateTokenPermissions(owner, req.Permissions); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		ttl, err := apitoken.ParseTTL(req.ExpiresIn)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		token, secret, err := manager.Create(r.Context(), apitoken.CreateRequest{
+			Name: req.Name, Owner: owner, TenantID: requestTenant(r), Permissions: req.Permissions, TTL: ttl,
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		logger.Info("[AUDIT] 🔑 API 令牌已创建: %q (%s) 权限 %s by %s", token.Name, token.Prefix, strings.Join(token.Permissions, ","), requestActor(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(TokenCreateResponse{Token: token, Secret: secret})
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleTokenDetail DELETE /api/tokens/{id} 吊销令牌，立即生效
+func handleTokenDetail(w http.ResponseWriter, r *http.Request) {
+	manager, ok := tokenManager(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/tokens/"), 10, 32)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+	token, err := manager.Revoke(r.Context(), uint(id), requestUser(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	logger.Info("[AUDIT] 🔑 API 令牌已吊销: %q (%s) by %s", token.Name, token.Prefix, requestActor(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+// tokenManager 令牌管理接口的前置检查，失败时写入错误响应
+func tokenManager(w http.ResponseWriter, r *http.Request) (*apitoken.Manager, bool) {
+	if requestToken(r) != nil {
+		writeError(w, r, errTokenSelfManage)
+		return nil, false
+	}
+	if config.Current().WebUser == "" || config.Current().WebPassword == "" {
+		writeError(w, r, errTokenAuthRequired)
+		return nil, false
+	}
+	manager := apitoken.Default()
+	if manager == nil {
+		writeError(w, r, errTokensUnavailable)
+		return nil, false
+	}
+	return manager, true
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/apitoken"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func setupTokens(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() {
+		config.Store(saved)
+		apitoken.SetDefault(nil)
+	})
+	config.Update(func(cfg *config.Config) { cfg.WebUser, cfg.WebPassword = "admin", "secret" })
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&apitoken.Token{}); err != nil {
+		t.Fatal(err)
+	}
+	apitoken.SetDefault(apitoken.NewManager(db))
+}
+
+func TestHandleTokens_Lifecycle(t *testing.T) {
+	setupTokens(t)
+
+	create := func(body string) (*httptest.ResponseRecorder, TokenCreateResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(body))
+		req.SetBasicAuth("admin", "secret")
+		rec := httptest.NewRecorder()
+		basicAuth(handleTokens)(rec, req)
+		var resp TokenCreateResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	for _, body := range []string{`{"name":"ci"}`, `{"name":"ci","permissions":["deployments:fly"]}`, `{"name":"ci","permissions":["logs:read"],"expires_in":"soon"}`, `{"permissions":["logs:read"]}`} {
+		if rec, _ := create(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec, created := create(`{"name":"ci","permissions":["deployments:write"],"expires_in":"90d"}`)
+	if rec.Code != http.StatusCreated || !strings.HasPrefix(created.Secret, apitoken.Prefix) || created.Token == nil || created.ExpiresAt == nil {
+		t.Fatalf("Expected the full token once, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tokens", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	basicAuth(handleTokens)(rec, req)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Secret) || !strings.Contains(rec.Body.String(), created.Prefix) {
+		t.Fatalf("Expected list with prefix only, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	var actor string
+	handler := basicAuth(func(w http.ResponseWriter, r *http.Request) {
+		actor = requestActor(r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	bearer := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+created.Secret)
+		rec := httptest.NewRecorder()
+		if strings.HasPrefix(path, "/api/tokens") {
+			basicAuth(handleTokens)(rec, req)
+		} else {
+			handler(rec, req)
+		}
+		return rec.Code
+	}
+
+	if code := bearer(http.MethodPost, "/api/deployment/workflow"); code != http.StatusNoContent {
+		t.Fatalf("Expected token to reach deployment API, got %d", code)
+	}
+	if !strings.Contains(actor, `via token "ci"`) || !strings.HasPrefix(actor, "admin") {
+		t.Errorf("Expected audit actor to name the token, got %q", actor)
+	}
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/files/save"},
+		{http.MethodGet, "/api/stats"},
+		{http.MethodDelete, "/api/websites/1"},
+		{http.MethodGet, "/api/tokens"},
+	} {
+		if code := bearer(route.method, route.path); code != http.StatusForbidden {
+			t.Errorf("Expected 403 for %s %s, got %d", route.method, route.path, code)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/tokens/%d", created.ID), nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	basicAuth(handleTokenDetail)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected revocation, got %d %s", rec.Code, rec.Body.String())
+	}
+	if code := bearer(http.MethodPost, "/api/deployment/workflow"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 right after revocation, got %d", code)
+	}
+}
+
+func TestRequestPermissions_Token(t *testing.T) {
+	setupTokens(t)
+
+	token := &apitoken.Token{Name: "ops", Owner: "admin", Permissions: []string{PermissionJobsManage, "websites:*"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs/report/run", nil)
+	req = req.WithContext(withToken(req.Context(), token))
+	can := requestPermissions(req)
+	if !can(PermissionJobsManage) || !can("websites:delete") || can(PermissionDriftResolve) {
+		t.Errorf("Expected token permissions only, got jobs=%v websites=%v drift=%v", can(PermissionJobsManage), can("websites:delete"), can(PermissionDriftResolve))
+	}
+
+	// 所属用户不是管理员时，令牌权限不能超过用户当前的角色权限
+	token.Owner = "bob"
+	if requestPermissions(req)(PermissionJobsManage) {
+		t.Error("Expected token of a user without roles to have no permissions")
+	}
+	if err := ValidateTokenPermissions("bob", []string{"logs:read"}); err == nil {
+		t.Error("Expected bob not to grant permissions the user does not have")
+	}
+	if err := ValidateTokenPermissions("admin", []string{"*", "logs:*", PermissionJobsManage}); err != nil {
+		t.Errorf("Expected admin to grant any known permission, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"qwq/internal/logger"
+	"qwq/internal/ownership"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// adminRole 管理员角色，最后一个启用的管理员不能删除
+const adminRole = "admin"
+
+// orphanAcknowledge 删除用户时确认把资源转给系统用户的参数值
+const orphanAcknowledge = "acknowledge"
+
+// UserDeletion 删除用户的结果，Transferred 为每张表（"服务.表"）转移的资源数
+type UserDeletion struct {
+	ID            int              `json:"id"`
+	Username      string           `json:"username"`
+	TransferredTo int              `json:"transferred_to"`
+	Orphaned      bool             `json:"orphaned"` // 资源转给了内置的系统用户
+	Transferred   map[string]int64 `json:"transferred"`
+}
+
+// userDeleteTarget 解析 DELETE /api/users/{id} 的 ?transfer_to={用户ID} 或 ?orphan=acknowledge，二者必须且只能指定一个
+func userDeleteTarget(r *http.Request) (to int, orphan bool, err error) {
+	query := r.URL.Query()
+	rawTo, rawOrphan := query.Get("transfer_to"), query.Get("orphan")
+	switch {
+	case rawTo != "" && rawOrphan != "":
+		return 0, false, errUserDeleteTarget
+	case rawOrphan != "":
+		if rawOrphan != orphanAcknowledge {
+			return 0, false, errUserDeleteTarget
+		}
+		return int(ownership.SystemUserID), true, nil
+	case rawTo != "":
+		to, err := strconv.Atoi(rawTo)
+		if err != nil || to <= int(ownership.SystemUserID) {
+			return 0, false, errUserTransferTarget
+		}
+		return to, false, nil
+	}
+	return 0, false, errUserDeleteTarget
+}
+
+// isLastAdmin 用户是否为唯一启用的管理员，调用方持有 userWrites 锁
+func isLastAdmin(db *gorm.DB, user User) (bool, error) {
+	if !hasRole(user, adminRole) {
+		return false, nil
+	}
+	var users []User
+	if err := db.Where("id <> ? AND enabled = ?", user.ID, true).Find(&users).Error; err != nil {
+		return false, err
+	}
+	for _, u := range users {
+		if hasRole(u, adminRole) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func hasRole(user User, role string) bool {
+	for _, r := range user.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteUser 把用户的资源转给 to 后删除用户，转移失败时用户保留；调用方持有 userWrites 锁
+func deleteUser(ctx context.Context, db *gorm.DB, user User, to int, orphan bool, actor string) (*UserDeletion, error) {
+	last, err := isLastAdmin(db, user)
+	if err != nil {
+		return nil, err
+	}
+	if last {
+		return nil, errLastAdmin
+	}
+	if !orphan {
+		if to == user.ID {
+			return nil, errUserTransferTarget
+		}
+		var n int64
+		if err := db.Model(&User{}).Where("id = ?", to).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errUserTransferTarget
+		}
+	}
+
+	result := &UserDeletion{ID: user.ID, Username: user.Username, TransferredTo: to, Orphaned: orphan, Transferred: map[string]int64{}}
+	if registry := ownership.Default(); registry != nil {
+		counts, err := registry.Transfer(ctx, uint(user.ID), uint(to))
+		if err != nil {
+			logger.Info("[AUDIT] ❌ 转移用户 %s(#%d) 的资源失败，用户未删除: %v by %s", user.Username, user.ID, err, actor)
+			return nil, fmt.Errorf("transfer resources of user %d: %w", user.ID, err)
+		}
+		result.Transferred = counts
+	}
+	if err := db.Delete(&User{}, user.ID).Error; err != nil {
+		logger.Info("[AUDIT] ❌ 删除用户 %s(#%d) 失败，资源已转给 #%d: %v by %s", user.Username, user.ID, to, err, actor)
+		return nil, err
+	}
+
+	target := fmt.Sprintf("#%d", to)
+	if orphan {
+		target = "系统用户"
+	}
+	logger.Info("[AUDIT] 👤 用户已删除: %s(#%d)，资源转给 %s %v by %s", user.Username, user.ID, target, result.Transferred, actor)
+	return result, nil
+}
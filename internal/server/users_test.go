@@ -0,0 +1,139 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"qwq/internal/container"
+	"qwq/internal/ownership"
+	"qwq/internal/website"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupUserDeletion 三个用户（1 号为唯一管理员），2 号用户有一个网站和一个 Compose 项目
+func setupUserDeletion(t *testing.T) *gorm.DB {
+	t.Helper()
+	setupDashboard(t).Create([]User{
+		{Username: "root", Roles: []string{adminRole}, Enabled: true},
+		{Username: "alice", Roles: []string{"developer"}, Enabled: true},
+		{Username: "bob", Roles: []string{"developer"}, Enabled: true},
+	})
+	t.Cleanup(func() { ownership.SetDefault(nil) })
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&website.Website{}, &container.ComposeProject{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&website.Website{Name: "shop", Domain: "shop.example.com", UserID: 2, TenantID: 1})
+	db.Create(&container.ComposeProject{Name: "shop", Content: "services: {}", Status: container.ProjectStatusRunning, UserID: 2, TenantID: 1})
+
+	registry := ownership.NewRegistry()
+	if err := registry.Register("website", db, &website.Website{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("container", db, &container.ComposeProject{}); err != nil {
+		t.Fatal(err)
+	}
+	ownership.SetDefault(registry)
+	return db
+}
+
+func deleteUserRequest(path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handleUserDetail(rec, httptest.NewRequest(http.MethodDelete, path, nil))
+	return rec
+}
+
+func userExists(id int) bool {
+	db, _ := dashboardDB()
+	var n int64
+	db.Model(&User{}).Where("id = ?", id).Count(&n)
+	return n > 0
+}
+
+func TestDeleteUser_TransfersResources(t *testing.T) {
+	db := setupUserDeletion(t)
+
+	for path, code := range map[string]string{
+		"/api/users/2":            "USER_DELETE_TARGET_REQUIRED",
+		"/api/users/2?orphan=yes": "USER_DELETE_TARGET_REQUIRED",
+		"/api/users/2?transfer_to=3&orphan=acknowledge": "USER_DELETE_TARGET_REQUIRED",
+		"/api/users/2?transfer_to=2":                    "USER_TRANSFER_TARGET_INVALID",
+		"/api/users/2?transfer_to=9":                    "USER_TRANSFER_TARGET_INVALID",
+	} {
+		rec := deleteUserRequest(path)
+		var body map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&body)
+		if rec.Code != http.StatusBadRequest || body["code"] != code {
+			t.Errorf("%s: expected 400 %s, got %d %v", path, code, rec.Code, body)
+		}
+	}
+	if !userExists(2) {
+		t.Fatal("Rejected deletions must keep the user")
+	}
+
+	rec := deleteUserRequest("/api/users/2?transfer_to=3")
+	var result UserDeletion
+	json.NewDecoder(rec.Body).Decode(&result)
+	if rec.Code != http.StatusOK || result.TransferredTo != 3 || result.Orphaned {
+		t.Fatalf("Expected the resources to move to user 3, got %d %+v", rec.Code, result)
+	}
+	if result.Transferred["website.websites"] != 1 || result.Transferred["container.compose_projects"] != 1 {
+		t.Errorf("Expected per-table counts, got %v", result.Transferred)
+	}
+	var site website.Website
+	var project container.ComposeProject
+	db.First(&site)
+	db.First(&project)
+	if site.UserID != 3 || project.UserID != 3 {
+		t.Errorf("Expected the website and project to belong to user 3, got %d and %d", site.UserID, project.UserID)
+	}
+	if userExists(2) {
+		t.Error("Expected the user to be deleted")
+	}
+}
+
+func TestDeleteUser_OrphanAcknowledge(t *testing.T) {
+	db := setupUserDeletion(t)
+	rec := deleteUserRequest("/api/users/2?orphan=acknowledge")
+	var result UserDeletion
+	json.NewDecoder(rec.Body).Decode(&result)
+	if rec.Code != http.StatusOK || !result.Orphaned || result.TransferredTo != int(ownership.SystemUserID) {
+		t.Fatalf("Expected the resources to move to the system user, got %d %+v", rec.Code, result)
+	}
+	var n int64
+	db.Model(&website.Website{}).Where("user_id = ?", ownership.SystemUserID).Count(&n)
+	if n != 1 {
+		t.Errorf("Expected the website to belong to the system user, got %d", n)
+	}
+}
+
+func TestDeleteUser_LastAdmin(t *testing.T) {
+	setupUserDeletion(t)
+	rec := deleteUserRequest("/api/users/1?transfer_to=2")
+	if rec.Code != http.StatusConflict || !userExists(1) {
+		t.Fatalf("Expected the last admin to be kept, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 有另一个启用的管理员时可以删除
+	db, _ := dashboardDB()
+	db.Save(&User{ID: 3, Username: "bob", Roles: []string{adminRole}, Enabled: true})
+	if rec := deleteUserRequest("/api/users/1?transfer_to=3"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the admin to be deleted, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := deleteUserRequest("/api/users/3?orphan=acknowledge"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected the remaining admin to be kept, got %d", rec.Code)
+	}
+}
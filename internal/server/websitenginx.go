@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/drift"
+	"qwq/internal/logger"
+	"qwq/internal/website"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// errNginxTest nginx -t 未通过，错误信息包含 nginx 的输出
+	errNginxTest = errors.New("nginx configuration test failed")
+	// errNginxReload nginx -s reload 失败，错误信息包含 nginx 的输出
+	errNginxReload = errors.New("nginx reload failed")
+)
+
+// websiteDomain 网站域名的格式，域名同时用作配置文件名和 server_name，不能包含路径分隔符或 nginx 语法字符
+var websiteDomain = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}$`)
+
+// nginxCommand 创建 nginx 命令，参数不经过 shell；测试中替换为假命令
+var nginxCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+	binary := config.Current().Websites.NginxBinary
+	if binary == "" {
+		binary = "nginx"
+	}
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// nginxWrites 串行化站点配置的写入、校验和重载：nginx -t 检查的是全部配置，并发写入会互相影响校验结果和回滚
+var nginxWrites sync.Mutex
+
+// websiteNginxPath 网站配置文件的路径，未配置 websites.nginx_sites_dir 时为空
+func websiteNginxPath(domain string) string {
+	dir := config.Current().Websites.NginxSitesDir
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, domain+".conf")
+}
+
+// renderWebsiteNginx 用 website.NginxConfigGenerator 生成网站的反向代理配置。
+// backend_url 为单个地址或地址的 JSON 数组，多个后端时按 load_balance 生成 upstream；
+// 启用 SSL 且已签发证书时生成 HTTPS 配置，Web 服务运行时把 ACME HTTP-01 挑战转发给 qwq
+func renderWebsiteNginx(ctx context.Context, site *Website) (string, error) {
+	proxy := &website.ProxyConfig{
+		Backend:           site.BackendURL,
+		LoadBalanceMethod: website.LoadBalanceMethod(site.LoadBalance),
+		Timeout:           60,
+		MaxBodySize:       10 << 20,
+		CustomConfig:      challengeLocation(),
+	}
+	if err := website.ValidateBackends(proxy); err != nil {
+		return "", err
+	}
+	cert := websiteCertificate(ctx, site)
+	return website.NewNginxConfigGenerator(&website.Website{
+		Name:        site.Domain,
+		Domain:      site.Domain,
+		SiteType:    website.SiteTypeProxy,
+		SSLEnabled:  cert != nil,
+		SSLCert:     cert,
+		ProxyConfig: proxy,
+	}).Generate()
+}
+
+// applyWebsiteNginx 按网站当前的状态写入或删除它的 nginx 配置：启用的网站写入生成的配置，停用的网站删除配置。
+// 未配置 websites.nginx_sites_dir 时不做任何事
+func applyWebsiteNginx(ctx context.Context, site *Website) error {
+	if websiteNginxPath(site.Domain) == "" {
+		return nil
+	}
+	if !site.Enabled {
+		return replaceWebsiteNginx(ctx, site.Domain, nil)
+	}
+	rendered, err := renderWebsiteNginx(ctx, site)
+	if err != nil {
+		return err
+	}
+	return replaceWebsiteNginx(ctx, site.Domain, []byte(rendered))
+}
+
+// removeWebsiteNginx 删除网站的 nginx 配置并重载，配置文件不存在时不重载
+func removeWebsiteNginx(ctx context.Context, domain string) error {
+	if websiteNginxPath(domain) == "" {
+		return nil
+	}
+	return replaceWebsiteNginx(ctx, domain, nil)
+}
+
+// replaceWebsiteNginx 将网站的配置文件替换为 content（nil 表示删除），nginx -t 通过后重载；
+// 校验或重载失败时恢复原来的文件，返回 nginx 的输出。写入和删除经过漂移跟踪，
+// 文件被手工修改且尚未处理时返回 drift.ErrConflict，不覆盖外部修改
+func replaceWebsiteNginx(ctx context.Context, domain string, content []byte) error {
+	nginxWrites.Lock()
+	defer nginxWrites.Unlock()
+
+	path := websiteNginxPath(domain)
+	target := drift.File{Path: path, Kind: drift.KindNginx, Owner: domain}
+	previous, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read nginx config: %w", err)
+	}
+	if content == nil && !existed {
+		return nil
+	}
+
+	if content == nil {
+		err = removeTrackedNginx(path)
+	} else {
+		err = driftTracker.Write(target, content, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write nginx config: %w", err)
+	}
+
+	if err := testAndReloadNginx(ctx); err != nil {
+		var rollback error
+		if existed {
+			rollback = driftTracker.Write(target, previous, 0644)
+		} else {
+			rollback = removeTrackedNginx(path)
+		}
+		if rollback != nil {
+			logger.Info("❌ 回滚网站 %s 的 nginx 配置失败: %v", domain, rollback)
+		}
+		return err
+	}
+	return nil
+}
+
+// removeTrackedNginx 删除托管的配置文件并停止跟踪，文件有未处理的外部修改时返回 drift.ErrConflict
+func removeTrackedNginx(path string) error {
+	if err := driftTracker.Check(path); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	driftTracker.Forget(path)
+	return nil
+}
+
+// testAndReloadNginx 运行 nginx -t，通过后执行 nginx -s reload
+func testAndReloadNginx(ctx context.Context) error {
+	if out, err := nginxCommand(ctx, "-t").CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", errNginxTest, nginxOutput(out, err))
+	}
+	if out, err := nginxCommand(ctx, "-s", "reload").CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", errNginxReload, nginxOutput(out, err))
+	}
+	return nil
+}
+
+// nginxOutput nginx 的输出，没有输出（如找不到 nginx）时使用执行错误
+func nginxOutput(out []byte, err error) string {
+	if output := strings.TrimSpace(string(out)); output != "" {
+		return output
+	}
+	return err.Error()
+}
+
+// writeNginxPreview 返回网站将要生成的 nginx 配置，不写入文件也不保存网站记录（dry_run=true）
+func writeNginxPreview(w http.ResponseWriter, r *http.Request, site *Website) {
+	rendered, err := renderWebsiteNginx(r.Context(), site)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domain":  site.Domain,
+		"enabled": site.Enabled,
+		"path":    websiteNginxPath(site.Domain),
+		"config":  rendered,
+	})
+}
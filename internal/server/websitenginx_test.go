@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/drift"
+	"strings"
+	"testing"
+)
+
+// fakeNginx 将站点配置写入临时目录，用 sh 代替 nginx；failTest 为 true 时 nginx -t 以 nginx 的错误输出失败
+func fakeNginx(t *testing.T) (dir string, calls *[]string, failTest *bool) {
+	t.Helper()
+	setupDashboard(t)
+	dir = t.TempDir()
+	saved, savedCommand, savedTracker := config.Current(), nginxCommand, driftTracker
+	t.Cleanup(func() {
+		config.Store(saved)
+		nginxCommand = savedCommand
+		driftTracker = savedTracker
+	})
+	driftTracker = drift.NewTracker("")
+	config.Update(func(cfg *config.Config) {
+		cfg.Websites = config.WebsitesConfig{NginxSitesDir: dir}
+	})
+	calls, failTest = &[]string{}, new(bool)
+	nginxCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+		*calls = append(*calls, strings.Join(args, " "))
+		if args[0] == "-t" && *failTest {
+			return exec.CommandContext(ctx, "sh", "-c", `echo 'nginx: [emerg] host not found in upstream "backend"' >&2; exit 1`)
+		}
+		return exec.CommandContext(ctx, "true")
+	}
+	return dir, calls, failTest
+}
+
+// websiteRequest 调用网站管理处理器
+func websiteRequest(method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if target == "/api/websites" || strings.HasPrefix(target, "/api/websites?") {
+		handleWebsites(rec, req)
+	} else {
+		handleWebsiteDetail(rec, req)
+	}
+	return rec
+}
+
+func TestWebsiteNginx_CreateUpdateDelete(t *testing.T) {
+	dir, calls, _ := fakeNginx(t)
+	path := filepath.Join(dir, "example.com.conf")
+
+	rec := websiteRequest(http.MethodPost, "/api/websites", `{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the website to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "server_name example.com;") || !strings.Contains(string(data), "proxy_pass http://127.0.0.1:8080;") {
+		t.Fatalf("Expected the generated vhost, got %q", data)
+	}
+	if strings.Join(*calls, ",") != "-t,-s reload" {
+		t.Errorf("Expected nginx -t before the reload, got %q", *calls)
+	}
+
+	rec = websiteRequest(http.MethodPut, "/api/websites/1", `{"backend_url":"[\"http://10.0.0.1:80\",\"http://10.0.0.2:80\"]","load_balance":"least_conn"}`)
+	if data, _ := os.ReadFile(path); rec.Code != http.StatusOK || !strings.Contains(string(data), "upstream backend_example_com") || !strings.Contains(string(data), "least_conn;") {
+		t.Fatalf("Expected the update to regenerate an upstream, got %d %q", rec.Code, data)
+	}
+
+	// 停用删除配置，重新启用时恢复
+	rec = websiteRequest(http.MethodPut, "/api/websites/1", `{"enabled":false}`)
+	if _, err := os.Stat(path); rec.Code != http.StatusOK || !os.IsNotExist(err) {
+		t.Fatalf("Expected disabling to remove the vhost, got %d %v", rec.Code, err)
+	}
+	rec = websiteRequest(http.MethodPut, "/api/websites/1", `{"enabled":true}`)
+	if _, err := os.Stat(path); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("Expected enabling to write the vhost, got %d %v", rec.Code, err)
+	}
+
+	*calls = nil
+	rec = websiteRequest(http.MethodDelete, "/api/websites/1", "")
+	if _, err := os.Stat(path); rec.Code != http.StatusNoContent || !os.IsNotExist(err) {
+		t.Fatalf("Expected deleting to remove the vhost, got %d %v", rec.Code, err)
+	}
+	if strings.Join(*calls, ",") != "-t,-s reload" {
+		t.Errorf("Expected nginx to be reloaded after the delete, got %q", *calls)
+	}
+}
+
+func TestWebsiteNginx_TestFailureRollsBack(t *testing.T) {
+	dir, calls, failTest := fakeNginx(t)
+	path := filepath.Join(dir, "example.com.conf")
+
+	*failTest = true
+	rec := websiteRequest(http.MethodPost, "/api/websites", `{"domain":"example.com","backend_url":"http://backend:8080"}`)
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusUnprocessableEntity || envelope.Code != "WEBSITE_NGINX_TEST_FAILED" || !strings.Contains(envelope.Message, "host not found") {
+		t.Fatalf("Expected the nginx error to be returned, got %d %+v", rec.Code, envelope)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the rejected vhost to be removed, got %v", err)
+	}
+	if sites, _ := listWebsites(); len(sites) != 0 {
+		t.Errorf("Expected no website record when nginx rejects the config, got %+v", sites)
+	}
+	if strings.Join(*calls, ",") != "-t" {
+		t.Errorf("Expected no reload after a failed test, got %q", *calls)
+	}
+
+	*failTest = false
+	if rec := websiteRequest(http.MethodPost, "/api/websites", `{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the website to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+	before, _ := os.ReadFile(path)
+	*failTest = true
+	rec = websiteRequest(http.MethodPut, "/api/websites/1", `{"backend_url":"http://backend:9090"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected the update to be rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("Expected the previous vhost to be restored, got %q", after)
+	}
+	if sites, _ := listWebsites(); len(sites) != 1 || sites[0].BackendURL != "http://127.0.0.1:8080" {
+		t.Errorf("Expected the rejected update not to be saved, got %+v", sites)
+	}
+}
+
+func TestWebsiteNginx_HandEditsConflict(t *testing.T) {
+	dir, calls, _ := fakeNginx(t)
+	path := filepath.Join(dir, "example.com.conf")
+
+	if rec := websiteRequest(http.MethodPost, "/api/websites", `{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the website to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+	if files := driftTracker.Files(); len(files) != 1 || files[0].Path != path || files[0].Kind != drift.KindNginx || files[0].Owner != "example.com" {
+		t.Fatalf("Expected the vhost to be tracked, got %+v", files)
+	}
+
+	// 手工修改后，更新和删除都返回冲突，不覆盖也不删除外部修改
+	edited := []byte("# hand edit\n")
+	os.WriteFile(path, edited, 0644)
+	*calls = nil
+	rec := websiteRequest(http.MethodPut, "/api/websites/1", `{"backend_url":"http://127.0.0.1:9090"}`)
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusConflict || envelope.Code != "DRIFT_CONFLICT" {
+		t.Fatalf("Expected a drift conflict, got %d %+v", rec.Code, envelope)
+	}
+	rec = websiteRequest(http.MethodDelete, "/api/websites/1", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected the delete to conflict, got %d %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(edited) {
+		t.Errorf("Expected the hand edit to be kept, got %q", data)
+	}
+	if events := driftTracker.Events(true); len(events) != 1 || events[0].Path != path {
+		t.Errorf("Expected one open drift event, got %+v", events)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("Expected nginx not to be reloaded, got %q", *calls)
+	}
+	if sites, _ := listWebsites(); len(sites) != 1 || sites[0].BackendURL != "http://127.0.0.1:8080" {
+		t.Errorf("Expected the conflicting update not to be saved, got %+v", sites)
+	}
+}
+
+func TestWebsiteNginx_DryRunAndValidation(t *testing.T) {
+	dir, calls, _ := fakeNginx(t)
+
+	rec := websiteRequest(http.MethodPost, "/api/websites?dry_run=true", `{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`)
+	var preview struct {
+		Path   string `json:"path"`
+		Config string `json:"config"`
+	}
+	json.NewDecoder(rec.Body).Decode(&preview)
+	if rec.Code != http.StatusOK || preview.Path != filepath.Join(dir, "example.com.conf") || !strings.Contains(preview.Config, "proxy_pass http://127.0.0.1:8080;") {
+		t.Fatalf("Expected the rendered config, got %d %+v", rec.Code, preview)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 || len(*calls) != 0 {
+		t.Errorf("A dry run must not write or run nginx, got %d files and %q", len(entries), *calls)
+	}
+	if sites, _ := listWebsites(); len(sites) != 0 {
+		t.Errorf("A dry run must not save the website, got %+v", sites)
+	}
+
+	for body, code := range map[string]string{
+		`{"domain":"../../etc/passwd","backend_url":"http://127.0.0.1:8080"}`:       "WEBSITE_INVALID_DOMAIN",
+		`{"domain":"example.com; include /etc/shadow","backend_url":"http://a:80"}`: "WEBSITE_INVALID_DOMAIN",
+		`{"domain":"example.com","backend_url":"http://a:80; return 200"}`:          "WEBSITE_INVALID_BACKEND",
+		`{"domain":"example.com"}`: "WEBSITE_INVALID_BACKEND",
+	} {
+		rec := websiteRequest(http.MethodPost, "/api/websites", body)
+		if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusBadRequest || envelope.Code != code {
+			t.Errorf("%s: expected %s, got %d %+v", body, code, rec.Code, envelope)
+		}
+	}
+	if len(*calls) != 0 {
+		t.Errorf("Rejected websites must not run nginx, got %q", *calls)
+	}
+}
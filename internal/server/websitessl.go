@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"qwq/internal/apierror"
+	"qwq/internal/config"
+	"qwq/internal/website"
+	"sync"
+)
+
+// defaultChallengePath ACME HTTP-01 挑战的默认路径
+const defaultChallengePath = "/.well-known/acme-challenge/"
+
+var (
+	// certificates 网站证书服务，由启动时注入（需要网站数据库）；未注入时控制台不能申请证书
+	certificates   website.SSLService
+	certificatesMu sync.RWMutex
+
+	// listenAddr Web 服务的监听地址，生成的 nginx 配置把 HTTP-01 挑战转发到这里
+	listenAddr string
+)
+
+// errCertificatesUnavailable 网站数据库不可用，无法申请证书
+var errCertificatesUnavailable = apierror.New(http.StatusServiceUnavailable, "SSL_UNAVAILABLE", "Certificate service is not available")
+
+// SetCertificateService 设置控制台申请和续期证书使用的证书服务
+func SetCertificateService(service website.SSLService) {
+	certificatesMu.Lock()
+	defer certificatesMu.Unlock()
+	certificates = service
+}
+
+// certificateService 当前的证书服务，未设置时为 nil
+func certificateService() website.SSLService {
+	certificatesMu.RLock()
+	defer certificatesMu.RUnlock()
+	return certificates
+}
+
+// acmeChallengePath 挂载 HTTP-01 挑战的路径，以 / 结尾
+func acmeChallengePath() string {
+	path := config.Current().ACME.ChallengePath
+	if path == "" {
+		return defaultChallengePath
+	}
+	if path[len(path)-1] != '/' {
+		path += "/"
+	}
+	return path
+}
+
+// challengeUpstream nginx 转发 HTTP-01 挑战的地址，监听所有地址时使用本机回环地址；Web 服务未启动时为空
+func challengeUpstream() string {
+	if listenAddr == "" {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return ""
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// challengeLocation 转发 HTTP-01 挑战到 qwq 的 location，优先于站点的其他 location
+func challengeLocation() string {
+	upstream := challengeUpstream()
+	if upstream == "" {
+		return ""
+	}
+	return fmt.Sprintf("location ^~ %s {\n    proxy_pass %s;\n    proxy_set_header Host $host;\n}", acmeChallengePath(), upstream)
+}
+
+// websiteCertificate 网站启用 SSL 时使用的有效证书，没有证书时返回 nil
+func websiteCertificate(ctx context.Context, site *Website) *website.SSLCert {
+	service := certificateService()
+	if !site.SSLEnabled || service == nil {
+		return nil
+	}
+	cert, err := service.GetSSLCertByDomain(ctx, site.Domain)
+	if err != nil || cert.Status != website.SSLStatusValid || cert.CertPath == "" {
+		return nil
+	}
+	return cert
+}
+
+// issueWebsiteCertificate 为网站申请（apply）或续期（renew）Let's Encrypt 证书，返回新的证书
+func issueWebsiteCertificate(ctx context.Context, service website.SSLService, site *Website, action string) (*website.SSLCert, error) {
+	if action == "apply" {
+		cert, err := service.RequestCertificate(ctx, site.Domain, "", website.SSLProviderLetsEncrypt)
+		if err != nil {
+			return nil, apierror.Wrap(http.StatusBadGateway, "SSL_ISSUE_FAILED", err)
+		}
+		return cert, nil
+	}
+
+	cert, err := service.GetSSLCertByDomain(ctx, site.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.RenewCertificate(ctx, cert.ID); err != nil {
+		if errors.Is(err, website.ErrRenewalNotDue) {
+			return nil, err
+		}
+		return nil, apierror.Wrap(http.StatusBadGateway, "SSL_RENEW_FAILED", err)
+	}
+	return service.GetSSLCert(ctx, cert.ID)
+}
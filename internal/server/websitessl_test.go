@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"qwq/internal/config"
+	"qwq/internal/website"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeCertificates 使用临时证书目录和内存数据库的证书服务，issueErr 非空时签发失败
+func fakeCertificates(t *testing.T) (certDir string, issueErr *error) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&website.SSLCert{}); err != nil {
+		t.Fatal(err)
+	}
+
+	certDir, issueErr = t.TempDir(), new(error)
+	config.Update(func(cfg *config.Config) { cfg.ACME.CertDir = certDir })
+	issue := func(ctx context.Context, domains []string, email string) (*website.CertificateBundle, error) {
+		if *issueErr != nil {
+			return nil, *issueErr
+		}
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: domains[0]},
+			DNSNames:     domains,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().AddDate(0, 0, 90),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			return nil, err
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return &website.CertificateBundle{
+			Domain:      domains[0],
+			Domains:     domains,
+			Issuer:      "Fake LE",
+			Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			NotBefore:   template.NotBefore,
+			NotAfter:    template.NotAfter,
+		}, nil
+	}
+	saved := certificateService()
+	t.Cleanup(func() { SetCertificateService(saved) })
+	SetCertificateService(website.NewSSLServiceWithIssuer(db, issue))
+	return certDir, issueErr
+}
+
+func TestWebsiteSSL_ApplyEnablesHTTPS(t *testing.T) {
+	dir, _, _ := fakeNginx(t)
+	certDir, issueErr := fakeCertificates(t)
+	path := filepath.Join(dir, "example.com.conf")
+	if rec := websiteRequest(http.MethodPost, "/api/websites", `{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the website to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	*issueErr = errors.New("urn:ietf:params:acme:error:connection: Timeout during connect")
+	rec := websiteRequest(http.MethodPost, "/api/websites/1/ssl/apply", "")
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusBadGateway || envelope.Code != "SSL_ISSUE_FAILED" || !strings.Contains(envelope.Message, "Timeout during connect") {
+		t.Fatalf("Expected the ACME error to be returned, got %d %+v", rec.Code, envelope)
+	}
+	if sites, _ := listWebsites(); sites[0].SSLEnabled {
+		t.Error("A failed issuance must not enable SSL")
+	}
+
+	*issueErr = nil
+	rec = websiteRequest(http.MethodPost, "/api/websites/1/ssl/apply", "")
+	var body map[string]string
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body["ssl_cert_expiry"] == "" {
+		t.Fatalf("Expected the certificate to be issued, got %d %v", rec.Code, body)
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"listen 443 ssl", "ssl_certificate " + filepath.Join(certDir, "example_com.crt") + ";", "return 301 https://"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %q in the vhost:\n%s", want, data)
+		}
+	}
+	if sites, _ := listWebsites(); !sites[0].SSLEnabled || sites[0].SSLCertExpiry != body["ssl_cert_expiry"] {
+		t.Errorf("Expected SSL to be enabled with the certificate expiry, got %+v", sites[0])
+	}
+
+	// 新证书还未进入续期窗口
+	rec = websiteRequest(http.MethodPost, "/api/websites/1/ssl/renew", "")
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusConflict || envelope.Code != "SSL_RENEWAL_NOT_DUE" {
+		t.Errorf("Expected renewal to be refused outside the window, got %d %+v", rec.Code, envelope)
+	}
+}
+
+func TestWebsiteSSL_Unavailable(t *testing.T) {
+	fakeNginx(t)
+	saved := certificateService()
+	t.Cleanup(func() { SetCertificateService(saved) })
+	SetCertificateService(nil)
+	websiteRequest(http.MethodPost, "/api/websites", `{"domain":"example.com","backend_url":"http://127.0.0.1:8080"}`)
+
+	rec := websiteRequest(http.MethodPost, "/api/websites/1/ssl/apply", "")
+	if envelope := decodeEnvelope(t, rec); rec.Code != http.StatusServiceUnavailable || envelope.Code != "SSL_UNAVAILABLE" {
+		t.Errorf("Expected 503 without a certificate service, got %d %+v", rec.Code, envelope)
+	}
+}
+
+func TestWebsiteNginx_ForwardsACMEChallenges(t *testing.T) {
+	fakeNginx(t)
+	savedAddr := listenAddr
+	t.Cleanup(func() { listenAddr = savedAddr })
+	listenAddr = ":8899"
+
+	rendered, err := renderWebsiteNginx(context.Background(), &Website{Domain: "example.com", BackendURL: "http://127.0.0.1:8080", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered, "location ^~ /.well-known/acme-challenge/ {") || !strings.Contains(rendered, "proxy_pass http://127.0.0.1:8899;") {
+		t.Errorf("Expected HTTP-01 challenges to be forwarded to qwq:\n%s", rendered)
+	}
+}
@@ -0,0 +1,199 @@
+// Package session 签发和校验 Web 控制台的登录令牌：HS256 签名的 JWT，带有用户名、角色和过期时间；
+// 注销的令牌在过期之前记录在内存中的吊销列表里
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL 登录令牌的默认有效期
+	DefaultTTL = 24 * time.Hour
+	// DefaultSecretFile 未配置密钥时，首次启动生成的签名密钥的保存位置
+	DefaultSecretFile = "qwq_jwt_secret"
+	// secretBytes 生成的签名密钥长度
+	secretBytes = 32
+)
+
+var (
+	// ErrInvalidToken 令牌格式错误或签名不匹配
+	ErrInvalidToken = errors.New("invalid session token")
+	// ErrTokenExpired 令牌已过期
+	ErrTokenExpired = errors.New("session token expired")
+	// ErrTokenRevoked 令牌已注销
+	ErrTokenRevoked = errors.New("session token revoked")
+)
+
+// jwtHeader 固定的 JWT 头，校验时拒绝其他算法（包括 none）
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims 登录令牌中的声明
+type Claims struct {
+	Subject   string   `json:"sub"` // 用户名
+	Roles     []string `json:"roles"`
+	ID        string   `json:"jti"` // 令牌 ID，注销时记入吊销列表
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// Expiry 令牌的过期时间
+func (c *Claims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// Manager 签发、校验和注销登录令牌
+type Manager struct {
+	secret []byte
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	revoked map[string]int64 // 令牌 ID -> 过期时间，过期后从列表中清除
+}
+
+// NewManager 创建令牌管理器，ttl 不大于 0 时使用 DefaultTTL
+func NewManager(secret []byte, ttl time.Duration) *Manager {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Manager{secret: secret, ttl: ttl, revoked: make(map[string]int64)}
+}
+
+// TTL 令牌有效期
+func (m *Manager) TTL() time.Duration { return m.ttl }
+
+// Issue 为用户签发令牌
+func (m *Manager) Issue(username string, roles []string) (string, *Claims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("generate token id: %w", err)
+	}
+	now := time.Now()
+	claims := &Claims{
+		Subject:   username,
+		Roles:     roles,
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.ttl).Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + m.sign(unsigned), claims, nil
+}
+
+// Verify 校验令牌的签名、过期时间和吊销状态，返回其中的声明
+func (m *Manager) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(m.sign(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.revoked[claims.ID]; ok {
+		return nil, ErrTokenRevoked
+	}
+	return &claims, nil
+}
+
+// Revoke 注销令牌，直到过期之前都会被拒绝；同时清除已过期的吊销记录
+func (m *Manager) Revoke(claims *Claims) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	for id, expires := range m.revoked {
+		if now >= expires {
+			delete(m.revoked, id)
+		}
+	}
+	m.revoked[claims.ID] = claims.ExpiresAt
+}
+
+func (m *Manager) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LoadSecret 读取保存的签名密钥，文件不存在时生成随机密钥并以 0600 权限保存，重启后已签发的令牌仍然有效
+func LoadSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < secretBytes {
+			return nil, fmt.Errorf("invalid session secret in %s", path)
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("save session secret: %w", err)
+	}
+	return secret, nil
+}
+
+var (
+	defaultManagerMu sync.RWMutex
+	defaultManager   *Manager
+)
+
+// SetDefault 设置全局令牌管理器，Web 服务通过它签发和校验登录令牌
+func SetDefault(manager *Manager) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+	defaultManager = manager
+}
+
+// Default 返回全局令牌管理器，未启用时为 nil
+func Default() *Manager {
+	defaultManagerMu.RLock()
+	defer defaultManagerMu.RUnlock()
+	return defaultManager
+}
+
+// claimsKey 请求上下文中认证通过的登录令牌声明
+type claimsKey struct{}
+
+// WithClaims 把认证通过的令牌声明放入上下文
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext 请求使用的登录令牌声明，不是通过登录令牌认证时返回 nil
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+	return claims
+}
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_IssueVerifyRevoke(t *testing.T) {
+	manager := NewManager([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	token, claims, err := manager.Issue("admin", []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(token, ".") != 2 || claims.ExpiresAt-claims.IssuedAt != 3600 {
+		t.Fatalf("Expected a JWT valid for an hour, got %q %+v", token, claims)
+	}
+	verified, err := manager.Verify(token)
+	if err != nil || verified.Subject != "admin" || verified.Roles[0] != "admin" || verified.ID != claims.ID {
+		t.Fatalf("Verify = %+v, %v", verified, err)
+	}
+
+	// 其他密钥签名和篡改过的令牌无效
+	other := NewManager([]byte("another secret with enough bytes!"), time.Hour)
+	if _, err := other.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a token signed with another secret to be invalid, got %v", err)
+	}
+	parts := strings.Split(token, ".")
+	forged, _, _ := other.Issue("admin", []string{"admin"})
+	if _, err := manager.Verify(parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a tampered payload to be invalid, got %v", err)
+	}
+	if _, err := manager.Verify("eyJhbGciOiJub25lIn0." + parts[1] + "."); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected alg none to be rejected, got %v", err)
+	}
+
+	manager.Revoke(verified)
+	if _, err := manager.Verify(token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected a revoked token to be rejected, got %v", err)
+	}
+
+	expired, _, _ := NewManager([]byte("0123456789abcdef0123456789abcdef"), time.Nanosecond).Issue("admin", nil)
+	if _, err := manager.Verify(expired); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected an expired token, got %v", err)
+	}
+}
+
+func TestLoadSecret_PersistsGeneratedSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	first, err := LoadSecret(path)
+	if err != nil || len(first) != secretBytes {
+		t.Fatalf("LoadSecret = %x, %v", first, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the secret file to be private, got %v %v", info, err)
+	}
+	second, err := LoadSecret(path)
+	if err != nil || string(second) != string(first) {
+		t.Errorf("Expected the saved secret to be reused, got %x %v", second, err)
+	}
+	os.WriteFile(path, []byte("short"), 0600)
+	if _, err := LoadSecret(path); err == nil {
+		t.Error("Expected an invalid secret file to be rejected")
+	}
+}
@@ -0,0 +1,266 @@
+// Package slash 对话中的斜杠命令（如 /patrol、/status），直接执行内部操作而不经过 AI
+// 命令按注册表分发，新增命令只需一次 Register；CLI 和 Web 终端共用同一张表
+package slash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Prefix 斜杠命令的前缀
+const Prefix = "/"
+
+var (
+	// ErrUnknownCommand 未注册的命令
+	ErrUnknownCommand = errors.New("unknown command")
+	// ErrForbidden 调用者没有对应 API 的权限
+	ErrForbidden = errors.New("permission denied")
+)
+
+// Command 一条斜杠命令
+// Method 和 Path 是等价的 API，调用前按该接口的权限规则检查，保证对话和 API 的权限一致
+type Command struct {
+	Name    string // 命令名，不含前缀
+	Args    string // 参数说明，如 "[n]"
+	Summary string // 一句话说明，显示在 /help 中
+	Method  string // 等价 API 的方法，为空时不检查权限
+	Path    string // 等价 API 的路径
+	Run     func(ctx context.Context, args []string) (*Result, error)
+}
+
+// Mutates 命令是否会改变状态（等价 API 不是只读请求）
+func (c *Command) Mutates() bool {
+	return c.Method != "" && c.Method != http.MethodGet && c.Method != http.MethodHead
+}
+
+type actorKey struct{}
+
+// WithActor 在上下文中记录命令发起人，用于审计日志
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor 命令发起人，未记录时为 "unknown"
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "unknown"
+}
+
+// Authorizer 判断调用者能否访问等价 API，nil 表示本机操作者，拥有全部权限
+type Authorizer func(method, path string) bool
+
+// Result 命令结果：标题、说明文字和可选的表格
+type Result struct {
+	Title   string     `json:"title,omitempty"`
+	Text    string     `json:"text,omitempty"`
+	Columns []string   `json:"columns,omitempty"`
+	Rows    [][]string `json:"rows,omitempty"`
+}
+
+// Markdown 渲染为 Markdown，表格使用 GFM 语法
+func (r *Result) Markdown() string {
+	var b strings.Builder
+	if r.Title != "" {
+		fmt.Fprintf(&b, "**%s**\n\n", r.Title)
+	}
+	if r.Text != "" {
+		b.WriteString(r.Text)
+		b.WriteString("\n\n")
+	}
+	if len(r.Columns) > 0 && len(r.Rows) > 0 {
+		b.WriteString("|")
+		for _, c := range r.Columns {
+			b.WriteString(" " + markdownCell(c) + " |")
+		}
+		b.WriteString("\n|")
+		for range r.Columns {
+			b.WriteString(" :--- |")
+		}
+		b.WriteString("\n")
+		for _, row := range r.Rows {
+			b.WriteString("|")
+			for i := range r.Columns {
+				cell := ""
+				if i < len(row) {
+					cell = row[i]
+				}
+				b.WriteString(" " + markdownCell(cell) + " |")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// markdownCell 转义表格单元格中的竖线和换行
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// UnknownCommandError 未知命令，附带相近的命令名
+type UnknownCommandError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownCommandError) Error() string {
+	msg := fmt.Sprintf("未知命令 %s%s", Prefix, e.Name)
+	if len(e.Suggestions) > 0 {
+		names := make([]string, len(e.Suggestions))
+		for i, s := range e.Suggestions {
+			names[i] = Prefix + s
+		}
+		msg += "，是否要输入 " + strings.Join(names, " 或 ") + "？"
+	} else {
+		msg += "，"
+	}
+	return msg + "输入 /help 查看所有命令"
+}
+
+func (e *UnknownCommandError) Is(target error) bool { return target == ErrUnknownCommand }
+
+// Dispatcher 斜杠命令注册表
+type Dispatcher struct {
+	mu       sync.RWMutex
+	commands map[string]*Command
+}
+
+// New 创建注册表，内置 /help
+func New() *Dispatcher {
+	d := &Dispatcher{commands: make(map[string]*Command)}
+	d.Register(Command{Name: "help", Summary: "列出所有斜杠命令", Run: d.help})
+	return d
+}
+
+// Register 注册命令，同名命令会被替换
+func (d *Dispatcher) Register(cmd Command) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := strings.ToLower(strings.TrimPrefix(cmd.Name, Prefix))
+	cmd.Name = name
+	d.commands[name] = &cmd
+}
+
+// Commands 已注册的命令，按名称排序
+func (d *Dispatcher) Commands() []Command {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	cmds := make([]Command, 0, len(d.commands))
+	for _, c := range d.commands {
+		cmds = append(cmds, *c)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// IsCommand 输入是否为斜杠命令；"/" 开头的路径（如 /var/log 磁盘满了吗）不算命令
+func IsCommand(input string) bool {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, Prefix) || len(input) == len(Prefix) {
+		return false
+	}
+	name, _, _ := strings.Cut(input[len(Prefix):], " ")
+	return !strings.Contains(name, Prefix)
+}
+
+// Dispatch 解析并执行命令；authorize 为 nil 时不检查权限
+func (d *Dispatcher) Dispatch(ctx context.Context, input string, authorize Authorizer) (*Result, error) {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(input), Prefix))
+	if len(fields) == 0 {
+		return nil, &UnknownCommandError{}
+	}
+	name := strings.ToLower(fields[0])
+
+	d.mu.RLock()
+	cmd, ok := d.commands[name]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, &UnknownCommandError{Name: name, Suggestions: d.suggest(name)}
+	}
+	if authorize != nil && cmd.Method != "" && !authorize(cmd.Method, cmd.Path) {
+		return nil, fmt.Errorf("%w: %s%s 需要 %s %s 的权限", ErrForbidden, Prefix, name, cmd.Method, cmd.Path)
+	}
+	return cmd.Run(ctx, fields[1:])
+}
+
+// suggest 相近的命令名：前缀匹配或编辑距离不超过 2，最多 3 个
+func (d *Dispatcher) suggest(name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	d.mu.RLock()
+	var candidates []candidate
+	for n := range d.commands {
+		distance := levenshtein(name, n)
+		if strings.HasPrefix(n, name) || strings.HasPrefix(name, n) {
+			distance = 0
+		}
+		if distance <= 2 {
+			candidates = append(candidates, candidate{n, distance})
+		}
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	if len(candidates) > 3 {
+		candidates = candidates[:3]
+	}
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.name
+	}
+	return names
+}
+
+// levenshtein 编辑距离，按字符计算
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+func (d *Dispatcher) help(ctx context.Context, args []string) (*Result, error) {
+	result := &Result{Title: "斜杠命令", Text: "以 / 开头的消息直接执行，不经过 AI", Columns: []string{"命令", "说明"}}
+	for _, c := range d.Commands() {
+		usage := Prefix + c.Name
+		if c.Args != "" {
+			usage += " " + c.Args
+		}
+		summary := c.Summary
+		if c.Mutates() {
+			summary += "（需要 " + c.Method + " " + c.Path + " 的权限）"
+		}
+		result.Rows = append(result.Rows, []string{usage, summary})
+	}
+	return result, nil
+}
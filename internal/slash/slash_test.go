@@ -0,0 +1,117 @@
+package slash
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testDispatcher(ran *[]string) *Dispatcher {
+	d := New()
+	d.Register(Command{Name: "patrol", Summary: "巡检", Method: http.MethodPost, Path: "/api/trigger",
+		Run: func(ctx context.Context, args []string) (*Result, error) {
+			*ran = append(*ran, "patrol by "+Actor(ctx))
+			return &Result{Text: "started"}, nil
+		}})
+	d.Register(Command{Name: "/status", Summary: "状态", Method: http.MethodGet, Path: "/api/stats",
+		Run: func(ctx context.Context, args []string) (*Result, error) {
+			*ran = append(*ran, "status "+strings.Join(args, ","))
+			return &Result{Columns: []string{"指标", "状态"}, Rows: [][]string{{"负载", "0.1|0.2"}}}, nil
+		}})
+	return d
+}
+
+func TestIsCommand(t *testing.T) {
+	for input, want := range map[string]bool{
+		"/patrol":       true,
+		"  /status now": true,
+		"/":             false,
+		"/var/log 满了吗":  false,
+		"查看 /etc/hosts": false,
+		"patrol":        false,
+	} {
+		if got := IsCommand(input); got != want {
+			t.Errorf("IsCommand(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestDispatch_RunsRegisteredCommand(t *testing.T) {
+	var ran []string
+	d := testDispatcher(&ran)
+	ctx := WithActor(context.Background(), "alice")
+	if _, err := d.Dispatch(ctx, "/PATROL", nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err := d.Dispatch(ctx, "/status  a b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0] != "patrol by alice" || ran[1] != "status a,b" {
+		t.Errorf("Unexpected runs %v", ran)
+	}
+	want := "| 指标 | 状态 |\n| :--- | :--- |\n| 负载 | 0.1\\|0.2 |\n"
+	if md := result.Markdown(); md != want {
+		t.Errorf("Expected an escaped markdown table, got %q", md)
+	}
+}
+
+func TestDispatch_SuggestsCloseMatches(t *testing.T) {
+	var ran []string
+	d := testDispatcher(&ran)
+	_, err := d.Dispatch(context.Background(), "/stauts", nil)
+	var unknown *UnknownCommandError
+	if !errors.Is(err, ErrUnknownCommand) || !errors.As(err, &unknown) {
+		t.Fatalf("Expected ErrUnknownCommand, got %v", err)
+	}
+	if len(unknown.Suggestions) != 1 || unknown.Suggestions[0] != "status" || !strings.Contains(err.Error(), "/status") {
+		t.Errorf("Expected /status to be suggested, got %v", unknown.Suggestions)
+	}
+	if _, err := d.Dispatch(context.Background(), "/pa", nil); !errors.As(err, &unknown) || len(unknown.Suggestions) != 1 || unknown.Suggestions[0] != "patrol" {
+		t.Errorf("Expected a prefix to suggest /patrol, got %v", err)
+	}
+	if _, err := d.Dispatch(context.Background(), "/deploy", nil); !errors.As(err, &unknown) || len(unknown.Suggestions) != 0 {
+		t.Errorf("Expected no suggestions for an unrelated command, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Unknown commands must not run anything, got %v", ran)
+	}
+}
+
+func TestDispatch_ChecksEquivalentAPI(t *testing.T) {
+	var ran []string
+	d := testDispatcher(&ran)
+	var checked []string
+	readOnly := func(method, path string) bool {
+		checked = append(checked, method+" "+path)
+		return method == http.MethodGet
+	}
+	if _, err := d.Dispatch(context.Background(), "/patrol", readOnly); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden, got %v", err)
+	}
+	if _, err := d.Dispatch(context.Background(), "/status", readOnly); err != nil {
+		t.Errorf("Expected read commands to be allowed, got %v", err)
+	}
+	if _, err := d.Dispatch(context.Background(), "/help", readOnly); err != nil {
+		t.Errorf("Expected /help to need no permission, got %v", err)
+	}
+	if len(checked) != 2 || checked[0] != "POST /api/trigger" || len(ran) != 1 {
+		t.Errorf("Unexpected checks %v runs %v", checked, ran)
+	}
+}
+
+func TestHelp_ListsCommands(t *testing.T) {
+	var ran []string
+	result, err := testDispatcher(&ran).Dispatch(context.Background(), "/help", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 3 || result.Rows[0][0] != "/help" || result.Rows[1][0] != "/patrol" {
+		t.Fatalf("Expected sorted commands, got %v", result.Rows)
+	}
+	if !strings.Contains(result.Rows[1][1], "POST /api/trigger") || strings.Contains(result.Rows[2][1], "/api/stats") {
+		t.Errorf("Expected only mutating commands to mention their permission, got %v", result.Rows)
+	}
+}
@@ -0,0 +1,248 @@
+// Package spa 提供嵌入的前端单页应用：启动时一次性读取全部文件，预先计算 ETag 和 gzip 压缩结果，
+// 按文件名是否带内容哈希设置缓存策略，并支持 304 协商
+package spa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexFile 单页应用入口，页面路由都回退到它
+const IndexFile = "index.html"
+
+// minCompressSize 小于该大小的文件不压缩，压缩头的开销抵消了收益
+const minCompressSize = 1024
+
+// assetsDir Vite 输出带哈希文件名的目录
+const assetsDir = "assets/"
+
+// 缓存策略
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable" // 文件名带内容哈希，内容变化时文件名随之变化
+	cacheRevalidate = "no-cache"                            // 每次用 ETag 协商，未变化时返回 304
+)
+
+var (
+	// ErrMissingIndex 前端构建产物中没有 index.html
+	ErrMissingIndex = errors.New("frontend build has no index.html")
+	// ErrMissingAssets index.html 引用的资源不在构建产物中
+	ErrMissingAssets = errors.New("frontend build is missing assets referenced by index.html")
+)
+
+// hashedName Vite 生成的带内容哈希的文件名，如 index-DlAUqK2U.js
+var hashedName = regexp.MustCompile(`-[A-Za-z0-9_-]{8}\.[a-z0-9]+$`)
+
+// assetRef index.html 中引用的本地资源
+var assetRef = regexp.MustCompile(`(?:src|href)="/?(assets/[^"?#]+)"`)
+
+// asset 预处理后的文件
+type asset struct {
+	name        string
+	body        []byte
+	gzipped     []byte // 压缩后没有变小时为空
+	etag        string
+	contentType string
+	cache       string
+}
+
+// Site 预热后的前端文件
+type Site struct {
+	assets map[string]*asset
+	index  *asset
+}
+
+// Load 读取 fsys 下的全部文件并预先计算 ETag 和压缩结果，检查 index.html 及其引用的资源是否存在
+func Load(fsys fs.FS) (*Site, error) {
+	site := &Site{assets: make(map[string]*asset)}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		site.assets[name] = newAsset(name, body)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read frontend build: %w", err)
+	}
+	if site.index = site.assets[IndexFile]; site.index == nil {
+		return nil, ErrMissingIndex
+	}
+	if missing := site.Missing(); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingAssets, strings.Join(missing, ", "))
+	}
+	return site, nil
+}
+
+// Validate 检查构建产物是否完整，用于构建时提前发现缺失的 dist
+func Validate(fsys fs.FS) error {
+	_, err := Load(fsys)
+	return err
+}
+
+// Missing index.html 引用但不存在的资源
+func (s *Site) Missing() []string {
+	var missing []string
+	for _, match := range assetRef.FindAllStringSubmatch(string(s.index.body), -1) {
+		if _, ok := s.assets[match[1]]; !ok {
+			missing = append(missing, match[1])
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Files 文件数和总大小（未压缩）
+func (s *Site) Files() (int, int64) {
+	var size int64
+	for _, a := range s.assets {
+		size += int64(len(a.body))
+	}
+	return len(s.assets), size
+}
+
+func newAsset(name string, body []byte) *asset {
+	sum := sha256.Sum256(body)
+	a := &asset{
+		name:        name,
+		body:        body,
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		contentType: ContentType(name),
+		cache:       cacheRevalidate,
+	}
+	if strings.HasPrefix(name, assetsDir) && hashedName.MatchString(name) {
+		a.cache = cacheImmutable
+	}
+	if compressible(a.contentType) && len(body) >= minCompressSize {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(body)
+		zw.Close()
+		if buf.Len() < len(body) {
+			a.gzipped = buf.Bytes()
+		}
+	}
+	return a
+}
+
+// ServeHTTP 返回静态文件；不存在的页面路由返回 index.html，不存在的静态资源返回 404
+func (s *Site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = IndexFile
+	}
+	a, ok := s.assets[name]
+	switch {
+	case ok && (isStatic(name) || strings.HasSuffix(name, ".html")):
+	case name == "favicon.ico":
+		// 没有图标时返回 204，避免浏览器报错
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case isStatic(name):
+		http.NotFound(w, r)
+		return
+	default:
+		a = s.index
+	}
+	s.serve(w, r, a)
+}
+
+func (s *Site) serve(w http.ResponseWriter, r *http.Request, a *asset) {
+	h := w.Header()
+	h.Set("Content-Type", a.contentType)
+	h.Set("Cache-Control", a.cache)
+	body, etag := a.body, a.etag
+	if a.gzipped != nil {
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			// 压缩后的内容是另一种表示，使用不同的强 ETag
+			body, etag = a.gzipped, strings.TrimSuffix(a.etag, `"`)+`-gz"`
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	h.Set("ETag", etag)
+	// ServeContent 处理 If-None-Match（304）、HEAD 和 Range
+	http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(body))
+}
+
+// acceptsGzip Accept-Encoding 是否接受 gzip，q=0 表示拒绝
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if coding = strings.TrimSpace(coding); coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isStatic 按路径判断是否为静态资源，静态资源不存在时返回 404 而不是回退到 index.html
+func isStatic(name string) bool {
+	if strings.HasPrefix(name, assetsDir) {
+		return true
+	}
+	switch path.Ext(name) {
+	case ".js", ".css", ".png", ".jpg", ".jpeg", ".svg", ".json", ".woff", ".woff2", ".ttf", ".map", ".ico":
+		return true
+	}
+	return false
+}
+
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.HasPrefix(contentType, "application/javascript") ||
+		strings.HasPrefix(contentType, "application/json") ||
+		strings.HasPrefix(contentType, "image/svg+xml")
+}
+
+// ContentType 按扩展名返回 Content-Type
+func ContentType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".js":
+		return "application/javascript; charset=utf-8"
+	case ".css":
+		return "text/css; charset=utf-8"
+	case ".json", ".map":
+		return "application/json; charset=utf-8"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".svg":
+		return "image/svg+xml"
+	case ".ico":
+		return "image/x-icon"
+	case ".woff":
+		return "font/woff"
+	case ".woff2":
+		return "font/woff2"
+	case ".ttf":
+		return "font/ttf"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
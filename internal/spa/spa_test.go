@@ -0,0 +1,165 @@
+package spa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testIndex = `<!doctype html><html><head>
+<script type="module" crossorigin src="/assets/index-DlAUqK2U.js"></script>
+<link rel="stylesheet" crossorigin href="/assets/index-B9x_Q-3a.css">
+</head><body><div id="app"></div></body></html>`
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":                {Data: []byte(testIndex)},
+		"assets/index-DlAUqK2U.js":  {Data: []byte(strings.Repeat("console.log('qwq');\n", 500))},
+		"assets/index-B9x_Q-3a.css": {Data: []byte("body{margin:0}")},
+		"logo.png":                  {Data: []byte{0x89, 'P', 'N', 'G'}},
+	}
+}
+
+func get(site *Site, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	site.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoad_Validates(t *testing.T) {
+	if _, err := Load(testFS()); err != nil {
+		t.Fatalf("Expected a complete build, got %v", err)
+	}
+
+	fsys := testFS()
+	delete(fsys, "index.html")
+	if _, err := Load(fsys); !errors.Is(err, ErrMissingIndex) {
+		t.Errorf("Expected ErrMissingIndex, got %v", err)
+	}
+
+	fsys = testFS()
+	delete(fsys, "assets/index-DlAUqK2U.js")
+	_, err := Load(fsys)
+	if !errors.Is(err, ErrMissingAssets) || !strings.Contains(err.Error(), "assets/index-DlAUqK2U.js") {
+		t.Errorf("Expected the missing asset to be named, got %v", err)
+	}
+}
+
+func TestSite_CachingHeaders(t *testing.T) {
+	site, _ := Load(testFS())
+
+	asset := get(site, "/assets/index-DlAUqK2U.js", nil)
+	if asset.Code != http.StatusOK || asset.Header().Get("Cache-Control") != cacheImmutable {
+		t.Errorf("Expected hashed assets to be immutable, got %d %q", asset.Code, asset.Header().Get("Cache-Control"))
+	}
+	if asset.Header().Get("Content-Type") != "application/javascript; charset=utf-8" || asset.Header().Get("ETag") == "" {
+		t.Errorf("Unexpected headers %v", asset.Header())
+	}
+
+	// index.html 和页面路由每次协商，部署后立即生效
+	for _, path := range []string{"/", "/index.html", "/containers/42"} {
+		rec := get(site, path, nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-cache" || !strings.Contains(rec.Body.String(), `<div id="app">`) {
+			t.Errorf("%s: expected index.html with no-cache, got %d %q", path, rec.Code, rec.Header().Get("Cache-Control"))
+		}
+	}
+	if rec := get(site, "/logo.png", nil); rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected files without a content hash to be revalidated, got %q", rec.Header().Get("Cache-Control"))
+	}
+	if rec := get(site, "/assets/missing-AAAAAAAA.js", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing assets, got %d", rec.Code)
+	}
+	if rec := get(site, "/favicon.ico", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 without a favicon, got %d", rec.Code)
+	}
+}
+
+func TestSite_ConditionalRequests(t *testing.T) {
+	site, _ := Load(testFS())
+	first := get(site, "/assets/index-DlAUqK2U.js", nil)
+	etag := first.Header().Get("ETag")
+
+	repeat := get(site, "/assets/index-DlAUqK2U.js", http.Header{"If-None-Match": {etag}})
+	if repeat.Code != http.StatusNotModified || repeat.Body.Len() != 0 {
+		t.Errorf("Expected 304 with an empty body, got %d (%d bytes)", repeat.Code, repeat.Body.Len())
+	}
+	index := get(site, "/", nil)
+	if rec := get(site, "/", http.Header{"If-None-Match": {index.Header().Get("ETag")}}); rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged index.html, got %d", rec.Code)
+	}
+	if rec := get(site, "/assets/index-DlAUqK2U.js", http.Header{"If-None-Match": {`"stale"`}}); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a stale ETag, got %d", rec.Code)
+	}
+}
+
+func TestSite_Gzip(t *testing.T) {
+	site, _ := Load(testFS())
+	plain := get(site, "/assets/index-DlAUqK2U.js", nil)
+	rec := get(site, "/assets/index-DlAUqK2U.js", http.Header{"Accept-Encoding": {"br, gzip;q=0.8"}})
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected a gzip response, got %v", rec.Header())
+	}
+	if rec.Body.Len() >= plain.Body.Len() || rec.Header().Get("ETag") == plain.Header().Get("ETag") {
+		t.Errorf("Expected a smaller body with its own ETag, got %d bytes %s", rec.Body.Len(), rec.Header().Get("ETag"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !bytes.Equal(body, plain.Body.Bytes()) {
+		t.Error("Expected the gzip body to decompress to the original file")
+	}
+
+	// 压缩后的 ETag 同样可以协商
+	if again := get(site, "/assets/index-DlAUqK2U.js", http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {rec.Header().Get("ETag")}}); again.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for the gzip ETag, got %d", again.Code)
+	}
+	if rec := get(site, "/assets/index-DlAUqK2U.js", http.Header{"Accept-Encoding": {"gzip;q=0"}}); rec.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected gzip;q=0 to disable compression")
+	}
+	if rec := get(site, "/assets/index-B9x_Q-3a.css", http.Header{"Accept-Encoding": {"gzip"}}); rec.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected small files to be sent uncompressed")
+	}
+}
+
+// BenchmarkSite_Load 首次打开页面（无缓存）传输的字节数
+func BenchmarkSite_Load(b *testing.B) {
+	benchmarkLoad(b, false)
+}
+
+// BenchmarkSite_RepeatLoad 再次打开页面：哈希资源由浏览器直接使用缓存，index.html 返回 304
+func BenchmarkSite_RepeatLoad(b *testing.B) {
+	benchmarkLoad(b, true)
+}
+
+func benchmarkLoad(b *testing.B, repeat bool) {
+	site, err := Load(testFS())
+	if err != nil {
+		b.Fatal(err)
+	}
+	index := get(site, "/", http.Header{"Accept-Encoding": {"gzip"}})
+	var transferred int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if repeat {
+			rec := get(site, "/", http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {index.Header().Get("ETag")}})
+			transferred += rec.Body.Len()
+			continue
+		}
+		for _, path := range []string{"/", "/assets/index-DlAUqK2U.js", "/assets/index-B9x_Q-3a.css"} {
+			transferred += get(site, path, http.Header{"Accept-Encoding": {"gzip"}}).Body.Len()
+		}
+	}
+	b.ReportMetric(float64(transferred)/float64(b.N), "bytes/load")
+}
@@ -0,0 +1,28 @@
+// spacheck 检查前端构建产物是否完整，由 internal/server 的 go:generate 在编译前运行：
+//
+//	go generate ./internal/server
+//
+// dist 中没有 index.html 或缺少 index.html 引用的资源时以非零状态退出，避免编译出无法打开页面的二进制
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"qwq/internal/spa"
+)
+
+func main() {
+	dir := "dist"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	site, err := spa.Load(os.DirFS(dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "spacheck: %s: %v\n", dir, err)
+		fmt.Fprintln(os.Stderr, "spacheck: 请先运行 cd frontend && npm ci && npm run build，再把 frontend/dist 复制到 internal/server/dist")
+		os.Exit(1)
+	}
+	files, size := site.Files()
+	fmt.Printf("spacheck: %s: %d files, %d KB\n", dir, files, size>>10)
+}
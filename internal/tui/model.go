@@ -0,0 +1,522 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"qwq/internal/patrol"
+	"qwq/internal/server"
+)
+
+// view 当前显示的页面
+type view int
+
+const (
+	viewDashboard view = iota
+	viewIncidents
+	viewLogs
+)
+
+// key 解析后的按键
+type key string
+
+const (
+	keyQuit  key = "q"
+	keyCtrlC key = "ctrl+c"
+	keyEsc   key = "esc"
+	keyUp    key = "up"
+	keyDown  key = "down"
+	keyPgUp  key = "pgup"
+	keyPgDn  key = "pgdn"
+)
+
+// action 按键要求 Run 执行的操作，数据获取在后台进行，界面不阻塞
+type action int
+
+const (
+	actionNone action = iota
+	actionQuit
+	actionPatrol
+	actionRefresh
+	actionLogs
+)
+
+// style 整行的显示样式，在截断之后才加上转义序列，不影响宽度计算
+type style int
+
+const (
+	styleNormal style = iota
+	styleTitle
+	styleAlert
+	styleDim
+	styleFooter
+)
+
+// line 渲染结果中的一行
+type line struct {
+	text  string
+	style style
+}
+
+// logLines 日志页读取的行数
+const logLines = 500
+
+// Model 界面状态，只在 Run 的主循环中读写
+type Model struct {
+	source   string
+	view     view
+	snapshot *Snapshot
+	err      error // 最近一次刷新的错误，保留上一次的数据继续显示
+	logs     []string
+	logErr   error
+	status   string // 页脚的提示，如巡检已触发
+	scroll   int    // 事件页从顶部、日志页从底部滚动的行数
+}
+
+// NewModel 创建界面状态
+func NewModel(source string) *Model {
+	return &Model{source: source}
+}
+
+// SetSnapshot 更新刷新结果
+func (m *Model) SetSnapshot(s *Snapshot, err error) {
+	m.err = err
+	if err == nil {
+		m.snapshot = s
+	}
+}
+
+// SetLogs 更新日志页的内容
+func (m *Model) SetLogs(lines []string, err error) {
+	m.logs, m.logErr = lines, err
+}
+
+// SetStatus 设置页脚提示
+func (m *Model) SetStatus(status string) {
+	m.status = status
+}
+
+// HandleKey 处理一次按键
+func (m *Model) HandleKey(k key) action {
+	switch k {
+	case keyQuit, keyCtrlC:
+		return actionQuit
+	case "p":
+		m.status = "正在触发巡检..."
+		return actionPatrol
+	case "r":
+		return actionRefresh
+	case "i":
+		m.view, m.scroll = viewIncidents, 0
+	case "l":
+		m.view, m.scroll = viewLogs, 0
+		return actionLogs
+	case "d", keyEsc:
+		m.view, m.scroll = viewDashboard, 0
+	case "k", keyUp:
+		m.scrollBy(1)
+	case "j", keyDown:
+		m.scrollBy(-1)
+	case keyPgUp:
+		m.scrollBy(10)
+	case keyPgDn:
+		m.scrollBy(-10)
+	}
+	return actionNone
+}
+
+// scrollBy 正数向较早的内容滚动：事件页向下，日志页向上
+func (m *Model) scrollBy(n int) {
+	if m.view == viewIncidents {
+		n = -n
+	}
+	m.scroll += n
+	if m.scroll < 0 {
+		m.scroll = 0
+	}
+}
+
+// Render 按终端大小渲染整屏，每行都截断到终端宽度，行数不超过终端高度
+func (m *Model) Render(width, height int) []line {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	var body []line
+	switch m.view {
+	case viewIncidents:
+		body = m.renderIncidents()
+	case viewLogs:
+		body = m.renderLogs()
+	default:
+		body = m.renderDashboard(width)
+	}
+
+	lines := []line{m.header(width)}
+	if m.err != nil {
+		lines = append(lines, line{"刷新失败: " + m.err.Error(), styleAlert})
+	}
+	if height > 2 {
+		room := height - len(lines) - 1
+		body = m.window(body, room)
+		lines = append(lines, body...)
+		lines = append(lines, line{m.footer(width), styleFooter})
+	}
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	for i := range lines {
+		lines[i].text = truncate(sanitize(lines[i].text), width)
+	}
+	return lines
+}
+
+// window 截取可滚动内容中当前可见的部分
+func (m *Model) window(body []line, room int) []line {
+	if room <= 0 {
+		return nil
+	}
+	if len(body) <= room {
+		m.scroll = 0
+		return body
+	}
+	maxScroll := len(body) - room
+	if m.scroll > maxScroll {
+		m.scroll = maxScroll
+	}
+	switch m.view {
+	case viewLogs:
+		end := len(body) - m.scroll
+		return body[end-room : end]
+	case viewIncidents:
+		return body[m.scroll : m.scroll+room]
+	}
+	return body[:room]
+}
+
+func (m *Model) header(width int) line {
+	title := "qwq top"
+	if m.view == viewIncidents {
+		title += " · 事件"
+	} else if m.view == viewLogs {
+		title += " · 日志"
+	}
+	if width >= 40 {
+		title += " · " + m.source
+	}
+	if m.snapshot != nil && m.snapshot.Stats.Time != "" {
+		title += " · " + m.snapshot.Stats.Time
+	}
+	return line{title, styleTitle}
+}
+
+func (m *Model) footer(width int) string {
+	keys := "p 巡检  i 事件  l 日志  d 仪表盘  q 退出"
+	if m.view != viewDashboard {
+		keys = "j/k 滚动  d 返回  q 退出"
+	}
+	if width < 40 {
+		keys = "p i l d q"
+	}
+	if m.status != "" {
+		return m.status + " | " + keys
+	}
+	return keys
+}
+
+func (m *Model) renderDashboard(width int) []line {
+	if m.snapshot == nil {
+		return []line{{"正在采集...", styleDim}}
+	}
+	stats := m.snapshot.Stats
+	wide := width >= 60
+	var lines []line
+
+	load := strings.TrimSpace(stats.Load)
+	if load == "" {
+		load = "-"
+	}
+	lines = append(lines, line{fmt.Sprintf("负载 %s   TCP %s", load, stats.TcpConn), styleNormal})
+	memPct := parsePct(stats.MemPct)
+	lines = append(lines, line{fmt.Sprintf("内存 %s%s / %s MB", gauge(memPct, wide), stats.MemUsed, stats.MemTotal), pctStyle(memPct)})
+
+	lines = append(lines, line{"磁盘", styleTitle})
+	if len(stats.Mounts) == 0 {
+		pct := parsePct(stats.DiskPct)
+		lines = append(lines, line{fmt.Sprintf("  / %s可用 %s", gauge(pct, wide), stats.DiskAvail), pctStyle(pct)})
+	}
+	for _, mount := range stats.Mounts {
+		text := fmt.Sprintf("  %s %s可用 %s", mount.Mount, gauge(mount.Pct, wide), humanBytes(mount.Avail))
+		if wide {
+			text += fmt.Sprintf(" / %s  %s", humanBytes(mount.Total), mount.Device)
+		}
+		lines = append(lines, line{text, pctStyle(mount.Pct)})
+	}
+
+	lines = append(lines, line{"HTTP 检查", styleTitle})
+	if len(m.snapshot.Checks) == 0 {
+		lines = append(lines, line{"  未配置", styleDim})
+	}
+	for _, check := range m.snapshot.Checks {
+		switch {
+		case check.CheckedAt.IsZero():
+			lines = append(lines, line{"  ...   " + check.Name + "  尚未执行", styleDim})
+		case check.Success:
+			text, st := "  OK    "+check.Name+"  "+check.Latency, styleNormal
+			if check.Degraded {
+				text, st = "  WARN  "+check.Name+"  "+check.Error, styleAlert
+			}
+			if check.Stale {
+				lines = append(lines, line{text + "  已过期", styleDim})
+			} else {
+				lines = append(lines, line{text, st})
+			}
+		default:
+			lines = append(lines, line{"  FAIL  " + check.Name + "  " + check.Error, styleAlert})
+		}
+	}
+
+	lines = append(lines, line{"活动事件", styleTitle})
+	latest := m.latestRun()
+	switch {
+	case latest == nil:
+		lines = append(lines, line{"  暂无巡检记录", styleDim})
+	case len(latest.Findings) == 0:
+		lines = append(lines, line{"  无", styleNormal})
+	default:
+		for _, finding := range latest.Findings {
+			lines = append(lines, line{"  " + finding, styleAlert})
+		}
+	}
+
+	lines = append(lines, line{"最近巡检", styleTitle})
+	if latest != nil {
+		lines = append(lines, runLine(latest))
+		if wide {
+			lines = append(lines, line{"  " + verdictCounts(latest.Verdicts), styleDim})
+		}
+	} else {
+		lines = append(lines, line{"  -", styleDim})
+	}
+	return lines
+}
+
+func (m *Model) renderIncidents() []line {
+	if m.snapshot == nil {
+		return []line{{"正在采集...", styleDim}}
+	}
+	var lines []line
+	for i := range m.snapshot.Runs {
+		run := &m.snapshot.Runs[i]
+		if run.Anomalies == 0 && len(run.Findings) == 0 {
+			continue
+		}
+		lines = append(lines, runLine(run))
+		for _, finding := range run.Findings {
+			lines = append(lines, line{"    " + finding, styleAlert})
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, line{fmt.Sprintf("最近 %d 次巡检没有发现异常", len(m.snapshot.Runs)), styleNormal})
+	}
+	return lines
+}
+
+func (m *Model) renderLogs() []line {
+	if m.logErr != nil {
+		return []line{{"读取日志失败: " + m.logErr.Error(), styleAlert}}
+	}
+	if len(m.logs) == 0 {
+		return []line{{"暂无日志", styleDim}}
+	}
+	lines := make([]line, len(m.logs))
+	for i, text := range m.logs {
+		lines[i] = line{text, styleNormal}
+	}
+	return lines
+}
+
+// latestRun 最近一次已结束的巡检
+func (m *Model) latestRun() *server.PatrolRunSummary {
+	if m.snapshot == nil {
+		return nil
+	}
+	for i := range m.snapshot.Runs {
+		if !m.snapshot.Runs[i].FinishedAt.IsZero() {
+			return &m.snapshot.Runs[i]
+		}
+	}
+	return nil
+}
+
+func runLine(run *server.PatrolRunSummary) line {
+	verdict, st := "正常", styleNormal
+	if run.Anomalies > 0 {
+		verdict, st = fmt.Sprintf("异常 %d", run.Anomalies), styleAlert
+	}
+	if run.FinishedAt.IsZero() {
+		verdict, st = "进行中", styleDim
+	}
+	return line{fmt.Sprintf("  #%d %s %s %s", run.ID, run.StartedAt.Local().Format("01-02 15:04"), run.Trigger, verdict), st}
+}
+
+// verdictCounts 各结论的检查项数量，如 "ok 8  alert 1"
+func verdictCounts(verdicts map[string]patrol.Verdict) string {
+	counts := make(map[patrol.Verdict]int)
+	for _, v := range verdicts {
+		counts[v]++
+	}
+	var parts []string
+	for _, v := range []patrol.Verdict{patrol.VerdictOK, patrol.VerdictAlert, patrol.VerdictSkipped, patrol.VerdictTimeout} {
+		if counts[v] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", v, counts[v]))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+// gauge 百分比及进度条，窄终端只显示数字
+func gauge(pct float64, bar bool) string {
+	text := fmt.Sprintf("%5.1f%% ", pct)
+	if !bar {
+		return text
+	}
+	const size = 20
+	filled := int(pct/100*size + 0.5)
+	if filled < 0 {
+		filled = 0
+	} else if filled > size {
+		filled = size
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", size-filled) + "] " + text
+}
+
+func pctStyle(pct float64) style {
+	if pct >= 90 {
+		return styleAlert
+	}
+	return styleNormal
+}
+
+func parsePct(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	return v
+}
+
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// sanitize 去掉日志等外部文本中的控制字符和颜色转义序列，避免破坏画面
+func sanitize(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 0x1b && i+1 < len(s) && s[i+1] == '[':
+			// 跳过 CSI 序列直到结束字节
+			for i += 2; i < len(s) && (s[i] < 0x40 || s[i] > 0x7e); i++ {
+			}
+		case c == '\t':
+			b.WriteByte(' ')
+		case c < 0x20 || c == 0x7f:
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// truncate 按显示宽度截断，超出时以 ~ 结尾
+func truncate(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if used+w > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	if width > 0 {
+		b.WriteByte('~')
+	}
+	return b.String()
+}
+
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth 终端中字符占用的列数：中日韩文字和大部分 emoji 占两列
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f) || (r >= 0x300 && r <= 0x36f):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+// parseKeys 把一次读取到的输入解析为按键，未识别的转义序列忽略
+func parseKeys(b []byte) []key {
+	var keys []key
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == 3:
+			keys = append(keys, keyCtrlC)
+		case c == 0x1b:
+			if i+2 < len(b) && b[i+1] == '[' {
+				seq := b[i+2]
+				i += 2
+				switch seq {
+				case 'A':
+					keys = append(keys, keyUp)
+				case 'B':
+					keys = append(keys, keyDown)
+				case '5', '6':
+					if i+1 < len(b) && b[i+1] == '~' {
+						i++
+						if seq == '5' {
+							keys = append(keys, keyPgUp)
+						} else {
+							keys = append(keys, keyPgDn)
+						}
+					}
+				}
+				continue
+			}
+			keys = append(keys, keyEsc)
+		case c >= 0x20 && c < 0x7f:
+			keys = append(keys, key(strings.ToLower(string(c))))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,150 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+	"qwq/internal/server"
+)
+
+func testSnapshot() *Snapshot {
+	finished := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Snapshot{
+		Stats: server.StatsPoint{
+			Time: "12:00:00", Load: " 0.50, 0.40, 0.30", MemPct: "45.0", MemUsed: "1843", MemTotal: "4096", TcpConn: "12",
+			Mounts: []monitor.MountUsage{
+				{Mount: "/", Device: "/dev/sda1", Total: 100 << 30, Avail: 5 << 30, Pct: 95},
+				{Mount: "/data/应用数据", Device: "/dev/sdb1", Total: 200 << 30, Avail: 150 << 30, Pct: 25},
+			},
+		},
+		Checks: []monitor.CheckResult{
+			{Name: "api", Success: true, Latency: "12ms", CheckedAt: finished},
+			{Name: "shop", Success: false, Error: "connection refused", CheckedAt: finished},
+		},
+		Runs: []server.PatrolRunSummary{
+			{ID: 3, Trigger: "manual", StartedAt: finished, FinishedAt: finished, Anomalies: 1,
+				Verdicts: map[string]patrol.Verdict{"disk": patrol.VerdictAlert, "memory": patrol.VerdictOK},
+				Findings: []string{"disk: 磁盘告警 (/dev/sda1)"}},
+			{ID: 2, Trigger: "cron", StartedAt: finished, FinishedAt: finished},
+		},
+	}
+}
+
+func renderText(lines []line) string {
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	return strings.Join(texts, "\n")
+}
+
+func TestRender_Dashboard(t *testing.T) {
+	m := NewModel("local")
+	m.SetSnapshot(testSnapshot(), nil)
+	lines := m.Render(100, 40)
+	text := renderText(lines)
+	for _, want := range []string{"负载 0.50, 0.40, 0.30   TCP 12", "[#########...........]  45.0%", "/dev/sda1", "FAIL  shop  connection refused",
+		"disk: 磁盘告警 (/dev/sda1)", "#3 ", "ok 1  alert 1", "q 退出"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected dashboard to contain %q, got:\n%s", want, text)
+		}
+	}
+	for _, l := range lines {
+		if strings.Contains(l.text, "/dev/sda1") && strings.HasPrefix(l.text, "  / ") && l.style != styleAlert {
+			t.Errorf("Expected the 95%% mount to be highlighted, got %+v", l)
+		}
+	}
+}
+
+func TestRender_NarrowTerminal(t *testing.T) {
+	m := NewModel("http://127.0.0.1:8080")
+	m.SetSnapshot(testSnapshot(), nil)
+	for _, size := range [][2]int{{30, 10}, {20, 5}, {8, 2}, {1, 1}} {
+		lines := m.Render(size[0], size[1])
+		if len(lines) == 0 || len(lines) > size[1] {
+			t.Fatalf("%dx%d: expected 1..%d lines, got %d", size[0], size[1], size[1], len(lines))
+		}
+		for _, l := range lines {
+			if w := displayWidth(l.text); w > size[0] {
+				t.Errorf("%dx%d: line %q is %d columns wide", size[0], size[1], l.text, w)
+			}
+		}
+		if size[1] > 2 && !strings.Contains(lines[len(lines)-1].text, "p i l") {
+			t.Errorf("%dx%d: expected the compact footer on the last line, got %q", size[0], size[1], lines[len(lines)-1].text)
+		}
+	}
+	if text := renderText(m.Render(30, 40)); strings.Contains(text, "[#") || strings.Contains(text, "127.0.0.1") {
+		t.Errorf("Expected no gauges or source on narrow terminals, got:\n%s", text)
+	}
+}
+
+func TestRender_RefreshErrorKeepsData(t *testing.T) {
+	m := NewModel("local")
+	m.SetSnapshot(testSnapshot(), nil)
+	m.SetSnapshot(nil, errors.New("connection refused"))
+	text := renderText(m.Render(80, 40))
+	if !strings.Contains(text, "刷新失败: connection refused") || !strings.Contains(text, "TCP 12") {
+		t.Errorf("Expected the error and the previous data, got:\n%s", text)
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	m := NewModel("local")
+	m.SetSnapshot(testSnapshot(), nil)
+	if m.HandleKey("p") != actionPatrol || m.HandleKey(keyCtrlC) != actionQuit || m.HandleKey(keyQuit) != actionQuit {
+		t.Fatal("Expected p to trigger a patrol and q / ctrl-c to quit")
+	}
+
+	m.HandleKey("i")
+	text := renderText(m.Render(80, 20))
+	if !strings.Contains(text, "#3 ") || strings.Contains(text, "#2 ") {
+		t.Errorf("Expected the incident list to show only runs with anomalies, got:\n%s", text)
+	}
+
+	if m.HandleKey("l") != actionLogs {
+		t.Fatal("Expected l to fetch logs")
+	}
+	logs := make([]string, 50)
+	for i := range logs {
+		logs[i] = "line " + string(rune('A'+i%26)) + "\x1b[31m"
+	}
+	m.SetLogs(logs, nil)
+	lines := m.Render(80, 10)
+	if last := lines[len(lines)-2].text; last != "line X" {
+		t.Errorf("Expected the log view to follow the tail with control characters removed, got %q", last)
+	}
+	m.HandleKey(keyUp)
+	if lines = m.Render(80, 10); lines[len(lines)-2].text != "line W" {
+		t.Errorf("Expected up to scroll back one line, got %q", lines[len(lines)-2].text)
+	}
+	m.HandleKey("d")
+	if m.view != viewDashboard || m.scroll != 0 {
+		t.Errorf("Expected d to return to the dashboard, got view %d scroll %d", m.view, m.scroll)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("Pq\x03\x1b[A\x1b[B\x1b[5~\x1b"))
+	want := []key{"p", keyQuit, keyCtrlC, keyUp, keyDown, keyPgUp, keyEsc}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("key %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("磁盘告警abc", 7); got != "磁盘告~" || displayWidth(got) > 7 {
+		t.Errorf("Expected wide characters to count as two columns, got %q", got)
+	}
+	if got := truncate("abc", 3); got != "abc" {
+		t.Errorf("Expected short text to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"qwq/internal/monitor"
+	"qwq/internal/patrol"
+	"qwq/internal/server"
+)
+
+// recentRuns 界面读取的巡检记录条数，事件列表只显示其中有异常的记录
+const recentRuns = 20
+
+// logTailBytes 本地模式读取日志文件末尾的字节数
+const logTailBytes = 64 * 1024
+
+// ErrPatrolRunning 上一次从界面触发的巡检尚未结束
+var ErrPatrolRunning = errors.New("patrol already running")
+
+// Snapshot 一次刷新得到的数据
+type Snapshot struct {
+	Stats  server.StatsPoint
+	Checks []monitor.CheckResult     // HTTP 检查的最近结果
+	Runs   []server.PatrolRunSummary // 最近的巡检记录，最新的在前
+}
+
+// Source 界面的数据来源：Web 服务运行时读取其 API，否则在本进程中采集
+type Source interface {
+	// Name 标题栏显示的数据来源
+	Name() string
+	Snapshot(ctx context.Context) (*Snapshot, error)
+	// TriggerPatrol 在后台开始一次巡检，不等待结束
+	TriggerPatrol(ctx context.Context) error
+	// Logs 最近 n 行日志，最早的在前
+	Logs(ctx context.Context, n int) ([]string, error)
+}
+
+// LocalSource 在本进程中使用与 Web 服务相同的采集逻辑
+type LocalSource struct {
+	Collect  func() server.StatsPoint // 通常为 server.CollectStats
+	Patrol   func()                   // 执行一次巡检
+	LogPath  string                   // 日志文件，为空或无法读取时使用 Buffer
+	Buffer   func() []string          // 内存中的日志缓冲，通常为 logger.GetWebLogs
+	RunsFile string                   // 巡检记录文件，其他进程（如定时巡检）写入后重新加载
+
+	running atomic.Bool
+	runsMod time.Time
+}
+
+// Name 数据来源
+func (s *LocalSource) Name() string { return "local" }
+
+// Snapshot 采集一次监控数据
+func (s *LocalSource) Snapshot(ctx context.Context) (*Snapshot, error) {
+	s.reloadRuns()
+	stats := s.Collect()
+	checks, _ := stats.Services.([]monitor.CheckResult)
+	return &Snapshot{Stats: stats, Checks: checks, Runs: server.PatrolRunSummaries(recentRuns)}, nil
+}
+
+// reloadRuns 巡检记录文件更新后重新加载，本进程正在巡检时跳过以免覆盖尚未写入的记录
+func (s *LocalSource) reloadRuns() {
+	if s.RunsFile == "" || s.running.Load() {
+		return
+	}
+	info, err := os.Stat(s.RunsFile)
+	if err != nil || !info.ModTime().After(s.runsMod) {
+		return
+	}
+	if err := patrol.DefaultStore.Load(s.RunsFile); err == nil {
+		s.runsMod = info.ModTime()
+	}
+}
+
+// TriggerPatrol 在后台执行巡检，同时只执行一次
+func (s *LocalSource) TriggerPatrol(ctx context.Context) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return ErrPatrolRunning
+	}
+	go func() {
+		defer s.running.Store(false)
+		s.Patrol()
+	}()
+	return nil
+}
+
+// Logs 读取日志文件的最后 n 行
+func (s *LocalSource) Logs(ctx context.Context, n int) ([]string, error) {
+	lines, err := s.tailFile()
+	if err != nil && s.Buffer != nil {
+		return lastLines(s.Buffer(), n), nil
+	}
+	return lastLines(lines, n), err
+}
+
+func (s *LocalSource) tailFile() ([]string, error) {
+	if s.LogPath == "" {
+		return nil, errors.New("no log file")
+	}
+	f, err := os.Open(s.LogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - logTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if offset > 0 && len(lines) > 1 {
+		lines = lines[1:] // 第一行可能不完整
+	}
+	return lines, nil
+}
+
+// APISource 读取正在运行的 Web 服务的 API，不再启动第二个采集器
+type APISource struct {
+	BaseURL  string // 如 http://127.0.0.1:8080
+	User     string // 基础认证，Token 非空时忽略
+	Password string
+	Token    string // API 令牌
+	Client   *http.Client
+}
+
+// Name 数据来源
+func (s *APISource) Name() string { return s.BaseURL }
+
+// Probe 检查 Web 服务是否在运行且认证有效
+func (s *APISource) Probe(ctx context.Context) error {
+	var points []server.StatsPoint
+	return s.get(ctx, "/api/stats", &points)
+}
+
+// Snapshot 读取最新的监控数据点和巡检记录
+func (s *APISource) Snapshot(ctx context.Context) (*Snapshot, error) {
+	var points []server.StatsPoint
+	if err := s.get(ctx, "/api/stats", &points); err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if len(points) > 0 {
+		snapshot.Stats = points[len(points)-1]
+		// services 解码后是通用 map，转换回检查结果
+		if raw, err := json.Marshal(snapshot.Stats.Services); err == nil {
+			json.Unmarshal(raw, &snapshot.Checks)
+		}
+	}
+	if err := s.get(ctx, fmt.Sprintf("/api/patrol/runs?limit=%d", recentRuns), &snapshot.Runs); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// TriggerPatrol 通过 /api/trigger 触发巡检
+func (s *APISource) TriggerPatrol(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodPost, "/api/trigger")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Logs Web 服务内存中的最近日志
+func (s *APISource) Logs(ctx context.Context, n int) ([]string, error) {
+	var lines []string
+	if err := s.get(ctx, "/api/logs", &lines); err != nil {
+		return nil, err
+	}
+	return lastLines(lines, n), nil
+}
+
+func (s *APISource) get(ctx context.Context, path string, out interface{}) error {
+	resp, err := s.do(ctx, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *APISource) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(s.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	} else if s.User != "" {
+		req.SetBasicAuth(s.User, s.Password)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return resp, nil
+}
+
+func lastLines(lines []string, n int) []string {
+	if n > 0 && len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,116 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qwq/internal/monitor"
+	"qwq/internal/server"
+)
+
+func TestAPISource(t *testing.T) {
+	var triggers int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+		checks := []monitor.CheckResult{{Name: "api", Success: true, Latency: "3ms", CheckedAt: time.Now()}}
+		json.NewEncoder(w).Encode([]server.StatsPoint{{Time: "11:59:58"}, {Time: "12:00:00", Services: checks}})
+	})
+	mux.HandleFunc("/api/patrol/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "20" {
+			t.Errorf("Expected limit=20, got %q", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode([]server.PatrolRunSummary{{ID: 7, Findings: []string{"disk: 磁盘告警"}}})
+	})
+	mux.HandleFunc("/api/trigger", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		atomic.AddInt32(&triggers, 1)
+	})
+	mux.HandleFunc("/api/logs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"a", "b", "c"})
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	if err := (&APISource{BaseURL: ts.URL}).Probe(ctx); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the probe to fail without credentials, got %v", err)
+	}
+	source := &APISource{BaseURL: ts.URL + "/", User: "admin", Password: "secret"}
+	if err := source.Probe(ctx); err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	snapshot, err := source.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if snapshot.Stats.Time != "12:00:00" || len(snapshot.Checks) != 1 || snapshot.Checks[0].Name != "api" || snapshot.Checks[0].CheckedAt.IsZero() {
+		t.Errorf("Expected the latest point with decoded checks, got %+v", snapshot)
+	}
+	if len(snapshot.Runs) != 1 || snapshot.Runs[0].ID != 7 {
+		t.Errorf("Expected patrol runs, got %+v", snapshot.Runs)
+	}
+	if err := source.TriggerPatrol(ctx); err != nil || atomic.LoadInt32(&triggers) != 1 {
+		t.Errorf("Expected one trigger, got %v (%d)", err, triggers)
+	}
+	if lines, err := source.Logs(ctx, 2); err != nil || strings.Join(lines, ",") != "b,c" {
+		t.Errorf("Expected the last two log lines, got %v %v", lines, err)
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "qwq.log")
+	if err := os.WriteFile(logPath, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	var patrols int32
+	source := &LocalSource{
+		Collect: func() server.StatsPoint {
+			return server.StatsPoint{TcpConn: "3", Services: []monitor.CheckResult{{Name: "api"}}}
+		},
+		Patrol: func() {
+			atomic.AddInt32(&patrols, 1)
+			<-release
+		},
+		LogPath: logPath,
+		Buffer:  func() []string { return []string{"buffered"} },
+	}
+	ctx := context.Background()
+
+	snapshot, err := source.Snapshot(ctx)
+	if err != nil || snapshot.Stats.TcpConn != "3" || len(snapshot.Checks) != 1 {
+		t.Fatalf("Expected collected stats and checks, got %+v %v", snapshot, err)
+	}
+	if err := source.TriggerPatrol(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.TriggerPatrol(ctx); err != ErrPatrolRunning {
+		t.Errorf("Expected ErrPatrolRunning while a patrol is running, got %v", err)
+	}
+	close(release)
+
+	if lines, err := source.Logs(ctx, 2); err != nil || strings.Join(lines, ",") != "two,three" {
+		t.Errorf("Expected the log file tail, got %v %v", lines, err)
+	}
+	source.LogPath = filepath.Join(t.TempDir(), "missing.log")
+	if lines, _ := source.Logs(ctx, 2); strings.Join(lines, ",") != "buffered" {
+		t.Errorf("Expected the buffer when the log file is missing, got %v", lines)
+	}
+}
@@ -0,0 +1,221 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// 刷新间隔与终端大小检查间隔
+const (
+	refreshInterval = 2 * time.Second
+	resizeInterval  = 250 * time.Millisecond
+	requestTimeout  = 10 * time.Second
+)
+
+// 终端控制序列
+const (
+	enterAltScreen = "\x1b[?1049h"
+	leaveAltScreen = "\x1b[?1049l"
+	hideCursor     = "\x1b[?25l"
+	showCursor     = "\x1b[?25h"
+	resetStyle     = "\x1b[0m"
+)
+
+// ErrNotTerminal 标准输入或输出不是终端
+var ErrNotTerminal = errors.New("qwq top requires an interactive terminal")
+
+var styleCodes = map[style]string{
+	styleTitle:  "\x1b[1m",
+	styleAlert:  "\x1b[31m",
+	styleDim:    "\x1b[2m",
+	styleFooter: "\x1b[7m",
+}
+
+type snapshotResult struct {
+	snapshot *Snapshot
+	err      error
+}
+
+type logsResult struct {
+	lines []string
+	err   error
+}
+
+// Run 运行全屏界面，直到按下 q / Ctrl-C、ctx 取消或收到终止信号
+// 数据在后台获取，退出不等待进行中的请求；无论以何种方式退出都恢复终端状态
+func Run(ctx context.Context, source Source, in, out *os.File) error {
+	fd := int(in.Fd())
+	if !readline.IsTerminal(fd) || !readline.IsTerminal(int(out.Fd())) {
+		return ErrNotTerminal
+	}
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to enter raw mode: %w", err)
+	}
+	defer func() {
+		io.WriteString(out, resetStyle+showCursor+leaveAltScreen)
+		readline.Restore(fd, state)
+	}()
+	io.WriteString(out, enterAltScreen+hideCursor)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
+	defer signal.Stop(signals)
+
+	keys := make(chan []key, 8)
+	go readKeys(in, keys)
+
+	model := NewModel(source.Name())
+	snapshots := make(chan snapshotResult, 1)
+	logs := make(chan logsResult, 1)
+	patrols := make(chan error, 1)
+	fetching := false
+	refresh := func() {
+		if fetching {
+			return
+		}
+		fetching = true
+		go func() {
+			reqCtx, done := context.WithTimeout(ctx, requestTimeout)
+			defer done()
+			s, err := source.Snapshot(reqCtx)
+			snapshots <- snapshotResult{s, err}
+		}()
+	}
+	fetchLogs := func() {
+		go func() {
+			reqCtx, done := context.WithTimeout(ctx, requestTimeout)
+			defer done()
+			lines, err := source.Logs(reqCtx, logLines)
+			select {
+			case logs <- logsResult{lines, err}:
+			default:
+			}
+		}()
+	}
+
+	width, height := terminalSize(int(out.Fd()))
+	draw := func() {
+		io.WriteString(out, frame(model.Render(width, height)))
+	}
+	refresh()
+	draw()
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	resize := time.NewTicker(resizeInterval)
+	defer resize.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signals:
+			return nil
+		case batch, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range batch {
+				switch model.HandleKey(k) {
+				case actionQuit:
+					return nil
+				case actionPatrol:
+					go func() {
+						reqCtx, done := context.WithTimeout(ctx, requestTimeout)
+						defer done()
+						select {
+						case patrols <- source.TriggerPatrol(reqCtx):
+						default:
+						}
+					}()
+				case actionRefresh:
+					refresh()
+				case actionLogs:
+					fetchLogs()
+				}
+			}
+			draw()
+		case res := <-snapshots:
+			fetching = false
+			model.SetSnapshot(res.snapshot, res.err)
+			draw()
+		case res := <-logs:
+			model.SetLogs(res.lines, res.err)
+			draw()
+		case err := <-patrols:
+			switch {
+			case errors.Is(err, ErrPatrolRunning):
+				model.SetStatus("巡检进行中")
+			case err != nil:
+				model.SetStatus("触发巡检失败: " + err.Error())
+			default:
+				model.SetStatus("巡检已触发")
+			}
+			draw()
+		case <-ticker.C:
+			refresh()
+			if model.view == viewLogs {
+				fetchLogs()
+			}
+		case <-resize.C:
+			if w, h := terminalSize(int(out.Fd())); w != width || h != height {
+				width, height = w, h
+				draw()
+			}
+		}
+	}
+}
+
+// readKeys 持续读取输入，读取失败（如终端关闭）时关闭通道
+func readKeys(in io.Reader, keys chan<- []key) {
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			keys <- parseKeys(buf[:n])
+		}
+		if err != nil {
+			close(keys)
+			return
+		}
+	}
+}
+
+// terminalSize 终端大小，无法获取时按 80x24 处理
+func terminalSize(fd int) (int, int) {
+	w, h, err := readline.GetSize(fd)
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// frame 拼接整屏输出：回到左上角逐行覆盖并清除行尾，最后清除剩余部分，避免闪烁
+func frame(lines []line) string {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		if code := styleCodes[l.style]; code != "" {
+			b.WriteString(code + l.text + resetStyle)
+		} else {
+			b.WriteString(l.text)
+		}
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"qwq/internal/config"
+	"qwq/internal/logger"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// confirmInput 确认提示读取的标准输入，测试时替换
+var confirmInput = os.Stdin
+
+// StdinIsTerminal 标准输入是否为终端
+func StdinIsTerminal() bool {
+	return readline.IsTerminal(int(confirmInput.Fd()))
+}
+
+// Confirm 显示 prompt 并读取一行回答，accept 判断去掉首尾空白后的回答是否确认
+// 标准输入不是终端（重定向自文件、/dev/null 或管道）时不读取，直接按 terminal.assume_yes（--yes）决定，默认拒绝
+func Confirm(prompt string, accept func(answer string) bool) bool {
+	fmt.Print(prompt)
+	if !StdinIsTerminal() {
+		if config.Current().Terminal.AssumeYes {
+			fmt.Println("yes (--yes)")
+			logger.Info("[AUDIT] ⌨️ 标准输入不是终端，按 --yes 自动确认: %s", strings.TrimSpace(prompt))
+			return true
+		}
+		fmt.Println("no (标准输入不是终端，使用 --yes 自动确认)")
+		logger.Info("[AUDIT] ⌨️ 标准输入不是终端，默认拒绝: %s", strings.TrimSpace(prompt))
+		return false
+	}
+	input, err := bufio.NewReader(confirmInput).ReadString('\n')
+	if err != nil && input == "" {
+		logger.Info("[AUDIT] ⌨️ 读取确认输入失败，按拒绝处理: %v", err)
+		return false
+	}
+	return accept(strings.TrimSpace(input))
+}
+
+// ConfirmYes 回答 y 或 yes（不区分大小写）时确认
+func ConfirmYes(answer string) bool {
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
+
+// LineReader 命令行对话的输入，读完或终端关闭时返回 io.EOF
+type LineReader interface {
+	ReadLine() (string, error)
+	Close() error
+}
+
+// NewLineReader 标准输入是终端时使用带历史记录的 readline，否则逐行读取标准输入，
+// 使 echo "问题" | qwq chat 回答完输入后退出
+func NewLineReader(prompt, historyFile string) (LineReader, error) {
+	if !StdinIsTerminal() {
+		logger.Info("⌨️ 标准输入不是终端，逐行读取输入")
+		return &pipeReader{scanner: bufio.NewScanner(confirmInput)}, nil
+	}
+	rl, err := readline.NewEx(&readline.Config{Prompt: prompt, HistoryFile: historyFile})
+	if err != nil {
+		return nil, err
+	}
+	return &terminalReader{rl: rl}, nil
+}
+
+type terminalReader struct {
+	rl *readline.Instance
+}
+
+// ReadLine Ctrl-C 清空当前行继续读取，Ctrl-D 返回 io.EOF
+func (r *terminalReader) ReadLine() (string, error) {
+	for {
+		line, err := r.rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		return line, err
+	}
+}
+
+func (r *terminalReader) Close() error {
+	return r.rl.Close()
+}
+
+type pipeReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *pipeReader) ReadLine() (string, error) {
+	if r.scanner.Scan() {
+		return strings.TrimRight(r.scanner.Text(), "\r"), nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+func (r *pipeReader) Close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfirmHelperProcess 不是真正的测试：runHelper 以子进程运行测试程序并执行这里的确认或逐行读取
+func TestConfirmHelperProcess(t *testing.T) {
+	mode := os.Getenv("QWQ_CONFIRM_HELPER")
+	if mode == "" {
+		return
+	}
+	config.Update(func(cfg *config.Config) { cfg.Terminal.AssumeYes = os.Getenv("QWQ_ASSUME_YES") == "1" })
+	switch mode {
+	case "confirm":
+		fmt.Printf("\nresult=%v\n", ConfirmExecution(os.Getenv("QWQ_CONFIRM_CMD")))
+	case "lines":
+		reader, err := NewLineReader("> ", "")
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		for {
+			line, err := reader.ReadLine()
+			if err != nil {
+				fmt.Printf("eof=%v\n", errors.Is(err, io.EOF))
+				break
+			}
+			fmt.Printf("line=%s\n", line)
+		}
+	}
+	os.Exit(0)
+}
+
+// runHelper 以给定的标准输入运行子进程，超时说明确认提示阻塞在读取上
+func runHelper(t *testing.T, stdin io.Reader, env ...string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestConfirmHelperProcess$")
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatalf("Helper blocked on stdin:\n%s", output)
+	}
+	if err != nil {
+		t.Fatalf("Helper failed: %v\n%s", err, output)
+	}
+	return string(output)
+}
+
+// closedStdin 写端已关闭的管道，读取立即返回 EOF
+func closedStdin(t *testing.T) *os.File {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestConfirmExecution_NonTTYDeniesByDefault(t *testing.T) {
+	for name, stdin := range map[string]io.Reader{
+		"dev null": nil,
+		"closed":   closedStdin(t),
+		"piped":    strings.NewReader("y\nyes\n"), // 管道中的内容不会被当作确认
+	} {
+		for _, cmd := range []string{"systemctl restart nginx", "rm /tmp/qwq-confirm-test", "rm -rf /"} {
+			output := runHelper(t, stdin, "QWQ_CONFIRM_HELPER=confirm", "QWQ_CONFIRM_CMD="+cmd)
+			if !strings.Contains(output, "result=false") {
+				t.Errorf("%s: expected %q to be denied, got:\n%s", name, cmd, output)
+			}
+		}
+	}
+
+	// 低风险命令不需要确认
+	if output := runHelper(t, nil, "QWQ_CONFIRM_HELPER=confirm", "QWQ_CONFIRM_CMD=uptime"); !strings.Contains(output, "result=true") {
+		t.Errorf("Expected low risk commands to run without confirmation, got:\n%s", output)
+	}
+}
+
+func TestConfirmExecution_NonTTYAssumeYes(t *testing.T) {
+	for cmd, want := range map[string]string{
+		"systemctl restart nginx":  "result=true",
+		"rm /tmp/qwq-confirm-test": "result=true",
+		"rm -rf /":                 "result=false", // 极高风险命令必须在终端输入验证码
+	} {
+		output := runHelper(t, closedStdin(t), "QWQ_CONFIRM_HELPER=confirm", "QWQ_CONFIRM_CMD="+cmd, "QWQ_ASSUME_YES=1")
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s for %q with --yes, got:\n%s", want, cmd, output)
+		}
+	}
+}
+
+func TestNewLineReader_PipedStdin(t *testing.T) {
+	output := runHelper(t, strings.NewReader("磁盘为什么满了\r\nexit\n"), "QWQ_CONFIRM_HELPER=lines")
+	if want := "line=磁盘为什么满了\nline=exit\neof=true\n"; !strings.HasSuffix(output, want) {
+		t.Errorf("Expected each line then EOF, got %q", output)
+	}
+	if output := runHelper(t, closedStdin(t), "QWQ_CONFIRM_HELPER=lines"); !strings.HasSuffix(output, "\neof=true\n") {
+		t.Errorf("Expected EOF from a closed stdin, got %q", output)
+	}
+}
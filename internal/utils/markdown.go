@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/chzyer/readline"
+)
+
+const (
+	// defaultWrapWidth 无法获取终端宽度时的换行宽度
+	defaultWrapWidth = 100
+	minWrapWidth     = 20
+)
+
+// RenderOptions 终端 Markdown 渲染选项
+type RenderOptions struct {
+	NoColor bool   // 强制纯文本输出，等同于设置 NO_COLOR
+	Width   int    // 换行宽度，0 表示跟随终端宽度
+	Style   string // glamour 样式：auto、dark、light 等，默认 auto
+}
+
+// MarkdownRenderer 终端 Markdown 渲染器，在会话内复用。输出到终端时使用 glamour 渲染；
+// 输出被重定向、设置了 NO_COLOR 或 --no-color 时输出去掉 Markdown 标记的纯文本，不带 ANSI 转义序列
+type MarkdownRenderer struct {
+	term  *glamour.TermRenderer
+	width int
+}
+
+// NewMarkdownRenderer 根据输出目标创建渲染器：out 不是终端时使用纯文本，换行宽度默认取终端宽度
+func NewMarkdownRenderer(out *os.File, opts RenderOptions) *MarkdownRenderer {
+	r := &MarkdownRenderer{}
+	if opts.NoColor || os.Getenv("NO_COLOR") != "" || out == nil || !readline.IsTerminal(int(out.Fd())) {
+		return r
+	}
+
+	r.width = opts.Width
+	if r.width <= 0 {
+		r.width = defaultWrapWidth
+		if cols, _, err := readline.GetSize(int(out.Fd())); err == nil && cols > 0 {
+			r.width = cols
+		}
+	}
+	r.width = max(r.width, minWrapWidth)
+
+	style := opts.Style
+	if style == "" || style == "auto" {
+		// glamour 的 auto 样式探测的是 stdout 的背景色，输出到其他终端时使用深色样式
+		style = "dark"
+		if out == os.Stdout {
+			style = "auto"
+		}
+	}
+	term, err := glamour.NewTermRenderer(glamour.WithStandardStyle(style), glamour.WithWordWrap(r.width))
+	if err != nil {
+		return r
+	}
+	r.term = term
+	return r
+}
+
+// Plain 是否输出纯文本
+func (r *MarkdownRenderer) Plain() bool {
+	return r.term == nil
+}
+
+// Width 终端换行宽度，纯文本输出时为 0（不换行）
+func (r *MarkdownRenderer) Width() int {
+	return r.width
+}
+
+// Render 渲染 Markdown，返回的文本以换行结尾
+func (r *MarkdownRenderer) Render(markdown string) string {
+	if r.term != nil {
+		if out, err := r.term.Render(markdown); err == nil {
+			return out
+		}
+	}
+	return strings.TrimRight(StripMarkdown(markdown), "\n") + "\n"
+}
+
+// Colorize 用 ANSI 颜色码（如 "31"）包裹文本，纯文本输出时原样返回
+func (r *MarkdownRenderer) Colorize(code, text string) string {
+	if r.Plain() {
+		return text
+	}
+	return "\033[" + code + "m" + text + "\033[0m"
+}
+
+var (
+	mdHeading    = regexp.MustCompile(`^\s{0,3}#{1,6}\s+`)
+	mdQuote      = regexp.MustCompile(`^\s{0,3}>\s?`)
+	mdBullet     = regexp.MustCompile(`^(\s*)[*+]\s+`)
+	mdRule       = regexp.MustCompile(`^\s{0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdBold       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdStrike     = regexp.MustCompile(`~~([^~]+)~~`)
+	mdInlineCode = regexp.MustCompile("`+([^`]+)`+")
+)
+
+// StripMarkdown 把 Markdown 转为便于阅读的纯文本：去掉标题、强调、引用和代码块标记，
+// 链接保留文字和地址，代码块内容原样保留
+func StripMarkdown(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+		if mdRule.MatchString(line) {
+			out = append(out, "")
+			continue
+		}
+		line = mdHeading.ReplaceAllString(line, "")
+		line = mdQuote.ReplaceAllString(line, "")
+		line = mdBullet.ReplaceAllString(line, "$1- ")
+		out = append(out, stripInline(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+// stripInline 去掉行内标记，行内代码中的内容不做处理
+func stripInline(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range mdInlineCode.FindAllStringSubmatchIndex(line, -1) {
+		b.WriteString(stripEmphasis(line[last:loc[0]]))
+		b.WriteString(line[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	b.WriteString(stripEmphasis(line[last:]))
+	return b.String()
+}
+
+func stripEmphasis(s string) string {
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1 ($2)")
+	s = mdBold.ReplaceAllString(s, "$1$2")
+	s = mdItalic.ReplaceAllString(s, "$1")
+	return mdStrike.ReplaceAllString(s, "$1")
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// openPTY 打开一对伪终端，返回从端，cols 为终端宽度
+func openPTY(t *testing.T, cols uint16) *os.File {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pty unavailable: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var unlock int32
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Skipf("unlock pty: %v", err)
+	}
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Skipf("get pty number: %v", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("open pty slave: %v", err)
+	}
+	t.Cleanup(func() { slave.Close() })
+
+	ws := struct{ Row, Col, X, Y uint16 }{Row: 24, Col: cols}
+	if err := ioctl(slave.Fd(), syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		t.Fatalf("set pty size: %v", err)
+	}
+	return slave
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func TestMarkdownRenderer_TTY(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	tty := openPTY(t, 60)
+
+	renderer := NewMarkdownRenderer(tty, RenderOptions{})
+	if renderer.Plain() || renderer.Width() != 60 {
+		t.Fatalf("Expected styled output at the terminal width, got plain=%v width=%d", renderer.Plain(), renderer.Width())
+	}
+	out := renderer.Render(sampleMarkdown + "\n" + strings.Repeat("巡检结果正常 ", 30))
+	if !strings.Contains(out, "\033[") {
+		t.Errorf("Expected ANSI escape sequences on a TTY, got %q", out)
+	}
+	for _, line := range strings.Split(stripANSI(out), "\n") {
+		// 中文字符占两列
+		if width := utf8.RuneCountInString(line) + (len(line)-utf8.RuneCountInString(line))/2; width > 60+2 {
+			t.Errorf("Expected lines wrapped to the terminal width, got %d columns: %q", width, line)
+		}
+	}
+
+	// 配置的宽度优先于终端宽度
+	if r := NewMarkdownRenderer(tty, RenderOptions{Width: 40}); r.Width() != 40 {
+		t.Errorf("Expected configured wrap width, got %d", r.Width())
+	}
+}
+
+func TestMarkdownRenderer_NoColor(t *testing.T) {
+	tty := openPTY(t, 80)
+
+	if r := NewMarkdownRenderer(tty, RenderOptions{NoColor: true}); !r.Plain() || strings.Contains(r.Render(sampleMarkdown), "\033[") {
+		t.Error("Expected --no-color to disable styling on a TTY")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if r := NewMarkdownRenderer(tty, RenderOptions{}); !r.Plain() || strings.Contains(r.Render(sampleMarkdown), "\033[") {
+		t.Error("Expected NO_COLOR to disable styling on a TTY")
+	}
+}
+
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\033' {
+			for i < len(s) && !(s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
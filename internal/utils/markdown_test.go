@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const sampleMarkdown = "# 磁盘检查\n\n**/var** 使用率 *92%*，详见 [文档](https://example.com/disk)。\n\n* 清理 `journalctl --vacuum-size=500M`\n\n```bash\ndu -sh /var/* | sort -h\n```\n"
+
+func TestStripMarkdown(t *testing.T) {
+	got := StripMarkdown(sampleMarkdown)
+	for _, want := range []string{"磁盘检查\n", "/var 使用率 92%，详见 文档 (https://example.com/disk)。", "- 清理 journalctl --vacuum-size=500M", "du -sh /var/* | sort -h"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in plain text, got:\n%s", want, got)
+		}
+	}
+	for _, bad := range []string{"#", "**", "`", "](", "```"} {
+		if strings.Contains(got, bad) {
+			t.Errorf("Expected %q to be stripped, got:\n%s", bad, got)
+		}
+	}
+}
+
+func TestMarkdownRenderer_PipeIsPlain(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	renderer := NewMarkdownRenderer(w, RenderOptions{})
+	out := renderer.Render(sampleMarkdown)
+	if !renderer.Plain() || strings.Contains(out, "\033[") || strings.Contains(out, "**") {
+		t.Errorf("Expected plain output for a pipe, got %q", out)
+	}
+	if c := renderer.Colorize("31", "error"); c != "error" {
+		t.Errorf("Expected Colorize to be a no-op, got %q", c)
+	}
+}
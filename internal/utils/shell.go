@@ -1,48 +1,256 @@
 package utils
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"qwq/internal/config"
+	"qwq/internal/logger"
 	"qwq/internal/security"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 )
 
+// CommandTimeout 单条命令的默认超时，可通过 command_timeout 配置
 const CommandTimeout = 60 * time.Second
 
+// ConfiguredTimeout 当前配置的命令超时，远程执行器与本机命令使用同一配置
+func ConfiguredTimeout() time.Duration {
+	return commandTimeout()
+}
+
+// commandTimeout 当前配置的命令超时
+func commandTimeout() time.Duration {
+	if seconds := config.Current().CommandTimeout; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return CommandTimeout
+}
+
+// maxShellOutput stdout、stderr 各自保留的最大长度，兼容接口合并后的结果同样按此截断
+const maxShellOutput = 4000
+
+// ShellResult 命令执行的结构化结果，stdout 和 stderr 分开采集
+type ShellResult struct {
+	Command   string        `json:"command"`
+	Stdout    string        `json:"stdout"`
+	Stderr    string        `json:"stderr"`
+	ExitCode  int           `json:"exit_code"` // 进程未启动或被信号终止时为 -1
+	Duration  time.Duration `json:"duration"`
+	Timeout   time.Duration `json:"timeout"` // 生效的超时时间，不限制时为 0
+	TimedOut  bool          `json:"timed_out"`
+	Cancelled bool          `json:"cancelled"`
+	Truncated bool          `json:"truncated"` // stdout 或 stderr 超过 maxShellOutput，多余的输出已丢弃
+	Err       string        `json:"error,omitempty"` // 非零退出或启动失败的原因，如 "exit status 1"
+}
+
+// timeoutSeconds 超时提示中的秒数
+func (r *ShellResult) timeoutSeconds() int {
+	if r.Timeout > 0 {
+		return int(r.Timeout.Seconds())
+	}
+	return int(CommandTimeout.Seconds())
+}
+
+// OK 命令正常结束且退出码为 0
+func (r *ShellResult) OK() bool {
+	return r.ExitCode == 0 && !r.TimedOut && !r.Cancelled && r.Err == ""
+}
+
+// Combined 按旧格式合并 stdout、stderr 和失败说明，供尚未迁移到结构化结果的调用方使用
+func (r *ShellResult) Combined() string {
+	res := r.Stdout
+	if r.Stderr != "" {
+		if res != "" && !strings.HasSuffix(res, "\n") {
+			res += "\n"
+		}
+		res += r.Stderr
+	}
+
+	if r.Cancelled {
+		res += "\n(Command cancelled)"
+	} else if r.TimedOut {
+		res += fmt.Sprintf("\n(Command timed out after %ds)", r.timeoutSeconds())
+	} else if r.Err != "" {
+		if len(res) > 0 {
+			res += fmt.Sprintf("\n(Command failed: %s)", r.Err)
+		} else {
+			res = fmt.Sprintf("(Command failed: %s)", r.Err)
+		}
+	}
+	return truncateOutput(res)
+}
+
+// Format 以带标签的分段呈现结果，供 AI 工具输出使用，避免把 stderr 中的警告当成命令结果
+func (r *ShellResult) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[exit_code] %d", r.ExitCode)
+	switch {
+	case r.Cancelled:
+		b.WriteString(" (cancelled)")
+	case r.TimedOut:
+		fmt.Fprintf(&b, " (timed out after %ds)", r.timeoutSeconds())
+	case r.ExitCode == -1 && r.Err != "":
+		fmt.Fprintf(&b, " (%s)", r.Err)
+	}
+	fmt.Fprintf(&b, "\n[duration] %s\n", r.Duration.Round(time.Millisecond))
+	for _, section := range []struct{ name, content string }{{"stdout", r.Stdout}, {"stderr", r.Stderr}} {
+		if strings.TrimSpace(section.content) == "" {
+			fmt.Fprintf(&b, "[%s] (empty)\n", section.name)
+			continue
+		}
+		fmt.Fprintf(&b, "[%s]\n%s", section.name, section.content)
+		if !strings.HasSuffix(section.content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ExecuteShell 执行命令并返回合并后的输出（兼容接口，新代码使用 RunShell）
 func ExecuteShell(c string) string {
+	return RunShell(c).Combined()
+}
+
+// ExecuteShellContext 执行命令并返回合并后的输出（兼容接口，新代码使用 RunShellContext）
+func ExecuteShellContext(parent context.Context, c string) string {
+	return RunShellContext(parent, c).Combined()
+}
+
+// RunShell 执行命令并返回结构化结果
+func RunShell(c string) *ShellResult {
+	return RunShellContext(context.Background(), c)
+}
+
+// RunShellContext 执行命令，分别采集 stdout 和 stderr，超时时间为 command_timeout（默认 60 秒）
+// ctx 取消时终止整个进程组（包括 bash 启动的子进程），取消前已产生的输出会保留在结果中
+func RunShellContext(parent context.Context, c string) *ShellResult {
+	return RunShellWith(parent, c, ShellOptions{})
+}
+
+// ShellOptions 执行命令的可选参数
+type ShellOptions struct {
+	Timeout time.Duration // 为 0 时使用 command_timeout，小于 0 时不限制（如用户在终端中直接执行的命令）
+	Stdout  io.Writer     // 不为空时实时写入 stdout 的每个数据块，不受截断影响
+	Stderr  io.Writer     // 不为空时实时写入 stderr 的每个数据块，不受截断影响
+}
+
+// RunShellWith 按选项执行命令；输出按数据块写入，结果中每个流只保留前 maxShellOutput 字节，
+// 输出再多也不会占用更多内存
+func RunShellWith(parent context.Context, c string, opts ShellOptions) *ShellResult {
+	result := &ShellResult{Command: c}
 	if strings.HasPrefix(strings.TrimSpace(c), "kubectl") {
 		if !CheckK8sConnection() {
-			return "❌ Error: Kubernetes cluster is unreachable. Please check ~/.kube/config mount."
+			result.Stderr = "❌ Error: Kubernetes cluster is unreachable. Please check ~/.kube/config mount."
+			result.ExitCode = -1
+			return result
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = commandTimeout()
+	}
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		result.Timeout = timeout
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "bash", "-c", c)
-	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	killProcessGroupOnCancel(cmd)
+	cmd.WaitDelay = time.Second
 
-	out, err := cmd.CombinedOutput()
-	res := string(out)
+	stdout := &cappedBuffer{limit: maxShellOutput, tee: opts.Stdout}
+	stderr := &cappedBuffer{limit: maxShellOutput, tee: opts.Stderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	start := time.Now()
+	err := cmd.Run()
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.dropped || stderr.dropped
 
-	if ctx.Err() == context.DeadlineExceeded {
-		res += "\n(Command timed out after 60s)"
+	result.ExitCode = -1
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if parent.Err() != nil {
+		result.Cancelled = true
+	} else if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		result.TimedOut = true
 	} else if err != nil {
-		if len(res) > 0 {
-			res += fmt.Sprintf("\n(Command failed: %v)", err)
+		result.Err = err.Error()
+	}
+	return result
+}
+
+// cappedBuffer 只保留前 limit 字节的输出，多余的部分丢弃并标记；tee 不为空时同时实时转发每个数据块
+type cappedBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	limit   int
+	dropped bool
+	tee     io.Writer
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.limit - len(b.buf); room > 0 {
+		if len(p) > room {
+			b.buf = append(b.buf, p[:room]...)
+			b.dropped = true
 		} else {
-			res = fmt.Sprintf("(Command failed: %v)", err)
+			b.buf = append(b.buf, p...)
 		}
+	} else if len(p) > 0 {
+		b.dropped = true
+	}
+	if b.tee != nil {
+		b.tee.Write(p)
+	}
+	return len(p), nil
+}
+
+// String 保留的输出，丢弃过输出时追加截断提示
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropped {
+		return string(b.buf) + "\n...(Output truncated)"
 	}
-	if len(res) > 4000 {
-		res = res[:4000] + "\n...(Output truncated)"
+	return string(b.buf)
+}
+
+// ShellOutput 按本机命令相同的规则截断的输出，远程执行器用它采集 stdout 和 stderr
+type ShellOutput struct {
+	cappedBuffer
+}
+
+// NewShellOutput 创建输出缓冲，tee 不为空时实时转发每个数据块
+func NewShellOutput(tee io.Writer) *ShellOutput {
+	return &ShellOutput{cappedBuffer{limit: maxShellOutput, tee: tee}}
+}
+
+// Truncated 是否丢弃过超出长度的输出
+func (o *ShellOutput) Truncated() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.dropped
+}
+
+// truncateOutput 截断过长的输出
+func truncateOutput(s string) string {
+	if len(s) > maxShellOutput {
+		return s[:maxShellOutput] + "\n...(Output truncated)"
 	}
-	return res
+	return s
 }
 
 func CheckK8sConnection() bool {
@@ -53,28 +261,18 @@ func CheckK8sConnection() bool {
 	return true
 }
 
+// IsCommandSafe 按当前的自动执行策略判断命令是否不会被拒绝
 func IsCommandSafe(c string) bool {
-	return security.CheckRisk(c) != security.RiskCritical
+	return security.EvaluateAutoExec(c).Action != security.ActionDeny
 }
 
+// IsReadOnlyCommand 按当前的自动执行策略判断命令是否可以自动执行
 func IsReadOnlyCommand(cmd string) bool {
-	safeKeywords := []string{
-		"ls", "cat", "head", "tail", "grep", "find", "pwd", "echo", "whoami", "id",
-		"ps", "top", "uptime", "free", "df", "du", "netstat", "ss", "lsof",
-		"kubectl get", "kubectl describe", "kubectl logs", "kubectl top", "kubectl cluster-info",
-		"docker ps", "docker logs", "docker stats", "ip", "hostname",
-	}
-	c := strings.ToLower(cmd)
-	for _, kw := range safeKeywords {
-		if strings.HasPrefix(c, kw) || strings.Contains(c, " "+kw) {
-			if !strings.Contains(c, ">") && !strings.Contains(c, "rm ") && !strings.Contains(c, "kill") && !strings.Contains(c, "delete") {
-				return true
-			}
-		}
-	}
-	return false
+	return security.EvaluateAutoExec(cmd).Action == security.ActionAuto
 }
 
+// ConfirmExecution 按风险等级确认命令，标准输入不是终端时按 Confirm 的规则处理；
+// 极高风险命令必须在终端中输入验证码，--yes 也不会自动确认
 func ConfirmExecution(cmd string) bool {
 	risk := security.CheckRisk(cmd)
 	switch risk {
@@ -82,26 +280,24 @@ func ConfirmExecution(cmd string) bool {
 		return true
 	case security.RiskMedium:
 		fmt.Printf("\n\033[33m⚠️  [中风险] 这是一个修改操作: %s\033[0m\n", cmd)
-		fmt.Print("确认执行? (y/N): ")
+		return Confirm("确认执行? (y/N): ", ConfirmYes)
 	case security.RiskHigh:
 		fmt.Printf("\n\033[31m🔥 [高风险] 这是一个危险操作: %s\033[0m\n", cmd)
-		fmt.Print("确认执行? (输入 'yes' 确认): ")
-	case security.RiskCritical:
-		code := security.GenerateVerifyCode()
-		fmt.Printf("\n\033[41;37m💀 [极高风险] 毁灭性操作警告: %s \033[0m\n", cmd)
-		fmt.Printf("请输入验证码 \033[1;33m%s\033[0m 以确认: ", code)
-		reader := bufio.NewReader(os.Stdin)
-		input, _ := reader.ReadString('\n')
-		return strings.TrimSpace(input) == code
-	}
-
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
-	input = strings.TrimSpace(strings.ToLower(input))
-	if risk == security.RiskHigh {
-		return input == "yes"
-	}
-	return input == "y" || input == "yes"
+		return Confirm("确认执行? (输入 'yes' 确认): ", func(answer string) bool {
+			return strings.ToLower(answer) == "yes"
+		})
+	}
+
+	fmt.Printf("\n\033[41;37m💀 [极高风险] 毁灭性操作警告: %s \033[0m\n", cmd)
+	if !StdinIsTerminal() {
+		fmt.Println("标准输入不是终端，极高风险命令不会自动确认")
+		logger.Info("[AUDIT] ⌨️ 标准输入不是终端，拒绝极高风险命令: %q", cmd)
+		return false
+	}
+	code := security.GenerateVerifyCode()
+	return Confirm(fmt.Sprintf("请输入验证码 \033[1;33m%s\033[0m 以确认: ", code), func(answer string) bool {
+		return answer == code
+	})
 }
 
 func GetHostname() string {
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"qwq/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunShell_SeparatesStreams(t *testing.T) {
+	res := RunShell("echo result; echo 'warning: something' >&2; exit 3")
+
+	if res.Stdout != "result\n" || res.Stderr != "warning: something\n" {
+		t.Fatalf("Expected separate streams, got stdout=%q stderr=%q", res.Stdout, res.Stderr)
+	}
+	if res.ExitCode != 3 || res.OK() || res.TimedOut || res.Cancelled || res.Duration <= 0 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+
+	formatted := res.Format()
+	for _, want := range []string{"[exit_code] 3", "[stdout]\nresult\n", "[stderr]\nwarning: something"} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("Expected %q in formatted output:\n%s", want, formatted)
+		}
+	}
+
+	// 兼容接口仍返回合并后的输出和失败说明
+	if got := ExecuteShell("echo result; echo 'warning: something' >&2; exit 3"); got != "result\nwarning: something\n\n(Command failed: exit status 3)" {
+		t.Errorf("Unexpected combined output %q", got)
+	}
+}
+
+func TestRunShell_SuccessAndEmptyStreams(t *testing.T) {
+	res := RunShell("true")
+	if !res.OK() || res.ExitCode != 0 || res.Err != "" {
+		t.Fatalf("Expected success, got %+v", res)
+	}
+	if formatted := res.Format(); !strings.Contains(formatted, "[stdout] (empty)") || !strings.Contains(formatted, "[stderr] (empty)") {
+		t.Errorf("Expected empty sections to be labelled, got:\n%s", formatted)
+	}
+	if got := res.Combined(); got != "" {
+		t.Errorf("Expected empty combined output, got %q", got)
+	}
+}
+
+func TestRunShellContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	res := RunShellContext(ctx, "echo started; sleep 30")
+	if !res.Cancelled || res.OK() || res.Stdout != "started\n" {
+		t.Fatalf("Expected cancelled result with partial stdout, got %+v", res)
+	}
+	if !strings.HasSuffix(res.Combined(), "\n(Command cancelled)") || !strings.Contains(res.Format(), "(cancelled)") {
+		t.Errorf("Expected cancellation to be reported, got %q / %q", res.Combined(), res.Format())
+	}
+}
+
+func TestRunShell_ConfiguredTimeoutKillsProcessGroup(t *testing.T) {
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) { cfg.CommandTimeout = 1 })
+
+	start := time.Now()
+	// 子进程继承输出管道，只终止 bash 时 Run 会一直等待
+	res := RunShell("echo started; sleep 30 & sleep 30; wait")
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Expected the process group to be killed after the timeout, took %v", elapsed)
+	}
+	if !res.TimedOut || res.Timeout != time.Second || res.Stdout != "started\n" {
+		t.Fatalf("Expected a timed out result with partial stdout, got %+v", res)
+	}
+	if !strings.Contains(res.Format(), "(timed out after 1s)") {
+		t.Errorf("Expected the configured timeout in the output, got:\n%s", res.Format())
+	}
+}
+
+func TestRunShellWith_StreamsAndCapsOutput(t *testing.T) {
+	var streamed strings.Builder
+	res := RunShellWith(context.Background(), "yes line | head -c 200000", ShellOptions{Stdout: &streamed})
+
+	if !res.OK() || !res.Truncated {
+		t.Fatalf("Expected a successful truncated result, got exit %d truncated %v", res.ExitCode, res.Truncated)
+	}
+	if !strings.HasSuffix(res.Stdout, "\n...(Output truncated)") || len(res.Stdout) != maxShellOutput+len("\n...(Output truncated)") {
+		t.Errorf("Expected stdout capped at %d bytes, got %d", maxShellOutput, len(res.Stdout))
+	}
+	// 实时输出不受截断影响
+	if streamed.Len() != 200000 {
+		t.Errorf("Expected the full output to be streamed, got %d bytes", streamed.Len())
+	}
+
+	if res := RunShell("printf abc"); res.Truncated || res.Stdout != "abc" {
+		t.Errorf("Expected short output untouched, got %+v", res)
+	}
+}
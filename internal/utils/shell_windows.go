@@ -0,0 +1,8 @@
+//go:build windows
+
+package utils
+
+import "os/exec"
+
+// killProcessGroupOnCancel Windows 下取消时只终止 bash 进程
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
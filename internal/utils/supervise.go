@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"qwq/internal/logger"
+	"qwq/internal/monitor"
+	"runtime/debug"
+	"time"
+)
+
+// 后台任务重启退避参数
+var (
+	SuperviseMinBackoff = time.Second
+	SuperviseMaxBackoff = time.Minute
+	// SuperviseResetAfter 任务稳定运行超过该时长后，退避时间重置
+	SuperviseResetAfter = time.Minute
+)
+
+// RecordPanic 记录已恢复的 panic：输出堆栈并累加 qwq_panics_total 指标
+func RecordPanic(source string, value interface{}, stack []byte) {
+	monitor.Panics.WithLabelValues(source).Inc()
+	logger.Info("💥 [%s] panic recovered: %v\n%s", source, value, stack)
+}
+
+// Supervise 运行后台任务，任务 panic 时记录堆栈并按指数退避重启
+// 任务正常返回或 ctx 结束时 Supervise 返回
+func Supervise(ctx context.Context, name string, task func(ctx context.Context)) {
+	backoff := SuperviseMinBackoff
+	for {
+		started := time.Now()
+		if !runRecovered(ctx, name, task) {
+			return
+		}
+
+		if time.Since(started) > SuperviseResetAfter {
+			backoff = SuperviseMinBackoff
+		}
+		logger.Info("🔁 [%s] 将在 %v 后重启", name, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > SuperviseMaxBackoff {
+			backoff = SuperviseMaxBackoff
+		}
+	}
+}
+
+// runRecovered 执行一次任务，返回是否发生了 panic
+func runRecovered(ctx context.Context, name string, task func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			RecordPanic(name, r, debug.Stack())
+			panicked = true
+		}
+	}()
+	task(ctx)
+	return false
+}
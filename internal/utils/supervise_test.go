@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSupervise_RestartsAfterPanic(t *testing.T) {
+	SuperviseMinBackoff, SuperviseMaxBackoff = time.Millisecond, 4*time.Millisecond
+	defer func() { SuperviseMinBackoff, SuperviseMaxBackoff = time.Second, time.Minute }()
+
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		Supervise(context.Background(), "test", func(ctx context.Context) {
+			runs++
+			if runs < 3 {
+				panic("bad patrol rule")
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Supervise should return once the task returns normally")
+	}
+	if runs != 3 {
+		t.Errorf("Expected task to be restarted twice, ran %d times", runs)
+	}
+}
+
+func TestSupervise_StopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Supervise(ctx, "test", func(ctx context.Context) { panic("always") })
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Supervise should stop when context is cancelled")
+	}
+}
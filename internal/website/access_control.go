@@ -0,0 +1,203 @@
+package website
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HtpasswdDir 托管的 htpasswd 文件目录，每个启用 Basic 认证的站点一个文件
+var HtpasswdDir = "/etc/nginx/qwq-htpasswd"
+
+// ErrInvalidAccessRule 无效的访问控制配置
+var ErrInvalidAccessRule = errors.New("invalid access control")
+
+// FieldError 字段级校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// AccessRuleError 访问控制校验错误，包含所有出错字段
+type AccessRuleError struct {
+	Fields []FieldError
+}
+
+func (e *AccessRuleError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidAccessRule, strings.Join(parts, "; "))
+}
+
+func (e *AccessRuleError) Unwrap() error {
+	return ErrInvalidAccessRule
+}
+
+// ipRule 已解析的 allow/deny 规则
+type ipRule struct {
+	raw     string
+	network *net.IPNet
+}
+
+// parseIPRules 解析 JSON 数组形式的 IP/CIDR 列表，单个 IP 视为 /32 或 /128
+func parseIPRules(field, value string, errs *[]FieldError) []ipRule {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var entries []string
+	if err := json.Unmarshal([]byte(value), &entries); err != nil {
+		*errs = append(*errs, FieldError{Field: field, Message: "must be a JSON array of IP addresses or CIDRs"})
+		return nil
+	}
+
+	rules := make([]ipRule, 0, len(entries))
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		var network *net.IPNet
+		if strings.Contains(entry, "/") {
+			_, parsed, err := net.ParseCIDR(entry)
+			if err != nil {
+				*errs = append(*errs, FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Message: fmt.Sprintf("%q is not a valid CIDR", entry)})
+				continue
+			}
+			network = parsed
+		} else if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		} else {
+			*errs = append(*errs, FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Message: fmt.Sprintf("%q is not a valid IP address or CIDR", entry)})
+			continue
+		}
+		rules = append(rules, ipRule{raw: entry, network: network})
+	}
+	return rules
+}
+
+// networksOverlap 判断两个网段是否有交集
+func networksOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// prepareAccessControl 校验访问控制字段并对 Basic 认证密码做 bcrypt 哈希
+// existing 为更新前的配置，未重新提交密码时沿用原有哈希；重叠的 allow/deny 规则记录到 Warnings
+func prepareAccessControl(config *ProxyConfig, existing *ProxyConfig) error {
+	var errs []FieldError
+	allows := parseIPRules("allow_ips", config.AllowIPs, &errs)
+	denies := parseIPRules("deny_ips", config.DenyIPs, &errs)
+
+	config.Warnings = nil
+	for _, deny := range denies {
+		for _, allow := range allows {
+			if networksOverlap(deny.network, allow.network) {
+				config.Warnings = append(config.Warnings,
+					fmt.Sprintf("deny %s overlaps allow %s; deny rules are evaluated first", deny.raw, allow.raw))
+			}
+		}
+	}
+
+	if config.BasicAuthEnabled {
+		switch {
+		case config.BasicAuthUser == "":
+			errs = append(errs, FieldError{Field: "basic_auth_user", Message: "is required when basic auth is enabled"})
+		case strings.ContainsAny(config.BasicAuthUser, ":\n\r"):
+			errs = append(errs, FieldError{Field: "basic_auth_user", Message: "must not contain ':' or line breaks"})
+		}
+
+		if config.BasicAuthPassword != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(config.BasicAuthPassword), bcrypt.DefaultCost)
+			if err != nil {
+				errs = append(errs, FieldError{Field: "basic_auth_password", Message: err.Error()})
+			}
+			config.BasicAuthHash = string(hash)
+		} else if existing != nil && existing.BasicAuthHash != "" && existing.BasicAuthUser == config.BasicAuthUser {
+			config.BasicAuthHash = existing.BasicAuthHash
+		} else if config.BasicAuthHash == "" {
+			errs = append(errs, FieldError{Field: "basic_auth_password", Message: "is required when basic auth is enabled"})
+		}
+	} else {
+		config.BasicAuthHash = ""
+	}
+	config.BasicAuthPassword = "" // 明文密码不落库、不回显
+
+	if len(errs) > 0 {
+		return &AccessRuleError{Fields: errs}
+	}
+	return nil
+}
+
+// basicAuthActive 是否应生成 Basic 认证指令
+func basicAuthActive(config *ProxyConfig) bool {
+	return config != nil && config.BasicAuthEnabled && config.BasicAuthUser != "" && config.BasicAuthHash != ""
+}
+
+// htpasswdPath 站点的 htpasswd 文件路径
+func htpasswdPath(domain string) string {
+	return filepath.Join(HtpasswdDir, sanitizeName(domain)+".htpasswd")
+}
+
+// SyncHtpasswd 按站点配置写入或删除托管的 htpasswd 文件，应在写入 Nginx 配置前调用
+func SyncHtpasswd(website *Website) error {
+	path := htpasswdPath(website.Domain)
+	if !basicAuthActive(website.ProxyConfig) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove htpasswd file: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(HtpasswdDir, 0750); err != nil {
+		return fmt.Errorf("failed to create htpasswd directory: %w", err)
+	}
+	content := fmt.Sprintf("%s:%s\n", website.ProxyConfig.BasicAuthUser, website.ProxyConfig.BasicAuthHash)
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		return fmt.Errorf("failed to write htpasswd file: %w", err)
+	}
+	return nil
+}
+
+// generateAccessControl 生成 allow/deny 和 Basic 认证指令
+// deny 规则在前；配置了 allow 列表时，未命中的地址全部拒绝
+func (g *NginxConfigGenerator) generateAccessControl() string {
+	config := g.website.ProxyConfig
+	if config == nil {
+		return ""
+	}
+
+	var ignored []FieldError
+	allows := parseIPRules("allow_ips", config.AllowIPs, &ignored)
+	denies := parseIPRules("deny_ips", config.DenyIPs, &ignored)
+	authActive := basicAuthActive(config)
+	if len(allows) == 0 && len(denies) == 0 && !authActive {
+		return ""
+	}
+
+	var builder strings.Builder
+	builder.WriteString("    # Access control\n")
+	for _, rule := range denies {
+		builder.WriteString(fmt.Sprintf("    deny %s;\n", rule.raw))
+	}
+	for _, rule := range allows {
+		builder.WriteString(fmt.Sprintf("    allow %s;\n", rule.raw))
+	}
+	if len(allows) > 0 {
+		builder.WriteString("    deny all;\n")
+	}
+	if authActive {
+		builder.WriteString("    auth_basic \"Restricted\";\n")
+		builder.WriteString(fmt.Sprintf("    auth_basic_user_file %s;\n", htpasswdPath(g.website.Domain)))
+	}
+	builder.WriteString("\n")
+
+	return builder.String()
+}
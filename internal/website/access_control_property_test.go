@@ -0,0 +1,256 @@
+package website
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试用的固定 bcrypt 哈希，避免属性测试中反复计算
+const testBasicAuthHash = "$2a$10$abcdefghijklmnopqrstuu5Zr2k3o7XvQ1YqB0JxF7Vq2b3n6E9Gi"
+
+// genIPRule 生成 IPv4 地址或 CIDR
+func genIPRule() gopter.Gen {
+	return gopter.CombineGens(
+		gen.IntRange(1, 223),
+		gen.IntRange(0, 255),
+		gen.IntRange(0, 255),
+		gen.OneConstOf("", "/8", "/16", "/24", "/32"),
+	).Map(func(values []interface{}) string {
+		suffix := values[3].(string)
+		last := 0
+		if suffix == "" || suffix == "/32" {
+			last = 1
+		}
+		ip := fmt.Sprintf("%d.%d.%d.%d", values[0].(int), values[1].(int), values[2].(int), last)
+		if suffix == "/8" {
+			ip = fmt.Sprintf("%d.0.0.0", values[0].(int))
+		}
+		return ip + suffix
+	})
+}
+
+// accessCase 访问控制配置组合
+type accessCase struct {
+	website *Website
+	allows  []string
+	denies  []string
+	auth    bool
+}
+
+// genAccessCase 生成带随机访问控制配置的反向代理站点
+func genAccessCase() gopter.Gen {
+	return gopter.CombineGens(
+		genWebsite(false, false),
+		gen.SliceOfN(2, genIPRule()),
+		gen.SliceOfN(2, genIPRule()),
+		gen.IntRange(0, 2), // allow 条数
+		gen.IntRange(0, 2), // deny 条数
+		gen.Bool(),         // 是否启用 Basic 认证
+	).Map(func(values []interface{}) accessCase {
+		c := accessCase{
+			website: values[0].(*Website),
+			allows:  values[1].([]string)[:values[3].(int)],
+			denies:  values[2].([]string)[:values[4].(int)],
+			auth:    values[5].(bool),
+		}
+		config := c.website.ProxyConfig
+		if len(c.allows) > 0 {
+			data, _ := json.Marshal(c.allows)
+			config.AllowIPs = string(data)
+		}
+		if len(c.denies) > 0 {
+			data, _ := json.Marshal(c.denies)
+			config.DenyIPs = string(data)
+		}
+		if c.auth {
+			config.BasicAuthEnabled = true
+			config.BasicAuthUser = "office"
+			config.BasicAuthHash = testBasicAuthHash
+		}
+		return c
+	})
+}
+
+// TestProperty18_AccessControlDirectives 测试访问控制指令生成
+// 验证 allow/deny 和 auth_basic 指令仅在配置时出现
+func TestProperty18_AccessControlDirectives(t *testing.T) {
+	properties := gopter.NewProperties(nil)
+
+	// Property 18: 访问控制指令与配置一一对应
+	properties.Property("allow/deny 与 auth_basic 仅在配置时生成", prop.ForAll(
+		func(c accessCase) bool {
+			config, err := NewNginxConfigGenerator(c.website).Generate()
+			if err != nil {
+				t.Logf("配置生成失败: %v", err)
+				return false
+			}
+
+			for _, rule := range c.allows {
+				if !strings.Contains(config, fmt.Sprintf("allow %s;", rule)) {
+					t.Logf("配置缺少 allow %s", rule)
+					return false
+				}
+			}
+			for _, rule := range c.denies {
+				if !strings.Contains(config, fmt.Sprintf("deny %s;", rule)) {
+					t.Logf("配置缺少 deny %s", rule)
+					return false
+				}
+			}
+			if (len(c.allows) > 0) != strings.Contains(config, "deny all;") {
+				t.Logf("deny all 与 allow 列表不一致: allows=%v", c.allows)
+				return false
+			}
+			if len(c.allows) == 0 && strings.Contains(config, "allow ") {
+				t.Logf("未配置 allow 时不应生成 allow 指令")
+				return false
+			}
+			if len(c.allows) == 0 && len(c.denies) == 0 && !c.auth && strings.Contains(config, "# Access control") {
+				t.Logf("未配置访问控制时不应生成访问控制块")
+				return false
+			}
+
+			hasAuth := strings.Contains(config, "auth_basic \"Restricted\";") &&
+				strings.Contains(config, "auth_basic_user_file "+htpasswdPath(c.website.Domain)+";")
+			if c.auth != hasAuth || (!c.auth && strings.Contains(config, "auth_basic")) {
+				t.Logf("auth_basic 指令与配置不一致: enabled=%v", c.auth)
+				return false
+			}
+			return true
+		},
+		genAccessCase(),
+	))
+
+	// Property 19: 关闭 Basic 认证后配置中不再引用 htpasswd，且托管文件被删除
+	properties.Property("关闭 Basic 认证移除 htpasswd 引用", prop.ForAll(
+		func(website *Website) bool {
+			saved := HtpasswdDir
+			HtpasswdDir = t.TempDir()
+			defer func() { HtpasswdDir = saved }()
+
+			website.ProxyConfig.BasicAuthEnabled = true
+			website.ProxyConfig.BasicAuthUser = "office"
+			website.ProxyConfig.BasicAuthHash = testBasicAuthHash
+			if err := SyncHtpasswd(website); err != nil {
+				t.Logf("写入 htpasswd 失败: %v", err)
+				return false
+			}
+			enabled, _ := NewNginxConfigGenerator(website).Generate()
+			if !strings.Contains(enabled, htpasswdPath(website.Domain)) {
+				t.Logf("启用时缺少 htpasswd 引用")
+				return false
+			}
+
+			existing := *website.ProxyConfig
+			website.ProxyConfig.BasicAuthEnabled = false
+			if err := prepareAccessControl(website.ProxyConfig, &existing); err != nil {
+				t.Logf("校验失败: %v", err)
+				return false
+			}
+			if err := SyncHtpasswd(website); err != nil {
+				t.Logf("删除 htpasswd 失败: %v", err)
+				return false
+			}
+			disabled, _ := NewNginxConfigGenerator(website).Generate()
+			if strings.Contains(disabled, "auth_basic") || strings.Contains(disabled, ".htpasswd") {
+				t.Logf("关闭后仍引用 htpasswd")
+				return false
+			}
+			if _, err := os.Stat(htpasswdPath(website.Domain)); !os.IsNotExist(err) {
+				t.Logf("关闭后 htpasswd 文件仍存在")
+				return false
+			}
+			return true
+		},
+		genWebsite(false, false),
+	))
+
+	// Property 20: 格式错误的 CIDR 被拒绝，并指出出错的字段和下标
+	properties.Property("拒绝格式错误的 CIDR", prop.ForAll(
+		func(valid []string, bad string, index int) bool {
+			entries := append([]string{}, valid...)
+			index = index % (len(entries) + 1)
+			entries = append(entries[:index], append([]string{bad}, entries[index:]...)...)
+			data, _ := json.Marshal(entries)
+
+			config := &ProxyConfig{Backend: "http://127.0.0.1:8080", DenyIPs: string(data)}
+			err := prepareAccessControl(config, nil)
+			var ruleErr *AccessRuleError
+			if !errors.As(err, &ruleErr) || !errors.Is(err, ErrInvalidAccessRule) {
+				t.Logf("期望 AccessRuleError，得到 %v", err)
+				return false
+			}
+			expected := fmt.Sprintf("deny_ips[%d]", index)
+			return len(ruleErr.Fields) == 1 && ruleErr.Fields[0].Field == expected
+		},
+		gen.SliceOfN(2, genIPRule()),
+		gen.OneConstOf("10.0.0.0/33", "300.1.1.1", "10.0.0.1/abc", "office", ""),
+		gen.IntRange(0, 2),
+	))
+
+	// 运行属性测试（100次迭代）
+	properties.TestingRun(t, gopter.ConsoleReporter(false))
+}
+
+func TestPrepareAccessControl_BasicAuthAndOverlap(t *testing.T) {
+	config := &ProxyConfig{
+		Backend:           "http://127.0.0.1:8080",
+		AllowIPs:          `["10.1.0.0/16"]`,
+		DenyIPs:           `["10.0.0.0/8", "192.168.1.1"]`,
+		BasicAuthEnabled:  true,
+		BasicAuthUser:     "office",
+		BasicAuthPassword: "s3cret",
+	}
+	if err := prepareAccessControl(config, nil); err != nil {
+		t.Fatalf("prepareAccessControl failed: %v", err)
+	}
+	if len(config.Warnings) != 1 || !strings.Contains(config.Warnings[0], "10.0.0.0/8") {
+		t.Errorf("Expected one overlap warning, got %v", config.Warnings)
+	}
+	if config.BasicAuthPassword != "" {
+		t.Error("Plain password must be cleared")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(config.BasicAuthHash), []byte("s3cret")) != nil {
+		t.Error("Expected bcrypt hash of the password")
+	}
+
+	// 更新时未提交密码沿用原哈希
+	update := &ProxyConfig{Backend: config.Backend, BasicAuthEnabled: true, BasicAuthUser: "office"}
+	if err := prepareAccessControl(update, config); err != nil || update.BasicAuthHash != config.BasicAuthHash {
+		t.Errorf("Expected existing hash to be kept, got %q, %v", update.BasicAuthHash, err)
+	}
+
+	// 启用认证但缺少用户名和密码
+	missing := &ProxyConfig{Backend: config.Backend, BasicAuthEnabled: true}
+	var ruleErr *AccessRuleError
+	if err := prepareAccessControl(missing, nil); !errors.As(err, &ruleErr) || len(ruleErr.Fields) != 2 {
+		t.Errorf("Expected field errors for user and password, got %v", err)
+	}
+}
+
+func TestSyncHtpasswd(t *testing.T) {
+	saved := HtpasswdDir
+	HtpasswdDir = filepath.Join(t.TempDir(), "htpasswd")
+	defer func() { HtpasswdDir = saved }()
+
+	website := &Website{Domain: "tools.example.com", ProxyConfig: &ProxyConfig{
+		BasicAuthEnabled: true, BasicAuthUser: "office", BasicAuthHash: testBasicAuthHash,
+	}}
+	if err := SyncHtpasswd(website); err != nil {
+		t.Fatalf("SyncHtpasswd failed: %v", err)
+	}
+	data, err := os.ReadFile(htpasswdPath(website.Domain))
+	if err != nil || string(data) != "office:"+testBasicAuthHash+"\n" {
+		t.Errorf("Unexpected htpasswd content %q, %v", data, err)
+	}
+}
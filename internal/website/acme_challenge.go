@@ -0,0 +1,153 @@
+package website
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChallengeStore 保存进行中的 HTTP-01 挑战，作为 http.Handler 响应 /.well-known/acme-challenge/<token>
+type ChallengeStore struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+// DefaultChallenges qwq Web 服务挂载的 HTTP-01 挑战，ACMEOptionsFromConfig 使用
+var DefaultChallenges = NewChallengeStore()
+
+// NewChallengeStore 创建 HTTP-01 挑战存储
+func NewChallengeStore() *ChallengeStore {
+	return &ChallengeStore{tokens: make(map[string]string)}
+}
+
+// Put 添加挑战 token 的响应内容
+func (s *ChallengeStore) Put(token, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = response
+}
+
+// Delete 删除挑战 token
+func (s *ChallengeStore) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+// ServeHTTP 按路径最后一段查找 token，未知的 token 返回 404
+func (s *ChallengeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	response, ok := s.tokens[path.Base(r.URL.Path)]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(response))
+}
+
+// DNS01Solver 发布和清理 DNS-01 挑战的 TXT 记录
+type DNS01Solver interface {
+	// Present 发布 fqdn 的 TXT 记录，返回时记录应已可以解析
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp 删除 Present 发布的记录
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// DNSChallengeSolver 通过 DNSService 创建由 qwq 管理的 TXT 记录，记录同步到 DNS 提供商，也可以在 DNS 管理中查看
+type DNSChallengeSolver struct {
+	Provider string        // DNS 提供商名称，凭证在 dns.providers 中配置
+	Records  DNSService    // 创建、删除记录和检查解析
+	Zone     string        // 托管的主域名，为空时取 fqdn 的最后两段
+	Timeout  time.Duration // 等待记录解析生效的最长时间，默认 2 分钟
+	Interval time.Duration // 检查解析的间隔，默认 5 秒
+
+	mu      sync.Mutex
+	records map[string]*DNSRecord // fqdn+value -> 已发布的记录
+}
+
+// zoneOf fqdn 所在的主域名和相对主域名的记录名
+func (s *DNSChallengeSolver) zoneOf(fqdn string) (zone, name string) {
+	zone = s.Zone
+	if zone == "" {
+		labels := strings.Split(fqdn, ".")
+		if len(labels) < 2 {
+			return fqdn, "@"
+		}
+		zone = strings.Join(labels[len(labels)-2:], ".")
+	}
+	return zone, strings.TrimSuffix(strings.TrimSuffix(fqdn, zone), ".")
+}
+
+// Present 添加 TXT 记录并等待 Records 能解析到它
+func (s *DNSChallengeSolver) Present(ctx context.Context, fqdn, value string) error {
+	zone, name := s.zoneOf(fqdn)
+	record := &DNSRecord{
+		Domain:   zone,
+		Type:     DNSRecordTXT,
+		Name:     name,
+		Value:    value,
+		TTL:      120,
+		Provider: s.Provider,
+		Managed:  true,
+	}
+	if err := s.Records.CreateDNSRecord(ctx, record); err != nil {
+		return fmt.Errorf("failed to add txt record: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.records == nil {
+		s.records = make(map[string]*DNSRecord)
+	}
+	s.records[fqdn+" "+value] = record
+	s.mu.Unlock()
+
+	return s.waitPropagation(ctx, fqdn, value)
+}
+
+// waitPropagation 轮询 VerifyDNS 直到 TXT 记录生效或超时
+func (s *DNSChallengeSolver) waitPropagation(ctx context.Context, fqdn, value string) error {
+	timeout, interval := s.Timeout, s.Interval
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if verification, err := s.Records.VerifyDNS(ctx, fqdn, string(DNSRecordTXT), value); err == nil && verification.Propagated {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("txt record %s not visible after %s", fqdn, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// CleanUp 删除 Present 添加的记录，同时从 DNS 提供商删除
+func (s *DNSChallengeSolver) CleanUp(ctx context.Context, fqdn, value string) error {
+	s.mu.Lock()
+	record, ok := s.records[fqdn+" "+value]
+	delete(s.records, fqdn+" "+value)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := s.Records.DeleteDNSRecord(ctx, record.ID); err != nil {
+		return fmt.Errorf("failed to delete txt record: %w", err)
+	}
+	return nil
+}
@@ -9,11 +9,16 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"qwq/internal/config"
+
 	"golang.org/x/crypto/acme"
 )
 
@@ -22,71 +27,152 @@ const (
 	LetsEncryptProductionURL = "https://acme-v02.api.letsencrypt.org/directory"
 	// LetsEncryptStagingURL Let's Encrypt 测试环境 URL
 	LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
-	// CertStorageDir 证书存储目录
+	// CertStorageDir 默认的证书存储目录
 	CertStorageDir = "/etc/qwq/ssl"
+	// DefaultRenewDays 新证书默认在到期前 30 天进入续期窗口
+	DefaultRenewDays = 30
+	// accountKeyFile ACME 账户私钥在证书目录中的文件名，复用账户避免每次签发都注册新账户
+	accountKeyFile = "acme_account.key"
 )
 
+// ErrNoChallenge ACME 授权中没有可用的挑战：通配符域名需要 DNS-01，其他域名需要 HTTP-01 或 DNS-01
+var ErrNoChallenge = errors.New("no usable acme challenge")
+
+// ACMEOptions ACME 客户端配置
+type ACMEOptions struct {
+	DirectoryURL string          // ACME 目录地址，为空时使用 Let's Encrypt 生产环境
+	Email        string          // 账户联系邮箱，可为空
+	AccountKey   string          // 账户私钥文件，不存在时生成并保存；为空时每次使用新账户
+	HTTP01       *ChallengeStore // 非空时由 qwq 的 Web 服务响应 HTTP-01 挑战
+	DNS01        DNS01Solver     // 非空时可以使用 DNS-01 挑战，通配符域名只能使用 DNS-01
+	HTTPClient   *http.Client    // 访问 ACME 服务器的客户端，为空时使用默认客户端
+}
+
+// certDir 证书、私钥和账户密钥的保存目录
+func certDir() string {
+	if dir := config.Current().ACME.CertDir; dir != "" {
+		return dir
+	}
+	return CertStorageDir
+}
+
+// ACMEOptionsFromConfig 按 acme 配置创建客户端选项：staging 时使用 Let's Encrypt 测试环境，
+// HTTP-01 挑战由 DefaultChallenges 响应，配置了 DNS 提供商时通过 records 发布 DNS-01 的 TXT 记录并同步到提供商
+func ACMEOptionsFromConfig(cfg config.ACMEConfig, records DNSService) (ACMEOptions, error) {
+	opts := ACMEOptions{
+		DirectoryURL: LetsEncryptProductionURL,
+		Email:        cfg.Email,
+		AccountKey:   filepath.Join(certDir(), accountKeyFile),
+		HTTP01:       DefaultChallenges,
+	}
+	if cfg.Staging {
+		opts.DirectoryURL = LetsEncryptStagingURL
+	}
+	if cfg.DirectoryURL != "" {
+		opts.DirectoryURL = cfg.DirectoryURL
+	}
+	if cfg.DNS.Provider != "" {
+		// 提前检查凭证，避免在挑战时才发现提供商没有配置
+		if _, err := DNSProviderFromConfig(cfg.DNS.Provider); err != nil {
+			return opts, err
+		}
+		opts.DNS01 = &DNSChallengeSolver{
+			Provider: cfg.DNS.Provider,
+			Records:  records,
+			Zone:     cfg.DNS.Zone,
+			Timeout:  time.Duration(cfg.DNS.PropagationTimeout) * time.Second,
+		}
+	}
+	return opts, nil
+}
+
 // ACMEClient ACME 客户端
 type ACMEClient struct {
-	client      *acme.Client
-	accountKey  crypto.Signer
-	directoryURL string
+	client *acme.Client
+	opts   ACMEOptions
 }
 
 // NewACMEClient 创建 ACME 客户端
-func NewACMEClient(staging bool) (*ACMEClient, error) {
-	// 生成账户密钥
-	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate account key: %w", err)
+func NewACMEClient(opts ACMEOptions) (*ACMEClient, error) {
+	if opts.DirectoryURL == "" {
+		opts.DirectoryURL = LetsEncryptProductionURL
 	}
-
-	// 选择目录 URL
-	directoryURL := LetsEncryptProductionURL
-	if staging {
-		directoryURL = LetsEncryptStagingURL
+	accountKey, err := loadAccountKey(opts.AccountKey)
+	if err != nil {
+		return nil, err
 	}
 
 	client := &acme.Client{
 		Key:          accountKey,
-		DirectoryURL: directoryURL,
+		DirectoryURL: opts.DirectoryURL,
+		HTTPClient:   opts.HTTPClient,
+		UserAgent:    "qwq",
 	}
 
-	return &ACMEClient{
-		client:       client,
-		accountKey:   accountKey,
-		directoryURL: directoryURL,
-	}, nil
+	return &ACMEClient{client: client, opts: opts}, nil
 }
 
-// Register 注册 ACME 账户
-func (c *ACMEClient) Register(ctx context.Context, email string) error {
-	account := &acme.Account{
-		Contact: []string{"mailto:" + email},
+// loadAccountKey 读取 PEM 格式的账户私钥，文件不存在时生成新的 P-256 私钥并以 0600 权限保存；path 为空时只生成
+func loadAccountKey(path string) (crypto.Signer, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			block, _ := pem.Decode(data)
+			if block == nil {
+				return nil, fmt.Errorf("invalid account key %s", path)
+			}
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read account key: %w", err)
+		}
 	}
 
-	_, err := c.client.Register(ctx, account, acme.AcceptTOS)
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		// 如果账户已存在，忽略错误
-		if err != acme.ErrAccountAlreadyExists {
-			return fmt.Errorf("failed to register account: %w", err)
-		}
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+	if path == "" {
+		return accountKey, nil
+	}
+	der, err := x509.MarshalECPrivateKey(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write account key: %w", err)
+	}
+	return accountKey, nil
+}
+
+// Register 注册 ACME 账户，账户已存在时忽略
+func (c *ACMEClient) Register(ctx context.Context) error {
+	account := &acme.Account{}
+	if c.opts.Email != "" {
+		account.Contact = []string{"mailto:" + c.opts.Email}
+	}
+
+	if _, err := c.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("failed to register account: %w", err)
 	}
 
 	return nil
 }
 
-// ObtainCertificate 获取证书
-func (c *ACMEClient) ObtainCertificate(ctx context.Context, domain, email string) (*CertificateBundle, error) {
-	// 注册账户
-	if err := c.Register(ctx, email); err != nil {
+// ObtainCertificate 申请覆盖 domains 的证书，第一个域名作为 CommonName；以 *. 开头的通配符域名使用 DNS-01 挑战
+func (c *ACMEClient) ObtainCertificate(ctx context.Context, domains []string) (*CertificateBundle, error) {
+	if len(domains) == 0 {
+		return nil, ErrInvalidDomain
+	}
+	if err := c.Register(ctx); err != nil {
 		return nil, err
 	}
 
 	// 创建订单
-	order, err := c.client.AuthorizeOrder(ctx, []acme.AuthzID{
-		{Type: "dns", Value: domain},
-	})
+	order, err := c.client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
@@ -111,49 +197,24 @@ func (c *ACMEClient) ObtainCertificate(ctx context.Context, domain, email string
 	}
 
 	// 创建 CSR
-	csr, err := c.createCSR(certKey, domain)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create csr: %w", err)
 	}
 
-	// 完成订单
+	// 完成订单，返回的证书链第一张为站点证书
 	der, _, err := c.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to finalize order: %w", err)
 	}
 
-	// 解析证书
-	cert, err := x509.ParseCertificate(der[0])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse certificate: %w", err)
-	}
-
-	// 编码证书和私钥
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: der[0],
-	})
-
-	keyBytes, err := x509.MarshalECPrivateKey(certKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal key: %w", err)
-	}
-
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
-	})
-
-	return &CertificateBundle{
-		Domain:      domain,
-		Certificate: certPEM,
-		PrivateKey:  keyPEM,
-		NotBefore:   cert.NotBefore,
-		NotAfter:    cert.NotAfter,
-	}, nil
+	return newCertificateBundle(domains[0], der, certKey)
 }
 
-// completeChallenge 完成挑战
+// completeChallenge 完成一个授权的挑战：非通配符域名优先使用 HTTP-01，否则使用 DNS-01
 func (c *ACMEClient) completeChallenge(ctx context.Context, authzURL string) error {
 	// 获取授权
 	authz, err := c.client.GetAuthorization(ctx, authzURL)
@@ -166,35 +227,40 @@ func (c *ACMEClient) completeChallenge(ctx context.Context, authzURL string) err
 		return nil
 	}
 
-	// 选择 HTTP-01 挑战
 	var challenge *acme.Challenge
 	for _, ch := range authz.Challenges {
-		if ch.Type == "http-01" {
+		if ch.Type == "http-01" && c.opts.HTTP01 != nil && !authz.Wildcard {
 			challenge = ch
 			break
 		}
+		if ch.Type == "dns-01" && c.opts.DNS01 != nil {
+			challenge = ch
+		}
 	}
-
 	if challenge == nil {
-		return fmt.Errorf("no http-01 challenge found")
+		return fmt.Errorf("%w for %s", ErrNoChallenge, authz.Identifier.Value)
 	}
 
-	// 获取挑战响应
-	response, err := c.client.HTTP01ChallengeResponse(challenge.Token)
-	if err != nil {
-		return fmt.Errorf("failed to get challenge response: %w", err)
-	}
-
-	// 创建挑战文件
-	challengePath := filepath.Join("/var/www/html/.well-known/acme-challenge", challenge.Token)
-	if err := os.MkdirAll(filepath.Dir(challengePath), 0755); err != nil {
-		return fmt.Errorf("failed to create challenge directory: %w", err)
-	}
-
-	if err := os.WriteFile(challengePath, []byte(response), 0644); err != nil {
-		return fmt.Errorf("failed to write challenge file: %w", err)
+	switch challenge.Type {
+	case "http-01":
+		response, err := c.client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return fmt.Errorf("failed to get challenge response: %w", err)
+		}
+		c.opts.HTTP01.Put(challenge.Token, response)
+		defer c.opts.HTTP01.Delete(challenge.Token)
+	case "dns-01":
+		value, err := c.client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return fmt.Errorf("failed to get challenge record: %w", err)
+		}
+		// 通配符授权的标识是去掉 *. 的域名
+		fqdn := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+		if err := c.opts.DNS01.Present(ctx, fqdn, value); err != nil {
+			return fmt.Errorf("failed to present dns record: %w", err)
+		}
+		defer c.opts.DNS01.CleanUp(context.WithoutCancel(ctx), fqdn, value)
 	}
-	defer os.Remove(challengePath)
 
 	// 接受挑战
 	if _, err := c.client.Accept(ctx, challenge); err != nil {
@@ -202,67 +268,91 @@ func (c *ACMEClient) completeChallenge(ctx context.Context, authzURL string) err
 	}
 
 	// 等待验证完成
-	_, err = c.client.WaitAuthorization(ctx, authzURL)
-	if err != nil {
+	if _, err := c.client.WaitAuthorization(ctx, authzURL); err != nil {
 		return fmt.Errorf("failed to wait for authorization: %w", err)
 	}
 
 	return nil
 }
 
-// createCSR 创建证书签名请求
-func (c *ACMEClient) createCSR(key crypto.Signer, domain string) ([]byte, error) {
-	template := &x509.CertificateRequest{
-		Subject:  pkix.Name{CommonName: domain},
-		DNSNames: []string{domain},
-	}
-
-	return x509.CreateCertificateRequest(rand.Reader, template, key)
-}
-
-// RenewCertificate 续期证书
-func (c *ACMEClient) RenewCertificate(ctx context.Context, domain, email string) (*CertificateBundle, error) {
-	// 续期实际上就是重新获取证书
-	return c.ObtainCertificate(ctx, domain, email)
-}
-
 // CertificateBundle 证书包
 type CertificateBundle struct {
 	Domain      string
-	Certificate []byte
+	Domains     []string // 证书包含的全部域名（SAN）
+	Issuer      string   // 签发者的 CommonName
+	Certificate []byte   // PEM 格式的证书链，第一张为站点证书
 	PrivateKey  []byte
 	NotBefore   time.Time
 	NotAfter    time.Time
 }
 
-// SaveToFile 保存证书到文件
-func (b *CertificateBundle) SaveToFile() (certPath, keyPath string, err error) {
+// newCertificateBundle 由 DER 格式的证书链和私钥创建证书包，元数据取自第一张证书
+func newCertificateBundle(domain string, chain [][]byte, key *ecdsa.PrivateKey) (*CertificateBundle, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("empty certificate chain")
+	}
+	cert, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	issuer := cert.Issuer.CommonName
+	if issuer == "" {
+		issuer = cert.Issuer.String()
+	}
+	return &CertificateBundle{
+		Domain:      domain,
+		Domains:     cert.DNSNames,
+		Issuer:      issuer,
+		Certificate: certPEM,
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+	}, nil
+}
+
+// certFileName 证书文件名（不含扩展名），通配符域名的 * 写作 wildcard
+func certFileName(domain string) string {
+	return sanitizeName(strings.ReplaceAll(domain, "*", "wildcard"))
+}
+
+// SaveTo 保存证书和私钥到 dir，私钥文件权限为 0600
+func (b *CertificateBundle) SaveTo(dir string) (certPath, keyPath string, err error) {
 	// 确保存储目录存在
-	if err := os.MkdirAll(CertStorageDir, 0755); err != nil {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", "", fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
 	// 证书文件路径
-	certPath = filepath.Join(CertStorageDir, sanitizeName(b.Domain)+".crt")
-	keyPath = filepath.Join(CertStorageDir, sanitizeName(b.Domain)+".key")
+	certPath = filepath.Join(dir, certFileName(b.Domain)+".crt")
+	keyPath = filepath.Join(dir, certFileName(b.Domain)+".key")
+
+	// 先保存私钥，nginx 不会读到与私钥不匹配的新证书
+	if err := os.WriteFile(keyPath, b.PrivateKey, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write private key: %w", err)
+	}
 
 	// 保存证书
 	if err := os.WriteFile(certPath, b.Certificate, 0644); err != nil {
 		return "", "", fmt.Errorf("failed to write certificate: %w", err)
 	}
 
-	// 保存私钥（设置更严格的权限）
-	if err := os.WriteFile(keyPath, b.PrivateKey, 0600); err != nil {
-		return "", "", fmt.Errorf("failed to write private key: %w", err)
-	}
-
 	return certPath, keyPath, nil
 }
 
-// LoadFromFile 从文件加载证书
-func LoadCertificateFromFile(domain string) (*CertificateBundle, error) {
-	certPath := filepath.Join(CertStorageDir, sanitizeName(domain)+".crt")
-	keyPath := filepath.Join(CertStorageDir, sanitizeName(domain)+".key")
+// LoadCertificateFromFile 从 dir 加载 SaveTo 保存的证书
+func LoadCertificateFromFile(dir, domain string) (*CertificateBundle, error) {
+	certPath := filepath.Join(dir, certFileName(domain)+".crt")
+	keyPath := filepath.Join(dir, certFileName(domain)+".key")
 
 	// 读取证书
 	certPEM, err := os.ReadFile(certPath)
@@ -289,6 +379,8 @@ func LoadCertificateFromFile(domain string) (*CertificateBundle, error) {
 
 	return &CertificateBundle{
 		Domain:      domain,
+		Domains:     cert.DNSNames,
+		Issuer:      cert.Issuer.CommonName,
 		Certificate: certPEM,
 		PrivateKey:  keyPEM,
 		NotBefore:   cert.NotBefore,
@@ -0,0 +1,264 @@
+package website
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qwq/internal/config"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestChallengeStore_ServesTokens(t *testing.T) {
+	store := NewChallengeStore()
+	store.Put("token-1", "token-1.thumbprint")
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		store.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/.well-known/acme-challenge/token-1"); rec.Code != http.StatusOK || rec.Body.String() != "token-1.thumbprint" {
+		t.Fatalf("Expected the key authorization, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := get("/.well-known/acme-challenge/unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown token, got %d", rec.Code)
+	}
+	store.Delete("token-1")
+	if rec := get("/.well-known/acme-challenge/token-1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after the challenge is removed, got %d", rec.Code)
+	}
+}
+
+// delayedDNS 第 visibleAfter 次查询时记录才解析生效
+type delayedDNS struct {
+	DNSService
+	lookups      int
+	visibleAfter int
+}
+
+func (d *delayedDNS) VerifyDNS(ctx context.Context, domain, recordType, expectedValue string) (*DNSVerification, error) {
+	d.lookups++
+	return &DNSVerification{Domain: domain, Propagated: d.lookups >= d.visibleAfter}, nil
+}
+
+func TestDNSChallengeSolver_PresentAndCleanUp(t *testing.T) {
+	db := setupDNSTestDB(t)
+	driver, drivers := newMockDNSDriver("fake")
+	records := &delayedDNS{DNSService: NewDNSServiceWithDrivers(db, drivers), visibleAfter: 3}
+	solver := &DNSChallengeSolver{Provider: "fake", Records: records, Interval: time.Millisecond}
+	ctx := context.Background()
+
+	if err := solver.Present(ctx, "_acme-challenge.shop.example.com", "digest"); err != nil {
+		t.Fatal(err)
+	}
+	remote := driver.zones["example.com"]
+	if len(remote) != 1 || remote[0].Name != "_acme-challenge.shop" || remote[0].Type != DNSRecordTXT || remote[0].Value != "digest" {
+		t.Fatalf("Expected a TXT record in the example.com zone, got %+v", remote)
+	}
+	if records.lookups != 3 {
+		t.Errorf("Expected Present to wait until the record is visible, got %d lookups", records.lookups)
+	}
+	if saved, _ := records.ListDNSRecords(ctx, "example.com", 0, 0); len(saved) != 1 || saved[0].ProviderID != remote[0].ProviderID || !saved[0].Managed {
+		t.Fatalf("Expected the challenge record in DNS management, got %+v", saved)
+	}
+
+	if err := solver.CleanUp(ctx, "_acme-challenge.shop.example.com", "digest"); err != nil {
+		t.Fatal(err)
+	}
+	if len(driver.zones["example.com"]) != 0 {
+		t.Errorf("Expected the provider record to be deleted, got %+v", driver.zones["example.com"])
+	}
+	if saved, _ := records.ListDNSRecords(ctx, "example.com", 0, 0); len(saved) != 0 {
+		t.Errorf("Expected the challenge record to be removed, got %+v", saved)
+	}
+
+	// 记录一直不生效时超时
+	records = &delayedDNS{DNSService: NewDNSServiceWithDrivers(db, drivers), visibleAfter: 1 << 30}
+	solver = &DNSChallengeSolver{Provider: "fake", Records: records, Zone: "example.com", Timeout: 20 * time.Millisecond, Interval: time.Millisecond}
+	if err := solver.Present(ctx, "_acme-challenge.example.com", "digest"); err == nil || !strings.Contains(err.Error(), "not visible") {
+		t.Errorf("Expected a propagation timeout, got %v", err)
+	}
+}
+
+// fakeIssuer 用测试 CA 签发有效期为 validity 的证书，记录每次签发的域名
+type fakeIssuer struct {
+	validity time.Duration
+	requests [][]string
+	err      error
+}
+
+func (f *fakeIssuer) issue(ctx context.Context, domains []string, email string) (*CertificateBundle, error) {
+	f.requests = append(f.requests, domains)
+	if f.err != nil {
+		return nil, f.err
+	}
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake LE R3"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour * 365),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(f.validity),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return newCertificateBundle(domains[0], [][]byte{leafDER, caDER}, key)
+}
+
+// setupSSLTest 使用临时证书目录和内存数据库创建 SSL 服务
+func setupSSLTest(t *testing.T, issuer *fakeIssuer) (SSLService, string) {
+	t.Helper()
+	dir := t.TempDir()
+	saved := config.Current()
+	t.Cleanup(func() { config.Store(saved) })
+	config.Update(func(cfg *config.Config) {
+		cfg.ACME = config.ACMEConfig{CertDir: dir, RenewDays: 20, Email: "ops@example.com"}
+	})
+
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&SSLCert{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewSSLServiceWithIssuer(db, issuer.issue), dir
+}
+
+func TestSSLService_RequestCertificatePersistsMetadata(t *testing.T) {
+	issuer := &fakeIssuer{validity: 90 * 24 * time.Hour}
+	service, dir := setupSSLTest(t, issuer)
+	ctx := context.Background()
+
+	cert, err := service.RequestCertificate(ctx, "*.example.com", "", SSLProviderLetsEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := service.GetSSLCert(ctx, cert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != SSLStatusValid || saved.Issuer != "Fake LE R3" || len(saved.SANs) != 1 || saved.SANs[0] != "*.example.com" {
+		t.Fatalf("Expected the issuer and SANs to be stored, got %+v", saved)
+	}
+	if saved.NotBefore == nil || saved.ExpiryDate == nil || saved.ExpiryDate.Sub(*saved.NotBefore) < 89*24*time.Hour {
+		t.Errorf("Expected not_before and not_after from the certificate, got %v %v", saved.NotBefore, saved.ExpiryDate)
+	}
+	if saved.Email != "ops@example.com" || saved.RenewDaysBefore != 20 {
+		t.Errorf("Expected the acme email and renew days from config, got %q %d", saved.Email, saved.RenewDaysBefore)
+	}
+	if saved.CertPath != filepath.Join(dir, "wildcard_example_com.crt") {
+		t.Errorf("Expected the certificate under the configured dir, got %s", saved.CertPath)
+	}
+	if info, err := os.Stat(saved.KeyPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private key readable only by the owner, got %v %v", info, err)
+	}
+	if chain, _ := os.ReadFile(saved.CertPath); strings.Count(string(chain), "BEGIN CERTIFICATE") != 2 {
+		t.Errorf("Expected the full chain to be saved, got %q", chain)
+	}
+}
+
+func TestSSLService_RenewOnlyInsideWindow(t *testing.T) {
+	issuer := &fakeIssuer{validity: 90 * 24 * time.Hour}
+	service, _ := setupSSLTest(t, issuer)
+	ctx := context.Background()
+
+	cert, err := service.RequestCertificate(ctx, "example.com", "", SSLProviderLetsEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.RenewCertificate(ctx, cert.ID); !errors.Is(err, ErrRenewalNotDue) {
+		t.Fatalf("Expected a fresh certificate not to be renewed, got %v", err)
+	}
+	if results, err := RenewDue(ctx, service, nil); err != nil || len(results) != 0 {
+		t.Fatalf("Expected nothing due, got %+v %v", results, err)
+	}
+
+	// 进入续期窗口后按原证书的域名重新签发
+	issuer.validity = 10 * 24 * time.Hour
+	if _, err := service.RequestCertificate(ctx, "shop.example.com", "", SSLProviderLetsEncrypt); err != nil {
+		t.Fatal(err)
+	}
+	issuer.validity = 90 * 24 * time.Hour
+	reloads := 0
+	results, err := RenewDue(ctx, service, func(context.Context) error { reloads++; return nil })
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Expected the expiring certificate to be renewed, got %+v %v", results, err)
+	}
+	if renewed := results[0].Cert; renewed.Domain != "shop.example.com" || time.Until(*renewed.ExpiryDate) < 80*24*time.Hour {
+		t.Errorf("Expected the renewed expiry, got %+v", renewed)
+	}
+	if last := issuer.requests[len(issuer.requests)-1]; len(last) != 1 || last[0] != "shop.example.com" {
+		t.Errorf("Expected the SANs to be reissued, got %q", last)
+	}
+	if reloads != 1 {
+		t.Errorf("Expected one reload after the renewal, got %d", reloads)
+	}
+}
+
+func TestSSLService_RenewFailureKeepsCertificate(t *testing.T) {
+	issuer := &fakeIssuer{validity: 5 * 24 * time.Hour}
+	service, _ := setupSSLTest(t, issuer)
+	ctx := context.Background()
+
+	cert, err := service.RequestCertificate(ctx, "example.com", "", SSLProviderLetsEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.err = errors.New("urn:ietf:params:acme:error:rateLimited")
+	reloads := 0
+	results, err := RenewDue(ctx, service, func(context.Context) error { reloads++; return nil })
+	if err != nil || len(results) != 1 || results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "rateLimited") {
+		t.Fatalf("Expected the renewal failure in the results, got %+v %v", results, err)
+	}
+	if reloads != 0 {
+		t.Errorf("Expected no reload without a renewed certificate, got %d", reloads)
+	}
+	saved, _ := service.GetSSLCert(ctx, cert.ID)
+	if saved.Status != SSLStatusValid || saved.CertContent != cert.CertContent {
+		t.Errorf("Expected the current certificate to be kept for the next attempt, got %+v", saved)
+	}
+	if err := service.AutoRenew(ctx); err == nil || !strings.Contains(err.Error(), "example.com") {
+		t.Errorf("Expected AutoRenew to report the failed domain, got %v", err)
+	}
+}
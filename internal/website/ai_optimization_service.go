@@ -143,7 +143,7 @@ func (s *aiOptimizationService) AutoFixCommonIssues(ctx context.Context, website
 		return nil, fmt.Errorf("failed to get website: %w", err)
 	}
 
-	if website.ProxyConfig == nil {
+	if website.GetSiteType() == SiteTypeProxy && website.ProxyConfig == nil {
 		return &FixResult{
 			Success: false,
 			Message: "no proxy config found",
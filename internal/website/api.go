@@ -2,8 +2,14 @@ package website
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
+
+	"qwq/internal/apierror"
+	"qwq/internal/appstore"
+	"qwq/internal/pagination"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -17,6 +23,7 @@ type APIHandler struct {
 	sslService     SSLService            // SSL 证书服务
 	dnsService     DNSService            // DNS 管理服务
 	aiService      AIOptimizationService // AI 优化服务
+	deployer       *TemplateSiteDeployer // 从应用商店模板部署网站后端
 }
 
 // NewAPIHandler 创建 API 处理器
@@ -27,6 +34,8 @@ func NewAPIHandler(db *gorm.DB) *APIHandler {
 	sslService := NewSSLService(db)
 	dnsService := NewDNSService(db)
 	aiService := NewAIOptimizationService(db, websiteService, proxyService)
+	appStoreService := appstore.NewAppStoreService(db)
+	deployer := NewTemplateSiteDeployer(websiteService, proxyService, appStoreService, appstore.NewInstallerService(appStoreService))
 
 	return &APIHandler{
 		websiteService: websiteService,
@@ -34,6 +43,7 @@ func NewAPIHandler(db *gorm.DB) *APIHandler {
 		sslService:     sslService,
 		dnsService:     dnsService,
 		aiService:      aiService,
+		deployer:       deployer,
 	}
 }
 
@@ -91,52 +101,79 @@ func (h *APIHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 // ListWebsites 列出网站
-// 支持分页查询，返回当前用户和租户下的所有网站
+// 分页返回当前用户和租户下的网站，支持按 status、site_type 过滤
 func (h *APIHandler) ListWebsites(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	tenantID := getTenantID(r)
-	page := getQueryInt(r, "page", 1)
-	pageSize := getQueryInt(r, "pageSize", 20)
+	q, err := pagination.Parse(r.URL.Query(), websiteListSpec)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
 
-	websites, total, err := h.websiteService.ListWebsites(r.Context(), userID, tenantID, page, pageSize)
+	page, err := h.websiteService.ListWebsites(r.Context(), getUserID(r), getTenantID(r), q)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"websites": websites,
-		"total":    total,
-		"page":     page,
-		"pageSize": pageSize,
-	})
+	respondJSON(w, http.StatusOK, page)
+}
+
+// createWebsiteRequest 创建网站请求，携带 backend_template 时先从应用商店模板部署后端
+type createWebsiteRequest struct {
+	Website
+	BackendTemplate *BackendTemplate `json:"backend_template,omitempty"`
 }
 
 // CreateWebsite 创建网站
 func (h *APIHandler) CreateWebsite(w http.ResponseWriter, r *http.Request) {
-	var website Website
-	if err := json.NewDecoder(r.Body).Decode(&website); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	var req createWebsiteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
+	website := req.Website
 
 	website.UserID = getUserID(r)
 	website.TenantID = getTenantID(r)
 
+	if req.BackendTemplate != nil {
+		h.createWebsiteWithBackend(w, r, &website, req.BackendTemplate)
+		return
+	}
+
 	if err := h.websiteService.CreateWebsite(r.Context(), &website); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
 	respondJSON(w, http.StatusCreated, website)
 }
 
+// createWebsiteWithBackend 部署模板后端并创建网站，返回实例和网站 ID；失败时返回失败的阶段和已回滚的阶段
+func (h *APIHandler) createWebsiteWithBackend(w http.ResponseWriter, r *http.Request, website *Website, backend *BackendTemplate) {
+	result, err := h.deployer.Create(r.Context(), website, backend)
+	var stageErr *StageError
+	switch {
+	case err == nil:
+		respondJSON(w, http.StatusCreated, result)
+	case errors.As(err, &stageErr):
+		// 部署阶段失败：details 中返回失败阶段和回滚结果，无法归类的失败视为后端部署失败
+		apiErr := apierror.Lookup(err, websiteErrors...)
+		if apiErr.Code == apierror.CodeInternal {
+			apiErr = apierror.Wrap(http.StatusBadGateway, "BACKEND_DEPLOY_FAILED", err)
+		}
+		apierror.Write(w, r, apiErr.WithDetails(result))
+	default:
+		respondServiceError(w, r, err)
+	}
+}
+
 // GetWebsite 获取网站
 func (h *APIHandler) GetWebsite(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	website, err := h.websiteService.GetWebsite(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -148,13 +185,13 @@ func (h *APIHandler) UpdateWebsite(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	var website Website
 	if err := json.NewDecoder(r.Body).Decode(&website); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
 	website.ID = id
 	if err := h.websiteService.UpdateWebsite(r.Context(), &website); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -165,7 +202,7 @@ func (h *APIHandler) UpdateWebsite(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DeleteWebsite(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	if err := h.websiteService.DeleteWebsite(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -179,12 +216,12 @@ func (h *APIHandler) EnableSSL(w http.ResponseWriter, r *http.Request) {
 		CertID uint `json:"cert_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
 	if err := h.websiteService.EnableSSL(r.Context(), id, req.CertID); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -195,32 +232,35 @@ func (h *APIHandler) EnableSSL(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DisableSSL(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	if err := h.websiteService.DisableSSL(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "SSL disabled successfully"})
 }
 
-// ListSSLCerts 列出 SSL 证书
+// ListSSLCerts 分页列出 SSL 证书，支持按 status、domain、provider 过滤
 func (h *APIHandler) ListSSLCerts(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	tenantID := getTenantID(r)
+	q, err := pagination.Parse(r.URL.Query(), sslCertListSpec)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
 
-	certs, err := h.sslService.ListSSLCerts(r.Context(), userID, tenantID)
+	page, err := h.sslService.QuerySSLCerts(r.Context(), getUserID(r), getTenantID(r), q)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, certs)
+	respondJSON(w, http.StatusOK, page)
 }
 
 // CreateSSLCert 创建 SSL 证书记录
 func (h *APIHandler) CreateSSLCert(w http.ResponseWriter, r *http.Request) {
 	var cert SSLCert
 	if err := json.NewDecoder(r.Body).Decode(&cert); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
@@ -228,7 +268,7 @@ func (h *APIHandler) CreateSSLCert(w http.ResponseWriter, r *http.Request) {
 	cert.TenantID = getTenantID(r)
 
 	if err := h.sslService.CreateSSLCert(r.Context(), &cert); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -240,7 +280,7 @@ func (h *APIHandler) GetSSLCert(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	cert, err := h.sslService.GetSSLCert(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -252,13 +292,13 @@ func (h *APIHandler) UpdateSSLCert(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	var cert SSLCert
 	if err := json.NewDecoder(r.Body).Decode(&cert); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
 	cert.ID = id
 	if err := h.sslService.UpdateSSLCert(r.Context(), &cert); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -269,7 +309,7 @@ func (h *APIHandler) UpdateSSLCert(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DeleteSSLCert(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	if err := h.sslService.DeleteSSLCert(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -285,13 +325,13 @@ func (h *APIHandler) RequestCertificate(w http.ResponseWriter, r *http.Request)
 		Provider SSLProvider `json:"provider"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
 	cert, err := h.sslService.RequestCertificate(r.Context(), req.Domain, req.Email, req.Provider)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -305,7 +345,7 @@ func (h *APIHandler) RequestCertificate(w http.ResponseWriter, r *http.Request)
 func (h *APIHandler) RenewCertificate(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	if err := h.sslService.RenewCertificate(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -316,7 +356,7 @@ func (h *APIHandler) RenewCertificate(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) CheckExpiry(w http.ResponseWriter, r *http.Request) {
 	certs, err := h.sslService.CheckExpiry(r.Context())
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -330,7 +370,7 @@ func (h *APIHandler) ListProxyConfigs(w http.ResponseWriter, r *http.Request) {
 
 	configs, err := h.proxyService.ListProxyConfigs(r.Context(), userID, tenantID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -341,7 +381,7 @@ func (h *APIHandler) ListProxyConfigs(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) CreateProxyConfig(w http.ResponseWriter, r *http.Request) {
 	var config ProxyConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
@@ -349,7 +389,7 @@ func (h *APIHandler) CreateProxyConfig(w http.ResponseWriter, r *http.Request) {
 	config.TenantID = getTenantID(r)
 
 	if err := h.proxyService.CreateProxyConfig(r.Context(), &config); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -361,7 +401,7 @@ func (h *APIHandler) GetProxyConfig(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	config, err := h.proxyService.GetProxyConfig(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -373,13 +413,13 @@ func (h *APIHandler) UpdateProxyConfig(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	var config ProxyConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
 	config.ID = id
 	if err := h.proxyService.UpdateProxyConfig(r.Context(), &config); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -390,7 +430,7 @@ func (h *APIHandler) UpdateProxyConfig(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DeleteProxyConfig(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	if err := h.proxyService.DeleteProxyConfig(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -400,33 +440,35 @@ func (h *APIHandler) DeleteProxyConfig(w http.ResponseWriter, r *http.Request) {
 // ReloadNginx 重载 Nginx
 func (h *APIHandler) ReloadNginx(w http.ResponseWriter, r *http.Request) {
 	if err := h.proxyService.ReloadNginx(r.Context()); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Nginx reloaded successfully"})
 }
 
-// ListDNSRecords 列出 DNS 记录
+// ListDNSRecords 分页列出 DNS 记录，支持按 domain、type、provider 过滤
 func (h *APIHandler) ListDNSRecords(w http.ResponseWriter, r *http.Request) {
-	domain := r.URL.Query().Get("domain")
-	userID := getUserID(r)
-	tenantID := getTenantID(r)
+	q, err := pagination.Parse(r.URL.Query(), dnsRecordListSpec)
+	if err != nil {
+		respondServiceError(w, r, err)
+		return
+	}
 
-	records, err := h.dnsService.ListDNSRecords(r.Context(), domain, userID, tenantID)
+	page, err := h.dnsService.QueryDNSRecords(r.Context(), getUserID(r), getTenantID(r), q)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, records)
+	respondJSON(w, http.StatusOK, page)
 }
 
 // CreateDNSRecord 创建 DNS 记录
 func (h *APIHandler) CreateDNSRecord(w http.ResponseWriter, r *http.Request) {
 	var record DNSRecord
 	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
@@ -434,7 +476,7 @@ func (h *APIHandler) CreateDNSRecord(w http.ResponseWriter, r *http.Request) {
 	record.TenantID = getTenantID(r)
 
 	if err := h.dnsService.CreateDNSRecord(r.Context(), &record); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -446,7 +488,7 @@ func (h *APIHandler) GetDNSRecord(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	record, err := h.dnsService.GetDNSRecord(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -458,13 +500,13 @@ func (h *APIHandler) UpdateDNSRecord(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	var record DNSRecord
 	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
 	record.ID = id
 	if err := h.dnsService.UpdateDNSRecord(r.Context(), &record); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -475,7 +517,7 @@ func (h *APIHandler) UpdateDNSRecord(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DeleteDNSRecord(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	if err := h.dnsService.DeleteDNSRecord(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -483,45 +525,58 @@ func (h *APIHandler) DeleteDNSRecord(w http.ResponseWriter, r *http.Request) {
 }
 
 // VerifyDNS 验证 DNS 解析
-// 检查域名的 DNS 记录是否已正确解析到期望值
+// 在配置的各个解析器上检查域名的 DNS 记录是否已正确解析到期望值；
+// wait 为 true（请求体或查询参数）时轮询到全部生效或超时（timeout 秒，默认取配置），返回生效用时
 func (h *APIHandler) VerifyDNS(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Domain        string `json:"domain"`
 		RecordType    string `json:"record_type"`
 		ExpectedValue string `json:"expected_value"`
+		Wait          bool   `json:"wait"`
+		Timeout       int    `json:"timeout"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
+	if r.URL.Query().Get("wait") == "true" {
+		req.Wait = true
+	}
 
-	verified, err := h.dnsService.VerifyDNS(r.Context(), req.Domain, req.RecordType, req.ExpectedValue)
+	var verification *DNSVerification
+	var err error
+	if req.Wait {
+		verification, err = h.dnsService.WaitDNSPropagation(r.Context(), req.Domain, req.RecordType, req.ExpectedValue, time.Duration(req.Timeout)*time.Second)
+	} else {
+		verification, err = h.dnsService.VerifyDNS(r.Context(), req.Domain, req.RecordType, req.ExpectedValue)
+	}
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]bool{"verified": verified})
+	respondJSON(w, http.StatusOK, verification)
 }
 
 // SyncWithProvider 与 DNS 提供商同步
-// 从云服务商（阿里云、腾讯云等）同步 DNS 记录到本地数据库
+// 与云服务商（阿里云、Cloudflare）双向同步 DNS 记录，返回导入、推送的记录和冲突
 func (h *APIHandler) SyncWithProvider(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Domain   string `json:"domain"`
 		Provider string `json:"provider"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondServiceError(w, r, errInvalidBody)
 		return
 	}
 
-	if err := h.dnsService.SyncWithProvider(r.Context(), req.Domain, req.Provider); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	result, err := h.dnsService.SyncWithProvider(r.Context(), req.Domain, req.Provider, getUserID(r), getTenantID(r))
+	if err != nil {
+		respondServiceError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "DNS records synced successfully"})
+	respondJSON(w, http.StatusOK, result)
 }
 
 // AnalyzeWebsiteConfig 分析网站配置
@@ -529,7 +584,7 @@ func (h *APIHandler) AnalyzeWebsiteConfig(w http.ResponseWriter, r *http.Request
 	id := getIDFromPath(r)
 	analysis, err := h.aiService.AnalyzeWebsiteConfig(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -541,7 +596,7 @@ func (h *APIHandler) GenerateOptimizations(w http.ResponseWriter, r *http.Reques
 	id := getIDFromPath(r)
 	suggestions, err := h.aiService.GenerateOptimizationSuggestions(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -553,7 +608,7 @@ func (h *APIHandler) AutoFixIssues(w http.ResponseWriter, r *http.Request) {
 	id := getIDFromPath(r)
 	result, err := h.aiService.AutoFixCommonIssues(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -565,7 +620,7 @@ func (h *APIHandler) AnalyzePerformance(w http.ResponseWriter, r *http.Request)
 	id := getIDFromPath(r)
 	analysis, err := h.aiService.AnalyzePerformance(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondServiceError(w, r, err)
 		return
 	}
 
@@ -581,9 +636,61 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// respondError 返回错误响应
-func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+// websiteErrors 网站服务错误到 API 错误码的映射，包含部署模板后端时的应用商店错误
+var websiteErrors = append([]apierror.Mapping{
+	{Err: ErrWebsiteNotFound, Status: http.StatusNotFound, Code: "WEBSITE_NOT_FOUND"},
+	{Err: ErrWebsiteExists, Status: http.StatusConflict, Code: "WEBSITE_DOMAIN_EXISTS"},
+	{Err: ErrInvalidDomain, Status: http.StatusBadRequest, Code: "WEBSITE_INVALID_DOMAIN"},
+	{Err: ErrInvalidSiteType, Status: http.StatusBadRequest, Code: "WEBSITE_INVALID_SITE_TYPE"},
+	{Err: ErrInvalidDocRoot, Status: http.StatusBadRequest, Code: "WEBSITE_INVALID_DOC_ROOT"},
+	{Err: ErrInvalidRedirect, Status: http.StatusBadRequest, Code: "WEBSITE_INVALID_REDIRECT"},
+	{Err: ErrInvalidBackend, Status: http.StatusBadRequest, Code: "PROXY_INVALID_BACKEND"},
+	{Err: ErrInvalidAccessRule, Status: http.StatusBadRequest, Code: "PROXY_INVALID_ACCESS_RULE"},
+	{Err: ErrProxyConfigNotFound, Status: http.StatusNotFound, Code: "PROXY_CONFIG_NOT_FOUND"},
+	{Err: ErrSSLCertNotFound, Status: http.StatusNotFound, Code: "SSL_CERT_NOT_FOUND"},
+	{Err: ErrSSLCertExpired, Status: http.StatusConflict, Code: "SSL_CERT_EXPIRED"},
+	{Err: ErrRenewalNotDue, Status: http.StatusConflict, Code: "SSL_RENEWAL_NOT_DUE"},
+	{Err: ErrDNSRecordNotFound, Status: http.StatusNotFound, Code: "DNS_RECORD_NOT_FOUND"},
+	{Err: ErrUnsupportedRecordType, Status: http.StatusBadRequest, Code: "DNS_UNSUPPORTED_RECORD_TYPE"},
+	{Err: ErrDNSProviderUnsupported, Status: http.StatusBadRequest, Code: "DNS_PROVIDER_UNSUPPORTED"},
+	{Err: ErrDNSProviderNotConfigured, Status: http.StatusBadRequest, Code: "DNS_PROVIDER_NOT_CONFIGURED"},
+	{Err: ErrDNSProviderRequest, Status: http.StatusBadGateway, Code: "DNS_PROVIDER_ERROR"},
+	{Err: ErrDriftImport, Status: http.StatusConflict, Code: "DRIFT_IMPORT_UNSUPPORTED"},
+	{Err: ErrBackendNotRunning, Status: http.StatusBadGateway, Code: "BACKEND_NOT_RUNNING"},
+	{Err: ErrNoPublishedPort, Status: http.StatusUnprocessableEntity, Code: "BACKEND_NO_PUBLISHED_PORT"},
+	{Err: gorm.ErrRecordNotFound, Status: http.StatusNotFound, Code: apierror.CodeNotFound},
+}, appstore.ErrorMappings...)
+
+// 列表接口允许的排序字段和过滤参数，默认按创建时间倒序
+var (
+	websiteListSpec = pagination.Spec{
+		Sort:        map[string]string{"id": "id", "name": "name", "domain": "domain", "status": "status", "created_at": "created_at", "updated_at": "updated_at"},
+		DefaultSort: "-created_at",
+		Filters:     map[string]string{"status": "status", "site_type": "site_type"},
+	}
+	sslCertListSpec = pagination.Spec{
+		Sort:        map[string]string{"id": "id", "domain": "domain", "status": "status", "expiry_date": "expiry_date", "created_at": "created_at"},
+		DefaultSort: "-created_at",
+		Filters:     map[string]string{"status": "status", "domain": "domain", "provider": "provider"},
+	}
+	dnsRecordListSpec = pagination.Spec{
+		Sort:        map[string]string{"id": "id", "domain": "domain", "name": "name", "type": "type", "created_at": "created_at"},
+		DefaultSort: "-created_at",
+		Filters:     map[string]string{"domain": "domain", "type": "type", "provider": "provider"},
+	}
+)
+
+// errInvalidBody 请求体不是合法的 JSON
+var errInvalidBody = apierror.New(http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+
+// respondServiceError 返回统一的错误响应，访问控制校验错误在 details 中附带字段级错误
+func respondServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var ruleErr *AccessRuleError
+	if errors.As(err, &ruleErr) {
+		apiErr := apierror.Wrap(http.StatusBadRequest, "PROXY_INVALID_ACCESS_RULE", err)
+		err = apiErr.WithDetails(map[string]interface{}{"fields": ruleErr.Fields})
+	}
+	apierror.Write(w, r, err, websiteErrors...)
 }
 
 // getIDFromPath 从路径参数中提取 ID
@@ -604,16 +711,3 @@ func getUserID(r *http.Request) uint {
 func getTenantID(r *http.Request) uint {
 	return 1
 }
-
-// getQueryInt 从查询参数中获取整数值，支持默认值
-func getQueryInt(r *http.Request, key string, defaultValue int) int {
-	value := r.URL.Query().Get(key)
-	if value == "" {
-		return defaultValue
-	}
-	intValue, err := strconv.Atoi(value)
-	if err != nil {
-		return defaultValue
-	}
-	return intValue
-}
@@ -0,0 +1,179 @@
+package website
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"qwq/internal/apierror"
+	"qwq/internal/pagination"
+
+	"github.com/gorilla/mux"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// stubWebsiteService 返回固定错误的网站服务
+type stubWebsiteService struct {
+	WebsiteService
+	err error
+}
+
+func (s *stubWebsiteService) GetWebsite(ctx context.Context, id uint) (*Website, error) {
+	return nil, s.err
+}
+
+func (s *stubWebsiteService) CreateWebsite(ctx context.Context, website *Website) error {
+	return s.err
+}
+
+// stubProxyService 返回固定错误的代理服务
+type stubProxyService struct {
+	ProxyService
+	err error
+}
+
+func (s *stubProxyService) CreateProxyConfig(ctx context.Context, config *ProxyConfig) error {
+	return s.err
+}
+
+func serveAPI(handler http.HandlerFunc, method, body string) (*httptest.ResponseRecorder, apierror.Envelope) {
+	req := mux.SetURLVars(httptest.NewRequest(method, "/api/websites/1", strings.NewReader(body)), map[string]string{"id": "1"})
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	var envelope apierror.Envelope
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	return rec, envelope
+}
+
+func TestAPIHandler_ErrorEnvelope(t *testing.T) {
+	websites := &stubWebsiteService{}
+	proxies := &stubProxyService{}
+	h := &APIHandler{websiteService: websites, proxyService: proxies}
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		err     error
+		status  int
+		code    string
+	}{
+		{"not found", h.GetWebsite, http.MethodGet, fmt.Errorf("%w: 1", ErrWebsiteNotFound), http.StatusNotFound, "WEBSITE_NOT_FOUND"},
+		{"duplicate domain", h.CreateWebsite, http.MethodPost, ErrWebsiteExists, http.StatusConflict, "WEBSITE_DOMAIN_EXISTS"},
+		{"invalid domain", h.CreateWebsite, http.MethodPost, fmt.Errorf("%w: a..b", ErrInvalidDomain), http.StatusBadRequest, "WEBSITE_INVALID_DOMAIN"},
+		{"unknown", h.CreateWebsite, http.MethodPost, errors.New("database is locked"), http.StatusInternalServerError, apierror.CodeInternal},
+	}
+	for _, tc := range cases {
+		websites.err = tc.err
+		rec, envelope := serveAPI(tc.handler, tc.method, `{"domain":"example.com"}`)
+		if rec.Code != tc.status || envelope.Code != tc.code || envelope.RequestID == "" {
+			t.Errorf("%s: expected %d %s, got %d %+v", tc.name, tc.status, tc.code, rec.Code, envelope)
+		}
+		if tc.code == apierror.CodeInternal && strings.Contains(envelope.Message, "database") {
+			t.Errorf("%s: internal details leaked: %q", tc.name, envelope.Message)
+		}
+	}
+
+	if rec, envelope := serveAPI(h.CreateWebsite, http.MethodPost, `{`); rec.Code != http.StatusBadRequest || envelope.Code != "INVALID_REQUEST_BODY" {
+		t.Errorf("Expected INVALID_REQUEST_BODY, got %d %+v", rec.Code, envelope)
+	}
+
+	proxies.err = &AccessRuleError{Fields: []FieldError{{Field: "access.ip_allow[0]", Message: "invalid CIDR"}}}
+	rec, envelope := serveAPI(h.CreateProxyConfig, http.MethodPost, `{}`)
+	details, _ := envelope.Details.(map[string]interface{})
+	fields, _ := details["fields"].([]interface{})
+	if rec.Code != http.StatusBadRequest || envelope.Code != "PROXY_INVALID_ACCESS_RULE" || len(fields) != 1 {
+		t.Errorf("Expected field errors in details, got %d %+v", rec.Code, envelope)
+	}
+}
+
+// listPage 分页响应，条目只解析 id
+type listPage struct {
+	Items []struct {
+		ID uint `json:"id"`
+	} `json:"items"`
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"pageSize"`
+}
+
+func TestAPIHandler_ListPagination(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Website{}, &ProxyConfig{}, &SSLCert{}, &DNSRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		status := StatusActive
+		if i > 3 {
+			status = StatusInactive
+		}
+		domain := fmt.Sprintf("site%d.example.com", i)
+		db.Create(&Website{Name: fmt.Sprintf("site%d", i), Domain: domain, Status: status, UserID: 1, TenantID: 1})
+		db.Create(&SSLCert{Domain: domain, Provider: SSLProviderLetsEncrypt, Status: SSLStatusValid, UserID: 1, TenantID: 1})
+		db.Create(&DNSRecord{Domain: "example.com", Type: DNSRecordA, Name: fmt.Sprintf("site%d", i), Value: "10.0.0.1", UserID: 1, TenantID: 1})
+	}
+	// 其他租户的记录不会出现在列表中
+	db.Create(&DNSRecord{Domain: "other.com", Type: DNSRecordA, Name: "www", Value: "10.0.0.2", UserID: 2, TenantID: 2})
+
+	router := mux.NewRouter()
+	NewAPIHandler(db).RegisterRoutes(router)
+	get := func(path string) (*httptest.ResponseRecorder, listPage) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var page listPage
+		json.Unmarshal(rec.Body.Bytes(), &page)
+		return rec, page
+	}
+
+	for _, base := range []string{"/api/v1/websites", "/api/v1/ssl/certs", "/api/v1/dns/records"} {
+		rec, page := get(base)
+		if rec.Code != http.StatusOK || page.Total != 5 || len(page.Items) != 5 || page.Page != 1 || page.PageSize != pagination.DefaultPageSize {
+			t.Errorf("%s: expected the first page with the default size, got %d %+v", base, rec.Code, page)
+		}
+		// 按 id 升序时最后一页只有剩余的一条
+		rec, page = get(base + "?page=3&pageSize=2&sort=id")
+		if rec.Code != http.StatusOK || len(page.Items) != 1 || page.Items[0].ID != 5 || page.Total != 5 {
+			t.Errorf("%s: expected the last partial page, got %d %+v", base, rec.Code, page)
+		}
+		rec, page = get(base + "?page=4&pageSize=2")
+		if rec.Code != http.StatusOK || page.Items == nil || len(page.Items) != 0 || page.Total != 5 {
+			t.Errorf("%s: expected an empty page past the end, got %d %+v", base, rec.Code, page)
+		}
+		rec, _ = get(base + "?page=0")
+		if envelope := decodeListError(rec); rec.Code != http.StatusBadRequest || envelope.Code != pagination.CodeInvalidPagination {
+			t.Errorf("%s: expected INVALID_PAGINATION, got %d %+v", base, rec.Code, envelope)
+		}
+		rec, _ = get(base + "?sort=-user_id")
+		if envelope := decodeListError(rec); rec.Code != http.StatusBadRequest || envelope.Code != pagination.CodeInvalidSort {
+			t.Errorf("%s: expected INVALID_SORT_FIELD, got %d %+v", base, rec.Code, envelope)
+		}
+	}
+
+	if _, page := get("/api/v1/websites?status=inactive&sort=-id"); page.Total != 2 || page.Items[0].ID != 5 {
+		t.Errorf("Expected inactive websites newest first, got %+v", page)
+	}
+	if _, page := get("/api/v1/dns/records?domain=other.com"); page.Total != 0 {
+		t.Errorf("Expected other tenants' records to be hidden, got %+v", page)
+	}
+}
+
+func decodeListError(rec *httptest.ResponseRecorder) apierror.Envelope {
+	var envelope apierror.Envelope
+	json.Unmarshal(rec.Body.Bytes(), &envelope)
+	return envelope
+}
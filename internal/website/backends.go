@@ -0,0 +1,175 @@
+package website
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 后端服务器参数上限，与 nginx 的合理取值范围保持一致
+const (
+	maxBackendWeight = 1000
+	maxBackendFails  = 100
+	maxFailTimeout   = 3600
+)
+
+// BackendServer upstream 中的一个后端服务器
+type BackendServer struct {
+	URL         string `json:"url"`                    // 后端地址，如 http://10.0.0.1:8080
+	Weight      int    `json:"weight,omitempty"`       // 权重，0 表示使用 nginx 默认值 1
+	Backup      bool   `json:"backup,omitempty"`       // 备用服务器，只在所有主服务器不可用时接收流量
+	MaxFails    int    `json:"max_fails,omitempty"`    // 失败次数阈值，0 表示按健康检查配置
+	FailTimeout int    `json:"fail_timeout,omitempty"` // 失败判定窗口和摘除时长（秒），0 表示按健康检查配置
+}
+
+// hostPort upstream server 指令使用的地址（去掉协议和路径）
+func (b BackendServer) hostPort() string {
+	if u, err := url.Parse(b.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return b.URL
+}
+
+// scheme 后端协议，未写协议时为 http
+func (b BackendServer) scheme() string {
+	if u, err := url.Parse(b.URL); err == nil && u.Host != "" && u.Scheme != "" {
+		return u.Scheme
+	}
+	return "http"
+}
+
+// parseLegacyBackend 解析旧格式的 Backend 字段：单个地址、地址的 JSON 数组或 BackendServer 的 JSON 数组
+func parseLegacyBackend(backend string) ([]BackendServer, error) {
+	backend = strings.TrimSpace(backend)
+	if backend == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(backend, "[") {
+		return []BackendServer{{URL: backend}}, nil
+	}
+
+	var urls []string
+	if err := json.Unmarshal([]byte(backend), &urls); err == nil {
+		servers := make([]BackendServer, 0, len(urls))
+		for _, u := range urls {
+			servers = append(servers, BackendServer{URL: u})
+		}
+		return servers, nil
+	}
+	var servers []BackendServer
+	if err := json.Unmarshal([]byte(backend), &servers); err != nil {
+		return nil, fmt.Errorf("%w: backend must be an address or a JSON array", ErrInvalidBackend)
+	}
+	return servers, nil
+}
+
+// Servers 返回后端服务器列表，未迁移的旧格式配置从 Backend 字段解析
+func (c *ProxyConfig) Servers() []BackendServer {
+	if len(c.Backends) > 0 {
+		return c.Backends
+	}
+	servers, _ := parseLegacyBackend(c.Backend)
+	return servers
+}
+
+// usesUpstream 是否需要生成 upstream 块：多个后端，或单个后端设置了权重、备用或失败参数
+func (c *ProxyConfig) usesUpstream() bool {
+	servers := c.Servers()
+	if len(servers) > 1 {
+		return true
+	}
+	return len(servers) == 1 && (servers[0].Weight > 0 || servers[0].MaxFails > 0 || servers[0].FailTimeout > 0)
+}
+
+// AfterFind 读取旧格式的记录时在内存中迁移到 Backends，保存时写回新格式
+func (c *ProxyConfig) AfterFind(tx *gorm.DB) error {
+	if len(c.Backends) == 0 && c.Backend != "" {
+		if servers, err := parseLegacyBackend(c.Backend); err == nil {
+			c.Backends = servers
+			c.Backend = ""
+		}
+	}
+	return nil
+}
+
+// prepareBackends 将旧格式的 Backend 迁移到 Backends 并校验每个后端服务器
+func prepareBackends(config *ProxyConfig) error {
+	if len(config.Backends) == 0 {
+		servers, err := parseLegacyBackend(config.Backend)
+		if err != nil {
+			return err
+		}
+		config.Backends = servers
+	}
+	config.Backend = ""
+	return validateBackends(config)
+}
+
+// ValidateBackends 校验代理配置的后端服务器，供不经过 ProxyService 保存、直接生成 nginx 配置的调用方使用
+func ValidateBackends(config *ProxyConfig) error {
+	return validateBackends(config)
+}
+
+// validateBackends 校验后端服务器列表
+// ip_hash 不支持 backup，且至少需要一个主服务器
+func validateBackends(config *ProxyConfig) error {
+	servers := config.Servers()
+	if len(servers) == 0 {
+		return fmt.Errorf("%w: at least one backend is required", ErrInvalidBackend)
+	}
+
+	primaries := 0
+	for i, server := range servers {
+		field := fmt.Sprintf("backends[%d]", i)
+		if err := checkNginxValue(server.URL, ErrInvalidBackend); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		u, err := url.Parse(server.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%w: %s: invalid url %q, expected scheme://host[:port]", ErrInvalidBackend, field, server.URL)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("%w: %s: scheme must be http or https", ErrInvalidBackend, field)
+		}
+		if server.Weight < 0 || server.Weight > maxBackendWeight {
+			return fmt.Errorf("%w: %s: weight must be between 1 and %d", ErrInvalidBackend, field, maxBackendWeight)
+		}
+		if server.MaxFails < 0 || server.MaxFails > maxBackendFails {
+			return fmt.Errorf("%w: %s: max_fails must be between 0 and %d", ErrInvalidBackend, field, maxBackendFails)
+		}
+		if server.FailTimeout < 0 || server.FailTimeout > maxFailTimeout {
+			return fmt.Errorf("%w: %s: fail_timeout must be between 0 and %d seconds", ErrInvalidBackend, field, maxFailTimeout)
+		}
+		if server.Backup {
+			if config.LoadBalanceMethod == LoadBalanceIPHash {
+				return fmt.Errorf("%w: %s: backup servers cannot be used with ip_hash", ErrInvalidBackend, field)
+			}
+			continue
+		}
+		primaries++
+	}
+	if primaries == 0 {
+		return fmt.Errorf("%w: at least one non-backup backend is required", ErrInvalidBackend)
+	}
+	return nil
+}
+
+// MigrateProxyBackends 将数据库中旧格式（Backend 字符串或 JSON 数组）的代理配置写回为 Backends，返回迁移的记录数
+func MigrateProxyBackends(db *gorm.DB) (int, error) {
+	var configs []*ProxyConfig
+	if err := db.Where("backend <> ?", "").Find(&configs).Error; err != nil {
+		return 0, fmt.Errorf("failed to list proxy configs: %w", err)
+	}
+	migrated := 0
+	for _, config := range configs {
+		// AfterFind 已在内存中完成转换，只需写回
+		if err := db.Model(config).Select("backend", "backends").Updates(config).Error; err != nil {
+			return migrated, fmt.Errorf("failed to migrate proxy config %d: %w", config.ID, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
@@ -0,0 +1,92 @@
+package website
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func TestValidateBackends(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ProxyConfig
+		wantErr bool
+	}{
+		{"legacy single", ProxyConfig{Backend: "http://127.0.0.1:8080"}, false},
+		{"weighted with backup", ProxyConfig{LoadBalanceMethod: LoadBalanceWeighted, Backends: []BackendServer{
+			{URL: "http://a:80", Weight: 5}, {URL: "http://b:80", Backup: true, MaxFails: 2, FailTimeout: 10},
+		}}, false},
+		{"empty", ProxyConfig{}, true},
+		{"only backups", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80", Backup: true}}}, true},
+		{"backup with ip_hash", ProxyConfig{LoadBalanceMethod: LoadBalanceIPHash, Backends: []BackendServer{
+			{URL: "http://a:80"}, {URL: "http://b:80", Backup: true},
+		}}, true},
+		{"negative weight", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80", Weight: -1}}}, true},
+		{"injection", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80; include /etc/passwd"}}}, true},
+		{"bad scheme", ProxyConfig{Backends: []BackendServer{{URL: "ftp://a:21"}}}, true},
+		{"comment", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80#"}}}, true},
+		{"double quote", ProxyConfig{Backends: []BackendServer{{URL: `http://a:80/"x`}}}, true},
+		{"single quote", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80/'x"}}}, true},
+		{"variable", ProxyConfig{Backends: []BackendServer{{URL: "http://$host:80"}}}, true},
+		{"backslash", ProxyConfig{Backends: []BackendServer{{URL: `http://a:80\x`}}}, true},
+		{"control character", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80\x00"}}}, true},
+		{"carriage return", ProxyConfig{Backends: []BackendServer{{URL: "http://a:80\r"}}}, true},
+		{"no host", ProxyConfig{Backends: []BackendServer{{URL: "http:///path"}}}, true},
+		{"no scheme", ProxyConfig{Backends: []BackendServer{{URL: "a:80"}}}, true},
+		{"unparseable", ProxyConfig{Backends: []BackendServer{{URL: "http://a:port"}}}, true},
+		{"bad legacy json", ProxyConfig{Backend: `["http://a:80"`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			err := prepareBackends(&config)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidBackend) {
+				t.Errorf("Expected ErrInvalidBackend, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateProxyBackends(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&ProxyConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟旧版本写入的记录
+	if err := db.Exec(`INSERT INTO proxy_configs (name, backend, user_id, tenant_id) VALUES (?, ?, 1, 1), (?, ?, 1, 1)`,
+		"single", "http://127.0.0.1:3000", "multi", `["http://10.0.0.1:80","http://10.0.0.2:80"]`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded ProxyConfig
+	if err := db.Where("name = ?", "multi").First(&loaded).Error; err != nil || len(loaded.Backends) != 2 || loaded.Backend != "" {
+		t.Fatalf("Expected legacy record converted on read, got %+v %v", loaded, err)
+	}
+
+	migrated, err := MigrateProxyBackends(db)
+	if err != nil || migrated != 2 {
+		t.Fatalf("MigrateProxyBackends: %d %v", migrated, err)
+	}
+	var legacyLeft int64
+	db.Model(&ProxyConfig{}).Where("backend <> ?", "").Count(&legacyLeft)
+	var raw string
+	db.Raw("SELECT backends FROM proxy_configs WHERE name = ?", "single").Scan(&raw)
+	if legacyLeft != 0 || raw != `[{"url":"http://127.0.0.1:3000"}]` {
+		t.Errorf("Expected records rewritten in the new format, got %d legacy, %s", legacyLeft, raw)
+	}
+}
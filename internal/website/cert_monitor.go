@@ -53,52 +53,17 @@ func (m *CertMonitor) Stop() {
 
 // checkAndRenew 检查并续期证书
 func (m *CertMonitor) checkAndRenew(ctx context.Context) {
-	// 获取即将过期的证书
-	certs, err := m.sslService.CheckExpiry(ctx)
-	if err != nil {
-		fmt.Printf("failed to check certificate expiry: %v\n", err)
-		return
-	}
-
-	if len(certs) == 0 {
-		return
-	}
-
-	fmt.Printf("found %d certificates that need renewal\n", len(certs))
-
-	// 续期证书
-	for _, cert := range certs {
-		if err := m.renewCertificate(ctx, cert); err != nil {
-			fmt.Printf("failed to renew certificate %d (%s): %v\n", cert.ID, cert.Domain, err)
+	results, err := RenewDue(ctx, m.sslService, func(context.Context) error { return reloadNginx() })
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("failed to renew certificate %d (%s): %v\n", result.Cert.ID, result.Cert.Domain, result.Err)
 			continue
 		}
-		fmt.Printf("successfully renewed certificate %d (%s)\n", cert.ID, cert.Domain)
-	}
-}
-
-// renewCertificate 续期单个证书
-func (m *CertMonitor) renewCertificate(ctx context.Context, cert *SSLCert) error {
-	// 检查是否需要续期
-	if cert.ExpiryDate == nil {
-		return fmt.Errorf("certificate has no expiry date")
-	}
-
-	daysUntilExpiry := int(time.Until(*cert.ExpiryDate).Hours() / 24)
-	if daysUntilExpiry > cert.RenewDaysBefore {
-		return nil // 还不需要续期
-	}
-
-	// 执行续期
-	if err := m.sslService.RenewCertificate(ctx, cert.ID); err != nil {
-		return err
+		fmt.Printf("successfully renewed certificate %d (%s)\n", result.Cert.ID, result.Cert.Domain)
 	}
-
-	// 重载 Nginx 以应用新证书
-	if err := reloadNginx(); err != nil {
-		fmt.Printf("warning: failed to reload nginx after certificate renewal: %v\n", err)
+	if err != nil {
+		fmt.Printf("warning: %v\n", err)
 	}
-
-	return nil
 }
 
 // GetExpiringCertificates 获取即将过期的证书列表
@@ -2,205 +2,232 @@ package website
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// AliyunDNSProvider 阿里云 DNS 提供商
+// aliyunPageSize DescribeDomainRecords 每页的记录数（最大 500）
+const aliyunPageSize = 500
+
+// AliyunDNSProvider 阿里云云解析 DNS 提供商，使用 AccessKey 签名调用 RPC 风格的 API（版本 2015-01-09）
 type AliyunDNSProvider struct {
 	accessKeyID     string
 	accessKeySecret string
-	region          string
+	endpoint        string
+	client          *http.Client
+	now             func() time.Time // 签名使用的时间，测试中替换
 }
 
 // NewAliyunDNSProvider 创建阿里云 DNS 提供商
 func NewAliyunDNSProvider(config *DNSProviderConfig) (*AliyunDNSProvider, error) {
 	if config.AccessKeyID == "" || config.AccessKeySecret == "" {
-		return nil, fmt.Errorf("access key id and secret are required")
+		return nil, fmt.Errorf("%w: aliyun access key id and secret are required", ErrDNSProviderNotConfigured)
 	}
 
-	region := config.Region
-	if region == "" {
-		region = "cn-hangzhou" // 默认区域
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://alidns.aliyuncs.com"
+		if config.Region != "" {
+			endpoint = "https://alidns." + config.Region + ".aliyuncs.com"
+		}
 	}
 
 	return &AliyunDNSProvider{
 		accessKeyID:     config.AccessKeyID,
 		accessKeySecret: config.AccessKeySecret,
-		region:          region,
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		client:          config.httpClient(),
+		now:             time.Now,
 	}, nil
 }
 
-// AddRecord 添加 DNS 记录
-func (p *AliyunDNSProvider) AddRecord(ctx context.Context, record *DNSRecord) (string, error) {
-	// TODO: 实现阿里云 DNS API 调用
-	// 这里需要集成阿里云 SDK
-	// 示例代码框架：
-	/*
-		client, err := alidns.NewClientWithAccessKey(p.region, p.accessKeyID, p.accessKeySecret)
-		if err != nil {
-			return "", fmt.Errorf("failed to create aliyun client: %w", err)
-		}
+// aliyunEscape 阿里云签名要求的 URL 编码：空格为 %20，* 为 %2A，~ 不编码
+func aliyunEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
 
-		request := alidns.CreateAddDomainRecordRequest()
-		request.DomainName = record.Domain
-		request.RR = record.Name
-		request.Type = string(record.Type)
-		request.Value = record.Value
-		request.TTL = requests.NewInteger(record.TTL)
-		if record.Priority > 0 {
-			request.Priority = requests.NewInteger(record.Priority)
-		}
+// aliyunSignature 计算 GET 请求的签名（SignatureVersion 1.0，HMAC-SHA1）
+func aliyunSignature(params map[string]string, secret string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, aliyunEscape(key)+"="+aliyunEscape(params[key]))
+	}
+	stringToSign := "GET&" + aliyunEscape("/") + "&" + aliyunEscape(strings.Join(pairs, "&"))
 
-		response, err := client.AddDomainRecord(request)
-		if err != nil {
-			return "", fmt.Errorf("failed to add dns record: %w", err)
-		}
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
 
-		return response.RecordId, nil
-	*/
+// call 调用 API，params 为接口参数，result 非空时解析 JSON 响应
+func (p *AliyunDNSProvider) call(ctx context.Context, action string, params map[string]string, result interface{}) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	query := map[string]string{
+		"Action":           action,
+		"Format":           "JSON",
+		"Version":          "2015-01-09",
+		"AccessKeyId":      p.accessKeyID,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"Timestamp":        p.now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for key, value := range params {
+		query[key] = value
+	}
+	values := url.Values{}
+	for key, value := range query {
+		values.Set(key, value)
+	}
+	values.Set("Signature", aliyunSignature(query, p.accessKeySecret))
 
-	// 暂时返回模拟的记录 ID
-	return fmt.Sprintf("aliyun-%s-%s", record.Domain, record.Name), nil
-}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+"/?"+values.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: aliyun %s: %v", ErrDNSProviderRequest, action, err)
+	}
+	defer resp.Body.Close()
 
-// UpdateRecord 更新 DNS 记录
-func (p *AliyunDNSProvider) UpdateRecord(ctx context.Context, record *DNSRecord) error {
-	// TODO: 实现阿里云 DNS API 调用
-	// 示例代码框架：
-	/*
-		client, err := alidns.NewClientWithAccessKey(p.region, p.accessKeyID, p.accessKeySecret)
-		if err != nil {
-			return fmt.Errorf("failed to create aliyun client: %w", err)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("%w: aliyun %s: %v", ErrDNSProviderRequest, action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
 		}
-
-		request := alidns.CreateUpdateDomainRecordRequest()
-		request.RecordId = record.ProviderID
-		request.RR = record.Name
-		request.Type = string(record.Type)
-		request.Value = record.Value
-		request.TTL = requests.NewInteger(record.TTL)
-		if record.Priority > 0 {
-			request.Priority = requests.NewInteger(record.Priority)
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("%w: aliyun %s: %s %s", ErrDNSProviderRequest, action, apiErr.Code, apiErr.Message)
 		}
-
-		_, err = client.UpdateDomainRecord(request)
-		if err != nil {
-			return fmt.Errorf("failed to update dns record: %w", err)
+		return fmt.Errorf("%w: aliyun %s: %s", ErrDNSProviderRequest, action, resp.Status)
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("%w: aliyun %s: invalid response: %v", ErrDNSProviderRequest, action, err)
 		}
-
-		return nil
-	*/
-
+	}
 	return nil
 }
 
-// DeleteRecord 删除 DNS 记录
-func (p *AliyunDNSProvider) DeleteRecord(ctx context.Context, providerID string) error {
-	// TODO: 实现阿里云 DNS API 调用
-	// 示例代码框架：
-	/*
-		client, err := alidns.NewClientWithAccessKey(p.region, p.accessKeyID, p.accessKeySecret)
-		if err != nil {
-			return fmt.Errorf("failed to create aliyun client: %w", err)
-		}
-
-		request := alidns.CreateDeleteDomainRecordRequest()
-		request.RecordId = providerID
-
-		_, err = client.DeleteDomainRecord(request)
-		if err != nil {
-			return fmt.Errorf("failed to delete dns record: %w", err)
-		}
-
-		return nil
-	*/
-
-	return nil
+// aliyunRecord 阿里云的解析记录
+type aliyunRecord struct {
+	RecordID string `json:"RecordId"`
+	RR       string `json:"RR"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+	Priority int    `json:"Priority"`
 }
 
-// GetRecord 获取 DNS 记录
-func (p *AliyunDNSProvider) GetRecord(ctx context.Context, providerID string) (*DNSRecord, error) {
-	// TODO: 实现阿里云 DNS API 调用
-	// 示例代码框架：
-	/*
-		client, err := alidns.NewClientWithAccessKey(p.region, p.accessKeyID, p.accessKeySecret)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create aliyun client: %w", err)
+// ListRecords 分页列出 zone 下的全部解析记录
+func (p *AliyunDNSProvider) ListRecords(ctx context.Context, zone string) ([]*DNSRecord, error) {
+	var records []*DNSRecord
+	for page := 1; ; page++ {
+		var result struct {
+			TotalCount    int `json:"TotalCount"`
+			DomainRecords struct {
+				Record []aliyunRecord `json:"Record"`
+			} `json:"DomainRecords"`
 		}
-
-		request := alidns.CreateDescribeDomainRecordInfoRequest()
-		request.RecordId = providerID
-
-		response, err := client.DescribeDomainRecordInfo(request)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get dns record: %w", err)
+		params := map[string]string{
+			"DomainName": zone,
+			"PageNumber": strconv.Itoa(page),
+			"PageSize":   strconv.Itoa(aliyunPageSize),
 		}
-
-		return &DNSRecord{
-			Domain:     response.DomainName,
-			Type:       DNSRecordType(response.Type),
-			Name:       response.RR,
-			Value:      response.Value,
-			TTL:        response.TTL,
-			Priority:   response.Priority,
-			Provider:   "aliyun",
-			ProviderID: response.RecordId,
-		}, nil
-	*/
-
-	return nil, fmt.Errorf("not implemented")
+		if err := p.call(ctx, "DescribeDomainRecords", params, &result); err != nil {
+			return nil, err
+		}
+		for _, r := range result.DomainRecords.Record {
+			records = append(records, &DNSRecord{
+				Domain:     zone,
+				Type:       DNSRecordType(r.Type),
+				Name:       r.RR,
+				Value:      r.Value,
+				TTL:        r.TTL,
+				Priority:   r.Priority,
+				Provider:   p.Name(),
+				ProviderID: r.RecordID,
+			})
+		}
+		if len(result.DomainRecords.Record) < aliyunPageSize || len(records) >= result.TotalCount {
+			return records, nil
+		}
+	}
 }
 
-// ListRecords 列出 DNS 记录
-func (p *AliyunDNSProvider) ListRecords(ctx context.Context, domain string) ([]*DNSRecord, error) {
-	// TODO: 实现阿里云 DNS API 调用
-	// 示例代码框架：
-	/*
-		client, err := alidns.NewClientWithAccessKey(p.region, p.accessKeyID, p.accessKeySecret)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create aliyun client: %w", err)
-		}
+// recordParams 创建和更新记录的参数，没有设置 TTL 时使用阿里云的默认值
+func (p *AliyunDNSProvider) recordParams(record *DNSRecord) map[string]string {
+	rr := record.Name
+	if rr == "" {
+		rr = "@"
+	}
+	params := map[string]string{
+		"RR":    rr,
+		"Type":  string(record.Type),
+		"Value": record.Value,
+	}
+	if record.TTL > 0 {
+		params["TTL"] = strconv.Itoa(record.TTL)
+	}
+	if record.Type == DNSRecordMX && record.Priority > 0 {
+		params["Priority"] = strconv.Itoa(record.Priority)
+	}
+	return params
+}
 
-		request := alidns.CreateDescribeDomainRecordsRequest()
-		request.DomainName = domain
-		request.PageSize = requests.NewInteger(100)
-
-		var records []*DNSRecord
-		pageNumber := 1
-
-		for {
-			request.PageNumber = requests.NewInteger(pageNumber)
-			response, err := client.DescribeDomainRecords(request)
-			if err != nil {
-				return nil, fmt.Errorf("failed to list dns records: %w", err)
-			}
-
-			for _, record := range response.DomainRecords.Record {
-				records = append(records, &DNSRecord{
-					Domain:     domain,
-					Type:       DNSRecordType(record.Type),
-					Name:       record.RR,
-					Value:      record.Value,
-					TTL:        record.TTL,
-					Priority:   record.Priority,
-					Provider:   "aliyun",
-					ProviderID: record.RecordId,
-				})
-			}
-
-			if len(response.DomainRecords.Record) < 100 {
-				break
-			}
-			pageNumber++
-		}
+// CreateRecord 添加解析记录
+func (p *AliyunDNSProvider) CreateRecord(ctx context.Context, zone string, record *DNSRecord) (string, error) {
+	params := p.recordParams(record)
+	params["DomainName"] = zone
+	var result struct {
+		RecordID string `json:"RecordId"`
+	}
+	if err := p.call(ctx, "AddDomainRecord", params, &result); err != nil {
+		return "", err
+	}
+	return result.RecordID, nil
+}
 
-		return records, nil
-	*/
+// UpdateRecord 按 record.ProviderID 修改解析记录
+func (p *AliyunDNSProvider) UpdateRecord(ctx context.Context, zone string, record *DNSRecord) error {
+	params := p.recordParams(record)
+	params["RecordId"] = record.ProviderID
+	return p.call(ctx, "UpdateDomainRecord", params, nil)
+}
 
-	return nil, fmt.Errorf("not implemented")
+// DeleteRecord 删除解析记录
+func (p *AliyunDNSProvider) DeleteRecord(ctx context.Context, zone string, providerID string) error {
+	return p.call(ctx, "DeleteDomainRecord", map[string]string{"RecordId": providerID}, nil)
 }
 
-// GetName 获取提供商名称
-func (p *AliyunDNSProvider) GetName() string {
+// Name 获取提供商名称
+func (p *AliyunDNSProvider) Name() string {
 	return "aliyun"
 }
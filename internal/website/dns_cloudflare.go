@@ -1,91 +1,228 @@
 package website
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 )
 
-// CloudflareDNSProvider Cloudflare DNS 提供商
+// cloudflareEndpoint Cloudflare API v4 地址
+const cloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+// CloudflareDNSProvider Cloudflare DNS 提供商，使用 API Token 认证
 type CloudflareDNSProvider struct {
 	apiToken string
-	email    string
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	zoneIDs map[string]string // zone 名称 -> zone ID
 }
 
 // NewCloudflareDNSProvider 创建 Cloudflare DNS 提供商
 func NewCloudflareDNSProvider(config *DNSProviderConfig) (*CloudflareDNSProvider, error) {
-	if config.AccessKeyID == "" {
-		return nil, fmt.Errorf("api token is required")
+	if config.APIToken == "" {
+		return nil, fmt.Errorf("%w: cloudflare api token is required", ErrDNSProviderNotConfigured)
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = cloudflareEndpoint
 	}
 
 	return &CloudflareDNSProvider{
-		apiToken: config.AccessKeyID,
-		email:    config.AccessKeySecret, // 可选
+		apiToken: config.APIToken,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   config.httpClient(),
+		zoneIDs:  make(map[string]string),
 	}, nil
 }
 
-// AddRecord 添加 DNS 记录
-func (p *CloudflareDNSProvider) AddRecord(ctx context.Context, record *DNSRecord) (string, error) {
-	// TODO: 实现 Cloudflare DNS API 调用
-	// 这里需要集成 Cloudflare SDK
-	// 示例代码框架：
-	/*
-		api, err := cloudflare.NewWithAPIToken(p.apiToken)
-		if err != nil {
-			return "", fmt.Errorf("failed to create cloudflare client: %w", err)
-		}
+// cloudflareRecord Cloudflare 的 DNS 记录
+type cloudflareRecord struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Priority *int   `json:"priority,omitempty"`
+}
+
+// cloudflareResponse Cloudflare API 的响应
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
 
-		// 获取 Zone ID
-		zoneID, err := api.ZoneIDByName(record.Domain)
+// do 调用 Cloudflare API，body 非空时以 JSON 发送，result 非空时解析响应的 result
+func (p *CloudflareDNSProvider) do(ctx context.Context, method, path string, body, result interface{}) (*cloudflareResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
 		if err != nil {
-			return "", fmt.Errorf("failed to get zone id: %w", err)
+			return nil, err
 		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.endpoint+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiToken)
+	req.Header.Set("Content-Type", "application/json")
 
-		// 创建记录
-		dnsRecord := cloudflare.DNSRecord{
-			Type:     string(record.Type),
-			Name:     record.Name + "." + record.Domain,
-			Content:  record.Value,
-			TTL:      record.TTL,
-			Priority: &record.Priority,
-		}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cloudflare: %v", ErrDNSProviderRequest, err)
+	}
+	defer resp.Body.Close()
 
-		response, err := api.CreateDNSRecord(ctx, zoneID, dnsRecord)
-		if err != nil {
-			return "", fmt.Errorf("failed to add dns record: %w", err)
+	var envelope cloudflareResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("%w: cloudflare: %s: invalid response: %v", ErrDNSProviderRequest, resp.Status, err)
+	}
+	if !envelope.Success {
+		var messages []string
+		for _, e := range envelope.Errors {
+			messages = append(messages, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		if len(messages) == 0 {
+			messages = append(messages, resp.Status)
 		}
+		return nil, fmt.Errorf("%w: cloudflare: %s", ErrDNSProviderRequest, strings.Join(messages, "; "))
+	}
+	if result != nil {
+		if err := json.Unmarshal(envelope.Result, result); err != nil {
+			return nil, fmt.Errorf("%w: cloudflare: invalid result: %v", ErrDNSProviderRequest, err)
+		}
+	}
+	return &envelope, nil
+}
 
-		return response.Result.ID, nil
-	*/
+// zoneID 查找 zone 的 ID，结果缓存在驱动中
+func (p *CloudflareDNSProvider) zoneID(ctx context.Context, zone string) (string, error) {
+	p.mu.Lock()
+	id, ok := p.zoneIDs[zone]
+	p.mu.Unlock()
+	if ok {
+		return id, nil
+	}
 
-	// 暂时返回模拟的记录 ID
-	return fmt.Sprintf("cloudflare-%s-%s", record.Domain, record.Name), nil
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if _, err := p.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("%w: cloudflare: zone %s not found", ErrDNSProviderRequest, zone)
+	}
+	p.mu.Lock()
+	p.zoneIDs[zone] = zones[0].ID
+	p.mu.Unlock()
+	return zones[0].ID, nil
 }
 
-// UpdateRecord 更新 DNS 记录
-func (p *CloudflareDNSProvider) UpdateRecord(ctx context.Context, record *DNSRecord) error {
-	// TODO: 实现 Cloudflare DNS API 调用
-	return nil
+// ListRecords 列出 zone 下的全部记录
+func (p *CloudflareDNSProvider) ListRecords(ctx context.Context, zone string) ([]*DNSRecord, error) {
+	zoneID, err := p.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for page := 1; ; page++ {
+		var result []cloudflareRecord
+		envelope, err := p.do(ctx, http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?per_page=100&page=%d", zoneID, page), nil, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range result {
+			record := &DNSRecord{
+				Domain:     zone,
+				Type:       DNSRecordType(r.Type),
+				Name:       relativeName(r.Name, zone),
+				Value:      r.Content,
+				TTL:        r.TTL,
+				Provider:   p.Name(),
+				ProviderID: r.ID,
+			}
+			if r.Priority != nil {
+				record.Priority = *r.Priority
+			}
+			records = append(records, record)
+		}
+		if page >= envelope.ResultInfo.TotalPages {
+			return records, nil
+		}
+	}
 }
 
-// DeleteRecord 删除 DNS 记录
-func (p *CloudflareDNSProvider) DeleteRecord(ctx context.Context, providerID string) error {
-	// TODO: 实现 Cloudflare DNS API 调用
-	return nil
+// cloudflareBody 创建和更新记录的请求体，Cloudflare 的 TTL 为 1 表示自动
+func cloudflareBody(zone string, record *DNSRecord) cloudflareRecord {
+	body := cloudflareRecord{
+		Type:    string(record.Type),
+		Name:    absoluteName(record.Name, zone),
+		Content: record.Value,
+		TTL:     record.TTL,
+	}
+	if body.TTL <= 0 {
+		body.TTL = 1
+	}
+	if record.Type == DNSRecordMX {
+		priority := record.Priority
+		body.Priority = &priority
+	}
+	return body
 }
 
-// GetRecord 获取 DNS 记录
-func (p *CloudflareDNSProvider) GetRecord(ctx context.Context, providerID string) (*DNSRecord, error) {
-	// TODO: 实现 Cloudflare DNS API 调用
-	return nil, fmt.Errorf("not implemented")
+// CreateRecord 在 zone 下创建记录
+func (p *CloudflareDNSProvider) CreateRecord(ctx context.Context, zone string, record *DNSRecord) (string, error) {
+	zoneID, err := p.zoneID(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+	var created cloudflareRecord
+	if _, err := p.do(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", cloudflareBody(zone, record), &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
 }
 
-// ListRecords 列出 DNS 记录
-func (p *CloudflareDNSProvider) ListRecords(ctx context.Context, domain string) ([]*DNSRecord, error) {
-	// TODO: 实现 Cloudflare DNS API 调用
-	return nil, fmt.Errorf("not implemented")
+// UpdateRecord 按 record.ProviderID 更新记录
+func (p *CloudflareDNSProvider) UpdateRecord(ctx context.Context, zone string, record *DNSRecord) error {
+	zoneID, err := p.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	_, err = p.do(ctx, http.MethodPut, "/zones/"+zoneID+"/dns_records/"+url.PathEscape(record.ProviderID), cloudflareBody(zone, record), nil)
+	return err
+}
+
+// DeleteRecord 删除记录
+func (p *CloudflareDNSProvider) DeleteRecord(ctx context.Context, zone string, providerID string) error {
+	zoneID, err := p.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	_, err = p.do(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+url.PathEscape(providerID), nil, nil)
+	return err
 }
 
-// GetName 获取提供商名称
-func (p *CloudflareDNSProvider) GetName() string {
+// Name 获取提供商名称
+func (p *CloudflareDNSProvider) Name() string {
 	return "cloudflare"
 }
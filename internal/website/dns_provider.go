@@ -2,76 +2,134 @@ package website
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qwq/internal/config"
+)
+
+var (
+	// ErrDNSProviderUnsupported 不支持的 DNS 提供商
+	ErrDNSProviderUnsupported = errors.New("unsupported dns provider")
+	// ErrDNSProviderNotConfigured 配置中没有该 DNS 提供商的凭证
+	ErrDNSProviderNotConfigured = errors.New("dns provider not configured")
+	// ErrDNSProviderRequest DNS 提供商的 API 返回错误，错误信息包含提供商的错误码和说明
+	ErrDNSProviderRequest = errors.New("dns provider request failed")
 )
 
-// DNSProvider DNS 提供商接口
-type DNSProvider interface {
-	// AddRecord 添加 DNS 记录
-	AddRecord(ctx context.Context, record *DNSRecord) (string, error)
-	
-	// UpdateRecord 更新 DNS 记录
-	UpdateRecord(ctx context.Context, record *DNSRecord) error
-	
-	// DeleteRecord 删除 DNS 记录
-	DeleteRecord(ctx context.Context, providerID string) error
-	
-	// GetRecord 获取 DNS 记录
-	GetRecord(ctx context.Context, providerID string) (*DNSRecord, error)
-	
-	// ListRecords 列出 DNS 记录
-	ListRecords(ctx context.Context, domain string) ([]*DNSRecord, error)
-	
-	// GetName 获取提供商名称
-	GetName() string
+// DNSProviderDriver DNS 提供商驱动，按托管的根域名（zone）管理记录。
+// 记录的 Domain 为 zone，Name 为相对 zone 的主机记录（根域名为 @），ProviderID 为提供商的记录 ID
+type DNSProviderDriver interface {
+	// Name 提供商名称，与 DNSRecord.Provider 一致
+	Name() string
+
+	// ListRecords 列出 zone 下的全部记录
+	ListRecords(ctx context.Context, zone string) ([]*DNSRecord, error)
+
+	// CreateRecord 在 zone 下创建记录，返回提供商的记录 ID
+	CreateRecord(ctx context.Context, zone string, record *DNSRecord) (string, error)
+
+	// UpdateRecord 按 record.ProviderID 更新记录
+	UpdateRecord(ctx context.Context, zone string, record *DNSRecord) error
+
+	// DeleteRecord 删除提供商的记录
+	DeleteRecord(ctx context.Context, zone string, providerID string) error
 }
 
 // DNSProviderConfig DNS 提供商配置
 type DNSProviderConfig struct {
-	Provider    string            `json:"provider"`     // 提供商名称
-	AccessKeyID string            `json:"access_key_id"` // 访问密钥 ID
-	AccessKeySecret string        `json:"access_key_secret"` // 访问密钥
-	Region      string            `json:"region,omitempty"` // 区域（某些提供商需要）
-	Endpoint    string            `json:"endpoint,omitempty"` // 自定义端点
-	Extra       map[string]string `json:"extra,omitempty"` // 额外配置
+	Provider        string       `json:"provider"`           // 提供商名称
+	APIToken        string       `json:"api_token"`          // API 令牌（Cloudflare）
+	AccessKeyID     string       `json:"access_key_id"`      // 访问密钥 ID（阿里云 AccessKey ID、腾讯云 SecretId）
+	AccessKeySecret string       `json:"access_key_secret"`  // 访问密钥（阿里云 AccessKey Secret、腾讯云 SecretKey）
+	Region          string       `json:"region,omitempty"`   // 区域（某些提供商需要）
+	Endpoint        string       `json:"endpoint,omitempty"` // 自定义端点
+	HTTPClient      *http.Client `json:"-"`                  // 访问 API 的客户端，为空时使用 30 秒超时的默认客户端
+}
+
+// httpClient 访问提供商 API 使用的客户端
+func (c *DNSProviderConfig) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
 }
 
-// NewDNSProvider 创建 DNS 提供商实例
-func NewDNSProvider(config *DNSProviderConfig) (DNSProvider, error) {
+// NewDNSProviderDriver 创建 DNS 提供商驱动
+func NewDNSProviderDriver(config *DNSProviderConfig) (DNSProviderDriver, error) {
 	switch config.Provider {
 	case "aliyun":
 		return NewAliyunDNSProvider(config)
-	case "tencent":
-		return NewTencentDNSProvider(config)
 	case "cloudflare":
 		return NewCloudflareDNSProvider(config)
+	case "tencent":
+		return NewTencentDNSProvider(config)
 	default:
-		return nil, fmt.Errorf("unsupported dns provider: %s", config.Provider)
+		return nil, fmt.Errorf("%w: %s", ErrDNSProviderUnsupported, config.Provider)
+	}
+}
+
+// DNSProviderFromConfig 使用 dns.providers 中的凭证创建提供商驱动
+func DNSProviderFromConfig(provider string) (DNSProviderDriver, error) {
+	credentials, ok := config.Current().DNS.Providers[provider]
+	if !ok {
+		if provider != "aliyun" && provider != "cloudflare" && provider != "tencent" {
+			return nil, fmt.Errorf("%w: %s", ErrDNSProviderUnsupported, provider)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDNSProviderNotConfigured, provider)
+	}
+	return NewDNSProviderDriver(&DNSProviderConfig{
+		Provider:        provider,
+		APIToken:        credentials.APIToken,
+		AccessKeyID:     credentials.AccessKeyID,
+		AccessKeySecret: credentials.AccessKeySecret,
+		Region:          credentials.Region,
+		Endpoint:        credentials.Endpoint,
+	})
+}
+
+// relativeName 提供商返回的完整域名转换为相对 zone 的主机记录
+func relativeName(fqdn, zone string) string {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	if fqdn == zone || fqdn == "" {
+		return "@"
+	}
+	return strings.TrimSuffix(fqdn, "."+zone)
+}
+
+// absoluteName 主机记录转换为完整域名
+func absoluteName(name, zone string) string {
+	if name == "" || name == "@" {
+		return zone
 	}
+	return name + "." + zone
 }
 
 // DNSProviderManager DNS 提供商管理器
 type DNSProviderManager struct {
-	providers map[string]DNSProvider
+	providers map[string]DNSProviderDriver
 }
 
 // NewDNSProviderManager 创建 DNS 提供商管理器
 func NewDNSProviderManager() *DNSProviderManager {
 	return &DNSProviderManager{
-		providers: make(map[string]DNSProvider),
+		providers: make(map[string]DNSProviderDriver),
 	}
 }
 
 // RegisterProvider 注册提供商
-func (m *DNSProviderManager) RegisterProvider(name string, provider DNSProvider) {
+func (m *DNSProviderManager) RegisterProvider(name string, provider DNSProviderDriver) {
 	m.providers[name] = provider
 }
 
 // GetProvider 获取提供商
-func (m *DNSProviderManager) GetProvider(name string) (DNSProvider, error) {
+func (m *DNSProviderManager) GetProvider(name string) (DNSProviderDriver, error) {
 	provider, ok := m.providers[name]
 	if !ok {
-		return nil, fmt.Errorf("provider not found: %s", name)
+		return nil, fmt.Errorf("%w: %s", ErrDNSProviderNotConfigured, name)
 	}
 	return provider, nil
 }
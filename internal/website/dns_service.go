@@ -3,24 +3,55 @@ package website
 import (
 	"context"
 	"fmt"
-	"net"
+	"time"
+
+	"qwq/internal/pagination"
 
 	"gorm.io/gorm"
 )
 
 // dnsService DNS 服务实现
 type dnsService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	drivers  func(provider string) (DNSProviderDriver, error) // 按名称获取提供商驱动
+	verifier func() *DNSVerifier                              // 验证解析使用的验证器
 }
 
-// NewDNSService 创建 DNS 服务实例
+// NewDNSService 创建 DNS 服务实例，提供商凭证从配置的 dns.providers 读取
 func NewDNSService(db *gorm.DB) DNSService {
-	return &dnsService{db: db}
+	return NewDNSServiceWithDrivers(db, DNSProviderFromConfig)
+}
+
+// NewDNSServiceWithDrivers 创建使用指定提供商驱动的 DNS 服务实例
+func NewDNSServiceWithDrivers(db *gorm.DB, drivers func(provider string) (DNSProviderDriver, error)) DNSService {
+	return &dnsService{db: db, drivers: drivers, verifier: DNSVerifierFromConfig}
 }
 
-// CreateDNSRecord 创建 DNS 记录
+// propagated 记录由 qwq 管理且设置了提供商时，本地变更同步到提供商
+func propagated(record *DNSRecord) bool {
+	return record.Managed && record.Provider != ""
+}
+
+// CreateDNSRecord 创建 DNS 记录，管理的记录先在提供商创建
 func (s *dnsService) CreateDNSRecord(ctx context.Context, record *DNSRecord) error {
+	var driver DNSProviderDriver
+	if propagated(record) {
+		var err error
+		if driver, err = s.drivers(record.Provider); err != nil {
+			return err
+		}
+		providerID, err := driver.CreateRecord(ctx, record.Domain, record)
+		if err != nil {
+			return fmt.Errorf("failed to create dns record at %s: %w", record.Provider, err)
+		}
+		record.ProviderID = providerID
+	}
+
 	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		if driver != nil {
+			// 本地保存失败时删除刚创建的远端记录，避免留下无人管理的记录
+			driver.DeleteRecord(ctx, record.Domain, record.ProviderID)
+		}
 		return fmt.Errorf("failed to create dns record: %w", err)
 	}
 	return nil
@@ -61,6 +92,24 @@ func (s *dnsService) ListDNSRecords(ctx context.Context, domain string, userID,
 	return records, nil
 }
 
+// QueryDNSRecords 分页列出 DNS 记录
+func (s *dnsService) QueryDNSRecords(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*DNSRecord], error) {
+	query := s.db.WithContext(ctx).Model(&DNSRecord{})
+	
+	if tenantID > 0 {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	page, err := pagination.Find[*DNSRecord](query, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dns records: %w", err)
+	}
+	return page, nil
+}
+
 // UpdateDNSRecord 更新 DNS 记录
 func (s *dnsService) UpdateDNSRecord(ctx context.Context, record *DNSRecord) error {
 	// 检查记录是否存在
@@ -71,6 +120,26 @@ func (s *dnsService) UpdateDNSRecord(ctx context.Context, record *DNSRecord) err
 		}
 		return fmt.Errorf("failed to check dns record existence: %w", err)
 	}
+	if record.ProviderID == "" {
+		record.ProviderID = existing.ProviderID
+	}
+
+	if propagated(record) {
+		driver, err := s.drivers(record.Provider)
+		if err != nil {
+			return err
+		}
+		if record.ProviderID == "" {
+			// 之前没有同步过的记录在提供商创建
+			providerID, err := driver.CreateRecord(ctx, record.Domain, record)
+			if err != nil {
+				return fmt.Errorf("failed to create dns record at %s: %w", record.Provider, err)
+			}
+			record.ProviderID = providerID
+		} else if err := driver.UpdateRecord(ctx, record.Domain, record); err != nil {
+			return fmt.Errorf("failed to update dns record at %s: %w", record.Provider, err)
+		}
+	}
 
 	if err := s.db.WithContext(ctx).Save(record).Error; err != nil {
 		return fmt.Errorf("failed to update dns record: %w", err)
@@ -78,8 +147,25 @@ func (s *dnsService) UpdateDNSRecord(ctx context.Context, record *DNSRecord) err
 	return nil
 }
 
-// DeleteDNSRecord 删除 DNS 记录
+// DeleteDNSRecord 删除 DNS 记录，管理的记录先从提供商删除
 func (s *dnsService) DeleteDNSRecord(ctx context.Context, id uint) error {
+	var existing DNSRecord
+	if err := s.db.WithContext(ctx).First(&existing, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrDNSRecordNotFound
+		}
+		return fmt.Errorf("failed to get dns record: %w", err)
+	}
+	if propagated(&existing) && existing.ProviderID != "" {
+		driver, err := s.drivers(existing.Provider)
+		if err != nil {
+			return err
+		}
+		if err := driver.DeleteRecord(ctx, existing.Domain, existing.ProviderID); err != nil {
+			return fmt.Errorf("failed to delete dns record at %s: %w", existing.Provider, err)
+		}
+	}
+
 	result := s.db.WithContext(ctx).Delete(&DNSRecord{}, id)
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete dns record: %w", result.Error)
@@ -91,155 +177,176 @@ func (s *dnsService) DeleteDNSRecord(ctx context.Context, id uint) error {
 }
 
 // VerifyDNS 验证 DNS 解析
-func (s *dnsService) VerifyDNS(ctx context.Context, domain, recordType, expectedValue string) (bool, error) {
-	switch DNSRecordType(recordType) {
-	case DNSRecordA:
-		return s.verifyARecord(domain, expectedValue)
-	case DNSRecordAAAA:
-		return s.verifyAAAARecord(domain, expectedValue)
-	case DNSRecordCNAME:
-		return s.verifyCNAMERecord(domain, expectedValue)
-	case DNSRecordTXT:
-		return s.verifyTXTRecord(domain, expectedValue)
-	case DNSRecordMX:
-		return s.verifyMXRecord(domain, expectedValue)
-	default:
-		return false, fmt.Errorf("unsupported record type: %s", recordType)
-	}
-}
-
-// verifyARecord 验证 A 记录
-func (s *dnsService) verifyARecord(domain, expectedIP string) (bool, error) {
-	ips, err := net.LookupIP(domain)
-	if err != nil {
-		return false, fmt.Errorf("failed to lookup A record: %w", err)
-	}
+func (s *dnsService) VerifyDNS(ctx context.Context, domain, recordType, expectedValue string) (*DNSVerification, error) {
+	return s.verifier().Verify(ctx, domain, recordType, expectedValue)
+}
 
-	for _, ip := range ips {
-		if ip.To4() != nil && ip.String() == expectedIP {
-			return true, nil
-		}
+// WaitDNSPropagation 等待 DNS 解析生效
+func (s *dnsService) WaitDNSPropagation(ctx context.Context, domain, recordType, expectedValue string, timeout time.Duration) (*DNSVerification, error) {
+	verifier := s.verifier()
+	if timeout > 0 {
+		verifier.Timeout = timeout
 	}
-
-	return false, nil
+	return verifier.Wait(ctx, domain, recordType, expectedValue)
 }
 
-// verifyAAAARecord 验证 AAAA 记录
-func (s *dnsService) verifyAAAARecord(domain, expectedIP string) (bool, error) {
-	ips, err := net.LookupIP(domain)
-	if err != nil {
-		return false, fmt.Errorf("failed to lookup AAAA record: %w", err)
-	}
+// DNSSyncResult 与提供商同步的结果
+type DNSSyncResult struct {
+	Domain    string        `json:"domain"`
+	Provider  string        `json:"provider"`
+	Imported  []*DNSRecord  `json:"imported"`  // 从提供商导入的记录
+	Pushed    []*DNSRecord  `json:"pushed"`    // 推送到提供商的本地管理记录
+	Linked    int           `json:"linked"`    // 两边一致、关联了提供商记录 ID 的记录数
+	Conflicts []DNSConflict `json:"conflicts"` // 未处理的冲突
+}
 
-	for _, ip := range ips {
-		if ip.To16() != nil && ip.To4() == nil && ip.String() == expectedIP {
-			return true, nil
-		}
-	}
+// DNSConflict 同名同类型的记录在本地和提供商的值不同，需要人工处理
+type DNSConflict struct {
+	Name         string        `json:"name"`
+	Type         DNSRecordType `json:"type"`
+	LocalValues  []string      `json:"local_values"`
+	RemoteValues []string      `json:"remote_values"`
+}
 
-	return false, nil
+// dnsRecordKey 双向同步时按名称和类型分组记录
+type dnsRecordKey struct {
+	name       string
+	recordType DNSRecordType
 }
 
-// verifyCNAMERecord 验证 CNAME 记录
-func (s *dnsService) verifyCNAMERecord(domain, expectedCNAME string) (bool, error) {
-	cname, err := net.LookupCNAME(domain)
+// SyncWithProvider 与 DNS 提供商同步
+func (s *dnsService) SyncWithProvider(ctx context.Context, domain, provider string, userID, tenantID uint) (*DNSSyncResult, error) {
+	driver, err := s.drivers(provider)
 	if err != nil {
-		return false, fmt.Errorf("failed to lookup CNAME record: %w", err)
+		return nil, err
 	}
 
-	// 移除末尾的点
-	if len(cname) > 0 && cname[len(cname)-1] == '.' {
-		cname = cname[:len(cname)-1]
+	// 从提供商获取记录
+	remoteRecords, err := driver.ListRecords(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records from provider: %w", err)
 	}
 
-	return cname == expectedCNAME, nil
-}
-
-// verifyTXTRecord 验证 TXT 记录
-func (s *dnsService) verifyTXTRecord(domain, expectedValue string) (bool, error) {
-	txts, err := net.LookupTXT(domain)
-	if err != nil {
-		return false, fmt.Errorf("failed to lookup TXT record: %w", err)
+	// 获取本地属于该提供商的记录
+	var localRecords []*DNSRecord
+	if err := s.db.WithContext(ctx).Where("domain = ? AND provider = ?", domain, provider).Order("id").Find(&localRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to list local records: %w", err)
 	}
 
-	for _, txt := range txts {
-		if txt == expectedValue {
-			return true, nil
+	// 先关联两边名称、类型和值都一致的记录
+	result := &DNSSyncResult{Domain: domain, Provider: provider, Imported: []*DNSRecord{}, Pushed: []*DNSRecord{}, Conflicts: []DNSConflict{}}
+	var keys []dnsRecordKey
+	localGroups := make(map[dnsRecordKey][]*DNSRecord)
+	remoteGroups := make(map[dnsRecordKey][]*DNSRecord)
+	for _, record := range localRecords {
+		key := dnsRecordKey{record.Name, record.Type}
+		if _, ok := localGroups[key]; !ok {
+			keys = append(keys, key)
 		}
+		localGroups[key] = append(localGroups[key], record)
 	}
-
-	return false, nil
-}
-
-// verifyMXRecord 验证 MX 记录
-func (s *dnsService) verifyMXRecord(domain, expectedMX string) (bool, error) {
-	mxs, err := net.LookupMX(domain)
-	if err != nil {
-		return false, fmt.Errorf("failed to lookup MX record: %w", err)
+	for _, record := range remoteRecords {
+		key := dnsRecordKey{record.Name, record.Type}
+		if _, ok := localGroups[key]; !ok {
+			if _, ok := remoteGroups[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		remoteGroups[key] = append(remoteGroups[key], record)
 	}
 
-	for _, mx := range mxs {
-		host := mx.Host
-		// 移除末尾的点
-		if len(host) > 0 && host[len(host)-1] == '.' {
-			host = host[:len(host)-1]
+	db := s.db.WithContext(ctx)
+	for _, key := range keys {
+		locals, remotes := matchDNSRecords(localGroups[key], remoteGroups[key])
+		for _, pair := range locals {
+			if pair.remote == nil {
+				continue
+			}
+			local := pair.local
+			if local.ProviderID != pair.remote.ProviderID || local.TTL != pair.remote.TTL {
+				local.ProviderID, local.TTL = pair.remote.ProviderID, pair.remote.TTL
+				if err := db.Save(local).Error; err != nil {
+					return nil, fmt.Errorf("failed to link dns record: %w", err)
+				}
+			}
+			result.Linked++
 		}
-		if host == expectedMX {
-			return true, nil
+
+		var unmatchedLocal []*DNSRecord
+		for _, pair := range locals {
+			if pair.remote == nil {
+				unmatchedLocal = append(unmatchedLocal, pair.local)
+			}
 		}
-	}
 
-	return false, nil
-}
+		// 两边都有未匹配的记录：同名同类型但值不同，不覆盖任何一方
+		if len(unmatchedLocal) > 0 && len(remotes) > 0 {
+			conflict := DNSConflict{Name: key.name, Type: key.recordType}
+			for _, record := range unmatchedLocal {
+				conflict.LocalValues = append(conflict.LocalValues, record.Value)
+			}
+			for _, record := range remotes {
+				conflict.RemoteValues = append(conflict.RemoteValues, record.Value)
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
 
-// SyncWithProvider 与 DNS 提供商同步
-func (s *dnsService) SyncWithProvider(ctx context.Context, domain, provider string) error {
-	// 获取提供商配置
-	// TODO: 从配置中获取提供商凭证
-	config := &DNSProviderConfig{
-		Provider: provider,
-		// AccessKeyID 和 AccessKeySecret 需要从配置或数据库中获取
-	}
+		// 导入本地没有的远端记录，之后由 qwq 管理
+		for _, remote := range remotes {
+			remote.Domain, remote.Provider, remote.Managed = domain, provider, true
+			remote.UserID, remote.TenantID = userID, tenantID
+			if err := db.Create(remote).Error; err != nil {
+				return nil, fmt.Errorf("failed to import dns record: %w", err)
+			}
+			result.Imported = append(result.Imported, remote)
+		}
 
-	dnsProvider, err := NewDNSProvider(config)
-	if err != nil {
-		return fmt.Errorf("failed to create dns provider: %w", err)
+		// 推送提供商没有的本地管理记录，包括在提供商被删除的记录
+		for _, local := range unmatchedLocal {
+			if !local.Managed {
+				continue
+			}
+			providerID, err := driver.CreateRecord(ctx, domain, local)
+			if err != nil {
+				return nil, fmt.Errorf("failed to push dns record to provider: %w", err)
+			}
+			local.ProviderID = providerID
+			if err := db.Save(local).Error; err != nil {
+				return nil, fmt.Errorf("failed to update dns record: %w", err)
+			}
+			result.Pushed = append(result.Pushed, local)
+		}
 	}
 
-	// 从提供商获取记录
-	providerRecords, err := dnsProvider.ListRecords(ctx, domain)
-	if err != nil {
-		return fmt.Errorf("failed to list records from provider: %w", err)
-	}
+	return result, nil
+}
 
-	// 获取本地记录
-	localRecords, err := s.ListDNSRecords(ctx, domain, 0, 0)
-	if err != nil {
-		return fmt.Errorf("failed to list local records: %w", err)
-	}
+// dnsRecordPair 本地记录和值相同的远端记录，没有匹配时 remote 为 nil
+type dnsRecordPair struct {
+	local  *DNSRecord
+	remote *DNSRecord
+}
 
-	// 创建本地记录映射
-	localRecordMap := make(map[string]*DNSRecord)
-	for _, record := range localRecords {
-		key := fmt.Sprintf("%s-%s-%s", record.Name, record.Type, record.Value)
-		localRecordMap[key] = record
+// matchDNSRecords 按值匹配同名同类型的本地和远端记录，返回每条本地记录的匹配结果和未匹配的远端记录
+func matchDNSRecords(locals, remotes []*DNSRecord) ([]dnsRecordPair, []*DNSRecord) {
+	pairs := make([]dnsRecordPair, len(locals))
+	used := make([]bool, len(remotes))
+	for i, local := range locals {
+		pairs[i].local = local
+		for j, remote := range remotes {
+			if !used[j] && remote.Value == local.Value {
+				pairs[i].remote, used[j] = remote, true
+				break
+			}
+		}
 	}
 
-	// 同步记录
-	for _, providerRecord := range providerRecords {
-		key := fmt.Sprintf("%s-%s-%s", providerRecord.Name, providerRecord.Type, providerRecord.Value)
-		
-		if localRecord, exists := localRecordMap[key]; exists {
-			// 更新现有记录
-			localRecord.ProviderID = providerRecord.ProviderID
-			localRecord.TTL = providerRecord.TTL
-			localRecord.Priority = providerRecord.Priority
-			s.UpdateDNSRecord(ctx, localRecord)
-		} else {
-			// 创建新记录
-			s.CreateDNSRecord(ctx, providerRecord)
+	var unmatched []*DNSRecord
+	for j, remote := range remotes {
+		if !used[j] {
+			unmatched = append(unmatched, remote)
 		}
 	}
-
-	return nil
+	return pairs, unmatched
 }
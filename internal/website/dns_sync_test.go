@@ -0,0 +1,452 @@
+package website
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockDNSDriver 内存中的 DNS 提供商，err 非空时所有调用都返回该错误
+type mockDNSDriver struct {
+	name   string
+	zones  map[string][]*DNSRecord
+	nextID int
+	err    error
+}
+
+// newMockDNSDriver 创建模拟驱动和只包含它的驱动查找函数
+func newMockDNSDriver(name string) (*mockDNSDriver, func(string) (DNSProviderDriver, error)) {
+	driver := &mockDNSDriver{name: name, zones: make(map[string][]*DNSRecord)}
+	manager := NewDNSProviderManager()
+	manager.RegisterProvider(name, driver)
+	return driver, manager.GetProvider
+}
+
+// add 直接在提供商添加记录，模拟在提供商控制台的修改
+func (d *mockDNSDriver) add(zone, name string, recordType DNSRecordType, value string) *DNSRecord {
+	d.nextID++
+	record := &DNSRecord{Domain: zone, Name: name, Type: recordType, Value: value, TTL: 600, Provider: d.name, ProviderID: fmt.Sprintf("rec-%d", d.nextID)}
+	d.zones[zone] = append(d.zones[zone], record)
+	return record
+}
+
+// find 按主机记录查找提供商的记录
+func (d *mockDNSDriver) find(zone, name string) *DNSRecord {
+	for _, record := range d.zones[zone] {
+		if record.Name == name {
+			return record
+		}
+	}
+	return nil
+}
+
+func (d *mockDNSDriver) Name() string { return d.name }
+
+func (d *mockDNSDriver) ListRecords(ctx context.Context, zone string) ([]*DNSRecord, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	var records []*DNSRecord
+	for _, record := range d.zones[zone] {
+		copied := *record
+		records = append(records, &copied)
+	}
+	return records, nil
+}
+
+func (d *mockDNSDriver) CreateRecord(ctx context.Context, zone string, record *DNSRecord) (string, error) {
+	if d.err != nil {
+		return "", d.err
+	}
+	return d.add(zone, record.Name, record.Type, record.Value).ProviderID, nil
+}
+
+func (d *mockDNSDriver) UpdateRecord(ctx context.Context, zone string, record *DNSRecord) error {
+	if d.err != nil {
+		return d.err
+	}
+	for _, existing := range d.zones[zone] {
+		if existing.ProviderID == record.ProviderID {
+			existing.Name, existing.Type, existing.Value, existing.TTL = record.Name, record.Type, record.Value, record.TTL
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: record %s not found", ErrDNSProviderRequest, record.ProviderID)
+}
+
+func (d *mockDNSDriver) DeleteRecord(ctx context.Context, zone string, providerID string) error {
+	if d.err != nil {
+		return d.err
+	}
+	records := d.zones[zone]
+	for i, existing := range records {
+		if existing.ProviderID == providerID {
+			d.zones[zone] = append(records[:i], records[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: record %s not found", ErrDNSProviderRequest, providerID)
+}
+
+func TestSyncWithProvider_TwoWayDiff(t *testing.T) {
+	db := setupDNSTestDB(t)
+	driver, drivers := newMockDNSDriver("fake")
+	service := NewDNSServiceWithDrivers(db, drivers)
+	ctx := context.Background()
+
+	www := driver.add("example.com", "www", DNSRecordA, "192.0.2.1")
+	driver.add("example.com", "api", DNSRecordA, "192.0.2.2")
+	driver.add("example.com", "mail", DNSRecordMX, "mx1.example.net")
+
+	// 直接写入数据库，不经过提供商
+	locals := []*DNSRecord{
+		{Domain: "example.com", Name: "www", Type: DNSRecordA, Value: "192.0.2.1", Provider: "fake", Managed: true, UserID: 1, TenantID: 1},
+		{Domain: "example.com", Name: "mail", Type: DNSRecordMX, Value: "mx2.example.net", Provider: "fake", Managed: true, UserID: 1, TenantID: 1},
+		{Domain: "example.com", Name: "blog", Type: DNSRecordA, Value: "192.0.2.3", Provider: "fake", Managed: true, UserID: 1, TenantID: 1},
+		{Domain: "example.com", Name: "legacy", Type: DNSRecordA, Value: "192.0.2.4", Provider: "fake", UserID: 1, TenantID: 1},
+		{Domain: "example.com", Name: "other", Type: DNSRecordA, Value: "192.0.2.5", Provider: "aliyun", Managed: true, UserID: 1, TenantID: 1},
+	}
+	for _, record := range locals {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := service.SyncWithProvider(ctx, "example.com", "fake", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Linked != 1 {
+		t.Errorf("Expected www to be linked, got %d", result.Linked)
+	}
+	if len(result.Imported) != 1 || result.Imported[0].Name != "api" || !result.Imported[0].Managed || result.Imported[0].UserID != 2 || result.Imported[0].TenantID != 3 {
+		t.Errorf("Expected api to be imported as a managed record, got %+v", result.Imported)
+	}
+	if len(result.Pushed) != 1 || result.Pushed[0].Name != "blog" || driver.find("example.com", "blog") == nil {
+		t.Errorf("Expected blog to be pushed to the provider, got %+v", result.Pushed)
+	}
+	if driver.find("example.com", "legacy") != nil || driver.find("example.com", "other") != nil {
+		t.Error("Unmanaged records and records of other providers must not be pushed")
+	}
+
+	// 冲突的记录两边都保持原样
+	if len(result.Conflicts) != 1 {
+		t.Fatalf("Expected one conflict, got %+v", result.Conflicts)
+	}
+	conflict := result.Conflicts[0]
+	if conflict.Name != "mail" || conflict.Type != DNSRecordMX || conflict.LocalValues[0] != "mx2.example.net" || conflict.RemoteValues[0] != "mx1.example.net" {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+	if driver.find("example.com", "mail").Value != "mx1.example.net" {
+		t.Error("A conflict must not overwrite the provider record")
+	}
+	mail, _ := service.GetDNSRecord(ctx, locals[1].ID)
+	if mail.Value != "mx2.example.net" {
+		t.Error("A conflict must not overwrite the local record")
+	}
+	if linked, _ := service.GetDNSRecord(ctx, locals[0].ID); linked.ProviderID != www.ProviderID {
+		t.Errorf("Expected www to take the provider record ID, got %q", linked.ProviderID)
+	}
+
+	// 再次同步时只剩冲突
+	result, err = service.SyncWithProvider(ctx, "example.com", "fake", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Linked != 3 || len(result.Imported) != 0 || len(result.Pushed) != 0 || len(result.Conflicts) != 1 {
+		t.Errorf("Expected a second sync to be a no-op, got linked=%d imported=%d pushed=%d conflicts=%d", result.Linked, len(result.Imported), len(result.Pushed), len(result.Conflicts))
+	}
+
+	// 在提供商被删除的管理记录重新推送
+	driver.DeleteRecord(ctx, "example.com", www.ProviderID)
+	result, err = service.SyncWithProvider(ctx, "example.com", "fake", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pushed) != 1 || result.Pushed[0].Name != "www" || driver.find("example.com", "www") == nil {
+		t.Errorf("Expected www to be pushed again, got %+v", result.Pushed)
+	}
+}
+
+func TestSyncWithProvider_Errors(t *testing.T) {
+	db := setupDNSTestDB(t)
+	driver, drivers := newMockDNSDriver("fake")
+	service := NewDNSServiceWithDrivers(db, drivers)
+	ctx := context.Background()
+
+	if _, err := service.SyncWithProvider(ctx, "example.com", "missing", 0, 0); !errors.Is(err, ErrDNSProviderNotConfigured) {
+		t.Errorf("Expected ErrDNSProviderNotConfigured, got %v", err)
+	}
+	driver.err = fmt.Errorf("%w: 10000 Authentication error", ErrDNSProviderRequest)
+	if _, err := service.SyncWithProvider(ctx, "example.com", "fake", 0, 0); !errors.Is(err, ErrDNSProviderRequest) || !strings.Contains(err.Error(), "Authentication error") {
+		t.Errorf("Expected the provider error, got %v", err)
+	}
+}
+
+func TestDNSService_PropagatesManagedRecords(t *testing.T) {
+	db := setupDNSTestDB(t)
+	driver, drivers := newMockDNSDriver("fake")
+	service := NewDNSServiceWithDrivers(db, drivers)
+	ctx := context.Background()
+
+	record := &DNSRecord{Domain: "example.com", Name: "www", Type: DNSRecordA, Value: "192.0.2.1", Provider: "fake", Managed: true, UserID: 1, TenantID: 1}
+	if err := service.CreateDNSRecord(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	remote := driver.find("example.com", "www")
+	if remote == nil || record.ProviderID != remote.ProviderID {
+		t.Fatalf("Expected the record to be created at the provider, got %+v", driver.zones)
+	}
+
+	// 更新时没有带 ProviderID 也使用已保存的
+	update := &DNSRecord{ID: record.ID, Domain: "example.com", Name: "www", Type: DNSRecordA, Value: "192.0.2.9", Provider: "fake", Managed: true, UserID: 1, TenantID: 1}
+	if err := service.UpdateDNSRecord(ctx, update); err != nil {
+		t.Fatal(err)
+	}
+	if remote.Value != "192.0.2.9" || update.ProviderID != remote.ProviderID {
+		t.Errorf("Expected the provider record to be updated, got %+v", remote)
+	}
+
+	if err := service.DeleteDNSRecord(ctx, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(driver.zones["example.com"]) != 0 {
+		t.Errorf("Expected the provider record to be deleted, got %+v", driver.zones["example.com"])
+	}
+
+	// 未管理的记录只保存在本地
+	unmanaged := &DNSRecord{Domain: "example.com", Name: "local", Type: DNSRecordA, Value: "192.0.2.2", Provider: "fake", UserID: 1, TenantID: 1}
+	if err := service.CreateDNSRecord(ctx, unmanaged); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeleteDNSRecord(ctx, unmanaged.ID); err != nil {
+		t.Fatal(err)
+	}
+	if driver.nextID != 1 {
+		t.Errorf("Expected unmanaged records not to reach the provider, got %d provider calls", driver.nextID)
+	}
+
+	// 提供商失败时不保存本地记录
+	driver.err = fmt.Errorf("%w: quota exceeded", ErrDNSProviderRequest)
+	failed := &DNSRecord{Domain: "example.com", Name: "api", Type: DNSRecordA, Value: "192.0.2.3", Provider: "fake", Managed: true, UserID: 1, TenantID: 1}
+	if err := service.CreateDNSRecord(ctx, failed); !errors.Is(err, ErrDNSProviderRequest) {
+		t.Errorf("Expected the provider error, got %v", err)
+	}
+	if saved, _ := service.ListDNSRecords(ctx, "example.com", 0, 0); len(saved) != 0 {
+		t.Errorf("Expected no local record after a provider failure, got %+v", saved)
+	}
+}
+
+func TestCloudflareDNSProvider_API(t *testing.T) {
+	var created map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer cf-token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`)
+			return
+		}
+		switch {
+		case r.URL.Path == "/zones" && r.URL.Query().Get("name") == "example.com":
+			fmt.Fprint(w, `{"success":true,"result":[{"id":"zone-1"}]}`)
+		case r.URL.Path == "/zones/zone-1/dns_records" && r.Method == http.MethodGet && r.URL.Query().Get("page") == "1":
+			fmt.Fprint(w, `{"success":true,"result":[{"id":"r1","type":"A","name":"example.com","content":"192.0.2.1","ttl":1}],"result_info":{"page":1,"total_pages":2}}`)
+		case r.URL.Path == "/zones/zone-1/dns_records" && r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"success":true,"result":[{"id":"r2","type":"MX","name":"mail.example.com","content":"mx.example.net","ttl":300,"priority":10}],"result_info":{"page":2,"total_pages":2}}`)
+		case r.URL.Path == "/zones/zone-1/dns_records" && r.Method == http.MethodPost:
+			json.NewDecoder(r.Body).Decode(&created)
+			fmt.Fprint(w, `{"success":true,"result":{"id":"r3"}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success":false,"errors":[{"code":81057,"message":"Record already exists."}]}`)
+		}
+	}))
+	defer server.Close()
+
+	driver, err := NewDNSProviderDriver(&DNSProviderConfig{Provider: "cloudflare", APIToken: "cf-token", Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	records, err := driver.ListRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Name != "@" || records[1].Name != "mail" || records[1].Priority != 10 || records[1].ProviderID != "r2" {
+		t.Errorf("Expected both pages with relative names, got %+v %+v", records[0], records[1])
+	}
+
+	id, err := driver.CreateRecord(ctx, "example.com", &DNSRecord{Name: "www", Type: DNSRecordA, Value: "192.0.2.7"})
+	if err != nil || id != "r3" {
+		t.Fatalf("Expected the new record ID, got %q %v", id, err)
+	}
+	if created["name"] != "www.example.com" || created["content"] != "192.0.2.7" || created["ttl"] != float64(1) {
+		t.Errorf("Unexpected create body %v", created)
+	}
+
+	err = driver.DeleteRecord(ctx, "example.com", "r9")
+	if !errors.Is(err, ErrDNSProviderRequest) || !strings.Contains(err.Error(), "81057 Record already exists.") {
+		t.Errorf("Expected the Cloudflare error message, got %v", err)
+	}
+
+	if _, err := NewDNSProviderDriver(&DNSProviderConfig{Provider: "cloudflare"}); !errors.Is(err, ErrDNSProviderNotConfigured) {
+		t.Errorf("Expected a missing token to be rejected, got %v", err)
+	}
+}
+
+func TestAliyunSignature(t *testing.T) {
+	// 阿里云文档中的签名示例
+	params := map[string]string{
+		"Format":           "XML",
+		"AccessKeyId":      "testid",
+		"Action":           "DescribeRegions",
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureNonce":   "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf",
+		"SignatureVersion": "1.0",
+		"Timestamp":        "2016-02-23T12:46:24Z",
+		"Version":          "2014-05-26",
+	}
+	if got := aliyunSignature(params, "testsecret"); got != "OLeaidS1JvxuMvnyHOwuJ+uX5qY=" {
+		t.Errorf("Unexpected signature %s", got)
+	}
+}
+
+func TestAliyunDNSProvider_API(t *testing.T) {
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		actions = append(actions, query.Get("Action"))
+		signature := query.Get("Signature")
+		params := make(map[string]string)
+		for key := range query {
+			if key != "Signature" {
+				params[key] = query.Get(key)
+			}
+		}
+		if query.Get("AccessKeyId") != "ak" || signature != aliyunSignature(params, "sk") || query.Get("Timestamp") != "2024-05-01T08:00:00Z" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"Code":"SignatureDoesNotMatch","Message":"Specified signature is not matched"}`)
+			return
+		}
+		switch query.Get("Action") {
+		case "DescribeDomainRecords":
+			fmt.Fprint(w, `{"TotalCount":2,"DomainRecords":{"Record":[{"RecordId":"1001","RR":"@","Type":"A","Value":"192.0.2.1","TTL":600},{"RecordId":"1002","RR":"mail","Type":"MX","Value":"mx.example.net","TTL":600,"Priority":5}]}}`)
+		case "AddDomainRecord":
+			if query.Get("DomainName") != "example.com" || query.Get("RR") != "www" || query.Get("Value") != "192.0.2.7" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"Code":"InvalidParameter","Message":"bad record"}`)
+				return
+			}
+			fmt.Fprint(w, `{"RecordId":"1003"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"Code":"DomainRecordNotBelongToUser","Message":"The DNS record does not exist."}`)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := NewAliyunDNSProvider(&DNSProviderConfig{AccessKeyID: "ak", AccessKeySecret: "sk", Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.now = func() time.Time { return time.Date(2024, 5, 1, 16, 0, 0, 0, time.FixedZone("CST", 8*3600)) }
+	ctx := context.Background()
+
+	records, err := provider.ListRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Name != "mail" || records[1].Priority != 5 || records[1].ProviderID != "1002" {
+		t.Errorf("Unexpected records %+v", records)
+	}
+
+	id, err := provider.CreateRecord(ctx, "example.com", &DNSRecord{Name: "www", Type: DNSRecordA, Value: "192.0.2.7"})
+	if err != nil || id != "1003" {
+		t.Fatalf("Expected the new record ID, got %q %v", id, err)
+	}
+
+	err = provider.DeleteRecord(ctx, "example.com", "9999")
+	if !errors.Is(err, ErrDNSProviderRequest) || !strings.Contains(err.Error(), "DomainRecordNotBelongToUser") {
+		t.Errorf("Expected the Aliyun error code, got %v", err)
+	}
+	if strings.Join(actions, ",") != "DescribeDomainRecords,AddDomainRecord,DeleteDomainRecord" {
+		t.Errorf("Unexpected actions %v", actions)
+	}
+}
+
+func TestTencentDNSProvider_API(t *testing.T) {
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("X-TC-Action")
+		actions = append(actions, action)
+		body, _ := io.ReadAll(r.Body)
+		timestamp := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+		if r.Header.Get("X-TC-Timestamp") != "1714550400" || r.Header.Get("Authorization") != tencentAuthorization("sid", "skey", r.Host, action, body, timestamp) {
+			fmt.Fprint(w, `{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"signature mismatch"}}}`)
+			return
+		}
+		var params map[string]interface{}
+		json.Unmarshal(body, &params)
+		switch action {
+		case "DescribeRecordList":
+			if params["Domain"] == "empty.example.com" {
+				fmt.Fprint(w, `{"Response":{"Error":{"Code":"ResourceNotFound.NoDataOfRecord","Message":"no records"}}}`)
+				return
+			}
+			fmt.Fprint(w, `{"Response":{"RecordCountInfo":{"TotalCount":2},"RecordList":[{"RecordId":1001,"Name":"@","Type":"A","Value":"192.0.2.1","TTL":600},{"RecordId":1002,"Name":"mail","Type":"MX","Value":"mx.example.net","TTL":600,"MX":5}]}}`)
+		case "CreateRecord":
+			if params["Domain"] != "example.com" || params["SubDomain"] != "www" || params["RecordLine"] != "默认" || params["Value"] != "192.0.2.7" {
+				fmt.Fprint(w, `{"Response":{"Error":{"Code":"InvalidParameter","Message":"bad record"}}}`)
+				return
+			}
+			fmt.Fprint(w, `{"Response":{"RecordId":1003}}`)
+		default:
+			fmt.Fprint(w, `{"Response":{"Error":{"Code":"ResourceNotFound.NoDataOfRecord","Message":"record not found"}}}`)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := NewTencentDNSProvider(&DNSProviderConfig{AccessKeyID: "sid"}); !errors.Is(err, ErrDNSProviderNotConfigured) {
+		t.Errorf("Expected ErrDNSProviderNotConfigured, got %v", err)
+	}
+	provider, err := NewTencentDNSProvider(&DNSProviderConfig{AccessKeyID: "sid", AccessKeySecret: "skey", Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.now = func() time.Time { return time.Date(2024, 5, 1, 16, 0, 0, 0, time.FixedZone("CST", 8*3600)) }
+	ctx := context.Background()
+
+	records, err := provider.ListRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Name != "mail" || records[1].Priority != 5 || records[1].ProviderID != "1002" || records[1].Provider != "tencent" {
+		t.Errorf("Unexpected records %+v", records)
+	}
+	if records, err := provider.ListRecords(ctx, "empty.example.com"); err != nil || len(records) != 0 {
+		t.Errorf("Expected an empty zone, got %v %v", records, err)
+	}
+
+	id, err := provider.CreateRecord(ctx, "example.com", &DNSRecord{Name: "www", Type: DNSRecordA, Value: "192.0.2.7"})
+	if err != nil || id != "1003" {
+		t.Fatalf("Expected the new record ID, got %q %v", id, err)
+	}
+
+	err = provider.DeleteRecord(ctx, "example.com", "9999")
+	if !errors.Is(err, ErrDNSProviderRequest) || !strings.Contains(err.Error(), "NoDataOfRecord") {
+		t.Errorf("Expected the DNSPod error code, got %v", err)
+	}
+	if err := provider.DeleteRecord(ctx, "example.com", "abc"); !errors.Is(err, ErrDNSProviderRequest) {
+		t.Errorf("Expected a non-numeric record ID to be rejected, got %v", err)
+	}
+	if strings.Join(actions, ",") != "DescribeRecordList,DescribeRecordList,CreateRecord,DeleteRecord" {
+		t.Errorf("Unexpected actions %v", actions)
+	}
+}
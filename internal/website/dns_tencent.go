@@ -1,196 +1,262 @@
 package website
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// TencentDNSProvider 腾讯云 DNS 提供商
+const (
+	// tencentEndpoint DNSPod API 3.0 地址
+	tencentEndpoint = "https://dnspod.tencentcloudapi.com"
+	// tencentVersion DNSPod API 版本
+	tencentVersion = "2021-03-23"
+	// tencentPageSize DescribeRecordList 每页的记录数（最大 3000）
+	tencentPageSize = 3000
+	// tencentRecordLine 创建和修改记录使用的线路
+	tencentRecordLine = "默认"
+	// tencentNoRecords zone 下没有记录时 DescribeRecordList 返回的错误码
+	tencentNoRecords = "ResourceNotFound.NoDataOfRecord"
+)
+
+// TencentDNSProvider 腾讯云 DNSPod 提供商，使用 SecretId/SecretKey 以 TC3-HMAC-SHA256 签名调用 API 3.0
 type TencentDNSProvider struct {
 	secretID  string
 	secretKey string
 	region    string
+	endpoint  string
+	client    *http.Client
+	now       func() time.Time // 签名使用的时间，测试中替换
 }
 
-// NewTencentDNSProvider 创建腾讯云 DNS 提供商
+// NewTencentDNSProvider 创建腾讯云 DNS 提供商，access_key_id 和 access_key_secret 为 SecretId 和 SecretKey
 func NewTencentDNSProvider(config *DNSProviderConfig) (*TencentDNSProvider, error) {
 	if config.AccessKeyID == "" || config.AccessKeySecret == "" {
-		return nil, fmt.Errorf("secret id and key are required")
+		return nil, fmt.Errorf("%w: tencent secret id and key are required", ErrDNSProviderNotConfigured)
 	}
-
-	region := config.Region
-	if region == "" {
-		region = "ap-guangzhou" // 默认区域
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = tencentEndpoint
 	}
 
 	return &TencentDNSProvider{
 		secretID:  config.AccessKeyID,
 		secretKey: config.AccessKeySecret,
-		region:    region,
+		region:    config.Region,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		client:    config.httpClient(),
+		now:       time.Now,
 	}, nil
 }
 
-// AddRecord 添加 DNS 记录
-func (p *TencentDNSProvider) AddRecord(ctx context.Context, record *DNSRecord) (string, error) {
-	// TODO: 实现腾讯云 DNS API 调用
-	// 这里需要集成腾讯云 SDK
-	// 示例代码框架：
-	/*
-		credential := common.NewCredential(p.secretID, p.secretKey)
-		client, err := dnspod.NewClient(credential, p.region, profile.NewClientProfile())
-		if err != nil {
-			return "", fmt.Errorf("failed to create tencent client: %w", err)
-		}
-
-		request := dnspod.NewCreateRecordRequest()
-		request.Domain = common.StringPtr(record.Domain)
-		request.SubDomain = common.StringPtr(record.Name)
-		request.RecordType = common.StringPtr(string(record.Type))
-		request.RecordLine = common.StringPtr("默认")
-		request.Value = common.StringPtr(record.Value)
-		request.TTL = common.Uint64Ptr(uint64(record.TTL))
-		if record.Priority > 0 {
-			request.MX = common.Uint64Ptr(uint64(record.Priority))
-		}
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
 
-		response, err := client.CreateRecord(request)
-		if err != nil {
-			return "", fmt.Errorf("failed to add dns record: %w", err)
-		}
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
-		return fmt.Sprintf("%d", *response.Response.RecordId), nil
-	*/
+// tencentAuthorization 计算 POST JSON 请求的 Authorization 头（TC3-HMAC-SHA256），签名包含 content-type、host 和 x-tc-action
+func tencentAuthorization(secretID, secretKey, host, action string, payload []byte, timestamp time.Time) string {
+	const service = "dnspod"
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		"content-type:application/json; charset=utf-8\nhost:" + host + "\nx-tc-action:" + strings.ToLower(action) + "\n",
+		"content-type;host;x-tc-action",
+		sha256Hex(payload),
+	}, "\n")
+	date := timestamp.UTC().Format("2006-01-02")
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(timestamp.Unix(), 10) + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256([]byte("TC3"+secretKey), date), service), "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host;x-tc-action, Signature=%s", secretID, scope, signature)
+}
 
-	// 暂时返回模拟的记录 ID
-	return fmt.Sprintf("tencent-%s-%s", record.Domain, record.Name), nil
+// tencentError DNSPod API 的错误，HTTP 状态码为 200，错误在 Response.Error 中
+type tencentError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
 }
 
-// UpdateRecord 更新 DNS 记录
-func (p *TencentDNSProvider) UpdateRecord(ctx context.Context, record *DNSRecord) error {
-	// TODO: 实现腾讯云 DNS API 调用
-	// 示例代码框架：
-	/*
-		credential := common.NewCredential(p.secretID, p.secretKey)
-		client, err := dnspod.NewClient(credential, p.region, profile.NewClientProfile())
-		if err != nil {
-			return fmt.Errorf("failed to create tencent client: %w", err)
-		}
+// call 调用 API，params 为接口参数，result 非空时解析响应的 Response；返回 API 的错误码以便调用方处理
+func (p *TencentDNSProvider) call(ctx context.Context, action string, params map[string]interface{}, result interface{}) (string, error) {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	target, err := url.Parse(p.endpoint)
+	if err != nil {
+		return "", err
+	}
+	timestamp := p.now()
 
-		recordID, err := strconv.ParseUint(record.ProviderID, 10, 64)
-		if err != nil {
-			return fmt.Errorf("invalid provider id: %w", err)
-		}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", tencentVersion)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	if p.region != "" {
+		req.Header.Set("X-TC-Region", p.region)
+	}
+	req.Header.Set("Authorization", tencentAuthorization(p.secretID, p.secretKey, target.Host, action, payload, timestamp))
 
-		request := dnspod.NewModifyRecordRequest()
-		request.Domain = common.StringPtr(record.Domain)
-		request.RecordId = common.Uint64Ptr(recordID)
-		request.SubDomain = common.StringPtr(record.Name)
-		request.RecordType = common.StringPtr(string(record.Type))
-		request.RecordLine = common.StringPtr("默认")
-		request.Value = common.StringPtr(record.Value)
-		request.TTL = common.Uint64Ptr(uint64(record.TTL))
-		if record.Priority > 0 {
-			request.MX = common.Uint64Ptr(uint64(record.Priority))
-		}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: tencent %s: %v", ErrDNSProviderRequest, action, err)
+	}
+	defer resp.Body.Close()
 
-		_, err = client.ModifyRecord(request)
-		if err != nil {
-			return fmt.Errorf("failed to update dns record: %w", err)
+	var envelope struct {
+		Response json.RawMessage `json:"Response"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&envelope); err != nil || len(envelope.Response) == 0 {
+		return "", fmt.Errorf("%w: tencent %s: %s: invalid response", ErrDNSProviderRequest, action, resp.Status)
+	}
+	var apiErr struct {
+		Error *tencentError `json:"Error"`
+	}
+	if err := json.Unmarshal(envelope.Response, &apiErr); err == nil && apiErr.Error != nil {
+		return apiErr.Error.Code, fmt.Errorf("%w: tencent %s: %s %s", ErrDNSProviderRequest, action, apiErr.Error.Code, apiErr.Error.Message)
+	}
+	if result != nil {
+		if err := json.Unmarshal(envelope.Response, result); err != nil {
+			return "", fmt.Errorf("%w: tencent %s: invalid response: %v", ErrDNSProviderRequest, action, err)
 		}
+	}
+	return "", nil
+}
 
-		return nil
-	*/
-
-	return nil
+// tencentRecord DNSPod 的解析记录
+type tencentRecord struct {
+	RecordID uint64 `json:"RecordId"`
+	Name     string `json:"Name"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+	MX       int    `json:"MX"`
 }
 
-// DeleteRecord 删除 DNS 记录
-func (p *TencentDNSProvider) DeleteRecord(ctx context.Context, providerID string) error {
-	// TODO: 实现腾讯云 DNS API 调用
-	// 示例代码框架：
-	/*
-		credential := common.NewCredential(p.secretID, p.secretKey)
-		client, err := dnspod.NewClient(credential, p.region, profile.NewClientProfile())
-		if err != nil {
-			return fmt.Errorf("failed to create tencent client: %w", err)
+// ListRecords 分页列出 zone 下的全部解析记录
+func (p *TencentDNSProvider) ListRecords(ctx context.Context, zone string) ([]*DNSRecord, error) {
+	var records []*DNSRecord
+	for offset := 0; ; offset += tencentPageSize {
+		var result struct {
+			RecordCountInfo struct {
+				TotalCount int `json:"TotalCount"`
+			} `json:"RecordCountInfo"`
+			RecordList []tencentRecord `json:"RecordList"`
 		}
-
-		recordID, err := strconv.ParseUint(providerID, 10, 64)
-		if err != nil {
-			return fmt.Errorf("invalid provider id: %w", err)
+		params := map[string]interface{}{"Domain": zone, "Offset": offset, "Limit": tencentPageSize}
+		if code, err := p.call(ctx, "DescribeRecordList", params, &result); err != nil {
+			if code == tencentNoRecords {
+				return records, nil
+			}
+			return nil, err
 		}
-
-		request := dnspod.NewDeleteRecordRequest()
-		request.RecordId = common.Uint64Ptr(recordID)
-
-		_, err = client.DeleteRecord(request)
-		if err != nil {
-			return fmt.Errorf("failed to delete dns record: %w", err)
+		for _, r := range result.RecordList {
+			records = append(records, &DNSRecord{
+				Domain:     zone,
+				Type:       DNSRecordType(r.Type),
+				Name:       r.Name,
+				Value:      r.Value,
+				TTL:        r.TTL,
+				Priority:   r.MX,
+				Provider:   p.Name(),
+				ProviderID: strconv.FormatUint(r.RecordID, 10),
+			})
 		}
-
-		return nil
-	*/
-
-	return nil
+		if len(result.RecordList) < tencentPageSize || len(records) >= result.RecordCountInfo.TotalCount {
+			return records, nil
+		}
+	}
 }
 
-// GetRecord 获取 DNS 记录
-func (p *TencentDNSProvider) GetRecord(ctx context.Context, providerID string) (*DNSRecord, error) {
-	// TODO: 实现腾讯云 DNS API 调用
-	return nil, fmt.Errorf("not implemented")
+// recordParams 创建和更新记录的参数，没有设置 TTL 时使用 DNSPod 的默认值
+func (p *TencentDNSProvider) recordParams(zone string, record *DNSRecord) map[string]interface{} {
+	subDomain := record.Name
+	if subDomain == "" {
+		subDomain = "@"
+	}
+	params := map[string]interface{}{
+		"Domain":     zone,
+		"SubDomain":  subDomain,
+		"RecordType": string(record.Type),
+		"RecordLine": tencentRecordLine,
+		"Value":      record.Value,
+	}
+	if record.TTL > 0 {
+		params["TTL"] = record.TTL
+	}
+	if record.Type == DNSRecordMX && record.Priority > 0 {
+		params["MX"] = record.Priority
+	}
+	return params
 }
 
-// ListRecords 列出 DNS 记录
-func (p *TencentDNSProvider) ListRecords(ctx context.Context, domain string) ([]*DNSRecord, error) {
-	// TODO: 实现腾讯云 DNS API 调用
-	// 示例代码框架：
-	/*
-		credential := common.NewCredential(p.secretID, p.secretKey)
-		client, err := dnspod.NewClient(credential, p.region, profile.NewClientProfile())
-		if err != nil {
-			return nil, fmt.Errorf("failed to create tencent client: %w", err)
-		}
-
-		request := dnspod.NewDescribeRecordListRequest()
-		request.Domain = common.StringPtr(domain)
-		request.Limit = common.Uint64Ptr(100)
-
-		var records []*DNSRecord
-		offset := uint64(0)
-
-		for {
-			request.Offset = common.Uint64Ptr(offset)
-			response, err := client.DescribeRecordList(request)
-			if err != nil {
-				return nil, fmt.Errorf("failed to list dns records: %w", err)
-			}
-
-			for _, record := range response.Response.RecordList {
-				records = append(records, &DNSRecord{
-					Domain:     domain,
-					Type:       DNSRecordType(*record.Type),
-					Name:       *record.Name,
-					Value:      *record.Value,
-					TTL:        int(*record.TTL),
-					Priority:   int(*record.MX),
-					Provider:   "tencent",
-					ProviderID: fmt.Sprintf("%d", *record.RecordId),
-				})
-			}
+// tencentRecordID 提供商的记录 ID 为数字
+func tencentRecordID(providerID string) (uint64, error) {
+	id, err := strconv.ParseUint(providerID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: tencent: invalid record id %q", ErrDNSProviderRequest, providerID)
+	}
+	return id, nil
+}
 
-			if len(response.Response.RecordList) < 100 {
-				break
-			}
-			offset += 100
-		}
+// CreateRecord 添加解析记录
+func (p *TencentDNSProvider) CreateRecord(ctx context.Context, zone string, record *DNSRecord) (string, error) {
+	var result struct {
+		RecordID uint64 `json:"RecordId"`
+	}
+	if _, err := p.call(ctx, "CreateRecord", p.recordParams(zone, record), &result); err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(result.RecordID, 10), nil
+}
 
-		return records, nil
-	*/
+// UpdateRecord 按 record.ProviderID 修改解析记录
+func (p *TencentDNSProvider) UpdateRecord(ctx context.Context, zone string, record *DNSRecord) error {
+	id, err := tencentRecordID(record.ProviderID)
+	if err != nil {
+		return err
+	}
+	params := p.recordParams(zone, record)
+	params["RecordId"] = id
+	_, err = p.call(ctx, "ModifyRecord", params, nil)
+	return err
+}
 
-	return nil, fmt.Errorf("not implemented")
+// DeleteRecord 删除解析记录
+func (p *TencentDNSProvider) DeleteRecord(ctx context.Context, zone string, providerID string) error {
+	id, err := tencentRecordID(providerID)
+	if err != nil {
+		return err
+	}
+	_, err = p.call(ctx, "DeleteRecord", map[string]interface{}{"Domain": zone, "RecordId": id}, nil)
+	return err
 }
 
-// GetName 获取提供商名称
-func (p *TencentDNSProvider) GetName() string {
+// Name 获取提供商名称
+func (p *TencentDNSProvider) Name() string {
 	return "tencent"
 }
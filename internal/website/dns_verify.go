@@ -0,0 +1,289 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qwq/internal/config"
+)
+
+// ErrUnsupportedRecordType 不支持验证的记录类型
+var ErrUnsupportedRecordType = errors.New("unsupported record type")
+
+// 验证解析的默认设置
+const (
+	DefaultVerifyTimeout  = 2 * time.Minute
+	DefaultVerifyInterval = 10 * time.Second
+
+	// resolverTimeout 单个解析器一次查询的最长时间
+	resolverTimeout = 5 * time.Second
+)
+
+// defaultResolvers 没有配置 dns.resolvers 时使用的 DNS 服务器
+var defaultResolvers = []string{"system", "8.8.8.8", "1.1.1.1"}
+
+// DNSResolver 查询 DNS 记录，*net.Resolver 实现了该接口
+type DNSResolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// NamedResolver 带名称的解析器，名称出现在验证结果中
+type NamedResolver struct {
+	Name     string
+	Resolver DNSResolver
+}
+
+// NewDNSResolver 使用指定 DNS 服务器（host[:port]，默认 53 端口）的解析器，system 或空为系统默认解析器
+func NewDNSResolver(server string) DNSResolver {
+	if server == "" || server == "system" {
+		return net.DefaultResolver
+	}
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: resolverTimeout}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// DNSResolverResult 一个解析器的查询结果
+type DNSResolverResult struct {
+	Resolver  string   `json:"resolver"`
+	Values    []string `json:"values"`              // 解析到的值，MX 为 "优先级 主机"
+	Matched   bool     `json:"matched"`             // 解析结果包含期望值
+	Flattened bool     `json:"flattened,omitempty"` // CNAME 被提供商展平，解析到的地址与目标一致
+	Error     string   `json:"error,omitempty"`
+}
+
+// DNSVerification 记录在各解析器上的验证结果
+type DNSVerification struct {
+	Domain     string              `json:"domain"`
+	RecordType DNSRecordType       `json:"record_type"`
+	Expected   string              `json:"expected_value"`
+	Propagated bool                `json:"propagated"` // 所有解析器都解析到了期望值
+	Results    []DNSResolverResult `json:"results"`
+	Attempts   int                 `json:"attempts"`   // 查询的轮数
+	ElapsedMS  int64               `json:"elapsed_ms"` // 从开始验证到最后一轮查询的时间，等待生效时即生效用时
+	CheckedAt  time.Time           `json:"checked_at"`
+}
+
+// DNSVerifier 通过多个解析器验证记录是否生效
+type DNSVerifier struct {
+	Resolvers []NamedResolver
+	Timeout   time.Duration // Wait 的最长等待时间，默认 2 分钟
+	Interval  time.Duration // Wait 检查的间隔，默认 10 秒
+}
+
+// DNSVerifierFromConfig 使用 dns.resolvers 等配置创建验证器
+func DNSVerifierFromConfig() *DNSVerifier {
+	cfg := config.Current().DNS
+	servers := cfg.Resolvers
+	if len(servers) == 0 {
+		servers = defaultResolvers
+	}
+	verifier := &DNSVerifier{
+		Timeout:  time.Duration(cfg.VerifyTimeout) * time.Second,
+		Interval: time.Duration(cfg.VerifyInterval) * time.Second,
+	}
+	for _, server := range servers {
+		if server == "" {
+			server = "system"
+		}
+		verifier.Resolvers = append(verifier.Resolvers, NamedResolver{Name: server, Resolver: NewDNSResolver(server)})
+	}
+	return verifier
+}
+
+// Verify 在所有解析器上并行查询一次
+func (v *DNSVerifier) Verify(ctx context.Context, domain, recordType, expected string) (*DNSVerification, error) {
+	domain = normalizeHost(domain)
+	if domain == "" {
+		return nil, fmt.Errorf("%w: domain is required", ErrInvalidDomain)
+	}
+	switch DNSRecordType(recordType) {
+	case DNSRecordA, DNSRecordAAAA, DNSRecordCNAME, DNSRecordTXT, DNSRecordMX:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+
+	verification := &DNSVerification{
+		Domain:     domain,
+		RecordType: DNSRecordType(recordType),
+		Expected:   expected,
+		Results:    make([]DNSResolverResult, len(v.Resolvers)),
+		Attempts:   1,
+		CheckedAt:  time.Now(),
+	}
+	var wg sync.WaitGroup
+	for i, resolver := range v.Resolvers {
+		wg.Add(1)
+		go func(i int, resolver NamedResolver) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, resolverTimeout)
+			defer cancel()
+			result := lookupRecord(ctx, resolver.Resolver, domain, DNSRecordType(recordType), expected)
+			result.Resolver = resolver.Name
+			verification.Results[i] = result
+		}(i, resolver)
+	}
+	wg.Wait()
+	verification.ElapsedMS = time.Since(verification.CheckedAt).Milliseconds()
+
+	verification.Propagated = len(verification.Results) > 0
+	for _, result := range verification.Results {
+		if !result.Matched {
+			verification.Propagated = false
+		}
+	}
+	return verification, nil
+}
+
+// Wait 每隔 Interval 查询一次，直到所有解析器都解析到期望值或超过 Timeout；超时不是错误，返回最后一次的结果
+func (v *DNSVerifier) Wait(ctx context.Context, domain, recordType, expected string) (*DNSVerification, error) {
+	timeout, interval := v.Timeout, v.Interval
+	if timeout <= 0 {
+		timeout = DefaultVerifyTimeout
+	}
+	if interval <= 0 {
+		interval = DefaultVerifyInterval
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	for attempt := 1; ; attempt++ {
+		verification, err := v.Verify(ctx, domain, recordType, expected)
+		if err != nil {
+			return nil, err
+		}
+		verification.Attempts = attempt
+		verification.ElapsedMS = time.Since(start).Milliseconds()
+		if verification.Propagated || time.Now().Add(interval).After(deadline) {
+			return verification, nil
+		}
+		select {
+		case <-ctx.Done():
+			return verification, nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lookupRecord 用一个解析器查询记录并与期望值比较
+func lookupRecord(ctx context.Context, resolver DNSResolver, domain string, recordType DNSRecordType, expected string) DNSResolverResult {
+	var result DNSResolverResult
+	switch recordType {
+	case DNSRecordA, DNSRecordAAAA:
+		network := "ip4"
+		if recordType == DNSRecordAAAA {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, domain)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		want := net.ParseIP(strings.TrimSpace(expected))
+		for _, ip := range ips {
+			result.Values = append(result.Values, ip.String())
+			if want != nil && ip.Equal(want) {
+				result.Matched = true
+			}
+		}
+
+	case DNSRecordCNAME:
+		target := normalizeHost(expected)
+		cname, err := resolver.LookupCNAME(ctx, domain)
+		if err == nil && normalizeHost(cname) != domain {
+			result.Values = []string{normalizeHost(cname)}
+			result.Matched = normalizeHost(cname) == target
+			return result
+		}
+		// 没有 CNAME（如根域名被提供商展平）时，解析到与目标相同的地址也算生效
+		return flattenedCNAME(ctx, resolver, domain, target, err)
+
+	case DNSRecordTXT:
+		txts, err := resolver.LookupTXT(ctx, domain)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Values = txts
+		for _, txt := range txts {
+			if txt == expected {
+				result.Matched = true
+			}
+		}
+
+	case DNSRecordMX:
+		priority, host := parseMXValue(expected)
+		mxs, err := resolver.LookupMX(ctx, domain)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, mx := range mxs {
+			result.Values = append(result.Values, fmt.Sprintf("%d %s", mx.Pref, normalizeHost(mx.Host)))
+			if normalizeHost(mx.Host) == host && (priority < 0 || int(mx.Pref) == priority) {
+				result.Matched = true
+			}
+		}
+	}
+	return result
+}
+
+// flattenedCNAME domain 解析到的地址与 CNAME 目标的地址有交集时视为生效
+func flattenedCNAME(ctx context.Context, resolver DNSResolver, domain, target string, cnameErr error) DNSResolverResult {
+	var result DNSResolverResult
+	ips, err := resolver.LookupIP(ctx, "ip", domain)
+	if err != nil {
+		if cnameErr != nil {
+			err = cnameErr
+		}
+		result.Error = err.Error()
+		return result
+	}
+	targetIPs, err := resolver.LookupIP(ctx, "ip", target)
+	if err != nil {
+		result.Error = fmt.Sprintf("lookup cname target %s: %v", target, err)
+	}
+
+	for _, ip := range ips {
+		result.Values = append(result.Values, ip.String())
+		for _, targetIP := range targetIPs {
+			if ip.Equal(targetIP) {
+				result.Matched, result.Flattened = true, true
+			}
+		}
+	}
+	return result
+}
+
+// parseMXValue 解析 MX 期望值，"10 mx.example.com" 同时比较优先级，只有主机时 priority 为 -1
+func parseMXValue(value string) (priority int, host string) {
+	fields := strings.Fields(value)
+	if len(fields) == 2 {
+		if p, err := strconv.Atoi(fields[0]); err == nil {
+			return p, normalizeHost(fields[1])
+		}
+	}
+	return -1, normalizeHost(value)
+}
+
+// normalizeHost 去掉末尾的点并转为小写
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+}
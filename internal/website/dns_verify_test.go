@@ -0,0 +1,201 @@
+package website
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResolver 返回固定记录的解析器，前 hiddenFor 次查询返回 NXDOMAIN，模拟尚未生效的记录
+type fakeResolver struct {
+	ips       map[string][]net.IP
+	cnames    map[string]string
+	txts      map[string][]string
+	mxs       map[string][]*net.MX
+	hiddenFor int
+	lookups   int
+}
+
+func (f *fakeResolver) hidden(name string) error {
+	f.lookups++
+	if f.lookups <= f.hiddenFor {
+		return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return nil
+}
+
+func (f *fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if err := f.hidden(host); err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, ip := range f.ips[host] {
+		if network == "ip" || (network == "ip4") == (ip.To4() != nil) {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func (f *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if err := f.hidden(host); err != nil {
+		return "", err
+	}
+	if cname, ok := f.cnames[host]; ok {
+		return cname, nil
+	}
+	// 与 net.Resolver 一致：没有 CNAME 时返回名称本身
+	return host + ".", nil
+}
+
+func (f *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if err := f.hidden(name); err != nil {
+		return nil, err
+	}
+	return f.txts[name], nil
+}
+
+func (f *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if err := f.hidden(name); err != nil {
+		return nil, err
+	}
+	return f.mxs[name], nil
+}
+
+// exampleResolver 包含 example.com 常用记录的解析器
+func exampleResolver() *fakeResolver {
+	return &fakeResolver{
+		ips: map[string][]net.IP{
+			"example.com":      {net.ParseIP("192.0.2.10")},
+			"www.example.com":  {net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+			"edge.example.net": {net.ParseIP("192.0.2.10")},
+		},
+		cnames: map[string]string{"shop.example.com": "shops.example.net."},
+		txts:   map[string][]string{"_acme-challenge.example.com": {"digest-1", "digest-2"}},
+		mxs:    map[string][]*net.MX{"example.com": {{Host: "MX1.example.net.", Pref: 10}}},
+	}
+}
+
+func TestDNSVerifier_RecordTypes(t *testing.T) {
+	cases := []struct {
+		name, domain, recordType, expected string
+		matched, flattened                 bool
+	}{
+		{"A", "www.example.com", "A", "192.0.2.1", true, false},
+		{"A mismatch", "www.example.com", "A", "192.0.2.2", false, false},
+		{"AAAA", "www.example.com", "AAAA", "2001:db8:0::1", true, false},
+		{"CNAME", "shop.example.com", "CNAME", "shops.example.net", true, false},
+		{"CNAME mismatch", "shop.example.com", "CNAME", "other.example.net", false, false},
+		{"CNAME flattened", "example.com", "CNAME", "edge.example.net.", true, true},
+		{"TXT", "_acme-challenge.example.com", "TXT", "digest-2", true, false},
+		{"MX host", "example.com", "MX", "mx1.example.net", true, false},
+		{"MX priority", "example.com", "MX", "10 mx1.example.net", true, false},
+		{"MX wrong priority", "example.com", "MX", "20 mx1.example.net", false, false},
+		{"missing", "missing.example.com", "A", "192.0.2.1", false, false},
+	}
+	for _, tc := range cases {
+		verifier := &DNSVerifier{Resolvers: []NamedResolver{{Name: "fake", Resolver: exampleResolver()}}}
+		verification, err := verifier.Verify(context.Background(), tc.domain, tc.recordType, tc.expected)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		result := verification.Results[0]
+		if result.Matched != tc.matched || result.Flattened != tc.flattened || verification.Propagated != tc.matched {
+			t.Errorf("%s: expected matched=%v flattened=%v, got %+v", tc.name, tc.matched, tc.flattened, result)
+		}
+	}
+
+	verifier := &DNSVerifier{Resolvers: []NamedResolver{{Name: "fake", Resolver: exampleResolver()}}}
+	verification, _ := verifier.Verify(context.Background(), "missing.example.com", "A", "192.0.2.1")
+	if !strings.Contains(verification.Results[0].Error, "no such host") {
+		t.Errorf("Expected the resolver error in the result, got %+v", verification.Results[0])
+	}
+	if _, err := verifier.Verify(context.Background(), "example.com", "SRV", "x"); !errors.Is(err, ErrUnsupportedRecordType) {
+		t.Errorf("Expected ErrUnsupportedRecordType, got %v", err)
+	}
+}
+
+func TestDNSVerifier_PerResolverResults(t *testing.T) {
+	lagging := exampleResolver()
+	lagging.hiddenFor = 1 << 30
+	verifier := &DNSVerifier{Resolvers: []NamedResolver{
+		{Name: "system", Resolver: exampleResolver()},
+		{Name: "8.8.8.8", Resolver: lagging},
+	}}
+
+	verification, err := verifier.Verify(context.Background(), "www.example.com", "A", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Propagated {
+		t.Error("The record must not be propagated while a resolver still misses it")
+	}
+	if got := verification.Results; got[0].Resolver != "system" || !got[0].Matched || got[1].Resolver != "8.8.8.8" || got[1].Matched {
+		t.Errorf("Unexpected per-resolver results %+v", got)
+	}
+}
+
+func TestDNSVerifier_Wait(t *testing.T) {
+	slow := exampleResolver()
+	slow.hiddenFor = 2
+	verifier := &DNSVerifier{
+		Resolvers: []NamedResolver{{Name: "fake", Resolver: slow}},
+		Timeout:   time.Second,
+		Interval:  5 * time.Millisecond,
+	}
+	verification, err := verifier.Wait(context.Background(), "www.example.com", "A", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Propagated || verification.Attempts != 3 || verification.ElapsedMS < 10 {
+		t.Errorf("Expected propagation on the third attempt, got %+v", verification)
+	}
+
+	// 超时返回最后一次的结果而不是错误
+	never := exampleResolver()
+	never.hiddenFor = 1 << 30
+	verifier = &DNSVerifier{
+		Resolvers: []NamedResolver{{Name: "fake", Resolver: never}},
+		Timeout:   30 * time.Millisecond,
+		Interval:  5 * time.Millisecond,
+	}
+	verification, err = verifier.Wait(context.Background(), "www.example.com", "A", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Propagated || verification.Attempts < 2 {
+		t.Errorf("Expected a timeout after several attempts, got %+v", verification)
+	}
+}
+
+func TestAPIHandler_VerifyDNS(t *testing.T) {
+	slow := exampleResolver()
+	slow.hiddenFor = 1
+	service := &dnsService{verifier: func() *DNSVerifier {
+		return &DNSVerifier{Resolvers: []NamedResolver{{Name: "fake", Resolver: slow}}, Interval: time.Millisecond}
+	}}
+	h := &APIHandler{dnsService: service}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/dns/verify?wait=true", strings.NewReader(`{"domain":"www.example.com","record_type":"A","expected_value":"192.0.2.1","timeout":5}`))
+	rec := httptest.NewRecorder()
+	h.VerifyDNS(rec, req)
+	var verification DNSVerification
+	json.NewDecoder(rec.Body).Decode(&verification)
+	if rec.Code != http.StatusOK || !verification.Propagated || verification.Attempts != 2 || verification.Results[0].Resolver != "fake" {
+		t.Errorf("Expected propagation after waiting, got %d %+v", rec.Code, verification)
+	}
+
+	rec, envelope := serveAPI(h.VerifyDNS, http.MethodPost, `{"domain":"example.com","record_type":"SRV","expected_value":"x"}`)
+	if rec.Code != http.StatusBadRequest || envelope.Code != "DNS_UNSUPPORTED_RECORD_TYPE" {
+		t.Errorf("Expected 400 for an unsupported type, got %d %+v", rec.Code, envelope)
+	}
+}
@@ -0,0 +1,64 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"qwq/internal/drift"
+	"qwq/internal/logger"
+	"qwq/internal/utils"
+)
+
+// ErrDriftImport 外部修改无法导入到站点配置
+var ErrDriftImport = errors.New("cannot import external nginx changes")
+
+// NewNginxDriftHandler 站点 nginx 配置被手工修改后的处理方式：
+// 保留时把外部新增的行追加到站点代理配置的 CustomConfig，之后重新生成的配置仍包含这些修改；
+// 覆盖时重载 nginx 使恢复的托管版本生效
+func NewNginxDriftHandler(websites WebsiteService, proxies ProxyService) drift.Handler {
+	return drift.Handler{
+		Import: func(ctx context.Context, file drift.File, external, actor string) error {
+			site, err := websites.GetWebsiteByDomain(ctx, file.Owner)
+			if err != nil {
+				return err
+			}
+			if site.ProxyConfigID == nil {
+				return fmt.Errorf("%w: %s has no proxy config to hold custom directives, overwrite instead", ErrDriftImport, site.Domain)
+			}
+			proxy, err := proxies.GetProxyConfig(ctx, *site.ProxyConfigID)
+			if err != nil {
+				return err
+			}
+			added := importedLines(utils.UnifiedDiff(file.Content, external, "managed", "external"))
+			if len(added) == 0 {
+				return nil
+			}
+			if proxy.CustomConfig != "" && !strings.HasSuffix(proxy.CustomConfig, "\n") {
+				proxy.CustomConfig += "\n"
+			}
+			proxy.CustomConfig += strings.Join(added, "\n")
+			if err := proxies.UpdateProxyConfig(ctx, proxy); err != nil {
+				return err
+			}
+			logger.Info("[AUDIT] imported %d external nginx lines into custom config of %s by %s", len(added), site.Domain, actor)
+			return nil
+		},
+		Apply: func(ctx context.Context, file drift.File) error {
+			return proxies.ReloadNginx(ctx)
+		},
+	}
+}
+
+// importedLines diff 中外部新增的非空行，去掉缩进（生成配置时会重新缩进）。
+// diff 基于已包含现有自定义配置的托管版本，之前导入过的行不会重复出现
+func importedLines(diff string) []string {
+	var lines []string
+	for _, line := range drift.AddedLines(diff) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,53 @@
+package website
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"qwq/internal/drift"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestNginxDriftHandler_ImportsAddedLines(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Website{}, &ProxyConfig{}, &SSLCert{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	websites, proxies := NewWebsiteService(db), NewProxyService(db)
+	proxy := &ProxyConfig{Backend: "http://127.0.0.1:8080", CustomConfig: "client_max_body_size 10m;"}
+	if err := proxies.CreateProxyConfig(ctx, proxy); err != nil {
+		t.Fatal(err)
+	}
+	if err := websites.CreateWebsite(ctx, &Website{Name: "a", Domain: "a.com", ProxyConfigID: &proxy.ID, Status: StatusActive}); err != nil {
+		t.Fatal(err)
+	}
+
+	managed := "server {\n    listen 80;\n    client_max_body_size 10m;\n}\n"
+	external := "server {\n    listen 80;\n    client_max_body_size 10m;\n    location /static/ {\n        expires 7d;\n    }\n}\n"
+	handler := NewNginxDriftHandler(websites, proxies)
+	if err := handler.Import(ctx, drift.File{Owner: "a.com", Content: managed}, external, "alice"); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	updated, err := proxies.GetProxyConfig(ctx, proxy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "client_max_body_size 10m;\nlocation /static/ {\nexpires 7d;\n}"
+	if updated.CustomConfig != want {
+		t.Errorf("Expected added lines appended to the custom config, got %q", updated.CustomConfig)
+	}
+}
@@ -24,7 +24,7 @@ func ExampleWebsiteManagement(db *gorm.DB) error {
 	proxyConfig := &ProxyConfig{
 		Name:                "example-proxy",
 		ProxyType:           ProxyTypeReverse,
-		Backend:             "http://localhost:3000",
+		Backends:            []BackendServer{{URL: "http://localhost:3000"}},
 		LoadBalanceMethod:   LoadBalanceRoundRobin,
 		HealthCheckEnabled:  true,
 		HealthCheckPath:     "/health",
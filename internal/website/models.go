@@ -15,6 +15,15 @@ const (
 	StatusError    WebsiteStatus = "error"    // 错误
 )
 
+// SiteType 站点类型
+type SiteType string
+
+const (
+	SiteTypeProxy    SiteType = "proxy"    // 反向代理到后端服务
+	SiteTypeStatic   SiteType = "static"   // 静态站点，直接托管文件
+	SiteTypeRedirect SiteType = "redirect" // 跳转到目标地址
+)
+
 // ProxyType 代理类型
 type ProxyType string
 
@@ -72,6 +81,12 @@ type Website struct {
 	Domain          string         `json:"domain" gorm:"unique;not null;index"`       // 主域名
 	Aliases         string         `json:"aliases" gorm:"type:text"`                  // 域名别名（JSON数组）
 	Status          WebsiteStatus  `json:"status" gorm:"default:inactive;index"`      // 网站状态
+	SiteType        SiteType       `json:"site_type" gorm:"default:proxy;index"`      // 站点类型
+	DocRoot         string         `json:"doc_root,omitempty"`                        // 静态站点根目录
+	DirectoryIndex  bool           `json:"directory_index" gorm:"default:false"`      // 静态站点是否开启目录索引
+	RedirectURL     string         `json:"redirect_url,omitempty"`                    // 跳转目标地址
+	RedirectCode    int            `json:"redirect_code,omitempty"`                   // 跳转状态码（301/302）
+	RedirectKeepURI bool           `json:"redirect_keep_uri" gorm:"default:false"`    // 跳转时是否保留请求路径
 	SSLEnabled      bool           `json:"ssl_enabled" gorm:"default:false"`          // 是否启用 SSL
 	SSLCertID       *uint          `json:"ssl_cert_id,omitempty" gorm:"index"`        // SSL 证书 ID
 	SSLCert         *SSLCert       `json:"ssl_cert,omitempty" gorm:"foreignKey:SSLCertID"`
@@ -85,12 +100,29 @@ type Website struct {
 	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// GetSiteType 获取站点类型，未设置时视为反向代理
+func (w *Website) GetSiteType() SiteType {
+	if w.SiteType == "" {
+		return SiteTypeProxy
+	}
+	return w.SiteType
+}
+
+// GetRedirectCode 获取跳转状态码，未设置时默认 301
+func (w *Website) GetRedirectCode() int {
+	if w.RedirectCode == 0 {
+		return 301
+	}
+	return w.RedirectCode
+}
+
 // ProxyConfig 反向代理配置模型
 type ProxyConfig struct {
 	ID                  uint              `json:"id" gorm:"primaryKey"`
 	Name                string            `json:"name" gorm:"not null;index"`           // 配置名称
 	ProxyType           ProxyType         `json:"proxy_type" gorm:"default:reverse"`    // 代理类型
-	Backend             string            `json:"backend" gorm:"not null"`              // 后端地址（单个或JSON数组）
+	Backend             string            `json:"backend,omitempty"`                    // 旧格式的后端地址（单个或JSON数组），保存时迁移到 Backends
+	Backends            []BackendServer   `json:"backends" gorm:"type:text;serializer:json"`      // 后端服务器列表（权重、备用、失败参数）
 	LoadBalanceMethod   LoadBalanceMethod `json:"load_balance_method" gorm:"default:round_robin"` // 负载均衡方法
 	HealthCheckEnabled  bool              `json:"health_check_enabled" gorm:"default:true"`       // 是否启用健康检查
 	HealthCheckPath     string            `json:"health_check_path" gorm:"default:/"`             // 健康检查路径
@@ -98,6 +130,13 @@ type ProxyConfig struct {
 	Timeout             int               `json:"timeout" gorm:"default:60"`                      // 超时时间（秒）
 	MaxBodySize         int64             `json:"max_body_size" gorm:"default:10485760"`          // 最大请求体大小（字节）
 	CustomConfig        string            `json:"custom_config" gorm:"type:text"`                 // 自定义 Nginx 配置
+	AllowIPs            string            `json:"allow_ips" gorm:"type:text"`                     // 允许访问的 IP/CIDR（JSON数组），为空表示不限制
+	DenyIPs             string            `json:"deny_ips" gorm:"type:text"`                      // 禁止访问的 IP/CIDR（JSON数组）
+	BasicAuthEnabled    bool              `json:"basic_auth_enabled" gorm:"default:false"`        // 是否启用 Basic 认证
+	BasicAuthUser       string            `json:"basic_auth_user"`                                // Basic 认证用户名
+	BasicAuthPassword   string            `json:"basic_auth_password,omitempty" gorm:"-"`         // Basic 认证密码（仅用于提交，不保存明文）
+	BasicAuthHash       string            `json:"-"`                                              // Basic 认证密码的 bcrypt 哈希
+	Warnings            []string          `json:"warnings,omitempty" gorm:"-"`                    // 校验警告，如 allow/deny 规则重叠
 	UserID              uint              `json:"user_id" gorm:"not null;index"`                  // 所属用户
 	TenantID            uint              `json:"tenant_id" gorm:"not null;index"`                // 所属租户
 	CreatedAt           time.Time         `json:"created_at"`
@@ -116,7 +155,10 @@ type SSLCert struct {
 	CertContent     string         `json:"cert_content,omitempty" gorm:"type:text"`   // 证书内容
 	KeyContent      string         `json:"key_content,omitempty" gorm:"type:text"`    // 私钥内容
 	IssueDate       *time.Time     `json:"issue_date,omitempty"`                      // 签发日期
-	ExpiryDate      *time.Time     `json:"expiry_date,omitempty" gorm:"index"`        // 过期日期
+	ExpiryDate      *time.Time     `json:"expiry_date,omitempty" gorm:"index"`        // 过期日期（证书的 not_after）
+	NotBefore       *time.Time     `json:"not_before,omitempty"`                      // 证书生效时间
+	Issuer          string         `json:"issuer"`                                    // 签发者
+	SANs            []string       `json:"sans" gorm:"type:text;serializer:json"`     // 证书包含的全部域名
 	AutoRenew       *bool          `json:"auto_renew" gorm:"default:true"`            // 是否自动续期（指针类型以区分未设置和false）
 	RenewDaysBefore int            `json:"renew_days_before" gorm:"default:30"`       // 提前多少天续期
 	Email           string         `json:"email"`                                     // 联系邮箱
@@ -127,6 +169,19 @@ type SSLCert struct {
 	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// RenewalDue 证书是否已进入续期窗口：没有过期时间或不是有效状态的证书需要重新签发，
+// 有效的证书在过期前 RenewDaysBefore 天（未设置时为 30 天）开始续期
+func (c *SSLCert) RenewalDue(now time.Time) bool {
+	if c.ExpiryDate == nil || c.Status != SSLStatusValid {
+		return true
+	}
+	days := c.RenewDaysBefore
+	if days <= 0 {
+		days = DefaultRenewDays
+	}
+	return !now.Before(c.ExpiryDate.AddDate(0, 0, -days))
+}
+
 // DNSRecord DNS 记录模型
 type DNSRecord struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
@@ -136,8 +191,9 @@ type DNSRecord struct {
 	Value     string         `json:"value" gorm:"not null"`                 // 记录值
 	TTL       int            `json:"ttl" gorm:"default:600"`                // TTL（秒）
 	Priority  int            `json:"priority,omitempty"`                    // 优先级（MX记录）
-	Provider  string         `json:"provider"`                              // DNS 提供商（aliyun, tencent等）
+	Provider  string         `json:"provider"`                              // DNS 提供商（aliyun, cloudflare, tencent）
 	ProviderID string        `json:"provider_id"`                           // 提供商记录ID
+	Managed   bool           `json:"managed"`                               // 由 qwq 管理：本地变更同步到提供商
 	UserID    uint           `json:"user_id" gorm:"not null;index"`         // 所属用户
 	TenantID  uint           `json:"tenant_id" gorm:"not null;index"`       // 所属租户
 	CreatedAt time.Time      `json:"created_at"`
@@ -17,7 +17,27 @@ func NewNginxConfigGenerator(website *Website) *NginxConfigGenerator {
 }
 
 // Generate 生成完整的 Nginx 配置
+// 根据站点类型生成反向代理、静态站点或跳转配置
 func (g *NginxConfigGenerator) Generate() (string, error) {
+	switch g.website.GetSiteType() {
+	case SiteTypeStatic:
+		if g.website.DocRoot == "" {
+			return "", ErrInvalidDocRoot
+		}
+		if err := checkNginxValue(g.website.DocRoot, ErrInvalidDocRoot); err != nil {
+			return "", err
+		}
+		return g.generateServer(g.generateStaticLocationConfig())
+	case SiteTypeRedirect:
+		if g.website.RedirectURL == "" {
+			return "", ErrInvalidRedirect
+		}
+		if err := checkNginxValue(g.website.RedirectURL, ErrInvalidRedirect); err != nil {
+			return "", err
+		}
+		return g.generateServer(g.generateRedirectConfig())
+	}
+
 	if g.website.ProxyConfig == nil {
 		return "", ErrProxyConfigNotFound
 	}
@@ -35,7 +55,7 @@ func (g *NginxConfigGenerator) Generate() (string, error) {
 	}
 
 	// 生成 server 配置
-	serverConfig, err := g.generateServer()
+	serverConfig, err := g.generateServer(g.generateLocationConfig())
 	if err != nil {
 		return "", err
 	}
@@ -45,18 +65,14 @@ func (g *NginxConfigGenerator) Generate() (string, error) {
 }
 
 // generateUpstream 生成 upstream 配置
+// 多个后端或单个后端设置了权重、失败参数时生成，每个 server 按 BackendServer 输出 weight、backup 和失败参数
 func (g *NginxConfigGenerator) generateUpstream() (string, error) {
 	config := g.website.ProxyConfig
-	
-	// 尝试解析后端地址为 JSON 数组
-	var backends []string
-	if err := json.Unmarshal([]byte(config.Backend), &backends); err != nil {
-		// 如果不是 JSON 数组，则作为单个后端处理
+	if !config.usesUpstream() {
 		return "", nil
 	}
-
-	if len(backends) <= 1 {
-		return "", nil
+	if err := validateBackends(config); err != nil {
+		return "", err
 	}
 
 	var builder strings.Builder
@@ -71,29 +87,15 @@ func (g *NginxConfigGenerator) generateUpstream() (string, error) {
 	case LoadBalanceIPHash:
 		builder.WriteString("    ip_hash;\n")
 	case LoadBalanceWeighted:
-		// 加权轮询需要在每个 server 后面指定权重
+		// 加权轮询即 nginx 默认轮询，权重写在每个 server 后面
 		builder.WriteString("    # weighted round robin\n")
 	default:
 		// 默认轮询，不需要额外配置
 	}
 
 	// 添加后端服务器
-	for i, backend := range backends {
-		weight := ""
-		if config.LoadBalanceMethod == LoadBalanceWeighted {
-			// 简单示例：第一个服务器权重为 3，其他为 1
-			if i == 0 {
-				weight = " weight=3"
-			}
-		}
-
-		// 健康检查参数
-		healthCheck := ""
-		if config.HealthCheckEnabled {
-			healthCheck = fmt.Sprintf(" max_fails=3 fail_timeout=%ds", config.HealthCheckInterval)
-		}
-
-		builder.WriteString(fmt.Sprintf("    server %s%s%s;\n", backend, weight, healthCheck))
+	for _, server := range config.Servers() {
+		builder.WriteString(fmt.Sprintf("    server %s%s;\n", server.hostPort(), g.serverParams(server)))
 	}
 
 	// keepalive 连接
@@ -104,8 +106,45 @@ func (g *NginxConfigGenerator) generateUpstream() (string, error) {
 	return builder.String(), nil
 }
 
+// serverParams 生成 upstream server 指令的参数
+// 加权轮询时未设置权重的服务器显式输出 weight=1；未单独设置失败参数时按健康检查配置
+func (g *NginxConfigGenerator) serverParams(server BackendServer) string {
+	config := g.website.ProxyConfig
+	var params strings.Builder
+
+	weight := server.Weight
+	if weight == 0 && config.LoadBalanceMethod == LoadBalanceWeighted {
+		weight = 1
+	}
+	if weight > 0 {
+		params.WriteString(fmt.Sprintf(" weight=%d", weight))
+	}
+
+	maxFails, failTimeout := server.MaxFails, server.FailTimeout
+	if config.HealthCheckEnabled {
+		if maxFails == 0 {
+			maxFails = 3
+		}
+		if failTimeout == 0 {
+			failTimeout = config.HealthCheckInterval
+		}
+	}
+	if maxFails > 0 {
+		params.WriteString(fmt.Sprintf(" max_fails=%d", maxFails))
+	}
+	if failTimeout > 0 {
+		params.WriteString(fmt.Sprintf(" fail_timeout=%ds", failTimeout))
+	}
+
+	if server.Backup {
+		params.WriteString(" backup")
+	}
+	return params.String()
+}
+
 // generateServer 生成 server 配置
-func (g *NginxConfigGenerator) generateServer() (string, error) {
+// locationConfig 为站点类型对应的 location 配置
+func (g *NginxConfigGenerator) generateServer(locationConfig string) (string, error) {
 	var builder strings.Builder
 	config := g.website.ProxyConfig
 
@@ -141,11 +180,14 @@ func (g *NginxConfigGenerator) generateServer() (string, error) {
 	// 日志配置
 	builder.WriteString(g.generateLogConfig())
 
+	// 访问控制（IP 白名单/黑名单、Basic 认证）
+	builder.WriteString(g.generateAccessControl())
+
 	// Location 配置
-	builder.WriteString(g.generateLocationConfig())
+	builder.WriteString(locationConfig)
 
 	// 自定义配置
-	if config.CustomConfig != "" {
+	if config != nil && config.CustomConfig != "" {
 		builder.WriteString("\n    # Custom configuration\n")
 		builder.WriteString(g.indentConfig(config.CustomConfig, 1))
 		builder.WriteString("\n")
@@ -153,8 +195,8 @@ func (g *NginxConfigGenerator) generateServer() (string, error) {
 
 	builder.WriteString("}\n")
 
-	// 如果启用了 SSL，添加 HTTP 到 HTTPS 的重定向
-	if g.website.SSLEnabled {
+	// 如果启用了 SSL，添加 HTTP 到 HTTPS 的重定向（跳转站点本身已处理所有请求）
+	if g.website.SSLEnabled && g.website.GetSiteType() != SiteTypeRedirect {
 		builder.WriteString("\n")
 		builder.WriteString(g.generateHTTPRedirect())
 	}
@@ -233,14 +275,15 @@ func (g *NginxConfigGenerator) generateLocationConfig() string {
 
 	builder.WriteString("    location / {\n")
 
-	// 确定代理目标
-	proxyPass := config.Backend
-	
-	// 如果有多个后端，使用 upstream
-	var backends []string
-	if err := json.Unmarshal([]byte(config.Backend), &backends); err == nil && len(backends) > 1 {
+	// 确定代理目标：单个后端直接代理，否则代理到 upstream（协议取第一个后端的协议）
+	servers := config.Servers()
+	proxyPass := ""
+	if len(servers) > 0 {
+		proxyPass = servers[0].URL
+	}
+	if config.usesUpstream() {
 		upstreamName := fmt.Sprintf("backend_%s", sanitizeName(g.website.Domain))
-		proxyPass = fmt.Sprintf("http://%s", upstreamName)
+		proxyPass = fmt.Sprintf("%s://%s", servers[0].scheme(), upstreamName)
 	}
 
 	builder.WriteString(fmt.Sprintf("        proxy_pass %s;\n", proxyPass))
@@ -273,6 +316,49 @@ func (g *NginxConfigGenerator) generateLocationConfig() string {
 	return builder.String()
 }
 
+// generateStaticLocationConfig 生成静态站点的 location 配置
+// HTML 不缓存以便及时发布，静态资源长期缓存
+func (g *NginxConfigGenerator) generateStaticLocationConfig() string {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("    root %s;\n", g.website.DocRoot))
+	builder.WriteString("    index index.html index.htm;\n\n")
+
+	builder.WriteString("    location / {\n")
+	builder.WriteString("        try_files $uri $uri/ =404;\n")
+	if g.website.DirectoryIndex {
+		builder.WriteString("        autoindex on;\n")
+	} else {
+		builder.WriteString("        autoindex off;\n")
+	}
+	builder.WriteString("        expires -1;\n")
+	builder.WriteString("    }\n\n")
+
+	// 静态资源缓存
+	builder.WriteString("    location ~* \\.(css|js|png|jpg|jpeg|gif|svg|ico|webp|woff|woff2|ttf)$ {\n")
+	builder.WriteString("        expires 30d;\n")
+	builder.WriteString("        access_log off;\n")
+	builder.WriteString("    }\n\n")
+
+	// 禁止访问隐藏文件（如 .git、.env）
+	builder.WriteString("    location ~ /\\. {\n")
+	builder.WriteString("        deny all;\n")
+	builder.WriteString("    }\n")
+
+	return builder.String()
+}
+
+// generateRedirectConfig 生成跳转站点的配置
+func (g *NginxConfigGenerator) generateRedirectConfig() string {
+	target := strings.TrimSuffix(g.website.RedirectURL, "/")
+	if g.website.RedirectKeepURI {
+		target += "$request_uri"
+	} else {
+		target = g.website.RedirectURL
+	}
+	return fmt.Sprintf("    location / {\n        return %d %s;\n    }\n", g.website.GetRedirectCode(), target)
+}
+
 // generateHTTPRedirect 生成 HTTP 到 HTTPS 的重定向
 func (g *NginxConfigGenerator) generateHTTPRedirect() string {
 	var builder strings.Builder
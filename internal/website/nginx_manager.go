@@ -6,6 +6,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"qwq/internal/drift"
 )
 
 const (
@@ -59,19 +61,14 @@ func reloadNginx() error {
 	return nil
 }
 
-// WriteNginxConfig 写入 Nginx 配置文件
-func WriteNginxConfig(domain, config string) error {
-	// 清理域名作为文件名
-	filename := sanitizeName(domain) + ".conf"
-	configPath := filepath.Join(NginxConfigDir, filename)
-
-	// 确保目录存在
-	if err := os.MkdirAll(NginxConfigDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
+// nginxConfigPath 站点配置文件路径
+func nginxConfigPath(domain string) string {
+	return filepath.Join(NginxConfigDir, sanitizeName(domain)+".conf")
+}
 
-	// 写入配置文件
-	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+// WriteNginxConfig 写入 Nginx 配置文件。文件自上次写入后被手工修改且尚未处理时返回 drift.ErrConflict，不覆盖外部修改
+func WriteNginxConfig(domain, config string) error {
+	if err := drift.Default.Write(drift.File{Path: nginxConfigPath(domain), Kind: drift.KindNginx, Owner: domain}, []byte(config), 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -135,6 +132,7 @@ func RemoveNginxConfig(domain string) error {
 			return fmt.Errorf("failed to remove config file: %w", err)
 		}
 	}
+	drift.Default.Forget(configPath)
 
 	return nil
 }
@@ -19,9 +19,12 @@ func NewProxyService(db *gorm.DB) ProxyService {
 
 // CreateProxyConfig 创建代理配置
 func (s *proxyService) CreateProxyConfig(ctx context.Context, config *ProxyConfig) error {
-	// 验证后端地址
-	if config.Backend == "" {
-		return ErrInvalidBackend
+	// 迁移旧格式并验证后端服务器
+	if err := prepareBackends(config); err != nil {
+		return err
+	}
+	if err := prepareAccessControl(config, nil); err != nil {
+		return err
 	}
 
 	if err := s.db.WithContext(ctx).Create(config).Error; err != nil {
@@ -64,9 +67,9 @@ func (s *proxyService) ListProxyConfigs(ctx context.Context, userID, tenantID ui
 
 // UpdateProxyConfig 更新代理配置
 func (s *proxyService) UpdateProxyConfig(ctx context.Context, config *ProxyConfig) error {
-	// 验证后端地址
-	if config.Backend == "" {
-		return ErrInvalidBackend
+	// 迁移旧格式并验证后端服务器
+	if err := prepareBackends(config); err != nil {
+		return err
 	}
 
 	// 检查配置是否存在
@@ -77,6 +80,9 @@ func (s *proxyService) UpdateProxyConfig(ctx context.Context, config *ProxyConfi
 		}
 		return fmt.Errorf("failed to check proxy config existence: %w", err)
 	}
+	if err := prepareAccessControl(config, &existing); err != nil {
+		return err
+	}
 
 	if err := s.db.WithContext(ctx).Save(config).Error; err != nil {
 		return fmt.Errorf("failed to update proxy config: %w", err)
@@ -98,7 +104,7 @@ func (s *proxyService) DeleteProxyConfig(ctx context.Context, id uint) error {
 
 // GenerateNginxConfig 生成 Nginx 配置
 func (s *proxyService) GenerateNginxConfig(ctx context.Context, website *Website) (string, error) {
-	if website.ProxyConfig == nil {
+	if website.GetSiteType() == SiteTypeProxy && website.ProxyConfig == nil {
 		return "", ErrProxyConfigNotFound
 	}
 
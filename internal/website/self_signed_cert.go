@@ -69,6 +69,8 @@ func generateSelfSignedCert(domain string) (*CertificateBundle, error) {
 
 	return &CertificateBundle{
 		Domain:      domain,
+		Domains:     template.DNSNames,
+		Issuer:      domain,
 		Certificate: certPEM,
 		PrivateKey:  keyPEM,
 		NotBefore:   notBefore,
@@ -115,6 +117,8 @@ func UploadManualCertificate(domain string, certPEM, keyPEM []byte) (*Certificat
 
 	return &CertificateBundle{
 		Domain:      domain,
+		Domains:     cert.DNSNames,
+		Issuer:      cert.Issuer.CommonName,
 		Certificate: certPEM,
 		PrivateKey:  keyPEM,
 		NotBefore:   cert.NotBefore,
@@ -3,6 +3,9 @@ package website
 import (
 	"context"
 	"errors"
+	"time"
+
+	"qwq/internal/pagination"
 )
 
 var (
@@ -16,12 +19,20 @@ var (
 	ErrSSLCertNotFound = errors.New("ssl certificate not found")
 	// ErrSSLCertExpired SSL证书已过期
 	ErrSSLCertExpired = errors.New("ssl certificate expired")
+	// ErrRenewalNotDue SSL证书还未进入续期窗口
+	ErrRenewalNotDue = errors.New("ssl certificate renewal not due")
 	// ErrProxyConfigNotFound 代理配置未找到
 	ErrProxyConfigNotFound = errors.New("proxy config not found")
 	// ErrDNSRecordNotFound DNS记录未找到
 	ErrDNSRecordNotFound = errors.New("dns record not found")
 	// ErrInvalidBackend 无效的后端地址
 	ErrInvalidBackend = errors.New("invalid backend address")
+	// ErrInvalidSiteType 无效的站点类型
+	ErrInvalidSiteType = errors.New("invalid site type")
+	// ErrInvalidDocRoot 无效的静态站点根目录
+	ErrInvalidDocRoot = errors.New("invalid doc root")
+	// ErrInvalidRedirect 无效的跳转配置
+	ErrInvalidRedirect = errors.New("invalid redirect target")
 )
 
 // WebsiteService 网站管理服务接口
@@ -35,8 +46,8 @@ type WebsiteService interface {
 	// GetWebsiteByDomain 根据域名获取网站
 	GetWebsiteByDomain(ctx context.Context, domain string) (*Website, error)
 	
-	// ListWebsites 列出网站
-	ListWebsites(ctx context.Context, userID, tenantID uint, page, pageSize int) ([]*Website, int64, error)
+	// ListWebsites 分页列出网站
+	ListWebsites(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*Website], error)
 	
 	// UpdateWebsite 更新网站
 	UpdateWebsite(ctx context.Context, website *Website) error
@@ -92,6 +103,9 @@ type SSLService interface {
 	// ListSSLCerts 列出 SSL 证书
 	ListSSLCerts(ctx context.Context, userID, tenantID uint) ([]*SSLCert, error)
 	
+	// QuerySSLCerts 分页列出 SSL 证书
+	QuerySSLCerts(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*SSLCert], error)
+	
 	// UpdateSSLCert 更新 SSL 证书
 	UpdateSSLCert(ctx context.Context, cert *SSLCert) error
 	
@@ -122,17 +136,24 @@ type DNSService interface {
 	// ListDNSRecords 列出 DNS 记录
 	ListDNSRecords(ctx context.Context, domain string, userID, tenantID uint) ([]*DNSRecord, error)
 	
+	// QueryDNSRecords 分页列出 DNS 记录，域名等条件由 q 的过滤参数指定
+	QueryDNSRecords(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*DNSRecord], error)
+	
 	// UpdateDNSRecord 更新 DNS 记录
 	UpdateDNSRecord(ctx context.Context, record *DNSRecord) error
 	
 	// DeleteDNSRecord 删除 DNS 记录
 	DeleteDNSRecord(ctx context.Context, id uint) error
 	
-	// VerifyDNS 验证 DNS 解析
-	VerifyDNS(ctx context.Context, domain, recordType, expectedValue string) (bool, error)
+	// VerifyDNS 在配置的各个解析器上验证 DNS 解析，返回每个解析器的结果
+	VerifyDNS(ctx context.Context, domain, recordType, expectedValue string) (*DNSVerification, error)
+	
+	// WaitDNSPropagation 轮询直到所有解析器都解析到期望值或超时，timeout 为 0 时使用配置的时间
+	WaitDNSPropagation(ctx context.Context, domain, recordType, expectedValue string, timeout time.Duration) (*DNSVerification, error)
 	
-	// SyncWithProvider 与 DNS 提供商同步
-	SyncWithProvider(ctx context.Context, domain, provider string) error
+	// SyncWithProvider 与 DNS 提供商双向同步：导入本地没有的远端记录，推送本地管理的记录，
+	// 同名同类型但值不同的记录作为冲突返回，不覆盖任何一方
+	SyncWithProvider(ctx context.Context, domain, provider string, userID, tenantID uint) (*DNSSyncResult, error)
 }
 
 // AIOptimizationService AI 网站配置优化服务接口
@@ -0,0 +1,136 @@
+package website
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// SiteRootDir 静态站点托管根目录
+// 静态站点的 docroot 必须位于该目录内，防止通过网站配置暴露任意宿主机目录
+var SiteRootDir = "/var/www"
+
+// validateSiteConfig 校验站点类型相关的必填字段，不修改文件系统
+// 静态站点未指定 docroot 时使用 SiteRootDir 下按域名命名的托管目录，由 ensureDocRoot 在保存时创建
+func validateSiteConfig(website *Website) error {
+	switch website.GetSiteType() {
+	case SiteTypeProxy:
+		return nil
+	case SiteTypeStatic:
+		if website.DocRoot == "" {
+			website.DocRoot = managedDocRoot(website.Domain)
+			return checkNginxValue(website.DocRoot, ErrInvalidDocRoot)
+		}
+		// 托管目录尚未创建（如上次保存失败）时同样交给 ensureDocRoot 创建
+		if website.DocRoot == managedDocRoot(website.Domain) {
+			if _, err := os.Stat(website.DocRoot); os.IsNotExist(err) {
+				return checkNginxValue(website.DocRoot, ErrInvalidDocRoot)
+			}
+		}
+		docRoot, err := resolveDocRoot(website.DocRoot)
+		if err != nil {
+			return err
+		}
+		website.DocRoot = docRoot
+		return nil
+	case SiteTypeRedirect:
+		return validateRedirect(website)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidSiteType, website.SiteType)
+	}
+}
+
+// managedDocRoot 静态站点在 SiteRootDir 下的托管目录
+func managedDocRoot(domain string) string {
+	return filepath.Join(SiteRootDir, sanitizeName(domain))
+}
+
+// ensureDocRoot 保存静态站点前创建托管目录，其他站点类型和自定义 docroot 不做处理
+func ensureDocRoot(website *Website) error {
+	if website.GetSiteType() != SiteTypeStatic || website.DocRoot != managedDocRoot(website.Domain) {
+		return nil
+	}
+	if err := os.MkdirAll(website.DocRoot, 0755); err != nil {
+		return fmt.Errorf("%w: failed to create %s: %v", ErrInvalidDocRoot, website.DocRoot, err)
+	}
+	return nil
+}
+
+// checkNginxValue 拒绝包含空白、引号、;{}$\# 或控制字符的值，这些值会原样写入 nginx 指令，
+// 否则可以结束当前指令并注入任意配置，或用 # 注释掉指令的其余部分
+func checkNginxValue(value string, kind error) error {
+	for _, r := range value {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(";{}'\"$\\#", r) {
+			return fmt.Errorf("%w: %q contains characters not allowed in nginx config", kind, value)
+		}
+	}
+	return nil
+}
+
+// resolveDocRoot 校验 docroot 存在、是目录，且（解析符号链接后）位于 SiteRootDir 内
+func resolveDocRoot(docRoot string) (string, error) {
+	if !filepath.IsAbs(docRoot) {
+		return "", fmt.Errorf("%w: must be an absolute path", ErrInvalidDocRoot)
+	}
+	if err := checkNginxValue(docRoot, ErrInvalidDocRoot); err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(SiteRootDir)
+	if err != nil {
+		return "", fmt.Errorf("%w: site root %s is not accessible: %v", ErrInvalidDocRoot, SiteRootDir, err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(docRoot))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s does not exist", ErrInvalidDocRoot, docRoot)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is outside of %s", ErrInvalidDocRoot, docRoot, SiteRootDir)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a directory", ErrInvalidDocRoot, docRoot)
+	}
+
+	// 符号链接解析后的路径同样写入 nginx 配置
+	if err := checkNginxValue(resolved, ErrInvalidDocRoot); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// validateRedirect 校验跳转目标为有效的 http/https 地址，状态码为 301 或 302
+func validateRedirect(website *Website) error {
+	target, err := url.Parse(website.RedirectURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: %q is not a valid http(s) URL", ErrInvalidRedirect, website.RedirectURL)
+	}
+	if err := checkNginxValue(website.RedirectURL, ErrInvalidRedirect); err != nil {
+		return err
+	}
+
+	switch website.GetRedirectCode() {
+	case 301, 302:
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported status code %d", ErrInvalidRedirect, website.RedirectCode)
+	}
+}
+
+// isSiteConfigError 判断是否为站点配置校验错误
+func isSiteConfigError(err error) bool {
+	for _, target := range []error{ErrInvalidDomain, ErrInvalidSiteType, ErrInvalidDocRoot, ErrInvalidRedirect} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package website
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateSiteConfig(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	originalRoot := SiteRootDir
+	SiteRootDir = root
+	defer func() { SiteRootDir = originalRoot }()
+
+	existing := filepath.Join(root, "exists")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatalf("Failed to create docroot: %v", err)
+	}
+	escape := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, escape); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		website Website
+		wantErr error
+	}{
+		{"proxy without config", Website{Domain: "a.com"}, nil},
+		{"static existing docroot", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: existing}, nil},
+		{"static managed docroot", Website{Domain: "b.com", SiteType: SiteTypeStatic}, nil},
+		{"static missing docroot", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: filepath.Join(root, "missing")}, ErrInvalidDocRoot},
+		{"static docroot outside jail", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: outside}, ErrInvalidDocRoot},
+		{"static docroot traversal", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: root + "/../" + filepath.Base(outside)}, ErrInvalidDocRoot},
+		{"static docroot symlink escape", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: escape}, ErrInvalidDocRoot},
+		{"static relative docroot", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: "exists"}, ErrInvalidDocRoot},
+		{"redirect valid", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "https://b.com/"}, nil},
+		{"redirect 302", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "http://b.com", RedirectCode: 302}, nil},
+		{"redirect missing target", Website{Domain: "a.com", SiteType: SiteTypeRedirect}, ErrInvalidRedirect},
+		{"redirect bad scheme", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "ftp://b.com"}, ErrInvalidRedirect},
+		{"redirect bad code", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "https://b.com", RedirectCode: 307}, ErrInvalidRedirect},
+		{"static docroot injection", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: existing + ";}include /etc/passwd;#"}, ErrInvalidDocRoot},
+		{"static docroot whitespace", Website{Domain: "a.com", SiteType: SiteTypeStatic, DocRoot: existing + " /etc"}, ErrInvalidDocRoot},
+		{"redirect injection", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "https://a.com/x;}include /etc/passwd;#"}, ErrInvalidRedirect},
+		{"redirect variable", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "https://a.com/$host"}, ErrInvalidRedirect},
+		{"redirect newline", Website{Domain: "a.com", SiteType: SiteTypeRedirect, RedirectURL: "https://a.com/\nreturn 200"}, ErrInvalidRedirect},
+		{"unknown type", Website{Domain: "a.com", SiteType: "ftp"}, ErrInvalidSiteType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			website := tt.website
+			err := validateSiteConfig(&website)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil && !isSiteConfigError(err) {
+				t.Errorf("Expected error to be classified as site config error")
+			}
+		})
+	}
+
+	// 未指定 docroot 时使用托管目录，校验不创建目录，保存时由 ensureDocRoot 创建
+	website := Website{Domain: "managed.example.com", SiteType: SiteTypeStatic}
+	if err := validateSiteConfig(&website); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(website.DocRoot); !os.IsNotExist(err) {
+		t.Fatalf("Validation should not create the managed docroot %s", website.DocRoot)
+	}
+	if err := ensureDocRoot(&website); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info, err := os.Stat(website.DocRoot); err != nil || !info.IsDir() {
+		t.Errorf("Expected managed docroot to be created at %s", website.DocRoot)
+	}
+	if err := validateSiteConfig(&website); err != nil {
+		t.Errorf("Created managed docroot should validate: %v", err)
+	}
+}
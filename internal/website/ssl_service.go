@@ -2,20 +2,52 @@ package website
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"qwq/internal/config"
+	"qwq/internal/pagination"
+
 	"gorm.io/gorm"
 )
 
+// IssueFunc 向 CA 申请覆盖 domains 的证书
+type IssueFunc func(ctx context.Context, domains []string, email string) (*CertificateBundle, error)
+
 // sslService SSL 证书服务实现
 type sslService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	issue IssueFunc
 }
 
-// NewSSLService 创建 SSL 服务实例
+// NewSSLService 创建 SSL 服务实例，Let's Encrypt 证书按 acme 配置签发
 func NewSSLService(db *gorm.DB) SSLService {
-	return &sslService{db: db}
+	return NewSSLServiceWithIssuer(db, acmeIssuer(NewDNSService(db)))
+}
+
+// NewSSLServiceWithIssuer 创建使用 issue 签发 Let's Encrypt 证书的 SSL 服务实例
+func NewSSLServiceWithIssuer(db *gorm.DB, issue IssueFunc) SSLService {
+	return &sslService{db: db, issue: issue}
+}
+
+// acmeIssuer 每次签发时按当前的 acme 配置创建 ACME 客户端，email 为空时使用配置的邮箱
+func acmeIssuer(records DNSService) IssueFunc {
+	return func(ctx context.Context, domains []string, email string) (*CertificateBundle, error) {
+		cfg := config.Current().ACME
+		opts, err := ACMEOptionsFromConfig(cfg, records)
+		if err != nil {
+			return nil, err
+		}
+		if email != "" {
+			opts.Email = email
+		}
+		client, err := NewACMEClient(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create acme client: %w", err)
+		}
+		return client.ObtainCertificate(ctx, domains)
+	}
 }
 
 // CreateSSLCert 创建 SSL 证书记录
@@ -73,6 +105,24 @@ func (s *sslService) ListSSLCerts(ctx context.Context, userID, tenantID uint) ([
 	return certs, nil
 }
 
+// QuerySSLCerts 分页列出 SSL 证书
+func (s *sslService) QuerySSLCerts(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*SSLCert], error) {
+	query := s.db.WithContext(ctx).Model(&SSLCert{})
+	
+	if tenantID > 0 {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	page, err := pagination.Find[*SSLCert](query, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssl certs: %w", err)
+	}
+	return page, nil
+}
+
 // UpdateSSLCert 更新 SSL 证书
 func (s *sslService) UpdateSSLCert(ctx context.Context, cert *SSLCert) error {
 	// 检查证书是否存在
@@ -107,14 +157,21 @@ func (s *sslService) RequestCertificate(ctx context.Context, domain, email strin
 	// 创建证书记录
 	now := time.Now()
 	autoRenew := true
-	
+	renewDays := config.Current().ACME.RenewDays
+	if renewDays <= 0 {
+		renewDays = DefaultRenewDays
+	}
+	if email == "" {
+		email = config.Current().ACME.Email
+	}
+
 	cert := &SSLCert{
 		Domain:          domain,
 		Provider:        provider,
 		Status:          SSLStatusPending,
 		Email:           email,
 		AutoRenew:       &autoRenew,
-		RenewDaysBefore: 30,
+		RenewDaysBefore: renewDays,
 		IssueDate:       &now,
 	}
 
@@ -122,29 +179,19 @@ func (s *sslService) RequestCertificate(ctx context.Context, domain, email strin
 	switch provider {
 	case SSLProviderLetsEncrypt:
 		// 使用 Let's Encrypt 申请证书
-		bundle, err := s.requestLetsEncryptCert(ctx, domain, email)
+		bundle, err := s.issue(ctx, []string{domain}, email)
 		if err != nil {
 			cert.Status = SSLStatusError
 			s.CreateSSLCert(ctx, cert)
 			return nil, fmt.Errorf("failed to request certificate: %w", err)
 		}
 
-		// 保存证书文件
-		certPath, keyPath, err := bundle.SaveToFile()
-		if err != nil {
+		if err := s.store(cert, bundle); err != nil {
 			cert.Status = SSLStatusError
 			s.CreateSSLCert(ctx, cert)
-			return nil, fmt.Errorf("failed to save certificate: %w", err)
+			return nil, err
 		}
 
-		// 更新证书信息
-		cert.CertPath = certPath
-		cert.KeyPath = keyPath
-		cert.CertContent = string(bundle.Certificate)
-		cert.KeyContent = string(bundle.PrivateKey)
-		cert.ExpiryDate = &bundle.NotAfter
-		cert.Status = SSLStatusValid
-
 	case SSLProviderSelfSigned:
 		// 生成自签名证书
 		bundle, err := generateSelfSignedCert(domain)
@@ -154,20 +201,12 @@ func (s *sslService) RequestCertificate(ctx context.Context, domain, email strin
 			return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
 		}
 
-		certPath, keyPath, err := bundle.SaveToFile()
-		if err != nil {
+		if err := s.store(cert, bundle); err != nil {
 			cert.Status = SSLStatusError
 			s.CreateSSLCert(ctx, cert)
-			return nil, fmt.Errorf("failed to save certificate: %w", err)
+			return nil, err
 		}
 
-		cert.CertPath = certPath
-		cert.KeyPath = keyPath
-		cert.CertContent = string(bundle.Certificate)
-		cert.KeyContent = string(bundle.PrivateKey)
-		cert.ExpiryDate = &bundle.NotAfter
-		cert.Status = SSLStatusValid
-
 	case SSLProviderManual:
 		// 手动上传证书，只创建记录
 		expiryDate := now.AddDate(1, 0, 0) // 默认1年有效期
@@ -184,81 +223,68 @@ func (s *sslService) RequestCertificate(ctx context.Context, domain, email strin
 	return cert, nil
 }
 
-// requestLetsEncryptCert 使用 Let's Encrypt 申请证书
-func (s *sslService) requestLetsEncryptCert(ctx context.Context, domain, email string) (*CertificateBundle, error) {
-	// 创建 ACME 客户端（使用生产环境）
-	client, err := NewACMEClient(false)
+// store 将证书和私钥保存到 acme.cert_dir，并把证书的元数据写入 cert
+func (s *sslService) store(cert *SSLCert, bundle *CertificateBundle) error {
+	certPath, keyPath, err := bundle.SaveTo(certDir())
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to save certificate: %w", err)
 	}
 
-	// 获取证书
-	return client.ObtainCertificate(ctx, domain, email)
+	now := time.Now()
+	notBefore, notAfter := bundle.NotBefore, bundle.NotAfter
+	cert.CertPath = certPath
+	cert.KeyPath = keyPath
+	cert.CertContent = string(bundle.Certificate)
+	cert.KeyContent = string(bundle.PrivateKey)
+	cert.Issuer = bundle.Issuer
+	cert.SANs = bundle.Domains
+	cert.IssueDate = &now
+	cert.NotBefore = &notBefore
+	cert.ExpiryDate = &notAfter
+	cert.Status = SSLStatusValid
+	return nil
 }
 
-// RenewCertificate 续期证书
+// RenewCertificate 续期证书，证书还未进入续期窗口时返回 ErrRenewalNotDue。
+// Let's Encrypt 续期失败时保留原来的证书和状态，原证书在过期前仍然可用，下次检查时重试
 func (s *sslService) RenewCertificate(ctx context.Context, certID uint) error {
 	cert, err := s.GetSSLCert(ctx, certID)
 	if err != nil {
 		return err
 	}
+	if cert.Provider == SSLProviderManual {
+		return fmt.Errorf("manual certificates cannot be auto-renewed")
+	}
+	if !cert.RenewalDue(time.Now()) {
+		return fmt.Errorf("%w: %s expires at %s", ErrRenewalNotDue, cert.Domain, cert.ExpiryDate.Format(time.RFC3339))
+	}
 
 	// 根据提供商续期证书
 	switch cert.Provider {
 	case SSLProviderLetsEncrypt:
-		// 使用 Let's Encrypt 续期证书
-		client, err := NewACMEClient(false)
-		if err != nil {
-			return fmt.Errorf("failed to create acme client: %w", err)
+		// 按原证书的全部域名重新签发
+		domains := cert.SANs
+		if len(domains) == 0 {
+			domains = []string{cert.Domain}
 		}
-
-		bundle, err := client.RenewCertificate(ctx, cert.Domain, cert.Email)
+		bundle, err := s.issue(ctx, domains, cert.Email)
 		if err != nil {
-			cert.Status = SSLStatusError
-			s.UpdateSSLCert(ctx, cert)
 			return fmt.Errorf("failed to renew certificate: %w", err)
 		}
-
-		// 保存新证书
-		certPath, keyPath, err := bundle.SaveToFile()
-		if err != nil {
-			return fmt.Errorf("failed to save certificate: %w", err)
+		if err := s.store(cert, bundle); err != nil {
+			return err
 		}
 
-		// 更新证书信息
-		now := time.Now()
-		cert.CertPath = certPath
-		cert.KeyPath = keyPath
-		cert.CertContent = string(bundle.Certificate)
-		cert.KeyContent = string(bundle.PrivateKey)
-		cert.IssueDate = &now
-		cert.ExpiryDate = &bundle.NotAfter
-		cert.Status = SSLStatusValid
-
 	case SSLProviderSelfSigned:
 		// 重新生成自签名证书
 		bundle, err := generateSelfSignedCert(cert.Domain)
 		if err != nil {
 			return fmt.Errorf("failed to generate self-signed certificate: %w", err)
 		}
-
-		certPath, keyPath, err := bundle.SaveToFile()
-		if err != nil {
-			return fmt.Errorf("failed to save certificate: %w", err)
+		if err := s.store(cert, bundle); err != nil {
+			return err
 		}
 
-		now := time.Now()
-		cert.CertPath = certPath
-		cert.KeyPath = keyPath
-		cert.CertContent = string(bundle.Certificate)
-		cert.KeyContent = string(bundle.PrivateKey)
-		cert.IssueDate = &now
-		cert.ExpiryDate = &bundle.NotAfter
-		cert.Status = SSLStatusValid
-
-	case SSLProviderManual:
-		return fmt.Errorf("manual certificates cannot be auto-renewed")
-
 	default:
 		return fmt.Errorf("unsupported provider: %s", cert.Provider)
 	}
@@ -283,26 +309,58 @@ func (s *sslService) CheckExpiry(ctx context.Context) ([]*SSLCert, error) {
 	return certs, nil
 }
 
-// AutoRenew 自动续期即将过期的证书
-func (s *sslService) AutoRenew(ctx context.Context) error {
-	certs, err := s.CheckExpiry(ctx)
+// RenewalResult 一张证书的续期结果
+type RenewalResult struct {
+	Cert *SSLCert
+	Err  error
+}
+
+// RenewDue 续期 CheckExpiry 找到的已进入续期窗口的证书，有证书续期成功时调用 reload（可为空）使 nginx 加载新证书。
+// 返回每张证书的续期结果；检查过期失败或 reload 失败时返回错误
+func RenewDue(ctx context.Context, certs SSLService, reload func(ctx context.Context) error) ([]RenewalResult, error) {
+	expiring, err := certs.CheckExpiry(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, cert := range certs {
-		// 检查是否需要续期
-		if cert.ExpiryDate != nil {
-			daysUntilExpiry := int(time.Until(*cert.ExpiryDate).Hours() / 24)
-			if daysUntilExpiry <= cert.RenewDaysBefore {
-				if err := s.RenewCertificate(ctx, cert.ID); err != nil {
-					// 记录错误但继续处理其他证书
-					fmt.Printf("failed to renew certificate %d: %v\n", cert.ID, err)
-					continue
-				}
+	now := time.Now()
+	var results []RenewalResult
+	renewed := false
+	for _, cert := range expiring {
+		if !cert.RenewalDue(now) {
+			continue
+		}
+		err := certs.RenewCertificate(ctx, cert.ID)
+		if err == nil {
+			// 返回续期后的证书信息
+			if updated, getErr := certs.GetSSLCert(ctx, cert.ID); getErr == nil {
+				cert = updated
 			}
+			renewed = true
 		}
+		results = append(results, RenewalResult{Cert: cert, Err: err})
 	}
 
-	return nil
+	if renewed && reload != nil {
+		if err := reload(ctx); err != nil {
+			return results, fmt.Errorf("failed to reload nginx after certificate renewal: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// AutoRenew 自动续期即将过期的证书，返回所有续期失败的错误
+func (s *sslService) AutoRenew(ctx context.Context) error {
+	results, err := RenewDue(ctx, s, nil)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("certificate %d (%s): %w", result.Cert.ID, result.Cert.Domain, result.Err))
+		}
+	}
+	return errors.Join(errs...)
 }
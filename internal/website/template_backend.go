@@ -0,0 +1,347 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"qwq/internal/appstore"
+	"qwq/internal/container"
+)
+
+// 模板后端部署的各个阶段，失败时在结果中报告
+const (
+	StageInstall = "install"       // 从模板安装应用
+	StageWait    = "wait_running"  // 等待实例进入 running 状态
+	StagePort    = "discover_port" // 查找实例发布到主机的端口
+	StageProxy   = "proxy_config"  // 创建反向代理配置
+	StageWebsite = "website"       // 创建网站记录
+	StageNginx   = "nginx"         // 生成、写入并重载 nginx 配置
+)
+
+// 等待实例启动的默认参数
+const (
+	defaultBackendWaitTimeout  = 5 * time.Minute
+	defaultBackendPollInterval = time.Second
+)
+
+var (
+	// ErrBackendNotRunning 实例安装失败或超时仍未进入 running 状态
+	ErrBackendNotRunning = errors.New("backend instance is not running")
+	// ErrNoPublishedPort 实例没有发布到主机的端口，无法作为代理后端
+	ErrNoPublishedPort = errors.New("backend instance publishes no host port")
+)
+
+// BackendTemplate 创建网站时一并部署的应用商店模板，TemplateID 和 Template（模板名称）二选一
+type BackendTemplate struct {
+	TemplateID   uint                   `json:"template_id,omitempty"`
+	Template     string                 `json:"template,omitempty"`
+	InstanceName string                 `json:"instance_name,omitempty"` // 实例名称，默认由域名生成
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+	Service      string                 `json:"service,omitempty"` // 作为后端的 compose 服务，模板有多个服务发布端口时指定
+	AutoResolve  bool                   `json:"auto_resolve,omitempty"`
+}
+
+// StageError 模板后端部署在某个阶段失败
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string { return fmt.Sprintf("%s: %v", e.Stage, e.Err) }
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// TemplateSiteResult 创建网站并部署模板后端的结果
+type TemplateSiteResult struct {
+	WebsiteID   uint     `json:"website_id,omitempty"`
+	InstanceID  uint     `json:"instance_id,omitempty"`
+	ProgressID  string   `json:"progress_id,omitempty"`
+	Backend     string   `json:"backend,omitempty"` // 自动发现的后端地址
+	Website     *Website `json:"website,omitempty"`
+	FailedStage string   `json:"failed_stage,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	RolledBack  []string `json:"rolled_back,omitempty"`     // 已回滚的阶段，按回滚顺序
+	RollbackErr []string `json:"rollback_errors,omitempty"` // 回滚失败的阶段和原因，需要手动清理
+}
+
+// TemplateSiteDeployer 创建网站时从应用商店模板部署后端：安装应用、等待实例运行、发现发布的端口、
+// 生成代理配置和网站记录、写入并重载 nginx 配置。任一阶段失败时按相反顺序回滚已完成的阶段
+type TemplateSiteDeployer struct {
+	Websites  WebsiteService
+	Proxies   ProxyService
+	Store     appstore.AppStoreService
+	Installer appstore.InstallerService
+
+	// ApplyNginx 写入、启用并重载站点配置，RemoveNginx 回滚时删除站点配置，测试中替换
+	ApplyNginx  func(ctx context.Context, domain, config string) error
+	RemoveNginx func(ctx context.Context, domain string) error
+
+	WaitTimeout  time.Duration // 等待实例运行的超时时间，默认 5 分钟
+	PollInterval time.Duration // 查询安装进度的间隔，默认 1 秒
+}
+
+// NewTemplateSiteDeployer 创建模板后端部署器，nginx 配置写入 NginxConfigDir 并通过 proxies 重载
+func NewTemplateSiteDeployer(websites WebsiteService, proxies ProxyService, store appstore.AppStoreService, installer appstore.InstallerService) *TemplateSiteDeployer {
+	return &TemplateSiteDeployer{
+		Websites:  websites,
+		Proxies:   proxies,
+		Store:     store,
+		Installer: installer,
+		ApplyNginx: func(ctx context.Context, domain, config string) error {
+			if err := WriteNginxConfig(domain, config); err != nil {
+				return err
+			}
+			if err := EnableNginxSite(domain); err != nil {
+				return err
+			}
+			return proxies.ReloadNginx(ctx)
+		},
+		RemoveNginx: func(ctx context.Context, domain string) error {
+			if err := RemoveNginxConfig(domain); err != nil {
+				return err
+			}
+			return proxies.ReloadNginx(ctx)
+		},
+	}
+}
+
+// Create 部署模板后端并创建指向它的网站。失败时返回 *StageError，result 中记录失败的阶段和回滚情况
+func (d *TemplateSiteDeployer) Create(ctx context.Context, website *Website, backend *BackendTemplate) (*TemplateSiteResult, error) {
+	result := &TemplateSiteResult{}
+	// 安装之前先做不需要后端的校验，避免明显无效的请求触发安装和回滚
+	if website.GetSiteType() != SiteTypeProxy {
+		return result, fmt.Errorf("%w: backend_template requires a proxy site", ErrInvalidSiteType)
+	}
+	if !isValidDomain(website.Domain) {
+		return result, ErrInvalidDomain
+	}
+	if _, err := d.Websites.GetWebsiteByDomain(ctx, website.Domain); err == nil {
+		return result, ErrWebsiteExists
+	}
+
+	var rollbacks []rollbackStep
+	fail := func(stage string, err error) (*TemplateSiteResult, error) {
+		result.FailedStage, result.Error = stage, err.Error()
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			if rbErr := rollbacks[i].undo(); rbErr != nil {
+				result.RollbackErr = append(result.RollbackErr, fmt.Sprintf("%s: %v", rollbacks[i].stage, rbErr))
+				continue
+			}
+			result.RolledBack = append(result.RolledBack, rollbacks[i].stage)
+		}
+		return result, &StageError{Stage: stage, Err: err}
+	}
+	// 回滚不受请求取消的影响
+	cleanup := context.WithoutCancel(ctx)
+
+	template, err := d.resolveTemplate(ctx, backend)
+	if err != nil {
+		return fail(StageInstall, err)
+	}
+	instanceName := backend.InstanceName
+	if instanceName == "" {
+		instanceName = sanitizeName(website.Domain)
+	}
+	installed, err := d.Installer.Install(ctx, &appstore.InstallRequest{
+		TemplateID:   template.ID,
+		InstanceName: instanceName,
+		Parameters:   backend.Parameters,
+		UserID:       website.UserID,
+		TenantID:     website.TenantID,
+		AutoResolve:  backend.AutoResolve,
+	})
+	if err != nil {
+		return fail(StageInstall, err)
+	}
+	result.InstanceID, result.ProgressID = installed.InstanceID, installed.ProgressID
+	rollbacks = append(rollbacks, rollbackStep{StageInstall, func() error {
+		return d.Installer.Uninstall(cleanup, &appstore.UninstallRequest{InstanceID: installed.InstanceID, Force: true})
+	}})
+
+	instance, err := d.waitRunning(ctx, installed)
+	if err != nil {
+		return fail(StageWait, err)
+	}
+
+	backendURL, err := d.discoverBackend(ctx, instance, backend)
+	if err != nil {
+		return fail(StagePort, err)
+	}
+	result.Backend = backendURL
+
+	proxy := &ProxyConfig{
+		Name:      website.Domain,
+		ProxyType: ProxyTypeReverse,
+		Backends:  []BackendServer{{URL: backendURL}},
+		UserID:    website.UserID,
+		TenantID:  website.TenantID,
+	}
+	if err := d.Proxies.CreateProxyConfig(ctx, proxy); err != nil {
+		return fail(StageProxy, err)
+	}
+	rollbacks = append(rollbacks, rollbackStep{StageProxy, func() error {
+		return d.Proxies.DeleteProxyConfig(cleanup, proxy.ID)
+	}})
+
+	website.ProxyConfigID = &proxy.ID
+	website.Status = StatusActive
+	if err := d.Websites.CreateWebsite(ctx, website); err != nil {
+		return fail(StageWebsite, err)
+	}
+	result.WebsiteID = website.ID
+	rollbacks = append(rollbacks, rollbackStep{StageWebsite, func() error {
+		return d.Websites.DeleteWebsite(cleanup, website.ID)
+	}})
+
+	website.ProxyConfig = proxy
+	nginxConfig, err := d.Proxies.GenerateNginxConfig(ctx, website)
+	if err == nil {
+		err = d.ApplyNginx(ctx, website.Domain, nginxConfig)
+	}
+	if err != nil {
+		// 配置可能已部分写入，先删除再回滚前面的阶段
+		rollbacks = append(rollbacks, rollbackStep{StageNginx, func() error {
+			return d.RemoveNginx(cleanup, website.Domain)
+		}})
+		return fail(StageNginx, err)
+	}
+
+	result.Website = website
+	return result, nil
+}
+
+// rollbackStep 已完成阶段的回滚操作
+type rollbackStep struct {
+	stage string
+	undo  func() error
+}
+
+func (d *TemplateSiteDeployer) resolveTemplate(ctx context.Context, backend *BackendTemplate) (*appstore.AppTemplate, error) {
+	switch {
+	case backend.TemplateID > 0:
+		return d.Store.GetTemplate(ctx, backend.TemplateID)
+	case backend.Template != "":
+		return d.Store.GetTemplateByName(ctx, backend.Template)
+	}
+	return nil, fmt.Errorf("%w: template_id or template is required", appstore.ErrTemplateNotFound)
+}
+
+// waitRunning 轮询安装进度，安装完成后确认实例状态为 running
+func (d *TemplateSiteDeployer) waitRunning(ctx context.Context, installed *appstore.InstallResult) (*appstore.ApplicationInstance, error) {
+	timeout, interval := d.WaitTimeout, d.PollInterval
+	if timeout <= 0 {
+		timeout = defaultBackendWaitTimeout
+	}
+	if interval <= 0 {
+		interval = defaultBackendPollInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		progress, err := d.Installer.GetProgress(ctx, installed.ProgressID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get install progress: %w", err)
+		}
+		switch progress.Status {
+		case appstore.StatusCompleted:
+			instance, err := d.Store.GetInstance(ctx, installed.InstanceID)
+			if err != nil {
+				return nil, err
+			}
+			if instance.Status != string(appstore.InstanceStatusRunning) {
+				return nil, fmt.Errorf("%w: instance status %s", ErrBackendNotRunning, instance.Status)
+			}
+			return instance, nil
+		case appstore.StatusFailed, appstore.StatusRolledBack:
+			return nil, fmt.Errorf("%w: %s %s", ErrBackendNotRunning, progress.Message, progress.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s after %s (%v)", ErrBackendNotRunning, progress.Status, timeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// discoverBackend 从实例渲染后的 compose 中找出发布到主机的端口，生成代理后端地址
+func (d *TemplateSiteDeployer) discoverBackend(ctx context.Context, instance *appstore.ApplicationInstance, backend *BackendTemplate) (string, error) {
+	compose, err := d.Store.RenderTemplate(ctx, instance.TemplateID, backend.Parameters)
+	if err != nil {
+		return "", err
+	}
+	project, err := container.NewComposeParser().Parse(compose)
+	if err != nil {
+		return "", err
+	}
+	host, port, err := publishedPort(project, backend.Service)
+	if err != nil {
+		return "", err
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// publishedPort 选出作为后端的服务的第一个主机端口：指定了 service 时只看该服务，
+// 否则按服务名顺序取第一个发布了端口的服务。监听所有网卡的端口通过 127.0.0.1 访问
+func publishedPort(project *container.ComposeConfig, service string) (string, int, error) {
+	names := make([]string, 0, len(project.Services))
+	for name := range project.Services {
+		if service == "" || name == service {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", 0, fmt.Errorf("%w: service %q not found", ErrNoPublishedPort, service)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, spec := range project.Services[name].Ports {
+			if host, port, ok := parsePublished(spec); ok {
+				return host, port, nil
+			}
+		}
+	}
+	return "", 0, ErrNoPublishedPort
+}
+
+// parsePublished 解析 "8080:80"、"127.0.0.1:8080:80/tcp"、"[::1]:8080:80"、"8080-8081:80-81" 中的主机地址和端口，
+// 只写容器端口（由 Docker 随机分配主机端口）时返回 false
+func parsePublished(spec string) (string, int, bool) {
+	spec, _, _ = strings.Cut(strings.Trim(strings.TrimSpace(spec), `"'`), "/")
+	var hostIP, hostPort string
+	if ip, rest, ok := strings.Cut(strings.TrimPrefix(spec, "["), "]:"); ok && strings.HasPrefix(spec, "[") {
+		hostIP, spec = ip, rest
+		hostPort, _, ok = strings.Cut(spec, ":")
+		if !ok {
+			return "", 0, false
+		}
+	} else {
+		parts := strings.Split(spec, ":")
+		switch len(parts) {
+		case 2:
+			hostPort = parts[0]
+		case 3:
+			hostIP, hostPort = parts[0], parts[1]
+		default:
+			return "", 0, false
+		}
+	}
+	hostPort, _, _ = strings.Cut(hostPort, "-")
+	port, err := strconv.Atoi(hostPort)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, false
+	}
+	if hostIP == "" || hostIP == "0.0.0.0" || hostIP == "::" {
+		hostIP = "127.0.0.1"
+	}
+	return hostIP, port, true
+}
@@ -0,0 +1,170 @@
+package website
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"qwq/internal/appstore"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testBackendCompose = `version: '3.8'
+services:
+  db:
+    image: mysql:8
+    expose:
+      - "3306"
+  app:
+    image: wordpress:latest
+    ports:
+      - "{{.port}}:80"
+`
+
+// newTestDeployer 使用内存数据库和真实的网站、代理、应用商店服务，nginx 操作由测试记录
+func newTestDeployer(t *testing.T, content string) (*TemplateSiteDeployer, appstore.AppStoreService, *[]string) {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Website{}, &ProxyConfig{}, &SSLCert{}, &appstore.AppTemplate{}, &appstore.ApplicationInstance{}); err != nil {
+		t.Fatal(err)
+	}
+	template := &appstore.AppTemplate{
+		Name: "wordpress", DisplayName: "WordPress", Category: appstore.CategoryWebServer,
+		Type: appstore.TemplateTypeDockerCompose, Version: "1.0.0", Status: appstore.TemplateStatusPublished,
+		Content:    content,
+		Parameters: `[{"name":"port","type":"int","default_value":8080,"required":true}]`,
+	}
+	if err := db.Create(template).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	store := appstore.NewAppStoreService(db)
+	proxies := NewProxyService(db)
+	deployer := NewTemplateSiteDeployer(NewWebsiteService(db), proxies, store, appstore.NewInstallerService(store))
+	deployer.PollInterval = 10 * time.Millisecond
+	deployer.WaitTimeout = 5 * time.Second
+	var nginx []string
+	deployer.ApplyNginx = func(ctx context.Context, domain, config string) error {
+		nginx = append(nginx, "apply "+domain)
+		return nil
+	}
+	deployer.RemoveNginx = func(ctx context.Context, domain string) error {
+		nginx = append(nginx, "remove "+domain)
+		return nil
+	}
+	return deployer, store, &nginx
+}
+
+func TestTemplateSiteDeployer_Create(t *testing.T) {
+	deployer, store, nginx := newTestDeployer(t, testBackendCompose)
+	ctx := context.Background()
+
+	site := &Website{Name: "blog", Domain: "blog.example.com", UserID: 1, TenantID: 1}
+	result, err := deployer.Create(ctx, site, &BackendTemplate{Template: "wordpress", Parameters: map[string]interface{}{"port": 18080}})
+	if err != nil {
+		t.Fatalf("Create failed: %v (%+v)", err, result)
+	}
+	if result.Backend != "http://127.0.0.1:18080" || result.WebsiteID == 0 || result.InstanceID == 0 {
+		t.Fatalf("Expected the published port of the app service as backend, got %+v", result)
+	}
+
+	saved, err := deployer.Websites.GetWebsite(ctx, result.WebsiteID)
+	if err != nil || saved.Status != StatusActive || saved.ProxyConfig == nil || saved.ProxyConfig.Backends[0].URL != result.Backend {
+		t.Fatalf("Expected an active website proxying to the backend, got %+v, %v", saved, err)
+	}
+	if instance, err := store.GetInstance(ctx, result.InstanceID); err != nil || instance.Status != "running" || instance.Name != "blog_example_com" {
+		t.Errorf("Expected a running instance named after the domain, got %+v, %v", instance, err)
+	}
+	if !reflect.DeepEqual(*nginx, []string{"apply blog.example.com"}) {
+		t.Errorf("Expected the nginx config applied once, got %v", *nginx)
+	}
+
+	// 域名已存在时在安装之前拒绝
+	if _, err := deployer.Create(ctx, &Website{Domain: "blog.example.com"}, &BackendTemplate{Template: "wordpress"}); !errors.Is(err, ErrWebsiteExists) {
+		t.Errorf("Expected ErrWebsiteExists before installing, got %v", err)
+	}
+}
+
+func TestTemplateSiteDeployer_RollsBackOnNginxFailure(t *testing.T) {
+	deployer, store, nginx := newTestDeployer(t, testBackendCompose)
+	ctx := context.Background()
+	deployer.ApplyNginx = func(ctx context.Context, domain, config string) error {
+		return errors.New("nginx: [emerg] unknown directive")
+	}
+
+	site := &Website{Name: "shop", Domain: "shop.example.com", UserID: 1, TenantID: 1}
+	result, err := deployer.Create(ctx, site, &BackendTemplate{Template: "wordpress", Parameters: map[string]interface{}{"port": 18081}})
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != StageNginx || result.FailedStage != StageNginx {
+		t.Fatalf("Expected failure at the nginx stage, got %v (%+v)", err, result)
+	}
+	if want := []string{StageNginx, StageWebsite, StageProxy, StageInstall}; !reflect.DeepEqual(result.RolledBack, want) || len(result.RollbackErr) != 0 {
+		t.Errorf("Expected every stage rolled back in reverse order, got %v / %v", result.RolledBack, result.RollbackErr)
+	}
+	if !reflect.DeepEqual(*nginx, []string{"remove shop.example.com"}) {
+		t.Errorf("Expected the partial nginx config removed, got %v", *nginx)
+	}
+
+	if _, err := deployer.Websites.GetWebsiteByDomain(ctx, "shop.example.com"); !errors.Is(err, ErrWebsiteNotFound) {
+		t.Errorf("Expected the website removed, got %v", err)
+	}
+	if configs, _ := deployer.Proxies.ListProxyConfigs(ctx, 0, 0); len(configs) != 0 {
+		t.Errorf("Expected the proxy config removed, got %d", len(configs))
+	}
+	if _, err := store.GetInstance(ctx, result.InstanceID); !errors.Is(err, appstore.ErrInstanceNotFound) {
+		t.Errorf("Expected the instance uninstalled, got %v", err)
+	}
+}
+
+func TestTemplateSiteDeployer_NoPublishedPort(t *testing.T) {
+	deployer, store, _ := newTestDeployer(t, "version: '3.8'\nservices:\n  worker:\n    image: busybox\n    expose:\n      - \"{{.port}}\"\n")
+	ctx := context.Background()
+
+	result, err := deployer.Create(ctx, &Website{Domain: "worker.example.com", UserID: 1, TenantID: 1}, &BackendTemplate{TemplateID: 1, Parameters: map[string]interface{}{"port": 9000}})
+	if !errors.Is(err, ErrNoPublishedPort) || result.FailedStage != StagePort {
+		t.Fatalf("Expected ErrNoPublishedPort at the port stage, got %v (%+v)", err, result)
+	}
+	if !reflect.DeepEqual(result.RolledBack, []string{StageInstall}) {
+		t.Errorf("Expected only the install rolled back, got %v", result.RolledBack)
+	}
+	if _, err := store.GetInstance(ctx, result.InstanceID); !errors.Is(err, appstore.ErrInstanceNotFound) {
+		t.Errorf("Expected the instance uninstalled, got %v", err)
+	}
+}
+
+func TestParsePublished(t *testing.T) {
+	tests := []struct {
+		spec string
+		host string
+		port int
+		ok   bool
+	}{
+		{"8080:80", "127.0.0.1", 8080, true},
+		{"10.0.0.5:9000:80/tcp", "10.0.0.5", 9000, true},
+		{"0.0.0.0:8443:443", "127.0.0.1", 8443, true},
+		{"[::1]:8081:80", "::1", 8081, true},
+		{"3000-3005:3000-3005", "127.0.0.1", 3000, true},
+		{"80", "", 0, false},
+		{"${PORT}:80", "", 0, false},
+	}
+	for _, tt := range tests {
+		host, port, ok := parsePublished(tt.spec)
+		if host != tt.host || port != tt.port || ok != tt.ok {
+			t.Errorf("parsePublished(%q) = %q, %d, %v; want %q, %d, %v", tt.spec, host, port, ok, tt.host, tt.port, tt.ok)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package website
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -62,6 +63,25 @@ func genValidLoadBalanceMethod() gopter.Gen {
 	)
 }
 
+// genBackendServer 生成后端服务器：随机权重、备用标记和失败参数，0 表示使用默认值
+func genBackendServer() gopter.Gen {
+	return gopter.CombineGens(
+		genValidBackend(),      // 后端地址
+		gen.IntRange(0, 10),    // 权重
+		gen.Bool(),             // 是否为备用服务器
+		gen.IntRange(0, 5),     // max_fails
+		gen.IntRange(0, 60),    // fail_timeout（秒）
+	).Map(func(values []interface{}) BackendServer {
+		return BackendServer{
+			URL:         values[0].(string),
+			Weight:      values[1].(int),
+			Backup:      values[2].(bool),
+			MaxFails:    values[3].(int),
+			FailTimeout: values[4].(int),
+		}
+	})
+}
+
 // genProxyConfig 生成有效的代理配置
 // multiBackend: true 生成多后端配置（用于负载均衡测试），false 生成单后端配置
 func genProxyConfig(multiBackend bool) gopter.Gen {
@@ -70,26 +90,33 @@ func genProxyConfig(multiBackend bool) gopter.Gen {
 		return gopter.CombineGens(
 			gen.Identifier(),                                 // 配置名称
 			genValidLoadBalanceMethod(),                      // 负载均衡方法
-			gen.SliceOfN(3, genValidBackend()),              // 生成3个后端服务器
+			gen.SliceOfN(3, genBackendServer()),             // 生成3个后端服务器
 			gen.IntRange(30, 120),                           // 超时时间（秒）
 			gen.IntRange(10485760, 52428800),                // 请求体大小限制（10MB - 50MB）
+			gen.Bool(),                                      // 是否启用健康检查
 		).Map(func(values []interface{}) *ProxyConfig {
 			name := values[0].(string)
 			lbMethod := values[1].(LoadBalanceMethod)
-			backends := values[2].([]string)
+			backends := values[2].([]BackendServer)
 			timeout := values[3].(int)
 			maxBodySize := int64(values[4].(int))
+			healthCheck := values[5].(bool)
 			
-			// 将后端列表转换为 JSON 数组
-			backendsJSON, _ := json.Marshal(backends)
+			// 第一个后端始终是主服务器；ip_hash 不支持备用服务器
+			backends[0].Backup = false
+			if lbMethod == LoadBalanceIPHash {
+				for i := range backends {
+					backends[i].Backup = false
+				}
+			}
 			
 			return &ProxyConfig{
 				ID:                  1,
 				Name:                name,
 				ProxyType:           ProxyTypeReverse,
-				Backend:             string(backendsJSON),
+				Backends:            backends,
 				LoadBalanceMethod:   lbMethod,
-				HealthCheckEnabled:  true,
+				HealthCheckEnabled:  healthCheck,
 				HealthCheckPath:     "/health",
 				HealthCheckInterval: 30,
 				Timeout:             timeout,
@@ -116,7 +143,7 @@ func genProxyConfig(multiBackend bool) gopter.Gen {
 			ID:                  1,
 			Name:                name,
 			ProxyType:           ProxyTypeReverse,
-			Backend:             backend,
+			Backends:            []BackendServer{{URL: backend}},
 			LoadBalanceMethod:   LoadBalanceRoundRobin,
 			HealthCheckEnabled:  true,
 			HealthCheckPath:     "/health",
@@ -389,12 +416,127 @@ func TestProperty10_ConfigGeneration_LoadBalancing(t *testing.T) {
 					return false
 				}
 			case LoadBalanceWeighted:
-				if !strings.Contains(config, "weight=") {
-					t.Logf("加权轮询配置缺少 weight 参数")
+				// 每个后端都显式输出权重，未设置时为 1
+				lines := upstreamServerLines(config)
+				for i, backend := range website.ProxyConfig.Backends {
+					want := backend.Weight
+					if want == 0 {
+						want = 1
+					}
+					if !strings.Contains(lines[i], fmt.Sprintf(" weight=%d", want)) {
+						t.Logf("后端 %s 的权重应为 %d: %s", backend.URL, want, lines[i])
+						return false
+					}
+				}
+			}
+			
+			return true
+		},
+		genWebsite(false, true),
+	))
+	
+	// Property 6.1: upstream 中每个 server 反映后端的全部字段
+	// 验证地址、权重、备用标记和失败参数与 BackendServer 一致，顺序与配置一致
+	properties.Property("upstream server 反映后端字段", prop.ForAll(
+		func(website *Website) bool {
+			generator := NewNginxConfigGenerator(website)
+			config, err := generator.Generate()
+			
+			if err != nil {
+				t.Logf("配置生成失败: %v", err)
+				return false
+			}
+			
+			proxy := website.ProxyConfig
+			lines := upstreamServerLines(config)
+			if len(lines) != len(proxy.Backends) {
+				t.Logf("upstream server 数量 %d 与后端数量 %d 不一致", len(lines), len(proxy.Backends))
+				return false
+			}
+			for i, backend := range proxy.Backends {
+				line := lines[i]
+				if !strings.HasPrefix(line, "server "+backend.hostPort()) {
+					t.Logf("server 地址应为 %s: %s", backend.hostPort(), line)
+					return false
+				}
+				if backend.Weight > 0 && !strings.Contains(line, fmt.Sprintf(" weight=%d", backend.Weight)) {
+					t.Logf("缺少 weight=%d: %s", backend.Weight, line)
+					return false
+				}
+				if backend.Weight == 0 && proxy.LoadBalanceMethod != LoadBalanceWeighted && strings.Contains(line, "weight=") {
+					t.Logf("未设置权重时不应输出 weight: %s", line)
+					return false
+				}
+				if backend.Backup != strings.HasSuffix(line, " backup;") {
+					t.Logf("backup 标记应为 %v: %s", backend.Backup, line)
+					return false
+				}
+				maxFails, failTimeout := backend.MaxFails, backend.FailTimeout
+				if proxy.HealthCheckEnabled {
+					if maxFails == 0 {
+						maxFails = 3
+					}
+					if failTimeout == 0 {
+						failTimeout = proxy.HealthCheckInterval
+					}
+				}
+				if (maxFails > 0) != strings.Contains(line, fmt.Sprintf(" max_fails=%d", maxFails)) {
+					t.Logf("max_fails 应为 %d: %s", maxFails, line)
+					return false
+				}
+				if (failTimeout > 0) != strings.Contains(line, fmt.Sprintf(" fail_timeout=%ds", failTimeout)) {
+					t.Logf("fail_timeout 应为 %ds: %s", failTimeout, line)
 					return false
 				}
 			}
 			
+			// 使用 upstream 时 proxy_pass 指向 upstream，协议取第一个后端的协议
+			want := fmt.Sprintf("proxy_pass %s://backend_%s;", proxy.Backends[0].scheme(), sanitizeName(website.Domain))
+			if !strings.Contains(config, want) {
+				t.Logf("配置缺少 %s", want)
+				return false
+			}
+			
+			return true
+		},
+		genWebsite(false, true),
+	))
+	
+	// Property 6.2: 旧格式的后端（JSON 字符串数组）与迁移后的结构化配置生成相同的 upstream
+	properties.Property("旧格式后端兼容", prop.ForAll(
+		func(website *Website) bool {
+			proxy := website.ProxyConfig
+			urls := make([]string, len(proxy.Backends))
+			for i, backend := range proxy.Backends {
+				urls[i] = backend.URL
+				proxy.Backends[i] = BackendServer{URL: backend.URL}
+			}
+			structured, err := NewNginxConfigGenerator(website).Generate()
+			if err != nil {
+				t.Logf("配置生成失败: %v", err)
+				return false
+			}
+			
+			legacyJSON, _ := json.Marshal(urls)
+			legacy := *proxy
+			legacy.Backends = nil
+			legacy.Backend = string(legacyJSON)
+			legacySite := *website
+			legacySite.ProxyConfig = &legacy
+			fromLegacy, err := NewNginxConfigGenerator(&legacySite).Generate()
+			if err != nil {
+				t.Logf("旧格式配置生成失败: %v", err)
+				return false
+			}
+			if structured != fromLegacy {
+				t.Logf("旧格式生成的配置不一致:\n%s\n---\n%s", structured, fromLegacy)
+				return false
+			}
+			
+			if err := prepareBackends(&legacy); err != nil || len(legacy.Backends) != len(urls) || legacy.Backend != "" {
+				t.Logf("旧格式迁移失败: %v %+v", err, legacy.Backends)
+				return false
+			}
 			return true
 		},
 		genWebsite(false, true),
@@ -726,3 +868,201 @@ func TestProperty10_ConfigGeneration_Timeout(t *testing.T) {
 	// 运行属性测试（100次迭代）
 	properties.TestingRun(t, gopter.ConsoleReporter(false))
 }
+
+// genSiteWebsite 生成指定站点类型的网站
+// 静态站点和跳转站点不配置 ProxyConfig，用于验证无后端域名的配置生成
+func genSiteWebsite(siteType SiteType, withSSL bool) gopter.Gen {
+	return gopter.CombineGens(
+		genWebsite(withSSL, false),
+		gen.Bool(),                   // 目录索引 / 保留请求路径
+		gen.OneConstOf(301, 302),     // 跳转状态码
+		genValidDomain(),             // 跳转目标域名
+	).Map(func(values []interface{}) *Website {
+		website := values[0].(*Website)
+		toggle := values[1].(bool)
+		website.SiteType = siteType
+
+		switch siteType {
+		case SiteTypeStatic:
+			website.ProxyConfig = nil
+			website.ProxyConfigID = nil
+			website.DocRoot = fmt.Sprintf("/var/www/%s", sanitizeName(website.Domain))
+			website.DirectoryIndex = toggle
+		case SiteTypeRedirect:
+			website.ProxyConfig = nil
+			website.ProxyConfigID = nil
+			website.RedirectURL = fmt.Sprintf("https://%s/", values[3].(string))
+			website.RedirectCode = values[2].(int)
+			website.RedirectKeepURI = toggle
+		}
+		return website
+	})
+}
+
+// TestProperty10_ConfigGeneration_SiteTypes 测试不同站点类型的配置生成
+// 验证反向代理、静态站点、跳转站点在启用/不启用 SSL 时都能生成正确配置
+func TestProperty10_ConfigGeneration_SiteTypes(t *testing.T) {
+	properties := gopter.NewProperties(nil)
+
+	for _, withSSL := range []bool{false, true} {
+		withSSL := withSSL
+		suffix := "（HTTP）"
+		if withSSL {
+			suffix = "（HTTPS）"
+		}
+
+		// Property 15: 反向代理站点保持原有行为
+		properties.Property("反向代理站点生成 proxy_pass"+suffix, prop.ForAll(
+			func(website *Website) bool {
+				config, err := NewNginxConfigGenerator(website).Generate()
+				if err != nil {
+					t.Logf("配置生成失败: %v", err)
+					return false
+				}
+				return strings.Contains(config, "proxy_pass") && checkSSLVariant(t, config, website)
+			},
+			genSiteWebsite(SiteTypeProxy, withSSL),
+		))
+
+		// Property 16: 静态站点托管 docroot，带缓存头和目录索引开关
+		properties.Property("静态站点生成 root 和缓存配置"+suffix, prop.ForAll(
+			func(website *Website) bool {
+				config, err := NewNginxConfigGenerator(website).Generate()
+				if err != nil {
+					t.Logf("配置生成失败: %v", err)
+					return false
+				}
+				if strings.Contains(config, "proxy_pass") {
+					t.Logf("静态站点不应包含 proxy_pass")
+					return false
+				}
+				if !strings.Contains(config, fmt.Sprintf("root %s;", website.DocRoot)) {
+					t.Logf("配置缺少 root 指令: %s", website.DocRoot)
+					return false
+				}
+				if !strings.Contains(config, "try_files $uri $uri/ =404;") || !strings.Contains(config, "expires 30d;") {
+					t.Logf("配置缺少静态文件或缓存配置")
+					return false
+				}
+				autoindex := "autoindex off;"
+				if website.DirectoryIndex {
+					autoindex = "autoindex on;"
+				}
+				if !strings.Contains(config, autoindex) {
+					t.Logf("配置缺少 %s", autoindex)
+					return false
+				}
+				return checkSSLVariant(t, config, website)
+			},
+			genSiteWebsite(SiteTypeStatic, withSSL),
+		))
+
+		// Property 17: 跳转站点返回指定状态码和目标地址
+		properties.Property("跳转站点生成 return 指令"+suffix, prop.ForAll(
+			func(website *Website) bool {
+				config, err := NewNginxConfigGenerator(website).Generate()
+				if err != nil {
+					t.Logf("配置生成失败: %v", err)
+					return false
+				}
+				if strings.Contains(config, "proxy_pass") || strings.Contains(config, "# HTTP to HTTPS redirect") {
+					t.Logf("跳转站点不应包含代理或额外的 HTTPS 跳转")
+					return false
+				}
+				expected := fmt.Sprintf("return %d %s;", website.RedirectCode, website.RedirectURL)
+				if website.RedirectKeepURI {
+					expected = fmt.Sprintf("return %d %s$request_uri;", website.RedirectCode, strings.TrimSuffix(website.RedirectURL, "/"))
+				}
+				if !strings.Contains(config, expected) {
+					t.Logf("配置缺少跳转指令: %s", expected)
+					return false
+				}
+				if website.SSLEnabled && !strings.Contains(config, "listen 443 ssl") {
+					t.Logf("启用 SSL 的跳转站点缺少 HTTPS 监听")
+					return false
+				}
+				return true
+			},
+			genSiteWebsite(SiteTypeRedirect, withSSL),
+		))
+	}
+
+	// 运行属性测试（100次迭代）
+	properties.TestingRun(t, gopter.ConsoleReporter(false))
+}
+
+// TestProperty10_ConfigGeneration_RejectsInjection 测试 docroot 和跳转目标中的 nginx 语法字符被拒绝
+// 这些值原样写入 root 和 return 指令，包含 ; { } 等字符时可以注入任意配置
+func TestProperty10_ConfigGeneration_RejectsInjection(t *testing.T) {
+	properties := gopter.NewProperties(nil)
+	genPayload := gen.OneConstOf(";}include /etc/passwd;#", " /etc", "{", "'", "\"", "$host", "\\", "\n", "\t", "\x00")
+
+	properties.Property("跳转目标包含 nginx 语法字符时拒绝", prop.ForAll(
+		func(website *Website, payload string) bool {
+			website.RedirectURL += "x" + payload
+			if err := validateRedirect(website); !errors.Is(err, ErrInvalidRedirect) {
+				t.Logf("校验未拒绝跳转目标 %q: %v", website.RedirectURL, err)
+				return false
+			}
+			if _, err := NewNginxConfigGenerator(website).Generate(); !errors.Is(err, ErrInvalidRedirect) {
+				t.Logf("配置生成未拒绝跳转目标 %q: %v", website.RedirectURL, err)
+				return false
+			}
+			return true
+		},
+		genSiteWebsite(SiteTypeRedirect, false),
+		genPayload,
+	))
+
+	properties.Property("docroot 包含 nginx 语法字符时拒绝", prop.ForAll(
+		func(website *Website, payload string) bool {
+			website.DocRoot += payload
+			if err := validateSiteConfig(website); !errors.Is(err, ErrInvalidDocRoot) {
+				t.Logf("校验未拒绝 docroot %q: %v", website.DocRoot, err)
+				return false
+			}
+			if _, err := NewNginxConfigGenerator(website).Generate(); !errors.Is(err, ErrInvalidDocRoot) {
+				t.Logf("配置生成未拒绝 docroot %q: %v", website.DocRoot, err)
+				return false
+			}
+			return true
+		},
+		genSiteWebsite(SiteTypeStatic, false),
+		genPayload,
+	))
+
+	// 运行属性测试（100次迭代）
+	properties.TestingRun(t, gopter.ConsoleReporter(false))
+}
+
+// checkSSLVariant 验证 SSL 相关配置与网站设置一致
+func checkSSLVariant(t *testing.T, config string, website *Website) bool {
+	hasSSL := strings.Contains(config, "listen 443 ssl")
+	hasRedirect := strings.Contains(config, "return 301 https://$server_name$request_uri;")
+	if website.SSLEnabled != hasSSL || website.SSLEnabled != hasRedirect {
+		t.Logf("SSL 配置不一致: enabled=%v listen443=%v redirect=%v", website.SSLEnabled, hasSSL, hasRedirect)
+		return false
+	}
+	if website.SSLEnabled && !strings.Contains(config, website.SSLCert.CertPath) {
+		t.Logf("配置缺少证书路径")
+		return false
+	}
+	return true
+}
+
+// upstreamServerLines 按顺序返回 upstream 块中的 server 指令（去掉缩进）
+func upstreamServerLines(config string) []string {
+	start := strings.Index(config, "upstream ")
+	if start < 0 {
+		return nil
+	}
+	end := strings.Index(config[start:], "}")
+	var lines []string
+	for _, line := range strings.Split(config[start:start+end], "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "server ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"regexp"
 
+	"qwq/internal/pagination"
+
 	"gorm.io/gorm"
 )
 
@@ -25,6 +27,11 @@ func (s *websiteService) CreateWebsite(ctx context.Context, website *Website) er
 		return ErrInvalidDomain
 	}
 
+	// 验证站点类型相关配置
+	if err := validateSiteConfig(website); err != nil {
+		return err
+	}
+
 	// 检查域名是否已存在
 	var count int64
 	if err := s.db.WithContext(ctx).Model(&Website{}).
@@ -36,6 +43,11 @@ func (s *websiteService) CreateWebsite(ctx context.Context, website *Website) er
 		return ErrWebsiteExists
 	}
 
+	// 静态站点使用托管目录时创建该目录
+	if err := ensureDocRoot(website); err != nil {
+		return err
+	}
+
 	// 创建网站记录
 	if err := s.db.WithContext(ctx).Create(website).Error; err != nil {
 		return fmt.Errorf("failed to create website: %w", err)
@@ -75,12 +87,9 @@ func (s *websiteService) GetWebsiteByDomain(ctx context.Context, domain string)
 	return &website, nil
 }
 
-// ListWebsites 列出网站
-func (s *websiteService) ListWebsites(ctx context.Context, userID, tenantID uint, page, pageSize int) ([]*Website, int64, error) {
-	var websites []*Website
-	var total int64
-
-	query := s.db.WithContext(ctx).Model(&Website{})
+// ListWebsites 分页列出网站
+func (s *websiteService) ListWebsites(ctx context.Context, userID, tenantID uint, q pagination.Query) (*pagination.Page[*Website], error) {
+	query := s.db.WithContext(ctx).Model(&Website{}).Preload("SSLCert").Preload("ProxyConfig")
 	
 	// 根据租户和用户过滤
 	if tenantID > 0 {
@@ -90,24 +99,11 @@ func (s *websiteService) ListWebsites(ctx context.Context, userID, tenantID uint
 		query = query.Where("user_id = ?", userID)
 	}
 
-	// 获取总数
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count websites: %w", err)
+	page, err := pagination.Find[*Website](query, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list websites: %w", err)
 	}
-
-	// 分页查询
-	offset := (page - 1) * pageSize
-	if err := query.
-		Preload("SSLCert").
-		Preload("ProxyConfig").
-		Offset(offset).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&websites).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to list websites: %w", err)
-	}
-
-	return websites, total, nil
+	return page, nil
 }
 
 // UpdateWebsite 更新网站
@@ -117,6 +113,11 @@ func (s *websiteService) UpdateWebsite(ctx context.Context, website *Website) er
 		return ErrInvalidDomain
 	}
 
+	// 验证站点类型相关配置
+	if err := validateSiteConfig(website); err != nil {
+		return err
+	}
+
 	// 检查网站是否存在
 	var existing Website
 	if err := s.db.WithContext(ctx).First(&existing, website.ID).Error; err != nil {
@@ -139,6 +140,11 @@ func (s *websiteService) UpdateWebsite(ctx context.Context, website *Website) er
 		}
 	}
 
+	// 静态站点使用托管目录时创建该目录
+	if err := ensureDocRoot(website); err != nil {
+		return err
+	}
+
 	// 更新网站记录
 	if err := s.db.WithContext(ctx).Save(website).Error; err != nil {
 		return fmt.Errorf("failed to update website: %w", err)